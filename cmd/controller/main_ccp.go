@@ -24,6 +24,7 @@ import (
 
 	"github.com/Azure/karpenter-provider-azure/pkg/cloudprovider"
 	"github.com/Azure/karpenter-provider-azure/pkg/controllers"
+	"github.com/Azure/karpenter-provider-azure/pkg/debug"
 	"github.com/Azure/karpenter-provider-azure/pkg/operator"
 	"github.com/go-logr/zapr"
 	"github.com/samber/lo"
@@ -45,6 +46,7 @@ func main() {
 	logger := zapr.NewLogger(logging.NewLogger(ctx, "controller"))
 	lo.Must0(operator.WaitForCRDs(ctx, 2*time.Minute, ctrl.GetConfigOrDie(), logger), "failed waiting for CRDs")
 
+	operator.WithLeaderElectionTimings(ctx)
 	ctx, op := operator.NewOperator(coreoperator.NewOperator())
 
 	// TODO: Consider also dumping at least some core options
@@ -59,6 +61,17 @@ func main() {
 	)
 
 	lo.Must0(op.AddHealthzCheck("cloud-provider", aksCloudProvider.LivenessProbe))
+	if port := options.FromContext(ctx).DebugServerPort; port != 0 {
+		lo.Must0(op.Add(debug.NewServer(
+			port,
+			op.GetClient(),
+			aksCloudProvider,
+			op.InstanceTypesProvider,
+			op.NodeImagesCache,
+			op.UnavailableOfferingsCache,
+			op.PricingProvider,
+		)), "adding debug server")
+	}
 
 	cloudProvider := metrics.Decorate(aksCloudProvider)
 	clusterState := state.NewCluster(op.Clock, op.GetClient(), cloudProvider)
@@ -76,6 +89,7 @@ func main() {
 		WithControllers(ctx, controllers.NewControllers(
 			ctx,
 			op.Manager,
+			op.Clock,
 			op.GetClient(),
 			op.EventRecorder,
 			aksCloudProvider,
@@ -84,7 +98,9 @@ func main() {
 			op.KubernetesVersionProvider,
 			op.ImageProvider,
 			op.InClusterKubernetesInterface,
-			op.AZClient.SubnetsClient(),
+			op.AZClient,
+			op.InstanceTypesProvider,
+			op.PricingProvider,
 		)...).
 		Start(ctx)
 }
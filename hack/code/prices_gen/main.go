@@ -137,7 +137,8 @@ func generatePricing(filePath string) {
 		resultsChan := make(chan *pricing.Provider)
 		log.Println("fetching pricing data in region", region)
 		go func(region string, resultsChan chan *pricing.Provider) {
-			pricingProvider := pricing.NewProvider(ctx, env, pricing.NewAPI(cloud), region, make(chan struct{}))
+			pricingProvider := pricing.NewProvider(env, pricing.NewAPI(cloud), region, pricing.DefaultUpdatePeriod)
+			go func() { _ = pricingProvider.Start(ctx) }()
 			attempts := 0
 			for {
 				if pricingProvider.OnDemandLastUpdated().After(updateStarted) {
@@ -0,0 +1,179 @@
+/*
+Portions Copyright (c) Microsoft Corporation.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"go/format"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/samber/lo"
+)
+
+// announcements are the Azure VM size retirement lists, each with a markdown table of series and their retirement dates
+var announcements = []string{
+	"https://raw.githubusercontent.com/MicrosoftDocs/azure-compute-docs/main/articles/virtual-machines/sizes/retirement/retired-sizes-list.md",
+	"https://raw.githubusercontent.com/MicrosoftDocs/azure-compute-docs/main/articles/virtual-machines/sizes/retirement/previous-gen-retirement.md",
+}
+
+// seriesFamilies maps the series names used in the announcements to the SKU families reported by the resource SKUs
+// API, where they don't follow the standard<Series>Family convention.
+var seriesFamilies = map[string][]string{
+	"basica": {"basicAFamily"},
+	"av1":    {"standardA0_A7Family"},
+	"a8-a11": {"standardA8_A11Family"},
+	"nc":     {"standardNCFamily", "standardNCPromoFamily"},
+	"ncv2":   {"standardNCSv2Family"},
+	"ncv3":   {"standardNCSv3Family"},
+	"nd":     {"standardNDSFamily"},
+	"nv":     {"standardNVFamily", "standardNVPromoFamily"},
+	"nvv3":   {"standardNVSv3Family"},
+	"nvv4":   {"standardNVSv4Family"},
+	"h":      {"standardHFamily", "standardHPromoFamily"},
+	"hb":     {"standardHBSFamily"},
+}
+
+var dateFormats = []string{"January 2, 2006", "Jan 2, 2006", "January 2 2006", time.DateOnly, "01/02/2006"}
+
+func main() {
+	flag.Parse()
+	if flag.NArg() != 1 {
+		log.Fatalf("Usage: %s pkg/providers/instancetype/zz_generated.retirement.go", os.Args[0])
+	}
+
+	retirements := map[string]time.Time{}
+	for _, url := range announcements {
+		log.Println("fetching retirement announcements from", url)
+		for series, date := range parseAnnouncement(fetch(url)) {
+			for _, family := range families(series) {
+				retirements[strings.ToLower(family)] = date
+			}
+		}
+	}
+	writeRetirements(flag.Arg(0), retirements)
+}
+
+func fetch(url string) string {
+	resp, err := http.Get(url) // #nosec G107 -- fixed URLs
+	if err != nil {
+		log.Fatalf("fetching %s: %s", url, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		log.Fatalf("fetching %s: %s", url, resp.Status)
+	}
+	return string(lo.Must(io.ReadAll(resp.Body)))
+}
+
+// parseAnnouncement returns the retirement date of each series in the markdown tables of the announcement, which
+// have a series column and a retirement date column.
+func parseAnnouncement(markdown string) map[string]time.Time {
+	retirements := map[string]time.Time{}
+	seriesColumn, dateColumn := -1, -1
+	for _, line := range strings.Split(markdown, "\n") {
+		line = strings.TrimSpace(line)
+		if !strings.HasPrefix(line, "|") {
+			seriesColumn, dateColumn = -1, -1 // end of table
+			continue
+		}
+		cells := lo.Map(strings.Split(strings.Trim(line, "|"), "|"), func(cell string, _ int) string { return strings.TrimSpace(cell) })
+		if seriesColumn < 0 {
+			seriesColumn = lo.IndexOf(lo.Map(cells, func(cell string, _ int) bool { return strings.Contains(strings.ToLower(cell), "series") }), true)
+			dateColumn = lo.IndexOf(lo.Map(cells, func(cell string, _ int) bool { return strings.Contains(strings.ToLower(cell), "retirement date") }), true)
+			continue
+		}
+		if dateColumn < 0 || len(cells) <= max(seriesColumn, dateColumn) || strings.HasPrefix(cells[0], "-") {
+			continue
+		}
+		date, ok := parseDate(cells[dateColumn])
+		if !ok {
+			log.Printf("skipping %s: unrecognized retirement date %q", cells[seriesColumn], cells[dateColumn])
+			continue
+		}
+		for _, series := range strings.Split(stripMarkdown(cells[seriesColumn]), ",") {
+			retirements[normalizeSeries(series)] = date
+		}
+	}
+	return retirements
+}
+
+func parseDate(cell string) (time.Time, bool) {
+	cell = strings.TrimSpace(stripMarkdown(cell))
+	for _, format := range dateFormats {
+		if date, err := time.Parse(format, cell); err == nil {
+			return date, true
+		}
+	}
+	return time.Time{}, false
+}
+
+// stripMarkdown drops links and emphasis, e.g. "[NCv2-series](../ncv2-series.md)" => "NCv2-series"
+func stripMarkdown(cell string) string {
+	if start, end := strings.Index(cell, "["), strings.Index(cell, "]("); start >= 0 && end > start {
+		cell = cell[start+1 : end]
+	}
+	return strings.Trim(cell, "*_ ")
+}
+
+func normalizeSeries(series string) string {
+	series = strings.ToLower(strings.TrimSpace(series))
+	series = strings.TrimSuffix(strings.TrimSuffix(series, " series"), "-series")
+	return strings.ReplaceAll(series, " ", "")
+}
+
+func families(series string) []string {
+	if families, ok := seriesFamilies[series]; ok {
+		return families
+	}
+	return []string{"standard" + strings.ReplaceAll(series, "-", "") + "Family"}
+}
+
+func writeRetirements(filePath string, retirements map[string]time.Time) {
+	src := &bytes.Buffer{}
+	fmt.Fprintln(src, "//go:build !ignore_autogenerated")
+	license := lo.Must(os.ReadFile("hack/boilerplate.go.txt"))
+	fmt.Fprintln(src, string(license))
+	fmt.Fprintln(src, "package instancetype")
+	fmt.Fprintln(src, `import "time"`)
+	fmt.Fprintf(src, "// generated at %s\n\n", time.Now().UTC().Format(time.RFC3339))
+	fmt.Fprintln(src, "// initialSeriesRetirements are the retirement dates of VM series announced by Azure, keyed by lowercase SKU family")
+	fmt.Fprintln(src, "var initialSeriesRetirements = map[string]time.Time{")
+	families := lo.Keys(retirements)
+	sort.Strings(families)
+	for _, family := range families {
+		date := retirements[family]
+		fmt.Fprintf(src, "%q: time.Date(%d, time.%s, %d, 0, 0, 0, 0, time.UTC),\n", family, date.Year(), date.Month(), date.Day())
+	}
+	fmt.Fprintln(src, "}")
+
+	formatted, err := format.Source(src.Bytes())
+	if err != nil {
+		log.Fatalf("formatting generated source: %s", err)
+	}
+	if err := os.WriteFile(filePath, formatted, 0644); err != nil {
+		log.Fatalf("writing output, %s", err)
+	}
+	log.Printf("successfully generated retirement file: \"%s\"\n", filePath)
+}
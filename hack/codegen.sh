@@ -29,6 +29,17 @@ locationsgen() {
   checkForUpdates "${GIT_DIFF}" "${NO_UPDATE}" "${SUBJECT} beside timestamps since last update" "${GENERATED_FILE}"
 }
 
+retirementgen() {
+  GENERATED_FILE="pkg/providers/instancetype/zz_generated.retirement.go"
+  NO_UPDATE=$' pkg/providers/instancetype/zz_generated.retirement.go | 2 +-\n 1 file changed, 1 insertion(+), 1 deletion(-)'
+  SUBJECT="Retirement"
+
+  go run hack/code/retirement_gen/main.go -- "${GENERATED_FILE}"
+
+  GIT_DIFF=$(git diff --stat "${GENERATED_FILE}")
+  checkForUpdates "${GIT_DIFF}" "${NO_UPDATE}" "${SUBJECT} beside timestamps since last update" "${GENERATED_FILE}"
+}
+
 skugen() {
   location=${1:-eastus}
 
@@ -107,4 +118,5 @@ fi
 # Run all the codegen scripts
 pricing
 locationsgen
+retirementgen
 skugen-all
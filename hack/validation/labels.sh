@@ -13,11 +13,16 @@ rule=$'self.all(x, x in
         "karpenter.azure.com/sku-cpu",
         "karpenter.azure.com/sku-memory",
         "karpenter.azure.com/sku-networking-accelerated",
+        "karpenter.azure.com/sku-networking-bandwidth-mbps",
         "karpenter.azure.com/sku-storage-premium-capable",
         "karpenter.azure.com/sku-storage-ephemeralos-maxsize",
+        "karpenter.azure.com/sku-storage-local-protocol",
+        "karpenter.azure.com/sku-storage-local-count",
+        "karpenter.azure.com/sku-storage-local-size",
         "karpenter.azure.com/sku-gpu-name",
         "karpenter.azure.com/sku-gpu-manufacturer",
-        "karpenter.azure.com/sku-gpu-count"
+        "karpenter.azure.com/sku-gpu-count",
+        "karpenter.azure.com/sku-confidential-computing"
     ]
     || !x.find("^([^/]+)").endsWith("karpenter.azure.com")
 )
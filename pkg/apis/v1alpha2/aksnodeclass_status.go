@@ -21,6 +21,7 @@ import (
 
 	"github.com/awslabs/operatorpkg/status"
 	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 )
 
 const (
@@ -39,6 +40,31 @@ type NodeImage struct {
 	// Requirements of the image to be utilized on an instance type
 	// +required
 	Requirements []corev1.NodeSelectorRequirement `json:"requirements"`
+	// Channel the image version was selected from, Preview if it is a preview version
+	// +optional
+	Channel ImageChannel `json:"channel,omitempty"`
+	// Pinned is true if the image version is the version pinned by the imageVersion of the AKSNodeClass
+	// +optional
+	Pinned bool `json:"pinned,omitempty"`
+	// Distro of the default image the image is a version of, e.g. aks-ubuntu-containerd-22.04-gen2
+	// +optional
+	Distro string `json:"distro,omitempty"`
+	// PublishedDate is when the image version was published, if the image source reports it
+	// +optional
+	PublishedDate *metav1.Time `json:"publishedDate,omitempty"`
+}
+
+// MaintenanceWindowStatus is the state of a maintenance window
+type MaintenanceWindowStatus struct {
+	// Open is whether the maintenance window is open, allowing the voluntary disruption of nodes
+	// +required
+	Open bool `json:"open"`
+	// CloseTime is when the maintenance window closes, while it's open
+	// +optional
+	CloseTime *metav1.Time `json:"closeTime,omitempty"`
+	// NextOpenTime is when the maintenance window next opens
+	// +optional
+	NextOpenTime *metav1.Time `json:"nextOpenTime,omitempty"`
 }
 
 // AKSNodeClassStatus contains the resolved state of the AKSNodeClass
@@ -51,6 +77,17 @@ type AKSNodeClassStatus struct {
 	// used for nodes provisioned for the NodeClass
 	// +optional
 	KubernetesVersion string `json:"kubernetesVersion,omitempty"`
+	// MaintenanceWindow is the state of the maintenance window of the NodeClass, if it has one
+	// +optional
+	MaintenanceWindow *MaintenanceWindowStatus `json:"maintenanceWindow,omitempty"`
+	// ImageCacheRefresh is the value of the image-cache-refresh annotation of the NodeClass that its images were last
+	// refreshed for
+	// +optional
+	ImageCacheRefresh string `json:"imageCacheRefresh,omitempty"`
+	// Zones are the zones of the region the instance types of the NodeClass are offered in, updated as zones are
+	// added to the region
+	// +optional
+	Zones []string `json:"zones,omitempty"`
 	// Conditions contains signals for health and readiness
 	// +optional
 	Conditions []status.Condition `json:"conditions,omitempty"`
@@ -21,5 +21,10 @@ const (
 	Ubuntu2204ImageFamily = "Ubuntu2204"
 	Ubuntu2404ImageFamily = "Ubuntu2404"
 	AzureLinuxImageFamily = "AzureLinux"
-	CustomImageFamily     = "Custom"
+	// AzureLinux3ImageFamily is Azure Linux 3.0, whatever the Kubernetes version. The AzureLinux image family is Azure
+	// Linux 2.0 before Kubernetes 1.32, and Azure Linux 3.0 from it.
+	AzureLinux3ImageFamily = "AzureLinux3"
+	// Windows2022ImageFamily is Windows Server 2022 with containerd, the only image family of Windows nodes
+	Windows2022ImageFamily = "Windows2022"
+	CustomImageFamily      = "Custom"
 )
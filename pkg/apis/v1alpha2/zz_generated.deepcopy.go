@@ -23,6 +23,7 @@ package v1alpha2
 import (
 	"github.com/awslabs/operatorpkg/status"
 	"k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
 )
 
@@ -93,12 +94,43 @@ func (in *AKSNodeClassSpec) DeepCopyInto(out *AKSNodeClassSpec) {
 		*out = new(string)
 		**out = **in
 	}
+	if in.SubscriptionID != nil {
+		in, out := &in.SubscriptionID, &out.SubscriptionID
+		*out = new(string)
+		**out = **in
+	}
+	if in.ResourceGroup != nil {
+		in, out := &in.ResourceGroup, &out.ResourceGroup
+		*out = new(string)
+		**out = **in
+	}
+	if in.KubeletIdentityClientID != nil {
+		in, out := &in.KubeletIdentityClientID, &out.KubeletIdentityClientID
+		*out = new(string)
+		**out = **in
+	}
+	if in.KubeletIdentityResourceID != nil {
+		in, out := &in.KubeletIdentityResourceID, &out.KubeletIdentityResourceID
+		*out = new(string)
+		**out = **in
+	}
 	if in.OSDiskSizeGB != nil {
 		in, out := &in.OSDiskSizeGB, &out.OSDiskSizeGB
 		*out = new(int32)
 		**out = **in
 	}
-	out.CustomImageTerm = in.CustomImageTerm
+	if in.CustomImageTerm != nil {
+		in, out := &in.CustomImageTerm, &out.CustomImageTerm
+		*out = new(CustomImageTerm)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.CustomImageTerms != nil {
+		in, out := &in.CustomImageTerms, &out.CustomImageTerms
+		*out = make([]CustomImageTerm, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
 	if in.ImageFamily != nil {
 		in, out := &in.ImageFamily, &out.ImageFamily
 		*out = new(string)
@@ -109,6 +141,46 @@ func (in *AKSNodeClassSpec) DeepCopyInto(out *AKSNodeClassSpec) {
 		*out = new(FIPSMode)
 		**out = **in
 	}
+	if in.KubernetesVersion != nil {
+		in, out := &in.KubernetesVersion, &out.KubernetesVersion
+		*out = new(string)
+		**out = **in
+	}
+	if in.ImageChannel != nil {
+		in, out := &in.ImageChannel, &out.ImageChannel
+		*out = new(ImageChannel)
+		**out = **in
+	}
+	if in.ImageVersion != nil {
+		in, out := &in.ImageVersion, &out.ImageVersion
+		*out = new(string)
+		**out = **in
+	}
+	if in.ImageVersionConstraint != nil {
+		in, out := &in.ImageVersionConstraint, &out.ImageVersionConstraint
+		*out = new(string)
+		**out = **in
+	}
+	if in.ImageID != nil {
+		in, out := &in.ImageID, &out.ImageID
+		*out = new(string)
+		**out = **in
+	}
+	if in.ImageDistroName != nil {
+		in, out := &in.ImageDistroName, &out.ImageDistroName
+		*out = new(string)
+		**out = **in
+	}
+	if in.MarketplaceImage != nil {
+		in, out := &in.MarketplaceImage, &out.MarketplaceImage
+		*out = new(MarketplaceImageTerm)
+		**out = **in
+	}
+	if in.ImageDriftDisabled != nil {
+		in, out := &in.ImageDriftDisabled, &out.ImageDriftDisabled
+		*out = new(bool)
+		**out = **in
+	}
 	if in.Tags != nil {
 		in, out := &in.Tags, &out.Tags
 		*out = make(map[string]string, len(*in))
@@ -131,6 +203,21 @@ func (in *AKSNodeClassSpec) DeepCopyInto(out *AKSNodeClassSpec) {
 		*out = new(Security)
 		(*in).DeepCopyInto(*out)
 	}
+	if in.PatchSettings != nil {
+		in, out := &in.PatchSettings, &out.PatchSettings
+		*out = new(PatchSettings)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.MaintenanceWindow != nil {
+		in, out := &in.MaintenanceWindow, &out.MaintenanceWindow
+		*out = new(MaintenanceWindow)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.LocalStorageConsolidateAfter != nil {
+		in, out := &in.LocalStorageConsolidateAfter, &out.LocalStorageConsolidateAfter
+		*out = new(metav1.Duration)
+		**out = **in
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new AKSNodeClassSpec.
@@ -153,6 +240,16 @@ func (in *AKSNodeClassStatus) DeepCopyInto(out *AKSNodeClassStatus) {
 			(*in)[i].DeepCopyInto(&(*out)[i])
 		}
 	}
+	if in.MaintenanceWindow != nil {
+		in, out := &in.MaintenanceWindow, &out.MaintenanceWindow
+		*out = new(MaintenanceWindowStatus)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.Zones != nil {
+		in, out := &in.Zones, &out.Zones
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
 	if in.Conditions != nil {
 		in, out := &in.Conditions, &out.Conditions
 		*out = make([]status.Condition, len(*in))
@@ -175,6 +272,13 @@ func (in *AKSNodeClassStatus) DeepCopy() *AKSNodeClassStatus {
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *CustomImageTerm) DeepCopyInto(out *CustomImageTerm) {
 	*out = *in
+	if in.VersionTagSelector != nil {
+		in, out := &in.VersionTagSelector, &out.VersionTagSelector
+		*out = make(map[string]string, len(*in))
+		for key, val := range *in {
+			(*out)[key] = val
+		}
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new CustomImageTerm.
@@ -187,6 +291,31 @@ func (in *CustomImageTerm) DeepCopy() *CustomImageTerm {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *InsecureKubeletDefaults) DeepCopyInto(out *InsecureKubeletDefaults) {
+	*out = *in
+	if in.ReadOnlyPort != nil {
+		in, out := &in.ReadOnlyPort, &out.ReadOnlyPort
+		*out = new(int32)
+		**out = **in
+	}
+	if in.AnonymousAuth != nil {
+		in, out := &in.AnonymousAuth, &out.AnonymousAuth
+		*out = new(bool)
+		**out = **in
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new InsecureKubeletDefaults.
+func (in *InsecureKubeletDefaults) DeepCopy() *InsecureKubeletDefaults {
+	if in == nil {
+		return nil
+	}
+	out := new(InsecureKubeletDefaults)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *KubeletConfiguration) DeepCopyInto(out *KubeletConfiguration) {
 	*out = *in
@@ -221,6 +350,11 @@ func (in *KubeletConfiguration) DeepCopyInto(out *KubeletConfiguration) {
 		*out = new(int64)
 		**out = **in
 	}
+	if in.InsecureKubeletDefaults != nil {
+		in, out := &in.InsecureKubeletDefaults, &out.InsecureKubeletDefaults
+		*out = new(InsecureKubeletDefaults)
+		(*in).DeepCopyInto(*out)
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new KubeletConfiguration.
@@ -233,6 +367,105 @@ func (in *KubeletConfiguration) DeepCopy() *KubeletConfiguration {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *LinuxAutomaticByPlatformSettings) DeepCopyInto(out *LinuxAutomaticByPlatformSettings) {
+	*out = *in
+	if in.BypassPlatformSafetyChecksOnUserSchedule != nil {
+		in, out := &in.BypassPlatformSafetyChecksOnUserSchedule, &out.BypassPlatformSafetyChecksOnUserSchedule
+		*out = new(bool)
+		**out = **in
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new LinuxAutomaticByPlatformSettings.
+func (in *LinuxAutomaticByPlatformSettings) DeepCopy() *LinuxAutomaticByPlatformSettings {
+	if in == nil {
+		return nil
+	}
+	out := new(LinuxAutomaticByPlatformSettings)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *LinuxPatchSettings) DeepCopyInto(out *LinuxPatchSettings) {
+	*out = *in
+	if in.AutomaticByPlatformSettings != nil {
+		in, out := &in.AutomaticByPlatformSettings, &out.AutomaticByPlatformSettings
+		*out = new(LinuxAutomaticByPlatformSettings)
+		(*in).DeepCopyInto(*out)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new LinuxPatchSettings.
+func (in *LinuxPatchSettings) DeepCopy() *LinuxPatchSettings {
+	if in == nil {
+		return nil
+	}
+	out := new(LinuxPatchSettings)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *MaintenanceWindow) DeepCopyInto(out *MaintenanceWindow) {
+	*out = *in
+	out.Duration = in.Duration
+	if in.TimeZone != nil {
+		in, out := &in.TimeZone, &out.TimeZone
+		*out = new(string)
+		**out = **in
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new MaintenanceWindow.
+func (in *MaintenanceWindow) DeepCopy() *MaintenanceWindow {
+	if in == nil {
+		return nil
+	}
+	out := new(MaintenanceWindow)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *MaintenanceWindowStatus) DeepCopyInto(out *MaintenanceWindowStatus) {
+	*out = *in
+	if in.CloseTime != nil {
+		in, out := &in.CloseTime, &out.CloseTime
+		*out = (*in).DeepCopy()
+	}
+	if in.NextOpenTime != nil {
+		in, out := &in.NextOpenTime, &out.NextOpenTime
+		*out = (*in).DeepCopy()
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new MaintenanceWindowStatus.
+func (in *MaintenanceWindowStatus) DeepCopy() *MaintenanceWindowStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(MaintenanceWindowStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *MarketplaceImageTerm) DeepCopyInto(out *MarketplaceImageTerm) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new MarketplaceImageTerm.
+func (in *MarketplaceImageTerm) DeepCopy() *MarketplaceImageTerm {
+	if in == nil {
+		return nil
+	}
+	out := new(MarketplaceImageTerm)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *NodeImage) DeepCopyInto(out *NodeImage) {
 	*out = *in
@@ -243,6 +476,10 @@ func (in *NodeImage) DeepCopyInto(out *NodeImage) {
 			(*in)[i].DeepCopyInto(&(*out)[i])
 		}
 	}
+	if in.PublishedDate != nil {
+		in, out := &in.PublishedDate, &out.PublishedDate
+		*out = (*in).DeepCopy()
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new NodeImage.
@@ -255,6 +492,26 @@ func (in *NodeImage) DeepCopy() *NodeImage {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *PatchSettings) DeepCopyInto(out *PatchSettings) {
+	*out = *in
+	if in.Linux != nil {
+		in, out := &in.Linux, &out.Linux
+		*out = new(LinuxPatchSettings)
+		(*in).DeepCopyInto(*out)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new PatchSettings.
+func (in *PatchSettings) DeepCopy() *PatchSettings {
+	if in == nil {
+		return nil
+	}
+	out := new(PatchSettings)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *Security) DeepCopyInto(out *Security) {
 	*out = *in
@@ -263,6 +520,26 @@ func (in *Security) DeepCopyInto(out *Security) {
 		*out = new(bool)
 		**out = **in
 	}
+	if in.SecurityType != nil {
+		in, out := &in.SecurityType, &out.SecurityType
+		*out = new(SecurityType)
+		**out = **in
+	}
+	if in.SecureBootEnabled != nil {
+		in, out := &in.SecureBootEnabled, &out.SecureBootEnabled
+		*out = new(bool)
+		**out = **in
+	}
+	if in.VTPMEnabled != nil {
+		in, out := &in.VTPMEnabled, &out.VTPMEnabled
+		*out = new(bool)
+		**out = **in
+	}
+	if in.CustomCATrustCertificates != nil {
+		in, out := &in.CustomCATrustCertificates, &out.CustomCATrustCertificates
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new Security.
@@ -31,15 +31,63 @@ var (
 	FIPSModeDisabled = FIPSMode("Disabled")
 )
 
+// SecurityType is the security type of the VMs of the provisioned nodes
+type SecurityType string
+
+var (
+	SecurityTypeStandard       = SecurityType("Standard")
+	SecurityTypeTrustedLaunch  = SecurityType("TrustedLaunch")
+	SecurityTypeConfidentialVM = SecurityType("ConfidentialVM")
+)
+
+type ImageChannel string
+
+var (
+	ImageChannelStable  = ImageChannel("Stable")
+	ImageChannelPreview = ImageChannel("Preview")
+)
+
 // AKSNodeClassSpec is the top level specification for the AKS Karpenter Provider.
 // This will contain configuration necessary to launch instances in AKS.
 // +kubebuilder:validation:XValidation:message="FIPS is not yet supported for Ubuntu2204 or Ubuntu2404",rule="has(self.fipsMode) && self.fipsMode == 'FIPS' ? (has(self.imageFamily) && self.imageFamily != 'Ubuntu2204' && self.imageFamily != 'Ubuntu2404') : true"
+// +kubebuilder:validation:XValidation:message="kubeletIdentityClientID and kubeletIdentityResourceID must be set together",rule="has(self.kubeletIdentityClientID) == has(self.kubeletIdentityResourceID)"
+// +kubebuilder:validation:XValidation:message="imageVersion and imageVersionConstraint are mutually exclusive",rule="!(has(self.imageVersion) && has(self.imageVersionConstraint))"
+// +kubebuilder:validation:XValidation:message="imageID and customImageTerms are mutually exclusive",rule="!(has(self.imageID) && has(self.customImageTerms))"
+// +kubebuilder:validation:XValidation:message="customImageTerm and customImageTerms are mutually exclusive",rule="!(has(self.customImageTerm) && has(self.customImageTerms))"
+// +kubebuilder:validation:XValidation:message="imageID is mutually exclusive with imageVersion and imageVersionConstraint",rule="has(self.imageID) ? !has(self.imageVersion) && !has(self.imageVersionConstraint) : true"
+// +kubebuilder:validation:XValidation:message="imageID and imageDistroName must be set together",rule="has(self.imageID) == has(self.imageDistroName)"
+// +kubebuilder:validation:XValidation:message="securityType ConfidentialVM is only supported for the default images of the Ubuntu2204 image family, without FIPS",rule="has(self.security) && has(self.security.securityType) && self.security.securityType == 'ConfidentialVM' ? (has(self.imageFamily) && self.imageFamily == 'Ubuntu2204' && !(has(self.fipsMode) && self.fipsMode == 'FIPS') && !has(self.imageID) && !has(self.marketplaceImage)) : true"
+// +kubebuilder:validation:XValidation:message="marketplaceImage is mutually exclusive with customImageTerms, imageID, imageVersion and imageVersionConstraint",rule="has(self.marketplaceImage) ? !has(self.customImageTerms) && !has(self.imageID) && !has(self.imageVersion) && !has(self.imageVersionConstraint) : true"
 type AKSNodeClassSpec struct {
 	// VNETSubnetID is the subnet used by nics provisioned with this nodeclass.
 	// If not specified, we will use the default --vnet-subnet-id specified in karpenter's options config
 	// +kubebuilder:validation:Pattern=`(?i)^\/subscriptions\/[^\/]+\/resourceGroups\/[a-zA-Z0-9_\-().]{0,89}[a-zA-Z0-9_\-()]\/providers\/Microsoft\.Network\/virtualNetworks\/[^\/]+\/subnets\/[^\/]+$`
 	// +optional
 	VNETSubnetID *string `json:"vnetSubnetID,omitempty"`
+	// SubscriptionID is the subscription the VMs and network interfaces of nodes provisioned with this nodeclass are created in.
+	// The resource group must exist in the subscription, and vnetSubnetID must be a subnet of a virtual network in the
+	// subscription. The network interfaces of nodes in another subscription than the cluster's are neither added to the
+	// backend pools of the cluster's load balancers nor associated with its network security group, which can't be
+	// referenced across subscriptions, so the subnet must provide the outbound connectivity of the nodes.
+	// If not specified, the cluster's subscription is used.
+	// +kubebuilder:validation:Pattern=`^[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}$`
+	// +optional
+	SubscriptionID *string `json:"subscriptionID,omitempty"`
+	// ResourceGroup is the resource group the VMs and network interfaces of nodes provisioned with this nodeclass are
+	// created in, in the subscription of the nodeclass. If not specified, the node resource group of the cluster is used.
+	// +kubebuilder:validation:Pattern=`^[a-zA-Z0-9_\-().]{0,89}[a-zA-Z0-9_\-()]$`
+	// +optional
+	ResourceGroup *string `json:"resourceGroup,omitempty"`
+	// KubeletIdentityClientID is the client ID of the user-assigned managed identity kubelet uses on nodes provisioned
+	// with this nodeclass, e.g. to pull images from ACR, instead of the cluster's kubelet identity.
+	// kubeletIdentityResourceID must be set to the resource ID of the same identity.
+	// +kubebuilder:validation:Pattern=`^[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}$`
+	// +optional
+	KubeletIdentityClientID *string `json:"kubeletIdentityClientID,omitempty"`
+	// KubeletIdentityResourceID is the resource ID of the kubelet identity, which is assigned to the VMs.
+	// +kubebuilder:validation:Pattern=`(?i)^\/subscriptions\/[^\/]+\/resourceGroups\/[^\/]+\/providers\/Microsoft\.ManagedIdentity\/userAssignedIdentities\/[^\/]+$`
+	// +optional
+	KubeletIdentityResourceID *string `json:"kubeletIdentityResourceID,omitempty"`
 	// +kubebuilder:default=50
 	// +kubebuilder:validation:Minimum=30
 	// +kubebuilder:validation:Maximum=2048
@@ -49,17 +97,76 @@ type AKSNodeClassSpec struct {
 	// +kubebuilder:validation:Optional
 	// OSDiskSizeDynamic is enable dynamic os disk size based on SKU max allowed disk
 	OSDiskSizeDynamic bool `json:"OSDiskSizeDynamic,omitempty"`
-	// CustomImageTerm is for user defined Azure Custom Images
+	// CustomImageTerm is for user defined Azure Custom Images.
+	// Deprecated: use customImageTerms. When set, it is the only custom image term.
+	// +optional
+	CustomImageTerm *CustomImageTerm `json:"customImageTerm,omitempty" hash:"ignore"`
+	// CustomImageTerms are the user defined Azure Custom Images of the Custom image family, in order of priority. Each
+	// instance type launches with the image of the first term whose architecture and Hyper-V generation it supports,
+	// so that nodepools can mix instance types of different architectures.
+	// +kubebuilder:validation:MaxItems:=8
 	// +optional
-	CustomImageTerm CustomImageTerm `json:"customImageTerm,omitempty" hash:"ignore"`
+	CustomImageTerms []CustomImageTerm `json:"customImageTerms,omitempty" hash:"ignore"`
 	// ImageFamily is the image family that instances use.
 	// +kubebuilder:default=Ubuntu
-	// +kubebuilder:validation:Enum:={Ubuntu,Ubuntu2204,Ubuntu2404,AzureLinux,Custom}
+	// +kubebuilder:validation:Enum:={Ubuntu,Ubuntu2204,Ubuntu2404,AzureLinux,AzureLinux3,Windows2022,Custom}
 	ImageFamily *string `json:"imageFamily,omitempty"`
 	// FIPSMode controls FIPS compliance for the provisioned nodes
 	// +kubebuilder:validation:Enum:={FIPS,Disabled}
 	// +optional
 	FIPSMode *FIPSMode `json:"fipsMode,omitempty"`
+	// KubernetesVersion overrides the Kubernetes version discovered from the API server, which the nodes are bootstrapped
+	// with and their images are selected for, e.g. to keep launching nodes of the previous minor version for a while after
+	// upgrading the control plane. It can't be ahead of the API server, nor more than two minor versions behind it, or the
+	// Kubernetes version isn't ready. Changing it replaces the nodes of the previous version.
+	// +kubebuilder:validation:Pattern=`^[0-9]+\.[0-9]+\.[0-9]+$`
+	// +optional
+	KubernetesVersion *string `json:"kubernetesVersion,omitempty" hash:"ignore"`
+	// ImageChannel controls which node image versions are eligible when selecting the latest version of an image.
+	// Stable only selects GA versions, while Preview also selects the versions published as previews, e.g. for upcoming
+	// Kubernetes releases.
+	// +kubebuilder:default=Stable
+	// +kubebuilder:validation:Enum:={Stable,Preview}
+	// +optional
+	ImageChannel *ImageChannel `json:"imageChannel,omitempty" hash:"ignore"`
+	// ImageVersion pins the version of the images of the image family, e.g. 202410.09.0, instead of selecting their latest
+	// version of the image channel. The version must exist for all the images of the image family, or the images aren't
+	// ready. Removing it selects the latest versions again, replacing the nodes of the pinned version.
+	// It doesn't apply to the Custom image family, whose versions are pinned by its customImageTerms.
+	// +kubebuilder:validation:Pattern=`^[0-9]+\.[0-9]+\.[0-9]+$`
+	// +optional
+	ImageVersion *string `json:"imageVersion,omitempty" hash:"ignore"`
+	// ImageVersionConstraint restricts the versions of the images of the image family selected as their latest version,
+	// e.g. ">=202401.0.0 <202501.0.0" for any version of 2024. Versions are compared as semantic versions, and constraints
+	// are comparisons (=, !=, <, <=, >, >=) of versions or wildcard versions, e.g. 202402.x, ANDed by spaces and ORed by ||.
+	// The images aren't ready if none of the versions of one of them satisfies the constraint.
+	// +kubebuilder:validation:MaxLength=256
+	// +kubebuilder:validation:XValidation:message="imageVersionConstraint must be comparisons of versions, e.g. '>=202401.0.0 <202501.0.0', separated by spaces or ' || '",rule="self.matches('^ *(<=|>=|==|!=|<|>|=|!)?[0-9]+([.][0-9x]+){0,2}(-[0-9A-Za-z.-]+)?( +([|][|] +)?(<=|>=|==|!=|<|>|=|!)?[0-9]+([.][0-9x]+){0,2}(-[0-9A-Za-z.-]+)?)* *$')"
+	// +optional
+	ImageVersionConstraint *string `json:"imageVersionConstraint,omitempty" hash:"ignore"`
+	// ImageID is the resource ID of the image version instances launch with, instead of the images of the image family
+	// or customImageTerms, e.g. /subscriptions/<id>/resourceGroups/<rg>/providers/Microsoft.Compute/galleries/<gallery>/images/<image>/versions/<version>
+	// for a shared image gallery image, or /CommunityGalleries/<gallery>/images/<image>/versions/<version> for a community
+	// gallery image. The image isn't looked up, so it must exist and support the instance types of the nodepools.
+	// Changing it replaces the nodes.
+	// +kubebuilder:validation:Pattern=`(?i)^(/subscriptions/[^/]+/resourceGroups/[^/]+/providers/Microsoft\.Compute/galleries/[^/]+|/CommunityGalleries/[^/]+)/images/[^/]+/versions/[^/]+$`
+	// +optional
+	ImageID *string `json:"imageID,omitempty"`
+	// ImageDistroName is the aks container service agent pool distro name of the image of the imageID, which the nodes
+	// are bootstrapped for, e.g. aks-ubuntu-containerd-22.04-gen2. It's required with the imageID.
+	// Here are all distro https://github.com/Azure/AgentBaker/blob/dev/pkg/agent/datamodel/types.go#L144.
+	// +kubebuilder:validation:MinLength=1
+	// +optional
+	ImageDistroName *string `json:"imageDistroName,omitempty"`
+	// MarketplaceImage is the Azure Marketplace image instances launch with, instead of the images of the image family,
+	// e.g. a hardened image published to the marketplace rather than to a compute gallery. The image family still
+	// determines how the nodes are bootstrapped. Changing it replaces the nodes.
+	// +optional
+	MarketplaceImage *MarketplaceImageTerm `json:"marketplaceImage,omitempty" hash:"ignore"`
+	// ImageDriftDisabled, when true, keeps the existing nodes on the images they were launched with rather than replacing
+	// them once newer images are resolved. New nodes still launch with the latest images.
+	// +optional
+	ImageDriftDisabled *bool `json:"imageDriftDisabled,omitempty" hash:"ignore"`
 	// Tags to be applied on Azure resources like instances.
 	// +kubebuilder:validation:XValidation:message="tags keys must be less than 512 characters",rule="self.all(k, size(k) <= 512)"
 	// +kubebuilder:validation:XValidation:message="tags keys must not contain '<', '>', '%', '&', or '?'",rule="self.all(k, !k.matches('[<>%&?]'))"
@@ -88,15 +195,44 @@ type AKSNodeClassSpec struct {
 
 	// Collection of security related karpenter fields
 	Security *Security `json:"security,omitempty"`
+	// PatchSettings are the guest patching settings of the OS of provisioned nodes, in the osProfile of their VMs.
+	// Settings left unset keep the Azure defaults.
+	// +optional
+	PatchSettings *PatchSettings `json:"patchSettings,omitempty"`
+	// MaintenanceWindow restricts the voluntary disruption of the nodes of this nodeclass, i.e. their consolidation and the
+	// replacement of drifted nodes, e.g. on image upgrades, to a recurring window. Outside of it, the nodes are annotated
+	// with karpenter.sh/do-not-disrupt. The involuntary disruption of nodes, e.g. on spot evictions or by node repair, and
+	// their expiration are never blocked. If not specified, voluntary disruption is only restricted by the nodepool budgets.
+	// +optional
+	MaintenanceWindow *MaintenanceWindow `json:"maintenanceWindow,omitempty" hash:"ignore"`
+	// LocalStorageConsolidateAfter is how long after their launch the nodes of instance types with local disks, e.g. the
+	// NVMe disks of the Lsv3 series, are protected from consolidation, as the data on their local disks is expensive to
+	// rehydrate elsewhere. Meanwhile, the nodes are annotated with karpenter.sh/do-not-disrupt, unless they drifted, so the
+	// replacement of drifted nodes, as well as their expiration and involuntary disruption, still apply. If not specified,
+	// these nodes are consolidated like any other.
+	// +kubebuilder:validation:Pattern=`^((([0-9]+(h|m))|([0-9]+h[0-9]+m))(0s)?)$`
+	// +kubebuilder:validation:Type="string"
+	// +optional
+	LocalStorageConsolidateAfter *metav1.Duration `json:"localStorageConsolidateAfter,omitempty" hash:"ignore"`
 }
 
 // CustomImageTerm defines selection logic for Custom Image used by Karpenter to launch nodes.
 // If multiple fields are used for selection, the requirements are ANDed.
+// +kubebuilder:validation:XValidation:message="version and versionConstraint are mutually exclusive",rule="!(has(self.version) && has(self.versionConstraint))"
+// +kubebuilder:validation:XValidation:message="sharedGalleryUniqueName can't be set along with galleryResourceGroupName or galleryName",rule="!has(self.sharedGalleryUniqueName) || !(has(self.galleryResourceGroupName) || has(self.galleryName))"
+// +kubebuilder:validation:XValidation:message="version and versionTagSelector are mutually exclusive",rule="!(has(self.version) && has(self.versionTagSelector))"
 type CustomImageTerm struct {
 	// GallerySubscriptionID is Image Gallery Subscription ID.
 	// +kubebuilder:validation:Pattern="^\\w{8}-\\w{4}-\\w{4}-\\w{4}-\\w{12}$"
 	// +optional
 	GallerySubscriptionID string `json:"gallerySubscriptionID,omitempty"`
+	// TenantID is the Microsoft Entra tenant of the gallery, when it's in another tenant than the cluster's. The gallery
+	// is looked up with a credential of the tenant, and nodes are created with an auxiliary token of the tenant, which
+	// the credential of the controller must be able to obtain, e.g. as a multitenant application. The tenant must be
+	// listed in the additionally-allowed-tenants of the controller.
+	// +kubebuilder:validation:Pattern="^\\w{8}-\\w{4}-\\w{4}-\\w{4}-\\w{12}$"
+	// +optional
+	TenantID string `json:"tenantID,omitempty"`
 	// GalleryResourceGroupName is Image Gallery Resource Group Name.
 	// This value is the name field, which is different from the name tag.
 	// +optional
@@ -105,6 +241,12 @@ type CustomImageTerm struct {
 	// This value is the name field, which is different from the name tag.
 	// +optional
 	GalleryName string `json:"galleryName,omitempty"`
+	// SharedGalleryUniqueName is the unique name of a gallery directly shared with the subscription or tenant, e.g.
+	// 11111111-1111-1111-1111-111111111111-MYGALLERY, to look the image up in rather than a gallery of a resource group.
+	// The gallery is looked up in the location of the cluster, from the gallerySubscriptionID, defaulting to the cluster's.
+	// +kubebuilder:validation:MinLength=1
+	// +optional
+	SharedGalleryUniqueName string `json:"sharedGalleryUniqueName,omitempty"`
 	// Name is the Image name in Azure Image Gallery.
 	// This value is the name field, which is different from the name tag.
 	// +optional
@@ -119,9 +261,123 @@ type CustomImageTerm struct {
 	// You can leave it empty and get latest image version
 	// +optional
 	Version string `json:"version,omitempty"`
+	// VersionConstraint restricts the versions of the image selected as its latest version, e.g. ">=1.2.0 <2.0.0", as
+	// the imageVersionConstraint of the AKSNodeClass. It can't be set along with the version.
+	// +kubebuilder:validation:MaxLength=256
+	// +kubebuilder:validation:XValidation:message="versionConstraint must be comparisons of versions, e.g. '>=1.2.0 <2.0.0', separated by spaces or ' || '",rule="self.matches('^ *(<=|>=|==|!=|<|>|=|!)?[0-9]+([.][0-9x]+){0,2}(-[0-9A-Za-z.-]+)?( +([|][|] +)?(<=|>=|==|!=|<|>|=|!)?[0-9]+([.][0-9x]+){0,2}(-[0-9A-Za-z.-]+)?)* *$')"
+	// +optional
+	VersionConstraint string `json:"versionConstraint,omitempty"`
+	// VersionTagSelector restricts the versions of the image selected as its latest version to those with all of its
+	// tags, e.g. {"validated": "true"} for the versions an image pipeline tagged once soak tested. Provisioning is blocked
+	// while no version of the image has them. The tags of the versions of directly shared galleries are their artifact
+	// tags. It can't be set along with the version.
+	// +kubebuilder:validation:MaxProperties=10
+	// +optional
+	VersionTagSelector map[string]string `json:"versionTagSelector,omitempty"`
+	// Architecture is the CPU architecture of the image, which the instance types must have.
+	// You can leave it empty to use the architecture of the gallery image definition.
+	// +kubebuilder:validation:Enum:={x64,Arm64}
+	// +optional
+	Architecture string `json:"architecture,omitempty"`
+	// HyperVGeneration is the Hyper-V generation of the image, which the instance types must support.
+	// You can leave it empty to use the Hyper-V generation of the gallery image definition.
+	// +kubebuilder:validation:Enum:={V1,V2}
+	// +optional
+	HyperVGeneration string `json:"hyperVGeneration,omitempty"`
+}
+
+// MarketplaceImageTerm defines the Azure Marketplace image used by Karpenter to launch nodes, by its publisher, offer
+// and SKU. Images with a purchase plan can only launch once the terms of their plan are accepted in the subscription,
+// e.g. with `az vm image terms accept --publisher <publisher> --offer <offer> --plan <sku>`.
+type MarketplaceImageTerm struct {
+	// Publisher is the publisher of the image, e.g. Canonical.
+	// +kubebuilder:validation:MinLength=1
+	// +required
+	Publisher string `json:"publisher"`
+	// Offer is the offer of the image, e.g. 0001-com-ubuntu-server-jammy.
+	// +kubebuilder:validation:MinLength=1
+	// +required
+	Offer string `json:"offer"`
+	// SKU is the SKU of the image, e.g. 22_04-lts-gen2.
+	// +kubebuilder:validation:MinLength=1
+	// +required
+	SKU string `json:"sku"`
+	// Version is the image version, e.g. 22.04.202410090.
+	// You can leave it empty to get the latest image version
+	// +kubebuilder:validation:Pattern=`^[0-9]+\.[0-9]+\.[0-9]+$`
+	// +optional
+	Version string `json:"version,omitempty"`
+	// DistroName is the aks container service agent pool distro name of the image, which the nodes are bootstrapped for.
+	// Here are all distro https://github.com/Azure/AgentBaker/blob/dev/pkg/agent/datamodel/types.go#L144.
+	// +kubebuilder:validation:Enum=aks-ubuntu-containerd-22.04-gen2;aks-ubuntu-arm64-containerd-22.04-gen2
+	// +kubebuilder:default="aks-ubuntu-containerd-22.04-gen2"
+	// +optional
+	DistroName string `json:"distroName,omitempty"`
+}
+
+// MaintenanceWindow is a recurring window of time, opening on a cron schedule for a duration.
+type MaintenanceWindow struct {
+	// schedule is when the maintenance window opens, in cron format: minute hour day-of-month month day-of-week, or one of
+	// the @yearly, @monthly, @weekly, @daily and @hourly macros. For example, "0 2 * * 0" opens it on Sundays at 02:00.
+	// +kubebuilder:validation:Pattern:=`^(@(annually|yearly|monthly|weekly|daily|midnight|hourly))|((.+)\s(.+)\s(.+)\s(.+)\s(.+))$`
+	// +required
+	Schedule string `json:"schedule"`
+	// duration is how long the maintenance window stays open after opening, in hours and minutes, e.g. 4h or 1h30m.
+	// +kubebuilder:validation:Pattern=`^((([0-9]+(h|m))|([0-9]+h[0-9]+m))(0s)?)$`
+	// +kubebuilder:validation:Type="string"
+	// +required
+	Duration metav1.Duration `json:"duration"`
+	// timeZone is the IANA time zone of the schedule, e.g. Europe/Amsterdam.
+	// Default: UTC
+	// +optional
+	TimeZone *string `json:"timeZone,omitempty"`
+}
+
+// PatchSettings are the guest patching settings of the VMs, per OS.
+// For more information, see:
+// https://learn.microsoft.com/en-us/azure/virtual-machines/automatic-vm-guest-patching
+type PatchSettings struct {
+	// Linux are the patch settings of Linux VMs.
+	// +optional
+	Linux *LinuxPatchSettings `json:"linux,omitempty"`
+}
+
+// LinuxPatchSettings are the patch settings of Linux VMs, the linuxConfiguration.patchSettings of their osProfile.
+// +kubebuilder:validation:XValidation:message="automaticByPlatformSettings requires patchMode AutomaticByPlatform",rule="has(self.automaticByPlatformSettings) ? (has(self.patchMode) && self.patchMode == 'AutomaticByPlatform') : true"
+type LinuxPatchSettings struct {
+	// patchMode is the mode of VM guest patching. AutomaticByPlatform patches the VM with the platform orchestrated
+	// patching of Azure Update Manager, while ImageDefault keeps the patching configuration of the image.
+	// Default: ImageDefault
+	// +kubebuilder:validation:Enum:={ImageDefault,AutomaticByPlatform}
+	// +optional
+	PatchMode string `json:"patchMode,omitempty"`
+	// assessmentMode is the mode of the assessment of the patches available to the VM. AutomaticByPlatform assesses
+	// them periodically, while ImageDefault only assesses them on demand.
+	// Default: ImageDefault
+	// +kubebuilder:validation:Enum:={ImageDefault,AutomaticByPlatform}
+	// +optional
+	AssessmentMode string `json:"assessmentMode,omitempty"`
+	// automaticByPlatformSettings are the settings of the AutomaticByPlatform patch mode.
+	// +optional
+	AutomaticByPlatformSettings *LinuxAutomaticByPlatformSettings `json:"automaticByPlatformSettings,omitempty"`
+}
+
+// LinuxAutomaticByPlatformSettings are the settings of the AutomaticByPlatform patch mode of Linux VMs.
+type LinuxAutomaticByPlatformSettings struct {
+	// bypassPlatformSafetyChecksOnUserSchedule enables patching the VM on the schedule of a maintenance configuration,
+	// bypassing the safety checks of the platform, e.g. its maintenance windows.
+	// Default: false
+	// +optional
+	BypassPlatformSafetyChecksOnUserSchedule *bool `json:"bypassPlatformSafetyChecksOnUserSchedule,omitempty"`
+	// rebootSetting is when the VM is rebooted after patching.
+	// Default: IfRequired
+	// +kubebuilder:validation:Enum:={IfRequired,Never,Always}
+	// +optional
+	RebootSetting string `json:"rebootSetting,omitempty"`
 }
 
 // TODO: Add link for the aka.ms/nap/aksnodeclass-enable-host-encryption docs
+// +kubebuilder:validation:XValidation:message="secureBootEnabled and vTPMEnabled require securityType TrustedLaunch",rule="has(self.secureBootEnabled) || has(self.vTPMEnabled) ? (has(self.securityType) && self.securityType == 'TrustedLaunch') : true"
 type Security struct {
 	// EncryptionAtHost specifies whether host-level encryption is enabled for provisioned nodes.
 	// For more information, see:
@@ -129,6 +385,44 @@ type Security struct {
 	// https://learn.microsoft.com/en-us/azure/virtual-machines/disk-encryption#encryption-at-host---end-to-end-encryption-for-your-vm-data
 	// +optional
 	EncryptionAtHost *bool `json:"encryptionAtHost,omitempty"`
+	// SecurityType is the security type of the VMs of provisioned nodes. TrustedLaunch launches VMs with secure boot
+	// and a vTPM, as configured by secureBootEnabled and vTPMEnabled, from the Gen2 images of the image family, and only
+	// on the Gen2 VM sizes supporting trusted launch; the images of imageID, customImageTerms and marketplaceImage must
+	// be Gen2 images supporting it too. ConfidentialVM launches confidential VMs, with
+	// their memory encrypted by AMD SEV-SNP or Intel TDX, from the confidential VM images of the image family, and only
+	// on the confidential VM sizes, e.g. DCasv5 and ECasv5, which nodepools can also require with the
+	// karpenter.azure.com/sku-confidential-computing label. Their OS disks are managed disks, with their VM guest state
+	// encrypted.
+	// For more information, see:
+	// https://learn.microsoft.com/en-us/azure/virtual-machines/trusted-launch
+	// https://learn.microsoft.com/en-us/azure/confidential-computing/confidential-vm-overview
+	// Default: Standard
+	// +kubebuilder:validation:Enum:={Standard,TrustedLaunch,ConfidentialVM}
+	// +optional
+	SecurityType *SecurityType `json:"securityType,omitempty"`
+	// SecureBootEnabled is whether secure boot is enabled on the VMs of provisioned nodes, which only boot signed
+	// kernels, drivers and boot loaders. Unsigned kernel modules, e.g. some GPU drivers, fail to load with it.
+	// Requires securityType TrustedLaunch.
+	// Default: true
+	// +optional
+	SecureBootEnabled *bool `json:"secureBootEnabled,omitempty"`
+	// VTPMEnabled is whether a virtual TPM is attached to the VMs of provisioned nodes, for measured boot and attestation.
+	// Requires securityType TrustedLaunch.
+	// Default: true
+	// +optional
+	VTPMEnabled *bool `json:"vTPMEnabled,omitempty"`
+	// CustomCATrustCertificates are base64 encoded PEM certificates added to the trust store of provisioned nodes,
+	// like the customCATrustCertificates of the AKS security profile. They are written to /opt/certs, which is watched
+	// by the node's update_certs path unit, so the trust store of live nodes can be updated by writing there, e.g. from a
+	// DaemonSet; changing this field only applies to new nodes, and does not drift existing ones.
+	// Only supported in the scriptless provision mode; in the bootstrapping client provision mode, nodes trust the
+	// customCATrustCertificates of the cluster.
+	// For more information, see:
+	// https://learn.microsoft.com/en-us/azure/aks/custom-certificate-authority
+	// +kubebuilder:validation:MaxItems=10
+	// +kubebuilder:validation:items:Pattern=`^[A-Za-z0-9+/]+={0,2}$`
+	// +optional
+	CustomCATrustCertificates []string `json:"customCATrustCertificates,omitempty" hash:"ignore"`
 }
 
 // KubeletConfiguration defines args to be used when configuring kubelet on provisioned nodes.
@@ -219,6 +513,75 @@ type KubeletConfiguration struct {
 	// Default: -1
 	// +optional
 	PodPidsLimit *int64 `json:"podPidsLimit,omitempty"`
+	// insecureKubeletDefaults overrides the hardened kubelet settings nodes are bootstrapped with: the read-only port
+	// disabled, anonymous authentication disabled, and Webhook authorization. It is an escape hatch for workloads that
+	// depend on the insecure kubelet defaults, and weakens the security of the nodes.
+	// Only overrides that change the effective settings drift the nodes.
+	// +optional
+	InsecureKubeletDefaults *InsecureKubeletDefaults `json:"insecureKubeletDefaults,omitempty" hash:"ignore"`
+}
+
+// InsecureKubeletDefaults overrides the hardened kubelet settings. Settings left unset keep their hardened value.
+type InsecureKubeletDefaults struct {
+	// readOnlyPort is the port of the unauthenticated, read-only kubelet API. 0 disables it.
+	// Default: 0
+	// +kubebuilder:validation:Minimum:=0
+	// +kubebuilder:validation:Maximum:=65535
+	// +optional
+	ReadOnlyPort *int32 `json:"readOnlyPort,omitempty"`
+	// anonymousAuth enables anonymous requests to the kubelet API.
+	// Default: false
+	// +optional
+	AnonymousAuth *bool `json:"anonymousAuth,omitempty"`
+	// authorizationMode is the authorization mode of the kubelet API. AlwaysAllow authorizes all requests.
+	// Default: Webhook
+	// +kubebuilder:validation:Enum:={Webhook,AlwaysAllow}
+	// +optional
+	AuthorizationMode string `json:"authorizationMode,omitempty"`
+}
+
+const (
+	KubeletAuthorizationModeWebhook     = "Webhook"
+	KubeletAuthorizationModeAlwaysAllow = "AlwaysAllow"
+)
+
+// GetReadOnlyPort returns the effective read-only port of the kubelet, 0 (disabled) unless overridden
+func (in *InsecureKubeletDefaults) GetReadOnlyPort() int32 {
+	if in == nil {
+		return 0
+	}
+	return lo.FromPtr(in.ReadOnlyPort)
+}
+
+// GetAnonymousAuth returns whether anonymous requests to the kubelet API are enabled, false unless overridden
+func (in *InsecureKubeletDefaults) GetAnonymousAuth() bool {
+	if in == nil {
+		return false
+	}
+	return lo.FromPtr(in.AnonymousAuth)
+}
+
+// GetAuthorizationMode returns the effective authorization mode of the kubelet API, Webhook unless overridden
+func (in *InsecureKubeletDefaults) GetAuthorizationMode() string {
+	if in == nil || in.AuthorizationMode == "" {
+		return KubeletAuthorizationModeWebhook
+	}
+	return in.AuthorizationMode
+}
+
+// effectiveOverrides returns the overridden kubelet settings that differ from the hardened ones
+func (in *InsecureKubeletDefaults) effectiveOverrides() map[string]string {
+	overrides := map[string]string{}
+	if port := in.GetReadOnlyPort(); port != 0 {
+		overrides["readOnlyPort"] = fmt.Sprint(port)
+	}
+	if in.GetAnonymousAuth() {
+		overrides["anonymousAuth"] = "true"
+	}
+	if mode := in.GetAuthorizationMode(); mode != KubeletAuthorizationModeWebhook {
+		overrides["authorizationMode"] = mode
+	}
+	return overrides
 }
 
 // AKSNodeClass is the Schema for the AKSNodeClass API
@@ -244,7 +607,15 @@ type AKSNodeClass struct {
 const AKSNodeClassHashVersion = "v3"
 
 func (in *AKSNodeClass) Hash() string {
-	return fmt.Sprint(lo.Must(hashstructure.Hash(in.Spec, hashstructure.FormatV2, &hashstructure.HashOptions{
+	var hashed any = in.Spec
+	// the insecure kubelet defaults are hashed by their effective values, so that overrides to the hardened values don't drift nodes,
+	// and nodeclasses without overrides keep their hash
+	if in.Spec.Kubelet != nil {
+		if overrides := in.Spec.Kubelet.InsecureKubeletDefaults.effectiveOverrides(); len(overrides) > 0 {
+			hashed = []any{in.Spec, overrides}
+		}
+	}
+	return fmt.Sprint(lo.Must(hashstructure.Hash(hashed, hashstructure.FormatV2, &hashstructure.HashOptions{
 		SlicesAsSets:    true,
 		IgnoreZeroValue: true,
 		ZeroNil:         true,
@@ -267,3 +638,42 @@ func (in *AKSNodeClass) GetEncryptionAtHost() bool {
 	}
 	return false
 }
+
+// IsTrustedLaunch returns whether the nodes of the node class are trusted launch VMs
+func (in *AKSNodeClass) IsTrustedLaunch() bool {
+	return in.Spec.Security != nil && lo.FromPtr(in.Spec.Security.SecurityType) == SecurityTypeTrustedLaunch
+}
+
+// IsConfidentialVM returns whether the nodes of the node class are confidential VMs
+func (in *AKSNodeClass) IsConfidentialVM() bool {
+	return in.Spec.Security != nil && lo.FromPtr(in.Spec.Security.SecurityType) == SecurityTypeConfidentialVM
+}
+
+// IsImageFrozen returns whether image updates are frozen by the image-freeze annotation
+func (in *AKSNodeClass) IsImageFrozen() bool {
+	return in.Annotations[AnnotationImageFreeze] == "true"
+}
+
+// IsImageDriftDisabled returns whether the nodes are kept on the images they were launched with
+func (in *AKSNodeClass) IsImageDriftDisabled() bool {
+	return lo.FromPtr(in.Spec.ImageDriftDisabled)
+}
+
+// IsDrainOnDelete returns whether the NodeClaims referencing the AKSNodeClass are disrupted once it's deleted
+func (in *AKSNodeClass) IsDrainOnDelete() bool {
+	return in.Annotations[AnnotationDrainOnDelete] == "true"
+}
+
+// CustomImageTerms returns the custom image terms of the node class in order of priority, the deprecated
+// customImageTerm being the only term when set
+func (in *AKSNodeClass) CustomImageTerms() []CustomImageTerm {
+	if in.Spec.CustomImageTerm != nil {
+		return []CustomImageTerm{*in.Spec.CustomImageTerm}
+	}
+	return in.Spec.CustomImageTerms
+}
+
+// GetImageChannel returns the image channel of the node class, defaulting to Stable
+func (in *AKSNodeClass) GetImageChannel() ImageChannel {
+	return lo.FromPtrOr(in.Spec.ImageChannel, ImageChannelStable)
+}
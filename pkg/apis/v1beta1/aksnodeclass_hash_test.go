@@ -86,6 +86,12 @@ var _ = Describe("Hash", func() {
 		Entry("ImageFamily", v1beta1.AKSNodeClass{Spec: v1beta1.AKSNodeClassSpec{ImageFamily: lo.ToPtr("AzureLinux")}}),
 		Entry("Kubelet", v1beta1.AKSNodeClass{Spec: v1beta1.AKSNodeClassSpec{Kubelet: &v1beta1.KubeletConfiguration{CPUManagerPolicy: "none"}}}),
 		Entry("MaxPods", v1beta1.AKSNodeClass{Spec: v1beta1.AKSNodeClassSpec{MaxPods: lo.ToPtr(int32(200))}}),
+		Entry("PatchSettings", v1beta1.AKSNodeClass{Spec: v1beta1.AKSNodeClassSpec{PatchSettings: &v1beta1.PatchSettings{Linux: &v1beta1.LinuxPatchSettings{PatchMode: "AutomaticByPlatform"}}}}),
+		Entry("ImageID", v1beta1.AKSNodeClass{Spec: v1beta1.AKSNodeClassSpec{ImageID: lo.ToPtr("/CommunityGalleries/gallery/images/image/versions/1.0.0")}}),
+		Entry("ImageDistroName", v1beta1.AKSNodeClass{Spec: v1beta1.AKSNodeClassSpec{ImageDistroName: lo.ToPtr("aks-ubuntu-containerd-22.04-gen2")}}),
+		Entry("SecurityType", v1beta1.AKSNodeClass{Spec: v1beta1.AKSNodeClassSpec{Security: &v1beta1.Security{SecurityType: lo.ToPtr(v1beta1.SecurityTypeTrustedLaunch)}}}),
+		Entry("SecureBootEnabled", v1beta1.AKSNodeClass{Spec: v1beta1.AKSNodeClassSpec{Security: &v1beta1.Security{SecureBootEnabled: lo.ToPtr(false)}}}),
+		Entry("VTPMEnabled", v1beta1.AKSNodeClass{Spec: v1beta1.AKSNodeClassSpec{Security: &v1beta1.Security{VTPMEnabled: lo.ToPtr(false)}}}),
 	)
 	It("should not change hash when tags are re-ordered", func() {
 		hash := nodeClass.Hash()
@@ -99,6 +105,29 @@ var _ = Describe("Hash", func() {
 		updatedHash := nodeClass.Hash()
 		Expect(hash).To(Equal(updatedHash))
 	})
+	It("should not change hash when the maintenance window is changed", func() {
+		hash := nodeClass.Hash()
+		nodeClass.Spec.MaintenanceWindow = &v1beta1.MaintenanceWindow{Schedule: "0 2 * * 0", Duration: metav1.Duration{Duration: 4 * time.Hour}}
+		Expect(nodeClass.Hash()).To(Equal(hash))
+	})
+	It("should not change hash when insecure kubelet defaults keep the hardened values", func() {
+		hash := nodeClass.Hash()
+		nodeClass.Spec.Kubelet.InsecureKubeletDefaults = &v1beta1.InsecureKubeletDefaults{
+			ReadOnlyPort:      lo.ToPtr(int32(0)),
+			AnonymousAuth:     lo.ToPtr(false),
+			AuthorizationMode: v1beta1.KubeletAuthorizationModeWebhook,
+		}
+		Expect(nodeClass.Hash()).To(Equal(hash))
+	})
+	DescribeTable("should change hash when insecure kubelet defaults change the effective values", func(insecureDefaults *v1beta1.InsecureKubeletDefaults) {
+		hash := nodeClass.Hash()
+		nodeClass.Spec.Kubelet.InsecureKubeletDefaults = insecureDefaults
+		Expect(nodeClass.Hash()).ToNot(Equal(hash))
+	},
+		Entry("ReadOnlyPort", &v1beta1.InsecureKubeletDefaults{ReadOnlyPort: lo.ToPtr(int32(10255))}),
+		Entry("AnonymousAuth", &v1beta1.InsecureKubeletDefaults{AnonymousAuth: lo.ToPtr(true)}),
+		Entry("AuthorizationMode", &v1beta1.InsecureKubeletDefaults{AuthorizationMode: v1beta1.KubeletAuthorizationModeAlwaysAllow}),
+	)
 	It("should expect two AKSNodeClasses with the same spec to have the same hash", func() {
 		otherNodeClass := &v1beta1.AKSNodeClass{
 			Spec: nodeClass.Spec,
@@ -21,12 +21,36 @@ import (
 
 	"github.com/awslabs/operatorpkg/status"
 	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 )
 
 const (
 	ConditionTypeImagesReady            = "ImagesReady"
 	ConditionTypeKubernetesVersionReady = "KubernetesVersionReady"
 	ConditionTypeSubnetsReady           = "SubnetsReady"
+	ConditionTypeSubscriptionReady      = "SubscriptionReady"
+	ConditionTypeKubeletIdentityReady   = "KubeletIdentityReady"
+
+	// ConditionTypeImagesFrozen is set while image updates are frozen by the image-freeze annotation. It is not a readiness condition.
+	ConditionTypeImagesFrozen = "ImagesFrozen"
+	// ConditionTypeImagesUnsatisfiable is set while none of the instance types offered to a NodePool referencing the AKSNodeClass
+	// is compatible with its images. It is not a readiness condition.
+	ConditionTypeImagesUnsatisfiable = "ImagesUnsatisfiable"
+	// ConditionTypeImagesKubernetesVersionUnsupported is set while an image of the AKSNodeClass doesn't support its Kubernetes
+	// version, e.g. when the image-freeze annotation or a pinned custom image version keeps it across a Kubernetes upgrade.
+	// It is not a readiness condition.
+	ConditionTypeImagesKubernetesVersionUnsupported = "ImagesKubernetesVersionUnsupported"
+	// ConditionTypeSubnetEgressUnavailable is set while the subnet of the AKSNodeClass has no egress path for some of the
+	// zones the NodePools referencing it launch into, e.g. as its NAT gateway is in another zone. It is advisory, and not a
+	// readiness condition.
+	ConditionTypeSubnetEgressUnavailable = "SubnetEgressUnavailable"
+	// ConditionTypeDataStale is set while the pricing or SKU data of instance types of the AKSNodeClass is older than the
+	// strict-data-freshness option, so that their offerings aren't launched until it's refreshed. It is not a readiness
+	// condition.
+	ConditionTypeDataStale = "DataStale"
+	// ConditionTypeTerminating is set while a deleted AKSNodeClass waits on the termination of the NodeClaims referencing it.
+	// It is not a readiness condition.
+	ConditionTypeTerminating = "Terminating"
 )
 
 // NodeImage contains resolved image selector values utilized for node launch
@@ -39,6 +63,31 @@ type NodeImage struct {
 	// Requirements of the image to be utilized on an instance type
 	// +required
 	Requirements []corev1.NodeSelectorRequirement `json:"requirements"`
+	// Channel the image version was selected from, Preview if it is a preview version
+	// +optional
+	Channel ImageChannel `json:"channel,omitempty"`
+	// Pinned is true if the image version is the version pinned by the imageVersion of the AKSNodeClass
+	// +optional
+	Pinned bool `json:"pinned,omitempty"`
+	// Distro of the default image the image is a version of, e.g. aks-ubuntu-containerd-22.04-gen2
+	// +optional
+	Distro string `json:"distro,omitempty"`
+	// PublishedDate is when the image version was published, if the image source reports it
+	// +optional
+	PublishedDate *metav1.Time `json:"publishedDate,omitempty"`
+}
+
+// MaintenanceWindowStatus is the state of a maintenance window
+type MaintenanceWindowStatus struct {
+	// Open is whether the maintenance window is open, allowing the voluntary disruption of nodes
+	// +required
+	Open bool `json:"open"`
+	// CloseTime is when the maintenance window closes, while it's open
+	// +optional
+	CloseTime *metav1.Time `json:"closeTime,omitempty"`
+	// NextOpenTime is when the maintenance window next opens
+	// +optional
+	NextOpenTime *metav1.Time `json:"nextOpenTime,omitempty"`
 }
 
 // AKSNodeClassStatus contains the resolved state of the AKSNodeClass
@@ -51,6 +100,17 @@ type AKSNodeClassStatus struct {
 	// used for nodes provisioned for the NodeClass
 	// +optional
 	KubernetesVersion string `json:"kubernetesVersion,omitempty"`
+	// MaintenanceWindow is the state of the maintenance window of the NodeClass, if it has one
+	// +optional
+	MaintenanceWindow *MaintenanceWindowStatus `json:"maintenanceWindow,omitempty"`
+	// ImageCacheRefresh is the value of the image-cache-refresh annotation of the NodeClass that its images were last
+	// refreshed for
+	// +optional
+	ImageCacheRefresh string `json:"imageCacheRefresh,omitempty"`
+	// Zones are the zones of the region the instance types of the NodeClass are offered in, updated as zones are
+	// added to the region
+	// +optional
+	Zones []string `json:"zones,omitempty"`
 	// Conditions contains signals for health and readiness
 	// +optional
 	Conditions []status.Condition `json:"conditions,omitempty"`
@@ -61,6 +121,8 @@ func (in *AKSNodeClass) StatusConditions() status.ConditionSet {
 		ConditionTypeImagesReady,
 		ConditionTypeKubernetesVersionReady,
 		ConditionTypeSubnetsReady,
+		ConditionTypeSubscriptionReady,
+		ConditionTypeKubeletIdentityReady,
 	}
 	return status.NewReadyConditions(conds...).For(in)
 }
@@ -19,4 +19,26 @@ package v1beta1
 // Annotations
 var (
 	AnnotationInPlaceUpdateHash = Group + "/in-place-update-hash"
+
+	// AnnotationBootstrapCustomDataDebug and AnnotationBootstrapCSEDebug hold a redacted rendering of the
+	// bootstrap payload sent with the VM. They are only set when --enable-bootstrap-debug is on.
+	AnnotationBootstrapCustomDataDebug = Group + "/bootstrap-custom-data-debug"
+	AnnotationBootstrapCSEDebug        = Group + "/bootstrap-cse-debug"
+
+	// AnnotationMaintenanceWindowBlocked is set on nodes annotated with karpenter.sh/do-not-disrupt outside of the
+	// maintenance window of their AKSNodeClass, so that only the annotations set for the window are removed as it opens
+	AnnotationMaintenanceWindowBlocked = Group + "/maintenance-window-blocked"
+
+	// AnnotationLocalStorageConsolidationBlocked is set on the nodes with local disks annotated with
+	// karpenter.sh/do-not-disrupt while they're protected from consolidation by the localStorageConsolidateAfter of their
+	// AKSNodeClass, so that only the annotations set for the protection are removed as it ends
+	AnnotationLocalStorageConsolidationBlocked = Group + "/local-storage-consolidation-blocked"
+
+	// AnnotationEstimatedHourlyCost holds an estimate of the hourly cost of the VM of a nodeclaim in USD, from the retail
+	// prices of its SKU and capacity type, which are held by AnnotationEstimatedHourlyCostSKU and
+	// AnnotationEstimatedHourlyCostCapacityType. It's set at launch from the price of the offering launched, and the spot
+	// prices are refreshed as the pricing changes. The annotations are copied to the node, and don't affect drift.
+	AnnotationEstimatedHourlyCost             = Group + "/estimated-hourly-cost"
+	AnnotationEstimatedHourlyCostSKU          = Group + "/estimated-hourly-cost-sku"
+	AnnotationEstimatedHourlyCostCapacityType = Group + "/estimated-hourly-cost-capacity-type"
 )
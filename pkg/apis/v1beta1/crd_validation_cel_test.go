@@ -18,6 +18,7 @@ package v1beta1_test
 
 import (
 	"strings"
+	"time"
 
 	"github.com/Azure/karpenter-provider-azure/pkg/apis/v1beta1"
 	"github.com/Pallinder/go-randomdata"
@@ -122,6 +123,54 @@ var _ = Describe("CEL/Validation", func() {
 		})
 	})
 
+	Context("KubeletIdentity", func() {
+		const (
+			clientID   = "87654321-4321-4321-4321-210987654321"
+			resourceID = "/subscriptions/12345678-1234-1234-1234-123456789012/resourceGroups/rgname/providers/Microsoft.ManagedIdentity/userAssignedIdentities/kubelet"
+		)
+		DescribeTable("Should require kubeletIdentityClientID and kubeletIdentityResourceID together", func(clientID *string, resourceID *string, expected bool) {
+			nodeClass := &v1beta1.AKSNodeClass{
+				ObjectMeta: metav1.ObjectMeta{Name: strings.ToLower(randomdata.SillyName())},
+				Spec: v1beta1.AKSNodeClassSpec{
+					KubeletIdentityClientID:   clientID,
+					KubeletIdentityResourceID: resourceID,
+				},
+			}
+			if expected {
+				Expect(env.Client.Create(ctx, nodeClass)).To(Succeed())
+			} else {
+				Expect(env.Client.Create(ctx, nodeClass)).ToNot(Succeed())
+			}
+		},
+			Entry("both", lo.ToPtr(clientID), lo.ToPtr(resourceID), true),
+			Entry("neither", nil, nil, true),
+			Entry("only the client ID", lo.ToPtr(clientID), nil, false),
+			Entry("only the resource ID", nil, lo.ToPtr(resourceID), false),
+			Entry("a client ID that isn't a GUID", lo.ToPtr("kubelet"), lo.ToPtr(resourceID), false),
+			Entry("a resource ID that isn't an identity", lo.ToPtr(clientID), lo.ToPtr("/subscriptions/12345678-1234-1234-1234-123456789012/resourceGroups/rgname/providers/Microsoft.Network/virtualNetworks/vnet"), false),
+		)
+	})
+
+	Context("CustomCATrustCertificates", func() {
+		DescribeTable("Should validate customCATrustCertificates", func(certificates []string, expected bool) {
+			nodeClass := &v1beta1.AKSNodeClass{
+				ObjectMeta: metav1.ObjectMeta{Name: strings.ToLower(randomdata.SillyName())},
+				Spec: v1beta1.AKSNodeClassSpec{
+					Security: &v1beta1.Security{CustomCATrustCertificates: certificates},
+				},
+			}
+			if expected {
+				Expect(env.Client.Create(ctx, nodeClass)).To(Succeed())
+			} else {
+				Expect(env.Client.Create(ctx, nodeClass)).ToNot(Succeed())
+			}
+		},
+			Entry("base64 encoded certificates", []string{"LS0tLS1CRUdJTiBDRVJUSUZJQ0FURS0tLS0t", "dGVzdA=="}, true),
+			Entry("a certificate that isn't base64 encoded", []string{"-----BEGIN CERTIFICATE-----"}, false),
+			Entry("more than 10 certificates", lo.RepeatBy(11, func(int) string { return "dGVzdA==" }), false),
+		)
+	})
+
 	Context("OSDiskSizeGB", func() {
 		DescribeTable("Should validate OSDiskSizeGB constraints", func(osDiskSizeGB *int32, expected bool) {
 			nodeClass := &v1beta1.AKSNodeClass{
@@ -184,6 +233,52 @@ var _ = Describe("CEL/Validation", func() {
 		)
 	})
 
+	Context("SecurityType", func() {
+		DescribeTable("should only accept ConfidentialVM with the Ubuntu2204 images", func(imageFamily string, fipsMode *v1beta1.FIPSMode, securityType v1beta1.SecurityType, expected bool) {
+			nodeClass := &v1beta1.AKSNodeClass{
+				ObjectMeta: metav1.ObjectMeta{Name: strings.ToLower(randomdata.SillyName())},
+				Spec: v1beta1.AKSNodeClassSpec{
+					FIPSMode: fipsMode,
+					Security: &v1beta1.Security{SecurityType: &securityType},
+				},
+			}
+			if imageFamily != "" {
+				nodeClass.Spec.ImageFamily = &imageFamily
+			}
+			if expected {
+				Expect(env.Client.Create(ctx, nodeClass)).To(Succeed())
+			} else {
+				Expect(env.Client.Create(ctx, nodeClass)).ToNot(Succeed())
+			}
+		},
+			Entry("Standard with the default image family should succeed", "", nil, v1beta1.SecurityTypeStandard, true),
+			Entry("ConfidentialVM with Ubuntu2204 should succeed", v1beta1.Ubuntu2204ImageFamily, nil, v1beta1.SecurityTypeConfidentialVM, true),
+			Entry("ConfidentialVM with Ubuntu2204 and FIPSMode Disabled should succeed", v1beta1.Ubuntu2204ImageFamily, &v1beta1.FIPSModeDisabled, v1beta1.SecurityTypeConfidentialVM, true),
+			Entry("ConfidentialVM with the default image family should fail", "", nil, v1beta1.SecurityTypeConfidentialVM, false),
+			Entry("ConfidentialVM with AzureLinux should fail", v1beta1.AzureLinuxImageFamily, nil, v1beta1.SecurityTypeConfidentialVM, false),
+			Entry("ConfidentialVM with Custom should fail", v1beta1.CustomImageFamily, nil, v1beta1.SecurityTypeConfidentialVM, false),
+			Entry("TrustedLaunch with the default image family should succeed", "", nil, v1beta1.SecurityTypeTrustedLaunch, true),
+			Entry("TrustedLaunch with AzureLinux should succeed", v1beta1.AzureLinuxImageFamily, nil, v1beta1.SecurityTypeTrustedLaunch, true),
+			Entry("invalid SecurityType should fail", v1beta1.Ubuntu2204ImageFamily, nil, v1beta1.SecurityType("TrustedVM"), false),
+		)
+		DescribeTable("should only accept secureBootEnabled and vTPMEnabled with TrustedLaunch", func(security *v1beta1.Security, expected bool) {
+			nodeClass := &v1beta1.AKSNodeClass{
+				ObjectMeta: metav1.ObjectMeta{Name: strings.ToLower(randomdata.SillyName())},
+				Spec:       v1beta1.AKSNodeClassSpec{Security: security},
+			}
+			if expected {
+				Expect(env.Client.Create(ctx, nodeClass)).To(Succeed())
+			} else {
+				Expect(env.Client.Create(ctx, nodeClass)).ToNot(Succeed())
+			}
+		},
+			Entry("TrustedLaunch with secure boot and vTPM should succeed", &v1beta1.Security{SecurityType: lo.ToPtr(v1beta1.SecurityTypeTrustedLaunch), SecureBootEnabled: lo.ToPtr(true), VTPMEnabled: lo.ToPtr(true)}, true),
+			Entry("TrustedLaunch without secure boot should succeed", &v1beta1.Security{SecurityType: lo.ToPtr(v1beta1.SecurityTypeTrustedLaunch), SecureBootEnabled: lo.ToPtr(false)}, true),
+			Entry("secure boot without a security type should fail", &v1beta1.Security{SecureBootEnabled: lo.ToPtr(true)}, false),
+			Entry("vTPM with Standard should fail", &v1beta1.Security{SecurityType: lo.ToPtr(v1beta1.SecurityTypeStandard), VTPMEnabled: lo.ToPtr(true)}, false),
+		)
+	})
+
 	Context("Requirements", func() {
 		It("should allow restricted domains exceptions", func() {
 			oldNodePool := nodePool.DeepCopy()
@@ -363,4 +458,236 @@ var _ = Describe("CEL/Validation", func() {
 			Expect(env.Client.Create(ctx, nodeClass)).To(Succeed())
 		})
 	})
+	Context("PatchSettings", func() {
+		It("should allow the AutomaticByPlatform patch mode with its settings", func() {
+			nodeClass := &v1beta1.AKSNodeClass{
+				ObjectMeta: metav1.ObjectMeta{Name: strings.ToLower(randomdata.SillyName())},
+				Spec: v1beta1.AKSNodeClassSpec{
+					PatchSettings: &v1beta1.PatchSettings{Linux: &v1beta1.LinuxPatchSettings{
+						PatchMode:                   "AutomaticByPlatform",
+						AutomaticByPlatformSettings: &v1beta1.LinuxAutomaticByPlatformSettings{BypassPlatformSafetyChecksOnUserSchedule: lo.ToPtr(false)},
+					}},
+				},
+			}
+			Expect(env.Client.Create(ctx, nodeClass)).To(Succeed())
+		})
+		It("should reject the AutomaticByPlatform settings without the AutomaticByPlatform patch mode", func() {
+			nodeClass := &v1beta1.AKSNodeClass{
+				ObjectMeta: metav1.ObjectMeta{Name: strings.ToLower(randomdata.SillyName())},
+				Spec: v1beta1.AKSNodeClassSpec{
+					PatchSettings: &v1beta1.PatchSettings{Linux: &v1beta1.LinuxPatchSettings{
+						PatchMode:                   "ImageDefault",
+						AutomaticByPlatformSettings: &v1beta1.LinuxAutomaticByPlatformSettings{RebootSetting: "Never"},
+					}},
+				},
+			}
+			Expect(env.Client.Create(ctx, nodeClass)).ToNot(Succeed())
+		})
+		It("should reject an unknown patch mode", func() {
+			nodeClass := &v1beta1.AKSNodeClass{
+				ObjectMeta: metav1.ObjectMeta{Name: strings.ToLower(randomdata.SillyName())},
+				Spec: v1beta1.AKSNodeClassSpec{
+					PatchSettings: &v1beta1.PatchSettings{Linux: &v1beta1.LinuxPatchSettings{PatchMode: "Manual"}},
+				},
+			}
+			Expect(env.Client.Create(ctx, nodeClass)).ToNot(Succeed())
+		})
+	})
+	Context("MaintenanceWindow", func() {
+		DescribeTable("should validate the maintenance window", func(window v1beta1.MaintenanceWindow, valid bool) {
+			nodeClass := &v1beta1.AKSNodeClass{
+				ObjectMeta: metav1.ObjectMeta{Name: strings.ToLower(randomdata.SillyName())},
+				Spec:       v1beta1.AKSNodeClassSpec{MaintenanceWindow: &window},
+			}
+			if valid {
+				Expect(env.Client.Create(ctx, nodeClass)).To(Succeed())
+			} else {
+				Expect(env.Client.Create(ctx, nodeClass)).ToNot(Succeed())
+			}
+		},
+			Entry("cron schedule", v1beta1.MaintenanceWindow{Schedule: "0 2 * * 0", Duration: metav1.Duration{Duration: 4 * time.Hour}}, true),
+			Entry("macro schedule with a time zone", v1beta1.MaintenanceWindow{Schedule: "@daily", Duration: metav1.Duration{Duration: 90 * time.Minute}, TimeZone: lo.ToPtr("Europe/Amsterdam")}, true),
+			Entry("schedule missing fields", v1beta1.MaintenanceWindow{Schedule: "0 2 *", Duration: metav1.Duration{Duration: 4 * time.Hour}}, false),
+			Entry("duration in seconds", v1beta1.MaintenanceWindow{Schedule: "0 2 * * 0", Duration: metav1.Duration{Duration: 30 * time.Second}}, false),
+		)
+	})
+	Context("KubernetesVersion", func() {
+		DescribeTable("should validate the kubernetes version", func(version string, valid bool) {
+			nodeClass := &v1beta1.AKSNodeClass{
+				ObjectMeta: metav1.ObjectMeta{Name: strings.ToLower(randomdata.SillyName())},
+				Spec:       v1beta1.AKSNodeClassSpec{KubernetesVersion: lo.ToPtr(version)},
+			}
+			if valid {
+				Expect(env.Client.Create(ctx, nodeClass)).To(Succeed())
+			} else {
+				Expect(env.Client.Create(ctx, nodeClass)).ToNot(Succeed())
+			}
+		},
+			Entry("patch version", "1.31.2", true),
+			Entry("minor version", "1.31", false),
+			Entry("prefixed version", "v1.31.2", false),
+		)
+	})
+	Context("ImageVersionConstraint", func() {
+		DescribeTable("should validate the image version constraint", func(constraint string, valid bool) {
+			nodeClass := &v1beta1.AKSNodeClass{
+				ObjectMeta: metav1.ObjectMeta{Name: strings.ToLower(randomdata.SillyName())},
+				Spec:       v1beta1.AKSNodeClassSpec{ImageVersionConstraint: lo.ToPtr(constraint)},
+			}
+			if valid {
+				Expect(env.Client.Create(ctx, nodeClass)).To(Succeed())
+			} else {
+				Expect(env.Client.Create(ctx, nodeClass)).ToNot(Succeed())
+			}
+		},
+			Entry("range", ">=202401.0.0 <202501.0.0", true),
+			Entry("wildcard", "202402.x", true),
+			Entry("ORed ranges", "<202401.0.0 || >=202501.0.0 !202501.02.0", true),
+			Entry("words", "latest", false),
+			Entry("unspaced OR", "202401.x||202402.x", false),
+		)
+		It("should reject an image version constraint along with the image version", func() {
+			nodeClass := &v1beta1.AKSNodeClass{
+				ObjectMeta: metav1.ObjectMeta{Name: strings.ToLower(randomdata.SillyName())},
+				Spec: v1beta1.AKSNodeClassSpec{
+					ImageVersion:           lo.ToPtr("202402.26.0"),
+					ImageVersionConstraint: lo.ToPtr("202402.x"),
+				},
+			}
+			Expect(env.Client.Create(ctx, nodeClass)).ToNot(Succeed())
+		})
+		It("should reject a custom image term version constraint along with its version", func() {
+			nodeClass := &v1beta1.AKSNodeClass{
+				ObjectMeta: metav1.ObjectMeta{Name: strings.ToLower(randomdata.SillyName())},
+				Spec: v1beta1.AKSNodeClassSpec{
+					ImageFamily:      lo.ToPtr(v1beta1.CustomImageFamily),
+					CustomImageTerms: []v1beta1.CustomImageTerm{{Name: "ubuntu", Version: "1.0.0", VersionConstraint: "1.x"}},
+				},
+			}
+			Expect(env.Client.Create(ctx, nodeClass)).ToNot(Succeed())
+		})
+		It("should reject a custom image term version tag selector along with its version", func() {
+			nodeClass := &v1beta1.AKSNodeClass{
+				ObjectMeta: metav1.ObjectMeta{Name: strings.ToLower(randomdata.SillyName())},
+				Spec: v1beta1.AKSNodeClassSpec{
+					ImageFamily:      lo.ToPtr(v1beta1.CustomImageFamily),
+					CustomImageTerms: []v1beta1.CustomImageTerm{{Name: "ubuntu", Version: "1.0.0", VersionTagSelector: map[string]string{"validated": "true"}}},
+				},
+			}
+			Expect(env.Client.Create(ctx, nodeClass)).ToNot(Succeed())
+		})
+		It("should accept the deprecated custom image term", func() {
+			nodeClass := &v1beta1.AKSNodeClass{
+				ObjectMeta: metav1.ObjectMeta{Name: strings.ToLower(randomdata.SillyName())},
+				Spec: v1beta1.AKSNodeClassSpec{
+					ImageFamily:     lo.ToPtr(v1beta1.CustomImageFamily),
+					CustomImageTerm: &v1beta1.CustomImageTerm{Name: "ubuntu"},
+				},
+			}
+			Expect(env.Client.Create(ctx, nodeClass)).To(Succeed())
+		})
+		It("should reject the deprecated custom image term along with custom image terms", func() {
+			nodeClass := &v1beta1.AKSNodeClass{
+				ObjectMeta: metav1.ObjectMeta{Name: strings.ToLower(randomdata.SillyName())},
+				Spec: v1beta1.AKSNodeClassSpec{
+					ImageFamily:      lo.ToPtr(v1beta1.CustomImageFamily),
+					CustomImageTerm:  &v1beta1.CustomImageTerm{Name: "ubuntu"},
+					CustomImageTerms: []v1beta1.CustomImageTerm{{Name: "ubuntu"}},
+				},
+			}
+			Expect(env.Client.Create(ctx, nodeClass)).ToNot(Succeed())
+		})
+	})
+	Context("ImageID", func() {
+		DescribeTable("should validate the image ID", func(imageID string, valid bool) {
+			nodeClass := &v1beta1.AKSNodeClass{
+				ObjectMeta: metav1.ObjectMeta{Name: strings.ToLower(randomdata.SillyName())},
+				Spec: v1beta1.AKSNodeClassSpec{
+					ImageID:         lo.ToPtr(imageID),
+					ImageDistroName: lo.ToPtr("aks-ubuntu-containerd-22.04-gen2"),
+				},
+			}
+			if valid {
+				Expect(env.Client.Create(ctx, nodeClass)).To(Succeed())
+			} else {
+				Expect(env.Client.Create(ctx, nodeClass)).ToNot(Succeed())
+			}
+		},
+			Entry("shared image gallery image", "/subscriptions/00000000-0000-0000-0000-000000000000/resourceGroups/images/providers/Microsoft.Compute/galleries/gallery/images/ubuntu/versions/1.0.0", true),
+			Entry("community gallery image", "/CommunityGalleries/AKSUbuntu-38d80f77-467a-481f-a8d4-09b6d4220bd2/images/2204gen2containerd/versions/202410.09.0", true),
+			Entry("image definition", "/CommunityGalleries/AKSUbuntu-38d80f77-467a-481f-a8d4-09b6d4220bd2/images/2204gen2containerd", false),
+			Entry("managed image", "/subscriptions/00000000-0000-0000-0000-000000000000/resourceGroups/images/providers/Microsoft.Compute/images/ubuntu", false),
+		)
+		It("should reject an image ID along with custom image terms", func() {
+			nodeClass := &v1beta1.AKSNodeClass{
+				ObjectMeta: metav1.ObjectMeta{Name: strings.ToLower(randomdata.SillyName())},
+				Spec: v1beta1.AKSNodeClassSpec{
+					ImageFamily:      lo.ToPtr(v1beta1.CustomImageFamily),
+					ImageID:          lo.ToPtr("/CommunityGalleries/gallery/images/image/versions/1.0.0"),
+					ImageDistroName:  lo.ToPtr("aks-ubuntu-containerd-22.04-gen2"),
+					CustomImageTerms: []v1beta1.CustomImageTerm{{Name: "ubuntu"}},
+				},
+			}
+			Expect(env.Client.Create(ctx, nodeClass)).ToNot(Succeed())
+		})
+		It("should reject an image ID along with the image version", func() {
+			nodeClass := &v1beta1.AKSNodeClass{
+				ObjectMeta: metav1.ObjectMeta{Name: strings.ToLower(randomdata.SillyName())},
+				Spec: v1beta1.AKSNodeClassSpec{
+					ImageID:         lo.ToPtr("/CommunityGalleries/gallery/images/image/versions/1.0.0"),
+					ImageDistroName: lo.ToPtr("aks-ubuntu-containerd-22.04-gen2"),
+					ImageVersion:    lo.ToPtr("202402.26.0"),
+				},
+			}
+			Expect(env.Client.Create(ctx, nodeClass)).ToNot(Succeed())
+		})
+		It("should reject an image ID without the image distro name", func() {
+			nodeClass := &v1beta1.AKSNodeClass{
+				ObjectMeta: metav1.ObjectMeta{Name: strings.ToLower(randomdata.SillyName())},
+				Spec:       v1beta1.AKSNodeClassSpec{ImageID: lo.ToPtr("/CommunityGalleries/gallery/images/image/versions/1.0.0")},
+			}
+			Expect(env.Client.Create(ctx, nodeClass)).ToNot(Succeed())
+		})
+	})
+	Context("MarketplaceImage", func() {
+		It("should accept a marketplace image", func() {
+			nodeClass := &v1beta1.AKSNodeClass{
+				ObjectMeta: metav1.ObjectMeta{Name: strings.ToLower(randomdata.SillyName())},
+				Spec: v1beta1.AKSNodeClassSpec{
+					MarketplaceImage: &v1beta1.MarketplaceImageTerm{Publisher: "Canonical", Offer: "0001-com-ubuntu-server-jammy", SKU: "22_04-lts-gen2", Version: "22.04.202410090"},
+				},
+			}
+			Expect(env.Client.Create(ctx, nodeClass)).To(Succeed())
+		})
+		It("should reject a marketplace image along with custom image terms", func() {
+			nodeClass := &v1beta1.AKSNodeClass{
+				ObjectMeta: metav1.ObjectMeta{Name: strings.ToLower(randomdata.SillyName())},
+				Spec: v1beta1.AKSNodeClassSpec{
+					ImageFamily:      lo.ToPtr(v1beta1.CustomImageFamily),
+					MarketplaceImage: &v1beta1.MarketplaceImageTerm{Publisher: "Canonical", Offer: "0001-com-ubuntu-server-jammy", SKU: "22_04-lts-gen2"},
+					CustomImageTerms: []v1beta1.CustomImageTerm{{Name: "ubuntu"}},
+				},
+			}
+			Expect(env.Client.Create(ctx, nodeClass)).ToNot(Succeed())
+		})
+		It("should reject a marketplace image along with the image version", func() {
+			nodeClass := &v1beta1.AKSNodeClass{
+				ObjectMeta: metav1.ObjectMeta{Name: strings.ToLower(randomdata.SillyName())},
+				Spec: v1beta1.AKSNodeClassSpec{
+					MarketplaceImage: &v1beta1.MarketplaceImageTerm{Publisher: "Canonical", Offer: "0001-com-ubuntu-server-jammy", SKU: "22_04-lts-gen2"},
+					ImageVersion:     lo.ToPtr("202402.26.0"),
+				},
+			}
+			Expect(env.Client.Create(ctx, nodeClass)).ToNot(Succeed())
+		})
+		It("should reject a marketplace image without a SKU", func() {
+			nodeClass := &v1beta1.AKSNodeClass{
+				ObjectMeta: metav1.ObjectMeta{Name: strings.ToLower(randomdata.SillyName())},
+				Spec: v1beta1.AKSNodeClassSpec{
+					MarketplaceImage: &v1beta1.MarketplaceImageTerm{Publisher: "Canonical", Offer: "0001-com-ubuntu-server-jammy"},
+				},
+			}
+			Expect(env.Client.Create(ctx, nodeClass)).ToNot(Succeed())
+		})
+	})
 })
@@ -17,6 +17,7 @@ limitations under the License.
 package v1beta1
 
 import (
+	corev1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/util/sets"
 	karpv1 "sigs.k8s.io/karpenter/pkg/apis/v1"
 	"sigs.k8s.io/karpenter/pkg/scheduling"
@@ -37,16 +38,26 @@ func init() {
 		AKSLabelMemory,
 
 		LabelSKUAcceleratedNetworking,
+		LabelSKUNetworkingBandwidth,
 
 		LabelSKUStoragePremiumCapable,
 		LabelSKUStorageEphemeralOSMaxSize,
+		LabelSKUStorageLocalProtocol,
+		LabelSKUStorageLocalCount,
+		LabelSKUStorageLocalSize,
 
 		LabelSKUGPUName,
 		LabelSKUGPUManufacturer,
 		LabelSKUGPUCount,
 
+		LabelSKUConfidentialComputing,
+
+		LabelImageFamily,
+
 		AKSLabelCluster,
 	)
+	// GPU nodes are expected to be initializing until the GPU driver is ready, rather than to be tainted
+	scheduling.KnownEphemeralTaints = append(scheduling.KnownEphemeralTaints, GPUInitializingTaint)
 }
 
 var (
@@ -72,6 +83,13 @@ var (
 	HyperVGenerationV2 = "2"
 	ManufacturerNvidia = "nvidia"
 
+	StorageLocalProtocolNVMe = "nvme"
+	StorageLocalProtocolSCSI = "scsi"
+
+	ConfidentialComputingSNP  = "SNP"
+	ConfidentialComputingTDX  = "TDX"
+	ConfidentialComputingNone = "None"
+
 	LabelSKUName    = Group + "/sku-name"    // Standard_A1_v2
 	LabelSKUFamily  = Group + "/sku-family"  // A
 	LabelSKUVersion = Group + "/sku-version" // numerical (without v), with 1 backfilled
@@ -83,27 +101,67 @@ var (
 	AKSLabelMemory = AKSLabelDomain + "/sku-memory" // Same value as sku-memory.
 
 	// selected capabilities (from additive features in VM size name, or from SKU capabilities)
-	LabelSKUAcceleratedNetworking = Group + "/sku-networking-accelerated" // sku.AcceleratedNetworkingEnabled
+	LabelSKUAcceleratedNetworking = Group + "/sku-networking-accelerated"    // sku.AcceleratedNetworkingEnabled
+	LabelSKUNetworkingBandwidth   = Group + "/sku-networking-bandwidth-mbps" // expected bandwidth in Mbps, omitted when unknown
 
 	LabelSKUStoragePremiumCapable     = Group + "/sku-storage-premium-capable"     // sku.IsPremiumIO
 	LabelSKUStorageEphemeralOSMaxSize = Group + "/sku-storage-ephemeralos-maxsize" // calculated as max(sku.CachedDiskBytes, sku.MaxResourceVolumeMB)
+	LabelSKUStorageLocalProtocol      = Group + "/sku-storage-local-protocol"      // nvme or scsi, omitted without local disks
+	LabelSKUStorageLocalCount         = Group + "/sku-storage-local-count"         // number of local disks
+	LabelSKUStorageLocalSize          = Group + "/sku-storage-local-size"          // total local disk capacity in GB
 
 	// GPU labels
 	LabelSKUGPUName         = Group + "/sku-gpu-name"         // ie GPU Accelerator type we parse from vmSize
 	LabelSKUGPUManufacturer = Group + "/sku-gpu-manufacturer" // ie NVIDIA, AMD, etc
 	LabelSKUGPUCount        = Group + "/sku-gpu-count"        // ie 16, 32, etc
 
+	LabelSKUConfidentialComputing = Group + "/sku-confidential-computing" // SNP, TDX or None
+
+	// LabelImageFamily is the image family of nodes. Nodepools requiring an image family, through a label or a requirement,
+	// override the image family of their nodeclass.
+	LabelImageFamily = Group + "/image-family"
+
 	// Internal/restricted labels
 	LabelSKUHyperVGeneration = Group + "/sku-hyperv-generation" // sku.HyperVGenerations
 
 	// AKS labels
 	AKSLabelDomain = "kubernetes.azure.com"
 
-	AKSLabelCluster                 = AKSLabelDomain + "/cluster"
-	AKSLabelKubeletIdentityClientID = AKSLabelDomain + "/kubelet-identity-client-id"
+	AKSLabelCluster                  = AKSLabelDomain + "/cluster"
+	AKSLabelKubeletIdentityClientID  = AKSLabelDomain + "/kubelet-identity-client-id"
+	AKSLabelCgroupMode               = AKSLabelDomain + "/cgroup-mode"                 // v1 or v2, derived from the image
+	AKSLabelEphemeralOSDiskPlacement = AKSLabelDomain + "/ephemeral-os-disk-placement" // NvmeDisk, CacheDisk or ResourceDisk, omitted with a managed OS disk
 
 	AnnotationAKSNodeClassHash        = apis.Group + "/aksnodeclass-hash"
 	AnnotationAKSNodeClassHashVersion = apis.Group + "/aksnodeclass-hash-version"
+	// AnnotationImageFreeze, when set to "true" on an AKSNodeClass, freezes its images at the versions currently in its status
+	AnnotationImageFreeze = apis.Group + "/image-freeze"
+	// AnnotationImageCacheRefresh, when set or changed on an AKSNodeClass, e.g. to the current timestamp, evicts its cached
+	// images and updates its images to the latest versions right away, regardless of its maintenance window
+	AnnotationImageCacheRefresh = apis.Group + "/image-cache-refresh"
+	// AnnotationDrainOnDelete, when set to "true" on an AKSNodeClass, disrupts the NodeClaims referencing it once it's deleted,
+	// within the disruption budgets of their NodePools, rather than waiting on them to be terminated otherwise
+	AnnotationDrainOnDelete = apis.Group + "/drain-on-delete"
+	// AnnotationZoneSpread, when set to "true" on a NodePool, launches its nodes round-robin across zones, in the zone with
+	// the fewest of its nodes, rather than in the zone of the cheapest offering
+	AnnotationZoneSpread = apis.Group + "/zone-spread"
+	// AnnotationCapacityFallback, when set on a NodePool allowing both spot and on-demand, sets when its NodeClaims fall back
+	// from spot to on-demand: Always once no spot offering is available, the default, Never, or AfterNFailures=<n> once <n>
+	// spot launches of the NodePool failed recently, counting the launches finding no spot offering available
+	AnnotationCapacityFallback = apis.Group + "/capacity-fallback"
+
+	// GPUInitializingTaint is registered by GPU nodes, and removed once they report the NodeConditionTypeGPUDriverReady
+	// condition, when GPU driver readiness is enabled with the gpu-driver-ready-timeout option
+	GPUInitializingTaint = corev1.Taint{
+		Key:    Group + "/gpu-initializing",
+		Effect: corev1.TaintEffectNoSchedule,
+	}
+	// NodeConditionTypeGPUDriverReady is reported by GPU nodes once the GPU driver and the device plugin prerequisites
+	// are verified
+	NodeConditionTypeGPUDriverReady corev1.NodeConditionType = "GPUDriverReady"
+	// NodeConditionTypeInstanceHealthy is set on nodes by the instance health evaluator from the instance view of their VM
+	// and the provisioning state of their NICs, for failures on the Azure side that nodes don't report themselves
+	NodeConditionTypeInstanceHealthy corev1.NodeConditionType = "InstanceHealthy"
 )
 
 const (
@@ -111,7 +169,22 @@ const (
 	Ubuntu2204ImageFamily = "Ubuntu2204"
 	Ubuntu2404ImageFamily = "Ubuntu2404"
 	AzureLinuxImageFamily = "AzureLinux"
-	CustomImageFamily     = "Custom"
+	// AzureLinux3ImageFamily is Azure Linux 3.0, whatever the Kubernetes version. The AzureLinux image family is Azure
+	// Linux 2.0 before Kubernetes 1.32, and Azure Linux 3.0 from it.
+	AzureLinux3ImageFamily = "AzureLinux3"
+	// Windows2022ImageFamily is Windows Server 2022 with containerd, the only image family of Windows nodes
+	Windows2022ImageFamily = "Windows2022"
+	CustomImageFamily      = "Custom"
+)
+
+// OverridableImageFamilies are the image families nodepools can override the image family of their nodeclass with.
+// The Custom image family can't be, for requiring the custom image term of the nodeclass.
+var OverridableImageFamilies = sets.New(
+	UbuntuImageFamily,
+	Ubuntu2204ImageFamily,
+	Ubuntu2404ImageFamily,
+	AzureLinuxImageFamily,
+	AzureLinux3ImageFamily,
 )
 
 var UbuntuFamilies = sets.New(
@@ -120,3 +193,12 @@ var UbuntuFamilies = sets.New(
 	Ubuntu2404ImageFamily,
 	CustomImageFamily,
 )
+
+var AzureLinuxFamilies = sets.New(
+	AzureLinuxImageFamily,
+	AzureLinux3ImageFamily,
+)
+
+var WindowsFamilies = sets.New(
+	Windows2022ImageFamily,
+)
@@ -0,0 +1,60 @@
+/*
+Portions Copyright (c) Microsoft Corporation.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1beta1
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/robfig/cron/v3"
+	"github.com/samber/lo"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// Status returns the state of the maintenance window at the time: whether it's open and, if it is, when it closes, and
+// when it next opens
+func (in *MaintenanceWindow) Status(now time.Time) (*MaintenanceWindowStatus, error) {
+	schedule, err := in.schedule()
+	if err != nil {
+		return nil, err
+	}
+	status := &MaintenanceWindowStatus{
+		NextOpenTime: lo.ToPtr(metav1.NewTime(schedule.Next(now))),
+	}
+	// the window is open if it last opened within its duration
+	if opened := schedule.Next(now.Add(-in.Duration.Duration)); !opened.After(now) {
+		status.Open = true
+		status.CloseTime = lo.ToPtr(metav1.NewTime(opened.Add(in.Duration.Duration)))
+	}
+	return status, nil
+}
+
+// NextTransition returns when the maintenance window in this state next opens or closes
+func (in *MaintenanceWindowStatus) NextTransition() time.Time {
+	if in.Open {
+		return in.CloseTime.Time
+	}
+	return in.NextOpenTime.Time
+}
+
+func (in *MaintenanceWindow) schedule() (cron.Schedule, error) {
+	schedule, err := cron.ParseStandard(fmt.Sprintf("TZ=%s %s", lo.FromPtrOr(in.TimeZone, "UTC"), in.Schedule))
+	if err != nil {
+		return nil, fmt.Errorf("parsing maintenance window schedule %q, %w", in.Schedule, err)
+	}
+	return schedule, nil
+}
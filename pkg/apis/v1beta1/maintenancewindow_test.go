@@ -0,0 +1,78 @@
+/*
+Portions Copyright (c) Microsoft Corporation.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1beta1_test
+
+import (
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/samber/lo"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/Azure/karpenter-provider-azure/pkg/apis/v1beta1"
+)
+
+var _ = Describe("MaintenanceWindow", func() {
+	var window *v1beta1.MaintenanceWindow
+	at := func(value string) time.Time {
+		return lo.Must(time.Parse(time.RFC3339, value))
+	}
+
+	BeforeEach(func() {
+		// Sundays 02:00-06:00 UTC
+		window = &v1beta1.MaintenanceWindow{Schedule: "0 2 * * 0", Duration: metav1.Duration{Duration: 4 * time.Hour}}
+	})
+
+	DescribeTable("should report whether the window is open",
+		func(now string, open bool, closeTime string, nextOpenTime string) {
+			status, err := window.Status(at(now))
+			Expect(err).ToNot(HaveOccurred())
+			Expect(status.Open).To(Equal(open))
+			if open {
+				Expect(status.CloseTime.Time).To(BeTemporally("==", at(closeTime)))
+				Expect(status.NextTransition()).To(BeTemporally("==", at(closeTime)))
+			} else {
+				Expect(status.CloseTime).To(BeNil())
+				Expect(status.NextTransition()).To(BeTemporally("==", at(nextOpenTime)))
+			}
+			Expect(status.NextOpenTime.Time).To(BeTemporally("==", at(nextOpenTime)))
+		},
+		Entry("before the window", "2026-10-16T12:00:00Z", false, "", "2026-10-18T02:00:00Z"),
+		Entry("as the window opens", "2026-10-18T02:00:00Z", true, "2026-10-18T06:00:00Z", "2026-10-25T02:00:00Z"),
+		Entry("in the window", "2026-10-18T05:59:00Z", true, "2026-10-18T06:00:00Z", "2026-10-25T02:00:00Z"),
+		Entry("as the window closes", "2026-10-18T06:00:00Z", false, "", "2026-10-25T02:00:00Z"),
+	)
+	It("should open the window in its time zone", func() {
+		window.TimeZone = lo.ToPtr("Europe/Amsterdam")
+		// 02:00 CEST is 00:00 UTC
+		status, err := window.Status(at("2026-10-18T01:00:00Z"))
+		Expect(err).ToNot(HaveOccurred())
+		Expect(status.Open).To(BeTrue())
+		Expect(status.CloseTime.Time).To(BeTemporally("==", at("2026-10-18T04:00:00Z")))
+	})
+	It("should fail on an invalid time zone", func() {
+		window.TimeZone = lo.ToPtr("Mars/Olympus")
+		_, err := window.Status(time.Now())
+		Expect(err).To(HaveOccurred())
+	})
+	It("should fail on an invalid schedule", func() {
+		window.Schedule = "0 25 * * *"
+		_, err := window.Status(time.Now())
+		Expect(err).To(HaveOccurred())
+	})
+})
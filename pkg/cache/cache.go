@@ -16,14 +16,21 @@ limitations under the License.
 
 package cache
 
-import "time"
+import (
+	"time"
+
+	"github.com/patrickmn/go-cache"
+
+	"github.com/Azure/karpenter-provider-azure/pkg/operator/options"
+)
 
 const (
 	// KubernetesVersionTTL is the time before the detected Kubernetes version is removed from cache,
-	// to be re-detected next time it is needed.
+	// to be re-detected next time it is needed. The operator uses the cache-kubernetes-version-ttl option.
 	KubernetesVersionTTL = 15 * time.Minute
 	// UnavailableOfferingsTTL is the time before offerings that were marked as unavailable
-	// are removed from the cache and are available for launch again
+	// are removed from the cache and are available for launch again. The operator uses the
+	// cache-unavailable-offerings-ttl option.
 	UnavailableOfferingsTTL = 3 * time.Minute
 
 	// DefaultCleanupInterval triggers cache cleanup (lazy eviction) at this interval.
@@ -33,3 +40,23 @@ const (
 	// that become available after they get evicted from the cache
 	UnavailableOfferingsCleanupInterval = time.Second * 10
 )
+
+// ProviderCaches are the caches of the providers, configured with the cache options
+type ProviderCaches struct {
+	KubernetesVersion    *cache.Cache
+	Images               *cache.Cache
+	InstanceTypes        *cache.Cache
+	LoadBalancers        *cache.Cache
+	UnavailableOfferings *UnavailableOfferings
+}
+
+// NewProviderCaches returns the caches of the providers with the TTLs and cleanup intervals of the config
+func NewProviderCaches(config options.CacheConfig) ProviderCaches {
+	return ProviderCaches{
+		KubernetesVersion:    cache.New(config.KubernetesVersionTTL, config.KubernetesVersionCleanupInterval),
+		Images:               cache.New(config.ImagesTTL, config.ImagesCleanupInterval),
+		InstanceTypes:        cache.New(config.InstanceTypesTTL, config.InstanceTypesCleanupInterval),
+		LoadBalancers:        cache.New(config.LoadBalancersTTL, config.LoadBalancersCleanupInterval),
+		UnavailableOfferings: NewUnavailableOfferingsWithTTL(config.UnavailableOfferingsTTL, config.UnavailableOfferingsCleanupInterval),
+	}
+}
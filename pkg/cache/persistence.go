@@ -0,0 +1,139 @@
+/*
+Portions Copyright (c) Microsoft Corporation.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cache
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sync/atomic"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+const (
+	// UnavailableOfferingsConfigMapName is the name of the ConfigMap the unavailable offerings are persisted to
+	UnavailableOfferingsConfigMapName = "karpenter-unavailable-offerings"
+
+	unavailableOfferingsConfigMapKey = "offerings"
+	// unavailableOfferingsPersistPeriod is how often the unavailable offerings are persisted, if they changed, so that
+	// the many offerings marked unavailable during a capacity shortage are persisted together
+	unavailableOfferingsPersistPeriod = 10 * time.Second
+)
+
+// UnavailableOfferingsPersister persists the unavailable offerings to a ConfigMap, so that they survive restarts of the
+// operator: otherwise, it would attempt to launch all the offerings it had just learned were unavailable again. The
+// persisted offerings are restored once, as the persister starts, and the in-memory cache is authoritative thereafter.
+type UnavailableOfferingsPersister struct {
+	unavailableOfferings *UnavailableOfferings
+	kubernetesInterface  kubernetes.Interface
+	namespace            string
+	// persistedSeqNum is the sequence number of the unavailable offerings when they were last persisted
+	persistedSeqNum uint64
+}
+
+func NewUnavailableOfferingsPersister(unavailableOfferings *UnavailableOfferings, kubernetesInterface kubernetes.Interface, namespace string) *UnavailableOfferingsPersister {
+	return &UnavailableOfferingsPersister{
+		unavailableOfferings: unavailableOfferings,
+		kubernetesInterface:  kubernetesInterface,
+		namespace:            namespace,
+	}
+}
+
+// Start restores the persisted unavailable offerings, then persists them whenever they change, until the context is
+// canceled
+func (p *UnavailableOfferingsPersister) Start(ctx context.Context) error {
+	ctx = log.IntoContext(ctx, log.FromContext(ctx).WithName("unavailableofferings").WithValues("ConfigMap", p.namespace+"/"+UnavailableOfferingsConfigMapName))
+	if err := p.Restore(ctx); err != nil {
+		log.FromContext(ctx).Error(err, "failed to restore the unavailable offerings")
+	}
+	ticker := time.NewTicker(unavailableOfferingsPersistPeriod)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+			if err := p.Persist(ctx); err != nil {
+				log.FromContext(ctx).Error(err, "failed to persist the unavailable offerings")
+			}
+		}
+	}
+}
+
+// NeedLeaderElection is true so that only the leader, which launches the VMs and so marks offerings unavailable,
+// persists them
+func (p *UnavailableOfferingsPersister) NeedLeaderElection() bool {
+	return true
+}
+
+// Restore marks the persisted unavailable offerings that haven't expired unavailable until their expiration
+func (p *UnavailableOfferingsPersister) Restore(ctx context.Context) error {
+	configMap, err := p.kubernetesInterface.CoreV1().ConfigMaps(p.namespace).Get(ctx, UnavailableOfferingsConfigMapName, metav1.GetOptions{})
+	if err != nil {
+		if errors.IsNotFound(err) {
+			return nil
+		}
+		return fmt.Errorf("getting configmap, %w", err)
+	}
+	var offerings []UnavailableOffering
+	if data, ok := configMap.Data[unavailableOfferingsConfigMapKey]; ok {
+		if err := json.Unmarshal([]byte(data), &offerings); err != nil {
+			return fmt.Errorf("unmarshaling unavailable offerings, %w", err)
+		}
+	}
+	restored := p.unavailableOfferings.Restore(ctx, offerings)
+	log.FromContext(ctx).Info("restored unavailable offerings", "restored", restored, "expired", len(offerings)-restored)
+	// the restored offerings are persisted already, but for those that expired
+	p.persistedSeqNum = atomic.LoadUint64(&p.unavailableOfferings.SeqNum)
+	return nil
+}
+
+// Persist writes the unavailable offerings to the ConfigMap, if they changed since they were last persisted
+func (p *UnavailableOfferingsPersister) Persist(ctx context.Context) error {
+	seqNum := atomic.LoadUint64(&p.unavailableOfferings.SeqNum)
+	if seqNum == p.persistedSeqNum {
+		return nil
+	}
+	data, err := json.Marshal(p.unavailableOfferings.List())
+	if err != nil {
+		return fmt.Errorf("marshaling unavailable offerings, %w", err)
+	}
+
+	configMaps := p.kubernetesInterface.CoreV1().ConfigMaps(p.namespace)
+	configMap, err := configMaps.Get(ctx, UnavailableOfferingsConfigMapName, metav1.GetOptions{})
+	if errors.IsNotFound(err) {
+		_, err = configMaps.Create(ctx, &corev1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{Name: UnavailableOfferingsConfigMapName, Namespace: p.namespace},
+			Data:       map[string]string{unavailableOfferingsConfigMapKey: string(data)},
+		}, metav1.CreateOptions{})
+	} else if err == nil {
+		configMap.Data = map[string]string{unavailableOfferingsConfigMapKey: string(data)}
+		_, err = configMaps.Update(ctx, configMap, metav1.UpdateOptions{})
+	}
+	if err != nil {
+		return fmt.Errorf("writing configmap, %w", err)
+	}
+	p.persistedSeqNum = seqNum
+	log.FromContext(ctx).V(1).Info("persisted unavailable offerings")
+	return nil
+}
@@ -0,0 +1,140 @@
+/*
+Portions Copyright (c) Microsoft Corporation.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cache
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+	karpv1 "sigs.k8s.io/karpenter/pkg/apis/v1"
+)
+
+const testNamespace = "karpenter"
+
+func persistedOfferingsConfigMap(t *testing.T, offerings []UnavailableOffering) *corev1.ConfigMap {
+	t.Helper()
+	data, err := json.Marshal(offerings)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Name: UnavailableOfferingsConfigMapName, Namespace: testNamespace},
+		Data:       map[string]string{unavailableOfferingsConfigMapKey: string(data)},
+	}
+}
+
+func TestUnavailableOfferingsPersisterRestoresUnexpiredOfferings(t *testing.T) {
+	ctx := context.Background()
+	now := time.Now()
+	kubernetesInterface := fake.NewClientset(persistedOfferingsConfigMap(t, []UnavailableOffering{
+		{InstanceType: "Standard_D2_v2", Zone: "westus-1", CapacityType: karpv1.CapacityTypeOnDemand, Reason: "SkuNotAvailable", Expiration: now.Add(-time.Minute)},
+		{InstanceType: "Standard_D4_v2", Zone: "westus-1", CapacityType: karpv1.CapacityTypeOnDemand, Reason: "ZonalAllocationFailure", Expiration: now.Add(time.Hour)},
+		{Family: "standarddv2family", MinCPUs: 16, Zone: "westus-2", CapacityType: karpv1.CapacityTypeOnDemand, Reason: VMFamilyUnavailableReason, Expiration: now.Add(time.Hour)},
+		{Family: "standarddv3family", Zone: "westus-2", CapacityType: karpv1.CapacityTypeOnDemand, Reason: VMFamilyUnavailableReason, Expiration: now.Add(-time.Hour)},
+		{CapacityType: karpv1.CapacityTypeSpot, Reason: "SpotUnavailable", Expiration: now.Add(-time.Second)},
+	}))
+
+	// the operator restarts with an empty cache
+	u := NewUnavailableOfferings()
+	persister := NewUnavailableOfferingsPersister(u, kubernetesInterface, testNamespace)
+	if err := persister.Restore(ctx); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	d2 := createTestSKU("Standard_D2_v2", "standardDv2Family", "D2_v2", 2)
+	d4 := createTestSKU("Standard_D4_v2", "standardDv2Family", "D4_v2", 8)
+	d16 := createTestSKU("Standard_D16_v2", "standardDv2Family", "D16_v2", 16)
+	d2v3 := createTestSKU("Standard_D2_v3", "standardDv3Family", "D2_v3", 2)
+
+	assertOfferingAvailable(t, u, d2, "westus-1", karpv1.CapacityTypeOnDemand, "expired offering should not be restored")
+	assertOfferingUnavailable(t, u, d4, "westus-1", karpv1.CapacityTypeOnDemand, "unexpired offering should be restored")
+	if reason, _ := u.UnavailableReason(d4, "westus-1", karpv1.CapacityTypeOnDemand); reason != "ZonalAllocationFailure" {
+		t.Errorf("expected the restored reason ZonalAllocationFailure, got %q", reason)
+	}
+	assertOfferingUnavailable(t, u, d16, "westus-2", karpv1.CapacityTypeOnDemand, "unexpired family block should be restored")
+	assertOfferingAvailable(t, u, d4, "westus-2", karpv1.CapacityTypeOnDemand, "restored family block should keep its CPU count")
+	assertOfferingAvailable(t, u, d2v3, "westus-2", karpv1.CapacityTypeOnDemand, "expired family block should not be restored")
+	assertOfferingAvailable(t, u, d4, "westus-3", karpv1.CapacityTypeSpot, "expired spot block should not be restored")
+
+	// the restored offerings expire when they would have before the restart
+	for _, offering := range u.List() {
+		if offering.Expiration.Sub(now.Add(time.Hour)).Abs() > time.Second {
+			t.Errorf("expected %v to expire in an hour, expires at %s", offering, offering.Expiration)
+		}
+	}
+}
+
+func TestUnavailableOfferingsPersisterPersistsChanges(t *testing.T) {
+	ctx := context.Background()
+	kubernetesInterface := fake.NewClientset()
+	u := NewUnavailableOfferings()
+	persister := NewUnavailableOfferingsPersister(u, kubernetesInterface, testNamespace)
+	// restoring without a persisted ConfigMap restores nothing
+	if err := persister.Restore(ctx); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// nothing changed, so nothing is persisted
+	if err := persister.Persist(ctx); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, err := kubernetesInterface.CoreV1().ConfigMaps(testNamespace).Get(ctx, UnavailableOfferingsConfigMapName, metav1.GetOptions{}); err == nil {
+		t.Fatal("expected no ConfigMap to be created before any offering is marked unavailable")
+	}
+
+	u.MarkUnavailable(ctx, "SkuNotAvailable", "Standard_D2_v2", "westus-1", karpv1.CapacityTypeOnDemand)
+	if err := persister.Persist(ctx); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	u.MarkFamilyUnavailable(ctx, "standardDv2Family", "westus-2", karpv1.CapacityTypeSpot, time.Hour)
+	if err := persister.Persist(ctx); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// a restarted operator restores the persisted offerings
+	restarted := NewUnavailableOfferings()
+	if err := NewUnavailableOfferingsPersister(restarted, kubernetesInterface, testNamespace).Restore(ctx); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	d2 := createTestSKU("Standard_D2_v2", "standardDv2Family", "D2_v2", 2)
+	assertOfferingUnavailable(t, restarted, d2, "westus-1", karpv1.CapacityTypeOnDemand, "persisted offering should be restored")
+	assertOfferingUnavailable(t, restarted, d2, "westus-2", karpv1.CapacityTypeSpot, "persisted family block should be restored")
+	assertOfferingAvailable(t, restarted, d2, "westus-2", karpv1.CapacityTypeOnDemand, "offering that wasn't persisted should be available")
+	if len(restarted.List()) != len(u.List()) {
+		t.Errorf("expected %d restored offerings, got %d", len(u.List()), len(restarted.List()))
+	}
+}
+
+func TestUnavailableOfferingsRestoreKeepsMoreRestrictiveFamilyBlock(t *testing.T) {
+	ctx := context.Background()
+	u := NewUnavailableOfferings()
+	u.MarkFamilyUnavailable(ctx, "standardDv2Family", "westus-1", karpv1.CapacityTypeOnDemand, time.Hour)
+
+	restored := u.Restore(ctx, []UnavailableOffering{
+		{Family: "standarddv2family", MinCPUs: 16, Zone: "westus-1", CapacityType: karpv1.CapacityTypeOnDemand, Reason: VMFamilyUnavailableReason, Expiration: time.Now().Add(time.Hour)},
+	})
+	if restored != 1 {
+		t.Errorf("expected 1 restored offering, got %d", restored)
+	}
+	d2 := createTestSKU("Standard_D2_v2", "standardDv2Family", "D2_v2", 2)
+	assertOfferingUnavailable(t, u, d2, "westus-1", karpv1.CapacityTypeOnDemand, "whole family block should be kept")
+}
@@ -19,12 +19,14 @@ package cache
 import (
 	"context"
 	"fmt"
+	"sort"
 	"strings"
 	"sync/atomic"
 	"time"
 
 	"github.com/Azure/skewer"
 	"github.com/patrickmn/go-cache"
+	"github.com/samber/lo"
 	"sigs.k8s.io/controller-runtime/pkg/log"
 	karpv1 "sigs.k8s.io/karpenter/pkg/apis/v1"
 
@@ -34,6 +36,8 @@ import (
 const (
 	// wholeVMFamilyBlockedSentinel means that entire SKU family is blocked, not just certain instance types with a CPU count above a threshold
 	wholeVMFamilyBlockedSentinel = -1
+	// VMFamilyUnavailableReason is the reason of offerings unavailable because their VM family is
+	VMFamilyUnavailableReason = "VMFamilyUnavailable"
 )
 
 var (
@@ -48,17 +52,20 @@ var (
 // We don't bundle the two caches together into one to avoid accidentally bundling together different SKUs while handling errors which don't necessarily warrant blocking more than just the single instance type.
 // This could be adjusted in the future, as we gather more data and get more confidence in information available in skewer.SKU.
 type UnavailableOfferings struct {
-	// key: <capacityType>:<instanceType>:<zone>, value: struct{}{}
+	// key: <capacityType>:<instanceType>:<zone>, value: string (the reason the offering is unavailable)
 	singleOfferingCache *cache.Cache
 	// key: <skuFamilyName>:<zone>:<capacityType> (lowercase), value: int64 (CPU count at or above which we block, or wholeVMFamilyBlockedSentinel if entire family is blocked)
 	vmFamilyCache *cache.Cache
-	SeqNum        uint64
+	// ttl is how long offerings marked unavailable without a custom TTL are excluded
+	ttl    time.Duration
+	SeqNum uint64
 }
 
 func NewUnavailableOfferingsWithCache(singleOfferingCache, vmFamilyCache *cache.Cache) *UnavailableOfferings {
 	uo := &UnavailableOfferings{
 		singleOfferingCache: singleOfferingCache,
 		vmFamilyCache:       vmFamilyCache,
+		ttl:                 UnavailableOfferingsTTL,
 		SeqNum:              0,
 	}
 	uo.singleOfferingCache.OnEvicted(func(_ string, _ interface{}) {
@@ -71,28 +78,48 @@ func NewUnavailableOfferingsWithCache(singleOfferingCache, vmFamilyCache *cache.
 }
 
 func NewUnavailableOfferings() *UnavailableOfferings {
-	return NewUnavailableOfferingsWithCache(
-		cache.New(UnavailableOfferingsTTL, UnavailableOfferingsCleanupInterval),
-		cache.New(UnavailableOfferingsTTL, UnavailableOfferingsCleanupInterval),
+	return NewUnavailableOfferingsWithTTL(UnavailableOfferingsTTL, UnavailableOfferingsCleanupInterval)
+}
+
+// NewUnavailableOfferingsWithTTL returns an UnavailableOfferings excluding offerings for ttl unless marked unavailable
+// with a custom TTL, and evicting them every cleanupInterval
+func NewUnavailableOfferingsWithTTL(ttl, cleanupInterval time.Duration) *UnavailableOfferings {
+	uo := NewUnavailableOfferingsWithCache(
+		cache.New(ttl, cleanupInterval),
+		cache.New(ttl, cleanupInterval),
 	)
+	uo.ttl = ttl
+	return uo
 }
 
 // IsUnavailable returns true if the offering appears in the cache
 func (u *UnavailableOfferings) IsUnavailable(sku *skewer.SKU, zone, capacityType string) bool {
+	_, unavailable := u.UnavailableReason(sku, zone, capacityType)
+	return unavailable
+}
+
+// UnavailableReason returns the reason the offering was marked unavailable with, and whether it appears in the cache
+func (u *UnavailableOfferings) UnavailableReason(sku *skewer.SKU, zone, capacityType string) (string, bool) {
 	if capacityType == karpv1.CapacityTypeSpot {
-		if _, found := u.singleOfferingCache.Get(spotKey); found {
-			return true
+		if reason, found := u.singleOfferingCache.Get(spotKey); found {
+			return reasonOf(reason), true
 		}
 	}
 
 	// check if there offering is marked as unavailable at vm family level
 	if u.isFamilyUnavailable(sku, zone, capacityType) {
-		return true
+		return VMFamilyUnavailableReason, true
 	}
 
 	// lastly check if the offering is marked as unavailable for the specific instance type, zone and capacity type
-	_, found := u.singleOfferingCache.Get(singleInstanceKey(sku.GetName(), zone, capacityType))
-	return found
+	reason, found := u.singleOfferingCache.Get(singleInstanceKey(sku.GetName(), zone, capacityType))
+	return reasonOf(reason), found
+}
+
+// reasonOf returns the reason of a single offering cache entry
+func reasonOf(value interface{}) string {
+	reason, _ := value.(string)
+	return reason
 }
 
 func (u *UnavailableOfferings) isFamilyUnavailable(sku *skewer.SKU, zone, capacityType string) bool {
@@ -161,13 +188,83 @@ func (u *UnavailableOfferings) MarkUnavailableWithTTL(ctx context.Context, unava
 		"zone", zone,
 		"capacity-type", capacityType,
 		"ttl", ttl)
-	u.singleOfferingCache.Set(singleInstanceKey(instanceType, zone, capacityType), struct{}{}, ttl)
+	u.singleOfferingCache.Set(singleInstanceKey(instanceType, zone, capacityType), unavailableReason, ttl)
 	atomic.AddUint64(&u.SeqNum, 1)
 }
 
 // MarkUnavailable communicates recently observed temporary capacity shortages in the provided offerings
 func (u *UnavailableOfferings) MarkUnavailable(ctx context.Context, unavailableReason, instanceType, zone, capacityType string) {
-	u.MarkUnavailableWithTTL(ctx, unavailableReason, instanceType, zone, capacityType, UnavailableOfferingsTTL)
+	u.MarkUnavailableWithTTL(ctx, unavailableReason, instanceType, zone, capacityType, u.ttl)
+}
+
+// UnavailableOffering is an entry of the unavailable offerings, for introspection. Entries either block an instance
+// type, a VM family (its instance types with at least MinCPUs, or all of them when MinCPUs is 0), or all spot
+// offerings when neither is set.
+type UnavailableOffering struct {
+	InstanceType string    `json:"instanceType,omitempty"`
+	Family       string    `json:"family,omitempty"`
+	MinCPUs      int64     `json:"minCPUs,omitempty"`
+	Zone         string    `json:"zone,omitempty"`
+	CapacityType string    `json:"capacityType"`
+	Reason       string    `json:"reason"`
+	Expiration   time.Time `json:"expiration"`
+}
+
+// List returns the unavailable offerings that haven't expired, soonest to expire first
+func (u *UnavailableOfferings) List() []UnavailableOffering {
+	offerings := []UnavailableOffering{}
+	for key, item := range u.singleOfferingCache.Items() {
+		// <capacityType>:<instanceType>:<zone>
+		parts := strings.SplitN(key, ":", 3)
+		if len(parts) != 3 {
+			continue
+		}
+		offerings = append(offerings, UnavailableOffering{
+			CapacityType: parts[0],
+			InstanceType: parts[1],
+			Zone:         parts[2],
+			Reason:       reasonOf(item.Object),
+			Expiration:   time.Unix(0, item.Expiration),
+		})
+	}
+	for key, item := range u.vmFamilyCache.Items() {
+		// skufamily:<skuFamilyName>:<zone>:<capacityType>
+		parts := strings.SplitN(key, ":", 4)
+		if len(parts) != 4 {
+			continue
+		}
+		cpuCount, _ := item.Object.(int64)
+		offerings = append(offerings, UnavailableOffering{
+			Family:       parts[1],
+			MinCPUs:      max(cpuCount, 0), // wholeVMFamilyBlockedSentinel => 0
+			Zone:         parts[2],
+			CapacityType: parts[3],
+			Reason:       VMFamilyUnavailableReason,
+			Expiration:   time.Unix(0, item.Expiration),
+		})
+	}
+	sort.Slice(offerings, func(i, j int) bool { return offerings[i].Expiration.Before(offerings[j].Expiration) })
+	return offerings
+}
+
+// Restore marks the offerings, as listed by List, unavailable until their expiration, discarding those that already
+// expired, and returns how many were restored
+func (u *UnavailableOfferings) Restore(ctx context.Context, offerings []UnavailableOffering) int {
+	restored := 0
+	for _, offering := range offerings {
+		ttl := time.Until(offering.Expiration)
+		if ttl <= 0 {
+			continue
+		}
+		if offering.Family != "" {
+			u.MarkFamilyUnavailableAtCPUCount(ctx, offering.Family, offering.Zone, offering.CapacityType,
+				lo.Ternary(offering.MinCPUs > 0, offering.MinCPUs, wholeVMFamilyBlockedSentinel), ttl)
+		} else {
+			u.MarkUnavailableWithTTL(ctx, offering.Reason, offering.InstanceType, offering.Zone, offering.CapacityType, ttl)
+		}
+		restored++
+	}
+	return restored
 }
 
 func (u *UnavailableOfferings) Flush() {
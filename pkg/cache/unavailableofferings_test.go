@@ -230,3 +230,35 @@ func TestUnavailableOfferingsRestrictiveLimitPreservation(t *testing.T) {
 		assertOfferingAvailable(t, u, sku, "westus-1", karpv1.CapacityTypeOnDemand, "Offering should not be marked as unavailable after cache expiration")
 	}
 }
+
+func TestUnavailableOfferingsList(t *testing.T) {
+	u := NewUnavailableOfferingsWithCache(cache.New(time.Minute, time.Minute), cache.New(time.Minute, time.Minute))
+	if offerings := u.List(); len(offerings) != 0 {
+		t.Fatalf("expected no unavailable offerings initially, got %v", offerings)
+	}
+
+	u.MarkUnavailableWithTTL(context.TODO(), "test reason", "Standard_D2s_v3", "westus-1", karpv1.CapacityTypeOnDemand, 2*time.Minute)
+	u.MarkSpotUnavailableWithTTL(context.TODO(), 3*time.Minute)
+	u.MarkFamilyUnavailableAtCPUCount(context.TODO(), "standardNVasv4Family", "westus-2", karpv1.CapacityTypeSpot, 16, time.Minute)
+	u.MarkFamilyUnavailable(context.TODO(), "standardDSv3Family", "westus-3", karpv1.CapacityTypeOnDemand, 4*time.Minute)
+
+	offerings := u.List()
+	expected := []UnavailableOffering{
+		{Family: "standardnvasv4family", MinCPUs: 16, Zone: "westus-2", CapacityType: karpv1.CapacityTypeSpot, Reason: VMFamilyUnavailableReason},
+		{InstanceType: "Standard_D2s_v3", Zone: "westus-1", CapacityType: karpv1.CapacityTypeOnDemand, Reason: "test reason"},
+		{CapacityType: karpv1.CapacityTypeSpot, Reason: "SpotUnavailable"},
+		{Family: "standarddsv3family", Zone: "westus-3", CapacityType: karpv1.CapacityTypeOnDemand, Reason: VMFamilyUnavailableReason},
+	}
+	if len(offerings) != len(expected) {
+		t.Fatalf("expected %d unavailable offerings, got %v", len(expected), offerings)
+	}
+	for i := range expected {
+		if offerings[i].Expiration.Before(time.Now()) {
+			t.Errorf("expected offering %d to expire in the future, expires at %s", i, offerings[i].Expiration)
+		}
+		offerings[i].Expiration = time.Time{}
+		if offerings[i] != expected[i] {
+			t.Errorf("expected offering %d to be %+v, got %+v", i, expected[i], offerings[i])
+		}
+	}
+}
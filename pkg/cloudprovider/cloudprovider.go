@@ -21,7 +21,7 @@ import (
 	stderrors "errors"
 	"fmt"
 	"net/http"
-	"strings"
+	"sync"
 	"time"
 
 	"github.com/awslabs/operatorpkg/status"
@@ -48,10 +48,13 @@ import (
 
 	cloudproviderevents "github.com/Azure/karpenter-provider-azure/pkg/cloudprovider/events"
 	"github.com/Azure/karpenter-provider-azure/pkg/providers/imagefamily"
+	"github.com/Azure/karpenter-provider-azure/pkg/providers/imagefamily/bootstrap"
 	"github.com/Azure/karpenter-provider-azure/pkg/providers/instance"
 	"github.com/Azure/karpenter-provider-azure/pkg/providers/instance/offerings"
 	"github.com/Azure/karpenter-provider-azure/pkg/providers/instancetype"
 	"github.com/Azure/karpenter-provider-azure/pkg/providers/launchtemplate"
+	"github.com/Azure/karpenter-provider-azure/pkg/providers/pricing"
+	"github.com/Azure/karpenter-provider-azure/pkg/tracing"
 	"github.com/Azure/karpenter-provider-azure/pkg/utils"
 	nodeclaimutils "github.com/Azure/karpenter-provider-azure/pkg/utils/nodeclaim"
 
@@ -69,6 +72,7 @@ const (
 	NodeClassReadinessUnknownReason    = "NodeClassReadinessUnknown"
 	InstanceTypeResolutionFailedReason = "InstanceTypeResolutionFailed"
 	CreateInstanceFailedReason         = "CreateInstanceFailed"
+	ImageFamilyResolutionFailedReason  = "ImageFamilyResolutionFailed"
 )
 
 var _ cloudprovider.CloudProvider = (*CloudProvider)(nil)
@@ -79,6 +83,8 @@ type CloudProvider struct {
 	kubeClient           client.Client
 	imageProvider        imagefamily.NodeImageProvider
 	recorder             events.Recorder
+	// launchedImages is the image each nodeclass last launched with, by nodeclass UID and distro, see recordLaunch
+	launchedImages sync.Map
 }
 
 func New(
@@ -98,6 +104,11 @@ func New(
 }
 
 func (c *CloudProvider) validateNodeClass(nodeClass *v1beta1.AKSNodeClass) error {
+	// checked ahead of the readiness of the NodeClass, which doesn't tell what is wrong with the images, e.g. their source
+	// having become inaccessible
+	if imagesReady := nodeClass.StatusConditions().Get(v1beta1.ConditionTypeImagesReady); imagesReady.IsFalse() {
+		return cloudprovider.NewNodeClassNotReadyError(fmt.Errorf("NodeClass condition %s is False, %s", v1beta1.ConditionTypeImagesReady, imagesReady.Message))
+	}
 	nodeClassReady := nodeClass.StatusConditions().Get(status.ConditionReady)
 	if nodeClassReady.IsFalse() {
 		return cloudprovider.NewNodeClassNotReadyError(stderrors.New(nodeClassReady.Message))
@@ -114,7 +125,15 @@ func (c *CloudProvider) validateNodeClass(nodeClass *v1beta1.AKSNodeClass) error
 	return nil
 }
 
-func (c *CloudProvider) Create(ctx context.Context, nodeClaim *karpv1.NodeClaim) (*karpv1.NodeClaim, error) {
+func (c *CloudProvider) Create(ctx context.Context, nodeClaim *karpv1.NodeClaim) (_ *karpv1.NodeClaim, err error) {
+	// the stages of the launch are traced as children of the span of the nodeclaim, including those completing
+	// asynchronously after it ends
+	ctx, span := tracing.Start(ctx, tracing.SpanCreate,
+		tracing.NodeClaimKey.String(nodeClaim.Name),
+		tracing.NodePoolKey.String(nodeClaim.Labels[karpv1.NodePoolLabelKey]),
+	)
+	defer func() { tracing.End(span, err) }()
+
 	nodeClass, err := nodeclaimutils.GetAKSNodeClass(ctx, c.kubeClient, nodeClaim)
 	if err != nil {
 		if errors.IsNotFound(err) {
@@ -136,10 +155,22 @@ func (c *CloudProvider) Create(ctx context.Context, nodeClaim *karpv1.NodeClaim)
 		}
 	*/
 	if err = c.validateNodeClass(nodeClass); err != nil {
+		if imagesReady := nodeClass.StatusConditions().Get(v1beta1.ConditionTypeImagesReady); imagesReady.IsFalse() {
+			c.recorder.Publish(cloudproviderevents.NodeClaimImagesNotReady(nodeClaim, imagesReady.Message))
+		}
 		return nil, err
 	}
 
-	instanceTypes, err := c.resolveInstanceTypes(ctx, nodeClaim, nodeClass)
+	launchNodeClass, err := c.launchNodeClass(ctx, nodeClaim, nodeClass)
+	if err != nil {
+		return nil, cloudprovider.NewCreateError(fmt.Errorf("resolving image family, %w", err), ImageFamilyResolutionFailedReason, truncateMessage(err.Error()))
+	}
+	if imagefamily.IsWindows(launchNodeClass.Spec.ImageFamily) {
+		if err = imagefamily.ValidateWindows(ctx, nodeClaim); err != nil {
+			return nil, cloudprovider.NewCreateError(fmt.Errorf("validating windows node, %w", err), ImageFamilyResolutionFailedReason, truncateMessage(err.Error()))
+		}
+	}
+	instanceTypes, err := c.resolveInstanceTypes(ctx, nodeClaim, launchNodeClass)
 	if err != nil {
 		return nil, cloudprovider.NewCreateError(fmt.Errorf("resolving instance types, %w", err), InstanceTypeResolutionFailedReason, truncateMessage(err.Error()))
 	}
@@ -147,14 +178,32 @@ func (c *CloudProvider) Create(ctx context.Context, nodeClaim *karpv1.NodeClaim)
 		return nil, cloudprovider.NewInsufficientCapacityError(fmt.Errorf("all requested instance types were unavailable during launch"))
 	}
 
-	return c.createVMInstance(ctx, nodeClass, nodeClaim, instanceTypes)
+	return c.createVMInstance(ctx, nodeClass, launchNodeClass, nodeClaim, instanceTypes)
 }
 
-func (c *CloudProvider) createVMInstance(ctx context.Context, nodeClass *v1beta1.AKSNodeClass, nodeClaim *karpv1.NodeClaim, instanceTypes []*cloudprovider.InstanceType) (*karpv1.NodeClaim, error) {
-	vmPromise, err := c.vmInstanceProvider.BeginCreate(ctx, nodeClass, nodeClaim, instanceTypes)
+// createVMInstance launches the VM of the nodeclaim with launchNodeClass, which is its nodeclass unless the nodeclaim
+// overrides the image family
+func (c *CloudProvider) createVMInstance(ctx context.Context, nodeClass, launchNodeClass *v1beta1.AKSNodeClass, nodeClaim *karpv1.NodeClaim, instanceTypes []*cloudprovider.InstanceType) (*karpv1.NodeClaim, error) {
+	vmPromise, err := c.vmInstanceProvider.BeginCreate(ctx, launchNodeClass, nodeClaim, instanceTypes)
+	imagesNodeClass := launchNodeClass
+	var imageNotFoundErr *instance.ImageNotFoundError
+	if stderrors.As(err, &imageNotFoundErr) {
+		// the image version may have been deleted since it was resolved
+		reresolvedNodeClass, resolveErr := c.reresolveImage(ctx, nodeClass, launchNodeClass, imageNotFoundErr.ImageID)
+		recordImageNotFoundRecovery(imageNotFoundErr, resolveErr == nil)
+		if resolveErr != nil {
+			return nil, c.imagesNotReady(ctx, nodeClass, launchNodeClass, nodeClaim, resolveErr)
+		}
+		vmPromise, err = c.vmInstanceProvider.BeginCreate(ctx, reresolvedNodeClass, nodeClaim, instanceTypes)
+		imagesNodeClass = reresolvedNodeClass
+	}
 	if err != nil {
 		return nil, cloudprovider.NewCreateError(fmt.Errorf("creating instance failed, %w", err), CreateInstanceFailedReason, truncateMessage(err.Error()))
 	}
+	if vmPromise.CapacityFallback != "" {
+		c.recorder.Publish(cloudproviderevents.NodeClaimCapacityFallback(nodeClaim, vmPromise.CapacityFallback, vmPromise.SpotFailures))
+	}
+	c.recordLaunch(nodeClass, imagesNodeClass, nodeClaim, vmPromise)
 
 	if err := c.handleInstancePromise(ctx, vmPromise, nodeClaim); err != nil {
 		return nil, err
@@ -169,9 +218,18 @@ func (c *CloudProvider) createVMInstance(ctx context.Context, nodeClass *v1beta1
 	if err != nil {
 		return nil, err
 	}
+	// the image family the VM is launched with is recorded, for nodepools changing the image family they require to
+	// drift the nodes of the previous one
+	if family := lo.FromPtr(launchNodeClass.Spec.ImageFamily); family != "" {
+		newNodeClaim.Labels[v1beta1.LabelImageFamily] = family
+	}
 	if err := setAdditionalAnnotationsForNewNodeClaim(ctx, newNodeClaim, nodeClass); err != nil {
 		return nil, err
 	}
+	setEstimatedCostAnnotations(newNodeClaim, instanceType)
+	if options.FromContext(ctx).EnableBootstrapDebug {
+		setBootstrapDebugAnnotations(newNodeClaim, vmPromise.LaunchTemplate)
+	}
 	return newNodeClaim, nil
 }
 
@@ -286,24 +344,15 @@ func (c *CloudProvider) List(ctx context.Context) ([]*karpv1.NodeClaim, error) {
 
 		nodeClaims = append(nodeClaims, nodeClaim)
 	}
-	return nodeClaims, nil
+	return c.withRecentlyLaunched(ctx, nodeClaims)
 }
 
 func (c *CloudProvider) Get(ctx context.Context, providerID string) (*karpv1.NodeClaim, error) {
-	vmName, err := nodeclaimutils.GetVMName(providerID)
-	if err != nil {
-		return nil, fmt.Errorf("getting vm name, %w", err)
+	nodeClaim, err := c.get(ctx, providerID)
+	if cloudprovider.IsNodeClaimNotFoundError(err) {
+		return nil, c.notFoundWithinGracePeriod(ctx, providerID, err)
 	}
-	ctx = log.IntoContext(ctx, log.FromContext(ctx).WithValues("vmName", vmName))
-	vm, err := c.vmInstanceProvider.Get(ctx, vmName)
-	if err != nil {
-		return nil, fmt.Errorf("getting VM instance, %w", err)
-	}
-	instanceType, err := c.resolveInstanceTypeFromVMInstance(ctx, vm)
-	if err != nil {
-		return nil, fmt.Errorf("resolving instance type, %w", err)
-	}
-	return c.vmInstanceToNodeClaim(ctx, vm, instanceType)
+	return nodeClaim, err
 }
 
 func (c *CloudProvider) LivenessProbe(req *http.Request) error {
@@ -323,10 +372,15 @@ func (c *CloudProvider) GetInstanceTypes(ctx context.Context, nodePool *karpv1.N
 		// as the cause.
 		return nil, fmt.Errorf("resolving node class, %w", err)
 	}
+	nodeClass, err = nodePoolNodeClass(nodePool, nodeClass)
+	if err != nil {
+		return nil, fmt.Errorf("resolving image family, %w", err)
+	}
 	instanceTypes, err := c.instanceTypeProvider.List(ctx, nodeClass)
 	if err != nil {
 		return nil, err
 	}
+	c.checkSeriesRetirement(ctx, nodePool, nodeClass, instanceTypes)
 	return instanceTypes, nil
 }
 
@@ -336,6 +390,9 @@ func (c *CloudProvider) Delete(ctx context.Context, nodeClaim *karpv1.NodeClaim)
 	if err != nil {
 		return fmt.Errorf("getting VM name, %w", err)
 	}
+	if wait, err := c.awaitDataDiskDetachment(ctx, nodeClaim, vmName); err != nil || wait {
+		return err
+	}
 	return c.vmInstanceProvider.Delete(ctx, vmName)
 }
 
@@ -389,6 +446,12 @@ func (c *CloudProvider) RepairPolicies() []cloudprovider.RepairPolicy {
 			ConditionStatus:    corev1.ConditionUnknown,
 			TolerationDuration: 10 * time.Minute,
 		},
+		// Reported by the instance health evaluator, for failures on the Azure side
+		{
+			ConditionType:      v1beta1.NodeConditionTypeInstanceHealthy,
+			ConditionStatus:    corev1.ConditionFalse,
+			TolerationDuration: 10 * time.Minute,
+		},
 	}
 }
 
@@ -479,7 +542,7 @@ func (c *CloudProvider) vmInstanceToNodeClaim(ctx context.Context, vm *armcomput
 		labels[karpv1.NodePoolLabelKey] = *tag
 	}
 
-	nodeClaim.Name = GetNodeClaimNameFromVMName(*vm.Name)
+	nodeClaim.Name = GetNodeClaimNameFromVM(vm)
 	nodeClaim.Labels = labels
 	nodeClaim.Annotations = annotations
 	nodeClaim.CreationTimestamp = metav1.Time{Time: *vm.Properties.TimeCreated}
@@ -494,8 +557,12 @@ func (c *CloudProvider) vmInstanceToNodeClaim(ctx context.Context, vm *armcomput
 	return nodeClaim, nil
 }
 
-func GetNodeClaimNameFromVMName(vmName string) string {
-	return strings.TrimLeft("aks-", vmName)
+// GetNodeClaimNameFromVM returns the name of the nodeclaim of the VM, from its tag when the VM name is shortened
+func GetNodeClaimNameFromVM(vm *armcompute.VirtualMachine) string {
+	if tag, ok := vm.Tags[launchtemplate.NodeClaimTagKey]; ok {
+		return lo.FromPtr(tag)
+	}
+	return utils.NodeClaimNameFromResourceName(lo.FromPtr(vm.Name))
 }
 
 const truncateAt = 1200
@@ -528,3 +595,39 @@ func setAdditionalAnnotationsForNewNodeClaim(ctx context.Context, nodeClaim *kar
 	})
 	return nil
 }
+
+// setEstimatedCostAnnotations annotates the nodeclaim with the price of the offering the VM was launched with, as an
+// estimate of its hourly cost. The annotations aren't part of any hash, so they don't cause drift as the price changes.
+func setEstimatedCostAnnotations(nodeClaim *karpv1.NodeClaim, instanceType *cloudprovider.InstanceType) {
+	if instanceType == nil {
+		return
+	}
+	capacityType := nodeClaim.Labels[karpv1.CapacityTypeLabelKey]
+	zone := nodeClaim.Labels[corev1.LabelTopologyZone]
+	offering, ok := lo.Find(instanceType.Offerings, func(o *cloudprovider.Offering) bool {
+		return o.Requirements.Get(karpv1.CapacityTypeLabelKey).Any() == capacityType && o.Requirements.Get(corev1.LabelTopologyZone).Any() == zone
+	})
+	if !ok || offering.Price == 0 {
+		return
+	}
+	nodeClaim.Annotations = lo.Assign(nodeClaim.Annotations, pricing.CostEstimateAnnotations(instanceType.Name, capacityType, offering.Price))
+}
+
+// setBootstrapDebugAnnotations adds a redacted rendering of the bootstrap payload the VM was launched with,
+// so that bootstrap failures can be debugged without decoding customData from the VM.
+func setBootstrapDebugAnnotations(nodeClaim *karpv1.NodeClaim, launchTemplate *launchtemplate.Template) {
+	if launchTemplate == nil {
+		// The VM already existed, so we don't know what it was launched with
+		return
+	}
+	// the token the template was rendered with, which may have been rotated since the options were read
+	token := string(launchTemplate.BootstrapToken)
+	debugAnnotations := map[string]string{}
+	if customData := lo.CoalesceOrEmpty(launchTemplate.ScriptlessCustomData, launchTemplate.CustomScriptsCustomData); customData != "" {
+		debugAnnotations[v1beta1.AnnotationBootstrapCustomDataDebug] = bootstrap.RenderForDebug(customData, token)
+	}
+	if launchTemplate.CustomScriptsCSE != "" {
+		debugAnnotations[v1beta1.AnnotationBootstrapCSEDebug] = bootstrap.RenderForDebug(launchTemplate.CustomScriptsCSE, token)
+	}
+	nodeClaim.Annotations = lo.Assign(nodeClaim.Annotations, debugAnnotations)
+}
@@ -0,0 +1,118 @@
+/*
+Portions Copyright (c) Microsoft Corporation.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cloudprovider
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	nodeclaimutils "github.com/Azure/karpenter-provider-azure/pkg/utils/nodeclaim"
+
+	karpv1 "sigs.k8s.io/karpenter/pkg/apis/v1"
+	"sigs.k8s.io/karpenter/pkg/cloudprovider"
+)
+
+// LaunchNotFoundGracePeriod is how long after a NodeClaim is launched that its VM not being found is attributed to the
+// eventual consistency of ARM, and of Azure Resource Graph, rather than to the VM being gone. Reading a VM right after
+// it was created can fail with NotFound for several seconds, and listing the VMs can miss it for longer, which Karpenter
+// would otherwise take for the instance having disappeared, deleting its NodeClaim and orphaning the VM until it is
+// garbage collected.
+const LaunchNotFoundGracePeriod = 2 * time.Minute
+
+// launchedWithinGracePeriod returns whether the NodeClaim was launched within the launch NotFound grace period
+func launchedWithinGracePeriod(nodeClaim *karpv1.NodeClaim) bool {
+	launched := nodeClaim.StatusConditions().Get(karpv1.ConditionTypeLaunched)
+	return launched.IsTrue() && time.Since(launched.LastTransitionTime.Time) < LaunchNotFoundGracePeriod
+}
+
+// recentlyLaunchedNodeClaims returns the NodeClaims launched within the launch NotFound grace period, by provider ID
+func (c *CloudProvider) recentlyLaunchedNodeClaims(ctx context.Context) (map[string]*karpv1.NodeClaim, error) {
+	nodeClaimList := &karpv1.NodeClaimList{}
+	if err := c.kubeClient.List(ctx, nodeClaimList); err != nil {
+		return nil, fmt.Errorf("listing nodeclaims, %w", err)
+	}
+	nodeClaims := map[string]*karpv1.NodeClaim{}
+	for i := range nodeClaimList.Items {
+		nodeClaim := &nodeClaimList.Items[i]
+		if nodeClaim.Status.ProviderID != "" && nodeClaim.DeletionTimestamp.IsZero() && launchedWithinGracePeriod(nodeClaim) {
+			nodeClaims[nodeClaim.Status.ProviderID] = nodeClaim
+		}
+	}
+	return nodeClaims, nil
+}
+
+// notFoundWithinGracePeriod returns a retryable error in place of the NodeClaimNotFoundError of the VM, if its NodeClaim
+// was launched within the launch NotFound grace period, so that the VM is considered to still be provisioning
+func (c *CloudProvider) notFoundWithinGracePeriod(ctx context.Context, providerID string, notFoundErr error) error {
+	nodeClaims, err := c.recentlyLaunchedNodeClaims(ctx)
+	if err != nil {
+		return fmt.Errorf("%w, %w", notFoundErr, err)
+	}
+	nodeClaim, ok := nodeClaims[providerID]
+	if !ok {
+		return notFoundErr
+	}
+	log.FromContext(ctx).V(1).Info("VM of recently launched nodeclaim not found yet, considering it provisioning", "NodeClaim", nodeClaim.Name)
+	// the NodeClaimNotFoundError isn't wrapped, so that it isn't taken for the VM being gone
+	return fmt.Errorf("VM of nodeclaim %s launched within the last %s not found yet, %s", nodeClaim.Name, LaunchNotFoundGracePeriod, notFoundErr)
+}
+
+// withRecentlyLaunched adds the NodeClaims launched within the launch NotFound grace period that are missing from the
+// listed NodeClaims. Their VMs are read from ARM, and those still not found are represented by their NodeClaims, as
+// still provisioning.
+func (c *CloudProvider) withRecentlyLaunched(ctx context.Context, nodeClaims []*karpv1.NodeClaim) ([]*karpv1.NodeClaim, error) {
+	recentlyLaunched, err := c.recentlyLaunchedNodeClaims(ctx)
+	if err != nil {
+		return nil, err
+	}
+	for _, nodeClaim := range nodeClaims {
+		delete(recentlyLaunched, nodeClaim.Status.ProviderID)
+	}
+	for providerID, nodeClaim := range recentlyLaunched {
+		listed, err := c.get(ctx, providerID)
+		if err != nil {
+			if !cloudprovider.IsNodeClaimNotFoundError(err) {
+				return nil, err
+			}
+			log.FromContext(ctx).V(1).Info("VM of recently launched nodeclaim not listed yet, considering it provisioning", "NodeClaim", nodeClaim.Name)
+			listed = nodeClaim.DeepCopy()
+		}
+		nodeClaims = append(nodeClaims, listed)
+	}
+	return nodeClaims, nil
+}
+
+// get returns the NodeClaim of the VM with the provider ID
+func (c *CloudProvider) get(ctx context.Context, providerID string) (*karpv1.NodeClaim, error) {
+	vmName, err := nodeclaimutils.GetVMName(providerID)
+	if err != nil {
+		return nil, fmt.Errorf("getting vm name, %w", err)
+	}
+	ctx = log.IntoContext(ctx, log.FromContext(ctx).WithValues("vmName", vmName))
+	vm, err := c.vmInstanceProvider.Get(ctx, vmName)
+	if err != nil {
+		return nil, fmt.Errorf("getting VM instance, %w", err)
+	}
+	instanceType, err := c.resolveInstanceTypeFromVMInstance(ctx, vm)
+	if err != nil {
+		return nil, fmt.Errorf("resolving instance type, %w", err)
+	}
+	return c.vmInstanceToNodeClaim(ctx, vm, instanceType)
+}
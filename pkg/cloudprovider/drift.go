@@ -22,6 +22,7 @@ import (
 	"strings"
 
 	sdkerrors "github.com/Azure/azure-sdk-for-go-extensions/pkg/errors"
+	"github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/compute/armcompute/v7"
 	"github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/network/armnetwork"
 	"github.com/samber/lo"
 	v1 "k8s.io/api/core/v1"
@@ -29,7 +30,9 @@ import (
 
 	"github.com/Azure/karpenter-provider-azure/pkg/apis/v1beta1"
 	"github.com/Azure/karpenter-provider-azure/pkg/operator/options"
+	"github.com/Azure/karpenter-provider-azure/pkg/providers/imagefamily"
 	"github.com/Azure/karpenter-provider-azure/pkg/providers/instance"
+	"github.com/Azure/karpenter-provider-azure/pkg/utils"
 	nodeclaimutils "github.com/Azure/karpenter-provider-azure/pkg/utils/nodeclaim"
 
 	karpv1 "sigs.k8s.io/karpenter/pkg/apis/v1"
@@ -138,6 +141,12 @@ func (c *CloudProvider) isImageVersionDrifted(
 ) (cloudprovider.DriftReason, error) {
 	logger := log.FromContext(ctx)
 
+	// the images of a frozen nodeclass are kept as is, so nodes are not replaced for running a different image, nor are
+	// they when image drift is disabled
+	if nodeClass.IsImageFrozen() || nodeClass.IsImageDriftDisabled() {
+		return "", nil
+	}
+
 	id, err := nodeclaimutils.GetVMName(nodeClaim.Status.ProviderID)
 	if err != nil {
 		// TODO (charliedmcb): Do we need to handle vm not found here before its provisioned?
@@ -166,9 +175,9 @@ func (c *CloudProvider) isImageVersionDrifted(
 		//     We may want to collect this with the other errors up a level as to not block other drift conditions.
 		return "", nil
 	}
-	CIGID := lo.FromPtr(vm.Properties.StorageProfile.ImageReference.CommunityGalleryImageID)
-	SIGID := lo.FromPtr(vm.Properties.StorageProfile.ImageReference.ID)
-	vmImageID := lo.Ternary(SIGID != "", SIGID, CIGID)
+	vmImageID := utils.ImageReferenceToString(vm.Properties.StorageProfile.ImageReference)
+	// the images of a gallery that moved are the same in the gallery it moved to
+	aliasedVMImageID, aliased := imagefamily.AliasedImageID(ctx, vmImageID)
 
 	nodeImages, err := nodeClass.GetImages()
 	// Note: this differs from AWS, as they don't check for status readiness during Drift.
@@ -185,8 +194,16 @@ func (c *CloudProvider) isImageVersionDrifted(
 		return "", fmt.Errorf("no images exist for the given constraints")
 	}
 
+	// the casing of the IDs of the images of directly shared galleries, which are not ARM resource IDs, isn't preserved
+	sharedGalleryImage := lo.FromPtr(vm.Properties.StorageProfile.ImageReference.SharedGalleryImageID) != ""
+
 	for _, availableImage := range nodeImages {
-		if availableImage.ID == vmImageID {
+		if availableImage.ID == vmImageID || (sharedGalleryImage && strings.EqualFold(availableImage.ID, vmImageID)) ||
+			(aliased && strings.EqualFold(availableImage.ID, aliasedVMImageID)) {
+			return "", nil
+		}
+		// marketplace images are referenced by their publisher, offer, SKU and version rather than by ID
+		if ref, ok := imagefamily.MarketplaceImageReference(availableImage.ID); ok && sameMarketplaceImage(ref, vm.Properties.StorageProfile.ImageReference) {
 			return "", nil
 		}
 	}
@@ -197,13 +214,27 @@ func (c *CloudProvider) isImageVersionDrifted(
 	return ImageDrift, nil
 }
 
+// sameMarketplaceImage returns whether the image references are of the same marketplace image version. The version of
+// the VM's image reference may be "latest", in which case its exact version is compared.
+func sameMarketplaceImage(a, b *armcompute.ImageReference) bool {
+	version := lo.FromPtr(b.ExactVersion)
+	if version == "" {
+		version = lo.FromPtr(b.Version)
+	}
+	return strings.EqualFold(lo.FromPtr(a.Publisher), lo.FromPtr(b.Publisher)) &&
+		strings.EqualFold(lo.FromPtr(a.Offer), lo.FromPtr(b.Offer)) &&
+		strings.EqualFold(lo.FromPtr(a.SKU), lo.FromPtr(b.SKU)) &&
+		lo.FromPtr(a.Version) == version
+}
+
 // isSubnetDrifted returns drift if the nic for this nodeclaim does not match the expected subnet
 func (c *CloudProvider) isSubnetDrifted(ctx context.Context, nodeClaim *karpv1.NodeClaim, nodeClass *v1beta1.AKSNodeClass) (cloudprovider.DriftReason, error) {
 	expectedSubnet := lo.Ternary(nodeClass.Spec.VNETSubnetID == nil, options.FromContext(ctx).SubnetID, lo.FromPtr(nodeClass.Spec.VNETSubnetID))
 	nicName := instance.GenerateResourceName(nodeClaim.Name)
 
 	// TODO: Refactor all of AzConfig to be part of options
-	nic, err := c.vmInstanceProvider.GetNic(ctx, options.FromContext(ctx).NodeResourceGroup, nicName)
+	resourceGroup := lo.Ternary(nodeClass.Spec.ResourceGroup == nil, options.FromContext(ctx).NodeResourceGroup, lo.FromPtr(nodeClass.Spec.ResourceGroup))
+	nic, err := c.vmInstanceProvider.GetNic(ctx, resourceGroup, nicName)
 	if err != nil {
 		if sdkerrors.IsNotFoundErr(err) {
 			return "", nil
@@ -221,7 +252,7 @@ func (c *CloudProvider) isSubnetDrifted(ctx context.Context, nodeClaim *karpv1.N
 }
 
 // isKubeletIdentityDrifted returns drift if the kubelet identity has drifted
-func (c *CloudProvider) isKubeletIdentityDrifted(ctx context.Context, nodeClaim *karpv1.NodeClaim, _ *v1beta1.AKSNodeClass) (cloudprovider.DriftReason, error) {
+func (c *CloudProvider) isKubeletIdentityDrifted(ctx context.Context, nodeClaim *karpv1.NodeClaim, nodeClass *v1beta1.AKSNodeClass) (cloudprovider.DriftReason, error) {
 	opts := options.FromContext(ctx)
 	logger := log.FromContext(ctx)
 
@@ -240,10 +271,11 @@ func (c *CloudProvider) isKubeletIdentityDrifted(ctx context.Context, nodeClaim
 		return "", nil
 	}
 
-	if kubeletIdentityClientID != opts.KubeletIdentityClientID {
+	expectedKubeletIdentityClientID := utils.GetKubeletIdentityClientID(nodeClass, opts.KubeletIdentityClientID)
+	if kubeletIdentityClientID != expectedKubeletIdentityClientID {
 		logger.V(1).Info("drift triggered due to expected and actual kubelet identity client id mismatch",
 			"driftType", KubeletIdentityDrift,
-			"expectedKubeletIdentityClientID", opts.KubeletIdentityClientID,
+			"expectedKubeletIdentityClientID", expectedKubeletIdentityClientID,
 			"actualKubeletIdentityClientID", kubeletIdentityClientID)
 		return KubeletIdentityDrift, nil
 	}
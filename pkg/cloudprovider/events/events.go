@@ -18,16 +18,26 @@ package events
 
 import (
 	"fmt"
+	"time"
 
+	"github.com/samber/lo"
 	corev1 "k8s.io/api/core/v1"
 
 	v1 "sigs.k8s.io/karpenter/pkg/apis/v1"
 	"sigs.k8s.io/karpenter/pkg/events"
+
+	"github.com/Azure/karpenter-provider-azure/pkg/apis/v1beta1"
+	"github.com/Azure/karpenter-provider-azure/pkg/utils/redact"
 )
 
 const (
 	AsyncProvisioningReason   = "AsyncProvisioningError"
 	NodeClassResolutionReason = "NodeClassResolutionError"
+	ImagesNotReadyReason      = "ImagesNotReady"
+	SeriesRetirementReason    = "RetiringInstanceTypes"
+	CapacityFallbackReason    = "CapacityFallback"
+	InstanceSelectedReason    = "InstanceSelected"
+	ImageSelectedReason       = "ImageSelected"
 )
 
 func NodePoolFailedToResolveNodeClass(nodePool *v1.NodePool) events.Event {
@@ -40,6 +50,17 @@ func NodePoolFailedToResolveNodeClass(nodePool *v1.NodePool) events.Event {
 	}
 }
 
+func NodePoolInstanceTypesRetiring(nodePool *v1.NodePool, retirement time.Time) events.Event {
+	return events.Event{
+		InvolvedObject: nodePool,
+		Type:           corev1.EventTypeWarning,
+		Reason:         SeriesRetirementReason,
+		Message:        fmt.Sprintf("Requirements can only be satisfied by instance types of VM series retiring by %s", retirement.Format(time.DateOnly)),
+		DedupeValues:   []string{string(nodePool.UID)},
+		DedupeTimeout:  time.Hour,
+	}
+}
+
 func NodeClaimFailedToResolveNodeClass(nodeClaim *v1.NodeClaim) events.Event {
 	return events.Event{
 		InvolvedObject: nodeClaim,
@@ -50,16 +71,76 @@ func NodeClaimFailedToResolveNodeClass(nodeClaim *v1.NodeClaim) events.Event {
 	}
 }
 
+func NodeClaimImagesNotReady(nodeClaim *v1.NodeClaim, message string) events.Event {
+	return events.Event{
+		InvolvedObject: nodeClaim,
+		Type:           corev1.EventTypeWarning,
+		Reason:         ImagesNotReadyReason,
+		Message:        fmt.Sprintf("Not launching, the images of the NodeClass are not ready: %s", truncateMessage(redact.String(message))),
+		DedupeValues:   []string{string(nodeClaim.UID)},
+	}
+}
+
 func NodeClaimFailedToRegister(nodeClaim *v1.NodeClaim, err error) events.Event {
 	return events.Event{
 		InvolvedObject: nodeClaim,
 		Type:           corev1.EventTypeWarning,
 		Reason:         AsyncProvisioningReason,
-		Message:        fmt.Sprintf("Failed to register: %s", truncateMessage(err.Error())),
+		Message:        fmt.Sprintf("Failed to register: %s", truncateMessage(redact.String(err.Error()))),
+		DedupeValues:   []string{string(nodeClaim.UID)},
+	}
+}
+
+func NodeClaimCapacityFallback(nodeClaim *v1.NodeClaim, capacityFallback string, spotFailures int) events.Event {
+	return events.Event{
+		InvolvedObject: nodeClaim,
+		Type:           corev1.EventTypeNormal,
+		Reason:         CapacityFallbackReason,
+		Message:        fmt.Sprintf("Launched on-demand instead of spot, with capacity fallback %s after %d recent spot failures of the NodePool", capacityFallback, spotFailures),
+		DedupeValues:   []string{string(nodeClaim.UID)},
+	}
+}
+
+func NodeClaimInstanceSelected(nodeClaim *v1.NodeClaim, instanceType, zone, capacityType, reason string) events.Event {
+	return events.Event{
+		InvolvedObject: nodeClaim,
+		Type:           corev1.EventTypeNormal,
+		Reason:         InstanceSelectedReason,
+		Message:        fmt.Sprintf("Launching instance type %s, %s in zone %q, picked as the %s", instanceType, capacityType, zone, reason),
+		DedupeValues:   []string{string(nodeClaim.UID)},
+	}
+}
+
+func NodeClaimImageSelected(nodeClaim *v1.NodeClaim, distro, imageID, previousImageID string) events.Event {
+	return events.Event{
+		InvolvedObject: nodeClaim,
+		Type:           corev1.EventTypeNormal,
+		Reason:         ImageSelectedReason,
+		Message:        imageSelectedMessage(distro, imageID, previousImageID),
 		DedupeValues:   []string{string(nodeClaim.UID)},
 	}
 }
 
+func NodeClassImageSelected(nodeClass *v1beta1.AKSNodeClass, distro, imageID, previousImageID string) events.Event {
+	return events.Event{
+		InvolvedObject: nodeClass,
+		Type:           corev1.EventTypeNormal,
+		Reason:         ImageSelectedReason,
+		Message:        imageSelectedMessage(distro, imageID, previousImageID),
+		DedupeValues:   []string{string(nodeClass.UID), imageID},
+	}
+}
+
+// imageSelectedMessage describes the image selected for launching, of its distro if it has one, and the image it replaces,
+// if any
+func imageSelectedMessage(distro, imageID, previousImageID string) string {
+	image := lo.Ternary(distro == "", imageID, fmt.Sprintf("%s of distro %s", imageID, distro))
+	if previousImageID == "" {
+		return fmt.Sprintf("Launching with image %s, the first launch since startup", image)
+	}
+	return fmt.Sprintf("Launching with image %s, a different image than the last launch, %s", image, previousImageID)
+}
+
 const truncateAt = 500
 
 func truncateMessage(msg string) string {
@@ -0,0 +1,131 @@
+/*
+Portions Copyright (c) Microsoft Corporation.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cloudprovider
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/samber/lo"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	karpv1 "sigs.k8s.io/karpenter/pkg/apis/v1"
+	"sigs.k8s.io/karpenter/pkg/scheduling"
+
+	"github.com/Azure/karpenter-provider-azure/pkg/apis/v1beta1"
+	"github.com/Azure/karpenter-provider-azure/pkg/providers/imagefamily"
+)
+
+// Nodepools sharing a nodeclass can require another image family than the one of the nodeclass, through the image family
+// label, as a template label or a requirement. The nodeclaims of such nodepools are launched with a copy of the nodeclass
+// with the image family overridden, so that the image, the instance types and the bootstrap parameters all follow it.
+
+// imageFamilyRequirement returns the requirement on the image family label of the labels and requirements, or nil if
+// they don't have one
+func imageFamilyRequirement(labels map[string]string, requirements scheduling.Requirements) *scheduling.Requirement {
+	requirements = scheduling.NewRequirements(requirements.Values()...)
+	if family, ok := labels[v1beta1.LabelImageFamily]; ok {
+		requirements.Add(scheduling.NewRequirement(v1beta1.LabelImageFamily, corev1.NodeSelectorOpIn, family))
+	}
+	if !requirements.Has(v1beta1.LabelImageFamily) {
+		return nil
+	}
+	return requirements.Get(v1beta1.LabelImageFamily)
+}
+
+// overrideImageFamily returns the image family overriding the one of the nodeclass for the requirement: none when the
+// image family of the nodeclass satisfies it, and otherwise the first overridable image family that does. The image
+// families the requirement selects must all be registered.
+func overrideImageFamily(requirement *scheduling.Requirement, nodeClass *v1beta1.AKSNodeClass) (string, error) {
+	if requirement == nil {
+		return "", nil
+	}
+	if requirement.Operator() == corev1.NodeSelectorOpIn {
+		if unknown := sets.New(requirement.Values()...).Difference(v1beta1.OverridableImageFamilies.Union(sets.New(lo.FromPtr(nodeClass.Spec.ImageFamily)))); unknown.Len() > 0 {
+			return "", fmt.Errorf("image families %s of label %s are not registered, nodepools can require one of %s", strings.Join(sets.List(unknown), ", "), v1beta1.LabelImageFamily, strings.Join(sets.List(v1beta1.OverridableImageFamilies), ", "))
+		}
+	}
+	if requirement.Has(lo.FromPtr(nodeClass.Spec.ImageFamily)) {
+		return "", nil
+	}
+	family, ok := lo.Find(sets.List(v1beta1.OverridableImageFamilies), requirement.Has)
+	if !ok {
+		return "", fmt.Errorf("no image family satisfies the requirement %s, nodepools can require one of %s", requirement, strings.Join(sets.List(v1beta1.OverridableImageFamilies), ", "))
+	}
+	if lo.FromPtr(nodeClass.Spec.FIPSMode) == v1beta1.FIPSModeFIPS && (family == v1beta1.Ubuntu2204ImageFamily || family == v1beta1.Ubuntu2404ImageFamily) {
+		return "", fmt.Errorf("image family %s doesn't support the FIPS mode of nodeclass %s", family, nodeClass.Name)
+	}
+	return family, nil
+}
+
+// withImageFamily returns a copy of the nodeclass with the image family overridden
+func withImageFamily(nodeClass *v1beta1.AKSNodeClass, family string) *v1beta1.AKSNodeClass {
+	nodeClass = nodeClass.DeepCopy()
+	nodeClass.Spec.ImageFamily = lo.ToPtr(family)
+	return nodeClass
+}
+
+// nodePoolNodeClass returns the nodeclass the instance types of the nodepool are computed with, checking that the image
+// family the nodepool requires, if any, is registered
+func nodePoolNodeClass(nodePool *karpv1.NodePool, nodeClass *v1beta1.AKSNodeClass) (*v1beta1.AKSNodeClass, error) {
+	requirement := imageFamilyRequirement(nodePool.Spec.Template.Labels, scheduling.NewNodeSelectorRequirementsWithMinValues(nodePool.Spec.Template.Spec.Requirements...))
+	family, err := overrideImageFamily(requirement, nodeClass)
+	if err != nil || family == "" {
+		return nodeClass, err
+	}
+	return withImageFamily(nodeClass, family), nil
+}
+
+// launchNodeClass returns the nodeclass the VM of the nodeclaim is launched with: its nodeclass, or a copy of it with the
+// image family the nodeclaim requires and the images of that family
+func (c *CloudProvider) launchNodeClass(ctx context.Context, nodeClaim *karpv1.NodeClaim, nodeClass *v1beta1.AKSNodeClass) (*v1beta1.AKSNodeClass, error) {
+	requirement := imageFamilyRequirement(nodeClaim.Labels, scheduling.NewNodeSelectorRequirementsWithMinValues(nodeClaim.Spec.Requirements...))
+	family, err := overrideImageFamily(requirement, nodeClass)
+	if err != nil {
+		return nil, err
+	}
+	if family == "" {
+		return nodeClass, nil
+	}
+	launchNodeClass := withImageFamily(nodeClass, family)
+	// the images are listed ahead of the background refreshes of the images of the nodeclasses
+	nodeImages, err := c.imageProvider.List(imagefamily.WithPriority(ctx, imagefamily.PriorityLaunch), launchNodeClass)
+	if err != nil {
+		return nil, fmt.Errorf("listing the images of image family %s, %w", family, err)
+	}
+	if len(nodeImages) == 0 {
+		return nil, fmt.Errorf("no images found for image family %s", family)
+	}
+	launchNodeClass.Status.Images = nodeClassImages(nodeImages)
+	log.FromContext(ctx).V(1).Info("overriding the image family of the nodeclass", "NodeClaim", nodeClaim.Name, "imageFamily", family)
+	return launchNodeClass, nil
+}
+
+// nodeClassImages returns the images of the nodeclass status of the node images
+func nodeClassImages(nodeImages []imagefamily.NodeImage) []v1beta1.NodeImage {
+	return lo.Map(nodeImages, func(nodeImage imagefamily.NodeImage, _ int) v1beta1.NodeImage {
+		return v1beta1.NodeImage{
+			ID: nodeImage.ID,
+			Requirements: lo.Map(nodeImage.Requirements.NodeSelectorRequirements(), func(requirement karpv1.NodeSelectorRequirementWithMinValues, _ int) corev1.NodeSelectorRequirement {
+				return requirement.NodeSelectorRequirement
+			}),
+			Channel: nodeImage.Channel,
+		}
+	})
+}
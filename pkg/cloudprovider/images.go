@@ -0,0 +1,163 @@
+/*
+Portions Copyright (c) Microsoft Corporation.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cloudprovider
+
+import (
+	"context"
+	stderrors "errors"
+	"fmt"
+	"strings"
+
+	"github.com/samber/lo"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	karpv1 "sigs.k8s.io/karpenter/pkg/apis/v1"
+	"sigs.k8s.io/karpenter/pkg/cloudprovider"
+
+	"github.com/Azure/karpenter-provider-azure/pkg/apis/v1beta1"
+	cloudproviderevents "github.com/Azure/karpenter-provider-azure/pkg/cloudprovider/events"
+	"github.com/Azure/karpenter-provider-azure/pkg/metrics"
+	"github.com/Azure/karpenter-provider-azure/pkg/providers/imagefamily"
+	"github.com/Azure/karpenter-provider-azure/pkg/providers/instance"
+)
+
+// ImageNotFoundReason is the reason of the ImagesReady condition once an image the nodeclass launched with wasn't found,
+// and couldn't be re-resolved
+const ImageNotFoundReason = "ImageNotFound"
+
+// The images of a nodeclass are resolved into its status, and cached, well ahead of the VM creates launching them. An image
+// version deleted from its gallery meanwhile fails the creates with an image not found error, which would be retried with
+// the same image for as long as it's kept. Instead, the cached images are evicted, the image is re-resolved, and the create
+// is retried once with the re-resolved image. The versions of custom images, which the users of their galleries may delete
+// at any time, are checked before the create, which is then recovered the same way without creating the VM.
+
+// reresolveImage evicts the cached images of launchNodeClass, and replaces the image that wasn't found with the latest
+// version of the same image. The images in the status of the nodeclass are replaced too, unless the nodeclaim overrides
+// the image family of the nodeclass.
+func (c *CloudProvider) reresolveImage(ctx context.Context, nodeClass, launchNodeClass *v1beta1.AKSNodeClass, imageID string) (*v1beta1.AKSNodeClass, error) {
+	log.FromContext(ctx).Info("image not found, re-resolving the images of the nodeclass", "NodeClass", nodeClass.Name, "image-id", imageID)
+	if err := c.imageProvider.Evict(ctx, launchNodeClass); err != nil {
+		return nil, fmt.Errorf("evicting the cached images, %w", err)
+	}
+	nodeImages, err := c.imageProvider.List(imagefamily.WithPriority(ctx, imagefamily.PriorityLaunch), launchNodeClass)
+	if err != nil {
+		return nil, fmt.Errorf("listing the images, %w", err)
+	}
+	replacement, ok := lo.Find(nodeClassImages(nodeImages), func(image v1beta1.NodeImage) bool {
+		return imageBaseID(image.ID) == imageBaseID(imageID)
+	})
+	if !ok {
+		return nil, fmt.Errorf("no version of image %s found", imageBaseID(imageID))
+	}
+	if replacement.ID == imageID {
+		return nil, fmt.Errorf("image %s wasn't found, but is still listed as the latest version", imageID)
+	}
+	images := lo.Map(launchNodeClass.Status.Images, func(image v1beta1.NodeImage, _ int) v1beta1.NodeImage {
+		return lo.Ternary(image.ID == imageID, replacement, image)
+	})
+	log.FromContext(ctx).Info("re-resolved image", "NodeClass", nodeClass.Name, "image-id", replacement.ID)
+
+	if launchNodeClass != nodeClass {
+		launchNodeClass = launchNodeClass.DeepCopy()
+		launchNodeClass.Status.Images = images
+		return launchNodeClass, nil
+	}
+	stored := nodeClass.DeepCopy()
+	nodeClass.Status.Images = images
+	// the images controller updates the status of the nodeclass concurrently
+	if err := c.kubeClient.Status().Patch(ctx, nodeClass, client.MergeFromWithOptions(stored, client.MergeFromWithOptimisticLock{})); err != nil {
+		return nil, fmt.Errorf("updating the images of nodeclass %s, %w", nodeClass.Name, err)
+	}
+	return nodeClass, nil
+}
+
+// imagesNotReady returns the error of launching the nodeclaim once its image couldn't be re-resolved. Unless the nodeclaim
+// overrides the image family, the ImagesReady condition of the nodeclass is set to False, which stops its nodeclaims from
+// launching until the images controller resolves the images again.
+func (c *CloudProvider) imagesNotReady(ctx context.Context, nodeClass, launchNodeClass *v1beta1.AKSNodeClass, nodeClaim *karpv1.NodeClaim, err error) error {
+	if launchNodeClass != nodeClass {
+		return cloudprovider.NewCreateError(fmt.Errorf("re-resolving image, %w", err), ImageFamilyResolutionFailedReason, truncateMessage(err.Error()))
+	}
+	message := fmt.Sprintf("Image not found, %s", err)
+	stored := nodeClass.DeepCopy()
+	nodeClass.StatusConditions().SetFalse(v1beta1.ConditionTypeImagesReady, ImageNotFoundReason, message)
+	if patchErr := c.kubeClient.Status().Patch(ctx, nodeClass, client.MergeFromWithOptions(stored, client.MergeFromWithOptimisticLock{})); patchErr != nil {
+		log.FromContext(ctx).Error(patchErr, "failed to set the images of the nodeclass not ready", "NodeClass", nodeClass.Name)
+	}
+	c.recorder.Publish(cloudproviderevents.NodeClaimImagesNotReady(nodeClaim, message))
+	return cloudprovider.NewNodeClassNotReadyError(fmt.Errorf("NodeClass condition %s is False, %s", v1beta1.ConditionTypeImagesReady, message))
+}
+
+// recordImageNotFoundRecovery counts the launch whose image wasn't found, by whether it was found missing by the check of
+// the version of its custom image before the VM create, or by the VM create, and whether its image was re-resolved
+func recordImageNotFoundRecovery(err *instance.ImageNotFoundError, recovered bool) {
+	var imageVersionDeletedErr *imagefamily.ImageVersionDeletedError
+	metrics.ImageNotFoundRecoveries.WithLabelValues(
+		lo.Ternary(stderrors.As(err, &imageVersionDeletedErr), "preflight", "create"),
+		lo.Ternary(recovered, "recovered", "failed"),
+	).Inc()
+}
+
+// recordLaunch publishes the instance type, zone and capacity type picked for the VM of the nodeclaim, and, when the
+// nodeclass launches a distro with a different image than it last did, e.g. once a newer version of it is resolved, the
+// image, as events. VMs which already existed, e.g. created before a restart, aren't launched so aren't recorded.
+func (c *CloudProvider) recordLaunch(nodeClass, launchNodeClass *v1beta1.AKSNodeClass, nodeClaim *karpv1.NodeClaim, vmPromise *instance.VirtualMachinePromise) {
+	if vmPromise.LaunchTemplate == nil {
+		return
+	}
+	if vmPromise.VM != nil && vmPromise.VM.Properties != nil && vmPromise.VM.Properties.HardwareProfile != nil {
+		instanceType := string(lo.FromPtr(vmPromise.VM.Properties.HardwareProfile.VMSize))
+		c.recorder.Publish(cloudproviderevents.NodeClaimInstanceSelected(nodeClaim, instanceType, vmPromise.Zone, vmPromise.CapacityType, vmPromise.SelectionReason))
+	}
+	imageID := vmPromise.LaunchTemplate.ImageID
+	if imageID == "" {
+		return
+	}
+	image, found := lo.Find(launchNodeClass.Status.Images, func(image v1beta1.NodeImage) bool {
+		return strings.EqualFold(image.ID, imageID)
+	})
+	// the images of marketplace images and image IDs have no distro, so are told apart by their ID without the version
+	distro := lo.Ternary(found, image.Distro, imageBaseID(imageID))
+	previous, loaded := c.launchedImages.Swap(fmt.Sprintf("%s/%s", nodeClass.UID, distro), imageID)
+	previousImageID, _ := previous.(string)
+	if loaded && strings.EqualFold(previousImageID, imageID) {
+		return
+	}
+	c.recorder.Publish(
+		cloudproviderevents.NodeClaimImageSelected(nodeClaim, image.Distro, imageID, previousImageID),
+		cloudproviderevents.NodeClassImageSelected(nodeClass, image.Distro, imageID, previousImageID),
+	)
+}
+
+// ForgetNodeClass drops the images the deleted nodeclass last launched with, see recordLaunch
+func (c *CloudProvider) ForgetNodeClass(nodeClass *v1beta1.AKSNodeClass) {
+	prefix := fmt.Sprintf("%s/", nodeClass.UID)
+	c.launchedImages.Range(func(key, _ any) bool {
+		if strings.HasPrefix(key.(string), prefix) {
+			c.launchedImages.Delete(key)
+		}
+		return true
+	})
+}
+
+// imageBaseID returns the ID of the image without its version
+func imageBaseID(imageID string) string {
+	if i := strings.LastIndex(imageID, "/versions/"); i >= 0 {
+		return imageID[:i]
+	}
+	return imageID
+}
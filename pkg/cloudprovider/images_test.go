@@ -0,0 +1,109 @@
+/*
+Portions Copyright (c) Microsoft Corporation.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cloudprovider
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/compute/armcompute/v7"
+	"github.com/samber/lo"
+	"github.com/stretchr/testify/assert"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
+	karpv1 "sigs.k8s.io/karpenter/pkg/apis/v1"
+	"sigs.k8s.io/karpenter/pkg/events"
+
+	"github.com/Azure/karpenter-provider-azure/pkg/apis/v1beta1"
+	cloudproviderevents "github.com/Azure/karpenter-provider-azure/pkg/cloudprovider/events"
+	"github.com/Azure/karpenter-provider-azure/pkg/providers/instance"
+	"github.com/Azure/karpenter-provider-azure/pkg/providers/launchtemplate"
+)
+
+func TestRecordLaunch(t *testing.T) {
+	const (
+		imageV1 = "/subscriptions/00000000-0000-0000-0000-000000000000/resourceGroups/images/providers/Microsoft.Compute/galleries/gallery/images/2204gen2containerd/versions/202501.01.0"
+		imageV2 = "/subscriptions/00000000-0000-0000-0000-000000000000/resourceGroups/images/providers/Microsoft.Compute/galleries/gallery/images/2204gen2containerd/versions/202502.01.0"
+		armV1   = "/subscriptions/00000000-0000-0000-0000-000000000000/resourceGroups/images/providers/Microsoft.Compute/galleries/gallery/images/2204gen2arm64containerd/versions/202501.01.0"
+	)
+	fakeRecorder := record.NewFakeRecorder(100)
+	c := &CloudProvider{recorder: events.NewRecorder(fakeRecorder)}
+	nodeClass := &v1beta1.AKSNodeClass{ObjectMeta: metav1.ObjectMeta{Name: "default", UID: "nodeclass"}}
+	nodeClass.Status.Images = []v1beta1.NodeImage{
+		{ID: imageV1, Distro: "aks-ubuntu-containerd-22.04-gen2"},
+		{ID: imageV2, Distro: "aks-ubuntu-containerd-22.04-gen2"},
+		{ID: armV1, Distro: "aks-ubuntu-arm64-containerd-22.04-gen2"},
+	}
+	launch := func(nodeClaimUID, imageID string, launched bool) []string {
+		nodeClaim := &karpv1.NodeClaim{ObjectMeta: metav1.ObjectMeta{Name: nodeClaimUID, UID: types.UID(nodeClaimUID)}}
+		vmPromise := &instance.VirtualMachinePromise{
+			VM:              &armcompute.VirtualMachine{Properties: &armcompute.VirtualMachineProperties{HardwareProfile: &armcompute.HardwareProfile{VMSize: lo.ToPtr(armcompute.VirtualMachineSizeTypes("Standard_D2s_v3"))}}},
+			Zone:            "westus-1",
+			CapacityType:    karpv1.CapacityTypeSpot,
+			SelectionReason: instance.SelectionReasonCheapestOffering,
+		}
+		if launched {
+			vmPromise.LaunchTemplate = &launchtemplate.Template{ImageID: imageID}
+		}
+		c.recordLaunch(nodeClass, nodeClass, nodeClaim, vmPromise)
+		var published []string
+		for len(fakeRecorder.Events) > 0 {
+			published = append(published, <-fakeRecorder.Events)
+		}
+		return published
+	}
+	reasons := func(published []string) []string {
+		return lo.Map(published, func(event string, _ int) string { return strings.Fields(event)[1] })
+	}
+
+	// the first launch of the distro since startup records its image
+	published := launch("first", imageV1, true)
+	assert.Equal(t, []string{cloudproviderevents.InstanceSelectedReason, cloudproviderevents.ImageSelectedReason, cloudproviderevents.ImageSelectedReason}, reasons(published))
+	assert.Contains(t, published[0], `Launching instance type Standard_D2s_v3, spot in zone "westus-1", picked as the cheapest available offering`)
+	assert.Contains(t, published[1], imageV1)
+	assert.Contains(t, published[1], "of distro aks-ubuntu-containerd-22.04-gen2")
+
+	// launching the same image again only records the instance
+	assert.Equal(t, []string{cloudproviderevents.InstanceSelectedReason}, reasons(launch("same image", imageV1, true)))
+
+	// the image of another distro isn't a different image than the last launch
+	published = launch("other distro", armV1, true)
+	assert.Equal(t, []string{cloudproviderevents.InstanceSelectedReason, cloudproviderevents.ImageSelectedReason, cloudproviderevents.ImageSelectedReason}, reasons(published))
+	assert.Contains(t, published[1], "the first launch since startup")
+
+	// a newer version of the distro is recorded with the image it replaces
+	published = launch("newer image", imageV2, true)
+	assert.Equal(t, []string{cloudproviderevents.InstanceSelectedReason, cloudproviderevents.ImageSelectedReason, cloudproviderevents.ImageSelectedReason}, reasons(published))
+	assert.Contains(t, published[1], imageV2)
+	assert.Contains(t, published[1], "a different image than the last launch, "+imageV1)
+
+	// VMs which already existed aren't launched
+	assert.Empty(t, launch("existing", imageV1, false))
+
+	// the images of a deleted nodeclass are forgotten, apart from those of other nodeclasses
+	otherNodeClass := &v1beta1.AKSNodeClass{ObjectMeta: metav1.ObjectMeta{Name: "other", UID: "other-nodeclass"}}
+	c.launchedImages.Store(fmt.Sprintf("%s/%s", otherNodeClass.UID, "aks-ubuntu-containerd-22.04-gen2"), imageV1)
+	c.ForgetNodeClass(nodeClass)
+	var launchedImages []string
+	c.launchedImages.Range(func(key, _ any) bool {
+		launchedImages = append(launchedImages, key.(string))
+		return true
+	})
+	assert.Equal(t, []string{"other-nodeclass/aks-ubuntu-containerd-22.04-gen2"}, launchedImages)
+}
@@ -0,0 +1,253 @@
+/*
+Portions Copyright (c) Microsoft Corporation.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cloudprovider
+
+import (
+	"context"
+	"maps"
+	"net/http"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/awslabs/operatorpkg/object"
+	"github.com/samber/lo"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/version"
+	fakediscovery "k8s.io/client-go/discovery/fake"
+	kubernetesfake "k8s.io/client-go/kubernetes/fake"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/record"
+	fakeclient "sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	karpv1 "sigs.k8s.io/karpenter/pkg/apis/v1"
+	corecloudprovider "sigs.k8s.io/karpenter/pkg/cloudprovider"
+	"sigs.k8s.io/karpenter/pkg/events"
+	coreoptions "sigs.k8s.io/karpenter/pkg/operator/options"
+	coretest "sigs.k8s.io/karpenter/pkg/test"
+
+	"github.com/Azure/karpenter-provider-azure/pkg/apis/v1beta1"
+	"github.com/Azure/karpenter-provider-azure/pkg/consts"
+	"github.com/Azure/karpenter-provider-azure/pkg/fake"
+	"github.com/Azure/karpenter-provider-azure/pkg/operator/options"
+	"github.com/Azure/karpenter-provider-azure/pkg/providers/instance"
+	"github.com/Azure/karpenter-provider-azure/pkg/test"
+)
+
+const (
+	// loadTestNodeClaims is the number of NodeClaims launched concurrently per benchmark iteration, as many as the
+	// throughput target
+	loadTestNodeClaims = 500
+	// targetLaunchesPerMinute is the provisioning throughput target, 500 NodeClaims launched in 10 minutes
+	targetLaunchesPerMinute = 500.0 / 10
+	// loadTestLatencyScale is how many times the ARM-like latencies of the throughput benchmark are scaled down
+	loadTestLatencyScale = 100
+	// latencyTestNodeClaims is the number of NodeClaims launched concurrently per latency benchmark iteration, few
+	// enough for launches not to queue for the workers of the network operation pool
+	latencyTestNodeClaims = 20
+	// loadTestSeed makes the sampled latencies and injected failures reproducible between runs
+	loadTestSeed = 2025
+)
+
+// launchRecorder tracks the VM launches that NodePool-managed NodeClaims wait on in the background
+type launchRecorder struct {
+	instance.VMProvider
+	wg               sync.WaitGroup
+	launched, failed atomic.Int64
+}
+
+func (r *launchRecorder) BeginCreate(ctx context.Context, nodeClass *v1beta1.AKSNodeClass, nodeClaim *karpv1.NodeClaim, instanceTypes []*corecloudprovider.InstanceType) (*instance.VirtualMachinePromise, error) {
+	promise, err := r.VMProvider.BeginCreate(ctx, nodeClass, nodeClaim, instanceTypes)
+	if err != nil {
+		r.failed.Add(1)
+		return nil, err
+	}
+	r.wg.Add(1)
+	wait := promise.WaitFunc
+	promise.WaitFunc = func() error {
+		defer r.wg.Done()
+		err := wait()
+		lo.Ternary(err == nil, &r.launched, &r.failed).Add(1)
+		return err
+	}
+	return promise, nil
+}
+
+// newLoadTestEnvironment returns an environment of fake APIs and a fake kube-apiserver, rather than envtest, with a
+// nodeclass ready to launch NodeClaims with
+func newLoadTestEnvironment(b *testing.B, opts *options.Options) (context.Context, *coretest.Environment, *test.Environment, *v1beta1.AKSNodeClass) {
+	b.Helper()
+	ctx := coreoptions.ToContext(log.IntoContext(context.Background(), log.Log), coretest.Options())
+	ctx = options.ToContext(ctx, opts)
+
+	kubernetesInterface := kubernetesfake.NewClientset()
+	kubernetesInterface.Discovery().(*fakediscovery.FakeDiscovery).FakedServerVersion = &version.Info{GitVersion: "v1.31.0"}
+	env := &coretest.Environment{
+		Client:              fakeclient.NewClientBuilder().WithScheme(clientgoscheme.Scheme).WithStatusSubresource(&v1beta1.AKSNodeClass{}).Build(),
+		KubernetesInterface: kubernetesInterface,
+	}
+	azureEnv := test.NewEnvironment(ctx, env)
+
+	// the fake client neither defaults the nodeclass like the API server, nor sets the generation the conditions are observed for
+	nodeClass := test.AKSNodeClass(v1beta1.AKSNodeClass{Spec: v1beta1.AKSNodeClassSpec{MaxPods: lo.ToPtr[int32](50)}})
+	nodeClass.Generation = 1
+	test.ApplyDefaultStatus(nodeClass, env, false)
+	if err := env.Client.Create(ctx, nodeClass); err != nil {
+		b.Fatalf("creating nodeclass, %s", err)
+	}
+	return ctx, env, azureEnv, nodeClass
+}
+
+// loadTestNodeClaim returns a NodeClaim of a NodePool, launched with the nodeclass
+func loadTestNodeClaim(nodeClass *v1beta1.AKSNodeClass) *karpv1.NodeClaim {
+	return coretest.NodeClaim(karpv1.NodeClaim{
+		ObjectMeta: metav1.ObjectMeta{Labels: map[string]string{karpv1.NodePoolLabelKey: "default"}},
+		Spec: karpv1.NodeClaimSpec{NodeClassRef: &karpv1.NodeClassReference{
+			Group: object.GVK(nodeClass).Group,
+			Kind:  object.GVK(nodeClass).Kind,
+			Name:  nodeClass.Name,
+		}},
+	})
+}
+
+// BenchmarkLaunchThroughput launches NodeClaims concurrently against the fake compute APIs, with ARM-like latencies
+// scaled down 100x and a share of launches failing, and reports the launch throughput along with the ARM calls made. It
+// fails when the throughput, scaled back to ARM latencies, misses the target of 500 NodeClaims launched in 10 minutes:
+//
+//	go test ./pkg/cloudprovider -run '^$' -bench BenchmarkLaunchThroughput
+func BenchmarkLaunchThroughput(b *testing.B) {
+	benchCtx, benchEnv, benchAzureEnv, benchNodeClass := newLoadTestEnvironment(b, test.Options())
+	benchAzureEnv.NetworkInterfacesAPI.NetworkInterfacesCreateOrUpdateBehavior.LatencyDistribution = fake.NormalLatency(loadTestSeed, 2*time.Second/loadTestLatencyScale, 500*time.Millisecond/loadTestLatencyScale)
+	benchAzureEnv.VirtualMachinesAPI.VirtualMachineCreateOrUpdateBehavior.LatencyDistribution = fake.NormalLatency(loadTestSeed, 30*time.Second/loadTestLatencyScale, 5*time.Second/loadTestLatencyScale)
+	benchAzureEnv.VirtualMachinesAPI.VirtualMachineDeleteBehavior.LatencyDistribution = fake.NormalLatency(loadTestSeed, 20*time.Second/loadTestLatencyScale, 3*time.Second/loadTestLatencyScale)
+	launches := &launchRecorder{VMProvider: benchAzureEnv.VMInstanceProvider}
+	benchCloudProvider := New(benchAzureEnv.InstanceTypesProvider, launches, events.NewRecorder(&record.FakeRecorder{}), benchEnv.Client, benchAzureEnv.ImageProvider)
+
+	var elapsed time.Duration
+	b.ResetTimer()
+	for range b.N {
+		b.StopTimer()
+		benchAzureEnv.Reset()
+		benchAzureEnv.VirtualMachinesAPI.VirtualMachineCreateOrUpdateBehavior.Failures.Set(loadTestSeed,
+			fake.FailureRate{ErrorCode: "AllocationFailed", StatusCode: http.StatusOK, Rate: 0.02},
+			fake.FailureRate{ErrorCode: "InternalExecutionError", StatusCode: http.StatusInternalServerError, Rate: 0.01},
+		)
+		b.StartTimer()
+
+		launched := launches.launched.Load()
+		start := time.Now()
+		var wg sync.WaitGroup
+		for range loadTestNodeClaims {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				// like the NodeClaims of NodePools, Create returns once the VM creation started, and waits for it in the background
+				_, _ = benchCloudProvider.Create(benchCtx, loadTestNodeClaim(benchNodeClass))
+			}()
+		}
+		wg.Wait()
+		launches.wg.Wait()
+		elapsed += time.Since(start)
+
+		b.StopTimer()
+		// List and garbage collection read the same in-memory state the launches were made in
+		nodeClaims, err := benchCloudProvider.List(benchCtx)
+		if err != nil {
+			b.Fatalf("listing nodeclaims, %s", err)
+		}
+		if got, want := int64(len(nodeClaims)), launches.launched.Load()-launched; got != want {
+			b.Fatalf("expected %d nodeclaims to be listed, got %d", want, got)
+		}
+		b.StartTimer()
+	}
+	b.StopTimer()
+
+	launchesPerMinute := float64(launches.launched.Load()) / elapsed.Minutes()
+	b.ReportMetric(launchesPerMinute, "launches/min")
+	if scaled := launchesPerMinute / loadTestLatencyScale; scaled < targetLaunchesPerMinute {
+		b.Errorf("expected at least %.0f launches/min at ARM latencies, got %.1f", targetLaunchesPerMinute, scaled)
+	}
+	b.ReportMetric(float64(launches.failed.Load())/float64(b.N), "failures/op")
+	calls := benchAzureEnv.VirtualMachinesAPI.Calls()
+	maps.Copy(calls, benchAzureEnv.NetworkInterfacesAPI.Calls())
+	calls["AzureResourceGraph.Resources"] = benchAzureEnv.AzureResourceGraphAPI.AzureResourceGraphResourcesBehavior.Calls()
+	for _, operation := range slices.Sorted(maps.Keys(calls)) {
+		// the calls of the last iteration, as the fakes are reset between iterations
+		b.ReportMetric(float64(calls[operation]), operation+"-calls/op")
+	}
+}
+
+// BenchmarkLaunchLatency launches NodeClaims concurrently with their customData rendered by the node bootstrapping
+// API, with ARM-like latencies scaled down only 10x so that the rest of the launch doesn't skew them, and reports how
+// long launches take to start their VM create, along with the latencies of the NIC create and customData rendering
+// they wait on. The NIC is created while the customData is rendered, so launches take about the longer of the two,
+// rather than their sum, the serial latency:
+//
+//	go test ./pkg/cloudprovider -run '^$' -bench BenchmarkLaunchLatency
+func BenchmarkLaunchLatency(b *testing.B) {
+	benchCtx, benchEnv, benchAzureEnv, benchNodeClass := newLoadTestEnvironment(b, test.Options(test.OptionsFields{
+		ProvisionMode: lo.ToPtr(consts.ProvisionModeBootstrappingClient),
+	}))
+	// the latencies the launches wait on, summed across the launches
+	var nicLatency, renderLatency atomic.Int64
+	recorded := func(latencies *atomic.Int64, distribution fake.LatencyDistribution) fake.LatencyDistribution {
+		return func() time.Duration {
+			latency := distribution()
+			latencies.Add(int64(latency))
+			return latency
+		}
+	}
+	benchAzureEnv.NetworkInterfacesAPI.NetworkInterfacesCreateOrUpdateBehavior.LatencyDistribution = recorded(&nicLatency, fake.NormalLatency(loadTestSeed, 200*time.Millisecond, 50*time.Millisecond))
+	benchAzureEnv.NodeBootstrappingAPI.LatencyDistribution = recorded(&renderLatency, fake.NormalLatency(loadTestSeed, 150*time.Millisecond, 50*time.Millisecond))
+	benchCloudProvider := New(benchAzureEnv.InstanceTypesProvider, benchAzureEnv.VMInstanceProvider, events.NewRecorder(&record.FakeRecorder{}), benchEnv.Client, benchAzureEnv.ImageProvider)
+
+	var launchLatency atomic.Int64
+	var launches int
+	b.ResetTimer()
+	for range b.N {
+		b.StopTimer()
+		benchAzureEnv.Reset()
+		b.StartTimer()
+
+		var wg sync.WaitGroup
+		for range latencyTestNodeClaims {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				start := time.Now()
+				if _, err := benchCloudProvider.Create(benchCtx, loadTestNodeClaim(benchNodeClass)); err != nil {
+					b.Errorf("launching nodeclaim, %s", err)
+					return
+				}
+				launchLatency.Add(int64(time.Since(start)))
+			}()
+		}
+		wg.Wait()
+		launches += latencyTestNodeClaims
+	}
+	b.StopTimer()
+
+	perLaunch := func(latencies *atomic.Int64) float64 {
+		return time.Duration(latencies.Load()/int64(launches)).Seconds() * 1000
+	}
+	b.ReportMetric(perLaunch(&launchLatency), "launch-ms")
+	b.ReportMetric(perLaunch(&nicLatency), "nic-create-ms")
+	b.ReportMetric(perLaunch(&renderLatency), "customdata-render-ms")
+	b.ReportMetric(perLaunch(&nicLatency)+perLaunch(&renderLatency), "serial-ms")
+}
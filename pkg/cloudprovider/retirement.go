@@ -0,0 +1,75 @@
+/*
+Portions Copyright (c) Microsoft Corporation.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cloudprovider
+
+import (
+	"context"
+	"time"
+
+	"github.com/samber/lo"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	"github.com/Azure/karpenter-provider-azure/pkg/apis/v1beta1"
+	cloudproviderevents "github.com/Azure/karpenter-provider-azure/pkg/cloudprovider/events"
+	"github.com/Azure/karpenter-provider-azure/pkg/providers/instancetype"
+
+	karpv1 "sigs.k8s.io/karpenter/pkg/apis/v1"
+	"sigs.k8s.io/karpenter/pkg/cloudprovider"
+	"sigs.k8s.io/karpenter/pkg/metrics"
+	"sigs.k8s.io/karpenter/pkg/scheduling"
+)
+
+// checkSeriesRetirement flags nodepools whose requirements can only be satisfied by instance types of VM series that
+// retire within the retirement warning period, so they can be moved to other series before creates start failing.
+// Retired series are already excluded from the instance types.
+func (c *CloudProvider) checkSeriesRetirement(ctx context.Context, nodePool *karpv1.NodePool, nodeClass *v1beta1.AKSNodeClass, instanceTypes []*cloudprovider.InstanceType) {
+	retirement, retiringOnly := c.latestSeriesRetirement(ctx, nodePool, nodeClass, instanceTypes)
+	instancetype.NodePoolRetiringSeriesOnlyMetric.With(map[string]string{
+		metrics.NodePoolLabel: nodePool.Name,
+	}).Set(lo.Ternary(retiringOnly, 1.0, 0.0))
+	if retiringOnly {
+		log.FromContext(ctx).V(1).Info("nodepool requirements can only be satisfied by instance types of retiring VM series", "NodePool", nodePool.Name, "retirement", retirement.Format(time.DateOnly))
+		c.recorder.Publish(cloudproviderevents.NodePoolInstanceTypesRetiring(nodePool, retirement))
+	}
+}
+
+// latestSeriesRetirement returns whether all the instance types compatible with the nodepool requirements are of
+// retiring VM series, and if so when the last of them retires.
+func (c *CloudProvider) latestSeriesRetirement(ctx context.Context, nodePool *karpv1.NodePool, nodeClass *v1beta1.AKSNodeClass, instanceTypes []*cloudprovider.InstanceType) (time.Time, bool) {
+	requirements := scheduling.NewNodeSelectorRequirementsWithMinValues(nodePool.Spec.Template.Spec.Requirements...)
+	compatible := lo.Filter(instanceTypes, func(instanceType *cloudprovider.InstanceType, _ int) bool {
+		return instanceType.Requirements.Intersects(requirements) == nil
+	})
+	if len(compatible) == 0 {
+		return time.Time{}, false
+	}
+	var latest time.Time
+	for _, instanceType := range compatible {
+		sku, err := c.instanceTypeProvider.Get(ctx, nodeClass, instanceType.Name)
+		if err != nil {
+			return time.Time{}, false
+		}
+		retirement, retiring := instancetype.IsSeriesRetiring(ctx, sku, time.Now())
+		if !retiring {
+			return time.Time{}, false
+		}
+		if retirement.After(latest) {
+			latest = retirement
+		}
+	}
+	return latest, true
+}
@@ -20,9 +20,15 @@ package cloudprovider
 import (
 	"context"
 	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
 	"testing"
 	"time"
 
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
+	// nolint SA1019 - deprecated package
+	"github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/compute/armcompute/v7"
 	"github.com/awslabs/operatorpkg/object"
 	"github.com/blang/semver/v4"
 	. "github.com/onsi/ginkgo/v2"
@@ -35,10 +41,12 @@ import (
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	karpv1 "sigs.k8s.io/karpenter/pkg/apis/v1"
 	corecloudprovider "sigs.k8s.io/karpenter/pkg/cloudprovider"
+	nodeclaimgarbagecollection "sigs.k8s.io/karpenter/pkg/controllers/nodeclaim/garbagecollection"
 	"sigs.k8s.io/karpenter/pkg/controllers/provisioning"
 	"sigs.k8s.io/karpenter/pkg/controllers/state"
 	"sigs.k8s.io/karpenter/pkg/events"
 	coreoptions "sigs.k8s.io/karpenter/pkg/operator/options"
+	"sigs.k8s.io/karpenter/pkg/scheduling"
 	coretest "sigs.k8s.io/karpenter/pkg/test"
 	. "sigs.k8s.io/karpenter/pkg/test/expectations"
 	"sigs.k8s.io/karpenter/pkg/test/v1alpha1"
@@ -46,10 +54,15 @@ import (
 
 	"github.com/Azure/karpenter-provider-azure/pkg/apis"
 	"github.com/Azure/karpenter-provider-azure/pkg/apis/v1beta1"
+	"github.com/Azure/karpenter-provider-azure/pkg/fake"
+	"github.com/Azure/karpenter-provider-azure/pkg/metrics"
 	"github.com/Azure/karpenter-provider-azure/pkg/operator/options"
+	"github.com/Azure/karpenter-provider-azure/pkg/providers/imagefamily"
 	"github.com/Azure/karpenter-provider-azure/pkg/providers/instance"
+	"github.com/Azure/karpenter-provider-azure/pkg/providers/launchtemplate"
 	"github.com/Azure/karpenter-provider-azure/pkg/test"
 	"github.com/Azure/karpenter-provider-azure/pkg/utils"
+	nodeclaimutils "github.com/Azure/karpenter-provider-azure/pkg/utils/nodeclaim"
 )
 
 var ctx context.Context
@@ -146,12 +159,28 @@ var _ = Describe("CloudProvider", func() {
 		nodeClaims, _ := cloudProvider.List(ctx)
 		Expect(azureEnv.AzureResourceGraphAPI.AzureResourceGraphResourcesBehavior.CalledWithInput.Len()).To(Equal(1))
 		queryRequest := azureEnv.AzureResourceGraphAPI.AzureResourceGraphResourcesBehavior.CalledWithInput.Pop().Query
-		Expect(*queryRequest.Query).To(Equal(instance.GetVMListQueryBuilder(azureEnv.AzureResourceGraphAPI.ResourceGroup).String()))
+		Expect(*queryRequest.Query).To(Equal(instance.GetVMListQueryBuilder(azureEnv.AzureResourceGraphAPI.ResourceGroup, azureEnv.AzureResourceGraphAPI.ClusterName).String()))
 		Expect(nodeClaims).To(HaveLen(1))
 		Expect(nodeClaims[0]).ToNot(BeNil())
 		Expect(nodeClaims[0].Status.Capacity).ToNot(BeEmpty())
-		resp, _ := azureEnv.VirtualMachinesAPI.Get(ctx, azureEnv.AzureResourceGraphAPI.ResourceGroup, nodeClaims[0].Name, nil)
-		Expect(resp.VirtualMachine).ToNot(BeNil())
+		resp, _ := azureEnv.VirtualMachinesAPI.Get(ctx, azureEnv.AzureResourceGraphAPI.ResourceGroup, instance.GenerateResourceName(nodeClaims[0].Name), nil)
+		Expect(resp.VirtualMachine.ID).ToNot(BeNil())
+	})
+	It("should shorten the VM name of a long nodeclaim name, and map the VM back to the nodeclaim", func() {
+		nodeClaim.Name = strings.Repeat("long-nodepool-name-", 4) + "2jf98"
+		ExpectApplied(ctx, env.Client, nodePool, nodeClass, nodeClaim)
+		_, err := cloudProvider.Create(ctx, nodeClaim)
+		Expect(err).ToNot(HaveOccurred())
+
+		vm := azureEnv.VirtualMachinesAPI.VirtualMachineCreateOrUpdateBehavior.CalledWithInput.Pop().VM
+		Expect(len(lo.FromPtr(vm.Name))).To(BeNumerically("<=", 64))
+		Expect(lo.FromPtr(vm.Properties.OSProfile.ComputerName)).To(Equal(lo.FromPtr(vm.Name)))
+		Expect(vm.Tags).To(HaveKeyWithValue(launchtemplate.NodeClaimTagKey, lo.ToPtr(nodeClaim.Name)))
+
+		nodeClaims, err := cloudProvider.List(ctx)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(nodeClaims).To(HaveLen(1))
+		Expect(nodeClaims[0].Name).To(Equal(nodeClaim.Name))
 	})
 	It("should return an ICE error when there are no instance types to launch", func() {
 		// Specify no instance types and expect to receive a capacity error
@@ -170,6 +199,333 @@ var _ = Describe("CloudProvider", func() {
 		Expect(corecloudprovider.IsInsufficientCapacityError(err)).To(BeTrue())
 		Expect(cloudProviderMachine).To(BeNil())
 	})
+	It("should not launch when the images of the nodeclass are inaccessible", func() {
+		nodeClass.StatusConditions().SetFalse(v1beta1.ConditionTypeImagesReady, "ImagesInaccessible", "Image source is inaccessible, AuthorizationFailed")
+		ExpectApplied(ctx, env.Client, nodePool, nodeClass, nodeClaim)
+		cloudProviderMachine, err := cloudProvider.Create(ctx, nodeClaim)
+		Expect(corecloudprovider.IsNodeClassNotReadyError(err)).To(BeTrue())
+		Expect(err.Error()).To(ContainSubstring("AuthorizationFailed"))
+		Expect(cloudProviderMachine).To(BeNil())
+		Expect(azureEnv.VirtualMachinesAPI.VirtualMachineCreateOrUpdateBehavior.CalledWithInput.Len()).To(Equal(0))
+	})
+	Context("Image not found", func() {
+		var imageProvider *listCountingImageProvider
+		var imageCloudProvider *CloudProvider
+		notFoundRecoveries := func(result string) float64 {
+			metric, err := metrics.FindMetricWithLabelValues("karpenter_image_not_found_recoveries_total", map[string]string{metrics.SourceLabel: "create", metrics.ResultLabel: result})
+			Expect(err).ToNot(HaveOccurred())
+			return metric.GetCounter().GetValue()
+		}
+
+		BeforeEach(func() {
+			imageProvider = &listCountingImageProvider{NodeImageProvider: azureEnv.ImageProvider}
+			imageCloudProvider = New(azureEnv.InstanceTypesProvider, azureEnv.VMInstanceProvider, recorder, env.Client, imageProvider)
+			// the fixture version of the nodeclass status was deleted after it was resolved, the gallery only has a later one
+			azureEnv.CommunityImageVersionsAPI.ImageVersions.Append(&armcompute.CommunityGalleryImageVersion{Name: lo.ToPtr("202502.01.0")})
+		})
+
+		It("should re-resolve the image once and retry the launch when the image version was deleted", func() {
+			azureEnv.VirtualMachinesAPI.VirtualMachineCreateOrUpdateBehavior.BeginError.Set(&azcore.ResponseError{ErrorCode: "GalleryImageNotFound", StatusCode: http.StatusNotFound})
+			recovered := notFoundRecoveries("recovered")
+			ExpectApplied(ctx, env.Client, nodePool, nodeClass, nodeClaim)
+			_, err := imageCloudProvider.Create(ctx, nodeClaim)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(imageProvider.lists).To(Equal(1))
+			Expect(notFoundRecoveries("recovered")).To(Equal(recovered + 1))
+
+			Expect(azureEnv.VirtualMachinesAPI.VirtualMachineCreateOrUpdateBehavior.CalledWithInput.Len()).To(Equal(2))
+			vm := azureEnv.VirtualMachinesAPI.VirtualMachineCreateOrUpdateBehavior.CalledWithInput.Pop().VM
+			Expect(lo.FromPtr(vm.Properties.StorageProfile.ImageReference.CommunityGalleryImageID)).To(HaveSuffix("/versions/202502.01.0"))
+
+			nodeClass = ExpectExists(ctx, env.Client, nodeClass)
+			Expect(nodeClass.Status.Images[0].ID).To(HaveSuffix("/versions/202502.01.0"))
+			Expect(nodeClass.StatusConditions().Get(v1beta1.ConditionTypeImagesReady).IsTrue()).To(BeTrue())
+		})
+		It("should retry the launch only once", func() {
+			azureEnv.VirtualMachinesAPI.VirtualMachineCreateOrUpdateBehavior.BeginError.Set(&azcore.ResponseError{ErrorCode: "GalleryImageNotFound", StatusCode: http.StatusNotFound}, fake.MaxCalls(2))
+			ExpectApplied(ctx, env.Client, nodePool, nodeClass, nodeClaim)
+			_, err := imageCloudProvider.Create(ctx, nodeClaim)
+			Expect(err).To(HaveOccurred())
+			Expect(imageProvider.lists).To(Equal(1))
+			Expect(azureEnv.VirtualMachinesAPI.VirtualMachineCreateOrUpdateBehavior.CalledWithInput.Len()).To(Equal(2))
+		})
+		It("should set the images of the nodeclass not ready when the image can't be re-resolved", func() {
+			azureEnv.VirtualMachinesAPI.VirtualMachineCreateOrUpdateBehavior.BeginError.Set(&azcore.ResponseError{ErrorCode: "ImageNotFound", StatusCode: http.StatusNotFound})
+			azureEnv.CommunityImageVersionsAPI.Error = &azcore.ResponseError{ErrorCode: "ResourceNotFound", StatusCode: http.StatusNotFound}
+			failed := notFoundRecoveries("failed")
+			ExpectApplied(ctx, env.Client, nodePool, nodeClass, nodeClaim)
+			_, err := imageCloudProvider.Create(ctx, nodeClaim)
+			Expect(corecloudprovider.IsNodeClassNotReadyError(err)).To(BeTrue())
+			Expect(imageProvider.lists).To(Equal(1))
+			Expect(notFoundRecoveries("failed")).To(Equal(failed + 1))
+			Expect(azureEnv.VirtualMachinesAPI.VirtualMachineCreateOrUpdateBehavior.CalledWithInput.Len()).To(Equal(1))
+
+			nodeClass = ExpectExists(ctx, env.Client, nodeClass)
+			imagesReady := nodeClass.StatusConditions().Get(v1beta1.ConditionTypeImagesReady)
+			Expect(imagesReady.IsFalse()).To(BeTrue())
+			Expect(imagesReady.Reason).To(Equal(ImageNotFoundReason))
+		})
+	})
+	Context("Bootstrap debug", func() {
+		It("should not annotate the bootstrap payload by default", func() {
+			ExpectApplied(ctx, env.Client, nodePool, nodeClass, nodeClaim)
+			createdNodeClaim, err := cloudProvider.Create(ctx, nodeClaim)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(createdNodeClaim.Annotations).ToNot(HaveKey(v1beta1.AnnotationBootstrapCustomDataDebug))
+			Expect(createdNodeClaim.Annotations).ToNot(HaveKey(v1beta1.AnnotationBootstrapCSEDebug))
+		})
+		It("should annotate a redacted bootstrap payload when enabled", func() {
+			token := "abcdef.0123456789abcdef"
+			ctx = options.ToContext(ctx, test.Options(test.OptionsFields{
+				KubeletClientTLSBootstrapToken: lo.ToPtr(token),
+				EnableBootstrapDebug:           lo.ToPtr(true),
+			}))
+			ExpectApplied(ctx, env.Client, nodePool, nodeClass, nodeClaim)
+			createdNodeClaim, err := cloudProvider.Create(ctx, nodeClaim)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(createdNodeClaim.Annotations).To(HaveKey(v1beta1.AnnotationBootstrapCustomDataDebug))
+			debugData := createdNodeClaim.Annotations[v1beta1.AnnotationBootstrapCustomDataDebug]
+			Expect(debugData).To(ContainSubstring("TLS_BOOTSTRAP_TOKEN"))
+			Expect(debugData).ToNot(ContainSubstring(token))
+		})
+		It("should redact the bootstrap token the launch template was rendered with", func() {
+			// the token of the launch template is resolved at launch, e.g. from a rotated secret, rather than the options
+			launchTemplate := &launchtemplate.Template{
+				CustomScriptsCSE: "bootstrap --token rotated.0123456789abcdef",
+				BootstrapToken:   "rotated.0123456789abcdef",
+			}
+			setBootstrapDebugAnnotations(nodeClaim, launchTemplate)
+			Expect(nodeClaim.Annotations).To(HaveKey(v1beta1.AnnotationBootstrapCSEDebug))
+			Expect(nodeClaim.Annotations[v1beta1.AnnotationBootstrapCSEDebug]).ToNot(ContainSubstring("rotated.0123456789abcdef"))
+		})
+	})
+
+	It("should annotate the nodeclaim with the estimated hourly cost of the offering launched", func() {
+		ExpectApplied(ctx, env.Client, nodePool, nodeClass, nodeClaim)
+		createdNodeClaim, err := cloudProvider.Create(ctx, nodeClaim)
+		Expect(err).ToNot(HaveOccurred())
+
+		sku := createdNodeClaim.Labels[v1.LabelInstanceTypeStable]
+		capacityType := createdNodeClaim.Labels[karpv1.CapacityTypeLabelKey]
+		Expect(createdNodeClaim.Annotations).To(HaveKeyWithValue(v1beta1.AnnotationEstimatedHourlyCostSKU, sku))
+		Expect(createdNodeClaim.Annotations).To(HaveKeyWithValue(v1beta1.AnnotationEstimatedHourlyCostCapacityType, capacityType))
+		price, ok := azureEnv.PricingProvider.OnDemandPrice(sku)
+		if capacityType == karpv1.CapacityTypeSpot {
+			price, ok = azureEnv.PricingProvider.ZonalSpotPrice(sku, createdNodeClaim.Labels[v1.LabelTopologyZone])
+		}
+		Expect(ok).To(BeTrue())
+		Expect(createdNodeClaim.Annotations).To(HaveKeyWithValue(v1beta1.AnnotationEstimatedHourlyCost, strconv.FormatFloat(price, 'f', -1, 64)))
+	})
+
+	Context("Image family override", func() {
+		It("should launch with the image family of the nodepool and record it on the nodeclaim", func() {
+			nodeClass.Spec.ImageFamily = lo.ToPtr(v1beta1.Ubuntu2204ImageFamily)
+			nodeClaim.Labels[v1beta1.LabelImageFamily] = v1beta1.AzureLinuxImageFamily
+			ExpectApplied(ctx, env.Client, nodePool, nodeClass, nodeClaim)
+			createdNodeClaim, err := cloudProvider.Create(ctx, nodeClaim)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(createdNodeClaim.Labels).To(HaveKeyWithValue(v1beta1.LabelImageFamily, v1beta1.AzureLinuxImageFamily))
+
+			vm := azureEnv.VirtualMachinesAPI.VirtualMachineCreateOrUpdateBehavior.CalledWithInput.Pop().VM
+			imageReference := vm.Properties.StorageProfile.ImageReference
+			Expect(lo.FromPtr(imageReference.CommunityGalleryImageID) + lo.FromPtr(imageReference.ID)).To(ContainSubstring("AKSAzureLinux"))
+		})
+		It("should record the image family of the nodeclass when the nodepool doesn't override it", func() {
+			nodeClass.Spec.ImageFamily = lo.ToPtr(v1beta1.Ubuntu2204ImageFamily)
+			ExpectApplied(ctx, env.Client, nodePool, nodeClass, nodeClaim)
+			createdNodeClaim, err := cloudProvider.Create(ctx, nodeClaim)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(createdNodeClaim.Labels).To(HaveKeyWithValue(v1beta1.LabelImageFamily, v1beta1.Ubuntu2204ImageFamily))
+		})
+		It("should fail to launch with an image family that isn't registered", func() {
+			nodeClaim.Labels[v1beta1.LabelImageFamily] = "Windows2022"
+			ExpectApplied(ctx, env.Client, nodePool, nodeClass, nodeClaim)
+			_, err := cloudProvider.Create(ctx, nodeClaim)
+			Expect(err).To(HaveOccurred())
+			Expect(err.Error()).To(ContainSubstring("Windows2022"))
+			Expect(azureEnv.VirtualMachinesAPI.VirtualMachineCreateOrUpdateBehavior.CalledWithInput.Len()).To(Equal(0))
+		})
+		It("should not get the instance types of a nodepool requiring an image family that isn't registered", func() {
+			nodePool.Spec.Template.Labels = map[string]string{v1beta1.LabelImageFamily: "Windows2022"}
+			ExpectApplied(ctx, env.Client, nodePool, nodeClass)
+			_, err := cloudProvider.GetInstanceTypes(ctx, nodePool)
+			Expect(err).To(HaveOccurred())
+		})
+		It("should not override the image family with one not supporting the FIPS mode of the nodeclass", func() {
+			nodeClass.Spec.ImageFamily = lo.ToPtr(v1beta1.AzureLinuxImageFamily)
+			nodeClass.Spec.FIPSMode = lo.ToPtr(v1beta1.FIPSModeFIPS)
+			requirement := imageFamilyRequirement(map[string]string{v1beta1.LabelImageFamily: v1beta1.Ubuntu2204ImageFamily}, nil)
+			_, err := overrideImageFamily(requirement, nodeClass)
+			Expect(err).To(HaveOccurred())
+		})
+		It("should pick an overridable image family satisfying a requirement excluding the one of the nodeclass", func() {
+			nodeClass.Spec.ImageFamily = lo.ToPtr(v1beta1.Ubuntu2204ImageFamily)
+			requirement := imageFamilyRequirement(nil, scheduling.NewRequirements(
+				scheduling.NewRequirement(v1beta1.LabelImageFamily, v1.NodeSelectorOpNotIn, v1beta1.Ubuntu2204ImageFamily, v1beta1.AzureLinuxImageFamily)))
+			family, err := overrideImageFamily(requirement, nodeClass)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(v1beta1.OverridableImageFamilies.Has(family)).To(BeTrue())
+			Expect(family).ToNot(BeElementOf(v1beta1.Ubuntu2204ImageFamily, v1beta1.AzureLinuxImageFamily))
+		})
+	})
+
+	Context("Volume detachment", func() {
+		var vmName string
+
+		BeforeEach(func() {
+			ExpectApplied(ctx, env.Client, nodePool, nodeClass, nodeClaim)
+			createdNodeClaim, err := cloudProvider.Create(ctx, nodeClaim)
+			Expect(err).ToNot(HaveOccurred())
+			nodeClaim.Status.ProviderID = createdNodeClaim.Status.ProviderID
+			vmName, err = nodeclaimutils.GetVMName(nodeClaim.Status.ProviderID)
+			Expect(err).ToNot(HaveOccurred())
+
+			// a data disk of an Azure Disk volume is still attached
+			id := fake.MkVMID(azureEnv.AzureResourceGraphAPI.ResourceGroup, vmName)
+			vm, ok := azureEnv.VirtualMachinesAPI.Instances.Load(id)
+			Expect(ok).To(BeTrue())
+			attached := vm.(armcompute.VirtualMachine)
+			attached.Properties.StorageProfile.DataDisks = []*armcompute.DataDisk{{Name: lo.ToPtr("pvc-disk"), Lun: lo.ToPtr[int32](0)}}
+			azureEnv.VirtualMachinesAPI.Instances.Store(id, attached)
+		})
+
+		It("should wait for data disks to be detached before deleting the VM", func() {
+			nodeClaim.DeletionTimestamp = &metav1.Time{Time: time.Now()}
+			Expect(cloudProvider.Delete(ctx, nodeClaim)).To(Succeed())
+			Expect(azureEnv.VirtualMachinesAPI.VirtualMachineDeleteBehavior.CalledWithInput.Len()).To(Equal(0))
+		})
+		It("should delete the VM once the volume detach timeout elapsed", func() {
+			nodeClaim.DeletionTimestamp = &metav1.Time{Time: time.Now().Add(-3 * time.Minute)}
+			Expect(cloudProvider.Delete(ctx, nodeClaim)).To(Succeed())
+			Expect(azureEnv.VirtualMachinesAPI.VirtualMachineDeleteBehavior.CalledWithInput.Len()).To(Equal(1))
+		})
+		It("should measure the volume detach timeout from when volumes started detaching", func() {
+			nodeClaim.DeletionTimestamp = &metav1.Time{Time: time.Now().Add(-time.Hour)}
+			nodeClaim.StatusConditions().SetFalse(karpv1.ConditionTypeVolumesDetached, "TerminationGracePeriodElapsed", "TerminationGracePeriodElapsed")
+			Expect(cloudProvider.Delete(ctx, nodeClaim)).To(Succeed())
+			Expect(azureEnv.VirtualMachinesAPI.VirtualMachineDeleteBehavior.CalledWithInput.Len()).To(Equal(0))
+		})
+		It("should not wait when the volume detach timeout is disabled", func() {
+			ctx = options.ToContext(ctx, test.Options(test.OptionsFields{VolumeDetachTimeout: lo.ToPtr(time.Duration(0))}))
+			nodeClaim.DeletionTimestamp = &metav1.Time{Time: time.Now()}
+			Expect(cloudProvider.Delete(ctx, nodeClaim)).To(Succeed())
+			Expect(azureEnv.VirtualMachinesAPI.VirtualMachineDeleteBehavior.CalledWithInput.Len()).To(Equal(1))
+		})
+		It("should not wait for NodeClaims that aren't deleting", func() {
+			Expect(cloudProvider.Delete(ctx, nodeClaim)).To(Succeed())
+			Expect(azureEnv.VirtualMachinesAPI.VirtualMachineDeleteBehavior.CalledWithInput.Len()).To(Equal(1))
+		})
+	})
+
+	Context("Eventual consistency", func() {
+		var vmName string
+
+		launch := func(launched time.Time) {
+			GinkgoHelper()
+			ExpectApplied(ctx, env.Client, nodePool, nodeClass, nodeClaim)
+			createdNodeClaim, err := cloudProvider.Create(ctx, nodeClaim)
+			Expect(err).ToNot(HaveOccurred())
+			nodeClaim.Status.ProviderID = createdNodeClaim.Status.ProviderID
+			nodeClaim.StatusConditions().SetTrue(karpv1.ConditionTypeLaunched)
+			nodeClaim.StatusConditions().SetTrue(karpv1.ConditionTypeRegistered)
+			for i := range nodeClaim.Status.Conditions {
+				nodeClaim.Status.Conditions[i].LastTransitionTime = metav1.NewTime(launched)
+			}
+			ExpectApplied(ctx, env.Client, nodeClaim)
+			vmName, err = nodeclaimutils.GetVMName(nodeClaim.Status.ProviderID)
+			Expect(err).ToNot(HaveOccurred())
+		}
+
+		BeforeEach(func() {
+			// the VMs aren't found until a minute after they're created
+			azureEnv.VirtualMachinesAPI.ReplicationLag = time.Minute
+		})
+
+		It("should consider the VM of a recently launched nodeclaim provisioning until it's found", func() {
+			launch(time.Now())
+
+			_, err := cloudProvider.Get(ctx, nodeClaim.Status.ProviderID)
+			Expect(err).To(HaveOccurred())
+			Expect(corecloudprovider.IsNodeClaimNotFoundError(err)).To(BeFalse())
+
+			nodeClaims, err := cloudProvider.List(ctx)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(lo.Map(nodeClaims, func(nc *karpv1.NodeClaim, _ int) string { return nc.Status.ProviderID })).To(ConsistOf(nodeClaim.Status.ProviderID))
+		})
+		It("should not garbage collect a recently launched nodeclaim whose VM isn't found yet", func() {
+			launch(time.Now())
+
+			ExpectSingletonReconciled(ctx, nodeclaimgarbagecollection.NewController(fakeClock, env.Client, cloudProvider))
+			ExpectExists(ctx, env.Client, nodeClaim)
+		})
+		It("should get the VM of a recently launched nodeclaim once it's found", func() {
+			launch(time.Now())
+			azureEnv.VirtualMachinesAPI.ReplicationLag = 0
+
+			found, err := cloudProvider.Get(ctx, nodeClaim.Status.ProviderID)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(found.Status.ProviderID).To(Equal(nodeClaim.Status.ProviderID))
+		})
+		It("should consider the VM gone once the grace period after the launch elapsed", func() {
+			launch(time.Now().Add(-LaunchNotFoundGracePeriod))
+			azureEnv.VirtualMachinesAPI.Instances.Delete(fake.MkVMID(azureEnv.AzureResourceGraphAPI.ResourceGroup, vmName))
+
+			_, err := cloudProvider.Get(ctx, nodeClaim.Status.ProviderID)
+			Expect(corecloudprovider.IsNodeClaimNotFoundError(err)).To(BeTrue())
+
+			nodeClaims, err := cloudProvider.List(ctx)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(nodeClaims).To(BeEmpty())
+		})
+	})
+
+	Context("VM series retirement", func() {
+		retiringSeriesOnly := func() float64 {
+			metric, err := metrics.FindMetricWithLabelValues("karpenter_instance_type_nodepool_retiring_series_only", map[string]string{metrics.NodePoolLabel: nodePool.Name})
+			Expect(err).ToNot(HaveOccurred())
+			Expect(metric).ToNot(BeNil())
+			return metric.GetGauge().GetValue()
+		}
+
+		BeforeEach(func() {
+			// Standard_D2_v2 is of the standardDv2Family series
+			nodePool.Spec.Template.Spec.Requirements = append(nodePool.Spec.Template.Spec.Requirements, karpv1.NodeSelectorRequirementWithMinValues{
+				NodeSelectorRequirement: v1.NodeSelectorRequirement{
+					Key:      v1.LabelInstanceTypeStable,
+					Operator: v1.NodeSelectorOpIn,
+					Values:   []string{"Standard_D2_v2"},
+				},
+			})
+			ExpectApplied(ctx, env.Client, nodePool, nodeClass)
+		})
+
+		It("should flag nodepools that can only use instance types of retiring series", func() {
+			ctx = options.ToContext(ctx, test.Options(test.OptionsFields{
+				VMSeriesRetirementOverrides: map[string]string{"standardDv2Family": time.Now().AddDate(0, 1, 0).Format(time.DateOnly)},
+			}))
+			instanceTypes, err := cloudProvider.GetInstanceTypes(ctx, nodePool)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(instanceTypes).To(ContainElement(HaveField("Name", "Standard_D2_v2")))
+			Expect(retiringSeriesOnly()).To(Equal(1.0))
+		})
+		It("should not flag nodepools when the retirement is beyond the warning period", func() {
+			ctx = options.ToContext(ctx, test.Options(test.OptionsFields{
+				VMSeriesRetirementOverrides: map[string]string{"standardDv2Family": time.Now().AddDate(1, 0, 0).Format(time.DateOnly)},
+			}))
+			_, err := cloudProvider.GetInstanceTypes(ctx, nodePool)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(retiringSeriesOnly()).To(Equal(0.0))
+		})
+		It("should not flag nodepools that can also use instance types of other series", func() {
+			nodePool.Spec.Template.Spec.Requirements[len(nodePool.Spec.Template.Spec.Requirements)-1].Values = []string{"Standard_D2_v2", "Standard_D2_v3"}
+			ctx = options.ToContext(ctx, test.Options(test.OptionsFields{
+				VMSeriesRetirementOverrides: map[string]string{"standardDv2Family": time.Now().AddDate(0, 1, 0).Format(time.DateOnly)},
+			}))
+			_, err := cloudProvider.GetInstanceTypes(ctx, nodePool)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(retiringSeriesOnly()).To(Equal(0.0))
+		})
+	})
 
 	// TODO (chmcbrid): split Drift tests into their own test file drift_test.go
 	Context("Drift", func() {
@@ -294,6 +650,110 @@ var _ = Describe("CloudProvider", func() {
 				Expect(err).ToNot(HaveOccurred())
 				Expect(drifted).To(Equal(ImageDrift))
 			})
+
+			It("should trigger drift when the version of the marketplace image changes", func() {
+				azureEnv.VirtualMachinesAPI.Instances.Range(func(key, value any) bool {
+					vm := value.(armcompute.VirtualMachine)
+					vm.Properties.StorageProfile.ImageReference = &armcompute.ImageReference{
+						Publisher: lo.ToPtr("Canonical"),
+						Offer:     lo.ToPtr("0001-com-ubuntu-server-jammy"),
+						SKU:       lo.ToPtr("22_04-lts-gen2"),
+						Version:   lo.ToPtr("22.04.202410090"),
+					}
+					azureEnv.VirtualMachinesAPI.Instances.Store(key, vm)
+					return true
+				})
+				nodeClass = ExpectExists(ctx, env.Client, nodeClass)
+				nodeClass.Status.Images = []v1beta1.NodeImage{{
+					ID: imagefamily.BuildImageIDMarketplace("12345678-1234-1234-1234-123456789012", fake.Region, "Canonical", "0001-com-ubuntu-server-jammy", "22_04-lts-gen2", "22.04.202410090"),
+				}}
+				ExpectApplied(ctx, env.Client, nodeClass)
+				drifted, err := cloudProvider.IsDrifted(ctx, nodeClaim)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(drifted).To(Equal(NoDrift))
+
+				nodeClass.Status.Images = []v1beta1.NodeImage{{
+					ID: imagefamily.BuildImageIDMarketplace("12345678-1234-1234-1234-123456789012", fake.Region, "Canonical", "0001-com-ubuntu-server-jammy", "22_04-lts-gen2", "22.04.202411010"),
+				}}
+				ExpectApplied(ctx, env.Client, nodeClass)
+				drifted, err = cloudProvider.IsDrifted(ctx, nodeClaim)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(drifted).To(Equal(ImageDrift))
+			})
+
+			It("should not trigger drift for images of a gallery that moved to an aliased gallery", func() {
+				oldGallery := "/subscriptions/11111111-1111-1111-1111-111111111111/resourceGroups/images/providers/Microsoft.Compute/galleries/gallery"
+				newGallery := "/subscriptions/22222222-2222-2222-2222-222222222222/resourceGroups/images/providers/Microsoft.Compute/galleries/gallery"
+				azureEnv.VirtualMachinesAPI.Instances.Range(func(key, value any) bool {
+					vm := value.(armcompute.VirtualMachine)
+					vm.Properties.StorageProfile.ImageReference = &armcompute.ImageReference{
+						ID: lo.ToPtr(imagefamily.BuildImageIDSIG("11111111-1111-1111-1111-111111111111", "images", "gallery", "ubuntu", "1.0.0")),
+					}
+					azureEnv.VirtualMachinesAPI.Instances.Store(key, vm)
+					return true
+				})
+				nodeClass = ExpectExists(ctx, env.Client, nodeClass)
+				nodeClass.Status.Images = []v1beta1.NodeImage{{
+					ID: imagefamily.BuildImageIDSIG("22222222-2222-2222-2222-222222222222", "images", "gallery", "ubuntu", "1.0.0"),
+				}}
+				ExpectApplied(ctx, env.Client, nodeClass)
+				drifted, err := cloudProvider.IsDrifted(ctx, nodeClaim)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(drifted).To(Equal(ImageDrift))
+
+				aliasCtx := options.ToContext(ctx, test.Options(test.OptionsFields{
+					KubeletIdentityClientID: lo.ToPtr(node.Labels[v1beta1.AKSLabelKubeletIdentityClientID]),
+					GalleryAliases:          map[string]string{oldGallery: newGallery},
+				}))
+				drifted, err = cloudProvider.IsDrifted(aliasCtx, nodeClaim)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(drifted).To(Equal(NoDrift))
+			})
+
+			It("should not trigger drift for the image of a directly shared gallery in another casing", func() {
+				azureEnv.VirtualMachinesAPI.Instances.Range(func(key, value any) bool {
+					vm := value.(armcompute.VirtualMachine)
+					vm.Properties.StorageProfile.ImageReference = &armcompute.ImageReference{
+						SharedGalleryImageID: lo.ToPtr(strings.ToLower(imagefamily.BuildImageIDSharedGallery("11111111-1111-1111-1111-111111111111-GALLERY", "ubuntu", "1.0.0"))),
+					}
+					azureEnv.VirtualMachinesAPI.Instances.Store(key, vm)
+					return true
+				})
+				nodeClass = ExpectExists(ctx, env.Client, nodeClass)
+				nodeClass.Status.Images = []v1beta1.NodeImage{{
+					ID: imagefamily.BuildImageIDSharedGallery("11111111-1111-1111-1111-111111111111-GALLERY", "ubuntu", "1.0.0"),
+				}}
+				ExpectApplied(ctx, env.Client, nodeClass)
+				drifted, err := cloudProvider.IsDrifted(ctx, nodeClaim)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(drifted).To(Equal(NoDrift))
+
+				nodeClass.Status.Images = []v1beta1.NodeImage{{
+					ID: imagefamily.BuildImageIDSharedGallery("11111111-1111-1111-1111-111111111111-GALLERY", "ubuntu", "1.0.1"),
+				}}
+				ExpectApplied(ctx, env.Client, nodeClass)
+				drifted, err = cloudProvider.IsDrifted(ctx, nodeClaim)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(drifted).To(Equal(ImageDrift))
+			})
+
+			It("should not trigger drift when the image version changes while images are frozen", func() {
+				nodeClass.Annotations = lo.Assign(nodeClass.Annotations, map[string]string{v1beta1.AnnotationImageFreeze: "true"})
+				test.ApplyCIGImagesWithVersion(nodeClass, "202503.02.0")
+				ExpectApplied(ctx, env.Client, nodeClass)
+				drifted, err := cloudProvider.IsDrifted(ctx, nodeClaim)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(drifted).To(Equal(NoDrift))
+			})
+
+			It("should not trigger drift when the image version changes while image drift is disabled", func() {
+				nodeClass.Spec.ImageDriftDisabled = lo.ToPtr(true)
+				test.ApplyCIGImagesWithVersion(nodeClass, "202503.02.0")
+				ExpectApplied(ctx, env.Client, nodeClass)
+				drifted, err := cloudProvider.IsDrifted(ctx, nodeClaim)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(drifted).To(Equal(NoDrift))
+			})
 		})
 
 		Context("Kubernetes Version", func() {
@@ -388,7 +848,31 @@ var _ = Describe("CloudProvider", func() {
 				Expect(err).ToNot(HaveOccurred())
 				Expect(drifted).To(Equal(KubeletIdentityDrift))
 			})
+
+			It("should compare the node kubelet client ID to the nodeclass kubelet identity", func() {
+				ctx = options.ToContext(ctx, test.Options(test.OptionsFields{
+					KubeletIdentityClientID: lo.ToPtr("3824ff7a-93b6-40af-b861-2eb621ba437a"), // a different random UUID
+				}))
+				nodeClass.Spec.KubeletIdentityClientID = lo.ToPtr(node.Labels[v1beta1.AKSLabelKubeletIdentityClientID])
+				nodeClass.Spec.KubeletIdentityResourceID = lo.ToPtr("/subscriptions/12345678-1234-1234-1234-123456789012/resourceGroups/test-resourceGroup/providers/Microsoft.ManagedIdentity/userAssignedIdentities/kubelet")
+				ExpectApplied(ctx, env.Client, nodeClass)
+
+				drifted, err := cloudProvider.IsDrifted(ctx, nodeClaim)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(drifted).To(BeEmpty())
+			})
 		})
 
 	})
 })
+
+// listCountingImageProvider counts the images listed by the cloudprovider
+type listCountingImageProvider struct {
+	imagefamily.NodeImageProvider
+	lists int
+}
+
+func (p *listCountingImageProvider) List(ctx context.Context, nodeClass *v1beta1.AKSNodeClass) ([]imagefamily.NodeImage, error) {
+	p.lists++
+	return p.NodeImageProvider.List(ctx, nodeClass)
+}
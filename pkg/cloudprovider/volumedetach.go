@@ -0,0 +1,78 @@
+/*
+Portions Copyright (c) Microsoft Corporation.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cloudprovider
+
+import (
+	"context"
+	"time"
+
+	// nolint SA1019 - deprecated package
+	"github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/compute/armcompute/v7"
+	"github.com/samber/lo"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	"github.com/Azure/karpenter-provider-azure/pkg/operator/options"
+	"github.com/Azure/karpenter-provider-azure/pkg/providers/instance"
+	"github.com/Azure/karpenter-provider-azure/pkg/utils"
+
+	karpv1 "sigs.k8s.io/karpenter/pkg/apis/v1"
+	"sigs.k8s.io/karpenter/pkg/metrics"
+)
+
+// awaitDataDiskDetachment returns whether the deletion of the VM of a terminating NodeClaim should wait for its data
+// disks to be detached. Deleting a VM with Azure Disk volumes still attached can leave the disks attached to the deleted
+// VM for several minutes, blocking their attachment to other nodes. Karpenter waits for the VolumeAttachments of the
+// node to be deleted before terminating it, but not for pods that aren't drained, or past the termination grace period,
+// so the data disks of the VM are checked too, until the volume detach timeout elapses.
+// Delete is called until the VM is gone, so waiting only defers the deletion to a later call.
+func (c *CloudProvider) awaitDataDiskDetachment(ctx context.Context, nodeClaim *karpv1.NodeClaim, vmName string) (bool, error) {
+	timeout := options.FromContext(ctx).VolumeDetachTimeout
+	start, ok := volumeDetachmentStart(nodeClaim)
+	if timeout == 0 || !ok {
+		return false, nil
+	}
+	vm, err := c.vmInstanceProvider.Get(ctx, vmName)
+	if err != nil {
+		return false, err
+	}
+	if utils.IsVMDeleting(*vm) || vm.Properties == nil || vm.Properties.StorageProfile == nil || len(vm.Properties.StorageProfile.DataDisks) == 0 {
+		return false, nil
+	}
+	dataDisks := lo.Map(vm.Properties.StorageProfile.DataDisks, func(disk *armcompute.DataDisk, _ int) string { return lo.FromPtr(disk.Name) })
+	if time.Since(start) < timeout {
+		log.FromContext(ctx).V(1).Info("waiting for data disks to be detached before deleting virtual machine", "vmName", vmName, "dataDisks", dataDisks)
+		return true, nil
+	}
+	log.FromContext(ctx).Info("timed out waiting for data disks to be detached, deleting virtual machine regardless", "vmName", vmName, "dataDisks", dataDisks, "timeout", timeout)
+	instance.VMDeleteVolumeDetachTimeoutMetric.With(map[string]string{
+		metrics.NodePoolLabel: nodeClaim.Labels[karpv1.NodePoolLabelKey],
+	}).Inc()
+	return false, nil
+}
+
+// volumeDetachmentStart returns when the NodeClaim started waiting for its volumes to be detached: when the
+// VolumesDetached condition was set, after draining, or else when the NodeClaim started deleting.
+// NodeClaims that aren't deleting, e.g. the ones garbage collection constructs for leaked VMs, don't wait.
+func volumeDetachmentStart(nodeClaim *karpv1.NodeClaim) (time.Time, bool) {
+	if nodeClaim.DeletionTimestamp == nil {
+		return time.Time{}, false
+	}
+	if cond := nodeClaim.StatusConditions().Get(karpv1.ConditionTypeVolumesDetached); cond != nil && !cond.IsUnknown() {
+		return cond.LastTransitionTime.Time, true
+	}
+	return nodeClaim.DeletionTimestamp.Time, true
+}
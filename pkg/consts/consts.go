@@ -39,4 +39,26 @@ const (
 
 	ProvisionModeAKSScriptless       = "aksscriptless"
 	ProvisionModeBootstrappingClient = "bootstrappingclient"
+
+	CloudAzure = "azure"
+	CloudFake  = "fake"
+
+	// NodeImageVersionsAPIVersion is the default api-version of the NodeImageVersions API
+	NodeImageVersionsAPIVersion = "2024-04-02-preview"
+	// NodeImageVersionsFallbackAPIVersion is the api-version tried when the configured one is rejected, e.g. in
+	// sovereign clouds that lag behind. It is the first api-version serving the NodeImageVersions API.
+	NodeImageVersionsFallbackAPIVersion = "2024-02-02-preview"
+
+	// SpotPlacementScoresAPIVersion is the api-version of the Spot Placement Scores API
+	SpotPlacementScoresAPIVersion = "2025-06-05"
+
+	// SpotPlacementScoreStrategyPrice orders the offerings of the instance types to launch by price only
+	SpotPlacementScoreStrategyPrice = "Price"
+	// SpotPlacementScoreStrategyWeighted orders them by price weighted against the spot placement score of spot offerings
+	SpotPlacementScoreStrategyWeighted = "Weighted"
+
+	// TagDriftModeReport reports the resources whose tags drifted from those Karpenter sets, without repairing them
+	TagDriftModeReport = "Report"
+	// TagDriftModeRepair repairs them as well
+	TagDriftModeRepair = "Repair"
 )
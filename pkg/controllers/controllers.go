@@ -22,48 +22,82 @@ import (
 	"github.com/awslabs/operatorpkg/controller"
 	"github.com/awslabs/operatorpkg/status"
 	"k8s.io/client-go/kubernetes"
+	"k8s.io/utils/clock"
 
-	"sigs.k8s.io/karpenter/pkg/cloudprovider"
 	"sigs.k8s.io/karpenter/pkg/events"
 
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/manager"
 
 	"github.com/Azure/karpenter-provider-azure/pkg/apis/v1beta1"
+	"github.com/Azure/karpenter-provider-azure/pkg/cloudprovider"
+	nodeclaimcostestimate "github.com/Azure/karpenter-provider-azure/pkg/controllers/nodeclaim/costestimate"
 	nodeclaimgarbagecollection "github.com/Azure/karpenter-provider-azure/pkg/controllers/nodeclaim/garbagecollection"
+	nodeclaimgpudriver "github.com/Azure/karpenter-provider-azure/pkg/controllers/nodeclaim/gpudriver"
+	nodeclaiminstancehealth "github.com/Azure/karpenter-provider-azure/pkg/controllers/nodeclaim/instancehealth"
+	nodeclaimlocalstorage "github.com/Azure/karpenter-provider-azure/pkg/controllers/nodeclaim/localstorage"
+	nodeclaimmaintenancewindow "github.com/Azure/karpenter-provider-azure/pkg/controllers/nodeclaim/maintenancewindow"
+	nodeclaimrootfilesystem "github.com/Azure/karpenter-provider-azure/pkg/controllers/nodeclaim/rootfilesystem"
+	nodeclaimtagbackfill "github.com/Azure/karpenter-provider-azure/pkg/controllers/nodeclaim/tagbackfill"
+	nodeclaimtagdrift "github.com/Azure/karpenter-provider-azure/pkg/controllers/nodeclaim/tagdrift"
 	nodeclasshash "github.com/Azure/karpenter-provider-azure/pkg/controllers/nodeclass/hash"
+	nodeclasskubernetesupgrade "github.com/Azure/karpenter-provider-azure/pkg/controllers/nodeclass/kubernetesupgrade"
 	nodeclassstatus "github.com/Azure/karpenter-provider-azure/pkg/controllers/nodeclass/status"
 	nodeclasstermination "github.com/Azure/karpenter-provider-azure/pkg/controllers/nodeclass/termination"
+	nodepoolmetrics "github.com/Azure/karpenter-provider-azure/pkg/controllers/nodepool/metrics"
 
 	"github.com/Azure/karpenter-provider-azure/pkg/controllers/nodeclaim/inplaceupdate"
+	"github.com/Azure/karpenter-provider-azure/pkg/operator/options"
 	"github.com/Azure/karpenter-provider-azure/pkg/providers/imagefamily"
 	"github.com/Azure/karpenter-provider-azure/pkg/providers/instance"
+	"github.com/Azure/karpenter-provider-azure/pkg/providers/instancetype"
 	"github.com/Azure/karpenter-provider-azure/pkg/providers/kubernetesversion"
+	"github.com/Azure/karpenter-provider-azure/pkg/providers/pricing"
 )
 
 func NewControllers(
 	ctx context.Context,
 	mgr manager.Manager,
+	clk clock.Clock,
 	kubeClient client.Client,
 	recorder events.Recorder,
-	cloudProvider cloudprovider.CloudProvider,
+	cloudProvider *cloudprovider.CloudProvider,
 	vmInstanceProvider instance.VMProvider,
 	kubernetesVersionProvider kubernetesversion.KubernetesVersionProvider,
 	nodeImageProvider imagefamily.NodeImageProvider,
 	inClusterKubernetesInterface kubernetes.Interface,
-	subnetsClient instance.SubnetsAPI,
+	azClient *instance.AZClient,
+	instanceTypeProvider instancetype.Provider,
+	pricingProvider *pricing.Provider,
 ) []controller.Controller {
 	controllers := []controller.Controller{
 		nodeclasshash.NewController(kubeClient),
-		nodeclassstatus.NewController(kubeClient, kubernetesVersionProvider, nodeImageProvider, inClusterKubernetesInterface, subnetsClient),
-		nodeclasstermination.NewController(kubeClient, recorder),
+		nodeclassstatus.NewController(kubeClient, kubernetesVersionProvider, nodeImageProvider, inClusterKubernetesInterface, azClient, instanceTypeProvider, recorder, clk),
+		nodeclassstatus.NewMetricsController(kubeClient),
+		nodeclasskubernetesupgrade.NewController(kubeClient, kubernetesVersionProvider),
+		nodeclasstermination.NewController(kubeClient, recorder, clk, cloudProvider),
 
-		nodeclaimgarbagecollection.NewVirtualMachine(kubeClient, cloudProvider),
+		nodeclaimgarbagecollection.NewVirtualMachine(kubeClient, cloudProvider, vmInstanceProvider),
 		nodeclaimgarbagecollection.NewNetworkInterface(kubeClient, vmInstanceProvider),
+		nodeclaimtagbackfill.NewController(kubeClient, vmInstanceProvider),
+		nodeclaimrootfilesystem.NewController(kubeClient),
+		nodeclaimgpudriver.NewController(kubeClient, cloudProvider, recorder, clk),
+		nodeclaimmaintenancewindow.NewController(kubeClient, clk),
+		nodeclaimlocalstorage.NewController(kubeClient, clk),
+		nodeclaiminstancehealth.NewRepairMetricsController(kubeClient, cloudProvider),
+		nodeclaimcostestimate.NewController(kubeClient, pricingProvider),
+
+		nodepoolmetrics.NewController(kubeClient),
 
 		// TODO: nodeclaim tagging
 		inplaceupdate.NewController(kubeClient, vmInstanceProvider),
 		status.NewController[*v1beta1.AKSNodeClass](kubeClient, mgr.GetEventRecorderFor("karpenter")),
 	}
+	if options.FromContext(ctx).InstanceHealthInterval > 0 {
+		controllers = append(controllers, nodeclaiminstancehealth.NewController(kubeClient, vmInstanceProvider))
+	}
+	if options.FromContext(ctx).TagDriftInterval > 0 {
+		controllers = append(controllers, nodeclaimtagdrift.NewController(kubeClient, vmInstanceProvider))
+	}
 	return controllers
 }
@@ -0,0 +1,165 @@
+/*
+Portions Copyright (c) Microsoft Corporation.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package costestimate
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/arm"
+	"github.com/awslabs/operatorpkg/singleton"
+	"github.com/samber/lo"
+	"go.uber.org/multierr"
+	corev1 "k8s.io/api/core/v1"
+	controllerruntime "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/manager"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+	karpv1 "sigs.k8s.io/karpenter/pkg/apis/v1"
+	"sigs.k8s.io/karpenter/pkg/operator/injection"
+
+	"github.com/Azure/karpenter-provider-azure/pkg/apis/v1beta1"
+	"github.com/Azure/karpenter-provider-azure/pkg/metrics"
+	"github.com/Azure/karpenter-provider-azure/pkg/providers/pricing"
+)
+
+// refreshInterval is how often the estimates are refreshed. The pricing is refreshed far less often, but the zonal spot
+// prices can be updated at any time.
+const refreshInterval = 5 * time.Minute
+
+// Controller keeps the estimated hourly cost annotations of the nodeclaims, and of their nodes, up to date with the
+// pricing, and sums the estimates by nodepool. The annotations are set at launch from the price of the offering
+// launched; spot prices change over time, so those are refreshed. Nodeclaims launched before the annotations were
+// introduced are annotated from their instance type and capacity type labels.
+type Controller struct {
+	kubeClient      client.Client
+	pricingProvider *pricing.Provider
+}
+
+func NewController(kubeClient client.Client, pricingProvider *pricing.Provider) *Controller {
+	return &Controller{
+		kubeClient:      kubeClient,
+		pricingProvider: pricingProvider,
+	}
+}
+
+func (c *Controller) Reconcile(ctx context.Context) (reconcile.Result, error) {
+	ctx = injection.WithControllerName(ctx, "nodeclaim.costestimate")
+
+	nodeClaimList := &karpv1.NodeClaimList{}
+	if err := c.kubeClient.List(ctx, nodeClaimList); err != nil {
+		return reconcile.Result{}, fmt.Errorf("listing NodeClaims for cost estimates: %w", err)
+	}
+	var errs error
+	costs := map[string]float64{}
+	for i := range nodeClaimList.Items {
+		nodeClaim := &nodeClaimList.Items[i]
+		if !nodeClaim.DeletionTimestamp.IsZero() || nodeClaim.Status.ProviderID == "" {
+			continue
+		}
+		sku, capacityType, price, ok := c.estimate(nodeClaim)
+		if !ok {
+			continue
+		}
+		costs[nodeClaim.Labels[karpv1.NodePoolLabelKey]] += price
+		if err := c.annotate(ctx, nodeClaim, pricing.CostEstimateAnnotations(sku, capacityType, price)); err != nil {
+			errs = multierr.Append(errs, err)
+		}
+	}
+
+	metrics.NodePoolEstimatedHourlyCost.Reset()
+	for nodePool, cost := range costs {
+		metrics.NodePoolEstimatedHourlyCost.WithLabelValues(nodePool).Set(cost)
+	}
+	return reconcile.Result{RequeueAfter: refreshInterval}, errs
+}
+
+// estimate returns the SKU and capacity type of the VM of the nodeclaim, and its current estimated hourly cost. The
+// on-demand prices don't change for a VM in practice, so the price it was annotated with is kept, while the spot price
+// is the current one of its zone. The price annotated is kept when there is no current price.
+func (c *Controller) estimate(nodeClaim *karpv1.NodeClaim) (string, string, float64, bool) {
+	sku := lo.CoalesceOrEmpty(nodeClaim.Annotations[v1beta1.AnnotationEstimatedHourlyCostSKU], nodeClaim.Labels[corev1.LabelInstanceTypeStable])
+	capacityType := lo.CoalesceOrEmpty(nodeClaim.Annotations[v1beta1.AnnotationEstimatedHourlyCostCapacityType], nodeClaim.Labels[karpv1.CapacityTypeLabelKey])
+	if sku == "" || capacityType == "" {
+		return "", "", 0, false
+	}
+	annotatedPrice, err := strconv.ParseFloat(nodeClaim.Annotations[v1beta1.AnnotationEstimatedHourlyCost], 64)
+	annotated := err == nil
+	if annotated && capacityType != karpv1.CapacityTypeSpot {
+		return sku, capacityType, annotatedPrice, true
+	}
+
+	var price float64
+	var ok bool
+	if capacityType == karpv1.CapacityTypeSpot {
+		// the zone is a logical zone of the subscription of the VM, which may not be the cluster's
+		var subscriptionID string
+		if id, err := arm.ParseResourceID(strings.TrimPrefix(nodeClaim.Status.ProviderID, "azure://")); err == nil {
+			subscriptionID = id.SubscriptionID
+		}
+		price, ok = c.pricingProvider.SubscriptionZonalSpotPrice(subscriptionID, sku, nodeClaim.Labels[corev1.LabelTopologyZone])
+	} else {
+		price, ok = c.pricingProvider.OnDemandPrice(sku)
+	}
+	if !ok {
+		return sku, capacityType, annotatedPrice, annotated
+	}
+	return sku, capacityType, price, true
+}
+
+// annotate sets the cost estimate annotations on the nodeclaim and its node. Karpenter copies the annotations of the
+// nodeclaim to its node on registration only, so refreshed estimates are set on the node as well.
+func (c *Controller) annotate(ctx context.Context, nodeClaim *karpv1.NodeClaim, annotations map[string]string) error {
+	if !hasAnnotations(nodeClaim.Annotations, annotations) {
+		stored := nodeClaim.DeepCopy()
+		nodeClaim.Annotations = lo.Assign(nodeClaim.Annotations, annotations)
+		if err := c.kubeClient.Patch(ctx, nodeClaim, client.MergeFrom(stored)); client.IgnoreNotFound(err) != nil {
+			return fmt.Errorf("annotating NodeClaim %q with cost estimate: %w", nodeClaim.Name, err)
+		}
+	}
+	if nodeClaim.Status.NodeName == "" {
+		return nil
+	}
+	node := &corev1.Node{}
+	if err := c.kubeClient.Get(ctx, client.ObjectKey{Name: nodeClaim.Status.NodeName}, node); err != nil {
+		return client.IgnoreNotFound(err)
+	}
+	if hasAnnotations(node.Annotations, annotations) {
+		return nil
+	}
+	stored := node.DeepCopy()
+	node.Annotations = lo.Assign(node.Annotations, annotations)
+	if err := c.kubeClient.Patch(ctx, node, client.MergeFrom(stored)); client.IgnoreNotFound(err) != nil {
+		return fmt.Errorf("annotating Node %q with cost estimate: %w", node.Name, err)
+	}
+	return nil
+}
+
+func hasAnnotations(annotations, expected map[string]string) bool {
+	return maps.Equal(expected, lo.PickByKeys(annotations, lo.Keys(expected)))
+}
+
+func (c *Controller) Register(_ context.Context, m manager.Manager) error {
+	return controllerruntime.NewControllerManagedBy(m).
+		Named("nodeclaim.costestimate").
+		WatchesRawSource(singleton.Source()).
+		Complete(singleton.AsReconciler(c))
+}
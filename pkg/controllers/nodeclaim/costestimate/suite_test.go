@@ -0,0 +1,149 @@
+/*
+Portions Copyright (c) Microsoft Corporation.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package costestimate_test
+
+import (
+	"context"
+	"testing"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	karpv1 "sigs.k8s.io/karpenter/pkg/apis/v1"
+	coreoptions "sigs.k8s.io/karpenter/pkg/operator/options"
+	coretest "sigs.k8s.io/karpenter/pkg/test"
+	. "sigs.k8s.io/karpenter/pkg/test/expectations"
+	"sigs.k8s.io/karpenter/pkg/test/v1alpha1"
+	. "sigs.k8s.io/karpenter/pkg/utils/testing"
+
+	"github.com/Azure/karpenter-provider-azure/pkg/apis"
+	"github.com/Azure/karpenter-provider-azure/pkg/apis/v1beta1"
+	"github.com/Azure/karpenter-provider-azure/pkg/controllers/nodeclaim/costestimate"
+	"github.com/Azure/karpenter-provider-azure/pkg/metrics"
+	"github.com/Azure/karpenter-provider-azure/pkg/operator/options"
+	"github.com/Azure/karpenter-provider-azure/pkg/providers/pricing"
+	"github.com/Azure/karpenter-provider-azure/pkg/test"
+)
+
+var ctx context.Context
+var env *coretest.Environment
+var azureEnv *test.Environment
+var costEstimateController *costestimate.Controller
+
+func TestCostEstimate(t *testing.T) {
+	ctx = TestContextWithLogger(t)
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Controllers/CostEstimate")
+}
+
+var _ = BeforeSuite(func() {
+	ctx = coreoptions.ToContext(ctx, coretest.Options())
+	ctx = options.ToContext(ctx, test.Options())
+	env = coretest.NewEnvironment(coretest.WithCRDs(apis.CRDs...), coretest.WithCRDs(v1alpha1.CRDs...))
+	azureEnv = test.NewEnvironment(ctx, env)
+	costEstimateController = costestimate.NewController(env.Client, azureEnv.PricingProvider)
+})
+
+var _ = AfterSuite(func() {
+	Expect(env.Stop()).To(Succeed(), "Failed to stop environment")
+})
+
+var _ = Describe("Cost Estimate", func() {
+	const sku = "Standard_D2_v2"
+	const zone = "southcentralus-1"
+	var nodeClaim *karpv1.NodeClaim
+	var node *corev1.Node
+
+	BeforeEach(func() {
+		azureEnv.Reset()
+		node = coretest.Node()
+		nodeClaim = coretest.NodeClaim(karpv1.NodeClaim{
+			ObjectMeta: metav1.ObjectMeta{
+				Labels: map[string]string{
+					karpv1.NodePoolLabelKey:        "default",
+					corev1.LabelInstanceTypeStable: sku,
+					corev1.LabelTopologyZone:       zone,
+					karpv1.CapacityTypeLabelKey:    karpv1.CapacityTypeSpot,
+				},
+				Annotations: pricing.CostEstimateAnnotations(sku, karpv1.CapacityTypeSpot, 0.5),
+			},
+			Status: karpv1.NodeClaimStatus{
+				ProviderID: coretest.RandomProviderID(),
+				NodeName:   node.Name,
+			},
+		})
+	})
+
+	AfterEach(func() {
+		ExpectCleanedUp(ctx, env.Client)
+	})
+
+	It("should refresh the spot price of the nodeclaim and its node", func() {
+		azureEnv.PricingProvider.UpdateZonalSpotPricing(ctx, map[string]map[string]float64{sku: {zone: 0.25}})
+		ExpectApplied(ctx, env.Client, nodeClaim, node)
+
+		ExpectSingletonReconciled(ctx, costEstimateController)
+
+		expected := pricing.CostEstimateAnnotations(sku, karpv1.CapacityTypeSpot, 0.25)
+		for key, value := range expected {
+			Expect(ExpectExists(ctx, env.Client, nodeClaim).Annotations).To(HaveKeyWithValue(key, value))
+			Expect(ExpectExists(ctx, env.Client, node).Annotations).To(HaveKeyWithValue(key, value))
+		}
+		Expect(testutil.ToFloat64(metrics.NodePoolEstimatedHourlyCost.WithLabelValues("default"))).To(Equal(0.25))
+	})
+	It("should keep the price of an on-demand nodeclaim", func() {
+		nodeClaim.Labels[karpv1.CapacityTypeLabelKey] = karpv1.CapacityTypeOnDemand
+		nodeClaim.Annotations = pricing.CostEstimateAnnotations(sku, karpv1.CapacityTypeOnDemand, 0.5)
+		ExpectApplied(ctx, env.Client, nodeClaim, node)
+
+		ExpectSingletonReconciled(ctx, costEstimateController)
+
+		Expect(ExpectExists(ctx, env.Client, nodeClaim).Annotations).To(HaveKeyWithValue(v1beta1.AnnotationEstimatedHourlyCost, "0.5"))
+		Expect(ExpectExists(ctx, env.Client, node).Annotations).To(HaveKeyWithValue(v1beta1.AnnotationEstimatedHourlyCost, "0.5"))
+		Expect(testutil.ToFloat64(metrics.NodePoolEstimatedHourlyCost.WithLabelValues("default"))).To(Equal(0.5))
+	})
+	It("should annotate a nodeclaim launched without an estimate from its labels", func() {
+		nodeClaim.Labels[karpv1.CapacityTypeLabelKey] = karpv1.CapacityTypeOnDemand
+		nodeClaim.Annotations = nil
+		ExpectApplied(ctx, env.Client, nodeClaim, node)
+
+		ExpectSingletonReconciled(ctx, costEstimateController)
+
+		price, ok := azureEnv.PricingProvider.OnDemandPrice(sku)
+		Expect(ok).To(BeTrue())
+		for key, value := range pricing.CostEstimateAnnotations(sku, karpv1.CapacityTypeOnDemand, price) {
+			Expect(ExpectExists(ctx, env.Client, nodeClaim).Annotations).To(HaveKeyWithValue(key, value))
+		}
+	})
+	It("should sum the estimates of the nodeclaims of a nodepool", func() {
+		azureEnv.PricingProvider.UpdateZonalSpotPricing(ctx, map[string]map[string]float64{sku: {zone: 0.25}})
+		otherNodeClaim := coretest.NodeClaim(karpv1.NodeClaim{
+			ObjectMeta: metav1.ObjectMeta{
+				Labels:      nodeClaim.Labels,
+				Annotations: pricing.CostEstimateAnnotations(sku, karpv1.CapacityTypeSpot, 0.5),
+			},
+			Status: karpv1.NodeClaimStatus{ProviderID: coretest.RandomProviderID()},
+		})
+		ExpectApplied(ctx, env.Client, nodeClaim, otherNodeClaim, node)
+
+		ExpectSingletonReconciled(ctx, costEstimateController)
+
+		Expect(testutil.ToFloat64(metrics.NodePoolEstimatedHourlyCost.WithLabelValues("default"))).To(Equal(0.5))
+	})
+})
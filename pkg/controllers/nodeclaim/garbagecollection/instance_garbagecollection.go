@@ -38,19 +38,25 @@ import (
 	karpv1 "sigs.k8s.io/karpenter/pkg/apis/v1"
 
 	corecloudprovider "sigs.k8s.io/karpenter/pkg/cloudprovider"
+
+	"github.com/Azure/karpenter-provider-azure/pkg/providers/instance"
+	nodeclaimutils "github.com/Azure/karpenter-provider-azure/pkg/utils/nodeclaim"
+	armopts "github.com/Azure/karpenter-provider-azure/pkg/utils/opts"
 )
 
 type VirtualMachine struct {
-	kubeClient      client.Client
-	cloudProvider   corecloudprovider.CloudProvider
-	successfulCount uint64 // keeps track of successful reconciles for more aggressive requeuing near the start of the controller
+	kubeClient         client.Client
+	cloudProvider      corecloudprovider.CloudProvider
+	vmInstanceProvider instance.VMProvider
+	successfulCount    uint64 // keeps track of successful reconciles for more aggressive requeuing near the start of the controller
 }
 
-func NewVirtualMachine(kubeClient client.Client, cloudProvider corecloudprovider.CloudProvider) *VirtualMachine {
+func NewVirtualMachine(kubeClient client.Client, cloudProvider corecloudprovider.CloudProvider, vmInstanceProvider instance.VMProvider) *VirtualMachine {
 	return &VirtualMachine{
-		kubeClient:      kubeClient,
-		cloudProvider:   cloudProvider,
-		successfulCount: 0,
+		kubeClient:         kubeClient,
+		cloudProvider:      cloudProvider,
+		vmInstanceProvider: vmInstanceProvider,
+		successfulCount:    0,
 	}
 }
 
@@ -90,11 +96,26 @@ func (c *VirtualMachine) Reconcile(ctx context.Context) (reconcile.Result, error
 		return reconcile.Result{}, err
 	}
 	c.successfulCount++
-	return reconcile.Result{RequeueAfter: lo.Ternary(c.successfulCount <= 20, time.Second*10, time.Minute*2)}, nil
+	// garbage collection can wait while the ARM request budget is low, leaving it to provisioning
+	return reconcile.Result{RequeueAfter: armopts.RateLimits.BackgroundInterval(lo.Ternary(c.successfulCount <= 20, time.Second*10, time.Minute*2))}, nil
 }
 
 func (c *VirtualMachine) garbageCollect(ctx context.Context, nodeClaim *karpv1.NodeClaim, nodeList *v1.NodeList) error {
 	ctx = log.IntoContext(ctx, log.FromContext(ctx).WithValues("providerID", nodeClaim.Status.ProviderID))
+	// VMs are listed by their tags, which other automation may have copied onto VMs Karpenter didn't create, so the VM
+	// must be confirmed as managed before being deleted. Near-matches are only logged, for auditing.
+	vmName, err := nodeclaimutils.GetVMName(nodeClaim.Status.ProviderID)
+	if err != nil {
+		return err
+	}
+	vm, err := c.vmInstanceProvider.Get(ctx, vmName)
+	if err != nil {
+		return corecloudprovider.IgnoreNodeClaimNotFoundError(err)
+	}
+	if reason := instance.UnconfirmedManagedVMReason(ctx, vm); reason != "" {
+		log.FromContext(ctx).Info("skipping garbage collection of VM not confirmed as managed", "vmName", vmName, "reason", reason)
+		return nil
+	}
 	if err := c.cloudProvider.Delete(ctx, nodeClaim); err != nil {
 		return corecloudprovider.IgnoreNodeClaimNotFoundError(err)
 	}
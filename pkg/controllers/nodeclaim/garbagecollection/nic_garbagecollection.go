@@ -35,6 +35,7 @@ import (
 	"sigs.k8s.io/karpenter/pkg/operator/injection"
 
 	"github.com/Azure/karpenter-provider-azure/pkg/providers/instance"
+	armopts "github.com/Azure/karpenter-provider-azure/pkg/utils/opts"
 )
 
 const (
@@ -89,6 +90,10 @@ func (c *NetworkInterface) Reconcile(ctx context.Context) (reconcile.Result, err
 	}
 	workqueue.ParallelizeUntil(ctx, 100, len(nics), func(i int) {
 		nicName := lo.FromPtr(nics[i].Name)
+		// NICs attached to a VM, e.g. one not listed as the cluster's, are left for the deletion of their VM
+		if nics[i].Properties != nil && nics[i].Properties.VirtualMachine != nil {
+			return
+		}
 		if !unremovableInterfaces.Has(nicName) {
 			err := c.vmInstanceProvider.DeleteNic(ctx, nicName)
 			if err != nil {
@@ -100,7 +105,7 @@ func (c *NetworkInterface) Reconcile(ctx context.Context) (reconcile.Result, err
 		}
 	})
 	return reconcile.Result{
-		RequeueAfter: NicGarbageCollectionInterval,
+		RequeueAfter: armopts.RateLimits.BackgroundInterval(NicGarbageCollectionInterval),
 	}, nil
 }
 
@@ -27,6 +27,7 @@ import (
 	"github.com/awslabs/operatorpkg/object"
 
 	"github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/compute/armcompute/v7"
+	"github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/network/armnetwork"
 	"github.com/Azure/karpenter-provider-azure/pkg/apis"
 	"github.com/Azure/karpenter-provider-azure/pkg/apis/v1beta1"
 	"github.com/Azure/karpenter-provider-azure/pkg/cloudprovider"
@@ -82,7 +83,7 @@ var _ = BeforeSuite(func() {
 	//	ctx, stop = context.WithCancel(ctx)
 	azureEnv = test.NewEnvironment(ctx, env)
 	cloudProvider = cloudprovider.New(azureEnv.InstanceTypesProvider, azureEnv.VMInstanceProvider, events.NewRecorder(&record.FakeRecorder{}), env.Client, azureEnv.ImageProvider)
-	virtualMachineGCController = garbagecollection.NewVirtualMachine(env.Client, cloudProvider)
+	virtualMachineGCController = garbagecollection.NewVirtualMachine(env.Client, cloudProvider, azureEnv.VMInstanceProvider)
 	networkInterfaceGCController = garbagecollection.NewNetworkInterface(env.Client, azureEnv.VMInstanceProvider)
 	fakeClock = &clock.FakeClock{}
 	cluster = state.NewCluster(fakeClock, env.Client, cloudProvider)
@@ -156,6 +157,17 @@ var _ = Describe("VirtualMachine Garbage Collection", func() {
 			_, err := cloudProvider.Get(ctx, providerID)
 			Expect(err).NotTo(HaveOccurred())
 		})
+		It("should not delete an instance of another cluster", func() {
+			vm.Properties = &armcompute.VirtualMachineProperties{
+				TimeCreated: lo.ToPtr(time.Now().Add(-time.Minute * 10)),
+			}
+			vm.Tags[launchtemplate.KarpenterManagedTagKey] = lo.ToPtr("other-cluster")
+			azureEnv.VirtualMachinesAPI.Instances.Store(lo.FromPtr(vm.ID), *vm)
+
+			ExpectSingletonReconciled(ctx, virtualMachineGCController)
+			_, err := cloudProvider.Get(ctx, providerID)
+			Expect(err).NotTo(HaveOccurred())
+		})
 		It("should delete many instances if they all don't have NodeClaim owners", func() {
 			// Generate 100 instances that have different vmIDs
 			var ids []string
@@ -171,7 +183,7 @@ var _ = Describe("VirtualMachine Garbage Collection", func() {
 					providerID = utils.VMResourceIDToProviderID(ctx, *vm.ID)
 					newVM := test.VirtualMachine(test.VirtualMachineOptions{
 						Name:         vmName,
-						NodepoolName: "default",
+						NodepoolName: nodePool.Name,
 						Properties: &armcompute.VirtualMachineProperties{
 							TimeCreated: lo.ToPtr(time.Now().Add(-time.Minute * 10)),
 						},
@@ -212,7 +224,7 @@ var _ = Describe("VirtualMachine Garbage Collection", func() {
 					providerID = utils.VMResourceIDToProviderID(ctx, *vm.ID)
 					newVM := test.VirtualMachine(test.VirtualMachineOptions{
 						Name:         vmName,
-						NodepoolName: "default",
+						NodepoolName: nodePool.Name,
 						Properties: &armcompute.VirtualMachineProperties{
 							TimeCreated: lo.ToPtr(time.Now().Add(-time.Minute * 10)),
 						},
@@ -280,7 +292,7 @@ var _ = Describe("VirtualMachine Garbage Collection", func() {
 
 	var _ = Context("Basic", func() {
 		BeforeEach(func() {
-			vm = test.VirtualMachine(test.VirtualMachineOptions{Name: "vm-a", NodepoolName: "default"})
+			vm = test.VirtualMachine(test.VirtualMachineOptions{Name: "aks-default-a1b2c", NodepoolName: "default"})
 			providerID = utils.VMResourceIDToProviderID(ctx, lo.FromPtr(vm.ID))
 		})
 		It("should delete an instance if there is no NodeClaim owner", func() {
@@ -313,6 +325,50 @@ var _ = Describe("VirtualMachine Garbage Collection", func() {
 
 			ExpectNotFound(ctx, env.Client, node)
 		})
+		It("should not delete an instance with the managed tags, but a name Karpenter doesn't generate", func() {
+			lookAlike := test.VirtualMachine(test.VirtualMachineOptions{
+				Name:         "legacy-vm-01",
+				NodepoolName: "default",
+				Properties: &armcompute.VirtualMachineProperties{
+					TimeCreated: lo.ToPtr(time.Now().Add(-time.Minute * 10)),
+				},
+			})
+			azureEnv.VirtualMachinesAPI.Instances.Store(lo.FromPtr(lookAlike.ID), *lookAlike)
+
+			ExpectSingletonReconciled(ctx, virtualMachineGCController)
+			_, err = cloudProvider.Get(ctx, utils.VMResourceIDToProviderID(ctx, lo.FromPtr(lookAlike.ID)))
+			Expect(err).NotTo(HaveOccurred())
+		})
+		It("should not delete an instance with a name Karpenter generates, but the nodepool tag of another nodepool", func() {
+			vm.Properties = &armcompute.VirtualMachineProperties{
+				TimeCreated: lo.ToPtr(time.Now().Add(-time.Minute * 10)),
+			}
+			vm.Tags[launchtemplate.NodePoolTagKey] = lo.ToPtr("other-nodepool")
+			azureEnv.VirtualMachinesAPI.Instances.Store(lo.FromPtr(vm.ID), *vm)
+
+			ExpectSingletonReconciled(ctx, virtualMachineGCController)
+			_, err = cloudProvider.Get(ctx, providerID)
+			Expect(err).NotTo(HaveOccurred())
+		})
+		It("should only delete an instance with the confirmation tag, when configured", func() {
+			confirmationCtx := options.ToContext(ctx, test.Options(test.OptionsFields{GarbageCollectionConfirmationTag: lo.ToPtr("owner=karpenter")}))
+			vm.Properties = &armcompute.VirtualMachineProperties{
+				TimeCreated: lo.ToPtr(time.Now().Add(-time.Minute * 10)),
+			}
+			azureEnv.VirtualMachinesAPI.Instances.Store(lo.FromPtr(vm.ID), *vm)
+
+			ExpectSingletonReconciled(confirmationCtx, virtualMachineGCController)
+			_, err = cloudProvider.Get(ctx, providerID)
+			Expect(err).NotTo(HaveOccurred())
+
+			vm.Tags["owner"] = lo.ToPtr("karpenter")
+			azureEnv.VirtualMachinesAPI.Instances.Store(lo.FromPtr(vm.ID), *vm)
+
+			ExpectSingletonReconciled(confirmationCtx, virtualMachineGCController)
+			_, err = cloudProvider.Get(ctx, providerID)
+			Expect(err).To(HaveOccurred())
+			Expect(corecloudprovider.IsNodeClaimNotFoundError(err)).To(BeTrue())
+		})
 	})
 })
 
@@ -374,6 +430,20 @@ var _ = Describe("NetworkInterface Garbage Collection", func() {
 		Expect(len(nicsAfterGC)).To(Equal(1))
 
 	})
+	It("should not delete a NIC attached to a VM that isn't listed", func() {
+		attachedNic := test.Interface(test.InterfaceOptions{
+			NodepoolName: nodePool.Name,
+			Properties: &armnetwork.InterfacePropertiesFormat{
+				VirtualMachine: &armnetwork.SubResource{ID: lo.ToPtr("/subscriptions/12345678-1234-1234-1234-123456789012/resourceGroups/test-resourceGroup/providers/Microsoft.Compute/virtualMachines/unlisted-vm")},
+			},
+		})
+		azureEnv.NetworkInterfacesAPI.NetworkInterfaces.Store(lo.FromPtr(attachedNic.ID), *attachedNic)
+		ExpectSingletonReconciled(ctx, networkInterfaceGCController)
+		nicsAfterGC, err := azureEnv.VMInstanceProvider.ListNics(ctx)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(len(nicsAfterGC)).To(Equal(1))
+		Expect(azureEnv.NetworkInterfacesAPI.NetworkInterfacesDeleteBehavior.CalledWithInput.Len()).To(Equal(0))
+	})
 	It("the vm gc controller should handle deletion of network interfaces if a nic is associated with a vm", func() {
 		managedNic := test.Interface(test.InterfaceOptions{
 			NodepoolName: nodePool.Name,
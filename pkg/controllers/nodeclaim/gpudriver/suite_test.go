@@ -0,0 +1,124 @@
+/*
+Portions Copyright (c) Microsoft Corporation.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package gpudriver_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/samber/lo"
+	corev1 "k8s.io/api/core/v1"
+	clock "k8s.io/utils/clock/testing"
+	karpv1 "sigs.k8s.io/karpenter/pkg/apis/v1"
+	coreoptions "sigs.k8s.io/karpenter/pkg/operator/options"
+	coretest "sigs.k8s.io/karpenter/pkg/test"
+	. "sigs.k8s.io/karpenter/pkg/test/expectations"
+	"sigs.k8s.io/karpenter/pkg/test/v1alpha1"
+	. "sigs.k8s.io/karpenter/pkg/utils/testing"
+
+	"github.com/Azure/karpenter-provider-azure/pkg/apis"
+	"github.com/Azure/karpenter-provider-azure/pkg/apis/v1beta1"
+	"github.com/Azure/karpenter-provider-azure/pkg/controllers/nodeclaim/gpudriver"
+	"github.com/Azure/karpenter-provider-azure/pkg/operator/options"
+	"github.com/Azure/karpenter-provider-azure/pkg/test"
+)
+
+var ctx context.Context
+var env *coretest.Environment
+var fakeClock *clock.FakeClock
+var recorder *coretest.EventRecorder
+var gpuDriverController *gpudriver.Controller
+
+func TestGPUDriver(t *testing.T) {
+	ctx = TestContextWithLogger(t)
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Controllers/GPUDriver")
+}
+
+var _ = BeforeSuite(func() {
+	ctx = coreoptions.ToContext(ctx, coretest.Options())
+	ctx = options.ToContext(ctx, test.Options(test.OptionsFields{GPUDriverReadyTimeout: lo.ToPtr(15 * time.Minute)}))
+	env = coretest.NewEnvironment(coretest.WithCRDs(apis.CRDs...), coretest.WithCRDs(v1alpha1.CRDs...))
+	fakeClock = clock.NewFakeClock(time.Now())
+	recorder = coretest.NewEventRecorder()
+	gpuDriverController = gpudriver.NewController(env.Client, nil, recorder, fakeClock)
+})
+
+var _ = AfterSuite(func() {
+	Expect(env.Stop()).To(Succeed(), "Failed to stop environment")
+})
+
+var _ = Describe("GPU Driver", func() {
+	var nodeClaim *karpv1.NodeClaim
+	var node *corev1.Node
+
+	BeforeEach(func() {
+		fakeClock.SetTime(time.Now())
+		recorder.Reset()
+		node = coretest.Node(coretest.NodeOptions{
+			Taints: []corev1.Taint{v1beta1.GPUInitializingTaint},
+		})
+		nodeClaim = coretest.NodeClaim(karpv1.NodeClaim{
+			Status: karpv1.NodeClaimStatus{
+				NodeName: node.Name,
+			},
+		})
+	})
+
+	AfterEach(func() {
+		ExpectCleanedUp(ctx, env.Client)
+	})
+
+	It("should remove the GPU initializing taint once the GPU driver is ready", func() {
+		node.Status.Conditions = []corev1.NodeCondition{{Type: v1beta1.NodeConditionTypeGPUDriverReady, Status: corev1.ConditionTrue}}
+		ExpectApplied(ctx, env.Client, nodeClaim, node)
+		ExpectObjectReconciled(ctx, env.Client, gpuDriverController, nodeClaim)
+
+		node = ExpectExists(ctx, env.Client, node)
+		Expect(node.Spec.Taints).ToNot(ContainElement(v1beta1.GPUInitializingTaint))
+		ExpectExists(ctx, env.Client, nodeClaim)
+	})
+	It("should wait for the GPU driver within the timeout", func() {
+		ExpectApplied(ctx, env.Client, nodeClaim, node)
+		result := ExpectObjectReconciled(ctx, env.Client, gpuDriverController, nodeClaim)
+
+		Expect(result.RequeueAfter).ToNot(BeZero())
+		node = ExpectExists(ctx, env.Client, node)
+		Expect(node.Spec.Taints).To(ContainElement(v1beta1.GPUInitializingTaint))
+		ExpectExists(ctx, env.Client, nodeClaim)
+	})
+	It("should delete the nodeclaim once the GPU driver isn't ready within the timeout", func() {
+		ExpectApplied(ctx, env.Client, nodeClaim, node)
+		fakeClock.Step(16 * time.Minute)
+		ExpectObjectReconciled(ctx, env.Client, gpuDriverController, nodeClaim)
+
+		ExpectNotFound(ctx, env.Client, nodeClaim)
+		Expect(recorder.Calls("GPUDriverNotReady")).To(Equal(1))
+	})
+	It("should not affect nodes without the GPU initializing taint", func() {
+		node.Spec.Taints = nil
+		ExpectApplied(ctx, env.Client, nodeClaim, node)
+		fakeClock.Step(16 * time.Minute)
+		ExpectObjectReconciled(ctx, env.Client, gpuDriverController, nodeClaim)
+
+		ExpectExists(ctx, env.Client, nodeClaim)
+		Expect(recorder.Calls("GPUDriverNotReady")).To(BeZero())
+	})
+})
@@ -30,6 +30,7 @@ import (
 	"github.com/Azure/karpenter-provider-azure/pkg/operator/options"
 	"github.com/Azure/karpenter-provider-azure/pkg/providers/instance"
 	"github.com/Azure/karpenter-provider-azure/pkg/providers/launchtemplate"
+	"github.com/Azure/karpenter-provider-azure/pkg/utils"
 )
 
 func logVMPatch(ctx context.Context, update *armcompute.VirtualMachineUpdate) {
@@ -87,7 +88,7 @@ func patchVMIdentities(
 	params *patchParameters,
 	currentVM *armcompute.VirtualMachine,
 ) bool {
-	expectedIdentities := params.opts.NodeIdentities
+	expectedIdentities := utils.GetNodeIdentities(params.nodeClass, params.opts.NodeIdentities)
 	var currentIdentities []string
 	if currentVM.Identity != nil {
 		currentIdentities = lo.Keys(currentVM.Identity.UserAssignedIdentities)
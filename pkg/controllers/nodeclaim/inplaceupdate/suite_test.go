@@ -38,6 +38,7 @@ import (
 	"github.com/Azure/karpenter-provider-azure/pkg/controllers/nodeclaim/inplaceupdate"
 	"github.com/Azure/karpenter-provider-azure/pkg/fake"
 	"github.com/Azure/karpenter-provider-azure/pkg/operator/options"
+	"github.com/Azure/karpenter-provider-azure/pkg/providers/launchtemplate"
 	"github.com/Azure/karpenter-provider-azure/pkg/test"
 	. "github.com/Azure/karpenter-provider-azure/pkg/test/expectations"
 	"github.com/Azure/karpenter-provider-azure/pkg/utils"
@@ -100,7 +101,8 @@ var _ = Describe("Unit tests", func() {
 			ID:   lo.ToPtr(fake.MkVMID(azureEnv.AzureResourceGraphAPI.ResourceGroup, vmName)),
 			Name: lo.ToPtr(vmName),
 			Tags: map[string]*string{
-				"karpenter.azure.com_cluster": lo.ToPtr("test-cluster"),
+				"karpenter.azure.com_cluster":  lo.ToPtr("test-cluster"),
+				launchtemplate.NodeClassTagKey: lo.ToPtr(nodeClass.Name),
 			},
 		}
 	})
@@ -438,7 +440,8 @@ var _ = Describe("Unit tests", func() {
 
 		It("should add missing tags from AdditionalTags", func() {
 			currentVM.Tags = map[string]*string{
-				"karpenter.azure.com_cluster": lo.ToPtr("test-cluster"),
+				"karpenter.azure.com_cluster":  lo.ToPtr("test-cluster"),
+				launchtemplate.NodeClassTagKey: lo.ToPtr(nodeClass.Name),
 			}
 
 			options := test.Options()
@@ -449,15 +452,17 @@ var _ = Describe("Unit tests", func() {
 
 			Expect(update).To(Equal(&armcompute.VirtualMachineUpdate{
 				Tags: map[string]*string{
-					"karpenter.azure.com_cluster": lo.ToPtr("test-cluster"), // Should always be included
-					"test-tag":                    lo.ToPtr("my-tag"),
+					"karpenter.azure.com_cluster":  lo.ToPtr("test-cluster"), // Should always be included
+					launchtemplate.NodeClassTagKey: lo.ToPtr(nodeClass.Name),
+					"test-tag":                     lo.ToPtr("my-tag"),
 				},
 			}))
 		})
 
 		It("should add missing tags from NodeClass", func() {
 			currentVM.Tags = map[string]*string{
-				"karpenter.azure.com_cluster": lo.ToPtr("test-cluster"),
+				"karpenter.azure.com_cluster":  lo.ToPtr("test-cluster"),
+				launchtemplate.NodeClassTagKey: lo.ToPtr(nodeClass.Name),
 			}
 
 			options := test.Options()
@@ -468,16 +473,18 @@ var _ = Describe("Unit tests", func() {
 
 			Expect(update).To(Equal(&armcompute.VirtualMachineUpdate{
 				Tags: map[string]*string{
-					"karpenter.azure.com_cluster": lo.ToPtr("test-cluster"), // Should always be included
-					"nodeclass-tag":               lo.ToPtr("nodeclass-value"),
+					"karpenter.azure.com_cluster":  lo.ToPtr("test-cluster"), // Should always be included
+					launchtemplate.NodeClassTagKey: lo.ToPtr(nodeClass.Name),
+					"nodeclass-tag":                lo.ToPtr("nodeclass-value"),
 				},
 			}))
 		})
 
 		It("should add missing tags from NodeClass if conflicting with AdditionalTags", func() {
 			currentVM.Tags = map[string]*string{
-				"karpenter.azure.com_cluster": lo.ToPtr("test-cluster"),
-				"test-tag":                    lo.ToPtr("my-tag"),
+				"karpenter.azure.com_cluster":  lo.ToPtr("test-cluster"),
+				launchtemplate.NodeClassTagKey: lo.ToPtr(nodeClass.Name),
+				"test-tag":                     lo.ToPtr("my-tag"),
 			}
 
 			options := test.Options()
@@ -491,8 +498,25 @@ var _ = Describe("Unit tests", func() {
 
 			Expect(update).To(Equal(&armcompute.VirtualMachineUpdate{
 				Tags: map[string]*string{
-					"karpenter.azure.com_cluster": lo.ToPtr("test-cluster"), // Should always be included
-					"test-tag":                    lo.ToPtr("nodeclass-value"),
+					"karpenter.azure.com_cluster":  lo.ToPtr("test-cluster"), // Should always be included
+					launchtemplate.NodeClassTagKey: lo.ToPtr(nodeClass.Name),
+					"test-tag":                     lo.ToPtr("nodeclass-value"),
+				},
+			}))
+		})
+
+		It("should add the missing nodeclass tag", func() {
+			currentVM.Tags = map[string]*string{
+				"karpenter.azure.com_cluster": lo.ToPtr("test-cluster"),
+			}
+
+			options := test.Options()
+			update := inplaceupdate.CalculateVMPatch(options, nodeClaim, nodeClass, currentVM)
+
+			Expect(update).To(Equal(&armcompute.VirtualMachineUpdate{
+				Tags: map[string]*string{
+					"karpenter.azure.com_cluster":  lo.ToPtr("test-cluster"),
+					launchtemplate.NodeClassTagKey: lo.ToPtr(nodeClass.Name),
 				},
 			}))
 		})
@@ -500,8 +524,9 @@ var _ = Describe("Unit tests", func() {
 		// NOTE: It is expected that this will remove manually added user tags as well
 		It("should remove unneeded tags", func() {
 			currentVM.Tags = map[string]*string{
-				"karpenter.azure.com_cluster": lo.ToPtr("test-cluster"),
-				"test-tag":                    lo.ToPtr("my-tag"),
+				"karpenter.azure.com_cluster":  lo.ToPtr("test-cluster"),
+				launchtemplate.NodeClassTagKey: lo.ToPtr(nodeClass.Name),
+				"test-tag":                     lo.ToPtr("my-tag"),
 			}
 
 			options := test.Options()
@@ -509,7 +534,8 @@ var _ = Describe("Unit tests", func() {
 
 			Expect(update).To(Equal(&armcompute.VirtualMachineUpdate{
 				Tags: map[string]*string{
-					"karpenter.azure.com_cluster": lo.ToPtr("test-cluster"), // Should always be included
+					"karpenter.azure.com_cluster":  lo.ToPtr("test-cluster"), // Should always be included
+					launchtemplate.NodeClassTagKey: lo.ToPtr(nodeClass.Name),
 				},
 			}))
 		})
@@ -527,37 +553,41 @@ var _ = Describe("In Place Update Controller", func() {
 
 	BeforeEach(func() {
 		vmName = "vm-a"
+		// Create a test AKSNodeClass that the NodeClaim can reference
+		nodeClass = test.AKSNodeClass()
 		vm = &armcompute.VirtualMachine{
 			ID:   lo.ToPtr(fake.MkVMID(azureEnv.AzureResourceGraphAPI.ResourceGroup, vmName)),
 			Name: lo.ToPtr(vmName),
 			Tags: map[string]*string{
-				"karpenter.azure.com_cluster": lo.ToPtr("test-cluster"),
+				"karpenter.azure.com_cluster":  lo.ToPtr("test-cluster"),
+				launchtemplate.NodeClassTagKey: lo.ToPtr(nodeClass.Name),
 			},
 		}
 		nic = &armnetwork.Interface{
 			ID:   lo.ToPtr(fake.MakeNetworkInterfaceID(azureEnv.AzureResourceGraphAPI.ResourceGroup, vmName)),
 			Name: lo.ToPtr(vmName),
 			Tags: map[string]*string{
-				"karpenter.azure.com_cluster": lo.ToPtr("test-cluster"),
+				"karpenter.azure.com_cluster":  lo.ToPtr("test-cluster"),
+				launchtemplate.NodeClassTagKey: lo.ToPtr(nodeClass.Name),
 			},
 		}
 		billingExt = &armcompute.VirtualMachineExtension{
 			ID:   lo.ToPtr(fake.MakeVMExtensionID(azureEnv.AzureResourceGraphAPI.ResourceGroup, vmName, "computeAksLinuxBilling")),
 			Name: lo.ToPtr("computeAksLinuxBilling"),
 			Tags: map[string]*string{
-				"karpenter.azure.com_cluster": lo.ToPtr("test-cluster"),
+				"karpenter.azure.com_cluster":  lo.ToPtr("test-cluster"),
+				launchtemplate.NodeClassTagKey: lo.ToPtr(nodeClass.Name),
 			},
 		}
 		cseExt = &armcompute.VirtualMachineExtension{
 			ID:   lo.ToPtr(fake.MakeVMExtensionID(azureEnv.AzureResourceGraphAPI.ResourceGroup, vmName, "cse-agent-karpenter")),
 			Name: lo.ToPtr("cse-agent-karpenter"),
 			Tags: map[string]*string{
-				"karpenter.azure.com_cluster": lo.ToPtr("test-cluster"),
+				"karpenter.azure.com_cluster":  lo.ToPtr("test-cluster"),
+				launchtemplate.NodeClassTagKey: lo.ToPtr(nodeClass.Name),
 			},
 		}
 
-		// Create a test AKSNodeClass that the NodeClaim can reference
-		nodeClass = test.AKSNodeClass()
 		nodeClaim = coretest.NodeClaim(karpv1.NodeClaim{
 			Spec: karpv1.NodeClaimSpec{
 				NodeClassRef: &karpv1.NodeClassReference{
@@ -647,7 +677,8 @@ var _ = Describe("In Place Update Controller", func() {
 			Expect(updatedVM.Identity.UserAssignedIdentities).To(HaveKey("/subscriptions/1234/resourceGroups/mcrg/providers/Microsoft.ManagedIdentity/userAssignedIdentities/myid1"))
 			// Expect the tags to remain unchanged
 			Expect(updatedVM.Tags).To(Equal(map[string]*string{
-				"karpenter.azure.com_cluster": lo.ToPtr("test-cluster"),
+				"karpenter.azure.com_cluster":  lo.ToPtr("test-cluster"),
+				launchtemplate.NodeClassTagKey: lo.ToPtr(nodeClass.Name),
 			}))
 
 			nodeClaim = ExpectExists(ctx, env.Client, nodeClaim)
@@ -710,7 +741,8 @@ var _ = Describe("In Place Update Controller", func() {
 			Expect(updatedVM.Identity.UserAssignedIdentities).To(HaveKey("/subscriptions/1234/resourceGroups/mcrg/providers/Microsoft.ManagedIdentity/userAssignedIdentities/myotheridentity"))
 			// Expect the tags to remain unchanged
 			Expect(updatedVM.Tags).To(Equal(map[string]*string{
-				"karpenter.azure.com_cluster": lo.ToPtr("test-cluster"),
+				"karpenter.azure.com_cluster":  lo.ToPtr("test-cluster"),
+				launchtemplate.NodeClassTagKey: lo.ToPtr(nodeClass.Name),
 			}))
 
 			nodeClaim = ExpectExists(ctx, env.Client, nodeClaim)
@@ -747,9 +779,10 @@ var _ = Describe("In Place Update Controller", func() {
 				vmName,
 				azureEnv,
 				map[string]*string{
-					"karpenter.azure.com_cluster": lo.ToPtr("test-cluster"),
-					"nodeclass-tag":               lo.ToPtr("nodeclass-value"),
-					"test-tag":                    lo.ToPtr("my-tag"),
+					"karpenter.azure.com_cluster":  lo.ToPtr("test-cluster"),
+					launchtemplate.NodeClassTagKey: lo.ToPtr(nodeClass.Name),
+					"nodeclass-tag":                lo.ToPtr("nodeclass-value"),
+					"test-tag":                     lo.ToPtr("my-tag"),
 				})
 			Expect(updatedVM).ToNot(Equal(vm))
 			// Expect the identities to remain unchanged
@@ -789,9 +822,10 @@ var _ = Describe("In Place Update Controller", func() {
 
 		It("should clear existing tags on VM", func() {
 			vm.Tags = map[string]*string{
-				"karpenter.azure.com_cluster": lo.ToPtr("test-cluster"),
-				"test-tag":                    lo.ToPtr("my-tag"),
-				"nodeclass-tag":               lo.ToPtr("nodeclass-value"),
+				"karpenter.azure.com_cluster":  lo.ToPtr("test-cluster"),
+				launchtemplate.NodeClassTagKey: lo.ToPtr(nodeClass.Name),
+				"test-tag":                     lo.ToPtr("my-tag"),
+				"nodeclass-tag":                lo.ToPtr("nodeclass-value"),
 			}
 			azureEnv.VirtualMachinesAPI.Instances.Store(lo.FromPtr(vm.ID), *vm)
 			azureEnv.NetworkInterfacesAPI.NetworkInterfaces.Store(lo.FromPtr(nic.ID), *nic)
@@ -811,8 +845,9 @@ var _ = Describe("In Place Update Controller", func() {
 				vmName,
 				azureEnv,
 				map[string]*string{
-					"karpenter.azure.com_cluster": lo.ToPtr("test-cluster"),
-					"nodeclass-tag":               lo.ToPtr("nodeclass-value"),
+					"karpenter.azure.com_cluster":  lo.ToPtr("test-cluster"),
+					launchtemplate.NodeClassTagKey: lo.ToPtr(nodeClass.Name),
+					"nodeclass-tag":                lo.ToPtr("nodeclass-value"),
 					// "test-tag" should be removed
 				})
 			// Expect the identities to remain unchanged
@@ -826,6 +861,8 @@ var _ = Describe("In Place Update Controller", func() {
 		DescribeTable(
 			"should propagate update to tags from NodeClass",
 			func(newTags map[string]string, expectedTags map[string]*string) {
+				// The nodeclass tag is always included, the nodeclass is only known once the entry runs
+				expectedTags = lo.Assign(expectedTags, map[string]*string{launchtemplate.NodeClassTagKey: lo.ToPtr(nodeClass.Name)})
 				azureEnv.VirtualMachinesAPI.Instances.Store(lo.FromPtr(vm.ID), *vm)
 				azureEnv.NetworkInterfacesAPI.NetworkInterfaces.Store(lo.FromPtr(nic.ID), *nic)
 				azureEnv.VirtualMachineExtensionsAPI.Extensions.Store(lo.FromPtr(billingExt.ID), *billingExt)
@@ -909,8 +946,9 @@ var _ = Describe("In Place Update Controller", func() {
 				vmName,
 				azureEnv,
 				map[string]*string{
-					"karpenter.azure.com_cluster": lo.ToPtr("test-cluster"),
-					"nodeclass-tag":               lo.ToPtr("nodeclass-value"),
+					"karpenter.azure.com_cluster":  lo.ToPtr("test-cluster"),
+					launchtemplate.NodeClassTagKey: lo.ToPtr(nodeClass.Name),
+					"nodeclass-tag":                lo.ToPtr("nodeclass-value"),
 				})
 			Expect(updatedVM).ToNot(Equal(vm))
 		})
@@ -26,6 +26,7 @@ import (
 
 	"github.com/Azure/karpenter-provider-azure/pkg/apis/v1beta1"
 	"github.com/Azure/karpenter-provider-azure/pkg/operator/options"
+	"github.com/Azure/karpenter-provider-azure/pkg/utils"
 	"github.com/samber/lo"
 )
 
@@ -59,7 +60,7 @@ func HashFromNodeClaim(options *options.Options, nodeClaim *karpv1.NodeClaim, no
 	}
 
 	hashStruct := &vmInPlaceUpdateFields{
-		Identities: sets.New(options.NodeIdentities...),
+		Identities: sets.New(utils.GetNodeIdentities(nodeClass, options.NodeIdentities)...),
 		Tags:       tags,
 	}
 
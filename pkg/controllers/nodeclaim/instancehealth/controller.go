@@ -0,0 +1,175 @@
+/*
+Portions Copyright (c) Microsoft Corporation.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package instancehealth
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/arm"
+	"github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/network/armnetwork"
+	"github.com/awslabs/operatorpkg/singleton"
+	"github.com/samber/lo"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/util/workqueue"
+	controllerruntime "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/manager"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+	karpv1 "sigs.k8s.io/karpenter/pkg/apis/v1"
+	corecloudprovider "sigs.k8s.io/karpenter/pkg/cloudprovider"
+	"sigs.k8s.io/karpenter/pkg/operator/injection"
+
+	"github.com/Azure/karpenter-provider-azure/pkg/apis/v1beta1"
+	"github.com/Azure/karpenter-provider-azure/pkg/metrics"
+	"github.com/Azure/karpenter-provider-azure/pkg/operator/options"
+	"github.com/Azure/karpenter-provider-azure/pkg/providers/instance"
+	nodeclaimutils "github.com/Azure/karpenter-provider-azure/pkg/utils/nodeclaim"
+	armopts "github.com/Azure/karpenter-provider-azure/pkg/utils/opts"
+)
+
+// Controller periodically evaluates the health of the VMs of the nodes of nodeclaims on the Azure side, from their
+// instance view and the provisioning state of their NICs, and reports it with the InstanceHealthy condition of the
+// nodes. Failures such as a VM agent not responding or a NIC failing to provision after an update never show up as
+// conditions reported by the nodes themselves; the repair policy of the condition has node repair replace the nodes
+// once it's been False long enough.
+type Controller struct {
+	kubeClient         client.Client
+	vmInstanceProvider instance.VMProvider
+}
+
+func NewController(kubeClient client.Client, vmInstanceProvider instance.VMProvider) *Controller {
+	return &Controller{
+		kubeClient:         kubeClient,
+		vmInstanceProvider: vmInstanceProvider,
+	}
+}
+
+func (c *Controller) Reconcile(ctx context.Context) (reconcile.Result, error) {
+	ctx = injection.WithControllerName(ctx, "nodeclaim.instancehealth")
+
+	nodeClaimList := &karpv1.NodeClaimList{}
+	if err := c.kubeClient.List(ctx, nodeClaimList); err != nil {
+		return reconcile.Result{}, fmt.Errorf("listing NodeClaims for instance health: %w", err)
+	}
+	nodeClaims := lo.Filter(nodeClaimList.Items, func(nodeClaim karpv1.NodeClaim, _ int) bool {
+		return nodeClaim.DeletionTimestamp.IsZero() && nodeClaim.Status.NodeName != "" && nodeClaim.Status.ProviderID != ""
+	})
+	// the NICs of the cluster are listed at once, rather than read one by one
+	nics, err := c.vmInstanceProvider.ListNics(ctx)
+	if err != nil {
+		return reconcile.Result{}, fmt.Errorf("listing NICs: %w", err)
+	}
+	nicsByID := lo.SliceToMap(nics, func(nic *armnetwork.Interface) (string, *armnetwork.Interface) {
+		return strings.ToLower(lo.FromPtr(nic.ID)), nic
+	})
+
+	var mu sync.Mutex
+	unhealthy := map[string]int{}
+	workqueue.ParallelizeUntil(ctx, 10, len(nodeClaims), func(i int) {
+		h, err := c.evaluate(ctx, &nodeClaims[i], nicsByID)
+		if err != nil {
+			log.FromContext(ctx).Error(err, "failed to evaluate instance health", "NodeClaim", nodeClaims[i].Name)
+			return
+		}
+		if h != nil && !h.healthy() {
+			mu.Lock()
+			unhealthy[h.reason]++
+			mu.Unlock()
+		}
+	})
+	metrics.InstanceHealthUnhealthyNodes.Reset()
+	for reason, count := range unhealthy {
+		metrics.InstanceHealthUnhealthyNodes.WithLabelValues(reason).Set(float64(count))
+	}
+	return reconcile.Result{RequeueAfter: armopts.RateLimits.BackgroundInterval(options.FromContext(ctx).InstanceHealthInterval)}, nil
+}
+
+// evaluate evaluates the health of the VM of the nodeclaim and reports it on its node. It returns nil if the VM or the
+// node is gone, which garbage collection and the termination of the nodeclaim take care of.
+func (c *Controller) evaluate(ctx context.Context, nodeClaim *karpv1.NodeClaim, nicsByID map[string]*armnetwork.Interface) (*health, error) {
+	vmName, err := nodeclaimutils.GetVMName(nodeClaim.Status.ProviderID)
+	if err != nil {
+		return nil, err
+	}
+	vm, err := c.vmInstanceProvider.GetWithInstanceView(ctx, vmName)
+	if err != nil {
+		return nil, corecloudprovider.IgnoreNodeClaimNotFoundError(err)
+	}
+	var nics []*armnetwork.Interface
+	if vm.Properties != nil && vm.Properties.NetworkProfile != nil {
+		for _, ref := range vm.Properties.NetworkProfile.NetworkInterfaces {
+			if nic, ok := nicsByID[strings.ToLower(lo.FromPtr(ref.ID))]; ok {
+				nics = append(nics, nic)
+			} else if id, err := arm.ParseResourceID(lo.FromPtr(ref.ID)); err == nil {
+				// NICs created since the listing, or not found by it
+				if nic, err := c.vmInstanceProvider.GetNic(ctx, id.ResourceGroupName, id.Name); err == nil {
+					nics = append(nics, nic)
+				}
+			}
+		}
+	}
+	h := evaluate(vm, nics)
+
+	node := &corev1.Node{}
+	if err := c.kubeClient.Get(ctx, client.ObjectKey{Name: nodeClaim.Status.NodeName}, node); err != nil {
+		return nil, client.IgnoreNotFound(err)
+	}
+	status := lo.Ternary(h.healthy(), corev1.ConditionTrue, corev1.ConditionFalse)
+	existing, found := lo.Find(node.Status.Conditions, func(condition corev1.NodeCondition) bool {
+		return condition.Type == v1beta1.NodeConditionTypeInstanceHealthy
+	})
+	if found && existing.Status == status && existing.Reason == h.reason && existing.Message == h.message {
+		return &h, nil
+	}
+	condition := corev1.NodeCondition{
+		Type:               v1beta1.NodeConditionTypeInstanceHealthy,
+		Status:             status,
+		Reason:             h.reason,
+		Message:            h.message,
+		LastHeartbeatTime:  metav1.Now(),
+		LastTransitionTime: metav1.Now(),
+	}
+	// node repair tolerates the unhealthy condition for a while from its last transition, which a changing message
+	// mustn't reset
+	if found && existing.Status == status {
+		condition.LastTransitionTime = existing.LastTransitionTime
+	}
+	if !h.healthy() && (!found || existing.Status != status) {
+		log.FromContext(ctx).Info("instance is unhealthy", "Node", node.Name, "reason", h.reason, "message", h.message)
+	}
+	stored := node.DeepCopy()
+	node.Status.Conditions = append(lo.Reject(node.Status.Conditions, func(condition corev1.NodeCondition, _ int) bool {
+		return condition.Type == v1beta1.NodeConditionTypeInstanceHealthy
+	}), condition)
+	// the kubelet updates the conditions of the node concurrently
+	if err := c.kubeClient.Status().Patch(ctx, node, client.MergeFromWithOptions(stored, client.MergeFromWithOptimisticLock{})); err != nil {
+		return nil, client.IgnoreNotFound(err)
+	}
+	return &h, nil
+}
+
+func (c *Controller) Register(_ context.Context, m manager.Manager) error {
+	return controllerruntime.NewControllerManagedBy(m).
+		Named("nodeclaim.instancehealth").
+		WatchesRawSource(singleton.Source()).
+		Complete(singleton.AsReconciler(c))
+}
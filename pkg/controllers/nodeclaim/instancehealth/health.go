@@ -0,0 +1,90 @@
+/*
+Portions Copyright (c) Microsoft Corporation.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package instancehealth
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/compute/armcompute/v7"
+	"github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/network/armnetwork"
+	"github.com/samber/lo"
+)
+
+const (
+	HealthyReason               = "Healthy"
+	VMProvisioningFailedReason  = "VMProvisioningFailed"
+	VMAgentNotReadyReason       = "VMAgentNotReady"
+	NICProvisioningFailedReason = "NICProvisioningFailed"
+)
+
+// health is the outcome of evaluating a VM and its NICs
+type health struct {
+	reason  string
+	message string
+}
+
+func (h health) healthy() bool {
+	return h.reason == HealthyReason
+}
+
+// evaluate returns the health of a VM from its instance view and the provisioning state of its NICs. A failed
+// provisioning of the VM or of a NIC, e.g. after an update, makes it unhealthy, as does a VM agent that isn't ready
+// while the VM runs. An instance view without VM agent status, e.g. of a VM still booting, doesn't.
+func evaluate(vm *armcompute.VirtualMachine, nics []*armnetwork.Interface) health {
+	var instanceView *armcompute.VirtualMachineInstanceView
+	if vm.Properties != nil {
+		instanceView = vm.Properties.InstanceView
+	}
+	if instanceView == nil {
+		instanceView = &armcompute.VirtualMachineInstanceView{}
+	}
+	if status, ok := lo.Find(instanceView.Statuses, func(status *armcompute.InstanceViewStatus) bool {
+		return hasCodePrefix(status, "ProvisioningState/failed")
+	}); ok {
+		return health{reason: VMProvisioningFailedReason, message: fmt.Sprintf("Provisioning of the VM failed: %s", describe(status))}
+	}
+	for _, nic := range nics {
+		if nic.Properties != nil && lo.FromPtr(nic.Properties.ProvisioningState) == armnetwork.ProvisioningStateFailed {
+			return health{reason: NICProvisioningFailedReason, message: fmt.Sprintf("Provisioning of the NIC %s failed", lo.FromPtr(nic.Name))}
+		}
+	}
+	running := lo.ContainsBy(instanceView.Statuses, func(status *armcompute.InstanceViewStatus) bool {
+		return hasCodePrefix(status, "PowerState/running")
+	})
+	if running && instanceView.VMAgent != nil && len(instanceView.VMAgent.Statuses) > 0 {
+		if !lo.ContainsBy(instanceView.VMAgent.Statuses, func(status *armcompute.InstanceViewStatus) bool {
+			return hasCodePrefix(status, "ProvisioningState/succeeded")
+		}) {
+			return health{reason: VMAgentNotReadyReason, message: fmt.Sprintf("VM agent is not ready: %s", describe(instanceView.VMAgent.Statuses[0]))}
+		}
+	}
+	return health{reason: HealthyReason, message: "VM agent is ready and the VM and its NICs are provisioned"}
+}
+
+func hasCodePrefix(status *armcompute.InstanceViewStatus, prefix string) bool {
+	return status != nil && strings.HasPrefix(strings.ToLower(lo.FromPtr(status.Code)), strings.ToLower(prefix))
+}
+
+// describe renders an instance view status for a condition message, e.g. "Not Ready (VM Agent is unresponsive.)"
+func describe(status *armcompute.InstanceViewStatus) string {
+	description := lo.CoalesceOrEmpty(lo.FromPtr(status.DisplayStatus), lo.FromPtr(status.Code))
+	if message := lo.FromPtr(status.Message); message != "" {
+		description += fmt.Sprintf(" (%s)", message)
+	}
+	return description
+}
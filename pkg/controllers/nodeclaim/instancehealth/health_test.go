@@ -0,0 +1,219 @@
+/*
+Portions Copyright (c) Microsoft Corporation.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package instancehealth
+
+import (
+	"testing"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/compute/armcompute/v7"
+	"github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/network/armnetwork"
+	"github.com/samber/lo"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	karpv1 "sigs.k8s.io/karpenter/pkg/apis/v1"
+	"sigs.k8s.io/karpenter/pkg/cloudprovider"
+
+	"github.com/Azure/karpenter-provider-azure/pkg/apis/v1beta1"
+)
+
+func status(code, displayStatus, message string) *armcompute.InstanceViewStatus {
+	return &armcompute.InstanceViewStatus{Code: lo.ToPtr(code), DisplayStatus: lo.ToPtr(displayStatus), Message: lo.EmptyableToPtr(message)}
+}
+
+func vmWithInstanceView(instanceView *armcompute.VirtualMachineInstanceView) *armcompute.VirtualMachine {
+	return &armcompute.VirtualMachine{Properties: &armcompute.VirtualMachineProperties{InstanceView: instanceView}}
+}
+
+func nic(name string, state armnetwork.ProvisioningState) *armnetwork.Interface {
+	return &armnetwork.Interface{Name: lo.ToPtr(name), Properties: &armnetwork.InterfacePropertiesFormat{ProvisioningState: lo.ToPtr(state)}}
+}
+
+func TestEvaluate(t *testing.T) {
+	running := status("PowerState/running", "VM running", "")
+	provisioned := status("ProvisioningState/succeeded", "Provisioning succeeded", "")
+	agentReady := &armcompute.VirtualMachineAgentInstanceView{Statuses: []*armcompute.InstanceViewStatus{status("ProvisioningState/succeeded", "Ready", "GuestAgent is running and processing the extensions.")}}
+	agentNotReady := &armcompute.VirtualMachineAgentInstanceView{Statuses: []*armcompute.InstanceViewStatus{status("ProvisioningState/Unavailable", "Not Ready", "VM Agent is unresponsive.")}}
+
+	tests := []struct {
+		name            string
+		vm              *armcompute.VirtualMachine
+		nics            []*armnetwork.Interface
+		expectedReason  string
+		expectedMessage string
+	}{
+		{
+			name:           "healthy VM",
+			vm:             vmWithInstanceView(&armcompute.VirtualMachineInstanceView{Statuses: []*armcompute.InstanceViewStatus{provisioned, running}, VMAgent: agentReady}),
+			nics:           []*armnetwork.Interface{nic("aks-default-a1b2c", armnetwork.ProvisioningStateSucceeded)},
+			expectedReason: HealthyReason,
+		},
+		{
+			name:           "VM without instance view",
+			vm:             &armcompute.VirtualMachine{},
+			expectedReason: HealthyReason,
+		},
+		{
+			name:            "VM agent not ready",
+			vm:              vmWithInstanceView(&armcompute.VirtualMachineInstanceView{Statuses: []*armcompute.InstanceViewStatus{provisioned, running}, VMAgent: agentNotReady}),
+			expectedReason:  VMAgentNotReadyReason,
+			expectedMessage: "VM agent is not ready: Not Ready (VM Agent is unresponsive.)",
+		},
+		{
+			name:           "VM agent without status, e.g. while booting",
+			vm:             vmWithInstanceView(&armcompute.VirtualMachineInstanceView{Statuses: []*armcompute.InstanceViewStatus{provisioned, running}, VMAgent: &armcompute.VirtualMachineAgentInstanceView{}}),
+			expectedReason: HealthyReason,
+		},
+		{
+			name:           "VM agent not ready on a stopped VM",
+			vm:             vmWithInstanceView(&armcompute.VirtualMachineInstanceView{Statuses: []*armcompute.InstanceViewStatus{provisioned, status("PowerState/stopped", "VM stopped", "")}, VMAgent: agentNotReady}),
+			expectedReason: HealthyReason,
+		},
+		{
+			name:            "VM provisioning failed",
+			vm:              vmWithInstanceView(&armcompute.VirtualMachineInstanceView{Statuses: []*armcompute.InstanceViewStatus{status("ProvisioningState/failed/InternalOperationError", "Provisioning failed", "An internal execution error occurred."), running}, VMAgent: agentReady}),
+			expectedReason:  VMProvisioningFailedReason,
+			expectedMessage: "Provisioning of the VM failed: Provisioning failed (An internal execution error occurred.)",
+		},
+		{
+			name:            "NIC provisioning failed",
+			vm:              vmWithInstanceView(&armcompute.VirtualMachineInstanceView{Statuses: []*armcompute.InstanceViewStatus{provisioned, running}, VMAgent: agentReady}),
+			nics:            []*armnetwork.Interface{nic("aks-default-a1b2c", armnetwork.ProvisioningStateFailed)},
+			expectedReason:  NICProvisioningFailedReason,
+			expectedMessage: "Provisioning of the NIC aks-default-a1b2c failed",
+		},
+		{
+			name:           "NIC updating",
+			vm:             vmWithInstanceView(&armcompute.VirtualMachineInstanceView{Statuses: []*armcompute.InstanceViewStatus{provisioned, running}, VMAgent: agentReady}),
+			nics:           []*armnetwork.Interface{nic("aks-default-a1b2c", armnetwork.ProvisioningStateUpdating)},
+			expectedReason: HealthyReason,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := evaluate(tt.vm, tt.nics)
+			if h.reason != tt.expectedReason {
+				t.Errorf("expected reason %q, got %q (%s)", tt.expectedReason, h.reason, h.message)
+			}
+			if tt.expectedMessage != "" && h.message != tt.expectedMessage {
+				t.Errorf("expected message %q, got %q", tt.expectedMessage, h.message)
+			}
+		})
+	}
+}
+
+func TestRepairedCondition(t *testing.T) {
+	initiated := time.Now()
+	policies := []cloudprovider.RepairPolicy{
+		{ConditionType: corev1.NodeReady, ConditionStatus: corev1.ConditionFalse, TolerationDuration: 10 * time.Minute},
+		{ConditionType: v1beta1.NodeConditionTypeInstanceHealthy, ConditionStatus: corev1.ConditionFalse, TolerationDuration: 10 * time.Minute},
+	}
+	node := func(conditions ...corev1.NodeCondition) *corev1.Node {
+		return &corev1.Node{Status: corev1.NodeStatus{Conditions: conditions}}
+	}
+	condition := func(conditionType corev1.NodeConditionType, status corev1.ConditionStatus, since time.Duration) corev1.NodeCondition {
+		return corev1.NodeCondition{Type: conditionType, Status: status, LastTransitionTime: metav1.NewTime(initiated.Add(-since))}
+	}
+
+	tests := []struct {
+		name     string
+		node     *corev1.Node
+		expected corev1.NodeConditionType
+	}{
+		{
+			name: "healthy node",
+			node: node(condition(corev1.NodeReady, corev1.ConditionTrue, time.Hour), condition(v1beta1.NodeConditionTypeInstanceHealthy, corev1.ConditionTrue, time.Hour)),
+		},
+		{
+			name:     "unhealthy on the Azure side",
+			node:     node(condition(corev1.NodeReady, corev1.ConditionTrue, time.Hour), condition(v1beta1.NodeConditionTypeInstanceHealthy, corev1.ConditionFalse, 11*time.Minute)),
+			expected: v1beta1.NodeConditionTypeInstanceHealthy,
+		},
+		{
+			name:     "unhealthy on the Kubernetes side",
+			node:     node(condition(corev1.NodeReady, corev1.ConditionFalse, 10*time.Minute), condition(v1beta1.NodeConditionTypeInstanceHealthy, corev1.ConditionTrue, time.Hour)),
+			expected: corev1.NodeReady,
+		},
+		{
+			name: "unhealthy for less than tolerated",
+			node: node(condition(corev1.NodeReady, corev1.ConditionTrue, time.Hour), condition(v1beta1.NodeConditionTypeInstanceHealthy, corev1.ConditionFalse, 5*time.Minute)),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			conditionType, ok := repairedCondition(tt.node, initiated, policies)
+			if ok != (tt.expected != "") || conditionType != tt.expected {
+				t.Errorf("expected repaired condition %q, got %q (%t)", tt.expected, conditionType, ok)
+			}
+		})
+	}
+}
+
+func TestRepairInitiated(t *testing.T) {
+	deleted := metav1.NewTime(time.Date(2026, time.January, 1, 12, 0, 0, 0, time.UTC))
+	nodeClaim := func(deletionTimestamp *metav1.Time, tgp *time.Duration, annotations map[string]string) *karpv1.NodeClaim {
+		nodeClaim := &karpv1.NodeClaim{ObjectMeta: metav1.ObjectMeta{DeletionTimestamp: deletionTimestamp, Annotations: annotations}}
+		if tgp != nil {
+			nodeClaim.Spec.TerminationGracePeriod = &metav1.Duration{Duration: *tgp}
+		}
+		return nodeClaim
+	}
+	annotated := func(t time.Time) map[string]string {
+		return map[string]string{karpv1.NodeClaimTerminationTimestampAnnotationKey: t.Format(time.RFC3339)}
+	}
+
+	tests := []struct {
+		name      string
+		nodeClaim *karpv1.NodeClaim
+		expected  *time.Time
+	}{
+		{
+			name:      "not deleted",
+			nodeClaim: nodeClaim(nil, nil, nil),
+		},
+		{
+			name:      "deleted without a termination grace period",
+			nodeClaim: nodeClaim(&deleted, nil, nil),
+		},
+		{
+			name:      "deleted with a termination grace period",
+			nodeClaim: nodeClaim(&deleted, lo.ToPtr(time.Hour), annotated(deleted.Add(time.Hour))),
+		},
+		{
+			name:      "repair initiated, not deleted yet",
+			nodeClaim: nodeClaim(nil, lo.ToPtr(time.Hour), annotated(deleted.Add(-time.Second))),
+			expected:  lo.ToPtr(deleted.Add(-time.Second)),
+		},
+		{
+			name:      "repair initiated and deleted",
+			nodeClaim: nodeClaim(&deleted, lo.ToPtr(time.Hour), annotated(deleted.Time)),
+			expected:  lo.ToPtr(deleted.Time),
+		},
+		{
+			name:      "invalid annotation",
+			nodeClaim: nodeClaim(nil, nil, map[string]string{karpv1.NodeClaimTerminationTimestampAnnotationKey: "soon"}),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			initiated, ok := repairInitiated(tt.nodeClaim)
+			if ok != (tt.expected != nil) || (ok && !initiated.Equal(*tt.expected)) {
+				t.Errorf("expected repair initiated at %v, got %v (%t)", tt.expected, initiated, ok)
+			}
+		})
+	}
+}
@@ -0,0 +1,131 @@
+/*
+Portions Copyright (c) Microsoft Corporation.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package instancehealth
+
+import (
+	"context"
+	"time"
+
+	"github.com/awslabs/operatorpkg/reasonable"
+	"github.com/patrickmn/go-cache"
+	"github.com/samber/lo"
+	corev1 "k8s.io/api/core/v1"
+	controllerruntime "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller"
+	"sigs.k8s.io/controller-runtime/pkg/manager"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+	karpv1 "sigs.k8s.io/karpenter/pkg/apis/v1"
+	"sigs.k8s.io/karpenter/pkg/cloudprovider"
+	"sigs.k8s.io/karpenter/pkg/operator/injection"
+
+	"github.com/Azure/karpenter-provider-azure/pkg/apis/v1beta1"
+	"github.com/Azure/karpenter-provider-azure/pkg/metrics"
+)
+
+const (
+	RepairSourceAzure      = "azure"
+	RepairSourceKubernetes = "kubernetes"
+)
+
+// RepairMetricsController counts the nodeclaims replaced by node repair, by whether the unhealthy condition of their
+// node was the InstanceHealthy condition reported from the Azure side, or another condition reported in the cluster.
+// Node repair marks the nodeclaims it repairs with the time it initiated the repair before deleting them, at which time
+// their node had a condition matching a repair policy for longer than the policy tolerates. The termination of other
+// deletions marks the nodeclaims with the end of their termination grace period instead, past their deletion.
+type RepairMetricsController struct {
+	kubeClient    client.Client
+	cloudProvider cloudprovider.CloudProvider
+	// counted holds the UIDs of the repaired nodeclaims already evaluated, which are reconciled until they're gone
+	counted *cache.Cache
+}
+
+func NewRepairMetricsController(kubeClient client.Client, cloudProvider cloudprovider.CloudProvider) *RepairMetricsController {
+	return &RepairMetricsController{
+		kubeClient:    kubeClient,
+		cloudProvider: cloudProvider,
+		counted:       cache.New(time.Hour, 10*time.Minute),
+	}
+}
+
+func (c *RepairMetricsController) Reconcile(ctx context.Context, nodeClaim *karpv1.NodeClaim) (reconcile.Result, error) {
+	ctx = injection.WithControllerName(ctx, "nodeclaim.repairmetrics")
+
+	initiated, ok := repairInitiated(nodeClaim)
+	if !ok || nodeClaim.Status.NodeName == "" {
+		return reconcile.Result{}, nil
+	}
+	if _, ok := c.counted.Get(string(nodeClaim.UID)); ok {
+		return reconcile.Result{}, nil
+	}
+	node := &corev1.Node{}
+	if err := c.kubeClient.Get(ctx, client.ObjectKey{Name: nodeClaim.Status.NodeName}, node); err != nil {
+		return reconcile.Result{}, client.IgnoreNotFound(err)
+	}
+	c.counted.SetDefault(string(nodeClaim.UID), struct{}{})
+	if condition, ok := repairedCondition(node, initiated, c.cloudProvider.RepairPolicies()); ok {
+		metrics.NodeClaimsRepairedTotal.WithLabelValues(
+			lo.Ternary(condition == v1beta1.NodeConditionTypeInstanceHealthy, RepairSourceAzure, RepairSourceKubernetes),
+			string(condition),
+			nodeClaim.Labels[karpv1.NodePoolLabelKey],
+		).Inc()
+	}
+	return reconcile.Result{}, nil
+}
+
+// repairInitiated returns the time node repair initiated the repair of the nodeclaim, if it did
+func repairInitiated(nodeClaim *karpv1.NodeClaim) (time.Time, bool) {
+	annotation, ok := nodeClaim.Annotations[karpv1.NodeClaimTerminationTimestampAnnotationKey]
+	if !ok {
+		return time.Time{}, false
+	}
+	// the termination of a deletion marks the nodeclaim with the end of its termination grace period
+	if tgp := nodeClaim.Spec.TerminationGracePeriod; !nodeClaim.DeletionTimestamp.IsZero() && tgp != nil &&
+		annotation == nodeClaim.DeletionTimestamp.Add(tgp.Duration).Format(time.RFC3339) {
+		return time.Time{}, false
+	}
+	initiated, err := time.Parse(time.RFC3339, annotation)
+	if err != nil {
+		return time.Time{}, false
+	}
+	return initiated, true
+}
+
+// repairedCondition returns the condition of the node for which node repair initiated its repair at the given time, if
+// any: one matching a repair policy since at least the duration the policy tolerates
+func repairedCondition(node *corev1.Node, initiated time.Time, policies []cloudprovider.RepairPolicy) (corev1.NodeConditionType, bool) {
+	for _, policy := range policies {
+		condition, ok := lo.Find(node.Status.Conditions, func(condition corev1.NodeCondition) bool {
+			return condition.Type == policy.ConditionType && condition.Status == policy.ConditionStatus
+		})
+		if ok && !condition.LastTransitionTime.Add(policy.TolerationDuration).After(initiated) {
+			return condition.Type, true
+		}
+	}
+	return "", false
+}
+
+func (c *RepairMetricsController) Register(_ context.Context, m manager.Manager) error {
+	return controllerruntime.NewControllerManagedBy(m).
+		Named("nodeclaim.repairmetrics").
+		For(&karpv1.NodeClaim{}).
+		WithOptions(controller.Options{
+			RateLimiter:             reasonable.RateLimiter(),
+			MaxConcurrentReconciles: 10,
+		}).
+		Complete(reconcile.AsReconciler(m.GetClient(), c))
+}
@@ -0,0 +1,221 @@
+/*
+Portions Copyright (c) Microsoft Corporation.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package instancehealth_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/compute/armcompute/v7"
+	"github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/network/armnetwork"
+	"github.com/awslabs/operatorpkg/object"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/samber/lo"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/record"
+	karpv1 "sigs.k8s.io/karpenter/pkg/apis/v1"
+	"sigs.k8s.io/karpenter/pkg/events"
+	coreoptions "sigs.k8s.io/karpenter/pkg/operator/options"
+	coretest "sigs.k8s.io/karpenter/pkg/test"
+	. "sigs.k8s.io/karpenter/pkg/test/expectations"
+	"sigs.k8s.io/karpenter/pkg/test/v1alpha1"
+	. "sigs.k8s.io/karpenter/pkg/utils/testing"
+
+	"github.com/Azure/karpenter-provider-azure/pkg/apis"
+	"github.com/Azure/karpenter-provider-azure/pkg/apis/v1beta1"
+	"github.com/Azure/karpenter-provider-azure/pkg/cloudprovider"
+	"github.com/Azure/karpenter-provider-azure/pkg/controllers/nodeclaim/instancehealth"
+	"github.com/Azure/karpenter-provider-azure/pkg/metrics"
+	"github.com/Azure/karpenter-provider-azure/pkg/operator/options"
+	"github.com/Azure/karpenter-provider-azure/pkg/providers/instance"
+	"github.com/Azure/karpenter-provider-azure/pkg/test"
+	"github.com/Azure/karpenter-provider-azure/pkg/utils"
+)
+
+var ctx context.Context
+var env *coretest.Environment
+var azureEnv *test.Environment
+var instanceHealthController *instancehealth.Controller
+var repairMetricsController *instancehealth.RepairMetricsController
+
+func TestInstanceHealth(t *testing.T) {
+	ctx = TestContextWithLogger(t)
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Controllers/InstanceHealth")
+}
+
+var _ = BeforeSuite(func() {
+	ctx = coreoptions.ToContext(ctx, coretest.Options())
+	ctx = options.ToContext(ctx, test.Options())
+	env = coretest.NewEnvironment(coretest.WithCRDs(apis.CRDs...), coretest.WithCRDs(v1alpha1.CRDs...))
+	azureEnv = test.NewEnvironment(ctx, env)
+	cloudProvider := cloudprovider.New(azureEnv.InstanceTypesProvider, azureEnv.VMInstanceProvider, events.NewRecorder(&record.FakeRecorder{}), env.Client, azureEnv.ImageProvider)
+	instanceHealthController = instancehealth.NewController(env.Client, azureEnv.VMInstanceProvider)
+	repairMetricsController = instancehealth.NewRepairMetricsController(env.Client, cloudProvider)
+})
+
+var _ = AfterSuite(func() {
+	Expect(env.Stop()).To(Succeed(), "Failed to stop environment")
+})
+
+var _ = Describe("Instance Health", func() {
+	var nodeClaim *karpv1.NodeClaim
+	var node *corev1.Node
+	var vm *armcompute.VirtualMachine
+	var nic *armnetwork.Interface
+
+	agentStatus := func(code, displayStatus string) *armcompute.VirtualMachineAgentInstanceView {
+		return &armcompute.VirtualMachineAgentInstanceView{Statuses: []*armcompute.InstanceViewStatus{{Code: lo.ToPtr(code), DisplayStatus: lo.ToPtr(displayStatus)}}}
+	}
+	storeInstanceView := func(vmAgent *armcompute.VirtualMachineAgentInstanceView) {
+		vm.Properties.InstanceView = &armcompute.VirtualMachineInstanceView{
+			Statuses: []*armcompute.InstanceViewStatus{{Code: lo.ToPtr("ProvisioningState/succeeded")}, {Code: lo.ToPtr("PowerState/running")}},
+			VMAgent:  vmAgent,
+		}
+		azureEnv.VirtualMachinesAPI.Instances.Store(lo.FromPtr(vm.ID), *vm)
+	}
+	expectCondition := func(status corev1.ConditionStatus, reason string) corev1.NodeCondition {
+		node = ExpectExists(ctx, env.Client, node)
+		condition, ok := lo.Find(node.Status.Conditions, func(condition corev1.NodeCondition) bool {
+			return condition.Type == v1beta1.NodeConditionTypeInstanceHealthy
+		})
+		Expect(ok).To(BeTrue())
+		Expect(condition.Status).To(Equal(status))
+		Expect(condition.Reason).To(Equal(reason))
+		return condition
+	}
+
+	BeforeEach(func() {
+		azureEnv.Reset()
+		nodeClass := test.AKSNodeClass()
+		nodeClaim = coretest.NodeClaim(karpv1.NodeClaim{
+			Spec: karpv1.NodeClaimSpec{
+				NodeClassRef: &karpv1.NodeClassReference{
+					Group: object.GVK(nodeClass).Group,
+					Kind:  object.GVK(nodeClass).Kind,
+					Name:  nodeClass.Name,
+				},
+			},
+		})
+		vmName := instance.GenerateResourceName(nodeClaim.Name)
+		nic = test.Interface(test.InterfaceOptions{Name: vmName})
+		nic.Properties.ProvisioningState = lo.ToPtr(armnetwork.ProvisioningStateSucceeded)
+		azureEnv.NetworkInterfacesAPI.NetworkInterfaces.Store(lo.FromPtr(nic.ID), *nic)
+		vm = test.VirtualMachine(test.VirtualMachineOptions{Name: vmName, Properties: &armcompute.VirtualMachineProperties{
+			NetworkProfile: &armcompute.NetworkProfile{NetworkInterfaces: []*armcompute.NetworkInterfaceReference{{ID: nic.ID}}},
+		}})
+		storeInstanceView(agentStatus("ProvisioningState/succeeded", "Ready"))
+
+		node = coretest.Node(coretest.NodeOptions{ProviderID: utils.VMResourceIDToProviderID(ctx, lo.FromPtr(vm.ID))})
+		nodeClaim.Status.NodeName = node.Name
+		nodeClaim.Status.ProviderID = node.Spec.ProviderID
+		ExpectApplied(ctx, env.Client, nodeClaim, node)
+	})
+
+	AfterEach(func() {
+		ExpectCleanedUp(ctx, env.Client)
+	})
+
+	It("should report a healthy instance", func() {
+		ExpectSingletonReconciled(ctx, instanceHealthController)
+		expectCondition(corev1.ConditionTrue, instancehealth.HealthyReason)
+	})
+	It("should report an instance whose VM agent isn't ready, keeping the time it became unhealthy", func() {
+		storeInstanceView(agentStatus("ProvisioningState/Unavailable", "Not Ready"))
+		ExpectSingletonReconciled(ctx, instanceHealthController)
+		unhealthy := expectCondition(corev1.ConditionFalse, instancehealth.VMAgentNotReadyReason)
+
+		// node repair tolerates the condition from the time it became unhealthy
+		storeInstanceView(agentStatus("ProvisioningState/Unavailable", "Not Ready (still)"))
+		ExpectSingletonReconciled(ctx, instanceHealthController)
+		Expect(expectCondition(corev1.ConditionFalse, instancehealth.VMAgentNotReadyReason).LastTransitionTime).To(Equal(unhealthy.LastTransitionTime))
+
+		storeInstanceView(agentStatus("ProvisioningState/succeeded", "Ready"))
+		ExpectSingletonReconciled(ctx, instanceHealthController)
+		expectCondition(corev1.ConditionTrue, instancehealth.HealthyReason)
+	})
+	It("should report an instance whose NIC failed to provision", func() {
+		nic.Properties.ProvisioningState = lo.ToPtr(armnetwork.ProvisioningStateFailed)
+		azureEnv.NetworkInterfacesAPI.NetworkInterfaces.Store(lo.FromPtr(nic.ID), *nic)
+		ExpectSingletonReconciled(ctx, instanceHealthController)
+		expectCondition(corev1.ConditionFalse, instancehealth.NICProvisioningFailedReason)
+	})
+	It("should ignore nodeclaims whose VM is gone", func() {
+		azureEnv.VirtualMachinesAPI.Instances.Delete(lo.FromPtr(vm.ID))
+		ExpectSingletonReconciled(ctx, instanceHealthController)
+		node = ExpectExists(ctx, env.Client, node)
+		Expect(node.Status.Conditions).ToNot(ContainElement(HaveField("Type", v1beta1.NodeConditionTypeInstanceHealthy)))
+	})
+	It("should count nodeclaims repaired for the instance health once", func() {
+		node.Status.Conditions = append(node.Status.Conditions, corev1.NodeCondition{
+			Type:               v1beta1.NodeConditionTypeInstanceHealthy,
+			Status:             corev1.ConditionFalse,
+			Reason:             instancehealth.VMAgentNotReadyReason,
+			LastTransitionTime: metav1.NewTime(time.Now().Add(-time.Hour)),
+		})
+		// node repair marks the nodeclaim with the time it initiates the repair, before deleting it
+		nodeClaim.Annotations = lo.Assign(nodeClaim.Annotations, map[string]string{
+			karpv1.NodeClaimTerminationTimestampAnnotationKey: time.Now().Format(time.RFC3339),
+		})
+		ExpectApplied(ctx, env.Client, nodeClaim, node)
+
+		labels := map[string]string{
+			metrics.SourceLabel:    instancehealth.RepairSourceAzure,
+			metrics.ConditionLabel: string(v1beta1.NodeConditionTypeInstanceHealthy),
+			metrics.NodePoolLabel:  nodeClaim.Labels[karpv1.NodePoolLabelKey],
+		}
+		repaired := func() float64 {
+			metric, err := metrics.FindMetricWithLabelValues("karpenter_nodeclaims_repaired_total", labels)
+			Expect(err).ToNot(HaveOccurred())
+			// the getters of a missing metric return 0
+			return metric.GetCounter().GetValue()
+		}
+		before := repaired()
+		ExpectObjectReconciled(ctx, env.Client, repairMetricsController, nodeClaim)
+		ExpectObjectReconciled(ctx, env.Client, repairMetricsController, nodeClaim)
+		Expect(repaired()).To(Equal(before + 1))
+	})
+	It("should not count nodeclaims deleted with an unhealthy node but not repaired", func() {
+		node.Status.Conditions = append(node.Status.Conditions, corev1.NodeCondition{
+			Type:               v1beta1.NodeConditionTypeInstanceHealthy,
+			Status:             corev1.ConditionFalse,
+			Reason:             instancehealth.VMAgentNotReadyReason,
+			LastTransitionTime: metav1.NewTime(time.Now().Add(-time.Hour)),
+		})
+		nodeClaim.Finalizers = []string{karpv1.TerminationFinalizer}
+		ExpectApplied(ctx, env.Client, nodeClaim, node)
+		Expect(env.Client.Delete(ctx, nodeClaim)).To(Succeed())
+
+		labels := map[string]string{
+			metrics.SourceLabel:    instancehealth.RepairSourceAzure,
+			metrics.ConditionLabel: string(v1beta1.NodeConditionTypeInstanceHealthy),
+			metrics.NodePoolLabel:  nodeClaim.Labels[karpv1.NodePoolLabelKey],
+		}
+		metric, err := metrics.FindMetricWithLabelValues("karpenter_nodeclaims_repaired_total", labels)
+		Expect(err).ToNot(HaveOccurred())
+		before := metric.GetCounter().GetValue()
+		ExpectObjectReconciled(ctx, env.Client, repairMetricsController, nodeClaim)
+		metric, err = metrics.FindMetricWithLabelValues("karpenter_nodeclaims_repaired_total", labels)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(metric.GetCounter().GetValue()).To(Equal(before))
+
+		ExpectFinalizersRemoved(ctx, env.Client, nodeClaim)
+	})
+})
@@ -0,0 +1,145 @@
+/*
+Portions Copyright (c) Microsoft Corporation.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package localstorage
+
+import (
+	"context"
+	"strconv"
+	"time"
+
+	"github.com/awslabs/operatorpkg/reasonable"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/utils/clock"
+	controllerruntime "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/manager"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+	karpv1 "sigs.k8s.io/karpenter/pkg/apis/v1"
+	"sigs.k8s.io/karpenter/pkg/operator/injection"
+	nodeclaimutils "sigs.k8s.io/karpenter/pkg/utils/nodeclaim"
+
+	"github.com/Azure/karpenter-provider-azure/pkg/apis/v1beta1"
+)
+
+// Controller protects the nodes of instance types with local disks from consolidation for the
+// localStorageConsolidateAfter of their AKSNodeClass after their launch, by annotating them with
+// karpenter.sh/do-not-disrupt meanwhile. Karpenter orders consolidation candidates by the cost of rescheduling their
+// pods, without consulting the cloud provider, so it would otherwise pick these nodes as readily as any other, although
+// the data on their local disks is expensive to rehydrate. Drifted nodes aren't protected, so they're still replaced,
+// and the expiration and involuntary disruption of nodes ignore the annotation. Nodes annotated by their users are left
+// as they are.
+type Controller struct {
+	kubeClient client.Client
+	clock      clock.Clock
+}
+
+func NewController(kubeClient client.Client, clk clock.Clock) *Controller {
+	return &Controller{
+		kubeClient: kubeClient,
+		clock:      clk,
+	}
+}
+
+func (c *Controller) Reconcile(ctx context.Context, nodeClaim *karpv1.NodeClaim) (reconcile.Result, error) {
+	ctx = injection.WithControllerName(ctx, "nodeclaim.localstorage")
+
+	if !nodeClaim.DeletionTimestamp.IsZero() || nodeClaim.Status.NodeName == "" {
+		return reconcile.Result{}, nil
+	}
+	node := &corev1.Node{}
+	if err := c.kubeClient.Get(ctx, client.ObjectKey{Name: nodeClaim.Status.NodeName}, node); err != nil {
+		return reconcile.Result{}, client.IgnoreNotFound(err)
+	}
+	consolidateAfter, err := c.consolidateAfter(ctx, nodeClaim)
+	if err != nil {
+		return reconcile.Result{}, err
+	}
+
+	var result reconcile.Result
+	blocked := false
+	if consolidateAfter > 0 && hasLocalDisks(node) && !nodeClaim.StatusConditions().Get(karpv1.ConditionTypeDrifted).IsTrue() {
+		if remaining := nodeClaim.CreationTimestamp.Add(consolidateAfter).Sub(c.clock.Now()); remaining > 0 {
+			blocked = true
+			result.RequeueAfter = remaining
+		}
+	}
+
+	annotated := node.Annotations[v1beta1.AnnotationLocalStorageConsolidationBlocked] == "true"
+	stored := node.DeepCopy()
+	switch {
+	case blocked && !annotated:
+		// disruption may be blocked by the maintenance window too, and stays blocked until both are lifted
+		if node.Annotations[karpv1.DoNotDisruptAnnotationKey] == "true" && node.Annotations[v1beta1.AnnotationMaintenanceWindowBlocked] != "true" {
+			// disruption is blocked by the user already
+			return result, nil
+		}
+		if node.Annotations == nil {
+			node.Annotations = map[string]string{}
+		}
+		node.Annotations[karpv1.DoNotDisruptAnnotationKey] = "true"
+		node.Annotations[v1beta1.AnnotationLocalStorageConsolidationBlocked] = "true"
+		log.FromContext(ctx).V(1).Info("protecting node with local disks from consolidation", "Node", node.Name, "duration", result.RequeueAfter)
+	case !blocked && annotated:
+		if node.Annotations[v1beta1.AnnotationMaintenanceWindowBlocked] != "true" {
+			delete(node.Annotations, karpv1.DoNotDisruptAnnotationKey)
+		}
+		delete(node.Annotations, v1beta1.AnnotationLocalStorageConsolidationBlocked)
+		log.FromContext(ctx).V(1).Info("ending protection of node with local disks from consolidation", "Node", node.Name)
+	default:
+		return result, nil
+	}
+	if err := c.kubeClient.Patch(ctx, node, client.MergeFrom(stored)); err != nil {
+		return reconcile.Result{}, client.IgnoreNotFound(err)
+	}
+	return result, nil
+}
+
+// consolidateAfter returns the localStorageConsolidateAfter of the AKSNodeClass of the nodeclaim, 0 if it has none
+func (c *Controller) consolidateAfter(ctx context.Context, nodeClaim *karpv1.NodeClaim) (time.Duration, error) {
+	if nodeClaim.Spec.NodeClassRef == nil {
+		return 0, nil
+	}
+	nodeClass := &v1beta1.AKSNodeClass{}
+	if err := c.kubeClient.Get(ctx, client.ObjectKey{Name: nodeClaim.Spec.NodeClassRef.Name}, nodeClass); err != nil {
+		return 0, client.IgnoreNotFound(err)
+	}
+	if nodeClass.Spec.LocalStorageConsolidateAfter == nil {
+		return 0, nil
+	}
+	return nodeClass.Spec.LocalStorageConsolidateAfter.Duration, nil
+}
+
+// hasLocalDisks returns whether the instance type of the node has local disks, from its sku-storage-local-count label
+func hasLocalDisks(node *corev1.Node) bool {
+	count, err := strconv.Atoi(node.Labels[v1beta1.LabelSKUStorageLocalCount])
+	return err == nil && count > 0
+}
+
+func (c *Controller) Register(_ context.Context, m manager.Manager) error {
+	return controllerruntime.NewControllerManagedBy(m).
+		Named("nodeclaim.localstorage").
+		For(&karpv1.NodeClaim{}).
+		// changing the localStorageConsolidateAfter of a nodeclass applies to the nodes of its nodeclaims right away
+		Watches(&v1beta1.AKSNodeClass{}, nodeclaimutils.NodeClassEventHandler(c.kubeClient)).
+		WithOptions(controller.Options{
+			RateLimiter:             reasonable.RateLimiter(),
+			MaxConcurrentReconciles: 10,
+		}).
+		Complete(reconcile.AsReconciler(m.GetClient(), c))
+}
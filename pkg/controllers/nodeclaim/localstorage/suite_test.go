@@ -0,0 +1,183 @@
+/*
+Portions Copyright (c) Microsoft Corporation.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package localstorage_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	clock "k8s.io/utils/clock/testing"
+	karpv1 "sigs.k8s.io/karpenter/pkg/apis/v1"
+	coreoptions "sigs.k8s.io/karpenter/pkg/operator/options"
+	coretest "sigs.k8s.io/karpenter/pkg/test"
+	. "sigs.k8s.io/karpenter/pkg/test/expectations"
+	"sigs.k8s.io/karpenter/pkg/test/v1alpha1"
+	. "sigs.k8s.io/karpenter/pkg/utils/testing"
+
+	"github.com/Azure/karpenter-provider-azure/pkg/apis"
+	"github.com/Azure/karpenter-provider-azure/pkg/apis/v1beta1"
+	"github.com/Azure/karpenter-provider-azure/pkg/controllers/nodeclaim/localstorage"
+	"github.com/Azure/karpenter-provider-azure/pkg/operator/options"
+	"github.com/Azure/karpenter-provider-azure/pkg/test"
+)
+
+var ctx context.Context
+var env *coretest.Environment
+var fakeClock *clock.FakeClock
+var localStorageController *localstorage.Controller
+
+func TestLocalStorage(t *testing.T) {
+	ctx = TestContextWithLogger(t)
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Controllers/LocalStorage")
+}
+
+var _ = BeforeSuite(func() {
+	ctx = coreoptions.ToContext(ctx, coretest.Options())
+	ctx = options.ToContext(ctx, test.Options())
+	env = coretest.NewEnvironment(coretest.WithCRDs(apis.CRDs...), coretest.WithCRDs(v1alpha1.CRDs...))
+	fakeClock = clock.NewFakeClock(time.Now())
+	localStorageController = localstorage.NewController(env.Client, fakeClock)
+})
+
+var _ = AfterSuite(func() {
+	Expect(env.Stop()).To(Succeed(), "Failed to stop environment")
+})
+
+var _ = Describe("Local Storage", func() {
+	var nodeClass *v1beta1.AKSNodeClass
+	var nodeClaim *karpv1.NodeClaim
+	var node *corev1.Node
+
+	// applied applies the objects, and moves the clock to the launch of the nodeclaim
+	applied := func() {
+		ExpectApplied(ctx, env.Client, nodeClass, nodeClaim, node)
+		fakeClock.SetTime(nodeClaim.CreationTimestamp.Time)
+	}
+
+	BeforeEach(func() {
+		nodeClass = test.AKSNodeClass(v1beta1.AKSNodeClass{
+			Spec: v1beta1.AKSNodeClassSpec{
+				LocalStorageConsolidateAfter: &metav1.Duration{Duration: 24 * time.Hour},
+			},
+		})
+		// a Standard_L8s_v3, with a local NVMe disk
+		node = coretest.Node(coretest.NodeOptions{ObjectMeta: metav1.ObjectMeta{Labels: map[string]string{
+			v1beta1.LabelSKUStorageLocalProtocol: "nvme",
+			v1beta1.LabelSKUStorageLocalCount:    "1",
+		}}})
+		nodeClaim = coretest.NodeClaim(karpv1.NodeClaim{
+			Spec: karpv1.NodeClaimSpec{
+				NodeClassRef: &karpv1.NodeClassReference{
+					Group: v1beta1.Group,
+					Kind:  "AKSNodeClass",
+					Name:  nodeClass.Name,
+				},
+			},
+			Status: karpv1.NodeClaimStatus{
+				NodeName: node.Name,
+			},
+		})
+	})
+
+	AfterEach(func() {
+		ExpectCleanedUp(ctx, env.Client)
+	})
+
+	It("should protect nodes with local disks from consolidation after their launch", func() {
+		applied()
+		result := ExpectObjectReconciled(ctx, env.Client, localStorageController, nodeClaim)
+
+		Expect(result.RequeueAfter).To(Equal(24 * time.Hour))
+		node = ExpectExists(ctx, env.Client, node)
+		Expect(node.Annotations).To(HaveKeyWithValue(karpv1.DoNotDisruptAnnotationKey, "true"))
+		Expect(node.Annotations).To(HaveKeyWithValue(v1beta1.AnnotationLocalStorageConsolidationBlocked, "true"))
+	})
+	It("should end the protection once localStorageConsolidateAfter elapsed", func() {
+		applied()
+		ExpectObjectReconciled(ctx, env.Client, localStorageController, nodeClaim)
+		fakeClock.Step(24 * time.Hour)
+		result := ExpectObjectReconciled(ctx, env.Client, localStorageController, nodeClaim)
+
+		Expect(result.RequeueAfter).To(BeZero())
+		node = ExpectExists(ctx, env.Client, node)
+		Expect(node.Annotations).ToNot(HaveKey(karpv1.DoNotDisruptAnnotationKey))
+		Expect(node.Annotations).ToNot(HaveKey(v1beta1.AnnotationLocalStorageConsolidationBlocked))
+	})
+	It("should not protect drifted nodes, so that they're replaced", func() {
+		applied()
+		ExpectObjectReconciled(ctx, env.Client, localStorageController, nodeClaim)
+		nodeClaim.StatusConditions().SetTrue(karpv1.ConditionTypeDrifted)
+		ExpectApplied(ctx, env.Client, nodeClaim)
+		ExpectObjectReconciled(ctx, env.Client, localStorageController, nodeClaim)
+
+		node = ExpectExists(ctx, env.Client, node)
+		Expect(node.Annotations).ToNot(HaveKey(karpv1.DoNotDisruptAnnotationKey))
+		Expect(node.Annotations).ToNot(HaveKey(v1beta1.AnnotationLocalStorageConsolidationBlocked))
+	})
+	It("should not protect nodes without local disks", func() {
+		node.Labels[v1beta1.LabelSKUStorageLocalCount] = "0"
+		delete(node.Labels, v1beta1.LabelSKUStorageLocalProtocol)
+		applied()
+		result := ExpectObjectReconciled(ctx, env.Client, localStorageController, nodeClaim)
+
+		Expect(result.RequeueAfter).To(BeZero())
+		node = ExpectExists(ctx, env.Client, node)
+		Expect(node.Annotations).ToNot(HaveKey(karpv1.DoNotDisruptAnnotationKey))
+	})
+	It("should not protect nodes without localStorageConsolidateAfter", func() {
+		nodeClass.Spec.LocalStorageConsolidateAfter = nil
+		applied()
+		ExpectObjectReconciled(ctx, env.Client, localStorageController, nodeClaim)
+
+		node = ExpectExists(ctx, env.Client, node)
+		Expect(node.Annotations).ToNot(HaveKey(karpv1.DoNotDisruptAnnotationKey))
+	})
+	It("should leave nodes annotated by their users as they are", func() {
+		node.Annotations = map[string]string{karpv1.DoNotDisruptAnnotationKey: "true"}
+		applied()
+		ExpectObjectReconciled(ctx, env.Client, localStorageController, nodeClaim)
+		node = ExpectExists(ctx, env.Client, node)
+		Expect(node.Annotations).ToNot(HaveKey(v1beta1.AnnotationLocalStorageConsolidationBlocked))
+
+		fakeClock.Step(24 * time.Hour)
+		ExpectObjectReconciled(ctx, env.Client, localStorageController, nodeClaim)
+		node = ExpectExists(ctx, env.Client, node)
+		Expect(node.Annotations).To(HaveKeyWithValue(karpv1.DoNotDisruptAnnotationKey, "true"))
+	})
+	It("should keep disruption blocked while the maintenance window is closed", func() {
+		node.Annotations = map[string]string{
+			karpv1.DoNotDisruptAnnotationKey:           "true",
+			v1beta1.AnnotationMaintenanceWindowBlocked: "true",
+		}
+		applied()
+		ExpectObjectReconciled(ctx, env.Client, localStorageController, nodeClaim)
+		node = ExpectExists(ctx, env.Client, node)
+		Expect(node.Annotations).To(HaveKeyWithValue(v1beta1.AnnotationLocalStorageConsolidationBlocked, "true"))
+
+		fakeClock.Step(24 * time.Hour)
+		ExpectObjectReconciled(ctx, env.Client, localStorageController, nodeClaim)
+		node = ExpectExists(ctx, env.Client, node)
+		Expect(node.Annotations).To(HaveKeyWithValue(karpv1.DoNotDisruptAnnotationKey, "true"))
+		Expect(node.Annotations).ToNot(HaveKey(v1beta1.AnnotationLocalStorageConsolidationBlocked))
+	})
+})
@@ -0,0 +1,137 @@
+/*
+Portions Copyright (c) Microsoft Corporation.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package maintenancewindow
+
+import (
+	"context"
+
+	"github.com/awslabs/operatorpkg/reasonable"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/utils/clock"
+	controllerruntime "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/manager"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+	karpv1 "sigs.k8s.io/karpenter/pkg/apis/v1"
+	"sigs.k8s.io/karpenter/pkg/operator/injection"
+	nodeclaimutils "sigs.k8s.io/karpenter/pkg/utils/nodeclaim"
+
+	"github.com/Azure/karpenter-provider-azure/pkg/apis/v1beta1"
+)
+
+// Controller blocks the voluntary disruption of the nodes of nodeclaims outside of the maintenance window of their
+// AKSNodeClass, by annotating the nodes with karpenter.sh/do-not-disrupt while the window is closed. Karpenter doesn't
+// consult the cloud provider on whether nodes can be disrupted, but skips nodes with the annotation when disrupting
+// nodes voluntarily, i.e. when consolidating them and replacing drifted ones; it doesn't when handling spot evictions,
+// repairing nodes, or expiring them. Nodes annotated by their users are left as they are.
+type Controller struct {
+	kubeClient client.Client
+	clock      clock.Clock
+}
+
+func NewController(kubeClient client.Client, clk clock.Clock) *Controller {
+	return &Controller{
+		kubeClient: kubeClient,
+		clock:      clk,
+	}
+}
+
+func (c *Controller) Reconcile(ctx context.Context, nodeClaim *karpv1.NodeClaim) (reconcile.Result, error) {
+	ctx = injection.WithControllerName(ctx, "nodeclaim.maintenancewindow")
+
+	if !nodeClaim.DeletionTimestamp.IsZero() || nodeClaim.Status.NodeName == "" {
+		return reconcile.Result{}, nil
+	}
+	node := &corev1.Node{}
+	if err := c.kubeClient.Get(ctx, client.ObjectKey{Name: nodeClaim.Status.NodeName}, node); err != nil {
+		return reconcile.Result{}, client.IgnoreNotFound(err)
+	}
+	window, err := c.maintenanceWindow(ctx, nodeClaim)
+	if err != nil {
+		return reconcile.Result{}, err
+	}
+
+	var result reconcile.Result
+	blocked := false
+	if window != nil {
+		now := c.clock.Now()
+		status, err := window.Status(now)
+		if err != nil {
+			// an invalid window doesn't block disruption
+			log.FromContext(ctx).Error(err, "invalid maintenance window, not blocking disruption", "NodeClass", nodeClaim.Spec.NodeClassRef.Name)
+		} else {
+			blocked = !status.Open
+			result.RequeueAfter = status.NextTransition().Sub(now)
+		}
+	}
+
+	annotated := node.Annotations[v1beta1.AnnotationMaintenanceWindowBlocked] == "true"
+	stored := node.DeepCopy()
+	switch {
+	case blocked && !annotated:
+		// disruption may be blocked by the local storage protection too, and stays blocked until both are lifted
+		if node.Annotations[karpv1.DoNotDisruptAnnotationKey] == "true" && node.Annotations[v1beta1.AnnotationLocalStorageConsolidationBlocked] != "true" {
+			// disruption is blocked by the user already
+			return result, nil
+		}
+		if node.Annotations == nil {
+			node.Annotations = map[string]string{}
+		}
+		node.Annotations[karpv1.DoNotDisruptAnnotationKey] = "true"
+		node.Annotations[v1beta1.AnnotationMaintenanceWindowBlocked] = "true"
+		log.FromContext(ctx).V(1).Info("blocking disruption of node outside of maintenance window", "Node", node.Name)
+	case !blocked && annotated:
+		if node.Annotations[v1beta1.AnnotationLocalStorageConsolidationBlocked] != "true" {
+			delete(node.Annotations, karpv1.DoNotDisruptAnnotationKey)
+		}
+		delete(node.Annotations, v1beta1.AnnotationMaintenanceWindowBlocked)
+		log.FromContext(ctx).V(1).Info("unblocking disruption of node in maintenance window", "Node", node.Name)
+	default:
+		return result, nil
+	}
+	if err := c.kubeClient.Patch(ctx, node, client.MergeFrom(stored)); err != nil {
+		return reconcile.Result{}, client.IgnoreNotFound(err)
+	}
+	return result, nil
+}
+
+// maintenanceWindow returns the maintenance window of the AKSNodeClass of the nodeclaim, if it has one
+func (c *Controller) maintenanceWindow(ctx context.Context, nodeClaim *karpv1.NodeClaim) (*v1beta1.MaintenanceWindow, error) {
+	if nodeClaim.Spec.NodeClassRef == nil {
+		return nil, nil
+	}
+	nodeClass := &v1beta1.AKSNodeClass{}
+	if err := c.kubeClient.Get(ctx, client.ObjectKey{Name: nodeClaim.Spec.NodeClassRef.Name}, nodeClass); err != nil {
+		return nil, client.IgnoreNotFound(err)
+	}
+	return nodeClass.Spec.MaintenanceWindow, nil
+}
+
+func (c *Controller) Register(_ context.Context, m manager.Manager) error {
+	return controllerruntime.NewControllerManagedBy(m).
+		Named("nodeclaim.maintenancewindow").
+		For(&karpv1.NodeClaim{}).
+		// changing the maintenance window of a nodeclass applies to the nodes of its nodeclaims right away
+		Watches(&v1beta1.AKSNodeClass{}, nodeclaimutils.NodeClassEventHandler(c.kubeClient)).
+		WithOptions(controller.Options{
+			RateLimiter:             reasonable.RateLimiter(),
+			MaxConcurrentReconciles: 10,
+		}).
+		Complete(reconcile.AsReconciler(m.GetClient(), c))
+}
@@ -0,0 +1,169 @@
+/*
+Portions Copyright (c) Microsoft Corporation.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package maintenancewindow_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/samber/lo"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	clock "k8s.io/utils/clock/testing"
+	karpv1 "sigs.k8s.io/karpenter/pkg/apis/v1"
+	coreoptions "sigs.k8s.io/karpenter/pkg/operator/options"
+	coretest "sigs.k8s.io/karpenter/pkg/test"
+	. "sigs.k8s.io/karpenter/pkg/test/expectations"
+	"sigs.k8s.io/karpenter/pkg/test/v1alpha1"
+	. "sigs.k8s.io/karpenter/pkg/utils/testing"
+
+	"github.com/Azure/karpenter-provider-azure/pkg/apis"
+	"github.com/Azure/karpenter-provider-azure/pkg/apis/v1beta1"
+	"github.com/Azure/karpenter-provider-azure/pkg/controllers/nodeclaim/maintenancewindow"
+	"github.com/Azure/karpenter-provider-azure/pkg/operator/options"
+	"github.com/Azure/karpenter-provider-azure/pkg/test"
+)
+
+var ctx context.Context
+var env *coretest.Environment
+var fakeClock *clock.FakeClock
+var maintenanceWindowController *maintenancewindow.Controller
+
+func TestMaintenanceWindow(t *testing.T) {
+	ctx = TestContextWithLogger(t)
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Controllers/MaintenanceWindow")
+}
+
+var _ = BeforeSuite(func() {
+	ctx = coreoptions.ToContext(ctx, coretest.Options())
+	ctx = options.ToContext(ctx, test.Options())
+	env = coretest.NewEnvironment(coretest.WithCRDs(apis.CRDs...), coretest.WithCRDs(v1alpha1.CRDs...))
+	fakeClock = clock.NewFakeClock(time.Now())
+	maintenanceWindowController = maintenancewindow.NewController(env.Client, fakeClock)
+})
+
+var _ = AfterSuite(func() {
+	Expect(env.Stop()).To(Succeed(), "Failed to stop environment")
+})
+
+var _ = Describe("Maintenance Window", func() {
+	var nodeClass *v1beta1.AKSNodeClass
+	var nodeClaim *karpv1.NodeClaim
+	var node *corev1.Node
+
+	BeforeEach(func() {
+		// a Friday, outside of the window
+		fakeClock.SetTime(lo.Must(time.Parse(time.RFC3339, "2026-10-16T12:00:00Z")))
+		nodeClass = test.AKSNodeClass(v1beta1.AKSNodeClass{
+			Spec: v1beta1.AKSNodeClassSpec{
+				// Sundays 02:00-06:00 UTC
+				MaintenanceWindow: &v1beta1.MaintenanceWindow{Schedule: "0 2 * * 0", Duration: metav1.Duration{Duration: 4 * time.Hour}},
+			},
+		})
+		node = coretest.Node()
+		nodeClaim = coretest.NodeClaim(karpv1.NodeClaim{
+			Spec: karpv1.NodeClaimSpec{
+				NodeClassRef: &karpv1.NodeClassReference{
+					Group: v1beta1.Group,
+					Kind:  "AKSNodeClass",
+					Name:  nodeClass.Name,
+				},
+			},
+			Status: karpv1.NodeClaimStatus{
+				NodeName: node.Name,
+			},
+		})
+	})
+
+	AfterEach(func() {
+		ExpectCleanedUp(ctx, env.Client)
+	})
+
+	It("should block disruption of the node outside of the maintenance window", func() {
+		ExpectApplied(ctx, env.Client, nodeClass, nodeClaim, node)
+		result := ExpectObjectReconciled(ctx, env.Client, maintenanceWindowController, nodeClaim)
+
+		Expect(result.RequeueAfter).To(Equal(38 * time.Hour))
+		node = ExpectExists(ctx, env.Client, node)
+		Expect(node.Annotations).To(HaveKeyWithValue(karpv1.DoNotDisruptAnnotationKey, "true"))
+		Expect(node.Annotations).To(HaveKeyWithValue(v1beta1.AnnotationMaintenanceWindowBlocked, "true"))
+	})
+	It("should unblock disruption of the node once the maintenance window opens", func() {
+		ExpectApplied(ctx, env.Client, nodeClass, nodeClaim, node)
+		ExpectObjectReconciled(ctx, env.Client, maintenanceWindowController, nodeClaim)
+		fakeClock.Step(39 * time.Hour)
+		result := ExpectObjectReconciled(ctx, env.Client, maintenanceWindowController, nodeClaim)
+
+		Expect(result.RequeueAfter).To(Equal(3 * time.Hour))
+		node = ExpectExists(ctx, env.Client, node)
+		Expect(node.Annotations).ToNot(HaveKey(karpv1.DoNotDisruptAnnotationKey))
+		Expect(node.Annotations).ToNot(HaveKey(v1beta1.AnnotationMaintenanceWindowBlocked))
+	})
+	It("should unblock disruption of the node once the maintenance window is removed", func() {
+		ExpectApplied(ctx, env.Client, nodeClass, nodeClaim, node)
+		ExpectObjectReconciled(ctx, env.Client, maintenanceWindowController, nodeClaim)
+		nodeClass.Spec.MaintenanceWindow = nil
+		ExpectApplied(ctx, env.Client, nodeClass)
+		result := ExpectObjectReconciled(ctx, env.Client, maintenanceWindowController, nodeClaim)
+
+		Expect(result.RequeueAfter).To(BeZero())
+		node = ExpectExists(ctx, env.Client, node)
+		Expect(node.Annotations).ToNot(HaveKey(karpv1.DoNotDisruptAnnotationKey))
+		Expect(node.Annotations).ToNot(HaveKey(v1beta1.AnnotationMaintenanceWindowBlocked))
+	})
+	It("should leave nodes annotated by their users as they are", func() {
+		node.Annotations = map[string]string{karpv1.DoNotDisruptAnnotationKey: "true"}
+		ExpectApplied(ctx, env.Client, nodeClass, nodeClaim, node)
+		ExpectObjectReconciled(ctx, env.Client, maintenanceWindowController, nodeClaim)
+		node = ExpectExists(ctx, env.Client, node)
+		Expect(node.Annotations).ToNot(HaveKey(v1beta1.AnnotationMaintenanceWindowBlocked))
+
+		fakeClock.Step(39 * time.Hour)
+		ExpectObjectReconciled(ctx, env.Client, maintenanceWindowController, nodeClaim)
+		node = ExpectExists(ctx, env.Client, node)
+		Expect(node.Annotations).To(HaveKeyWithValue(karpv1.DoNotDisruptAnnotationKey, "true"))
+	})
+	It("should keep disruption blocked while nodes with local disks are protected from consolidation", func() {
+		node.Annotations = map[string]string{
+			karpv1.DoNotDisruptAnnotationKey:                   "true",
+			v1beta1.AnnotationLocalStorageConsolidationBlocked: "true",
+		}
+		ExpectApplied(ctx, env.Client, nodeClass, nodeClaim, node)
+		ExpectObjectReconciled(ctx, env.Client, maintenanceWindowController, nodeClaim)
+		node = ExpectExists(ctx, env.Client, node)
+		Expect(node.Annotations).To(HaveKeyWithValue(v1beta1.AnnotationMaintenanceWindowBlocked, "true"))
+
+		fakeClock.Step(39 * time.Hour)
+		ExpectObjectReconciled(ctx, env.Client, maintenanceWindowController, nodeClaim)
+		node = ExpectExists(ctx, env.Client, node)
+		Expect(node.Annotations).To(HaveKeyWithValue(karpv1.DoNotDisruptAnnotationKey, "true"))
+		Expect(node.Annotations).ToNot(HaveKey(v1beta1.AnnotationMaintenanceWindowBlocked))
+	})
+	It("should not block disruption of nodes without a maintenance window", func() {
+		nodeClass.Spec.MaintenanceWindow = nil
+		ExpectApplied(ctx, env.Client, nodeClass, nodeClaim, node)
+		result := ExpectObjectReconciled(ctx, env.Client, maintenanceWindowController, nodeClaim)
+
+		Expect(result.RequeueAfter).To(BeZero())
+		node = ExpectExists(ctx, env.Client, node)
+		Expect(node.Annotations).ToNot(HaveKey(karpv1.DoNotDisruptAnnotationKey))
+	})
+})
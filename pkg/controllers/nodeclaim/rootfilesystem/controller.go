@@ -0,0 +1,117 @@
+/*
+Portions Copyright (c) Microsoft Corporation.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package rootfilesystem
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/awslabs/operatorpkg/reasonable"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	controllerruntime "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/manager"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+	karpv1 "sigs.k8s.io/karpenter/pkg/apis/v1"
+	"sigs.k8s.io/karpenter/pkg/operator/injection"
+)
+
+const (
+	// ConditionTypeRootFilesystemUndersized is the node condition of whether the root filesystem of the node is smaller
+	// than the ephemeral storage its instance type advertises, e.g. because it wasn't grown to the OS disk
+	ConditionTypeRootFilesystemUndersized corev1.NodeConditionType = "RootFilesystemUndersized"
+
+	RootFilesystemNotGrownReason = "RootFilesystemNotGrown"
+	RootFilesystemGrownReason    = "RootFilesystemGrown"
+)
+
+// Controller reports on the nodes of nodeclaims whether their root filesystem is smaller than the ephemeral storage
+// advertised for their instance type. Nodes grow their root filesystem to the OS disk on bootstrap, before the kubelet
+// starts; the kubelet then reports the ephemeral storage of the filesystem, which is compared once to the advertised one.
+type Controller struct {
+	kubeClient client.Client
+}
+
+func NewController(kubeClient client.Client) *Controller {
+	return &Controller{
+		kubeClient: kubeClient,
+	}
+}
+
+func (c *Controller) Reconcile(ctx context.Context, nodeClaim *karpv1.NodeClaim) (reconcile.Result, error) {
+	ctx = injection.WithControllerName(ctx, "nodeclaim.rootfilesystem")
+
+	if !nodeClaim.DeletionTimestamp.IsZero() || nodeClaim.Status.NodeName == "" {
+		return reconcile.Result{}, nil
+	}
+	advertised, ok := nodeClaim.Status.Capacity[corev1.ResourceEphemeralStorage]
+	if !ok {
+		return reconcile.Result{}, nil
+	}
+	node := &corev1.Node{}
+	if err := c.kubeClient.Get(ctx, client.ObjectKey{Name: nodeClaim.Status.NodeName}, node); err != nil {
+		return reconcile.Result{}, client.IgnoreNotFound(err)
+	}
+	// the root filesystem doesn't change size once the kubelet reported it
+	for _, condition := range node.Status.Conditions {
+		if condition.Type == ConditionTypeRootFilesystemUndersized {
+			return reconcile.Result{}, nil
+		}
+	}
+	actual, ok := node.Status.Capacity[corev1.ResourceEphemeralStorage]
+	if !ok {
+		// the kubelet hasn't reported its capacity yet
+		return reconcile.Result{RequeueAfter: 30 * time.Second}, nil
+	}
+
+	condition := corev1.NodeCondition{
+		Type:               ConditionTypeRootFilesystemUndersized,
+		Status:             corev1.ConditionFalse,
+		Reason:             RootFilesystemGrownReason,
+		Message:            fmt.Sprintf("Root filesystem of %s provides the %s of ephemeral storage of the instance type", actual.String(), advertised.String()),
+		LastHeartbeatTime:  metav1.Now(),
+		LastTransitionTime: metav1.Now(),
+	}
+	if actual.Cmp(advertised) < 0 {
+		condition.Status = corev1.ConditionTrue
+		condition.Reason = RootFilesystemNotGrownReason
+		condition.Message = fmt.Sprintf("Root filesystem of %s is smaller than the %s of ephemeral storage of the instance type, it may not have been grown to the OS disk", actual.String(), advertised.String())
+		log.FromContext(ctx).Info("root filesystem is smaller than the advertised ephemeral storage", "Node", node.Name, "capacity", actual.String(), "advertised", advertised.String())
+	}
+	stored := node.DeepCopy()
+	node.Status.Conditions = append(node.Status.Conditions, condition)
+	// the kubelet updates the conditions of the node concurrently
+	if err := c.kubeClient.Status().Patch(ctx, node, client.MergeFromWithOptions(stored, client.MergeFromWithOptimisticLock{})); err != nil {
+		return reconcile.Result{}, client.IgnoreNotFound(err)
+	}
+	return reconcile.Result{}, nil
+}
+
+func (c *Controller) Register(_ context.Context, m manager.Manager) error {
+	return controllerruntime.NewControllerManagedBy(m).
+		Named("nodeclaim.rootfilesystem").
+		For(&karpv1.NodeClaim{}).
+		WithOptions(controller.Options{
+			RateLimiter:             reasonable.RateLimiter(),
+			MaxConcurrentReconciles: 10,
+		}).
+		Complete(reconcile.AsReconciler(m.GetClient(), c))
+}
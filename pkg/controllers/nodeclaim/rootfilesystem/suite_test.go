@@ -0,0 +1,126 @@
+/*
+Portions Copyright (c) Microsoft Corporation.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package rootfilesystem_test
+
+import (
+	"context"
+	"testing"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	karpv1 "sigs.k8s.io/karpenter/pkg/apis/v1"
+	coreoptions "sigs.k8s.io/karpenter/pkg/operator/options"
+	coretest "sigs.k8s.io/karpenter/pkg/test"
+	. "sigs.k8s.io/karpenter/pkg/test/expectations"
+	"sigs.k8s.io/karpenter/pkg/test/v1alpha1"
+	. "sigs.k8s.io/karpenter/pkg/utils/testing"
+
+	"github.com/Azure/karpenter-provider-azure/pkg/apis"
+	"github.com/Azure/karpenter-provider-azure/pkg/controllers/nodeclaim/rootfilesystem"
+	"github.com/Azure/karpenter-provider-azure/pkg/operator/options"
+	"github.com/Azure/karpenter-provider-azure/pkg/test"
+)
+
+var ctx context.Context
+var env *coretest.Environment
+var rootFilesystemController *rootfilesystem.Controller
+
+func TestRootFilesystem(t *testing.T) {
+	ctx = TestContextWithLogger(t)
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Controllers/RootFilesystem")
+}
+
+var _ = BeforeSuite(func() {
+	ctx = coreoptions.ToContext(ctx, coretest.Options())
+	ctx = options.ToContext(ctx, test.Options())
+	env = coretest.NewEnvironment(coretest.WithCRDs(apis.CRDs...), coretest.WithCRDs(v1alpha1.CRDs...))
+	rootFilesystemController = rootfilesystem.NewController(env.Client)
+})
+
+var _ = AfterSuite(func() {
+	Expect(env.Stop()).To(Succeed(), "Failed to stop environment")
+})
+
+var _ = Describe("Root Filesystem", func() {
+	var nodeClaim *karpv1.NodeClaim
+	var node *corev1.Node
+
+	rootFilesystemCondition := func() *corev1.NodeCondition {
+		node = ExpectExists(ctx, env.Client, node)
+		for i := range node.Status.Conditions {
+			if node.Status.Conditions[i].Type == rootfilesystem.ConditionTypeRootFilesystemUndersized {
+				return &node.Status.Conditions[i]
+			}
+		}
+		return nil
+	}
+
+	BeforeEach(func() {
+		node = coretest.Node(coretest.NodeOptions{
+			Capacity: corev1.ResourceList{corev1.ResourceEphemeralStorage: resource.MustParse("503Gi")},
+		})
+		nodeClaim = coretest.NodeClaim(karpv1.NodeClaim{
+			Status: karpv1.NodeClaimStatus{
+				NodeName: node.Name,
+				Capacity: corev1.ResourceList{corev1.ResourceEphemeralStorage: resource.MustParse("512G")},
+			},
+		})
+	})
+
+	AfterEach(func() {
+		ExpectCleanedUp(ctx, env.Client)
+	})
+
+	It("should report a root filesystem grown to the OS disk", func() {
+		ExpectApplied(ctx, env.Client, nodeClaim, node)
+		ExpectObjectReconciled(ctx, env.Client, rootFilesystemController, nodeClaim)
+
+		condition := rootFilesystemCondition()
+		Expect(condition).ToNot(BeNil())
+		Expect(condition.Status).To(Equal(corev1.ConditionFalse))
+		Expect(condition.Reason).To(Equal(rootfilesystem.RootFilesystemGrownReason))
+	})
+	It("should report a root filesystem smaller than the advertised ephemeral storage", func() {
+		node.Status.Capacity[corev1.ResourceEphemeralStorage] = resource.MustParse("100Gi")
+		ExpectApplied(ctx, env.Client, nodeClaim, node)
+		ExpectObjectReconciled(ctx, env.Client, rootFilesystemController, nodeClaim)
+
+		condition := rootFilesystemCondition()
+		Expect(condition).ToNot(BeNil())
+		Expect(condition.Status).To(Equal(corev1.ConditionTrue))
+		Expect(condition.Reason).To(Equal(rootfilesystem.RootFilesystemNotGrownReason))
+		Expect(condition.Message).To(ContainSubstring("100Gi"))
+	})
+	It("should wait for the kubelet to report the capacity of the node", func() {
+		delete(node.Status.Capacity, corev1.ResourceEphemeralStorage)
+		ExpectApplied(ctx, env.Client, nodeClaim, node)
+		result := ExpectObjectReconciled(ctx, env.Client, rootFilesystemController, nodeClaim)
+
+		Expect(result.RequeueAfter).ToNot(BeZero())
+		Expect(rootFilesystemCondition()).To(BeNil())
+	})
+	It("should not report on the nodes of nodeclaims that aren't registered", func() {
+		nodeClaim.Status.NodeName = ""
+		ExpectApplied(ctx, env.Client, nodeClaim, node)
+		ExpectObjectReconciled(ctx, env.Client, rootFilesystemController, nodeClaim)
+
+		Expect(rootFilesystemCondition()).To(BeNil())
+	})
+})
@@ -0,0 +1,147 @@
+/*
+Portions Copyright (c) Microsoft Corporation.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package tagbackfill
+
+import (
+	"context"
+	"fmt"
+	"maps"
+
+	"github.com/awslabs/operatorpkg/singleton"
+	"github.com/samber/lo"
+	"go.uber.org/multierr"
+	"k8s.io/apimachinery/pkg/util/sets"
+	controllerruntime "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/manager"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+	karpv1 "sigs.k8s.io/karpenter/pkg/apis/v1"
+	"sigs.k8s.io/karpenter/pkg/operator/injection"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/compute/armcompute/v7"
+	"github.com/Azure/karpenter-provider-azure/pkg/operator/options"
+	"github.com/Azure/karpenter-provider-azure/pkg/providers/instance"
+	"github.com/Azure/karpenter-provider-azure/pkg/providers/launchtemplate"
+)
+
+// Controller back-fills the cluster and nodeclass tags onto the VMs and NICs created before those tags were applied.
+// Listing and garbage collection only consider resources with the cluster tag, so without it these would be orphaned.
+// The back-fill runs once on startup, and is retried until it succeeds.
+type Controller struct {
+	kubeClient         client.Client
+	vmInstanceProvider instance.VMProvider
+}
+
+func NewController(kubeClient client.Client, vmInstanceProvider instance.VMProvider) *Controller {
+	return &Controller{
+		kubeClient:         kubeClient,
+		vmInstanceProvider: vmInstanceProvider,
+	}
+}
+
+func (c *Controller) Reconcile(ctx context.Context) (reconcile.Result, error) {
+	ctx = injection.WithControllerName(ctx, "nodeclaim.tagbackfill")
+
+	nodeClassNames, err := c.nodeClassNamesByResourceName(ctx)
+	if err != nil {
+		return reconcile.Result{}, err
+	}
+	vms, err := c.vmInstanceProvider.ListUntagged(ctx)
+	if err != nil {
+		return reconcile.Result{}, fmt.Errorf("listing untagged VMs: %w", err)
+	}
+	nics, err := c.vmInstanceProvider.ListUntaggedNics(ctx)
+	if err != nil {
+		return reconcile.Result{}, fmt.Errorf("listing untagged NICs: %w", err)
+	}
+
+	var errs error
+	// The NIC of a VM is tagged along with the VM
+	taggedVMs := sets.New[string]()
+	for _, vm := range vms {
+		vmName := lo.FromPtr(vm.Name)
+		tags, ok := backfilledTags(ctx, vm.Tags, nodeClassNames[vmName])
+		if !ok {
+			continue
+		}
+		if err := c.vmInstanceProvider.Update(ctx, vmName, armcompute.VirtualMachineUpdate{Tags: tags}); err != nil {
+			errs = multierr.Append(errs, fmt.Errorf("back-filling tags of VM %q: %w", vmName, err))
+			continue
+		}
+		taggedVMs.Insert(vmName)
+		log.FromContext(ctx).Info("back-filled tags of VM", "vmName", vmName)
+	}
+	for _, nic := range nics {
+		nicName := lo.FromPtr(nic.Name)
+		if taggedVMs.Has(nicName) {
+			continue
+		}
+		tags, ok := backfilledTags(ctx, nic.Tags, nodeClassNames[nicName])
+		if !ok {
+			continue
+		}
+		if err := c.vmInstanceProvider.UpdateNicTags(ctx, nicName, tags); err != nil {
+			errs = multierr.Append(errs, fmt.Errorf("back-filling tags of NIC %q: %w", nicName, err))
+			continue
+		}
+		log.FromContext(ctx).Info("back-filled tags of NIC", "nicName", nicName)
+	}
+	if errs != nil {
+		return reconcile.Result{}, errs
+	}
+	// No requeue, the resources created from now on are tagged on creation
+	return reconcile.Result{}, nil
+}
+
+// nodeClassNamesByResourceName maps the resource names of the nodeclaims to the name of their nodeclass
+func (c *Controller) nodeClassNamesByResourceName(ctx context.Context) (map[string]string, error) {
+	nodeClaimList := &karpv1.NodeClaimList{}
+	if err := c.kubeClient.List(ctx, nodeClaimList); err != nil {
+		return nil, fmt.Errorf("listing NodeClaims for tag back-fill: %w", err)
+	}
+	nodeClassNames := map[string]string{}
+	for _, nodeClaim := range nodeClaimList.Items {
+		if nodeClaim.Spec.NodeClassRef != nil {
+			nodeClassNames[instance.GenerateResourceName(nodeClaim.Name)] = nodeClaim.Spec.NodeClassRef.Name
+		}
+	}
+	return nodeClassNames, nil
+}
+
+// backfilledTags returns the tags of a resource with the missing cluster and nodeclass tags added, and whether any
+// were missing. The nodeclass of resources without a nodeclaim is unknown, so those only get the cluster tag.
+func backfilledTags(ctx context.Context, tags map[string]*string, nodeClassName string) (map[string]*string, bool) {
+	backfilled := maps.Clone(tags)
+	if backfilled == nil {
+		backfilled = map[string]*string{}
+	}
+	if _, ok := backfilled[launchtemplate.KarpenterManagedTagKey]; !ok {
+		backfilled[launchtemplate.KarpenterManagedTagKey] = lo.ToPtr(options.FromContext(ctx).ClusterName)
+	}
+	if _, ok := backfilled[launchtemplate.NodeClassTagKey]; !ok && nodeClassName != "" {
+		backfilled[launchtemplate.NodeClassTagKey] = lo.ToPtr(nodeClassName)
+	}
+	return backfilled, len(backfilled) != len(tags)
+}
+
+func (c *Controller) Register(_ context.Context, m manager.Manager) error {
+	return controllerruntime.NewControllerManagedBy(m).
+		Named("nodeclaim.tagbackfill").
+		WatchesRawSource(singleton.Source()).
+		Complete(singleton.AsReconciler(c))
+}
@@ -0,0 +1,156 @@
+/*
+Portions Copyright (c) Microsoft Corporation.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package tagbackfill_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/compute/armcompute/v7"
+	"github.com/awslabs/operatorpkg/object"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/samber/lo"
+	karpv1 "sigs.k8s.io/karpenter/pkg/apis/v1"
+	coreoptions "sigs.k8s.io/karpenter/pkg/operator/options"
+	coretest "sigs.k8s.io/karpenter/pkg/test"
+	. "sigs.k8s.io/karpenter/pkg/test/expectations"
+	"sigs.k8s.io/karpenter/pkg/test/v1alpha1"
+	. "sigs.k8s.io/karpenter/pkg/utils/testing"
+
+	"github.com/Azure/karpenter-provider-azure/pkg/apis"
+	"github.com/Azure/karpenter-provider-azure/pkg/apis/v1beta1"
+	"github.com/Azure/karpenter-provider-azure/pkg/controllers/nodeclaim/tagbackfill"
+	"github.com/Azure/karpenter-provider-azure/pkg/fake"
+	"github.com/Azure/karpenter-provider-azure/pkg/operator/options"
+	"github.com/Azure/karpenter-provider-azure/pkg/providers/instance"
+	"github.com/Azure/karpenter-provider-azure/pkg/providers/launchtemplate"
+	"github.com/Azure/karpenter-provider-azure/pkg/test"
+	. "github.com/Azure/karpenter-provider-azure/pkg/test/expectations"
+)
+
+var ctx context.Context
+var env *coretest.Environment
+var azureEnv *test.Environment
+var tagBackfillController *tagbackfill.Controller
+
+func TestTagBackfill(t *testing.T) {
+	ctx = TestContextWithLogger(t)
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Controllers/TagBackfill")
+}
+
+var _ = BeforeSuite(func() {
+	ctx = coreoptions.ToContext(ctx, coretest.Options())
+	ctx = options.ToContext(ctx, test.Options())
+	env = coretest.NewEnvironment(coretest.WithCRDs(apis.CRDs...), coretest.WithCRDs(v1alpha1.CRDs...))
+	azureEnv = test.NewEnvironment(ctx, env)
+	tagBackfillController = tagbackfill.NewController(env.Client, azureEnv.VMInstanceProvider)
+})
+
+var _ = AfterSuite(func() {
+	Expect(env.Stop()).To(Succeed(), "Failed to stop environment")
+})
+
+var _ = Describe("Tag Backfill", func() {
+	var nodeClass *v1beta1.AKSNodeClass
+	var nodeClaim *karpv1.NodeClaim
+
+	BeforeEach(func() {
+		nodeClass = test.AKSNodeClass()
+		nodeClaim = coretest.NodeClaim(karpv1.NodeClaim{
+			Spec: karpv1.NodeClaimSpec{
+				NodeClassRef: &karpv1.NodeClassReference{
+					Group: object.GVK(nodeClass).Group,
+					Kind:  object.GVK(nodeClass).Kind,
+					Name:  nodeClass.Name,
+				},
+			},
+		})
+		azureEnv.Reset()
+	})
+
+	AfterEach(func() {
+		ExpectCleanedUp(ctx, env.Client)
+	})
+
+	It("should back-fill the cluster and nodeclass tags onto the VM and NIC of a nodeclaim", func() {
+		vmName := instance.GenerateResourceName(nodeClaim.Name)
+		untaggedTags := map[string]*string{launchtemplate.NodePoolTagKey: lo.ToPtr("default")}
+		vm := test.VirtualMachine(test.VirtualMachineOptions{Name: vmName, Tags: untaggedTags})
+		nic := test.Interface(test.InterfaceOptions{Name: vmName, Tags: untaggedTags})
+		azureEnv.VirtualMachinesAPI.Instances.Store(lo.FromPtr(vm.ID), *vm)
+		azureEnv.NetworkInterfacesAPI.NetworkInterfaces.Store(lo.FromPtr(nic.ID), *nic)
+		billingExt := armcompute.VirtualMachineExtension{
+			ID:   lo.ToPtr(fake.MakeVMExtensionID(azureEnv.AzureResourceGraphAPI.ResourceGroup, vmName, "computeAksLinuxBilling")),
+			Name: lo.ToPtr("computeAksLinuxBilling"),
+			Tags: untaggedTags,
+		}
+		azureEnv.VirtualMachineExtensionsAPI.Extensions.Store(lo.FromPtr(billingExt.ID), billingExt)
+		ExpectApplied(ctx, env.Client, nodeClaim)
+
+		ExpectSingletonReconciled(ctx, tagBackfillController)
+
+		ExpectInstanceResourcesHaveTags(ctx, vmName, azureEnv, map[string]*string{
+			launchtemplate.NodePoolTagKey:         lo.ToPtr("default"),
+			launchtemplate.KarpenterManagedTagKey: lo.ToPtr("test-cluster"),
+			launchtemplate.NodeClassTagKey:        lo.ToPtr(nodeClass.Name),
+		})
+		vms, err := azureEnv.VMInstanceProvider.List(ctx)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(vms).To(HaveLen(1))
+		// The NIC is tagged along with the VM
+		Expect(azureEnv.NetworkInterfacesAPI.NetworkInterfacesUpdateTagsBehavior.CalledWithInput.Len()).To(Equal(1))
+	})
+	It("should back-fill only the cluster tag onto a NIC without a nodeclaim, so that it is garbage collected", func() {
+		nic := test.Interface(test.InterfaceOptions{Tags: map[string]*string{launchtemplate.NodePoolTagKey: lo.ToPtr("default")}})
+		azureEnv.NetworkInterfacesAPI.NetworkInterfaces.Store(lo.FromPtr(nic.ID), *nic)
+
+		nics, err := azureEnv.VMInstanceProvider.ListNics(ctx)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(nics).To(BeEmpty())
+
+		ExpectSingletonReconciled(ctx, tagBackfillController)
+
+		nics, err = azureEnv.VMInstanceProvider.ListNics(ctx)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(nics).To(HaveLen(1))
+		Expect(nics[0].Tags).To(Equal(map[string]*string{
+			launchtemplate.NodePoolTagKey:         lo.ToPtr("default"),
+			launchtemplate.KarpenterManagedTagKey: lo.ToPtr("test-cluster"),
+		}))
+	})
+	It("should not update resources that are tagged, or of another cluster", func() {
+		taggedVM := test.VirtualMachine(test.VirtualMachineOptions{
+			Name: instance.GenerateResourceName(nodeClaim.Name),
+			Tags: lo.Assign(test.ManagedTags("default"), map[string]*string{launchtemplate.NodeClassTagKey: lo.ToPtr(nodeClass.Name)}),
+		})
+		otherClusterVM := test.VirtualMachine(test.VirtualMachineOptions{Tags: map[string]*string{
+			launchtemplate.NodePoolTagKey:         lo.ToPtr("default"),
+			launchtemplate.KarpenterManagedTagKey: lo.ToPtr("other-cluster"),
+		}})
+		for _, vm := range []*armcompute.VirtualMachine{taggedVM, otherClusterVM} {
+			azureEnv.VirtualMachinesAPI.Instances.Store(lo.FromPtr(vm.ID), *vm)
+		}
+		ExpectApplied(ctx, env.Client, nodeClaim)
+
+		ExpectSingletonReconciled(ctx, tagBackfillController)
+
+		Expect(azureEnv.VirtualMachinesAPI.VirtualMachineUpdateBehavior.Calls()).To(Equal(0))
+		Expect(azureEnv.NetworkInterfacesAPI.NetworkInterfacesUpdateTagsBehavior.Calls()).To(Equal(0))
+	})
+})
@@ -0,0 +1,240 @@
+/*
+Portions Copyright (c) Microsoft Corporation.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package tagdrift
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"sort"
+
+	sdkerrors "github.com/Azure/azure-sdk-for-go-extensions/pkg/errors"
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/arm"
+	"github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/compute/armcompute/v7"
+	"github.com/awslabs/operatorpkg/singleton"
+	"github.com/samber/lo"
+	controllerruntime "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/manager"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+	karpv1 "sigs.k8s.io/karpenter/pkg/apis/v1"
+	corecloudprovider "sigs.k8s.io/karpenter/pkg/cloudprovider"
+	"sigs.k8s.io/karpenter/pkg/operator/injection"
+
+	"github.com/Azure/karpenter-provider-azure/pkg/consts"
+	"github.com/Azure/karpenter-provider-azure/pkg/metrics"
+	"github.com/Azure/karpenter-provider-azure/pkg/operator/options"
+	"github.com/Azure/karpenter-provider-azure/pkg/providers/instance"
+	"github.com/Azure/karpenter-provider-azure/pkg/providers/launchtemplate"
+	nodeclaimutils "github.com/Azure/karpenter-provider-azure/pkg/utils/nodeclaim"
+	armopts "github.com/Azure/karpenter-provider-azure/pkg/utils/opts"
+)
+
+const (
+	resourceTypeVM   = "VirtualMachine"
+	resourceTypeNIC  = "NetworkInterface"
+	resourceTypeDisk = "Disk"
+)
+
+// Controller periodically compares the tags of the VMs, NICs and managed OS disks of the nodeclaims with the tags
+// Karpenter sets on them: the additional tags, the tags of their nodeclass and the Karpenter identity tags. Manual edits
+// and policy remediations change or remove these, which breaks cost allocation and the listing and garbage collection
+// of the resources. The drifted resources are reported, and with the Repair mode their tags are patched in place, up to
+// a number of repairs per check and while the ARM budget isn't low. Tags Karpenter doesn't set are left as is.
+type Controller struct {
+	kubeClient         client.Client
+	vmInstanceProvider instance.VMProvider
+}
+
+func NewController(kubeClient client.Client, vmInstanceProvider instance.VMProvider) *Controller {
+	return &Controller{
+		kubeClient:         kubeClient,
+		vmInstanceProvider: vmInstanceProvider,
+	}
+}
+
+// check is the state of a tag drift check
+type check struct {
+	repair bool
+	// repairs is the number of repairs left in the check
+	repairs  int
+	drifted  map[string]int
+	repaired map[string]int
+}
+
+func (c *Controller) Reconcile(ctx context.Context) (reconcile.Result, error) {
+	ctx = injection.WithControllerName(ctx, "nodeclaim.tagdrift")
+	opts := options.FromContext(ctx)
+
+	nodeClaimList := &karpv1.NodeClaimList{}
+	if err := c.kubeClient.List(ctx, nodeClaimList); err != nil {
+		return reconcile.Result{}, fmt.Errorf("listing NodeClaims for tag drift: %w", err)
+	}
+	nodeClaims := lo.Filter(nodeClaimList.Items, func(nodeClaim karpv1.NodeClaim, _ int) bool {
+		return nodeClaim.DeletionTimestamp.IsZero() && nodeClaim.Status.ProviderID != "" &&
+			nodeClaim.StatusConditions().Get(karpv1.ConditionTypeRegistered).IsTrue()
+	})
+	// the oldest nodeclaims first, so that the repairs deferred to the next checks always make progress
+	sort.Slice(nodeClaims, func(i, j int) bool {
+		return nodeClaims[i].CreationTimestamp.Before(&nodeClaims[j].CreationTimestamp)
+	})
+
+	chk := &check{
+		repair:   opts.TagDriftMode == consts.TagDriftModeRepair,
+		repairs:  opts.TagDriftMaxRepairs,
+		drifted:  map[string]int{},
+		repaired: map[string]int{},
+	}
+	for i := range nodeClaims {
+		if err := c.checkNodeClaim(ctx, chk, &nodeClaims[i]); err != nil {
+			log.FromContext(ctx).Error(err, "failed to check tag drift", "NodeClaim", nodeClaims[i].Name)
+		}
+	}
+	metrics.TagDriftDriftedResources.Reset()
+	metrics.TagDriftRepairedResources.Reset()
+	for _, resourceType := range []string{resourceTypeVM, resourceTypeNIC, resourceTypeDisk} {
+		metrics.TagDriftDriftedResources.WithLabelValues(resourceType).Set(float64(chk.drifted[resourceType]))
+		metrics.TagDriftRepairedResources.WithLabelValues(resourceType).Set(float64(chk.repaired[resourceType]))
+	}
+	return reconcile.Result{RequeueAfter: armopts.RateLimits.BackgroundInterval(opts.TagDriftInterval)}, nil
+}
+
+// checkNodeClaim checks the tags of the VM of the nodeclaim, its NIC and its managed OS disk. Resources that are gone
+// are skipped, garbage collection and the termination of the nodeclaim take care of those.
+func (c *Controller) checkNodeClaim(ctx context.Context, chk *check, nodeClaim *karpv1.NodeClaim) error {
+	nodeClass, err := nodeclaimutils.GetAKSNodeClass(ctx, c.kubeClient, nodeClaim)
+	if err != nil {
+		return client.IgnoreNotFound(err)
+	}
+	vm, err := nodeclaimutils.GetVM(ctx, c.vmInstanceProvider, nodeClaim)
+	if err != nil {
+		return corecloudprovider.IgnoreNodeClaimNotFoundError(err)
+	}
+	vmName := lo.FromPtr(vm.Name)
+	expected := launchtemplate.Tags(options.FromContext(ctx), nodeClass, nodeClaim)
+
+	// The NIC of a VM is tagged along with the VM
+	vmRepaired, err := c.checkResource(ctx, chk, resourceTypeVM, vmName, vm.Tags, expected, func(tags map[string]*string) error {
+		return c.vmInstanceProvider.Update(ctx, vmName, armcompute.VirtualMachineUpdate{Tags: tags})
+	})
+	if err != nil {
+		return err
+	}
+	if !vmRepaired {
+		// the NIC is in the resource group of its VM
+		resourceGroup := options.FromContext(ctx).NodeResourceGroup
+		if id, err := arm.ParseResourceID(lo.FromPtr(vm.ID)); err == nil {
+			resourceGroup = id.ResourceGroupName
+		}
+		nic, err := c.vmInstanceProvider.GetNic(ctx, resourceGroup, vmName)
+		if err != nil && !sdkerrors.IsNotFoundErr(err) {
+			return fmt.Errorf("getting NIC %q: %w", vmName, err)
+		}
+		if nic != nil {
+			if _, err := c.checkResource(ctx, chk, resourceTypeNIC, vmName, nic.Tags, expected, func(tags map[string]*string) error {
+				return c.vmInstanceProvider.UpdateNicTags(ctx, vmName, tags)
+			}); err != nil {
+				return err
+			}
+		}
+	}
+
+	diskName, ok := managedOSDiskName(vm)
+	if !ok {
+		return nil
+	}
+	disk, err := c.vmInstanceProvider.GetDisk(ctx, diskName)
+	if err != nil {
+		if sdkerrors.IsNotFoundErr(err) {
+			return nil
+		}
+		return fmt.Errorf("getting disk %q: %w", diskName, err)
+	}
+	_, err = c.checkResource(ctx, chk, resourceTypeDisk, diskName, disk.Tags, expected, func(tags map[string]*string) error {
+		return c.vmInstanceProvider.UpdateDiskTags(ctx, diskName, tags)
+	})
+	return err
+}
+
+// checkResource reports the resource if its tags drifted, and repairs them if the check can. It returns whether they
+// were repaired.
+func (c *Controller) checkResource(ctx context.Context, chk *check, resourceType, name string, tags, expected map[string]*string,
+	update func(map[string]*string) error) (bool, error) {
+	drifted := driftedTagKeys(tags, expected)
+	if len(drifted) == 0 {
+		return false, nil
+	}
+	chk.drifted[resourceType]++
+	logger := log.FromContext(ctx).WithValues("resourceType", resourceType, "name", name, "tags", drifted)
+	if !chk.repair {
+		logger.Info("tags drifted")
+		return false, nil
+	}
+	if chk.repairs <= 0 || armopts.RateLimits.Low() {
+		logger.V(1).Info("tags drifted, deferring the repair to the next check")
+		return false, nil
+	}
+	chk.repairs--
+	if err := update(repairedTags(tags, expected)); err != nil {
+		return false, fmt.Errorf("repairing tags of %s %q: %w", resourceType, name, err)
+	}
+	chk.repaired[resourceType]++
+	logger.Info("repaired drifted tags")
+	return true, nil
+}
+
+// driftedTagKeys returns the sorted keys of the expected tags that are missing from the tags, or have another value
+func driftedTagKeys(tags, expected map[string]*string) []string {
+	var drifted []string
+	for key, value := range expected {
+		if current, ok := tags[key]; !ok || lo.FromPtr(current) != lo.FromPtr(value) {
+			drifted = append(drifted, key)
+		}
+	}
+	sort.Strings(drifted)
+	return drifted
+}
+
+// repairedTags returns the tags with the expected tags restored, keeping the tags Karpenter doesn't set
+func repairedTags(tags, expected map[string]*string) map[string]*string {
+	repaired := maps.Clone(tags)
+	if repaired == nil {
+		repaired = map[string]*string{}
+	}
+	maps.Copy(repaired, expected)
+	return repaired
+}
+
+// managedOSDiskName returns the name of the managed OS disk of the VM. Ephemeral OS disks aren't separate resources.
+func managedOSDiskName(vm *armcompute.VirtualMachine) (string, bool) {
+	if vm.Properties == nil || vm.Properties.StorageProfile == nil || vm.Properties.StorageProfile.OSDisk == nil {
+		return "", false
+	}
+	osDisk := vm.Properties.StorageProfile.OSDisk
+	if osDisk.DiffDiskSettings != nil || lo.FromPtr(osDisk.Name) == "" {
+		return "", false
+	}
+	return lo.FromPtr(osDisk.Name), true
+}
+
+func (c *Controller) Register(_ context.Context, m manager.Manager) error {
+	return controllerruntime.NewControllerManagedBy(m).
+		Named("nodeclaim.tagdrift").
+		WatchesRawSource(singleton.Source()).
+		Complete(singleton.AsReconciler(c))
+}
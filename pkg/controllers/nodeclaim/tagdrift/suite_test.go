@@ -0,0 +1,217 @@
+/*
+Portions Copyright (c) Microsoft Corporation.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package tagdrift_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/compute/armcompute/v7"
+	"github.com/awslabs/operatorpkg/object"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/samber/lo"
+	karpv1 "sigs.k8s.io/karpenter/pkg/apis/v1"
+	coreoptions "sigs.k8s.io/karpenter/pkg/operator/options"
+	coretest "sigs.k8s.io/karpenter/pkg/test"
+	. "sigs.k8s.io/karpenter/pkg/test/expectations"
+	"sigs.k8s.io/karpenter/pkg/test/v1alpha1"
+	. "sigs.k8s.io/karpenter/pkg/utils/testing"
+
+	"github.com/Azure/karpenter-provider-azure/pkg/apis"
+	"github.com/Azure/karpenter-provider-azure/pkg/apis/v1beta1"
+	"github.com/Azure/karpenter-provider-azure/pkg/consts"
+	"github.com/Azure/karpenter-provider-azure/pkg/controllers/nodeclaim/tagdrift"
+	"github.com/Azure/karpenter-provider-azure/pkg/fake"
+	"github.com/Azure/karpenter-provider-azure/pkg/operator/options"
+	"github.com/Azure/karpenter-provider-azure/pkg/providers/instance"
+	"github.com/Azure/karpenter-provider-azure/pkg/providers/launchtemplate"
+	"github.com/Azure/karpenter-provider-azure/pkg/test"
+	"github.com/Azure/karpenter-provider-azure/pkg/utils"
+)
+
+var ctx context.Context
+var env *coretest.Environment
+var azureEnv *test.Environment
+var tagDriftController *tagdrift.Controller
+
+func TestTagDrift(t *testing.T) {
+	ctx = TestContextWithLogger(t)
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Controllers/TagDrift")
+}
+
+var _ = BeforeSuite(func() {
+	ctx = coreoptions.ToContext(ctx, coretest.Options())
+	ctx = options.ToContext(ctx, test.Options())
+	env = coretest.NewEnvironment(coretest.WithCRDs(apis.CRDs...), coretest.WithCRDs(v1alpha1.CRDs...))
+	azureEnv = test.NewEnvironment(ctx, env)
+	tagDriftController = tagdrift.NewController(env.Client, azureEnv.VMInstanceProvider)
+})
+
+var _ = AfterSuite(func() {
+	Expect(env.Stop()).To(Succeed(), "Failed to stop environment")
+})
+
+var _ = Describe("Tag Drift", func() {
+	var nodeClass *v1beta1.AKSNodeClass
+	var nodeClaim *karpv1.NodeClaim
+	var vmName string
+	var expectedTags map[string]*string
+	var driftedTags map[string]*string
+
+	repairCtx := func(maxRepairs int) context.Context {
+		return options.ToContext(ctx, test.Options(test.OptionsFields{
+			TagDriftMode:       lo.ToPtr(consts.TagDriftModeRepair),
+			TagDriftMaxRepairs: lo.ToPtr(maxRepairs),
+		}))
+	}
+	// storeResources stores the VM of the nodeclaim, its NIC and its managed OS disk with the tags
+	storeResources := func(name string, tags map[string]*string) {
+		vm := test.VirtualMachine(test.VirtualMachineOptions{Name: name, Tags: tags, Properties: &armcompute.VirtualMachineProperties{
+			StorageProfile: &armcompute.StorageProfile{OSDisk: &armcompute.OSDisk{Name: lo.ToPtr(name)}},
+		}})
+		nic := test.Interface(test.InterfaceOptions{Name: name, Tags: tags})
+		azureEnv.VirtualMachinesAPI.Instances.Store(lo.FromPtr(vm.ID), *vm)
+		azureEnv.NetworkInterfacesAPI.NetworkInterfaces.Store(lo.FromPtr(nic.ID), *nic)
+		disk := armcompute.Disk{
+			ID:   lo.ToPtr(fake.MakeDiskID(azureEnv.AzureResourceGraphAPI.ResourceGroup, name)),
+			Name: lo.ToPtr(name),
+			Tags: tags,
+		}
+		azureEnv.DisksAPI.Disks.Store(lo.FromPtr(disk.ID), disk)
+		billingExt := armcompute.VirtualMachineExtension{
+			ID:   lo.ToPtr(fake.MakeVMExtensionID(azureEnv.AzureResourceGraphAPI.ResourceGroup, name, "computeAksLinuxBilling")),
+			Name: lo.ToPtr("computeAksLinuxBilling"),
+			Tags: tags,
+		}
+		azureEnv.VirtualMachineExtensionsAPI.Extensions.Store(lo.FromPtr(billingExt.ID), billingExt)
+	}
+	applyNodeClaim := func(nodeClaim *karpv1.NodeClaim) {
+		nodeClaim.Status.ProviderID = utils.VMResourceIDToProviderID(ctx, fake.MkVMID(azureEnv.AzureResourceGraphAPI.ResourceGroup, instance.GenerateResourceName(nodeClaim.Name)))
+		nodeClaim.StatusConditions().SetTrue(karpv1.ConditionTypeRegistered)
+		ExpectApplied(ctx, env.Client, nodeClaim)
+	}
+	newNodeClaim := func() *karpv1.NodeClaim {
+		return coretest.NodeClaim(karpv1.NodeClaim{
+			Spec: karpv1.NodeClaimSpec{
+				NodeClassRef: &karpv1.NodeClassReference{
+					Group: object.GVK(nodeClass).Group,
+					Kind:  object.GVK(nodeClass).Kind,
+					Name:  nodeClass.Name,
+				},
+			},
+		})
+	}
+
+	BeforeEach(func() {
+		azureEnv.Reset()
+		nodeClass = test.AKSNodeClass(v1beta1.AKSNodeClass{Spec: v1beta1.AKSNodeClassSpec{Tags: map[string]string{"cost-center": "platform"}}})
+		ExpectApplied(ctx, env.Client, nodeClass)
+		nodeClaim = newNodeClaim()
+		vmName = instance.GenerateResourceName(nodeClaim.Name)
+		expectedTags = launchtemplate.Tags(options.FromContext(ctx), nodeClass, nodeClaim)
+		// the nodeclass tag was changed and the cluster tag removed, and a policy added a tag of its own
+		driftedTags = lo.OmitByKeys(lo.Assign(expectedTags, map[string]*string{
+			"cost-center": lo.ToPtr("unknown"),
+			"policy":      lo.ToPtr("added"),
+		}), []string{launchtemplate.KarpenterManagedTagKey})
+		storeResources(vmName, driftedTags)
+		applyNodeClaim(nodeClaim)
+	})
+
+	AfterEach(func() {
+		ExpectCleanedUp(ctx, env.Client)
+	})
+
+	It("should only report drifted resources in the Report mode", func() {
+		ExpectSingletonReconciled(ctx, tagDriftController)
+
+		Expect(azureEnv.VirtualMachinesAPI.VirtualMachineUpdateBehavior.Calls()).To(Equal(0))
+		Expect(azureEnv.NetworkInterfacesAPI.NetworkInterfacesUpdateTagsBehavior.Calls()).To(Equal(0))
+		Expect(azureEnv.DisksAPI.DisksUpdateBehavior.Calls()).To(Equal(0))
+	})
+	It("should repair the tags of the VM, its NIC and its OS disk, keeping the tags Karpenter doesn't set", func() {
+		ExpectSingletonReconciled(repairCtx(20), tagDriftController)
+
+		repaired := lo.Assign(expectedTags, map[string]*string{"policy": lo.ToPtr("added")})
+		vm, err := azureEnv.VMInstanceProvider.Get(ctx, vmName)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(vm.Tags).To(Equal(repaired))
+		nic, err := azureEnv.NetworkInterfacesAPI.Get(ctx, azureEnv.AzureResourceGraphAPI.ResourceGroup, vmName, nil)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(nic.Tags).To(Equal(repaired))
+		disk, err := azureEnv.DisksAPI.Get(ctx, azureEnv.AzureResourceGraphAPI.ResourceGroup, vmName, nil)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(disk.Tags).To(Equal(repaired))
+		// The NIC is repaired along with the VM
+		Expect(azureEnv.NetworkInterfacesAPI.NetworkInterfacesUpdateTagsBehavior.Calls()).To(Equal(1))
+
+		// and nothing is left to repair
+		ExpectSingletonReconciled(repairCtx(20), tagDriftController)
+		Expect(azureEnv.VirtualMachinesAPI.VirtualMachineUpdateBehavior.Calls()).To(Equal(1))
+		Expect(azureEnv.DisksAPI.DisksUpdateBehavior.Calls()).To(Equal(1))
+	})
+	It("should repair a NIC whose tags drifted while those of its VM didn't", func() {
+		storeResources(vmName, expectedTags)
+		nic := test.Interface(test.InterfaceOptions{Name: vmName, Tags: driftedTags})
+		azureEnv.NetworkInterfacesAPI.NetworkInterfaces.Store(lo.FromPtr(nic.ID), *nic)
+
+		ExpectSingletonReconciled(repairCtx(20), tagDriftController)
+
+		Expect(azureEnv.VirtualMachinesAPI.VirtualMachineUpdateBehavior.Calls()).To(Equal(0))
+		Expect(azureEnv.DisksAPI.DisksUpdateBehavior.Calls()).To(Equal(0))
+		updated, err := azureEnv.NetworkInterfacesAPI.Get(ctx, azureEnv.AzureResourceGraphAPI.ResourceGroup, vmName, nil)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(updated.Tags).To(Equal(lo.Assign(expectedTags, map[string]*string{"policy": lo.ToPtr("added")})))
+	})
+	It("should defer the repairs beyond the maximum per check to the next checks", func() {
+		other := newNodeClaim()
+		storeResources(instance.GenerateResourceName(other.Name), driftedTags)
+		applyNodeClaim(other)
+
+		// the VM and OS disk of each nodeclaim, one check at a time
+		for repairs := 1; repairs <= 4; repairs++ {
+			ExpectSingletonReconciled(repairCtx(1), tagDriftController)
+			Expect(azureEnv.VirtualMachinesAPI.VirtualMachineUpdateBehavior.Calls() + azureEnv.DisksAPI.DisksUpdateBehavior.Calls()).To(Equal(repairs))
+		}
+		ExpectSingletonReconciled(repairCtx(1), tagDriftController)
+		Expect(azureEnv.VirtualMachinesAPI.VirtualMachineUpdateBehavior.Calls()).To(Equal(2))
+		Expect(azureEnv.DisksAPI.DisksUpdateBehavior.Calls()).To(Equal(2))
+	})
+	It("should skip ephemeral OS disks and nodeclaims that aren't registered", func() {
+		vm := test.VirtualMachine(test.VirtualMachineOptions{Name: vmName, Tags: expectedTags, Properties: &armcompute.VirtualMachineProperties{
+			StorageProfile: &armcompute.StorageProfile{OSDisk: &armcompute.OSDisk{
+				Name:             lo.ToPtr(vmName),
+				DiffDiskSettings: &armcompute.DiffDiskSettings{Option: lo.ToPtr(armcompute.DiffDiskOptionsLocal)},
+			}},
+		}})
+		azureEnv.VirtualMachinesAPI.Instances.Store(lo.FromPtr(vm.ID), *vm)
+		nic := test.Interface(test.InterfaceOptions{Name: vmName, Tags: expectedTags})
+		azureEnv.NetworkInterfacesAPI.NetworkInterfaces.Store(lo.FromPtr(nic.ID), *nic)
+		unregistered := newNodeClaim()
+		storeResources(instance.GenerateResourceName(unregistered.Name), driftedTags)
+		unregistered.Status.ProviderID = utils.VMResourceIDToProviderID(ctx, fake.MkVMID(azureEnv.AzureResourceGraphAPI.ResourceGroup, instance.GenerateResourceName(unregistered.Name)))
+		ExpectApplied(ctx, env.Client, unregistered)
+
+		ExpectSingletonReconciled(repairCtx(20), tagDriftController)
+
+		Expect(azureEnv.VirtualMachinesAPI.VirtualMachineUpdateBehavior.Calls()).To(Equal(0))
+		Expect(azureEnv.NetworkInterfacesAPI.NetworkInterfacesUpdateTagsBehavior.Calls()).To(Equal(0))
+		Expect(azureEnv.DisksAPI.DisksUpdateBehavior.Calls()).To(Equal(0))
+	})
+})
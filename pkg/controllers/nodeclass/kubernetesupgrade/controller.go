@@ -0,0 +1,120 @@
+/*
+Portions Copyright (c) Microsoft Corporation.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package kubernetesupgrade
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/awslabs/operatorpkg/singleton"
+	"go.uber.org/multierr"
+	"k8s.io/apimachinery/pkg/api/equality"
+	controllerruntime "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/manager"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+	"sigs.k8s.io/karpenter/pkg/operator/injection"
+
+	"github.com/Azure/karpenter-provider-azure/pkg/apis/v1beta1"
+	nodeclassstatus "github.com/Azure/karpenter-provider-azure/pkg/controllers/nodeclass/status"
+	"github.com/Azure/karpenter-provider-azure/pkg/providers/kubernetesversion"
+)
+
+// refreshInterval is how often the version of the API server is discovered, so that upgrades of the control plane are
+// noticed well before the cached version expires
+const refreshInterval = time.Minute
+
+// Controller detects upgrades of the control plane. The Kubernetes version of the AKSNodeClasses, which the nodes are
+// bootstrapped with, is the version of the API server, which is cached and checked for an upgrade as the nodeclasses
+// are requeued. Until then, new nodes would launch with the previous version. Instead, the version of the API server is
+// discovered regularly, and once it changed, the Kubernetes version of the nodeclasses is upgraded right away, which
+// resolves their images of the version and drifts the nodes of the previous version.
+type Controller struct {
+	kubeClient                client.Client
+	kubernetesVersionProvider kubernetesversion.KubernetesVersionProvider
+	kubernetesVersion         *nodeclassstatus.KubernetesVersionReconciler
+
+	// upgrading is whether the last upgrade of the nodeclasses failed, so that it's retried on the next reconcile, as
+	// the version is only reported as changed once
+	upgrading bool
+}
+
+func NewController(kubeClient client.Client, kubernetesVersionProvider kubernetesversion.KubernetesVersionProvider) *Controller {
+	return &Controller{
+		kubeClient:                kubeClient,
+		kubernetesVersionProvider: kubernetesVersionProvider,
+		kubernetesVersion:         nodeclassstatus.NewKubernetesVersionReconciler(kubernetesVersionProvider),
+	}
+}
+
+func (c *Controller) Reconcile(ctx context.Context) (reconcile.Result, error) {
+	ctx = injection.WithControllerName(ctx, "nodeclass.kubernetesupgrade")
+
+	changed, err := c.kubernetesVersionProvider.Refresh(ctx)
+	if err != nil {
+		return reconcile.Result{}, fmt.Errorf("discovering kubernetes version, %w", err)
+	}
+	if !changed && !c.upgrading {
+		return reconcile.Result{RequeueAfter: refreshInterval}, nil
+	}
+	if changed {
+		log.FromContext(ctx).Info("kubernetes version of the API server changed, updating the kubernetes version of the nodeclasses")
+		c.upgrading = true
+	}
+
+	nodeClassList := &v1beta1.AKSNodeClassList{}
+	if err := c.kubeClient.List(ctx, nodeClassList); err != nil {
+		return reconcile.Result{}, fmt.Errorf("listing AKSNodeClasses, %w", err)
+	}
+	var errs error
+	for i := range nodeClassList.Items {
+		if err := c.upgrade(ctx, &nodeClassList.Items[i]); err != nil {
+			errs = multierr.Append(errs, err)
+		}
+	}
+	c.upgrading = errs != nil
+	return reconcile.Result{RequeueAfter: refreshInterval}, errs
+}
+
+// upgrade updates the Kubernetes version of the nodeclass to the discovered one, like the nodeclass status controller
+// does once the nodeclass is requeued. The status controller then resolves the images of the version, as the update of
+// the status requeues the nodeclass.
+func (c *Controller) upgrade(ctx context.Context, nodeClass *v1beta1.AKSNodeClass) error {
+	if !nodeClass.DeletionTimestamp.IsZero() {
+		return nil
+	}
+	stored := nodeClass.DeepCopy()
+	if _, err := c.kubernetesVersion.Reconcile(ctx, nodeClass); err != nil {
+		return fmt.Errorf("updating kubernetes version of AKSNodeClass %q, %w", nodeClass.Name, err)
+	}
+	if equality.Semantic.DeepEqual(stored, nodeClass) {
+		return nil
+	}
+	if err := c.kubeClient.Status().Patch(ctx, nodeClass, client.MergeFromWithOptions(stored, client.MergeFromWithOptimisticLock{})); client.IgnoreNotFound(err) != nil {
+		return fmt.Errorf("patching kubernetes version of AKSNodeClass %q, %w", nodeClass.Name, err)
+	}
+	return nil
+}
+
+func (c *Controller) Register(_ context.Context, m manager.Manager) error {
+	return controllerruntime.NewControllerManagedBy(m).
+		Named("nodeclass.kubernetesupgrade").
+		WatchesRawSource(singleton.Source()).
+		Complete(singleton.AsReconciler(c))
+}
@@ -0,0 +1,150 @@
+/*
+Portions Copyright (c) Microsoft Corporation.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package kubernetesupgrade_test
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/samber/lo"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/interceptor"
+	coreoptions "sigs.k8s.io/karpenter/pkg/operator/options"
+	coretest "sigs.k8s.io/karpenter/pkg/test"
+	. "sigs.k8s.io/karpenter/pkg/test/expectations"
+	"sigs.k8s.io/karpenter/pkg/test/v1alpha1"
+	. "sigs.k8s.io/karpenter/pkg/utils/testing"
+
+	"github.com/Azure/karpenter-provider-azure/pkg/apis"
+	"github.com/Azure/karpenter-provider-azure/pkg/apis/v1beta1"
+	"github.com/Azure/karpenter-provider-azure/pkg/controllers/nodeclass/kubernetesupgrade"
+	"github.com/Azure/karpenter-provider-azure/pkg/operator/options"
+	"github.com/Azure/karpenter-provider-azure/pkg/test"
+)
+
+var ctx context.Context
+var env *coretest.Environment
+var kubernetesVersionProvider *fakeKubernetesVersionProvider
+var controller *kubernetesupgrade.Controller
+
+// fakeKubernetesVersionProvider discovers the version it's set to, as the version of envtest's API server can't change
+type fakeKubernetesVersionProvider struct {
+	version    string
+	discovered string
+}
+
+func (p *fakeKubernetesVersionProvider) KubeServerVersion(_ context.Context) (string, error) {
+	return p.version, nil
+}
+
+func (p *fakeKubernetesVersionProvider) Refresh(_ context.Context) (bool, error) {
+	changed := p.discovered != "" && p.discovered != p.version
+	p.discovered = p.version
+	return changed, nil
+}
+
+func TestKubernetesUpgrade(t *testing.T) {
+	ctx = TestContextWithLogger(t)
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Controllers/NodeClass/KubernetesUpgrade")
+}
+
+var _ = BeforeSuite(func() {
+	ctx = coreoptions.ToContext(ctx, coretest.Options())
+	ctx = options.ToContext(ctx, test.Options())
+	env = coretest.NewEnvironment(coretest.WithCRDs(apis.CRDs...), coretest.WithCRDs(v1alpha1.CRDs...))
+	kubernetesVersionProvider = &fakeKubernetesVersionProvider{}
+	controller = kubernetesupgrade.NewController(env.Client, kubernetesVersionProvider)
+})
+
+var _ = AfterSuite(func() {
+	Expect(env.Stop()).To(Succeed(), "Failed to stop environment")
+})
+
+var _ = Describe("Kubernetes Upgrade", func() {
+	var nodeClass *v1beta1.AKSNodeClass
+
+	BeforeEach(func() {
+		*kubernetesVersionProvider = fakeKubernetesVersionProvider{version: "1.31.2"}
+		// the version the controller starts with isn't an upgrade
+		ExpectSingletonReconciled(ctx, controller)
+
+		nodeClass = test.AKSNodeClass()
+		ExpectApplied(ctx, env.Client, nodeClass)
+		nodeClass.Status.KubernetesVersion = "1.31.2"
+		nodeClass.StatusConditions().SetTrue(v1beta1.ConditionTypeKubernetesVersionReady)
+		nodeClass.StatusConditions().SetTrue(v1beta1.ConditionTypeImagesReady)
+		ExpectApplied(ctx, env.Client, nodeClass)
+	})
+
+	AfterEach(func() {
+		ExpectCleanedUp(ctx, env.Client)
+	})
+
+	It("should upgrade the kubernetes version of the nodeclasses once the control plane is upgraded", func() {
+		kubernetesVersionProvider.version = "1.32.0"
+		ExpectSingletonReconciled(ctx, controller)
+
+		nodeClass = ExpectExists(ctx, env.Client, nodeClass)
+		Expect(nodeClass.Status.KubernetesVersion).To(Equal("1.32.0"))
+		Expect(nodeClass.StatusConditions().IsTrue(v1beta1.ConditionTypeKubernetesVersionReady)).To(BeTrue())
+		// the images of the version are resolved by the nodeclass status controller
+		Expect(nodeClass.StatusConditions().Get(v1beta1.ConditionTypeImagesReady).IsFalse()).To(BeTrue())
+	})
+	It("should retry the upgrade of the nodeclasses that failed to be patched", func() {
+		failed := false
+		upgradeController := kubernetesupgrade.NewController(interceptor.NewClient(lo.Must(client.NewWithWatch(env.Config, client.Options{Scheme: env.Client.Scheme()})), interceptor.Funcs{
+			SubResourcePatch: func(ctx context.Context, c client.Client, subResourceName string, obj client.Object, patch client.Patch, opts ...client.SubResourcePatchOption) error {
+				if !failed {
+					failed = true
+					return fmt.Errorf("failed to patch")
+				}
+				return c.SubResource(subResourceName).Patch(ctx, obj, patch, opts...)
+			},
+		}), kubernetesVersionProvider)
+
+		kubernetesVersionProvider.version = "1.32.0"
+		ExpectSingletonReconcileFailed(ctx, upgradeController)
+		Expect(ExpectExists(ctx, env.Client, nodeClass).Status.KubernetesVersion).To(Equal("1.31.2"))
+
+		// the version is unchanged since the last refresh, but the upgrade is retried
+		ExpectSingletonReconciled(ctx, upgradeController)
+		Expect(ExpectExists(ctx, env.Client, nodeClass).Status.KubernetesVersion).To(Equal("1.32.0"))
+	})
+	It("should keep the kubernetes version the nodeclass overrides", func() {
+		nodeClass.Spec.KubernetesVersion = lo.ToPtr("1.31.2")
+		ExpectApplied(ctx, env.Client, nodeClass)
+
+		kubernetesVersionProvider.version = "1.32.0"
+		ExpectSingletonReconciled(ctx, controller)
+
+		nodeClass = ExpectExists(ctx, env.Client, nodeClass)
+		Expect(nodeClass.Status.KubernetesVersion).To(Equal("1.31.2"))
+		Expect(nodeClass.StatusConditions().IsTrue(v1beta1.ConditionTypeImagesReady)).To(BeTrue())
+	})
+	It("should leave the nodeclasses to the status controller while the version is unchanged", func() {
+		nodeClass.Status.KubernetesVersion = "1.30.0"
+		ExpectApplied(ctx, env.Client, nodeClass)
+
+		ExpectSingletonReconciled(ctx, controller)
+
+		Expect(ExpectExists(ctx, env.Client, nodeClass).Status.KubernetesVersion).To(Equal("1.30.0"))
+	})
+})
@@ -22,12 +22,14 @@ import (
 	"go.uber.org/multierr"
 	"k8s.io/apimachinery/pkg/api/equality"
 	"k8s.io/client-go/kubernetes"
+	"k8s.io/utils/clock"
 	controllerruntime "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/controller"
 	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
 	"sigs.k8s.io/controller-runtime/pkg/manager"
 	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+	"sigs.k8s.io/karpenter/pkg/events"
 	"sigs.k8s.io/karpenter/pkg/operator/injection"
 
 	"sigs.k8s.io/karpenter/pkg/utils/result"
@@ -35,6 +37,7 @@ import (
 	"github.com/Azure/karpenter-provider-azure/pkg/apis/v1beta1"
 	"github.com/Azure/karpenter-provider-azure/pkg/providers/imagefamily"
 	"github.com/Azure/karpenter-provider-azure/pkg/providers/instance"
+	"github.com/Azure/karpenter-provider-azure/pkg/providers/instancetype"
 	"github.com/Azure/karpenter-provider-azure/pkg/providers/kubernetesversion"
 	"github.com/awslabs/operatorpkg/reasonable"
 )
@@ -46,9 +49,17 @@ type reconciler interface {
 type Controller struct {
 	kubeClient client.Client
 
-	kubernetesVersion *KubernetesVersionReconciler
-	nodeImage         *NodeImageReconciler
-	subnet            *SubnetReconciler
+	kubernetesVersion  *KubernetesVersionReconciler
+	nodeImage          *NodeImageReconciler
+	subnet             *SubnetReconciler
+	zones              *ZonesReconciler
+	subnetEgress       *SubnetEgressReconciler
+	subscription       *SubscriptionReconciler
+	kubeletIdentity    *KubeletIdentityReconciler
+	imageCompatibility *ImageCompatibilityReconciler
+	imageK8sVersion    *ImageKubernetesVersionReconciler
+	maintenanceWindow  *MaintenanceWindowReconciler
+	dataFreshness      *DataFreshnessReconciler
 }
 
 func NewController(
@@ -56,14 +67,25 @@ func NewController(
 	kubernetesVersionProvider kubernetesversion.KubernetesVersionProvider,
 	nodeImageProvider imagefamily.NodeImageProvider,
 	inClusterKubernetesInterface kubernetes.Interface,
-	subnetClient instance.SubnetsAPI,
+	azClient *instance.AZClient,
+	instanceTypeProvider instancetype.Provider,
+	recorder events.Recorder,
+	clk clock.Clock,
 ) *Controller {
 	return &Controller{
 		kubeClient: kubeClient,
 
-		kubernetesVersion: NewKubernetesVersionReconciler(kubernetesVersionProvider),
-		nodeImage:         NewNodeImageReconciler(nodeImageProvider, inClusterKubernetesInterface),
-		subnet:            NewSubnetReconciler(subnetClient),
+		kubernetesVersion:  NewKubernetesVersionReconciler(kubernetesVersionProvider),
+		nodeImage:          NewNodeImageReconciler(nodeImageProvider, inClusterKubernetesInterface, recorder),
+		subnet:             NewSubnetReconciler(azClient),
+		zones:              NewZonesReconciler(instanceTypeProvider, recorder),
+		subnetEgress:       NewSubnetEgressReconciler(kubeClient, azClient, instanceTypeProvider),
+		subscription:       NewSubscriptionReconciler(azClient),
+		kubeletIdentity:    NewKubeletIdentityReconciler(azClient),
+		imageCompatibility: NewImageCompatibilityReconciler(kubeClient, instanceTypeProvider, recorder),
+		imageK8sVersion:    NewImageKubernetesVersionReconciler(nodeImageProvider),
+		maintenanceWindow:  NewMaintenanceWindowReconciler(clk),
+		dataFreshness:      NewDataFreshnessReconciler(instanceTypeProvider, recorder),
 	}
 }
 
@@ -85,6 +107,17 @@ func (c *Controller) Reconcile(ctx context.Context, nodeClass *v1beta1.AKSNodeCl
 		c.kubernetesVersion,
 		c.nodeImage,
 		c.subnet,
+		// before the egress of the subnet, which is checked for the zones added to the region too
+		c.zones,
+		// after the subnet, as it checks the egress of the subnet once it's ready
+		c.subnetEgress,
+		c.subscription,
+		c.kubeletIdentity,
+		// after the images, as they check the images resolved by them
+		c.imageCompatibility,
+		c.imageK8sVersion,
+		c.maintenanceWindow,
+		c.dataFreshness,
 	} {
 		res, err := reconciler.Reconcile(ctx, nodeClass)
 		errs = multierr.Append(errs, err)
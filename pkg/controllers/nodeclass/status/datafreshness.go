@@ -0,0 +1,125 @@
+/*
+Portions Copyright (c) Microsoft Corporation.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package status
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/samber/lo"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+	"sigs.k8s.io/karpenter/pkg/events"
+
+	"github.com/Azure/karpenter-provider-azure/pkg/apis/v1beta1"
+	"github.com/Azure/karpenter-provider-azure/pkg/metrics"
+	"github.com/Azure/karpenter-provider-azure/pkg/operator/options"
+	"github.com/Azure/karpenter-provider-azure/pkg/providers/instancetype"
+	"github.com/Azure/karpenter-provider-azure/pkg/utils"
+)
+
+const (
+	dataFreshnessReconcilerName = "nodeclass.datafreshness"
+
+	// DataStaleSKUsReason is the reason of the DataStale condition while the SKUs of the subscription are stale, which
+	// pauses the launch of all offerings
+	DataStaleSKUsReason = "StaleSKUs"
+	// DataStalePricingReason is the reason of the DataStale condition while the prices of some instance types are stale
+	DataStalePricingReason = "StalePricing"
+
+	staleDataSourceOnDemandPrices = "on-demand-prices"
+	staleDataSourceSpotPrices     = "spot-prices"
+	staleDataSourceSKUs           = "skus"
+)
+
+// DataFreshnessReconciler surfaces the AKSNodeClasses whose instance types have pricing or SKU data older than the
+// strict-data-freshness option through the DataStale condition, events and the karpenter_nodeclass_stale_data metric.
+// The offerings of such instance types are unavailable, so pods stay pending rather than launching instances at an
+// unknown price, which would otherwise look like a capacity shortage. It's requeued often, as data goes stale with time.
+type DataFreshnessReconciler struct {
+	instanceTypeProvider instancetype.Provider
+	recorder             events.Recorder
+}
+
+func NewDataFreshnessReconciler(instanceTypeProvider instancetype.Provider, recorder events.Recorder) *DataFreshnessReconciler {
+	return &DataFreshnessReconciler{
+		instanceTypeProvider: instanceTypeProvider,
+		recorder:             recorder,
+	}
+}
+
+func (r *DataFreshnessReconciler) Reconcile(ctx context.Context, nodeClass *v1beta1.AKSNodeClass) (reconcile.Result, error) {
+	ctx = log.IntoContext(ctx, log.FromContext(ctx).WithName(dataFreshnessReconcilerName))
+
+	freshness := options.FromContext(ctx).StrictDataFreshness
+	if freshness <= 0 {
+		if err := nodeClass.StatusConditions().Clear(v1beta1.ConditionTypeDataStale); err != nil {
+			return reconcile.Result{}, fmt.Errorf("clearing %s condition, %w", v1beta1.ConditionTypeDataStale, err)
+		}
+		metrics.NodeClassStaleData.DeletePartialMatch(prometheus.Labels{metrics.NodeClassLabel: nodeClass.Name})
+		return reconcile.Result{}, nil
+	}
+
+	stale, err := r.instanceTypeProvider.StaleData(ctx, nodeClass)
+	if err != nil {
+		return reconcile.Result{}, fmt.Errorf("getting stale data, %w", err)
+	}
+	metrics.NodeClassStaleData.WithLabelValues(nodeClass.Name, staleDataSourceOnDemandPrices).Set(lo.Ternary(stale.OnDemandPrices.Len() > 0, 1.0, 0.0))
+	metrics.NodeClassStaleData.WithLabelValues(nodeClass.Name, staleDataSourceSpotPrices).Set(lo.Ternary(stale.SpotPrices.Len() > 0, 1.0, 0.0))
+	metrics.NodeClassStaleData.WithLabelValues(nodeClass.Name, staleDataSourceSKUs).Set(lo.Ternary(stale.SKUs, 1.0, 0.0))
+
+	if !stale.IsStale() {
+		if nodeClass.StatusConditions().Get(v1beta1.ConditionTypeDataStale) != nil {
+			log.FromContext(ctx).Info("pricing and SKU data refreshed, resuming provisioning")
+			r.recorder.Publish(DataRefreshedEvent(nodeClass))
+		}
+		if err := nodeClass.StatusConditions().Clear(v1beta1.ConditionTypeDataStale); err != nil {
+			return reconcile.Result{}, fmt.Errorf("clearing %s condition, %w", v1beta1.ConditionTypeDataStale, err)
+		}
+		return reconcile.Result{RequeueAfter: time.Minute}, nil
+	}
+
+	message := staleDataMessage(stale, freshness)
+	if nodeClass.StatusConditions().SetTrueWithReason(v1beta1.ConditionTypeDataStale, lo.Ternary(stale.SKUs, DataStaleSKUsReason, DataStalePricingReason), message) {
+		log.FromContext(ctx).Info("pausing provisioning of offerings with stale data",
+			"staleOnDemandPrices", stale.OnDemandPrices.Len(),
+			"staleSpotPrices", stale.SpotPrices.Len(),
+			"staleSKUs", stale.SKUs,
+		)
+	}
+	r.recorder.Publish(DataStaleEvent(nodeClass, message))
+	return reconcile.Result{RequeueAfter: time.Minute}, nil
+}
+
+// staleDataMessage explains which data is stale, and that the offerings launched with it are paused
+func staleDataMessage(stale *instancetype.StaleData, freshness time.Duration) string {
+	var staleData []string
+	if stale.SKUs {
+		staleData = append(staleData, fmt.Sprintf("the SKUs of the subscription, fetched at %s", stale.SKUsFetched.Format(time.RFC3339)))
+	}
+	if stale.OnDemandPrices.Len() > 0 {
+		staleData = append(staleData, fmt.Sprintf("the on-demand prices of %d instance type(s), %s", stale.OnDemandPrices.Len(), utils.PrettySlice(sets.List(stale.OnDemandPrices), 3)))
+	}
+	if stale.SpotPrices.Len() > 0 {
+		staleData = append(staleData, fmt.Sprintf("the spot prices of %d instance type(s), %s", stale.SpotPrices.Len(), utils.PrettySlice(sets.List(stale.SpotPrices), 3)))
+	}
+	return fmt.Sprintf("Provisioning is paused for the offerings whose data is older than the strict data freshness of %s, until it's refreshed: %s", freshness, strings.Join(staleData, "; "))
+}
@@ -0,0 +1,79 @@
+/*
+Portions Copyright (c) Microsoft Corporation.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package status_test
+
+import (
+	"context"
+	"time"
+
+	"github.com/samber/lo"
+
+	"github.com/Azure/karpenter-provider-azure/pkg/apis/v1beta1"
+	"github.com/Azure/karpenter-provider-azure/pkg/controllers/nodeclass/status"
+	"github.com/Azure/karpenter-provider-azure/pkg/operator/options"
+	"github.com/Azure/karpenter-provider-azure/pkg/test"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("NodeClass DataFreshness Status Controller", func() {
+	var (
+		dataFreshnessReconciler *status.DataFreshnessReconciler
+		strictCtx               context.Context
+	)
+
+	BeforeEach(func() {
+		dataFreshnessReconciler = status.NewDataFreshnessReconciler(azureEnv.InstanceTypesProvider, recorder)
+		test.ApplyDefaultStatus(nodeClass, env, false)
+		strictCtx = options.ToContext(ctx, test.Options(test.OptionsFields{StrictDataFreshness: lo.ToPtr(time.Hour)}))
+	})
+
+	It("should not set DataStale without strict data freshness", func() {
+		_, err := dataFreshnessReconciler.Reconcile(ctx, nodeClass)
+		Expect(err).ToNot(HaveOccurred())
+
+		Expect(nodeClass.StatusConditions().Get(v1beta1.ConditionTypeDataStale)).To(BeNil())
+		Expect(recorder.Calls("DataStale")).To(BeZero())
+	})
+
+	It("should set DataStale while the prices are the static ones", func() {
+		_, err := dataFreshnessReconciler.Reconcile(strictCtx, nodeClass)
+		Expect(err).ToNot(HaveOccurred())
+
+		condition := nodeClass.StatusConditions().Get(v1beta1.ConditionTypeDataStale)
+		Expect(condition.IsTrue()).To(BeTrue())
+		Expect(condition.Reason).To(Equal(status.DataStalePricingReason))
+		Expect(condition.Message).To(ContainSubstring("Provisioning is paused"))
+		Expect(recorder.Calls("DataStale")).To(Equal(1))
+	})
+
+	It("should clear DataStale once the prices are refreshed", func() {
+		_, err := dataFreshnessReconciler.Reconcile(strictCtx, nodeClass)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(nodeClass.StatusConditions().Get(v1beta1.ConditionTypeDataStale).IsTrue()).To(BeTrue())
+
+		prices := lo.SliceToMap(azureEnv.PricingProvider.InstanceTypes(), func(instanceType string) (string, float64) { return instanceType, 1.0 })
+		Expect(azureEnv.PricingProvider.UpdateOnDemandPricing(ctx, prices)).To(BeNil())
+		Expect(azureEnv.PricingProvider.UpdateSpotPricing(ctx, prices)).To(BeNil())
+
+		_, err = dataFreshnessReconciler.Reconcile(strictCtx, nodeClass)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(nodeClass.StatusConditions().Get(v1beta1.ConditionTypeDataStale)).To(BeNil())
+		Expect(recorder.Calls("DataRefreshed")).To(Equal(1))
+	})
+})
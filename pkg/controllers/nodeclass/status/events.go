@@ -0,0 +1,80 @@
+/*
+Portions Copyright (c) Microsoft Corporation.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package status
+
+import (
+	"fmt"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+
+	"sigs.k8s.io/karpenter/pkg/events"
+
+	"github.com/Azure/karpenter-provider-azure/pkg/apis/v1beta1"
+	"github.com/Azure/karpenter-provider-azure/pkg/utils"
+)
+
+func ImagesUnsatisfiableEvent(nodeClass *v1beta1.AKSNodeClass, nodePools []string) events.Event {
+	return events.Event{
+		InvolvedObject: nodeClass,
+		Type:           corev1.EventTypeWarning,
+		Reason:         "ImagesUnsatisfiable",
+		Message:        fmt.Sprintf("No instance types offered to NodePool(s) %s are compatible with the images of the AKSNodeClass", utils.PrettySlice(nodePools, 5)),
+		DedupeValues:   []string{string(nodeClass.UID), strings.Join(nodePools, ",")},
+	}
+}
+
+func ImagesUpdatedEvent(nodeClass *v1beta1.AKSNodeClass, imageIDs []string) events.Event {
+	return events.Event{
+		InvolvedObject: nodeClass,
+		Type:           corev1.EventTypeNormal,
+		Reason:         "ImagesUpdated",
+		Message:        fmt.Sprintf("Resolved images of the AKSNodeClass updated to %s", utils.PrettySlice(imageIDs, 5)),
+		DedupeValues:   []string{string(nodeClass.UID), strings.Join(imageIDs, ",")},
+	}
+}
+
+func DataStaleEvent(nodeClass *v1beta1.AKSNodeClass, message string) events.Event {
+	return events.Event{
+		InvolvedObject: nodeClass,
+		Type:           corev1.EventTypeWarning,
+		Reason:         "DataStale",
+		Message:        message,
+		DedupeValues:   []string{string(nodeClass.UID), message},
+	}
+}
+
+func DataRefreshedEvent(nodeClass *v1beta1.AKSNodeClass) events.Event {
+	return events.Event{
+		InvolvedObject: nodeClass,
+		Type:           corev1.EventTypeNormal,
+		Reason:         "DataRefreshed",
+		Message:        "Pricing and SKU data of the AKSNodeClass refreshed, provisioning resumed",
+		DedupeValues:   []string{string(nodeClass.UID)},
+	}
+}
+
+func ZonesAddedEvent(nodeClass *v1beta1.AKSNodeClass, zones []string) events.Event {
+	return events.Event{
+		InvolvedObject: nodeClass,
+		Type:           corev1.EventTypeNormal,
+		Reason:         "ZonesAdded",
+		Message: fmt.Sprintf("Zone(s) %s were added to the region, and are offered to the NodePools of the AKSNodeClass. "+
+			"Its subnet is regional and spans them, check the SubnetEgressUnavailable condition in case its NAT gateway doesn't", utils.PrettySlice(zones, 5)),
+		DedupeValues: []string{string(nodeClass.UID), strings.Join(zones, ",")},
+	}
+}
@@ -0,0 +1,128 @@
+/*
+Portions Copyright (c) Microsoft Corporation.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package status
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/samber/lo"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+	karpv1 "sigs.k8s.io/karpenter/pkg/apis/v1"
+	"sigs.k8s.io/karpenter/pkg/cloudprovider"
+	"sigs.k8s.io/karpenter/pkg/events"
+	"sigs.k8s.io/karpenter/pkg/scheduling"
+
+	"github.com/Azure/karpenter-provider-azure/pkg/apis"
+	"github.com/Azure/karpenter-provider-azure/pkg/apis/v1beta1"
+	"github.com/Azure/karpenter-provider-azure/pkg/metrics"
+	"github.com/Azure/karpenter-provider-azure/pkg/providers/instancetype"
+	"github.com/Azure/karpenter-provider-azure/pkg/utils"
+)
+
+const imageCompatibilityReconcilerName = "nodeclass.imagecompatibility"
+
+// ImageCompatibilityReconciler surfaces AKSNodeClasses whose images can't run on any of the instance types offered to a
+// NodePool referencing them, e.g. an image family without arm64 images used by an arm64-only NodePool. Pods for such a
+// NodePool would otherwise stay pending without any indication of why.
+type ImageCompatibilityReconciler struct {
+	kubeClient           client.Client
+	instanceTypeProvider instancetype.Provider
+	recorder             events.Recorder
+}
+
+func NewImageCompatibilityReconciler(kubeClient client.Client, instanceTypeProvider instancetype.Provider, recorder events.Recorder) *ImageCompatibilityReconciler {
+	return &ImageCompatibilityReconciler{
+		kubeClient:           kubeClient,
+		instanceTypeProvider: instanceTypeProvider,
+		recorder:             recorder,
+	}
+}
+
+func (r *ImageCompatibilityReconciler) Reconcile(ctx context.Context, nodeClass *v1beta1.AKSNodeClass) (reconcile.Result, error) {
+	ctx = log.IntoContext(ctx, log.FromContext(ctx).WithName(imageCompatibilityReconcilerName))
+
+	images, err := nodeClass.GetImages()
+	if err != nil {
+		// images that aren't ready are already surfaced through the ImagesReady condition
+		return reconcile.Result{}, nil //nolint:nilerr
+	}
+
+	incompatibleNodePools, err := r.incompatibleNodePools(ctx, nodeClass, images)
+	if err != nil {
+		return reconcile.Result{}, err
+	}
+	if len(incompatibleNodePools) == 0 {
+		if err := nodeClass.StatusConditions().Clear(v1beta1.ConditionTypeImagesUnsatisfiable); err != nil {
+			return reconcile.Result{}, fmt.Errorf("clearing %s condition, %w", v1beta1.ConditionTypeImagesUnsatisfiable, err)
+		}
+		metrics.ImageUnsatisfiableNodeClasses.DeleteLabelValues(nodeClass.Name)
+		return reconcile.Result{RequeueAfter: 5 * time.Minute}, nil
+	}
+
+	message := fmt.Sprintf("No instance types offered to NodePool(s) %s are compatible with the images of the AKSNodeClass", utils.PrettySlice(incompatibleNodePools, 5))
+	if nodeClass.StatusConditions().SetTrueWithReason(v1beta1.ConditionTypeImagesUnsatisfiable, "NoCompatibleInstanceTypes", message) {
+		log.FromContext(ctx).Info("images are not compatible with any offered instance type", "nodePools", incompatibleNodePools)
+	}
+	r.recorder.Publish(ImagesUnsatisfiableEvent(nodeClass, incompatibleNodePools))
+	metrics.ImageUnsatisfiableNodeClasses.WithLabelValues(nodeClass.Name).Set(1)
+	return reconcile.Result{RequeueAfter: 5 * time.Minute}, nil
+}
+
+// incompatibleNodePools returns the names of the NodePools referencing the AKSNodeClass for which none of the offered
+// instance types is compatible with one of the images
+func (r *ImageCompatibilityReconciler) incompatibleNodePools(ctx context.Context, nodeClass *v1beta1.AKSNodeClass, images []v1beta1.NodeImage) ([]string, error) {
+	nodePoolList := &karpv1.NodePoolList{}
+	if err := r.kubeClient.List(ctx, nodePoolList); err != nil {
+		return nil, fmt.Errorf("listing nodepools, %w", err)
+	}
+	nodePools := lo.Filter(nodePoolList.Items, func(nodePool karpv1.NodePool, _ int) bool {
+		ref := nodePool.Spec.Template.Spec.NodeClassRef
+		return ref != nil && ref.Group == apis.Group && ref.Kind == "AKSNodeClass" && ref.Name == nodeClass.Name
+	})
+	if len(nodePools) == 0 {
+		return nil, nil
+	}
+
+	instanceTypes, err := r.instanceTypeProvider.List(ctx, nodeClass)
+	if err != nil {
+		return nil, fmt.Errorf("listing instance types, %w", err)
+	}
+	imageRequirements := lo.Map(images, func(image v1beta1.NodeImage, _ int) scheduling.Requirements {
+		return scheduling.NewNodeSelectorRequirements(image.Requirements...)
+	})
+	compatibleInstanceTypes := lo.Filter(instanceTypes, func(instanceType *cloudprovider.InstanceType, _ int) bool {
+		return lo.ContainsBy(imageRequirements, func(requirements scheduling.Requirements) bool {
+			return instanceType.Requirements.Compatible(requirements, v1beta1.AllowUndefinedWellKnownAndRestrictedLabels) == nil
+		})
+	})
+
+	var incompatible []string
+	for _, nodePool := range nodePools {
+		requirements := scheduling.NewNodeSelectorRequirementsWithMinValues(nodePool.Spec.Template.Spec.Requirements...)
+		requirements.Add(scheduling.NewLabelRequirements(nodePool.Spec.Template.Labels).Values()...)
+		if !lo.ContainsBy(compatibleInstanceTypes, func(instanceType *cloudprovider.InstanceType) bool {
+			return requirements.Compatible(instanceType.Requirements, v1beta1.AllowUndefinedWellKnownAndRestrictedLabels) == nil
+		}) {
+			incompatible = append(incompatible, nodePool.Name)
+		}
+	}
+	return incompatible, nil
+}
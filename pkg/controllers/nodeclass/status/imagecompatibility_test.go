@@ -0,0 +1,115 @@
+/*
+Portions Copyright (c) Microsoft Corporation.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package status_test
+
+import (
+	"github.com/awslabs/operatorpkg/object"
+	corev1 "k8s.io/api/core/v1"
+	karpv1 "sigs.k8s.io/karpenter/pkg/apis/v1"
+	coretest "sigs.k8s.io/karpenter/pkg/test"
+
+	"github.com/Azure/karpenter-provider-azure/pkg/apis/v1beta1"
+	"github.com/Azure/karpenter-provider-azure/pkg/controllers/nodeclass/status"
+	"github.com/Azure/karpenter-provider-azure/pkg/test"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	. "sigs.k8s.io/karpenter/pkg/test/expectations"
+)
+
+var _ = Describe("NodeClass ImageCompatibility Status Controller", func() {
+	var (
+		imageCompatibilityReconciler *status.ImageCompatibilityReconciler
+		nodePool                     *karpv1.NodePool
+	)
+
+	BeforeEach(func() {
+		imageCompatibilityReconciler = status.NewImageCompatibilityReconciler(env.Client, azureEnv.InstanceTypesProvider, recorder)
+		test.ApplyDefaultStatus(nodeClass, env, false)
+		nodePool = coretest.NodePool(karpv1.NodePool{
+			Spec: karpv1.NodePoolSpec{
+				Template: karpv1.NodeClaimTemplate{
+					Spec: karpv1.NodeClaimTemplateSpec{
+						NodeClassRef: &karpv1.NodeClassReference{
+							Group: object.GVK(nodeClass).Group,
+							Kind:  object.GVK(nodeClass).Kind,
+							Name:  nodeClass.Name,
+						},
+						Requirements: []karpv1.NodeSelectorRequirementWithMinValues{{
+							NodeSelectorRequirement: corev1.NodeSelectorRequirement{
+								Key:      corev1.LabelArchStable,
+								Operator: corev1.NodeSelectorOpIn,
+								Values:   []string{karpv1.ArchitectureArm64},
+							},
+						}},
+					},
+				},
+			},
+		})
+	})
+
+	It("should not set ImagesUnsatisfiable when the images are compatible with the offered instance types", func() {
+		ExpectApplied(ctx, env.Client, nodePool)
+
+		_, err := imageCompatibilityReconciler.Reconcile(ctx, nodeClass)
+		Expect(err).ToNot(HaveOccurred())
+
+		Expect(nodeClass.StatusConditions().Get(v1beta1.ConditionTypeImagesUnsatisfiable)).To(BeNil())
+		Expect(recorder.Calls("ImagesUnsatisfiable")).To(BeZero())
+	})
+
+	It("should set ImagesUnsatisfiable when no offered instance type is compatible with the images", func() {
+		ExpectApplied(ctx, env.Client, nodePool)
+		// drop the arm64 image
+		nodeClass.Status.Images = nodeClass.Status.Images[:2]
+
+		_, err := imageCompatibilityReconciler.Reconcile(ctx, nodeClass)
+		Expect(err).ToNot(HaveOccurred())
+
+		condition := nodeClass.StatusConditions().Get(v1beta1.ConditionTypeImagesUnsatisfiable)
+		Expect(condition.IsTrue()).To(BeTrue())
+		Expect(condition.Message).To(ContainSubstring(nodePool.Name))
+		Expect(recorder.Calls("ImagesUnsatisfiable")).To(Equal(1))
+		// the condition is a warning, and doesn't affect readiness
+		Expect(nodeClass.StatusConditions().Root().IsTrue()).To(BeTrue())
+	})
+
+	It("should clear ImagesUnsatisfiable once the images are compatible again", func() {
+		ExpectApplied(ctx, env.Client, nodePool)
+		images := nodeClass.Status.Images
+		nodeClass.Status.Images = images[:2]
+		_, err := imageCompatibilityReconciler.Reconcile(ctx, nodeClass)
+		Expect(err).ToNot(HaveOccurred())
+
+		nodeClass.Status.Images = images
+		_, err = imageCompatibilityReconciler.Reconcile(ctx, nodeClass)
+		Expect(err).ToNot(HaveOccurred())
+
+		Expect(nodeClass.StatusConditions().Get(v1beta1.ConditionTypeImagesUnsatisfiable)).To(BeNil())
+	})
+
+	It("should ignore NodePools referencing other nodeclasses", func() {
+		nodePool.Spec.Template.Spec.NodeClassRef.Name = "other"
+		ExpectApplied(ctx, env.Client, nodePool)
+		nodeClass.Status.Images = nodeClass.Status.Images[:2]
+
+		_, err := imageCompatibilityReconciler.Reconcile(ctx, nodeClass)
+		Expect(err).ToNot(HaveOccurred())
+
+		Expect(nodeClass.StatusConditions().Get(v1beta1.ConditionTypeImagesUnsatisfiable)).To(BeNil())
+	})
+})
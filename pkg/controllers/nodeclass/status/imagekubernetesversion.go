@@ -0,0 +1,95 @@
+/*
+Portions Copyright (c) Microsoft Corporation.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package status
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/samber/lo"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	"github.com/Azure/karpenter-provider-azure/pkg/apis/v1beta1"
+	"github.com/Azure/karpenter-provider-azure/pkg/providers/imagefamily"
+)
+
+const imageKubernetesVersionReconcilerName = "nodeclass.imagekubernetesversion"
+
+// ImageKubernetesVersionReconciler surfaces AKSNodeClasses whose images don't support their Kubernetes version. The images
+// are updated along with Kubernetes upgrades, except while frozen by the image-freeze annotation or pinned to a custom
+// image version, and nodes launched from an image that doesn't support the Kubernetes version fail to join.
+type ImageKubernetesVersionReconciler struct {
+	nodeImageProvider imagefamily.NodeImageProvider
+}
+
+func NewImageKubernetesVersionReconciler(nodeImageProvider imagefamily.NodeImageProvider) *ImageKubernetesVersionReconciler {
+	return &ImageKubernetesVersionReconciler{
+		nodeImageProvider: nodeImageProvider,
+	}
+}
+
+func (r *ImageKubernetesVersionReconciler) Reconcile(ctx context.Context, nodeClass *v1beta1.AKSNodeClass) (reconcile.Result, error) {
+	ctx = log.IntoContext(ctx, log.FromContext(ctx).WithName(imageKubernetesVersionReconcilerName))
+
+	// images and kubernetes versions that aren't ready are already surfaced through their own conditions
+	images, err := nodeClass.GetImages()
+	if err != nil {
+		return reconcile.Result{}, nil //nolint:nilerr
+	}
+	kubernetesVersion, err := nodeClass.GetKubernetesVersion()
+	if err != nil {
+		return reconcile.Result{}, nil //nolint:nilerr
+	}
+
+	var unsupported []string
+	for _, image := range images {
+		supported, err := r.nodeImageProvider.KubernetesVersionRange(ctx, nodeClass, image.ID)
+		if err != nil {
+			return reconcile.Result{}, fmt.Errorf("getting kubernetes versions supported by image %s, %w", image.ID, err)
+		}
+		if err := imagefamily.ValidateKubernetesVersion(image.ID, kubernetesVersion, supported); err != nil {
+			unsupported = append(unsupported, err.Error())
+		}
+	}
+	if len(unsupported) == 0 {
+		if err := nodeClass.StatusConditions().Clear(v1beta1.ConditionTypeImagesKubernetesVersionUnsupported); err != nil {
+			return reconcile.Result{}, fmt.Errorf("clearing %s condition, %w", v1beta1.ConditionTypeImagesKubernetesVersionUnsupported, err)
+		}
+		return reconcile.Result{RequeueAfter: 5 * time.Minute}, nil
+	}
+
+	if nodeClass.StatusConditions().SetTrueWithReason(v1beta1.ConditionTypeImagesKubernetesVersionUnsupported, unsupportedKubernetesVersionReason(nodeClass), strings.Join(unsupported, "; ")) {
+		log.FromContext(ctx).Info("images do not support the kubernetes version", "kubernetesVersion", kubernetesVersion, "images", unsupported)
+	}
+	return reconcile.Result{RequeueAfter: 5 * time.Minute}, nil
+}
+
+// unsupportedKubernetesVersionReason returns why the images of the AKSNodeClass weren't updated for its Kubernetes version
+func unsupportedKubernetesVersionReason(nodeClass *v1beta1.AKSNodeClass) string {
+	switch {
+	case nodeClass.IsImageFrozen():
+		return "ImagesFrozen"
+	case lo.FromPtr(nodeClass.Spec.ImageFamily) == v1beta1.CustomImageFamily &&
+		lo.ContainsBy(nodeClass.CustomImageTerms(), func(imageTerm v1beta1.CustomImageTerm) bool { return imageTerm.Version != "" }):
+		return "ImageVersionPinned"
+	default:
+		return "UnsupportedKubernetesVersion"
+	}
+}
@@ -0,0 +1,83 @@
+/*
+Portions Copyright (c) Microsoft Corporation.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package status_test
+
+import (
+	"github.com/samber/lo"
+	corev1 "k8s.io/api/core/v1"
+
+	"github.com/Azure/karpenter-provider-azure/pkg/apis/v1beta1"
+	"github.com/Azure/karpenter-provider-azure/pkg/controllers/nodeclass/status"
+	"github.com/Azure/karpenter-provider-azure/pkg/test"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("NodeClass ImageKubernetesVersion Status Controller", func() {
+	const azureLinux2ImageID = "/CommunityGalleries/AKSAzureLinux-f7c7cda5-1c9a-4bdc-a222-9614c968580b/images/V2gen2/versions/202501.02.0"
+	var imageKubernetesVersionReconciler *status.ImageKubernetesVersionReconciler
+
+	BeforeEach(func() {
+		imageKubernetesVersionReconciler = status.NewImageKubernetesVersionReconciler(azureEnv.ImageProvider)
+		test.ApplyDefaultStatus(nodeClass, env, false)
+	})
+
+	It("should not set ImagesKubernetesVersionUnsupported when the images support the kubernetes version", func() {
+		_, err := imageKubernetesVersionReconciler.Reconcile(ctx, nodeClass)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(nodeClass.StatusConditions().Get(v1beta1.ConditionTypeImagesKubernetesVersionUnsupported)).To(BeNil())
+	})
+
+	It("should set ImagesKubernetesVersionUnsupported when frozen images don't support an upgraded kubernetes version", func() {
+		nodeClass.Spec.ImageFamily = lo.ToPtr(v1beta1.AzureLinuxImageFamily)
+		nodeClass.Annotations = map[string]string{v1beta1.AnnotationImageFreeze: "true"}
+		nodeClass.Status.Images = []v1beta1.NodeImage{{
+			ID: azureLinux2ImageID,
+			Requirements: []corev1.NodeSelectorRequirement{
+				{Key: corev1.LabelArchStable, Operator: corev1.NodeSelectorOpIn, Values: []string{"amd64"}},
+			},
+		}}
+		nodeClass.Status.KubernetesVersion = "1.32.0"
+
+		_, err := imageKubernetesVersionReconciler.Reconcile(ctx, nodeClass)
+		Expect(err).ToNot(HaveOccurred())
+		condition := nodeClass.StatusConditions().Get(v1beta1.ConditionTypeImagesKubernetesVersionUnsupported)
+		Expect(condition).ToNot(BeNil())
+		Expect(condition.IsTrue()).To(BeTrue())
+		Expect(condition.Reason).To(Equal("ImagesFrozen"))
+		Expect(condition.Message).To(ContainSubstring(azureLinux2ImageID))
+		Expect(condition.Message).To(ContainSubstring("version 202501.02.0"))
+		Expect(condition.Message).To(ContainSubstring("kubernetes version 1.32.0"))
+
+		// cleared once the kubernetes version is supported again
+		nodeClass.Status.KubernetesVersion = "1.31.3"
+		_, err = imageKubernetesVersionReconciler.Reconcile(ctx, nodeClass)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(nodeClass.StatusConditions().Get(v1beta1.ConditionTypeImagesKubernetesVersionUnsupported)).To(BeNil())
+	})
+
+	It("should not set ImagesKubernetesVersionUnsupported while the kubernetes version isn't ready", func() {
+		nodeClass.Status.Images = []v1beta1.NodeImage{{ID: azureLinux2ImageID}}
+		nodeClass.Status.KubernetesVersion = "1.32.0"
+		nodeClass.StatusConditions().SetFalse(v1beta1.ConditionTypeKubernetesVersionReady, "KubernetesVersionFalseForTesting", "testing false kubernetes version status")
+
+		_, err := imageKubernetesVersionReconciler.Reconcile(ctx, nodeClass)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(nodeClass.StatusConditions().Get(v1beta1.ConditionTypeImagesKubernetesVersionUnsupported)).To(BeNil())
+	})
+})
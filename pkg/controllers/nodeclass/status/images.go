@@ -18,8 +18,10 @@ package status
 
 import (
 	"context"
+	stderrors "errors"
 	"fmt"
 	"os"
+	"slices"
 	"sort"
 	"strings"
 	"time"
@@ -36,14 +38,17 @@ import (
 	"github.com/samber/lo"
 
 	"github.com/Azure/karpenter-provider-azure/pkg/apis/v1beta1"
+	"github.com/Azure/karpenter-provider-azure/pkg/metrics"
 	"github.com/Azure/karpenter-provider-azure/pkg/operator/options"
 	"github.com/Azure/karpenter-provider-azure/pkg/providers/imagefamily"
 	"github.com/Azure/karpenter-provider-azure/pkg/utils"
+	armopts "github.com/Azure/karpenter-provider-azure/pkg/utils/opts"
 
 	controllerruntime "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/manager"
 	"sigs.k8s.io/controller-runtime/pkg/reconcile"
 	v1 "sigs.k8s.io/karpenter/pkg/apis/v1"
+	"sigs.k8s.io/karpenter/pkg/events"
 	"sigs.k8s.io/karpenter/pkg/utils/pretty"
 )
 
@@ -55,11 +60,33 @@ const (
 	nodeOSMaintenanceWindowChannel = "aksManagedNodeOSUpgradeSchedule"
 	configMapStartTimeFormat       = "%s-start"
 	configMapEndTimeFormat         = "%s-end"
+
+	// ImagesInaccessibleReason is the reason of the ImagesReady condition while the image source can't be accessed
+	ImagesInaccessibleReason = "ImagesInaccessible"
+	// ImageVersionNotFoundReason is the reason of the ImagesReady condition while the image version pinned by the
+	// nodeclass doesn't exist for one of its images
+	ImageVersionNotFoundReason = "ImageVersionNotFound"
+	// ImageVersionsNotFoundReason is the reason of the ImagesReady condition while the gallery image definition of one of
+	// the custom image terms of the nodeclass has no versions yet
+	ImageVersionsNotFoundReason = "ImageVersionsNotFound"
+	// ImageVersionConstraintUnsatisfiableReason is the reason of the ImagesReady condition while none of the versions of
+	// one of the images of the nodeclass satisfies its version constraint
+	ImageVersionConstraintUnsatisfiableReason = "ImageVersionConstraintUnsatisfiable"
+	// ImageVersionTagSelectorUnsatisfiableReason is the reason of the ImagesReady condition while none of the versions of
+	// the image of one of the custom image terms of the nodeclass has the tags of its version tag selector
+	ImageVersionTagSelectorUnsatisfiableReason = "ImageVersionTagSelectorUnsatisfiable"
+	// ImageIncompatibleReason is the reason of the ImagesReady condition while the gallery image definition of one of the
+	// custom image terms of the nodeclass can't boot as a node of it, e.g. a specialized or Windows image
+	ImageIncompatibleReason = "ImageIncompatible"
+	// imageProbeRetryInterval is how soon the image source is probed again after failing, so that access coming back
+	// is picked up without waiting for the regular refresh of the images
+	imageProbeRetryInterval = time.Minute
 )
 
 type NodeImageReconciler struct {
 	nodeImageProvider            imagefamily.NodeImageProvider
 	inClusterKubernetesInterface kubernetes.Interface
+	recorder                     events.Recorder
 	systemNamespace              string
 	cm                           *pretty.ChangeMonitor
 }
@@ -67,12 +94,14 @@ type NodeImageReconciler struct {
 func NewNodeImageReconciler(
 	provider imagefamily.NodeImageProvider,
 	inClusterKubernetesInterface kubernetes.Interface,
+	recorder events.Recorder,
 ) *NodeImageReconciler {
 	systemNamespace := strings.TrimSpace(os.Getenv("SYSTEM_NAMESPACE"))
 
 	return &NodeImageReconciler{
 		nodeImageProvider:            provider,
 		inClusterKubernetesInterface: inClusterKubernetesInterface,
+		recorder:                     recorder,
 		systemNamespace:              systemNamespace,
 		cm:                           pretty.NewChangeMonitor(),
 	}
@@ -93,6 +122,10 @@ func (r *NodeImageReconciler) Register(_ context.Context, m manager.Manager) err
 
 // The image version reconciler will detect reasons to bump the node image version as follows in order:
 //
+// While the nodeclass has the image-freeze annotation, none of the below apply, and the images in the status are kept as is.
+//
+// A new value of the image-cache-refresh annotation evicts the cached images of the nodeclass, and applies Scenario A.
+//
 // Scenario A: Update all image versions to latest
 //   - 1. Initializes the images versions for a newly created AKSNodeClass, based on customer configuration.
 //   - 2. Indirectly handle image bump for k8s upgrade
@@ -123,10 +156,85 @@ func (r *NodeImageReconciler) Reconcile(ctx context.Context, nodeClass *v1beta1.
 		return reconcile.Result{}, nil
 	}
 
+	// Probed ahead of the image freeze, as frozen images come from the same source, and can't be launched without access to it.
+	// Once the source is accessible again, the images are resolved as for a new nodeclass, which also picks up any kubernetes
+	// upgrade that happened meanwhile.
+	if err := r.nodeImageProvider.Probe(ctx, nodeClass); err != nil {
+		nodeClass.StatusConditions().SetFalse(v1beta1.ConditionTypeImagesReady, ImagesInaccessibleReason, fmt.Sprintf("Image source is inaccessible, %s", err))
+		logger.Error(err, "probing image source")
+		return reconcile.Result{RequeueAfter: imageProbeRetryInterval}, nil
+	}
+
+	// An image freeze keeps the images already in the status, regardless of newly published versions, kubernetes upgrades, or
+	// maintenance windows. A nodeclass without images yet is still initialized, so that it can provision nodes.
+	if nodeClass.IsImageFrozen() && len(nodeClass.Status.Images) > 0 {
+		if nodeClass.StatusConditions().SetTrueWithReason(v1beta1.ConditionTypeImagesFrozen, "ImageFreezeAnnotation", fmt.Sprintf("Image updates are frozen by the %s annotation", v1beta1.AnnotationImageFreeze)) {
+			logger.Info("image updates frozen for nodeclass", "images", nodeClass.Status.Images)
+		}
+		metrics.ImageFreezeActive.WithLabelValues(nodeClass.Name).Set(1)
+		nodeClass.StatusConditions().SetTrue(v1beta1.ConditionTypeImagesReady)
+		return reconcile.Result{RequeueAfter: 5 * time.Minute}, nil
+	}
+	if nodeClass.StatusConditions().Get(v1beta1.ConditionTypeImagesFrozen) != nil {
+		logger.Info("image updates unfrozen for nodeclass")
+		if err := nodeClass.StatusConditions().Clear(v1beta1.ConditionTypeImagesFrozen); err != nil {
+			return reconcile.Result{}, fmt.Errorf("clearing %s condition, %w", v1beta1.ConditionTypeImagesFrozen, err)
+		}
+	}
+	metrics.ImageFreezeActive.DeleteLabelValues(nodeClass.Name)
+
+	// A new value of the image-cache-refresh annotation evicts the cached images of the nodeclass, so that the latest
+	// versions are looked up again, and updates its images to them regardless of the maintenance window
+	imageCacheRefresh := nodeClass.Annotations[v1beta1.AnnotationImageCacheRefresh]
+	refreshing := imageCacheRefresh != "" && imageCacheRefresh != nodeClass.Status.ImageCacheRefresh
+	if refreshing {
+		if err := r.nodeImageProvider.Evict(ctx, nodeClass); err != nil {
+			return reconcile.Result{}, fmt.Errorf("evicting cached nodeimages, %w", err)
+		}
+		logger.Info("refreshing images of nodeclass", "imageCacheRefresh", imageCacheRefresh)
+	}
+
 	nodeImages, err := r.nodeImageProvider.List(ctx, nodeClass)
 	if err != nil {
+		var imageVersionNotFoundErr *imagefamily.ImageVersionNotFoundError
+		if stderrors.As(err, &imageVersionNotFoundErr) {
+			nodeClass.StatusConditions().SetFalse(v1beta1.ConditionTypeImagesReady, ImageVersionNotFoundReason, fmt.Sprintf("Pinned %s", err))
+			logger.Error(err, "resolving pinned image version")
+			return reconcile.Result{RequeueAfter: 5 * time.Minute}, nil
+		}
+		var imageVersionsNotFoundErr *imagefamily.ImageVersionsNotFoundError
+		if stderrors.As(err, &imageVersionsNotFoundErr) {
+			nodeClass.StatusConditions().SetFalse(v1beta1.ConditionTypeImagesReady, ImageVersionsNotFoundReason, fmt.Sprintf("Custom %s", err))
+			logger.Error(err, "resolving custom image versions")
+			return reconcile.Result{RequeueAfter: 5 * time.Minute}, nil
+		}
+		var imageVersionConstraintErr *imagefamily.ImageVersionConstraintError
+		if stderrors.As(err, &imageVersionConstraintErr) {
+			nodeClass.StatusConditions().SetFalse(v1beta1.ConditionTypeImagesReady, ImageVersionConstraintUnsatisfiableReason, fmt.Sprintf("Image version constraint is unsatisfiable, %s", err))
+			logger.Error(err, "resolving image versions satisfying the version constraint")
+			return reconcile.Result{RequeueAfter: 5 * time.Minute}, nil
+		}
+		var imageVersionTagSelectorErr *imagefamily.ImageVersionTagSelectorError
+		if stderrors.As(err, &imageVersionTagSelectorErr) {
+			nodeClass.StatusConditions().SetFalse(v1beta1.ConditionTypeImagesReady, ImageVersionTagSelectorUnsatisfiableReason, fmt.Sprintf("Image version tag selector is unsatisfiable, %s", err))
+			logger.Error(err, "resolving image versions with the tags of the version tag selector")
+			return reconcile.Result{RequeueAfter: 5 * time.Minute}, nil
+		}
+		var imageIncompatibleErr *imagefamily.ImageIncompatibleError
+		if stderrors.As(err, &imageIncompatibleErr) {
+			nodeClass.StatusConditions().SetFalse(v1beta1.ConditionTypeImagesReady, ImageIncompatibleReason, fmt.Sprintf("Image is incompatible with the nodeclass, %s", err))
+			logger.Error(err, "validating custom image definition")
+			return reconcile.Result{RequeueAfter: 5 * time.Minute}, nil
+		}
 		return reconcile.Result{}, fmt.Errorf("getting nodeimages, %w", err)
 	}
+	// The community gallery images SIG failures fall back to only stand in for a nodeclass without images yet, so that it
+	// can provision nodes, rather than replacing its images until SIG is available again
+	if len(nodeClass.Status.Images) > 0 && lo.SomeBy(nodeImages, func(nodeImage imagefamily.NodeImage) bool { return nodeImage.Fallback }) {
+		logger.Info("keeping the images of nodeclass while SIG is unavailable", "images", nodeClass.Status.Images)
+		nodeClass.StatusConditions().SetTrue(v1beta1.ConditionTypeImagesReady)
+		return reconcile.Result{RequeueAfter: 5 * time.Minute}, nil
+	}
 	goalImages := lo.Map(nodeImages, func(nodeImage imagefamily.NodeImage, _ int) v1beta1.NodeImage {
 		reqs := lo.Map(nodeImage.Requirements.NodeSelectorRequirements(), func(item v1.NodeSelectorRequirementWithMinValues, _ int) corev1.NodeSelectorRequirement {
 			return item.NodeSelectorRequirement
@@ -140,9 +248,18 @@ func (r *NodeImageReconciler) Reconcile(ctx context.Context, nodeClass *v1beta1.
 			return reqs[i].Key < reqs[j].Key
 		})
 
+		var publishedDate *metav1.Time
+		if nodeImage.PublishedDate != nil {
+			publishedDate = lo.ToPtr(metav1.NewTime(*nodeImage.PublishedDate))
+		}
+
 		return v1beta1.NodeImage{
-			ID:           nodeImage.ID,
-			Requirements: reqs,
+			ID:            nodeImage.ID,
+			Requirements:  reqs,
+			Channel:       nodeImage.Channel,
+			Distro:        nodeImage.Distro,
+			Pinned:        nodeImage.Pinned,
+			PublishedDate: publishedDate,
 		}
 	})
 
@@ -151,7 +268,7 @@ func (r *NodeImageReconciler) Reconcile(ctx context.Context, nodeClass *v1beta1.
 	// Note: We want to handle cases 1-3 regardless of maintenance window state, since they are either
 	// for initialization, based off an underlying customer operation, or a different update we're
 	// dependant upon which would have already been preformed within its required maintenance Window.
-	shouldUpdate := imageVersionsUnready(nodeClass)
+	shouldUpdate := refreshing || imageVersionsUnready(nodeClass) || imageVersionPinned(nodeClass)
 	if !shouldUpdate {
 		// Case 4: Check if the maintenance window is open
 		var err error
@@ -162,7 +279,7 @@ func (r *NodeImageReconciler) Reconcile(ctx context.Context, nodeClass *v1beta1.
 	}
 	if !shouldUpdate {
 		// Scenario B: Calculate any partial update based on image selectors, or newly supports SKUs
-		goalImages = overrideAnyGoalStateVersionsWithExisting(nodeClass, goalImages)
+		goalImages = overrideAnyGoalStateVersionsWithExisting(ctx, nodeClass, goalImages)
 	}
 	if len(goalImages) == 0 {
 		nodeClass.Status.Images = nil
@@ -174,10 +291,15 @@ func (r *NodeImageReconciler) Reconcile(ctx context.Context, nodeClass *v1beta1.
 	// We care about the ordering of the slices here, as it translates to priority during selection, so not treating them as sets
 	if utils.HasChanged(nodeClass.Status.Images, goalImages, &hashstructure.HashOptions{SlicesAsSets: false}) {
 		logger.Info("new available images updated for nodeclass", "existingImages", nodeClass.Status.Images, "newImages", goalImages)
+		if imageIDs := nodeImageIDs(goalImages); len(nodeClass.Status.Images) > 0 && !slices.Equal(nodeImageIDs(nodeClass.Status.Images), imageIDs) {
+			r.recorder.Publish(ImagesUpdatedEvent(nodeClass, imageIDs))
+		}
 	}
 	nodeClass.Status.Images = goalImages
+	nodeClass.Status.ImageCacheRefresh = imageCacheRefresh
 	nodeClass.StatusConditions().SetTrue(v1beta1.ConditionTypeImagesReady)
-	return reconcile.Result{RequeueAfter: 5 * time.Minute}, nil
+	// refreshing images that are ready can wait while the ARM request budget is low
+	return reconcile.Result{RequeueAfter: armopts.RateLimits.BackgroundInterval(5 * time.Minute)}, nil
 }
 
 // Handles case 1: This is a new AKSNodeClass, where images haven't been populated yet
@@ -187,6 +309,13 @@ func imageVersionsUnready(nodeClass *v1beta1.AKSNodeClass) bool {
 	return !nodeClass.StatusConditions().Get(v1beta1.ConditionTypeImagesReady).IsTrue()
 }
 
+// A pinned image version or image ID is applied as soon as it's set or changed, since the user selected it explicitly
+func imageVersionPinned(nodeClass *v1beta1.AKSNodeClass) bool {
+	return lo.FromPtr(nodeClass.Spec.ImageID) != "" ||
+		(nodeClass.Spec.MarketplaceImage != nil && nodeClass.Spec.MarketplaceImage.Version != "") ||
+		(lo.FromPtr(nodeClass.Spec.ImageVersion) != "" && lo.FromPtr(nodeClass.Spec.ImageFamily) != v1beta1.CustomImageFamily)
+}
+
 // Handles case 4: check if the maintenance window is open
 // TODO (charliedmcb): remove nolint on gocyclo. Added for now in order to pass "make verify"
 // I think the best way to get rid of gocyclo is to break the section retrieving the maintenance window
@@ -251,20 +380,30 @@ func (r *NodeImageReconciler) isMaintenanceWindowOpen(ctx context.Context) (bool
 //
 // Handles case 5: users updating image selectors.
 //   - Currently, this is just image family, and/or usage of SIG, which means that we should just be looking at the baseID of the images
+//   - Moving from the Preview to the Stable image channel replaces any preview versions
+//   - Removing the pinned image version replaces the pinned versions with the latest ones
+//   - Changing the image version constraint replaces the versions that don't satisfy it
 //
 // Handles case 6: We will softly add newly supported SKUs by Karpenter on their latest version
 //   - Note: I think this should be re-assessed if this is the exact behavior we want to give users before any actual new SKU support is released.
 //
 // TODO: Need longer term design for handling newly supported versions, and other image selectors.
-func overrideAnyGoalStateVersionsWithExisting(nodeClass *v1beta1.AKSNodeClass, discoveredImages []v1beta1.NodeImage) []v1beta1.NodeImage {
-	existingBaseIDMapping := mapImageBasesToImages(nodeClass.Status.Images)
+func overrideAnyGoalStateVersionsWithExisting(ctx context.Context, nodeClass *v1beta1.AKSNodeClass, discoveredImages []v1beta1.NodeImage) []v1beta1.NodeImage {
+	existingBaseIDMapping := mapImageBasesToImages(aliasedImages(ctx, nodeClass.Status.Images))
 	updatedImages := []v1beta1.NodeImage{}
 	// Note: we have to range over the discovered images here, instead of converting to a baseIDMapping, to keep the ordering consistent
 	for i := range discoveredImages {
 		discoveredImage := discoveredImages[i]
 		discoveredBaseImageID := trimVersionSuffix(discoveredImage.ID)
-		if existingImage, ok := existingBaseIDMapping[discoveredBaseImageID]; ok {
-			updatedImages = append(updatedImages, *existingImage)
+		// a preview version is not kept once the nodeclass is moved off the Preview channel, nor a pinned version once unpinned,
+		// nor a version not satisfying the version constraint
+		if existingImage, ok := existingBaseIDMapping[discoveredBaseImageID]; ok && !existingImage.Pinned &&
+			(existingImage.Channel != v1beta1.ImageChannelPreview || nodeClass.GetImageChannel() == v1beta1.ImageChannelPreview) &&
+			imagefamily.SatisfiesImageVersionConstraint(ctx, nodeClass, existingImage.ID) {
+			keptImage := *existingImage
+			// the distro belongs to the image definition, so it's filled in for images resolved before it was reported
+			keptImage.Distro = discoveredImage.Distro
+			updatedImages = append(updatedImages, keptImage)
 		} else {
 			updatedImages = append(updatedImages, discoveredImage)
 		}
@@ -272,6 +411,19 @@ func overrideAnyGoalStateVersionsWithExisting(nodeClass *v1beta1.AKSNodeClass, d
 	return updatedImages
 }
 
+func nodeImageIDs(images []v1beta1.NodeImage) []string {
+	return lo.Map(images, func(image v1beta1.NodeImage, _ int) string { return image.ID })
+}
+
+// aliasedImages returns the images with those of the galleries that moved in the galleries they moved to, so that the
+// versions of images of an aliased gallery are kept in the new gallery
+func aliasedImages(ctx context.Context, images []v1beta1.NodeImage) []v1beta1.NodeImage {
+	return lo.Map(images, func(image v1beta1.NodeImage, _ int) v1beta1.NodeImage {
+		image.ID, _ = imagefamily.AliasedImageID(ctx, image.ID)
+		return image
+	})
+}
+
 func mapImageBasesToImages(images []v1beta1.NodeImage) map[string]*v1beta1.NodeImage {
 	imagesBaseMapping := map[string]*v1beta1.NodeImage{}
 	for i := range images {
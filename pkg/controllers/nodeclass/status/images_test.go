@@ -58,6 +58,8 @@ func getExpectedTestCommunityImages(version string) []v1beta1.NodeImage {
 					Values:   []string{"2"},
 				},
 			},
+			Channel: v1beta1.ImageChannelStable,
+			Distro:  "aks-ubuntu-containerd-22.04-gen2",
 		},
 		{
 			ID: fmt.Sprintf("/CommunityGalleries/AKSUbuntu-38d80f77-467a-481f-a8d4-09b6d4220bd2/images/2204containerd/versions/%s", version),
@@ -73,6 +75,8 @@ func getExpectedTestCommunityImages(version string) []v1beta1.NodeImage {
 					Values:   []string{"1"},
 				},
 			},
+			Channel: v1beta1.ImageChannelStable,
+			Distro:  "aks-ubuntu-containerd-22.04",
 		},
 		{
 			ID: fmt.Sprintf("/CommunityGalleries/AKSUbuntu-38d80f77-467a-481f-a8d4-09b6d4220bd2/images/2204gen2arm64containerd/versions/%s", version),
@@ -88,6 +92,8 @@ func getExpectedTestCommunityImages(version string) []v1beta1.NodeImage {
 					Values:   []string{"2"},
 				},
 			},
+			Channel: v1beta1.ImageChannelStable,
+			Distro:  "aks-ubuntu-arm64-containerd-22.04-gen2",
 		},
 	}
 }
@@ -175,7 +181,7 @@ var _ = Describe("NodeClass NodeImage Status Controller", func() {
 			)
 
 			BeforeEach(func() {
-				imageReconciler = status.NewNodeImageReconciler(azureEnv.ImageProvider, env.KubernetesInterface)
+				imageReconciler = status.NewNodeImageReconciler(azureEnv.ImageProvider, env.KubernetesInterface, recorder)
 			})
 
 			It("images ready status should be false if FIPS is enabled but UseSIG is false", func() {
@@ -212,7 +218,7 @@ var _ = Describe("NodeClass NodeImage Status Controller", func() {
 
 			BeforeEach(func() {
 				os.Setenv("SYSTEM_NAMESPACE", "kube-system")
-				imageReconciler = status.NewNodeImageReconciler(azureEnv.ImageProvider, env.KubernetesInterface)
+				imageReconciler = status.NewNodeImageReconciler(azureEnv.ImageProvider, env.KubernetesInterface, recorder)
 			})
 
 			It("Should update NodeImages when ConfigMap is missing (fail open)", func() {
@@ -229,6 +235,7 @@ var _ = Describe("NodeClass NodeImage Status Controller", func() {
 				Expect(err).ToNot(HaveOccurred())
 
 				ExpectReadyWithCIGImages(nodeClass, oldcigImageVersion)
+				Expect(recorder.Calls("ImagesUpdated")).To(BeZero())
 			})
 
 			It("Should update NodeImages when ConfigMap is empty (maintenance window undefined)", func() {
@@ -247,6 +254,7 @@ var _ = Describe("NodeClass NodeImage Status Controller", func() {
 				Expect(err).ToNot(HaveOccurred())
 
 				ExpectReadyWithCIGImages(nodeClass, newCIGImageVersion)
+				Expect(recorder.Calls("ImagesUpdated")).To(Equal(1))
 			})
 
 			It("Should error when ConfigMap is malformed (missing endtime)", func() {
@@ -274,6 +282,291 @@ var _ = Describe("NodeClass NodeImage Status Controller", func() {
 			})
 		})
 
+		Context("Image freeze", func() {
+			var (
+				imageReconciler *status.NodeImageReconciler
+			)
+
+			BeforeEach(func() {
+				os.Unsetenv("SYSTEM_NAMESPACE")
+				imageReconciler = status.NewNodeImageReconciler(azureEnv.ImageProvider, env.KubernetesInterface, recorder)
+				nodeClass.Annotations = map[string]string{v1beta1.AnnotationImageFreeze: "true"}
+			})
+
+			It("Should not update NodeImages while frozen", func() {
+				_, err := imageReconciler.Reconcile(ctx, nodeClass)
+				Expect(err).ToNot(HaveOccurred())
+
+				ExpectReadyWithCIGImages(nodeClass, oldcigImageVersion)
+				Expect(nodeClass.StatusConditions().IsTrue(v1beta1.ConditionTypeImagesFrozen)).To(BeTrue())
+			})
+
+			It("Should not update NodeImages while frozen, even if they are unready", func() {
+				nodeClass.StatusConditions().SetFalse(v1beta1.ConditionTypeImagesReady, "KubernetesVersionChanged", "")
+
+				_, err := imageReconciler.Reconcile(ctx, nodeClass)
+				Expect(err).ToNot(HaveOccurred())
+
+				ExpectReadyWithCIGImages(nodeClass, oldcigImageVersion)
+			})
+
+			It("Should initialize NodeImages of a new nodeclass while frozen", func() {
+				nodeClass.Status.Images = nil
+				nodeClass.StatusConditions().SetFalse(v1beta1.ConditionTypeImagesReady, "ImagesNotFound", "")
+
+				_, err := imageReconciler.Reconcile(ctx, nodeClass)
+				Expect(err).ToNot(HaveOccurred())
+
+				ExpectReadyWithCIGImages(nodeClass, newCIGImageVersion)
+			})
+
+			It("Should update NodeImages once unfrozen", func() {
+				_, err := imageReconciler.Reconcile(ctx, nodeClass)
+				Expect(err).ToNot(HaveOccurred())
+
+				delete(nodeClass.Annotations, v1beta1.AnnotationImageFreeze)
+				_, err = imageReconciler.Reconcile(ctx, nodeClass)
+				Expect(err).ToNot(HaveOccurred())
+
+				ExpectReadyWithCIGImages(nodeClass, newCIGImageVersion)
+				Expect(nodeClass.StatusConditions().Get(v1beta1.ConditionTypeImagesFrozen)).To(BeNil())
+			})
+		})
+
+		Context("Image cache refresh", func() {
+			var (
+				imageReconciler *status.NodeImageReconciler
+			)
+
+			BeforeEach(func() {
+				os.Setenv("SYSTEM_NAMESPACE", "kube-system")
+				imageReconciler = status.NewNodeImageReconciler(azureEnv.ImageProvider, env.KubernetesInterface, recorder)
+				ExpectApplied(ctx, env.Client, getClosedMWConfigMap())
+			})
+
+			It("Should update NodeImages outside of the maintenance window once the annotation is set", func() {
+				nodeClass.Annotations = map[string]string{v1beta1.AnnotationImageCacheRefresh: "2026-10-16T12:00:00Z"}
+
+				_, err := imageReconciler.Reconcile(ctx, nodeClass)
+				Expect(err).ToNot(HaveOccurred())
+
+				ExpectReadyWithCIGImages(nodeClass, newCIGImageVersion)
+				Expect(nodeClass.Status.ImageCacheRefresh).To(Equal("2026-10-16T12:00:00Z"))
+			})
+
+			It("Should not update NodeImages again until the annotation changes", func() {
+				nodeClass.Annotations = map[string]string{v1beta1.AnnotationImageCacheRefresh: "2026-10-16T12:00:00Z"}
+				nodeClass.Status.ImageCacheRefresh = "2026-10-16T12:00:00Z"
+
+				_, err := imageReconciler.Reconcile(ctx, nodeClass)
+				Expect(err).ToNot(HaveOccurred())
+				ExpectReadyWithCIGImages(nodeClass, oldcigImageVersion)
+
+				nodeClass.Annotations[v1beta1.AnnotationImageCacheRefresh] = "2026-10-17T12:00:00Z"
+				_, err = imageReconciler.Reconcile(ctx, nodeClass)
+				Expect(err).ToNot(HaveOccurred())
+				ExpectReadyWithCIGImages(nodeClass, newCIGImageVersion)
+				Expect(nodeClass.Status.ImageCacheRefresh).To(Equal("2026-10-17T12:00:00Z"))
+			})
+
+			It("Should not update NodeImages once the annotation is removed", func() {
+				nodeClass.Status.ImageCacheRefresh = "2026-10-16T12:00:00Z"
+
+				_, err := imageReconciler.Reconcile(ctx, nodeClass)
+				Expect(err).ToNot(HaveOccurred())
+
+				ExpectReadyWithCIGImages(nodeClass, oldcigImageVersion)
+				Expect(nodeClass.Status.ImageCacheRefresh).To(BeEmpty())
+			})
+		})
+
+		Context("Image source probe", func() {
+			var (
+				imageReconciler *status.NodeImageReconciler
+			)
+
+			BeforeEach(func() {
+				os.Unsetenv("SYSTEM_NAMESPACE")
+				imageReconciler = status.NewNodeImageReconciler(azureEnv.ImageProvider, env.KubernetesInterface, recorder)
+			})
+
+			It("Should set ImagesReady to false with the error while the community gallery is inaccessible", func() {
+				azureEnv.CommunityImageVersionsAPI.Error = fmt.Errorf("AuthorizationFailed")
+
+				result, err := imageReconciler.Reconcile(ctx, nodeClass)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(result.RequeueAfter).To(Equal(time.Minute))
+				// the images are kept for when access comes back
+				Expect(nodeClass.Status.Images).To(HaveExactElements(getExpectedTestCommunityImages(oldcigImageVersion)))
+
+				condition := nodeClass.StatusConditions().Get(v1beta1.ConditionTypeImagesReady)
+				Expect(condition.IsFalse()).To(BeTrue())
+				Expect(condition.Reason).To(Equal(status.ImagesInaccessibleReason))
+				Expect(condition.Message).To(ContainSubstring("AuthorizationFailed"))
+				Expect(nodeClass.StatusConditions().Get(opstatus.ConditionReady).IsFalse()).To(BeTrue())
+			})
+
+			It("Should set ImagesReady to false while the SIG is inaccessible", func() {
+				stored := ctx
+				DeferCleanup(func() { ctx = stored })
+				ctx = test.Options(test.OptionsFields{UseSIG: lo.ToPtr(true)}).ToContext(ctx)
+				azureEnv.NodeImageVersionsAPI.Error = fmt.Errorf("AuthorizationFailed")
+
+				_, err := imageReconciler.Reconcile(ctx, nodeClass)
+				Expect(err).ToNot(HaveOccurred())
+
+				condition := nodeClass.StatusConditions().Get(v1beta1.ConditionTypeImagesReady)
+				Expect(condition.IsFalse()).To(BeTrue())
+				Expect(condition.Reason).To(Equal(status.ImagesInaccessibleReason))
+			})
+
+			It("Should set ImagesReady to false while frozen images are inaccessible", func() {
+				nodeClass.Annotations = map[string]string{v1beta1.AnnotationImageFreeze: "true"}
+				azureEnv.CommunityImageVersionsAPI.Error = fmt.Errorf("AuthorizationFailed")
+
+				_, err := imageReconciler.Reconcile(ctx, nodeClass)
+				Expect(err).ToNot(HaveOccurred())
+
+				Expect(nodeClass.StatusConditions().Get(v1beta1.ConditionTypeImagesReady).Reason).To(Equal(status.ImagesInaccessibleReason))
+			})
+
+			It("Should recover once the image source is accessible again", func() {
+				azureEnv.CommunityImageVersionsAPI.Error = fmt.Errorf("AuthorizationFailed")
+				_, err := imageReconciler.Reconcile(ctx, nodeClass)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(nodeClass.StatusConditions().IsTrue(v1beta1.ConditionTypeImagesReady)).To(BeFalse())
+
+				azureEnv.CommunityImageVersionsAPI.Error = nil
+				_, err = imageReconciler.Reconcile(ctx, nodeClass)
+				Expect(err).ToNot(HaveOccurred())
+
+				ExpectReadyWithCIGImages(nodeClass, newCIGImageVersion)
+			})
+		})
+
+		Context("Pinned and constrained image versions", func() {
+			var (
+				imageReconciler *status.NodeImageReconciler
+			)
+
+			BeforeEach(func() {
+				os.Setenv("SYSTEM_NAMESPACE", "kube-system")
+				imageReconciler = status.NewNodeImageReconciler(azureEnv.ImageProvider, env.KubernetesInterface, recorder)
+				azureEnv.CommunityImageVersionsAPI.ImageVersions.Reset()
+				for i, version := range []string{oldcigImageVersion, newCIGImageVersion} {
+					azureEnv.CommunityImageVersionsAPI.ImageVersions.Append(&armcompute.CommunityGalleryImageVersion{
+						Name:       lo.ToPtr(version),
+						Properties: &armcompute.CommunityGalleryImageVersionProperties{PublishedDate: lo.ToPtr(time.Now().Add(time.Duration(i-2) * time.Hour))},
+					})
+				}
+				// the pinned version and the version constraint are applied regardless of the maintenance window
+				ExpectApplied(ctx, env.Client, getClosedMWConfigMap())
+			})
+
+			It("Should update NodeImages to the pinned version", func() {
+				nodeClass.Status.Images = getExpectedTestCommunityImages(newCIGImageVersion)
+				nodeClass.Spec.ImageVersion = lo.ToPtr(oldcigImageVersion)
+
+				_, err := imageReconciler.Reconcile(ctx, nodeClass)
+				Expect(err).ToNot(HaveOccurred())
+
+				Expect(nodeClass.Status.Images).To(HaveExactElements(lo.Map(getExpectedTestCommunityImages(oldcigImageVersion), func(image v1beta1.NodeImage, _ int) v1beta1.NodeImage {
+					image.Pinned = true
+					return image
+				})))
+				Expect(nodeClass.StatusConditions().IsTrue(v1beta1.ConditionTypeImagesReady)).To(BeTrue())
+			})
+
+			It("Should set ImagesReady to false while the pinned version doesn't exist", func() {
+				nodeClass.Spec.ImageVersion = lo.ToPtr("202001.01.0")
+
+				result, err := imageReconciler.Reconcile(ctx, nodeClass)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(result.RequeueAfter).To(Equal(5 * time.Minute))
+				Expect(nodeClass.Status.Images).To(HaveExactElements(getExpectedTestCommunityImages(oldcigImageVersion)))
+
+				condition := nodeClass.StatusConditions().Get(v1beta1.ConditionTypeImagesReady)
+				Expect(condition.IsFalse()).To(BeTrue())
+				Expect(condition.Reason).To(Equal(status.ImageVersionNotFoundReason))
+				Expect(condition.Message).To(ContainSubstring("202001.01.0"))
+			})
+
+			It("Should set ImagesReady to false while no version satisfies the version constraint", func() {
+				nodeClass.Spec.ImageVersionConstraint = lo.ToPtr(">=202601.0.0")
+
+				_, err := imageReconciler.Reconcile(ctx, nodeClass)
+				Expect(err).ToNot(HaveOccurred())
+
+				condition := nodeClass.StatusConditions().Get(v1beta1.ConditionTypeImagesReady)
+				Expect(condition.IsFalse()).To(BeTrue())
+				Expect(condition.Reason).To(Equal(status.ImageVersionConstraintUnsatisfiableReason))
+			})
+
+			It("Should update NodeImages not satisfying the version constraint", func() {
+				nodeClass.Status.Images = getExpectedTestCommunityImages(newCIGImageVersion)
+				nodeClass.Spec.ImageVersionConstraint = lo.ToPtr("<202501.0.0")
+
+				_, err := imageReconciler.Reconcile(ctx, nodeClass)
+				Expect(err).ToNot(HaveOccurred())
+
+				ExpectReadyWithCIGImages(nodeClass, oldcigImageVersion)
+			})
+
+			It("Should update NodeImages to the latest version once unpinned", func() {
+				nodeClass.Spec.ImageVersion = lo.ToPtr(oldcigImageVersion)
+				_, err := imageReconciler.Reconcile(ctx, nodeClass)
+				Expect(err).ToNot(HaveOccurred())
+
+				nodeClass.Spec.ImageVersion = nil
+				_, err = imageReconciler.Reconcile(ctx, nodeClass)
+				Expect(err).ToNot(HaveOccurred())
+
+				ExpectReadyWithCIGImages(nodeClass, newCIGImageVersion)
+			})
+		})
+
+		Context("Incompatible custom images", func() {
+			var (
+				imageReconciler *status.NodeImageReconciler
+			)
+
+			BeforeEach(func() {
+				os.Setenv("SYSTEM_NAMESPACE", "kube-system")
+				imageReconciler = status.NewNodeImageReconciler(azureEnv.ImageProvider, env.KubernetesInterface, recorder)
+				nodeClass.Spec.ImageFamily = lo.ToPtr(v1beta1.CustomImageFamily)
+				nodeClass.Spec.CustomImageTerms = []v1beta1.CustomImageTerm{{
+					GallerySubscriptionID:    "00000000-0000-0000-0000-000000000000",
+					GalleryResourceGroupName: "gallery-rg",
+					GalleryName:              "gallery",
+					Name:                     "custom-image",
+				}}
+			})
+
+			DescribeTable("Should set ImagesReady to false while the image definition is incompatible",
+				func(osState armcompute.OperatingSystemStateTypes, osType armcompute.OperatingSystemTypes) {
+					azureEnv.CustomGalleryAPI.SetImageDefinition(armcompute.GalleryImage{
+						Name: lo.ToPtr("custom-image"),
+						Properties: &armcompute.GalleryImageProperties{
+							OSState:      lo.ToPtr(osState),
+							OSType:       lo.ToPtr(osType),
+							Architecture: lo.ToPtr(armcompute.ArchitectureX64),
+						},
+					})
+
+					result, err := imageReconciler.Reconcile(ctx, nodeClass)
+					Expect(err).ToNot(HaveOccurred())
+					Expect(result.RequeueAfter).To(Equal(5 * time.Minute))
+
+					condition := nodeClass.StatusConditions().Get(v1beta1.ConditionTypeImagesReady)
+					Expect(condition.IsFalse()).To(BeTrue())
+					Expect(condition.Reason).To(Equal(status.ImageIncompatibleReason))
+					Expect(condition.Message).To(ContainSubstring("custom-image"))
+				},
+				Entry("Specialized image", armcompute.OperatingSystemStateTypesSpecialized, armcompute.OperatingSystemTypesLinux),
+				Entry("Windows image", armcompute.OperatingSystemStateTypesGeneralized, armcompute.OperatingSystemTypesWindows),
+			)
+		})
+
 		When("SYSTEM_NAMESPACE is not set", func() {
 			var (
 				imageReconciler *status.NodeImageReconciler
@@ -281,7 +574,7 @@ var _ = Describe("NodeClass NodeImage Status Controller", func() {
 
 			BeforeEach(func() {
 				os.Unsetenv("SYSTEM_NAMESPACE")
-				imageReconciler = status.NewNodeImageReconciler(azureEnv.ImageProvider, env.KubernetesInterface)
+				imageReconciler = status.NewNodeImageReconciler(azureEnv.ImageProvider, env.KubernetesInterface, recorder)
 			})
 
 			It("Should update NodeImages (fail open)", func() {
@@ -0,0 +1,116 @@
+/*
+Portions Copyright (c) Microsoft Corporation.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package status
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	sdkerrors "github.com/Azure/azure-sdk-for-go-extensions/pkg/errors"
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/arm"
+	"github.com/samber/lo"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	"github.com/Azure/karpenter-provider-azure/pkg/apis/v1beta1"
+	"github.com/Azure/karpenter-provider-azure/pkg/consts"
+	"github.com/Azure/karpenter-provider-azure/pkg/operator/options"
+	"github.com/Azure/karpenter-provider-azure/pkg/providers/instance"
+)
+
+const (
+	KubeletIdentityUnreadyReasonNotFound = "KubeletIdentityNotFound"
+
+	KubeletIdentityUnreadyReasonClientIDMismatch = "KubeletIdentityClientIDMismatch"
+
+	KubeletIdentityUnreadyReasonUnsupportedProvisionMode = "UnsupportedProvisionMode"
+)
+
+const (
+	kubeletIdentityReconcilerName = "nodeclass.kubeletidentity"
+
+	kubeletIdentityRequeueInterval = 10 * time.Minute
+)
+
+// KubeletIdentityReconciler validates the kubelet identity a nodeclass overrides the cluster's with: it must exist,
+// and its client ID must be the one of the resource ID.
+// Whether the identity has AcrPull on the registries pods pull from isn't checked, as they aren't known to Karpenter.
+type KubeletIdentityReconciler struct {
+	azClient *instance.AZClient
+}
+
+func NewKubeletIdentityReconciler(azClient *instance.AZClient) *KubeletIdentityReconciler {
+	return &KubeletIdentityReconciler{
+		azClient: azClient,
+	}
+}
+
+func (r *KubeletIdentityReconciler) Reconcile(ctx context.Context, nodeClass *v1beta1.AKSNodeClass) (reconcile.Result, error) {
+	if nodeClass.Spec.KubeletIdentityResourceID == nil {
+		nodeClass.StatusConditions().SetTrue(v1beta1.ConditionTypeKubeletIdentityReady)
+		return reconcile.Result{}, nil
+	}
+	resourceID := lo.FromPtr(nodeClass.Spec.KubeletIdentityResourceID)
+	clientID := lo.FromPtr(nodeClass.Spec.KubeletIdentityClientID)
+	logger := log.FromContext(ctx).WithName(kubeletIdentityReconcilerName).WithValues("kubeletIdentityResourceID", resourceID)
+
+	// the node bootstrapping service configures the cluster's kubelet identity
+	if options.FromContext(ctx).ProvisionMode == consts.ProvisionModeBootstrappingClient {
+		nodeClass.StatusConditions().SetFalse(
+			v1beta1.ConditionTypeKubeletIdentityReady,
+			KubeletIdentityUnreadyReasonUnsupportedProvisionMode,
+			fmt.Sprintf("kubeletIdentityClientID is not supported with provision mode %s", consts.ProvisionModeBootstrappingClient),
+		)
+		return reconcile.Result{}, nil
+	}
+
+	// the format is validated by the CRD
+	id, err := arm.ParseResourceID(resourceID)
+	if err != nil {
+		return reconcile.Result{}, fmt.Errorf("parsing kubelet identity resource ID, %w", err)
+	}
+	azClient, err := r.azClient.ForSubscription(id.SubscriptionID)
+	if err != nil {
+		return reconcile.Result{}, err
+	}
+	identity, err := azClient.UserAssignedIdentitiesClient().Get(ctx, id.ResourceGroupName, id.Name, nil)
+	if err != nil {
+		if sdkerrors.IsNotFoundErr(err) {
+			nodeClass.StatusConditions().SetFalse(
+				v1beta1.ConditionTypeKubeletIdentityReady,
+				KubeletIdentityUnreadyReasonNotFound,
+				fmt.Sprintf("resource not found: %s", resourceID),
+			)
+			return reconcile.Result{RequeueAfter: time.Minute}, nil
+		}
+		logger.Error(err, "getting kubelet identity failed")
+		return reconcile.Result{}, err
+	}
+	if identity.Properties != nil && !strings.EqualFold(lo.FromPtr(identity.Properties.ClientID), clientID) {
+		nodeClass.StatusConditions().SetFalse(
+			v1beta1.ConditionTypeKubeletIdentityReady,
+			KubeletIdentityUnreadyReasonClientIDMismatch,
+			fmt.Sprintf("kubeletIdentityClientID %s is not the client ID of %s", clientID, resourceID),
+		)
+		return reconcile.Result{}, nil
+	}
+
+	nodeClass.StatusConditions().SetTrue(v1beta1.ConditionTypeKubeletIdentityReady)
+	return reconcile.Result{RequeueAfter: kubeletIdentityRequeueInterval}, nil
+}
@@ -0,0 +1,90 @@
+/*
+Portions Copyright (c) Microsoft Corporation.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package status_test
+
+import (
+	"github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/msi/armmsi"
+	"github.com/Azure/karpenter-provider-azure/pkg/apis/v1beta1"
+	"github.com/Azure/karpenter-provider-azure/pkg/consts"
+	"github.com/Azure/karpenter-provider-azure/pkg/controllers/nodeclass/status"
+	"github.com/Azure/karpenter-provider-azure/pkg/fake"
+	"github.com/Azure/karpenter-provider-azure/pkg/operator/options"
+	"github.com/Azure/karpenter-provider-azure/pkg/test"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/samber/lo"
+)
+
+var _ = Describe("KubeletIdentityStatus", func() {
+	const (
+		clientID   = "87654321-4321-4321-4321-210987654321"
+		resourceID = "/subscriptions/12345678-1234-1234-1234-123456789012/resourceGroups/identity-resourceGroup/providers/Microsoft.ManagedIdentity/userAssignedIdentities/kubelet"
+	)
+	var nodeClass *v1beta1.AKSNodeClass
+	var reconciler *status.KubeletIdentityReconciler
+
+	BeforeEach(func() {
+		reconciler = status.NewKubeletIdentityReconciler(azureEnv.AZClient)
+		nodeClass = test.AKSNodeClass()
+		nodeClass.Spec.KubeletIdentityClientID = lo.ToPtr(clientID)
+		nodeClass.Spec.KubeletIdentityResourceID = lo.ToPtr(resourceID)
+	})
+
+	storeIdentity := func(clientID string) {
+		azureEnv.UserAssignedIdentitiesAPI.Identities.Store(fake.MakeUserAssignedIdentityKey("identity-resourceGroup", "kubelet"), armmsi.Identity{
+			ID:         lo.ToPtr(resourceID),
+			Properties: &armmsi.UserAssignedIdentityProperties{ClientID: lo.ToPtr(clientID)},
+		})
+	}
+
+	It("should mark nodeclass as ready when no kubelet identity is specified", func() {
+		nodeClass = test.AKSNodeClass()
+		_, err := reconciler.Reconcile(ctx, nodeClass)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(nodeClass.StatusConditions().Get(v1beta1.ConditionTypeKubeletIdentityReady).IsTrue()).To(BeTrue())
+	})
+	It("should mark nodeclass as ready when the kubelet identity exists", func() {
+		storeIdentity(clientID)
+		_, err := reconciler.Reconcile(ctx, nodeClass)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(nodeClass.StatusConditions().Get(v1beta1.ConditionTypeKubeletIdentityReady).IsTrue()).To(BeTrue())
+	})
+	It("should mark nodeclass as not ready when the kubelet identity doesn't exist", func() {
+		_, err := reconciler.Reconcile(ctx, nodeClass)
+		Expect(err).ToNot(HaveOccurred())
+		cond := nodeClass.StatusConditions().Get(v1beta1.ConditionTypeKubeletIdentityReady)
+		Expect(cond.IsFalse()).To(BeTrue())
+		Expect(cond.Reason).To(Equal(status.KubeletIdentityUnreadyReasonNotFound))
+	})
+	It("should mark nodeclass as not ready when the client ID isn't the one of the kubelet identity", func() {
+		storeIdentity("3824ff7a-93b6-40af-b861-2eb621ba437a")
+		_, err := reconciler.Reconcile(ctx, nodeClass)
+		Expect(err).ToNot(HaveOccurred())
+		cond := nodeClass.StatusConditions().Get(v1beta1.ConditionTypeKubeletIdentityReady)
+		Expect(cond.IsFalse()).To(BeTrue())
+		Expect(cond.Reason).To(Equal(status.KubeletIdentityUnreadyReasonClientIDMismatch))
+	})
+	It("should mark nodeclass as not ready in the bootstrapping client provision mode", func() {
+		ctx := options.ToContext(ctx, test.Options(test.OptionsFields{ProvisionMode: lo.ToPtr(consts.ProvisionModeBootstrappingClient)}))
+		storeIdentity(clientID)
+		_, err := reconciler.Reconcile(ctx, nodeClass)
+		Expect(err).ToNot(HaveOccurred())
+		cond := nodeClass.StatusConditions().Get(v1beta1.ConditionTypeKubeletIdentityReady)
+		Expect(cond.IsFalse()).To(BeTrue())
+		Expect(cond.Reason).To(Equal(status.KubeletIdentityUnreadyReasonUnsupportedProvisionMode))
+	})
+})
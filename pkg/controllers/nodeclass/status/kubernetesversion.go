@@ -24,9 +24,10 @@ import (
 
 	"github.com/awslabs/operatorpkg/reasonable"
 	"github.com/blang/semver/v4"
+	"github.com/samber/lo"
 
 	"github.com/Azure/karpenter-provider-azure/pkg/apis/v1beta1"
-	azurecache "github.com/Azure/karpenter-provider-azure/pkg/cache"
+	"github.com/Azure/karpenter-provider-azure/pkg/operator/options"
 	"github.com/Azure/karpenter-provider-azure/pkg/providers/kubernetesversion"
 
 	controllerruntime "sigs.k8s.io/controller-runtime"
@@ -38,6 +39,12 @@ import (
 
 const (
 	kubernetesVersionReconcilerName = "nodeclass.kubernetesversion"
+
+	// KubernetesVersionUnsupportedReason is the reason of the KubernetesVersionReady condition while the Kubernetes version
+	// the AKSNodeClass overrides is ahead of the API server, or more than maxKubernetesVersionSkew minor versions behind it
+	KubernetesVersionUnsupportedReason = "KubernetesVersionUnsupported"
+	// maxKubernetesVersionSkew is how many minor versions behind the API server the kubelet of the nodes may be
+	maxKubernetesVersionSkew = 2
 )
 
 type KubernetesVersionReconciler struct {
@@ -69,6 +76,8 @@ func (r *KubernetesVersionReconciler) Register(_ context.Context, m manager.Mana
 //  1. Newly created AKSNodeClass, will select the version discovered from the API server
 //  2. If a later kubernetes version is discovered from the API server, we will upgrade to it. [don't currently support rollback]
 //     - Note: We will indirectly trigger an upgrade to latest image version as well, by resetting the Images readiness.
+//
+// The version the AKSNodeClass overrides is selected instead of the discovered one, and is rolled back to if it's earlier.
 func (r *KubernetesVersionReconciler) Reconcile(ctx context.Context, nodeClass *v1beta1.AKSNodeClass) (reconcile.Result, error) {
 	ctx = log.IntoContext(ctx, log.FromContext(ctx).WithName(kubernetesVersionReconcilerName))
 	logger := log.FromContext(ctx).WithValues("existingKubernetesVersion", nodeClass.Status.KubernetesVersion)
@@ -77,6 +86,14 @@ func (r *KubernetesVersionReconciler) Reconcile(ctx context.Context, nodeClass *
 	if err != nil {
 		return reconcile.Result{}, fmt.Errorf("getting kubernetes version, %w", err)
 	}
+	overridden := lo.FromPtr(nodeClass.Spec.KubernetesVersion) != ""
+	if overridden {
+		if err := validateKubernetesVersionOverride(*nodeClass.Spec.KubernetesVersion, goalK8sVersion); err != nil {
+			nodeClass.StatusConditions().SetFalse(v1beta1.ConditionTypeKubernetesVersionReady, KubernetesVersionUnsupportedReason, err.Error())
+			return reconcile.Result{RequeueAfter: options.FromContext(ctx).CacheConfig.KubernetesVersionTTL}, nil
+		}
+		goalK8sVersion = *nodeClass.Spec.KubernetesVersion
+	}
 
 	// Handles case 1: init, update kubernetes status to API server version found
 	if !nodeClass.StatusConditions().Get(v1beta1.ConditionTypeKubernetesVersionReady).IsTrue() || nodeClass.Status.KubernetesVersion == "" {
@@ -95,6 +112,9 @@ func (r *KubernetesVersionReconciler) Reconcile(ctx context.Context, nodeClass *
 		if newK8sVersion.GT(currentK8sVersion) {
 			logger.V(1).Info("kubernetes upgrade detected", "currentKubernetesVersion", currentK8sVersion.String(), "discoveredKubernetesVersion", newK8sVersion.String())
 			nodeClass.StatusConditions().SetFalse(v1beta1.ConditionTypeImagesReady, "KubernetesUpgrade", "Performing kubernetes upgrade, need to get latest images")
+		} else if newK8sVersion.LT(currentK8sVersion) && overridden {
+			logger.V(1).Info("kubernetes version overridden to an earlier version", "currentKubernetesVersion", currentK8sVersion.String(), "overriddenKubernetesVersion", newK8sVersion.String())
+			nodeClass.StatusConditions().SetFalse(v1beta1.ConditionTypeImagesReady, "KubernetesVersionOverride", "Kubernetes version overridden, need to get the images of the version")
 		} else if newK8sVersion.LT(currentK8sVersion) {
 			logger.Info("detected potential kubernetes downgrade, keeping current version", "currentKubernetesVersion", currentK8sVersion.String(), "discoveredKubernetesVersion", newK8sVersion.String())
 			// We do not currently support downgrading, so keep the kubernetes version the same
@@ -106,5 +126,29 @@ func (r *KubernetesVersionReconciler) Reconcile(ctx context.Context, nodeClass *
 	if r.cm.HasChanged(fmt.Sprintf("nodeclass-%s-kubernetesversion", nodeClass.Name), nodeClass.Status.KubernetesVersion) {
 		logger.WithValues("newKubernetesVersion", nodeClass.Status.KubernetesVersion).Info("new kubernetes version updated for nodeclass")
 	}
-	return reconcile.Result{RequeueAfter: azurecache.KubernetesVersionTTL}, nil
+	return reconcile.Result{RequeueAfter: options.FromContext(ctx).CacheConfig.KubernetesVersionTTL}, nil
+}
+
+// validateKubernetesVersionOverride returns an error if the Kubernetes version an AKSNodeClass overrides is ahead of the
+// version of the API server, or more than maxKubernetesVersionSkew minor versions behind it
+func validateKubernetesVersionOverride(override, serverVersion string) error {
+	overrideVersion, err := semver.Parse(override)
+	if err != nil {
+		return fmt.Errorf("parsing kubernetes version %s, %w", override, err)
+	}
+	apiServerVersion, err := semver.Parse(serverVersion)
+	if err != nil {
+		return fmt.Errorf("parsing discovered kubernetes version, %w", err)
+	}
+	// the patch versions of the kubelet and the API server are independent
+	if overrideVersion.Major != apiServerVersion.Major {
+		return fmt.Errorf("kubernetes version %s isn't of the major version of the API server version %s", override, serverVersion)
+	}
+	if overrideVersion.Minor > apiServerVersion.Minor {
+		return fmt.Errorf("kubernetes version %s is ahead of the API server version %s", override, serverVersion)
+	}
+	if overrideVersion.Minor+maxKubernetesVersionSkew < apiServerVersion.Minor {
+		return fmt.Errorf("kubernetes version %s is more than %d minor versions behind the API server version %s", override, maxKubernetesVersionSkew, serverVersion)
+	}
+	return nil
 }
@@ -22,8 +22,10 @@ import (
 	"github.com/Azure/karpenter-provider-azure/pkg/controllers/nodeclass/status"
 	"github.com/Azure/karpenter-provider-azure/pkg/test"
 
+	"github.com/blang/semver/v4"
 	. "github.com/onsi/ginkgo/v2"
 	. "github.com/onsi/gomega"
+	"github.com/samber/lo"
 	"sigs.k8s.io/controller-runtime/pkg/reconcile"
 	. "sigs.k8s.io/karpenter/pkg/test/expectations"
 )
@@ -81,5 +83,59 @@ var _ = Describe("NodeClass KubernetesVersion Status Controller", func() {
 			Expect(nodeClass.StatusConditions().IsTrue(v1beta1.ConditionTypeKubernetesVersionReady)).To(BeTrue())
 			Expect(nodeClass.StatusConditions().Get(v1beta1.ConditionTypeImagesReady).IsFalse()).To(BeTrue())
 		})
+
+		It("Should select the overridden KubernetesVersion, and reset node image readiness to false when it's earlier", func() {
+			nodeClass.Spec.KubernetesVersion = lo.ToPtr(oldK8sVersion)
+			nodeClass.Status.KubernetesVersion = testK8sVersion
+			nodeClass.StatusConditions().SetTrue(v1beta1.ConditionTypeKubernetesVersionReady)
+
+			result, err := k8sReconciler.Reconcile(ctx, nodeClass)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(result).To(Equal(reconcile.Result{RequeueAfter: azurecache.KubernetesVersionTTL}))
+
+			Expect(nodeClass.Status.KubernetesVersion).To(Equal(oldK8sVersion))
+			Expect(nodeClass.StatusConditions().IsTrue(v1beta1.ConditionTypeKubernetesVersionReady)).To(BeTrue())
+			Expect(nodeClass.StatusConditions().Get(v1beta1.ConditionTypeImagesReady).IsFalse()).To(BeTrue())
+		})
+
+		It("Should select the discovered KubernetesVersion once the override is removed", func() {
+			nodeClass.Status.KubernetesVersion = oldK8sVersion
+			nodeClass.StatusConditions().SetTrue(v1beta1.ConditionTypeKubernetesVersionReady)
+
+			_, err := k8sReconciler.Reconcile(ctx, nodeClass)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(nodeClass.Status.KubernetesVersion).To(Equal(testK8sVersion))
+			Expect(nodeClass.StatusConditions().IsTrue(v1beta1.ConditionTypeKubernetesVersionReady)).To(BeTrue())
+		})
+
+		DescribeTable("Should not be ready when the overridden KubernetesVersion is unsupported", func(minorSkew int, message string) {
+			version := lo.Must(semver.Parse(testK8sVersion))
+			version.Minor = uint64(int(version.Minor) + minorSkew)
+			nodeClass.Spec.KubernetesVersion = lo.ToPtr(version.String())
+			nodeClass.Status.KubernetesVersion = testK8sVersion
+			nodeClass.StatusConditions().SetTrue(v1beta1.ConditionTypeKubernetesVersionReady)
+
+			_, err := k8sReconciler.Reconcile(ctx, nodeClass)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(nodeClass.Status.KubernetesVersion).To(Equal(testK8sVersion))
+			condition := nodeClass.StatusConditions().Get(v1beta1.ConditionTypeKubernetesVersionReady)
+			Expect(condition.IsFalse()).To(BeTrue())
+			Expect(condition.Reason).To(Equal(status.KubernetesVersionUnsupportedReason))
+			Expect(condition.Message).To(ContainSubstring(message))
+		},
+			Entry("ahead of the API server", 1, "is ahead of the API server version"),
+			Entry("more than two minor versions behind the API server", -3, "is more than 2 minor versions behind the API server version"),
+		)
+
+		It("Should select an overridden KubernetesVersion two minor versions behind the API server", func() {
+			version := lo.Must(semver.Parse(testK8sVersion))
+			version.Minor -= 2
+			nodeClass.Spec.KubernetesVersion = lo.ToPtr(version.String())
+
+			_, err := k8sReconciler.Reconcile(ctx, nodeClass)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(nodeClass.Status.KubernetesVersion).To(Equal(version.String()))
+			Expect(nodeClass.StatusConditions().IsTrue(v1beta1.ConditionTypeKubernetesVersionReady)).To(BeTrue())
+		})
 	})
 })
@@ -0,0 +1,58 @@
+/*
+Portions Copyright (c) Microsoft Corporation.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package status
+
+import (
+	"context"
+
+	"k8s.io/utils/clock"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	"github.com/Azure/karpenter-provider-azure/pkg/apis/v1beta1"
+)
+
+const maintenanceWindowReconcilerName = "nodeclass.maintenancewindow"
+
+// MaintenanceWindowReconciler reports in the status of an AKSNodeClass with a maintenance window whether it's open, and
+// when it next opens, requeueing the AKSNodeClass to update it as the window opens and closes
+type MaintenanceWindowReconciler struct {
+	clock clock.Clock
+}
+
+func NewMaintenanceWindowReconciler(clk clock.Clock) *MaintenanceWindowReconciler {
+	return &MaintenanceWindowReconciler{
+		clock: clk,
+	}
+}
+
+func (r *MaintenanceWindowReconciler) Reconcile(ctx context.Context, nodeClass *v1beta1.AKSNodeClass) (reconcile.Result, error) {
+	if nodeClass.Spec.MaintenanceWindow == nil {
+		nodeClass.Status.MaintenanceWindow = nil
+		return reconcile.Result{}, nil
+	}
+	now := r.clock.Now()
+	status, err := nodeClass.Spec.MaintenanceWindow.Status(now)
+	if err != nil {
+		// an invalid window doesn't block disruption, which is logged by the nodeclaim maintenance window controller too
+		log.FromContext(ctx).WithName(maintenanceWindowReconcilerName).Error(err, "invalid maintenance window")
+		nodeClass.Status.MaintenanceWindow = nil
+		return reconcile.Result{}, nil
+	}
+	nodeClass.Status.MaintenanceWindow = status
+	return reconcile.Result{RequeueAfter: status.NextTransition().Sub(now)}, nil
+}
@@ -0,0 +1,85 @@
+/*
+Portions Copyright (c) Microsoft Corporation.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package status_test
+
+import (
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/samber/lo"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	. "sigs.k8s.io/karpenter/pkg/test/expectations"
+
+	"github.com/Azure/karpenter-provider-azure/pkg/apis/v1beta1"
+	"github.com/Azure/karpenter-provider-azure/pkg/controllers/nodeclass/status"
+	"github.com/Azure/karpenter-provider-azure/pkg/test"
+)
+
+var _ = Describe("MaintenanceWindowStatus", func() {
+	var nodeClass *v1beta1.AKSNodeClass
+	var reconciler *status.MaintenanceWindowReconciler
+
+	BeforeEach(func() {
+		// a Friday
+		fakeClock.SetTime(lo.Must(time.Parse(time.RFC3339, "2026-10-16T12:00:00Z")))
+		reconciler = status.NewMaintenanceWindowReconciler(fakeClock)
+		nodeClass = test.AKSNodeClass()
+		// Sundays 02:00-06:00 UTC
+		nodeClass.Spec.MaintenanceWindow = &v1beta1.MaintenanceWindow{Schedule: "0 2 * * 0", Duration: metav1.Duration{Duration: 4 * time.Hour}}
+	})
+
+	It("should not report a maintenance window when none is specified", func() {
+		nodeClass.Spec.MaintenanceWindow = nil
+		nodeClass.Status.MaintenanceWindow = &v1beta1.MaintenanceWindowStatus{Open: true}
+		result, err := reconciler.Reconcile(ctx, nodeClass)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(result.RequeueAfter).To(BeZero())
+		Expect(nodeClass.Status.MaintenanceWindow).To(BeNil())
+	})
+	It("should report a closed maintenance window, and requeue as it opens", func() {
+		result, err := reconciler.Reconcile(ctx, nodeClass)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(nodeClass.Status.MaintenanceWindow.Open).To(BeFalse())
+		Expect(nodeClass.Status.MaintenanceWindow.CloseTime).To(BeNil())
+		Expect(nodeClass.Status.MaintenanceWindow.NextOpenTime.Time).To(BeTemporally("==", fakeClock.Now().Add(38*time.Hour)))
+		Expect(result.RequeueAfter).To(Equal(38 * time.Hour))
+	})
+	It("should report an open maintenance window, and requeue as it closes", func() {
+		fakeClock.Step(39 * time.Hour)
+		result, err := reconciler.Reconcile(ctx, nodeClass)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(nodeClass.Status.MaintenanceWindow.Open).To(BeTrue())
+		Expect(nodeClass.Status.MaintenanceWindow.CloseTime.Time).To(BeTemporally("==", fakeClock.Now().Add(3*time.Hour)))
+		Expect(nodeClass.Status.MaintenanceWindow.NextOpenTime.Time).To(BeTemporally("==", fakeClock.Now().Add(7*24*time.Hour-time.Hour)))
+		Expect(result.RequeueAfter).To(Equal(3 * time.Hour))
+	})
+	It("should not report an invalid maintenance window", func() {
+		nodeClass.Spec.MaintenanceWindow.TimeZone = lo.ToPtr("Mars/Olympus")
+		result, err := reconciler.Reconcile(ctx, nodeClass)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(result.RequeueAfter).To(BeZero())
+		Expect(nodeClass.Status.MaintenanceWindow).To(BeNil())
+	})
+	It("should report the maintenance window by the clock of the status controller", func() {
+		ExpectApplied(ctx, env.Client, nodeClass)
+		ExpectObjectReconciled(ctx, env.Client, controller, nodeClass)
+		nodeClass = ExpectExists(ctx, env.Client, nodeClass)
+		Expect(nodeClass.Status.MaintenanceWindow.Open).To(BeFalse())
+		Expect(nodeClass.Status.MaintenanceWindow.NextOpenTime.Time).To(BeTemporally("==", fakeClock.Now().Add(38*time.Hour)))
+	})
+})
@@ -0,0 +1,205 @@
+/*
+Portions Copyright (c) Microsoft Corporation.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package status
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"strings"
+
+	"github.com/awslabs/operatorpkg/object"
+	"github.com/awslabs/operatorpkg/reasonable"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/samber/lo"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	controllerruntime "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/builder"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/manager"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+	karpv1 "sigs.k8s.io/karpenter/pkg/apis/v1"
+	"sigs.k8s.io/karpenter/pkg/operator/injection"
+
+	"github.com/Azure/karpenter-provider-azure/pkg/apis/v1beta1"
+	"github.com/Azure/karpenter-provider-azure/pkg/cloudprovider"
+	"github.com/Azure/karpenter-provider-azure/pkg/metrics"
+)
+
+// maxImageLabelLength bounds the length of the image label values; longer image IDs are shortened by imageLabel
+const maxImageLabelLength = 64
+
+// MetricsController exports the readiness of the AKSNodeClasses and the composition of the nodes launched from them:
+// how many there are, on which image versions, and how many drifted from the images and are pending replacement.
+// Besides AKSNodeClass changes, it reconciles on nodes being added or removed and on their NodeClaims changing image
+// or drifting, so the gauges follow the fleet between status reconciles.
+type MetricsController struct {
+	kubeClient client.Client
+}
+
+func NewMetricsController(kubeClient client.Client) *MetricsController {
+	return &MetricsController{
+		kubeClient: kubeClient,
+	}
+}
+
+func (c *MetricsController) Reconcile(ctx context.Context, req reconcile.Request) (reconcile.Result, error) {
+	ctx = injection.WithControllerName(ctx, "nodeclass.metrics")
+
+	nodeClass := &v1beta1.AKSNodeClass{}
+	if err := c.kubeClient.Get(ctx, req.NamespacedName, nodeClass); err != nil {
+		if errors.IsNotFound(err) {
+			deleteNodeClassMetrics(req.Name)
+			return reconcile.Result{}, nil
+		}
+		return reconcile.Result{}, err
+	}
+
+	nodes := &corev1.NodeList{}
+	if err := c.kubeClient.List(ctx, nodes, client.MatchingLabels{nodeClassLabelKey(): nodeClass.Name}); err != nil {
+		return reconcile.Result{}, fmt.Errorf("listing nodes, %w", err)
+	}
+	nodeClaims := &karpv1.NodeClaimList{}
+	if err := c.kubeClient.List(ctx, nodeClaims, client.MatchingFields{"spec.nodeClassRef.name": nodeClass.Name}); err != nil {
+		return reconcile.Result{}, fmt.Errorf("listing nodeclaims, %w", err)
+	}
+	nodeClaimsByProviderID := lo.SliceToMap(nodeClaims.Items, func(nodeClaim karpv1.NodeClaim) (string, karpv1.NodeClaim) {
+		return nodeClaim.Status.ProviderID, nodeClaim
+	})
+
+	imageNodes := map[string]int{}
+	imageDriftedNodes := 0
+	for _, node := range nodes.Items {
+		nodeClaim, ok := nodeClaimsByProviderID[node.Spec.ProviderID]
+		if !ok || node.Spec.ProviderID == "" {
+			continue
+		}
+		if nodeClaim.Status.ImageID != "" {
+			imageNodes[imageLabel(nodeClaim.Status.ImageID)]++
+		}
+		if drifted := nodeClaim.StatusConditions().Get(karpv1.ConditionTypeDrifted); drifted.IsTrue() && drifted.Reason == string(cloudprovider.ImageDrift) {
+			imageDriftedNodes++
+		}
+	}
+
+	// reset the series of the nodeclass, so that conditions and image versions that are gone don't linger
+	deleteNodeClassMetrics(nodeClass.Name)
+	for _, condition := range nodeClass.Status.Conditions {
+		metrics.NodeClassConditionStatus.WithLabelValues(nodeClass.Name, condition.Type).Set(lo.Ternary(condition.Status == metav1.ConditionTrue, 1.0, 0.0))
+	}
+	metrics.NodeClassNodes.WithLabelValues(nodeClass.Name).Set(float64(len(nodes.Items)))
+	for image, count := range imageNodes {
+		metrics.NodeClassImageNodes.WithLabelValues(nodeClass.Name, image).Set(float64(count))
+	}
+	metrics.NodeClassImageDriftedNodes.WithLabelValues(nodeClass.Name).Set(float64(imageDriftedNodes))
+	return reconcile.Result{}, nil
+}
+
+func deleteNodeClassMetrics(nodeClassName string) {
+	labels := prometheus.Labels{metrics.NodeClassLabel: nodeClassName}
+	metrics.NodeClassConditionStatus.DeletePartialMatch(labels)
+	metrics.NodeClassNodes.DeletePartialMatch(labels)
+	metrics.NodeClassImageNodes.DeletePartialMatch(labels)
+	metrics.NodeClassImageDriftedNodes.DeletePartialMatch(labels)
+}
+
+// nodeClassLabelKey is the label karpenter sets on nodes with the name of their AKSNodeClass
+func nodeClassLabelKey() string {
+	return karpv1.NodeClassLabelKey(object.GVK(&v1beta1.AKSNodeClass{}).GroupKind())
+}
+
+// imageLabel bounds the length of image IDs used as label values. Longer IDs, e.g. SIG and community gallery image
+// version IDs, are shortened to their image name and version followed by a hash of the ID, which keeps them readable
+// and distinct, e.g. ".../images/2204gen2containerd/versions/202501.02.0" => "2204gen2containerd/202501.02.0-1a2b3c4d"
+func imageLabel(imageID string) string {
+	if len(imageID) <= maxImageLabelLength {
+		return imageID
+	}
+	sum := sha256.Sum256([]byte(imageID))
+	hash := hex.EncodeToString(sum[:])[:8]
+	parts := strings.Split(imageID, "/")
+	name := parts[len(parts)-1]
+	if len(parts) >= 3 && strings.EqualFold(parts[len(parts)-2], "versions") {
+		name = parts[len(parts)-3] + "/" + name
+	}
+	name = name[:min(len(name), maxImageLabelLength-len(hash)-1)]
+	return name + "-" + hash
+}
+
+func (c *MetricsController) Register(_ context.Context, m manager.Manager) error {
+	return controllerruntime.NewControllerManagedBy(m).
+		Named("nodeclass.metrics").
+		For(&v1beta1.AKSNodeClass{}, builder.WithPredicates(predicate.Funcs{
+			// the conditions are all that is reported from the AKSNodeClass itself
+			UpdateFunc: func(e event.UpdateEvent) bool {
+				return !equality.Semantic.DeepEqual(e.ObjectOld.(*v1beta1.AKSNodeClass).Status.Conditions, e.ObjectNew.(*v1beta1.AKSNodeClass).Status.Conditions)
+			},
+		})).
+		Watches(
+			&corev1.Node{},
+			handler.EnqueueRequestsFromMapFunc(func(_ context.Context, o client.Object) []reconcile.Request {
+				name, ok := o.GetLabels()[nodeClassLabelKey()]
+				if !ok {
+					return nil
+				}
+				return []reconcile.Request{{NamespacedName: types.NamespacedName{Name: name}}}
+			}),
+			// nodes being added or removed, or labeled with their nodeclass after registration
+			builder.WithPredicates(predicate.Funcs{
+				UpdateFunc: func(e event.UpdateEvent) bool {
+					return e.ObjectOld.GetLabels()[nodeClassLabelKey()] != e.ObjectNew.GetLabels()[nodeClassLabelKey()]
+				},
+			}),
+		).
+		Watches(
+			&karpv1.NodeClaim{},
+			handler.EnqueueRequestsFromMapFunc(func(_ context.Context, o client.Object) []reconcile.Request {
+				nc := o.(*karpv1.NodeClaim)
+				if nc.Spec.NodeClassRef == nil {
+					return nil
+				}
+				return []reconcile.Request{{NamespacedName: types.NamespacedName{Name: nc.Spec.NodeClassRef.Name}}}
+			}),
+			// nodeclaims of existing nodes resolving their image or drifting
+			builder.WithPredicates(predicate.Funcs{
+				CreateFunc: func(e event.CreateEvent) bool { return false },
+				UpdateFunc: func(e event.UpdateEvent) bool {
+					oldNodeClaim, newNodeClaim := e.ObjectOld.(*karpv1.NodeClaim), e.ObjectNew.(*karpv1.NodeClaim)
+					return oldNodeClaim.Status.ProviderID != newNodeClaim.Status.ProviderID ||
+						oldNodeClaim.Status.ImageID != newNodeClaim.Status.ImageID ||
+						!equality.Semantic.DeepEqual(oldNodeClaim.StatusConditions().Get(karpv1.ConditionTypeDrifted), newNodeClaim.StatusConditions().Get(karpv1.ConditionTypeDrifted))
+				},
+				DeleteFunc: func(e event.DeleteEvent) bool { return false },
+			}),
+		).
+		WithOptions(controller.Options{
+			RateLimiter: reasonable.RateLimiter(),
+			// TODO: Document why this magic number used. If we want to consistently use it accoss reconcilers, refactor to a reused const.
+			// Comments thread discussing this: https://github.com/Azure/karpenter-provider-azure/pull/729#discussion_r2006629809
+			MaxConcurrentReconciles: 10,
+		}).
+		Complete(c)
+}
@@ -0,0 +1,173 @@
+/*
+Portions Copyright (c) Microsoft Corporation.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package status_test
+
+import (
+	"fmt"
+
+	"github.com/awslabs/operatorpkg/object"
+	"github.com/awslabs/operatorpkg/status"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/samber/lo"
+	corev1 "k8s.io/api/core/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	crmetrics "sigs.k8s.io/controller-runtime/pkg/metrics"
+	karpv1 "sigs.k8s.io/karpenter/pkg/apis/v1"
+	coretest "sigs.k8s.io/karpenter/pkg/test"
+
+	"github.com/Azure/karpenter-provider-azure/pkg/apis/v1beta1"
+	"github.com/Azure/karpenter-provider-azure/pkg/cloudprovider"
+	nodeclassstatus "github.com/Azure/karpenter-provider-azure/pkg/controllers/nodeclass/status"
+	"github.com/Azure/karpenter-provider-azure/pkg/metrics"
+	"github.com/Azure/karpenter-provider-azure/pkg/test"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	. "sigs.k8s.io/karpenter/pkg/test/expectations"
+)
+
+const (
+	shortImageID = "/CommunityGalleries/AKSUbuntu/images/2204/versions/1.0.0"
+	longImageID  = "/CommunityGalleries/AKSUbuntu-38d80f77-467a-481f-a8d4-09b6d4220bd2/images/2204gen2containerd/versions/202501.02.0"
+)
+
+var _ = Describe("NodeClass Metrics Controller", func() {
+	var metricsController *nodeclassstatus.MetricsController
+
+	BeforeEach(func() {
+		metricsController = nodeclassstatus.NewMetricsController(env.Client)
+		test.ApplyDefaultStatus(nodeClass, env, false)
+	})
+
+	nodeClaimAndNode := func(imageID string) (*karpv1.NodeClaim, *corev1.Node) {
+		return coretest.NodeClaimAndNode(karpv1.NodeClaim{
+			Spec: karpv1.NodeClaimSpec{
+				NodeClassRef: &karpv1.NodeClassReference{
+					Group: object.GVK(nodeClass).Group,
+					Kind:  object.GVK(nodeClass).Kind,
+					Name:  nodeClass.Name,
+				},
+			},
+			Status: karpv1.NodeClaimStatus{
+				ProviderID: coretest.RandomProviderID(),
+				ImageID:    imageID,
+			},
+		})
+	}
+
+	gaugeValue := func(name string, labels map[string]string) float64 {
+		GinkgoHelper()
+		metric, err := metrics.FindMetricWithLabelValues(name, labels)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(metric).ToNot(BeNil(), fmt.Sprintf("expected a %s series with labels %v", name, labels))
+		return metric.GetGauge().GetValue()
+	}
+
+	// imageNodesByLabel returns the nodes of the nodeclass per image label
+	imageNodesByLabel := func() map[string]float64 {
+		GinkgoHelper()
+		families, err := crmetrics.Registry.Gather()
+		Expect(err).ToNot(HaveOccurred())
+		imageNodes := map[string]float64{}
+		for _, family := range families {
+			if family.GetName() != "karpenter_nodeclass_image_nodes" {
+				continue
+			}
+			for _, metric := range family.GetMetric() {
+				labels := lo.SliceToMap(metric.GetLabel(), func(label *dto.LabelPair) (string, string) { return label.GetName(), label.GetValue() })
+				if labels[metrics.NodeClassLabel] == nodeClass.Name {
+					imageNodes[labels[metrics.ImageLabel]] = metric.GetGauge().GetValue()
+				}
+			}
+		}
+		return imageNodes
+	}
+
+	It("should report the readiness of the nodeclass per condition", func() {
+		nodeClass.StatusConditions().SetFalse(v1beta1.ConditionTypeSubnetsReady, "SubnetNotFound", "subnet not found")
+		ExpectApplied(ctx, env.Client, nodeClass)
+		ExpectReconcileSucceeded(ctx, metricsController, client.ObjectKeyFromObject(nodeClass))
+
+		Expect(gaugeValue("karpenter_nodeclass_condition_status", map[string]string{metrics.NodeClassLabel: nodeClass.Name, metrics.ConditionLabel: v1beta1.ConditionTypeImagesReady})).To(BeNumerically("==", 1))
+		Expect(gaugeValue("karpenter_nodeclass_condition_status", map[string]string{metrics.NodeClassLabel: nodeClass.Name, metrics.ConditionLabel: v1beta1.ConditionTypeSubnetsReady})).To(BeNumerically("==", 0))
+		Expect(gaugeValue("karpenter_nodeclass_condition_status", map[string]string{metrics.NodeClassLabel: nodeClass.Name, metrics.ConditionLabel: status.ConditionReady})).To(BeNumerically("==", 0))
+	})
+
+	It("should report the nodes of the nodeclass per image version, hashing long image IDs", func() {
+		for _, imageID := range []string{shortImageID, longImageID, longImageID} {
+			nodeClaim, node := nodeClaimAndNode(imageID)
+			ExpectApplied(ctx, env.Client, nodeClass, nodeClaim, node)
+		}
+		ExpectReconcileSucceeded(ctx, metricsController, client.ObjectKeyFromObject(nodeClass))
+
+		Expect(gaugeValue("karpenter_nodeclass_nodes", map[string]string{metrics.NodeClassLabel: nodeClass.Name})).To(BeNumerically("==", 3))
+		imageNodes := imageNodesByLabel()
+		Expect(imageNodes).To(HaveLen(2))
+		Expect(imageNodes).To(HaveKeyWithValue(shortImageID, 1.0))
+		Expect(imageNodes).ToNot(HaveKey(longImageID))
+		for image, count := range imageNodes {
+			if image != shortImageID {
+				Expect(image).To(HavePrefix("2204gen2containerd/202501.02.0-"))
+				Expect(len(image)).To(BeNumerically("<=", 64))
+				Expect(count).To(BeNumerically("==", 2))
+			}
+		}
+	})
+
+	It("should report the nodes pending replacement after drifting from the images", func() {
+		drifted, driftedNode := nodeClaimAndNode(shortImageID)
+		drifted.StatusConditions().SetTrueWithReason(karpv1.ConditionTypeDrifted, string(cloudprovider.ImageDrift), string(cloudprovider.ImageDrift))
+		k8sDrifted, k8sDriftedNode := nodeClaimAndNode(shortImageID)
+		k8sDrifted.StatusConditions().SetTrueWithReason(karpv1.ConditionTypeDrifted, string(cloudprovider.K8sVersionDrift), string(cloudprovider.K8sVersionDrift))
+		nodeClaim, node := nodeClaimAndNode(shortImageID)
+		ExpectApplied(ctx, env.Client, nodeClass, drifted, driftedNode, k8sDrifted, k8sDriftedNode, nodeClaim, node)
+		ExpectReconcileSucceeded(ctx, metricsController, client.ObjectKeyFromObject(nodeClass))
+
+		Expect(gaugeValue("karpenter_nodeclass_image_drifted_nodes", map[string]string{metrics.NodeClassLabel: nodeClass.Name})).To(BeNumerically("==", 1))
+	})
+
+	It("should follow nodes being removed", func() {
+		nodeClaim, node := nodeClaimAndNode(shortImageID)
+		ExpectApplied(ctx, env.Client, nodeClass, nodeClaim, node)
+		ExpectReconcileSucceeded(ctx, metricsController, client.ObjectKeyFromObject(nodeClass))
+		Expect(gaugeValue("karpenter_nodeclass_image_nodes", map[string]string{metrics.NodeClassLabel: nodeClass.Name, metrics.ImageLabel: shortImageID})).To(BeNumerically("==", 1))
+
+		ExpectDeleted(ctx, env.Client, node)
+		ExpectReconcileSucceeded(ctx, metricsController, client.ObjectKeyFromObject(nodeClass))
+
+		Expect(gaugeValue("karpenter_nodeclass_nodes", map[string]string{metrics.NodeClassLabel: nodeClass.Name})).To(BeNumerically("==", 0))
+		Expect(imageNodesByLabel()).To(BeEmpty())
+	})
+
+	It("should delete the metrics of deleted nodeclasses", func() {
+		ExpectApplied(ctx, env.Client, nodeClass)
+		ExpectReconcileSucceeded(ctx, metricsController, client.ObjectKeyFromObject(nodeClass))
+		Expect(gaugeValue("karpenter_nodeclass_nodes", map[string]string{metrics.NodeClassLabel: nodeClass.Name})).To(BeNumerically("==", 0))
+
+		ExpectDeleted(ctx, env.Client, nodeClass)
+		ExpectReconcileSucceeded(ctx, metricsController, client.ObjectKeyFromObject(nodeClass))
+
+		for _, name := range []string{"karpenter_nodeclass_nodes", "karpenter_nodeclass_image_drifted_nodes"} {
+			metric, err := metrics.FindMetricWithLabelValues(name, map[string]string{metrics.NodeClassLabel: nodeClass.Name})
+			Expect(err).ToNot(HaveOccurred())
+			Expect(metric).To(BeNil(), fmt.Sprintf("expected no %s series", name))
+		}
+		metric, err := metrics.FindMetricWithLabelValues("karpenter_nodeclass_condition_status", map[string]string{metrics.NodeClassLabel: nodeClass.Name, metrics.ConditionLabel: status.ConditionReady})
+		Expect(err).ToNot(HaveOccurred())
+		Expect(metric).To(BeNil())
+	})
+})
@@ -27,6 +27,7 @@ import (
 	"sigs.k8s.io/controller-runtime/pkg/reconcile"
 
 	sdkerrors "github.com/Azure/azure-sdk-for-go-extensions/pkg/errors"
+	"github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/authorization/armauthorization/v2"
 	"github.com/Azure/karpenter-provider-azure/pkg/apis/v1beta1"
 	"github.com/Azure/karpenter-provider-azure/pkg/operator/options"
 	"github.com/Azure/karpenter-provider-azure/pkg/providers/instance"
@@ -34,12 +35,12 @@ import (
 )
 
 type SubnetReconciler struct {
-	subnetClient instance.SubnetsAPI
+	azClient *instance.AZClient
 }
 
-func NewSubnetReconciler(subnetClient instance.SubnetsAPI) *SubnetReconciler {
+func NewSubnetReconciler(azClient *instance.AZClient) *SubnetReconciler {
 	return &SubnetReconciler{
-		subnetClient: subnetClient,
+		azClient: azClient,
 	}
 }
 
@@ -47,6 +48,8 @@ const (
 	SubnetUnreadyReasonNotFound = "SubnetNotFound"
 
 	SubnetUnreadyReasonIDInvalid = "SubnetIDInvalid"
+
+	SubnetUnreadyReasonJoinPermissionMissing = "SubnetJoinPermissionMissing"
 )
 
 const (
@@ -63,7 +66,6 @@ func (r *SubnetReconciler) Reconcile(ctx context.Context, nodeClass *v1beta1.AKS
 }
 
 func (r *SubnetReconciler) validateVNETSubnetID(ctx context.Context, nodeClass *v1beta1.AKSNodeClass) (reconcile.Result, error) {
-	clusterSubnetID := options.FromContext(ctx).SubnetID
 	subnetID := lo.Ternary(nodeClass.Spec.VNETSubnetID != nil, lo.FromPtr(nodeClass.Spec.VNETSubnetID), options.FromContext(ctx).SubnetID)
 	logger := log.FromContext(ctx).WithName(subnetReconcilerName).WithValues("subnetID", subnetID)
 
@@ -77,24 +79,14 @@ func (r *SubnetReconciler) validateVNETSubnetID(ctx context.Context, nodeClass *
 		)
 		return reconcile.Result{}, nil
 	}
-	if subnetID != clusterSubnetID {
-		clusterSubnetIDParts, err := utils.GetVnetSubnetIDComponents(clusterSubnetID) // Assume valid cluster subnet id
-		if err != nil {                                                               // Highly unlikely case but putting it in nonetheless
-			logger.Error(err, "failed to parse cluster subnet ID", "clusterSubnetID", clusterSubnetID)
-			return reconcile.Result{}, nil
-		}
-		if !clusterSubnetIDParts.IsSameVNET(nodeClassSubnetComponents) {
-			logger.Error(nil, "subnet does not match cluster subscription, resource group, or virtual network", "subnetID", subnetID)
-			nodeClass.StatusConditions().SetFalse(
-				v1beta1.ConditionTypeSubnetsReady,
-				SubnetUnreadyReasonIDInvalid,
-				fmt.Sprintf("vnetSubnetID does not match the cluster subscription, resource group, or virtual network: %s", subnetID),
-			)
-			return reconcile.Result{}, nil
-		}
+	// The subnet may be in a virtual network of another resource group, or subscription, than the cluster's,
+	// so it is read with the clients of its own subscription
+	azClient, err := r.azClient.ForSubscription(nodeClassSubnetComponents.SubscriptionID)
+	if err != nil {
+		logger.Error(err, "creating clients for the subnet subscription failed")
+		return reconcile.Result{}, err
 	}
-
-	_, err = r.subnetClient.Get(ctx, nodeClassSubnetComponents.ResourceGroupName, nodeClassSubnetComponents.VNetName, nodeClassSubnetComponents.SubnetName, nil)
+	_, err = azClient.SubnetsClient().Get(ctx, nodeClassSubnetComponents.ResourceGroupName, nodeClassSubnetComponents.VNetName, nodeClassSubnetComponents.SubnetName, nil)
 	if err != nil {
 		azErr := sdkerrors.IsResponseError(err)
 		if azErr != nil && (azErr.StatusCode == http.StatusNotFound) {
@@ -109,8 +101,44 @@ func (r *SubnetReconciler) validateVNETSubnetID(ctx context.Context, nodeClass *
 		return reconcile.Result{}, err
 	}
 
+	// Karpenter is granted access to the cluster's virtual network, for other virtual networks creating a network
+	// interface fails if the join permission hasn't been granted
+	if !r.isInClusterVNET(ctx, nodeClassSubnetComponents) {
+		permitted, err := r.isSubnetJoinPermitted(ctx, azClient, nodeClassSubnetComponents)
+		if err != nil {
+			// not being able to check the permission doesn't mean it is missing
+			logger.Error(err, "listing permissions on subnet failed")
+		} else if !permitted {
+			nodeClass.StatusConditions().SetFalse(
+				v1beta1.ConditionTypeSubnetsReady,
+				SubnetUnreadyReasonJoinPermissionMissing,
+				fmt.Sprintf("missing permission %s on subnet %s", utils.SubnetJoinAction, subnetID),
+			)
+			return reconcile.Result{RequeueAfter: healthyRequeueInterval}, nil
+		}
+	}
+
 	nodeClass.StatusConditions().SetTrue(v1beta1.ConditionTypeSubnetsReady)
 
 	// Periodically requeue just in case subnet has been removed or later revalidating things like fullness etc
 	return reconcile.Result{RequeueAfter: healthyRequeueInterval}, nil
 }
+
+func (r *SubnetReconciler) isInClusterVNET(ctx context.Context, subnet utils.VnetSubnetResource) bool {
+	clusterSubnet, err := utils.GetVnetSubnetIDComponents(options.FromContext(ctx).SubnetID)
+	return err == nil && clusterSubnet.IsSameVNET(subnet)
+}
+
+func (r *SubnetReconciler) isSubnetJoinPermitted(ctx context.Context, azClient *instance.AZClient, subnet utils.VnetSubnetResource) (bool, error) {
+	var permissions []*armauthorization.Permission
+	pager := azClient.PermissionsClient().NewListForResourcePager(subnet.ResourceGroupName, "Microsoft.Network",
+		fmt.Sprintf("virtualNetworks/%s", subnet.VNetName), "subnets", subnet.SubnetName, nil)
+	for pager.More() {
+		page, err := pager.NextPage(ctx)
+		if err != nil {
+			return false, err
+		}
+		permissions = append(permissions, page.Value...)
+	}
+	return utils.IsActionPermitted(permissions, utils.SubnetJoinAction), nil
+}
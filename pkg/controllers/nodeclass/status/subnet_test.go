@@ -22,6 +22,7 @@ import (
 	"time"
 
 	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
+	"github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/authorization/armauthorization/v2"
 	"github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/network/armnetwork"
 	"github.com/Azure/karpenter-provider-azure/pkg/apis/v1beta1"
 	"github.com/Azure/karpenter-provider-azure/pkg/controllers/nodeclass/status"
@@ -98,7 +99,7 @@ var _ = Describe("SubnetStatus", func() {
 		var reconciler *status.SubnetReconciler
 
 		BeforeEach(func() {
-			reconciler = status.NewSubnetReconciler(azureEnv.SubnetsAPI)
+			reconciler = status.NewSubnetReconciler(azureEnv.AZClient)
 			nodeClass = test.AKSNodeClass()
 		})
 
@@ -168,5 +169,45 @@ var _ = Describe("SubnetStatus", func() {
 			cond := nodeClass.StatusConditions().Get(v1beta1.ConditionTypeSubnetsReady)
 			Expect(cond.IsTrue()).To(BeTrue())
 		})
+
+		DescribeTable("should accept subnets outside of the cluster virtual network",
+			func(subnetID string, expectedResourceGroup string) {
+				nodeClass.Spec.VNETSubnetID = lo.ToPtr(subnetID)
+				azureEnv.SubnetsAPI.GetFunc = func(ctx context.Context, resourceGroupName string, virtualNetworkName string, subnetName string, options *armnetwork.SubnetsClientGetOptions) (armnetwork.SubnetsClientGetResponse, error) {
+					Expect(resourceGroupName).To(Equal(expectedResourceGroup))
+					return armnetwork.SubnetsClientGetResponse{}, nil
+				}
+
+				result, err := reconciler.Reconcile(ctx, nodeClass)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(result).To(Equal(reconcile.Result{RequeueAfter: time.Minute * 3}))
+				Expect(nodeClass.StatusConditions().Get(v1beta1.ConditionTypeSubnetsReady).IsTrue()).To(BeTrue())
+			},
+			Entry("same subscription and resource group",
+				"/subscriptions/12345678-1234-1234-1234-123456789012/resourceGroups/test-resourceGroup/providers/Microsoft.Network/virtualNetworks/other-vnet/subnets/other-subnet", "test-resourceGroup"),
+			Entry("another resource group",
+				"/subscriptions/12345678-1234-1234-1234-123456789012/resourceGroups/network-resourceGroup/providers/Microsoft.Network/virtualNetworks/shared-vnet/subnets/shared-subnet", "network-resourceGroup"),
+			Entry("another subscription",
+				"/subscriptions/87654321-4321-4321-4321-210987654321/resourceGroups/network-resourceGroup/providers/Microsoft.Network/virtualNetworks/shared-vnet/subnets/shared-subnet", "network-resourceGroup"),
+		)
+
+		It("should mark nodeclass as not ready when the subnet join permission is missing", func() {
+			nodeClass.Spec.VNETSubnetID = lo.ToPtr("/subscriptions/87654321-4321-4321-4321-210987654321/resourceGroups/network-resourceGroup/providers/Microsoft.Network/virtualNetworks/shared-vnet/subnets/shared-subnet")
+			azureEnv.PermissionsAPI.Permissions = []*armauthorization.Permission{{Actions: []*string{lo.ToPtr("*/read")}}}
+
+			_, err := reconciler.Reconcile(ctx, nodeClass)
+			Expect(err).ToNot(HaveOccurred())
+			cond := nodeClass.StatusConditions().Get(v1beta1.ConditionTypeSubnetsReady)
+			Expect(cond.IsFalse()).To(BeTrue())
+			Expect(cond.Reason).To(Equal(status.SubnetUnreadyReasonJoinPermissionMissing))
+		})
+
+		It("should not check the subnet join permission in the cluster virtual network", func() {
+			azureEnv.PermissionsAPI.Permissions = []*armauthorization.Permission{{Actions: []*string{lo.ToPtr("*/read")}}}
+
+			_, err := reconciler.Reconcile(ctx, nodeClass)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(nodeClass.StatusConditions().Get(v1beta1.ConditionTypeSubnetsReady).IsTrue()).To(BeTrue())
+		})
 	})
 })
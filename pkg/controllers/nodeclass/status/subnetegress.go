@@ -0,0 +1,253 @@
+/*
+Portions Copyright (c) Microsoft Corporation.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package status
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/arm"
+	"github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/network/armnetwork"
+	"github.com/samber/lo"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+	karpv1 "sigs.k8s.io/karpenter/pkg/apis/v1"
+	"sigs.k8s.io/karpenter/pkg/scheduling"
+
+	"github.com/Azure/karpenter-provider-azure/pkg/apis"
+	"github.com/Azure/karpenter-provider-azure/pkg/apis/v1beta1"
+	"github.com/Azure/karpenter-provider-azure/pkg/operator/options"
+	"github.com/Azure/karpenter-provider-azure/pkg/providers/instance"
+	"github.com/Azure/karpenter-provider-azure/pkg/providers/instancetype"
+	"github.com/Azure/karpenter-provider-azure/pkg/utils"
+)
+
+const (
+	subnetEgressReconcilerName = "nodeclass.subnetegress"
+
+	// SubnetEgressDefaultRouteDroppedReason is the reason of the SubnetEgressUnavailable condition while the route table of
+	// the subnet drops the traffic of its default route, so that no zone has an egress path
+	SubnetEgressDefaultRouteDroppedReason = "DefaultRouteDropped"
+	// SubnetEgressNATGatewayZoneMismatchReason is the reason of the SubnetEgressUnavailable condition while the NAT gateway
+	// of the subnet is zonal, and some of the zones launched into aren't among its zones
+	SubnetEgressNATGatewayZoneMismatchReason = "NATGatewayZoneMismatch"
+	// SubnetEgressLaunchZonesUnknownReason is the reason of the SubnetEgressUnavailable condition while the zones the
+	// NodePools referencing the AKSNodeClass launch into can't be resolved, so that the egress can't be checked
+	SubnetEgressLaunchZonesUnknownReason = "LaunchZonesUnknown"
+
+	defaultRouteAddressPrefix = "0.0.0.0/0"
+)
+
+// SubnetEgressReconciler cross-references the NAT gateway and route table of the subnet of an AKSNodeClass with the zones
+// the NodePools referencing it launch into, and surfaces the zones without a sane egress path through the
+// SubnetEgressUnavailable condition. Nodes launched into such zones can't bootstrap, or black-hole the traffic of their
+// pods, with nothing pointing at the subnet. It's advisory: launches aren't blocked, as the egress may be provided in
+// ways that aren't checked, e.g. by a virtual appliance.
+type SubnetEgressReconciler struct {
+	kubeClient           client.Client
+	azClient             *instance.AZClient
+	instanceTypeProvider instancetype.Provider
+}
+
+func NewSubnetEgressReconciler(kubeClient client.Client, azClient *instance.AZClient, instanceTypeProvider instancetype.Provider) *SubnetEgressReconciler {
+	return &SubnetEgressReconciler{
+		kubeClient:           kubeClient,
+		azClient:             azClient,
+		instanceTypeProvider: instanceTypeProvider,
+	}
+}
+
+func (r *SubnetEgressReconciler) Reconcile(ctx context.Context, nodeClass *v1beta1.AKSNodeClass) (reconcile.Result, error) {
+	ctx = log.IntoContext(ctx, log.FromContext(ctx).WithName(subnetEgressReconcilerName))
+
+	if !nodeClass.StatusConditions().IsTrue(v1beta1.ConditionTypeSubnetsReady) {
+		// subnets that aren't ready are already surfaced through the SubnetsReady condition
+		return reconcile.Result{}, nil
+	}
+	zones, err := r.launchZones(ctx, nodeClass)
+	if err != nil {
+		// surfaced through the condition rather than failing the reconcile of the other conditions of the AKSNodeClass
+		log.FromContext(ctx).Error(err, "resolving zones launched into")
+		nodeClass.StatusConditions().SetUnknownWithReason(v1beta1.ConditionTypeSubnetEgressUnavailable, SubnetEgressLaunchZonesUnknownReason,
+			fmt.Sprintf("Resolving the zones launched into, %s", err))
+		return reconcile.Result{RequeueAfter: time.Minute}, nil
+	}
+	reason, zonesWithoutEgress, err := r.zonesWithoutEgress(ctx, nodeClass, zones)
+	if err != nil {
+		// the check is advisory, so failing it, e.g. for lack of access to the NAT gateway, keeps the condition as is
+		log.FromContext(ctx).Error(err, "checking egress of subnet")
+		return reconcile.Result{RequeueAfter: 5 * time.Minute}, nil
+	}
+	if len(zonesWithoutEgress) == 0 {
+		if err := nodeClass.StatusConditions().Clear(v1beta1.ConditionTypeSubnetEgressUnavailable); err != nil {
+			return reconcile.Result{}, fmt.Errorf("clearing %s condition, %w", v1beta1.ConditionTypeSubnetEgressUnavailable, err)
+		}
+		return reconcile.Result{RequeueAfter: 5 * time.Minute}, nil
+	}
+
+	message := fmt.Sprintf("Zone(s) %s have no egress path through the subnet", utils.PrettySlice(zonesWithoutEgress, 5))
+	switch reason {
+	case SubnetEgressDefaultRouteDroppedReason:
+		message += fmt.Sprintf(", its route table drops the traffic of the default route %s", defaultRouteAddressPrefix)
+	case SubnetEgressNATGatewayZoneMismatchReason:
+		message += ", they aren't among the zones of its NAT gateway"
+	}
+	if nodeClass.StatusConditions().SetTrueWithReason(v1beta1.ConditionTypeSubnetEgressUnavailable, reason, message) {
+		log.FromContext(ctx).Info("subnet has no egress path for zones launched into", "zones", zonesWithoutEgress, "reason", reason)
+	}
+	return reconcile.Result{RequeueAfter: 5 * time.Minute}, nil
+}
+
+// launchZones returns the zones the NodePools referencing the AKSNodeClass can launch into: the zones of the available
+// offerings of the instance types compatible with their requirements
+func (r *SubnetEgressReconciler) launchZones(ctx context.Context, nodeClass *v1beta1.AKSNodeClass) (sets.Set[string], error) {
+	nodePoolList := &karpv1.NodePoolList{}
+	if err := r.kubeClient.List(ctx, nodePoolList); err != nil {
+		return nil, fmt.Errorf("listing nodepools, %w", err)
+	}
+	nodePools := lo.Filter(nodePoolList.Items, func(nodePool karpv1.NodePool, _ int) bool {
+		ref := nodePool.Spec.Template.Spec.NodeClassRef
+		return ref != nil && ref.Group == apis.Group && ref.Kind == "AKSNodeClass" && ref.Name == nodeClass.Name
+	})
+	zones := sets.New[string]()
+	if len(nodePools) == 0 {
+		return zones, nil
+	}
+
+	instanceTypes, err := r.instanceTypeProvider.List(ctx, nodeClass)
+	if err != nil {
+		return nil, fmt.Errorf("listing instance types, %w", err)
+	}
+	for _, nodePool := range nodePools {
+		requirements := scheduling.NewNodeSelectorRequirementsWithMinValues(nodePool.Spec.Template.Spec.Requirements...)
+		requirements.Add(scheduling.NewLabelRequirements(nodePool.Spec.Template.Labels).Values()...)
+		for _, instanceType := range instanceTypes {
+			if requirements.Compatible(instanceType.Requirements, v1beta1.AllowUndefinedWellKnownAndRestrictedLabels) != nil {
+				continue
+			}
+			for _, offering := range instanceType.Offerings.Available() {
+				if requirements.Compatible(offering.Requirements, v1beta1.AllowUndefinedWellKnownAndRestrictedLabels) != nil {
+					continue
+				}
+				// non-zonal offerings are launched without a zone
+				if zone := offering.Requirements.Get(corev1.LabelTopologyZone).Any(); zone != "" {
+					zones.Insert(zone)
+				}
+			}
+		}
+	}
+	return zones, nil
+}
+
+// zonesWithoutEgress returns the zones launched into that have no egress path through the subnet of the AKSNodeClass,
+// sorted, and why. Every zone lacks one when the route table of the subnet drops the traffic of the default route, and
+// the zones that aren't among those of a zonal NAT gateway of the subnet lack one.
+func (r *SubnetEgressReconciler) zonesWithoutEgress(ctx context.Context, nodeClass *v1beta1.AKSNodeClass, zones sets.Set[string]) (string, []string, error) {
+	if zones.Len() == 0 {
+		return "", nil, nil
+	}
+	subnetID := lo.Ternary(nodeClass.Spec.VNETSubnetID != nil, lo.FromPtr(nodeClass.Spec.VNETSubnetID), options.FromContext(ctx).SubnetID)
+	subnetComponents, err := utils.GetVnetSubnetIDComponents(subnetID)
+	if err != nil {
+		return "", nil, err
+	}
+	azClient, err := r.azClient.ForSubscription(subnetComponents.SubscriptionID)
+	if err != nil {
+		return "", nil, err
+	}
+	subnet, err := azClient.SubnetsClient().Get(ctx, subnetComponents.ResourceGroupName, subnetComponents.VNetName, subnetComponents.SubnetName, nil)
+	if err != nil {
+		return "", nil, fmt.Errorf("getting subnet %s, %w", subnetID, err)
+	}
+	if subnet.Properties == nil {
+		return "", nil, nil
+	}
+
+	if routeTableRef := subnet.Properties.RouteTable; routeTableRef != nil && routeTableRef.ID != nil {
+		routeTable, err := r.getRouteTable(ctx, lo.FromPtr(routeTableRef.ID))
+		if err != nil {
+			return "", nil, err
+		}
+		if defaultRouteDropped(routeTable) {
+			return SubnetEgressDefaultRouteDroppedReason, sets.List(zones), nil
+		}
+	}
+	if natGatewayRef := subnet.Properties.NatGateway; natGatewayRef != nil && natGatewayRef.ID != nil {
+		natGateway, err := r.getNatGateway(ctx, lo.FromPtr(natGatewayRef.ID))
+		if err != nil {
+			return "", nil, err
+		}
+		// a NAT gateway without zones isn't pinned to any
+		if len(natGateway.Zones) > 0 {
+			natGatewayZones := sets.New(lo.Map(natGateway.Zones, func(zone *string, _ int) string {
+				return utils.MakeZone(lo.FromPtr(natGateway.Location), lo.FromPtr(zone))
+			})...)
+			if missing := zones.Difference(natGatewayZones); missing.Len() > 0 {
+				return SubnetEgressNATGatewayZoneMismatchReason, sets.List(missing), nil
+			}
+		}
+	}
+	return "", nil, nil
+}
+
+func (r *SubnetEgressReconciler) getRouteTable(ctx context.Context, routeTableID string) (*armnetwork.RouteTable, error) {
+	id, err := arm.ParseResourceID(routeTableID)
+	if err != nil {
+		return nil, fmt.Errorf("parsing route table ID %s, %w", routeTableID, err)
+	}
+	azClient, err := r.azClient.ForSubscription(id.SubscriptionID)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := azClient.RouteTablesClient().Get(ctx, id.ResourceGroupName, id.Name, nil)
+	if err != nil {
+		return nil, fmt.Errorf("getting route table %s, %w", routeTableID, err)
+	}
+	return &resp.RouteTable, nil
+}
+
+func (r *SubnetEgressReconciler) getNatGateway(ctx context.Context, natGatewayID string) (*armnetwork.NatGateway, error) {
+	id, err := arm.ParseResourceID(natGatewayID)
+	if err != nil {
+		return nil, fmt.Errorf("parsing NAT gateway ID %s, %w", natGatewayID, err)
+	}
+	azClient, err := r.azClient.ForSubscription(id.SubscriptionID)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := azClient.NatGatewaysClient().Get(ctx, id.ResourceGroupName, id.Name, nil)
+	if err != nil {
+		return nil, fmt.Errorf("getting NAT gateway %s, %w", natGatewayID, err)
+	}
+	return &resp.NatGateway, nil
+}
+
+// defaultRouteDropped returns whether the route table routes the traffic of the default route to no next hop
+func defaultRouteDropped(routeTable *armnetwork.RouteTable) bool {
+	if routeTable.Properties == nil {
+		return false
+	}
+	return lo.ContainsBy(routeTable.Properties.Routes, func(route *armnetwork.Route) bool {
+		return route != nil && route.Properties != nil &&
+			lo.FromPtr(route.Properties.AddressPrefix) == defaultRouteAddressPrefix &&
+			lo.FromPtr(route.Properties.NextHopType) == armnetwork.RouteNextHopTypeNone
+	})
+}
@@ -0,0 +1,201 @@
+/*
+Portions Copyright (c) Microsoft Corporation.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package status_test
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/network/armnetwork"
+	"github.com/awslabs/operatorpkg/object"
+	"github.com/samber/lo"
+	corev1 "k8s.io/api/core/v1"
+	karpv1 "sigs.k8s.io/karpenter/pkg/apis/v1"
+	"sigs.k8s.io/karpenter/pkg/cloudprovider"
+	coretest "sigs.k8s.io/karpenter/pkg/test"
+
+	"github.com/Azure/karpenter-provider-azure/pkg/apis/v1beta1"
+	"github.com/Azure/karpenter-provider-azure/pkg/controllers/nodeclass/status"
+	"github.com/Azure/karpenter-provider-azure/pkg/fake"
+	"github.com/Azure/karpenter-provider-azure/pkg/providers/instancetype"
+	"github.com/Azure/karpenter-provider-azure/pkg/test"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	. "sigs.k8s.io/karpenter/pkg/test/expectations"
+)
+
+var _ = Describe("NodeClass SubnetEgress Status Controller", func() {
+	const (
+		natGatewayID = "/subscriptions/12345678-1234-1234-1234-123456789012/resourceGroups/test-resourceGroup/providers/Microsoft.Network/natGateways/nat-gateway"
+		routeTableID = "/subscriptions/12345678-1234-1234-1234-123456789012/resourceGroups/test-resourceGroup/providers/Microsoft.Network/routeTables/route-table"
+	)
+	var (
+		subnetEgressReconciler *status.SubnetEgressReconciler
+		nodePool               *karpv1.NodePool
+		subnetProperties       *armnetwork.SubnetPropertiesFormat
+	)
+
+	BeforeEach(func() {
+		subnetEgressReconciler = status.NewSubnetEgressReconciler(env.Client, azureEnv.AZClient, azureEnv.InstanceTypesProvider)
+		test.ApplyDefaultStatus(nodeClass, env, false)
+		nodePool = coretest.NodePool(karpv1.NodePool{
+			Spec: karpv1.NodePoolSpec{
+				Template: karpv1.NodeClaimTemplate{
+					Spec: karpv1.NodeClaimTemplateSpec{
+						NodeClassRef: &karpv1.NodeClassReference{
+							Group: object.GVK(nodeClass).Group,
+							Kind:  object.GVK(nodeClass).Kind,
+							Name:  nodeClass.Name,
+						},
+					},
+				},
+			},
+		})
+		subnetProperties = &armnetwork.SubnetPropertiesFormat{
+			AddressPrefix: lo.ToPtr("10.0.0.0/16"),
+			NatGateway:    &armnetwork.SubResource{ID: lo.ToPtr(natGatewayID)},
+		}
+		azureEnv.SubnetsAPI.GetFunc = func(_ context.Context, _ string, _ string, _ string, _ *armnetwork.SubnetsClientGetOptions) (armnetwork.SubnetsClientGetResponse, error) {
+			return armnetwork.SubnetsClientGetResponse{Subnet: armnetwork.Subnet{Properties: subnetProperties}}, nil
+		}
+		storeNatGateway("1", "2", "3")
+	})
+
+	It("should not set SubnetEgressUnavailable when the NAT gateway covers the zones launched into", func() {
+		ExpectApplied(ctx, env.Client, nodePool)
+
+		_, err := subnetEgressReconciler.Reconcile(ctx, nodeClass)
+		Expect(err).ToNot(HaveOccurred())
+
+		Expect(nodeClass.StatusConditions().Get(v1beta1.ConditionTypeSubnetEgressUnavailable)).To(BeNil())
+	})
+
+	It("should set SubnetEgressUnavailable for the zones the zonal NAT gateway doesn't cover", func() {
+		storeNatGateway("1")
+		ExpectApplied(ctx, env.Client, nodePool)
+
+		_, err := subnetEgressReconciler.Reconcile(ctx, nodeClass)
+		Expect(err).ToNot(HaveOccurred())
+
+		condition := nodeClass.StatusConditions().Get(v1beta1.ConditionTypeSubnetEgressUnavailable)
+		Expect(condition.IsTrue()).To(BeTrue())
+		Expect(condition.Reason).To(Equal(status.SubnetEgressNATGatewayZoneMismatchReason))
+		Expect(condition.Message).To(ContainSubstring(fake.Region + "-2"))
+		Expect(condition.Message).ToNot(ContainSubstring(fake.Region + "-1"))
+		// the condition is advisory, and doesn't affect readiness
+		Expect(nodeClass.StatusConditions().Root().IsTrue()).To(BeTrue())
+	})
+
+	It("should only consider the zones the NodePools launch into", func() {
+		storeNatGateway("1")
+		nodePool.Spec.Template.Spec.Requirements = []karpv1.NodeSelectorRequirementWithMinValues{{
+			NodeSelectorRequirement: corev1.NodeSelectorRequirement{
+				Key:      corev1.LabelTopologyZone,
+				Operator: corev1.NodeSelectorOpIn,
+				Values:   []string{fake.Region + "-1"},
+			},
+		}}
+		ExpectApplied(ctx, env.Client, nodePool)
+
+		_, err := subnetEgressReconciler.Reconcile(ctx, nodeClass)
+		Expect(err).ToNot(HaveOccurred())
+
+		Expect(nodeClass.StatusConditions().Get(v1beta1.ConditionTypeSubnetEgressUnavailable)).To(BeNil())
+	})
+
+	It("should set SubnetEgressUnavailable for all zones when the route table drops the default route", func() {
+		subnetProperties.RouteTable = &armnetwork.RouteTable{ID: lo.ToPtr(routeTableID)}
+		azureEnv.RouteTablesAPI.RouteTables.Store(fake.MakeRouteTableKey("test-resourceGroup", "route-table"), armnetwork.RouteTable{
+			ID: lo.ToPtr(routeTableID),
+			Properties: &armnetwork.RouteTablePropertiesFormat{
+				Routes: []*armnetwork.Route{{
+					Properties: &armnetwork.RoutePropertiesFormat{
+						AddressPrefix: lo.ToPtr("0.0.0.0/0"),
+						NextHopType:   lo.ToPtr(armnetwork.RouteNextHopTypeNone),
+					},
+				}},
+			},
+		})
+		ExpectApplied(ctx, env.Client, nodePool)
+
+		_, err := subnetEgressReconciler.Reconcile(ctx, nodeClass)
+		Expect(err).ToNot(HaveOccurred())
+
+		condition := nodeClass.StatusConditions().Get(v1beta1.ConditionTypeSubnetEgressUnavailable)
+		Expect(condition.IsTrue()).To(BeTrue())
+		Expect(condition.Reason).To(Equal(status.SubnetEgressDefaultRouteDroppedReason))
+		Expect(condition.Message).To(ContainSubstring(fake.Region + "-1"))
+	})
+
+	It("should clear SubnetEgressUnavailable once the NAT gateway covers the zones again", func() {
+		storeNatGateway("1")
+		ExpectApplied(ctx, env.Client, nodePool)
+		_, err := subnetEgressReconciler.Reconcile(ctx, nodeClass)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(nodeClass.StatusConditions().Get(v1beta1.ConditionTypeSubnetEgressUnavailable)).ToNot(BeNil())
+
+		storeNatGateway()
+		_, err = subnetEgressReconciler.Reconcile(ctx, nodeClass)
+		Expect(err).ToNot(HaveOccurred())
+
+		Expect(nodeClass.StatusConditions().Get(v1beta1.ConditionTypeSubnetEgressUnavailable)).To(BeNil())
+	})
+
+	It("should keep the condition as is when the NAT gateway can't be read", func() {
+		azureEnv.NatGatewaysAPI.Reset()
+		ExpectApplied(ctx, env.Client, nodePool)
+
+		result, err := subnetEgressReconciler.Reconcile(ctx, nodeClass)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(result.RequeueAfter).ToNot(BeZero())
+
+		Expect(nodeClass.StatusConditions().Get(v1beta1.ConditionTypeSubnetEgressUnavailable)).To(BeNil())
+	})
+
+	It("should set SubnetEgressUnavailable unknown rather than fail when the zones launched into can't be resolved", func() {
+		subnetEgressReconciler = status.NewSubnetEgressReconciler(env.Client, azureEnv.AZClient, failingInstanceTypeProvider{azureEnv.InstanceTypesProvider})
+		ExpectApplied(ctx, env.Client, nodePool)
+
+		result, err := subnetEgressReconciler.Reconcile(ctx, nodeClass)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(result.RequeueAfter).ToNot(BeZero())
+
+		condition := nodeClass.StatusConditions().Get(v1beta1.ConditionTypeSubnetEgressUnavailable)
+		Expect(condition.IsUnknown()).To(BeTrue())
+		Expect(condition.Reason).To(Equal(status.SubnetEgressLaunchZonesUnknownReason))
+		Expect(condition.Message).To(ContainSubstring("listing instance types"))
+		Expect(nodeClass.StatusConditions().Root().IsTrue()).To(BeTrue())
+	})
+})
+
+// failingInstanceTypeProvider fails to list the instance types
+type failingInstanceTypeProvider struct {
+	instancetype.Provider
+}
+
+func (failingInstanceTypeProvider) List(context.Context, *v1beta1.AKSNodeClass) ([]*cloudprovider.InstanceType, error) {
+	return nil, fmt.Errorf("failed to list instance types")
+}
+
+// storeNatGateway stores the NAT gateway of the subnet in the given zones, or without zones
+func storeNatGateway(zones ...string) {
+	azureEnv.NatGatewaysAPI.NatGateways.Store(fake.MakeNatGatewayKey("test-resourceGroup", "nat-gateway"), armnetwork.NatGateway{
+		Location: lo.ToPtr(fake.Region),
+		Zones:    lo.ToSlicePtr(zones),
+	})
+}
@@ -0,0 +1,101 @@
+/*
+Portions Copyright (c) Microsoft Corporation.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package status
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/arm"
+	"github.com/samber/lo"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	"github.com/Azure/karpenter-provider-azure/pkg/apis/v1beta1"
+	"github.com/Azure/karpenter-provider-azure/pkg/operator/options"
+	"github.com/Azure/karpenter-provider-azure/pkg/providers/instance"
+	"github.com/Azure/karpenter-provider-azure/pkg/utils"
+)
+
+const (
+	SubscriptionUnreadyReasonClientsFailed = "SubscriptionClientsFailed"
+
+	SubscriptionUnreadyReasonVNETSubnetMismatch = "VNETSubnetSubscriptionMismatch"
+
+	SubscriptionUnreadyReasonNodeIdentityInvalid = "NodeIdentityInvalid"
+)
+
+const subscriptionReconcilerName = "nodeclass.subscription"
+
+// SubscriptionReconciler validates that nodes of an AKSNodeClass with a subscriptionID can be created in that
+// subscription: its clients can be constructed, the VNET subnet is in it (a NIC must be in the subscription of its
+// VNET), and the node identities can be referenced from it.
+type SubscriptionReconciler struct {
+	azClient *instance.AZClient
+}
+
+func NewSubscriptionReconciler(azClient *instance.AZClient) *SubscriptionReconciler {
+	return &SubscriptionReconciler{
+		azClient: azClient,
+	}
+}
+
+func (r *SubscriptionReconciler) Reconcile(ctx context.Context, nodeClass *v1beta1.AKSNodeClass) (reconcile.Result, error) {
+	subscriptionID := lo.FromPtr(nodeClass.Spec.SubscriptionID)
+	if subscriptionID == "" {
+		nodeClass.StatusConditions().SetTrue(v1beta1.ConditionTypeSubscriptionReady)
+		return reconcile.Result{}, nil
+	}
+	logger := log.FromContext(ctx).WithName(subscriptionReconcilerName).WithValues("subscriptionID", subscriptionID)
+
+	if _, err := r.azClient.ForSubscription(subscriptionID); err != nil {
+		logger.Error(err, "failed to create clients for subscription")
+		nodeClass.StatusConditions().SetFalse(
+			v1beta1.ConditionTypeSubscriptionReady,
+			SubscriptionUnreadyReasonClientsFailed,
+			fmt.Sprintf("Failed to create clients for subscription %s: %s", subscriptionID, err),
+		)
+		return reconcile.Result{}, nil
+	}
+
+	subnetID := lo.Ternary(nodeClass.Spec.VNETSubnetID != nil, lo.FromPtr(nodeClass.Spec.VNETSubnetID), options.FromContext(ctx).SubnetID)
+	// an unparseable subnet ID is reported by the subnet reconciler
+	if subnetComponents, err := utils.GetVnetSubnetIDComponents(subnetID); err == nil && !strings.EqualFold(subnetComponents.SubscriptionID, subscriptionID) {
+		nodeClass.StatusConditions().SetFalse(
+			v1beta1.ConditionTypeSubscriptionReady,
+			SubscriptionUnreadyReasonVNETSubnetMismatch,
+			fmt.Sprintf("vnetSubnetID %s is not in subscription %s", subnetID, subscriptionID),
+		)
+		return reconcile.Result{}, nil
+	}
+
+	for _, nodeIdentity := range options.FromContext(ctx).NodeIdentities {
+		id, err := arm.ParseResourceID(nodeIdentity)
+		if err != nil || !strings.EqualFold(id.ResourceType.String(), "Microsoft.ManagedIdentity/userAssignedIdentities") {
+			nodeClass.StatusConditions().SetFalse(
+				v1beta1.ConditionTypeSubscriptionReady,
+				SubscriptionUnreadyReasonNodeIdentityInvalid,
+				fmt.Sprintf("node identity %s is not a user assigned identity resource ID, which is required to assign it in subscription %s", nodeIdentity, subscriptionID),
+			)
+			return reconcile.Result{}, nil
+		}
+	}
+
+	nodeClass.StatusConditions().SetTrue(v1beta1.ConditionTypeSubscriptionReady)
+	return reconcile.Result{}, nil
+}
@@ -0,0 +1,84 @@
+/*
+Portions Copyright (c) Microsoft Corporation.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package status_test
+
+import (
+	"github.com/Azure/karpenter-provider-azure/pkg/apis/v1beta1"
+	"github.com/Azure/karpenter-provider-azure/pkg/controllers/nodeclass/status"
+	"github.com/Azure/karpenter-provider-azure/pkg/operator/options"
+	"github.com/Azure/karpenter-provider-azure/pkg/test"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/samber/lo"
+)
+
+var _ = Describe("SubscriptionStatus", func() {
+	const (
+		spokeSubscriptionID = "87654321-4321-4321-4321-210987654321"
+		spokeSubnetID       = "/subscriptions/87654321-4321-4321-4321-210987654321/resourceGroups/spoke-resourceGroup/providers/Microsoft.Network/virtualNetworks/spoke-vnet/subnets/spoke-subnet"
+	)
+	var nodeClass *v1beta1.AKSNodeClass
+	var reconciler *status.SubscriptionReconciler
+
+	BeforeEach(func() {
+		reconciler = status.NewSubscriptionReconciler(azureEnv.AZClient)
+		nodeClass = test.AKSNodeClass()
+	})
+
+	It("should mark nodeclass as ready when no subscription is specified", func() {
+		_, err := reconciler.Reconcile(ctx, nodeClass)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(nodeClass.StatusConditions().Get(v1beta1.ConditionTypeSubscriptionReady).IsTrue()).To(BeTrue())
+	})
+	It("should mark nodeclass as ready when the subnet is in the subscription", func() {
+		nodeClass.Spec.SubscriptionID = lo.ToPtr(spokeSubscriptionID)
+		nodeClass.Spec.VNETSubnetID = lo.ToPtr(spokeSubnetID)
+
+		_, err := reconciler.Reconcile(ctx, nodeClass)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(nodeClass.StatusConditions().Get(v1beta1.ConditionTypeSubscriptionReady).IsTrue()).To(BeTrue())
+	})
+	It("should mark nodeclass as not ready when the subnet is not in the subscription", func() {
+		// the cluster subnet is in the cluster subscription
+		nodeClass.Spec.SubscriptionID = lo.ToPtr(spokeSubscriptionID)
+
+		_, err := reconciler.Reconcile(ctx, nodeClass)
+		Expect(err).ToNot(HaveOccurred())
+		cond := nodeClass.StatusConditions().Get(v1beta1.ConditionTypeSubscriptionReady)
+		Expect(cond.IsFalse()).To(BeTrue())
+		Expect(cond.Reason).To(Equal(status.SubscriptionUnreadyReasonVNETSubnetMismatch))
+	})
+	It("should mark nodeclass as not ready when a node identity is not a resource ID", func() {
+		ctx := options.ToContext(ctx, test.Options(test.OptionsFields{NodeIdentities: []string{"node-identity"}}))
+		nodeClass.Spec.SubscriptionID = lo.ToPtr(spokeSubscriptionID)
+		nodeClass.Spec.VNETSubnetID = lo.ToPtr(spokeSubnetID)
+
+		_, err := reconciler.Reconcile(ctx, nodeClass)
+		Expect(err).ToNot(HaveOccurred())
+		cond := nodeClass.StatusConditions().Get(v1beta1.ConditionTypeSubscriptionReady)
+		Expect(cond.IsFalse()).To(BeTrue())
+		Expect(cond.Reason).To(Equal(status.SubscriptionUnreadyReasonNodeIdentityInvalid))
+	})
+	It("should skip the cluster virtual network check for the subnet of another subscription", func() {
+		nodeClass.Spec.SubscriptionID = lo.ToPtr(spokeSubscriptionID)
+		nodeClass.Spec.VNETSubnetID = lo.ToPtr(spokeSubnetID)
+
+		_, err := status.NewSubnetReconciler(azureEnv.AZClient).Reconcile(ctx, nodeClass)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(nodeClass.StatusConditions().Get(v1beta1.ConditionTypeSubnetsReady).IsTrue()).To(BeTrue())
+	})
+})
@@ -19,7 +19,9 @@ package status_test
 import (
 	"context"
 	"testing"
+	"time"
 
+	clock "k8s.io/utils/clock/testing"
 	"sigs.k8s.io/karpenter/pkg/test/v1alpha1"
 
 	coreoptions "sigs.k8s.io/karpenter/pkg/operator/options"
@@ -45,6 +47,8 @@ var env *coretest.Environment
 var azureEnv *test.Environment
 var nodeClass *v1beta1.AKSNodeClass
 var controller *status.Controller
+var recorder *coretest.EventRecorder
+var fakeClock *clock.FakeClock
 
 var (
 	testK8sVersion string
@@ -62,8 +66,10 @@ var _ = BeforeSuite(func() {
 	ctx = coreoptions.ToContext(ctx, coretest.Options())
 	ctx = options.ToContext(ctx, test.Options())
 	azureEnv = test.NewEnvironment(ctx, env)
+	recorder = coretest.NewEventRecorder()
+	fakeClock = clock.NewFakeClock(time.Now())
 
-	controller = status.NewController(env.Client, azureEnv.KubernetesVersionProvider, azureEnv.ImageProvider, env.KubernetesInterface, azureEnv.SubnetsAPI)
+	controller = status.NewController(env.Client, azureEnv.KubernetesVersionProvider, azureEnv.ImageProvider, env.KubernetesInterface, azureEnv.AZClient, azureEnv.InstanceTypesProvider, recorder, fakeClock)
 })
 
 var _ = AfterSuite(func() {
@@ -74,6 +80,7 @@ var _ = BeforeEach(func() {
 	ctx = coreoptions.ToContext(ctx, coretest.Options())
 	nodeClass = test.AKSNodeClass()
 	azureEnv.Reset()
+	recorder.Reset()
 
 	testK8sVersion = lo.Must(semver.ParseTolerant(lo.Must(env.KubernetesInterface.Discovery().ServerVersion()).String())).String()
 	semverTestK8sVersion := lo.Must(semver.ParseTolerant(testK8sVersion))
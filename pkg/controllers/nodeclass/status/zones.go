@@ -0,0 +1,69 @@
+/*
+Portions Copyright (c) Microsoft Corporation.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package status
+
+import (
+	"context"
+	"fmt"
+
+	"k8s.io/apimachinery/pkg/util/sets"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+	"sigs.k8s.io/karpenter/pkg/events"
+
+	"github.com/Azure/karpenter-provider-azure/pkg/apis/v1beta1"
+	"github.com/Azure/karpenter-provider-azure/pkg/operator/options"
+	"github.com/Azure/karpenter-provider-azure/pkg/providers/instancetype"
+)
+
+const zonesReconcilerName = "nodeclass.zones"
+
+// ZonesReconciler records the zones of the region the instance types of an AKSNodeClass are offered in, and surfaces
+// the zones added to the region through an event. The SKUs are fetched again every zones update period, so new zones
+// are offered without a restart. Subnets are regional, so the subnet of the AKSNodeClass already spans them; the
+// SubnetEgressUnavailable condition surfaces them if a zonal NAT gateway of the subnet doesn't.
+type ZonesReconciler struct {
+	instanceTypeProvider instancetype.Provider
+	recorder             events.Recorder
+}
+
+func NewZonesReconciler(instanceTypeProvider instancetype.Provider, recorder events.Recorder) *ZonesReconciler {
+	return &ZonesReconciler{
+		instanceTypeProvider: instanceTypeProvider,
+		recorder:             recorder,
+	}
+}
+
+func (r *ZonesReconciler) Reconcile(ctx context.Context, nodeClass *v1beta1.AKSNodeClass) (reconcile.Result, error) {
+	ctx = log.IntoContext(ctx, log.FromContext(ctx).WithName(zonesReconcilerName))
+
+	zones, err := r.instanceTypeProvider.Zones(ctx, nodeClass)
+	if err != nil {
+		return reconcile.Result{}, fmt.Errorf("getting zones, %w", err)
+	}
+	// the zones recorded first aren't new, only the ones added to the region afterwards
+	if len(nodeClass.Status.Zones) > 0 {
+		if added := zones.Difference(sets.New(nodeClass.Status.Zones...)); added.Len() > 0 {
+			log.FromContext(ctx).Info("offering new zones", "zones", sets.List(added))
+			r.recorder.Publish(ZonesAddedEvent(nodeClass, sets.List(added)))
+		}
+	}
+	nodeClass.Status.Zones = sets.List(zones)
+
+	// requeued to pick up the zones discovered when the SKUs are fetched again
+	return reconcile.Result{RequeueAfter: options.FromContext(ctx).CacheConfig.ZonesUpdatePeriod}, nil
+}
@@ -0,0 +1,63 @@
+/*
+Portions Copyright (c) Microsoft Corporation.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package status_test
+
+import (
+	"github.com/Azure/karpenter-provider-azure/pkg/controllers/nodeclass/status"
+	"github.com/Azure/karpenter-provider-azure/pkg/fake"
+	"github.com/Azure/karpenter-provider-azure/pkg/test"
+	"github.com/Azure/karpenter-provider-azure/pkg/utils"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("NodeClass Zones Status Controller", func() {
+	var zonesReconciler *status.ZonesReconciler
+
+	BeforeEach(func() {
+		zonesReconciler = status.NewZonesReconciler(azureEnv.InstanceTypesProvider, recorder)
+		test.ApplyDefaultStatus(nodeClass, env, false)
+	})
+
+	It("should record the zones of the region without an event", func() {
+		_, err := zonesReconciler.Reconcile(ctx, nodeClass)
+		Expect(err).ToNot(HaveOccurred())
+
+		Expect(nodeClass.Status.Zones).To(ConsistOf(utils.MakeZone(fake.Region, "1"), utils.MakeZone(fake.Region, "2"), utils.MakeZone(fake.Region, "3")))
+		Expect(recorder.Calls("ZonesAdded")).To(BeZero())
+	})
+
+	It("should surface the zones added to the region", func() {
+		nodeClass.Status.Zones = []string{utils.MakeZone(fake.Region, "1"), utils.MakeZone(fake.Region, "2")}
+
+		_, err := zonesReconciler.Reconcile(ctx, nodeClass)
+		Expect(err).ToNot(HaveOccurred())
+
+		Expect(nodeClass.Status.Zones).To(ContainElement(utils.MakeZone(fake.Region, "3")))
+		Expect(recorder.Calls("ZonesAdded")).To(Equal(1))
+	})
+
+	It("should not surface zones again once recorded", func() {
+		_, err := zonesReconciler.Reconcile(ctx, nodeClass)
+		Expect(err).ToNot(HaveOccurred())
+		_, err = zonesReconciler.Reconcile(ctx, nodeClass)
+		Expect(err).ToNot(HaveOccurred())
+
+		Expect(recorder.Calls("ZonesAdded")).To(BeZero())
+	})
+})
@@ -19,12 +19,18 @@ package termination
 import (
 	"context"
 	"fmt"
+	"sort"
 	"time"
 
 	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/utils/clock"
+	"sigs.k8s.io/controller-runtime/pkg/log"
 	"sigs.k8s.io/karpenter/pkg/operator/injection"
 
+	"github.com/Azure/karpenter-provider-azure/pkg/apis"
 	"github.com/Azure/karpenter-provider-azure/pkg/apis/v1beta1"
+	"github.com/Azure/karpenter-provider-azure/pkg/metrics"
+	"github.com/Azure/karpenter-provider-azure/pkg/utils"
 	"github.com/samber/lo"
 	"k8s.io/apimachinery/pkg/api/equality"
 	"k8s.io/apimachinery/pkg/types"
@@ -44,15 +50,24 @@ import (
 	"sigs.k8s.io/karpenter/pkg/events"
 )
 
+// NodeClassForgetter drops what it keeps in memory about deleted AKSNodeClasses
+type NodeClassForgetter interface {
+	ForgetNodeClass(nodeClass *v1beta1.AKSNodeClass)
+}
+
 type Controller struct {
 	kubeClient client.Client
 	recorder   events.Recorder
+	clk        clock.Clock
+	forgetter  NodeClassForgetter
 }
 
-func NewController(kubeClient client.Client, recorder events.Recorder) *Controller {
+func NewController(kubeClient client.Client, recorder events.Recorder, clk clock.Clock, forgetter NodeClassForgetter) *Controller {
 	return &Controller{
 		kubeClient: kubeClient,
 		recorder:   recorder,
+		clk:        clk,
+		forgetter:  forgetter,
 	}
 }
 
@@ -75,11 +90,13 @@ func (c *Controller) finalize(ctx context.Context, nodeClass *v1beta1.AKSNodeCla
 		return reconcile.Result{}, fmt.Errorf("listing nodeclaims that are using nodeclass, %w", err)
 	}
 	if len(nodeClaimList.Items) > 0 {
-		c.recorder.Publish(WaitingOnNodeClaimTerminationEvent(nodeClass, lo.Map(nodeClaimList.Items, func(nc karpv1.NodeClaim, _ int) string { return nc.Name })))
-		return reconcile.Result{RequeueAfter: time.Minute * 10}, nil // periodically fire the event
+		return c.waitOnNodeClaims(ctx, nodeClass, nodeClaimList.Items)
 	}
 
 	// any other processing before removing NodeClass goes here
+	metrics.ImageFreezeActive.DeleteLabelValues(nodeClass.Name)
+	metrics.ImageUnsatisfiableNodeClasses.DeleteLabelValues(nodeClass.Name)
+	c.forgetter.ForgetNodeClass(nodeClass)
 
 	controllerutil.RemoveFinalizer(nodeClass, v1beta1.TerminationFinalizer)
 	if !equality.Semantic.DeepEqual(stored, nodeClass) {
@@ -97,6 +114,97 @@ func (c *Controller) finalize(ctx context.Context, nodeClass *v1beta1.AKSNodeCla
 	return reconcile.Result{}, nil
 }
 
+// waitOnNodeClaims surfaces that the AKSNodeClass waits on the termination of the NodeClaims referencing it, and the
+// NodePools they belong to, and disrupts them if it's annotated to be drained on delete
+func (c *Controller) waitOnNodeClaims(ctx context.Context, nodeClass *v1beta1.AKSNodeClass, nodeClaims []karpv1.NodeClaim) (reconcile.Result, error) {
+	nodePools, err := c.referencingNodePools(ctx, nodeClass, nodeClaims)
+	if err != nil {
+		return reconcile.Result{}, err
+	}
+	names := lo.Map(nodeClaims, func(nc karpv1.NodeClaim, _ int) string { return nc.Name })
+
+	stored := nodeClass.DeepCopy()
+	message := fmt.Sprintf("Waiting on the termination of %d NodeClaim(s)", len(nodeClaims))
+	if len(nodePools) > 0 {
+		message += fmt.Sprintf(" of NodePool(s) %s", utils.PrettySlice(nodePools, 5))
+	}
+	nodeClass.StatusConditions().SetTrueWithReason(v1beta1.ConditionTypeTerminating, "WaitingOnNodeClaimTermination", message)
+	if !equality.Semantic.DeepEqual(stored, nodeClass) {
+		if err := c.kubeClient.Status().Patch(ctx, nodeClass, client.MergeFromWithOptions(stored, client.MergeFromWithOptimisticLock{})); err != nil {
+			if errors.IsConflict(err) {
+				return reconcile.Result{Requeue: true}, nil
+			}
+			return reconcile.Result{}, client.IgnoreNotFound(fmt.Errorf("setting %s condition, %w", v1beta1.ConditionTypeTerminating, err))
+		}
+	}
+	c.recorder.Publish(WaitingOnNodeClaimTerminationEvent(nodeClass, names, nodePools))
+
+	if !nodeClass.IsDrainOnDelete() {
+		return reconcile.Result{RequeueAfter: time.Minute * 10}, nil // periodically fire the event
+	}
+	if err := c.disrupt(ctx, nodeClaims); err != nil {
+		return reconcile.Result{}, err
+	}
+	// the disruption budgets may allow more NodeClaims to be disrupted as time passes, not only as NodeClaims terminate
+	return reconcile.Result{RequeueAfter: time.Minute}, nil
+}
+
+// referencingNodePools returns the sorted names of the NodePools referencing the AKSNodeClass, or owning NodeClaims
+// referencing it
+func (c *Controller) referencingNodePools(ctx context.Context, nodeClass *v1beta1.AKSNodeClass, nodeClaims []karpv1.NodeClaim) ([]string, error) {
+	nodePoolList := &karpv1.NodePoolList{}
+	if err := c.kubeClient.List(ctx, nodePoolList); err != nil {
+		return nil, fmt.Errorf("listing nodepools, %w", err)
+	}
+	nodePools := lo.FilterMap(nodePoolList.Items, func(nodePool karpv1.NodePool, _ int) (string, bool) {
+		ref := nodePool.Spec.Template.Spec.NodeClassRef
+		return nodePool.Name, ref != nil && ref.Group == apis.Group && ref.Kind == "AKSNodeClass" && ref.Name == nodeClass.Name
+	})
+	for _, nodeClaim := range nodeClaims {
+		if nodePool, ok := nodeClaim.Labels[karpv1.NodePoolLabelKey]; ok {
+			nodePools = append(nodePools, nodePool)
+		}
+	}
+	nodePools = lo.Uniq(nodePools)
+	sort.Strings(nodePools)
+	return nodePools, nil
+}
+
+// disrupt deletes the NodeClaims referencing the deleted AKSNodeClass, as many per NodePool as its disruption budgets
+// allow for drift, computed over all its NodeClaims and counting those already deleting. Karpenter then taints and drains
+// their nodes before terminating them.
+// NodeClaims not owned by a NodePool, or whose NodePool doesn't exist anymore, are left alone: no budget applies to them.
+func (c *Controller) disrupt(ctx context.Context, nodeClaims []karpv1.NodeClaim) error {
+	byNodePool := lo.GroupBy(lo.Filter(nodeClaims, func(nc karpv1.NodeClaim, _ int) bool {
+		return nc.Labels[karpv1.NodePoolLabelKey] != ""
+	}), func(nc karpv1.NodeClaim) string { return nc.Labels[karpv1.NodePoolLabelKey] })
+	for name, group := range byNodePool {
+		nodePool := &karpv1.NodePool{}
+		if err := c.kubeClient.Get(ctx, types.NamespacedName{Name: name}, nodePool); err != nil {
+			if errors.IsNotFound(err) {
+				continue
+			}
+			return fmt.Errorf("getting nodepool, %w", err)
+		}
+		// the budgets apply to all the NodeClaims of the NodePool, not only to those referencing the AKSNodeClass
+		nodePoolNodeClaims := &karpv1.NodeClaimList{}
+		if err := c.kubeClient.List(ctx, nodePoolNodeClaims, client.MatchingLabels{karpv1.NodePoolLabelKey: name}); err != nil {
+			return fmt.Errorf("listing nodeclaims of nodepool, %w", err)
+		}
+		deleting := lo.CountBy(nodePoolNodeClaims.Items, func(nc karpv1.NodeClaim) bool { return !nc.DeletionTimestamp.IsZero() })
+		running := lo.Filter(group, func(nc karpv1.NodeClaim, _ int) bool { return nc.DeletionTimestamp.IsZero() })
+		allowed := nodePool.MustGetAllowedDisruptions(c.clk, len(nodePoolNodeClaims.Items), karpv1.DisruptionReasonDrifted) - deleting
+		sort.Slice(running, func(i, j int) bool { return running[i].Name < running[j].Name })
+		for i := range running[:lo.Clamp(allowed, 0, len(running))] {
+			if err := c.kubeClient.Delete(ctx, &running[i]); client.IgnoreNotFound(err) != nil {
+				return fmt.Errorf("deleting nodeclaim, %w", err)
+			}
+			log.FromContext(ctx).Info("disrupting nodeclaim of deleted nodeclass", "NodeClaim", running[i].Name, "NodePool", name)
+		}
+	}
+	return nil
+}
+
 func (c *Controller) Register(_ context.Context, m manager.Manager) error {
 	return controllerruntime.NewControllerManagedBy(m).
 		Named("nodeclass.termination").
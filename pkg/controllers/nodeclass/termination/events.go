@@ -27,12 +27,16 @@ import (
 	"github.com/Azure/karpenter-provider-azure/pkg/utils"
 )
 
-func WaitingOnNodeClaimTerminationEvent(nodeClass *v1beta1.AKSNodeClass, names []string) events.Event {
+func WaitingOnNodeClaimTerminationEvent(nodeClass *v1beta1.AKSNodeClass, names []string, nodePools []string) events.Event {
+	message := fmt.Sprintf("Waiting on NodeClaim termination for %s", utils.PrettySlice(names, 5))
+	if len(nodePools) > 0 {
+		message += fmt.Sprintf(", NodePool(s) %s still reference the AKSNodeClass", utils.PrettySlice(nodePools, 5))
+	}
 	return events.Event{
 		InvolvedObject: nodeClass,
 		Type:           corev1.EventTypeNormal,
 		Reason:         "WaitingOnNodeClaimTermination",
-		Message:        fmt.Sprintf("Waiting on NodeClaim termination for %s", utils.PrettySlice(names, 5)),
+		Message:        message,
 		DedupeValues:   []string{string(nodeClass.UID)},
 	}
 }
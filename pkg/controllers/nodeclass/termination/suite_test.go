@@ -18,6 +18,7 @@ package termination_test
 
 import (
 	"context"
+	"fmt"
 	"testing"
 	"time"
 
@@ -26,7 +27,10 @@ import (
 	//used for launch template tests until they are migrated
 
 	"github.com/awslabs/operatorpkg/object"
+	"github.com/samber/lo"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/client-go/tools/record"
+	clock "k8s.io/utils/clock/testing"
 	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
 	karpv1 "sigs.k8s.io/karpenter/pkg/apis/v1"
 	"sigs.k8s.io/karpenter/pkg/events"
@@ -36,6 +40,7 @@ import (
 	"github.com/Azure/karpenter-provider-azure/pkg/apis"
 	"github.com/Azure/karpenter-provider-azure/pkg/apis/v1beta1"
 	"github.com/Azure/karpenter-provider-azure/pkg/controllers/nodeclass/termination"
+	"github.com/Azure/karpenter-provider-azure/pkg/metrics"
 	"github.com/Azure/karpenter-provider-azure/pkg/operator/options"
 	"github.com/Azure/karpenter-provider-azure/pkg/test"
 
@@ -48,7 +53,18 @@ import (
 var ctx context.Context
 var env *coretest.Environment
 var azureEnv *test.Environment
+var fakeClock *clock.FakeClock
 var terminationController *termination.Controller
+var forgetter *fakeNodeClassForgetter
+
+// fakeNodeClassForgetter records the AKSNodeClasses it's told to forget
+type fakeNodeClassForgetter struct {
+	forgotten []string
+}
+
+func (f *fakeNodeClassForgetter) ForgetNodeClass(nodeClass *v1beta1.AKSNodeClass) {
+	f.forgotten = append(f.forgotten, nodeClass.Name)
+}
 
 func TestAPIs(t *testing.T) {
 	ctx = TestContextWithLogger(t)
@@ -62,7 +78,9 @@ var _ = BeforeSuite(func() {
 	ctx = options.ToContext(ctx, test.Options())
 	azureEnv = test.NewEnvironment(ctx, env)
 
-	terminationController = termination.NewController(env.Client, events.NewRecorder(&record.FakeRecorder{}))
+	fakeClock = clock.NewFakeClock(time.Now())
+	forgetter = &fakeNodeClassForgetter{}
+	terminationController = termination.NewController(env.Client, events.NewRecorder(&record.FakeRecorder{}), fakeClock, forgetter)
 })
 
 var _ = AfterSuite(func() {
@@ -72,6 +90,7 @@ var _ = AfterSuite(func() {
 var _ = BeforeEach(func() {
 	ctx = coreoptions.ToContext(ctx, coretest.Options())
 	azureEnv.Reset()
+	forgetter.forgotten = nil
 })
 
 var _ = AfterEach(func() {
@@ -121,4 +140,169 @@ var _ = Describe("NodeClass Termination", func() {
 		ExpectObjectReconciled(ctx, env.Client, terminationController, nodeClass)
 		ExpectNotFound(ctx, env.Client, nodeClass)
 	})
+	It("should delete the image series of the AKSNodeClass", func() {
+		controllerutil.AddFinalizer(nodeClass, v1beta1.TerminationFinalizer)
+		ExpectApplied(ctx, env.Client, nodeClass)
+		metrics.ImageFreezeActive.WithLabelValues(nodeClass.Name).Set(1)
+		metrics.ImageUnsatisfiableNodeClasses.WithLabelValues(nodeClass.Name).Set(1)
+
+		Expect(env.Client.Delete(ctx, nodeClass)).To(Succeed())
+		ExpectObjectReconciled(ctx, env.Client, terminationController, nodeClass)
+		ExpectNotFound(ctx, env.Client, nodeClass)
+
+		for _, name := range []string{"karpenter_image_freeze_active", "karpenter_image_unsatisfiable_nodeclasses"} {
+			metric, err := metrics.FindMetricWithLabelValues(name, map[string]string{metrics.NodeClassLabel: nodeClass.Name})
+			Expect(err).ToNot(HaveOccurred())
+			Expect(metric).To(BeNil(), fmt.Sprintf("expected no %s series", name))
+		}
+	})
+	It("should forget the AKSNodeClass once deleted", func() {
+		controllerutil.AddFinalizer(nodeClass, v1beta1.TerminationFinalizer)
+		ExpectApplied(ctx, env.Client, nodeClass)
+		ExpectObjectReconciled(ctx, env.Client, terminationController, nodeClass)
+		Expect(forgetter.forgotten).To(BeEmpty())
+
+		Expect(env.Client.Delete(ctx, nodeClass)).To(Succeed())
+		ExpectObjectReconciled(ctx, env.Client, terminationController, nodeClass)
+		ExpectNotFound(ctx, env.Client, nodeClass)
+		Expect(forgetter.forgotten).To(ConsistOf(nodeClass.Name))
+	})
+	It("should set the Terminating condition naming the NodePools of the NodeClaims", func() {
+		nodePool := coretest.NodePool(karpv1.NodePool{
+			Spec: karpv1.NodePoolSpec{Template: karpv1.NodeClaimTemplate{Spec: karpv1.NodeClaimTemplateSpec{
+				NodeClassRef: &karpv1.NodeClassReference{
+					Group: object.GVK(nodeClass).Group,
+					Kind:  object.GVK(nodeClass).Kind,
+					Name:  nodeClass.Name,
+				},
+			}}},
+		})
+		nodeClaim := coretest.NodeClaim(karpv1.NodeClaim{
+			ObjectMeta: metav1.ObjectMeta{Labels: map[string]string{karpv1.NodePoolLabelKey: nodePool.Name}},
+			Spec: karpv1.NodeClaimSpec{
+				NodeClassRef: &karpv1.NodeClassReference{
+					Group: object.GVK(nodeClass).Group,
+					Kind:  object.GVK(nodeClass).Kind,
+					Name:  nodeClass.Name,
+				},
+			},
+		})
+		controllerutil.AddFinalizer(nodeClass, v1beta1.TerminationFinalizer)
+		ExpectApplied(ctx, env.Client, nodePool, nodeClaim, nodeClass)
+
+		Expect(env.Client.Delete(ctx, nodeClass)).To(Succeed())
+		res := ExpectObjectReconciled(ctx, env.Client, terminationController, nodeClass)
+		Expect(res.RequeueAfter).To(Equal(time.Minute * 10))
+		nodeClass = ExpectExists(ctx, env.Client, nodeClass)
+		condition := nodeClass.StatusConditions().Get(v1beta1.ConditionTypeTerminating)
+		Expect(condition).ToNot(BeNil())
+		Expect(condition.IsTrue()).To(BeTrue())
+		Expect(condition.Message).To(ContainSubstring(nodePool.Name))
+		// the NodeClaim isn't disrupted without the drain-on-delete annotation
+		ExpectExists(ctx, env.Client, nodeClaim)
+
+		ExpectDeleted(ctx, env.Client, nodeClaim)
+		ExpectObjectReconciled(ctx, env.Client, terminationController, nodeClass)
+		ExpectNotFound(ctx, env.Client, nodeClass)
+	})
+	It("should disrupt the NodeClaims within the NodePool budget when annotated to drain on delete", func() {
+		nodePool := coretest.NodePool(karpv1.NodePool{
+			Spec: karpv1.NodePoolSpec{Disruption: karpv1.Disruption{Budgets: []karpv1.Budget{{Nodes: "2"}}}},
+		})
+		var nodeClaims []*karpv1.NodeClaim
+		for i := 0; i < 3; i++ {
+			nc := coretest.NodeClaim(karpv1.NodeClaim{
+				ObjectMeta: metav1.ObjectMeta{
+					Labels: map[string]string{karpv1.NodePoolLabelKey: nodePool.Name},
+					// keeps the NodeClaims around once deleted, as Karpenter's termination would while draining them
+					Finalizers: []string{karpv1.TerminationFinalizer},
+				},
+				Spec: karpv1.NodeClaimSpec{
+					NodeClassRef: &karpv1.NodeClassReference{
+						Group: object.GVK(nodeClass).Group,
+						Kind:  object.GVK(nodeClass).Kind,
+						Name:  nodeClass.Name,
+					},
+				},
+			})
+			ExpectApplied(ctx, env.Client, nc)
+			nodeClaims = append(nodeClaims, nc)
+		}
+		nodeClass.Annotations = map[string]string{v1beta1.AnnotationDrainOnDelete: "true"}
+		controllerutil.AddFinalizer(nodeClass, v1beta1.TerminationFinalizer)
+		ExpectApplied(ctx, env.Client, nodePool, nodeClass)
+
+		Expect(env.Client.Delete(ctx, nodeClass)).To(Succeed())
+		res := ExpectObjectReconciled(ctx, env.Client, terminationController, nodeClass)
+		Expect(res.RequeueAfter).To(Equal(time.Minute))
+		deleting := func() int {
+			return len(lo.Filter(nodeClaims, func(nc *karpv1.NodeClaim, _ int) bool {
+				return !ExpectExists(ctx, env.Client, nc).DeletionTimestamp.IsZero()
+			}))
+		}
+		Expect(deleting()).To(Equal(2))
+
+		// the NodeClaims being deleted count against the budget
+		ExpectObjectReconciled(ctx, env.Client, terminationController, nodeClass)
+		Expect(deleting()).To(Equal(2))
+
+		// once one terminates, the last one is disrupted
+		for _, nc := range nodeClaims {
+			if stored := ExpectExists(ctx, env.Client, nc); !stored.DeletionTimestamp.IsZero() {
+				ExpectFinalizersRemoved(ctx, env.Client, stored)
+				ExpectNotFound(ctx, env.Client, stored)
+				nodeClaims = lo.Without(nodeClaims, nc)
+				break
+			}
+		}
+		ExpectObjectReconciled(ctx, env.Client, terminationController, nodeClass)
+		Expect(deleting()).To(Equal(2))
+
+		for _, nc := range nodeClaims {
+			ExpectFinalizersRemoved(ctx, env.Client, nc)
+		}
+		ExpectObjectReconciled(ctx, env.Client, terminationController, nodeClass)
+		ExpectNotFound(ctx, env.Client, nodeClass)
+	})
+	It("should compute the NodePool budget over all the NodeClaims of the NodePool", func() {
+		nodePool := coretest.NodePool(karpv1.NodePool{
+			Spec: karpv1.NodePoolSpec{Disruption: karpv1.Disruption{Budgets: []karpv1.Budget{{Nodes: "50%"}}}},
+		})
+		var nodeClaims []*karpv1.NodeClaim
+		for i := 0; i < 4; i++ {
+			nc := coretest.NodeClaim(karpv1.NodeClaim{
+				ObjectMeta: metav1.ObjectMeta{
+					Labels:     map[string]string{karpv1.NodePoolLabelKey: nodePool.Name},
+					Finalizers: []string{karpv1.TerminationFinalizer},
+				},
+				Spec: karpv1.NodeClaimSpec{
+					NodeClassRef: &karpv1.NodeClassReference{
+						Group: object.GVK(nodeClass).Group,
+						Kind:  object.GVK(nodeClass).Kind,
+						// half of the NodeClaims of the NodePool reference another AKSNodeClass
+						Name: lo.Ternary(i%2 == 0, nodeClass.Name, "other-nodeclass"),
+					},
+				},
+			})
+			ExpectApplied(ctx, env.Client, nc)
+			nodeClaims = append(nodeClaims, nc)
+		}
+		nodeClass.Annotations = map[string]string{v1beta1.AnnotationDrainOnDelete: "true"}
+		controllerutil.AddFinalizer(nodeClass, v1beta1.TerminationFinalizer)
+		ExpectApplied(ctx, env.Client, nodePool, nodeClass)
+
+		Expect(env.Client.Delete(ctx, nodeClass)).To(Succeed())
+		ExpectObjectReconciled(ctx, env.Client, terminationController, nodeClass)
+
+		// 50% of the 4 NodeClaims of the NodePool, rather than of the 2 referencing the AKSNodeClass
+		for i, nc := range nodeClaims {
+			Expect(ExpectExists(ctx, env.Client, nc).DeletionTimestamp.IsZero()).To(Equal(i%2 != 0))
+		}
+
+		for _, nc := range nodeClaims {
+			ExpectFinalizersRemoved(ctx, env.Client, nc)
+		}
+		ExpectObjectReconciled(ctx, env.Client, terminationController, nodeClass)
+		ExpectNotFound(ctx, env.Client, nodeClass)
+	})
 })
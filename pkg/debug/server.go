@@ -0,0 +1,282 @@
+/*
+Portions Copyright (c) Microsoft Corporation.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package debug serves read-only JSON dumps of the provider caches, for troubleshooting provisioning decisions. The
+// endpoints only listen on localhost and are disabled unless the debug-server-port option is set.
+package debug
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/patrickmn/go-cache"
+	"github.com/samber/lo"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	karpv1 "sigs.k8s.io/karpenter/pkg/apis/v1"
+	corecloudprovider "sigs.k8s.io/karpenter/pkg/cloudprovider"
+	"sigs.k8s.io/karpenter/pkg/scheduling"
+
+	"github.com/Azure/karpenter-provider-azure/pkg/apis/v1beta1"
+	azurecache "github.com/Azure/karpenter-provider-azure/pkg/cache"
+	"github.com/Azure/karpenter-provider-azure/pkg/providers/imagefamily"
+	"github.com/Azure/karpenter-provider-azure/pkg/providers/instancetype"
+	"github.com/Azure/karpenter-provider-azure/pkg/providers/pricing"
+	"github.com/Azure/karpenter-provider-azure/pkg/utils/redact"
+)
+
+const (
+	readHeaderTimeout = 10 * time.Second
+	shutdownTimeout   = 5 * time.Second
+)
+
+type Server struct {
+	port                 int
+	kubeClient           client.Client
+	cloudProvider        corecloudprovider.CloudProvider
+	instanceTypeProvider instancetype.Provider
+	nodeImagesCache      *cache.Cache
+	unavailableOfferings *azurecache.UnavailableOfferings
+	pricingProvider      *pricing.Provider
+}
+
+func NewServer(
+	port int,
+	kubeClient client.Client,
+	cloudProvider corecloudprovider.CloudProvider,
+	instanceTypeProvider instancetype.Provider,
+	nodeImagesCache *cache.Cache,
+	unavailableOfferings *azurecache.UnavailableOfferings,
+	pricingProvider *pricing.Provider,
+) *Server {
+	return &Server{
+		port:                 port,
+		kubeClient:           kubeClient,
+		cloudProvider:        cloudProvider,
+		instanceTypeProvider: instanceTypeProvider,
+		nodeImagesCache:      nodeImagesCache,
+		unavailableOfferings: unavailableOfferings,
+		pricingProvider:      pricingProvider,
+	}
+}
+
+// Handler returns the debug endpoints
+func (s *Server) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /debug/images", s.images)
+	mux.HandleFunc("GET /debug/unavailableofferings", s.unavailableOfferingsList)
+	mux.HandleFunc("GET /debug/instancetypes", s.instanceTypes)
+	mux.HandleFunc("GET /debug/offerings", s.offerings)
+	mux.HandleFunc("GET /debug/pricing", s.pricing)
+	return mux
+}
+
+// Start serves the debug endpoints on localhost until the context is done
+func (s *Server) Start(ctx context.Context) error {
+	server := &http.Server{
+		Addr:              net.JoinHostPort("127.0.0.1", strconv.Itoa(s.port)),
+		Handler:           s.Handler(),
+		ReadHeaderTimeout: readHeaderTimeout,
+		// handlers get the operator context, for its options
+		BaseContext: func(net.Listener) context.Context { return ctx },
+	}
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+		defer cancel()
+		if err := server.Shutdown(shutdownCtx); err != nil {
+			log.FromContext(ctx).Error(err, "failed shutting down the debug server")
+		}
+	}()
+	log.FromContext(ctx).Info("starting debug server", "address", server.Addr)
+	if err := server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		return fmt.Errorf("serving debug endpoints, %w", err)
+	}
+	return nil
+}
+
+// NeedLeaderElection is false so that the caches of standby replicas can be inspected too
+func (s *Server) NeedLeaderElection() bool {
+	return false
+}
+
+type nodeImage struct {
+	ID           string `json:"id"`
+	Channel      string `json:"channel,omitempty"`
+	Requirements string `json:"requirements"`
+}
+
+type nodeImages struct {
+	Key        string      `json:"key"`
+	Images     []nodeImage `json:"images"`
+	Expiration time.Time   `json:"expiration"`
+}
+
+func (s *Server) images(w http.ResponseWriter, _ *http.Request) {
+	entries := []nodeImages{}
+	for key, item := range s.nodeImagesCache.Items() {
+		images, ok := item.Object.([]imagefamily.NodeImage)
+		if !ok {
+			continue
+		}
+		entries = append(entries, nodeImages{
+			Key: key,
+			Images: lo.Map(images, func(image imagefamily.NodeImage, _ int) nodeImage {
+				return nodeImage{ID: image.ID, Channel: string(image.Channel), Requirements: image.Requirements.String()}
+			}),
+			Expiration: time.Unix(0, item.Expiration),
+		})
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Key < entries[j].Key })
+	writeJSON(w, http.StatusOK, entries)
+}
+
+func (s *Server) unavailableOfferingsList(w http.ResponseWriter, _ *http.Request) {
+	writeJSON(w, http.StatusOK, s.unavailableOfferings.List())
+}
+
+type offering struct {
+	Zone         string  `json:"zone"`
+	CapacityType string  `json:"capacityType"`
+	Price        float64 `json:"price"`
+	Available    bool    `json:"available"`
+}
+
+type instanceType struct {
+	Name      string     `json:"name"`
+	Offerings []offering `json:"offerings"`
+}
+
+// instanceTypes returns the instance types compatible with the requirements of the nodepool, with their offerings,
+// which is the snapshot of SKUs the nodepool launches from
+func (s *Server) instanceTypes(w http.ResponseWriter, r *http.Request) {
+	nodePool, ok := s.nodePool(w, r)
+	if !ok {
+		return
+	}
+	instanceTypes, err := s.cloudProvider.GetInstanceTypes(r.Context(), nodePool)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, fmt.Errorf("getting instance types, %w", err))
+		return
+	}
+	requirements := scheduling.NewNodeSelectorRequirementsWithMinValues(nodePool.Spec.Template.Spec.Requirements...)
+	snapshot := []instanceType{}
+	for _, it := range instanceTypes {
+		if it.Requirements.Compatible(requirements, scheduling.AllowUndefinedWellKnownLabels) != nil {
+			continue
+		}
+		snapshot = append(snapshot, instanceType{
+			Name: it.Name,
+			Offerings: lo.Map(it.Offerings.Compatible(requirements), func(o *corecloudprovider.Offering, _ int) offering {
+				return offering{Zone: o.Zone(), CapacityType: o.CapacityType(), Price: o.Price, Available: o.Available}
+			}),
+		})
+	}
+	sort.Slice(snapshot, func(i, j int) bool { return snapshot[i].Name < snapshot[j].Name })
+	writeJSON(w, http.StatusOK, snapshot)
+}
+
+// offerings returns the snapshot of the offerings of the nodepool, including the SKUs it can't launch and why, for
+// capacity planning
+func (s *Server) offerings(w http.ResponseWriter, r *http.Request) {
+	nodePool, ok := s.nodePool(w, r)
+	if !ok {
+		return
+	}
+	if nodePool.Spec.Template.Spec.NodeClassRef == nil {
+		writeError(w, http.StatusBadRequest, fmt.Errorf("nodepool %s has no nodeclass", nodePool.Name))
+		return
+	}
+	nodeClass := &v1beta1.AKSNodeClass{}
+	if !s.get(w, r, "nodeclass", nodePool.Spec.Template.Spec.NodeClassRef.Name, nodeClass) {
+		return
+	}
+	snapshot, err := s.instanceTypeProvider.Snapshot(r.Context(), nodePool, nodeClass)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, fmt.Errorf("getting offerings snapshot, %w", err))
+		return
+	}
+	writeJSON(w, http.StatusOK, snapshot)
+}
+
+// nodePool gets the nodepool of the nodepool query parameter, writing the error response if it can't
+func (s *Server) nodePool(w http.ResponseWriter, r *http.Request) (*karpv1.NodePool, bool) {
+	name := r.URL.Query().Get("nodepool")
+	if name == "" {
+		writeError(w, http.StatusBadRequest, fmt.Errorf("missing nodepool query parameter"))
+		return nil, false
+	}
+	nodePool := &karpv1.NodePool{}
+	return nodePool, s.get(w, r, "nodepool", name, nodePool)
+}
+
+// get gets the cluster-scoped object, writing the error response if it can't
+func (s *Server) get(w http.ResponseWriter, r *http.Request, kind, name string, obj client.Object) bool {
+	if err := s.kubeClient.Get(r.Context(), client.ObjectKey{Name: name}, obj); err != nil {
+		if apierrors.IsNotFound(err) {
+			writeError(w, http.StatusNotFound, err)
+			return false
+		}
+		writeError(w, http.StatusInternalServerError, fmt.Errorf("getting %s, %w", kind, err))
+		return false
+	}
+	return true
+}
+
+type pricingStaleness struct {
+	OnDemandLastUpdated  time.Time `json:"onDemandLastUpdated"`
+	SpotLastUpdated      time.Time `json:"spotLastUpdated"`
+	ZonalSpotLastUpdated time.Time `json:"zonalSpotLastUpdated"`
+	StaleOnDemandPrices  []string  `json:"staleOnDemandPrices"`
+	StaleSpotPrices      []string  `json:"staleSpotPrices"`
+	PricedInstanceTypes  int       `json:"pricedInstanceTypes"`
+}
+
+func (s *Server) pricing(w http.ResponseWriter, _ *http.Request) {
+	staleOnDemand, staleSpot := s.pricingProvider.StaleInstanceTypes()
+	writeJSON(w, http.StatusOK, pricingStaleness{
+		OnDemandLastUpdated:  s.pricingProvider.OnDemandLastUpdated(),
+		SpotLastUpdated:      s.pricingProvider.SpotLastUpdated(),
+		ZonalSpotLastUpdated: s.pricingProvider.ZonalSpotLastUpdated(),
+		StaleOnDemandPrices:  staleOnDemand,
+		StaleSpotPrices:      staleSpot,
+		PricedInstanceTypes:  len(s.pricingProvider.InstanceTypes()),
+	})
+}
+
+// writeJSON writes the value as indented JSON, redacting any secret that made its way into the caches
+func writeJSON(w http.ResponseWriter, status int, value any) {
+	body, err := json.MarshalIndent(value, "", "  ")
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, fmt.Errorf("marshaling response, %w", err))
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_, _ = w.Write([]byte(redact.String(string(body))))
+}
+
+func writeError(w http.ResponseWriter, status int, err error) {
+	http.Error(w, redact.String(err.Error()), status)
+}
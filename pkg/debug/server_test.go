@@ -0,0 +1,263 @@
+/*
+Portions Copyright (c) Microsoft Corporation.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package debug_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/cloud"
+	"github.com/patrickmn/go-cache"
+	"github.com/samber/lo"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	fakeclient "sigs.k8s.io/controller-runtime/pkg/client/fake"
+	karpv1 "sigs.k8s.io/karpenter/pkg/apis/v1"
+	corecloudprovider "sigs.k8s.io/karpenter/pkg/cloudprovider"
+	corefake "sigs.k8s.io/karpenter/pkg/cloudprovider/fake"
+	"sigs.k8s.io/karpenter/pkg/scheduling"
+	coretest "sigs.k8s.io/karpenter/pkg/test"
+
+	"github.com/Azure/karpenter-provider-azure/pkg/apis/v1beta1"
+	"github.com/Azure/karpenter-provider-azure/pkg/auth"
+	azurecache "github.com/Azure/karpenter-provider-azure/pkg/cache"
+	"github.com/Azure/karpenter-provider-azure/pkg/debug"
+	"github.com/Azure/karpenter-provider-azure/pkg/fake"
+	"github.com/Azure/karpenter-provider-azure/pkg/operator/options"
+	"github.com/Azure/karpenter-provider-azure/pkg/providers/imagefamily"
+	"github.com/Azure/karpenter-provider-azure/pkg/providers/instance/offerings"
+	"github.com/Azure/karpenter-provider-azure/pkg/providers/instancetype"
+	"github.com/Azure/karpenter-provider-azure/pkg/providers/pricing"
+	"github.com/Azure/karpenter-provider-azure/pkg/test"
+)
+
+const bootstrapToken = "abcdef.0123456789abcdef"
+
+type testServer struct {
+	*debug.Server
+	ctx                  context.Context
+	nodeImagesCache      *cache.Cache
+	unavailableOfferings *azurecache.UnavailableOfferings
+}
+
+func newTestServer(t *testing.T, objects ...runtime.Object) *testServer {
+	t.Helper()
+	ctx := options.ToContext(context.Background(), test.Options())
+	// karpv1 registers the karpenter types with the client-go scheme
+	kubeClient := fakeclient.NewClientBuilder().WithScheme(clientgoscheme.Scheme).WithRuntimeObjects(objects...).Build()
+
+	cloudProvider := corefake.NewCloudProvider()
+	cloudProvider.InstanceTypes = []*corecloudprovider.InstanceType{
+		corefake.NewInstanceType(corefake.InstanceTypeOptions{Name: "Standard_D2s_v3"}),
+		corefake.NewInstanceType(corefake.InstanceTypeOptions{Name: "Standard_D4s_v3"}),
+	}
+	nodeImagesCache := cache.New(time.Hour, time.Hour)
+	unavailableOfferings := azurecache.NewUnavailableOfferings()
+	// a non-public cloud keeps the static prices, without updating them in the background
+	pricingProvider := pricing.NewProvider(&auth.Environment{Cloud: cloud.AzureGovernment}, &fake.PricingAPI{}, fake.Region, pricing.DefaultUpdatePeriod)
+	instanceTypeProvider := instancetype.NewDefaultProvider(fake.Region, cache.New(time.Hour, time.Hour), &fake.ResourceSKUsAPI{Location: fake.Region}, pricingProvider, unavailableOfferings, nil)
+	return &testServer{
+		Server:               debug.NewServer(0, kubeClient, cloudProvider, instanceTypeProvider, nodeImagesCache, unavailableOfferings, pricingProvider),
+		ctx:                  ctx,
+		nodeImagesCache:      nodeImagesCache,
+		unavailableOfferings: unavailableOfferings,
+	}
+}
+
+func (s *testServer) get(t *testing.T, path string) *httptest.ResponseRecorder {
+	t.Helper()
+	recorder := httptest.NewRecorder()
+	s.Handler().ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, path, nil).WithContext(s.ctx))
+	return recorder
+}
+
+func decode[T any](t *testing.T, recorder *httptest.ResponseRecorder) T {
+	t.Helper()
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("expected status %d, got %d: %s", http.StatusOK, recorder.Code, recorder.Body.String())
+	}
+	if contentType := recorder.Header().Get("Content-Type"); contentType != "application/json" {
+		t.Errorf("expected a JSON content type, got %q", contentType)
+	}
+	var value T
+	if err := json.Unmarshal(recorder.Body.Bytes(), &value); err != nil {
+		t.Fatalf("decoding %s: %s", recorder.Body.String(), err)
+	}
+	return value
+}
+
+func TestImages(t *testing.T) {
+	s := newTestServer(t)
+	s.nodeImagesCache.SetDefault("ubuntu2204-1.31.0-stable", []imagefamily.NodeImage{{
+		ID:           "/CommunityGalleries/AKSUbuntu-38d80f77-467a-481f-a8d4-09b6d4220bd2/images/2204gen2containerd/versions/202501.02.0",
+		Requirements: scheduling.NewRequirements(scheduling.NewRequirement(corev1.LabelArchStable, corev1.NodeSelectorOpIn, karpv1.ArchitectureAmd64)),
+	}})
+	// secrets that made their way into a cache are redacted
+	s.nodeImagesCache.SetDefault("custom-"+bootstrapToken, []imagefamily.NodeImage{})
+
+	recorder := s.get(t, "/debug/images")
+	if strings.Contains(recorder.Body.String(), bootstrapToken) {
+		t.Errorf("expected the bootstrap token to be redacted, got %s", recorder.Body.String())
+	}
+	entries := decode[[]struct {
+		Key    string `json:"key"`
+		Images []struct {
+			ID           string `json:"id"`
+			Requirements string `json:"requirements"`
+		} `json:"images"`
+		Expiration time.Time `json:"expiration"`
+	}](t, recorder)
+	if len(entries) != 2 || entries[1].Key != "ubuntu2204-1.31.0-stable" || len(entries[1].Images) != 1 {
+		t.Fatalf("expected the cached node images, got %+v", entries)
+	}
+	if !strings.HasSuffix(entries[1].Images[0].ID, "/versions/202501.02.0") || !strings.Contains(entries[1].Images[0].Requirements, karpv1.ArchitectureAmd64) {
+		t.Errorf("expected the node image with its requirements, got %+v", entries[1].Images[0])
+	}
+	if entries[1].Expiration.Before(time.Now()) {
+		t.Errorf("expected the entry to expire in the future, expires at %s", entries[1].Expiration)
+	}
+}
+
+func TestUnavailableOfferings(t *testing.T) {
+	s := newTestServer(t)
+	s.unavailableOfferings.MarkUnavailable(s.ctx, "test reason", "Standard_D2s_v3", "westus-1", karpv1.CapacityTypeSpot)
+
+	offerings := decode[[]azurecache.UnavailableOffering](t, s.get(t, "/debug/unavailableofferings"))
+	if len(offerings) != 1 || offerings[0].InstanceType != "Standard_D2s_v3" || offerings[0].Zone != "westus-1" || offerings[0].CapacityType != karpv1.CapacityTypeSpot {
+		t.Fatalf("expected the unavailable offering, got %+v", offerings)
+	}
+	if offerings[0].Expiration.Before(time.Now()) {
+		t.Errorf("expected the offering to expire in the future, expires at %s", offerings[0].Expiration)
+	}
+}
+
+func TestInstanceTypes(t *testing.T) {
+	nodePool := coretest.NodePool(karpv1.NodePool{Spec: karpv1.NodePoolSpec{Template: karpv1.NodeClaimTemplate{Spec: karpv1.NodeClaimTemplateSpec{
+		Requirements: []karpv1.NodeSelectorRequirementWithMinValues{
+			{NodeSelectorRequirement: corev1.NodeSelectorRequirement{Key: corev1.LabelInstanceTypeStable, Operator: corev1.NodeSelectorOpIn, Values: []string{"Standard_D4s_v3"}}},
+			{NodeSelectorRequirement: corev1.NodeSelectorRequirement{Key: karpv1.CapacityTypeLabelKey, Operator: corev1.NodeSelectorOpIn, Values: []string{karpv1.CapacityTypeOnDemand}}},
+		},
+	}}}})
+	s := newTestServer(t, nodePool)
+
+	if code := s.get(t, "/debug/instancetypes").Code; code != http.StatusBadRequest {
+		t.Errorf("expected status %d without a nodepool, got %d", http.StatusBadRequest, code)
+	}
+	if code := s.get(t, "/debug/instancetypes?nodepool=missing").Code; code != http.StatusNotFound {
+		t.Errorf("expected status %d for a missing nodepool, got %d", http.StatusNotFound, code)
+	}
+
+	instanceTypes := decode[[]struct {
+		Name      string `json:"name"`
+		Offerings []struct {
+			Zone         string `json:"zone"`
+			CapacityType string `json:"capacityType"`
+			Available    bool   `json:"available"`
+		} `json:"offerings"`
+	}](t, s.get(t, "/debug/instancetypes?nodepool="+nodePool.Name))
+	if len(instanceTypes) != 1 || instanceTypes[0].Name != "Standard_D4s_v3" {
+		t.Fatalf("expected only the instance types compatible with the nodepool, got %+v", instanceTypes)
+	}
+	if len(instanceTypes[0].Offerings) == 0 {
+		t.Fatalf("expected the offerings of the instance type")
+	}
+	for _, offering := range instanceTypes[0].Offerings {
+		if offering.CapacityType != karpv1.CapacityTypeOnDemand || offering.Zone == "" {
+			t.Errorf("expected only the on-demand offerings, got %+v", offering)
+		}
+	}
+}
+
+func TestOfferings(t *testing.T) {
+	// the API server defaults maxPods, instance types are computed from it
+	nodeClass := test.AKSNodeClass(v1beta1.AKSNodeClass{Spec: v1beta1.AKSNodeClassSpec{MaxPods: lo.ToPtr[int32](30)}})
+	nodePool := coretest.NodePool(karpv1.NodePool{Spec: karpv1.NodePoolSpec{Template: karpv1.NodeClaimTemplate{Spec: karpv1.NodeClaimTemplateSpec{
+		NodeClassRef: &karpv1.NodeClassReference{Group: "karpenter.azure.com", Kind: "AKSNodeClass", Name: nodeClass.Name},
+		Requirements: []karpv1.NodeSelectorRequirementWithMinValues{
+			{NodeSelectorRequirement: corev1.NodeSelectorRequirement{Key: corev1.LabelInstanceTypeStable, Operator: corev1.NodeSelectorOpIn, Values: []string{"Standard_D2s_v3", "Standard_D4s_v3"}}},
+			{NodeSelectorRequirement: corev1.NodeSelectorRequirement{Key: karpv1.CapacityTypeLabelKey, Operator: corev1.NodeSelectorOpIn, Values: []string{karpv1.CapacityTypeOnDemand}}},
+		},
+	}}}})
+	s := newTestServer(t, nodePool, nodeClass)
+	for _, zone := range []string{"1", "2", "3"} {
+		s.unavailableOfferings.MarkUnavailable(s.ctx, offerings.SubscriptionQuotaReachedReason, "Standard_D4s_v3", fake.Region+"-"+zone, karpv1.CapacityTypeOnDemand)
+	}
+
+	if code := s.get(t, "/debug/offerings?nodepool=missing").Code; code != http.StatusNotFound {
+		t.Errorf("expected status %d for a missing nodepool, got %d", http.StatusNotFound, code)
+	}
+
+	snapshot := decode[instancetype.OfferingsSnapshot](t, s.get(t, "/debug/offerings?nodepool="+nodePool.Name))
+	if snapshot.NodePool != nodePool.Name || snapshot.NodeClass != nodeClass.Name {
+		t.Errorf("expected the snapshot of the nodepool and its nodeclass, got %s and %s", snapshot.NodePool, snapshot.NodeClass)
+	}
+	if len(snapshot.InstanceTypes) != 1 || snapshot.InstanceTypes[0].Name != "Standard_D2s_v3" {
+		t.Fatalf("expected only the instance types with available offerings, got %+v", snapshot.InstanceTypes)
+	}
+	for _, offering := range snapshot.InstanceTypes[0].Offerings {
+		if offering.CapacityType != karpv1.CapacityTypeOnDemand || !offering.Available || offering.Price == 0 {
+			t.Errorf("expected only the available and priced on-demand offerings, got %+v", offering)
+		}
+	}
+	excluded := lo.SliceToMap(snapshot.Excluded, func(e instancetype.ExcludedInstanceType) (string, instancetype.ExclusionReason) {
+		return e.Name, e.Reason
+	})
+	for name, reason := range map[string]instancetype.ExclusionReason{
+		"Standard_D4s_v3":  instancetype.ExclusionReasonQuota,
+		"Standard_D64s_v3": instancetype.ExclusionReasonNodePoolRequirements,
+		// restricted by AKS
+		"Standard_A0": instancetype.ExclusionReasonDenied,
+		// confidential
+		"Standard_DC8s_v3": instancetype.ExclusionReasonCapabilityMismatch,
+	} {
+		if excluded[name] != reason {
+			t.Errorf("expected %s to be excluded for %s, got %q", name, reason, excluded[name])
+		}
+	}
+}
+
+func TestPricing(t *testing.T) {
+	s := newTestServer(t)
+
+	staleness := decode[struct {
+		OnDemandLastUpdated time.Time `json:"onDemandLastUpdated"`
+		StaleOnDemandPrices []string  `json:"staleOnDemandPrices"`
+		StaleSpotPrices     []string  `json:"staleSpotPrices"`
+		PricedInstanceTypes int       `json:"pricedInstanceTypes"`
+	}](t, s.get(t, "/debug/pricing"))
+	if staleness.PricedInstanceTypes == 0 || staleness.OnDemandLastUpdated.IsZero() {
+		t.Errorf("expected the static prices, got %+v", staleness)
+	}
+	if staleness.StaleOnDemandPrices == nil || len(staleness.StaleOnDemandPrices) != 0 || len(staleness.StaleSpotPrices) != 0 {
+		t.Errorf("expected no stale prices, got %+v", staleness)
+	}
+}
+
+func TestReadOnly(t *testing.T) {
+	s := newTestServer(t)
+	recorder := httptest.NewRecorder()
+	s.Handler().ServeHTTP(recorder, httptest.NewRequest(http.MethodDelete, "/debug/unavailableofferings", nil).WithContext(s.ctx))
+	if recorder.Code != http.StatusMethodNotAllowed {
+		t.Errorf("expected status %d, got %d", http.StatusMethodNotAllowed, recorder.Code)
+	}
+}
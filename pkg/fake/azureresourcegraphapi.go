@@ -19,6 +19,7 @@ package fake
 import (
 	"context"
 	"encoding/json"
+	"strings"
 
 	"github.com/samber/lo"
 
@@ -27,6 +28,7 @@ import (
 	"github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/resourcegraph/armresourcegraph"
 	"github.com/Azure/karpenter-provider-azure/pkg/providers/instance"
 	"github.com/Azure/karpenter-provider-azure/pkg/providers/launchtemplate"
+	"github.com/Azure/karpenter-provider-azure/pkg/providers/pricing"
 )
 
 type AzureResourceGraphResourcesInput struct {
@@ -39,31 +41,43 @@ type AzureResourceGraphBehavior struct {
 	VirtualMachinesAPI                  *VirtualMachinesAPI
 	NetworkInterfacesAPI                *NetworkInterfacesAPI
 	ResourceGroup                       string
+	ClusterName                         string
+	// ZonalSpotPrices are the spot prices returned by the zonal spot price queries, keyed by instance type and then
+	// by the zone number
+	ZonalSpotPrices AtomicPtr[map[string]map[string]float64]
 }
 
-// assert that the fake implements the interface
+// assert that the fake implements the interfaces
 var _ instance.AzureResourceGraphAPI = &AzureResourceGraphAPI{}
+var _ pricing.ResourceGraphAPI = &AzureResourceGraphAPI{}
 
 type AzureResourceGraphAPI struct {
-	vmListQuery  string
-	nicListQuery string
+	vmListQuery     string
+	nicListQuery    string
+	allVMListQuery  string
+	allNICListQuery string
 	AzureResourceGraphBehavior
 }
 
-func NewAzureResourceGraphAPI(resourceGroup string, virtualMachinesAPI *VirtualMachinesAPI, networkInterfacesAPI *NetworkInterfacesAPI) *AzureResourceGraphAPI {
+func NewAzureResourceGraphAPI(resourceGroup string, clusterName string, virtualMachinesAPI *VirtualMachinesAPI, networkInterfacesAPI *NetworkInterfacesAPI) *AzureResourceGraphAPI {
 	return &AzureResourceGraphAPI{
-		vmListQuery:  instance.GetVMListQueryBuilder(resourceGroup).String(),
-		nicListQuery: instance.GetNICListQueryBuilder(resourceGroup).String(),
+		vmListQuery:     instance.GetVMListQueryBuilder(resourceGroup, clusterName).String(),
+		nicListQuery:    instance.GetNICListQueryBuilder(resourceGroup, clusterName).String(),
+		allVMListQuery:  instance.GetAllVMListQueryBuilder(resourceGroup).String(),
+		allNICListQuery: instance.GetAllNICListQueryBuilder(resourceGroup).String(),
 		AzureResourceGraphBehavior: AzureResourceGraphBehavior{
 			VirtualMachinesAPI:   virtualMachinesAPI,
 			NetworkInterfacesAPI: networkInterfacesAPI,
 			ResourceGroup:        resourceGroup,
+			ClusterName:          clusterName,
 		},
 	}
 }
 
 // Reset must be called between tests otherwise tests will pollute each other.
-func (c *AzureResourceGraphAPI) Reset() {}
+func (c *AzureResourceGraphAPI) Reset() {
+	c.ZonalSpotPrices.Reset()
+}
 
 func (c *AzureResourceGraphAPI) Resources(_ context.Context, query armresourcegraph.QueryRequest, options *armresourcegraph.ClientResourcesOptions) (armresourcegraph.ClientResourcesResponse, error) {
 	input := &AzureResourceGraphResourcesInput{
@@ -82,19 +96,22 @@ func (c *AzureResourceGraphAPI) Resources(_ context.Context, query armresourcegr
 }
 
 func (c *AzureResourceGraphAPI) getResourceList(query string) []interface{} {
+	if strings.HasPrefix(query, pricing.SpotResourcesTable) {
+		return c.loadZonalSpotPrices()
+	}
 	switch query {
-	case c.vmListQuery:
+	case c.vmListQuery, c.allVMListQuery:
 		vmList := lo.Filter(c.loadVMObjects(), func(vm armcompute.VirtualMachine, _ int) bool {
-			return vm.Tags != nil && vm.Tags[launchtemplate.NodePoolTagKey] != nil
+			return c.matchesTags(vm.Tags, query == c.vmListQuery)
 		})
 		resourceList := lo.Map(vmList, func(vm armcompute.VirtualMachine, _ int) interface{} {
 			b, _ := json.Marshal(vm)
 			return convertBytesToInterface(b)
 		})
 		return resourceList
-	case c.nicListQuery:
+	case c.nicListQuery, c.allNICListQuery:
 		nicList := lo.Filter(c.loadNicObjects(), func(nic armnetwork.Interface, _ int) bool {
-			return nic.Tags != nil && nic.Tags[launchtemplate.NodePoolTagKey] != nil
+			return c.matchesTags(nic.Tags, query == c.nicListQuery)
 		})
 		resourceList := lo.Map(nicList, func(nic armnetwork.Interface, _ int) interface{} {
 			b, _ := json.Marshal(nic)
@@ -105,10 +122,35 @@ func (c *AzureResourceGraphAPI) getResourceList(query string) []interface{} {
 	return nil
 }
 
+// matchesTags returns whether the tags of a resource match the list queries: the nodepool tag, and the cluster tag of
+// the cluster, unless resources of any cluster are listed
+func (c *AzureResourceGraphAPI) matchesTags(tags map[string]*string, clusterOnly bool) bool {
+	if tags == nil || tags[launchtemplate.NodePoolTagKey] == nil {
+		return false
+	}
+	return !clusterOnly || lo.FromPtr(tags[launchtemplate.KarpenterManagedTagKey]) == c.ClusterName
+}
+
+// loadZonalSpotPrices returns the rows of the zonal spot price query
+func (c *AzureResourceGraphAPI) loadZonalSpotPrices() []interface{} {
+	if c.ZonalSpotPrices.IsNil() {
+		return nil
+	}
+	var rows []interface{}
+	for instanceType, prices := range *c.ZonalSpotPrices.Clone() {
+		for zone, price := range prices {
+			rows = append(rows, map[string]interface{}{"skuName": instanceType, "zone": zone, "priceUSD": price})
+		}
+	}
+	return rows
+}
+
 func (c *AzureResourceGraphAPI) loadVMObjects() (vmList []armcompute.VirtualMachine) {
 	c.VirtualMachinesAPI.Instances.Range(func(k, v any) bool {
 		vm, _ := c.VirtualMachinesAPI.Instances.Load(k)
-		vmList = append(vmList, vm.(armcompute.VirtualMachine))
+		if c.VirtualMachinesAPI.replicated(vm.(armcompute.VirtualMachine)) {
+			vmList = append(vmList, vm.(armcompute.VirtualMachine))
+		}
 		return true
 	})
 	return vmList
@@ -30,9 +30,10 @@ import (
 
 func TestAzureResourceGraphAPI_Resources_VM(t *testing.T) {
 	resourceGroup := "test_managed_cluster_rg"
+	clusterName := "test_managed_cluster"
 	subscriptionID := "test_sub"
 	virtualMachinesAPI := &VirtualMachinesAPI{}
-	azureResourceGraphAPI := NewAzureResourceGraphAPI(resourceGroup, virtualMachinesAPI, nil)
+	azureResourceGraphAPI := NewAzureResourceGraphAPI(resourceGroup, clusterName, virtualMachinesAPI, nil)
 	cases := []struct {
 		testName      string
 		vmNames       []string
@@ -42,9 +43,21 @@ func TestAzureResourceGraphAPI_Resources_VM(t *testing.T) {
 		{
 			testName:      "happy case",
 			vmNames:       []string{"A", "B", "C"},
-			tags:          map[string]*string{launchtemplate.NodePoolTagKey: lo.ToPtr("default")},
+			tags:          map[string]*string{launchtemplate.NodePoolTagKey: lo.ToPtr("default"), launchtemplate.KarpenterManagedTagKey: lo.ToPtr(clusterName)},
 			expectedError: "",
 		},
+		{
+			testName:      "no cluster tag",
+			vmNames:       []string{"A", "B", "C"},
+			tags:          map[string]*string{launchtemplate.NodePoolTagKey: lo.ToPtr("default")},
+			expectedError: "Unexpected nil resource data",
+		},
+		{
+			testName:      "another cluster",
+			vmNames:       []string{"A", "B", "C"},
+			tags:          map[string]*string{launchtemplate.NodePoolTagKey: lo.ToPtr("default"), launchtemplate.KarpenterManagedTagKey: lo.ToPtr("other_cluster")},
+			expectedError: "Unexpected nil resource data",
+		},
 		{
 			testName:      "no tags",
 			vmNames:       []string{"A", "B", "C"},
@@ -67,7 +80,7 @@ func TestAzureResourceGraphAPI_Resources_VM(t *testing.T) {
 					return
 				}
 			}
-			queryRequest := instance.NewQueryRequest(&subscriptionID, instance.GetVMListQueryBuilder(resourceGroup).String())
+			queryRequest := instance.NewQueryRequest(&subscriptionID, instance.GetVMListQueryBuilder(resourceGroup, clusterName).String())
 			data, err := instance.GetResourceData(context.Background(), azureResourceGraphAPI, *queryRequest)
 			if err != nil {
 				t.Errorf("Unexpected error %v", err)
@@ -0,0 +1,174 @@
+/*
+Portions Copyright (c) Microsoft Corporation.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package fake
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/compute/armcompute/v7"
+	"github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/network/armnetwork"
+	"github.com/samber/lo"
+
+	"github.com/Azure/karpenter-provider-azure/pkg/providers/instance"
+	"github.com/Azure/karpenter-provider-azure/pkg/providers/loadbalancer"
+)
+
+// Latencies of the fake cloud LROs, roughly what is observed in Azure
+const (
+	CloudVirtualMachineCreateLatency   = 30 * time.Second
+	CloudVirtualMachineDeleteLatency   = 20 * time.Second
+	CloudNetworkInterfaceCreateLatency = 2 * time.Second
+	CloudNetworkInterfaceDeleteLatency = 2 * time.Second
+)
+
+// CloudImageVersion is the community gallery image version the fake cloud serves for all images
+const CloudImageVersion = "202505.27.0"
+
+// Cloud is an in-memory Azure cloud assembled from the fake APIs, that the operator can run against (--cloud=fake).
+// Unlike the fake APIs on their own, it is coherent: VMs and NICs created through it are listed by Azure Resource Graph,
+// SKUs and pricing are those of the fake Region, and the node resource group contains the load balancer and NSG that
+// AKS creates.
+type Cloud struct {
+	ResourceGroup string
+
+	VirtualMachinesAPI          *VirtualMachinesAPI
+	AzureResourceGraphAPI       *AzureResourceGraphAPI
+	VirtualMachineExtensionsAPI *VirtualMachineExtensionsAPI
+	NetworkInterfacesAPI        *NetworkInterfacesAPI
+	DisksAPI                    *DisksAPI
+	SubnetsAPI                  *SubnetsAPI
+	NatGatewaysAPI              *NatGatewaysAPI
+	RouteTablesAPI              *RouteTablesAPI
+	PermissionsAPI              *PermissionsAPI
+	UserAssignedIdentitiesAPI   *UserAssignedIdentitiesAPI
+	LoadBalancersAPI            *LoadBalancersAPI
+	NetworkSecurityGroupAPI     *NetworkSecurityGroupAPI
+	CommunityImageVersionsAPI   *CommunityGalleryImageVersionsAPI
+	NodeImageVersionsAPI        *NodeImageVersionsAPI
+	NodeBootstrappingAPI        *NodeBootstrappingAPI
+	SKUsAPI                     *ResourceSKUsAPI
+	PricingAPI                  *PricingAPI
+	SubscriptionsAPI            *SubscriptionsAPI
+	SpotPlacementScoresAPI      *SpotPlacementScoresAPI
+}
+
+// NewCloud returns a fake cloud in Region, with the nodes of the given cluster in the given resource group.
+// LROs take CloudVirtualMachineCreateLatency etc. to complete; set the Latency of the behaviors to override.
+func NewCloud(resourceGroup string, clusterName string) (*Cloud, error) {
+	subscriptionsAPI, err := NewSubscriptionsAPI()
+	if err != nil {
+		return nil, fmt.Errorf("creating fake subscriptions API, %w", err)
+	}
+	virtualMachinesAPI := &VirtualMachinesAPI{}
+	virtualMachinesAPI.VirtualMachineCreateOrUpdateBehavior.Latency = CloudVirtualMachineCreateLatency
+	virtualMachinesAPI.VirtualMachineDeleteBehavior.Latency = CloudVirtualMachineDeleteLatency
+	networkInterfacesAPI := &NetworkInterfacesAPI{}
+	networkInterfacesAPI.NetworkInterfacesCreateOrUpdateBehavior.Latency = CloudNetworkInterfaceCreateLatency
+	networkInterfacesAPI.NetworkInterfacesDeleteBehavior.Latency = CloudNetworkInterfaceDeleteLatency
+
+	c := &Cloud{
+		ResourceGroup:               resourceGroup,
+		VirtualMachinesAPI:          virtualMachinesAPI,
+		AzureResourceGraphAPI:       NewAzureResourceGraphAPI(resourceGroup, clusterName, virtualMachinesAPI, networkInterfacesAPI),
+		VirtualMachineExtensionsAPI: &VirtualMachineExtensionsAPI{},
+		NetworkInterfacesAPI:        networkInterfacesAPI,
+		DisksAPI:                    &DisksAPI{},
+		SubnetsAPI:                  &SubnetsAPI{},
+		NatGatewaysAPI:              &NatGatewaysAPI{},
+		RouteTablesAPI:              &RouteTablesAPI{},
+		PermissionsAPI:              &PermissionsAPI{},
+		UserAssignedIdentitiesAPI:   &UserAssignedIdentitiesAPI{},
+		LoadBalancersAPI:            &LoadBalancersAPI{},
+		NetworkSecurityGroupAPI:     &NetworkSecurityGroupAPI{},
+		CommunityImageVersionsAPI:   &CommunityGalleryImageVersionsAPI{},
+		NodeImageVersionsAPI:        &NodeImageVersionsAPI{},
+		NodeBootstrappingAPI:        &NodeBootstrappingAPI{},
+		SKUsAPI:                     &ResourceSKUsAPI{Location: Region},
+		PricingAPI:                  &PricingAPI{},
+		SubscriptionsAPI:            subscriptionsAPI,
+		SpotPlacementScoresAPI:      &SpotPlacementScoresAPI{},
+	}
+	c.CommunityImageVersionsAPI.ImageVersions.Append(&armcompute.CommunityGalleryImageVersion{Name: lo.ToPtr(CloudImageVersion)})
+
+	lbID := MakeLoadBalancerID(resourceGroup, loadbalancer.SLBName)
+	c.LoadBalancersAPI.LoadBalancers.Store(lbID, armnetwork.LoadBalancer{
+		ID:   lo.ToPtr(lbID),
+		Name: lo.ToPtr(loadbalancer.SLBName),
+		Properties: &armnetwork.LoadBalancerPropertiesFormat{
+			BackendAddressPools: lo.Map([]string{loadbalancer.SLBInboundBackendPoolName, loadbalancer.SLBOutboundBackendPoolName}, func(name string, _ int) *armnetwork.BackendAddressPool {
+				return &armnetwork.BackendAddressPool{
+					ID:         lo.ToPtr(MakeBackendAddressPoolID(resourceGroup, loadbalancer.SLBName, name)),
+					Name:       lo.ToPtr(name),
+					Properties: &armnetwork.BackendAddressPoolPropertiesFormat{},
+				}
+			}),
+		},
+	})
+	nsgName := "aks-agentpool-00000000-nsg"
+	nsgID := MakeNetworkSecurityGroupID(resourceGroup, nsgName)
+	c.NetworkSecurityGroupAPI.NSGs.Store(nsgID, armnetwork.SecurityGroup{
+		ID:         lo.ToPtr(nsgID),
+		Name:       lo.ToPtr(nsgName),
+		Properties: &armnetwork.SecurityGroupPropertiesFormat{},
+	})
+	return c, nil
+}
+
+// AZClient returns an AZClient backed by the fake cloud
+func (c *Cloud) AZClient() *instance.AZClient {
+	return instance.NewAZClientFromAPI(
+		c.VirtualMachinesAPI,
+		c.AzureResourceGraphAPI,
+		c.VirtualMachineExtensionsAPI,
+		c.NetworkInterfacesAPI,
+		c.SubnetsAPI,
+		c.NatGatewaysAPI,
+		c.RouteTablesAPI,
+		c.LoadBalancersAPI,
+		c.NetworkSecurityGroupAPI,
+		c.CommunityImageVersionsAPI,
+		c.NodeImageVersionsAPI,
+		c.NodeBootstrappingAPI,
+		c.SKUsAPI,
+		c.SubscriptionsAPI,
+		c.PermissionsAPI,
+		c.UserAssignedIdentitiesAPI,
+		c.SpotPlacementScoresAPI,
+		c.DisksAPI,
+	)
+}
+
+// VirtualMachines returns the VMs currently in the fake cloud
+func (c *Cloud) VirtualMachines() []armcompute.VirtualMachine {
+	var vms []armcompute.VirtualMachine
+	c.VirtualMachinesAPI.Instances.Range(func(_, v any) bool {
+		vms = append(vms, v.(armcompute.VirtualMachine))
+		return true
+	})
+	return vms
+}
+
+// EvictVM simulates the eviction of a spot VM (with the Delete eviction policy): the VM disappears
+// from the cloud without Karpenter asking for it, while its NIC is left behind.
+func (c *Cloud) EvictVM(vmName string) error {
+	id := MkVMID(c.ResourceGroup, vmName)
+	if _, ok := c.VirtualMachinesAPI.Instances.LoadAndDelete(id); !ok {
+		return fmt.Errorf("virtual machine %s not found", vmName)
+	}
+	return nil
+}
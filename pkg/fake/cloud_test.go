@@ -0,0 +1,78 @@
+/*
+Portions Copyright (c) Microsoft Corporation.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package fake
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/compute/armcompute/v7"
+	"github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/resourcegraph/armresourcegraph"
+	"github.com/samber/lo"
+
+	"github.com/Azure/karpenter-provider-azure/pkg/providers/instance"
+	"github.com/Azure/karpenter-provider-azure/pkg/providers/launchtemplate"
+)
+
+func TestCloud(t *testing.T) {
+	ctx := context.Background()
+	cloud, err := NewCloud("MC_fake-cluster", "fake-cluster")
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	latency := 200 * time.Millisecond
+	cloud.VirtualMachinesAPI.VirtualMachineCreateOrUpdateBehavior.Latency = latency
+
+	// creates complete after the configured latency
+	start := time.Now()
+	_, err = instance.CreateVirtualMachine(ctx, cloud.VirtualMachinesAPI, cloud.ResourceGroup, "aks-default-abcde", armcompute.VirtualMachine{
+		Tags:  map[string]*string{launchtemplate.NodePoolTagKey: lo.ToPtr("default"), launchtemplate.KarpenterManagedTagKey: lo.ToPtr("fake-cluster")},
+		Zones: []*string{lo.ToPtr("1")},
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	if elapsed := time.Since(start); elapsed < latency {
+		t.Errorf("Expected create to take at least %s, took %s", latency, elapsed)
+	}
+
+	// lists reflect creates
+	listVMs := func() []any {
+		resp, err := cloud.AzureResourceGraphAPI.Resources(ctx, armresourcegraph.QueryRequest{
+			Query: lo.ToPtr(instance.GetVMListQueryBuilder(cloud.ResourceGroup, "fake-cluster").String()),
+		}, nil)
+		if err != nil {
+			t.Fatalf("Unexpected error %v", err)
+		}
+		return resp.Data.([]any)
+	}
+	if vms := listVMs(); len(vms) != 1 {
+		t.Errorf("Expected 1 VM to be listed, got %d", len(vms))
+	}
+
+	// evictions remove the VM from the cloud
+	if err := cloud.EvictVM("aks-default-abcde"); err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	if vms := listVMs(); len(vms) != 0 {
+		t.Errorf("Expected evicted VM not to be listed, got %d", len(vms))
+	}
+	if err := cloud.EvictVM("aks-default-abcde"); err == nil {
+		t.Errorf("Expected error evicting a VM that doesn't exist")
+	}
+}
@@ -18,16 +18,20 @@ package fake
 
 import (
 	"context"
+	"net/http"
 
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
 	"github.com/Azure/azure-sdk-for-go/sdk/azcore/runtime"
 	"github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/compute/armcompute/v7"
 
 	imagefamilytypes "github.com/Azure/karpenter-provider-azure/pkg/providers/imagefamily/types"
 )
 
-// TODO: no ability to simulate errors on the Pager.
 type CommunityGalleryImageVersionsAPI struct {
 	ImageVersions AtomicPtrSlice[armcompute.CommunityGalleryImageVersion]
+	// Error allows tests to simulate API errors.
+	// If Error is set to non-nil, the pages fail with it instead of returning the fake data
+	Error error
 }
 
 // assert that the fake implements the interface
@@ -40,6 +44,9 @@ func (c *CommunityGalleryImageVersionsAPI) NewListPager(_ string, _ string, _ st
 			return false
 		},
 		Fetcher: func(ctx context.Context, _ *armcompute.CommunityGalleryImageVersionsClientListResponse) (armcompute.CommunityGalleryImageVersionsClientListResponse, error) {
+			if c.Error != nil {
+				return armcompute.CommunityGalleryImageVersionsClientListResponse{}, c.Error
+			}
 			output := armcompute.CommunityGalleryImageVersionList{
 				Value: []*armcompute.CommunityGalleryImageVersion{},
 			}
@@ -52,9 +59,23 @@ func (c *CommunityGalleryImageVersionsAPI) NewListPager(_ string, _ string, _ st
 	return runtime.NewPager(pagingHandler)
 }
 
+// Get returns the image version of the given name, or a not found error if there's none
+func (c *CommunityGalleryImageVersionsAPI) Get(_ context.Context, _ string, _ string, _ string, galleryImageVersionName string, _ *armcompute.CommunityGalleryImageVersionsClientGetOptions) (armcompute.CommunityGalleryImageVersionsClientGetResponse, error) {
+	if c.Error != nil {
+		return armcompute.CommunityGalleryImageVersionsClientGetResponse{}, c.Error
+	}
+	for _, imageVersion := range c.ImageVersions.values {
+		if imageVersion.Name != nil && *imageVersion.Name == galleryImageVersionName {
+			return armcompute.CommunityGalleryImageVersionsClientGetResponse{CommunityGalleryImageVersion: *imageVersion}, nil
+		}
+	}
+	return armcompute.CommunityGalleryImageVersionsClientGetResponse{}, &azcore.ResponseError{StatusCode: http.StatusNotFound}
+}
+
 func (c *CommunityGalleryImageVersionsAPI) Reset() {
 	if c == nil {
 		return
 	}
 	c.ImageVersions.Reset()
+	c.Error = nil
 }
@@ -0,0 +1,72 @@
+/*
+Portions Copyright (c) Microsoft Corporation.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package fake
+
+import (
+	"context"
+	"net/http"
+	"sync"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/arm"
+	azfake "github.com/Azure/azure-sdk-for-go/sdk/azcore/fake"
+	"github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/compute/armcompute/v7"
+	computefake "github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/compute/armcompute/v7/fake"
+)
+
+// CustomGalleryAPI fakes the galleries of the custom images of AKSNodeClasses, serving the image definitions by their
+// name, whatever their gallery. Image definitions that aren't set are not found, and no image has versions.
+type CustomGalleryAPI struct {
+	mu               sync.Mutex
+	imageDefinitions map[string]armcompute.GalleryImage
+}
+
+// SetImageDefinition serves the image definition by its name
+func (api *CustomGalleryAPI) SetImageDefinition(imageDefinition armcompute.GalleryImage) {
+	api.mu.Lock()
+	defer api.mu.Unlock()
+	if api.imageDefinitions == nil {
+		api.imageDefinitions = map[string]armcompute.GalleryImage{}
+	}
+	api.imageDefinitions[*imageDefinition.Name] = imageDefinition
+}
+
+func (api *CustomGalleryAPI) Reset() {
+	api.mu.Lock()
+	defer api.mu.Unlock()
+	api.imageDefinitions = nil
+}
+
+// ClientFactory returns the clients of the custom image galleries of the subscription, served by the fake
+func (api *CustomGalleryAPI) ClientFactory(subscriptionID, _ string) (*armcompute.ClientFactory, error) {
+	transport := computefake.NewServerFactoryTransport(&computefake.ServerFactory{
+		GalleryImagesServer: computefake.GalleryImagesServer{
+			Get: func(_ context.Context, _, _, galleryImageName string, _ *armcompute.GalleryImagesClientGetOptions) (resp azfake.Responder[armcompute.GalleryImagesClientGetResponse], errResp azfake.ErrorResponder) {
+				api.mu.Lock()
+				defer api.mu.Unlock()
+				imageDefinition, ok := api.imageDefinitions[galleryImageName]
+				if !ok {
+					errResp.SetResponseError(http.StatusNotFound, "NotFound")
+					return
+				}
+				resp.SetResponse(http.StatusOK, armcompute.GalleryImagesClientGetResponse{GalleryImage: imageDefinition}, nil)
+				return
+			},
+		},
+	})
+	return armcompute.NewClientFactory(subscriptionID, &azfake.TokenCredential{}, &arm.ClientOptions{ClientOptions: azcore.ClientOptions{Transport: transport}})
+}
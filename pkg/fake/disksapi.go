@@ -0,0 +1,97 @@
+/*
+Portions Copyright (c) Microsoft Corporation.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package fake
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"net/http"
+	"sync"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/runtime"
+	"github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/compute/armcompute/v7"
+
+	"github.com/Azure/karpenter-provider-azure/pkg/providers/instance"
+)
+
+type DiskUpdateInput struct {
+	ResourceGroupName string
+	DiskName          string
+	Disk              armcompute.DiskUpdate
+	Options           *armcompute.DisksClientBeginUpdateOptions
+}
+
+type DisksBehavior struct {
+	DisksUpdateBehavior MockedLRO[DiskUpdateInput, armcompute.DisksClientUpdateResponse]
+	// Disks is keyed by the ID of the disk, see MakeDiskID
+	Disks sync.Map
+}
+
+// assert that the fake implements the interface
+var _ instance.DisksAPI = &DisksAPI{}
+
+type DisksAPI struct {
+	DisksBehavior
+}
+
+// Reset must be called between tests otherwise tests will pollute each other.
+func (c *DisksAPI) Reset() {
+	c.DisksUpdateBehavior.Reset()
+	c.Disks.Range(func(k, _ any) bool {
+		c.Disks.Delete(k)
+		return true
+	})
+}
+
+func (c *DisksAPI) Get(_ context.Context, resourceGroupName string, diskName string, _ *armcompute.DisksClientGetOptions) (armcompute.DisksClientGetResponse, error) {
+	disk, ok := c.Disks.Load(MakeDiskID(resourceGroupName, diskName))
+	if !ok {
+		return armcompute.DisksClientGetResponse{}, &azcore.ResponseError{StatusCode: http.StatusNotFound}
+	}
+	return armcompute.DisksClientGetResponse{Disk: disk.(armcompute.Disk)}, nil
+}
+
+func (c *DisksAPI) BeginUpdate(_ context.Context, resourceGroupName string, diskName string, disk armcompute.DiskUpdate, options *armcompute.DisksClientBeginUpdateOptions) (*runtime.Poller[armcompute.DisksClientUpdateResponse], error) {
+	input := &DiskUpdateInput{
+		ResourceGroupName: resourceGroupName,
+		DiskName:          diskName,
+		Disk:              disk,
+		Options:           options,
+	}
+	return c.DisksUpdateBehavior.Invoke(input, func(input *DiskUpdateInput) (*armcompute.DisksClientUpdateResponse, error) {
+		id := MakeDiskID(input.ResourceGroupName, input.DiskName)
+		stored, ok := c.Disks.Load(id)
+		if !ok {
+			return nil, &azcore.ResponseError{StatusCode: http.StatusNotFound}
+		}
+		disk := stored.(armcompute.Disk)
+		if input.Disk.Tags != nil {
+			// Tags are full-replace if they're specified
+			disk.Tags = maps.Clone(input.Disk.Tags)
+		}
+		c.Disks.Store(id, disk)
+		return &armcompute.DisksClientUpdateResponse{Disk: disk}, nil
+	})
+}
+
+func MakeDiskID(resourceGroupName, diskName string) string {
+	const subscriptionID = "subscriptionID" // not important for fake
+	const idFormat = "/subscriptions/%s/resourceGroups/%s/providers/Microsoft.Compute/disks/%s"
+	return fmt.Sprintf(idFormat, subscriptionID, resourceGroupName, diskName)
+}
@@ -0,0 +1,134 @@
+/*
+Portions Copyright (c) Microsoft Corporation.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package fake
+
+import (
+	"maps"
+	"math/rand/v2"
+	"sync"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
+)
+
+// LatencyDistribution returns the latency of a single call to a fake API
+type LatencyDistribution func() time.Duration
+
+// UniformLatency returns latencies uniformly distributed between minLatency and maxLatency.
+// The seed makes the sequence of latencies reproducible.
+func UniformLatency(seed uint64, minLatency, maxLatency time.Duration) LatencyDistribution {
+	sample := sampler(seed)
+	return func() time.Duration {
+		return minLatency + time.Duration(sample(func(r *rand.Rand) float64 { return r.Float64() })*float64(maxLatency-minLatency))
+	}
+}
+
+// NormalLatency returns normally distributed latencies, which is roughly how the latencies of ARM LROs are spread.
+// Negative samples are returned as zero. The seed makes the sequence of latencies reproducible.
+func NormalLatency(seed uint64, mean, stddev time.Duration) LatencyDistribution {
+	sample := sampler(seed)
+	return func() time.Duration {
+		return max(mean+time.Duration(sample(func(r *rand.Rand) float64 { return r.NormFloat64() })*float64(stddev)), 0)
+	}
+}
+
+// sampler returns a concurrency safe source of samples, seeded with the given seed
+func sampler(seed uint64) func(func(*rand.Rand) float64) float64 {
+	var mu sync.Mutex
+	r := rand.New(rand.NewPCG(seed, seed))
+	return func(sample func(*rand.Rand) float64) float64 {
+		mu.Lock()
+		defer mu.Unlock()
+		return sample(r)
+	}
+}
+
+// FailureRate is the fraction of calls, between 0 and 1, that fail with the given ARM error
+type FailureRate struct {
+	ErrorCode  string
+	StatusCode int
+	Rate       float64
+}
+
+// FailureInjector fails calls to a fake API at random, at the configured rates. The zero value injects no failures.
+type FailureInjector struct {
+	mu    sync.Mutex
+	rates []FailureRate
+	rand  *rand.Rand
+}
+
+// Set replaces the failure rates. The seed makes the sequence of injected failures reproducible.
+func (f *FailureInjector) Set(seed uint64, rates ...FailureRate) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.rates = rates
+	f.rand = rand.New(rand.NewPCG(seed, seed))
+}
+
+func (f *FailureInjector) Reset() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.rates = nil
+	f.rand = nil
+}
+
+// Get returns the error to fail the call with, or nil if the call should succeed
+func (f *FailureInjector) Get() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if len(f.rates) == 0 {
+		return nil
+	}
+	sample := f.rand.Float64()
+	for _, rate := range f.rates {
+		if sample < rate.Rate {
+			return &azcore.ResponseError{ErrorCode: rate.ErrorCode, StatusCode: rate.StatusCode}
+		}
+		sample -= rate.Rate
+	}
+	return nil
+}
+
+// Calls returns the number of calls made to each operation of the fake VM API
+func (c *VirtualMachinesAPI) Calls() map[string]int {
+	return map[string]int{
+		"VirtualMachines.BeginCreateOrUpdate": c.VirtualMachineCreateOrUpdateBehavior.Calls(),
+		"VirtualMachines.BeginUpdate":         c.VirtualMachineUpdateBehavior.Calls(),
+		"VirtualMachines.BeginDelete":         c.VirtualMachineDeleteBehavior.Calls(),
+		"VirtualMachines.Get":                 c.VirtualMachineGetBehavior.Calls(),
+	}
+}
+
+// Calls returns the number of calls made to each operation of the fake NIC API
+func (c *NetworkInterfacesAPI) Calls() map[string]int {
+	return map[string]int{
+		"NetworkInterfaces.BeginCreateOrUpdate": c.NetworkInterfacesCreateOrUpdateBehavior.Calls(),
+		"NetworkInterfaces.BeginDelete":         c.NetworkInterfacesDeleteBehavior.Calls(),
+		"NetworkInterfaces.UpdateTags":          c.NetworkInterfacesUpdateTagsBehavior.Calls(),
+	}
+}
+
+// Calls returns the number of calls made to each operation of the fake APIs that VMs are launched, listed and
+// garbage collected through
+func (c *Cloud) Calls() map[string]int {
+	calls := map[string]int{
+		"AzureResourceGraph.Resources": c.AzureResourceGraphAPI.AzureResourceGraphResourcesBehavior.Calls(),
+	}
+	maps.Copy(calls, c.VirtualMachinesAPI.Calls())
+	maps.Copy(calls, c.NetworkInterfacesAPI.Calls())
+	return calls
+}
@@ -0,0 +1,117 @@
+/*
+Portions Copyright (c) Microsoft Corporation.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package fake
+
+import (
+	"context"
+	"errors"
+	"maps"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
+	"github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/compute/armcompute/v7"
+	"github.com/samber/lo"
+
+	"github.com/Azure/karpenter-provider-azure/pkg/providers/instance"
+	"github.com/Azure/karpenter-provider-azure/pkg/providers/launchtemplate"
+)
+
+func TestFailureInjector(t *testing.T) {
+	var failures FailureInjector
+	if err := failures.Get(); err != nil {
+		t.Fatalf("Expected the zero value not to inject failures, got %v", err)
+	}
+
+	sample := func() map[string]int {
+		failures.Set(42,
+			FailureRate{ErrorCode: "AllocationFailed", StatusCode: http.StatusOK, Rate: 0.2},
+			FailureRate{ErrorCode: "TooManyRequests", StatusCode: http.StatusTooManyRequests, Rate: 0.1},
+		)
+		counts := map[string]int{}
+		for range 10000 {
+			var respErr *azcore.ResponseError
+			if err := failures.Get(); errors.As(err, &respErr) {
+				counts[respErr.ErrorCode]++
+			} else {
+				counts[""]++
+			}
+		}
+		return counts
+	}
+	counts := sample()
+	for errorCode, expected := range map[string]int{"AllocationFailed": 2000, "TooManyRequests": 1000, "": 7000} {
+		if counts[errorCode] < expected*9/10 || counts[errorCode] > expected*11/10 {
+			t.Errorf("Expected about %d calls with error %q, got %d", expected, errorCode, counts[errorCode])
+		}
+	}
+	if again := sample(); !maps.Equal(again, counts) {
+		t.Errorf("Expected the same seed to inject the same failures, got %v and %v", counts, again)
+	}
+
+	failures.Reset()
+	if err := failures.Get(); err != nil {
+		t.Errorf("Expected no failures after reset, got %v", err)
+	}
+}
+
+func TestLatencyDistributions(t *testing.T) {
+	uniform := UniformLatency(1, 100*time.Millisecond, 200*time.Millisecond)
+	normal := NormalLatency(1, 100*time.Millisecond, time.Second)
+	for range 1000 {
+		if latency := uniform(); latency < 100*time.Millisecond || latency > 200*time.Millisecond {
+			t.Fatalf("Expected uniform latencies between 100ms and 200ms, got %s", latency)
+		}
+		if latency := normal(); latency < 0 {
+			t.Fatalf("Expected non-negative latencies, got %s", latency)
+		}
+	}
+	if a, b := UniformLatency(7, 0, time.Second)(), UniformLatency(7, 0, time.Second)(); a != b {
+		t.Errorf("Expected the same seed to sample the same latencies, got %s and %s", a, b)
+	}
+}
+
+func TestCloudFailureInjectionAndCalls(t *testing.T) {
+	ctx := context.Background()
+	cloud, err := NewCloud("MC_fake-cluster", "fake-cluster")
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	cloud.VirtualMachinesAPI.VirtualMachineCreateOrUpdateBehavior.LatencyDistribution = UniformLatency(1, 10*time.Millisecond, 20*time.Millisecond)
+	cloud.VirtualMachinesAPI.VirtualMachineCreateOrUpdateBehavior.Failures.Set(1, FailureRate{ErrorCode: "AllocationFailed", StatusCode: http.StatusOK, Rate: 1})
+
+	start := time.Now()
+	_, err = instance.CreateVirtualMachine(ctx, cloud.VirtualMachinesAPI, cloud.ResourceGroup, "aks-default-abcde", armcompute.VirtualMachine{
+		Tags: map[string]*string{launchtemplate.NodePoolTagKey: lo.ToPtr("default"), launchtemplate.KarpenterManagedTagKey: lo.ToPtr("fake-cluster")},
+	})
+	var respErr *azcore.ResponseError
+	if !errors.As(err, &respErr) || respErr.ErrorCode != "AllocationFailed" {
+		t.Fatalf("Expected an injected AllocationFailed error, got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed < 10*time.Millisecond {
+		t.Errorf("Expected the injected failure to surface after the sampled latency, took %s", elapsed)
+	}
+	if vms := cloud.VirtualMachines(); len(vms) != 0 {
+		t.Errorf("Expected the failed VM not to be created, got %d VMs", len(vms))
+	}
+
+	calls := cloud.Calls()
+	if calls["VirtualMachines.BeginCreateOrUpdate"] != 1 || calls["NetworkInterfaces.BeginCreateOrUpdate"] != 0 {
+		t.Errorf("Expected a single VM create call, got %v", calls)
+	}
+}
@@ -0,0 +1,57 @@
+/*
+Portions Copyright (c) Microsoft Corporation.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package fake
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
+	"github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/network/armnetwork"
+
+	"github.com/Azure/karpenter-provider-azure/pkg/providers/instance"
+)
+
+type NatGatewaysAPI struct {
+	// NatGateways is keyed by the lowercase resource group and name of the NAT gateway, see MakeNatGatewayKey
+	NatGateways sync.Map
+}
+
+var _ instance.NatGatewaysAPI = &NatGatewaysAPI{}
+
+// Reset must be called between tests otherwise tests will pollute each other.
+func (api *NatGatewaysAPI) Reset() {
+	api.NatGateways.Range(func(k, _ any) bool {
+		api.NatGateways.Delete(k)
+		return true
+	})
+}
+
+func (api *NatGatewaysAPI) Get(_ context.Context, resourceGroupName string, natGatewayName string, _ *armnetwork.NatGatewaysClientGetOptions) (armnetwork.NatGatewaysClientGetResponse, error) {
+	natGateway, ok := api.NatGateways.Load(MakeNatGatewayKey(resourceGroupName, natGatewayName))
+	if !ok {
+		return armnetwork.NatGatewaysClientGetResponse{}, &azcore.ResponseError{StatusCode: http.StatusNotFound}
+	}
+	return armnetwork.NatGatewaysClientGetResponse{NatGateway: natGateway.(armnetwork.NatGateway)}, nil
+}
+
+func MakeNatGatewayKey(resourceGroupName, natGatewayName string) string {
+	return strings.ToLower(fmt.Sprintf("%s/%s", resourceGroupName, natGatewayName))
+}
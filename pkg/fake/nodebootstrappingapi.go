@@ -20,6 +20,7 @@ import (
 	"context"
 	"encoding/base64"
 	"fmt"
+	"time"
 
 	"github.com/Azure/karpenter-provider-azure/pkg/providers/imagefamily/types"
 	"github.com/Azure/karpenter-provider-azure/pkg/provisionclients/models"
@@ -29,6 +30,8 @@ import (
 // for testing purposes.
 type NodeBootstrappingAPI struct {
 	SimulateDown bool
+	// LatencyDistribution, when set, is sampled for how long each call takes to respond
+	LatencyDistribution LatencyDistribution
 }
 
 // Ensure NodeBootstrappingAPI implements the types.NodeBootstrappingAPI interface
@@ -36,6 +39,13 @@ var _ types.NodeBootstrappingAPI = &NodeBootstrappingAPI{}
 
 // Get implements the NodeBootstrappingAPI interface for testing
 func (n *NodeBootstrappingAPI) Get(ctx context.Context, params *models.ProvisionValues) (types.NodeBootstrapping, error) {
+	if n.LatencyDistribution != nil {
+		select {
+		case <-time.After(n.LatencyDistribution()):
+		case <-ctx.Done():
+			return types.NodeBootstrapping{}, ctx.Err()
+		}
+	}
 	if n.SimulateDown {
 		return types.NodeBootstrapping{}, fmt.Errorf("InternalServerError; NodeBootstrappingAPI is down")
 	}
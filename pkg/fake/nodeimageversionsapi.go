@@ -443,6 +443,6 @@ func (n *NodeImageVersionsAPI) List(_ context.Context, _, _ string) (types.NodeI
 	}
 
 	return types.NodeImageVersionsResponse{
-		Values: imagefamily.FilteredNodeImages(dataToUse),
+		Values: imagefamily.SupportedGalleryNodeImages(dataToUse),
 	}, nil
 }
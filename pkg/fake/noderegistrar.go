@@ -0,0 +1,126 @@
+/*
+Portions Copyright (c) Microsoft Corporation.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package fake
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/compute/armcompute/v7"
+	"github.com/samber/lo"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	karpv1 "sigs.k8s.io/karpenter/pkg/apis/v1"
+
+	"github.com/Azure/karpenter-provider-azure/pkg/utils"
+)
+
+const (
+	// KwokNodeAnnotationKey marks nodes to be managed by kwok (https://kwok.sigs.k8s.io), which
+	// keeps their status and leases up to date in place of a kubelet
+	KwokNodeAnnotationKey   = "kwok.x-k8s.io/node"
+	KwokNodeAnnotationValue = "fake"
+
+	// NodeRegistrationDelay approximates how long a VM takes to boot and register its kubelet
+	NodeRegistrationDelay = 30 * time.Second
+	nodeRegistrarInterval = 5 * time.Second
+)
+
+// NodeRegistrar stands in for the kubelets of the VMs of a fake Cloud: once a VM has been up for RegistrationDelay,
+// it registers the Node for the NodeClaim launched on it, so that provisioning completes end to end.
+// The Nodes are annotated to be managed by kwok, which must be installed for them to remain Ready.
+type NodeRegistrar struct {
+	kubeClient        client.Client
+	cloud             *Cloud
+	RegistrationDelay time.Duration
+}
+
+func NewNodeRegistrar(kubeClient client.Client, cloud *Cloud) *NodeRegistrar {
+	return &NodeRegistrar{
+		kubeClient:        kubeClient,
+		cloud:             cloud,
+		RegistrationDelay: NodeRegistrationDelay,
+	}
+}
+
+// Start implements manager.Runnable
+func (r *NodeRegistrar) Start(ctx context.Context) error {
+	wait.UntilWithContext(ctx, func(ctx context.Context) {
+		if err := r.Reconcile(ctx); err != nil {
+			log.FromContext(ctx).Error(err, "registering fake nodes")
+		}
+	}, nodeRegistrarInterval)
+	return nil
+}
+
+// Reconcile registers a Node for each launched NodeClaim whose VM has been up for RegistrationDelay
+func (r *NodeRegistrar) Reconcile(ctx context.Context) error {
+	nodeClaims := &karpv1.NodeClaimList{}
+	if err := r.kubeClient.List(ctx, nodeClaims); err != nil {
+		return fmt.Errorf("listing nodeclaims, %w", err)
+	}
+	nodes := &corev1.NodeList{}
+	if err := r.kubeClient.List(ctx, nodes); err != nil {
+		return fmt.Errorf("listing nodes, %w", err)
+	}
+	registered := sets.New(lo.Map(nodes.Items, func(n corev1.Node, _ int) string { return n.Spec.ProviderID })...)
+	vms := lo.SliceToMap(r.cloud.VirtualMachines(), func(vm armcompute.VirtualMachine) (string, armcompute.VirtualMachine) {
+		return utils.VMResourceIDToProviderID(ctx, lo.FromPtr(vm.ID)), vm
+	})
+
+	for i := range nodeClaims.Items {
+		nodeClaim := &nodeClaims.Items[i]
+		if nodeClaim.Status.ProviderID == "" || registered.Has(nodeClaim.Status.ProviderID) || !nodeClaim.DeletionTimestamp.IsZero() {
+			continue
+		}
+		vm, ok := vms[nodeClaim.Status.ProviderID]
+		if !ok || vm.Properties == nil || time.Since(lo.FromPtr(vm.Properties.TimeCreated)) < r.RegistrationDelay {
+			continue
+		}
+		node := r.toNode(nodeClaim, lo.FromPtr(vm.Name))
+		if err := r.kubeClient.Create(ctx, node); err != nil && !errors.IsAlreadyExists(err) {
+			return fmt.Errorf("creating node %s, %w", node.Name, err)
+		}
+		log.FromContext(ctx).V(1).Info("registered fake node", "Node", node.Name, "NodeClaim", nodeClaim.Name)
+	}
+	return nil
+}
+
+func (r *NodeRegistrar) toNode(nodeClaim *karpv1.NodeClaim, name string) *corev1.Node {
+	return &corev1.Node{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        name,
+			Labels:      lo.Assign(nodeClaim.Labels, map[string]string{corev1.LabelHostname: name}),
+			Annotations: map[string]string{KwokNodeAnnotationKey: KwokNodeAnnotationValue},
+		},
+		Spec: corev1.NodeSpec{
+			ProviderID: nodeClaim.Status.ProviderID,
+			Taints:     []corev1.Taint{karpv1.UnregisteredNoExecuteTaint},
+		},
+		Status: corev1.NodeStatus{
+			Capacity:    nodeClaim.Status.Capacity,
+			Allocatable: nodeClaim.Status.Allocatable,
+			Phase:       corev1.NodePending,
+		},
+	}
+}
@@ -0,0 +1,62 @@
+/*
+Portions Copyright (c) Microsoft Corporation.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package fake
+
+import (
+	"context"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/runtime"
+	"github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/authorization/armauthorization/v2"
+	"github.com/samber/lo"
+
+	"github.com/Azure/karpenter-provider-azure/pkg/providers/instance"
+)
+
+// PermissionsAPI returns the caller's permissions on a resource, which are all actions unless Permissions is set
+type PermissionsAPI struct {
+	Permissions []*armauthorization.Permission
+	Error       error
+}
+
+var _ instance.PermissionsAPI = &PermissionsAPI{}
+
+func (api *PermissionsAPI) NewListForResourcePager(_ string, _ string, _ string, _ string, _ string, _ *armauthorization.PermissionsClientListForResourceOptions) *runtime.Pager[armauthorization.PermissionsClientListForResourceResponse] {
+	pagingHandler := runtime.PagingHandler[armauthorization.PermissionsClientListForResourceResponse]{
+		More: func(page armauthorization.PermissionsClientListForResourceResponse) bool {
+			return false
+		},
+		Fetcher: func(ctx context.Context, _ *armauthorization.PermissionsClientListForResourceResponse) (armauthorization.PermissionsClientListForResourceResponse, error) {
+			if api.Error != nil {
+				return armauthorization.PermissionsClientListForResourceResponse{}, api.Error
+			}
+			permissions := api.Permissions
+			if permissions == nil {
+				permissions = []*armauthorization.Permission{{Actions: []*string{lo.ToPtr("*")}}}
+			}
+			return armauthorization.PermissionsClientListForResourceResponse{
+				PermissionGetResult: armauthorization.PermissionGetResult{Value: permissions},
+			}, nil
+		},
+	}
+	return runtime.NewPager(pagingHandler)
+}
+
+// Reset must be called between tests otherwise tests will pollute each other.
+func (api *PermissionsAPI) Reset() {
+	api.Permissions = nil
+	api.Error = nil
+}
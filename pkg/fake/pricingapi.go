@@ -20,6 +20,7 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"strconv"
 
 	"github.com/Azure/karpenter-provider-azure/pkg/providers/pricing/client"
 )
@@ -34,6 +35,9 @@ type PricingAPI struct {
 type PricingBehavior struct {
 	NextError         AtomicError
 	ProductsPricePage AtomicPtr[client.ProductsPricePage]
+	// ProductsPricePages are paginated in order, with NextPageError failing the fetch of the pages after the first
+	ProductsPricePages AtomicPtrSlice[client.ProductsPricePage]
+	NextPageError      AtomicError
 }
 
 // assert that the fake implements the interface
@@ -42,12 +46,17 @@ var _ client.PricingAPI = &PricingAPI{}
 func (p *PricingAPI) Reset() {
 	p.NextError.Reset()
 	p.ProductsPricePage.Reset()
+	p.ProductsPricePages.Reset()
+	p.NextPageError.Reset()
 }
 
 func (p *PricingAPI) GetProductsPricePages(_ context.Context, _ []*client.Filter, fn func(output *client.ProductsPricePage)) error {
 	if !p.NextError.IsNil() {
 		return p.NextError.Get()
 	}
+	if p.ProductsPricePages.Len() > 0 {
+		return p.getPages(0, fn)
+	}
 	if !p.ProductsPricePage.IsNil() {
 		fn(p.ProductsPricePage.Clone())
 		return nil
@@ -56,6 +65,26 @@ func (p *PricingAPI) GetProductsPricePages(_ context.Context, _ []*client.Filter
 	return errors.New("no pricing data provided")
 }
 
+func (p *PricingAPI) ResumeProductsPricePages(_ context.Context, nextPageLink string, fn func(output *client.ProductsPricePage)) error {
+	page, err := strconv.Atoi(nextPageLink)
+	if err != nil {
+		return fmt.Errorf("invalid page link %q", nextPageLink)
+	}
+	return p.getPages(page, fn)
+}
+
+func (p *PricingAPI) getPages(from int, fn func(output *client.ProductsPricePage)) error {
+	for i := from; i < p.ProductsPricePages.Len(); i++ {
+		if i > 0 {
+			if err := p.NextPageError.Get(); err != nil {
+				return &client.PageError{NextPageLink: strconv.Itoa(i), Err: err}
+			}
+		}
+		fn(p.ProductsPricePages.Get(i))
+	}
+	return nil
+}
+
 func NewProductPrice(instanceType string, price float64) client.Item {
 	return client.Item{
 		ArmSkuName:  instanceType,
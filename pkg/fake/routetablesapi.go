@@ -0,0 +1,57 @@
+/*
+Portions Copyright (c) Microsoft Corporation.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package fake
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
+	"github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/network/armnetwork"
+
+	"github.com/Azure/karpenter-provider-azure/pkg/providers/instance"
+)
+
+type RouteTablesAPI struct {
+	// RouteTables is keyed by the lowercase resource group and name of the route table, see MakeRouteTableKey
+	RouteTables sync.Map
+}
+
+var _ instance.RouteTablesAPI = &RouteTablesAPI{}
+
+// Reset must be called between tests otherwise tests will pollute each other.
+func (api *RouteTablesAPI) Reset() {
+	api.RouteTables.Range(func(k, _ any) bool {
+		api.RouteTables.Delete(k)
+		return true
+	})
+}
+
+func (api *RouteTablesAPI) Get(_ context.Context, resourceGroupName string, routeTableName string, _ *armnetwork.RouteTablesClientGetOptions) (armnetwork.RouteTablesClientGetResponse, error) {
+	routeTable, ok := api.RouteTables.Load(MakeRouteTableKey(resourceGroupName, routeTableName))
+	if !ok {
+		return armnetwork.RouteTablesClientGetResponse{}, &azcore.ResponseError{StatusCode: http.StatusNotFound}
+	}
+	return armnetwork.RouteTablesClientGetResponse{RouteTable: routeTable.(armnetwork.RouteTable)}, nil
+}
+
+func MakeRouteTableKey(resourceGroupName, routeTableName string) string {
+	return strings.ToLower(fmt.Sprintf("%s/%s", resourceGroupName, routeTableName))
+}
@@ -0,0 +1,79 @@
+/*
+Portions Copyright (c) Microsoft Corporation.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package fake
+
+import (
+	"context"
+	"sync"
+
+	"github.com/Azure/karpenter-provider-azure/pkg/providers/spotplacementscore"
+)
+
+type SpotPlacementScoresGenerateInput struct {
+	Subscription string
+	Location     string
+	SKUs         []string
+}
+
+type SpotPlacementScoresBehavior struct {
+	GenerateBehavior MockedFunction[SpotPlacementScoresGenerateInput, []spotplacementscore.PlacementScore]
+	// Scores are the scores of SKUs by availability zone, e.g. "Standard_D2s_v3" => {"1": "High"}. SKUs without
+	// scores aren't scored.
+	Scores sync.Map
+}
+
+var _ spotplacementscore.API = &SpotPlacementScoresAPI{}
+
+type SpotPlacementScoresAPI struct {
+	SpotPlacementScoresBehavior
+}
+
+// Reset must be called between tests otherwise tests will pollute each other.
+func (api *SpotPlacementScoresAPI) Reset() {
+	api.GenerateBehavior.Reset()
+	api.Scores.Range(func(k, _ any) bool {
+		api.Scores.Delete(k)
+		return true
+	})
+}
+
+func (api *SpotPlacementScoresAPI) Generate(_ context.Context, subscription, location string, skus []string) ([]spotplacementscore.PlacementScore, error) {
+	input := &SpotPlacementScoresGenerateInput{
+		Subscription: subscription,
+		Location:     location,
+		SKUs:         skus,
+	}
+	return api.GenerateBehavior.Invoke(input, func(input *SpotPlacementScoresGenerateInput) ([]spotplacementscore.PlacementScore, error) {
+		var placementScores []spotplacementscore.PlacementScore
+		for _, sku := range input.SKUs {
+			scores, ok := api.Scores.Load(sku)
+			if !ok {
+				continue
+			}
+			for zone, score := range scores.(map[string]string) {
+				placementScores = append(placementScores, spotplacementscore.PlacementScore{
+					SKU:              sku,
+					Region:           input.Location,
+					AvailabilityZone: zone,
+					Score:            score,
+					IsQuotaAvailable: true,
+				})
+			}
+		}
+		return placementScores, nil
+	})
+}
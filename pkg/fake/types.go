@@ -19,7 +19,9 @@ package fake
 import (
 	"context"
 	"net/http"
+	"strconv"
 	"sync/atomic"
+	"time"
 
 	"github.com/Azure/azure-sdk-for-go/sdk/azcore/runtime"
 )
@@ -28,6 +30,7 @@ type MockedFunction[I any, O any] struct {
 	Output          AtomicPtr[O]      // Output to return on call to this function
 	CalledWithInput AtomicPtrStack[I] // Stack used to keep track of passed input to this function
 	Error           AtomicError       // Error to return a certain number of times defined by custom error options
+	Failures        FailureInjector   // Errors to return at random, at the configured rates
 
 	successfulCalls atomic.Int32 // Internal construct to keep track of the number of times this function has successfully been called
 	failedCalls     atomic.Int32 // Internal construct to keep track of the number of times this function has failed (with error)
@@ -39,6 +42,7 @@ func (m *MockedFunction[I, O]) Reset() {
 	m.Output.Reset()
 	m.CalledWithInput.Reset()
 	m.Error.Reset()
+	m.Failures.Reset()
 
 	m.successfulCalls.Store(0)
 	m.failedCalls.Store(0)
@@ -51,6 +55,10 @@ func (m *MockedFunction[I, O]) Invoke(input *I, defaultTransformer func(*I) (O,
 		m.failedCalls.Add(1)
 		return *new(O), err
 	}
+	if err := m.Failures.Get(); err != nil {
+		m.failedCalls.Add(1)
+		return *new(O), err
+	}
 	if !m.Output.IsNil() {
 		m.successfulCalls.Add(1)
 		return *m.Output.Clone(), nil
@@ -78,7 +86,10 @@ func (m *MockedFunction[I, O]) FailedCalls() int {
 
 type MockedLRO[I any, O any] struct {
 	MockedFunction[I, O]
-	BeginError AtomicError // Error to return a certain number of times defined by custom error options (for Begin)
+	BeginError AtomicError   // Error to return a certain number of times defined by custom error options (for Begin)
+	Latency    time.Duration // How long the returned poller takes to reach a terminal state, zero means immediately
+	// LatencyDistribution, when set, is sampled for the latency of each call instead of using Latency
+	LatencyDistribution LatencyDistribution
 }
 
 // Reset must be called between tests otherwise tests will pollute each other.
@@ -87,6 +98,7 @@ func (m *MockedLRO[I, O]) Reset() {
 	m.CalledWithInput.Reset()
 	m.BeginError.Reset()
 	m.Error.Reset()
+	m.Failures.Reset()
 
 	m.successfulCalls.Store(0)
 	m.failedCalls.Store(0)
@@ -94,6 +106,7 @@ func (m *MockedLRO[I, O]) Reset() {
 
 func (m *MockedLRO[I, O]) Invoke(input *I, defaultTransformer func(*I) (*O, error)) (*runtime.Poller[O], error) {
 	m.CalledWithInput.Add(input)
+	latency := m.latency()
 
 	if err := m.BeginError.Get(); err != nil {
 		m.failedCalls.Add(1)
@@ -101,12 +114,17 @@ func (m *MockedLRO[I, O]) Invoke(input *I, defaultTransformer func(*I) (*O, erro
 	}
 	if err := m.Error.Get(); err != nil {
 		m.failedCalls.Add(1)
-		return newMockPoller[O](nil, err)
+		return newMockPoller[O](nil, err, latency)
+	}
+	// like in Azure, injected failures surface once the operation completes, e.g. an AllocationFailed VM create
+	if err := m.Failures.Get(); err != nil {
+		m.failedCalls.Add(1)
+		return newMockPoller[O](nil, err, latency)
 	}
 
 	if !m.Output.IsNil() {
 		m.successfulCalls.Add(1)
-		return newMockPoller(m.Output.Clone(), nil)
+		return newMockPoller(m.Output.Clone(), nil, latency)
 	}
 	out, err := defaultTransformer(input)
 	if err != nil {
@@ -114,7 +132,14 @@ func (m *MockedLRO[I, O]) Invoke(input *I, defaultTransformer func(*I) (*O, erro
 	} else {
 		m.successfulCalls.Add(1)
 	}
-	return newMockPoller(out, err)
+	return newMockPoller(out, err, latency)
+}
+
+func (m *MockedLRO[I, O]) latency() time.Duration {
+	if m.LatencyDistribution != nil {
+		return max(m.LatencyDistribution(), 0)
+	}
+	return m.Latency
 }
 
 func (m *MockedLRO[I, O]) Calls() int {
@@ -129,19 +154,25 @@ func (m *MockedLRO[I, O]) FailedCalls() int {
 	return int(m.failedCalls.Load())
 }
 
-// MockHandler returns a pre-defined result or error.
+// MockHandler returns a pre-defined result or error, once doneAt has passed.
 type MockHandler[T any] struct {
 	result *T
 	err    error
+	doneAt time.Time
 }
 
-// Done returns true if the LRO has reached a terminal state. TrivialHandler is always done.
+// Done returns true if the LRO has reached a terminal state. MockHandler is done once doneAt has passed.
 func (h MockHandler[T]) Done() bool {
-	return true
+	return !time.Now().Before(h.doneAt)
 }
 
-// Poll fetches the latest state of the LRO.
+// Poll fetches the latest state of the LRO. While not done, the response asks to be polled again
+// when the LRO is expected to complete, rather than after the default polling frequency. Errors
+// surface once the LRO is done, as failed operations take time in Azure too.
 func (h MockHandler[T]) Poll(context.Context) (*http.Response, error) {
+	if remaining := time.Until(h.doneAt); remaining > 0 {
+		return &http.Response{Header: http.Header{"Retry-After-Ms": []string{strconv.FormatInt(remaining.Milliseconds()+1, 10)}}}, nil
+	}
 	if h.err != nil {
 		return nil, h.err
 	}
@@ -158,13 +189,14 @@ func (h MockHandler[T]) Result(_ context.Context, result *T) error {
 	return nil
 }
 
-// newMockPoller returns a poller with a mock handler that returns the given result and error.
-func newMockPoller[T any](result *T, err error) (*runtime.Poller[T], error) {
+// newMockPoller returns a poller with a mock handler that returns the given result and error after the given latency.
+func newMockPoller[T any](result *T, err error, latency time.Duration) (*runtime.Poller[T], error) {
 	// http.Response and Pipeline are not used
 	return runtime.NewPoller(nil, runtime.Pipeline{}, &runtime.NewPollerOptions[T]{
 		Handler: MockHandler[T]{
 			result: result,
 			err:    err,
+			doneAt: time.Now().Add(latency),
 		},
 		// Response: &result at the poller level is not needed, result from handler is always used
 	})
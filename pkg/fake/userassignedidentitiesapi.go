@@ -0,0 +1,57 @@
+/*
+Portions Copyright (c) Microsoft Corporation.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package fake
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
+	"github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/msi/armmsi"
+
+	"github.com/Azure/karpenter-provider-azure/pkg/providers/instance"
+)
+
+type UserAssignedIdentitiesAPI struct {
+	// Identities is keyed by the lowercase resource group and name of the identity, see MakeUserAssignedIdentityKey
+	Identities sync.Map
+}
+
+var _ instance.UserAssignedIdentitiesAPI = &UserAssignedIdentitiesAPI{}
+
+// Reset must be called between tests otherwise tests will pollute each other.
+func (api *UserAssignedIdentitiesAPI) Reset() {
+	api.Identities.Range(func(k, _ any) bool {
+		api.Identities.Delete(k)
+		return true
+	})
+}
+
+func (api *UserAssignedIdentitiesAPI) Get(_ context.Context, resourceGroupName string, resourceName string, _ *armmsi.UserAssignedIdentitiesClientGetOptions) (armmsi.UserAssignedIdentitiesClientGetResponse, error) {
+	identity, ok := api.Identities.Load(MakeUserAssignedIdentityKey(resourceGroupName, resourceName))
+	if !ok {
+		return armmsi.UserAssignedIdentitiesClientGetResponse{}, &azcore.ResponseError{StatusCode: http.StatusNotFound}
+	}
+	return armmsi.UserAssignedIdentitiesClientGetResponse{Identity: identity.(armmsi.Identity)}, nil
+}
+
+func MakeUserAssignedIdentityKey(resourceGroupName, resourceName string) string {
+	return strings.ToLower(fmt.Sprintf("%s/%s", resourceGroupName, resourceName))
+}
@@ -66,6 +66,9 @@ type VirtualMachinesBehavior struct {
 	VirtualMachineDeleteBehavior         MockedLRO[VirtualMachineDeleteInput, armcompute.VirtualMachinesClientDeleteResponse]
 	VirtualMachineGetBehavior            MockedFunction[VirtualMachineGetInput, armcompute.VirtualMachinesClientGetResponse]
 	Instances                            sync.Map
+	// ReplicationLag simulates the eventual consistency of ARM: VMs aren't found, nor listed, until it elapsed after
+	// they were created
+	ReplicationLag time.Duration
 }
 
 // assert that the fake implements the interface
@@ -84,6 +87,7 @@ func (c *VirtualMachinesAPI) Reset() {
 	c.VirtualMachineDeleteBehavior.Reset()
 	c.VirtualMachineGetBehavior.Reset()
 	c.VirtualMachineUpdateBehavior.Reset()
+	c.ReplicationLag = 0
 	c.Instances.Range(func(k, v any) bool {
 		c.Instances.Delete(k)
 		return true
@@ -235,7 +239,7 @@ func (c *VirtualMachinesAPI) Get(_ context.Context, resourceGroupName string, vm
 			return armcompute.VirtualMachinesClientGetResponse{}, getAuthTokenError(err)
 		}
 		instance, ok := c.Instances.Load(MkVMID(input.ResourceGroupName, input.VMName))
-		if !ok {
+		if !ok || !c.replicated(instance.(armcompute.VirtualMachine)) {
 			return armcompute.VirtualMachinesClientGetResponse{}, &azcore.ResponseError{StatusCode: http.StatusNotFound}
 		}
 		return armcompute.VirtualMachinesClientGetResponse{
@@ -259,6 +263,14 @@ func (c *VirtualMachinesAPI) BeginDelete(_ context.Context, resourceGroupName st
 	})
 }
 
+// replicated returns whether the replication lag elapsed since the VM was created
+func (c *VirtualMachinesAPI) replicated(vm armcompute.VirtualMachine) bool {
+	if c.ReplicationLag == 0 || vm.Properties == nil || vm.Properties.TimeCreated == nil {
+		return true
+	}
+	return time.Since(*vm.Properties.TimeCreated) >= c.ReplicationLag
+}
+
 func createSDKErrorBody(code, message string) io.ReadCloser {
 	return io.NopCloser(bytes.NewReader([]byte(fmt.Sprintf(`{"error":{"code": "%s", "message": "%s"}}`, code, message))))
 }
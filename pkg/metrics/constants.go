@@ -21,7 +21,11 @@ const (
 	Namespace = "karpenter"
 
 	// Subsystem(s).
-	imageFamilySubsystem = "image"
+	imageFamilySubsystem    = "image"
+	nodeClassSubsystem      = "nodeclass"
+	nodeClaimsSubsystem     = "nodeclaims"
+	instanceHealthSubsystem = "instance_health"
+	tagDriftSubsystem       = "tag_drift"
 
 	// Label key(s).
 	ImageLabel        = "image"
@@ -31,4 +35,19 @@ const (
 	CapacityTypeLabel = "capacity_type"
 	NodePoolLabel     = "nodepool"
 	PhaseLabel        = "phase"
+	NodeClassLabel    = "nodeclass"
+	ConditionLabel    = "condition"
+	APIVersionLabel   = "api_version"
+	CapabilityLabel   = "capability"
+	SubscriptionLabel = "subscription"
+	BucketLabel       = "bucket"
+	OperationLabel    = "operation"
+	SourceLabel       = "source"
+	ReasonLabel       = "reason"
+	PriorityLabel     = "priority"
+	ResourceTypeLabel = "resource_type"
+	ResultLabel       = "result"
+	PathLabel         = "path"
+	ErrorClassLabel   = "error_class"
+	FamilyLabel       = "family"
 )
@@ -29,12 +29,221 @@ var (
 			Name:      "selection_error_count",
 			Help:      "The number of errors encountered while selecting an image.",
 		},
-		[]string{"family"},
+		[]string{FamilyLabel},
+	)
+	ImageFreezeActive = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: Namespace,
+			Subsystem: imageFamilySubsystem,
+			Name:      "freeze_active",
+			Help:      "Whether image updates are frozen for an AKSNodeClass by the image-freeze annotation.",
+		},
+		[]string{NodeClassLabel},
+	)
+	ImageUnsatisfiableNodeClasses = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: Namespace,
+			Subsystem: imageFamilySubsystem,
+			Name:      "unsatisfiable_nodeclasses",
+			Help:      "AKSNodeClasses whose images are not compatible with any instance type offered to a NodePool referencing them. Summing the series counts them.",
+		},
+		[]string{NodeClassLabel},
+	)
+	NodeImageVersionsAPIFallback = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: Namespace,
+			Subsystem: imageFamilySubsystem,
+			Name:      "node_image_versions_api_fallback",
+			Help:      "Whether the NodeImageVersions API is called with the fallback api-version, because the configured api-version was rejected.",
+		},
+		[]string{APIVersionLabel},
+	)
+	ImageLookupFailureCacheHits = prometheus.NewCounter(
+		prometheus.CounterOpts{
+			Namespace: Namespace,
+			Subsystem: imageFamilySubsystem,
+			Name:      "lookup_failure_cache_hits_total",
+			Help:      "The number of image lookups answered with the cached failure of a previous lookup, e.g. while the gallery throttles the lookups, rather than retried.",
+		},
+	)
+	ImageSIGFallbacks = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: Namespace,
+			Subsystem: imageFamilySubsystem,
+			Name:      "sig_fallback_total",
+			Help:      "The number of lookups of the default images through SIG that failed and fell back to the community galleries, by image family.",
+		},
+		[]string{FamilyLabel},
+	)
+	ImageWorkQueueDepth = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: Namespace,
+			Subsystem: imageFamilySubsystem,
+			Name:      "work_queue_depth",
+			Help:      "The number of image lookups waiting for a slot of the image work queue, by priority: launch, probe or refresh.",
+		},
+		[]string{PriorityLabel},
+	)
+	ImageWorkQueueDedupeHits = prometheus.NewCounter(
+		prometheus.CounterOpts{
+			Namespace: Namespace,
+			Subsystem: imageFamilySubsystem,
+			Name:      "work_queue_dedupe_hits_total",
+			Help:      "The number of image lookups answered by an identical lookup already queued or in flight, rather than issued again.",
+		},
+	)
+	ImageNotFoundRecoveries = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: Namespace,
+			Subsystem: imageFamilySubsystem,
+			Name:      "not_found_recoveries_total",
+			Help:      "The number of launches whose image version was deleted after it was resolved, by where it was found missing: preflight for the check of custom image versions before the VM create, create for the VM create failing, and by result: recovered once the image was re-resolved to another version, or failed.",
+		},
+		[]string{SourceLabel, ResultLabel},
+	)
+	ImageResolutionDuration = prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Namespace: Namespace,
+			Subsystem: imageFamilySubsystem,
+			Name:      "resolution_duration_seconds",
+			Help:      "Duration of the resolutions of the images of AKSNodeClasses, including their wait in the image work queue, by resolution path: cig, sig, custom or marketplace.",
+			Buckets:   []float64{0.01, 0.05, 0.1, 0.5, 1, 2, 5, 10, 30, 60},
+		},
+		[]string{PathLabel},
+	)
+	ImageCacheLookups = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: Namespace,
+			Subsystem: imageFamilySubsystem,
+			Name:      "cache_lookups_total",
+			Help:      "The number of lookups of resolved images in the image cache, by resolution path and result: hit or miss. The images of the community galleries aren't cached.",
+		},
+		[]string{PathLabel, ResultLabel},
+	)
+	ImageResolutionErrors = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: Namespace,
+			Subsystem: imageFamilySubsystem,
+			Name:      "resolution_errors_total",
+			Help:      "The number of failed resolutions of the images of AKSNodeClasses, by resolution path and error class: throttled, notfound, auth or other.",
+		},
+		[]string{PathLabel, ErrorClassLabel},
+	)
+	NodeClassConditionStatus = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: Namespace,
+			Subsystem: nodeClassSubsystem,
+			Name:      "condition_status",
+			Help:      "Whether a status condition of an AKSNodeClass is True (1) or not (0), e.g. its Ready condition.",
+		},
+		[]string{NodeClassLabel, ConditionLabel},
+	)
+	NodeClassNodes = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: Namespace,
+			Subsystem: nodeClassSubsystem,
+			Name:      "nodes",
+			Help:      "The number of nodes launched from an AKSNodeClass.",
+		},
+		[]string{NodeClassLabel},
+	)
+	NodeClassImageNodes = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: Namespace,
+			Subsystem: nodeClassSubsystem,
+			Name:      "image_nodes",
+			Help:      "The number of nodes launched from an AKSNodeClass per image version. Long image IDs are shortened to their image name and version, with a hash of the ID.",
+		},
+		[]string{NodeClassLabel, ImageLabel},
+	)
+	NodeClassImageDriftedNodes = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: Namespace,
+			Subsystem: nodeClassSubsystem,
+			Name:      "image_drifted_nodes",
+			Help:      "The number of nodes launched from an AKSNodeClass that drifted from its images and are pending replacement.",
+		},
+		[]string{NodeClassLabel},
+	)
+	NodeClassStaleData = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: Namespace,
+			Subsystem: nodeClassSubsystem,
+			Name:      "stale_data",
+			Help:      "Whether the on-demand prices, spot prices or SKUs of instance types of an AKSNodeClass are older than the strict-data-freshness option (1) or not (0), pausing the launch of their offerings.",
+		},
+		[]string{NodeClassLabel, SourceLabel},
+	)
+	InstanceHealthUnhealthyNodes = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: Namespace,
+			Subsystem: instanceHealthSubsystem,
+			Name:      "unhealthy_nodes",
+			Help:      "The number of nodes found unhealthy on the Azure side by the last instance health evaluation, by reason, e.g. VMAgentNotReady or NICProvisioningFailed.",
+		},
+		[]string{ReasonLabel},
+	)
+	TagDriftDriftedResources = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: Namespace,
+			Subsystem: tagDriftSubsystem,
+			Name:      "drifted_resources",
+			Help:      "The number of resources whose tags drifted from the tags Karpenter sets on them, found by the last tag drift check, by resource type: VirtualMachine, NetworkInterface or Disk.",
+		},
+		[]string{ResourceTypeLabel},
+	)
+	TagDriftRepairedResources = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: Namespace,
+			Subsystem: tagDriftSubsystem,
+			Name:      "repaired_resources",
+			Help:      "The number of resources whose tags were repaired by the last tag drift check, by resource type. Always 0 in the Report tag drift mode.",
+		},
+		[]string{ResourceTypeLabel},
+	)
+	NodeClaimsRepairedTotal = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: Namespace,
+			Subsystem: nodeClaimsSubsystem,
+			Name:      "repaired_total",
+			Help:      "The number of nodeclaims replaced by node repair, by the source of the unhealthy node condition: azure for the InstanceHealthy condition of the instance health evaluator, kubernetes for the conditions reported in the cluster.",
+		},
+		[]string{SourceLabel, ConditionLabel, NodePoolLabel},
+	)
+	NodePoolEstimatedHourlyCost = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: Namespace,
+			Subsystem: nodeClaimsSubsystem,
+			Name:      "estimated_hourly_cost",
+			Help:      "The sum of the estimated hourly costs in USD of the VMs of the nodeclaims of a nodepool, from the retail prices of their offerings. It's an estimate and doesn't account for discounts, reservations or disks.",
+		},
+		[]string{NodePoolLabel},
 	)
 )
 
 func init() {
 	crmetrics.Registry.MustRegister(
 		ImageSelectionErrorCount,
+		ImageFreezeActive,
+		ImageUnsatisfiableNodeClasses,
+		NodeImageVersionsAPIFallback,
+		ImageLookupFailureCacheHits,
+		ImageSIGFallbacks,
+		ImageWorkQueueDepth,
+		ImageWorkQueueDedupeHits,
+		ImageNotFoundRecoveries,
+		ImageResolutionDuration,
+		ImageCacheLookups,
+		ImageResolutionErrors,
+		NodeClassConditionStatus,
+		NodeClassNodes,
+		NodeClassImageNodes,
+		NodeClassImageDriftedNodes,
+		NodeClassStaleData,
+		InstanceHealthUnhealthyNodes,
+		TagDriftDriftedResources,
+		TagDriftRepairedResources,
+		NodeClaimsRepairedTotal,
+		NodePoolEstimatedHourlyCost,
 	)
 }
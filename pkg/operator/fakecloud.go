@@ -0,0 +1,61 @@
+/*
+Portions Copyright (c) Microsoft Corporation.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package operator
+
+import (
+	"context"
+
+	"github.com/samber/lo"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/karpenter/pkg/operator"
+
+	"github.com/Azure/karpenter-provider-azure/pkg/auth"
+	"github.com/Azure/karpenter-provider-azure/pkg/consts"
+	"github.com/Azure/karpenter-provider-azure/pkg/fake"
+	"github.com/Azure/karpenter-provider-azure/pkg/operator/options"
+)
+
+const (
+	fakeCloudSubscriptionID = "00000000-0000-0000-0000-000000000000"
+	fakeCloudTenantID       = "00000000-0000-0000-0000-000000000000"
+	fakeCloudVnetGUID       = "00000000-0000-0000-0000-000000000000"
+)
+
+// newFakeCloudOperator returns an operator running against an in-memory fake cloud (--cloud=fake),
+// for local development without Azure credentials. It is expected to run out of cluster, e.g. against kind,
+// so the operator's client is used in place of an in-cluster one.
+func newFakeCloudOperator(ctx context.Context, operator *operator.Operator) (context.Context, *Operator) {
+	log.FromContext(ctx).Info("running against a fake cloud, no Azure resources will be created")
+
+	fakeCloud, err := fake.NewCloud(options.FromContext(ctx).NodeResourceGroup, options.FromContext(ctx).ClusterName)
+	lo.Must0(err, "creating fake cloud")
+	lo.Must0(operator.Add(fake.NewNodeRegistrar(operator.GetClient(), fakeCloud)), "adding fake node registrar")
+
+	azConfig := &auth.Config{
+		Cloud:          "AzurePublicCloud",
+		Location:       fake.Region,
+		TenantID:       fakeCloudTenantID,
+		SubscriptionID: fakeCloudSubscriptionID,
+		ResourceGroup:  options.FromContext(ctx).NodeResourceGroup,
+	}
+	env := lo.Must(auth.EnvironmentFromName(azConfig.Cloud))
+	vnetGUID := options.FromContext(ctx).VnetGUID
+	if vnetGUID == "" && options.FromContext(ctx).NetworkPluginMode == consts.NetworkPluginModeOverlay {
+		vnetGUID = fakeCloudVnetGUID
+	}
+	return newOperator(ctx, operator, azConfig, env, fakeCloud.AZClient(), fakeCloud.PricingAPI, operator.KubernetesInterface, vnetGUID)
+}
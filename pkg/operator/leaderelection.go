@@ -0,0 +1,87 @@
+/*
+Portions Copyright (c) Microsoft Corporation.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package operator
+
+import (
+	"context"
+
+	"github.com/samber/lo"
+	"k8s.io/client-go/rest"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/manager"
+
+	"github.com/Azure/karpenter-provider-azure/pkg/apis/v1beta1"
+	"github.com/Azure/karpenter-provider-azure/pkg/operator/options"
+	"github.com/Azure/karpenter-provider-azure/pkg/providers/instancetype"
+)
+
+// WithLeaderElectionTimings makes the managers created afterwards, i.e. the manager of the core operator, acquire and
+// renew their lease with the leader election timings of the options in ctx. The core operator leaves them to the
+// controller-runtime defaults, so they're set where it creates its manager.
+func WithLeaderElectionTimings(ctx context.Context) {
+	opts := options.FromContext(ctx)
+	newManager := ctrl.NewManager
+	ctrl.NewManager = func(config *rest.Config, mgrOpts manager.Options) (manager.Manager, error) {
+		mgrOpts.LeaseDuration = lo.ToPtr(opts.LeaderElectionLeaseDuration)
+		mgrOpts.RenewDeadline = lo.ToPtr(opts.LeaderElectionRenewDeadline)
+		mgrOpts.RetryPeriod = lo.ToPtr(opts.LeaderElectionRetryPeriod)
+		return newManager(config, mgrOpts)
+	}
+}
+
+// cacheWarmer fills the instance types cache with the instance types of every AKSNodeClass once elected the leader, so
+// that the first provisioning after a failover doesn't wait on listing the SKUs of the region. Standby replicas never
+// list them, leaving the ARM request quota to the leader.
+type cacheWarmer struct {
+	kubeClient           client.Client
+	instanceTypeProvider instancetype.Provider
+}
+
+func newCacheWarmer(kubeClient client.Client, instanceTypeProvider instancetype.Provider) *cacheWarmer {
+	return &cacheWarmer{
+		kubeClient:           kubeClient,
+		instanceTypeProvider: instanceTypeProvider,
+	}
+}
+
+// Start warms the cache once, stopping as soon as the context is canceled on losing the leadership
+func (w *cacheWarmer) Start(ctx context.Context) error {
+	ctx = log.IntoContext(ctx, log.FromContext(ctx).WithName("cachewarmer"))
+	nodeClassList := &v1beta1.AKSNodeClassList{}
+	if err := w.kubeClient.List(ctx, nodeClassList); err != nil {
+		log.FromContext(ctx).Error(err, "failed to list the AKSNodeClasses to warm the instance types cache with")
+		return nil
+	}
+	for i := range nodeClassList.Items {
+		if ctx.Err() != nil {
+			return nil
+		}
+		nodeClass := &nodeClassList.Items[i]
+		if _, err := w.instanceTypeProvider.List(ctx, nodeClass); err != nil {
+			// the provisioning lists them again, and reports the errors it gets
+			log.FromContext(ctx).V(1).Info("failed to warm the instance types cache", "AKSNodeClass", nodeClass.Name, "error", err)
+		}
+	}
+	return nil
+}
+
+// NeedLeaderElection is true so that only the leader, which provisions with the instance types, warms their cache
+func (w *cacheWarmer) NeedLeaderElection() bool {
+	return true
+}
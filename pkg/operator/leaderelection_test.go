@@ -0,0 +1,115 @@
+/*
+Portions Copyright (c) Microsoft Corporation.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package operator
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/samber/lo"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/rest"
+	ctrl "sigs.k8s.io/controller-runtime"
+	fakeclient "sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/manager"
+	"sigs.k8s.io/karpenter/pkg/cloudprovider"
+
+	"github.com/Azure/karpenter-provider-azure/pkg/apis/v1beta1"
+	"github.com/Azure/karpenter-provider-azure/pkg/operator/options"
+	"github.com/Azure/karpenter-provider-azure/pkg/providers/instancetype"
+	"github.com/Azure/karpenter-provider-azure/pkg/test"
+)
+
+func TestWithLeaderElectionTimings(t *testing.T) {
+	newManager := ctrl.NewManager
+	t.Cleanup(func() { ctrl.NewManager = newManager })
+	var created manager.Options
+	ctrl.NewManager = func(_ *rest.Config, mgrOpts manager.Options) (manager.Manager, error) {
+		created = mgrOpts
+		return nil, nil
+	}
+
+	ctx := options.ToContext(context.Background(), test.Options(test.OptionsFields{
+		LeaderElectionLeaseDuration: lo.ToPtr(time.Minute),
+		LeaderElectionRenewDeadline: lo.ToPtr(40 * time.Second),
+		LeaderElectionRetryPeriod:   lo.ToPtr(5 * time.Second),
+	}))
+	WithLeaderElectionTimings(ctx)
+	_, _ = ctrl.NewManager(nil, manager.Options{LeaderElection: true, LeaderElectionID: "karpenter-leader-election"})
+
+	if !created.LeaderElection || created.LeaderElectionID != "karpenter-leader-election" {
+		t.Errorf("expected the other manager options to be kept, got %+v", created)
+	}
+	if lo.FromPtr(created.LeaseDuration) != time.Minute {
+		t.Errorf("expected a lease duration of 1m, got %v", created.LeaseDuration)
+	}
+	if lo.FromPtr(created.RenewDeadline) != 40*time.Second {
+		t.Errorf("expected a renew deadline of 40s, got %v", created.RenewDeadline)
+	}
+	if lo.FromPtr(created.RetryPeriod) != 5*time.Second {
+		t.Errorf("expected a retry period of 5s, got %v", created.RetryPeriod)
+	}
+}
+
+// instanceTypeLister records the AKSNodeClasses the instance types are listed for, canceling ctx after the first one
+type instanceTypeLister struct {
+	instancetype.Provider
+	cancel func()
+	listed []string
+}
+
+func (l *instanceTypeLister) List(_ context.Context, nodeClass *v1beta1.AKSNodeClass) ([]*cloudprovider.InstanceType, error) {
+	l.listed = append(l.listed, nodeClass.Name)
+	if l.cancel != nil {
+		l.cancel()
+	}
+	return nil, nil
+}
+
+func TestCacheWarmer(t *testing.T) {
+	kubeClient := fakeclient.NewClientBuilder().WithScheme(clientgoscheme.Scheme).WithObjects(
+		test.AKSNodeClass(),
+		test.AKSNodeClass(),
+	).Build()
+
+	t.Run("needs leader election", func(t *testing.T) {
+		if !newCacheWarmer(kubeClient, &instanceTypeLister{}).NeedLeaderElection() {
+			t.Errorf("expected the cache to be warmed by the leader only")
+		}
+	})
+	t.Run("warms the instance types of every AKSNodeClass", func(t *testing.T) {
+		lister := &instanceTypeLister{}
+		if err := newCacheWarmer(kubeClient, lister).Start(context.Background()); err != nil {
+			t.Fatalf("expected no error, got %s", err)
+		}
+		if len(lister.listed) != 2 {
+			t.Errorf("expected the instance types of 2 AKSNodeClasses to be listed, got %v", lister.listed)
+		}
+	})
+	t.Run("stops on losing the leadership", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		lister := &instanceTypeLister{cancel: cancel}
+		if err := newCacheWarmer(kubeClient, lister).Start(ctx); err != nil {
+			t.Fatalf("expected no error, got %s", err)
+		}
+		if len(lister.listed) != 1 {
+			t.Errorf("expected the warm-up to stop after the first AKSNodeClass, got %v", lister.listed)
+		}
+	})
+}
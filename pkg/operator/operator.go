@@ -21,12 +21,15 @@ import (
 	"encoding/base64"
 	"fmt"
 	"net"
+	"os"
+	"strings"
 	"time"
 
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 
 	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
 	"github.com/Azure/azure-sdk-for-go/sdk/azcore/policy"
+	"github.com/Azure/skewer"
 	"github.com/go-logr/logr"
 	"github.com/patrickmn/go-cache"
 	"github.com/samber/lo"
@@ -56,6 +59,7 @@ import (
 
 	"github.com/Azure/karpenter-provider-azure/pkg/consts"
 	"github.com/Azure/karpenter-provider-azure/pkg/operator/options"
+	"github.com/Azure/karpenter-provider-azure/pkg/providers/bootstraptoken"
 	"github.com/Azure/karpenter-provider-azure/pkg/providers/imagefamily"
 	"github.com/Azure/karpenter-provider-azure/pkg/providers/instance"
 	"github.com/Azure/karpenter-provider-azure/pkg/providers/instancetype"
@@ -64,10 +68,16 @@ import (
 	"github.com/Azure/karpenter-provider-azure/pkg/providers/loadbalancer"
 	"github.com/Azure/karpenter-provider-azure/pkg/providers/networksecuritygroup"
 	"github.com/Azure/karpenter-provider-azure/pkg/providers/pricing"
+	"github.com/Azure/karpenter-provider-azure/pkg/providers/pricing/client"
+	"github.com/Azure/karpenter-provider-azure/pkg/providers/spotplacementscore"
+	"github.com/Azure/karpenter-provider-azure/pkg/tracing"
 	"github.com/Azure/karpenter-provider-azure/pkg/utils"
 	armopts "github.com/Azure/karpenter-provider-azure/pkg/utils/opts"
 )
 
+// serviceAccountNamespaceFile is the namespace of the service account of the pod the operator runs in
+const serviceAccountNamespaceFile = "/var/run/secrets/kubernetes.io/serviceaccount/namespace"
+
 func init() {
 	karpv1.NormalizedLabels = lo.Assign(karpv1.NormalizedLabels, map[string]string{"topology.disk.csi.azure.com/zone": corev1.LabelTopologyZone})
 }
@@ -81,16 +91,18 @@ type Operator struct {
 	InClusterKubernetesInterface kubernetes.Interface
 
 	UnavailableOfferingsCache *azurecache.UnavailableOfferings
-
-	KubernetesVersionProvider kubernetesversion.KubernetesVersionProvider
-	ImageProvider             imagefamily.NodeImageProvider
-	ImageResolver             imagefamily.Resolver
-	LaunchTemplateProvider    *launchtemplate.Provider
-	PricingProvider           *pricing.Provider
-	InstanceTypesProvider     instancetype.Provider
-	VMInstanceProvider        *instance.DefaultVMProvider
-	LoadBalancerProvider      *loadbalancer.Provider
-	AZClient                  *instance.AZClient
+	NodeImagesCache           *cache.Cache
+
+	KubernetesVersionProvider  kubernetesversion.KubernetesVersionProvider
+	ImageProvider              imagefamily.NodeImageProvider
+	ImageResolver              imagefamily.Resolver
+	LaunchTemplateProvider     *launchtemplate.Provider
+	PricingProvider            *pricing.Provider
+	SpotPlacementScoreProvider *spotplacementscore.Provider
+	InstanceTypesProvider      instancetype.Provider
+	VMInstanceProvider         *instance.DefaultVMProvider
+	LoadBalancerProvider       *loadbalancer.Provider
+	AZClient                   *instance.AZClient
 }
 
 func kubeDNSIP(ctx context.Context, kubernetesInterface kubernetes.Interface) (net.IP, error) {
@@ -109,12 +121,16 @@ func kubeDNSIP(ctx context.Context, kubernetesInterface kubernetes.Interface) (n
 }
 
 func NewOperator(ctx context.Context, operator *operator.Operator) (context.Context, *Operator) {
+	if options.FromContext(ctx).Cloud == consts.CloudFake {
+		return newFakeCloudOperator(ctx, operator)
+	}
+
 	azConfig, err := GetAZConfig()
 	lo.Must0(err, "creating Azure config") // NOTE: we prefer this over the cleaner azConfig := lo.Must(GetAzConfig()), as when initializing the client there are helpful error messages in initializing clients and the azure config
 
 	log.FromContext(ctx).V(0).Info("Initial AZConfig", "azConfig", azConfig.String())
 
-	cred, err := getCredential()
+	cred, err := getCredential(options.FromContext(ctx).GetAdditionallyAllowedTenants())
 	lo.Must0(err, "getting Azure credential")
 
 	env, err := auth.ResolveCloudEnvironment(azConfig)
@@ -123,12 +139,27 @@ func NewOperator(ctx context.Context, operator *operator.Operator) (context.Cont
 	// Get a token to ensure we can
 	lo.Must0(ensureToken(cred, env), "ensuring Azure token can be retrieved")
 
+	// the remaining ARM request quota is tracked across all the ARM clients
+	armopts.RateLimits.Configure(options.FromContext(ctx).ARMRateLimitLowThreshold, options.FromContext(ctx).ARMRateLimitBackpressure)
+	// the provisioning of nodeclaims is traced, with the ARM requests it sends, once an OTLP endpoint is configured
+	if endpoint := options.FromContext(ctx).OTLPTracesEndpoint; endpoint != "" {
+		shutdown, err := tracing.Setup(ctx, endpoint)
+		lo.Must0(err, "setting up tracing")
+		go func() {
+			<-ctx.Done()
+			shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+			if err := shutdown(shutdownCtx); err != nil {
+				log.FromContext(ctx).Error(err, "failed to flush traces")
+			}
+		}()
+	}
 	azClient, err := instance.NewAZClient(ctx, azConfig, env, cred)
 	lo.Must0(err, "creating Azure client")
-	if options.FromContext(ctx).VnetGUID == "" && options.FromContext(ctx).NetworkPluginMode == consts.NetworkPluginModeOverlay {
-		vnetGUID, err := getVnetGUID(ctx, cred, azConfig, options.FromContext(ctx).SubnetID)
+	vnetGUID := options.FromContext(ctx).VnetGUID
+	if vnetGUID == "" && options.FromContext(ctx).NetworkPluginMode == consts.NetworkPluginModeOverlay {
+		vnetGUID, err = getVnetGUID(ctx, cred, azConfig, options.FromContext(ctx).SubnetID)
 		lo.Must0(err, "getting VNET GUID")
-		options.FromContext(ctx).VnetGUID = vnetGUID
 	}
 
 	// These options are set similarly to those used by operator.KubernetesInterface
@@ -137,6 +168,20 @@ func NewOperator(ctx context.Context, operator *operator.Operator) (context.Cont
 	inClusterConfig.UserAgent = auth.GetUserAgentExtension()
 	inClusterClient := kubernetes.NewForConfigOrDie(inClusterConfig)
 
+	return newOperator(ctx, operator, azConfig, env, azClient, pricing.NewAPI(env.Cloud), inClusterClient, vnetGUID)
+}
+
+func newOperator(
+	ctx context.Context,
+	operator *operator.Operator,
+	azConfig *auth.Config,
+	env *auth.Environment,
+	azClient *instance.AZClient,
+	pricingAPI client.PricingAPI,
+	inClusterClient kubernetes.Interface,
+	vnetGUID string,
+) (context.Context, *Operator) {
+
 	if options.FromContext(ctx).DNSServiceIP == "" {
 		kubeDNSIP, err := kubeDNSIP(ctx, operator.KubernetesInterface)
 		if err != nil { // fall back to default
@@ -148,41 +193,70 @@ func NewOperator(ctx context.Context, operator *operator.Operator) (context.Cont
 		}
 	}
 
-	unavailableOfferingsCache := azurecache.NewUnavailableOfferings()
+	caches := newProviderCaches(ctx)
+	unavailableOfferingsCache := caches.UnavailableOfferings
+	// the unavailable offerings are persisted next to the operator, so that it doesn't attempt to launch them all again
+	// once restarted
+	if namespace := systemNamespace(); namespace != "" {
+		lo.Must0(operator.Add(azurecache.NewUnavailableOfferingsPersister(unavailableOfferingsCache, inClusterClient, namespace)), "adding unavailable offerings persister")
+	} else {
+		log.FromContext(ctx).Info("unable to detect the namespace of the operator, not persisting unavailable offerings")
+	}
 	pricingProvider := pricing.NewProvider(
-		ctx,
 		env,
-		pricing.NewAPI(env.Cloud),
+		pricingAPI,
+		azConfig.Location,
+		options.FromContext(ctx).CacheConfig.PricingUpdatePeriod,
+	).WithZonalSpotPricing(azClient.AzureResourceGraphClient(), azConfig.SubscriptionID).WithClock(operator.Clock)
+	// the pricing is updated by the leader only, from its election until it loses its leadership
+	lo.Must0(operator.Add(pricingProvider), "adding pricing update loop")
+
+	spotPlacementScoreProvider := spotplacementscore.NewProvider(
+		azClient.SpotPlacementScoresClient,
 		azConfig.Location,
-		operator.Elected(),
+		azConfig.SubscriptionID,
+		options.FromContext(ctx).CacheConfig.SpotPlacementScoresUpdatePeriod,
 	)
+	// the spot placement scores are only requested with the Weighted strategy, to keep within the quota of the API
+	if options.FromContext(ctx).SpotPlacementScoreStrategy == consts.SpotPlacementScoreStrategyWeighted {
+		lo.Must0(operator.Add(spotPlacementScoreProvider), "adding spot placement scores update loop")
+	}
 
 	kubernetesVersionProvider := kubernetesversion.NewKubernetesVersionProvider(
 		operator.KubernetesInterface,
-		cache.New(azurecache.KubernetesVersionTTL,
-			azurecache.DefaultCleanupInterval),
+		caches.KubernetesVersion,
 	)
 	imageProvider := imagefamily.NewProvider(
 		azClient.ImageVersionsClient,
 		azConfig.Location,
 		azConfig.SubscriptionID,
 		azClient.NodeImageVersionsClient,
-		cache.New(imagefamily.ImageExpirationInterval,
-			imagefamily.ImageCacheCleaningInterval),
+		caches.Images,
 	)
 	instanceTypeProvider := instancetype.NewDefaultProvider(
 		azConfig.Location,
-		cache.New(instancetype.InstanceTypesCacheTTL, azurecache.DefaultCleanupInterval),
+		caches.InstanceTypes,
 		azClient.SKUClient,
 		pricingProvider,
 		unavailableOfferingsCache,
+		func(subscriptionID string) (skewer.ResourceClient, error) {
+			subscriptionClient, err := azClient.ForSubscription(subscriptionID)
+			if err != nil {
+				return nil, err
+			}
+			return subscriptionClient.SKUClient, nil
+		},
 	)
+	// the instance types are listed ahead of the first provisioning by the leader only, once elected
+	lo.Must0(operator.Add(newCacheWarmer(operator.GetClient(), instanceTypeProvider)), "adding instance types cache warmer")
 	imageResolver := imagefamily.NewDefaultResolver(
 		operator.GetClient(),
 		imageProvider,
 		instanceTypeProvider,
 		azClient.NodeBootstrappingClient,
 	)
+	bootstrapTokenProvider, err := bootstraptoken.NewProvider(ctx, operator.KubernetesInterface)
+	lo.Must0(err, "creating kubelet bootstrap token provider")
 	launchTemplateProvider := launchtemplate.NewProvider(
 		ctx,
 		imageResolver,
@@ -195,12 +269,13 @@ func NewOperator(ctx context.Context, operator *operator.Operator) (context.Cont
 		options.FromContext(ctx).KubeletIdentityClientID,
 		options.FromContext(ctx).NodeResourceGroup,
 		azConfig.Location,
-		options.FromContext(ctx).VnetGUID,
+		vnetGUID,
 		options.FromContext(ctx).ProvisionMode,
+		bootstrapTokenProvider,
 	)
 	loadBalancerProvider := loadbalancer.NewProvider(
 		azClient.LoadBalancersClient,
-		cache.New(loadbalancer.LoadBalancersCacheTTL, azurecache.DefaultCleanupInterval),
+		caches.LoadBalancers,
 		options.FromContext(ctx).NodeResourceGroup,
 	)
 	networkSecurityGroupProvider := networksecuritygroup.NewProvider(
@@ -216,20 +291,32 @@ func NewOperator(ctx context.Context, operator *operator.Operator) (context.Cont
 		unavailableOfferingsCache,
 		azConfig.Location,
 		options.FromContext(ctx).NodeResourceGroup,
+		options.FromContext(ctx).ClusterName,
 		azConfig.SubscriptionID,
 		options.FromContext(ctx).ProvisionMode,
 		options.FromContext(ctx).DiskEncryptionSetID,
+		instance.NewVMStateCache(instance.VMStateCacheTTL, operator.Clock),
+		instance.NewCreateLimiter(
+			options.FromContext(ctx).MaxConcurrentVMCreates,
+			options.FromContext(ctx).MaxConcurrentVMCreatesPerNodePool,
+			options.FromContext(ctx).VMCreateQueueTimeout,
+		),
+		instance.NewNetworkOperationPool(options.FromContext(ctx).MaxConcurrentNICOperations, options.FromContext(ctx).NICPollInterval),
+		spotPlacementScoreProvider,
+		operator.GetClient(),
 	)
 
 	return ctx, &Operator{
 		Operator:                     operator,
 		InClusterKubernetesInterface: inClusterClient,
 		UnavailableOfferingsCache:    unavailableOfferingsCache,
+		NodeImagesCache:              caches.Images,
 		KubernetesVersionProvider:    kubernetesVersionProvider,
 		ImageProvider:                imageProvider,
 		ImageResolver:                imageResolver,
 		LaunchTemplateProvider:       launchTemplateProvider,
 		PricingProvider:              pricingProvider,
+		SpotPlacementScoreProvider:   spotPlacementScoreProvider,
 		InstanceTypesProvider:        instanceTypeProvider,
 		VMInstanceProvider:           vmInstanceProvider,
 		LoadBalancerProvider:         loadBalancerProvider,
@@ -237,6 +324,41 @@ func NewOperator(ctx context.Context, operator *operator.Operator) (context.Cont
 	}
 }
 
+// newProviderCaches returns the caches of the providers, configured with the cache options
+func newProviderCaches(ctx context.Context) azurecache.ProviderCaches {
+	config := options.FromContext(ctx).CacheConfig
+	log.FromContext(ctx).Info("configuring provider caches",
+		"kubernetesVersionTTL", config.KubernetesVersionTTL.String(),
+		"kubernetesVersionCleanupInterval", config.KubernetesVersionCleanupInterval.String(),
+		"imagesTTL", config.ImagesTTL.String(),
+		"imagesCleanupInterval", config.ImagesCleanupInterval.String(),
+		"imageLookupFailuresTTL", config.ImageLookupFailuresTTL.String(),
+		"nodeImageVersionsTTL", config.NodeImageVersionsTTL.String(),
+		"instanceTypesTTL", config.InstanceTypesTTL.String(),
+		"instanceTypesCleanupInterval", config.InstanceTypesCleanupInterval.String(),
+		"unavailableOfferingsTTL", config.UnavailableOfferingsTTL.String(),
+		"unavailableOfferingsCleanupInterval", config.UnavailableOfferingsCleanupInterval.String(),
+		"loadBalancersTTL", config.LoadBalancersTTL.String(),
+		"loadBalancersCleanupInterval", config.LoadBalancersCleanupInterval.String(),
+		"pricingUpdatePeriod", config.PricingUpdatePeriod.String(),
+		"zonesUpdatePeriod", config.ZonesUpdatePeriod.String(),
+	)
+	return azurecache.NewProviderCaches(config)
+}
+
+// systemNamespace returns the namespace the operator runs in: SYSTEM_NAMESPACE if set, otherwise the namespace of its
+// service account, if it runs in a pod
+func systemNamespace() string {
+	if namespace := strings.TrimSpace(os.Getenv("SYSTEM_NAMESPACE")); namespace != "" {
+		return namespace
+	}
+	namespace, err := os.ReadFile(serviceAccountNamespaceFile)
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(namespace))
+}
+
 func GetAZConfig() (*auth.Config, error) {
 	cfg, err := auth.BuildAzureConfig()
 	if err != nil {
@@ -357,9 +479,11 @@ func ensureToken(cred azcore.TokenCredential, env *auth.Environment) error {
 	return nil
 }
 
-func getCredential() (azcore.TokenCredential, error) {
+func getCredential(additionallyAllowedTenants []string) (azcore.TokenCredential, error) {
 	// TODO: Don't use NewDefaultAzureCredential
-	cred, err := azidentity.NewDefaultAzureCredential(nil)
+	// tokens of other tenants are only requested for the galleries of custom image terms in other tenants, and only for
+	// the tenants allowed explicitly
+	cred, err := azidentity.NewDefaultAzureCredential(&azidentity.DefaultAzureCredentialOptions{AdditionallyAllowedTenants: additionallyAllowedTenants})
 	if err != nil {
 		return nil, err
 	}
@@ -0,0 +1,77 @@
+/*
+Portions Copyright (c) Microsoft Corporation.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package operator
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/patrickmn/go-cache"
+	karpv1 "sigs.k8s.io/karpenter/pkg/apis/v1"
+
+	"github.com/Azure/karpenter-provider-azure/pkg/operator/options"
+	"github.com/Azure/karpenter-provider-azure/pkg/test"
+)
+
+func TestProviderCachesHonorCacheConfig(t *testing.T) {
+	config := options.CacheConfig{
+		KubernetesVersionTTL:                time.Minute,
+		KubernetesVersionCleanupInterval:    time.Minute,
+		ImagesTTL:                           2 * time.Minute,
+		ImagesCleanupInterval:               time.Minute,
+		InstanceTypesTTL:                    3 * time.Minute,
+		InstanceTypesCleanupInterval:        time.Minute,
+		UnavailableOfferingsTTL:             5 * time.Minute,
+		UnavailableOfferingsCleanupInterval: time.Minute,
+		LoadBalancersTTL:                    4 * time.Minute,
+		LoadBalancersCleanupInterval:        time.Minute,
+		PricingUpdatePeriod:                 time.Hour,
+	}
+	ctx := options.ToContext(context.Background(), test.Options(test.OptionsFields{CacheConfig: &config}))
+	caches := newProviderCaches(ctx)
+
+	for name, tc := range map[string]struct {
+		cache *cache.Cache
+		ttl   time.Duration
+	}{
+		"kubernetes version": {caches.KubernetesVersion, config.KubernetesVersionTTL},
+		"images":             {caches.Images, config.ImagesTTL},
+		"instance types":     {caches.InstanceTypes, config.InstanceTypesTTL},
+		"load balancers":     {caches.LoadBalancers, config.LoadBalancersTTL},
+	} {
+		start := time.Now()
+		tc.cache.SetDefault("key", struct{}{})
+		_, expiration, ok := tc.cache.GetWithExpiration("key")
+		if !ok {
+			t.Fatalf("%s: expected the entry to be cached", name)
+		}
+		if expiration.Before(start.Add(tc.ttl)) || expiration.After(time.Now().Add(tc.ttl)) {
+			t.Errorf("%s: expected the entry to expire after %s, expires at %s", name, tc.ttl, expiration.Sub(start))
+		}
+	}
+
+	start := time.Now()
+	caches.UnavailableOfferings.MarkUnavailable(ctx, "test reason", "Standard_D2s_v3", "westus-1", karpv1.CapacityTypeSpot)
+	offerings := caches.UnavailableOfferings.List()
+	if len(offerings) != 1 {
+		t.Fatalf("unavailable offerings: expected the offering to be unavailable, got %v", offerings)
+	}
+	if expiration := offerings[0].Expiration; expiration.Before(start.Add(config.UnavailableOfferingsTTL)) || expiration.After(time.Now().Add(config.UnavailableOfferingsTTL)) {
+		t.Errorf("unavailable offerings: expected the offering to be unavailable for %s, expires at %s", config.UnavailableOfferingsTTL, expiration.Sub(start))
+	}
+}
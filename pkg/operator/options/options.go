@@ -27,7 +27,9 @@ import (
 	"net/url"
 	"os"
 	"strings"
+	"time"
 
+	"github.com/samber/lo"
 	"k8s.io/apimachinery/pkg/util/sets"
 	k8sflag "k8s.io/component-base/cli/flag"
 	coreoptions "sigs.k8s.io/karpenter/pkg/operator/options"
@@ -67,7 +69,8 @@ type Options struct {
 	ClusterEndpoint                string  `json:"clusterEndpoint,omitempty"` // => APIServerName in bootstrap, except needs to be w/o https/port
 	VMMemoryOverheadPercent        float64 `json:"vmMemoryOverheadPercent,omitempty"`
 	ClusterID                      string  `json:"clusterId,omitempty"`
-	KubeletClientTLSBootstrapToken string  `json:"-"` // => TLSBootstrapToken in bootstrap (may need to be per node/nodepool)
+	KubeletClientTLSBootstrapToken string  `json:"-"`                                     // => TLSBootstrapToken in bootstrap (may need to be per node/nodepool). Deprecated: use KubeletBootstrapTokenSecret
+	KubeletBootstrapTokenSecret    string  `json:"kubeletBootstrapTokenSecret,omitempty"` // => <namespace>/<name>/<key> of the Secret holding the TLSBootstrapToken, takes precedence over KubeletClientTLSBootstrapToken
 	LinuxAdminUsername             string  `json:"-"`
 	SSHPublicKey                   string  `json:"-"` // ssh.publicKeys.keyData => VM SSH public key // TODO: move to v1beta1.AKSNodeClass?
 
@@ -88,17 +91,105 @@ type Options struct {
 	UseSIG                     bool              `json:"useSIG,omitempty"` // => UseSIG is true if Karpenter is managed by AKS, false if it is a self-hosted karpenter installation
 	SIGAccessTokenServerURL    string            `json:"-"`                // => SIGAccessTokenServerURL used to access SIG, not set if it is a self-hosted karpenter installation
 	SIGSubscriptionID          string            `json:"sigSubscriptionId,omitempty"`
+	SIGFallbackToCIG           bool              `json:"sigFallbackToCIG,omitempty"` // => Whether the default images fall back to the community galleries when their SIG lookup fails
 	NodeResourceGroup          string            `json:"nodeResourceGroup,omitempty"`
 	AdditionalTags             map[string]string `json:"additionalTags,omitempty"`
 	EnableAzureSDKLogging      bool              `json:"enableAzureSDKLogging,omitempty"` // Controls whether Azure SDK middleware logging is enabled
 	DiskEncryptionSetID        string            `json:"diskEncryptionSetId,omitempty"`
+	EnableBootstrapDebug       bool              `json:"enableBootstrapDebug,omitempty"`     // Controls whether a redacted rendering of the bootstrap payload is annotated onto new NodeClaims
+	DemoteImageDiscoveryLogs   bool              `json:"demoteImageDiscoveryLogs,omitempty"` // => Whether the logs of newly discovered node images are at the debug level, rather than info
+	Cloud                      string            `json:"cloud,omitempty"`                    // => "fake" runs against an in-memory cloud, for local development without Azure credentials
+	VolumeDetachTimeout        time.Duration     `json:"volumeDetachTimeout,omitempty"`      // => How long VM deletion waits for data disks to be detached
+	GPUDriverReadyTimeout      time.Duration     `json:"gpuDriverReadyTimeout,omitempty"`    // => How long GPU nodes stay tainted waiting on their GPU driver before being replaced, disabled when 0
+	InstanceHealthInterval     time.Duration     `json:"instanceHealthInterval,omitempty"`   // => How often the instance views of the VMs and their NICs are evaluated for repair, disabled when 0
+
+	TagDriftInterval   time.Duration `json:"tagDriftInterval,omitempty"`   // => How often the tags of the VMs, NICs and OS disks of nodeclaims are checked for drift, disabled when 0
+	TagDriftMode       string        `json:"tagDriftMode,omitempty"`       // => "Report" only reports the drifted resources, "Repair" repairs them as well
+	TagDriftMaxRepairs int           `json:"tagDriftMaxRepairs,omitempty"` // => Resources repaired per tag drift check, the rest are left to the next one
+
+	CommunityGalleryFallbackLocations string            `json:"communityGalleryFallbackLocations,omitempty"` // => Comma separated locations whose community galleries are listed, in order, while the location of the cluster has no version of an image
+	GalleryAliases                    map[string]string `json:"galleryAliases,omitempty"`                    // => Gallery ID => ID of the gallery it moved to, whose images are the same
+	AdditionallyAllowedTenants        string            `json:"additionallyAllowedTenants,omitempty"`        // => Comma separated tenants, besides the cluster's, the credential may get tokens of for the galleries of custom images
+
+	MaxConcurrentVMCreates            int           `json:"maxConcurrentVMCreates,omitempty"`            // => VM creates in flight, unlimited when 0
+	MaxConcurrentVMCreatesPerNodePool int           `json:"maxConcurrentVMCreatesPerNodePool,omitempty"` // => VM creates in flight per nodepool, unlimited when 0
+	VMCreateQueueTimeout              time.Duration `json:"vmCreateQueueTimeout,omitempty"`              // => How long VM creates beyond the limits wait before being retried
+	MaxConcurrentNICOperations        int           `json:"maxConcurrentNICOperations,omitempty"`        // => NIC creates and deletes running at once, unlimited when 0
+	NICPollInterval                   time.Duration `json:"nicPollInterval,omitempty"`                   // => How often NIC operations are polled, the SDK default when 0
+
+	ARMRateLimitLowThreshold int  `json:"armRateLimitLowThreshold,omitempty"` // => Remaining ARM request quota of a bucket below which the budget is low
+	ARMRateLimitBackpressure bool `json:"armRateLimitBackpressure,omitempty"` // => Whether background work is slowed down while the ARM request budget is low
+
+	SpotPlacementScoreStrategy string  `json:"spotPlacementScoreStrategy,omitempty"` // => "Price" orders spot offerings by price, "Weighted" by price weighted against their spot placement scores
+	SpotPlacementScoreWeight   float64 `json:"spotPlacementScoreWeight,omitempty"`   // => How much the price of the spot offering with the lowest placement score is raised by, e.g. 0.5 for 50%
+
+	VMSeriesRetirementOverrides     map[string]string `json:"vmSeriesRetirementOverrides,omitempty"`     // => SKU family => retirement date, merged over the generated retirement table
+	VMSeriesRetirementWarningMonths int               `json:"vmSeriesRetirementWarningMonths,omitempty"` // => How long before retirement nodepools limited to a VM series are flagged
+
+	StrictDataFreshness time.Duration `json:"strictDataFreshness,omitempty"` // => Max age of the pricing and SKU data offerings are launched with, disabled when 0
+
+	CacheConfig CacheConfig `json:"cacheConfig"`
+
+	DebugServerPort int `json:"debugServerPort,omitempty"` // => Port of the localhost-only debug endpoints, disabled when 0
+
+	LeaderElectionLeaseDuration time.Duration `json:"leaderElectionLeaseDuration,omitempty"` // => How long standby replicas wait before taking over a lease that isn't renewed
+	LeaderElectionRenewDeadline time.Duration `json:"leaderElectionRenewDeadline,omitempty"` // => How long the leader retries renewing its lease before giving up its leadership
+	LeaderElectionRetryPeriod   time.Duration `json:"leaderElectionRetryPeriod,omitempty"`   // => How often the lease is acquired or renewed
+
+	OTLPTracesEndpoint string `json:"otlpTracesEndpoint,omitempty"` // => OTLP/HTTP endpoint the provisioning traces are exported to, disabled when empty
+
+	GarbageCollectionConfirmationTag string `json:"garbageCollectionConfirmationTag,omitempty"` // => <key>=<value> tag applied to new VMs, and required on VMs before garbage collecting them
+
+	NodeImageVersionsAPIVersion string `json:"nodeImageVersionsAPIVersion,omitempty"` // => api-version of the NodeImageVersions API, with a fallback when rejected
+}
+
+// CacheConfig configures the provider caches. TTLs are how long entries are cached before being fetched again, and
+// cleanup intervals how often expired entries are evicted.
+type CacheConfig struct {
+	KubernetesVersionTTL                time.Duration `json:"kubernetesVersionTTL"`
+	KubernetesVersionCleanupInterval    time.Duration `json:"kubernetesVersionCleanupInterval"`
+	ImagesTTL                           time.Duration `json:"imagesTTL"`
+	ImagesCleanupInterval               time.Duration `json:"imagesCleanupInterval"`
+	ImageLookupFailuresTTL              time.Duration `json:"imageLookupFailuresTTL"` // => Failed image lookups are returned again until retried, disabled when 0
+	NodeImageVersionsTTL                time.Duration `json:"nodeImageVersionsTTL"`   // => The node image versions listed by the NodeImageVersions API, disabled when 0
+	InstanceTypesTTL                    time.Duration `json:"instanceTypesTTL"`       // => SKUs and the instance types computed from them
+	InstanceTypesCleanupInterval        time.Duration `json:"instanceTypesCleanupInterval"`
+	UnavailableOfferingsTTL             time.Duration `json:"unavailableOfferingsTTL"` // => Default time offerings are excluded after a capacity error, some errors use their own
+	UnavailableOfferingsCleanupInterval time.Duration `json:"unavailableOfferingsCleanupInterval"`
+	LoadBalancersTTL                    time.Duration `json:"loadBalancersTTL"`
+	LoadBalancersCleanupInterval        time.Duration `json:"loadBalancersCleanupInterval"`
+	PricingUpdatePeriod                 time.Duration `json:"pricingUpdatePeriod"`             // => Pricing is refreshed in the background rather than expired
+	SpotPlacementScoresUpdatePeriod     time.Duration `json:"spotPlacementScoresUpdatePeriod"` // => Spot placement scores are refreshed in the background too
+	ZonesUpdatePeriod                   time.Duration `json:"zonesUpdatePeriod"`               // => SKUs are refetched ahead of their TTL to discover new zones, disabled when 0
+}
+
+// DefaultCacheConfig returns the default cache configuration
+func DefaultCacheConfig() CacheConfig {
+	return CacheConfig{
+		KubernetesVersionTTL:                15 * time.Minute,
+		KubernetesVersionCleanupInterval:    time.Minute,
+		ImagesTTL:                           3 * 24 * time.Hour,
+		ImagesCleanupInterval:               time.Hour,
+		ImageLookupFailuresTTL:              30 * time.Second,
+		NodeImageVersionsTTL:                30 * time.Minute,
+		InstanceTypesTTL:                    23 * time.Hour,
+		InstanceTypesCleanupInterval:        time.Minute,
+		UnavailableOfferingsTTL:             3 * time.Minute,
+		UnavailableOfferingsCleanupInterval: 10 * time.Second, // low for quicker reactivity to offerings becoming available
+		LoadBalancersTTL:                    2 * time.Hour,
+		LoadBalancersCleanupInterval:        time.Minute,
+		PricingUpdatePeriod:                 12 * time.Hour,
+		SpotPlacementScoresUpdatePeriod:     30 * time.Minute,
+		ZonesUpdatePeriod:                   time.Hour,
+	}
 }
 
 func (o *Options) AddFlags(fs *coreoptions.FlagSet) {
 	fs.StringVar(&o.ClusterName, "cluster-name", env.WithDefaultString("CLUSTER_NAME", ""), "[REQUIRED] The kubernetes cluster name for resource tags.")
 	fs.StringVar(&o.ClusterEndpoint, "cluster-endpoint", env.WithDefaultString("CLUSTER_ENDPOINT", ""), "[REQUIRED] The external kubernetes cluster endpoint for new nodes to connect with.")
 	fs.Float64Var(&o.VMMemoryOverheadPercent, "vm-memory-overhead-percent", utils.WithDefaultFloat64("VM_MEMORY_OVERHEAD_PERCENT", 0.075), "The VM memory overhead as a percent that will be subtracted from the total memory for all instance types.")
-	fs.StringVar(&o.KubeletClientTLSBootstrapToken, "kubelet-bootstrap-token", env.WithDefaultString("KUBELET_BOOTSTRAP_TOKEN", ""), "[REQUIRED] The bootstrap token for new nodes to join the cluster.")
+	fs.StringVar(&o.KubeletClientTLSBootstrapToken, "kubelet-bootstrap-token", env.WithDefaultString("KUBELET_BOOTSTRAP_TOKEN", ""), "[DEPRECATED] The bootstrap token for new nodes to join the cluster. Use kubelet-bootstrap-token-secret instead. One of kubelet-bootstrap-token or kubelet-bootstrap-token-secret is required.")
+	fs.StringVar(&o.KubeletBootstrapTokenSecret, "kubelet-bootstrap-token-secret", env.WithDefaultString("KUBELET_BOOTSTRAP_TOKEN_SECRET", ""), "Reference to the Secret holding the bootstrap token for new nodes to join the cluster, in the format <namespace>/<name>/<key>. The Secret is watched, so token rotations are picked up without restarting. Takes precedence over kubelet-bootstrap-token.")
 	fs.StringVar(&o.LinuxAdminUsername, "linux-admin-username", env.WithDefaultString("LINUX_ADMIN_USERNAME", "azureuser"), "The admin username for Linux VMs.")
 	fs.StringVar(&o.SSHPublicKey, "ssh-public-key", env.WithDefaultString("SSH_PUBLIC_KEY", ""), "[REQUIRED] VM SSH public key.")
 	fs.StringVar(&o.NetworkPlugin, "network-plugin", env.WithDefaultString("NETWORK_PLUGIN", consts.NetworkPluginAzure), "The network plugin used by the cluster.")
@@ -116,6 +207,9 @@ func (o *Options) AddFlags(fs *coreoptions.FlagSet) {
 	fs.BoolVar(&o.UseSIG, "use-sig", env.WithDefaultBool("USE_SIG", false), "If set to true karpenter will use the AKS managed shared image galleries and the node image versions api. If set to false karpenter will use community image galleries. Only a subset of image features will be available in the community image galleries and this flag is only for the managed node provisioning addon.")
 	fs.StringVar(&o.SIGAccessTokenServerURL, "sig-access-token-server-url", env.WithDefaultString("SIG_ACCESS_TOKEN_SERVER_URL", ""), "The URL for the SIG access token server. Only used for AKS managed karpenter. UseSIG must be set tot true for this to take effect.")
 	fs.StringVar(&o.SIGSubscriptionID, "sig-subscription-id", env.WithDefaultString("SIG_SUBSCRIPTION_ID", ""), "The subscription ID of the shared image gallery.")
+	fs.BoolVar(&o.SIGFallbackToCIG, "sig-fallback-to-cig", env.WithDefaultBool("SIG_FALLBACK_TO_CIG", false), "If set to true, the default images are looked up in the community image galleries when their lookup through the node image versions api fails, e.g. during an outage of the node image versions service, so that it doesn't block scale-up. FIPS images have no community gallery images to fall back to. UseSIG must be set to true for this to take effect.")
+	fs.StringVar(&o.CommunityGalleryFallbackLocations, "community-gallery-fallback-locations", env.WithDefaultString("COMMUNITY_GALLERY_FALLBACK_LOCATIONS", ""), "Comma separated locations, e.g. a paired region, whose community image galleries are listed in order when the community gallery has no version of an image in the location of the cluster yet, e.g. while a new version is still being replicated to a small region. The location of the cluster is always listed first, so that its versions are used again once they are published there. Not used for pinned image versions.")
+	fs.StringVar(&o.AdditionallyAllowedTenants, "additionally-allowed-tenants", env.WithDefaultString("ADDITIONALLY_ALLOWED_TENANTS", ""), "Comma separated IDs of the Microsoft Entra tenants, besides the tenant of the cluster, that the credential of the controller may get tokens of. Custom image terms referencing galleries in other tenants (tenantID) only work for the tenants listed here.")
 	fs.StringVar(&o.DiskEncryptionSetID, "node-osdisk-diskencryptionset-id", env.WithDefaultString("NODE_OSDISK_DISKENCRYPTIONSET_ID", ""), "The ARM resource ID of the disk encryption set to use for customer-managed key (BYOK) encryption.")
 
 	additionalTagsFlag := k8sflag.NewMapStringString(&o.AdditionalTags)
@@ -124,9 +218,112 @@ func (o *Options) AddFlags(fs *coreoptions.FlagSet) {
 	}
 	// See https://github.com/Azure/karpenter-provider-azure/issues/1042 for issue discussing improvements around this
 	fs.Var(additionalTagsFlag, "additional-tags", "Additional tags to apply to the resources in Azure. Format is key1=value1,key2=value2. These tags will be merged with the tags specified on the NodePool. In the case of a tag collision, the NodePool tag wins. These tags only apply to new nodes and do not trigger drift, which means that adding tags to this collection will not update existing nodes until drift triggers for some other reason.")
+	fs.BoolVar(&o.EnableBootstrapDebug, "enable-bootstrap-debug", env.WithDefaultBool("ENABLE_BOOTSTRAP_DEBUG", false), "If set to true, a redacted rendering of the bootstrap customData (and CSE, in bootstrappingclient provision mode) is added as an annotation on new NodeClaims for debugging. Tokens and secrets are masked, but the payload may still contain cluster details, so this is off by default.")
+	fs.BoolVar(&o.DemoteImageDiscoveryLogs, "demote-image-discovery-logs", env.WithDefaultBool("DEMOTE_IMAGE_DISCOVERY_LOGS", false), "If set to true, the logs of newly discovered node images are at the debug level rather than info. They are only logged when the image discovered for an image definition changes.")
+	fs.StringVar(&o.Cloud, "cloud", env.WithDefaultString("CLOUD", consts.CloudAzure), "[UNSUPPORTED] The cloud to provision nodes in. Set to 'fake' to run against an in-memory cloud for local development, without Azure credentials.")
+	fs.DurationVar(&o.VolumeDetachTimeout, "volume-detach-timeout", env.WithDefaultDuration("VOLUME_DETACH_TIMEOUT", 2*time.Minute), "How long to wait, on termination, for the data disks of a VM to be detached before deleting it regardless. Deleting a VM with disks still attached can leave them attached to the deleted VM for several minutes, blocking their attachment to other nodes. Set to 0 to delete VMs without waiting.")
+	fs.DurationVar(&o.GPUDriverReadyTimeout, "gpu-driver-ready-timeout", env.WithDefaultDuration("GPU_DRIVER_READY_TIMEOUT", 0), "How long GPU nodes wait for their NVIDIA driver to be ready before being considered failed and replaced. GPU nodes register with the karpenter.azure.com/gpu-initializing:NoSchedule startup taint, which is removed once the node verifies its driver and device plugin prerequisites, so that GPU workloads aren't scheduled before. Only applies to the aksscriptless provision mode. Set to 0 to disable, registering GPU nodes without the taint.")
+	fs.DurationVar(&o.InstanceHealthInterval, "instance-health-interval", env.WithDefaultDuration("INSTANCE_HEALTH_INTERVAL", 0), "How often the health of the VMs of nodes is evaluated from their instance view, i.e. whether their VM agent is ready and their provisioning didn't fail, and from the provisioning state of their NICs. Nodes with failures on the Azure side get the InstanceHealthy condition set to False, and are replaced by node repair once it's been False for 10 minutes. Each evaluation reads the instance view of every VM, one uncached request per node, so it's disabled by default (0).")
+	fs.DurationVar(&o.TagDriftInterval, "tag-drift-interval", env.WithDefaultDuration("TAG_DRIFT_INTERVAL", 0), "How often the tags of the VMs, NICs and OS disks of nodeclaims are compared with the tags Karpenter sets on them, i.e. the additional-tags, the tags of their AKSNodeClass and the Karpenter identity tags, to find the ones that manual edits or policy remediations changed or removed. Tags that Karpenter doesn't set are left as is. Each check reads every VM, NIC and OS disk. Set to 0 to disable.")
+	fs.StringVar(&o.TagDriftMode, "tag-drift-mode", env.WithDefaultString("TAG_DRIFT_MODE", consts.TagDriftModeReport), "What tag drift checks do with the resources whose tags drifted. 'Report' logs them and reports them in the karpenter_tag_drift_drifted_resources metric. 'Repair' patches their tags in place as well, reported in the karpenter_tag_drift_repaired_resources metric.")
+	fs.IntVar(&o.TagDriftMaxRepairs, "tag-drift-max-repairs", env.WithDefaultInt("TAG_DRIFT_MAX_REPAIRS", 20), "The maximum number of resources repaired by a tag drift check, to stay within the ARM write budget. The rest are repaired by the next checks. Repairs also stop while the ARM request budget is low. Only used with the 'Repair' tag drift mode.")
+	fs.IntVar(&o.MaxConcurrentVMCreates, "max-concurrent-vm-creates", env.WithDefaultInt("MAX_CONCURRENT_VM_CREATES", 0), "The maximum number of VM creates in flight, from their start until the VM is provisioned. Creates beyond it are queued, taking turns across nodepools, and retried if they time out waiting. Set to 0 for no limit.")
+	fs.IntVar(&o.MaxConcurrentVMCreatesPerNodePool, "max-concurrent-vm-creates-per-nodepool", env.WithDefaultInt("MAX_CONCURRENT_VM_CREATES_PER_NODEPOOL", 0), "The maximum number of VM creates in flight per nodepool. Creates beyond it are queued, and retried if they time out waiting. Set to 0 for no limit.")
+	fs.DurationVar(&o.VMCreateQueueTimeout, "vm-create-queue-timeout", env.WithDefaultDuration("VM_CREATE_QUEUE_TIMEOUT", time.Minute), "How long VM creates beyond the limits of VM creates in flight wait to start. Creates timing out are retried with a backoff rather than failed.")
+	fs.IntVar(&o.MaxConcurrentNICOperations, "max-concurrent-nic-operations", env.WithDefaultInt("MAX_CONCURRENT_NIC_OPERATIONS", 50), "The maximum number of NIC creates and deletes running at once, from their start until their completion. Operations beyond it wait for others to complete, without polling ARM. Set to 0 for no limit.")
+	fs.DurationVar(&o.NICPollInterval, "nic-poll-interval", env.WithDefaultDuration("NIC_POLL_INTERVAL", 0), "How often NIC creates and deletes are polled for their completion when ARM doesn't ask to be polled later. NIC operations complete within seconds, so polling more often than the SDK default of 30s shortens launches, at the cost of more GETs. Set to 0 for the SDK default.")
+	fs.IntVar(&o.ARMRateLimitLowThreshold, "arm-rate-limit-low-threshold", env.WithDefaultInt("ARM_RATE_LIMIT_LOW_THRESHOLD", 50), "The remaining ARM request quota of a rate limit bucket, from the x-ms-ratelimit-remaining-* response headers, below which a warning is logged and the request budget is considered low. Set to 0 to disable.")
+	fs.StringVar(&o.SpotPlacementScoreStrategy, "spot-placement-score-strategy", env.WithDefaultString("SPOT_PLACEMENT_SCORE_STRATEGY", consts.SpotPlacementScoreStrategyPrice), "How spot offerings are ordered for launch. 'Price' orders them by price. 'Weighted' scores the instance types considered for spot launches with the Spot Placement Scores API, and orders spot offerings by their price weighted against their placement score, launching in the best scored zones. Offerings without a score, e.g. where the API is unavailable, are ordered by price.")
+	fs.Float64Var(&o.SpotPlacementScoreWeight, "spot-placement-score-weight", utils.WithDefaultFloat64("SPOT_PLACEMENT_SCORE_WEIGHT", 0.5), "How much spot placement scores weigh against prices with the 'Weighted' spot placement score strategy. The price of a spot offering is raised by up to this fraction for the lowest score, e.g. 0.5 orders a spot offering with a Low score as if it were 50% more expensive than with a High score.")
+	fs.BoolVar(&o.ARMRateLimitBackpressure, "arm-rate-limit-backpressure", env.WithDefaultBool("ARM_RATE_LIMIT_BACKPRESSURE", false), "If set to true, non-urgent background work, such as garbage collection and image refreshes, runs less often while the ARM request budget is low. Provisioning always runs at full speed.")
+
+	seriesRetirementOverridesFlag := k8sflag.NewMapStringString(&o.VMSeriesRetirementOverrides)
+	if err := seriesRetirementOverridesFlag.Set(env.WithDefaultString("VM_SERIES_RETIREMENT_OVERRIDES", "")); err != nil {
+		panic(fmt.Sprintf("failed to parse VM_SERIES_RETIREMENT_OVERRIDES from string %q: %s", env.WithDefaultString("VM_SERIES_RETIREMENT_OVERRIDES", ""), err))
+	}
+	fs.Var(seriesRetirementOverridesFlag, "vm-series-retirement-overrides", "Retirement dates of VM series, overriding the built-in retirement table. Format is family1=YYYY-MM-DD,family2=YYYY-MM-DD, where families are SKU families such as standardNCSv3Family. Instance types of retired series are excluded; a date far in the future re-enables a series, e.g. one with extended support.")
+	fs.IntVar(&o.VMSeriesRetirementWarningMonths, "vm-series-retirement-warning-months", env.WithDefaultInt("VM_SERIES_RETIREMENT_WARNING_MONTHS", 6), "How many months before the retirement of a VM series to warn about nodepools whose requirements can only be satisfied by instance types of retiring series. Set to 0 to disable the warning.")
+	fs.DurationVar(&o.StrictDataFreshness, "strict-data-freshness", env.WithDefaultDuration("STRICT_DATA_FRESHNESS", 0), "The maximum age of the pricing and SKU data offerings are launched with. Offerings whose price, or the SKUs of their subscription, weren't refreshed within it are unavailable until refreshed, so that no instance is launched at an unknown price: pods stay pending instead. AKSNodeClasses affected get the DataStale condition. Pricing is only refreshed in the public cloud, where it must be longer than cache-pricing-update-period. Set to 0 to disable.")
+	galleryAliasesFlag := k8sflag.NewMapStringString(&o.GalleryAliases)
+	if err := galleryAliasesFlag.Set(env.WithDefaultString("GALLERY_ALIASES", "")); err != nil {
+		panic(fmt.Sprintf("failed to parse GALLERY_ALIASES from string %q: %s", env.WithDefaultString("GALLERY_ALIASES", ""), err))
+	}
+	fs.Var(galleryAliasesFlag, "gallery-aliases", "Galleries of custom images that moved, e.g. to another subscription, with the same image definitions and versions. Format is old1=new1,old2=new2, where each is the ARM resource ID of a gallery, /subscriptions/<subscription>/resourceGroups/<resourceGroup>/providers/Microsoft.Compute/galleries/<gallery>. The customImageTerms of AKSNodeClasses referencing an old gallery launch nodes with the images of the new gallery, and the nodes running images of either gallery don't drift for it, so that galleries are migrated without replacing every node at once.")
+	o.CacheConfig.AddFlags(fs)
+	fs.StringVar(&o.GarbageCollectionConfirmationTag, "garbage-collection-confirmation-tag", env.WithDefaultString("GARBAGE_COLLECTION_CONFIRMATION_TAG", ""), "An extra tag, in the format key=value, applied to the VMs and other resources Karpenter creates, and required on VMs before they are garbage collected, in addition to the cluster and nodepool tags and a VM name Karpenter generates. Guards against deleting VMs that other automation copied the Karpenter tags onto. VMs created before it's set don't have it, and are left for manual cleanup.")
+	fs.IntVar(&o.DebugServerPort, "debug-server-port", env.WithDefaultInt("DEBUG_SERVER_PORT", 0), "The port of the read-only debug endpoints, which dump the provider caches, unavailable offerings, the instance types of a nodepool and pricing staleness as JSON. The endpoints only listen on localhost, e.g. for use with kubectl port-forward. Set to 0 to disable them.")
+	fs.DurationVar(&o.LeaderElectionLeaseDuration, "leader-election-lease-duration", env.WithDefaultDuration("LEADER_ELECTION_LEASE_DURATION", 15*time.Second), "How long standby replicas wait, after the leader last renewed its lease, before acquiring it and taking over. Longer durations tolerate slower API servers, at the cost of a longer failover. Must be longer than leader-election-renew-deadline.")
+	fs.DurationVar(&o.LeaderElectionRenewDeadline, "leader-election-renew-deadline", env.WithDefaultDuration("LEADER_ELECTION_RENEW_DEADLINE", 10*time.Second), "How long the leader retries renewing its lease before giving up its leadership, stopping its controllers and the background refreshes of its caches. Must be longer than 1.2 times leader-election-retry-period.")
+	fs.DurationVar(&o.LeaderElectionRetryPeriod, "leader-election-retry-period", env.WithDefaultDuration("LEADER_ELECTION_RETRY_PERIOD", 2*time.Second), "How often replicas try to acquire the lease, and the leader to renew it.")
+	fs.StringVar(&o.OTLPTracesEndpoint, "otlp-traces-endpoint", env.WithDefaultString("OTLP_TRACES_ENDPOINT", ""), "The URL of an OTLP/HTTP endpoint, e.g. http://otel-collector:4318/v1/traces, the OpenTelemetry traces of the provisioning of NodeClaims are exported to. Each NodeClaim launch is traced from image resolution through the NIC and VM creates to the completion of the CSE, with the request IDs of the ARM requests recorded on their spans. The standard OTEL_EXPORTER_OTLP_* environment variables, e.g. for headers, apply. Leave empty to disable tracing.")
+	fs.StringVar(&o.NodeImageVersionsAPIVersion, "node-image-versions-api-version", env.WithDefaultString("NODE_IMAGE_VERSIONS_API_VERSION", consts.NodeImageVersionsAPIVersion), "The api-version of the NodeImageVersions API, used to resolve the images of the AKS managed shared image galleries. When it is rejected as invalid, e.g. in clouds that lag behind, the older api-version "+consts.NodeImageVersionsFallbackAPIVersion+" is used instead.")
 	fs.BoolVar(&o.EnableAzureSDKLogging, "enable-azure-sdk-logging", env.WithDefaultBool("ENABLE_AZURE_SDK_LOGGING", true), "If set to false then Azure SDK middleware logging is disabled for debugging, and won't be logging all HTTP requests/responses to Azure APIs.")
 }
 
+func (c *CacheConfig) AddFlags(fs *coreoptions.FlagSet) {
+	defaults := DefaultCacheConfig()
+	fs.DurationVar(&c.KubernetesVersionTTL, "cache-kubernetes-version-ttl", env.WithDefaultDuration("CACHE_KUBERNETES_VERSION_TTL", defaults.KubernetesVersionTTL), "How long the detected Kubernetes version of the cluster is cached, and so how quickly upgrades are noticed.")
+	fs.DurationVar(&c.KubernetesVersionCleanupInterval, "cache-kubernetes-version-cleanup-interval", env.WithDefaultDuration("CACHE_KUBERNETES_VERSION_CLEANUP_INTERVAL", defaults.KubernetesVersionCleanupInterval), "How often the expired Kubernetes version is evicted from its cache.")
+	fs.DurationVar(&c.ImagesTTL, "cache-images-ttl", env.WithDefaultDuration("CACHE_IMAGES_TTL", defaults.ImagesTTL), "How long the node image versions are cached, and so how quickly new images are picked up.")
+	fs.DurationVar(&c.ImagesCleanupInterval, "cache-images-cleanup-interval", env.WithDefaultDuration("CACHE_IMAGES_CLEANUP_INTERVAL", defaults.ImagesCleanupInterval), "How often expired node image versions are evicted from their cache.")
+	fs.DurationVar(&c.ImageLookupFailuresTTL, "cache-image-lookup-failures-ttl", env.WithDefaultDuration("CACHE_IMAGE_LOOKUP_FAILURES_TTL", defaults.ImageLookupFailuresTTL), "How long failed lookups of the node image versions are cached, and returned again rather than retried, e.g. while the gallery throttles the lookups. Lookups failing again are cached exponentially longer, up to 5 minutes. Set to 0 to disable.")
+	fs.DurationVar(&c.NodeImageVersionsTTL, "cache-node-image-versions-ttl", env.WithDefaultDuration("CACHE_NODE_IMAGE_VERSIONS_TTL", defaults.NodeImageVersionsTTL), "How long the node image versions listed by the node image versions api are cached, and shared by the lookups of the images of all image families and AKSNodeClasses meanwhile. Refreshing the images of an AKSNodeClass lists them again. Only used when use-sig is set. Set to 0 to disable.")
+	fs.DurationVar(&c.InstanceTypesTTL, "cache-instance-types-ttl", env.WithDefaultDuration("CACHE_INSTANCE_TYPES_TTL", defaults.InstanceTypesTTL), "How long the SKUs of the region, and the instance types computed from them, are cached.")
+	fs.DurationVar(&c.InstanceTypesCleanupInterval, "cache-instance-types-cleanup-interval", env.WithDefaultDuration("CACHE_INSTANCE_TYPES_CLEANUP_INTERVAL", defaults.InstanceTypesCleanupInterval), "How often expired instance types are evicted from their cache.")
+	fs.DurationVar(&c.UnavailableOfferingsTTL, "cache-unavailable-offerings-ttl", env.WithDefaultDuration("CACHE_UNAVAILABLE_OFFERINGS_TTL", defaults.UnavailableOfferingsTTL), "How long offerings are excluded after an insufficient capacity error. Errors known to last longer, e.g. quota or SKU restrictions, use their own TTLs.")
+	fs.DurationVar(&c.UnavailableOfferingsCleanupInterval, "cache-unavailable-offerings-cleanup-interval", env.WithDefaultDuration("CACHE_UNAVAILABLE_OFFERINGS_CLEANUP_INTERVAL", defaults.UnavailableOfferingsCleanupInterval), "How often expired unavailable offerings are evicted, and so become available to launch again.")
+	fs.DurationVar(&c.LoadBalancersTTL, "cache-load-balancers-ttl", env.WithDefaultDuration("CACHE_LOAD_BALANCERS_TTL", defaults.LoadBalancersTTL), "How long the load balancers of the node resource group are cached, and so how quickly new ones are added to new VMs.")
+	fs.DurationVar(&c.LoadBalancersCleanupInterval, "cache-load-balancers-cleanup-interval", env.WithDefaultDuration("CACHE_LOAD_BALANCERS_CLEANUP_INTERVAL", defaults.LoadBalancersCleanupInterval), "How often expired load balancers are evicted from their cache.")
+	fs.DurationVar(&c.PricingUpdatePeriod, "cache-pricing-update-period", env.WithDefaultDuration("CACHE_PRICING_UPDATE_PERIOD", defaults.PricingUpdatePeriod), "How often pricing is refreshed from the Azure retail prices API.")
+	fs.DurationVar(&c.SpotPlacementScoresUpdatePeriod, "cache-spot-placement-scores-update-period", env.WithDefaultDuration("CACHE_SPOT_PLACEMENT_SCORES_UPDATE_PERIOD", defaults.SpotPlacementScoresUpdatePeriod), "How often the spot placement scores of the instance types considered for spot launches are refreshed, with the 'Weighted' spot placement score strategy.")
+	fs.DurationVar(&c.ZonesUpdatePeriod, "cache-zones-update-period", env.WithDefaultDuration("CACHE_ZONES_UPDATE_PERIOD", defaults.ZonesUpdatePeriod), "How often the SKUs of the region are fetched again ahead of cache-instance-types-ttl, so that the zones added to the region are offered without a restart. Set to 0 to disable.")
+}
+
+// SecretKeyRef identifies a key within a Secret
+type SecretKeyRef struct {
+	Namespace string
+	Name      string
+	Key       string
+}
+
+// GetKubeletBootstrapTokenSecretRef parses the kubelet-bootstrap-token-secret option
+func (o *Options) GetKubeletBootstrapTokenSecretRef() (SecretKeyRef, error) {
+	parts := strings.Split(o.KubeletBootstrapTokenSecret, "/")
+	if len(parts) != 3 || lo.Contains(parts, "") {
+		return SecretKeyRef{}, fmt.Errorf("kubelet-bootstrap-token-secret is invalid: expected format <namespace>/<name>/<key>, got %q", o.KubeletBootstrapTokenSecret)
+	}
+	return SecretKeyRef{Namespace: parts[0], Name: parts[1], Key: parts[2]}, nil
+}
+
+// GetCommunityGalleryFallbackLocations parses the community-gallery-fallback-locations option into its locations
+func (o *Options) GetCommunityGalleryFallbackLocations() []string {
+	if o.CommunityGalleryFallbackLocations == "" {
+		return nil
+	}
+	return lo.Map(strings.Split(o.CommunityGalleryFallbackLocations, ","), func(location string, _ int) string {
+		return strings.ToLower(strings.TrimSpace(location))
+	})
+}
+
+// GetAdditionallyAllowedTenants parses the additionally-allowed-tenants option into its tenant IDs
+func (o *Options) GetAdditionallyAllowedTenants() []string {
+	if o.AdditionallyAllowedTenants == "" {
+		return nil
+	}
+	return lo.Map(strings.Split(o.AdditionallyAllowedTenants, ","), func(tenantID string, _ int) string {
+		return strings.TrimSpace(tenantID)
+	})
+}
+
+// GetGarbageCollectionConfirmationTag parses the garbage-collection-confirmation-tag option into its key and value
+func (o *Options) GetGarbageCollectionConfirmationTag() (string, string, error) {
+	key, value, ok := strings.Cut(o.GarbageCollectionConfirmationTag, "=")
+	if !ok || key == "" || value == "" {
+		return "", "", fmt.Errorf("garbage-collection-confirmation-tag is invalid: expected format <key>=<value>, got %q", o.GarbageCollectionConfirmationTag)
+	}
+	return key, value, nil
+}
+
 func (o *Options) GetAPIServerName() string {
 	endpoint, _ := url.Parse(o.ClusterEndpoint) // assume to already validated
 	return endpoint.Hostname()
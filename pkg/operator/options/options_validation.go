@@ -22,7 +22,9 @@ import (
 	"net/url"
 	"regexp"
 	"strings"
+	"time"
 
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/arm"
 	"github.com/go-playground/validator/v10"
 	"github.com/google/uuid"
 	"go.uber.org/multierr"
@@ -46,6 +48,26 @@ func (o *Options) Validate() error {
 		o.validateAdditionalTags(),
 		o.validateDiskEncryptionSetID(),
 		o.validateClusterDNSIP(),
+		o.validateKubeletBootstrapTokenSecret(),
+		o.validateCloud(),
+		o.validateVolumeDetachTimeout(),
+		o.validateGPUDriverReadyTimeout(),
+		o.validateInstanceHealthInterval(),
+		o.validateTagDrift(),
+		o.validateVMCreateLimits(),
+		o.validateARMRateLimitLowThreshold(),
+		o.validateSpotPlacementScores(),
+		o.validateVMSeriesRetirement(),
+		o.validateStrictDataFreshness(),
+		o.validateCacheConfig(),
+		o.validateDebugServerPort(),
+		o.validateLeaderElection(),
+		o.validateOTLPTracesEndpoint(),
+		o.validateNodeImageVersionsAPIVersion(),
+		o.validateGarbageCollectionConfirmationTag(),
+		o.validateCommunityGalleryFallbackLocations(),
+		o.validateGalleryAliases(),
+		o.validateAdditionallyAllowedTenants(),
 		validate.Struct(o),
 	)
 }
@@ -59,6 +81,14 @@ func (o *Options) validateClusterDNSIP() error {
 	return nil
 }
 
+func (o *Options) validateKubeletBootstrapTokenSecret() error {
+	if o.KubeletBootstrapTokenSecret == "" {
+		return nil
+	}
+	_, err := o.GetKubeletBootstrapTokenSecretRef()
+	return err
+}
+
 func (o *Options) validateVNETGUID() error {
 	if o.VnetGUID != "" && uuid.Validate(o.VnetGUID) != nil {
 		return fmt.Errorf("vnet-guid %s is malformed", o.VnetGUID)
@@ -120,6 +150,199 @@ func (o *Options) validateProvisionMode() error {
 	return nil
 }
 
+func (o *Options) validateCloud() error {
+	if o.Cloud != consts.CloudAzure && o.Cloud != consts.CloudFake {
+		return fmt.Errorf("cloud %s is invalid. cloud must equal 'azure' or 'fake'", o.Cloud)
+	}
+	return nil
+}
+
+func (o *Options) validateVolumeDetachTimeout() error {
+	if o.VolumeDetachTimeout < 0 {
+		return fmt.Errorf("volume-detach-timeout %s is invalid. volume-detach-timeout must not be negative", o.VolumeDetachTimeout)
+	}
+	return nil
+}
+
+func (o *Options) validateGPUDriverReadyTimeout() error {
+	if o.GPUDriverReadyTimeout < 0 {
+		return fmt.Errorf("gpu-driver-ready-timeout %s is invalid. gpu-driver-ready-timeout must not be negative", o.GPUDriverReadyTimeout)
+	}
+	return nil
+}
+
+func (o *Options) validateInstanceHealthInterval() error {
+	if o.InstanceHealthInterval < 0 {
+		return fmt.Errorf("instance-health-interval %s is invalid. instance-health-interval must not be negative", o.InstanceHealthInterval)
+	}
+	return nil
+}
+
+func (o *Options) validateTagDrift() error {
+	if o.TagDriftInterval < 0 {
+		return fmt.Errorf("tag-drift-interval %s is invalid. tag-drift-interval must not be negative", o.TagDriftInterval)
+	}
+	if o.TagDriftMode != consts.TagDriftModeReport && o.TagDriftMode != consts.TagDriftModeRepair {
+		return fmt.Errorf("tag-drift-mode %s is invalid. tag-drift-mode must equal '%s' or '%s'", o.TagDriftMode, consts.TagDriftModeReport, consts.TagDriftModeRepair)
+	}
+	if o.TagDriftMaxRepairs < 0 {
+		return fmt.Errorf("tag-drift-max-repairs %d is invalid. tag-drift-max-repairs must not be negative", o.TagDriftMaxRepairs)
+	}
+	return nil
+}
+
+func (o *Options) validateVMCreateLimits() error {
+	if o.MaxConcurrentVMCreates < 0 {
+		return fmt.Errorf("max-concurrent-vm-creates %d is invalid. max-concurrent-vm-creates must not be negative", o.MaxConcurrentVMCreates)
+	}
+	if o.MaxConcurrentVMCreatesPerNodePool < 0 {
+		return fmt.Errorf("max-concurrent-vm-creates-per-nodepool %d is invalid. max-concurrent-vm-creates-per-nodepool must not be negative", o.MaxConcurrentVMCreatesPerNodePool)
+	}
+	if o.VMCreateQueueTimeout <= 0 {
+		return fmt.Errorf("vm-create-queue-timeout %s is invalid. vm-create-queue-timeout must be positive", o.VMCreateQueueTimeout)
+	}
+	if o.MaxConcurrentNICOperations < 0 {
+		return fmt.Errorf("max-concurrent-nic-operations %d is invalid. max-concurrent-nic-operations must not be negative", o.MaxConcurrentNICOperations)
+	}
+	if o.NICPollInterval < 0 {
+		return fmt.Errorf("nic-poll-interval %s is invalid. nic-poll-interval must not be negative", o.NICPollInterval)
+	}
+	return nil
+}
+
+func (o *Options) validateARMRateLimitLowThreshold() error {
+	if o.ARMRateLimitLowThreshold < 0 {
+		return fmt.Errorf("arm-rate-limit-low-threshold %d is invalid. arm-rate-limit-low-threshold must not be negative", o.ARMRateLimitLowThreshold)
+	}
+	return nil
+}
+
+func (o *Options) validateSpotPlacementScores() error {
+	if o.SpotPlacementScoreStrategy != consts.SpotPlacementScoreStrategyPrice && o.SpotPlacementScoreStrategy != consts.SpotPlacementScoreStrategyWeighted {
+		return fmt.Errorf("spot-placement-score-strategy %s is invalid. spot-placement-score-strategy must equal '%s' or '%s'", o.SpotPlacementScoreStrategy, consts.SpotPlacementScoreStrategyPrice, consts.SpotPlacementScoreStrategyWeighted)
+	}
+	if o.SpotPlacementScoreWeight < 0 {
+		return fmt.Errorf("spot-placement-score-weight %v is invalid. spot-placement-score-weight must not be negative", o.SpotPlacementScoreWeight)
+	}
+	return nil
+}
+
+func (o *Options) validateVMSeriesRetirement() error {
+	if o.VMSeriesRetirementWarningMonths < 0 {
+		return fmt.Errorf("vm-series-retirement-warning-months %d is invalid. vm-series-retirement-warning-months must not be negative", o.VMSeriesRetirementWarningMonths)
+	}
+	for family, date := range o.VMSeriesRetirementOverrides {
+		if _, err := time.Parse(time.DateOnly, date); err != nil {
+			return fmt.Errorf("vm-series-retirement-overrides is invalid: retirement date %q of %s must be formatted as YYYY-MM-DD", date, family)
+		}
+	}
+	return nil
+}
+
+func (o *Options) validateStrictDataFreshness() error {
+	if o.StrictDataFreshness < 0 {
+		return fmt.Errorf("strict-data-freshness %s is invalid. strict-data-freshness must not be negative", o.StrictDataFreshness)
+	}
+	// pricing older than the update period is expected between its updates, which would pause provisioning every time
+	if o.StrictDataFreshness > 0 && o.StrictDataFreshness <= o.CacheConfig.PricingUpdatePeriod {
+		return fmt.Errorf("strict-data-freshness %s is invalid. strict-data-freshness must be longer than cache-pricing-update-period %s", o.StrictDataFreshness, o.CacheConfig.PricingUpdatePeriod)
+	}
+	return nil
+}
+
+const (
+	minCacheTTL = time.Second
+	maxCacheTTL = 7 * 24 * time.Hour
+	// minPricingUpdatePeriod avoids hammering the retail prices API, which paginates over thousands of prices
+	minPricingUpdatePeriod = 5 * time.Minute
+	// minSpotPlacementScoresUpdatePeriod keeps within the low request quota of the Spot Placement Scores API
+	minSpotPlacementScoresUpdatePeriod = 5 * time.Minute
+	// minZonesUpdatePeriod avoids listing the SKUs of the region, which is slow and throttled, more often than needed
+	minZonesUpdatePeriod = 5 * time.Minute
+	// maxImageLookupFailuresTTL keeps failed image lookups from blocking launches for long once the images are available
+	maxImageLookupFailuresTTL = 5 * time.Minute
+)
+
+func (o *Options) validateCacheConfig() error {
+	c := o.CacheConfig
+	caches := []struct {
+		name            string
+		ttl             time.Duration
+		cleanupInterval time.Duration
+	}{
+		{"kubernetes-version", c.KubernetesVersionTTL, c.KubernetesVersionCleanupInterval},
+		{"images", c.ImagesTTL, c.ImagesCleanupInterval},
+		{"instance-types", c.InstanceTypesTTL, c.InstanceTypesCleanupInterval},
+		{"unavailable-offerings", c.UnavailableOfferingsTTL, c.UnavailableOfferingsCleanupInterval},
+		{"load-balancers", c.LoadBalancersTTL, c.LoadBalancersCleanupInterval},
+	}
+	for _, cache := range caches {
+		if cache.ttl < minCacheTTL || cache.ttl > maxCacheTTL {
+			return fmt.Errorf("cache-%s-ttl %s is invalid. cache-%s-ttl must be between %s and %s", cache.name, cache.ttl, cache.name, minCacheTTL, maxCacheTTL)
+		}
+		if cache.cleanupInterval <= 0 || cache.cleanupInterval > cache.ttl {
+			return fmt.Errorf("cache-%s-cleanup-interval %s is invalid. cache-%s-cleanup-interval must be positive and at most cache-%s-ttl", cache.name, cache.cleanupInterval, cache.name, cache.name)
+		}
+	}
+	if c.ImageLookupFailuresTTL < 0 || c.ImageLookupFailuresTTL > maxImageLookupFailuresTTL {
+		return fmt.Errorf("cache-image-lookup-failures-ttl %s is invalid. cache-image-lookup-failures-ttl must be between 0 (disabled) and %s", c.ImageLookupFailuresTTL, maxImageLookupFailuresTTL)
+	}
+	if c.NodeImageVersionsTTL < 0 || c.NodeImageVersionsTTL > c.ImagesTTL {
+		return fmt.Errorf("cache-node-image-versions-ttl %s is invalid. cache-node-image-versions-ttl must be between 0 (disabled) and cache-images-ttl", c.NodeImageVersionsTTL)
+	}
+	if c.PricingUpdatePeriod < minPricingUpdatePeriod || c.PricingUpdatePeriod > maxCacheTTL {
+		return fmt.Errorf("cache-pricing-update-period %s is invalid. cache-pricing-update-period must be between %s and %s", c.PricingUpdatePeriod, minPricingUpdatePeriod, maxCacheTTL)
+	}
+	if c.SpotPlacementScoresUpdatePeriod < minSpotPlacementScoresUpdatePeriod || c.SpotPlacementScoresUpdatePeriod > maxCacheTTL {
+		return fmt.Errorf("cache-spot-placement-scores-update-period %s is invalid. cache-spot-placement-scores-update-period must be between %s and %s", c.SpotPlacementScoresUpdatePeriod, minSpotPlacementScoresUpdatePeriod, maxCacheTTL)
+	}
+	if c.ZonesUpdatePeriod != 0 && (c.ZonesUpdatePeriod < minZonesUpdatePeriod || c.ZonesUpdatePeriod > c.InstanceTypesTTL) {
+		return fmt.Errorf("cache-zones-update-period %s is invalid. cache-zones-update-period must be 0 (disabled) or between %s and cache-instance-types-ttl", c.ZonesUpdatePeriod, minZonesUpdatePeriod)
+	}
+	return nil
+}
+
+func (o *Options) validateDebugServerPort() error {
+	if o.DebugServerPort < 0 || o.DebugServerPort > 65535 {
+		return fmt.Errorf("debug-server-port %d is invalid. debug-server-port must be between 0 (disabled) and 65535", o.DebugServerPort)
+	}
+	return nil
+}
+
+func (o *Options) validateLeaderElection() error {
+	if o.LeaderElectionRetryPeriod <= 0 {
+		return fmt.Errorf("leader-election-retry-period %s is invalid. leader-election-retry-period must be positive", o.LeaderElectionRetryPeriod)
+	}
+	// the leader election of client-go rejects, by panicking, the timings that don't leave room for the renewal retries
+	if float64(o.LeaderElectionRenewDeadline) <= 1.2*float64(o.LeaderElectionRetryPeriod) {
+		return fmt.Errorf("leader-election-renew-deadline %s is invalid. leader-election-renew-deadline must be longer than 1.2 times leader-election-retry-period %s", o.LeaderElectionRenewDeadline, o.LeaderElectionRetryPeriod)
+	}
+	if o.LeaderElectionLeaseDuration <= o.LeaderElectionRenewDeadline {
+		return fmt.Errorf("leader-election-lease-duration %s is invalid. leader-election-lease-duration must be longer than leader-election-renew-deadline %s", o.LeaderElectionLeaseDuration, o.LeaderElectionRenewDeadline)
+	}
+	return nil
+}
+
+func (o *Options) validateOTLPTracesEndpoint() error {
+	if o.OTLPTracesEndpoint == "" {
+		return nil
+	}
+	if endpoint, err := url.Parse(o.OTLPTracesEndpoint); err != nil || !isValidURL(o.OTLPTracesEndpoint) || (endpoint.Scheme != "http" && endpoint.Scheme != "https") {
+		return fmt.Errorf("otlp-traces-endpoint %q is invalid. otlp-traces-endpoint must be an http or https URL, e.g. http://otel-collector:4318/v1/traces", o.OTLPTracesEndpoint)
+	}
+	return nil
+}
+
+// apiVersionRegex matches ARM api-versions, e.g. 2024-04-02 or 2024-04-02-preview
+var apiVersionRegex = regexp.MustCompile(`^\d{4}-\d{2}-\d{2}(-preview)?$`)
+
+func (o *Options) validateNodeImageVersionsAPIVersion() error {
+	if !apiVersionRegex.MatchString(o.NodeImageVersionsAPIVersion) {
+		return fmt.Errorf("node-image-versions-api-version %q is invalid. node-image-versions-api-version must be a date, e.g. %s, optionally followed by -preview", o.NodeImageVersionsAPIVersion, consts.NodeImageVersionsAPIVersion)
+	}
+	return nil
+}
+
 func (o *Options) validateRequiredFields() error {
 	if o.ClusterEndpoint == "" {
 		return fmt.Errorf("missing field, cluster-endpoint")
@@ -127,8 +350,8 @@ func (o *Options) validateRequiredFields() error {
 	if o.ClusterName == "" {
 		return fmt.Errorf("missing field, cluster-name")
 	}
-	if o.KubeletClientTLSBootstrapToken == "" {
-		return fmt.Errorf("missing field, kubelet-bootstrap-token")
+	if o.KubeletClientTLSBootstrapToken == "" && o.KubeletBootstrapTokenSecret == "" {
+		return fmt.Errorf("missing field, kubelet-bootstrap-token or kubelet-bootstrap-token-secret")
 	}
 	if o.SSHPublicKey == "" {
 		return fmt.Errorf("missing field, ssh-public-key")
@@ -200,6 +423,72 @@ func (o *Options) validateAdditionalTags() error {
 	return nil
 }
 
+// validateGarbageCollectionConfirmationTag checks that the garbage collection confirmation tag is a key=value tag,
+// following Azure's tag rules like the additional tags
+func (o *Options) validateGarbageCollectionConfirmationTag() error {
+	if o.GarbageCollectionConfirmationTag == "" {
+		return nil
+	}
+	key, value, err := o.GetGarbageCollectionConfirmationTag()
+	if err != nil {
+		return err
+	}
+	if len(key) > 512 || len(value) > 256 {
+		return fmt.Errorf("garbage-collection-confirmation-tag %q exceeds the maximum length of 512 characters for its key or 256 for its value", o.GarbageCollectionConfirmationTag)
+	}
+	if strings.ContainsAny(key, `<>%&\?/`) {
+		return fmt.Errorf("garbage-collection-confirmation-tag key %q contains invalid characters. <, >, %%, &, \\, ?, / are not allowed", key)
+	}
+	return nil
+}
+
+// locationNameRegex matches the names of Azure locations, e.g. westus2
+var locationNameRegex = regexp.MustCompile(`^[a-z][a-z0-9]*$`)
+
+// validateCommunityGalleryFallbackLocations checks that the community gallery fallback locations are location names,
+// e.g. westus2, rather than display names like West US 2
+func (o *Options) validateCommunityGalleryFallbackLocations() error {
+	for _, location := range o.GetCommunityGalleryFallbackLocations() {
+		if !locationNameRegex.MatchString(location) {
+			return fmt.Errorf("community-gallery-fallback-locations %q is invalid. community-gallery-fallback-locations must be comma separated location names, e.g. westus2,eastus2", o.CommunityGalleryFallbackLocations)
+		}
+	}
+	return nil
+}
+
+// validateAdditionallyAllowedTenants checks that the additionally allowed tenants are tenant IDs, rather than the
+// wildcard allowing any tenant
+func (o *Options) validateAdditionallyAllowedTenants() error {
+	for _, tenantID := range o.GetAdditionallyAllowedTenants() {
+		if uuid.Validate(tenantID) != nil {
+			return fmt.Errorf("additionally-allowed-tenants %q is invalid. additionally-allowed-tenants must be comma separated tenant IDs", o.AdditionallyAllowedTenants)
+		}
+	}
+	return nil
+}
+
+// validateGalleryAliases checks that the gallery aliases map gallery IDs to other gallery IDs, without chains, as the
+// galleries that moved are only replaced once
+func (o *Options) validateGalleryAliases() error {
+	for from, to := range o.GalleryAliases {
+		for _, gallery := range []string{from, to} {
+			id, err := arm.ParseResourceID(gallery)
+			if err != nil || !strings.EqualFold(id.ResourceType.String(), "Microsoft.Compute/galleries") {
+				return fmt.Errorf("gallery-aliases %q is invalid. gallery-aliases must map gallery IDs, /subscriptions/<subscription>/resourceGroups/<resourceGroup>/providers/Microsoft.Compute/galleries/<gallery>", gallery)
+			}
+		}
+		if strings.EqualFold(from, to) {
+			return fmt.Errorf("gallery-aliases %q is invalid. gallery-aliases must map a gallery to another one", from)
+		}
+		for other := range o.GalleryAliases {
+			if strings.EqualFold(to, other) {
+				return fmt.Errorf("gallery-aliases %q is invalid. gallery-aliases must map a gallery to one that isn't aliased itself", from)
+			}
+		}
+	}
+	return nil
+}
+
 func isValidURL(u string) bool {
 	endpoint, err := url.Parse(u)
 	// url.Parse() will accept a lot of input without error; make
@@ -24,6 +24,7 @@ import (
 	"reflect"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/google/go-cmp/cmp/cmpopts"
 	. "github.com/onsi/ginkgo/v2"
@@ -53,6 +54,7 @@ var _ = Describe("Options", func() {
 		"VM_MEMORY_OVERHEAD_PERCENT",
 		"CLUSTER_ID",
 		"KUBELET_BOOTSTRAP_TOKEN",
+		"KUBELET_BOOTSTRAP_TOKEN_SECRET",
 		"SSH_PUBLIC_KEY",
 		"NETWORK_PLUGIN",
 		"NETWORK_POLICY",
@@ -65,11 +67,58 @@ var _ = Describe("Options", func() {
 		"SIG_ACCESS_TOKEN_SERVER_URL",
 		"SIG_ACCESS_TOKEN_SCOPE",
 		"SIG_SUBSCRIPTION_ID",
+		"SIG_FALLBACK_TO_CIG",
+		"COMMUNITY_GALLERY_FALLBACK_LOCATIONS",
+		"ADDITIONALLY_ALLOWED_TENANTS",
+		"GALLERY_ALIASES",
 		"AZURE_NODE_RESOURCE_GROUP",
 		"KUBELET_IDENTITY_CLIENT_ID",
 		"LINUX_ADMIN_USERNAME",
 		"ADDITIONAL_TAGS",
 		"ENABLE_AZURE_SDK_LOGGING",
+		"ENABLE_BOOTSTRAP_DEBUG",
+		"DEMOTE_IMAGE_DISCOVERY_LOGS",
+		"CLOUD",
+		"VOLUME_DETACH_TIMEOUT",
+		"GPU_DRIVER_READY_TIMEOUT",
+		"INSTANCE_HEALTH_INTERVAL",
+		"TAG_DRIFT_INTERVAL",
+		"TAG_DRIFT_MODE",
+		"TAG_DRIFT_MAX_REPAIRS",
+		"MAX_CONCURRENT_VM_CREATES",
+		"MAX_CONCURRENT_VM_CREATES_PER_NODEPOOL",
+		"VM_CREATE_QUEUE_TIMEOUT",
+		"MAX_CONCURRENT_NIC_OPERATIONS",
+		"NIC_POLL_INTERVAL",
+		"ARM_RATE_LIMIT_LOW_THRESHOLD",
+		"ARM_RATE_LIMIT_BACKPRESSURE",
+		"SPOT_PLACEMENT_SCORE_STRATEGY",
+		"SPOT_PLACEMENT_SCORE_WEIGHT",
+		"VM_SERIES_RETIREMENT_OVERRIDES",
+		"VM_SERIES_RETIREMENT_WARNING_MONTHS",
+		"STRICT_DATA_FRESHNESS",
+		"CACHE_KUBERNETES_VERSION_TTL",
+		"CACHE_KUBERNETES_VERSION_CLEANUP_INTERVAL",
+		"CACHE_IMAGES_TTL",
+		"CACHE_IMAGES_CLEANUP_INTERVAL",
+		"CACHE_IMAGE_LOOKUP_FAILURES_TTL",
+		"CACHE_NODE_IMAGE_VERSIONS_TTL",
+		"CACHE_INSTANCE_TYPES_TTL",
+		"CACHE_INSTANCE_TYPES_CLEANUP_INTERVAL",
+		"CACHE_UNAVAILABLE_OFFERINGS_TTL",
+		"CACHE_UNAVAILABLE_OFFERINGS_CLEANUP_INTERVAL",
+		"CACHE_LOAD_BALANCERS_TTL",
+		"CACHE_LOAD_BALANCERS_CLEANUP_INTERVAL",
+		"CACHE_PRICING_UPDATE_PERIOD",
+		"CACHE_SPOT_PLACEMENT_SCORES_UPDATE_PERIOD",
+		"CACHE_ZONES_UPDATE_PERIOD",
+		"DEBUG_SERVER_PORT",
+		"LEADER_ELECTION_LEASE_DURATION",
+		"LEADER_ELECTION_RENEW_DEADLINE",
+		"LEADER_ELECTION_RETRY_PERIOD",
+		"OTLP_TRACES_ENDPOINT",
+		"NODE_IMAGE_VERSIONS_API_VERSION",
+		"GARBAGE_COLLECTION_CONFIRMATION_TAG",
 	}
 
 	var fs *coreoptions.FlagSet
@@ -118,40 +167,50 @@ var _ = Describe("Options", func() {
 			os.Setenv("USE_SIG", "true")
 			os.Setenv("SIG_ACCESS_TOKEN_SERVER_URL", "http://valid-server.com")
 			os.Setenv("SIG_SUBSCRIPTION_ID", "my-subscription-id")
+			os.Setenv("SIG_FALLBACK_TO_CIG", "true")
 			os.Setenv("VNET_GUID", "a519e60a-cac0-40b2-b883-084477fe6f5c")
 			os.Setenv("AZURE_NODE_RESOURCE_GROUP", "my-node-rg")
 			os.Setenv("KUBELET_IDENTITY_CLIENT_ID", "2345678-1234-1234-1234-123456789012")
 			os.Setenv("LINUX_ADMIN_USERNAME", "customadminusername")
 			os.Setenv("ADDITIONAL_TAGS", "test-tag=test-value")
+			os.Setenv("CACHE_IMAGES_TTL", "24h")
+			os.Setenv("NODE_IMAGE_VERSIONS_API_VERSION", "2025-01-01-preview")
+			os.Setenv("GARBAGE_COLLECTION_CONFIRMATION_TAG", "owner=karpenter")
 			fs = &coreoptions.FlagSet{
 				FlagSet: flag.NewFlagSet("karpenter", flag.ContinueOnError),
 			}
 			opts.AddFlags(fs)
 			err := opts.Parse(fs)
 			Expect(err).ToNot(HaveOccurred())
+			cacheConfig := options.DefaultCacheConfig()
+			cacheConfig.ImagesTTL = 24 * time.Hour
 			expectedOpts := test.Options(test.OptionsFields{
-				ClusterName:                    lo.ToPtr("env-cluster"),
-				ClusterEndpoint:                lo.ToPtr("https://environment-cluster-id-value-for-testing"),
-				VMMemoryOverheadPercent:        lo.ToPtr(0.3),
-				ClusterID:                      lo.ToPtr("46593302"),
-				KubeletClientTLSBootstrapToken: lo.ToPtr("env-bootstrap-token"),
-				LinuxAdminUsername:             lo.ToPtr("customadminusername"),
-				SSHPublicKey:                   lo.ToPtr("env-ssh-public-key"),
-				NetworkPlugin:                  lo.ToPtr("none"),
-				NetworkPluginMode:              lo.ToPtr(""),
-				NetworkPolicy:                  lo.ToPtr("env-network-policy"),
-				SubnetID:                       lo.ToPtr("/subscriptions/12345678-1234-1234-1234-123456789012/resourceGroups/sillygeese/providers/Microsoft.Network/virtualNetworks/karpentervnet/subnets/karpentersub"),
-				NodeIdentities:                 []string{"/subscriptions/1234/resourceGroups/mcrg/providers/Microsoft.ManagedIdentity/userAssignedIdentities/envid1", "/subscriptions/1234/resourceGroups/mcrg/providers/Microsoft.ManagedIdentity/userAssignedIdentities/envid2"},
-				ProvisionMode:                  lo.ToPtr("bootstrappingclient"),
-				NodeBootstrappingServerURL:     lo.ToPtr("https://nodebootstrapping-server-url"),
-				VnetGUID:                       lo.ToPtr("a519e60a-cac0-40b2-b883-084477fe6f5c"),
-				UseSIG:                         lo.ToPtr(true),
-				SIGAccessTokenServerURL:        lo.ToPtr("http://valid-server.com"),
-				SIGSubscriptionID:              lo.ToPtr("my-subscription-id"),
-				NodeResourceGroup:              lo.ToPtr("my-node-rg"),
-				KubeletIdentityClientID:        lo.ToPtr("2345678-1234-1234-1234-123456789012"),
-				AdditionalTags:                 map[string]string{"test-tag": "test-value"},
-				ClusterDNSServiceIP:            lo.ToPtr("10.244.0.1"),
+				ClusterName:                      lo.ToPtr("env-cluster"),
+				ClusterEndpoint:                  lo.ToPtr("https://environment-cluster-id-value-for-testing"),
+				VMMemoryOverheadPercent:          lo.ToPtr(0.3),
+				ClusterID:                        lo.ToPtr("46593302"),
+				KubeletClientTLSBootstrapToken:   lo.ToPtr("env-bootstrap-token"),
+				LinuxAdminUsername:               lo.ToPtr("customadminusername"),
+				SSHPublicKey:                     lo.ToPtr("env-ssh-public-key"),
+				NetworkPlugin:                    lo.ToPtr("none"),
+				NetworkPluginMode:                lo.ToPtr(""),
+				NetworkPolicy:                    lo.ToPtr("env-network-policy"),
+				SubnetID:                         lo.ToPtr("/subscriptions/12345678-1234-1234-1234-123456789012/resourceGroups/sillygeese/providers/Microsoft.Network/virtualNetworks/karpentervnet/subnets/karpentersub"),
+				NodeIdentities:                   []string{"/subscriptions/1234/resourceGroups/mcrg/providers/Microsoft.ManagedIdentity/userAssignedIdentities/envid1", "/subscriptions/1234/resourceGroups/mcrg/providers/Microsoft.ManagedIdentity/userAssignedIdentities/envid2"},
+				ProvisionMode:                    lo.ToPtr("bootstrappingclient"),
+				NodeBootstrappingServerURL:       lo.ToPtr("https://nodebootstrapping-server-url"),
+				VnetGUID:                         lo.ToPtr("a519e60a-cac0-40b2-b883-084477fe6f5c"),
+				UseSIG:                           lo.ToPtr(true),
+				SIGAccessTokenServerURL:          lo.ToPtr("http://valid-server.com"),
+				SIGSubscriptionID:                lo.ToPtr("my-subscription-id"),
+				SIGFallbackToCIG:                 lo.ToPtr(true),
+				NodeResourceGroup:                lo.ToPtr("my-node-rg"),
+				KubeletIdentityClientID:          lo.ToPtr("2345678-1234-1234-1234-123456789012"),
+				AdditionalTags:                   map[string]string{"test-tag": "test-value"},
+				ClusterDNSServiceIP:              lo.ToPtr("10.244.0.1"),
+				CacheConfig:                      &cacheConfig,
+				NodeImageVersionsAPIVersion:      lo.ToPtr("2025-01-01-preview"),
+				GarbageCollectionConfirmationTag: lo.ToPtr("owner=karpenter"),
 			})
 			Expect(opts).To(BeComparableTo(expectedOpts, cmpopts.IgnoreUnexported(options.Options{})))
 		})
@@ -235,6 +294,31 @@ var _ = Describe("Options", func() {
 			)
 			Expect(err).To(MatchError(ContainSubstring("missing field, kubelet-bootstrap-token")))
 		})
+		It("should succeed when kubelet-bootstrap-token-secret is used instead of kubelet-bootstrap-token", func() {
+			err := opts.Parse(
+				fs,
+				"--cluster-name", "my-name",
+				"--cluster-endpoint", "https://karpenter-000000000000.hcp.westus2.staging.azmk8s.io",
+				"--kubelet-bootstrap-token-secret", "kube-system/karpenter-bootstrap-token/token",
+				"--ssh-public-key", "flag-ssh-public-key",
+				"--vnet-subnet-id", "/subscriptions/12345678-1234-1234-1234-123456789012/resourceGroups/sillygeese/providers/Microsoft.Network/virtualNetworks/karpentervnet/subnets/karpentersub",
+				"--node-resource-group", "my-node-rg",
+			)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(opts.GetKubeletBootstrapTokenSecretRef()).To(Equal(options.SecretKeyRef{Namespace: "kube-system", Name: "karpenter-bootstrap-token", Key: "token"}))
+		})
+		It("should fail validation when kubelet-bootstrap-token-secret is malformed", func() {
+			err := opts.Parse(
+				fs,
+				"--cluster-name", "my-name",
+				"--cluster-endpoint", "https://karpenter-000000000000.hcp.westus2.staging.azmk8s.io",
+				"--kubelet-bootstrap-token-secret", "kube-system/karpenter-bootstrap-token",
+				"--ssh-public-key", "flag-ssh-public-key",
+				"--vnet-subnet-id", "/subscriptions/12345678-1234-1234-1234-123456789012/resourceGroups/sillygeese/providers/Microsoft.Network/virtualNetworks/karpentervnet/subnets/karpentersub",
+				"--node-resource-group", "my-node-rg",
+			)
+			Expect(err).To(MatchError(ContainSubstring("kubelet-bootstrap-token-secret is invalid")))
+		})
 		It("should fail validation when SSHPublicKey not included", func() {
 			err := opts.Parse(
 				fs,
@@ -370,6 +454,407 @@ var _ = Describe("Options", func() {
 			Expect(err).ToNot(HaveOccurred())
 
 		})
+		It("should fail validation when cloud is not valid", func() {
+			err := opts.Parse(
+				fs,
+				"--cluster-name", "my-name",
+				"--cluster-endpoint", "https://karpenter-000000000000.hcp.westus2.staging.azmk8s.io",
+				"--kubelet-bootstrap-token", "flag-bootstrap-token",
+				"--ssh-public-key", "flag-ssh-public-key",
+				"--vnet-subnet-id", "/subscriptions/12345678-1234-1234-1234-123456789012/resourceGroups/sillygeese/providers/Microsoft.Network/virtualNetworks/karpentervnet/subnets/karpentersub",
+				"--node-resource-group", "my-node-rg",
+				"--cloud", "aws",
+			)
+			Expect(err).To(MatchError(ContainSubstring("cloud aws is invalid")))
+		})
+		It("should fail validation when volume detach timeout is negative", func() {
+			err := opts.Parse(
+				fs,
+				"--cluster-name", "my-name",
+				"--cluster-endpoint", "https://karpenter-000000000000.hcp.westus2.staging.azmk8s.io",
+				"--kubelet-bootstrap-token", "flag-bootstrap-token",
+				"--ssh-public-key", "flag-ssh-public-key",
+				"--vnet-subnet-id", "/subscriptions/12345678-1234-1234-1234-123456789012/resourceGroups/sillygeese/providers/Microsoft.Network/virtualNetworks/karpentervnet/subnets/karpentersub",
+				"--node-resource-group", "my-node-rg",
+				"--volume-detach-timeout", "-1m",
+			)
+			Expect(err).To(MatchError(ContainSubstring("volume-detach-timeout -1m0s is invalid")))
+		})
+		It("should fail validation when the VM create queue timeout isn't positive", func() {
+			err := opts.Parse(
+				fs,
+				"--cluster-name", "my-name",
+				"--cluster-endpoint", "https://karpenter-000000000000.hcp.westus2.staging.azmk8s.io",
+				"--kubelet-bootstrap-token", "flag-bootstrap-token",
+				"--ssh-public-key", "flag-ssh-public-key",
+				"--vnet-subnet-id", "/subscriptions/12345678-1234-1234-1234-123456789012/resourceGroups/sillygeese/providers/Microsoft.Network/virtualNetworks/karpentervnet/subnets/karpentersub",
+				"--node-resource-group", "my-node-rg",
+				"--max-concurrent-vm-creates-per-nodepool", "10",
+				"--vm-create-queue-timeout", "0s",
+			)
+			Expect(err).To(MatchError(ContainSubstring("vm-create-queue-timeout 0s is invalid")))
+		})
+		It("should fail validation when the maximum of concurrent NIC operations is negative", func() {
+			err := opts.Parse(
+				fs,
+				"--cluster-name", "my-name",
+				"--cluster-endpoint", "https://karpenter-000000000000.hcp.westus2.staging.azmk8s.io",
+				"--kubelet-bootstrap-token", "flag-bootstrap-token",
+				"--ssh-public-key", "flag-ssh-public-key",
+				"--vnet-subnet-id", "/subscriptions/12345678-1234-1234-1234-123456789012/resourceGroups/sillygeese/providers/Microsoft.Network/virtualNetworks/karpentervnet/subnets/karpentersub",
+				"--node-resource-group", "my-node-rg",
+				"--max-concurrent-nic-operations", "-1",
+			)
+			Expect(err).To(MatchError(ContainSubstring("max-concurrent-nic-operations -1 is invalid")))
+		})
+		It("should fail validation when the NIC poll interval is negative", func() {
+			err := opts.Parse(
+				fs,
+				"--cluster-name", "my-name",
+				"--cluster-endpoint", "https://karpenter-000000000000.hcp.westus2.staging.azmk8s.io",
+				"--kubelet-bootstrap-token", "flag-bootstrap-token",
+				"--ssh-public-key", "flag-ssh-public-key",
+				"--vnet-subnet-id", "/subscriptions/12345678-1234-1234-1234-123456789012/resourceGroups/sillygeese/providers/Microsoft.Network/virtualNetworks/karpentervnet/subnets/karpentersub",
+				"--node-resource-group", "my-node-rg",
+				"--nic-poll-interval", "-1s",
+			)
+			Expect(err).To(MatchError(ContainSubstring("nic-poll-interval -1s is invalid")))
+		})
+		It("should fail validation when the tag drift mode is invalid", func() {
+			err := opts.Parse(
+				fs,
+				"--cluster-name", "my-name",
+				"--cluster-endpoint", "https://karpenter-000000000000.hcp.westus2.staging.azmk8s.io",
+				"--kubelet-bootstrap-token", "flag-bootstrap-token",
+				"--ssh-public-key", "flag-ssh-public-key",
+				"--vnet-subnet-id", "/subscriptions/12345678-1234-1234-1234-123456789012/resourceGroups/sillygeese/providers/Microsoft.Network/virtualNetworks/karpentervnet/subnets/karpentersub",
+				"--node-resource-group", "my-node-rg",
+				"--tag-drift-mode", "Fix",
+			)
+			Expect(err).To(MatchError(ContainSubstring("tag-drift-mode Fix is invalid")))
+		})
+		It("should fail validation when the maximum of tag drift repairs is negative", func() {
+			err := opts.Parse(
+				fs,
+				"--cluster-name", "my-name",
+				"--cluster-endpoint", "https://karpenter-000000000000.hcp.westus2.staging.azmk8s.io",
+				"--kubelet-bootstrap-token", "flag-bootstrap-token",
+				"--ssh-public-key", "flag-ssh-public-key",
+				"--vnet-subnet-id", "/subscriptions/12345678-1234-1234-1234-123456789012/resourceGroups/sillygeese/providers/Microsoft.Network/virtualNetworks/karpentervnet/subnets/karpentersub",
+				"--node-resource-group", "my-node-rg",
+				"--tag-drift-max-repairs", "-1",
+			)
+			Expect(err).To(MatchError(ContainSubstring("tag-drift-max-repairs -1 is invalid")))
+		})
+		It("should fail validation when a gallery alias isn't a gallery ID", func() {
+			err := opts.Parse(
+				fs,
+				"--cluster-name", "my-name",
+				"--cluster-endpoint", "https://karpenter-000000000000.hcp.westus2.staging.azmk8s.io",
+				"--kubelet-bootstrap-token", "flag-bootstrap-token",
+				"--ssh-public-key", "flag-ssh-public-key",
+				"--vnet-subnet-id", "/subscriptions/12345678-1234-1234-1234-123456789012/resourceGroups/sillygeese/providers/Microsoft.Network/virtualNetworks/karpentervnet/subnets/karpentersub",
+				"--node-resource-group", "my-node-rg",
+				"--gallery-aliases", "/subscriptions/11111111-1111-1111-1111-111111111111/resourceGroups/images/providers/Microsoft.Compute/galleries/gallery=/subscriptions/22222222-2222-2222-2222-222222222222/resourceGroups/images",
+			)
+			Expect(err).To(MatchError(ContainSubstring("gallery-aliases \"/subscriptions/22222222-2222-2222-2222-222222222222/resourceGroups/images\" is invalid")))
+		})
+		It("should fail validation when gallery aliases are chained", func() {
+			err := opts.Parse(
+				fs,
+				"--cluster-name", "my-name",
+				"--cluster-endpoint", "https://karpenter-000000000000.hcp.westus2.staging.azmk8s.io",
+				"--kubelet-bootstrap-token", "flag-bootstrap-token",
+				"--ssh-public-key", "flag-ssh-public-key",
+				"--vnet-subnet-id", "/subscriptions/12345678-1234-1234-1234-123456789012/resourceGroups/sillygeese/providers/Microsoft.Network/virtualNetworks/karpentervnet/subnets/karpentersub",
+				"--node-resource-group", "my-node-rg",
+				"--gallery-aliases", "/subscriptions/11111111-1111-1111-1111-111111111111/resourceGroups/images/providers/Microsoft.Compute/galleries/gallery=/subscriptions/22222222-2222-2222-2222-222222222222/resourceGroups/images/providers/Microsoft.Compute/galleries/gallery,/subscriptions/22222222-2222-2222-2222-222222222222/resourceGroups/images/providers/Microsoft.Compute/galleries/gallery=/subscriptions/33333333-3333-3333-3333-333333333333/resourceGroups/images/providers/Microsoft.Compute/galleries/gallery",
+			)
+			Expect(err).To(MatchError(ContainSubstring("gallery-aliases \"/subscriptions/11111111-1111-1111-1111-111111111111/resourceGroups/images/providers/Microsoft.Compute/galleries/gallery\" is invalid")))
+		})
+		It("should fail validation when the GPU driver ready timeout is negative", func() {
+			err := opts.Parse(
+				fs,
+				"--cluster-name", "my-name",
+				"--cluster-endpoint", "https://karpenter-000000000000.hcp.westus2.staging.azmk8s.io",
+				"--kubelet-bootstrap-token", "flag-bootstrap-token",
+				"--ssh-public-key", "flag-ssh-public-key",
+				"--vnet-subnet-id", "/subscriptions/12345678-1234-1234-1234-123456789012/resourceGroups/sillygeese/providers/Microsoft.Network/virtualNetworks/karpentervnet/subnets/karpentersub",
+				"--node-resource-group", "my-node-rg",
+				"--gpu-driver-ready-timeout", "-1m",
+			)
+			Expect(err).To(MatchError(ContainSubstring("gpu-driver-ready-timeout -1m0s is invalid")))
+		})
+		It("should fail validation when the ARM rate limit low threshold is negative", func() {
+			err := opts.Parse(
+				fs,
+				"--cluster-name", "my-name",
+				"--cluster-endpoint", "https://karpenter-000000000000.hcp.westus2.staging.azmk8s.io",
+				"--kubelet-bootstrap-token", "flag-bootstrap-token",
+				"--ssh-public-key", "flag-ssh-public-key",
+				"--vnet-subnet-id", "/subscriptions/12345678-1234-1234-1234-123456789012/resourceGroups/sillygeese/providers/Microsoft.Network/virtualNetworks/karpentervnet/subnets/karpentersub",
+				"--node-resource-group", "my-node-rg",
+				"--arm-rate-limit-low-threshold", "-1",
+			)
+			Expect(err).To(MatchError(ContainSubstring("arm-rate-limit-low-threshold -1 is invalid")))
+		})
+		It("should fail validation when the spot placement score strategy is invalid", func() {
+			err := opts.Parse(
+				fs,
+				"--cluster-name", "my-name",
+				"--cluster-endpoint", "https://karpenter-000000000000.hcp.westus2.staging.azmk8s.io",
+				"--kubelet-bootstrap-token", "flag-bootstrap-token",
+				"--ssh-public-key", "flag-ssh-public-key",
+				"--vnet-subnet-id", "/subscriptions/12345678-1234-1234-1234-123456789012/resourceGroups/sillygeese/providers/Microsoft.Network/virtualNetworks/karpentervnet/subnets/karpentersub",
+				"--node-resource-group", "my-node-rg",
+				"--spot-placement-score-strategy", "Score",
+			)
+			Expect(err).To(MatchError(ContainSubstring("spot-placement-score-strategy Score is invalid")))
+		})
+		It("should fail validation when the spot placement score weight is negative", func() {
+			err := opts.Parse(
+				fs,
+				"--cluster-name", "my-name",
+				"--cluster-endpoint", "https://karpenter-000000000000.hcp.westus2.staging.azmk8s.io",
+				"--kubelet-bootstrap-token", "flag-bootstrap-token",
+				"--ssh-public-key", "flag-ssh-public-key",
+				"--vnet-subnet-id", "/subscriptions/12345678-1234-1234-1234-123456789012/resourceGroups/sillygeese/providers/Microsoft.Network/virtualNetworks/karpentervnet/subnets/karpentersub",
+				"--node-resource-group", "my-node-rg",
+				"--spot-placement-score-strategy", "Weighted",
+				"--spot-placement-score-weight", "-0.5",
+			)
+			Expect(err).To(MatchError(ContainSubstring("spot-placement-score-weight -0.5 is invalid")))
+		})
+		It("should fail validation when a VM series retirement date is malformed", func() {
+			err := opts.Parse(
+				fs,
+				"--cluster-name", "my-name",
+				"--cluster-endpoint", "https://karpenter-000000000000.hcp.westus2.staging.azmk8s.io",
+				"--kubelet-bootstrap-token", "flag-bootstrap-token",
+				"--ssh-public-key", "flag-ssh-public-key",
+				"--vnet-subnet-id", "/subscriptions/12345678-1234-1234-1234-123456789012/resourceGroups/sillygeese/providers/Microsoft.Network/virtualNetworks/karpentervnet/subnets/karpentersub",
+				"--node-resource-group", "my-node-rg",
+				"--vm-series-retirement-overrides", "standardNCSv3Family=30/09/2025",
+			)
+			Expect(err).To(MatchError(ContainSubstring(`retirement date "30/09/2025" of standardNCSv3Family must be formatted as YYYY-MM-DD`)))
+		})
+		It("should fail validation when VM series retirement warning months is negative", func() {
+			err := opts.Parse(
+				fs,
+				"--cluster-name", "my-name",
+				"--cluster-endpoint", "https://karpenter-000000000000.hcp.westus2.staging.azmk8s.io",
+				"--kubelet-bootstrap-token", "flag-bootstrap-token",
+				"--ssh-public-key", "flag-ssh-public-key",
+				"--vnet-subnet-id", "/subscriptions/12345678-1234-1234-1234-123456789012/resourceGroups/sillygeese/providers/Microsoft.Network/virtualNetworks/karpentervnet/subnets/karpentersub",
+				"--node-resource-group", "my-node-rg",
+				"--vm-series-retirement-warning-months", "-1",
+			)
+			Expect(err).To(MatchError(ContainSubstring("vm-series-retirement-warning-months -1 is invalid")))
+		})
+		It("should fail validation when strict data freshness is negative", func() {
+			err := opts.Parse(
+				fs,
+				"--cluster-name", "my-name",
+				"--cluster-endpoint", "https://karpenter-000000000000.hcp.westus2.staging.azmk8s.io",
+				"--kubelet-bootstrap-token", "flag-bootstrap-token",
+				"--ssh-public-key", "flag-ssh-public-key",
+				"--vnet-subnet-id", "/subscriptions/12345678-1234-1234-1234-123456789012/resourceGroups/sillygeese/providers/Microsoft.Network/virtualNetworks/karpentervnet/subnets/karpentersub",
+				"--node-resource-group", "my-node-rg",
+				"--strict-data-freshness", "-1h",
+			)
+			Expect(err).To(MatchError(ContainSubstring("strict-data-freshness -1h0m0s is invalid")))
+		})
+		It("should fail validation when strict data freshness isn't longer than the pricing update period", func() {
+			err := opts.Parse(
+				fs,
+				"--cluster-name", "my-name",
+				"--cluster-endpoint", "https://karpenter-000000000000.hcp.westus2.staging.azmk8s.io",
+				"--kubelet-bootstrap-token", "flag-bootstrap-token",
+				"--ssh-public-key", "flag-ssh-public-key",
+				"--vnet-subnet-id", "/subscriptions/12345678-1234-1234-1234-123456789012/resourceGroups/sillygeese/providers/Microsoft.Network/virtualNetworks/karpentervnet/subnets/karpentersub",
+				"--node-resource-group", "my-node-rg",
+				"--cache-pricing-update-period", "6h",
+				"--strict-data-freshness", "6h",
+			)
+			Expect(err).To(MatchError(ContainSubstring("strict-data-freshness must be longer than cache-pricing-update-period")))
+		})
+		It("should fail validation when a cache TTL is out of range", func() {
+			err := opts.Parse(
+				fs,
+				"--cluster-name", "my-name",
+				"--cluster-endpoint", "https://karpenter-000000000000.hcp.westus2.staging.azmk8s.io",
+				"--kubelet-bootstrap-token", "flag-bootstrap-token",
+				"--ssh-public-key", "flag-ssh-public-key",
+				"--vnet-subnet-id", "/subscriptions/12345678-1234-1234-1234-123456789012/resourceGroups/sillygeese/providers/Microsoft.Network/virtualNetworks/karpentervnet/subnets/karpentersub",
+				"--node-resource-group", "my-node-rg",
+				"--cache-instance-types-ttl", "720h",
+			)
+			Expect(err).To(MatchError(ContainSubstring("cache-instance-types-ttl 720h0m0s is invalid")))
+		})
+		It("should fail validation when a cache cleanup interval exceeds its TTL", func() {
+			err := opts.Parse(
+				fs,
+				"--cluster-name", "my-name",
+				"--cluster-endpoint", "https://karpenter-000000000000.hcp.westus2.staging.azmk8s.io",
+				"--kubelet-bootstrap-token", "flag-bootstrap-token",
+				"--ssh-public-key", "flag-ssh-public-key",
+				"--vnet-subnet-id", "/subscriptions/12345678-1234-1234-1234-123456789012/resourceGroups/sillygeese/providers/Microsoft.Network/virtualNetworks/karpentervnet/subnets/karpentersub",
+				"--node-resource-group", "my-node-rg",
+				"--cache-unavailable-offerings-ttl", "1m",
+				"--cache-unavailable-offerings-cleanup-interval", "2m",
+			)
+			Expect(err).To(MatchError(ContainSubstring("cache-unavailable-offerings-cleanup-interval 2m0s is invalid")))
+		})
+		It("should fail validation when the image lookup failures TTL is too long", func() {
+			err := opts.Parse(
+				fs,
+				"--cluster-name", "my-name",
+				"--cluster-endpoint", "https://karpenter-000000000000.hcp.westus2.staging.azmk8s.io",
+				"--kubelet-bootstrap-token", "flag-bootstrap-token",
+				"--ssh-public-key", "flag-ssh-public-key",
+				"--vnet-subnet-id", "/subscriptions/12345678-1234-1234-1234-123456789012/resourceGroups/sillygeese/providers/Microsoft.Network/virtualNetworks/karpentervnet/subnets/karpentersub",
+				"--node-resource-group", "my-node-rg",
+				"--cache-image-lookup-failures-ttl", "1h",
+			)
+			Expect(err).To(MatchError(ContainSubstring("cache-image-lookup-failures-ttl 1h0m0s is invalid")))
+		})
+		It("should fail validation when the node image versions TTL is longer than the images TTL", func() {
+			err := opts.Parse(
+				fs,
+				"--cluster-name", "my-name",
+				"--cluster-endpoint", "https://karpenter-000000000000.hcp.westus2.staging.azmk8s.io",
+				"--kubelet-bootstrap-token", "flag-bootstrap-token",
+				"--ssh-public-key", "flag-ssh-public-key",
+				"--vnet-subnet-id", "/subscriptions/12345678-1234-1234-1234-123456789012/resourceGroups/sillygeese/providers/Microsoft.Network/virtualNetworks/karpentervnet/subnets/karpentersub",
+				"--node-resource-group", "my-node-rg",
+				"--cache-images-ttl", "1h",
+				"--cache-node-image-versions-ttl", "2h",
+			)
+			Expect(err).To(MatchError(ContainSubstring("cache-node-image-versions-ttl 2h0m0s is invalid")))
+		})
+		It("should fail validation when the pricing update period is too short", func() {
+			err := opts.Parse(
+				fs,
+				"--cluster-name", "my-name",
+				"--cluster-endpoint", "https://karpenter-000000000000.hcp.westus2.staging.azmk8s.io",
+				"--kubelet-bootstrap-token", "flag-bootstrap-token",
+				"--ssh-public-key", "flag-ssh-public-key",
+				"--vnet-subnet-id", "/subscriptions/12345678-1234-1234-1234-123456789012/resourceGroups/sillygeese/providers/Microsoft.Network/virtualNetworks/karpentervnet/subnets/karpentersub",
+				"--node-resource-group", "my-node-rg",
+				"--cache-pricing-update-period", "1m",
+			)
+			Expect(err).To(MatchError(ContainSubstring("cache-pricing-update-period 1m0s is invalid")))
+		})
+		It("should fail validation when the spot placement scores update period is too short", func() {
+			err := opts.Parse(
+				fs,
+				"--cluster-name", "my-name",
+				"--cluster-endpoint", "https://karpenter-000000000000.hcp.westus2.staging.azmk8s.io",
+				"--kubelet-bootstrap-token", "flag-bootstrap-token",
+				"--ssh-public-key", "flag-ssh-public-key",
+				"--vnet-subnet-id", "/subscriptions/12345678-1234-1234-1234-123456789012/resourceGroups/sillygeese/providers/Microsoft.Network/virtualNetworks/karpentervnet/subnets/karpentersub",
+				"--node-resource-group", "my-node-rg",
+				"--cache-spot-placement-scores-update-period", "1m",
+			)
+			Expect(err).To(MatchError(ContainSubstring("cache-spot-placement-scores-update-period 1m0s is invalid")))
+		})
+		It("should fail validation when the zones update period is longer than the instance types TTL", func() {
+			err := opts.Parse(
+				fs,
+				"--cluster-name", "my-name",
+				"--cluster-endpoint", "https://karpenter-000000000000.hcp.westus2.staging.azmk8s.io",
+				"--kubelet-bootstrap-token", "flag-bootstrap-token",
+				"--ssh-public-key", "flag-ssh-public-key",
+				"--vnet-subnet-id", "/subscriptions/12345678-1234-1234-1234-123456789012/resourceGroups/sillygeese/providers/Microsoft.Network/virtualNetworks/karpentervnet/subnets/karpentersub",
+				"--node-resource-group", "my-node-rg",
+				"--cache-instance-types-ttl", "1h",
+				"--cache-zones-update-period", "2h",
+			)
+			Expect(err).To(MatchError(ContainSubstring("cache-zones-update-period 2h0m0s is invalid")))
+		})
+		It("should fail validation when the debug server port is out of range", func() {
+			err := opts.Parse(
+				fs,
+				"--cluster-name", "my-name",
+				"--cluster-endpoint", "https://karpenter-000000000000.hcp.westus2.staging.azmk8s.io",
+				"--kubelet-bootstrap-token", "flag-bootstrap-token",
+				"--ssh-public-key", "flag-ssh-public-key",
+				"--vnet-subnet-id", "/subscriptions/12345678-1234-1234-1234-123456789012/resourceGroups/sillygeese/providers/Microsoft.Network/virtualNetworks/karpentervnet/subnets/karpentersub",
+				"--node-resource-group", "my-node-rg",
+				"--debug-server-port", "70000",
+			)
+			Expect(err).To(MatchError(ContainSubstring("debug-server-port 70000 is invalid")))
+		})
+		It("should fail validation when the leader election lease duration isn't longer than the renew deadline", func() {
+			err := opts.Parse(
+				fs,
+				"--cluster-name", "my-name",
+				"--cluster-endpoint", "https://karpenter-000000000000.hcp.westus2.staging.azmk8s.io",
+				"--kubelet-bootstrap-token", "flag-bootstrap-token",
+				"--ssh-public-key", "flag-ssh-public-key",
+				"--vnet-subnet-id", "/subscriptions/12345678-1234-1234-1234-123456789012/resourceGroups/sillygeese/providers/Microsoft.Network/virtualNetworks/karpentervnet/subnets/karpentersub",
+				"--node-resource-group", "my-node-rg",
+				"--leader-election-lease-duration", "10s",
+			)
+			Expect(err).To(MatchError(ContainSubstring("leader-election-lease-duration 10s is invalid")))
+		})
+		It("should fail validation when the leader election renew deadline leaves no room to retry", func() {
+			err := opts.Parse(
+				fs,
+				"--cluster-name", "my-name",
+				"--cluster-endpoint", "https://karpenter-000000000000.hcp.westus2.staging.azmk8s.io",
+				"--kubelet-bootstrap-token", "flag-bootstrap-token",
+				"--ssh-public-key", "flag-ssh-public-key",
+				"--vnet-subnet-id", "/subscriptions/12345678-1234-1234-1234-123456789012/resourceGroups/sillygeese/providers/Microsoft.Network/virtualNetworks/karpentervnet/subnets/karpentersub",
+				"--node-resource-group", "my-node-rg",
+				"--leader-election-retry-period", "9s",
+			)
+			Expect(err).To(MatchError(ContainSubstring("leader-election-renew-deadline 10s is invalid")))
+		})
+		It("should succeed validation with longer leader election timings", func() {
+			err := opts.Parse(
+				fs,
+				"--cluster-name", "my-name",
+				"--cluster-endpoint", "https://karpenter-000000000000.hcp.westus2.staging.azmk8s.io",
+				"--kubelet-bootstrap-token", "flag-bootstrap-token",
+				"--ssh-public-key", "flag-ssh-public-key",
+				"--vnet-subnet-id", "/subscriptions/12345678-1234-1234-1234-123456789012/resourceGroups/sillygeese/providers/Microsoft.Network/virtualNetworks/karpentervnet/subnets/karpentersub",
+				"--node-resource-group", "my-node-rg",
+				"--leader-election-lease-duration", "60s",
+				"--leader-election-renew-deadline", "40s",
+				"--leader-election-retry-period", "5s",
+			)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(opts.LeaderElectionLeaseDuration).To(Equal(time.Minute))
+			Expect(opts.LeaderElectionRenewDeadline).To(Equal(40 * time.Second))
+			Expect(opts.LeaderElectionRetryPeriod).To(Equal(5 * time.Second))
+		})
+		It("should fail validation when the OTLP traces endpoint isn't an http URL", func() {
+			err := opts.Parse(
+				fs,
+				"--cluster-name", "my-name",
+				"--cluster-endpoint", "https://karpenter-000000000000.hcp.westus2.staging.azmk8s.io",
+				"--kubelet-bootstrap-token", "flag-bootstrap-token",
+				"--ssh-public-key", "flag-ssh-public-key",
+				"--vnet-subnet-id", "/subscriptions/12345678-1234-1234-1234-123456789012/resourceGroups/sillygeese/providers/Microsoft.Network/virtualNetworks/karpentervnet/subnets/karpentersub",
+				"--node-resource-group", "my-node-rg",
+				"--otlp-traces-endpoint", "otel-collector:4317",
+			)
+			Expect(err).To(MatchError(ContainSubstring(`otlp-traces-endpoint "otel-collector:4317" is invalid`)))
+		})
+		It("should fail validation when the NodeImageVersions api-version is malformed", func() {
+			err := opts.Parse(
+				fs,
+				"--cluster-name", "my-name",
+				"--cluster-endpoint", "https://karpenter-000000000000.hcp.westus2.staging.azmk8s.io",
+				"--kubelet-bootstrap-token", "flag-bootstrap-token",
+				"--ssh-public-key", "flag-ssh-public-key",
+				"--vnet-subnet-id", "/subscriptions/12345678-1234-1234-1234-123456789012/resourceGroups/sillygeese/providers/Microsoft.Network/virtualNetworks/karpentervnet/subnets/karpentersub",
+				"--node-resource-group", "my-node-rg",
+				"--node-image-versions-api-version", "latest",
+			)
+			Expect(err).To(MatchError(ContainSubstring(`node-image-versions-api-version "latest" is invalid`)))
+		})
 		It("should fail validation when ProvisionMode is not valid", func() {
 			err := opts.Parse(
 				fs,
@@ -491,6 +976,112 @@ var _ = Describe("Options", func() {
 			)
 			Expect(err).To(MatchError(ContainSubstring("validating options, additional-tags key \"<key1>\" contains invalid characters.")))
 		})
+		It("should parse garbage-collection-confirmation-tag", func() {
+			err := opts.Parse(
+				fs,
+				"--cluster-name", "my-name",
+				"--cluster-endpoint", "https://karpenter-000000000000.hcp.westus2.staging.azmk8s.io",
+				"--kubelet-bootstrap-token", "flag-bootstrap-token",
+				"--ssh-public-key", "flag-ssh-public-key",
+				"--vnet-subnet-id", "/subscriptions/12345678-1234-1234-1234-123456789012/resourceGroups/sillygeese/providers/Microsoft.Network/virtualNetworks/karpentervnet/subnets/karpentersub",
+				"--network-plugin", "azure",
+				"--network-plugin-mode", "overlay",
+				"--vnet-guid", "a519e60a-cac0-40b2-b883-084477fe6f5c",
+				"--node-resource-group", "my-node-rg",
+				"--garbage-collection-confirmation-tag", "owner=karpenter",
+			)
+			Expect(err).ToNot(HaveOccurred())
+			key, value, err := opts.GetGarbageCollectionConfirmationTag()
+			Expect(err).ToNot(HaveOccurred())
+			Expect(key).To(Equal("owner"))
+			Expect(value).To(Equal("karpenter"))
+		})
+		It("should fail if garbage-collection-confirmation-tag is malformed", func() {
+			err := opts.Parse(
+				fs,
+				"--cluster-name", "my-name",
+				"--cluster-endpoint", "https://karpenter-000000000000.hcp.westus2.staging.azmk8s.io",
+				"--kubelet-bootstrap-token", "flag-bootstrap-token",
+				"--ssh-public-key", "flag-ssh-public-key",
+				"--vnet-subnet-id", "/subscriptions/12345678-1234-1234-1234-123456789012/resourceGroups/sillygeese/providers/Microsoft.Network/virtualNetworks/karpentervnet/subnets/karpentersub",
+				"--network-plugin", "azure",
+				"--network-plugin-mode", "overlay",
+				"--vnet-guid", "a519e60a-cac0-40b2-b883-084477fe6f5c",
+				"--node-resource-group", "my-node-rg",
+				"--garbage-collection-confirmation-tag", "owner",
+			)
+			Expect(err).To(MatchError(ContainSubstring("garbage-collection-confirmation-tag is invalid: expected format <key>=<value>")))
+		})
+		It("should fail if garbage-collection-confirmation-tag has invalid character", func() {
+			err := opts.Parse(
+				fs,
+				"--cluster-name", "my-name",
+				"--cluster-endpoint", "https://karpenter-000000000000.hcp.westus2.staging.azmk8s.io",
+				"--kubelet-bootstrap-token", "flag-bootstrap-token",
+				"--ssh-public-key", "flag-ssh-public-key",
+				"--vnet-subnet-id", "/subscriptions/12345678-1234-1234-1234-123456789012/resourceGroups/sillygeese/providers/Microsoft.Network/virtualNetworks/karpentervnet/subnets/karpentersub",
+				"--network-plugin", "azure",
+				"--network-plugin-mode", "overlay",
+				"--vnet-guid", "a519e60a-cac0-40b2-b883-084477fe6f5c",
+				"--node-resource-group", "my-node-rg",
+				"--garbage-collection-confirmation-tag", "<owner>=karpenter",
+			)
+			Expect(err).To(MatchError(ContainSubstring("garbage-collection-confirmation-tag key \"<owner>\" contains invalid characters.")))
+		})
+		It("should parse community-gallery-fallback-locations", func() {
+			err := opts.Parse(
+				fs,
+				"--cluster-name", "my-name",
+				"--cluster-endpoint", "https://karpenter-000000000000.hcp.westus2.staging.azmk8s.io",
+				"--kubelet-bootstrap-token", "flag-bootstrap-token",
+				"--ssh-public-key", "flag-ssh-public-key",
+				"--vnet-subnet-id", "/subscriptions/12345678-1234-1234-1234-123456789012/resourceGroups/sillygeese/providers/Microsoft.Network/virtualNetworks/karpentervnet/subnets/karpentersub",
+				"--node-resource-group", "my-node-rg",
+				"--community-gallery-fallback-locations", "westus2, EastUS2",
+			)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(opts.GetCommunityGalleryFallbackLocations()).To(Equal([]string{"westus2", "eastus2"}))
+		})
+		It("should fail if community-gallery-fallback-locations has a display name", func() {
+			err := opts.Parse(
+				fs,
+				"--cluster-name", "my-name",
+				"--cluster-endpoint", "https://karpenter-000000000000.hcp.westus2.staging.azmk8s.io",
+				"--kubelet-bootstrap-token", "flag-bootstrap-token",
+				"--ssh-public-key", "flag-ssh-public-key",
+				"--vnet-subnet-id", "/subscriptions/12345678-1234-1234-1234-123456789012/resourceGroups/sillygeese/providers/Microsoft.Network/virtualNetworks/karpentervnet/subnets/karpentersub",
+				"--node-resource-group", "my-node-rg",
+				"--community-gallery-fallback-locations", "West US 2",
+			)
+			Expect(err).To(MatchError(ContainSubstring("community-gallery-fallback-locations \"West US 2\" is invalid")))
+		})
+		It("should parse additionally-allowed-tenants", func() {
+			err := opts.Parse(
+				fs,
+				"--cluster-name", "my-name",
+				"--cluster-endpoint", "https://karpenter-000000000000.hcp.westus2.staging.azmk8s.io",
+				"--kubelet-bootstrap-token", "flag-bootstrap-token",
+				"--ssh-public-key", "flag-ssh-public-key",
+				"--vnet-subnet-id", "/subscriptions/12345678-1234-1234-1234-123456789012/resourceGroups/sillygeese/providers/Microsoft.Network/virtualNetworks/karpentervnet/subnets/karpentersub",
+				"--node-resource-group", "my-node-rg",
+				"--additionally-allowed-tenants", "11111111-1111-1111-1111-111111111111, 22222222-2222-2222-2222-222222222222",
+			)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(opts.GetAdditionallyAllowedTenants()).To(Equal([]string{"11111111-1111-1111-1111-111111111111", "22222222-2222-2222-2222-222222222222"}))
+		})
+		It("should fail if additionally-allowed-tenants allows any tenant", func() {
+			err := opts.Parse(
+				fs,
+				"--cluster-name", "my-name",
+				"--cluster-endpoint", "https://karpenter-000000000000.hcp.westus2.staging.azmk8s.io",
+				"--kubelet-bootstrap-token", "flag-bootstrap-token",
+				"--ssh-public-key", "flag-ssh-public-key",
+				"--vnet-subnet-id", "/subscriptions/12345678-1234-1234-1234-123456789012/resourceGroups/sillygeese/providers/Microsoft.Network/virtualNetworks/karpentervnet/subnets/karpentersub",
+				"--node-resource-group", "my-node-rg",
+				"--additionally-allowed-tenants", "*",
+			)
+			Expect(err).To(MatchError(ContainSubstring("additionally-allowed-tenants \"*\" is invalid")))
+		})
 	})
 
 	Context("Admin Username Validation", func() {
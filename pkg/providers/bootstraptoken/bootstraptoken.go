@@ -0,0 +1,118 @@
+/*
+Portions Copyright (c) Microsoft Corporation.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package bootstraptoken
+
+import (
+	"context"
+	"fmt"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/kubernetes"
+	corev1listers "k8s.io/client-go/listers/core/v1"
+	toolscache "k8s.io/client-go/tools/cache"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	"github.com/Azure/karpenter-provider-azure/pkg/operator/options"
+)
+
+// Provider returns the TLS bootstrap token that new nodes use to join the cluster.
+// The token is looked up on every call, so that rotations are picked up at launch time.
+type Provider interface {
+	Token(ctx context.Context) (string, error)
+}
+
+// NewProvider returns a Secret backed Provider if a Secret reference is configured,
+// and otherwise falls back to the (deprecated) kubelet-bootstrap-token option.
+func NewProvider(ctx context.Context, kubernetesInterface kubernetes.Interface) (Provider, error) {
+	if options.FromContext(ctx).KubeletBootstrapTokenSecret == "" {
+		log.FromContext(ctx).Info("DEPRECATED: passing the bootstrap token via --kubelet-bootstrap-token is deprecated, use --kubelet-bootstrap-token-secret instead")
+		return NewOptionsProvider(), nil
+	}
+	ref, err := options.FromContext(ctx).GetKubeletBootstrapTokenSecretRef()
+	if err != nil {
+		return nil, err
+	}
+	return NewSecretProvider(ctx, kubernetesInterface, ref)
+}
+
+type optionsProvider struct{}
+
+// NewOptionsProvider returns a Provider that reads the token from the operator options
+func NewOptionsProvider() Provider {
+	return optionsProvider{}
+}
+
+func (optionsProvider) Token(ctx context.Context) (string, error) {
+	token := options.FromContext(ctx).KubeletClientTLSBootstrapToken
+	if token == "" {
+		return "", fmt.Errorf("kubelet bootstrap token is not set")
+	}
+	return token, nil
+}
+
+type secretProvider struct {
+	ref    options.SecretKeyRef
+	lister corev1listers.SecretLister
+}
+
+// NewSecretProvider returns a Provider that reads the token from a Secret. The Secret is watched through an
+// informer scoped to that single object, so updates are reflected without restarting the operator.
+func NewSecretProvider(ctx context.Context, kubernetesInterface kubernetes.Interface, ref options.SecretKeyRef) (Provider, error) {
+	factory := informers.NewSharedInformerFactoryWithOptions(kubernetesInterface, 0,
+		informers.WithNamespace(ref.Namespace),
+		informers.WithTweakListOptions(func(o *metav1.ListOptions) {
+			o.FieldSelector = fields.OneTermEqualSelector("metadata.name", ref.Name).String()
+		}),
+	)
+	informer := factory.Core().V1().Secrets()
+	if _, err := informer.Informer().AddEventHandler(toolscache.ResourceEventHandlerFuncs{
+		UpdateFunc: func(oldObj, newObj any) {
+			oldSecret, newSecret := oldObj.(*corev1.Secret), newObj.(*corev1.Secret)
+			if string(oldSecret.Data[ref.Key]) != string(newSecret.Data[ref.Key]) {
+				log.FromContext(ctx).Info("kubelet bootstrap token secret changed, new nodes will use the updated token", "secret", types.NamespacedName{Namespace: ref.Namespace, Name: ref.Name}.String())
+			}
+		},
+	}); err != nil {
+		return nil, fmt.Errorf("watching kubelet bootstrap token secret, %w", err)
+	}
+	factory.Start(ctx.Done())
+	for typ, synced := range factory.WaitForCacheSync(ctx.Done()) {
+		if !synced {
+			return nil, fmt.Errorf("waiting for %s informer to sync", typ)
+		}
+	}
+	return &secretProvider{
+		ref:    ref,
+		lister: informer.Lister(),
+	}, nil
+}
+
+func (p *secretProvider) Token(_ context.Context) (string, error) {
+	secret, err := p.lister.Secrets(p.ref.Namespace).Get(p.ref.Name)
+	if err != nil {
+		return "", fmt.Errorf("getting kubelet bootstrap token secret %s/%s, %w", p.ref.Namespace, p.ref.Name, err)
+	}
+	token, ok := secret.Data[p.ref.Key]
+	if !ok || len(token) == 0 {
+		return "", fmt.Errorf("kubelet bootstrap token secret %s/%s has no value for key %q", p.ref.Namespace, p.ref.Name, p.ref.Key)
+	}
+	return string(token), nil
+}
@@ -0,0 +1,84 @@
+/*
+Portions Copyright (c) Microsoft Corporation.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package bootstraptoken
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+
+	"github.com/Azure/karpenter-provider-azure/pkg/operator/options"
+)
+
+func newSecret(token string) *corev1.Secret {
+	return &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "kube-system", Name: "karpenter-bootstrap-token"},
+		Data:       map[string][]byte{"token": []byte(token)},
+	}
+}
+
+func TestSecretProviderPicksUpRotation(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	client := fake.NewSimpleClientset(newSecret("abcdef.0123456789abcdef"))
+	provider, err := NewSecretProvider(ctx, client, options.SecretKeyRef{Namespace: "kube-system", Name: "karpenter-bootstrap-token", Key: "token"})
+	assert.NoError(t, err)
+
+	token, err := provider.Token(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, "abcdef.0123456789abcdef", token)
+
+	_, err = client.CoreV1().Secrets("kube-system").Update(ctx, newSecret("ghijkl.0123456789abcdef"), metav1.UpdateOptions{})
+	assert.NoError(t, err)
+	assert.Eventually(t, func() bool {
+		token, err := provider.Token(ctx)
+		return err == nil && token == "ghijkl.0123456789abcdef"
+	}, 5*time.Second, 10*time.Millisecond)
+}
+
+func TestSecretProviderErrors(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	client := fake.NewSimpleClientset(newSecret("abcdef.0123456789abcdef"))
+
+	provider, err := NewSecretProvider(ctx, client, options.SecretKeyRef{Namespace: "kube-system", Name: "karpenter-bootstrap-token", Key: "missing"})
+	assert.NoError(t, err)
+	_, err = provider.Token(ctx)
+	assert.ErrorContains(t, err, `has no value for key "missing"`)
+
+	provider, err = NewSecretProvider(ctx, client, options.SecretKeyRef{Namespace: "kube-system", Name: "does-not-exist", Key: "token"})
+	assert.NoError(t, err)
+	_, err = provider.Token(ctx)
+	assert.ErrorContains(t, err, "getting kubelet bootstrap token secret kube-system/does-not-exist")
+}
+
+func TestOptionsProvider(t *testing.T) {
+	ctx := options.ToContext(context.Background(), &options.Options{KubeletClientTLSBootstrapToken: "abcdef.0123456789abcdef"})
+	token, err := NewOptionsProvider().Token(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, "abcdef.0123456789abcdef", token)
+
+	_, err = NewOptionsProvider().Token(options.ToContext(context.Background(), &options.Options{}))
+	assert.Error(t, err)
+}
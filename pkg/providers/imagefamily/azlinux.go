@@ -127,17 +127,20 @@ func (u AzureLinux) ScriptlessCustomData(
 ) bootstrap.Bootstrapper {
 	return bootstrap.AKS{
 		Options: bootstrap.Options{
-			ClusterName:      u.Options.ClusterName,
-			ClusterEndpoint:  u.Options.ClusterEndpoint,
-			KubeletConfig:    kubeletConfig,
-			Taints:           taints,
-			Labels:           labels,
-			CABundle:         caBundle,
-			GPUNode:          u.Options.GPUNode,
-			GPUDriverVersion: u.Options.GPUDriverVersion,
-			GPUDriverType:    u.Options.GPUDriverType,
-			GPUImageSHA:      u.Options.GPUImageSHA,
-			SubnetID:         u.Options.SubnetID,
+			ClusterName:               u.Options.ClusterName,
+			ClusterEndpoint:           u.Options.ClusterEndpoint,
+			KubeletConfig:             kubeletConfig,
+			Taints:                    taints,
+			Labels:                    labels,
+			CABundle:                  caBundle,
+			GPUNode:                   u.Options.GPUNode,
+			GPUDriverVersion:          u.Options.GPUDriverVersion,
+			GPUDriverType:             u.Options.GPUDriverType,
+			GPUImageSHA:               u.Options.GPUImageSHA,
+			SubnetID:                  u.Options.SubnetID,
+			CustomCATrustCertificates: u.Options.CustomCATrustCertificates,
+			RootFilesystemMinBytes:    u.Options.RootFilesystemMinBytes,
+			GPUDriverReadyTimeout:     u.Options.GPUDriverReadyTimeout,
 		},
 		Arch:                           u.Options.Arch,
 		TenantID:                       u.Options.TenantID,
@@ -151,6 +154,7 @@ func (u AzureLinux) ScriptlessCustomData(
 		NetworkPlugin:                  u.Options.NetworkPlugin,
 		NetworkPolicy:                  u.Options.NetworkPolicy,
 		KubernetesVersion:              u.Options.KubernetesVersion,
+		KubeletFlagsOverrides:          []bootstrap.KubeletFlagsOverride{bootstrap.AzureLinuxVolumePluginDir},
 	}
 }
 
@@ -25,6 +25,7 @@ import (
 	"github.com/Azure/karpenter-provider-azure/pkg/providers/imagefamily/bootstrap"
 	"github.com/Azure/karpenter-provider-azure/pkg/providers/imagefamily/customscriptsbootstrap"
 	"github.com/Azure/karpenter-provider-azure/pkg/providers/launchtemplate/parameters"
+	"github.com/samber/lo"
 	"github.com/stretchr/testify/assert"
 	v1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/api/resource"
@@ -92,7 +93,7 @@ func TestAzureLinux3_CustomScriptsNodeBootstrapping(t *testing.T) {
 	assert.Equal(t, "test-subscription", provisionBootstrapper.SubscriptionID)
 	assert.Equal(t, "test-rg", provisionBootstrapper.ResourceGroup)
 	assert.Equal(t, "test-cluster-rg", provisionBootstrapper.ClusterResourceGroup)
-	assert.Equal(t, "test-token", provisionBootstrapper.KubeletClientTLSBootstrapToken)
+	assert.Equal(t, "test-token", string(provisionBootstrapper.KubeletClientTLSBootstrapToken))
 	assert.Equal(t, "1.31.0", provisionBootstrapper.KubernetesVersion)
 	assert.Equal(t, imageDistro, provisionBootstrapper.ImageDistro)
 	assert.Equal(t, instanceType, provisionBootstrapper.InstanceType)
@@ -106,3 +107,10 @@ func TestAzureLinux3_Name(t *testing.T) {
 	azureLinux3 := imagefamily.AzureLinux3{}
 	assert.Equal(t, v1beta1.AzureLinuxImageFamily, azureLinux3.Name())
 }
+
+func TestAzureLinux3_ImageFamily(t *testing.T) {
+	// the AzureLinux3 image family is Azure Linux 3.0 before Kubernetes 1.32, unlike the AzureLinux image family
+	assert.IsType(t, &imagefamily.AzureLinux3{}, imagefamily.GetImageFamily(lo.ToPtr(v1beta1.AzureLinux3ImageFamily), nil, "1.31.0", nil))
+	assert.IsType(t, &imagefamily.AzureLinux{}, imagefamily.GetImageFamily(lo.ToPtr(v1beta1.AzureLinuxImageFamily), nil, "1.31.0", nil))
+	assert.IsType(t, &imagefamily.AzureLinux3{}, imagefamily.GetImageFamily(lo.ToPtr(v1beta1.AzureLinux3ImageFamily), nil, "1.33.0", nil))
+}
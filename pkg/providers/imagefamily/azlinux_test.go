@@ -92,7 +92,7 @@ func TestAzureLinux_CustomScriptsNodeBootstrapping(t *testing.T) {
 	assert.Equal(t, "test-subscription", provisionBootstrapper.SubscriptionID)
 	assert.Equal(t, "test-rg", provisionBootstrapper.ResourceGroup)
 	assert.Equal(t, "test-cluster-rg", provisionBootstrapper.ClusterResourceGroup)
-	assert.Equal(t, "test-token", provisionBootstrapper.KubeletClientTLSBootstrapToken)
+	assert.Equal(t, "test-token", string(provisionBootstrapper.KubeletClientTLSBootstrapToken))
 	assert.Equal(t, "1.31.0", provisionBootstrapper.KubernetesVersion)
 	assert.Equal(t, imageDistro, provisionBootstrapper.ImageDistro)
 	assert.Equal(t, instanceType, provisionBootstrapper.InstanceType)
@@ -20,14 +20,16 @@ import (
 	"bytes"
 	"encoding/base64"
 	"fmt"
+	"sort"
 	"strings"
 
 	"github.com/blang/semver/v4"
 	"github.com/samber/lo"
-	v1 "k8s.io/api/core/v1"
 
+	"github.com/Azure/karpenter-provider-azure/pkg/apis/v1beta1"
 	"github.com/Azure/karpenter-provider-azure/pkg/providers/imagefamily/labels"
 	"github.com/Azure/karpenter-provider-azure/pkg/utils"
+	"github.com/Azure/karpenter-provider-azure/pkg/utils/redact"
 
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 )
@@ -43,10 +45,12 @@ type AKS struct {
 	ResourceGroup                  string
 	ClusterID                      string
 	APIServerName                  string
-	KubeletClientTLSBootstrapToken string
+	KubeletClientTLSBootstrapToken redact.Secret
 	NetworkPlugin                  string
 	NetworkPolicy                  string
 	KubernetesVersion              string
+	// KubeletFlagsOverrides are the hooks of the image family for the genuine differences of its distro's kubelet flags
+	KubeletFlagsOverrides []KubeletFlagsOverride
 }
 
 var _ Bootstrapper = (*AKS)(nil) // assert AKS implements Bootstrapper
@@ -220,6 +224,9 @@ type NodeBootstrapVariables struct {
 	KubeCACrt                               string   // x   unique per cluster
 	ContainerdConfigContent                 string   // k   determined by GPU VM size, WASM support, Kata support
 	IsKata                                  bool     // n   user-specified
+	RootFilesystemMinBytes                  int64    // k   computed from the OS disk size of the AKSNodeClass
+	GPUDriverReadyTimeoutSeconds            int64    // k   user-specified, for GPU nodes only
+	GPUDriverReadyCondition                 string   // k   node condition GPU nodes report once their driver is verified
 }
 
 func (a AKS) aksBootstrapScript() (string, error) {
@@ -227,7 +234,9 @@ func (a AKS) aksBootstrapScript() (string, error) {
 	nbv := getStaticNodeBootstrapVars()
 
 	// apply overrides from passed in options
-	a.applyOptions(nbv)
+	if err := a.applyOptions(nbv); err != nil {
+		return "", err
+	}
 
 	containerdConfigTemplate, err := containerdConfigFromNodeBootstrapVars(nbv)
 	if err != nil {
@@ -251,6 +260,24 @@ func kubeBinaryURL(kubernetesVersion, cpuArch string) string {
 // CredentialProviderURL returns the URL for OOT credential provider,
 // or an empty string if OOT provider is not to be used
 func CredentialProviderURL(kubernetesVersion, arch string) string {
+	credentialProviderVersion := credentialProviderVersion(kubernetesVersion)
+	if credentialProviderVersion == "" {
+		return ""
+	}
+	return fmt.Sprintf("%s/cloud-provider-azure/v%s/binaries/azure-acr-credential-provider-linux-%s-v%s.tar.gz", globalAKSMirror, credentialProviderVersion, arch, credentialProviderVersion)
+}
+
+// WindowsCredentialProviderURL returns the download URL of the Windows release of the credential provider of the
+// Kubernetes version, empty when the credential provider isn't used
+func WindowsCredentialProviderURL(kubernetesVersion string) string {
+	credentialProviderVersion := credentialProviderVersion(kubernetesVersion)
+	if credentialProviderVersion == "" {
+		return ""
+	}
+	return fmt.Sprintf("%s/cloud-provider-azure/v%s/binaries/azure-acr-credential-provider-windows-amd64-v%s.tar.gz", globalAKSMirror, credentialProviderVersion, credentialProviderVersion)
+}
+
+func credentialProviderVersion(kubernetesVersion string) string {
 	minorVersion := semver.MustParse(kubernetesVersion).Minor
 	if minorVersion < 30 { // use from 1.30; 1.29 supports it too, but we have not fully tested it with Karpenter
 		return ""
@@ -259,29 +286,26 @@ func CredentialProviderURL(kubernetesVersion, arch string) string {
 	// credential provider has its own release outside of k8s version, and there'll be one credential provider binary for each k8s release,
 	// as credential provider release goes with cloud-provider-azure, not every credential provider release will be picked up unless
 	// there are CVE or bug fixes.
-	var credentialProviderVersion string
 	switch minorVersion {
 	case 29:
-		credentialProviderVersion = "1.29.15"
+		return "1.29.15"
 	case 30:
-		credentialProviderVersion = "1.30.12"
+		return "1.30.12"
 	case 31:
-		credentialProviderVersion = "1.31.6"
+		return "1.31.6"
 	case 32:
-		credentialProviderVersion = "1.32.5"
+		return "1.32.5"
 	case 33:
 		fallthrough // to default, which is same as latest
 	default:
-		credentialProviderVersion = "1.33.0"
+		return "1.33.0"
 	}
-
-	return fmt.Sprintf("%s/cloud-provider-azure/v%s/binaries/azure-acr-credential-provider-linux-%s-v%s.tar.gz", globalAKSMirror, credentialProviderVersion, arch, credentialProviderVersion)
 }
 
-func (a AKS) applyOptions(nbv *NodeBootstrapVariables) {
+func (a AKS) applyOptions(nbv *NodeBootstrapVariables) error {
 	nbv.KubeCACrt = *a.CABundle
 	nbv.APIServerName = a.APIServerName
-	nbv.TLSBootstrapToken = a.KubeletClientTLSBootstrapToken
+	nbv.TLSBootstrapToken = string(a.KubeletClientTLSBootstrapToken)
 
 	nbv.TenantID = a.TenantID
 	nbv.SubscriptionID = a.SubscriptionID
@@ -295,18 +319,27 @@ func (a AKS) applyOptions(nbv *NodeBootstrapVariables) {
 	nbv.KubernetesVersion = a.KubernetesVersion
 
 	nbv.KubeBinaryURL = kubeBinaryURL(a.KubernetesVersion, a.Arch)
-	nbv.VNETCNILinuxPluginsURL = fmt.Sprintf("%s/azure-cni/v1.4.32/binaries/azure-vnet-cni-linux-%s-v1.4.32.tgz", globalAKSMirror, a.Arch)
+	nbv.VNETCNILinuxPluginsURL = fmt.Sprintf("%s/azure-cni/%s/binaries/azure-vnet-cni-linux-%s-%s.tgz", globalAKSMirror, azureCNIVersion, a.Arch, azureCNIVersion)
 	nbv.CNIPluginsURL = fmt.Sprintf("%s/cni-plugins/v1.1.1/binaries/cni-plugins-linux-%s-v1.1.1.tgz", globalAKSMirror, a.Arch)
 	// calculated values
 	nbv.NetworkSecurityGroup = fmt.Sprintf("aks-agentpool-%s-nsg", a.ClusterID)
 	nbv.RouteTable = fmt.Sprintf("aks-agentpool-%s-routetable", a.ClusterID)
 
+	if len(a.CustomCATrustCertificates) > 0 {
+		nbv.ShouldConfigureCustomCATrust = true
+		nbv.CustomCATrustConfigCerts = a.CustomCATrustCertificates
+	}
+
+	nbv.RootFilesystemMinBytes = a.RootFilesystemMinBytes
+
 	if a.GPUNode {
 		nbv.GPUNode = true
 		nbv.ConfigGPUDriverIfNeeded = true
 		nbv.GPUDriverVersion = a.GPUDriverVersion
 		nbv.GPUDriverType = a.GPUDriverType
 		nbv.GPUImageSHA = a.GPUImageSHA
+		nbv.GPUDriverReadyTimeoutSeconds = int64(a.GPUDriverReadyTimeout.Seconds())
+		nbv.GPUDriverReadyCondition = string(v1beta1.NodeConditionTypeGPUDriverReady)
 	}
 
 	// merge and stringify labels
@@ -322,38 +355,29 @@ func (a AKS) applyOptions(nbv *NodeBootstrapVariables) {
 		return fmt.Sprintf("%s=%s", k, v)
 	}), ",")
 
-	// Assign Per K8s version kubelet flags
-	minorVersion := semver.MustParse(a.KubernetesVersion).Minor
-	kubeletFlagsBase := getBaseKubeletFlags()
-	if minorVersion < 31 {
-		kubeletFlagsBase["--keep-terminated-pod-volumes"] = "false"
+	nbv.CredentialProviderDownloadURL = CredentialProviderURL(a.KubernetesVersion, a.Arch)
+	nbv.NeedsCgroupV2 = cgroupModeOf(a.KubeletConfig) == CgroupModeV2
+	kubeletFlags, err := KubeletFlagsBuilder{
+		KubernetesVersion: a.KubernetesVersion,
+		Arch:              a.Arch,
+		KubeletConfig:     a.KubeletConfig,
+		Taints:            a.Taints,
+		Overrides:         a.KubeletFlagsOverrides,
+	}.Build()
+	if err != nil {
+		return err
 	}
+	nbv.KubeletFlags = FormatKubeletFlags(kubeletFlags)
+	return nil
+}
 
-	credentialProviderURL := CredentialProviderURL(a.KubernetesVersion, a.Arch)
-	if credentialProviderURL != "" { // use OOT credential provider
-		nbv.CredentialProviderDownloadURL = credentialProviderURL
-		kubeletFlagsBase["--image-credential-provider-config"] = "/var/lib/kubelet/credential-provider-config.yaml"
-		kubeletFlagsBase["--image-credential-provider-bin-dir"] = "/var/lib/kubelet/credential-provider"
-	} else { // Versions Less than 1.30
-		// we can make this logic smarter later when we have more than one
-		// for now just adding here.
-		kubeletFlagsBase["--feature-gates"] = "DisableKubeletCloudCredentialProviders=false"
-		kubeletFlagsBase["--azure-container-registry-config"] = "/etc/kubernetes/azure.json"
-	}
-	// merge and stringify taints
-	kubeletFlags := lo.Assign(kubeletFlagsBase)
-	if len(a.Taints) > 0 {
-		taintStrs := lo.Map(a.Taints, func(taint v1.Taint, _ int) string { return taint.ToString() })
-		kubeletFlags = lo.Assign(kubeletFlags, map[string]string{"--register-with-taints": strings.Join(taintStrs, ",")})
+// CgroupDriver returns the cgroup driver matching the cgroup mode: systemd manages the unified hierarchy of cgroup v2,
+// while the cgroup v1 images are set up for cgroupfs
+func CgroupDriver(cgroupMode string) string {
+	if cgroupMode == CgroupModeV1 {
+		return "cgroupfs"
 	}
-
-	nodeclaimKubeletConfig := kubeletConfigToMap(a.KubeletConfig)
-	kubeletFlags = lo.Assign(kubeletFlags, nodeclaimKubeletConfig)
-
-	// stringify kubelet flags (including taints)
-	nbv.KubeletFlags = strings.Join(lo.MapToSlice(kubeletFlags, func(k, v string) string {
-		return fmt.Sprintf("%s=%s", k, v)
-	}), " ")
+	return "systemd"
 }
 
 func containerdConfigFromNodeBootstrapVars(nbv *NodeBootstrapVariables) (string, error) {
@@ -425,8 +449,18 @@ func kubeletConfigToMap(kubeletConfig *KubeletConfiguration) map[string]string {
 	return args
 }
 
+// HardenedKubeletFlags returns the kubelet flags disabling the read-only port and anonymous authentication, and
+// authorizing requests through the API server, unless overridden by insecureKubeletDefaults
+func HardenedKubeletFlags(insecureDefaults *v1beta1.InsecureKubeletDefaults) map[string]string {
+	return map[string]string{
+		"--read-only-port":     fmt.Sprintf("%d", insecureDefaults.GetReadOnlyPort()),
+		"--anonymous-auth":     fmt.Sprintf("%t", insecureDefaults.GetAnonymousAuth()),
+		"--authorization-mode": insecureDefaults.GetAuthorizationMode(),
+	}
+}
+
 // joinParameterArgsToMap joins a map of keys and values by their separator. The separator will sit between the
-// arguments in a comma-separated list i.e. arg1<sep>val1,arg2<sep>val2
+// arguments in a comma-separated list i.e. arg1<sep>val1,arg2<sep>val2, sorted so that the same map always renders the same
 func JoinParameterArgsToMap[K comparable, V any](result map[string]string, name string, m map[K]V, separator string) {
 	var args []string
 
@@ -434,6 +468,7 @@ func JoinParameterArgsToMap[K comparable, V any](result map[string]string, name
 		args = append(args, fmt.Sprintf("%v%s%v", k, separator, v))
 	}
 	if len(args) > 0 {
+		sort.Strings(args)
 		result[name] = strings.Join(args, ",")
 	}
 }
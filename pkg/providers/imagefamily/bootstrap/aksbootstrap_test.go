@@ -18,6 +18,7 @@ package bootstrap
 
 import (
 	"fmt"
+	"strings"
 	"testing"
 	"time"
 
@@ -190,3 +191,96 @@ func TestKubeletConfigMap(t *testing.T) {
 		assert.Equal(t, v, actualKubeletConfig[k], fmt.Sprintf("parameter mismatch for %s", k))
 	}
 }
+
+func TestCustomCATrust(t *testing.T) {
+	const certificate = "-----BEGIN CERTIFICATE-----\nMIIBsTCCAVegAwIBAgIUTest\n-----END CERTIFICATE-----\n"
+	aks := AKS{
+		Options: Options{
+			ClusterName:               "test-cluster",
+			ClusterEndpoint:           "https://test-cluster",
+			KubeletConfig:             &KubeletConfiguration{MaxPods: 30},
+			CABundle:                  lo.ToPtr("dGVzdC1jYS1idW5kbGU="),
+			SubnetID:                  "/subscriptions/12345678-1234-1234-1234-123456789012/resourceGroups/test-rg/providers/Microsoft.Network/virtualNetworks/test-vnet/subnets/test-subnet",
+			CustomCATrustCertificates: []string{certificate},
+		},
+		Arch:              "amd64",
+		APIServerName:     "test-cluster",
+		KubernetesVersion: "1.31.0",
+	}
+	customData, err := aks.Script()
+	assert.NoError(t, err)
+	rendered := RenderForDebug(customData)
+	assert.Contains(t, rendered, `SHOULD_CONFIGURE_CUSTOM_CA_TRUST="true"`)
+	assert.Contains(t, rendered, `CUSTOM_CA_TRUST_COUNT="1"`)
+	assert.Contains(t, rendered, `CUSTOM_CA_CERT_0="`+certificate+`"`)
+
+	aks.CustomCATrustCertificates = nil
+	customData, err = aks.Script()
+	assert.NoError(t, err)
+	rendered = RenderForDebug(customData)
+	assert.Contains(t, rendered, `SHOULD_CONFIGURE_CUSTOM_CA_TRUST="false"`)
+	assert.Contains(t, rendered, `CUSTOM_CA_TRUST_COUNT="0"`)
+}
+
+func TestRootFilesystemGrowth(t *testing.T) {
+	aks := AKS{
+		Options: Options{
+			ClusterName:            "test-cluster",
+			ClusterEndpoint:        "https://test-cluster",
+			KubeletConfig:          &KubeletConfiguration{MaxPods: 30},
+			CABundle:               lo.ToPtr("dGVzdC1jYS1idW5kbGU="),
+			SubnetID:               "/subscriptions/12345678-1234-1234-1234-123456789012/resourceGroups/test-rg/providers/Microsoft.Network/virtualNetworks/test-vnet/subnets/test-subnet",
+			RootFilesystemMinBytes: 512000000000,
+		},
+		Arch:              "amd64",
+		APIServerName:     "test-cluster",
+		KubernetesVersion: "1.31.0",
+	}
+	customData, err := aks.Script()
+	assert.NoError(t, err)
+	rendered := RenderForDebug(customData)
+	assert.Contains(t, rendered, "ROOT_FILESYSTEM_MIN_BYTES=512000000000")
+	assert.Contains(t, rendered, "growpart")
+	// the root filesystem is grown before the kubelet starts
+	assert.Less(t, strings.Index(rendered, "growpart"), strings.Index(rendered, "provision_start.sh"))
+
+	aks.RootFilesystemMinBytes = 0
+	customData, err = aks.Script()
+	assert.NoError(t, err)
+	assert.NotContains(t, RenderForDebug(customData), "growpart")
+}
+
+func TestGPUDriverReady(t *testing.T) {
+	aks := AKS{
+		Options: Options{
+			ClusterName:           "test-cluster",
+			ClusterEndpoint:       "https://test-cluster",
+			KubeletConfig:         &KubeletConfiguration{MaxPods: 30},
+			CABundle:              lo.ToPtr("dGVzdC1jYS1idW5kbGU="),
+			SubnetID:              "/subscriptions/12345678-1234-1234-1234-123456789012/resourceGroups/test-rg/providers/Microsoft.Network/virtualNetworks/test-vnet/subnets/test-subnet",
+			GPUNode:               true,
+			GPUDriverReadyTimeout: 15 * time.Minute,
+		},
+		Arch:              "amd64",
+		APIServerName:     "test-cluster",
+		KubernetesVersion: "1.31.0",
+	}
+	customData, err := aks.Script()
+	assert.NoError(t, err)
+	rendered := RenderForDebug(customData)
+	assert.Contains(t, rendered, "karpenter-gpu-driver-ready.sh 900 GPUDriverReady")
+	assert.Contains(t, rendered, "nvidia-smi")
+	// the driver is verified in the background, while the node provisions
+	assert.Less(t, strings.Index(rendered, "karpenter-gpu-driver-ready.sh 900"), strings.Index(rendered, "provision_start.sh"))
+
+	aks.GPUDriverReadyTimeout = 0
+	customData, err = aks.Script()
+	assert.NoError(t, err)
+	assert.NotContains(t, RenderForDebug(customData), "karpenter-gpu-driver-ready.sh")
+
+	aks.GPUNode = false
+	aks.GPUDriverReadyTimeout = 15 * time.Minute
+	customData, err = aks.Script()
+	assert.NoError(t, err)
+	assert.NotContains(t, RenderForDebug(customData), "karpenter-gpu-driver-ready.sh")
+}
@@ -17,6 +17,8 @@ limitations under the License.
 package bootstrap
 
 import (
+	"time"
+
 	"github.com/Azure/karpenter-provider-azure/pkg/apis/v1beta1"
 	core "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
@@ -42,8 +44,16 @@ type KubeletConfiguration struct {
 	// EvictionMaxPodGracePeriod is the maximum allowed grace period (in seconds) to use when terminating pods in
 	// response to soft eviction thresholds being met.
 	EvictionMaxPodGracePeriod *int32
+	// CgroupMode is the cgroup mode of the image, CgroupModeV1 or CgroupModeV2 (the default), which the cgroup driver of
+	// the kubelet and of containerd follow
+	CgroupMode string
 }
 
+const (
+	CgroupModeV1 = "v1"
+	CgroupModeV2 = "v2"
+)
+
 // Options is the node bootstrapping parameters passed from Karpenter to the provisioning node
 type Options struct {
 	ClusterName      string
@@ -57,6 +67,14 @@ type Options struct {
 	GPUDriverType    string
 	GPUImageSHA      string
 	SubnetID         string
+	// CustomCATrustCertificates are PEM certificates added to the trust store of the node
+	CustomCATrustCertificates []string
+	// RootFilesystemMinBytes is the size the root filesystem is grown to, at least, before the kubelet starts. Some image
+	// versions don't grow the root filesystem to the OS disk, leaving the rest of the disk unused.
+	RootFilesystemMinBytes int64
+	// GPUDriverReadyTimeout is how long GPU nodes try to verify their GPU driver, to report the GPU driver ready
+	// condition that their GPU initializing taint is removed on. GPU nodes don't report it when 0.
+	GPUDriverReadyTimeout time.Duration
 }
 
 // Bootstrapper can be implemented to generate a bootstrap script
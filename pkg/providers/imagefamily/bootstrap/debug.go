@@ -0,0 +1,38 @@
+/*
+Portions Copyright (c) Microsoft Corporation.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package bootstrap
+
+import (
+	"encoding/base64"
+	"unicode/utf8"
+
+	"github.com/Azure/karpenter-provider-azure/pkg/utils/redact"
+)
+
+// RedactedValue is what secrets are replaced with in debug renderings of bootstrap payloads
+const RedactedValue = redact.Value
+
+// RenderForDebug turns a bootstrap payload (base64 encoded customData, or a plain CSE command) into
+// human-readable text with tokens and secrets masked, so that it can be surfaced for debugging.
+// Any additional known secret values (e.g. the configured bootstrap token) are masked wherever they appear.
+func RenderForDebug(payload string, secrets ...string) string {
+	rendered := payload
+	if decoded, err := base64.StdEncoding.DecodeString(payload); err == nil && utf8.Valid(decoded) {
+		rendered = string(decoded)
+	}
+	return redact.String(rendered, secrets...)
+}
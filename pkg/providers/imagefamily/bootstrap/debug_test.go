@@ -0,0 +1,99 @@
+/*
+Portions Copyright (c) Microsoft Corporation.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package bootstrap
+
+import (
+	"encoding/base64"
+	"testing"
+
+	"github.com/samber/lo"
+	"github.com/stretchr/testify/assert"
+)
+
+const testBootstrapToken = "abcdef.0123456789abcdef"
+
+func TestRenderForDebugRedactsAKSScript(t *testing.T) {
+	aks := AKS{
+		Options: Options{
+			ClusterName:     "test-cluster",
+			ClusterEndpoint: "https://test-cluster",
+			KubeletConfig:   &KubeletConfiguration{MaxPods: 30},
+			CABundle:        lo.ToPtr("dGVzdC1jYS1idW5kbGU="),
+			SubnetID:        "/subscriptions/12345678-1234-1234-1234-123456789012/resourceGroups/test-rg/providers/Microsoft.Network/virtualNetworks/test-vnet/subnets/test-subnet",
+		},
+		Arch:                           "amd64",
+		APIServerName:                  "test-cluster",
+		KubeletClientTLSBootstrapToken: testBootstrapToken,
+		KubernetesVersion:              "1.31.0",
+	}
+	customData, err := aks.Script()
+	assert.NoError(t, err)
+
+	rendered := RenderForDebug(customData)
+	assert.NotContains(t, rendered, testBootstrapToken)
+	assert.NotContains(t, rendered, "0123456789abcdef")
+	assert.Contains(t, rendered, `TLS_BOOTSTRAP_TOKEN="`+RedactedValue+`"`)
+	// Non-sensitive values are preserved so the rendering remains useful
+	assert.Contains(t, rendered, "KUBERNETES_VERSION=1.31.0")
+}
+
+func TestRenderForDebug(t *testing.T) {
+	cases := []struct {
+		name        string
+		payload     string
+		secrets     []string
+		mustNotHave []string
+		mustHave    []string
+	}{
+		{
+			name:        "plain CSE command",
+			payload:     `TLS_BOOTSTRAP_TOKEN="` + testBootstrapToken + `" /opt/azure/containers/provision_start.sh`,
+			mustNotHave: []string{testBootstrapToken},
+			mustHave:    []string{"/opt/azure/containers/provision_start.sh"},
+		},
+		{
+			name:        "unquoted variable",
+			payload:     base64.StdEncoding.EncodeToString([]byte("CUSTOM_SEARCH_REALM_PASSWORD=hunter2\nLOCATION=westus2")),
+			mustNotHave: []string{"hunter2"},
+			mustHave:    []string{"LOCATION=westus2"},
+		},
+		{
+			name:        "bootstrap token embedded outside of a known variable",
+			payload:     base64.StdEncoding.EncodeToString([]byte("token: " + testBootstrapToken + "\n")),
+			mustNotHave: []string{testBootstrapToken},
+		},
+		{
+			name:        "explicitly provided secret in a non-standard format",
+			payload:     "some-command --token=not-a-standard-token-format",
+			secrets:     []string{"not-a-standard-token-format", ""},
+			mustNotHave: []string{"not-a-standard-token-format"},
+			mustHave:    []string{"some-command --token=" + RedactedValue},
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			rendered := RenderForDebug(tc.payload, tc.secrets...)
+			for _, s := range tc.mustNotHave {
+				assert.NotContains(t, rendered, s)
+			}
+			for _, s := range tc.mustHave {
+				assert.Contains(t, rendered, s)
+			}
+		})
+	}
+}
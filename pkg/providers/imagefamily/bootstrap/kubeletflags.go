@@ -0,0 +1,106 @@
+/*
+Portions Copyright (c) Microsoft Corporation.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package bootstrap
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/blang/semver/v4"
+	"github.com/samber/lo"
+	v1 "k8s.io/api/core/v1"
+
+	"github.com/Azure/karpenter-provider-azure/pkg/apis/v1beta1"
+)
+
+// KubeletFlagsOverride adjusts the kubelet flags where the distro of an image family genuinely differs from the others.
+// It can't override the cgroup driver, which follows the cgroup mode of the image for all image families.
+type KubeletFlagsOverride func(kubeletFlags map[string]string)
+
+// AzureLinuxVolumePluginDir moves the directory of the FlexVolume plugins out of /usr, which is read-only on Azure Linux,
+// to where AKS installs them on its Azure Linux nodes
+func AzureLinuxVolumePluginDir(kubeletFlags map[string]string) {
+	kubeletFlags["--volume-plugin-dir"] = "/etc/kubernetes/volumeplugins"
+}
+
+// KubeletFlagsBuilder assembles the kubelet flags of the scriptless bootstrap, the same way for all image families: the
+// base flags, those of the Kubernetes version, the taints, the kubelet configuration of the nodeclass, and the hardening,
+// then the overrides of the image family, and finally the cgroup driver of the cgroup mode of the image.
+type KubeletFlagsBuilder struct {
+	KubernetesVersion string
+	Arch              string
+	KubeletConfig     *KubeletConfiguration
+	Taints            []v1.Taint
+	// Overrides are the hooks of the image family, applied in order
+	Overrides []KubeletFlagsOverride
+}
+
+func (b KubeletFlagsBuilder) Build() (map[string]string, error) {
+	cgroupMode := cgroupModeOf(b.KubeletConfig)
+	if cgroupMode != CgroupModeV1 && cgroupMode != CgroupModeV2 {
+		return nil, fmt.Errorf("unknown cgroup mode %q", cgroupMode)
+	}
+
+	kubeletFlags := getBaseKubeletFlags()
+	if semver.MustParse(b.KubernetesVersion).Minor < 31 {
+		kubeletFlags["--keep-terminated-pod-volumes"] = "false"
+	}
+	if CredentialProviderURL(b.KubernetesVersion, b.Arch) != "" { // use OOT credential provider
+		kubeletFlags["--image-credential-provider-config"] = "/var/lib/kubelet/credential-provider-config.yaml"
+		kubeletFlags["--image-credential-provider-bin-dir"] = "/var/lib/kubelet/credential-provider"
+	} else { // Versions Less than 1.30
+		kubeletFlags["--feature-gates"] = "DisableKubeletCloudCredentialProviders=false"
+		kubeletFlags["--azure-container-registry-config"] = "/etc/kubernetes/azure.json"
+	}
+	if len(b.Taints) > 0 {
+		taintStrs := lo.Map(b.Taints, func(taint v1.Taint, _ int) string { return taint.ToString() })
+		kubeletFlags["--register-with-taints"] = strings.Join(taintStrs, ",")
+	}
+
+	kubeletFlags = lo.Assign(kubeletFlags, kubeletConfigToMap(b.KubeletConfig))
+	// the hardening is always rendered explicitly, rather than relying on the defaults of the image
+	var insecureDefaults *v1beta1.InsecureKubeletDefaults
+	if b.KubeletConfig != nil {
+		insecureDefaults = b.KubeletConfig.InsecureKubeletDefaults
+	}
+	kubeletFlags = lo.Assign(kubeletFlags, HardenedKubeletFlags(insecureDefaults))
+
+	for _, override := range b.Overrides {
+		override(kubeletFlags)
+	}
+
+	// the cgroup driver of the kubelet and of containerd (SystemdCgroup) both follow the cgroup mode of the image
+	kubeletFlags["--cgroup-driver"] = CgroupDriver(cgroupMode)
+	return kubeletFlags, nil
+}
+
+// FormatKubeletFlags stringifies the kubelet flags, sorted by name so that the same flags always render the same
+func FormatKubeletFlags(kubeletFlags map[string]string) string {
+	flags := lo.MapToSlice(kubeletFlags, func(k, v string) string {
+		return fmt.Sprintf("%s=%s", k, v)
+	})
+	sort.Strings(flags)
+	return strings.Join(flags, " ")
+}
+
+func cgroupModeOf(kubeletConfig *KubeletConfiguration) string {
+	if kubeletConfig == nil || kubeletConfig.CgroupMode == "" {
+		return CgroupModeV2
+	}
+	return kubeletConfig.CgroupMode
+}
@@ -0,0 +1,64 @@
+/*
+Portions Copyright (c) Microsoft Corporation.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package bootstrap
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestKubeletFlagsBuilderOverrides(t *testing.T) {
+	builder := KubeletFlagsBuilder{
+		KubernetesVersion: "1.31.0",
+		Arch:              "amd64",
+		KubeletConfig:     &KubeletConfiguration{MaxPods: 30, CgroupMode: CgroupModeV1},
+		Overrides: []KubeletFlagsOverride{
+			func(kubeletFlags map[string]string) { kubeletFlags["--resolv-conf"] = "/etc/resolv.conf" },
+			func(kubeletFlags map[string]string) { delete(kubeletFlags, "--event-qps") },
+			// the cgroup driver follows the cgroup mode of the image, whatever the image family
+			func(kubeletFlags map[string]string) { kubeletFlags["--cgroup-driver"] = "systemd" },
+		},
+	}
+	kubeletFlags, err := builder.Build()
+	assert.NoError(t, err)
+	assert.Equal(t, "/etc/resolv.conf", kubeletFlags["--resolv-conf"])
+	assert.NotContains(t, kubeletFlags, "--event-qps")
+	assert.Equal(t, "cgroupfs", kubeletFlags["--cgroup-driver"])
+	assert.Equal(t, "30", kubeletFlags["--max-pods"])
+
+	builder.Overrides = nil
+	kubeletFlags, err = builder.Build()
+	assert.NoError(t, err)
+	assert.Equal(t, "/run/systemd/resolve/resolv.conf", kubeletFlags["--resolv-conf"])
+	assert.Equal(t, "0", kubeletFlags["--event-qps"])
+	assert.Equal(t, "cgroupfs", kubeletFlags["--cgroup-driver"])
+
+	builder.KubeletConfig.CgroupMode = CgroupModeV2
+	kubeletFlags, err = builder.Build()
+	assert.NoError(t, err)
+	assert.Equal(t, "systemd", kubeletFlags["--cgroup-driver"])
+
+	builder.KubeletConfig.CgroupMode = "v3"
+	_, err = builder.Build()
+	assert.EqualError(t, err, `unknown cgroup mode "v3"`)
+}
+
+func TestFormatKubeletFlags(t *testing.T) {
+	assert.Equal(t, "--a=1 --b=2 --c=x=y", FormatKubeletFlags(map[string]string{"--c": "x=y", "--a": "1", "--b": "2"}))
+	assert.Equal(t, "", FormatKubeletFlags(map[string]string{}))
+}
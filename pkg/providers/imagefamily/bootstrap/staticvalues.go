@@ -25,6 +25,8 @@ import (
 
 const (
 	globalAKSMirror = "https://acs-mirror.azureedge.net"
+	// azureCNIVersion is the version of Azure CNI installed on Linux and Windows nodes
+	azureCNIVersion = "v1.4.32"
 )
 
 // NOTE: embed only works on vars not defined in a function, so without putting this into an internal package for encapulation, we are stuck with these remaining vars.
@@ -37,12 +39,19 @@ var (
 
 	//go:embed sysctl.conf
 	sysctlContent []byte
+
+	//go:embed windows_cse.ps1.gtpl
+	windowsCustomDataTemplateText string
 )
 
 func getCustomDataTemplate() *template.Template {
 	return template.Must(template.New("customdata").Parse(customDataTemplateText))
 }
 
+func getWindowsCustomDataTemplate() *template.Template {
+	return template.Must(template.New("windowscustomdata").Parse(windowsCustomDataTemplateText))
+}
+
 func getContainerdConfigTemplate() *template.Template {
 	return template.Must(template.New("containerdconfig").Parse(containerdConfigTemplateText))
 }
@@ -55,9 +64,7 @@ func getBaseKubeletFlags() map[string]string {
 	// removed --keep-terminated-pod-volumes (not in 1.31)
 	return map[string]string{
 		"--address":                           "0.0.0.0",
-		"--anonymous-auth":                    "false",
 		"--authentication-token-webhook":      "true",
-		"--authorization-mode":                "Webhook",
 		"--cgroups-per-qos":                   "true",
 		"--client-ca-file":                    "/etc/kubernetes/certs/ca.crt",
 		"--cloud-config":                      "/etc/kubernetes/azure.json",
@@ -76,7 +83,6 @@ func getBaseKubeletFlags() map[string]string {
 		"--pod-manifest-path":                 "/etc/kubernetes/manifests",
 		"--pod-max-pids":                      "-1",
 		"--protect-kernel-defaults":           "true",
-		"--read-only-port":                    "0",
 		"--resolv-conf":                       "/run/systemd/resolve/resolv.conf",
 		"--rotate-certificates":               "true",
 		"--streaming-connection-idle-timeout": "4h",
@@ -86,6 +92,34 @@ func getBaseKubeletFlags() map[string]string {
 	}
 }
 
+func getBaseWindowsKubeletFlags() map[string]string {
+	// the flags of AKS Windows nodes, with the bootstrap kubeconfig of the TLS bootstrapping
+	return map[string]string{
+		"--address":                           "0.0.0.0",
+		"--authentication-token-webhook":      "true",
+		"--bootstrap-kubeconfig":              `c:\k\bootstrap-config`,
+		"--cert-dir":                          `c:\k\pki`,
+		"--cgroups-per-qos":                   "false",
+		"--client-ca-file":                    `c:\k\ca.crt`,
+		"--cloud-provider":                    "external",
+		"--cluster-dns":                       "10.0.0.10",
+		"--cluster-domain":                    "cluster.local",
+		"--container-runtime-endpoint":        "npipe://./pipe/containerd-containerd",
+		"--enforce-node-allocatable":          `""`,
+		"--event-qps":                         "0",
+		"--eviction-hard":                     `""`,
+		"--hairpin-mode":                      "promiscuous-bridge",
+		"--image-gc-high-threshold":           "85",
+		"--image-gc-low-threshold":            "80",
+		"--kubeconfig":                        `c:\k\config`,
+		"--max-pods":                          "30",
+		"--node-status-update-frequency":      "10s",
+		"--resolv-conf":                       `""`,
+		"--rotate-certificates":               "true",
+		"--streaming-connection-idle-timeout": "4h",
+	}
+}
+
 func getBaseKubeletNodeLabels() map[string]string {
 	return map[string]string{
 		"kubernetes.azure.com/mode": "user",
@@ -93,7 +127,7 @@ func getBaseKubeletNodeLabels() map[string]string {
 }
 
 func getStaticNodeBootstrapVars() *NodeBootstrapVariables {
-	vnetCNILinuxPluginsURL := fmt.Sprintf("%s/azure-cni/v1.4.32/binaries/azure-vnet-cni-linux-amd64-v1.4.32.tgz", globalAKSMirror)
+	vnetCNILinuxPluginsURL := fmt.Sprintf("%s/azure-cni/%s/binaries/azure-vnet-cni-linux-amd64-%s.tgz", globalAKSMirror, azureCNIVersion, azureCNIVersion)
 	cniPluginsURL := fmt.Sprintf("%s/cni-plugins/v1.1.1/binaries/cni-plugins-linux-amd64-v1.1.1.tgz", globalAKSMirror)
 
 	// baseline, covering unused (-), static (s), and unsupported (n) fields,
@@ -199,7 +233,7 @@ func getStaticNodeBootstrapVars() *NodeBootstrapVariables {
 		AzureEnvironmentFilepath:                "",                                                                  // s
 		ContainerdConfigContent:                 "",                                                                  // kd
 		IsKata:                                  false,                                                               // n
-		NeedsCgroupV2:                           true,                                                                // s only static for karpenter
+		NeedsCgroupV2:                           true,                                                                // s default, follows the cgroup mode of the image
 		EnsureNoDupePromiscuousBridge:           false,                                                               // s karpenter does not support kubenet
 	}
 }
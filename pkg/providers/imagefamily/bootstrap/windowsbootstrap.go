@@ -0,0 +1,161 @@
+/*
+Portions Copyright (c) Microsoft Corporation.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package bootstrap
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"strings"
+
+	"github.com/blang/semver/v4"
+	"github.com/samber/lo"
+	v1 "k8s.io/api/core/v1"
+
+	"github.com/Azure/karpenter-provider-azure/pkg/apis/v1beta1"
+	"github.com/Azure/karpenter-provider-azure/pkg/providers/imagefamily/labels"
+	"github.com/Azure/karpenter-provider-azure/pkg/utils"
+	"github.com/Azure/karpenter-provider-azure/pkg/utils/redact"
+)
+
+// WindowsCSECommand is the command of the CSE of Windows nodes. Windows doesn't run the custom data of the VM, which is
+// saved as is to CustomData.bin, so the CSE runs it as the bootstrap script.
+const WindowsCSECommand = `powershell.exe -ExecutionPolicy Unrestricted -command "$inputFile = '%SYSTEMDRIVE%\AzureData\CustomData.bin'; ` +
+	`$outputFile = '%SYSTEMDRIVE%\AzureData\CustomDataSetupScript.ps1'; Copy-Item $inputFile $outputFile; & $outputFile"`
+
+// Windows bootstraps Windows nodes with a PowerShell script, rather than the cloud-init script of AKS, which doesn't
+// apply to Windows
+type Windows struct {
+	Options
+
+	TenantID                       string
+	SubscriptionID                 string
+	KubeletIdentityClientID        string
+	Location                       string
+	ResourceGroup                  string
+	APIServerName                  string
+	KubeletClientTLSBootstrapToken redact.Secret
+	KubernetesVersion              string
+}
+
+var _ Bootstrapper = (*Windows)(nil) // assert Windows implements Bootstrapper
+
+// linuxOnlyKubeletFlags are the kubelet flags of the kubelet configuration of the nodeclass that Windows doesn't support,
+// for relying on cgroups or sysctls
+var linuxOnlyKubeletFlags = []string{
+	"--allowed-unsafe-sysctls",
+	"--cpu-cfs-quota",
+	"--cpu-manager-policy",
+	"--pod-max-pids",
+	"--topology-manager-policy",
+}
+
+// WindowsBootstrapVariables carries the variables rendering the bootstrap script of Windows nodes
+type WindowsBootstrapVariables struct {
+	KubeBinaryURL                 string
+	VNETCNIWindowsPluginsURL      string
+	CredentialProviderDownloadURL string
+	KubeCACrt                     string
+	APIServerName                 string
+	TLSBootstrapToken             string
+	TenantID                      string
+	SubscriptionID                string
+	ResourceGroup                 string
+	Location                      string
+	Subnet                        string
+	VirtualNetwork                string
+	VirtualNetworkResourceGroup   string
+	UserAssignedIdentityID        string
+	ClusterDNSServiceIP           string
+	KubeletNodeLabels             string
+	KubeletFlags                  string
+}
+
+func (w Windows) Script() (string, error) {
+	var buffer bytes.Buffer
+	if err := getWindowsCustomDataTemplate().Execute(&buffer, w.bootstrapVariables()); err != nil {
+		return "", fmt.Errorf("error executing windows custom data template: %w", err)
+	}
+	return base64.StdEncoding.EncodeToString(buffer.Bytes()), nil
+}
+
+func (w Windows) bootstrapVariables() WindowsBootstrapVariables {
+	subnetParts, _ := utils.GetVnetSubnetIDComponents(w.SubnetID)
+	kubeletLabels := lo.Assign(getBaseKubeletNodeLabels(), w.Labels)
+	labels.AddAgentBakerGeneratedLabels(w.ResourceGroup, w.KubeletIdentityClientID, kubeletLabels)
+
+	wbv := WindowsBootstrapVariables{
+		KubeBinaryURL:               windowsKubeBinaryURL(w.KubernetesVersion),
+		VNETCNIWindowsPluginsURL:    fmt.Sprintf("%s/azure-cni/%s/binaries/azure-vnet-cni-windows-amd64-%s.zip", globalAKSMirror, azureCNIVersion, azureCNIVersion),
+		KubeCACrt:                   lo.FromPtr(w.CABundle),
+		APIServerName:               w.APIServerName,
+		TLSBootstrapToken:           string(w.KubeletClientTLSBootstrapToken),
+		TenantID:                    w.TenantID,
+		SubscriptionID:              w.SubscriptionID,
+		ResourceGroup:               w.ResourceGroup,
+		Location:                    w.Location,
+		Subnet:                      subnetParts.SubnetName,
+		VirtualNetwork:              subnetParts.VNetName,
+		VirtualNetworkResourceGroup: subnetParts.ResourceGroupName,
+		UserAssignedIdentityID:      w.KubeletIdentityClientID,
+		KubeletNodeLabels: strings.Join(lo.MapToSlice(kubeletLabels, func(k, v string) string {
+			return fmt.Sprintf("%s=%s", k, v)
+		}), ","),
+	}
+	wbv.CredentialProviderDownloadURL = WindowsCredentialProviderURL(w.KubernetesVersion)
+	kubeletFlags := w.kubeletFlags(wbv.CredentialProviderDownloadURL != "")
+	wbv.ClusterDNSServiceIP = kubeletFlags["--cluster-dns"]
+	wbv.KubeletFlags = FormatKubeletFlags(kubeletFlags)
+	return wbv
+}
+
+// kubeletFlags returns the kubelet flags of Windows nodes: the base flags with the paths of Windows and without the
+// cgroups, which Windows doesn't have, then the taints, the kubelet configuration of the nodeclass and the hardening
+func (w Windows) kubeletFlags(credentialProvider bool) map[string]string {
+	kubeletFlags := getBaseWindowsKubeletFlags()
+	kubeletFlags["--pod-infra-container-image"] = windowsPauseImage(w.KubernetesVersion)
+	if credentialProvider {
+		kubeletFlags["--image-credential-provider-config"] = `c:\k\credential-provider-config.yaml`
+		kubeletFlags["--image-credential-provider-bin-dir"] = `c:\k\credential-provider`
+	}
+	if len(w.Taints) > 0 {
+		kubeletFlags["--register-with-taints"] = strings.Join(lo.Map(w.Taints, func(taint v1.Taint, _ int) string { return taint.ToString() }), ",")
+	}
+	kubeletFlags = lo.Assign(kubeletFlags, kubeletConfigToMap(w.KubeletConfig))
+	for _, flag := range linuxOnlyKubeletFlags {
+		delete(kubeletFlags, flag)
+	}
+	var insecureDefaults *v1beta1.InsecureKubeletDefaults
+	if w.KubeletConfig != nil {
+		insecureDefaults = w.KubeletConfig.InsecureKubeletDefaults
+	}
+	return lo.Assign(kubeletFlags, HardenedKubeletFlags(insecureDefaults))
+}
+
+// windowsPauseImage returns the pause image of Windows nodes of the Kubernetes version, the one the Kubernetes version
+// defaults to
+func windowsPauseImage(kubernetesVersion string) string {
+	if semver.MustParse(kubernetesVersion).Minor < 31 {
+		return "mcr.microsoft.com/oss/kubernetes/pause:3.9"
+	}
+	return "mcr.microsoft.com/oss/kubernetes/pause:3.10"
+}
+
+// Download URL of the Windows node binaries of the Kubernetes version, as published by AKS
+func windowsKubeBinaryURL(kubernetesVersion string) string {
+	return fmt.Sprintf("%s/kubernetes/v%s/windowszip/v%s-1int.zip", globalAKSMirror, kubernetesVersion, kubernetesVersion)
+}
@@ -0,0 +1,89 @@
+/*
+Portions Copyright (c) Microsoft Corporation.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package bootstrap
+
+import (
+	"encoding/base64"
+	"strings"
+	"testing"
+
+	"github.com/samber/lo"
+	"github.com/stretchr/testify/assert"
+	v1 "k8s.io/api/core/v1"
+
+	"github.com/Azure/karpenter-provider-azure/pkg/apis/v1beta1"
+)
+
+func TestWindowsScript(t *testing.T) {
+	windows := Windows{
+		Options: Options{
+			ClusterName:     "test-cluster",
+			ClusterEndpoint: "https://test-cluster",
+			KubeletConfig: &KubeletConfiguration{
+				KubeletConfiguration: v1beta1.KubeletConfiguration{CPUManagerPolicy: "static", PodPidsLimit: lo.ToPtr[int64](1024)},
+				MaxPods:              30,
+				ClusterDNSServiceIP:  "10.0.0.53",
+			},
+			Taints:   []v1.Taint{{Key: "os", Value: "windows", Effect: v1.TaintEffectNoSchedule}},
+			Labels:   map[string]string{"team": "windows"},
+			CABundle: lo.ToPtr("dGVzdC1jYS1idW5kbGU="),
+			SubnetID: "/subscriptions/12345678-1234-1234-1234-123456789012/resourceGroups/test-rg/providers/Microsoft.Network/virtualNetworks/test-vnet/subnets/test-subnet",
+		},
+		APIServerName:                  "test-cluster",
+		KubeletClientTLSBootstrapToken: "test.bootstraptoken",
+		KubernetesVersion:              "1.33.0",
+	}
+	customData, err := windows.Script()
+	assert.NoError(t, err)
+	script, err := base64.StdEncoding.DecodeString(customData)
+	assert.NoError(t, err)
+	rendered := string(script)
+
+	assert.Contains(t, rendered, windowsKubeBinaryURL("1.33.0"))
+	assert.Contains(t, rendered, `[Convert]::FromBase64String("dGVzdC1jYS1idW5kbGU=")`)
+	assert.Contains(t, rendered, "server: https://test-cluster:443")
+	assert.Contains(t, rendered, `token: "test.bootstraptoken"`)
+	assert.Contains(t, rendered, `"vnetName": "test-vnet"`)
+	assert.Contains(t, rendered, `"Nameservers": ["10.0.0.53", "168.63.129.16"]`)
+	assert.Contains(t, rendered, "https://acs-mirror.azureedge.net/cloud-provider-azure/v1.33.0/binaries/azure-acr-credential-provider-windows-amd64-v1.33.0.tar.gz")
+	assert.Contains(t, rendered, "https://acs-mirror.azureedge.net/azure-cni/v1.4.32/binaries/azure-vnet-cni-windows-amd64-v1.4.32.zip")
+	assert.Contains(t, rendered, "--pod-infra-container-image=mcr.microsoft.com/oss/kubernetes/pause:3.10")
+	// kube-proxy only starts once the kubelet wrote its kubeconfig, and both services restart on failure
+	waitForKubeconfig := strings.Index(rendered, `Test-Path "$KubeDir\config"`)
+	assert.NotEqual(t, -1, waitForKubeconfig)
+	assert.Less(t, waitForKubeconfig, strings.Index(rendered, "Start-Service kubeproxy"))
+	assert.Contains(t, rendered, "sc.exe failure kubelet")
+	assert.Contains(t, rendered, "sc.exe failure kubeproxy")
+	assert.Contains(t, rendered, "team=windows")
+	assert.Contains(t, rendered, "--register-with-taints=os=windows:NoSchedule")
+	assert.Contains(t, rendered, "--max-pods=30")
+	assert.Contains(t, rendered, "--read-only-port=0")
+	assert.Contains(t, rendered, "--cgroups-per-qos=false")
+	// the kubelet flags of Linux aren't rendered
+	assert.NotContains(t, rendered, "--cgroup-driver")
+	assert.NotContains(t, rendered, "--cpu-manager-policy")
+	assert.NotContains(t, rendered, "--pod-max-pids")
+	assert.NotContains(t, rendered, "/etc/kubernetes")
+}
+
+func TestWindowsKubeletFlagsWithoutKubeletConfig(t *testing.T) {
+	kubeletFlags := Windows{KubernetesVersion: "1.29.0"}.kubeletFlags(false)
+	assert.Equal(t, HardenedKubeletFlags(nil)["--anonymous-auth"], kubeletFlags["--anonymous-auth"])
+	assert.NotContains(t, kubeletFlags, "--image-credential-provider-config")
+	assert.NotContains(t, kubeletFlags, "--register-with-taints")
+	assert.Equal(t, "mcr.microsoft.com/oss/kubernetes/pause:3.9", kubeletFlags["--pod-infra-container-image"])
+}
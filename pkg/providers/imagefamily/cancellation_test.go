@@ -0,0 +1,189 @@
+/*
+Portions Copyright (c) Microsoft Corporation.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package imagefamily
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/arm"
+	azfake "github.com/Azure/azure-sdk-for-go/sdk/azcore/fake"
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/policy"
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/runtime"
+	"github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/compute/armcompute/v7"
+	computefake "github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/compute/armcompute/v7/fake"
+	"github.com/patrickmn/go-cache"
+	"github.com/samber/lo"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/Azure/karpenter-provider-azure/pkg/apis/v1beta1"
+	"github.com/Azure/karpenter-provider-azure/pkg/operator/options"
+	"github.com/Azure/karpenter-provider-azure/pkg/providers/imagefamily/types"
+)
+
+// blockingCommunityImageVersions lists community image versions whose pages block until the context of the listing is
+// done, signaling started once a page is requested
+type blockingCommunityImageVersions struct {
+	started chan struct{}
+}
+
+func newBlockingCommunityImageVersions() blockingCommunityImageVersions {
+	return blockingCommunityImageVersions{started: make(chan struct{}, 1)}
+}
+
+func (b blockingCommunityImageVersions) NewListPager(_, _, _ string, _ *armcompute.CommunityGalleryImageVersionsClientListOptions) *runtime.Pager[armcompute.CommunityGalleryImageVersionsClientListResponse] {
+	return runtime.NewPager(runtime.PagingHandler[armcompute.CommunityGalleryImageVersionsClientListResponse]{
+		More: func(armcompute.CommunityGalleryImageVersionsClientListResponse) bool { return false },
+		Fetcher: func(ctx context.Context, _ *armcompute.CommunityGalleryImageVersionsClientListResponse) (armcompute.CommunityGalleryImageVersionsClientListResponse, error) {
+			select {
+			case b.started <- struct{}{}:
+			default:
+			}
+			<-ctx.Done()
+			return armcompute.CommunityGalleryImageVersionsClientListResponse{}, ctx.Err()
+		},
+	})
+}
+
+func (b blockingCommunityImageVersions) Get(_ context.Context, _, _, _, _ string, _ *armcompute.CommunityGalleryImageVersionsClientGetOptions) (armcompute.CommunityGalleryImageVersionsClientGetResponse, error) {
+	return armcompute.CommunityGalleryImageVersionsClientGetResponse{}, errors.New("unexpected GET of a community image version")
+}
+
+// locationImageVersionsAPIs lists the versions of the community images of each location with the API of the location
+type locationImageVersionsAPIs map[string]types.CommunityGalleryImageVersionsAPI
+
+func (l locationImageVersionsAPIs) NewListPager(location, publicGalleryName, galleryImageName string, opts *armcompute.CommunityGalleryImageVersionsClientListOptions) *runtime.Pager[armcompute.CommunityGalleryImageVersionsClientListResponse] {
+	return l[location].NewListPager(location, publicGalleryName, galleryImageName, opts)
+}
+
+func (l locationImageVersionsAPIs) Get(ctx context.Context, location, publicGalleryName, galleryImageName, galleryImageVersionName string, opts *armcompute.CommunityGalleryImageVersionsClientGetOptions) (armcompute.CommunityGalleryImageVersionsClientGetResponse, error) {
+	return l[location].Get(ctx, location, publicGalleryName, galleryImageName, galleryImageVersionName, opts)
+}
+
+// cancelOnceStarted cancels the context once the started channel is signaled
+func cancelOnceStarted(ctx context.Context, started <-chan struct{}) context.Context {
+	ctx, cancel := context.WithCancel(ctx)
+	go func() {
+		<-started
+		cancel()
+	}()
+	return ctx
+}
+
+func cigNodeClass() *v1beta1.AKSNodeClass {
+	nodeClass := &v1beta1.AKSNodeClass{Spec: v1beta1.AKSNodeClassSpec{ImageFamily: lo.ToPtr(v1beta1.Ubuntu2204ImageFamily)}}
+	nodeClass.StatusConditions().SetTrue(v1beta1.ConditionTypeKubernetesVersionReady)
+	nodeClass.Status.KubernetesVersion = "1.31.0"
+	return nodeClass
+}
+
+func TestListCIGCanceled(t *testing.T) {
+	blocking := newBlockingCommunityImageVersions()
+	nodeImagesCache := cache.New(ImageExpirationInterval, ImageCacheCleaningInterval)
+	p := NewProvider(blocking, "westus", "00000000-0000-0000-0000-000000000000", nil, nodeImagesCache)
+	nodeClass := cigNodeClass()
+	ctx := options.ToContext(context.Background(), &options.Options{CacheConfig: options.CacheConfig{ImageLookupFailuresTTL: 30 * time.Second}})
+
+	// canceling the listing cancels the page in flight
+	_, err := p.List(cancelOnceStarted(ctx, blocking.started), nodeClass)
+	assert.ErrorIs(t, err, context.Canceled)
+	// neither a partial latest version nor the failure is cached
+	assert.Zero(t, nodeImagesCache.ItemCount())
+
+	// so that the next listing is retried right away
+	p.imageVersionsClient = staticCommunityImageVersions{communityImageVersion("202506.03.0")}
+	nodeImages, err := p.List(ctx, nodeClass)
+	assert.NoError(t, err)
+	assert.NotEmpty(t, nodeImages)
+	for _, nodeImage := range nodeImages {
+		assert.True(t, strings.HasSuffix(nodeImage.ID, "/versions/202506.03.0"), nodeImage.ID)
+	}
+}
+
+func TestListCIGFallbackLocationCanceled(t *testing.T) {
+	blocking := newBlockingCommunityImageVersions()
+	nodeImagesCache := cache.New(ImageExpirationInterval, ImageCacheCleaningInterval)
+	p := NewProvider(locationImageVersionsAPIs{
+		"westcentralus": staticCommunityImageVersions{},
+		"westus2":       blocking,
+		"westus3":       staticCommunityImageVersions{communityImageVersion("202506.10.0")},
+	}, "westcentralus", "00000000-0000-0000-0000-000000000000", nil, nodeImagesCache)
+	ctx := options.ToContext(context.Background(), &options.Options{CommunityGalleryFallbackLocations: "westus2,westus3"})
+
+	// the canceled fallback location isn't skipped for the next one, as its version may be newer
+	_, err := p.List(cancelOnceStarted(ctx, blocking.started), cigNodeClass())
+	assert.ErrorIs(t, err, context.Canceled)
+	assert.Zero(t, nodeImagesCache.ItemCount())
+}
+
+// blockingTransport blocks the requests of the paths with the suffix until their context is done, signaling started
+// once one is sent, and sends the others to the next transport
+type blockingTransport struct {
+	next       policy.Transporter
+	pathSuffix string
+	started    chan struct{}
+}
+
+func (b blockingTransport) Do(req *http.Request) (*http.Response, error) {
+	if !strings.HasSuffix(req.URL.Path, b.pathSuffix) {
+		return b.next.Do(req)
+	}
+	select {
+	case b.started <- struct{}{}:
+	default:
+	}
+	<-req.Context().Done()
+	return nil, req.Context().Err()
+}
+
+func TestListCustomImageCanceled(t *testing.T) {
+	transport := blockingTransport{
+		next:       computefake.NewServerFactoryTransport(&computefake.ServerFactory{GalleryImagesServer: fakeGalleryImagesServer()}),
+		pathSuffix: "/versions",
+		started:    make(chan struct{}, 1),
+	}
+	clientFactory, err := armcompute.NewClientFactory("11111111-1111-1111-1111-111111111111", &azfake.TokenCredential{},
+		&arm.ClientOptions{ClientOptions: azcore.ClientOptions{Transport: transport, Retry: policy.RetryOptions{MaxRetries: -1}}})
+	assert.NoError(t, err)
+	nodeImagesCache := cache.New(ImageExpirationInterval, ImageCacheCleaningInterval)
+	p := NewProvider(nil, "westus", "00000000-0000-0000-0000-000000000000", nil, nodeImagesCache)
+	p.newCustomGalleryClientFactory = func(string, string) (*armcompute.ClientFactory, error) { return clientFactory, nil }
+	nodeClass := &v1beta1.AKSNodeClass{
+		Spec: v1beta1.AKSNodeClassSpec{
+			ImageFamily: lo.ToPtr(v1beta1.CustomImageFamily),
+			CustomImageTerms: []v1beta1.CustomImageTerm{{
+				GallerySubscriptionID:    "11111111-1111-1111-1111-111111111111",
+				GalleryResourceGroupName: "images",
+				GalleryName:              "gallery",
+				Name:                     "ubuntu",
+			}},
+		},
+	}
+	nodeClass.StatusConditions().SetTrue(v1beta1.ConditionTypeKubernetesVersionReady)
+	nodeClass.Status.KubernetesVersion = "1.31.0"
+
+	ctx := cancelOnceStarted(options.ToContext(context.Background(), &options.Options{}), transport.started)
+	_, err = p.List(ctx, nodeClass)
+	assert.ErrorIs(t, err, context.Canceled)
+	_, ok := nodeImagesCache.Get(ttigCacheKey(nodeClass, nodeClass.Spec.CustomImageTerms[0]))
+	assert.False(t, ok)
+}
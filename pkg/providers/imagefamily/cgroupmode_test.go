@@ -0,0 +1,128 @@
+/*
+Portions Copyright (c) Microsoft Corporation.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package imagefamily_test
+
+import (
+	"encoding/base64"
+	"regexp"
+	"testing"
+
+	"github.com/samber/lo"
+	"github.com/stretchr/testify/assert"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	karpv1 "sigs.k8s.io/karpenter/pkg/apis/v1"
+	"sigs.k8s.io/karpenter/pkg/cloudprovider"
+
+	"github.com/Azure/karpenter-provider-azure/pkg/apis/v1beta1"
+	"github.com/Azure/karpenter-provider-azure/pkg/providers/imagefamily"
+	"github.com/Azure/karpenter-provider-azure/pkg/providers/imagefamily/bootstrap"
+	"github.com/Azure/karpenter-provider-azure/pkg/providers/launchtemplate/parameters"
+)
+
+var renderedContainerdConfigRegex = regexp.MustCompile(`CONTAINERD_CONFIG_CONTENT="([^"]*)"`)
+
+func TestCgroupMode(t *testing.T) {
+	expectedCgroupModes := map[string]string{
+		v1beta1.Ubuntu2204ImageFamily: bootstrap.CgroupModeV2,
+		v1beta1.Ubuntu2404ImageFamily: bootstrap.CgroupModeV2,
+		v1beta1.CustomImageFamily:     bootstrap.CgroupModeV2,
+	}
+	for familyName, expected := range expectedCgroupModes {
+		for _, useSIG := range []bool{false, true} {
+			for _, image := range imagefamily.GetImageFamily(lo.ToPtr(familyName), nil, "1.31.0", nil).DefaultImages(useSIG, nil) {
+				assert.Equal(t, expected, imagefamily.CgroupMode(image.Distro), image.Distro)
+			}
+		}
+	}
+
+	tests := []struct {
+		name              string
+		familyName        string
+		fipsMode          *v1beta1.FIPSMode
+		kubernetesVersion string
+		expected          string
+	}{
+		{name: "Ubuntu 20.04 (FIPS)", familyName: v1beta1.UbuntuImageFamily, fipsMode: &v1beta1.FIPSModeFIPS, kubernetesVersion: "1.31.0", expected: bootstrap.CgroupModeV1},
+		{name: "Azure Linux 2.0", familyName: v1beta1.AzureLinuxImageFamily, kubernetesVersion: "1.31.0", expected: bootstrap.CgroupModeV1},
+		{name: "Azure Linux 2.0 (FIPS)", familyName: v1beta1.AzureLinuxImageFamily, fipsMode: &v1beta1.FIPSModeFIPS, kubernetesVersion: "1.31.0", expected: bootstrap.CgroupModeV1},
+		{name: "Azure Linux 3.0", familyName: v1beta1.AzureLinuxImageFamily, kubernetesVersion: "1.32.0", expected: bootstrap.CgroupModeV2},
+		{name: "Azure Linux 3.0 (FIPS)", familyName: v1beta1.AzureLinuxImageFamily, fipsMode: &v1beta1.FIPSModeFIPS, kubernetesVersion: "1.32.0", expected: bootstrap.CgroupModeV2},
+		{name: "AzureLinux3 before 1.32", familyName: v1beta1.AzureLinux3ImageFamily, kubernetesVersion: "1.31.0", expected: bootstrap.CgroupModeV2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			images := imagefamily.GetImageFamily(lo.ToPtr(tt.familyName), tt.fipsMode, tt.kubernetesVersion, nil).DefaultImages(true, tt.fipsMode)
+			assert.NotEmpty(t, images)
+			for _, image := range images {
+				assert.Equal(t, tt.expected, imagefamily.CgroupMode(image.Distro), image.Distro)
+			}
+		})
+	}
+
+	// the distro name of custom images is user specified
+	assert.Equal(t, bootstrap.CgroupModeV1, imagefamily.CgroupMode("aks-cblmariner-v2-gen2"))
+	assert.Equal(t, bootstrap.CgroupModeV2, imagefamily.CgroupMode("my-custom-distro"))
+}
+
+// TestCgroupDriver asserts that the kubelet and containerd of the scriptless bootstrap use the same cgroup driver,
+// matching the cgroup mode of the image
+func TestCgroupDriver(t *testing.T) {
+	staticParameters := &parameters.StaticParameters{
+		ClusterName:                    "test-cluster",
+		ClusterEndpoint:                "https://test-cluster",
+		SubnetID:                       "/subscriptions/test/resourceGroups/test/providers/Microsoft.Network/virtualNetworks/vnet/subnets/subnet",
+		Arch:                           karpv1.ArchitectureAmd64,
+		KubeletClientTLSBootstrapToken: "test-token",
+		KubernetesVersion:              "1.31.0",
+	}
+	instanceType := &cloudprovider.InstanceType{
+		Name: "Standard_D2s_v3",
+		Capacity: v1.ResourceList{
+			v1.ResourceCPU:    resource.MustParse("2"),
+			v1.ResourceMemory: resource.MustParse("8Gi"),
+		},
+	}
+
+	tests := []struct {
+		cgroupMode          string
+		expectedDriverFlag  string
+		expectSystemdCgroup bool
+	}{
+		{cgroupMode: "", expectedDriverFlag: "--cgroup-driver=systemd", expectSystemdCgroup: true},
+		{cgroupMode: bootstrap.CgroupModeV2, expectedDriverFlag: "--cgroup-driver=systemd", expectSystemdCgroup: true},
+		{cgroupMode: bootstrap.CgroupModeV1, expectedDriverFlag: "--cgroup-driver=cgroupfs", expectSystemdCgroup: false},
+	}
+	for _, tt := range tests {
+		t.Run("cgroup "+tt.cgroupMode, func(t *testing.T) {
+			kubeletConfig := &bootstrap.KubeletConfiguration{MaxPods: 110, CgroupMode: tt.cgroupMode}
+			customData, err := imagefamily.AzureLinux{Options: staticParameters}.ScriptlessCustomData(kubeletConfig, nil, nil, lo.ToPtr("Y2EtYnVuZGxl"), instanceType).Script()
+			assert.NoError(t, err)
+			rendered := bootstrap.RenderForDebug(customData)
+			expectKubeletFlags(t, rendered, []string{tt.expectedDriverFlag})
+			assert.Contains(t, rendered, `NEEDS_CGROUPV2="`+lo.Ternary(tt.expectSystemdCgroup, "true", "false")+`"`)
+
+			match := renderedContainerdConfigRegex.FindStringSubmatch(rendered)
+			if !assert.NotNil(t, match, "expected CONTAINERD_CONFIG_CONTENT to be rendered") {
+				return
+			}
+			containerdConfig, err := base64.StdEncoding.DecodeString(match[1])
+			assert.NoError(t, err)
+			assert.Equal(t, tt.expectSystemdCgroup, regexp.MustCompile(`SystemdCgroup = true`).Match(containerdConfig))
+		})
+	}
+}
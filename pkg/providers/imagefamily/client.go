@@ -0,0 +1,130 @@
+/*
+Portions Copyright (c) Microsoft Corporation.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package imagefamily
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/arm"
+	"github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/compute/armcompute/v7"
+	"github.com/patrickmn/go-cache"
+	"github.com/samber/lo"
+	"sigs.k8s.io/karpenter/pkg/cloudprovider"
+
+	"github.com/Azure/karpenter-provider-azure/pkg/apis/v1beta1"
+	"github.com/Azure/karpenter-provider-azure/pkg/operator/options"
+	"github.com/Azure/karpenter-provider-azure/pkg/providers/imagefamily/types"
+)
+
+// ClientOptions are the options of a Client, matching the options of the operator image resolution depends on
+type ClientOptions struct {
+	// UseSIG resolves the images of the image families from the AKS shared image galleries in SIGSubscriptionID, rather
+	// than from the community galleries
+	UseSIG            bool
+	SIGSubscriptionID string
+	// NodeImageVersionsAPIVersion is the api-version of the NodeImageVersions API the shared image gallery images are
+	// resolved with, defaulting to the operator's
+	NodeImageVersionsAPIVersion string
+	// ARMClientOptions are the options of the ARM clients, e.g. their cloud
+	ARMClientOptions *arm.ClientOptions
+	// CacheConfig configures the caches of the resolved images, defaulting to the operator's defaults
+	CacheConfig *options.CacheConfig
+}
+
+// Client resolves the images the nodes of AKSNodeClasses are launched with, like the operator does, for binaries other
+// than the operator, e.g. to check ahead of time which image a nodeclass would launch. It caches like the operator, e.g.
+// the clients and image definitions of custom image galleries, so that a Client should be reused across calls. The
+// AKSNodeClasses must have their Kubernetes version resolved in their status.
+type Client struct {
+	provider *provider
+	options  *options.Options
+}
+
+// NewClient returns a Client resolving the images of the location with the credential, in the subscription of the
+// cluster, which custom image galleries default to. The galleries of custom image terms of other tenants are looked up
+// with the credential too, rather than with a credential of their tenant.
+func NewClient(credential azcore.TokenCredential, location, subscriptionID string, clientOptions ClientOptions) (*Client, error) {
+	armClientOptions := clientOptions.ARMClientOptions
+	if armClientOptions == nil {
+		armClientOptions = &arm.ClientOptions{}
+	}
+	communityImageVersionsClient, err := armcompute.NewCommunityGalleryImageVersionsClient(subscriptionID, credential, armClientOptions)
+	if err != nil {
+		return nil, fmt.Errorf("creating the community gallery image versions client, %w", err)
+	}
+	nodeImageVersionsClient := NewNodeImageVersionsClient(credential, armClientOptions.Cloud, clientOptions.NodeImageVersionsAPIVersion)
+	c := NewClientFromAPIs(communityImageVersionsClient, nodeImageVersionsClient, location, subscriptionID, clientOptions)
+	c.provider.WithCustomGalleryClientFactory(func(subscriptionID, _ string) (*armcompute.ClientFactory, error) {
+		clientFactory, err := armcompute.NewClientFactory(subscriptionID, credential, armClientOptions)
+		if err != nil {
+			return nil, fmt.Errorf("creating clients for the custom image gallery, %w", err)
+		}
+		return clientFactory, nil
+	})
+	return c, nil
+}
+
+// NewClientFromAPIs returns a Client resolving the images of the location with the given APIs, e.g. fakes in tests
+func NewClientFromAPIs(
+	communityImageVersionsAPI types.CommunityGalleryImageVersionsAPI,
+	nodeImageVersionsAPI types.NodeImageVersionsAPI,
+	location, subscriptionID string,
+	clientOptions ClientOptions,
+) *Client {
+	cacheConfig := lo.FromPtrOr(clientOptions.CacheConfig, options.DefaultCacheConfig())
+	return &Client{
+		provider: NewProvider(communityImageVersionsAPI, location, subscriptionID, nodeImageVersionsAPI,
+			cache.New(cacheConfig.ImagesTTL, cacheConfig.ImagesCleanupInterval)),
+		options: &options.Options{
+			UseSIG:                      clientOptions.UseSIG,
+			SIGSubscriptionID:           clientOptions.SIGSubscriptionID,
+			NodeImageVersionsAPIVersion: clientOptions.NodeImageVersionsAPIVersion,
+			CacheConfig:                 cacheConfig,
+			// the images are resolved on demand, rather than discovered in the background
+			DemoteImageDiscoveryLogs: true,
+		},
+	}
+}
+
+// Images returns the images of the AKSNodeClass in priority order, as they would be listed in its status
+func (c *Client) Images(ctx context.Context, nodeClass *v1beta1.AKSNodeClass) ([]NodeImage, error) {
+	return c.provider.List(options.ToContext(ctx, c.options), nodeClass)
+}
+
+// ImageID returns the ID of the image the nodes of the instance type would be launched with for the AKSNodeClass: its
+// first image compatible with the requirements of the instance type. Like a launch, it fails for an AKSNodeClass whose
+// images aren't ready or whose Kubernetes version isn't resolved.
+func (c *Client) ImageID(ctx context.Context, nodeClass *v1beta1.AKSNodeClass, instanceType *cloudprovider.InstanceType) (string, error) {
+	if imagesReady := nodeClass.StatusConditions().Get(v1beta1.ConditionTypeImagesReady); imagesReady.IsFalse() {
+		return "", fmt.Errorf("NodeClass condition %s is False, %s", v1beta1.ConditionTypeImagesReady, imagesReady.Message)
+	}
+	if _, err := nodeClass.GetKubernetesVersion(); err != nil {
+		return "", err
+	}
+	nodeImages, err := c.Images(ctx, nodeClass)
+	if err != nil {
+		return "", err
+	}
+	for _, nodeImage := range nodeImages {
+		if err := instanceType.Requirements.Compatible(nodeImage.Requirements, v1beta1.AllowUndefinedWellKnownAndRestrictedLabels); err == nil {
+			return nodeImage.ID, nil
+		}
+	}
+	return "", fmt.Errorf("no compatible images found for instance type %s", instanceType.Name)
+}
@@ -0,0 +1,106 @@
+/*
+Portions Copyright (c) Microsoft Corporation.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package imagefamily_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/compute/armcompute/v7"
+	"github.com/samber/lo"
+	"github.com/stretchr/testify/assert"
+	v1 "k8s.io/api/core/v1"
+	karpv1 "sigs.k8s.io/karpenter/pkg/apis/v1"
+	"sigs.k8s.io/karpenter/pkg/cloudprovider"
+	"sigs.k8s.io/karpenter/pkg/scheduling"
+
+	"github.com/Azure/karpenter-provider-azure/pkg/apis/v1beta1"
+	"github.com/Azure/karpenter-provider-azure/pkg/fake"
+	"github.com/Azure/karpenter-provider-azure/pkg/providers/imagefamily"
+)
+
+func clientTestNodeClass() *v1beta1.AKSNodeClass {
+	nodeClass := &v1beta1.AKSNodeClass{Spec: v1beta1.AKSNodeClassSpec{ImageFamily: lo.ToPtr(v1beta1.Ubuntu2204ImageFamily)}}
+	nodeClass.StatusConditions().SetTrue(v1beta1.ConditionTypeKubernetesVersionReady)
+	nodeClass.Status.KubernetesVersion = "1.31.0"
+	return nodeClass
+}
+
+func clientTestInstanceType(arch, hyperVGeneration string) *cloudprovider.InstanceType {
+	return &cloudprovider.InstanceType{
+		Name: "Standard_D2s_v3",
+		Requirements: scheduling.NewRequirements(
+			scheduling.NewRequirement(v1.LabelArchStable, v1.NodeSelectorOpIn, arch),
+			scheduling.NewRequirement(v1beta1.LabelSKUHyperVGeneration, v1.NodeSelectorOpIn, hyperVGeneration),
+		),
+	}
+}
+
+func TestClientImageIDCommunityGallery(t *testing.T) {
+	communityImageVersionsAPI := &fake.CommunityGalleryImageVersionsAPI{}
+	communityImageVersionsAPI.ImageVersions.Append(&armcompute.CommunityGalleryImageVersion{Name: lo.ToPtr(cigImageVersion)})
+	client := imagefamily.NewClientFromAPIs(communityImageVersionsAPI, &fake.NodeImageVersionsAPI{}, "westus2", customerSubscription, imagefamily.ClientOptions{})
+
+	imageID, err := client.ImageID(context.Background(), clientTestNodeClass(), clientTestInstanceType(karpv1.ArchitectureAmd64, v1beta1.HyperVGenerationV2))
+	assert.NoError(t, err)
+	assert.Equal(t, imagefamily.BuildImageIDCIG(imagefamily.AKSUbuntuPublicGalleryURL, imagefamily.Ubuntu2204Gen2ImageDefinition, cigImageVersion), imageID)
+
+	imageID, err = client.ImageID(context.Background(), clientTestNodeClass(), clientTestInstanceType(karpv1.ArchitectureArm64, v1beta1.HyperVGenerationV2))
+	assert.NoError(t, err)
+	assert.Equal(t, imagefamily.BuildImageIDCIG(imagefamily.AKSUbuntuPublicGalleryURL, imagefamily.Ubuntu2204Gen2ArmImageDefinition, cigImageVersion), imageID)
+
+	images, err := client.Images(context.Background(), clientTestNodeClass())
+	assert.NoError(t, err)
+	assert.Equal(t, renderExpectedCIGNodeImages(&imagefamily.Ubuntu2204{}, nil, cigImageVersion), images)
+}
+
+func TestClientImageIDSharedImageGallery(t *testing.T) {
+	client := imagefamily.NewClientFromAPIs(&fake.CommunityGalleryImageVersionsAPI{}, &fake.NodeImageVersionsAPI{}, "westus2", customerSubscription, imagefamily.ClientOptions{
+		UseSIG:            true,
+		SIGSubscriptionID: sigSubscription,
+	})
+
+	imageID, err := client.ImageID(context.Background(), clientTestNodeClass(), clientTestInstanceType(karpv1.ArchitectureAmd64, v1beta1.HyperVGenerationV1))
+	assert.NoError(t, err)
+	assert.Equal(t, imagefamily.BuildImageIDSIG(sigSubscription, imagefamily.AKSUbuntuResourceGroup, imagefamily.AKSUbuntuGalleryName, imagefamily.Ubuntu2204Gen1ImageDefinition, sigImageVersion), imageID)
+}
+
+func TestClientImageIDNoCompatibleImage(t *testing.T) {
+	communityImageVersionsAPI := &fake.CommunityGalleryImageVersionsAPI{}
+	communityImageVersionsAPI.ImageVersions.Append(&armcompute.CommunityGalleryImageVersion{Name: lo.ToPtr(cigImageVersion)})
+	client := imagefamily.NewClientFromAPIs(communityImageVersionsAPI, &fake.NodeImageVersionsAPI{}, "westus2", customerSubscription, imagefamily.ClientOptions{})
+
+	_, err := client.ImageID(context.Background(), clientTestNodeClass(), clientTestInstanceType(karpv1.ArchitectureArm64, v1beta1.HyperVGenerationV1))
+	assert.EqualError(t, err, "no compatible images found for instance type Standard_D2s_v3")
+}
+
+func TestClientImageIDNodeClassNotReady(t *testing.T) {
+	communityImageVersionsAPI := &fake.CommunityGalleryImageVersionsAPI{}
+	communityImageVersionsAPI.ImageVersions.Append(&armcompute.CommunityGalleryImageVersion{Name: lo.ToPtr(cigImageVersion)})
+	client := imagefamily.NewClientFromAPIs(communityImageVersionsAPI, &fake.NodeImageVersionsAPI{}, "westus2", customerSubscription, imagefamily.ClientOptions{})
+	instanceType := clientTestInstanceType(karpv1.ArchitectureAmd64, v1beta1.HyperVGenerationV2)
+
+	nodeClass := clientTestNodeClass()
+	nodeClass.StatusConditions().SetFalse(v1beta1.ConditionTypeImagesReady, "ImageIncompatible", "image is specialized")
+	_, err := client.ImageID(context.Background(), nodeClass, instanceType)
+	assert.EqualError(t, err, "NodeClass condition ImagesReady is False, image is specialized")
+
+	nodeClass = clientTestNodeClass()
+	nodeClass.StatusConditions().SetFalse(v1beta1.ConditionTypeKubernetesVersionReady, "KubernetesVersionNotFound", "version not found")
+	_, err = client.ImageID(context.Background(), nodeClass, instanceType)
+	assert.ErrorContains(t, err, v1beta1.ConditionTypeKubernetesVersionReady)
+}
@@ -0,0 +1,46 @@
+/*
+Portions Copyright (c) Microsoft Corporation.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package imagefamily
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/Azure/karpenter-provider-azure/pkg/operator/options"
+)
+
+func TestClientCacheConfig(t *testing.T) {
+	expiration := func(c *Client) time.Duration {
+		start := time.Now()
+		c.provider.nodeImagesCache.SetDefault("key", struct{}{})
+		_, expiration, _ := c.provider.nodeImagesCache.GetWithExpiration("key")
+		return expiration.Sub(start).Round(time.Minute)
+	}
+
+	// the images are cached like the operator does by default
+	c := NewClientFromAPIs(nil, nil, "westus2", "00000000-0000-0000-0000-000000000000", ClientOptions{})
+	assert.Equal(t, options.DefaultCacheConfig(), c.options.CacheConfig)
+	assert.Equal(t, options.DefaultCacheConfig().ImagesTTL, expiration(c))
+
+	// or as configured
+	config := options.CacheConfig{ImagesTTL: time.Hour, ImagesCleanupInterval: time.Minute, ImageLookupFailuresTTL: time.Minute}
+	c = NewClientFromAPIs(nil, nil, "westus2", "00000000-0000-0000-0000-000000000000", ClientOptions{CacheConfig: &config})
+	assert.Equal(t, config, c.options.CacheConfig)
+	assert.Equal(t, config.ImagesTTL, expiration(c))
+}
@@ -0,0 +1,99 @@
+/*
+Portions Copyright (c) Microsoft Corporation.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package imagefamily
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/runtime"
+	"github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/compute/armcompute/v7"
+	"github.com/patrickmn/go-cache"
+	"github.com/samber/lo"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/Azure/karpenter-provider-azure/pkg/apis/v1beta1"
+	"github.com/Azure/karpenter-provider-azure/pkg/operator/options"
+)
+
+// locationCommunityImageVersions lists the versions of the community images by location
+type locationCommunityImageVersions map[string]staticCommunityImageVersions
+
+func (l locationCommunityImageVersions) NewListPager(location, publicGalleryName, galleryImageName string, opts *armcompute.CommunityGalleryImageVersionsClientListOptions) *runtime.Pager[armcompute.CommunityGalleryImageVersionsClientListResponse] {
+	return l[location].NewListPager(location, publicGalleryName, galleryImageName, opts)
+}
+
+func (l locationCommunityImageVersions) Get(ctx context.Context, location, publicGalleryName, galleryImageName, galleryImageVersionName string, opts *armcompute.CommunityGalleryImageVersionsClientGetOptions) (armcompute.CommunityGalleryImageVersionsClientGetResponse, error) {
+	return l[location].Get(ctx, location, publicGalleryName, galleryImageName, galleryImageVersionName, opts)
+}
+
+func communityImageVersion(version string) *armcompute.CommunityGalleryImageVersion {
+	return &armcompute.CommunityGalleryImageVersion{
+		Name:       lo.ToPtr(version),
+		Properties: &armcompute.CommunityGalleryImageVersionProperties{PublishedDate: lo.ToPtr(time.Now())},
+	}
+}
+
+func TestListCIGFallbackLocations(t *testing.T) {
+	versions := locationCommunityImageVersions{
+		"westcentralus": {},
+		"westus2":       {communityImageVersion("202506.03.0")},
+		"westus3":       {communityImageVersion("202506.10.0")},
+	}
+	nodeImagesCache := cache.New(ImageExpirationInterval, ImageCacheCleaningInterval)
+	p := NewProvider(versions, "westcentralus", "00000000-0000-0000-0000-000000000000", nil, nodeImagesCache)
+	nodeClass := &v1beta1.AKSNodeClass{Spec: v1beta1.AKSNodeClassSpec{ImageFamily: lo.ToPtr(v1beta1.Ubuntu2204ImageFamily)}}
+	nodeClass.StatusConditions().SetTrue(v1beta1.ConditionTypeKubernetesVersionReady)
+	nodeClass.Status.KubernetesVersion = "1.31.0"
+	supportedImages := getSupportedImages(nodeClass, nodeClass.Status.KubernetesVersion, false)
+	key, err := p.cacheKey(supportedImages, nodeClass.Status.KubernetesVersion, nodeClass.GetImageChannel(), "", "")
+	assert.NoError(t, err)
+
+	// without fallback locations, no version is found
+	nodeImages, err := p.List(options.ToContext(context.Background(), &options.Options{}), nodeClass)
+	assert.NoError(t, err)
+	for _, nodeImage := range nodeImages {
+		assert.Empty(t, nodeImage.GalleryLocation)
+	}
+
+	// with them, the version of the first fallback location with one is used
+	ctx := options.ToContext(context.Background(), &options.Options{CommunityGalleryFallbackLocations: "eastus,westus2,westus3"})
+	nodeImages, err = p.List(ctx, nodeClass)
+	assert.NoError(t, err)
+	assert.Len(t, nodeImages, len(supportedImages))
+	for _, nodeImage := range nodeImages {
+		assert.True(t, strings.HasSuffix(nodeImage.ID, "/versions/202506.03.0"), nodeImage.ID)
+		assert.Equal(t, "westus2", nodeImage.GalleryLocation)
+	}
+	// and cached apart from the images of the location of the cluster
+	_, ok := nodeImagesCache.Get(key + "-westus2")
+	assert.True(t, ok)
+
+	// once the location of the cluster catches up, its version is used again
+	versions["westcentralus"] = staticCommunityImageVersions{communityImageVersion("202506.01.0")}
+	nodeImages, err = p.List(ctx, nodeClass)
+	assert.NoError(t, err)
+	for _, nodeImage := range nodeImages {
+		assert.True(t, strings.HasSuffix(nodeImage.ID, "/versions/202506.01.0"), nodeImage.ID)
+		assert.Empty(t, nodeImage.GalleryLocation)
+	}
+	cached, ok := nodeImagesCache.Get(key)
+	assert.True(t, ok)
+	assert.Equal(t, nodeImages, cached)
+}
@@ -98,17 +98,20 @@ func (u CustomImages) ScriptlessCustomData(
 ) bootstrap.Bootstrapper {
 	return bootstrap.AKS{
 		Options: bootstrap.Options{
-			ClusterName:      u.Options.ClusterName,
-			ClusterEndpoint:  u.Options.ClusterEndpoint,
-			KubeletConfig:    kubeletConfig,
-			Taints:           taints,
-			Labels:           labels,
-			CABundle:         caBundle,
-			GPUNode:          u.Options.GPUNode,
-			GPUDriverVersion: u.Options.GPUDriverVersion,
-			GPUDriverType:    u.Options.GPUDriverType,
-			GPUImageSHA:      u.Options.GPUImageSHA,
-			SubnetID:         u.Options.SubnetID,
+			ClusterName:               u.Options.ClusterName,
+			ClusterEndpoint:           u.Options.ClusterEndpoint,
+			KubeletConfig:             kubeletConfig,
+			Taints:                    taints,
+			Labels:                    labels,
+			CABundle:                  caBundle,
+			GPUNode:                   u.Options.GPUNode,
+			GPUDriverVersion:          u.Options.GPUDriverVersion,
+			GPUDriverType:             u.Options.GPUDriverType,
+			GPUImageSHA:               u.Options.GPUImageSHA,
+			SubnetID:                  u.Options.SubnetID,
+			CustomCATrustCertificates: u.Options.CustomCATrustCertificates,
+			RootFilesystemMinBytes:    u.Options.RootFilesystemMinBytes,
+			GPUDriverReadyTimeout:     u.Options.GPUDriverReadyTimeout,
 		},
 		Arch:                           u.Options.Arch,
 		TenantID:                       u.Options.TenantID,
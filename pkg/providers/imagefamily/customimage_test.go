@@ -0,0 +1,729 @@
+/*
+Portions Copyright (c) Microsoft Corporation.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package imagefamily
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/arm"
+	azfake "github.com/Azure/azure-sdk-for-go/sdk/azcore/fake"
+	"github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/compute/armcompute/v7"
+	computefake "github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/compute/armcompute/v7/fake"
+	"github.com/patrickmn/go-cache"
+	"github.com/samber/lo"
+	"github.com/stretchr/testify/assert"
+	v1 "k8s.io/api/core/v1"
+	karpv1 "sigs.k8s.io/karpenter/pkg/apis/v1"
+	"sigs.k8s.io/karpenter/pkg/scheduling"
+
+	"github.com/Azure/karpenter-provider-azure/pkg/apis/v1beta1"
+	"github.com/Azure/karpenter-provider-azure/pkg/operator/options"
+	"github.com/Azure/karpenter-provider-azure/pkg/providers/imagefamily/bootstrap"
+	"github.com/Azure/karpenter-provider-azure/pkg/providers/imagefamily/customscriptsbootstrap"
+	"github.com/Azure/karpenter-provider-azure/pkg/providers/imagefamily/types"
+	"github.com/Azure/karpenter-provider-azure/pkg/providers/launchtemplate/parameters"
+)
+
+func TestValidateCustomImageDefinition(t *testing.T) {
+	imageDefinition := func(osState armcompute.OperatingSystemStateTypes, osType armcompute.OperatingSystemTypes, architecture *armcompute.Architecture) *armcompute.GalleryImage {
+		return &armcompute.GalleryImage{
+			Name: lo.ToPtr("custom-image"),
+			Properties: &armcompute.GalleryImageProperties{
+				OSState:      lo.ToPtr(osState),
+				OSType:       lo.ToPtr(osType),
+				Architecture: architecture,
+			},
+		}
+	}
+	amd64Term := v1beta1.CustomImageTerm{DistroName: "aks-ubuntu-containerd-22.04-gen2"}
+	arm64Term := v1beta1.CustomImageTerm{DistroName: "aks-ubuntu-arm64-containerd-22.04-gen2"}
+
+	cases := []struct {
+		name            string
+		imageDefinition *armcompute.GalleryImage
+		imageTerm       v1beta1.CustomImageTerm
+		expectedErr     string
+	}{
+		{
+			name:            "generalized Linux x64 image",
+			imageDefinition: imageDefinition(armcompute.OperatingSystemStateTypesGeneralized, armcompute.OperatingSystemTypesLinux, lo.ToPtr(armcompute.ArchitectureX64)),
+			imageTerm:       amd64Term,
+		},
+		{
+			name:            "generalized Linux image without architecture",
+			imageDefinition: imageDefinition(armcompute.OperatingSystemStateTypesGeneralized, armcompute.OperatingSystemTypesLinux, nil),
+			imageTerm:       amd64Term,
+		},
+		{
+			name:            "generalized Linux Arm64 image",
+			imageDefinition: imageDefinition(armcompute.OperatingSystemStateTypesGeneralized, armcompute.OperatingSystemTypesLinux, lo.ToPtr(armcompute.ArchitectureArm64)),
+			imageTerm:       arm64Term,
+		},
+		{
+			name:            "specialized image",
+			imageDefinition: imageDefinition(armcompute.OperatingSystemStateTypesSpecialized, armcompute.OperatingSystemTypesLinux, lo.ToPtr(armcompute.ArchitectureX64)),
+			imageTerm:       amd64Term,
+			expectedErr:     "custom image custom-image has osState Specialized, expected Generalized",
+		},
+		{
+			name:            "Windows image",
+			imageDefinition: imageDefinition(armcompute.OperatingSystemStateTypesGeneralized, armcompute.OperatingSystemTypesWindows, lo.ToPtr(armcompute.ArchitectureX64)),
+			imageTerm:       amd64Term,
+			expectedErr:     "custom image custom-image has osType Windows, expected Linux for image family Custom",
+		},
+		{
+			name:            "x64 image with an arm64 distro",
+			imageDefinition: imageDefinition(armcompute.OperatingSystemStateTypesGeneralized, armcompute.OperatingSystemTypesLinux, lo.ToPtr(armcompute.ArchitectureX64)),
+			imageTerm:       arm64Term,
+			expectedErr:     "custom image custom-image has architecture x64, but distroName aks-ubuntu-arm64-containerd-22.04-gen2 requires arm64",
+		},
+		{
+			name:            "Arm64 image with an amd64 distro",
+			imageDefinition: imageDefinition(armcompute.OperatingSystemStateTypesGeneralized, armcompute.OperatingSystemTypesLinux, lo.ToPtr(armcompute.ArchitectureArm64)),
+			imageTerm:       amd64Term,
+			expectedErr:     "custom image custom-image has architecture Arm64, but distroName aks-ubuntu-containerd-22.04-gen2 requires amd64",
+		},
+		{
+			name:            "image without architecture overridden to Arm64",
+			imageDefinition: imageDefinition(armcompute.OperatingSystemStateTypesGeneralized, armcompute.OperatingSystemTypesLinux, nil),
+			imageTerm:       v1beta1.CustomImageTerm{DistroName: arm64Term.DistroName, Architecture: string(armcompute.ArchitectureArm64)},
+		},
+		{
+			name:            "Arm64 image overridden to x64 with an arm64 distro",
+			imageDefinition: imageDefinition(armcompute.OperatingSystemStateTypesGeneralized, armcompute.OperatingSystemTypesLinux, lo.ToPtr(armcompute.ArchitectureArm64)),
+			imageTerm:       v1beta1.CustomImageTerm{DistroName: arm64Term.DistroName, Architecture: string(armcompute.ArchitectureX64)},
+			expectedErr:     "custom image custom-image has architecture x64, but distroName aks-ubuntu-arm64-containerd-22.04-gen2 requires arm64",
+		},
+		{
+			name:            "image without properties",
+			imageDefinition: &armcompute.GalleryImage{Name: lo.ToPtr("custom-image")},
+			imageTerm:       amd64Term,
+			expectedErr:     "custom image custom-image has no properties",
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			err := validateCustomImageDefinition(tc.imageDefinition, tc.imageTerm)
+			if tc.expectedErr == "" {
+				assert.NoError(t, err)
+			} else {
+				assert.EqualError(t, err, tc.expectedErr)
+				// incompatible images are surfaced on the AKSNodeClass
+				var imageIncompatibleErr *ImageIncompatibleError
+				assert.ErrorAs(t, err, &imageIncompatibleErr)
+			}
+		})
+	}
+}
+
+func TestCustomImageRequirements(t *testing.T) {
+	imageDefinition := func(architecture *armcompute.Architecture, hyperVGeneration *armcompute.HyperVGeneration) *armcompute.GalleryImage {
+		return &armcompute.GalleryImage{
+			Name: lo.ToPtr("custom-image"),
+			Properties: &armcompute.GalleryImageProperties{
+				Architecture:     architecture,
+				HyperVGeneration: hyperVGeneration,
+			},
+		}
+	}
+
+	cases := []struct {
+		name                     string
+		imageDefinition          *armcompute.GalleryImage
+		imageTerm                v1beta1.CustomImageTerm
+		expectedArch             string
+		expectedHyperVGeneration string
+	}{
+		{
+			name:                     "Gen2 x64 image",
+			imageDefinition:          imageDefinition(lo.ToPtr(armcompute.ArchitectureX64), lo.ToPtr(armcompute.HyperVGenerationV2)),
+			expectedArch:             karpv1.ArchitectureAmd64,
+			expectedHyperVGeneration: v1beta1.HyperVGenerationV2,
+		},
+		{
+			name:                     "Gen1 Arm64 image",
+			imageDefinition:          imageDefinition(lo.ToPtr(armcompute.ArchitectureArm64), lo.ToPtr(armcompute.HyperVGenerationV1)),
+			expectedArch:             karpv1.ArchitectureArm64,
+			expectedHyperVGeneration: v1beta1.HyperVGenerationV1,
+		},
+		{
+			name:                     "image without architecture and Hyper-V generation",
+			imageDefinition:          imageDefinition(nil, nil),
+			expectedArch:             karpv1.ArchitectureAmd64,
+			expectedHyperVGeneration: v1beta1.HyperVGenerationV1,
+		},
+		{
+			name:                     "image overridden by the custom image term",
+			imageDefinition:          imageDefinition(lo.ToPtr(armcompute.ArchitectureX64), lo.ToPtr(armcompute.HyperVGenerationV1)),
+			imageTerm:                v1beta1.CustomImageTerm{Architecture: string(armcompute.ArchitectureArm64), HyperVGeneration: string(armcompute.HyperVGenerationV2)},
+			expectedArch:             karpv1.ArchitectureArm64,
+			expectedHyperVGeneration: v1beta1.HyperVGenerationV2,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			requirements := customImageRequirements(tc.imageDefinition, tc.imageTerm)
+			assert.Equal(t, []string{tc.expectedArch}, requirements.Get(v1.LabelArchStable).Values())
+			assert.Equal(t, []string{tc.expectedHyperVGeneration}, requirements.Get(v1beta1.LabelSKUHyperVGeneration).Values())
+		})
+	}
+}
+
+func TestCustomImageTermForImage(t *testing.T) {
+	amd64Term := v1beta1.CustomImageTerm{
+		GallerySubscriptionID:    "00000000-0000-0000-0000-000000000000",
+		GalleryResourceGroupName: "images",
+		GalleryName:              "gallery",
+		Name:                     "ubuntu",
+		DistroName:               "aks-ubuntu-containerd-22.04-gen2",
+	}
+	arm64Term := amd64Term
+	arm64Term.Name = "ubuntu-arm64"
+	arm64Term.DistroName = "aks-ubuntu-arm64-containerd-22.04-gen2"
+	imageTerms := []v1beta1.CustomImageTerm{amd64Term, arm64Term}
+
+	imageTerm, ok := CustomImageTermForImage(imageTerms, BuildImageIDSIG(arm64Term.GallerySubscriptionID, arm64Term.GalleryResourceGroupName, arm64Term.GalleryName, arm64Term.Name, "1.0.0"))
+	assert.True(t, ok)
+	assert.Equal(t, arm64Term, imageTerm)
+
+	// resource IDs are case-insensitive
+	imageTerm, ok = CustomImageTermForImage(imageTerms, strings.ToUpper(BuildImageIDSIG(amd64Term.GallerySubscriptionID, amd64Term.GalleryResourceGroupName, amd64Term.GalleryName, amd64Term.Name, "1.0.0")))
+	assert.True(t, ok)
+	assert.Equal(t, amd64Term, imageTerm)
+
+	// the image of another gallery image, whose name the terms' names are a prefix of
+	_, ok = CustomImageTermForImage(imageTerms, BuildImageIDSIG(amd64Term.GallerySubscriptionID, amd64Term.GalleryResourceGroupName, amd64Term.GalleryName, "ubuntu-gpu", "1.0.0"))
+	assert.False(t, ok)
+}
+
+func TestCustomGalleryClientFactoryFailure(t *testing.T) {
+	ctx := options.ToContext(context.Background(), &options.Options{})
+	credentialErr := errors.New("DefaultAzureCredential: failed to acquire a token")
+	calls := 0
+	p := NewProvider(nil, "westus", "00000000-0000-0000-0000-000000000000", nil, cache.New(ImageExpirationInterval, ImageCacheCleaningInterval))
+	p.newCustomGalleryClientFactory = func(string, string) (*armcompute.ClientFactory, error) {
+		calls++
+		return nil, fmt.Errorf("obtaining a credential for the custom image gallery, %w", credentialErr)
+	}
+
+	nodeClass := &v1beta1.AKSNodeClass{
+		Spec: v1beta1.AKSNodeClassSpec{
+			ImageFamily: lo.ToPtr(v1beta1.CustomImageFamily),
+			CustomImageTerms: []v1beta1.CustomImageTerm{{
+				GallerySubscriptionID:    "11111111-1111-1111-1111-111111111111",
+				GalleryResourceGroupName: "images",
+				GalleryName:              "gallery",
+				Name:                     "ubuntu",
+			}},
+		},
+	}
+	nodeClass.StatusConditions().SetTrue(v1beta1.ConditionTypeKubernetesVersionReady)
+	nodeClass.Status.KubernetesVersion = "1.31.0"
+
+	// the failure is returned, rather than crashing the controller or caching no images
+	nodeImages, err := p.List(ctx, nodeClass)
+	assert.ErrorIs(t, err, credentialErr)
+	assert.Empty(t, nodeImages)
+	assert.ErrorIs(t, p.Probe(ctx, nodeClass), credentialErr)
+	assert.Equal(t, 2, calls)
+
+	// and the client factory is created again on the next reconcile
+	_, err = p.List(ctx, nodeClass)
+	assert.ErrorIs(t, err, credentialErr)
+	assert.Equal(t, 3, calls)
+}
+
+func TestCustomGalleryClientFactoryCache(t *testing.T) {
+	p := NewProvider(nil, "westus", "00000000-0000-0000-0000-000000000000", nil, cache.New(ImageExpirationInterval, ImageCacheCleaningInterval))
+	var calls atomic.Int32
+	release := make(chan struct{})
+	p.newCustomGalleryClientFactory = func(string, string) (*armcompute.ClientFactory, error) {
+		calls.Add(1)
+		<-release
+		return &armcompute.ClientFactory{}, nil
+	}
+
+	// a burst of first uses creates the client factory once
+	const callers = 50
+	clientFactories := make(chan *armcompute.ClientFactory, callers)
+	var wg sync.WaitGroup
+	for range callers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			clientFactory, err := p.customGalleryClientFactory("11111111-1111-1111-1111-111111111111", "")
+			assert.NoError(t, err)
+			clientFactories <- clientFactory
+		}()
+	}
+	time.Sleep(100 * time.Millisecond)
+	close(release)
+	wg.Wait()
+	close(clientFactories)
+	assert.Equal(t, int32(1), calls.Load())
+	first := <-clientFactories
+	for clientFactory := range clientFactories {
+		assert.Same(t, first, clientFactory)
+	}
+
+	// and reuses it, per subscription
+	clientFactory, err := p.customGalleryClientFactory("11111111-1111-1111-1111-111111111111", "")
+	assert.NoError(t, err)
+	assert.Same(t, first, clientFactory)
+	assert.Equal(t, int32(1), calls.Load())
+	_, err = p.customGalleryClientFactory("22222222-2222-2222-2222-222222222222", "")
+	assert.NoError(t, err)
+	assert.Equal(t, int32(2), calls.Load())
+
+	// until it expires, so that a rotated credential is picked up
+	p.customGalleryClientFactories = cache.New(time.Millisecond, time.Minute)
+	_, err = p.customGalleryClientFactory("11111111-1111-1111-1111-111111111111", "")
+	assert.NoError(t, err)
+	time.Sleep(10 * time.Millisecond)
+	clientFactory, err = p.customGalleryClientFactory("11111111-1111-1111-1111-111111111111", "")
+	assert.NoError(t, err)
+	assert.Equal(t, int32(4), calls.Load())
+	assert.NotSame(t, first, clientFactory)
+}
+
+// galleryImageVersion returns a version of the custom image published days after the first, targeting the regions,
+// and with the regional replication states
+func galleryImageVersion(name string, days int, excludeFromLatest bool, targetRegions []string, replicationStates map[string]armcompute.ReplicationState) *armcompute.GalleryImageVersion {
+	return &armcompute.GalleryImageVersion{
+		ID:   lo.ToPtr("/subscriptions/11111111-1111-1111-1111-111111111111/resourceGroups/images/providers/Microsoft.Compute/galleries/gallery/images/ubuntu/versions/" + name),
+		Name: lo.ToPtr(name),
+		Properties: &armcompute.GalleryImageVersionProperties{
+			PublishingProfile: &armcompute.GalleryImageVersionPublishingProfile{
+				PublishedDate:     lo.ToPtr(time.Date(2025, 1, 1+days, 0, 0, 0, 0, time.UTC)),
+				ExcludeFromLatest: lo.ToPtr(excludeFromLatest),
+				TargetRegions: lo.Map(targetRegions, func(region string, _ int) *armcompute.TargetRegion {
+					return &armcompute.TargetRegion{Name: lo.ToPtr(region)}
+				}),
+			},
+			ReplicationStatus: &armcompute.ReplicationStatus{
+				Summary: lo.MapToSlice(replicationStates, func(region string, state armcompute.ReplicationState) *armcompute.RegionalReplicationStatus {
+					return &armcompute.RegionalReplicationStatus{Region: lo.ToPtr(region), State: lo.ToPtr(state)}
+				}),
+			},
+		},
+	}
+}
+
+// fakeGalleryImagesServer returns a server of generalized Linux gallery image definitions
+func fakeGalleryImagesServer() computefake.GalleryImagesServer {
+	return computefake.GalleryImagesServer{
+		Get: func(_ context.Context, _, _, galleryImageName string, _ *armcompute.GalleryImagesClientGetOptions) (resp azfake.Responder[armcompute.GalleryImagesClientGetResponse], errResp azfake.ErrorResponder) {
+			resp.SetResponse(http.StatusOK, armcompute.GalleryImagesClientGetResponse{GalleryImage: armcompute.GalleryImage{
+				Name: lo.ToPtr(galleryImageName),
+				Properties: &armcompute.GalleryImageProperties{
+					OSState: lo.ToPtr(armcompute.OperatingSystemStateTypesGeneralized),
+					OSType:  lo.ToPtr(armcompute.OperatingSystemTypesLinux),
+				},
+			}}, nil)
+			return
+		},
+	}
+}
+
+// fakeGalleryClientFactory returns a client factory of a gallery with a generalized Linux image, of the versions
+func fakeGalleryClientFactory(t *testing.T, imageVersions ...*armcompute.GalleryImageVersion) *armcompute.ClientFactory {
+	t.Helper()
+	transport := computefake.NewServerFactoryTransport(&computefake.ServerFactory{
+		GalleryImagesServer: fakeGalleryImagesServer(),
+		GalleryImageVersionsServer: computefake.GalleryImageVersionsServer{
+			NewListByGalleryImagePager: func(_, _, _ string, _ *armcompute.GalleryImageVersionsClientListByGalleryImageOptions) (resp azfake.PagerResponder[armcompute.GalleryImageVersionsClientListByGalleryImageResponse]) {
+				// the list doesn't return the replication status, like ARM
+				for _, imageVersion := range imageVersions {
+					listed := *imageVersion
+					listed.Properties = lo.ToPtr(*imageVersion.Properties)
+					listed.Properties.ReplicationStatus = nil
+					resp.AddPage(http.StatusOK, armcompute.GalleryImageVersionsClientListByGalleryImageResponse{
+						GalleryImageVersionList: armcompute.GalleryImageVersionList{Value: []*armcompute.GalleryImageVersion{&listed}},
+					}, nil)
+				}
+				return
+			},
+			Get: func(_ context.Context, _, _, _, galleryImageVersionName string, options *armcompute.GalleryImageVersionsClientGetOptions) (resp azfake.Responder[armcompute.GalleryImageVersionsClientGetResponse], errResp azfake.ErrorResponder) {
+				imageVersion, ok := lo.Find(imageVersions, func(imageVersion *armcompute.GalleryImageVersion) bool {
+					return lo.FromPtr(imageVersion.Name) == galleryImageVersionName
+				})
+				if !ok {
+					errResp.SetResponseError(http.StatusNotFound, "NotFound")
+					return
+				}
+				got := *imageVersion
+				if options == nil || lo.FromPtr(options.Expand) != armcompute.ReplicationStatusTypesReplicationStatus {
+					got.Properties = lo.ToPtr(*imageVersion.Properties)
+					got.Properties.ReplicationStatus = nil
+				}
+				resp.SetResponse(http.StatusOK, armcompute.GalleryImageVersionsClientGetResponse{GalleryImageVersion: got}, nil)
+				return
+			},
+		},
+	})
+	clientFactory, err := armcompute.NewClientFactory("11111111-1111-1111-1111-111111111111", &azfake.TokenCredential{},
+		&arm.ClientOptions{ClientOptions: azcore.ClientOptions{Transport: transport}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return clientFactory
+}
+
+// withTags returns the image version with the tags
+func withTags(imageVersion *armcompute.GalleryImageVersion, tags map[string]string) *armcompute.GalleryImageVersion {
+	imageVersion.Tags = lo.MapValues(tags, func(value, _ string) *string { return lo.ToPtr(value) })
+	return imageVersion
+}
+
+func TestCustomImageLatestVersion(t *testing.T) {
+	completed := map[string]armcompute.ReplicationState{"West US": armcompute.ReplicationStateCompleted}
+	for _, tc := range []struct {
+		name               string
+		imageVersions      []*armcompute.GalleryImageVersion
+		versionConstraint  string
+		versionTagSelector map[string]string
+		expected           string
+		expectedErr        string
+	}{
+		{
+			name: "newest version",
+			imageVersions: []*armcompute.GalleryImageVersion{
+				galleryImageVersion("1.0.0", 0, false, []string{"West US"}, completed),
+				galleryImageVersion("1.1.0", 1, false, []string{"West US"}, completed),
+			},
+			expected: "1.1.0",
+		},
+		{
+			name: "newest version not excluded from latest",
+			imageVersions: []*armcompute.GalleryImageVersion{
+				galleryImageVersion("1.0.0", 0, false, []string{"West US"}, completed),
+				galleryImageVersion("1.1.0-rc1", 1, true, []string{"West US"}, completed),
+			},
+			expected: "1.0.0",
+		},
+		{
+			name: "newest version targeting the region",
+			imageVersions: []*armcompute.GalleryImageVersion{
+				galleryImageVersion("1.0.0", 0, false, []string{"East US", "westus"}, map[string]armcompute.ReplicationState{"westus": armcompute.ReplicationStateCompleted}),
+				galleryImageVersion("1.1.0", 1, false, []string{"East US"}, map[string]armcompute.ReplicationState{"East US": armcompute.ReplicationStateCompleted}),
+			},
+			expected: "1.0.0",
+		},
+		{
+			name: "newest version replicated to the region",
+			imageVersions: []*armcompute.GalleryImageVersion{
+				galleryImageVersion("1.0.0", 0, false, []string{"West US"}, completed),
+				galleryImageVersion("1.0.1", 1, false, []string{"West US"}, completed),
+				galleryImageVersion("1.1.0", 2, false, []string{"West US"}, map[string]armcompute.ReplicationState{"West US": armcompute.ReplicationStateReplicating}),
+				galleryImageVersion("1.2.0", 3, false, []string{"West US"}, map[string]armcompute.ReplicationState{"West US": armcompute.ReplicationStateFailed}),
+			},
+			expected: "1.0.1",
+		},
+		{
+			name: "no version may be the latest",
+			imageVersions: []*armcompute.GalleryImageVersion{
+				galleryImageVersion("1.0.0", 0, true, []string{"West US"}, completed),
+				galleryImageVersion("1.1.0", 1, false, []string{"West US"}, map[string]armcompute.ReplicationState{"West US": armcompute.ReplicationStateReplicating}),
+			},
+			expectedErr: "custom image ubuntu has none of its 2 versions of the Stable image channel replicated to westus",
+		},
+		{
+			name: "newest version satisfying the version constraint",
+			imageVersions: []*armcompute.GalleryImageVersion{
+				galleryImageVersion("1.0.0", 0, false, []string{"West US"}, completed),
+				galleryImageVersion("1.1.0", 1, false, []string{"West US"}, completed),
+				galleryImageVersion("2.0.0", 2, false, []string{"West US"}, completed),
+			},
+			versionConstraint: "1.x",
+			expected:          "1.1.0",
+		},
+		{
+			name: "no version satisfying the version constraint",
+			imageVersions: []*armcompute.GalleryImageVersion{
+				galleryImageVersion("1.0.0", 0, false, []string{"West US"}, completed),
+			},
+			versionConstraint: ">=2.0.0",
+			expectedErr:       `no version of image ubuntu satisfies the version constraint ">=2.0.0"`,
+		},
+		{
+			name: "newest version with the tags of the version tag selector",
+			imageVersions: []*armcompute.GalleryImageVersion{
+				withTags(galleryImageVersion("1.0.0", 0, false, []string{"West US"}, completed), map[string]string{"validated": "true", "team": "nodes"}),
+				withTags(galleryImageVersion("1.1.0", 1, false, []string{"West US"}, completed), map[string]string{"validated": "false"}),
+				galleryImageVersion("1.2.0", 2, false, []string{"West US"}, completed),
+			},
+			versionTagSelector: map[string]string{"validated": "true"},
+			expected:           "1.0.0",
+		},
+		{
+			name: "no version with the tags of the version tag selector",
+			imageVersions: []*armcompute.GalleryImageVersion{
+				withTags(galleryImageVersion("1.0.0", 0, false, []string{"West US"}, completed), map[string]string{"validated": "true"}),
+			},
+			versionTagSelector: map[string]string{"validated": "true", "team": "nodes"},
+			expectedErr:        "no version of image ubuntu has the tags of the version tag selector {team=nodes,validated=true}",
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			ctx := options.ToContext(context.Background(), &options.Options{})
+			p := NewProvider(nil, "westus", "00000000-0000-0000-0000-000000000000", nil, cache.New(ImageExpirationInterval, ImageCacheCleaningInterval))
+			clientFactory := fakeGalleryClientFactory(t, tc.imageVersions...)
+			p.newCustomGalleryClientFactory = func(string, string) (*armcompute.ClientFactory, error) { return clientFactory, nil }
+			nodeClass := &v1beta1.AKSNodeClass{
+				Spec: v1beta1.AKSNodeClassSpec{
+					ImageFamily: lo.ToPtr(v1beta1.CustomImageFamily),
+					CustomImageTerms: []v1beta1.CustomImageTerm{{
+						GallerySubscriptionID:    "11111111-1111-1111-1111-111111111111",
+						GalleryResourceGroupName: "images",
+						GalleryName:              "gallery",
+						Name:                     "ubuntu",
+						VersionConstraint:        tc.versionConstraint,
+						VersionTagSelector:       tc.versionTagSelector,
+					}},
+				},
+			}
+			nodeClass.StatusConditions().SetTrue(v1beta1.ConditionTypeKubernetesVersionReady)
+			nodeClass.Status.KubernetesVersion = "1.31.0"
+
+			nodeImages, err := p.List(ctx, nodeClass)
+			if tc.expectedErr != "" {
+				assert.ErrorContains(t, err, tc.expectedErr)
+				return
+			}
+			assert.NoError(t, err)
+			if assert.Len(t, nodeImages, 1) {
+				assert.True(t, strings.HasSuffix(nodeImages[0].ID, "/versions/"+tc.expected), "expected version %s, got image %s", tc.expected, nodeImages[0].ID)
+			}
+		})
+	}
+}
+
+func TestCustomImageWithoutVersions(t *testing.T) {
+	emptyPage := computefake.GalleryImageVersionsServer{
+		NewListByGalleryImagePager: func(_, _, _ string, _ *armcompute.GalleryImageVersionsClientListByGalleryImageOptions) (resp azfake.PagerResponder[armcompute.GalleryImageVersionsClientListByGalleryImageResponse]) {
+			resp.AddPage(http.StatusOK, armcompute.GalleryImageVersionsClientListByGalleryImageResponse{}, nil)
+			return
+		},
+	}
+	withoutID := computefake.GalleryImageVersionsServer{
+		Get: func(_ context.Context, _, _, _, galleryImageVersionName string, _ *armcompute.GalleryImageVersionsClientGetOptions) (resp azfake.Responder[armcompute.GalleryImageVersionsClientGetResponse], errResp azfake.ErrorResponder) {
+			resp.SetResponse(http.StatusOK, armcompute.GalleryImageVersionsClientGetResponse{GalleryImageVersion: armcompute.GalleryImageVersion{Name: lo.ToPtr(galleryImageVersionName)}}, nil)
+			return
+		},
+	}
+	for _, tc := range []struct {
+		name                string
+		imageVersionsServer computefake.GalleryImageVersionsServer
+		version             string
+	}{
+		{name: "empty page of versions", imageVersionsServer: emptyPage},
+		{name: "pinned version without an ID", imageVersionsServer: withoutID, version: "1.0.0"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			ctx := options.ToContext(context.Background(), &options.Options{})
+			p := NewProvider(nil, "westus", "00000000-0000-0000-0000-000000000000", nil, cache.New(ImageExpirationInterval, ImageCacheCleaningInterval))
+			clientFactory, err := armcompute.NewClientFactory("11111111-1111-1111-1111-111111111111", &azfake.TokenCredential{},
+				&arm.ClientOptions{ClientOptions: azcore.ClientOptions{Transport: computefake.NewServerFactoryTransport(&computefake.ServerFactory{
+					GalleryImagesServer:        fakeGalleryImagesServer(),
+					GalleryImageVersionsServer: tc.imageVersionsServer,
+				})}})
+			assert.NoError(t, err)
+			p.newCustomGalleryClientFactory = func(string, string) (*armcompute.ClientFactory, error) { return clientFactory, nil }
+			nodeClass := &v1beta1.AKSNodeClass{
+				Spec: v1beta1.AKSNodeClassSpec{
+					ImageFamily: lo.ToPtr(v1beta1.CustomImageFamily),
+					CustomImageTerms: []v1beta1.CustomImageTerm{{
+						GallerySubscriptionID:    "11111111-1111-1111-1111-111111111111",
+						GalleryResourceGroupName: "images",
+						GalleryName:              "gallery",
+						Name:                     "ubuntu",
+						Version:                  tc.version,
+					}},
+				},
+			}
+			nodeClass.StatusConditions().SetTrue(v1beta1.ConditionTypeKubernetesVersionReady)
+			nodeClass.Status.KubernetesVersion = "1.31.0"
+
+			// the image definition created ahead of its first version has no images yet, rather than crashing the reconcile
+			nodeImages, err := p.List(ctx, nodeClass)
+			var imageVersionsNotFoundErr *ImageVersionsNotFoundError
+			if assert.ErrorAs(t, err, &imageVersionsNotFoundErr) {
+				assert.Equal(t, "gallery", imageVersionsNotFoundErr.Gallery)
+				assert.Equal(t, "ubuntu", imageVersionsNotFoundErr.ImageDefinition)
+			}
+			assert.Empty(t, nodeImages)
+		})
+	}
+
+	t.Run("shared gallery", func(t *testing.T) {
+		ctx := options.ToContext(context.Background(), &options.Options{})
+		p := NewProvider(nil, "westus", "00000000-0000-0000-0000-000000000000", nil, cache.New(ImageExpirationInterval, ImageCacheCleaningInterval))
+		clientFactory := fakeSharedGalleryClientFactory(t)
+		p.newCustomGalleryClientFactory = func(string, string) (*armcompute.ClientFactory, error) { return clientFactory, nil }
+		nodeClass := &v1beta1.AKSNodeClass{
+			Spec: v1beta1.AKSNodeClassSpec{
+				ImageFamily: lo.ToPtr(v1beta1.CustomImageFamily),
+				CustomImageTerms: []v1beta1.CustomImageTerm{{
+					SharedGalleryUniqueName: "11111111-1111-1111-1111-111111111111-SHAREDGALLERY",
+					Name:                    "ubuntu",
+				}},
+			},
+		}
+		nodeClass.StatusConditions().SetTrue(v1beta1.ConditionTypeKubernetesVersionReady)
+		nodeClass.Status.KubernetesVersion = "1.31.0"
+
+		_, err := p.List(ctx, nodeClass)
+		var imageVersionsNotFoundErr *ImageVersionsNotFoundError
+		assert.ErrorAs(t, err, &imageVersionsNotFoundErr)
+		assert.EqualError(t, err, "no versions found for image ubuntu of gallery 11111111-1111-1111-1111-111111111111-SHAREDGALLERY")
+	})
+}
+
+func TestCustomImagesArm64(t *testing.T) {
+	customImages := CustomImages{Options: &parameters.StaticParameters{Arch: karpv1.ArchitectureArm64, KubernetesVersion: "1.31.0"}}
+
+	arm64Requirements := scheduling.NewRequirements(scheduling.NewRequirement(v1.LabelArchStable, v1.NodeSelectorOpIn, karpv1.ArchitectureArm64))
+	arm64Images := lo.Filter(customImages.DefaultImages(true, nil), func(image types.DefaultImageOutput, _ int) bool {
+		return image.Requirements.Compatible(arm64Requirements) == nil
+	})
+	assert.Len(t, arm64Images, 1)
+	assert.Equal(t, "aks-ubuntu-arm64-containerd-22.04-gen2", arm64Images[0].Distro)
+
+	// the bootstrap of arm64 nodes selects the arm64 kubelet binaries and packages
+	scriptless, ok := customImages.ScriptlessCustomData(&bootstrap.KubeletConfiguration{}, nil, nil, nil, nil).(bootstrap.AKS)
+	assert.True(t, ok)
+	assert.Equal(t, karpv1.ArchitectureArm64, scriptless.Arch)
+	customScripts, ok := customImages.CustomScriptsNodeBootstrapping(&bootstrap.KubeletConfiguration{}, nil, nil, nil, nil,
+		arm64Images[0].Distro, "", nil, nil).(customscriptsbootstrap.ProvisionClientBootstrap)
+	assert.True(t, ok)
+	assert.Equal(t, karpv1.ArchitectureArm64, customScripts.Arch)
+}
+
+// fakeSharedGalleryClientFactory returns a client factory of a directly shared gallery with a generalized Linux image,
+// of the versions
+func fakeSharedGalleryClientFactory(t *testing.T, imageVersions ...*armcompute.SharedGalleryImageVersion) *armcompute.ClientFactory {
+	t.Helper()
+	transport := computefake.NewServerFactoryTransport(&computefake.ServerFactory{
+		SharedGalleryImagesServer: computefake.SharedGalleryImagesServer{
+			Get: func(_ context.Context, _, _, galleryImageName string, _ *armcompute.SharedGalleryImagesClientGetOptions) (resp azfake.Responder[armcompute.SharedGalleryImagesClientGetResponse], errResp azfake.ErrorResponder) {
+				resp.SetResponse(http.StatusOK, armcompute.SharedGalleryImagesClientGetResponse{SharedGalleryImage: armcompute.SharedGalleryImage{
+					Name: lo.ToPtr(galleryImageName),
+					Properties: &armcompute.SharedGalleryImageProperties{
+						OSState: lo.ToPtr(armcompute.OperatingSystemStateTypesGeneralized),
+						OSType:  lo.ToPtr(armcompute.OperatingSystemTypesLinux),
+					},
+				}}, nil)
+				return
+			},
+		},
+		SharedGalleryImageVersionsServer: computefake.SharedGalleryImageVersionsServer{
+			NewListPager: func(_, _, _ string, _ *armcompute.SharedGalleryImageVersionsClientListOptions) (resp azfake.PagerResponder[armcompute.SharedGalleryImageVersionsClientListResponse]) {
+				resp.AddPage(http.StatusOK, armcompute.SharedGalleryImageVersionsClientListResponse{
+					SharedGalleryImageVersionList: armcompute.SharedGalleryImageVersionList{Value: imageVersions},
+				}, nil)
+				return
+			},
+			Get: func(_ context.Context, _, _, _, galleryImageVersionName string, _ *armcompute.SharedGalleryImageVersionsClientGetOptions) (resp azfake.Responder[armcompute.SharedGalleryImageVersionsClientGetResponse], errResp azfake.ErrorResponder) {
+				imageVersion, ok := lo.Find(imageVersions, func(imageVersion *armcompute.SharedGalleryImageVersion) bool {
+					return lo.FromPtr(imageVersion.Name) == galleryImageVersionName
+				})
+				if !ok {
+					errResp.SetResponseError(http.StatusNotFound, "NotFound")
+					return
+				}
+				resp.SetResponse(http.StatusOK, armcompute.SharedGalleryImageVersionsClientGetResponse{SharedGalleryImageVersion: *imageVersion}, nil)
+				return
+			},
+		},
+	})
+	clientFactory, err := armcompute.NewClientFactory("00000000-0000-0000-0000-000000000000", &azfake.TokenCredential{},
+		&arm.ClientOptions{ClientOptions: azcore.ClientOptions{Transport: transport}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return clientFactory
+}
+
+func TestSharedGalleryCustomImage(t *testing.T) {
+	sharedGalleryImageVersion := func(name string, days int, excludeFromLatest bool) *armcompute.SharedGalleryImageVersion {
+		return &armcompute.SharedGalleryImageVersion{
+			Name: lo.ToPtr(name),
+			Properties: &armcompute.SharedGalleryImageVersionProperties{
+				PublishedDate:     lo.ToPtr(time.Date(2025, 1, 1+days, 0, 0, 0, 0, time.UTC)),
+				ExcludeFromLatest: lo.ToPtr(excludeFromLatest),
+			},
+		}
+	}
+	imageVersions := []*armcompute.SharedGalleryImageVersion{
+		sharedGalleryImageVersion("1.0.0", 0, false),
+		sharedGalleryImageVersion("1.1.0", 1, false),
+		sharedGalleryImageVersion("1.2.0-rc1", 2, true),
+	}
+	for _, tc := range []struct {
+		name     string
+		version  string
+		expected string
+	}{
+		{name: "newest version not excluded from latest", expected: "/SharedGalleries/11111111-1111-1111-1111-111111111111-SHAREDGALLERY/Images/ubuntu/Versions/1.1.0"},
+		{name: "pinned version", version: "1.0.0", expected: "/SharedGalleries/11111111-1111-1111-1111-111111111111-SHAREDGALLERY/Images/ubuntu/Versions/1.0.0"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			ctx := options.ToContext(context.Background(), &options.Options{})
+			p := NewProvider(nil, "westus", "00000000-0000-0000-0000-000000000000", nil, cache.New(ImageExpirationInterval, ImageCacheCleaningInterval))
+			clientFactory := fakeSharedGalleryClientFactory(t, imageVersions...)
+			var subscriptionIDs, tenantIDs []string
+			p.newCustomGalleryClientFactory = func(subscriptionID, tenantID string) (*armcompute.ClientFactory, error) {
+				subscriptionIDs = append(subscriptionIDs, subscriptionID)
+				tenantIDs = append(tenantIDs, tenantID)
+				return clientFactory, nil
+			}
+			nodeClass := &v1beta1.AKSNodeClass{
+				Spec: v1beta1.AKSNodeClassSpec{
+					ImageFamily: lo.ToPtr(v1beta1.CustomImageFamily),
+					CustomImageTerms: []v1beta1.CustomImageTerm{{
+						TenantID:                "33333333-3333-3333-3333-333333333333",
+						SharedGalleryUniqueName: "11111111-1111-1111-1111-111111111111-SHAREDGALLERY",
+						Name:                    "ubuntu",
+						Version:                 tc.version,
+					}},
+				},
+			}
+			nodeClass.StatusConditions().SetTrue(v1beta1.ConditionTypeKubernetesVersionReady)
+			nodeClass.Status.KubernetesVersion = "1.31.0"
+
+			nodeImages, err := p.List(ctx, nodeClass)
+			assert.NoError(t, err)
+			if assert.Len(t, nodeImages, 1) {
+				assert.Equal(t, tc.expected, nodeImages[0].ID)
+			}
+			// the gallery is shared with the subscription of the cluster, and accessed with a token of its tenant
+			assert.Equal(t, []string{"00000000-0000-0000-0000-000000000000"}, lo.Uniq(subscriptionIDs))
+			assert.Equal(t, []string{"33333333-3333-3333-3333-333333333333"}, lo.Uniq(tenantIDs))
+		})
+	}
+}
@@ -31,6 +31,7 @@ import (
 	"github.com/Azure/karpenter-provider-azure/pkg/providers/imagefamily/types"
 	"github.com/Azure/karpenter-provider-azure/pkg/provisionclients/models"
 	"github.com/Azure/karpenter-provider-azure/pkg/utils"
+	"github.com/Azure/karpenter-provider-azure/pkg/utils/redact"
 
 	v1 "k8s.io/api/core/v1"
 	karpv1 "sigs.k8s.io/karpenter/pkg/apis/v1"
@@ -56,7 +57,7 @@ type ProvisionClientBootstrap struct {
 	SubscriptionID                 string
 	ClusterResourceGroup           string
 	ResourceGroup                  string
-	KubeletClientTLSBootstrapToken string
+	KubeletClientTLSBootstrapToken redact.Secret
 	KubernetesVersion              string
 	ImageDistro                    string
 	IsWindows                      bool
@@ -85,7 +86,7 @@ func (p ProvisionClientBootstrap) GetCustomDataAndCSE(ctx context.Context) (stri
 		return "", "", fmt.Errorf("nodeBootstrapping.Get failed with error: %w", err)
 	}
 
-	customDataHydrated, cseHydrated, err := hydrateBootstrapTokenIfNeeded(nodeBootstrapping.CustomDataEncodedDehydratable, nodeBootstrapping.CSEDehydratable, p.KubeletClientTLSBootstrapToken)
+	customDataHydrated, cseHydrated, err := hydrateBootstrapTokenIfNeeded(nodeBootstrapping.CustomDataEncodedDehydratable, nodeBootstrapping.CSEDehydratable, string(p.KubeletClientTLSBootstrapToken))
 	if err != nil {
 		return "", "", fmt.Errorf("hydrateBootstrapTokenIfNeeded failed with error: %w", err)
 	}
@@ -168,6 +169,10 @@ func (p *ProvisionClientBootstrap) ConstructProvisionValues(ctx context.Context)
 			ContainerLogMaxSizeMB: convertContainerLogMaxSizeToMB(p.KubeletConfig.ContainerLogMaxSize),
 			ContainerLogMaxFiles:  p.KubeletConfig.ContainerLogMaxFiles,
 			PodMaxPids:            convertPodMaxPids(p.KubeletConfig.PodPidsLimit),
+			// the hardening is requested explicitly, rather than relying on the defaults of the service and the image
+			ReadOnlyPort:      lo.ToPtr(p.KubeletConfig.InsecureKubeletDefaults.GetReadOnlyPort()),
+			AnonymousAuth:     lo.ToPtr(p.KubeletConfig.InsecureKubeletDefaults.GetAnonymousAuth()),
+			AuthorizationMode: lo.ToPtr(p.KubeletConfig.InsecureKubeletDefaults.GetAuthorizationMode()),
 		}
 
 		// NodeClaim defaults don't work somehow and keep giving invalid values. Can be improved later.
@@ -0,0 +1,116 @@
+/*
+Portions Copyright (c) Microsoft Corporation.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package imagefamily
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/patrickmn/go-cache"
+	"k8s.io/utils/clock"
+
+	"github.com/Azure/karpenter-provider-azure/pkg/metrics"
+	"github.com/Azure/karpenter-provider-azure/pkg/operator/options"
+)
+
+// maxFailedLookupBackoff caps how long a lookup failing over and over is returned from the cache before it's retried
+const maxFailedLookupBackoff = 5 * time.Minute
+
+// failedLookup is a cached failure of a lookup of images
+type failedLookup struct {
+	err error
+	// failures is the number of consecutive failures of the lookup, which the backoff grows with
+	failures int
+	retryAt  time.Time
+}
+
+// failedLookups caches the failures of lookups of images, e.g. while the gallery throttles them, so that they're
+// returned again until they're retried, rather than retried by every caller in the meantime, which would make the
+// throttling worse. Lookups failing again are retried after exponentially longer, starting from the image lookup
+// failures TTL and capped at maxFailedLookupBackoff. The failures are cached along with the images they're lookups of.
+type failedLookups struct {
+	cache *cache.Cache
+	clock clock.Clock
+}
+
+func newFailedLookups(nodeImagesCache *cache.Cache, clk clock.Clock) *failedLookups {
+	return &failedLookups{
+		cache: nodeImagesCache,
+		clock: clk,
+	}
+}
+
+func failedLookupCacheKey(key string) string {
+	return "failed-lookup-" + key
+}
+
+// lookup returns the result of list for the key, or the cached failure of its previous lookup until it's retried.
+// Failures are cached for the image lookup failures TTL, and not at all when it's 0. Lookups failing as their context is
+// canceled, e.g. on shutdown, aren't failures of the gallery, and are retried right away by the next caller, including
+// those that joined the lookup of a caller canceled meanwhile in the image work queue.
+func (f *failedLookups) lookup(ctx context.Context, key string, list func() ([]NodeImage, error)) ([]NodeImage, error) {
+	key = failedLookupCacheKey(key)
+	var previous *failedLookup
+	if cached, ok := f.cache.Get(key); ok {
+		previous = cached.(*failedLookup)
+		if f.clock.Now().Before(previous.retryAt) {
+			metrics.ImageLookupFailureCacheHits.Inc()
+			return nil, previous.err
+		}
+	}
+	nodeImages, err := list()
+	if isCanceled(ctx, err) {
+		return nil, err
+	}
+	ttl := options.FromContext(ctx).CacheConfig.ImageLookupFailuresTTL
+	if err == nil || ttl <= 0 {
+		f.cache.Delete(key)
+		return nodeImages, err
+	}
+	failure := &failedLookup{err: err, failures: 1}
+	if previous != nil {
+		failure.failures = previous.failures + 1
+	}
+	failure.retryAt = f.clock.Now().Add(failedLookupBackoff(ttl, failure.failures))
+	// the failure is kept past its retry, to back off from the lookup failing again
+	f.cache.Set(key, failure, 2*maxFailedLookupBackoff)
+	return nil, err
+}
+
+// evict removes the cached failure of the lookup for the key, so that it's retried right away
+func (f *failedLookups) evict(key string) {
+	f.cache.Delete(failedLookupCacheKey(key))
+}
+
+// isCanceled returns whether the lookup failed with err because its context, or that of the caller whose lookup it
+// joined, was canceled
+func isCanceled(ctx context.Context, err error) bool {
+	return err != nil && (ctx.Err() != nil || errors.Is(err, context.Canceled))
+}
+
+// failedLookupBackoff returns how long a lookup that failed the given number of consecutive times is not retried
+func failedLookupBackoff(ttl time.Duration, failures int) time.Duration {
+	backoff := ttl
+	for range failures - 1 {
+		if backoff >= maxFailedLookupBackoff {
+			break
+		}
+		backoff *= 2
+	}
+	return min(backoff, maxFailedLookupBackoff)
+}
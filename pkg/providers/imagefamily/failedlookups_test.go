@@ -0,0 +1,111 @@
+/*
+Portions Copyright (c) Microsoft Corporation.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package imagefamily
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/patrickmn/go-cache"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	clock "k8s.io/utils/clock/testing"
+
+	"github.com/Azure/karpenter-provider-azure/pkg/metrics"
+	"github.com/Azure/karpenter-provider-azure/pkg/operator/options"
+)
+
+func TestFailedLookups(t *testing.T) {
+	fakeClock := clock.NewFakeClock(time.Now())
+	f := newFailedLookups(cache.New(ImageExpirationInterval, ImageCacheCleaningInterval), fakeClock)
+	ctx := options.ToContext(context.Background(), &options.Options{CacheConfig: options.CacheConfig{ImageLookupFailuresTTL: 30 * time.Second}})
+	throttled := errors.New("TooManyRequests")
+	lookups := 0
+	var lookupErr error
+	list := func() ([]NodeImage, error) {
+		lookups++
+		return []NodeImage{{ID: "image"}}, lookupErr
+	}
+	hits := testutil.ToFloat64(metrics.ImageLookupFailureCacheHits)
+
+	// a failed lookup is returned again until its TTL passes
+	lookupErr = throttled
+	for range 3 {
+		_, err := f.lookup(ctx, "key", list)
+		assert.Equal(t, throttled, err)
+	}
+	assert.Equal(t, 1, lookups)
+	assert.Equal(t, hits+2, testutil.ToFloat64(metrics.ImageLookupFailureCacheHits))
+	// other lookups aren't
+	_, err := f.lookup(ctx, "other", list)
+	assert.Equal(t, throttled, err)
+	assert.Equal(t, 2, lookups)
+
+	// a lookup failing again is retried after exponentially longer
+	fakeClock.Step(30 * time.Second)
+	_, err = f.lookup(ctx, "key", list)
+	assert.Equal(t, throttled, err)
+	assert.Equal(t, 3, lookups)
+	fakeClock.Step(59 * time.Second)
+	_, err = f.lookup(ctx, "key", list)
+	assert.Equal(t, throttled, err)
+	assert.Equal(t, 3, lookups)
+
+	// a successful lookup resets the backoff
+	lookupErr = nil
+	fakeClock.Step(time.Second)
+	nodeImages, err := f.lookup(ctx, "key", list)
+	assert.NoError(t, err)
+	assert.Equal(t, []NodeImage{{ID: "image"}}, nodeImages)
+	assert.Equal(t, 4, lookups)
+	lookupErr = throttled
+	_, err = f.lookup(ctx, "key", list)
+	assert.Equal(t, throttled, err)
+	fakeClock.Step(30 * time.Second)
+	_, err = f.lookup(ctx, "key", list)
+	assert.Equal(t, throttled, err)
+	assert.Equal(t, 6, lookups)
+
+	// an evicted failure is retried right away
+	f.evict("key")
+	_, err = f.lookup(ctx, "key", list)
+	assert.Equal(t, throttled, err)
+	assert.Equal(t, 7, lookups)
+
+	// failures aren't cached with a TTL of 0
+	ctx = options.ToContext(context.Background(), &options.Options{})
+	for range 3 {
+		_, err = f.lookup(ctx, "disabled", list)
+		assert.Equal(t, throttled, err)
+	}
+	assert.Equal(t, 10, lookups)
+}
+
+func TestFailedLookupBackoff(t *testing.T) {
+	for failures, want := range map[int]time.Duration{
+		1: 30 * time.Second,
+		2: time.Minute,
+		3: 2 * time.Minute,
+		4: 4 * time.Minute,
+		5: maxFailedLookupBackoff,
+		6: maxFailedLookupBackoff,
+	} {
+		assert.Equal(t, want, failedLookupBackoff(30*time.Second, failures), "failures: %d", failures)
+	}
+}
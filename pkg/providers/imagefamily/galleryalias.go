@@ -0,0 +1,89 @@
+/*
+Portions Copyright (c) Microsoft Corporation.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package imagefamily
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/arm"
+	"github.com/samber/lo"
+
+	"github.com/Azure/karpenter-provider-azure/pkg/apis/v1beta1"
+	"github.com/Azure/karpenter-provider-azure/pkg/operator/options"
+)
+
+// CustomImageTerms returns the custom image terms of the AKSNodeClass, with the galleries aliased by the gallery-aliases
+// option replaced by the galleries they moved to, so that new launches use the new galleries while the AKSNodeClasses
+// still reference the old ones
+func CustomImageTerms(ctx context.Context, nodeClass *v1beta1.AKSNodeClass) []v1beta1.CustomImageTerm {
+	aliases := options.FromContext(ctx).GalleryAliases
+	if len(aliases) == 0 {
+		return nodeClass.CustomImageTerms()
+	}
+	return lo.Map(nodeClass.CustomImageTerms(), func(imageTerm v1beta1.CustomImageTerm, _ int) v1beta1.CustomImageTerm {
+		if imageTerm.SharedGalleryUniqueName != "" {
+			return imageTerm
+		}
+		gallery, ok := galleryAlias(aliases, galleryID(imageTerm.GallerySubscriptionID, imageTerm.GalleryResourceGroupName, imageTerm.GalleryName))
+		if !ok {
+			return imageTerm
+		}
+		id, err := arm.ParseResourceID(gallery)
+		if err != nil {
+			return imageTerm
+		}
+		imageTerm.GallerySubscriptionID = id.SubscriptionID
+		imageTerm.GalleryResourceGroupName = id.ResourceGroupName
+		imageTerm.GalleryName = id.Name
+		return imageTerm
+	})
+}
+
+// AliasedImageID returns the ID of the image in the gallery its gallery moved to by the gallery-aliases option, and
+// whether it moved. The images of either gallery are the same, e.g. to compare the image of a VM with the images of its
+// AKSNodeClass.
+func AliasedImageID(ctx context.Context, imageID string) (string, bool) {
+	for from, to := range options.FromContext(ctx).GalleryAliases {
+		prefix := strings.TrimSuffix(from, "/") + "/images/"
+		if len(imageID) > len(prefix) && strings.EqualFold(imageID[:len(prefix)], prefix) {
+			gallery, err := arm.ParseResourceID(to)
+			if err != nil {
+				return imageID, false
+			}
+			// formatted as the IDs of the images listed for custom image terms
+			return galleryID(gallery.SubscriptionID, gallery.ResourceGroupName, gallery.Name) + "/images/" + imageID[len(prefix):], true
+		}
+	}
+	return imageID, false
+}
+
+// galleryAlias returns the gallery the gallery moved to, comparing their IDs case-insensitively
+func galleryAlias(aliases map[string]string, gallery string) (string, bool) {
+	for from, to := range aliases {
+		if strings.EqualFold(strings.TrimSuffix(from, "/"), gallery) {
+			return to, true
+		}
+	}
+	return "", false
+}
+
+// galleryID returns the ID of the gallery of a resource group
+func galleryID(subscriptionID, resourceGroup, galleryName string) string {
+	return fmt.Sprintf("/subscriptions/%s/resourceGroups/%s/providers/Microsoft.Compute/galleries/%s", subscriptionID, resourceGroup, galleryName)
+}
@@ -0,0 +1,75 @@
+/*
+Portions Copyright (c) Microsoft Corporation.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package imagefamily
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/Azure/karpenter-provider-azure/pkg/apis/v1beta1"
+	"github.com/Azure/karpenter-provider-azure/pkg/operator/options"
+)
+
+func galleryAliasContext() context.Context {
+	return options.ToContext(context.Background(), &options.Options{GalleryAliases: map[string]string{
+		"/subscriptions/11111111-1111-1111-1111-111111111111/resourceGroups/images/providers/Microsoft.Compute/galleries/gallery": "/subscriptions/22222222-2222-2222-2222-222222222222/resourceGroups/images-new/providers/Microsoft.Compute/galleries/gallery",
+	}})
+}
+
+func TestCustomImageTerms(t *testing.T) {
+	oldTerm := v1beta1.CustomImageTerm{GallerySubscriptionID: "11111111-1111-1111-1111-111111111111", GalleryResourceGroupName: "Images", GalleryName: "gallery", Name: "ubuntu", DistroName: "aks-ubuntu-containerd-22.04-gen2"}
+	otherTerm := v1beta1.CustomImageTerm{GallerySubscriptionID: "11111111-1111-1111-1111-111111111111", GalleryResourceGroupName: "images", GalleryName: "other", Name: "ubuntu"}
+	sharedTerm := v1beta1.CustomImageTerm{SharedGalleryUniqueName: "11111111-1111-1111-1111-111111111111-GALLERY", Name: "ubuntu"}
+	nodeClass := &v1beta1.AKSNodeClass{Spec: v1beta1.AKSNodeClassSpec{CustomImageTerms: []v1beta1.CustomImageTerm{oldTerm, otherTerm, sharedTerm}}}
+
+	// without aliases the terms are kept as is
+	assert.Equal(t, nodeClass.Spec.CustomImageTerms, CustomImageTerms(options.ToContext(context.Background(), &options.Options{}), nodeClass))
+
+	terms := CustomImageTerms(galleryAliasContext(), nodeClass)
+	newTerm := oldTerm
+	newTerm.GallerySubscriptionID = "22222222-2222-2222-2222-222222222222"
+	newTerm.GalleryResourceGroupName = "images-new"
+	assert.Equal(t, []v1beta1.CustomImageTerm{newTerm, otherTerm, sharedTerm}, terms)
+	// the AKSNodeClass itself isn't changed
+	assert.Equal(t, "11111111-1111-1111-1111-111111111111", nodeClass.Spec.CustomImageTerms[0].GallerySubscriptionID)
+
+	// the deprecated custom image term is the only term, aliased as well
+	nodeClass = &v1beta1.AKSNodeClass{Spec: v1beta1.AKSNodeClassSpec{CustomImageTerm: &oldTerm}}
+	assert.Equal(t, []v1beta1.CustomImageTerm{newTerm}, CustomImageTerms(galleryAliasContext(), nodeClass))
+}
+
+func TestAliasedImageID(t *testing.T) {
+	ctx := galleryAliasContext()
+
+	aliased, ok := AliasedImageID(ctx, strings.ToLower(BuildImageIDSIG("11111111-1111-1111-1111-111111111111", "images", "gallery", "ubuntu", "1.0.0")))
+	assert.True(t, ok)
+	assert.Equal(t, BuildImageIDSIG("22222222-2222-2222-2222-222222222222", "images-new", "gallery", "ubuntu", "1.0.0"), aliased)
+
+	// the images of other galleries, even with the name of the gallery as prefix, aren't aliased
+	for _, imageID := range []string{
+		BuildImageIDSIG("11111111-1111-1111-1111-111111111111", "images", "gallery2", "ubuntu", "1.0.0"),
+		BuildImageIDSIG("22222222-2222-2222-2222-222222222222", "images-new", "gallery", "ubuntu", "1.0.0"),
+		BuildImageIDCIG("AKSUbuntu", "2204gen2containerd", "202501.02.0"),
+	} {
+		aliased, ok := AliasedImageID(ctx, imageID)
+		assert.False(t, ok, imageID)
+		assert.Equal(t, imageID, aliased)
+	}
+}
@@ -0,0 +1,53 @@
+/*
+Portions Copyright (c) Microsoft Corporation.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package imagefamily
+
+import (
+	"strings"
+
+	"github.com/samber/lo"
+
+	"github.com/Azure/karpenter-provider-azure/pkg/apis/v1beta1"
+)
+
+const (
+	// ImageChannelTagKey is the gallery image version tag that marks a custom image version as a preview, when set to "Preview"
+	ImageChannelTagKey = "imageChannel"
+
+	// preview node image versions carry a pre-release suffix, e.g. 202506.10.0-preview
+	previewVersionSuffix = "-preview"
+)
+
+// isPreviewImageVersion returns whether an image version is flagged as a preview, either by its name or by its gallery tags
+func isPreviewImageVersion(version string, tags map[string]*string) bool {
+	if strings.HasSuffix(strings.ToLower(version), previewVersionSuffix) {
+		return true
+	}
+	channel, ok := tags[ImageChannelTagKey]
+	return ok && strings.EqualFold(lo.FromPtr(channel), string(v1beta1.ImageChannelPreview))
+}
+
+// isEligibleImageVersion returns whether an image version may be selected as the latest version for the channel.
+// Preview versions are only eligible on the Preview channel, which also includes all generally available versions.
+func isEligibleImageVersion(channel v1beta1.ImageChannel, preview bool) bool {
+	return !preview || channel == v1beta1.ImageChannelPreview
+}
+
+// imageVersionChannel returns the channel a selected image version came from
+func imageVersionChannel(preview bool) v1beta1.ImageChannel {
+	return lo.Ternary(preview, v1beta1.ImageChannelPreview, v1beta1.ImageChannelStable)
+}
@@ -0,0 +1,119 @@
+/*
+Portions Copyright (c) Microsoft Corporation.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package imagefamily
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/patrickmn/go-cache"
+	"github.com/samber/lo"
+	"sigs.k8s.io/karpenter/pkg/utils/pretty"
+
+	"github.com/Azure/karpenter-provider-azure/pkg/apis/v1beta1"
+	"github.com/Azure/karpenter-provider-azure/pkg/operator/options"
+	types "github.com/Azure/karpenter-provider-azure/pkg/providers/imagefamily/types"
+)
+
+func TestIsPreviewImageVersion(t *testing.T) {
+	testCases := []struct {
+		version  string
+		tags     map[string]*string
+		expected bool
+	}{
+		{"202505.27.0", nil, false},
+		{"202506.10.0-preview", nil, true},
+		{"202506.10.0-Preview", nil, true},
+		{"1.0.0", map[string]*string{ImageChannelTagKey: lo.ToPtr("Preview")}, true},
+		{"1.0.0", map[string]*string{ImageChannelTagKey: lo.ToPtr("Stable")}, false},
+		{"1.0.0", map[string]*string{"owner": lo.ToPtr("Preview")}, false},
+	}
+
+	for _, tc := range testCases {
+		if result := isPreviewImageVersion(tc.version, tc.tags); result != tc.expected {
+			t.Errorf("isPreviewImageVersion(%q, %v) = %v; want %v", tc.version, tc.tags, result, tc.expected)
+		}
+	}
+}
+
+func TestListSIGImageChannel(t *testing.T) {
+	const sku = "2204gen2containerd"
+	p := &provider{cm: pretty.NewChangeMonitor(), nodeImagesCache: cache.New(ImageExpirationInterval, ImageCacheCleaningInterval), nodeImageVersions: staticNodeImageVersions{Values: FilteredNodeImages([]types.NodeImageVersion{
+		{OS: AKSUbuntuGalleryName, SKU: sku, Version: "202505.27.0"},
+		{OS: AKSUbuntuGalleryName, SKU: sku, Version: "202506.03.0"},
+		{OS: AKSUbuntuGalleryName, SKU: sku, Version: "202506.10.0-preview"},
+		{OS: AKSUbuntuGalleryName, SKU: sku, Version: "202505.27.0-preview"},
+	})}}
+	supportedImages := []types.DefaultImageOutput{{ImageDefinition: sku}}
+
+	for _, tc := range []struct {
+		channel         v1beta1.ImageChannel
+		expectedVersion string
+	}{
+		{v1beta1.ImageChannelStable, "202506.03.0"},
+		{v1beta1.ImageChannelPreview, "202506.10.0-preview"},
+	} {
+		nodeImages, err := p.listSIG(options.ToContext(context.Background(), &options.Options{}), supportedImages, tc.channel, "", "")
+		if err != nil {
+			t.Fatalf("Unexpected error %v", err)
+		}
+		if len(nodeImages) != 1 {
+			t.Fatalf("Expected 1 node image on the %s channel, got %d", tc.channel, len(nodeImages))
+		}
+		if !strings.HasSuffix(nodeImages[0].ID, "/versions/"+tc.expectedVersion) {
+			t.Errorf("Expected version %s on the %s channel, got image %s", tc.expectedVersion, tc.channel, nodeImages[0].ID)
+		}
+		if nodeImages[0].Channel != tc.channel {
+			t.Errorf("Expected image from the %s channel, got %s", tc.channel, nodeImages[0].Channel)
+		}
+	}
+}
+
+func TestListSIGPinnedImageVersion(t *testing.T) {
+	const sku = "2204gen2containerd"
+	p := &provider{cm: pretty.NewChangeMonitor(), nodeImagesCache: cache.New(ImageExpirationInterval, ImageCacheCleaningInterval), nodeImageVersions: staticNodeImageVersions{Values: SupportedGalleryNodeImages([]types.NodeImageVersion{
+		{OS: AKSUbuntuGalleryName, SKU: sku, Version: "202505.27.0"},
+		{OS: AKSUbuntuGalleryName, SKU: sku, Version: "202506.03.0"},
+		{OS: AKSUbuntuGalleryName, SKU: sku, Version: "202506.10.0-preview"},
+	})}}
+	supportedImages := []types.DefaultImageOutput{{ImageDefinition: sku}}
+	ctx := options.ToContext(context.Background(), &options.Options{})
+
+	// the pinned version is selected over the latest one, whatever the image channel
+	for _, pinnedVersion := range []string{"202505.27.0", "202506.10.0-preview"} {
+		nodeImages, err := p.listSIG(ctx, supportedImages, v1beta1.ImageChannelStable, pinnedVersion, "")
+		if err != nil {
+			t.Fatalf("Unexpected error %v", err)
+		}
+		if len(nodeImages) != 1 || !strings.HasSuffix(nodeImages[0].ID, "/versions/"+pinnedVersion) || !nodeImages[0].Pinned {
+			t.Errorf("Expected the pinned version %s, got %v", pinnedVersion, nodeImages)
+		}
+	}
+
+	var imageVersionNotFoundErr *ImageVersionNotFoundError
+	if _, err := p.listSIG(ctx, supportedImages, v1beta1.ImageChannelStable, "202001.01.0", ""); !errors.As(err, &imageVersionNotFoundErr) {
+		t.Errorf("Expected an image version not found error, got %v", err)
+	}
+}
+
+type staticNodeImageVersions types.NodeImageVersionsResponse
+
+func (s staticNodeImageVersions) List(_ context.Context, _, _ string) (types.NodeImageVersionsResponse, error) {
+	return types.NodeImageVersionsResponse(s), nil
+}
@@ -0,0 +1,95 @@
+/*
+Portions Copyright (c) Microsoft Corporation.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package imagefamily
+
+import (
+	"context"
+	"testing"
+
+	"github.com/go-logr/logr"
+	"github.com/patrickmn/go-cache"
+	"github.com/stretchr/testify/assert"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	"github.com/Azure/karpenter-provider-azure/pkg/apis/v1beta1"
+	"github.com/Azure/karpenter-provider-azure/pkg/operator/options"
+	types "github.com/Azure/karpenter-provider-azure/pkg/providers/imagefamily/types"
+)
+
+// discoveryLogs counts the "discovered new image id" logs by verbosity
+type discoveryLogs map[int]int
+
+func (d discoveryLogs) logger() logr.Logger {
+	return logr.New(&discoveryLogSink{logs: d})
+}
+
+type discoveryLogSink struct {
+	logs discoveryLogs
+}
+
+func (s *discoveryLogSink) Init(logr.RuntimeInfo)          {}
+func (s *discoveryLogSink) Enabled(int) bool               { return true }
+func (s *discoveryLogSink) Error(error, string, ...any)    {}
+func (s *discoveryLogSink) WithValues(...any) logr.LogSink { return s }
+func (s *discoveryLogSink) WithName(string) logr.LogSink   { return s }
+func (s *discoveryLogSink) Info(level int, msg string, _ ...any) {
+	if msg == "discovered new image id" {
+		s.logs[level]++
+	}
+}
+
+func TestDiscoveredImageLogs(t *testing.T) {
+	const sku = "2204gen2containerd"
+	nodeImageVersions := &staticNodeImageVersions{Values: FilteredNodeImages([]types.NodeImageVersion{
+		{OS: AKSUbuntuGalleryName, SKU: sku, Version: "202505.27.0"},
+	})}
+	p := NewProvider(nil, "westus", "00000000-0000-0000-0000-000000000000", nodeImageVersions, cache.New(ImageExpirationInterval, ImageCacheCleaningInterval))
+	supportedImages := []types.DefaultImageOutput{{ImageDefinition: sku}}
+	logs := discoveryLogs{}
+	ctx := log.IntoContext(options.ToContext(context.Background(), &options.Options{}), logs.logger())
+
+	// repeated discoveries of an unchanged image, e.g. as the images expire from the cache, log it once
+	for range 5 {
+		for _, channel := range []v1beta1.ImageChannel{v1beta1.ImageChannelStable, v1beta1.ImageChannelStable, v1beta1.ImageChannelPreview} {
+			_, err := p.listSIG(ctx, supportedImages, channel, "", "")
+			assert.NoError(t, err)
+		}
+	}
+	// once per image channel the image is discovered for
+	assert.Equal(t, discoveryLogs{0: 2}, logs)
+
+	// a newer image is logged
+	nodeImageVersions.Values = FilteredNodeImages([]types.NodeImageVersion{
+		{OS: AKSUbuntuGalleryName, SKU: sku, Version: "202506.03.0"},
+	})
+	for range 5 {
+		_, err := p.listSIG(ctx, supportedImages, v1beta1.ImageChannelStable, "", "")
+		assert.NoError(t, err)
+	}
+	assert.Equal(t, discoveryLogs{0: 3}, logs)
+
+	// at the debug level with the demote-image-discovery-logs option
+	nodeImageVersions.Values = FilteredNodeImages([]types.NodeImageVersion{
+		{OS: AKSUbuntuGalleryName, SKU: sku, Version: "202506.10.0"},
+	})
+	ctx = options.ToContext(ctx, &options.Options{DemoteImageDiscoveryLogs: true})
+	for range 5 {
+		_, err := p.listSIG(ctx, supportedImages, v1beta1.ImageChannelStable, "", "")
+		assert.NoError(t, err)
+	}
+	assert.Equal(t, discoveryLogs{0: 3, 1: 1}, logs)
+}
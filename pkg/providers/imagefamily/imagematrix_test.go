@@ -0,0 +1,129 @@
+/*
+Portions Copyright (c) Microsoft Corporation.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package imagefamily_test
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/patrickmn/go-cache"
+	"github.com/samber/lo"
+	v1 "k8s.io/api/core/v1"
+	karpv1 "sigs.k8s.io/karpenter/pkg/apis/v1"
+	"sigs.k8s.io/karpenter/pkg/cloudprovider"
+	coreoptions "sigs.k8s.io/karpenter/pkg/operator/options"
+	coretest "sigs.k8s.io/karpenter/pkg/test"
+
+	"github.com/Azure/karpenter-provider-azure/pkg/apis/v1beta1"
+	"github.com/Azure/karpenter-provider-azure/pkg/auth"
+	kcache "github.com/Azure/karpenter-provider-azure/pkg/cache"
+	"github.com/Azure/karpenter-provider-azure/pkg/fake"
+	"github.com/Azure/karpenter-provider-azure/pkg/operator/options"
+	"github.com/Azure/karpenter-provider-azure/pkg/providers/imagefamily"
+	"github.com/Azure/karpenter-provider-azure/pkg/providers/imagefamily/types"
+	"github.com/Azure/karpenter-provider-azure/pkg/providers/instancetype"
+	"github.com/Azure/karpenter-provider-azure/pkg/providers/pricing"
+	"github.com/Azure/karpenter-provider-azure/pkg/test"
+	"github.com/Azure/karpenter-provider-azure/pkg/utils"
+)
+
+// TestDefaultImageMatrix iterates the recorded SKUs, and asserts that each of them is either not offered, or resolves to
+// the default image of each image family for its architecture and preferred Hyper-V generation.
+func TestDefaultImageMatrix(t *testing.T) {
+	imageFamilies := []struct {
+		name              string
+		kubernetesVersion string
+	}{
+		{v1beta1.Ubuntu2204ImageFamily, "1.31.0"},
+		{v1beta1.Ubuntu2404ImageFamily, "1.34.0"},
+		{v1beta1.AzureLinuxImageFamily, "1.31.0"}, // Azure Linux 2
+		{v1beta1.AzureLinuxImageFamily, "1.34.0"}, // Azure Linux 3
+		{v1beta1.AzureLinux3ImageFamily, "1.31.0"},
+	}
+	for _, region := range lo.Keys(fake.ResourceSkus) {
+		for _, useSIG := range []bool{false, true} {
+			ctx := coreoptions.ToContext(context.Background(), coretest.Options())
+			ctx = options.ToContext(ctx, test.Options(test.OptionsFields{UseSIG: lo.ToPtr(useSIG)}))
+			instanceTypeProvider := instancetype.NewDefaultProvider(
+				region,
+				cache.New(instancetype.InstanceTypesCacheTTL, kcache.DefaultCleanupInterval),
+				&fake.ResourceSKUsAPI{Location: region},
+				pricing.NewProvider(lo.Must(auth.EnvironmentFromName("AzurePublicCloud")), &fake.PricingAPI{}, region, pricing.DefaultUpdatePeriod),
+				kcache.NewUnavailableOfferings(),
+				nil,
+			)
+
+			for _, imageFamily := range imageFamilies {
+				t.Run(fmt.Sprintf("%s/%s/%s/useSIG=%t", region, imageFamily.name, imageFamily.kubernetesVersion, useSIG), func(t *testing.T) {
+					defaultImages := imagefamily.GetImageFamily(lo.ToPtr(imageFamily.name), nil, imageFamily.kubernetesVersion, nil).DefaultImages(useSIG, nil)
+					nodeClass := test.AKSNodeClass(v1beta1.AKSNodeClass{
+						Spec: v1beta1.AKSNodeClassSpec{ImageFamily: lo.ToPtr(imageFamily.name), MaxPods: lo.ToPtr[int32](30)},
+						Status: v1beta1.AKSNodeClassStatus{
+							Images: lo.Map(defaultImages, func(image types.DefaultImageOutput, _ int) v1beta1.NodeImage {
+								return v1beta1.NodeImage{
+									ID: image.ImageDefinition,
+									Requirements: lo.Map(image.Requirements.NodeSelectorRequirements(), func(r karpv1.NodeSelectorRequirementWithMinValues, _ int) v1.NodeSelectorRequirement {
+										return r.NodeSelectorRequirement
+									}),
+								}
+							}),
+						},
+					})
+					instanceTypes, err := instanceTypeProvider.List(ctx, nodeClass)
+					if err != nil {
+						t.Fatalf("Unexpected error %v", err)
+					}
+					if len(instanceTypes) == 0 {
+						t.Fatalf("Expected instance types to be offered")
+					}
+					offered := lo.SliceToMap(instanceTypes, func(it *cloudprovider.InstanceType) (string, *cloudprovider.InstanceType) { return it.Name, it })
+					for _, sku := range fake.ResourceSkus[region] {
+						instanceType, ok := offered[lo.FromPtr(sku.Name)]
+						if !ok {
+							continue
+						}
+						expectDefaultImage(t, instanceType, defaultImages)
+					}
+				})
+			}
+		}
+	}
+}
+
+func expectDefaultImage(t *testing.T, instanceType *cloudprovider.InstanceType, defaultImages []types.DefaultImageOutput) {
+	t.Helper()
+	image, ok := lo.Find(defaultImages, func(image types.DefaultImageOutput) bool {
+		return instanceType.Requirements.Compatible(image.Requirements, v1beta1.AllowUndefinedWellKnownAndRestrictedLabels) == nil
+	})
+	if !ok {
+		t.Errorf("Expected offered instance type %s to resolve to a default image", instanceType.Name)
+		return
+	}
+	arch := instanceType.Requirements.Get(v1.LabelArchStable).Any()
+	if !image.Requirements.Get(v1.LabelArchStable).Has(arch) {
+		t.Errorf("Expected instance type %s to resolve to an %s image, got %s", instanceType.Name, arch, image.ImageDefinition)
+	}
+	hyperVGenerations := instanceType.Requirements.Get(v1beta1.LabelSKUHyperVGeneration)
+	preferred := lo.Ternary(hyperVGenerations.Has(v1beta1.HyperVGenerationV2), v1beta1.HyperVGenerationV2, v1beta1.HyperVGenerationV1)
+	if !image.Requirements.Get(v1beta1.LabelSKUHyperVGeneration).Has(preferred) {
+		t.Errorf("Expected instance type %s to resolve to a Gen%s image, got %s", instanceType.Name, preferred, image.ImageDefinition)
+	}
+	if utils.IsNvidiaEnabledSKU(instanceType.Name) && arch != karpv1.ArchitectureAmd64 {
+		t.Errorf("Expected %s GPU instance type %s not to be offered", arch, instanceType.Name)
+	}
+}
@@ -0,0 +1,90 @@
+/*
+Portions Copyright (c) Microsoft Corporation.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package imagefamily
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/blang/semver/v4"
+	"github.com/samber/lo"
+
+	"github.com/Azure/karpenter-provider-azure/pkg/apis/v1beta1"
+)
+
+// ImageVersionConstraintError is returned when the version constraint of the AKSNodeClass, or of its custom image term,
+// can't be satisfied, rather than falling back to the latest version of the image: when none of the versions of the
+// image satisfies it, or it can't be parsed
+type ImageVersionConstraintError struct {
+	Constraint      string
+	ImageDefinition string
+	// Err is the error parsing the constraint, if it couldn't be parsed
+	Err error
+}
+
+func (e *ImageVersionConstraintError) Error() string {
+	if e.Err != nil {
+		return fmt.Sprintf("parsing image version constraint %q, %s", e.Constraint, e.Err)
+	}
+	return fmt.Sprintf("no version of image %s satisfies the version constraint %q", e.ImageDefinition, e.Constraint)
+}
+
+func (e *ImageVersionConstraintError) Unwrap() error {
+	return e.Err
+}
+
+// parseImageVersionConstraint parses the version constraint of images, a semver range, e.g. ">=202401.0.0 <202501.0.0".
+// The range of an empty constraint is nil, which all versions satisfy.
+func parseImageVersionConstraint(constraint string) (semver.Range, error) {
+	if constraint == "" {
+		return nil, nil
+	}
+	versionRange, err := semver.ParseRange(constraint)
+	if err != nil {
+		return nil, &ImageVersionConstraintError{Constraint: constraint, Err: err}
+	}
+	return versionRange, nil
+}
+
+// satisfiesImageVersionConstraint returns whether the image version is in the range of the version constraint. Image
+// versions are parsed leniently, as the versions of older community images have leading zeros, e.g. 2022.10.03, and
+// versions that can't be parsed don't satisfy any constraint.
+func satisfiesImageVersionConstraint(versionRange semver.Range, imageVersion string) bool {
+	if versionRange == nil {
+		return true
+	}
+	version, err := semver.ParseTolerant(imageVersion)
+	return err == nil && versionRange(version)
+}
+
+// SatisfiesImageVersionConstraint returns whether the version of the image satisfies the version constraint of the
+// AKSNodeClass, or of the custom image term the image was listed for. Constraints that can't be parsed fail the listing
+// of the images instead.
+func SatisfiesImageVersionConstraint(ctx context.Context, nodeClass *v1beta1.AKSNodeClass, imageID string) bool {
+	constraint := lo.FromPtr(nodeClass.Spec.ImageVersionConstraint)
+	if lo.FromPtr(nodeClass.Spec.ImageFamily) == v1beta1.CustomImageFamily {
+		imageTerm, _ := CustomImageTermForImage(CustomImageTerms(ctx, nodeClass), imageID)
+		constraint = imageTerm.VersionConstraint
+	}
+	versionRange, err := parseImageVersionConstraint(constraint)
+	if err != nil {
+		return true
+	}
+	_, imageVersion, _ := strings.Cut(imageID, "/versions/")
+	return satisfiesImageVersionConstraint(versionRange, imageVersion)
+}
@@ -0,0 +1,126 @@
+/*
+Portions Copyright (c) Microsoft Corporation.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package imagefamily
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/patrickmn/go-cache"
+	"github.com/samber/lo"
+	"sigs.k8s.io/karpenter/pkg/utils/pretty"
+
+	"github.com/Azure/karpenter-provider-azure/pkg/apis/v1beta1"
+	"github.com/Azure/karpenter-provider-azure/pkg/operator/options"
+	types "github.com/Azure/karpenter-provider-azure/pkg/providers/imagefamily/types"
+)
+
+func TestSatisfiesImageVersionConstraint(t *testing.T) {
+	for _, tc := range []struct {
+		constraint string
+		version    string
+		expected   bool
+	}{
+		{"", "202402.26.0", true},
+		{">=202401.0.0 <202501.0.0", "202402.26.0", true},
+		{">=202401.0.0 <202501.0.0", "202501.02.0", false},
+		{"202402.x", "202402.26.0", true},
+		{"202402.x", "202403.01.0", false},
+		{"<2023.0.0 || >=202501.0.0", "2022.10.03", true},
+		{"<2023.0.0 || >=202501.0.0", "202402.26.0", false},
+		// preview versions precede the version they're a preview of
+		{"<202506.10.0", "202506.10.0-preview", true},
+		{">=1.0.0", "latest", false},
+	} {
+		versionRange, err := parseImageVersionConstraint(tc.constraint)
+		if err != nil {
+			t.Fatalf("Unexpected error %v", err)
+		}
+		if result := satisfiesImageVersionConstraint(versionRange, tc.version); result != tc.expected {
+			t.Errorf("satisfiesImageVersionConstraint(%q, %q) = %v; want %v", tc.constraint, tc.version, result, tc.expected)
+		}
+	}
+
+	var constraintErr *ImageVersionConstraintError
+	if _, err := parseImageVersionConstraint("202402"); !errors.As(err, &constraintErr) || constraintErr.Err == nil {
+		t.Errorf("Expected an error parsing the image version constraint, got %v", err)
+	}
+}
+
+func TestListSIGImageVersionConstraint(t *testing.T) {
+	const sku = "2204gen2containerd"
+	p := &provider{cm: pretty.NewChangeMonitor(), nodeImagesCache: cache.New(ImageExpirationInterval, ImageCacheCleaningInterval), nodeImageVersions: staticNodeImageVersions{Values: SupportedGalleryNodeImages([]types.NodeImageVersion{
+		{OS: AKSUbuntuGalleryName, SKU: sku, Version: "202312.06.0"},
+		{OS: AKSUbuntuGalleryName, SKU: sku, Version: "202402.26.0"},
+		{OS: AKSUbuntuGalleryName, SKU: sku, Version: "202411.12.0"},
+		{OS: AKSUbuntuGalleryName, SKU: sku, Version: "202501.02.0"},
+	})}}
+	supportedImages := []types.DefaultImageOutput{{ImageDefinition: sku}}
+	ctx := options.ToContext(context.Background(), &options.Options{})
+
+	for _, tc := range []struct {
+		constraint      string
+		expectedVersion string
+	}{
+		{"", "202501.02.0"},
+		{">=202401.0.0 <202501.0.0", "202411.12.0"},
+		{"202402.x || <202400.0.0", "202402.26.0"},
+	} {
+		nodeImages, err := p.listSIG(ctx, supportedImages, v1beta1.ImageChannelStable, "", tc.constraint)
+		if err != nil {
+			t.Fatalf("Unexpected error %v", err)
+		}
+		if len(nodeImages) != 1 || !strings.HasSuffix(nodeImages[0].ID, "/versions/"+tc.expectedVersion) {
+			t.Errorf("Expected version %s with the version constraint %q, got %v", tc.expectedVersion, tc.constraint, nodeImages)
+		}
+	}
+
+	// an impossible constraint fails the listing, rather than falling back to the latest version
+	var constraintErr *ImageVersionConstraintError
+	if _, err := p.listSIG(ctx, supportedImages, v1beta1.ImageChannelStable, "", ">=202601.0.0"); !errors.As(err, &constraintErr) {
+		t.Errorf("Expected an image version constraint error, got %v", err)
+	}
+}
+
+func TestSatisfiesImageVersionConstraintOfNodeClass(t *testing.T) {
+	ctx := options.ToContext(context.Background(), &options.Options{})
+	nodeClass := &v1beta1.AKSNodeClass{Spec: v1beta1.AKSNodeClassSpec{
+		ImageFamily:            lo.ToPtr(v1beta1.Ubuntu2204ImageFamily),
+		ImageVersionConstraint: lo.ToPtr("<202501.0.0"),
+	}}
+	if !SatisfiesImageVersionConstraint(ctx, nodeClass, BuildImageIDCIG("AKSUbuntu", "2204gen2containerd", "202410.09.0")) {
+		t.Errorf("Expected version 202410.09.0 to satisfy the version constraint of the nodeclass")
+	}
+	if SatisfiesImageVersionConstraint(ctx, nodeClass, BuildImageIDCIG("AKSUbuntu", "2204gen2containerd", "202501.02.0")) {
+		t.Errorf("Expected version 202501.02.0 not to satisfy the version constraint of the nodeclass")
+	}
+
+	// the constraint of the custom image term applies to its images
+	nodeClass.Spec.ImageFamily = lo.ToPtr(v1beta1.CustomImageFamily)
+	nodeClass.Spec.CustomImageTerms = []v1beta1.CustomImageTerm{
+		{GallerySubscriptionID: "11111111-1111-1111-1111-111111111111", GalleryResourceGroupName: "images", GalleryName: "gallery", Name: "ubuntu", VersionConstraint: "1.x"},
+		{GallerySubscriptionID: "11111111-1111-1111-1111-111111111111", GalleryResourceGroupName: "images", GalleryName: "gallery", Name: "ubuntu-arm64"},
+	}
+	if SatisfiesImageVersionConstraint(ctx, nodeClass, BuildImageIDSIG("11111111-1111-1111-1111-111111111111", "images", "gallery", "ubuntu", "2.0.0")) {
+		t.Errorf("Expected version 2.0.0 not to satisfy the version constraint of its custom image term")
+	}
+	if !SatisfiesImageVersionConstraint(ctx, nodeClass, BuildImageIDSIG("11111111-1111-1111-1111-111111111111", "images", "gallery", "ubuntu-arm64", "2.0.0")) {
+		t.Errorf("Expected version 2.0.0 to satisfy its unconstrained custom image term")
+	}
+}
@@ -0,0 +1,101 @@
+/*
+Portions Copyright (c) Microsoft Corporation.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package imagefamily
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	sdkerrors "github.com/Azure/azure-sdk-for-go-extensions/pkg/errors"
+	"github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/compute/armcompute/v7"
+	"github.com/samber/lo"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	"github.com/Azure/karpenter-provider-azure/pkg/apis/v1beta1"
+)
+
+// imageVersionExistsTTL is how long a custom image version found to exist isn't checked again before launching from it,
+// so that bursts of launches check it once
+const imageVersionExistsTTL = 5 * time.Minute
+
+// ImageVersionDeletedError is returned when the version of the custom image a VM is about to be launched with doesn't
+// exist anymore, or isn't replicated to the region anymore, e.g. because it was deleted from its gallery after the images
+// of the AKSNodeClass were resolved and cached
+type ImageVersionDeletedError struct {
+	ImageID string
+}
+
+func (e *ImageVersionDeletedError) Error() string {
+	return fmt.Sprintf("image version %s doesn't exist anymore", e.ImageID)
+}
+
+// checkImageVersionExists returns an ImageVersionDeletedError if the version of the custom image the VM is launched with
+// was deleted since it was resolved, so that the images are re-resolved rather than the VM create failing. Only custom
+// images are checked, as their versions are managed by the users of their galleries, while the versions of the images of
+// the image families are kept by AKS long after newer ones are published. Failing to check is only logged, the VM create
+// failing anyway if the image can't be accessed.
+func (p *provider) checkImageVersionExists(ctx context.Context, nodeClass *v1beta1.AKSNodeClass, imageID string) error {
+	if lo.FromPtr(nodeClass.Spec.ImageID) != "" || nodeClass.Spec.MarketplaceImage != nil || lo.FromPtr(nodeClass.Spec.ImageFamily) != v1beta1.CustomImageFamily {
+		return nil
+	}
+	imageTerm, ok := CustomImageTermForImage(CustomImageTerms(ctx, nodeClass), imageID)
+	if !ok {
+		return nil
+	}
+	key := fmt.Sprintf("exists-%s", strings.ToLower(imageID))
+	if _, found := p.nodeImagesCache.Get(key); found {
+		return nil
+	}
+	exists, err := p.customImageVersionExists(ctx, imageTerm, imageID[strings.LastIndex(imageID, "/")+1:])
+	if err != nil {
+		log.FromContext(ctx).Error(err, "failed to check the custom image version exists", "image-id", imageID)
+		return nil
+	}
+	if !exists {
+		return &ImageVersionDeletedError{ImageID: imageID}
+	}
+	p.nodeImagesCache.Set(key, true, imageVersionExistsTTL)
+	return nil
+}
+
+// customImageVersionExists returns whether the version of the image of the custom image term exists and is replicated
+// to the region
+func (p *provider) customImageVersionExists(ctx context.Context, imageTerm v1beta1.CustomImageTerm, version string) (bool, error) {
+	clientFactory, err := p.customImageClientFactory(imageTerm)
+	if err != nil {
+		return false, err
+	}
+	if imageTerm.SharedGalleryUniqueName != "" {
+		// the versions of a shared gallery are looked up in the region, so they're replicated to it
+		_, err := clientFactory.NewSharedGalleryImageVersionsClient().Get(ctx, p.location, imageTerm.SharedGalleryUniqueName, imageTerm.Name, version, nil)
+		if sdkerrors.IsNotFoundErr(err) {
+			return false, nil
+		}
+		return err == nil, err
+	}
+	resp, err := clientFactory.NewGalleryImageVersionsClient().Get(ctx, imageTerm.GalleryResourceGroupName, imageTerm.GalleryName, imageTerm.Name, version,
+		&armcompute.GalleryImageVersionsClientGetOptions{Expand: lo.ToPtr(armcompute.ReplicationStatusTypesReplicationStatus)})
+	if sdkerrors.IsNotFoundErr(err) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return isReplicatedTo(&resp.GalleryImageVersion, p.location), nil
+}
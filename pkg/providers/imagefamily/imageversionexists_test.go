@@ -0,0 +1,79 @@
+/*
+Portions Copyright (c) Microsoft Corporation.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package imagefamily
+
+import (
+	"context"
+	"testing"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/compute/armcompute/v7"
+	"github.com/patrickmn/go-cache"
+	"github.com/samber/lo"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/Azure/karpenter-provider-azure/pkg/apis/v1beta1"
+	"github.com/Azure/karpenter-provider-azure/pkg/operator/options"
+)
+
+func TestCheckImageVersionExists(t *testing.T) {
+	completed := map[string]armcompute.ReplicationState{"West US": armcompute.ReplicationStateCompleted}
+	imageVersions := []*armcompute.GalleryImageVersion{
+		galleryImageVersion("1.0.0", 0, false, []string{"West US"}, completed),
+		galleryImageVersion("1.1.0", 1, false, []string{"West US", "East US"}, map[string]armcompute.ReplicationState{"East US": armcompute.ReplicationStateCompleted}),
+	}
+	customNodeClass := &v1beta1.AKSNodeClass{
+		Spec: v1beta1.AKSNodeClassSpec{
+			ImageFamily: lo.ToPtr(v1beta1.CustomImageFamily),
+			CustomImageTerms: []v1beta1.CustomImageTerm{{
+				GallerySubscriptionID:    "11111111-1111-1111-1111-111111111111",
+				GalleryResourceGroupName: "images",
+				GalleryName:              "gallery",
+				Name:                     "ubuntu",
+			}},
+		},
+	}
+
+	for _, tc := range []struct {
+		name      string
+		nodeClass *v1beta1.AKSNodeClass
+		version   string
+		deleted   bool
+	}{
+		{name: "existing version", nodeClass: customNodeClass, version: "1.0.0"},
+		{name: "deleted version", nodeClass: customNodeClass, version: "0.9.0", deleted: true},
+		{name: "version not replicated to the region anymore", nodeClass: customNodeClass, version: "1.1.0", deleted: true},
+		{name: "image of an image family isn't checked", nodeClass: &v1beta1.AKSNodeClass{Spec: v1beta1.AKSNodeClassSpec{ImageFamily: lo.ToPtr(v1beta1.Ubuntu2204ImageFamily)}}, version: "0.9.0"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			ctx := options.ToContext(context.Background(), &options.Options{})
+			p := NewProvider(nil, "westus", "00000000-0000-0000-0000-000000000000", nil, cache.New(ImageExpirationInterval, ImageCacheCleaningInterval))
+			clientFactory := fakeGalleryClientFactory(t, imageVersions...)
+			p.newCustomGalleryClientFactory = func(string, string) (*armcompute.ClientFactory, error) { return clientFactory, nil }
+			imageID := BuildImageIDSIG("11111111-1111-1111-1111-111111111111", "images", "gallery", "ubuntu", tc.version)
+
+			err := p.checkImageVersionExists(ctx, tc.nodeClass, imageID)
+			if !tc.deleted {
+				assert.NoError(t, err)
+				return
+			}
+			var imageVersionDeletedErr *ImageVersionDeletedError
+			if assert.ErrorAs(t, err, &imageVersionDeletedErr) {
+				assert.Equal(t, imageID, imageVersionDeletedErr.ImageID)
+			}
+		})
+	}
+}
@@ -0,0 +1,54 @@
+/*
+Portions Copyright (c) Microsoft Corporation.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package imagefamily
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/samber/lo"
+)
+
+// ImageVersionTagSelectorError is returned when none of the versions of the image of a custom image term has all the
+// tags of its version tag selector, rather than falling back to the latest version of the image
+type ImageVersionTagSelectorError struct {
+	Selector        map[string]string
+	ImageDefinition string
+}
+
+func (e *ImageVersionTagSelectorError) Error() string {
+	return fmt.Sprintf("no version of image %s has the tags of the version tag selector %s", e.ImageDefinition, formatVersionTagSelector(e.Selector))
+}
+
+// matchesVersionTagSelector returns whether the tags of the image version have all the key/values of the version tag
+// selector. An empty selector matches all versions.
+func matchesVersionTagSelector(selector map[string]string, tags map[string]*string) bool {
+	for key, value := range selector {
+		if tag, ok := tags[key]; !ok || lo.FromPtr(tag) != value {
+			return false
+		}
+	}
+	return true
+}
+
+// formatVersionTagSelector formats the version tag selector as its key=value pairs, sorted, e.g. "{validated=true}"
+func formatVersionTagSelector(selector map[string]string) string {
+	pairs := lo.MapToSlice(selector, func(key, value string) string { return key + "=" + value })
+	sort.Strings(pairs)
+	return "{" + strings.Join(pairs, ",") + "}"
+}
@@ -0,0 +1,196 @@
+/*
+Portions Copyright (c) Microsoft Corporation.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package imagefamily_test
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/samber/lo"
+	"github.com/stretchr/testify/assert"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	karpv1 "sigs.k8s.io/karpenter/pkg/apis/v1"
+	"sigs.k8s.io/karpenter/pkg/cloudprovider"
+
+	"github.com/Azure/karpenter-provider-azure/pkg/apis/v1beta1"
+	"github.com/Azure/karpenter-provider-azure/pkg/operator/options"
+	"github.com/Azure/karpenter-provider-azure/pkg/providers/imagefamily"
+	"github.com/Azure/karpenter-provider-azure/pkg/providers/imagefamily/bootstrap"
+	"github.com/Azure/karpenter-provider-azure/pkg/providers/imagefamily/customscriptsbootstrap"
+	"github.com/Azure/karpenter-provider-azure/pkg/providers/launchtemplate/parameters"
+	"github.com/Azure/karpenter-provider-azure/pkg/provisionclients/models"
+	"github.com/Azure/karpenter-provider-azure/pkg/test"
+)
+
+var updateGolden = flag.Bool("update", false, "update the golden files of the rendered kubelet flags")
+
+// TestKubeletFlagsGolden locks in the kubelet flags the scriptless bootstrap of every image family renders from the
+// kubelet configuration of the nodeclass, so that the image families don't diverge by accident. Run with -update to
+// regenerate the golden files after an intended change.
+func TestKubeletFlagsGolden(t *testing.T) {
+	staticParameters := &parameters.StaticParameters{
+		ClusterName:                    "test-cluster",
+		ClusterEndpoint:                "https://test-cluster",
+		SubnetID:                       "/subscriptions/test/resourceGroups/test/providers/Microsoft.Network/virtualNetworks/vnet/subnets/subnet",
+		Arch:                           karpv1.ArchitectureAmd64,
+		KubeletClientTLSBootstrapToken: "test-token",
+		KubernetesVersion:              "1.31.0",
+	}
+	instanceType := &cloudprovider.InstanceType{
+		Name: "Standard_D2s_v3",
+		Capacity: v1.ResourceList{
+			v1.ResourceCPU:    resource.MustParse("2"),
+			v1.ResourceMemory: resource.MustParse("8Gi"),
+		},
+	}
+	taints := []v1.Taint{
+		{Key: "dedicated", Value: "batch", Effect: v1.TaintEffectNoSchedule},
+		{Key: "karpenter.sh/unregistered", Effect: v1.TaintEffectNoExecute},
+	}
+
+	tests := []struct {
+		golden      string
+		imageFamily imagefamily.ImageFamily
+		cgroupMode  string
+	}{
+		{golden: "ubuntu2004", imageFamily: imagefamily.Ubuntu2004{Options: staticParameters}, cgroupMode: bootstrap.CgroupModeV2},
+		{golden: "ubuntu2204", imageFamily: imagefamily.Ubuntu2204{Options: staticParameters}, cgroupMode: bootstrap.CgroupModeV2},
+		{golden: "ubuntu2404", imageFamily: imagefamily.Ubuntu2404{Options: staticParameters}, cgroupMode: bootstrap.CgroupModeV2},
+		{golden: "azurelinux", imageFamily: imagefamily.AzureLinux{Options: staticParameters}, cgroupMode: bootstrap.CgroupModeV1},
+		{golden: "azurelinux3", imageFamily: imagefamily.AzureLinux3{Options: staticParameters}, cgroupMode: bootstrap.CgroupModeV2},
+		{golden: "custom", imageFamily: imagefamily.CustomImages{Options: staticParameters}, cgroupMode: bootstrap.CgroupModeV2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.golden, func(t *testing.T) {
+			kubeletConfig := goldenKubeletConfiguration(tt.cgroupMode)
+			customData, err := tt.imageFamily.ScriptlessCustomData(kubeletConfig, taints, nil, lo.ToPtr("Y2EtYnVuZGxl"), instanceType).Script()
+			assert.NoError(t, err)
+			match := renderedKubeletFlagsRegex.FindStringSubmatch(bootstrap.RenderForDebug(customData))
+			if !assert.NotNil(t, match, "expected KUBELET_FLAGS to be rendered") {
+				return
+			}
+			// one flag per line, so that a divergence diffs readably
+			rendered := strings.Join(strings.Fields(match[1]), "\n") + "\n"
+
+			assertGolden(t, filepath.Join("testdata", "kubeletflags", tt.golden+".golden"), rendered)
+		})
+	}
+}
+
+// TestCustomScriptsKubeletConfigGolden locks in the kubelet configuration the custom scripts bootstrap of every image
+// family requests from the node bootstrapping API. The API renders the kubelet flags itself, with the differences of
+// the distro of the OS SKU, so only the OS SKU differs between the image families of the same distro.
+func TestCustomScriptsKubeletConfigGolden(t *testing.T) {
+	ctx := options.ToContext(context.Background(), test.Options())
+	staticParameters := &parameters.StaticParameters{
+		ClusterName:                    "test-cluster",
+		SubnetID:                       "/subscriptions/test/resourceGroups/test/providers/Microsoft.Network/virtualNetworks/vnet/subnets/subnet",
+		Arch:                           karpv1.ArchitectureAmd64,
+		KubeletClientTLSBootstrapToken: "test-token",
+		KubernetesVersion:              "1.31.0",
+	}
+	instanceType := &cloudprovider.InstanceType{
+		Name: "Standard_D2s_v3",
+		Capacity: v1.ResourceList{
+			v1.ResourceCPU:    resource.MustParse("2"),
+			v1.ResourceMemory: resource.MustParse("8Gi"),
+		},
+	}
+
+	tests := []struct {
+		golden      string
+		imageFamily imagefamily.ImageFamily
+		cgroupMode  string
+	}{
+		{golden: "ubuntu2004", imageFamily: imagefamily.Ubuntu2004{Options: staticParameters}, cgroupMode: bootstrap.CgroupModeV1},
+		{golden: "ubuntu2204", imageFamily: imagefamily.Ubuntu2204{Options: staticParameters}, cgroupMode: bootstrap.CgroupModeV2},
+		{golden: "ubuntu2404", imageFamily: imagefamily.Ubuntu2404{Options: staticParameters}, cgroupMode: bootstrap.CgroupModeV2},
+		{golden: "azurelinux", imageFamily: imagefamily.AzureLinux{Options: staticParameters}, cgroupMode: bootstrap.CgroupModeV1},
+		{golden: "azurelinux3", imageFamily: imagefamily.AzureLinux3{Options: staticParameters}, cgroupMode: bootstrap.CgroupModeV2},
+		{golden: "custom", imageFamily: imagefamily.CustomImages{Options: staticParameters}, cgroupMode: bootstrap.CgroupModeV2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.golden, func(t *testing.T) {
+			bootstrapper := tt.imageFamily.CustomScriptsNodeBootstrapping(goldenKubeletConfiguration(tt.cgroupMode), nil, nil, nil, instanceType, "test-distro", "ManagedDisks", nil, nil)
+			provisionClientBootstrap, ok := bootstrapper.(customscriptsbootstrap.ProvisionClientBootstrap)
+			if !assert.True(t, ok, "expected the custom scripts bootstrap to use the node bootstrapping API") {
+				return
+			}
+			provisionValues, err := provisionClientBootstrap.ConstructProvisionValues(ctx)
+			if !assert.NoError(t, err) {
+				return
+			}
+			rendered, err := json.MarshalIndent(struct {
+				OsSku               *int32
+				MaxPods             *int32
+				CustomKubeletConfig *models.CustomKubeletConfig
+			}{
+				OsSku:               provisionValues.ProvisionProfile.OsSku,
+				MaxPods:             provisionValues.ProvisionProfile.MaxPods,
+				CustomKubeletConfig: provisionValues.ProvisionProfile.CustomKubeletConfig,
+			}, "", "  ")
+			assert.NoError(t, err)
+			assertGolden(t, filepath.Join("testdata", "customkubeletconfig", tt.golden+".golden"), string(rendered)+"\n")
+		})
+	}
+}
+
+// goldenKubeletConfiguration sets every field of the kubelet configuration of the nodeclass the bootstraps render
+func goldenKubeletConfiguration(cgroupMode string) *bootstrap.KubeletConfiguration {
+	return &bootstrap.KubeletConfiguration{
+		KubeletConfiguration: v1beta1.KubeletConfiguration{
+			CPUManagerPolicy:            "static",
+			CPUCFSQuota:                 lo.ToPtr(true),
+			TopologyManagerPolicy:       "best-effort",
+			ImageGCHighThresholdPercent: lo.ToPtr[int32](75),
+			ImageGCLowThresholdPercent:  lo.ToPtr[int32](60),
+			ContainerLogMaxSize:         "50Mi",
+			ContainerLogMaxFiles:        lo.ToPtr[int32](5),
+			PodPidsLimit:                lo.ToPtr[int64](4096),
+			AllowedUnsafeSysctls:        []string{"net.core.somaxconn", "kernel.msg*"},
+		},
+		MaxPods:                   50,
+		ClusterDNSServiceIP:       "10.0.0.10",
+		SystemReserved:            map[string]string{"cpu": "100m", "memory": "500Mi"},
+		KubeReserved:              map[string]string{"cpu": "200m", "memory": "1Gi"},
+		EvictionHard:              map[string]string{"memory.available": "750Mi", "nodefs.available": "10%"},
+		EvictionSoft:              map[string]string{"memory.available": "1Gi"},
+		EvictionSoftGracePeriod:   map[string]metav1.Duration{"memory.available": {Duration: time.Minute}},
+		EvictionMaxPodGracePeriod: lo.ToPtr[int32](60),
+		CgroupMode:                cgroupMode,
+	}
+}
+
+// assertGolden compares the rendered output with the golden file, after overwriting it with -update
+func assertGolden(t *testing.T, golden string, rendered string) {
+	t.Helper()
+	if *updateGolden {
+		assert.NoError(t, os.MkdirAll(filepath.Dir(golden), 0o755))
+		assert.NoError(t, os.WriteFile(golden, []byte(rendered), 0o600))
+	}
+	expected, err := os.ReadFile(golden)
+	assert.NoError(t, err)
+	assert.Equal(t, string(expected), rendered)
+}
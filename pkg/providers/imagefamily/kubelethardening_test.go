@@ -0,0 +1,141 @@
+/*
+Portions Copyright (c) Microsoft Corporation.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package imagefamily_test
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/samber/lo"
+	"github.com/stretchr/testify/assert"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	karpv1 "sigs.k8s.io/karpenter/pkg/apis/v1"
+	"sigs.k8s.io/karpenter/pkg/cloudprovider"
+
+	"github.com/Azure/karpenter-provider-azure/pkg/apis/v1beta1"
+	"github.com/Azure/karpenter-provider-azure/pkg/fake"
+	"github.com/Azure/karpenter-provider-azure/pkg/operator/options"
+	"github.com/Azure/karpenter-provider-azure/pkg/providers/imagefamily"
+	"github.com/Azure/karpenter-provider-azure/pkg/providers/imagefamily/bootstrap"
+	"github.com/Azure/karpenter-provider-azure/pkg/providers/imagefamily/customscriptsbootstrap"
+	"github.com/Azure/karpenter-provider-azure/pkg/providers/launchtemplate/parameters"
+)
+
+var renderedKubeletFlagsRegex = regexp.MustCompile(`KUBELET_FLAGS="([^"]*)"`)
+
+// TestKubeletHardening asserts that the kubelet flags rendered or requested by both bootstrap paths of every image family disable the
+// read-only port and anonymous authentication, and authorize through the API server, unless explicitly overridden
+func TestKubeletHardening(t *testing.T) {
+	staticParameters := &parameters.StaticParameters{
+		ClusterName:                    "test-cluster",
+		ClusterEndpoint:                "https://test-cluster",
+		SubnetID:                       "/subscriptions/test/resourceGroups/test/providers/Microsoft.Network/virtualNetworks/vnet/subnets/subnet",
+		Arch:                           karpv1.ArchitectureAmd64,
+		SubscriptionID:                 "test-subscription",
+		ResourceGroup:                  "test-rg",
+		ClusterResourceGroup:           "test-cluster-rg",
+		KubeletClientTLSBootstrapToken: "test-token",
+		KubernetesVersion:              "1.31.0",
+	}
+	imageFamilies := []imagefamily.ImageFamily{
+		imagefamily.Ubuntu2004{Options: staticParameters},
+		imagefamily.Ubuntu2204{Options: staticParameters},
+		imagefamily.Ubuntu2404{Options: staticParameters},
+		imagefamily.AzureLinux{Options: staticParameters},
+		imagefamily.AzureLinux3{Options: staticParameters},
+		imagefamily.CustomImages{Options: staticParameters},
+	}
+	instanceType := &cloudprovider.InstanceType{
+		Name: "Standard_D2s_v3",
+		Capacity: v1.ResourceList{
+			v1.ResourceCPU:    resource.MustParse("2"),
+			v1.ResourceMemory: resource.MustParse("8Gi"),
+		},
+	}
+	ctx := options.ToContext(context.Background(), &options.Options{VMMemoryOverheadPercent: 0.075})
+
+	tests := []struct {
+		name             string
+		insecureDefaults *v1beta1.InsecureKubeletDefaults
+		expectedFlags    []string
+	}{
+		{
+			name:          "hardened by default",
+			expectedFlags: []string{"--read-only-port=0", "--anonymous-auth=false", "--authorization-mode=Webhook"},
+		},
+		{
+			name:             "hardened when overridden with the hardened values",
+			insecureDefaults: &v1beta1.InsecureKubeletDefaults{ReadOnlyPort: lo.ToPtr[int32](0), AnonymousAuth: lo.ToPtr(false)},
+			expectedFlags:    []string{"--read-only-port=0", "--anonymous-auth=false", "--authorization-mode=Webhook"},
+		},
+		{
+			name: "insecure when explicitly overridden",
+			insecureDefaults: &v1beta1.InsecureKubeletDefaults{
+				ReadOnlyPort:      lo.ToPtr[int32](10255),
+				AnonymousAuth:     lo.ToPtr(true),
+				AuthorizationMode: v1beta1.KubeletAuthorizationModeAlwaysAllow,
+			},
+			expectedFlags: []string{"--read-only-port=10255", "--anonymous-auth=true", "--authorization-mode=AlwaysAllow"},
+		},
+	}
+	for _, imageFamily := range imageFamilies {
+		for _, tt := range tests {
+			t.Run(imageFamily.Name()+"/"+tt.name, func(t *testing.T) {
+				kubeletConfig := &bootstrap.KubeletConfiguration{MaxPods: 110}
+				kubeletConfig.InsecureKubeletDefaults = tt.insecureDefaults
+
+				customData, err := imageFamily.ScriptlessCustomData(kubeletConfig, nil, nil, lo.ToPtr("Y2EtYnVuZGxl"), instanceType).Script()
+				assert.NoError(t, err)
+				expectKubeletFlags(t, bootstrap.RenderForDebug(customData), tt.expectedFlags)
+
+				// the custom scripts bootstrap requests the flags from the node bootstrapping API
+				bootstrapper, ok := imageFamily.CustomScriptsNodeBootstrapping(kubeletConfig, nil, nil, map[string]string{}, instanceType,
+					"aks-ubuntu-containerd-22.04-gen2", "ManagedDisks", &fake.NodeBootstrappingAPI{}, nil).(customscriptsbootstrap.ProvisionClientBootstrap)
+				if !assert.True(t, ok) {
+					return
+				}
+				provisionValues, err := bootstrapper.ConstructProvisionValues(ctx)
+				assert.NoError(t, err)
+				customKubeletConfig := provisionValues.ProvisionProfile.CustomKubeletConfig
+				assert.Equal(t, []string{
+					fmt.Sprintf("--read-only-port=%d", lo.FromPtr(customKubeletConfig.ReadOnlyPort)),
+					fmt.Sprintf("--anonymous-auth=%t", lo.FromPtr(customKubeletConfig.AnonymousAuth)),
+					fmt.Sprintf("--authorization-mode=%s", lo.FromPtr(customKubeletConfig.AuthorizationMode)),
+				}, tt.expectedFlags)
+			})
+		}
+	}
+}
+
+func expectKubeletFlags(t *testing.T, rendered string, expectedFlags []string) {
+	t.Helper()
+	match := renderedKubeletFlagsRegex.FindStringSubmatch(rendered)
+	if !assert.NotNil(t, match, "expected KUBELET_FLAGS to be rendered") {
+		return
+	}
+	kubeletFlags := strings.Fields(match[1])
+	for _, flag := range expectedFlags {
+		assert.Contains(t, kubeletFlags, flag)
+		// each flag is set exactly once, so that no other value silently takes precedence
+		name := strings.SplitN(flag, "=", 2)[0]
+		assert.Len(t, lo.Filter(kubeletFlags, func(f string, _ int) bool { return strings.HasPrefix(f, name+"=") }), 1, "expected %s to be set once", name)
+	}
+}
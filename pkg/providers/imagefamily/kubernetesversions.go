@@ -0,0 +1,160 @@
+/*
+Portions Copyright (c) Microsoft Corporation.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package imagefamily
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/blang/semver/v4"
+	"github.com/samber/lo"
+
+	"github.com/Azure/karpenter-provider-azure/pkg/apis/v1beta1"
+	"github.com/Azure/karpenter-provider-azure/pkg/providers/imagefamily/types"
+)
+
+const (
+	// MinKubernetesVersionTagKey is the gallery image definition tag with the oldest Kubernetes minor version the versions
+	// of a custom image support, e.g. "1.30"
+	MinKubernetesVersionTagKey = "minKubernetesVersion"
+	// MaxKubernetesVersionTagKey is the gallery image definition tag with the newest Kubernetes minor version the versions
+	// of a custom image support, e.g. "1.33"
+	MaxKubernetesVersionTagKey = "maxKubernetesVersion"
+)
+
+// KubernetesVersionRange is the range of Kubernetes minor versions the versions of an image definition support,
+// inclusive. An empty bound doesn't bound the range.
+type KubernetesVersionRange struct {
+	Min string
+	Max string
+}
+
+// supportedKubernetesVersions are the Kubernetes versions supported by the node image definitions of AKS that don't
+// support all of them. The kubelet of newer Kubernetes minor versions fails to join on images that don't support it.
+var supportedKubernetesVersions = map[string]KubernetesVersionRange{
+	// Azure Linux 2.0 isn't supported from Kubernetes 1.32, which uses Azure Linux 3.0 instead
+	AzureLinuxGen2ImageDefinition:      {Max: "1.31"},
+	AzureLinuxGen1ImageDefinition:      {Max: "1.31"},
+	AzureLinuxGen2ArmImageDefinition:   {Max: "1.31"},
+	AzureLinux2Gen2FIPSImageDefinition: {Max: "1.31"},
+	AzureLinux2Gen1FIPSImageDefinition: {Max: "1.31"},
+	// Azure Linux 3.0 is published from Kubernetes 1.28, for the AzureLinux3 image family before 1.32
+	AzureLinux3Gen2ImageDefinition:          {Min: "1.28"},
+	AzureLinux3Gen1ImageDefinition:          {Min: "1.28"},
+	AzureLinux3Gen2ArmImageDefinition:       {Min: "1.28"},
+	AzureLinux3Gen2FIPSImageDefinition:      {Min: "1.28"},
+	AzureLinux3Gen1FIPSImageDefinition:      {Min: "1.28"},
+	AzureLinux3Gen2Arm64FIPSImageDefinition: {Min: "1.28"},
+	// Ubuntu 24.04 is supported from Kubernetes 1.32
+	Ubuntu2404Gen2ImageDefinition:    {Min: "1.32"},
+	Ubuntu2404Gen1ImageDefinition:    {Min: "1.32"},
+	Ubuntu2404Gen2ArmImageDefinition: {Min: "1.32"},
+}
+
+// Contains returns whether the Kubernetes version is within the range, comparing minor versions only
+func (r KubernetesVersionRange) Contains(kubernetesVersion string) (bool, error) {
+	version, err := parseMinorVersion(kubernetesVersion)
+	if err != nil {
+		return false, err
+	}
+	if r.Min != "" {
+		minVersion, err := parseMinorVersion(r.Min)
+		if err != nil {
+			return false, fmt.Errorf("parsing minimum kubernetes version, %w", err)
+		}
+		if version.LT(minVersion) {
+			return false, nil
+		}
+	}
+	if r.Max != "" {
+		maxVersion, err := parseMinorVersion(r.Max)
+		if err != nil {
+			return false, fmt.Errorf("parsing maximum kubernetes version, %w", err)
+		}
+		if version.GT(maxVersion) {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+func (r KubernetesVersionRange) String() string {
+	switch {
+	case r.Min != "" && r.Max != "":
+		return fmt.Sprintf("%s to %s", r.Min, r.Max)
+	case r.Min != "":
+		return fmt.Sprintf("%s and newer", r.Min)
+	case r.Max != "":
+		return fmt.Sprintf("%s and older", r.Max)
+	default:
+		return "all versions"
+	}
+}
+
+// parseMinorVersion parses the major and minor version of a Kubernetes version, e.g. 1.31 for v1.31.2
+func parseMinorVersion(version string) (semver.Version, error) {
+	parsed, err := semver.ParseTolerant(strings.TrimPrefix(version, "v"))
+	if err != nil {
+		return semver.Version{}, fmt.Errorf("parsing kubernetes version %q, %w", version, err)
+	}
+	return semver.Version{Major: parsed.Major, Minor: parsed.Minor}, nil
+}
+
+// ValidateKubernetesVersion returns an error naming the image, its version and the Kubernetes version if the image
+// doesn't support the Kubernetes version
+func ValidateKubernetesVersion(imageID, kubernetesVersion string, supported KubernetesVersionRange) error {
+	ok, err := supported.Contains(kubernetesVersion)
+	if err != nil {
+		return fmt.Errorf("validating kubernetes version of image %s, %w", imageID, err)
+	}
+	if !ok {
+		imageVersion := imageID[strings.LastIndex(imageID, "/")+1:]
+		return fmt.Errorf("image %s version %s does not support kubernetes version %s, it supports kubernetes %s", imageID, imageVersion, kubernetesVersion, supported)
+	}
+	return nil
+}
+
+// KubernetesVersionRange returns the Kubernetes versions the image supports: from the gallery tags of its image
+// definition for a custom image, and otherwise from the supported versions of the node image definitions of AKS. The
+// images of the imageID and marketplaceImage of the AKSNodeClass support any version, as they declare none.
+func (p *provider) KubernetesVersionRange(ctx context.Context, nodeClass *v1beta1.AKSNodeClass, imageID string) (KubernetesVersionRange, error) {
+	if lo.FromPtr(nodeClass.Spec.ImageID) != "" || nodeClass.Spec.MarketplaceImage != nil {
+		return KubernetesVersionRange{}, nil
+	}
+	if lo.FromPtr(nodeClass.Spec.ImageFamily) != v1beta1.CustomImageFamily {
+		image := types.DefaultImageOutput{}
+		image.PopulateImageTraitsFromID(imageID)
+		return supportedKubernetesVersions[image.ImageDefinition], nil
+	}
+	imageTerm, ok := CustomImageTermForImage(CustomImageTerms(ctx, nodeClass), imageID)
+	if !ok {
+		return KubernetesVersionRange{}, nil
+	}
+	clientFactory, err := p.customImageClientFactory(imageTerm)
+	if err != nil {
+		return KubernetesVersionRange{}, err
+	}
+	imageDefinition, err := p.getCustomImageDefinition(ctx, clientFactory, imageTerm)
+	if err != nil {
+		return KubernetesVersionRange{}, err
+	}
+	return KubernetesVersionRange{
+		Min: lo.FromPtr(imageDefinition.Tags[MinKubernetesVersionTagKey]),
+		Max: lo.FromPtr(imageDefinition.Tags[MaxKubernetesVersionTagKey]),
+	}, nil
+}
@@ -0,0 +1,70 @@
+/*
+Portions Copyright (c) Microsoft Corporation.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package imagefamily
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestKubernetesVersionRangeContains(t *testing.T) {
+	cases := []struct {
+		name              string
+		supported         KubernetesVersionRange
+		kubernetesVersion string
+		expected          bool
+	}{
+		{name: "unbounded", kubernetesVersion: "1.33.1", expected: true},
+		{name: "at the minimum", supported: KubernetesVersionRange{Min: "1.32"}, kubernetesVersion: "1.32.0", expected: true},
+		{name: "below the minimum", supported: KubernetesVersionRange{Min: "1.32"}, kubernetesVersion: "1.31.9", expected: false},
+		{name: "patch of the maximum", supported: KubernetesVersionRange{Max: "1.31"}, kubernetesVersion: "v1.31.12", expected: true},
+		{name: "above the maximum", supported: KubernetesVersionRange{Max: "1.31"}, kubernetesVersion: "1.32.0", expected: false},
+		{name: "within both bounds", supported: KubernetesVersionRange{Min: "1.30", Max: "1.33.2"}, kubernetesVersion: "1.33.5", expected: true},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			contains, err := tc.supported.Contains(tc.kubernetesVersion)
+			assert.NoError(t, err)
+			assert.Equal(t, tc.expected, contains)
+		})
+	}
+
+	_, err := KubernetesVersionRange{Max: "latest"}.Contains("1.32.0")
+	assert.Error(t, err)
+}
+
+func TestValidateKubernetesVersion(t *testing.T) {
+	imageID := "/subscriptions/10945678-1234-1234-1234-123456789012/resourceGroups/AKS-AzureLinux/providers/Microsoft.Compute/galleries/AKSAzureLinux/images/V2gen2/versions/202501.02.0"
+	assert.NoError(t, ValidateKubernetesVersion(imageID, "1.31.2", supportedKubernetesVersions[AzureLinuxGen2ImageDefinition]))
+	assert.EqualError(t, ValidateKubernetesVersion(imageID, "1.32.0", supportedKubernetesVersions[AzureLinuxGen2ImageDefinition]),
+		"image "+imageID+" version 202501.02.0 does not support kubernetes version 1.32.0, it supports kubernetes 1.31 and older")
+
+	// the AzureLinux3 image family is rejected before Azure Linux 3.0 is published
+	imageID = "/subscriptions/10945678-1234-1234-1234-123456789012/resourceGroups/AKS-AzureLinux/providers/Microsoft.Compute/galleries/AKSAzureLinux/images/V3gen2/versions/202501.02.0"
+	assert.NoError(t, ValidateKubernetesVersion(imageID, "1.28.0", supportedKubernetesVersions[AzureLinux3Gen2ImageDefinition]))
+	assert.EqualError(t, ValidateKubernetesVersion(imageID, "1.27.9", supportedKubernetesVersions[AzureLinux3Gen2ImageDefinition]),
+		"image "+imageID+" version 202501.02.0 does not support kubernetes version 1.27.9, it supports kubernetes 1.28 and newer")
+
+	// and the Ubuntu2404 image family before Ubuntu 24.04 is supported
+	imageID = "/subscriptions/10945678-1234-1234-1234-123456789012/resourceGroups/AKS-Ubuntu/providers/Microsoft.Compute/galleries/AKSUbuntu/images/2404gen2containerd/versions/202505.27.0"
+	for _, imageDefinition := range []string{Ubuntu2404Gen2ImageDefinition, Ubuntu2404Gen1ImageDefinition, Ubuntu2404Gen2ArmImageDefinition} {
+		assert.NoError(t, ValidateKubernetesVersion(imageID, "1.32.0", supportedKubernetesVersions[imageDefinition]))
+		assert.EqualError(t, ValidateKubernetesVersion(imageID, "1.31.9", supportedKubernetesVersions[imageDefinition]),
+			"image "+imageID+" version 202505.27.0 does not support kubernetes version 1.31.9, it supports kubernetes 1.32 and newer")
+	}
+}
@@ -0,0 +1,205 @@
+/*
+Portions Copyright (c) Microsoft Corporation.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package imagefamily
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+
+	sdkerrors "github.com/Azure/azure-sdk-for-go-extensions/pkg/errors"
+	"github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/compute/armcompute/v7"
+	"github.com/blang/semver/v4"
+	"github.com/samber/lo"
+	v1 "k8s.io/api/core/v1"
+	"sigs.k8s.io/karpenter/pkg/scheduling"
+
+	"github.com/Azure/karpenter-provider-azure/pkg/apis/v1beta1"
+)
+
+const marketplaceImageIDFormat = "/Subscriptions/%s/Providers/Microsoft.Compute/Locations/%s/Publishers/%s/ArtifactTypes/VMImage/Offers/%s/Skus/%s/Versions/%s"
+
+// marketplaceImageIDPattern matches the IDs of marketplace image versions, capturing their publisher, offer, SKU and version
+var marketplaceImageIDPattern = regexp.MustCompile(`(?i)^/subscriptions/[^/]+/providers/microsoft\.compute/locations/[^/]+/publishers/([^/]+)/artifacttypes/vmimage/offers/([^/]+)/skus/([^/]+)/versions/([^/]+)$`)
+
+// BuildImageIDMarketplace returns the ID of a marketplace image version in the location, as returned by ARM
+func BuildImageIDMarketplace(subscriptionID, location, publisher, offer, sku, version string) string {
+	return fmt.Sprintf(marketplaceImageIDFormat, subscriptionID, location, publisher, offer, sku, version)
+}
+
+// MarketplaceImageReference returns the reference of the marketplace image version of the ID, by its publisher, offer,
+// SKU and version, or false if the ID isn't of a marketplace image version
+func MarketplaceImageReference(imageID string) (*armcompute.ImageReference, bool) {
+	match := marketplaceImageIDPattern.FindStringSubmatch(imageID)
+	if match == nil {
+		return nil, false
+	}
+	return &armcompute.ImageReference{
+		Publisher: lo.ToPtr(match[1]),
+		Offer:     lo.ToPtr(match[2]),
+		SKU:       lo.ToPtr(match[3]),
+		Version:   lo.ToPtr(match[4]),
+	}, true
+}
+
+// marketplaceImageName returns the URN of the marketplace image, without its version, for errors
+func marketplaceImageName(imageTerm *v1beta1.MarketplaceImageTerm) string {
+	return fmt.Sprintf("%s:%s:%s", imageTerm.Publisher, imageTerm.Offer, imageTerm.SKU)
+}
+
+// marketplaceImageCacheKey returns the cache key of the marketplace image of an AKSNodeClass: its URN, with its pinned
+// version or else latest
+func marketplaceImageCacheKey(imageTerm *v1beta1.MarketplaceImageTerm) string {
+	return fmt.Sprintf("marketplace-%s:%s", marketplaceImageName(imageTerm), lo.Ternary(imageTerm.Version != "", imageTerm.Version, "latest"))
+}
+
+// listMarketplaceImage returns the image of the marketplace image of the AKSNodeClass: its pinned version, or else its
+// latest version. The marketplace is queried with the clients of the subscription of the cluster.
+func (p *provider) listMarketplaceImage(ctx context.Context, nodeClass *v1beta1.AKSNodeClass) ([]NodeImage, error) {
+	imageTerm := nodeClass.Spec.MarketplaceImage
+	key := marketplaceImageCacheKey(imageTerm)
+	cachedImage, found := p.nodeImagesCache.Get(key)
+	recordCacheLookup(resolutionPathMarketplace, found)
+	if found {
+		return cachedImage.([]NodeImage), nil
+	}
+
+	clientFactory, err := p.customGalleryClientFactory(p.subscription, "")
+	if err != nil {
+		return nil, err
+	}
+	imagesClient := clientFactory.NewVirtualMachineImagesClient()
+	version := imageTerm.Version
+	if version == "" {
+		if version, err = p.latestMarketplaceImageVersion(ctx, imagesClient, imageTerm); err != nil {
+			return nil, err
+		}
+	}
+	resp, err := imagesClient.Get(ctx, p.location, imageTerm.Publisher, imageTerm.Offer, imageTerm.SKU, version, nil)
+	if err != nil {
+		if imageTerm.Version != "" && sdkerrors.IsNotFoundErr(err) {
+			return nil, &ImageVersionNotFoundError{ImageVersion: version, ImageDefinition: marketplaceImageName(imageTerm)}
+		}
+		return nil, fmt.Errorf("getting marketplace image %s version %s, %w", marketplaceImageName(imageTerm), version, err)
+	}
+	if err := validateMarketplaceImage(&resp.VirtualMachineImage, imageTerm); err != nil {
+		return nil, err
+	}
+
+	imageID := BuildImageIDMarketplace(p.subscription, p.location, imageTerm.Publisher, imageTerm.Offer, imageTerm.SKU, version)
+	// the image is cached by its ID too, for its purchase plan to be looked up on launch
+	p.nodeImagesCache.SetDefault(imageID, &resp.VirtualMachineImage)
+	p.logDiscoveredImage(ctx, imageID, v1beta1.ImageChannelStable, imageTerm.Version != "")
+	nodeImages := []NodeImage{{
+		ID:           imageID,
+		Requirements: marketplaceImageRequirements(&resp.VirtualMachineImage),
+		Channel:      v1beta1.ImageChannelStable,
+		Pinned:       imageTerm.Version != "",
+	}}
+	p.nodeImagesCache.SetDefault(key, nodeImages)
+	return nodeImages, nil
+}
+
+// latestMarketplaceImageVersion returns the newest version of the marketplace image in the location. Marketplace image
+// versions are major.minor.build, and compared as semantic versions.
+func (p *provider) latestMarketplaceImageVersion(ctx context.Context, imagesClient *armcompute.VirtualMachineImagesClient, imageTerm *v1beta1.MarketplaceImageTerm) (string, error) {
+	resp, err := imagesClient.List(ctx, p.location, imageTerm.Publisher, imageTerm.Offer, imageTerm.SKU, nil)
+	if err != nil {
+		return "", fmt.Errorf("listing marketplace image %s versions, %w", marketplaceImageName(imageTerm), err)
+	}
+	var latest string
+	var latestVersion semver.Version
+	for _, image := range resp.VirtualMachineImageResourceArray {
+		version, err := semver.ParseTolerant(lo.FromPtr(image.Name))
+		if err != nil {
+			continue
+		}
+		if latest == "" || version.GT(latestVersion) {
+			latest, latestVersion = lo.FromPtr(image.Name), version
+		}
+	}
+	if latest == "" {
+		return "", fmt.Errorf("marketplace image %s has no versions in %s", marketplaceImageName(imageTerm), p.location)
+	}
+	return latest, nil
+}
+
+// validateMarketplaceImage rejects marketplace images that can't boot as nodes of the marketplace image term
+func validateMarketplaceImage(image *armcompute.VirtualMachineImage, imageTerm *v1beta1.MarketplaceImageTerm) error {
+	if image.Properties == nil {
+		return nil
+	}
+	// TODO(Windows): the image families are all Linux for now
+	if image.Properties.OSDiskImage != nil && lo.FromPtr(image.Properties.OSDiskImage.OperatingSystem) != armcompute.OperatingSystemTypesLinux {
+		return fmt.Errorf("marketplace image %s has operating system %s, expected %s", marketplaceImageName(imageTerm), lo.FromPtr(image.Properties.OSDiskImage.OperatingSystem), armcompute.OperatingSystemTypesLinux)
+	}
+	architecture := v1beta1.AzureToKubeArchitectures[string(marketplaceImageArchitecture(image))]
+	if arch := distroArch(imageTerm.DistroName); architecture != arch {
+		return fmt.Errorf("marketplace image %s has architecture %s, but distroName %s requires %s", marketplaceImageName(imageTerm), architecture, imageTerm.DistroName, arch)
+	}
+	return nil
+}
+
+// marketplaceImageRequirements returns the requirements of the instance types a marketplace image can boot on, from
+// its architecture and Hyper-V generation
+func marketplaceImageRequirements(image *armcompute.VirtualMachineImage) scheduling.Requirements {
+	hyperVGeneration := v1beta1.HyperVGenerationV1
+	if image.Properties != nil && lo.FromPtr(image.Properties.HyperVGeneration) == armcompute.HyperVGenerationTypesV2 {
+		hyperVGeneration = v1beta1.HyperVGenerationV2
+	}
+	return scheduling.NewRequirements(
+		scheduling.NewRequirement(v1.LabelArchStable, v1.NodeSelectorOpIn, v1beta1.AzureToKubeArchitectures[string(marketplaceImageArchitecture(image))]),
+		scheduling.NewRequirement(v1beta1.LabelSKUHyperVGeneration, v1.NodeSelectorOpIn, hyperVGeneration),
+	)
+}
+
+// marketplaceImageArchitecture returns the architecture of a marketplace image. An image without architecture is x64.
+func marketplaceImageArchitecture(image *armcompute.VirtualMachineImage) armcompute.ArchitectureTypes {
+	if image.Properties != nil && image.Properties.Architecture != nil {
+		return *image.Properties.Architecture
+	}
+	return armcompute.ArchitectureTypesX64
+}
+
+// MarketplaceImagePlan returns the purchase plan of the marketplace image version of the ID, which VMs launching with
+// it must specify, or nil if the image isn't a marketplace image or has no plan
+func (p *provider) MarketplaceImagePlan(ctx context.Context, imageID string) (*armcompute.PurchasePlan, error) {
+	ref, ok := MarketplaceImageReference(imageID)
+	if !ok {
+		return nil, nil
+	}
+	if cached, found := p.nodeImagesCache.Get(imageID); found {
+		return marketplaceImagePlan(cached.(*armcompute.VirtualMachineImage)), nil
+	}
+	clientFactory, err := p.customGalleryClientFactory(p.subscription, "")
+	if err != nil {
+		return nil, err
+	}
+	resp, err := clientFactory.NewVirtualMachineImagesClient().Get(ctx, p.location, *ref.Publisher, *ref.Offer, *ref.SKU, *ref.Version, nil)
+	if err != nil {
+		return nil, fmt.Errorf("getting marketplace image %s, %w", imageID, err)
+	}
+	p.nodeImagesCache.SetDefault(imageID, &resp.VirtualMachineImage)
+	return marketplaceImagePlan(&resp.VirtualMachineImage), nil
+}
+
+func marketplaceImagePlan(image *armcompute.VirtualMachineImage) *armcompute.PurchasePlan {
+	if image.Properties == nil {
+		return nil
+	}
+	return image.Properties.Plan
+}
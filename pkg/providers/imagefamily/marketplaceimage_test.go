@@ -0,0 +1,192 @@
+/*
+Portions Copyright (c) Microsoft Corporation.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package imagefamily
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/arm"
+	azfake "github.com/Azure/azure-sdk-for-go/sdk/azcore/fake"
+	"github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/compute/armcompute/v7"
+	computefake "github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/compute/armcompute/v7/fake"
+	"github.com/patrickmn/go-cache"
+	"github.com/samber/lo"
+	"github.com/stretchr/testify/assert"
+	v1 "k8s.io/api/core/v1"
+
+	"github.com/Azure/karpenter-provider-azure/pkg/apis/v1beta1"
+	"github.com/Azure/karpenter-provider-azure/pkg/operator/options"
+)
+
+// fakeMarketplaceClientFactory returns a client factory of a marketplace with the Linux image versions
+func fakeMarketplaceClientFactory(t *testing.T, images map[string]*armcompute.VirtualMachineImage) *armcompute.ClientFactory {
+	t.Helper()
+	transport := computefake.NewServerFactoryTransport(&computefake.ServerFactory{
+		VirtualMachineImagesServer: computefake.VirtualMachineImagesServer{
+			List: func(_ context.Context, _, _, _, _ string, _ *armcompute.VirtualMachineImagesClientListOptions) (resp azfake.Responder[armcompute.VirtualMachineImagesClientListResponse], errResp azfake.ErrorResponder) {
+				resources := []*armcompute.VirtualMachineImageResource{}
+				for version := range images {
+					resources = append(resources, &armcompute.VirtualMachineImageResource{Name: lo.ToPtr(version)})
+				}
+				resp.SetResponse(http.StatusOK, armcompute.VirtualMachineImagesClientListResponse{VirtualMachineImageResourceArray: resources}, nil)
+				return
+			},
+			Get: func(_ context.Context, _, _, _, _, version string, _ *armcompute.VirtualMachineImagesClientGetOptions) (resp azfake.Responder[armcompute.VirtualMachineImagesClientGetResponse], errResp azfake.ErrorResponder) {
+				image, ok := images[version]
+				if !ok {
+					errResp.SetResponseError(http.StatusNotFound, "NotFound")
+					return
+				}
+				resp.SetResponse(http.StatusOK, armcompute.VirtualMachineImagesClientGetResponse{VirtualMachineImage: *image}, nil)
+				return
+			},
+		},
+	})
+	clientFactory, err := armcompute.NewClientFactory("00000000-0000-0000-0000-000000000000", &azfake.TokenCredential{},
+		&arm.ClientOptions{ClientOptions: azcore.ClientOptions{Transport: transport}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return clientFactory
+}
+
+func marketplaceImage(version string, architecture armcompute.ArchitectureTypes, plan *armcompute.PurchasePlan) *armcompute.VirtualMachineImage {
+	return &armcompute.VirtualMachineImage{
+		Name: lo.ToPtr(version),
+		Properties: &armcompute.VirtualMachineImageProperties{
+			Architecture:     lo.ToPtr(architecture),
+			HyperVGeneration: lo.ToPtr(armcompute.HyperVGenerationTypesV2),
+			OSDiskImage:      &armcompute.OSDiskImage{OperatingSystem: lo.ToPtr(armcompute.OperatingSystemTypesLinux)},
+			Plan:             plan,
+		},
+	}
+}
+
+func TestListMarketplaceImage(t *testing.T) {
+	plan := &armcompute.PurchasePlan{Name: lo.ToPtr("cis-ubuntu2204"), Product: lo.ToPtr("cis-ubuntu"), Publisher: lo.ToPtr("center-for-internet-security-inc")}
+	images := map[string]*armcompute.VirtualMachineImage{
+		"1.0.9":  marketplaceImage("1.0.9", armcompute.ArchitectureTypesX64, plan),
+		"1.0.10": marketplaceImage("1.0.10", armcompute.ArchitectureTypesX64, plan),
+		"1.1.0":  marketplaceImage("1.1.0", armcompute.ArchitectureTypesArm64, nil),
+	}
+	for _, tc := range []struct {
+		name         string
+		version      string
+		distroName   string
+		expected     string
+		expectedPlan *armcompute.PurchasePlan
+		expectedErr  string
+	}{
+		{
+			name:       "latest version",
+			distroName: "aks-ubuntu-arm64-containerd-22.04-gen2",
+			expected:   "1.1.0",
+		},
+		{
+			name:         "pinned version with a plan",
+			version:      "1.0.10",
+			distroName:   "aks-ubuntu-containerd-22.04-gen2",
+			expected:     "1.0.10",
+			expectedPlan: plan,
+		},
+		{
+			name:        "pinned version of another architecture than the distro",
+			version:     "1.0.9",
+			distroName:  "aks-ubuntu-arm64-containerd-22.04-gen2",
+			expectedErr: "marketplace image center-for-internet-security-inc:cis-ubuntu:cis-ubuntu2204 has architecture amd64, but distroName aks-ubuntu-arm64-containerd-22.04-gen2 requires arm64",
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			ctx := options.ToContext(context.Background(), &options.Options{})
+			p := NewProvider(nil, "westus", "00000000-0000-0000-0000-000000000000", nil, cache.New(ImageExpirationInterval, ImageCacheCleaningInterval))
+			clientFactory := fakeMarketplaceClientFactory(t, images)
+			p.newCustomGalleryClientFactory = func(string, string) (*armcompute.ClientFactory, error) { return clientFactory, nil }
+			nodeClass := &v1beta1.AKSNodeClass{
+				Spec: v1beta1.AKSNodeClassSpec{
+					MarketplaceImage: &v1beta1.MarketplaceImageTerm{
+						Publisher:  "center-for-internet-security-inc",
+						Offer:      "cis-ubuntu",
+						SKU:        "cis-ubuntu2204",
+						Version:    tc.version,
+						DistroName: tc.distroName,
+					},
+				},
+			}
+
+			nodeImages, err := p.listMarketplaceImage(ctx, nodeClass)
+			if tc.expectedErr != "" {
+				assert.EqualError(t, err, tc.expectedErr)
+				return
+			}
+			assert.NoError(t, err)
+			imageID := BuildImageIDMarketplace("00000000-0000-0000-0000-000000000000", "westus", "center-for-internet-security-inc", "cis-ubuntu", "cis-ubuntu2204", tc.expected)
+			assert.Len(t, nodeImages, 1)
+			assert.Equal(t, imageID, nodeImages[0].ID)
+			assert.Equal(t, tc.version != "", nodeImages[0].Pinned)
+			assert.True(t, nodeImages[0].Requirements.Get(v1.LabelArchStable).Has(distroArch(tc.distroName)))
+			assert.True(t, nodeImages[0].Requirements.Get(v1beta1.LabelSKUHyperVGeneration).Has(v1beta1.HyperVGenerationV2))
+
+			imagePlan, err := p.MarketplaceImagePlan(ctx, imageID)
+			assert.NoError(t, err)
+			assert.Equal(t, tc.expectedPlan, imagePlan)
+		})
+	}
+}
+
+func TestListMarketplaceImagePinnedVersionNotFound(t *testing.T) {
+	ctx := options.ToContext(context.Background(), &options.Options{})
+	p := NewProvider(nil, "westus", "00000000-0000-0000-0000-000000000000", nil, cache.New(ImageExpirationInterval, ImageCacheCleaningInterval))
+	clientFactory := fakeMarketplaceClientFactory(t, map[string]*armcompute.VirtualMachineImage{})
+	p.newCustomGalleryClientFactory = func(string, string) (*armcompute.ClientFactory, error) { return clientFactory, nil }
+	nodeClass := &v1beta1.AKSNodeClass{
+		Spec: v1beta1.AKSNodeClassSpec{
+			MarketplaceImage: &v1beta1.MarketplaceImageTerm{Publisher: "Canonical", Offer: "ubuntu-24_04-lts", SKU: "server", Version: "24.04.202410090"},
+		},
+	}
+	_, err := p.listMarketplaceImage(ctx, nodeClass)
+	var imageVersionNotFoundErr *ImageVersionNotFoundError
+	assert.True(t, errors.As(err, &imageVersionNotFoundErr))
+
+	// without versions, there's no latest version
+	nodeClass.Spec.MarketplaceImage.Version = ""
+	_, err = p.listMarketplaceImage(ctx, nodeClass)
+	assert.EqualError(t, err, "marketplace image Canonical:ubuntu-24_04-lts:server has no versions in westus")
+}
+
+func TestMarketplaceImageReference(t *testing.T) {
+	imageID := BuildImageIDMarketplace("00000000-0000-0000-0000-000000000000", "westus", "Canonical", "ubuntu-24_04-lts", "server", "24.04.202410090")
+	ref, ok := MarketplaceImageReference(imageID)
+	assert.True(t, ok)
+	assert.Equal(t, &armcompute.ImageReference{
+		Publisher: lo.ToPtr("Canonical"),
+		Offer:     lo.ToPtr("ubuntu-24_04-lts"),
+		SKU:       lo.ToPtr("server"),
+		Version:   lo.ToPtr("24.04.202410090"),
+	}, ref)
+
+	for _, imageID := range []string{
+		BuildImageIDSIG("00000000-0000-0000-0000-000000000000", "images", "gallery", "ubuntu", "1.0.0"),
+		BuildImageIDCIG("AKSUbuntu-38d80f77-467a-481f-a8d4-09b6d4220bd2", "2204gen2containerd", "202410.09.0"),
+	} {
+		_, ok := MarketplaceImageReference(imageID)
+		assert.False(t, ok, imageID)
+	}
+}
@@ -22,16 +22,22 @@ import (
 	"github.com/Azure/azure-sdk-for-go/sdk/azidentity"
 	v1 "k8s.io/api/core/v1"
 	karpv1 "sigs.k8s.io/karpenter/pkg/apis/v1"
+	"sort"
 	"strings"
 	"time"
 
+	sdkerrors "github.com/Azure/azure-sdk-for-go-extensions/pkg/errors"
 	"github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/compute/armcompute/v7"
 	"github.com/Azure/karpenter-provider-azure/pkg/apis/v1beta1"
+	"github.com/Azure/karpenter-provider-azure/pkg/metrics"
 	"github.com/Azure/karpenter-provider-azure/pkg/operator/options"
 	types "github.com/Azure/karpenter-provider-azure/pkg/providers/imagefamily/types"
+	"github.com/blang/semver/v4"
 	"github.com/mitchellh/hashstructure/v2"
 	"github.com/patrickmn/go-cache"
 	"github.com/samber/lo"
+	"golang.org/x/sync/singleflight"
+	"k8s.io/utils/clock"
 	"sigs.k8s.io/controller-runtime/pkg/log"
 	"sigs.k8s.io/karpenter/pkg/scheduling"
 	"sigs.k8s.io/karpenter/pkg/utils/pretty"
@@ -43,15 +49,75 @@ const (
 
 	sharedImageGalleryImageIDFormat = "/subscriptions/%s/resourceGroups/%s/providers/Microsoft.Compute/galleries/%s/images/%s/versions/%s"
 	communityImageIDFormat          = "/CommunityGalleries/%s/images/%s/versions/%s"
+
+	customGalleryClientFactoryTTL = time.Hour
+
+	// nodeImageVersionsCacheKey is the cache key of the node image versions listed by the NodeImageVersions API, which are
+	// the same for every image definition
+	nodeImageVersionsCacheKey = "node-image-versions"
 )
 
 type NodeImage struct {
 	ID           string
 	Requirements scheduling.Requirements
+	// Channel is the image channel the selected image version came from
+	Channel v1beta1.ImageChannel
+	// Pinned is whether the image version is the version pinned by the imageVersion or imageID of the AKSNodeClass
+	Pinned bool
+	// Distro is the distro of the default image the image is a version of, empty for other images
+	Distro string
+	// PublishedDate is when the image version was published, if the image source reports it
+	PublishedDate *time.Time
+	// GalleryLocation is the community gallery fallback location the image version was listed in, empty for the
+	// location of the cluster
+	GalleryLocation string
+	// Fallback is whether the image version was listed from the community galleries once its lookup through SIG failed,
+	// see listCIGFallback
+	Fallback bool
+}
+
+// ImageVersionNotFoundError is returned when the image version pinned by the imageVersion of the AKSNodeClass doesn't
+// exist for one of the images of its image family
+type ImageVersionNotFoundError struct {
+	ImageVersion    string
+	ImageDefinition string
+}
+
+func (e *ImageVersionNotFoundError) Error() string {
+	return fmt.Sprintf("image version %s not found for image %s", e.ImageVersion, e.ImageDefinition)
+}
+
+// ImageVersionsNotFoundError is returned when the gallery image definition of a custom image term has no versions yet,
+// e.g. while the first version of a newly created definition is still being built
+type ImageVersionsNotFoundError struct {
+	Gallery         string
+	ImageDefinition string
+}
+
+func (e *ImageVersionsNotFoundError) Error() string {
+	return fmt.Sprintf("no versions found for image %s of gallery %s", e.ImageDefinition, e.Gallery)
+}
+
+// ImageIncompatibleError is returned when the gallery image definition of a custom image term can't boot as a node of
+// it, e.g. a specialized image or a Windows image. Its versions would all fail to launch, so it's surfaced once on the
+// AKSNodeClass rather than on every NodeClaim.
+type ImageIncompatibleError struct {
+	ImageDefinition string
+	Incompatibility string
+}
+
+func (e *ImageIncompatibleError) Error() string {
+	return fmt.Sprintf("custom image %s %s", e.ImageDefinition, e.Incompatibility)
 }
 
 type NodeImageProvider interface {
 	List(ctx context.Context, nodeClass *v1beta1.AKSNodeClass) ([]NodeImage, error)
+	// Probe checks that the image source of the AKSNodeClass is accessible, bypassing any cached images
+	Probe(ctx context.Context, nodeClass *v1beta1.AKSNodeClass) error
+	// Evict removes the cached images of the AKSNodeClass, so that they are listed from the image source again
+	Evict(ctx context.Context, nodeClass *v1beta1.AKSNodeClass) error
+	// KubernetesVersionRange returns the Kubernetes versions the image of the AKSNodeClass supports
+	KubernetesVersionRange(ctx context.Context, nodeClass *v1beta1.AKSNodeClass, imageID string) (KubernetesVersionRange, error)
 }
 
 type provider struct {
@@ -60,9 +126,25 @@ type provider struct {
 
 	imageVersionsClient types.CommunityGalleryImageVersionsAPI
 	nodeImageVersions   types.NodeImageVersionsAPI
+	// nodeImageVersionsGroup lists the node image versions once for the concurrent lookups missing them in the cache
+	nodeImageVersionsGroup singleflight.Group
 
 	nodeImagesCache *cache.Cache
-	cm              *pretty.ChangeMonitor
+	// failedLookups are the failed lookups of the default images of the image families, by the cache key of the images
+	failedLookups *failedLookups
+	cm            *pretty.ChangeMonitor
+
+	// newCustomGalleryClientFactory returns the clients of the gallery of custom images in the subscription, with a
+	// credential of the tenant, if any, which also query the marketplace images in the subscription of the cluster.
+	// Failing to, e.g. for lack of a credential, fails the listing of the images, which is retried on the next reconcile.
+	newCustomGalleryClientFactory func(subscriptionID, tenantID string) (*armcompute.ClientFactory, error)
+	// customGalleryClientFactories are the clients of the galleries of custom images by subscription and tenant, so that their
+	// credential isn't obtained again for every listing and launch. They expire, so that a rotated credential is picked up.
+	customGalleryClientFactories      *cache.Cache
+	customGalleryClientFactoriesGroup singleflight.Group
+
+	// workQueue issues the listings and probes of the images by priority, see workQueue
+	workQueue *workQueue
 }
 
 func NewProvider(versionsClient types.CommunityGalleryImageVersionsAPI, location, subscription string, nodeImageVersionsClient types.NodeImageVersionsAPI, nodeImagesCache *cache.Cache) *provider {
@@ -72,12 +154,35 @@ func NewProvider(versionsClient types.CommunityGalleryImageVersionsAPI, location
 		imageVersionsClient: versionsClient,
 		nodeImageVersions:   nodeImageVersionsClient,
 		nodeImagesCache:     nodeImagesCache,
+		failedLookups:       newFailedLookups(nodeImagesCache, clock.RealClock{}),
 		cm:                  pretty.NewChangeMonitor(),
+
+		newCustomGalleryClientFactory: newCustomGalleryClientFactory,
+		customGalleryClientFactories:  cache.New(customGalleryClientFactoryTTL, ImageCacheCleaningInterval),
+		workQueue:                     newWorkQueue(imageWorkQueueConcurrency),
 	}
 }
 
+// WithCustomGalleryClientFactory creates the clients of the galleries of custom images with newClientFactory, rather than
+// with a default credential of the tenant of the gallery, e.g. with fakes in tests
+func (p *provider) WithCustomGalleryClientFactory(newClientFactory func(subscriptionID, tenantID string) (*armcompute.ClientFactory, error)) *provider {
+	p.newCustomGalleryClientFactory = newClientFactory
+	return p
+}
+
 // Returns the list of available NodeImages for the given AKSNodeClass sorted in priority ordering
 func (p *provider) List(ctx context.Context, nodeClass *v1beta1.AKSNodeClass) ([]NodeImage, error) {
+	// the image of the imageID is launched as is, without looking it up
+	if imageID := lo.FromPtr(nodeClass.Spec.ImageID); imageID != "" {
+		return []NodeImage{{ID: imageID, Pinned: true}}, nil
+	}
+	start := time.Now()
+	nodeImages, err := p.list(ctx, nodeClass)
+	recordResolution(ctx, resolutionPath(ctx, nodeClass, nodeImages), start, err)
+	return nodeImages, err
+}
+
+func (p *provider) list(ctx context.Context, nodeClass *v1beta1.AKSNodeClass) ([]NodeImage, error) {
 	// TODO: refactor to be part of construction, since this is a karpenter setting and won't change across the process.
 	useSIG := options.FromContext(ctx).UseSIG
 
@@ -92,11 +197,17 @@ func (p *provider) List(ctx context.Context, nodeClass *v1beta1.AKSNodeClass) ([
 		return []NodeImage{}, err
 	}
 
-	supportedImages := getSupportedImages(nodeClass.Spec.ImageFamily, nodeClass.Spec.FIPSMode, kubernetesVersion, useSIG)
+	supportedImages := getSupportedImages(nodeClass, kubernetesVersion, useSIG)
+	channel := nodeClass.GetImageChannel()
+	pinnedVersion := lo.FromPtr(nodeClass.Spec.ImageVersion)
+	versionConstraint := lo.FromPtr(nodeClass.Spec.ImageVersionConstraint)
 
 	key, err := p.cacheKey(
 		supportedImages,
 		kubernetesVersion,
+		channel,
+		pinnedVersion,
+		versionConstraint,
 	)
 	if err != nil {
 		return []NodeImage{}, err
@@ -107,28 +218,219 @@ func (p *provider) List(ctx context.Context, nodeClass *v1beta1.AKSNodeClass) ([
 	//}
 
 	var nodeImages []NodeImage
-	if *nodeClass.Spec.ImageFamily == "Custom" {
-		nodeImages, err = p.listTTIG(ctx, nodeClass)
+	// the listings are queued in the image work queue, with the priority of the context
+	if nodeClass.Spec.MarketplaceImage != nil {
+		nodeImages, err = p.queueList(ctx, marketplaceImageCacheKey(nodeClass.Spec.MarketplaceImage), func(ctx context.Context) ([]NodeImage, error) {
+			return p.listMarketplaceImage(ctx, nodeClass)
+		})
+		if err != nil {
+			return []NodeImage{}, err
+		}
+	} else if *nodeClass.Spec.ImageFamily == "Custom" {
+		ttigKeys := lo.Map(CustomImageTerms(ctx, nodeClass), func(imageTerm v1beta1.CustomImageTerm, _ int) string {
+			return ttigCacheKey(nodeClass, imageTerm)
+		})
+		nodeImages, err = p.queueList(ctx, strings.Join(ttigKeys, ","), func(ctx context.Context) ([]NodeImage, error) {
+			return p.listTTIG(ctx, nodeClass)
+		})
+		if err != nil {
+			return []NodeImage{}, err
+		}
 	} else if useSIG {
 		log.FromContext(ctx).V(1).Info("using SIG to list node images")
-		nodeImages, err = p.listSIG(ctx, supportedImages)
+		nodeImages, err = p.failedLookups.lookup(ctx, key, func() ([]NodeImage, error) {
+			return p.queueList(ctx, key, func(ctx context.Context) ([]NodeImage, error) {
+				return p.listSIG(ctx, supportedImages, channel, pinnedVersion, versionConstraint)
+			})
+		})
+		// a canceled lookup isn't a failure of SIG to fall back from
+		if err != nil && !isCanceled(ctx, err) && options.FromContext(ctx).SIGFallbackToCIG {
+			nodeImages, err = p.listCIGFallback(ctx, nodeClass, kubernetesVersion, channel, pinnedVersion, versionConstraint, err)
+		}
 		if err != nil {
 			return []NodeImage{}, err
 		}
 	} else {
-		nodeImages, err = p.listCIG(ctx, supportedImages)
+		nodeImages, err = p.failedLookups.lookup(ctx, key, func() ([]NodeImage, error) {
+			return p.queueList(ctx, key, func(ctx context.Context) ([]NodeImage, error) {
+				return p.listCIG(ctx, supportedImages, channel, pinnedVersion, versionConstraint)
+			})
+		})
 		if err != nil {
 			return []NodeImage{}, err
 		}
 	}
-	p.nodeImagesCache.Set(key, nodeImages, cache.DefaultExpiration)
+	p.nodeImagesCache.Set(imagesCacheKey(key, nodeImages), nodeImages, cache.DefaultExpiration)
 
 	return nodeImages, nil
 }
 
-func (p *provider) listSIG(ctx context.Context, supportedImages []types.DefaultImageOutput) ([]NodeImage, error) {
+// Evict removes the cached images of the AKSNodeClass, e.g. once the version of one of them turned out to be deleted. The
+// keys of its images are derived from its spec as when they're listed, see cacheKey, ttigCacheKey and
+// marketplaceImageCacheKey, so that only its images are evicted, along with those of the AKSNodeClasses selecting the same
+// images. The definitions of custom images are kept, as they don't change once created. The cached node image versions are
+// evicted along with the default images, as they're listed again otherwise.
+func (p *provider) Evict(ctx context.Context, nodeClass *v1beta1.AKSNodeClass) error {
+	if lo.FromPtr(nodeClass.Spec.ImageID) != "" {
+		return nil
+	}
+	if imageTerm := nodeClass.Spec.MarketplaceImage; imageTerm != nil {
+		p.nodeImagesCache.Delete(marketplaceImageCacheKey(imageTerm))
+		return nil
+	}
+	if *nodeClass.Spec.ImageFamily == "Custom" {
+		for _, imageTerm := range CustomImageTerms(ctx, nodeClass) {
+			p.nodeImagesCache.Delete(ttigCacheKey(nodeClass, imageTerm))
+		}
+		return nil
+	}
+	kubernetesVersion, err := nodeClass.GetKubernetesVersion()
+	if err != nil {
+		return err
+	}
+	useSIG := options.FromContext(ctx).UseSIG
+	key, err := p.cacheKey(
+		getSupportedImages(nodeClass, kubernetesVersion, useSIG),
+		kubernetesVersion,
+		nodeClass.GetImageChannel(),
+		lo.FromPtr(nodeClass.Spec.ImageVersion),
+		lo.FromPtr(nodeClass.Spec.ImageVersionConstraint),
+	)
+	if err != nil {
+		return err
+	}
+	p.nodeImagesCache.Delete(key)
+	p.nodeImagesCache.Delete(nodeImageVersionsCacheKey)
+	p.failedLookups.evict(key)
+	return nil
+}
+
+// Probe makes a single uncached request to the image source of the AKSNodeClass: a listing of the SIG node image versions,
+// the first page of a community gallery image's versions, a GET of each custom or shared gallery image, or a listing of a version of
+// the marketplace image. Lost access to the source, e.g. through revoked RBAC, would otherwise go unnoticed while the
+// images are cached, and only fail VM creation.
+// The image of the imageID isn't probed, as it isn't looked up either. Probes are queued in the image work queue, with the
+// probe priority unless the context has another.
+func (p *provider) Probe(ctx context.Context, nodeClass *v1beta1.AKSNodeClass) error {
+	if lo.FromPtr(nodeClass.Spec.ImageID) != "" {
+		return nil
+	}
+	key, err := probeKey(nodeClass)
+	if err != nil {
+		return err
+	}
+	_, err = p.workQueue.do(ctx, key, priorityFromContext(ctx, PriorityProbe), func(ctx context.Context) (any, error) {
+		return nil, p.probe(ctx, nodeClass)
+	})
+	return err
+}
+
+// probeKey returns the key of the probe of the image source of the AKSNodeClass in the image work queue, a hash of the
+// parts of its spec and status the probe depends on
+func probeKey(nodeClass *v1beta1.AKSNodeClass) (string, error) {
+	hash, err := hashstructure.Hash([]interface{}{
+		nodeClass.Spec.ImageFamily,
+		nodeClass.Spec.FIPSMode,
+		nodeClass.Spec.MarketplaceImage,
+		nodeClass.CustomImageTerms(),
+		nodeClass.Status.KubernetesVersion,
+	}, hashstructure.FormatV2, nil)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("probe-%016x", hash), nil
+}
+
+func (p *provider) probe(ctx context.Context, nodeClass *v1beta1.AKSNodeClass) error {
+	if imageTerm := nodeClass.Spec.MarketplaceImage; imageTerm != nil {
+		clientFactory, err := p.customGalleryClientFactory(p.subscription, "")
+		if err != nil {
+			return err
+		}
+		_, err = clientFactory.NewVirtualMachineImagesClient().List(ctx, p.location, imageTerm.Publisher, imageTerm.Offer, imageTerm.SKU,
+			&armcompute.VirtualMachineImagesClientListOptions{Top: lo.ToPtr[int32](1)})
+		return err
+	}
+	useSIG := options.FromContext(ctx).UseSIG
+	if *nodeClass.Spec.ImageFamily == "Custom" {
+		for _, imageTerm := range CustomImageTerms(ctx, nodeClass) {
+			clientFactory, err := p.customImageClientFactory(imageTerm)
+			if err != nil {
+				return err
+			}
+			if imageTerm.SharedGalleryUniqueName != "" {
+				_, err = clientFactory.NewSharedGalleryImagesClient().Get(ctx, p.location, imageTerm.SharedGalleryUniqueName, imageTerm.Name, nil)
+			} else {
+				_, err = clientFactory.NewGalleryImagesClient().Get(ctx, imageTerm.GalleryResourceGroupName, imageTerm.GalleryName, imageTerm.Name, nil)
+			}
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	if useSIG {
+		_, err := p.nodeImageVersions.List(ctx, p.location, p.subscription)
+		return err
+	}
+
+	// the community gallery images depend on the kubernetes version, which List reports as missing
+	kubernetesVersion, err := nodeClass.GetKubernetesVersion()
+	if err != nil {
+		return nil
+	}
+	supportedImages := getSupportedImages(nodeClass, kubernetesVersion, useSIG)
+	if len(supportedImages) == 0 {
+		return nil
+	}
+	pager := p.imageVersionsClient.NewListPager(p.location, supportedImages[0].PublicGalleryURL, supportedImages[0].ImageDefinition, nil)
+	if pager.More() {
+		_, err = pager.NextPage(ctx)
+	}
+	return err
+}
+
+// listCIGFallback returns the default images of the AKSNodeClass from the community galleries once their lookup through
+// SIG failed with sigErr, so that e.g. an outage of the node image versions service doesn't block scale-up. The community
+// gallery images are cached, and their lookup failures backed off, apart from those through SIG, which are retried as
+// usual. FIPS images have no community gallery images, so that sigErr is returned for them. The images are marked as
+// Fallback, so that they don't replace the images the AKSNodeClass already has.
+func (p *provider) listCIGFallback(ctx context.Context, nodeClass *v1beta1.AKSNodeClass, kubernetesVersion string, channel v1beta1.ImageChannel, pinnedVersion, versionConstraint string, sigErr error) ([]NodeImage, error) {
+	if lo.FromPtr(nodeClass.Spec.FIPSMode) == v1beta1.FIPSModeFIPS {
+		return nil, sigErr
+	}
+	supportedImages := getSupportedImages(nodeClass, kubernetesVersion, false)
+	key, err := p.cacheKey(supportedImages, kubernetesVersion, channel, pinnedVersion, versionConstraint)
+	if err != nil {
+		return nil, err
+	}
+	log.FromContext(ctx).Info("failed to list the node images through SIG, falling back to the community galleries",
+		"imageFamily", lo.FromPtr(nodeClass.Spec.ImageFamily), "error", sigErr)
+	metrics.ImageSIGFallbacks.WithLabelValues(lo.FromPtr(nodeClass.Spec.ImageFamily)).Inc()
+	nodeImages, err := p.failedLookups.lookup(ctx, key, func() ([]NodeImage, error) {
+		return p.queueList(ctx, key, func(ctx context.Context) ([]NodeImage, error) {
+			return p.listCIG(ctx, supportedImages, channel, pinnedVersion, versionConstraint)
+		})
+	})
+	if err != nil {
+		return nil, fmt.Errorf("%w, falling back to the community galleries, %w", sigErr, err)
+	}
+	return lo.Map(nodeImages, func(nodeImage NodeImage, _ int) NodeImage {
+		nodeImage.Fallback = true
+		return nodeImage
+	}), nil
+}
+
+// listSIG returns the images of the supported images: their pinned version, if any, or else their latest version eligible
+// for the image channel and satisfying the version constraint. A pinned version that isn't listed for one of the images,
+// or a version constraint none of its versions satisfies, fails the listing.
+func (p *provider) listSIG(ctx context.Context, supportedImages []types.DefaultImageOutput, channel v1beta1.ImageChannel, pinnedVersion, versionConstraint string) ([]NodeImage, error) {
 	nodeImages := []NodeImage{}
-	retrievedLatestImages, err := p.nodeImageVersions.List(ctx, p.location, p.subscription)
+	versionRange, err := parseImageVersionConstraint(versionConstraint)
+	if err != nil {
+		return nil, err
+	}
+	retrievedLatestImages, err := p.listNodeImageVersions(ctx)
 	if err != nil {
 		return nil, err
 	}
@@ -136,47 +438,156 @@ func (p *provider) listSIG(ctx context.Context, supportedImages []types.DefaultI
 	for _, supportedImage := range supportedImages {
 		var nextImage *types.NodeImageVersion
 		for _, retrievedLatestImage := range retrievedLatestImages.Values {
-			if supportedImage.ImageDefinition == retrievedLatestImage.SKU {
+			if supportedImage.ImageDefinition != retrievedLatestImage.SKU {
+				continue
+			}
+			if pinnedVersion != "" {
+				if retrievedLatestImage.Version == pinnedVersion {
+					nextImage = &retrievedLatestImage
+					break
+				}
+				continue
+			}
+			if !isEligibleImageVersion(channel, isPreviewImageVersion(retrievedLatestImage.Version, nil)) ||
+				!satisfiesImageVersionConstraint(versionRange, retrievedLatestImage.Version) {
+				continue
+			}
+			if nextImage == nil || isNewerVersion(retrievedLatestImage.Version, nextImage.Version) {
 				nextImage = &retrievedLatestImage
-				break
 			}
 		}
 		if nextImage == nil {
+			if pinnedVersion != "" {
+				return nil, &ImageVersionNotFoundError{ImageVersion: pinnedVersion, ImageDefinition: supportedImage.ImageDefinition}
+			}
+			if versionRange != nil {
+				return nil, &ImageVersionConstraintError{Constraint: versionConstraint, ImageDefinition: supportedImage.ImageDefinition}
+			}
 			// Unable to find given image version
 			continue
 		}
 		imageID := BuildImageIDSIG(options.FromContext(ctx).SIGSubscriptionID, supportedImage.GalleryResourceGroup, supportedImage.GalleryName, supportedImage.ImageDefinition, nextImage.Version)
+		p.logDiscoveredImage(ctx, imageID, channel, pinnedVersion != "")
 
 		nodeImages = append(nodeImages, NodeImage{
 			ID:           imageID,
 			Requirements: supportedImage.Requirements,
+			Channel:      imageVersionChannel(isPreviewImageVersion(nextImage.Version, nil)),
+			Pinned:       pinnedVersion != "",
+			Distro:       supportedImage.Distro,
 		})
 	}
 	return nodeImages, nil
 }
 
-func (p *provider) listCIG(_ context.Context, supportedImages []types.DefaultImageOutput) ([]NodeImage, error) {
-	nodeImages := []NodeImage{}
-	for _, supportedImage := range supportedImages {
-		cigImageID, err := p.getCIGImageID(supportedImage.PublicGalleryURL, supportedImage.ImageDefinition)
+// listNodeImageVersions returns the node image versions of the location, cached for the node image versions TTL, so that
+// the images of all the image definitions, image families and AKSNodeClasses resolved meanwhile share a single listing
+func (p *provider) listNodeImageVersions(ctx context.Context) (types.NodeImageVersionsResponse, error) {
+	cached, ok := p.nodeImagesCache.Get(nodeImageVersionsCacheKey)
+	recordCacheLookup(resolutionPathSIG, ok)
+	if ok {
+		return cached.(types.NodeImageVersionsResponse), nil
+	}
+	// the listing is shared by the callers that join it, so it isn't canceled along with the context of the first
+	nodeImageVersions, err, _ := p.nodeImageVersionsGroup.Do(nodeImageVersionsCacheKey, func() (interface{}, error) {
+		nodeImageVersions, err := p.nodeImageVersions.List(context.WithoutCancel(ctx), p.location, p.subscription)
 		if err != nil {
 			return nil, err
 		}
+		if ttl := options.FromContext(ctx).CacheConfig.NodeImageVersionsTTL; ttl > 0 {
+			p.nodeImagesCache.Set(nodeImageVersionsCacheKey, nodeImageVersions, ttl)
+		}
+		return nodeImageVersions, nil
+	})
+	if err != nil {
+		return types.NodeImageVersionsResponse{}, err
+	}
+	return nodeImageVersions.(types.NodeImageVersionsResponse), nil
+}
+
+// listCIG returns the images of the supported images: their pinned version, if any, once it's found to exist, or else
+// their latest version eligible for the image channel and satisfying the version constraint
+func (p *provider) listCIG(ctx context.Context, supportedImages []types.DefaultImageOutput, channel v1beta1.ImageChannel, pinnedVersion, versionConstraint string) ([]NodeImage, error) {
+	nodeImages := []NodeImage{}
+	versionRange, err := parseImageVersionConstraint(versionConstraint)
+	if err != nil {
+		return nil, err
+	}
+	for _, supportedImage := range supportedImages {
+		imageVersion := pinnedVersion
+		var publishedDate *time.Time
+		var galleryLocation string
+		if pinnedVersion != "" {
+			resp, err := p.imageVersionsClient.Get(ctx, p.location, supportedImage.PublicGalleryURL, supportedImage.ImageDefinition, pinnedVersion, nil)
+			if err != nil {
+				if sdkerrors.IsNotFoundErr(err) {
+					return nil, &ImageVersionNotFoundError{ImageVersion: pinnedVersion, ImageDefinition: supportedImage.ImageDefinition}
+				}
+				return nil, err
+			}
+			publishedDate = communityImageVersionPublishedDate(&resp.CommunityGalleryImageVersion)
+		} else {
+			latest, location, err := p.latestNodeImageVersionCommunity(ctx, supportedImage.PublicGalleryURL, supportedImage.ImageDefinition, channel, versionRange)
+			if err != nil {
+				return nil, err
+			}
+			galleryLocation = lo.Ternary(location != p.location, location, "")
+			if latest == nil && versionRange != nil {
+				return nil, &ImageVersionConstraintError{Constraint: versionConstraint, ImageDefinition: supportedImage.ImageDefinition}
+			}
+			if latest != nil {
+				imageVersion = lo.FromPtr(latest.Name)
+				publishedDate = communityImageVersionPublishedDate(latest)
+			}
+		}
+		imageID := BuildImageIDCIG(supportedImage.PublicGalleryURL, supportedImage.ImageDefinition, imageVersion)
+		p.logDiscoveredImage(ctx, imageID, channel, pinnedVersion != "")
 
 		nodeImages = append(nodeImages, NodeImage{
-			ID:           cigImageID,
-			Requirements: supportedImage.Requirements,
+			ID:              imageID,
+			Requirements:    supportedImage.Requirements,
+			Channel:         imageVersionChannel(isPreviewImageVersion(imageVersion, nil)),
+			Pinned:          pinnedVersion != "",
+			Distro:          supportedImage.Distro,
+			PublishedDate:   publishedDate,
+			GalleryLocation: galleryLocation,
 		})
 	}
 	return nodeImages, nil
 }
 
-func (p *provider) cacheKey(supportedImages []types.DefaultImageOutput, k8sVersion string) (string, error) {
+// logDiscoveredImage logs the image discovered for an image definition when it changed: its latest version for the
+// image channel, or its pinned version. Images are discovered again whenever they expire from the cache, for every
+// nodeclass, which would otherwise log the same images over and over. The logs are at the debug level with the
+// demote-image-discovery-logs option.
+func (p *provider) logDiscoveredImage(ctx context.Context, imageID string, channel v1beta1.ImageChannel, pinned bool) {
+	key := imageID
+	if !pinned {
+		imageDefinitionID, _, _ := strings.Cut(imageID, "/versions/")
+		key = fmt.Sprintf("%s-%s", imageDefinitionID, channel)
+	}
+	if !p.cm.HasChanged("discovered-image-"+key, imageID) {
+		return
+	}
+	logger := log.FromContext(ctx)
+	if options.FromContext(ctx).DemoteImageDiscoveryLogs {
+		logger = logger.V(1)
+	}
+	logger.Info("discovered new image id", "image-id", imageID)
+}
+
+// cacheKey returns the cache key of the default images of the image family of an AKSNodeClass: a hash of the images
+// supported for its FIPS mode, SIG usage and kubernetes version, with its image channel, pinned version and version
+// constraint. AKSNodeClasses selecting the same images share the key.
+func (p *provider) cacheKey(supportedImages []types.DefaultImageOutput, k8sVersion string, channel v1beta1.ImageChannel, pinnedVersion, versionConstraint string) (string, error) {
 	// Note: the kubernetes version is part of the cache key here, because we bump images on kubernetes upgrade meaning
 	// we want to ensure if there is a kubernetes change we'll get fresh images if there are any.
 	hash, err := hashstructure.Hash([]interface{}{
 		supportedImages,
 		k8sVersion,
+		channel,
+		pinnedVersion,
+		versionConstraint,
 	}, hashstructure.FormatV2, &hashstructure.HashOptions{SlicesAsSets: true})
 	if err != nil {
 		return "", err
@@ -184,29 +595,82 @@ func (p *provider) cacheKey(supportedImages []types.DefaultImageOutput, k8sVersi
 	return fmt.Sprintf("%016x", hash), nil
 }
 
-func (p *provider) getCIGImageID(publicGalleryURL, communityImageName string) (string, error) {
-	imageVersion, err := p.latestNodeImageVersionCommunity(publicGalleryURL, communityImageName)
-	if err != nil {
-		return "", err
+// imagesCacheKey returns the cache key of the images listed for the cache key of their lookup, along with the community
+// gallery fallback locations any of them was listed in, so that images listed from the galleries of other locations are
+// told apart from those of the location of the cluster, which replace them once it catches up
+func imagesCacheKey(key string, nodeImages []NodeImage) string {
+	for _, location := range lo.Uniq(lo.FilterMap(nodeImages, func(nodeImage NodeImage, _ int) (string, bool) {
+		return nodeImage.GalleryLocation, nodeImage.GalleryLocation != ""
+	})) {
+		key = fmt.Sprintf("%s-%s", key, location)
 	}
-	return BuildImageIDCIG(publicGalleryURL, communityImageName, imageVersion), nil
+	return key
 }
 
-func (p *provider) latestNodeImageVersionCommunity(publicGalleryURL, communityImageName string) (string, error) {
-	pager := p.imageVersionsClient.NewListPager(p.location, publicGalleryURL, communityImageName, nil)
+// latestNodeImageVersionCommunity returns the most recently published version of the community image eligible for the
+// image channel and in the version range, if any, and the location whose community gallery listed it. The gallery of the
+// location of the cluster is listed first, and those of the community gallery fallback locations in order while it has
+// no such version, e.g. while a new image is still being replicated to a small region. The galleries of the fallback
+// locations failing to list are skipped, unless the context is canceled, as the version of a later location, or none, isn't
+// the latest then.
+func (p *provider) latestNodeImageVersionCommunity(ctx context.Context, publicGalleryURL, communityImageName string, channel v1beta1.ImageChannel, versionRange semver.Range) (*armcompute.CommunityGalleryImageVersion, string, error) {
+	latest, err := p.latestNodeImageVersionCommunityIn(ctx, p.location, publicGalleryURL, communityImageName, channel, versionRange)
+	if err != nil || latest != nil {
+		return latest, p.location, err
+	}
+	for _, location := range options.FromContext(ctx).GetCommunityGalleryFallbackLocations() {
+		if location == p.location {
+			continue
+		}
+		latest, err := p.latestNodeImageVersionCommunityIn(ctx, location, publicGalleryURL, communityImageName, channel, versionRange)
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			return nil, p.location, ctxErr
+		}
+		if err != nil {
+			log.FromContext(ctx).Error(err, "failed to list the community image versions of a fallback location", "image", communityImageName, "location", location)
+			continue
+		}
+		if latest != nil {
+			log.FromContext(ctx).Info("no community image version found in the location of the cluster, using the version of a fallback location",
+				"image", communityImageName, "version", lo.FromPtr(latest.Name), "location", location)
+			return latest, location, nil
+		}
+	}
+	return nil, p.location, nil
+}
+
+// latestNodeImageVersionCommunityIn returns the most recently published version of the community image in the gallery of
+// the location eligible for the image channel and in the version range, if any
+func (p *provider) latestNodeImageVersionCommunityIn(ctx context.Context, location, publicGalleryURL, communityImageName string, channel v1beta1.ImageChannel, versionRange semver.Range) (*armcompute.CommunityGalleryImageVersion, error) {
+	pager := p.imageVersionsClient.NewListPager(location, publicGalleryURL, communityImageName, nil)
 	topImageVersionCandidate := armcompute.CommunityGalleryImageVersion{}
 	for pager.More() {
-		page, err := pager.NextPage(context.Background())
+		page, err := pager.NextPage(ctx)
 		if err != nil {
-			return "", err
+			return nil, err
 		}
 		for _, imageVersion := range page.CommunityGalleryImageVersionList.Value {
+			if !isEligibleImageVersion(channel, isPreviewImageVersion(lo.FromPtr(imageVersion.Name), nil)) ||
+				!satisfiesImageVersionConstraint(versionRange, lo.FromPtr(imageVersion.Name)) {
+				continue
+			}
 			if lo.IsEmpty(topImageVersionCandidate) || imageVersion.Properties.PublishedDate.After(*topImageVersionCandidate.Properties.PublishedDate) {
 				topImageVersionCandidate = *imageVersion
 			}
 		}
 	}
-	return lo.FromPtr(topImageVersionCandidate.Name), nil
+	if lo.IsEmpty(topImageVersionCandidate) {
+		return nil, nil
+	}
+	return &topImageVersionCandidate, nil
+}
+
+// communityImageVersionPublishedDate returns when the community image version was published, if reported
+func communityImageVersionPublishedDate(imageVersion *armcompute.CommunityGalleryImageVersion) *time.Time {
+	if imageVersion.Properties == nil {
+		return nil
+	}
+	return imageVersion.Properties.PublishedDate
 }
 
 // BuildImageIDCIG builds a Community Image Gallery image ID
@@ -219,68 +683,374 @@ func BuildImageIDSIG(subscriptionID, resourceGroup, galleryName, imageDefinition
 	return fmt.Sprintf(sharedImageGalleryImageIDFormat, subscriptionID, resourceGroup, galleryName, imageDefinition, imageVersion)
 }
 
+// ttigCacheKey returns the cache key of the image of a custom image term: the ID of its image definition, with its pinned
+// version, or else with the image channel of the AKSNodeClass, its version constraint and its version tag selector, and
+// with its architecture and Hyper-V generation overrides, if any
+func ttigCacheKey(nodeClass *v1beta1.AKSNodeClass, imageTerm v1beta1.CustomImageTerm) string {
+	// an explicitly pinned version is used regardless of the channel
+	key := customImageID(imageTerm, imageTerm.Version)
+	if imageTerm.Version == "" {
+		key = fmt.Sprintf("%s-%s", key, nodeClass.GetImageChannel())
+		if imageTerm.VersionConstraint != "" {
+			key = fmt.Sprintf("%s-%s", key, imageTerm.VersionConstraint)
+		}
+		if len(imageTerm.VersionTagSelector) > 0 {
+			key = fmt.Sprintf("%s-%s", key, formatVersionTagSelector(imageTerm.VersionTagSelector))
+		}
+	}
+	// the requirements of the cached images depend on the overrides
+	if imageTerm.Architecture != "" || imageTerm.HyperVGeneration != "" {
+		key = fmt.Sprintf("%s-%s-%s", key, imageTerm.Architecture, imageTerm.HyperVGeneration)
+	}
+	return key
+}
+
+// listTTIG returns the images of the custom image terms of the AKSNodeClass, in the order of the terms, so that each
+// instance type launches with the image of the first term it's compatible with
 func (p *provider) listTTIG(ctx context.Context, nodeClass *v1beta1.AKSNodeClass) ([]NodeImage, error) {
+	if len(nodeClass.CustomImageTerms()) == 0 {
+		return nil, fmt.Errorf("custom image family requires specifying .spec.customImageTerms")
+	}
 	nodeImages := []NodeImage{}
-	imageTerm := nodeClass.Spec.CustomImageTerm
+	for _, imageTerm := range CustomImageTerms(ctx, nodeClass) {
+		termImages, err := p.listCustomImage(ctx, nodeClass, imageTerm)
+		if err != nil {
+			return nil, err
+		}
+		nodeImages = append(nodeImages, termImages...)
+	}
+	return nodeImages, nil
+}
 
-	key := BuildImageIDSIG(imageTerm.GallerySubscriptionID, imageTerm.GalleryResourceGroupName, imageTerm.GalleryName, imageTerm.Name, imageTerm.Version)
-	log.FromContext(ctx).WithValues("cache key", key).Info("CustomImage: retrieved cache key for TTIG image")
-	if cachedImage, found := p.nodeImagesCache.Get(key); found {
+// listCustomImage returns the image of the custom image term: its pinned version, or else its latest version eligible
+// for the image channel of the AKSNodeClass
+func (p *provider) listCustomImage(ctx context.Context, nodeClass *v1beta1.AKSNodeClass, imageTerm v1beta1.CustomImageTerm) ([]NodeImage, error) {
+	nodeImages := []NodeImage{}
+	channel := nodeClass.GetImageChannel()
+
+	key := ttigCacheKey(nodeClass, imageTerm)
+	log.FromContext(ctx).WithValues("cache key", key).V(1).Info("CustomImage: retrieved cache key for TTIG image")
+	cachedImage, found := p.nodeImagesCache.Get(key)
+	recordCacheLookup(resolutionPathCustom, found)
+	if found {
 		return cachedImage.([]NodeImage), nil
 	}
 
-	cred, err := azidentity.NewDefaultAzureCredential(nil)
-
+	clientFactory, err := p.customImageClientFactory(imageTerm)
 	if err != nil {
-		log.FromContext(ctx).Error(err, "failed to obtain a credential:")
+		return nil, err
 	}
-	clientFactory, err := armcompute.NewClientFactory(imageTerm.GallerySubscriptionID, cred, nil)
-
+	imageDefinition, err := p.getCustomImageDefinition(ctx, clientFactory, imageTerm)
 	if err != nil {
-		log.FromContext(ctx).Error(err, "failed to create client:")
+		return nil, err
+	}
+	if err := validateCustomImageDefinition(imageDefinition, imageTerm); err != nil {
+		return nil, err
 	}
 	imageCandidate := armcompute.GalleryImageVersion{}
 
-	if imageTerm.Version != "" {
+	if imageTerm.SharedGalleryUniqueName != "" {
+		sharedImageVersion, err := p.getSharedGalleryImageVersion(ctx, clientFactory, imageTerm, channel)
+		if err != nil {
+			return nil, err
+		}
+		imageCandidate = *sharedImageVersion
+	} else if imageTerm.Version != "" {
 		imageInfo, err := clientFactory.NewGalleryImageVersionsClient().Get(ctx, imageTerm.GalleryResourceGroupName, imageTerm.GalleryName, imageTerm.Name, imageTerm.Version, nil)
 		if err != nil {
 			return nil, err
 		}
 		imageCandidate = imageInfo.GalleryImageVersion
 	} else {
-		pager := clientFactory.NewGalleryImageVersionsClient().NewListByGalleryImagePager(imageTerm.GalleryResourceGroupName, imageTerm.GalleryName, imageTerm.Name, nil)
-		for pager.More() {
-			page, err := pager.NextPage(context.Background())
-			if err != nil {
-				return nil, err
-			}
-			for _, imageVersion := range page.GalleryImageVersionList.Value {
-				if lo.IsEmpty(imageCandidate.ID) || imageVersion.Properties.PublishingProfile.PublishedDate.After(*imageCandidate.Properties.PublishingProfile.PublishedDate) {
-					imageCandidate = *imageVersion
-				}
-			}
+		latest, err := p.latestCustomImageVersion(ctx, clientFactory, imageTerm, channel)
+		if err != nil {
+			return nil, err
 		}
+		imageCandidate = *latest
 	}
 
-	imageID := lo.FromPtr(imageCandidate.ID)
-	if p.cm.HasChanged(key, imageID) {
-		log.FromContext(ctx).WithValues("image-id", imageID).Info("discovered new image id")
-	}
-	imageArch := karpv1.ArchitectureAmd64
-
-	if strings.Contains(imageTerm.DistroName, "arm64") {
-		imageArch = karpv1.ArchitectureArm64
+	if lo.FromPtr(imageCandidate.ID) == "" {
+		return nil, &ImageVersionsNotFoundError{Gallery: customImageGallery(imageTerm), ImageDefinition: imageTerm.Name}
 	}
+	imageID := *imageCandidate.ID
+	p.logDiscoveredImage(ctx, imageID, channel, imageTerm.Version != "")
 	nodeImage := NodeImage{
-		ID: imageID,
-		Requirements: scheduling.NewRequirements(
-			scheduling.NewRequirement(v1.LabelArchStable, v1.NodeSelectorOpIn, imageArch),
-			scheduling.NewRequirement(v1beta1.LabelSKUHyperVGeneration, v1.NodeSelectorOpIn, v1beta1.HyperVGenerationV2),
-		),
+		ID:            imageID,
+		Requirements:  customImageRequirements(imageDefinition, imageTerm),
+		Channel:       imageVersionChannel(isPreviewImageVersion(lo.FromPtr(imageCandidate.Name), imageCandidate.Tags)),
+		PublishedDate: customImageVersionPublishedDate(&imageCandidate),
 	}
 	nodeImages = append(nodeImages, nodeImage)
 
-	p.nodeImagesCache.Set(key, nodeImages, ImageExpirationInterval)
+	p.nodeImagesCache.SetDefault(key, nodeImages)
 	return nodeImages, nil
+}
+
+// latestCustomImageVersion returns the newest version of the custom image term that may be its latest version: satisfying
+// its version constraint, with the tags of its version tag selector, of the image channel, not excluded from latest, and replicated to the region. Versions being
+// published are excluded from latest, or not replicated to the region yet, and VMs can't be created from them in the region.
+func (p *provider) latestCustomImageVersion(ctx context.Context, clientFactory *armcompute.ClientFactory, imageTerm v1beta1.CustomImageTerm, channel v1beta1.ImageChannel) (*armcompute.GalleryImageVersion, error) {
+	versionRange, err := parseImageVersionConstraint(imageTerm.VersionConstraint)
+	if err != nil {
+		return nil, err
+	}
+	versionsClient := clientFactory.NewGalleryImageVersionsClient()
+	var imageVersions []*armcompute.GalleryImageVersion
+	pager := versionsClient.NewListByGalleryImagePager(imageTerm.GalleryResourceGroupName, imageTerm.GalleryName, imageTerm.Name, nil)
+	for pager.More() {
+		page, err := pager.NextPage(ctx)
+		if err != nil {
+			return nil, err
+		}
+		imageVersions = append(imageVersions, page.GalleryImageVersionList.Value...)
+	}
+	if len(imageVersions) == 0 {
+		return nil, &ImageVersionsNotFoundError{Gallery: imageTerm.GalleryName, ImageDefinition: imageTerm.Name}
+	}
+	if versionRange != nil {
+		imageVersions = lo.Filter(imageVersions, func(imageVersion *armcompute.GalleryImageVersion, _ int) bool {
+			return satisfiesImageVersionConstraint(versionRange, lo.FromPtr(imageVersion.Name))
+		})
+		if len(imageVersions) == 0 {
+			return nil, &ImageVersionConstraintError{Constraint: imageTerm.VersionConstraint, ImageDefinition: imageTerm.Name}
+		}
+	}
+	if len(imageTerm.VersionTagSelector) > 0 {
+		imageVersions = lo.Filter(imageVersions, func(imageVersion *armcompute.GalleryImageVersion, _ int) bool {
+			return matchesVersionTagSelector(imageTerm.VersionTagSelector, imageVersion.Tags)
+		})
+		if len(imageVersions) == 0 {
+			return nil, &ImageVersionTagSelectorError{Selector: imageTerm.VersionTagSelector, ImageDefinition: imageTerm.Name}
+		}
+	}
+	candidates := latestCustomImageVersionCandidates(imageVersions, channel, p.location)
+	// the replication status is only returned by GETs of the versions, so the candidates are checked newest first
+	for _, candidate := range candidates {
+		resp, err := versionsClient.Get(ctx, imageTerm.GalleryResourceGroupName, imageTerm.GalleryName, imageTerm.Name, lo.FromPtr(candidate.Name),
+			&armcompute.GalleryImageVersionsClientGetOptions{Expand: lo.ToPtr(armcompute.ReplicationStatusTypesReplicationStatus)})
+		if err != nil {
+			return nil, err
+		}
+		if isReplicatedTo(&resp.GalleryImageVersion, p.location) {
+			return &resp.GalleryImageVersion, nil
+		}
+		log.FromContext(ctx).V(1).Info("skipping custom image version not replicated to the region yet", "image-id", lo.FromPtr(candidate.ID), "region", p.location)
+	}
+	return nil, fmt.Errorf("custom image %s has none of its %d versions of the %s image channel replicated to %s, and not excluded from latest",
+		imageTerm.Name, len(imageVersions), channel, p.location)
+}
 
+// customImageVersionPublishedDate returns when the custom image version was published, if reported
+func customImageVersionPublishedDate(imageVersion *armcompute.GalleryImageVersion) *time.Time {
+	if imageVersion.Properties == nil || imageVersion.Properties.PublishingProfile == nil {
+		return nil
+	}
+	return imageVersion.Properties.PublishingProfile.PublishedDate
+}
+
+// latestCustomImageVersionCandidates returns the image versions of the channel, not excluded from latest, and
+// targeting the region, newest first
+func latestCustomImageVersionCandidates(imageVersions []*armcompute.GalleryImageVersion, channel v1beta1.ImageChannel, location string) []*armcompute.GalleryImageVersion {
+	candidates := lo.Filter(imageVersions, func(imageVersion *armcompute.GalleryImageVersion, _ int) bool {
+		if !isEligibleImageVersion(channel, isPreviewImageVersion(lo.FromPtr(imageVersion.Name), imageVersion.Tags)) {
+			return false
+		}
+		if imageVersion.Properties == nil || imageVersion.Properties.PublishingProfile == nil || imageVersion.Properties.PublishingProfile.PublishedDate == nil {
+			return false
+		}
+		publishingProfile := imageVersion.Properties.PublishingProfile
+		return !lo.FromPtr(publishingProfile.ExcludeFromLatest) && lo.ContainsBy(publishingProfile.TargetRegions, func(targetRegion *armcompute.TargetRegion) bool {
+			return sameRegion(lo.FromPtr(targetRegion.Name), location)
+		})
+	})
+	sort.SliceStable(candidates, func(i, j int) bool {
+		return candidates[i].Properties.PublishingProfile.PublishedDate.After(*candidates[j].Properties.PublishingProfile.PublishedDate)
+	})
+	return candidates
+}
+
+// isReplicatedTo returns whether the replication of the image version to the region completed
+func isReplicatedTo(imageVersion *armcompute.GalleryImageVersion, location string) bool {
+	if imageVersion.Properties == nil || imageVersion.Properties.ReplicationStatus == nil {
+		return false
+	}
+	return lo.ContainsBy(imageVersion.Properties.ReplicationStatus.Summary, func(status *armcompute.RegionalReplicationStatus) bool {
+		return sameRegion(lo.FromPtr(status.Region), location) && lo.FromPtr(status.State) == armcompute.ReplicationStateCompleted
+	})
+}
+
+// sameRegion returns whether the regions are the same, whether named by their display name, e.g. "West US 2", as in
+// the target regions of gallery image versions, or by their name, e.g. westus2
+func sameRegion(a, b string) bool {
+	return strings.EqualFold(strings.ReplaceAll(a, " ", ""), strings.ReplaceAll(b, " ", ""))
+}
+
+// getCustomImageDefinition returns the gallery image definition of the custom image term. The definition is cached
+// separately from the image versions, as its properties don't change once created.
+func (p *provider) getCustomImageDefinition(ctx context.Context, clientFactory *armcompute.ClientFactory, imageTerm v1beta1.CustomImageTerm) (*armcompute.GalleryImage, error) {
+	if imageTerm.SharedGalleryUniqueName != "" {
+		return p.getSharedGalleryImageDefinition(ctx, clientFactory, imageTerm)
+	}
+	key := fmt.Sprintf("/subscriptions/%s/resourceGroups/%s/providers/Microsoft.Compute/galleries/%s/images/%s",
+		imageTerm.GallerySubscriptionID, imageTerm.GalleryResourceGroupName, imageTerm.GalleryName, imageTerm.Name)
+	if cached, found := p.nodeImagesCache.Get(key); found {
+		return cached.(*armcompute.GalleryImage), nil
+	}
+	resp, err := clientFactory.NewGalleryImagesClient().Get(ctx, imageTerm.GalleryResourceGroupName, imageTerm.GalleryName, imageTerm.Name, nil)
+	if err != nil {
+		return nil, fmt.Errorf("getting custom image definition %s, %w", key, err)
+	}
+	p.nodeImagesCache.SetDefault(key, &resp.GalleryImage)
+	return &resp.GalleryImage, nil
+}
+
+// validateCustomImageDefinition rejects custom images that can't boot as nodes of the custom image term. A specialized
+// image keeps the identity of its source VM and is never provisioned, so the node would only fail to join after the
+// registration timeout.
+func validateCustomImageDefinition(imageDefinition *armcompute.GalleryImage, imageTerm v1beta1.CustomImageTerm) error {
+	name := lo.FromPtr(imageDefinition.Name)
+	if imageDefinition.Properties == nil {
+		return &ImageIncompatibleError{ImageDefinition: name, Incompatibility: "has no properties"}
+	}
+	if osState := lo.FromPtr(imageDefinition.Properties.OSState); osState != armcompute.OperatingSystemStateTypesGeneralized {
+		return &ImageIncompatibleError{ImageDefinition: name, Incompatibility: fmt.Sprintf("has osState %s, expected %s", osState, armcompute.OperatingSystemStateTypesGeneralized)}
+	}
+	// TODO(Windows): the image families are all Linux for now
+	if osType := lo.FromPtr(imageDefinition.Properties.OSType); osType != armcompute.OperatingSystemTypesLinux {
+		return &ImageIncompatibleError{ImageDefinition: name, Incompatibility: fmt.Sprintf("has osType %s, expected %s for image family %s", osType, armcompute.OperatingSystemTypesLinux, v1beta1.CustomImageFamily)}
+	}
+	architecture := customImageArchitecture(imageDefinition, imageTerm)
+	if arch := v1beta1.AzureToKubeArchitectures[string(architecture)]; arch != customImageArch(imageTerm) {
+		return &ImageIncompatibleError{ImageDefinition: name, Incompatibility: fmt.Sprintf("has architecture %s, but distroName %s requires %s", architecture, imageTerm.DistroName, customImageArch(imageTerm))}
+	}
+	return nil
+}
+
+// customImageRequirements returns the requirements of the instance types a custom image can boot on, from the
+// architecture and Hyper-V generation of its gallery image definition, unless the custom image term overrides them
+func customImageRequirements(imageDefinition *armcompute.GalleryImage, imageTerm v1beta1.CustomImageTerm) scheduling.Requirements {
+	return scheduling.NewRequirements(
+		scheduling.NewRequirement(v1.LabelArchStable, v1.NodeSelectorOpIn, v1beta1.AzureToKubeArchitectures[string(customImageArchitecture(imageDefinition, imageTerm))]),
+		scheduling.NewRequirement(v1beta1.LabelSKUHyperVGeneration, v1.NodeSelectorOpIn, customImageHyperVGeneration(imageDefinition, imageTerm)),
+	)
+}
+
+// customImageArchitecture returns the architecture of a custom image. An image definition without architecture is x64.
+func customImageArchitecture(imageDefinition *armcompute.GalleryImage, imageTerm v1beta1.CustomImageTerm) armcompute.Architecture {
+	if imageTerm.Architecture != "" {
+		return armcompute.Architecture(imageTerm.Architecture)
+	}
+	if imageDefinition.Properties != nil && imageDefinition.Properties.Architecture != nil {
+		return *imageDefinition.Properties.Architecture
+	}
+	return armcompute.ArchitectureX64
+}
+
+// customImageHyperVGeneration returns the Hyper-V generation of a custom image, as the value of the Hyper-V generation
+// label. An image definition without Hyper-V generation is V1.
+func customImageHyperVGeneration(imageDefinition *armcompute.GalleryImage, imageTerm v1beta1.CustomImageTerm) string {
+	hyperVGeneration := armcompute.HyperVGenerationV1
+	if imageTerm.HyperVGeneration != "" {
+		hyperVGeneration = armcompute.HyperVGeneration(imageTerm.HyperVGeneration)
+	} else if imageDefinition.Properties != nil && imageDefinition.Properties.HyperVGeneration != nil {
+		hyperVGeneration = *imageDefinition.Properties.HyperVGeneration
+	}
+	if hyperVGeneration == armcompute.HyperVGenerationV2 {
+		return v1beta1.HyperVGenerationV2
+	}
+	return v1beta1.HyperVGenerationV1
+}
+
+// customImageArch returns the architecture the custom image term declares through its distro name
+func customImageArch(imageTerm v1beta1.CustomImageTerm) string {
+	return distroArch(imageTerm.DistroName)
+}
+
+// distroArch returns the architecture of the distro name
+func distroArch(distroName string) string {
+	if strings.Contains(distroName, "arm64") {
+		return karpv1.ArchitectureArm64
+	}
+	return karpv1.ArchitectureAmd64
+}
+
+// CustomImageTermForImage returns the custom image term the image was listed for, i.e. the first whose gallery image
+// the image is a version of
+func CustomImageTermForImage(imageTerms []v1beta1.CustomImageTerm, imageID string) (v1beta1.CustomImageTerm, bool) {
+	return lo.Find(imageTerms, func(imageTerm v1beta1.CustomImageTerm) bool {
+		return strings.HasPrefix(strings.ToLower(imageID), strings.ToLower(customImageID(imageTerm, "")))
+	})
+}
+
+// customImageID returns the ID of the version of the image of the custom image term, in its gallery of a resource group
+// or in its directly shared gallery
+func customImageID(imageTerm v1beta1.CustomImageTerm, version string) string {
+	if imageTerm.SharedGalleryUniqueName != "" {
+		return BuildImageIDSharedGallery(imageTerm.SharedGalleryUniqueName, imageTerm.Name, version)
+	}
+	return BuildImageIDSIG(imageTerm.GallerySubscriptionID, imageTerm.GalleryResourceGroupName, imageTerm.GalleryName, imageTerm.Name, version)
+}
+
+// customImageTermNames returns the names of the custom image terms, for errors
+func customImageTermNames(imageTerms []v1beta1.CustomImageTerm) []string {
+	return lo.Map(imageTerms, func(imageTerm v1beta1.CustomImageTerm, _ int) string {
+		return fmt.Sprintf("%s/%s", customImageGallery(imageTerm), imageTerm.Name)
+	})
+}
+
+// customImageGallery returns the name of the gallery of the custom image term, the unique name of directly shared galleries
+func customImageGallery(imageTerm v1beta1.CustomImageTerm) string {
+	return lo.CoalesceOrEmpty(imageTerm.SharedGalleryUniqueName, imageTerm.GalleryName)
+}
+
+// customImageClientFactory returns the clients of the gallery of the custom image term: in its gallery subscription,
+// defaulting to the cluster's for directly shared galleries, with a credential of its tenant, if any
+func (p *provider) customImageClientFactory(imageTerm v1beta1.CustomImageTerm) (*armcompute.ClientFactory, error) {
+	subscriptionID := imageTerm.GallerySubscriptionID
+	if subscriptionID == "" && imageTerm.SharedGalleryUniqueName != "" {
+		subscriptionID = p.subscription
+	}
+	return p.customGalleryClientFactory(subscriptionID, imageTerm.TenantID)
+}
+
+// customGalleryClientFactory returns the cached clients of the galleries of custom images in the subscription, with a
+// credential of the tenant, if any, creating them once for concurrent callers if they aren't cached. Failures aren't
+// cached, so that the next caller retries.
+func (p *provider) customGalleryClientFactory(subscriptionID, tenantID string) (*armcompute.ClientFactory, error) {
+	key := subscriptionID
+	if tenantID != "" {
+		key = fmt.Sprintf("%s/%s", subscriptionID, tenantID)
+	}
+	if cached, ok := p.customGalleryClientFactories.Get(key); ok {
+		return cached.(*armcompute.ClientFactory), nil
+	}
+	clientFactory, err, _ := p.customGalleryClientFactoriesGroup.Do(key, func() (interface{}, error) {
+		if cached, ok := p.customGalleryClientFactories.Get(key); ok {
+			return cached, nil
+		}
+		clientFactory, err := p.newCustomGalleryClientFactory(subscriptionID, tenantID)
+		if err != nil {
+			return nil, err
+		}
+		p.customGalleryClientFactories.SetDefault(key, clientFactory)
+		return clientFactory, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return clientFactory.(*armcompute.ClientFactory), nil
+}
+
+// newCustomGalleryClientFactory returns the clients of the gallery of custom images, in the gallery's subscription, with
+// a credential of the gallery's tenant, if any, or else of the default tenant
+func newCustomGalleryClientFactory(subscriptionID, tenantID string) (*armcompute.ClientFactory, error) {
+	cred, err := azidentity.NewDefaultAzureCredential(&azidentity.DefaultAzureCredentialOptions{TenantID: tenantID})
+	if err != nil {
+		return nil, fmt.Errorf("obtaining a credential for the custom image gallery, %w", err)
+	}
+	clientFactory, err := armcompute.NewClientFactory(subscriptionID, cred, nil)
+	if err != nil {
+		return nil, fmt.Errorf("creating clients for the custom image gallery, %w", err)
+	}
+	return clientFactory, nil
 }
@@ -56,7 +56,7 @@ func renderExpectedCIGNodeImages(
 	out := make([]imagefamily.NodeImage, 0, len(defaultImages))
 	for _, img := range defaultImages {
 		id := imagefamily.BuildImageIDCIG(img.PublicGalleryURL, img.ImageDefinition, version)
-		out = append(out, imagefamily.NodeImage{ID: id, Requirements: img.Requirements})
+		out = append(out, imagefamily.NodeImage{ID: id, Requirements: img.Requirements, Channel: v1beta1.ImageChannelStable, Distro: img.Distro})
 	}
 	return out
 }
@@ -69,7 +69,7 @@ func renderExpectedSIGNodeImages(
 	out := make([]imagefamily.NodeImage, 0, len(defaultImages))
 	for _, img := range defaultImages {
 		id := imagefamily.BuildImageIDSIG(sigSubscription, img.GalleryResourceGroup, img.GalleryName, img.ImageDefinition, sigImageVersion)
-		out = append(out, imagefamily.NodeImage{ID: id, Requirements: img.Requirements})
+		out = append(out, imagefamily.NodeImage{ID: id, Requirements: img.Requirements, Channel: v1beta1.ImageChannelStable, Distro: img.Distro})
 	}
 	return out
 }
@@ -477,6 +477,27 @@ var _ = Describe("NodeImageProvider tests", func() {
 		})
 	})
 
+	Context("List Image ID", func() {
+		It("should list the image of the image ID as is", func() {
+			imageID := "/subscriptions/00000000-0000-0000-0000-000000000000/resourceGroups/images/providers/Microsoft.Compute/galleries/gallery/images/ubuntu/versions/1.0.0"
+			nodeClass.Spec.ImageID = lo.ToPtr(imageID)
+			nodeClass.Spec.ImageDistroName = lo.ToPtr("aks-ubuntu-containerd-22.04-gen2")
+			foundImages, err := nodeImageProvider.List(ctx, nodeClass)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(foundImages).To(Equal([]imagefamily.NodeImage{{ID: imageID, Pinned: true}}))
+			Expect(nodeImageProvider.Probe(ctx, nodeClass)).To(Succeed())
+		})
+		It("should list the image of the image ID regardless of the Kubernetes version", func() {
+			imageID := "/CommunityGalleries/gallery/images/image/versions/1.0.0"
+			nodeClass.Spec.ImageID = lo.ToPtr(imageID)
+			nodeClass.Spec.ImageDistroName = lo.ToPtr("aks-ubuntu-containerd-22.04-gen2")
+			nodeClass.StatusConditions().SetFalse(v1beta1.ConditionTypeKubernetesVersionReady, "KubernetesVersionFalseForTesting", "testing false kubernetes version status")
+			foundImages, err := nodeImageProvider.List(ctx, nodeClass)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(foundImages).To(Equal([]imagefamily.NodeImage{{ID: imageID, Pinned: true}}))
+		})
+	})
+
 	Context("Caching tests", func() {
 		It("should ensure List images uses cached data", func() {
 			foundImages, err := nodeImageProvider.List(ctx, nodeClass)
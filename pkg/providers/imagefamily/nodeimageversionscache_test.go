@@ -0,0 +1,87 @@
+/*
+Portions Copyright (c) Microsoft Corporation.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package imagefamily
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/patrickmn/go-cache"
+	"github.com/samber/lo"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/Azure/karpenter-provider-azure/pkg/apis/v1beta1"
+	"github.com/Azure/karpenter-provider-azure/pkg/operator/options"
+	"github.com/Azure/karpenter-provider-azure/pkg/providers/imagefamily/types"
+)
+
+// countingNodeImageVersions counts the listings of the node image versions
+type countingNodeImageVersions struct {
+	staticNodeImageVersions
+	calls atomic.Int32
+}
+
+func (c *countingNodeImageVersions) List(ctx context.Context, location, subscription string) (types.NodeImageVersionsResponse, error) {
+	c.calls.Add(1)
+	return c.staticNodeImageVersions.List(ctx, location, subscription)
+}
+
+func TestNodeImageVersionsCache(t *testing.T) {
+	const kubernetesVersion = "1.31.0"
+	nodeClass := &v1beta1.AKSNodeClass{Spec: v1beta1.AKSNodeClassSpec{ImageFamily: lo.ToPtr(v1beta1.Ubuntu2204ImageFamily)}}
+	supportedImages := getSupportedImages(nodeClass, kubernetesVersion, true)
+	nodeImageVersions := &countingNodeImageVersions{staticNodeImageVersions: staticNodeImageVersions{
+		Values: lo.Map(supportedImages, func(supportedImage types.DefaultImageOutput, _ int) types.NodeImageVersion {
+			return types.NodeImageVersion{OS: AKSUbuntuGalleryName, SKU: supportedImage.ImageDefinition, Version: "202506.03.0"}
+		}),
+	}}
+	p := NewProvider(nil, "westus", "00000000-0000-0000-0000-000000000000", nodeImageVersions, cache.New(ImageExpirationInterval, ImageCacheCleaningInterval))
+	ctx := options.ToContext(context.Background(), &options.Options{UseSIG: true, CacheConfig: options.CacheConfig{NodeImageVersionsTTL: 30 * time.Minute}})
+	nodeClass.StatusConditions().SetTrue(v1beta1.ConditionTypeKubernetesVersionReady)
+	nodeClass.Status.KubernetesVersion = kubernetesVersion
+
+	// the images of all the image definitions are resolved from a single listing
+	nodeImages, err := p.List(ctx, nodeClass)
+	assert.NoError(t, err)
+	assert.Len(t, nodeImages, len(supportedImages))
+	assert.Greater(t, len(supportedImages), 1)
+	assert.Equal(t, int32(1), nodeImageVersions.calls.Load())
+
+	// which is shared by the lookups of other nodeclasses
+	previewNodeClass := nodeClass.DeepCopy()
+	previewNodeClass.Spec.ImageChannel = lo.ToPtr(v1beta1.ImageChannelPreview)
+	_, err = p.List(ctx, previewNodeClass)
+	assert.NoError(t, err)
+	assert.Equal(t, int32(1), nodeImageVersions.calls.Load())
+
+	// until the images are refreshed
+	assert.NoError(t, p.Evict(ctx, nodeClass))
+	_, err = p.List(ctx, nodeClass)
+	assert.NoError(t, err)
+	assert.Equal(t, int32(2), nodeImageVersions.calls.Load())
+
+	// and not at all when disabled
+	p.nodeImagesCache.Flush()
+	ctx = options.ToContext(context.Background(), &options.Options{UseSIG: true})
+	for range 2 {
+		_, err = p.List(ctx, nodeClass)
+		assert.NoError(t, err)
+	}
+	assert.Equal(t, int32(4), nodeImageVersions.calls.Load())
+}
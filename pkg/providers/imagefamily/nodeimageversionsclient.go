@@ -23,32 +23,75 @@ import (
 	"net/http"
 	"strconv"
 	"strings"
+	"sync"
 
+	sdkerrors "github.com/Azure/azure-sdk-for-go-extensions/pkg/errors"
 	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
 	"github.com/Azure/azure-sdk-for-go/sdk/azcore/cloud"
 	"github.com/Azure/azure-sdk-for-go/sdk/azcore/policy"
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/runtime"
+	"github.com/prometheus/client_golang/prometheus"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
 	"github.com/Azure/karpenter-provider-azure/pkg/auth"
+	"github.com/Azure/karpenter-provider-azure/pkg/consts"
+	"github.com/Azure/karpenter-provider-azure/pkg/metrics"
 	types "github.com/Azure/karpenter-provider-azure/pkg/providers/imagefamily/types"
 )
 
+// invalidAPIVersionErrorCode is the error code of requests with an api-version the endpoint doesn't serve
+const invalidAPIVersionErrorCode = "InvalidApiVersionParameter"
+
+// NodeImageVersionsClient lists the node image versions of a location. When the configured api-version is rejected,
+// the fallback api-version is tried, and used for the following calls if it succeeds.
 type NodeImageVersionsClient struct {
-	cred  azcore.TokenCredential
-	cloud cloud.Configuration
+	cred       azcore.TokenCredential
+	cloud      cloud.Configuration
+	apiVersion string
+
+	mu               sync.RWMutex
+	activeAPIVersion string
 }
 
-func NewNodeImageVersionsClient(cred azcore.TokenCredential, cloud cloud.Configuration) *NodeImageVersionsClient {
+func NewNodeImageVersionsClient(cred azcore.TokenCredential, cloud cloud.Configuration, apiVersion string) *NodeImageVersionsClient {
+	if apiVersion == "" {
+		apiVersion = consts.NodeImageVersionsAPIVersion
+	}
 	return &NodeImageVersionsClient{
-		cred:  cred,
-		cloud: cloud,
+		cred:             cred,
+		cloud:            cloud,
+		apiVersion:       apiVersion,
+		activeAPIVersion: apiVersion,
 	}
 }
 
 func (l *NodeImageVersionsClient) List(ctx context.Context, location, subscription string) (types.NodeImageVersionsResponse, error) {
+	apiVersion := l.getActiveAPIVersion()
+	response, err := l.list(ctx, location, subscription, apiVersion)
+	if err == nil || !isInvalidAPIVersionError(err) || apiVersion == consts.NodeImageVersionsFallbackAPIVersion {
+		return response, err
+	}
+
+	log.FromContext(ctx).Info("api-version of the NodeImageVersions API was rejected, trying the fallback api-version",
+		"apiVersion", apiVersion, "fallbackAPIVersion", consts.NodeImageVersionsFallbackAPIVersion, "error", err)
+	response, fallbackErr := l.list(ctx, location, subscription, consts.NodeImageVersionsFallbackAPIVersion)
+	if fallbackErr != nil {
+		return types.NodeImageVersionsResponse{}, fmt.Errorf("listing node image versions with fallback api-version %s: %w, after %w",
+			consts.NodeImageVersionsFallbackAPIVersion, fallbackErr, err)
+	}
+	l.setActiveAPIVersion(consts.NodeImageVersionsFallbackAPIVersion)
+	metrics.NodeImageVersionsAPIFallback.With(prometheus.Labels{metrics.APIVersionLabel: consts.NodeImageVersionsFallbackAPIVersion}).Set(1)
+	log.FromContext(ctx).Info("using the fallback api-version of the NodeImageVersions API",
+		"apiVersion", apiVersion, "fallbackAPIVersion", consts.NodeImageVersionsFallbackAPIVersion)
+	return response, nil
+}
+
+func (l *NodeImageVersionsClient) list(ctx context.Context, location, subscription, apiVersion string) (types.NodeImageVersionsResponse, error) {
 	resourceManagerConfig := l.cloud.Services[cloud.ResourceManager]
 
 	resourceURL := fmt.Sprintf(
 		"%s/subscriptions/%s/providers/Microsoft.ContainerService/locations/%s/nodeImageVersions?api-version=%s",
-		resourceManagerConfig.Endpoint, subscription, location, "2024-04-02-preview",
+		resourceManagerConfig.Endpoint, subscription, location, apiVersion,
 	)
 
 	token, err := l.cred.GetToken(ctx, policy.TokenRequestOptions{
@@ -58,7 +101,7 @@ func (l *NodeImageVersionsClient) List(ctx context.Context, location, subscripti
 		return types.NodeImageVersionsResponse{}, err
 	}
 
-	req, err := http.NewRequestWithContext(context.Background(), "GET", resourceURL, nil)
+	req, err := http.NewRequestWithContext(ctx, "GET", resourceURL, nil)
 	if err != nil {
 		return types.NodeImageVersionsResponse{}, err
 	}
@@ -72,6 +115,10 @@ func (l *NodeImageVersionsClient) List(ctx context.Context, location, subscripti
 		return types.NodeImageVersionsResponse{}, err
 	}
 	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		// the error code, e.g. InvalidApiVersionParameter, is parsed from the body
+		return types.NodeImageVersionsResponse{}, runtime.NewResponseError(resp)
+	}
 
 	var response types.NodeImageVersionsResponse
 	decoder := json.NewDecoder(resp.Body)
@@ -80,23 +127,40 @@ func (l *NodeImageVersionsClient) List(ctx context.Context, location, subscripti
 		return types.NodeImageVersionsResponse{}, err
 	}
 
-	response.Values = FilteredNodeImages(response.Values)
+	// all the versions are kept, rather than just the latest ones, so that older versions can be pinned
+	response.Values = SupportedGalleryNodeImages(response.Values)
 	return response, nil
 }
 
+// getActiveAPIVersion returns the api-version that last succeeded, so that a rejected one isn't probed on every call
+func (l *NodeImageVersionsClient) getActiveAPIVersion() string {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	return l.activeAPIVersion
+}
+
+func (l *NodeImageVersionsClient) setActiveAPIVersion(apiVersion string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.activeAPIVersion = apiVersion
+}
+
+func isInvalidAPIVersionError(err error) bool {
+	azErr := sdkerrors.IsResponseError(err)
+	return azErr != nil && azErr.ErrorCode == invalidAPIVersionErrorCode
+}
+
 // FilteredNodeImages filters on two conditions
-// 1. The image is the latest version for the given OS and SKU
+// 1. The image is the latest version for the given OS and SKU, tracked separately for preview versions
 // 2. the image belongs to a supported gallery(AKS Ubuntu or Azure Linux)
 func FilteredNodeImages(nodeImageVersions []types.NodeImageVersion) []types.NodeImageVersion {
 	latestImages := make(map[string]types.NodeImageVersion)
 
-	for _, image := range nodeImageVersions {
-		// Skip the galleries that Karpenter does not support
-		if image.OS != AKSUbuntuGalleryName && image.OS != AKSAzureLinuxGalleryName {
-			continue
-		}
-
+	for _, image := range SupportedGalleryNodeImages(nodeImageVersions) {
 		key := image.OS + "-" + image.SKU
+		if isPreviewImageVersion(image.Version, nil) {
+			key += previewVersionSuffix
+		}
 
 		currentLatest, exists := latestImages[key]
 		if !exists || isNewerVersion(image.Version, currentLatest.Version) {
@@ -111,8 +175,25 @@ func FilteredNodeImages(nodeImageVersions []types.NodeImageVersion) []types.Node
 	return filteredImages
 }
 
+// SupportedGalleryNodeImages returns the node image versions of the supported galleries (AKS Ubuntu or Azure Linux)
+func SupportedGalleryNodeImages(nodeImageVersions []types.NodeImageVersion) []types.NodeImageVersion {
+	var supportedImages []types.NodeImageVersion
+	for _, image := range nodeImageVersions {
+		// Skip the galleries that Karpenter does not support
+		if image.OS != AKSUbuntuGalleryName && image.OS != AKSAzureLinuxGalleryName {
+			continue
+		}
+		supportedImages = append(supportedImages, image)
+	}
+	return supportedImages
+}
+
 // isNewerVersion will return if version1 is greater than version2, note the new versioning scheme is yearmm.dd.build, previously it was yy.mm.dd without the build id.
+// Preview versions carry a pre-release suffix, and are older than the generally available version they precede.
 func isNewerVersion(version1, version2 string) bool {
+	version1, preRelease1, _ := strings.Cut(version1, "-")
+	version2, preRelease2, _ := strings.Cut(version2, "-")
+
 	// Split by dots and compare each segment as an integer getting the largest vhd version
 	v1Segments := strings.Split(version1, ".")
 	v2Segments := strings.Split(version2, ".")
@@ -135,5 +216,8 @@ func isNewerVersion(version1, version2 string) bool {
 	// If all segments are equal up to the length of the shorter version,
 	// the longer version is considered newer if it has additional segments
 	// the legacy linux versions use "yy.mm.dd" whereas new linux versions use "yymm.dd.build"
-	return len(v1Segments) > len(v2Segments)
+	if len(v1Segments) != len(v2Segments) {
+		return len(v1Segments) > len(v2Segments)
+	}
+	return preRelease1 == "" && preRelease2 != ""
 }
@@ -17,7 +17,20 @@ limitations under the License.
 package imagefamily
 
 import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
 	"testing"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/cloud"
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/policy"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/Azure/karpenter-provider-azure/pkg/consts"
 )
 
 func TestIsNewerVersion(t *testing.T) {
@@ -36,6 +49,10 @@ func TestIsNewerVersion(t *testing.T) {
 		{"2022.12.15", "2022.10.03", true},
 		{"202411.12.0", "202411.12.0", false},
 		{"2o2411.12.0", "202411.12.0", false}, // invalid version strings should be ignored and return false
+		{"202506.10.0-preview", "202505.27.0", true},
+		{"202505.27.0", "202506.10.0-preview", false},
+		{"202506.10.0", "202506.10.0-preview", true}, // the generally available version is newer than its preview
+		{"202506.10.0-preview", "202506.10.0", false},
 	}
 
 	for _, tc := range testCases {
@@ -47,3 +64,85 @@ func TestIsNewerVersion(t *testing.T) {
 		})
 	}
 }
+
+type staticCredential struct{}
+
+func (staticCredential) GetToken(context.Context, policy.TokenRequestOptions) (azcore.AccessToken, error) {
+	return azcore.AccessToken{Token: "token", ExpiresOn: time.Now().Add(time.Hour)}, nil
+}
+
+// nodeImageVersionsServer serves the NodeImageVersions API for the supported api-versions, and records the requested ones
+func nodeImageVersionsServer(t *testing.T, supportedAPIVersions ...string) (*httptest.Server, func() []string) {
+	var mu sync.Mutex
+	var requested []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		apiVersion := r.URL.Query().Get("api-version")
+		mu.Lock()
+		requested = append(requested, apiVersion)
+		mu.Unlock()
+		w.Header().Set("Content-Type", "application/json")
+		for _, supported := range supportedAPIVersions {
+			if apiVersion == supported {
+				fmt.Fprint(w, `{"values":[{"fullName":"AKSUbuntu-2204gen2containerd-202505.27.0","os":"AKSUbuntu","sku":"2204gen2containerd","version":"202505.27.0"}]}`)
+				return
+			}
+		}
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprintf(w, `{"error":{"code":"InvalidApiVersionParameter","message":"The api-version '%s' is invalid."}}`, apiVersion)
+	}))
+	t.Cleanup(server.Close)
+	return server, func() []string {
+		mu.Lock()
+		defer mu.Unlock()
+		return append([]string{}, requested...)
+	}
+}
+
+func nodeImageVersionsClient(server *httptest.Server, apiVersion string) *NodeImageVersionsClient {
+	cloudConfig := cloud.Configuration{Services: map[cloud.ServiceName]cloud.ServiceConfiguration{
+		cloud.ResourceManager: {Endpoint: server.URL, Audience: server.URL},
+	}}
+	return NewNodeImageVersionsClient(staticCredential{}, cloudConfig, apiVersion)
+}
+
+func TestNodeImageVersionsClientAPIVersion(t *testing.T) {
+	server, requested := nodeImageVersionsServer(t, consts.NodeImageVersionsAPIVersion, consts.NodeImageVersionsFallbackAPIVersion, "2025-01-01-preview")
+
+	// the default api-version is used when none is configured
+	response, err := nodeImageVersionsClient(server, "").List(context.Background(), "westus2", "subscription")
+	assert.NoError(t, err)
+	assert.Len(t, response.Values, 1)
+
+	_, err = nodeImageVersionsClient(server, "2025-01-01-preview").List(context.Background(), "westus2", "subscription")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{consts.NodeImageVersionsAPIVersion, "2025-01-01-preview"}, requested())
+}
+
+func TestNodeImageVersionsClientFallback(t *testing.T) {
+	server, requested := nodeImageVersionsServer(t, consts.NodeImageVersionsFallbackAPIVersion)
+	client := nodeImageVersionsClient(server, "2099-01-01-preview")
+
+	response, err := client.List(context.Background(), "westus2", "subscription")
+	assert.NoError(t, err)
+	assert.Len(t, response.Values, 1)
+	assert.Equal(t, []string{"2099-01-01-preview", consts.NodeImageVersionsFallbackAPIVersion}, requested())
+
+	// the fallback api-version is cached, so the rejected one isn't probed again
+	_, err = client.List(context.Background(), "westus2", "subscription")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"2099-01-01-preview", consts.NodeImageVersionsFallbackAPIVersion, consts.NodeImageVersionsFallbackAPIVersion}, requested())
+}
+
+func TestNodeImageVersionsClientFallbackRejected(t *testing.T) {
+	server, requested := nodeImageVersionsServer(t)
+
+	_, err := nodeImageVersionsClient(server, "2099-01-01-preview").List(context.Background(), "westus2", "subscription")
+	assert.Error(t, err)
+	assert.True(t, isInvalidAPIVersionError(err))
+	assert.Equal(t, []string{"2099-01-01-preview", consts.NodeImageVersionsFallbackAPIVersion}, requested())
+
+	// the fallback api-version isn't retried with itself
+	_, err = nodeImageVersionsClient(server, consts.NodeImageVersionsFallbackAPIVersion).List(context.Background(), "westus2", "subscription")
+	assert.Error(t, err)
+	assert.Len(t, requested(), 3)
+}
@@ -0,0 +1,107 @@
+/*
+Portions Copyright (c) Microsoft Corporation.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package imagefamily
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"time"
+
+	sdkerrors "github.com/Azure/azure-sdk-for-go-extensions/pkg/errors"
+	"github.com/Azure/azure-sdk-for-go/sdk/azidentity"
+	"github.com/samber/lo"
+
+	"github.com/Azure/karpenter-provider-azure/pkg/apis/v1beta1"
+	"github.com/Azure/karpenter-provider-azure/pkg/metrics"
+	"github.com/Azure/karpenter-provider-azure/pkg/operator/options"
+)
+
+// The resolution paths of the images of AKSNodeClasses, as the path label of the image resolution metrics
+const (
+	resolutionPathCIG         = "cig"
+	resolutionPathSIG         = "sig"
+	resolutionPathCustom      = "custom"
+	resolutionPathMarketplace = "marketplace"
+)
+
+// The classes of the errors of image resolutions, as the error class label of the image resolution errors metric
+const (
+	resolutionErrorThrottled = "throttled"
+	resolutionErrorNotFound  = "notfound"
+	resolutionErrorAuth      = "auth"
+	resolutionErrorOther     = "other"
+)
+
+// resolutionPath returns the path the images of the AKSNodeClass were resolved through: the community galleries for the
+// images listed from them once their lookup through SIG failed, see listCIGFallback
+func resolutionPath(ctx context.Context, nodeClass *v1beta1.AKSNodeClass, nodeImages []NodeImage) string {
+	switch {
+	case nodeClass.Spec.MarketplaceImage != nil:
+		return resolutionPathMarketplace
+	case lo.FromPtr(nodeClass.Spec.ImageFamily) == v1beta1.CustomImageFamily:
+		return resolutionPathCustom
+	case lo.SomeBy(nodeImages, func(nodeImage NodeImage) bool { return nodeImage.Fallback }):
+		return resolutionPathCIG
+	case options.FromContext(ctx).UseSIG:
+		return resolutionPathSIG
+	default:
+		return resolutionPathCIG
+	}
+}
+
+// recordResolution records the duration of the resolution of images through the path since it started, and its error,
+// if any. Resolutions failing as their context is canceled, e.g. on shutdown, aren't counted as errors.
+func recordResolution(ctx context.Context, path string, start time.Time, err error) {
+	metrics.ImageResolutionDuration.WithLabelValues(path).Observe(time.Since(start).Seconds())
+	if err != nil && !isCanceled(ctx, err) {
+		metrics.ImageResolutionErrors.WithLabelValues(path, resolutionErrorClass(err)).Inc()
+	}
+}
+
+// recordCacheLookup counts the lookup of resolved images of the path in the image cache
+func recordCacheLookup(path string, hit bool) {
+	metrics.ImageCacheLookups.WithLabelValues(path, lo.Ternary(hit, "hit", "miss")).Inc()
+}
+
+// resolutionErrorClass returns the class of the error of an image resolution: throttled by ARM, not found, whether the
+// image or the version satisfying the AKSNodeClass, failing to authenticate or authorize, or other
+func resolutionErrorClass(err error) string {
+	var authenticationFailedErr *azidentity.AuthenticationFailedError
+	if errors.As(err, &authenticationFailedErr) {
+		return resolutionErrorAuth
+	}
+	if azErr := sdkerrors.IsResponseError(err); azErr != nil {
+		switch azErr.StatusCode {
+		case http.StatusTooManyRequests:
+			return resolutionErrorThrottled
+		case http.StatusUnauthorized, http.StatusForbidden:
+			return resolutionErrorAuth
+		case http.StatusNotFound:
+			return resolutionErrorNotFound
+		}
+	}
+	var imageVersionNotFoundErr *ImageVersionNotFoundError
+	var imageVersionsNotFoundErr *ImageVersionsNotFoundError
+	var imageVersionConstraintErr *ImageVersionConstraintError
+	var imageVersionTagSelectorErr *ImageVersionTagSelectorError
+	if errors.As(err, &imageVersionNotFoundErr) || errors.As(err, &imageVersionsNotFoundErr) ||
+		errors.As(err, &imageVersionConstraintErr) || errors.As(err, &imageVersionTagSelectorErr) {
+		return resolutionErrorNotFound
+	}
+	return resolutionErrorOther
+}
@@ -0,0 +1,120 @@
+/*
+Portions Copyright (c) Microsoft Corporation.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package imagefamily
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
+	"github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/compute/armcompute/v7"
+	"github.com/patrickmn/go-cache"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/samber/lo"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/Azure/karpenter-provider-azure/pkg/apis/v1beta1"
+	"github.com/Azure/karpenter-provider-azure/pkg/metrics"
+	"github.com/Azure/karpenter-provider-azure/pkg/operator/options"
+)
+
+func TestResolutionErrorClass(t *testing.T) {
+	for _, tc := range []struct {
+		name     string
+		err      error
+		expected string
+	}{
+		{"throttled", fmt.Errorf("listing, %w", &azcore.ResponseError{StatusCode: http.StatusTooManyRequests}), resolutionErrorThrottled},
+		{"forbidden", &azcore.ResponseError{StatusCode: http.StatusForbidden, ErrorCode: "AuthorizationFailed"}, resolutionErrorAuth},
+		{"unauthorized", &azcore.ResponseError{StatusCode: http.StatusUnauthorized}, resolutionErrorAuth},
+		{"gallery not found", &azcore.ResponseError{StatusCode: http.StatusNotFound, ErrorCode: "ResourceNotFound"}, resolutionErrorNotFound},
+		{"pinned version not found", &ImageVersionNotFoundError{ImageVersion: "202401.01.0", ImageDefinition: "2204gen2containerd"}, resolutionErrorNotFound},
+		{"no version satisfying the constraint", &ImageVersionConstraintError{Constraint: ">=2.0.0", ImageDefinition: "ubuntu"}, resolutionErrorNotFound},
+		{"server error", &azcore.ResponseError{StatusCode: http.StatusInternalServerError}, resolutionErrorOther},
+		{"other", errors.New("boom"), resolutionErrorOther},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.expected, resolutionErrorClass(tc.err))
+		})
+	}
+}
+
+func TestResolutionPath(t *testing.T) {
+	ctx := options.ToContext(context.Background(), &options.Options{})
+	sigCtx := options.ToContext(context.Background(), &options.Options{UseSIG: true})
+	ubuntu := &v1beta1.AKSNodeClass{Spec: v1beta1.AKSNodeClassSpec{ImageFamily: lo.ToPtr(v1beta1.Ubuntu2204ImageFamily)}}
+
+	assert.Equal(t, resolutionPathCIG, resolutionPath(ctx, ubuntu, nil))
+	assert.Equal(t, resolutionPathSIG, resolutionPath(sigCtx, ubuntu, []NodeImage{{ID: "sig-image"}}))
+	// the images listed from the community galleries once their lookup through SIG failed
+	assert.Equal(t, resolutionPathCIG, resolutionPath(sigCtx, ubuntu, []NodeImage{{ID: "cig-image", Fallback: true}}))
+	assert.Equal(t, resolutionPathCustom, resolutionPath(sigCtx, &v1beta1.AKSNodeClass{Spec: v1beta1.AKSNodeClassSpec{ImageFamily: lo.ToPtr(v1beta1.CustomImageFamily)}}, nil))
+	assert.Equal(t, resolutionPathMarketplace, resolutionPath(ctx, &v1beta1.AKSNodeClass{Spec: v1beta1.AKSNodeClassSpec{
+		ImageFamily:      lo.ToPtr(v1beta1.Ubuntu2204ImageFamily),
+		MarketplaceImage: &v1beta1.MarketplaceImageTerm{Publisher: "canonical", Offer: "ubuntu", SKU: "22_04-lts"},
+	}}, nil))
+}
+
+func TestListRecordsResolutionMetrics(t *testing.T) {
+	ctx := options.ToContext(context.Background(), &options.Options{})
+	p := NewProvider(nil, "westus", "00000000-0000-0000-0000-000000000000", nil, cache.New(ImageExpirationInterval, ImageCacheCleaningInterval))
+	clientFactory := fakeGalleryClientFactory(t, galleryImageVersion("1.0.0", 0, false, []string{"West US"}, map[string]armcompute.ReplicationState{"West US": armcompute.ReplicationStateCompleted}))
+	p.newCustomGalleryClientFactory = func(string, string) (*armcompute.ClientFactory, error) { return clientFactory, nil }
+	nodeClass := &v1beta1.AKSNodeClass{
+		Spec: v1beta1.AKSNodeClassSpec{
+			ImageFamily: lo.ToPtr(v1beta1.CustomImageFamily),
+			CustomImageTerms: []v1beta1.CustomImageTerm{{
+				GallerySubscriptionID:    "11111111-1111-1111-1111-111111111111",
+				GalleryResourceGroupName: "images",
+				GalleryName:              "gallery",
+				Name:                     "ubuntu",
+			}},
+		},
+	}
+	nodeClass.StatusConditions().SetTrue(v1beta1.ConditionTypeKubernetesVersionReady)
+	nodeClass.Status.KubernetesVersion = "1.31.0"
+
+	misses := testutil.ToFloat64(metrics.ImageCacheLookups.WithLabelValues(resolutionPathCustom, "miss"))
+	hits := testutil.ToFloat64(metrics.ImageCacheLookups.WithLabelValues(resolutionPathCustom, "hit"))
+	resolutions := resolutionCount(t, resolutionPathCustom)
+
+	// the first listing misses the cache, the second hits it
+	for range 2 {
+		_, err := p.List(ctx, nodeClass)
+		assert.NoError(t, err)
+	}
+	assert.Equal(t, misses+1, testutil.ToFloat64(metrics.ImageCacheLookups.WithLabelValues(resolutionPathCustom, "miss")))
+	assert.Equal(t, hits+1, testutil.ToFloat64(metrics.ImageCacheLookups.WithLabelValues(resolutionPathCustom, "hit")))
+	assert.Equal(t, resolutions+2, resolutionCount(t, resolutionPathCustom))
+
+	notFound := testutil.ToFloat64(metrics.ImageResolutionErrors.WithLabelValues(resolutionPathCustom, resolutionErrorNotFound))
+	nodeClass.Spec.CustomImageTerms[0].Version = "2.0.0"
+	_, err := p.List(ctx, nodeClass)
+	assert.Error(t, err)
+	assert.Equal(t, notFound+1, testutil.ToFloat64(metrics.ImageResolutionErrors.WithLabelValues(resolutionPathCustom, resolutionErrorNotFound)))
+}
+
+// resolutionCount returns the number of resolutions of images through the path observed by the resolution duration
+func resolutionCount(t *testing.T, path string) uint64 {
+	t.Helper()
+	metric, err := metrics.FindMetricWithLabelValues("karpenter_image_resolution_duration_seconds", map[string]string{metrics.PathLabel: path})
+	assert.NoError(t, err)
+	return metric.GetHistogram().GetSampleCount()
+}
@@ -35,6 +35,7 @@ import (
 	types "github.com/Azure/karpenter-provider-azure/pkg/providers/imagefamily/types"
 	"github.com/Azure/karpenter-provider-azure/pkg/providers/instancetype"
 	template "github.com/Azure/karpenter-provider-azure/pkg/providers/launchtemplate/parameters"
+	"github.com/Azure/karpenter-provider-azure/pkg/tracing"
 	"github.com/Azure/karpenter-provider-azure/pkg/utils"
 	"github.com/samber/lo"
 	karpv1 "sigs.k8s.io/karpenter/pkg/apis/v1"
@@ -89,6 +90,13 @@ type ImageFamily interface {
 	DefaultImages(useSIG bool, fipsMode *v1beta1.FIPSMode) []types.DefaultImageOutput
 }
 
+// ConfidentialImageFamily is an ImageFamily with confidential VM images, which the AKSNodeClasses with the
+// ConfidentialVM security type launch instead of its default images
+type ConfidentialImageFamily interface {
+	// ConfidentialImages returns the confidential VM images, ordered like DefaultImages
+	ConfidentialImages(useSIG bool) []types.DefaultImageOutput
+}
+
 // NewDefaultResolver constructs a new launch template Resolver
 func NewDefaultResolver(_ client.Client, imageProvider *provider, instanceTypeProvider instancetype.Provider, nodeBootstrappingClient types.NodeBootstrappingAPI) *defaultResolver {
 	return &defaultResolver{
@@ -105,6 +113,22 @@ func (r *defaultResolver) Resolve(
 	nodeClaim *karpv1.NodeClaim,
 	instanceType *cloudprovider.InstanceType,
 	staticParameters *template.StaticParameters,
+) (*template.Parameters, error) {
+	ctx, span := tracing.Start(ctx, tracing.SpanResolveImage, tracing.InstanceTypeKey.String(instanceType.Name))
+	parameters, err := r.resolve(ctx, nodeClass, nodeClaim, instanceType, staticParameters)
+	if parameters != nil {
+		span.SetAttributes(tracing.ImageIDKey.String(parameters.ImageID))
+	}
+	tracing.End(span, err)
+	return parameters, err
+}
+
+func (r *defaultResolver) resolve(
+	ctx context.Context,
+	nodeClass *v1beta1.AKSNodeClass,
+	nodeClaim *karpv1.NodeClaim,
+	instanceType *cloudprovider.InstanceType,
+	staticParameters *template.StaticParameters,
 ) (*template.Parameters, error) {
 	nodeImages, err := nodeClass.GetImages()
 	if err != nil {
@@ -116,9 +140,12 @@ func (r *defaultResolver) Resolve(
 	}
 
 	imageFamily := GetImageFamily(nodeClass.Spec.ImageFamily, nodeClass.Spec.FIPSMode, kubernetesVersion, staticParameters)
-	imageID, err := r.resolveNodeImage(nodeImages, instanceType)
+	imageID, err := r.resolveNodeImage(nodeImages, nodeClaim, instanceType)
 	if err != nil {
 		metrics.ImageSelectionErrorCount.WithLabelValues(imageFamily.Name()).Inc()
+		if *nodeClass.Spec.ImageFamily == v1beta1.CustomImageFamily {
+			return nil, fmt.Errorf("%w, considered custom image terms %v", err, customImageTermNames(CustomImageTerms(ctx, nodeClass)))
+		}
 		return nil, err
 	}
 
@@ -127,22 +154,51 @@ func (r *defaultResolver) Resolve(
 		logging.InstanceType, instanceType.Name,
 	)
 
+	// an image pinned or frozen across a kubernetes upgrade may not support the new kubelet, which would fail to join
+	supportedKubernetesVersions, err := r.imageProvider.KubernetesVersionRange(ctx, nodeClass, imageID)
+	if err != nil {
+		return nil, err
+	}
+	if err := ValidateKubernetesVersion(imageID, kubernetesVersion, supportedKubernetesVersions); err != nil {
+		return nil, err
+	}
+	// the version of a custom image may have been deleted from its gallery since it was resolved
+	if err := r.imageProvider.checkImageVersionExists(ctx, nodeClass, imageID); err != nil {
+		return nil, err
+	}
+
 	// TODO: as ProvisionModeBootstrappingClient path develops, we will eventually be able to drop the retrieval of imageDistro here.
 	useSIG := options.FromContext(ctx).UseSIG
 	imageDistro := ""
-	if *nodeClass.Spec.ImageFamily == "Custom" {
-		if nodeClass.Spec.CustomImageTerm.DistroName == "" {
-			return nil, fmt.Errorf("custom image family requires specifying .spec.customImageTerm.distroName")
+	imageTenantID := ""
+	if lo.FromPtr(nodeClass.Spec.ImageID) != "" {
+		imageDistro = lo.FromPtr(nodeClass.Spec.ImageDistroName)
+	} else if nodeClass.Spec.MarketplaceImage != nil {
+		imageDistro = nodeClass.Spec.MarketplaceImage.DistroName
+	} else if *nodeClass.Spec.ImageFamily == "Custom" {
+		imageTerm, ok := CustomImageTermForImage(CustomImageTerms(ctx, nodeClass), imageID)
+		if !ok {
+			return nil, fmt.Errorf("no custom image term found for image id %s", imageID)
 		}
-		imageDistro = nodeClass.Spec.CustomImageTerm.DistroName
+		if imageTerm.DistroName == "" {
+			return nil, fmt.Errorf("custom image family requires specifying .spec.customImageTerms[].distroName")
+		}
+		imageDistro = imageTerm.DistroName
+		imageTenantID = imageTerm.TenantID
 	} else {
-		imageDistro, err = mapToImageDistro(imageID, nodeClass.Spec.FIPSMode, imageFamily, useSIG)
+		imageDistro, err = mapToImageDistro(imageID, nodeClass, imageFamily, useSIG)
 		if err != nil {
 			return nil, err
 		}
 
 	}
 
+	// VMs launching with a marketplace image with a purchase plan must specify it
+	imagePlan, err := r.imageProvider.MarketplaceImagePlan(ctx, imageID)
+	if err != nil {
+		return nil, err
+	}
+
 	generalTaints := nodeClaim.Spec.Taints
 	startupTaints := nodeClaim.Spec.StartupTaints
 	allTaints := lo.Flatten([][]corev1.Taint{
@@ -158,6 +214,12 @@ func (r *defaultResolver) Resolve(
 		allTaints = append(allTaints, karpv1.UnregisteredNoExecuteTaint)
 	}
 
+	// GPU nodes are tainted until they report their GPU driver ready
+	if staticParameters.GPUDriverReadyTimeout > 0 {
+		startupTaints = append(startupTaints, v1beta1.GPUInitializingTaint)
+		allTaints = append(allTaints, v1beta1.GPUInitializingTaint)
+	}
+
 	sku, err := r.instanceTypeProvider.Get(ctx, nodeClass, instanceType.Name)
 	if err != nil {
 		return nil, err
@@ -173,20 +235,31 @@ func (r *defaultResolver) Resolve(
 		return nil, err
 	}
 
+	// the cgroup mode follows the image, so nodes of the same nodeclass on different image versions can differ
+	cgroupMode := CgroupMode(imageDistro)
+	labels := lo.Assign(staticParameters.Labels)
+	// Windows has no cgroups
+	if !v1beta1.WindowsFamilies.Has(imageFamily.Name()) {
+		labels[v1beta1.AKSLabelCgroupMode] = cgroupMode
+	}
+	if placement != nil {
+		labels[v1beta1.AKSLabelEphemeralOSDiskPlacement] = string(*placement)
+	}
+
 	template := &template.Parameters{
 		StaticParameters: staticParameters,
 		ScriptlessCustomData: imageFamily.ScriptlessCustomData(
-			prepareKubeletConfiguration(ctx, instanceType, nodeClass),
+			prepareKubeletConfiguration(ctx, instanceType, nodeClass, cgroupMode),
 			allTaints,
-			staticParameters.Labels,
+			labels,
 			staticParameters.CABundle,
 			instanceType,
 		),
 		CustomScriptsNodeBootstrapping: imageFamily.CustomScriptsNodeBootstrapping(
-			prepareKubeletConfiguration(ctx, instanceType, nodeClass),
+			prepareKubeletConfiguration(ctx, instanceType, nodeClass, cgroupMode),
 			generalTaints,
 			startupTaints,
-			staticParameters.Labels,
+			labels,
 			instanceType,
 			imageDistro,
 			diskType,
@@ -201,7 +274,9 @@ func (r *defaultResolver) Resolve(
 		// traditional AKS, so putting this here along with the other settings
 		StorageProfileSizeGB: int32(diskSize),
 		ImageID:              imageID,
-		IsWindows:            false, // TODO(Windows)
+		ImagePlan:            imagePlan,
+		ImageTenantID:        imageTenantID,
+		IsWindows:            v1beta1.WindowsFamilies.Has(imageFamily.Name()),
 	}
 
 	return template, nil
@@ -213,18 +288,26 @@ func (r *defaultResolver) getStorageProfile(ctx context.Context, instanceType *c
 		return "", nil, err
 	}
 
-	_, placement = instancetype.FindMaxEphemeralSizeGBAndPlacement(sku)
-
-	if instancetype.UseEphemeralDisk(sku, nodeClass) {
+	// the VM guest state of confidential VMs is encrypted on their OS disk, which has to be managed
+	if nodeClass.IsConfidentialVM() {
+		return consts.StorageProfileManagedDisks, nil, nil
+	}
+	// a dynamically sized OS disk takes the largest placement, which it's sized to
+	if nodeClass.Spec.OSDiskSizeDynamic {
+		if _, placement = instancetype.FindMaxEphemeralSizeGBAndPlacement(sku); placement != nil {
+			return consts.StorageProfileEphemeral, placement, nil
+		}
+	}
+	if placement = instancetype.FindEphemeralPlacement(sku, int64(lo.FromPtr(nodeClass.Spec.OSDiskSizeGB))); placement != nil {
 		return consts.StorageProfileEphemeral, placement, nil
 	}
-	return consts.StorageProfileManagedDisks, placement, nil
+	return consts.StorageProfileManagedDisks, nil, nil
 }
 
-func mapToImageDistro(imageID string, fipsMode *v1beta1.FIPSMode, imageFamily ImageFamily, useSIG bool) (string, error) {
+func mapToImageDistro(imageID string, nodeClass *v1beta1.AKSNodeClass, imageFamily ImageFamily, useSIG bool) (string, error) {
 	var imageInfo types.DefaultImageOutput
 	imageInfo.PopulateImageTraitsFromID(imageID)
-	for _, defaultImage := range imageFamily.DefaultImages(useSIG, fipsMode) {
+	for _, defaultImage := range defaultImages(imageFamily, nodeClass, useSIG) {
 		if defaultImage.ImageDefinition == imageInfo.ImageDefinition {
 			return defaultImage.Distro, nil
 		}
@@ -232,7 +315,7 @@ func mapToImageDistro(imageID string, fipsMode *v1beta1.FIPSMode, imageFamily Im
 	return "", fmt.Errorf("no distro found for image id %s", imageID)
 }
 
-func prepareKubeletConfiguration(ctx context.Context, instanceType *cloudprovider.InstanceType, nodeClass *v1beta1.AKSNodeClass) *bootstrap.KubeletConfiguration {
+func prepareKubeletConfiguration(ctx context.Context, instanceType *cloudprovider.InstanceType, nodeClass *v1beta1.AKSNodeClass, cgroupMode string) *bootstrap.KubeletConfiguration {
 	kubeletConfig := &bootstrap.KubeletConfiguration{}
 
 	if nodeClass.Spec.Kubelet != nil {
@@ -246,13 +329,33 @@ func prepareKubeletConfiguration(ctx context.Context, instanceType *cloudprovide
 	kubeletConfig.KubeReserved = utils.StringMap(instanceType.Overhead.KubeReserved)
 	kubeletConfig.SystemReserved = utils.StringMap(instanceType.Overhead.SystemReserved)
 	kubeletConfig.EvictionHard = map[string]string{instancetype.MemoryAvailable: instanceType.Overhead.EvictionThreshold.Memory().String()}
+	kubeletConfig.CgroupMode = cgroupMode
 	return kubeletConfig
 }
 
-func getSupportedImages(familyName *string, fipsMode *v1beta1.FIPSMode, kubernetesVersion string, useSIG bool) []types.DefaultImageOutput {
+func getSupportedImages(nodeClass *v1beta1.AKSNodeClass, kubernetesVersion string, useSIG bool) []types.DefaultImageOutput {
 	// TODO: Options aren't used within DefaultImages, so safe to be using nil here. Refactor so we don't actually need to pass in Options for getting DefaultImage.
-	imageFamily := GetImageFamily(familyName, fipsMode, kubernetesVersion, nil)
-	return imageFamily.DefaultImages(useSIG, fipsMode)
+	imageFamily := GetImageFamily(nodeClass.Spec.ImageFamily, nodeClass.Spec.FIPSMode, kubernetesVersion, nil)
+	return defaultImages(imageFamily, nodeClass, useSIG)
+}
+
+// defaultImages returns the default images of the image family for the AKSNodeClass, its confidential VM images for
+// confidential VMs, none if it has none, so that confidential VMs never launch with images that aren't CVM-capable,
+// and only its Gen2 images for trusted launch VMs, which Gen1 VMs don't support
+func defaultImages(imageFamily ImageFamily, nodeClass *v1beta1.AKSNodeClass, useSIG bool) []types.DefaultImageOutput {
+	if nodeClass.IsConfidentialVM() {
+		if confidentialImageFamily, ok := imageFamily.(ConfidentialImageFamily); ok {
+			return confidentialImageFamily.ConfidentialImages(useSIG)
+		}
+		return []types.DefaultImageOutput{}
+	}
+	images := imageFamily.DefaultImages(useSIG, nodeClass.Spec.FIPSMode)
+	if nodeClass.IsTrustedLaunch() {
+		return lo.Filter(images, func(image types.DefaultImageOutput, _ int) bool {
+			return !image.Requirements.Has(v1beta1.LabelSKUHyperVGeneration) || image.Requirements.Get(v1beta1.LabelSKUHyperVGeneration).Has(v1beta1.HyperVGenerationV2)
+		})
+	}
+	return images
 }
 
 func GetImageFamily(familyName *string, fipsMode *v1beta1.FIPSMode, kubernetesVersion string, parameters *template.StaticParameters) ImageFamily {
@@ -266,6 +369,10 @@ func GetImageFamily(familyName *string, fipsMode *v1beta1.FIPSMode, kubernetesVe
 			return &AzureLinux3{Options: parameters}
 		}
 		return &AzureLinux{Options: parameters}
+	case v1beta1.AzureLinux3ImageFamily:
+		return &AzureLinux3{Options: parameters}
+	case v1beta1.Windows2022ImageFamily:
+		return &Windows2022{Options: parameters}
 	case v1beta1.CustomImageFamily:
 		return &CustomImages{Options: parameters}
 	case v1beta1.UbuntuImageFamily:
@@ -285,14 +392,18 @@ func defaultUbuntu(fipsMode *v1beta1.FIPSMode, kubernetesVersion string, paramet
 	return &Ubuntu2204{Options: parameters}
 }
 
-// resolveNodeImage returns Distro and Image ID for the given instance type. Images may vary due to architecture, accelerator, etc
+// resolveNodeImage returns Distro and Image ID for the given instance type. Images may vary due to architecture, accelerator, etc.
+// The requirements of the nodeclaim are intersected with those of the instance type, so that the image matches what the node
+// registers as, even when the instance type alone allows several, e.g. when only the nodeclaim pins the architecture.
 //
 // Preconditions:
 // - nodeImages is sorted by priority order
-func (r *defaultResolver) resolveNodeImage(nodeImages []v1beta1.NodeImage, instanceType *cloudprovider.InstanceType) (string, error) {
+func (r *defaultResolver) resolveNodeImage(nodeImages []v1beta1.NodeImage, nodeClaim *karpv1.NodeClaim, instanceType *cloudprovider.InstanceType) (string, error) {
+	requirements := scheduling.NewRequirements(instanceType.Requirements.Values()...)
+	requirements.Add(scheduling.NewNodeSelectorRequirementsWithMinValues(nodeClaim.Spec.Requirements...).Values()...)
 	// nodeImages are sorted by priority order, so we can return the first one that matches
 	for _, availableImage := range nodeImages {
-		if err := instanceType.Requirements.Compatible(
+		if err := requirements.Compatible(
 			scheduling.NewNodeSelectorRequirements(availableImage.Requirements...),
 			v1beta1.AllowUndefinedWellKnownAndRestrictedLabels,
 		); err == nil {
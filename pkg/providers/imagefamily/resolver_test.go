@@ -0,0 +1,134 @@
+/*
+Portions Copyright (c) Microsoft Corporation.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package imagefamily
+
+import (
+	"testing"
+
+	"github.com/samber/lo"
+	"github.com/stretchr/testify/assert"
+	v1 "k8s.io/api/core/v1"
+	karpv1 "sigs.k8s.io/karpenter/pkg/apis/v1"
+	"sigs.k8s.io/karpenter/pkg/cloudprovider"
+	"sigs.k8s.io/karpenter/pkg/scheduling"
+
+	"github.com/Azure/karpenter-provider-azure/pkg/apis/v1beta1"
+	"github.com/Azure/karpenter-provider-azure/pkg/providers/imagefamily/types"
+)
+
+func TestResolveNodeImage(t *testing.T) {
+	nodeImages := []v1beta1.NodeImage{
+		{
+			ID: "amd64-image",
+			Requirements: []v1.NodeSelectorRequirement{
+				{Key: v1.LabelArchStable, Operator: v1.NodeSelectorOpIn, Values: []string{karpv1.ArchitectureAmd64}},
+			},
+		},
+		{
+			ID: "arm64-image",
+			Requirements: []v1.NodeSelectorRequirement{
+				{Key: v1.LabelArchStable, Operator: v1.NodeSelectorOpIn, Values: []string{karpv1.ArchitectureArm64}},
+			},
+		},
+	}
+	// an instance type whose requirements allow either architecture
+	instanceType := &cloudprovider.InstanceType{
+		Name: "multi-arch",
+		Requirements: scheduling.NewRequirements(
+			scheduling.NewRequirement(v1.LabelArchStable, v1.NodeSelectorOpIn, karpv1.ArchitectureAmd64, karpv1.ArchitectureArm64),
+		),
+	}
+	nodeClaim := func(requirements ...v1.NodeSelectorRequirement) *karpv1.NodeClaim {
+		nodeClaim := &karpv1.NodeClaim{}
+		for _, requirement := range requirements {
+			nodeClaim.Spec.Requirements = append(nodeClaim.Spec.Requirements, karpv1.NodeSelectorRequirementWithMinValues{NodeSelectorRequirement: requirement})
+		}
+		return nodeClaim
+	}
+	r := &defaultResolver{}
+
+	// without a nodeclaim requirement, the image of highest priority is selected
+	imageID, err := r.resolveNodeImage(nodeImages, nodeClaim(), instanceType)
+	assert.NoError(t, err)
+	assert.Equal(t, "amd64-image", imageID)
+
+	// only the nodeclaim pins the architecture
+	imageID, err = r.resolveNodeImage(nodeImages, nodeClaim(
+		v1.NodeSelectorRequirement{Key: v1.LabelArchStable, Operator: v1.NodeSelectorOpIn, Values: []string{karpv1.ArchitectureArm64}},
+	), instanceType)
+	assert.NoError(t, err)
+	assert.Equal(t, "arm64-image", imageID)
+
+	// requirements of the nodeclaim on other labels don't affect the selection
+	imageID, err = r.resolveNodeImage(nodeImages, nodeClaim(
+		v1.NodeSelectorRequirement{Key: v1.LabelArchStable, Operator: v1.NodeSelectorOpNotIn, Values: []string{karpv1.ArchitectureAmd64}},
+		v1.NodeSelectorRequirement{Key: "team", Operator: v1.NodeSelectorOpIn, Values: []string{"a"}},
+	), instanceType)
+	assert.NoError(t, err)
+	assert.Equal(t, "arm64-image", imageID)
+
+	// the image must be compatible with both
+	_, err = r.resolveNodeImage(nodeImages[:1], nodeClaim(
+		v1.NodeSelectorRequirement{Key: v1.LabelArchStable, Operator: v1.NodeSelectorOpIn, Values: []string{karpv1.ArchitectureArm64}},
+	), instanceType)
+	assert.EqualError(t, err, "no compatible images found for instance type multi-arch")
+}
+
+func TestGetSupportedImagesConfidentialVM(t *testing.T) {
+	nodeClass := func(imageFamily string, securityType v1beta1.SecurityType) *v1beta1.AKSNodeClass {
+		return &v1beta1.AKSNodeClass{Spec: v1beta1.AKSNodeClassSpec{
+			ImageFamily: lo.ToPtr(imageFamily),
+			Security:    &v1beta1.Security{SecurityType: lo.ToPtr(securityType)},
+		}}
+	}
+	imageDefinitions := func(images []types.DefaultImageOutput) []string {
+		return lo.Map(images, func(image types.DefaultImageOutput, _ int) string { return image.ImageDefinition })
+	}
+
+	standard := nodeClass(v1beta1.Ubuntu2204ImageFamily, v1beta1.SecurityTypeStandard)
+	assert.Equal(t, []string{Ubuntu2204Gen2ImageDefinition, Ubuntu2204Gen1ImageDefinition, Ubuntu2204Gen2ArmImageDefinition},
+		imageDefinitions(getSupportedImages(standard, "1.31.0", true)))
+
+	confidential := nodeClass(v1beta1.Ubuntu2204ImageFamily, v1beta1.SecurityTypeConfidentialVM)
+	assert.Equal(t, []string{Ubuntu2204Gen2CVMImageDefinition}, imageDefinitions(getSupportedImages(confidential, "1.31.0", true)))
+	distro, err := mapToImageDistro(
+		"/subscriptions/10945678-1234-1234-1234-123456789012/resourceGroups/AKS-Ubuntu/providers/Microsoft.Compute/galleries/AKSUbuntu/images/2204gen2CVMcontainerd/versions/202506.03.0",
+		confidential, &Ubuntu2204{}, true)
+	assert.NoError(t, err)
+	assert.Equal(t, "aks-ubuntu-containerd-22.04-cvm-gen2", distro)
+
+	// image families without confidential VM images have no image confidential VMs can launch with
+	assert.Empty(t, getSupportedImages(nodeClass(v1beta1.AzureLinuxImageFamily, v1beta1.SecurityTypeConfidentialVM), "1.31.0", true))
+}
+
+func TestGetSupportedImagesTrustedLaunch(t *testing.T) {
+	imageDefinitions := func(images []types.DefaultImageOutput) []string {
+		return lo.Map(images, func(image types.DefaultImageOutput, _ int) string { return image.ImageDefinition })
+	}
+	trustedLaunch := &v1beta1.AKSNodeClass{Spec: v1beta1.AKSNodeClassSpec{
+		ImageFamily: lo.ToPtr(v1beta1.Ubuntu2204ImageFamily),
+		Security:    &v1beta1.Security{SecurityType: lo.ToPtr(v1beta1.SecurityTypeTrustedLaunch)},
+	}}
+
+	// the Gen1 image is never selected for trusted launch VMs
+	assert.Equal(t, []string{Ubuntu2204Gen2ImageDefinition, Ubuntu2204Gen2ArmImageDefinition},
+		imageDefinitions(getSupportedImages(trustedLaunch, "1.31.0", true)))
+	_, err := mapToImageDistro(
+		"/subscriptions/10945678-1234-1234-1234-123456789012/resourceGroups/AKS-Ubuntu/providers/Microsoft.Compute/galleries/AKSUbuntu/images/2204containerd/versions/202506.03.0",
+		trustedLaunch, &Ubuntu2204{}, true)
+	assert.Error(t, err)
+}
@@ -0,0 +1,140 @@
+/*
+Portions Copyright (c) Microsoft Corporation.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package imagefamily
+
+import (
+	"context"
+	"fmt"
+	"sort"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/compute/armcompute/v7"
+	"github.com/samber/lo"
+
+	"github.com/Azure/karpenter-provider-azure/pkg/apis/v1beta1"
+)
+
+const sharedGalleryImageIDFormat = "/SharedGalleries/%s/Images/%s/Versions/%s"
+
+// BuildImageIDSharedGallery returns the ID of the image version of a directly shared gallery, which VMs reference by
+// their shared gallery image ID
+func BuildImageIDSharedGallery(galleryUniqueName, imageDefinition, imageVersion string) string {
+	return fmt.Sprintf(sharedGalleryImageIDFormat, galleryUniqueName, imageDefinition, imageVersion)
+}
+
+// getSharedGalleryImageDefinition returns the image definition of the custom image term in its directly shared gallery,
+// as a gallery image definition, so that it's validated and required like the definitions of other custom images. It's
+// cached like them.
+func (p *provider) getSharedGalleryImageDefinition(ctx context.Context, clientFactory *armcompute.ClientFactory, imageTerm v1beta1.CustomImageTerm) (*armcompute.GalleryImage, error) {
+	key := fmt.Sprintf("/SharedGalleries/%s/Images/%s", imageTerm.SharedGalleryUniqueName, imageTerm.Name)
+	if cached, found := p.nodeImagesCache.Get(key); found {
+		return cached.(*armcompute.GalleryImage), nil
+	}
+	resp, err := clientFactory.NewSharedGalleryImagesClient().Get(ctx, p.location, imageTerm.SharedGalleryUniqueName, imageTerm.Name, nil)
+	if err != nil {
+		return nil, fmt.Errorf("getting shared gallery image definition %s, %w", key, err)
+	}
+	imageDefinition := &armcompute.GalleryImage{Name: resp.Name, Location: resp.Location}
+	if properties := resp.Properties; properties != nil {
+		imageDefinition.Tags = properties.ArtifactTags
+		imageDefinition.Properties = &armcompute.GalleryImageProperties{
+			OSState:          properties.OSState,
+			OSType:           properties.OSType,
+			Architecture:     properties.Architecture,
+			HyperVGeneration: properties.HyperVGeneration,
+		}
+	}
+	p.nodeImagesCache.SetDefault(key, imageDefinition)
+	return imageDefinition, nil
+}
+
+// getSharedGalleryImageVersion returns the version of the custom image term in its directly shared gallery, as a gallery
+// image version: its pinned version, or else its newest version satisfying its version constraint, with the tags of its
+// version tag selector, of the image channel, and not excluded from latest. The versions of a shared gallery are listed in the location, so they're replicated to it.
+func (p *provider) getSharedGalleryImageVersion(ctx context.Context, clientFactory *armcompute.ClientFactory, imageTerm v1beta1.CustomImageTerm, channel v1beta1.ImageChannel) (*armcompute.GalleryImageVersion, error) {
+	versionsClient := clientFactory.NewSharedGalleryImageVersionsClient()
+	if imageTerm.Version != "" {
+		resp, err := versionsClient.Get(ctx, p.location, imageTerm.SharedGalleryUniqueName, imageTerm.Name, imageTerm.Version, nil)
+		if err != nil {
+			return nil, err
+		}
+		return sharedGalleryImageVersion(imageTerm, &resp.SharedGalleryImageVersion), nil
+	}
+
+	versionRange, err := parseImageVersionConstraint(imageTerm.VersionConstraint)
+	if err != nil {
+		return nil, err
+	}
+	var imageVersions []*armcompute.SharedGalleryImageVersion
+	pager := versionsClient.NewListPager(p.location, imageTerm.SharedGalleryUniqueName, imageTerm.Name, nil)
+	for pager.More() {
+		page, err := pager.NextPage(ctx)
+		if err != nil {
+			return nil, err
+		}
+		imageVersions = append(imageVersions, page.Value...)
+	}
+	if len(imageVersions) == 0 {
+		return nil, &ImageVersionsNotFoundError{Gallery: imageTerm.SharedGalleryUniqueName, ImageDefinition: imageTerm.Name}
+	}
+	if versionRange != nil {
+		imageVersions = lo.Filter(imageVersions, func(imageVersion *armcompute.SharedGalleryImageVersion, _ int) bool {
+			return satisfiesImageVersionConstraint(versionRange, lo.FromPtr(imageVersion.Name))
+		})
+		if len(imageVersions) == 0 {
+			return nil, &ImageVersionConstraintError{Constraint: imageTerm.VersionConstraint, ImageDefinition: imageTerm.Name}
+		}
+	}
+	if len(imageTerm.VersionTagSelector) > 0 {
+		imageVersions = lo.Filter(imageVersions, func(imageVersion *armcompute.SharedGalleryImageVersion, _ int) bool {
+			return imageVersion.Properties != nil && matchesVersionTagSelector(imageTerm.VersionTagSelector, imageVersion.Properties.ArtifactTags)
+		})
+		if len(imageVersions) == 0 {
+			return nil, &ImageVersionTagSelectorError{Selector: imageTerm.VersionTagSelector, ImageDefinition: imageTerm.Name}
+		}
+	}
+	candidates := lo.Filter(imageVersions, func(imageVersion *armcompute.SharedGalleryImageVersion, _ int) bool {
+		if imageVersion.Properties == nil || imageVersion.Properties.PublishedDate == nil || lo.FromPtr(imageVersion.Properties.ExcludeFromLatest) {
+			return false
+		}
+		return isEligibleImageVersion(channel, isPreviewImageVersion(lo.FromPtr(imageVersion.Name), imageVersion.Properties.ArtifactTags))
+	})
+	if len(candidates) == 0 {
+		return nil, fmt.Errorf("shared gallery image %s/%s has none of its %d versions of the %s image channel eligible to be the latest",
+			imageTerm.SharedGalleryUniqueName, imageTerm.Name, len(imageVersions), channel)
+	}
+	sort.SliceStable(candidates, func(i, j int) bool {
+		return candidates[i].Properties.PublishedDate.After(*candidates[j].Properties.PublishedDate)
+	})
+	return sharedGalleryImageVersion(imageTerm, candidates[0]), nil
+}
+
+// sharedGalleryImageVersion returns the shared gallery image version as a gallery image version, identified by its
+// shared gallery image ID
+func sharedGalleryImageVersion(imageTerm v1beta1.CustomImageTerm, imageVersion *armcompute.SharedGalleryImageVersion) *armcompute.GalleryImageVersion {
+	galleryImageVersion := &armcompute.GalleryImageVersion{
+		ID:       lo.ToPtr(BuildImageIDSharedGallery(imageTerm.SharedGalleryUniqueName, imageTerm.Name, lo.FromPtr(imageVersion.Name))),
+		Name:     imageVersion.Name,
+		Location: imageVersion.Location,
+	}
+	if imageVersion.Properties != nil {
+		galleryImageVersion.Tags = imageVersion.Properties.ArtifactTags
+		galleryImageVersion.Properties = &armcompute.GalleryImageVersionProperties{
+			PublishingProfile: &armcompute.GalleryImageVersionPublishingProfile{PublishedDate: imageVersion.Properties.PublishedDate},
+		}
+	}
+	return galleryImageVersion
+}
@@ -0,0 +1,96 @@
+/*
+Portions Copyright (c) Microsoft Corporation.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package imagefamily
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/runtime"
+	"github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/compute/armcompute/v7"
+	"github.com/patrickmn/go-cache"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/samber/lo"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/Azure/karpenter-provider-azure/pkg/apis/v1beta1"
+	"github.com/Azure/karpenter-provider-azure/pkg/metrics"
+	"github.com/Azure/karpenter-provider-azure/pkg/operator/options"
+	"github.com/Azure/karpenter-provider-azure/pkg/providers/imagefamily/types"
+)
+
+type failingNodeImageVersions struct{ err error }
+
+func (f failingNodeImageVersions) List(_ context.Context, _, _ string) (types.NodeImageVersionsResponse, error) {
+	return types.NodeImageVersionsResponse{}, f.err
+}
+
+// staticCommunityImageVersions lists the same versions for every community image
+type staticCommunityImageVersions []*armcompute.CommunityGalleryImageVersion
+
+func (s staticCommunityImageVersions) NewListPager(_, _, _ string, _ *armcompute.CommunityGalleryImageVersionsClientListOptions) *runtime.Pager[armcompute.CommunityGalleryImageVersionsClientListResponse] {
+	return runtime.NewPager(runtime.PagingHandler[armcompute.CommunityGalleryImageVersionsClientListResponse]{
+		More: func(armcompute.CommunityGalleryImageVersionsClientListResponse) bool { return false },
+		Fetcher: func(context.Context, *armcompute.CommunityGalleryImageVersionsClientListResponse) (armcompute.CommunityGalleryImageVersionsClientListResponse, error) {
+			return armcompute.CommunityGalleryImageVersionsClientListResponse{
+				CommunityGalleryImageVersionList: armcompute.CommunityGalleryImageVersionList{Value: s},
+			}, nil
+		},
+	})
+}
+
+func (s staticCommunityImageVersions) Get(_ context.Context, _, _, _, _ string, _ *armcompute.CommunityGalleryImageVersionsClientGetOptions) (armcompute.CommunityGalleryImageVersionsClientGetResponse, error) {
+	return armcompute.CommunityGalleryImageVersionsClientGetResponse{CommunityGalleryImageVersion: *s[0]}, nil
+}
+
+func TestListSIGFallbackToCIG(t *testing.T) {
+	outage := errors.New("node image versions service unavailable")
+	p := NewProvider(staticCommunityImageVersions{{
+		Name:       lo.ToPtr("202506.03.0"),
+		Properties: &armcompute.CommunityGalleryImageVersionProperties{PublishedDate: lo.ToPtr(time.Now())},
+	}}, "westus", "00000000-0000-0000-0000-000000000000", failingNodeImageVersions{err: outage}, cache.New(ImageExpirationInterval, ImageCacheCleaningInterval))
+	nodeClass := &v1beta1.AKSNodeClass{Spec: v1beta1.AKSNodeClassSpec{ImageFamily: lo.ToPtr(v1beta1.Ubuntu2204ImageFamily)}}
+	nodeClass.StatusConditions().SetTrue(v1beta1.ConditionTypeKubernetesVersionReady)
+	nodeClass.Status.KubernetesVersion = "1.31.0"
+	fallbacks := testutil.ToFloat64(metrics.ImageSIGFallbacks.WithLabelValues(v1beta1.Ubuntu2204ImageFamily))
+
+	// without the fallback, the SIG failure fails the listing
+	_, err := p.List(options.ToContext(context.Background(), &options.Options{UseSIG: true}), nodeClass)
+	assert.ErrorIs(t, err, outage)
+	assert.Equal(t, fallbacks, testutil.ToFloat64(metrics.ImageSIGFallbacks.WithLabelValues(v1beta1.Ubuntu2204ImageFamily)))
+
+	// with it, the images are listed from the community galleries instead
+	ctx := options.ToContext(context.Background(), &options.Options{UseSIG: true, SIGFallbackToCIG: true})
+	nodeImages, err := p.List(ctx, nodeClass)
+	assert.NoError(t, err)
+	assert.NotEmpty(t, nodeImages)
+	for _, nodeImage := range nodeImages {
+		assert.True(t, strings.HasPrefix(nodeImage.ID, "/CommunityGalleries/"), nodeImage.ID)
+		assert.True(t, strings.HasSuffix(nodeImage.ID, "/versions/202506.03.0"), nodeImage.ID)
+		assert.True(t, nodeImage.Fallback, nodeImage.ID)
+	}
+	assert.Equal(t, fallbacks+1, testutil.ToFloat64(metrics.ImageSIGFallbacks.WithLabelValues(v1beta1.Ubuntu2204ImageFamily)))
+
+	// FIPS images have no community gallery images to fall back to
+	fipsNodeClass := nodeClass.DeepCopy()
+	fipsNodeClass.Spec.FIPSMode = lo.ToPtr(v1beta1.FIPSModeFIPS)
+	_, err = p.List(ctx, fipsNodeClass)
+	assert.ErrorIs(t, err, outage)
+}
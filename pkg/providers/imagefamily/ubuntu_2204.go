@@ -35,6 +35,7 @@ const (
 	Ubuntu2204Gen2ImageDefinition    = "2204gen2containerd"
 	Ubuntu2204Gen1ImageDefinition    = "2204containerd"
 	Ubuntu2204Gen2ArmImageDefinition = "2204gen2arm64containerd"
+	Ubuntu2204Gen2CVMImageDefinition = "2204gen2CVMcontainerd"
 )
 
 type Ubuntu2204 struct {
@@ -92,6 +93,23 @@ func (u Ubuntu2204) DefaultImages(useSIG bool, fipsMode *v1beta1.FIPSMode) []typ
 	}
 }
 
+// ConfidentialImages returns the confidential VM images, which are only gen2 amd64 images, as are the confidential VM sizes
+func (u Ubuntu2204) ConfidentialImages(_ bool) []types.DefaultImageOutput {
+	return []types.DefaultImageOutput{
+		{
+			PublicGalleryURL:     AKSUbuntuPublicGalleryURL,
+			GalleryResourceGroup: AKSUbuntuResourceGroup,
+			GalleryName:          AKSUbuntuGalleryName,
+			ImageDefinition:      Ubuntu2204Gen2CVMImageDefinition,
+			Requirements: scheduling.NewRequirements(
+				scheduling.NewRequirement(v1.LabelArchStable, v1.NodeSelectorOpIn, karpv1.ArchitectureAmd64),
+				scheduling.NewRequirement(v1beta1.LabelSKUHyperVGeneration, v1.NodeSelectorOpIn, v1beta1.HyperVGenerationV2),
+			),
+			Distro: "aks-ubuntu-containerd-22.04-cvm-gen2",
+		},
+	}
+}
+
 // UserData returns the default userdata script for the image Family
 func (u Ubuntu2204) ScriptlessCustomData(
 	kubeletConfig *bootstrap.KubeletConfiguration,
@@ -102,17 +120,20 @@ func (u Ubuntu2204) ScriptlessCustomData(
 ) bootstrap.Bootstrapper {
 	return bootstrap.AKS{
 		Options: bootstrap.Options{
-			ClusterName:      u.Options.ClusterName,
-			ClusterEndpoint:  u.Options.ClusterEndpoint,
-			KubeletConfig:    kubeletConfig,
-			Taints:           taints,
-			Labels:           labels,
-			CABundle:         caBundle,
-			GPUNode:          u.Options.GPUNode,
-			GPUDriverVersion: u.Options.GPUDriverVersion,
-			GPUDriverType:    u.Options.GPUDriverType,
-			GPUImageSHA:      u.Options.GPUImageSHA,
-			SubnetID:         u.Options.SubnetID,
+			ClusterName:               u.Options.ClusterName,
+			ClusterEndpoint:           u.Options.ClusterEndpoint,
+			KubeletConfig:             kubeletConfig,
+			Taints:                    taints,
+			Labels:                    labels,
+			CABundle:                  caBundle,
+			GPUNode:                   u.Options.GPUNode,
+			GPUDriverVersion:          u.Options.GPUDriverVersion,
+			GPUDriverType:             u.Options.GPUDriverType,
+			GPUImageSHA:               u.Options.GPUImageSHA,
+			SubnetID:                  u.Options.SubnetID,
+			CustomCATrustCertificates: u.Options.CustomCATrustCertificates,
+			RootFilesystemMinBytes:    u.Options.RootFilesystemMinBytes,
+			GPUDriverReadyTimeout:     u.Options.GPUDriverReadyTimeout,
 		},
 		Arch:                           u.Options.Arch,
 		TenantID:                       u.Options.TenantID,
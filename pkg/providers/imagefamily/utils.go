@@ -18,8 +18,14 @@ import (
 	"strings"
 
 	"github.com/blang/semver/v4"
+
+	"github.com/Azure/karpenter-provider-azure/pkg/providers/imagefamily/bootstrap"
 )
 
+// cgroupV1Distros are the distro markers of the images that still boot with cgroup v1: Ubuntu before 22.04, and
+// Azure Linux (CBL-Mariner) 2.0. Ubuntu 22.04+ and Azure Linux 3.0 use cgroup v2.
+var cgroupV1Distros = []string{"18.04", "20.04", "azurelinux-v2", "mariner-v2", "cblmariner"}
+
 // UseAzureLinux3 checks if the Kubernetes version is 1.32.0 or higher,
 // which is when Azure Linux 3 support starts
 func UseAzureLinux3(kubernetesVersion string) bool {
@@ -42,3 +48,13 @@ func UseUbuntu2404(kubernetesVersion string) bool {
 	}
 	return version.GE(semver.Version{Major: 1, Minor: 34})
 }
+
+// CgroupMode derives the cgroup mode of the image from its distro, which also covers the distro name of custom images
+func CgroupMode(imageDistro string) string {
+	for _, distro := range cgroupV1Distros {
+		if strings.Contains(imageDistro, distro) {
+			return bootstrap.CgroupModeV1
+		}
+	}
+	return bootstrap.CgroupModeV2
+}
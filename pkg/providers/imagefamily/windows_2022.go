@@ -0,0 +1,168 @@
+/*
+Portions Copyright (c) Microsoft Corporation.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package imagefamily
+
+import (
+	"context"
+	"fmt"
+
+	v1 "k8s.io/api/core/v1"
+
+	"github.com/Azure/karpenter-provider-azure/pkg/apis/v1beta1"
+	"github.com/Azure/karpenter-provider-azure/pkg/consts"
+	"github.com/Azure/karpenter-provider-azure/pkg/operator/options"
+	"github.com/Azure/karpenter-provider-azure/pkg/providers/imagefamily/bootstrap"
+	"github.com/Azure/karpenter-provider-azure/pkg/providers/imagefamily/customscriptsbootstrap"
+	types "github.com/Azure/karpenter-provider-azure/pkg/providers/imagefamily/types"
+	"github.com/Azure/karpenter-provider-azure/pkg/providers/launchtemplate/parameters"
+	"github.com/samber/lo"
+
+	karpv1 "sigs.k8s.io/karpenter/pkg/apis/v1"
+	"sigs.k8s.io/karpenter/pkg/cloudprovider"
+	"sigs.k8s.io/karpenter/pkg/scheduling"
+)
+
+const (
+	Windows2022Gen2ImageDefinition = "windows-2022-containerd-gen2"
+	Windows2022Gen1ImageDefinition = "windows-2022-containerd"
+)
+
+type Windows2022 struct {
+	Options *parameters.StaticParameters
+}
+
+func (w Windows2022) Name() string {
+	return v1beta1.Windows2022ImageFamily
+}
+
+func (w Windows2022) DefaultImages(useSIG bool, fipsMode *v1beta1.FIPSMode) []types.DefaultImageOutput {
+	// Note: the Windows images are only published in the shared image gallery of AKS, and there are no FIPS images yet
+	if !useSIG || lo.FromPtr(fipsMode) == v1beta1.FIPSModeFIPS {
+		return []types.DefaultImageOutput{}
+	}
+	// image provider will select these images in order, first match wins
+	return []types.DefaultImageOutput{
+		{
+			GalleryResourceGroup: AKSWindowsResourceGroup,
+			GalleryName:          AKSWindowsGalleryName,
+			ImageDefinition:      Windows2022Gen2ImageDefinition,
+			Requirements: scheduling.NewRequirements(
+				scheduling.NewRequirement(v1.LabelArchStable, v1.NodeSelectorOpIn, karpv1.ArchitectureAmd64),
+				scheduling.NewRequirement(v1beta1.LabelSKUHyperVGeneration, v1.NodeSelectorOpIn, v1beta1.HyperVGenerationV2),
+			),
+			Distro: "aks-windows-2022-containerd-gen2",
+		},
+		{
+			GalleryResourceGroup: AKSWindowsResourceGroup,
+			GalleryName:          AKSWindowsGalleryName,
+			ImageDefinition:      Windows2022Gen1ImageDefinition,
+			Requirements: scheduling.NewRequirements(
+				scheduling.NewRequirement(v1.LabelArchStable, v1.NodeSelectorOpIn, karpv1.ArchitectureAmd64),
+				scheduling.NewRequirement(v1beta1.LabelSKUHyperVGeneration, v1.NodeSelectorOpIn, v1beta1.HyperVGenerationV1),
+			),
+			Distro: "aks-windows-2022-containerd",
+		},
+	}
+}
+
+// ScriptlessCustomData returns the PowerShell bootstrap script of Windows nodes, run by the Windows CSE
+func (w Windows2022) ScriptlessCustomData(
+	kubeletConfig *bootstrap.KubeletConfiguration,
+	taints []v1.Taint,
+	labels map[string]string,
+	caBundle *string,
+	_ *cloudprovider.InstanceType,
+) bootstrap.Bootstrapper {
+	return bootstrap.Windows{
+		Options: bootstrap.Options{
+			ClusterName:     w.Options.ClusterName,
+			ClusterEndpoint: w.Options.ClusterEndpoint,
+			KubeletConfig:   kubeletConfig,
+			Taints:          taints,
+			Labels:          labels,
+			CABundle:        caBundle,
+			SubnetID:        w.Options.SubnetID,
+		},
+		TenantID:                       w.Options.TenantID,
+		SubscriptionID:                 w.Options.SubscriptionID,
+		Location:                       w.Options.Location,
+		KubeletIdentityClientID:        w.Options.KubeletIdentityClientID,
+		ResourceGroup:                  w.Options.ResourceGroup,
+		APIServerName:                  w.Options.APIServerName,
+		KubeletClientTLSBootstrapToken: w.Options.KubeletClientTLSBootstrapToken,
+		KubernetesVersion:              w.Options.KubernetesVersion,
+	}
+}
+
+// CustomScriptsNodeBootstrapping isn't supported for Windows yet, ValidateWindows rejects it ahead of the launch
+func (w Windows2022) CustomScriptsNodeBootstrapping(
+	kubeletConfig *bootstrap.KubeletConfiguration,
+	taints []v1.Taint,
+	startupTaints []v1.Taint,
+	labels map[string]string,
+	instanceType *cloudprovider.InstanceType,
+	imageDistro string,
+	storageProfile string,
+	nodeBootstrappingClient types.NodeBootstrappingAPI,
+	fipsMode *v1beta1.FIPSMode,
+) customscriptsbootstrap.Bootstrapper {
+	return customscriptsbootstrap.ProvisionClientBootstrap{
+		ClusterName:                    w.Options.ClusterName,
+		KubeletConfig:                  kubeletConfig,
+		Taints:                         taints,
+		StartupTaints:                  startupTaints,
+		Labels:                         labels,
+		SubnetID:                       w.Options.SubnetID,
+		Arch:                           w.Options.Arch,
+		SubscriptionID:                 w.Options.SubscriptionID,
+		ResourceGroup:                  w.Options.ResourceGroup,
+		KubeletClientTLSBootstrapToken: w.Options.KubeletClientTLSBootstrapToken,
+		KubernetesVersion:              w.Options.KubernetesVersion,
+		ImageDistro:                    imageDistro,
+		InstanceType:                   instanceType,
+		StorageProfile:                 storageProfile,
+		ClusterResourceGroup:           w.Options.ClusterResourceGroup,
+		NodeBootstrappingProvider:      nodeBootstrappingClient,
+		IsWindows:                      true,
+		FIPSMode:                       fipsMode,
+	}
+}
+
+// IsWindows returns whether the image family is a Windows one
+func IsWindows(familyName *string) bool {
+	return v1beta1.WindowsFamilies.Has(lo.FromPtr(familyName))
+}
+
+// ValidateWindows rejects the launches of Windows nodes the cluster or the nodeclaim can't support: Windows nodes need
+// Azure CNI without the Cilium dataplane, are bootstrapped by Karpenter itself, and only run on amd64
+func ValidateWindows(ctx context.Context, nodeClaim *karpv1.NodeClaim) error {
+	opts := options.FromContext(ctx)
+	if opts.NetworkPlugin != consts.NetworkPluginAzure {
+		return fmt.Errorf("windows nodes require network plugin %s, got %q", consts.NetworkPluginAzure, opts.NetworkPlugin)
+	}
+	if opts.NetworkDataplane == consts.NetworkDataplaneCilium {
+		return fmt.Errorf("windows nodes do not support network dataplane %s", consts.NetworkDataplaneCilium)
+	}
+	if opts.ProvisionMode == consts.ProvisionModeBootstrappingClient {
+		return fmt.Errorf("windows nodes do not support provision mode %s", consts.ProvisionModeBootstrappingClient)
+	}
+	architectures := scheduling.NewNodeSelectorRequirementsWithMinValues(nodeClaim.Spec.Requirements...).Get(v1.LabelArchStable)
+	if !architectures.Has(karpv1.ArchitectureAmd64) {
+		return fmt.Errorf("windows nodes only support architecture %s, got requirement %s", karpv1.ArchitectureAmd64, architectures)
+	}
+	return nil
+}
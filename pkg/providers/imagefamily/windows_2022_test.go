@@ -0,0 +1,151 @@
+/*
+Portions Copyright (c) Microsoft Corporation.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package imagefamily_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/samber/lo"
+	"github.com/stretchr/testify/assert"
+	v1 "k8s.io/api/core/v1"
+	karpv1 "sigs.k8s.io/karpenter/pkg/apis/v1"
+
+	"github.com/Azure/karpenter-provider-azure/pkg/apis/v1beta1"
+	"github.com/Azure/karpenter-provider-azure/pkg/consts"
+	"github.com/Azure/karpenter-provider-azure/pkg/operator/options"
+	"github.com/Azure/karpenter-provider-azure/pkg/providers/imagefamily"
+	"github.com/Azure/karpenter-provider-azure/pkg/providers/imagefamily/bootstrap"
+	template "github.com/Azure/karpenter-provider-azure/pkg/providers/launchtemplate/parameters"
+)
+
+func TestWindows2022_Name(t *testing.T) {
+	windows := &imagefamily.Windows2022{
+		Options: &template.StaticParameters{},
+	}
+	assert.Equal(t, v1beta1.Windows2022ImageFamily, windows.Name())
+	assert.Equal(t, windows, imagefamily.GetImageFamily(lo.ToPtr(v1beta1.Windows2022ImageFamily), nil, "1.33.0", windows.Options))
+	assert.True(t, imagefamily.IsWindows(lo.ToPtr(v1beta1.Windows2022ImageFamily)))
+	assert.False(t, imagefamily.IsWindows(lo.ToPtr(v1beta1.Ubuntu2204ImageFamily)))
+}
+
+func TestWindows2022_DefaultImages(t *testing.T) {
+	windows := &imagefamily.Windows2022{
+		Options: &template.StaticParameters{},
+	}
+
+	t.Run("should return the images of the shared image gallery", func(t *testing.T) {
+		images := windows.DefaultImages(true, nil)
+		assert.Len(t, images, 2)
+
+		assert.Equal(t, imagefamily.Windows2022Gen2ImageDefinition, images[0].ImageDefinition)
+		assert.Equal(t, imagefamily.AKSWindowsGalleryName, images[0].GalleryName)
+		assert.Equal(t, "aks-windows-2022-containerd-gen2", images[0].Distro)
+
+		assert.Equal(t, imagefamily.Windows2022Gen1ImageDefinition, images[1].ImageDefinition)
+		assert.Equal(t, "aks-windows-2022-containerd", images[1].Distro)
+
+		for _, image := range images {
+			assert.Equal(t, []string{karpv1.ArchitectureAmd64}, image.Requirements.Get(v1.LabelArchStable).Values())
+		}
+	})
+
+	t.Run("should return empty images without SIG", func(t *testing.T) {
+		assert.Empty(t, windows.DefaultImages(false, nil))
+	})
+
+	t.Run("should return empty images for FIPS mode", func(t *testing.T) {
+		assert.Empty(t, windows.DefaultImages(true, &v1beta1.FIPSModeFIPS))
+	})
+}
+
+func TestWindows2022_ScriptlessCustomData(t *testing.T) {
+	windows := &imagefamily.Windows2022{
+		Options: &template.StaticParameters{
+			KubernetesVersion:              "1.33.0",
+			KubeletClientTLSBootstrapToken: "test-bootstrap-token",
+			APIServerName:                  "test-api-server",
+		},
+	}
+	bootstrapper := windows.ScriptlessCustomData(nil, nil, nil, lo.ToPtr("Y2E="), nil)
+	windowsBootstrapper, ok := bootstrapper.(bootstrap.Windows)
+	assert.True(t, ok, "Expected Windows bootstrapper type")
+	assert.Equal(t, "test-api-server", windowsBootstrapper.APIServerName)
+}
+
+func TestValidateWindows(t *testing.T) {
+	nodeClaim := func(architectures ...string) *karpv1.NodeClaim {
+		nodeClaim := &karpv1.NodeClaim{}
+		if len(architectures) > 0 {
+			nodeClaim.Spec.Requirements = []karpv1.NodeSelectorRequirementWithMinValues{{
+				NodeSelectorRequirement: v1.NodeSelectorRequirement{Key: v1.LabelArchStable, Operator: v1.NodeSelectorOpIn, Values: architectures},
+			}}
+		}
+		return nodeClaim
+	}
+	tests := []struct {
+		name      string
+		options   options.Options
+		nodeClaim *karpv1.NodeClaim
+		wantErr   string
+	}{
+		{
+			name:      "Azure CNI",
+			options:   options.Options{NetworkPlugin: consts.NetworkPluginAzure},
+			nodeClaim: nodeClaim(),
+		},
+		{
+			name:      "Azure CNI overlay, amd64 or arm64",
+			options:   options.Options{NetworkPlugin: consts.NetworkPluginAzure, NetworkPluginMode: consts.NetworkPluginModeOverlay},
+			nodeClaim: nodeClaim(karpv1.ArchitectureAmd64, karpv1.ArchitectureArm64),
+		},
+		{
+			name:      "no network plugin",
+			options:   options.Options{NetworkPlugin: consts.NetworkPluginNone},
+			nodeClaim: nodeClaim(),
+			wantErr:   "windows nodes require network plugin azure",
+		},
+		{
+			name:      "Cilium dataplane",
+			options:   options.Options{NetworkPlugin: consts.NetworkPluginAzure, NetworkDataplane: consts.NetworkDataplaneCilium},
+			nodeClaim: nodeClaim(),
+			wantErr:   "windows nodes do not support network dataplane cilium",
+		},
+		{
+			name:      "bootstrapping client",
+			options:   options.Options{NetworkPlugin: consts.NetworkPluginAzure, ProvisionMode: consts.ProvisionModeBootstrappingClient},
+			nodeClaim: nodeClaim(),
+			wantErr:   "windows nodes do not support provision mode",
+		},
+		{
+			name:      "arm64",
+			options:   options.Options{NetworkPlugin: consts.NetworkPluginAzure},
+			nodeClaim: nodeClaim(karpv1.ArchitectureArm64),
+			wantErr:   "windows nodes only support architecture amd64",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := imagefamily.ValidateWindows(options.ToContext(context.Background(), &tt.options), tt.nodeClaim)
+			if tt.wantErr == "" {
+				assert.NoError(t, err)
+			} else {
+				assert.ErrorContains(t, err, tt.wantErr)
+			}
+		})
+	}
+}
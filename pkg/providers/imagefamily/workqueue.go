@@ -0,0 +1,233 @@
+/*
+Portions Copyright (c) Microsoft Corporation.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package imagefamily
+
+import (
+	"container/heap"
+	"context"
+	"sync"
+
+	"github.com/Azure/karpenter-provider-azure/pkg/metrics"
+)
+
+// imageWorkQueueConcurrency is how many image lookups are issued to ARM at once, one of which is kept for launches
+const imageWorkQueueConcurrency = 4
+
+// Priority is the priority of an image lookup in the image work queue
+type Priority int
+
+const (
+	// PriorityRefresh is the priority of the background refresh of the images of the AKSNodeClasses
+	PriorityRefresh Priority = iota
+	// PriorityProbe is the priority of the probes of the image sources of the AKSNodeClasses
+	PriorityProbe
+	// PriorityLaunch is the priority of the lookups of the images VMs are launched with
+	PriorityLaunch
+)
+
+func (p Priority) String() string {
+	switch p {
+	case PriorityLaunch:
+		return "launch"
+	case PriorityProbe:
+		return "probe"
+	default:
+		return "refresh"
+	}
+}
+
+type priorityContextKey struct{}
+
+// WithPriority returns a context whose image lookups are queued with the priority
+func WithPriority(ctx context.Context, priority Priority) context.Context {
+	return context.WithValue(ctx, priorityContextKey{}, priority)
+}
+
+// priorityFromContext returns the priority of the image lookups of the context, or else the default priority
+func priorityFromContext(ctx context.Context, defaultPriority Priority) Priority {
+	if priority, ok := ctx.Value(priorityContextKey{}).(Priority); ok {
+		return priority
+	}
+	return defaultPriority
+}
+
+// work is an image lookup, queued or in flight, shared by all the callers of its key
+type work struct {
+	key      string
+	priority Priority
+	// seq orders the work of the same priority by when it was queued
+	seq uint64
+	// index is the index of the work in the queue, or -1 once it's in flight
+	index int
+	// ctx is the context of the caller that queued the work without its cancellation, so that the work is shared by all
+	// the callers of its key rather than tied to the first. It's canceled once no caller waits for the work anymore.
+	ctx    context.Context
+	cancel context.CancelFunc
+	do     func(context.Context) (any, error)
+	// waiters is the number of callers waiting for the work
+	waiters int
+
+	done   chan struct{}
+	result any
+	err    error
+}
+
+// workHeap orders the queued work by priority, and then by when it was queued
+type workHeap []*work
+
+func (h workHeap) Len() int { return len(h) }
+func (h workHeap) Less(i, j int) bool {
+	if h[i].priority != h[j].priority {
+		return h[i].priority > h[j].priority
+	}
+	return h[i].seq < h[j].seq
+}
+func (h workHeap) Swap(i, j int) {
+	h[i], h[j] = h[j], h[i]
+	h[i].index = i
+	h[j].index = j
+}
+func (h *workHeap) Push(x any) {
+	w := x.(*work)
+	w.index = len(*h)
+	*h = append(*h, w)
+}
+func (h *workHeap) Pop() any {
+	old := *h
+	w := old[len(old)-1]
+	old[len(old)-1] = nil
+	w.index = -1
+	*h = old[:len(old)-1]
+	return w
+}
+
+// workQueue issues the image lookups of the launches, probes and background refreshes, which would otherwise overlap
+// and get throttled by the galleries, by priority with bounded concurrency. Lookups of the same key join the one queued
+// or in flight rather than being issued again, raising its priority if theirs is higher. Lookups other than launches
+// are only issued while more than one slot is free, so that a launch never waits for background work.
+type workQueue struct {
+	mu       sync.Mutex
+	limit    int
+	inFlight int
+	queued   workHeap
+	// work is the queued and in flight work by key
+	work map[string]*work
+	seq  uint64
+}
+
+// newWorkQueue returns a queue issuing up to limit lookups at once, which is at least 2 so that background work can be
+// issued alongside the slot kept for launches
+func newWorkQueue(limit int) *workQueue {
+	return &workQueue{
+		limit: max(limit, 2),
+		work:  map[string]*work{},
+	}
+}
+
+// do returns the result of the lookup of the key, issuing it with the priority once a slot is free unless the same key
+// is already queued or in flight. It returns early if the context is done, leaving the lookup to the other callers. The
+// lookup is passed the context of the caller that queued it without its cancellation, as it's shared by the callers that
+// joined it, and is only canceled once the contexts of all of them are done.
+func (q *workQueue) do(ctx context.Context, key string, priority Priority, do func(context.Context) (any, error)) (any, error) {
+	q.mu.Lock()
+	w, ok := q.work[key]
+	if ok {
+		metrics.ImageWorkQueueDedupeHits.Inc()
+		if w.index >= 0 && priority > w.priority {
+			metrics.ImageWorkQueueDepth.WithLabelValues(w.priority.String()).Dec()
+			metrics.ImageWorkQueueDepth.WithLabelValues(priority.String()).Inc()
+			w.priority = priority
+			heap.Fix(&q.queued, w.index)
+			q.dispatch()
+		}
+	} else {
+		q.seq++
+		w = &work{key: key, priority: priority, seq: q.seq, do: do, done: make(chan struct{})}
+		w.ctx, w.cancel = context.WithCancel(context.WithoutCancel(ctx))
+		q.work[key] = w
+		heap.Push(&q.queued, w)
+		metrics.ImageWorkQueueDepth.WithLabelValues(priority.String()).Inc()
+		q.dispatch()
+	}
+	w.waiters++
+	q.mu.Unlock()
+
+	select {
+	case <-w.done:
+		return w.result, w.err
+	case <-ctx.Done():
+		q.leave(w)
+		return nil, ctx.Err()
+	}
+}
+
+// leave stops a caller from waiting for the work, canceling it, or dropping it if it's still queued, once no caller
+// waits for it anymore
+func (q *workQueue) leave(w *work) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	w.waiters--
+	if w.waiters > 0 || q.work[w.key] != w {
+		return
+	}
+	// later callers of the key issue it again rather than joining the canceled work
+	delete(q.work, w.key)
+	w.cancel()
+	if w.index >= 0 {
+		heap.Remove(&q.queued, w.index)
+		metrics.ImageWorkQueueDepth.WithLabelValues(w.priority.String()).Dec()
+	}
+}
+
+// dispatch issues the queued work while slots are free. It's called with the lock held.
+func (q *workQueue) dispatch() {
+	for q.queued.Len() > 0 && q.inFlight < q.limit {
+		// the work is ordered by priority, so that if the next isn't a launch, none is
+		if q.queued[0].priority != PriorityLaunch && q.inFlight >= q.limit-1 {
+			return
+		}
+		w := heap.Pop(&q.queued).(*work)
+		metrics.ImageWorkQueueDepth.WithLabelValues(w.priority.String()).Dec()
+		q.inFlight++
+		go q.run(w)
+	}
+}
+
+func (q *workQueue) run(w *work) {
+	result, err := w.do(w.ctx)
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	w.result, w.err = result, err
+	w.cancel()
+	if q.work[w.key] == w {
+		delete(q.work, w.key)
+	}
+	q.inFlight--
+	close(w.done)
+	q.dispatch()
+}
+
+// queueList queues a listing of images of the key with the priority of the context, refresh by default
+func (p *provider) queueList(ctx context.Context, key string, list func(context.Context) ([]NodeImage, error)) ([]NodeImage, error) {
+	nodeImages, err := p.workQueue.do(ctx, "list-"+key, priorityFromContext(ctx, PriorityRefresh), func(ctx context.Context) (any, error) {
+		return list(ctx)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return nodeImages.([]NodeImage), nil
+}
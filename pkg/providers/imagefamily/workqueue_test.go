@@ -0,0 +1,207 @@
+/*
+Portions Copyright (c) Microsoft Corporation.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package imagefamily
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/Azure/karpenter-provider-azure/pkg/metrics"
+)
+
+// blockingWork is work of the queue blocking until it's released, recording the order it was issued in
+type blockingWork struct {
+	mu      sync.Mutex
+	started []string
+	release map[string]chan struct{}
+}
+
+func newBlockingWork() *blockingWork {
+	return &blockingWork{release: map[string]chan struct{}{}}
+}
+
+func (b *blockingWork) do(key string) func(context.Context) (any, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	release := make(chan struct{})
+	b.release[key] = release
+	return func(context.Context) (any, error) {
+		b.mu.Lock()
+		b.started = append(b.started, key)
+		b.mu.Unlock()
+		<-release
+		return key, nil
+	}
+}
+
+func (b *blockingWork) Started() []string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return append([]string{}, b.started...)
+}
+
+func (b *blockingWork) Release(key string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	close(b.release[key])
+}
+
+// queue queues the work of the key in the background, returning a channel receiving its result
+func queue(q *workQueue, b *blockingWork, key string, priority Priority) <-chan any {
+	result := make(chan any, 1)
+	do := b.do(key)
+	go func() {
+		r, _ := q.do(context.Background(), key, priority, do)
+		result <- r
+	}()
+	return result
+}
+
+func queuedDepth(priority Priority) float64 {
+	return testutil.ToFloat64(metrics.ImageWorkQueueDepth.WithLabelValues(priority.String()))
+}
+
+func TestWorkQueueLaunchJumpsAheadOfQueuedRefreshes(t *testing.T) {
+	q := newWorkQueue(2)
+	b := newBlockingWork()
+	refreshDepth := queuedDepth(PriorityRefresh)
+
+	// a refresh takes the only slot available to background work, the other refreshes are queued behind it
+	queue(q, b, "refresh-1", PriorityRefresh)
+	assert.Eventually(t, func() bool { return len(b.Started()) == 1 }, time.Second, time.Millisecond)
+	queue(q, b, "refresh-2", PriorityRefresh)
+	assert.Eventually(t, func() bool { return queuedDepth(PriorityRefresh) == refreshDepth+1 }, time.Second, time.Millisecond)
+	queue(q, b, "refresh-3", PriorityRefresh)
+	assert.Eventually(t, func() bool { return queuedDepth(PriorityRefresh) == refreshDepth+2 }, time.Second, time.Millisecond)
+
+	// a launch takes the slot kept for launches right away
+	launch1 := queue(q, b, "launch-1", PriorityLaunch)
+	assert.Eventually(t, func() bool { return len(b.Started()) == 2 }, time.Second, time.Millisecond)
+	assert.Equal(t, []string{"refresh-1", "launch-1"}, b.Started())
+
+	// a launch queued after the refreshes while all slots are taken is issued ahead of them
+	launchDepth := queuedDepth(PriorityLaunch)
+	queue(q, b, "launch-2", PriorityLaunch)
+	assert.Eventually(t, func() bool { return queuedDepth(PriorityLaunch) == launchDepth+1 }, time.Second, time.Millisecond)
+	b.Release("launch-1")
+	assert.Equal(t, "launch-1", <-launch1)
+	assert.Eventually(t, func() bool { return len(b.Started()) == 3 }, time.Second, time.Millisecond)
+	assert.Equal(t, []string{"refresh-1", "launch-1", "launch-2"}, b.Started())
+
+	// the refreshes are only issued while the slot kept for launches is free, and then in order
+	b.Release("refresh-1")
+	assert.Never(t, func() bool { return len(b.Started()) > 3 }, 50*time.Millisecond, time.Millisecond)
+	b.Release("launch-2")
+	assert.Eventually(t, func() bool { return len(b.Started()) == 4 }, time.Second, time.Millisecond)
+	b.Release("refresh-2")
+	assert.Eventually(t, func() bool { return len(b.Started()) == 5 }, time.Second, time.Millisecond)
+	assert.Equal(t, []string{"refresh-1", "launch-1", "launch-2", "refresh-2", "refresh-3"}, b.Started())
+	b.Release("refresh-3")
+	assert.Eventually(t, func() bool { return queuedDepth(PriorityRefresh) == refreshDepth }, time.Second, time.Millisecond)
+}
+
+func TestWorkQueueDedupe(t *testing.T) {
+	q := newWorkQueue(2)
+	b := newBlockingWork()
+	hits := testutil.ToFloat64(metrics.ImageWorkQueueDedupeHits)
+	refreshDepth := queuedDepth(PriorityRefresh)
+
+	// the background slot is taken, so that the next refresh is queued
+	queue(q, b, "refresh-1", PriorityRefresh)
+	assert.Eventually(t, func() bool { return len(b.Started()) == 1 }, time.Second, time.Millisecond)
+	refresh := queue(q, b, "refresh-2", PriorityRefresh)
+	assert.Eventually(t, func() bool { return queuedDepth(PriorityRefresh) == refreshDepth+1 }, time.Second, time.Millisecond)
+
+	// a launch of the same key joins the queued refresh rather than being issued again, raising its priority so that it's
+	// issued right away
+	launch := make(chan any, 1)
+	go func() {
+		r, _ := q.do(context.Background(), "refresh-2", PriorityLaunch, func(context.Context) (any, error) {
+			return "launch", nil
+		})
+		launch <- r
+	}()
+	assert.Eventually(t, func() bool { return len(b.Started()) == 2 }, time.Second, time.Millisecond)
+	assert.Equal(t, []string{"refresh-1", "refresh-2"}, b.Started())
+	assert.Equal(t, hits+1, testutil.ToFloat64(metrics.ImageWorkQueueDedupeHits))
+
+	// both callers get the result of the joined work
+	b.Release("refresh-2")
+	assert.Equal(t, "refresh-2", <-refresh)
+	assert.Equal(t, "refresh-2", <-launch)
+	b.Release("refresh-1")
+
+	// once done, the key is issued again
+	r, err := q.do(context.Background(), "refresh-2", PriorityRefresh, func(context.Context) (any, error) { return "again", nil })
+	assert.NoError(t, err)
+	assert.Equal(t, "again", r)
+}
+
+func TestWorkQueueContextDone(t *testing.T) {
+	q := newWorkQueue(2)
+	b := newBlockingWork()
+	queue(q, b, "refresh-1", PriorityRefresh)
+	assert.Eventually(t, func() bool { return len(b.Started()) == 1 }, time.Second, time.Millisecond)
+
+	// a caller whose context is done stops waiting for its queued work
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err := q.do(ctx, "refresh-2", PriorityRefresh, func(context.Context) (any, error) { return nil, nil })
+	assert.ErrorIs(t, err, context.Canceled)
+	b.Release("refresh-1")
+}
+
+func TestWorkQueueOutlivesIssuerContext(t *testing.T) {
+	q := newWorkQueue(2)
+	issuerCtx, cancel := context.WithCancel(context.Background())
+	started := make(chan struct{})
+	release := make(chan struct{})
+	workCtx := make(chan context.Context, 1)
+	issued := make(chan error, 1)
+	go func() {
+		_, err := q.do(issuerCtx, "refresh-1", PriorityRefresh, func(ctx context.Context) (any, error) {
+			workCtx <- ctx
+			close(started)
+			<-release
+			return "issued", ctx.Err()
+		})
+		issued <- err
+	}()
+	<-started
+	hits := testutil.ToFloat64(metrics.ImageWorkQueueDedupeHits)
+
+	// a caller joining the work of a caller canceled meanwhile gets the result of the work, which isn't canceled along
+	// with the context of the caller that queued it
+	joined := make(chan any, 1)
+	go func() {
+		r, _ := q.do(context.Background(), "refresh-1", PriorityRefresh, func(context.Context) (any, error) { return "joined", nil })
+		joined <- r
+	}()
+	assert.Eventually(t, func() bool {
+		return testutil.ToFloat64(metrics.ImageWorkQueueDedupeHits) == hits+1
+	}, time.Second, time.Millisecond)
+	cancel()
+	assert.ErrorIs(t, <-issued, context.Canceled)
+	assert.NoError(t, (<-workCtx).Err())
+	close(release)
+	assert.Equal(t, "issued", <-joined)
+}
@@ -18,12 +18,19 @@ package instance
 
 import (
 	"context"
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
 
 	"sigs.k8s.io/controller-runtime/pkg/log"
 
 	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/arm"
 	"github.com/Azure/azure-sdk-for-go/sdk/azcore/runtime"
+	"github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/authorization/armauthorization/v2"
 	"github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/compute/armcompute/v7"
+	"github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/msi/armmsi"
 	"github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/network/armnetwork"
 	"github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/resourcegraph/armresourcegraph"
 	"github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/resources/armsubscriptions"
@@ -35,6 +42,7 @@ import (
 	"github.com/Azure/karpenter-provider-azure/pkg/providers/instance/skuclient"
 	"github.com/Azure/karpenter-provider-azure/pkg/providers/loadbalancer"
 	"github.com/Azure/karpenter-provider-azure/pkg/providers/networksecuritygroup"
+	"github.com/Azure/karpenter-provider-azure/pkg/providers/spotplacementscore"
 	"github.com/Azure/karpenter-provider-azure/pkg/providers/zone"
 	"github.com/Azure/skewer"
 
@@ -64,17 +72,43 @@ type NetworkInterfacesAPI interface {
 	UpdateTags(ctx context.Context, resourceGroupName string, networkInterfaceName string, tags armnetwork.TagsObject, options *armnetwork.InterfacesClientUpdateTagsOptions) (armnetwork.InterfacesClientUpdateTagsResponse, error)
 }
 
+type DisksAPI interface {
+	Get(ctx context.Context, resourceGroupName string, diskName string, options *armcompute.DisksClientGetOptions) (armcompute.DisksClientGetResponse, error)
+	BeginUpdate(ctx context.Context, resourceGroupName string, diskName string, disk armcompute.DiskUpdate, options *armcompute.DisksClientBeginUpdateOptions) (*runtime.Poller[armcompute.DisksClientUpdateResponse], error)
+}
+
 type SubnetsAPI interface {
 	Get(ctx context.Context, resourceGroupName string, virtualNetworkName string, subnetName string, options *armnetwork.SubnetsClientGetOptions) (armnetwork.SubnetsClientGetResponse, error)
 }
 
+type NatGatewaysAPI interface {
+	Get(ctx context.Context, resourceGroupName string, natGatewayName string, options *armnetwork.NatGatewaysClientGetOptions) (armnetwork.NatGatewaysClientGetResponse, error)
+}
+
+type RouteTablesAPI interface {
+	Get(ctx context.Context, resourceGroupName string, routeTableName string, options *armnetwork.RouteTablesClientGetOptions) (armnetwork.RouteTablesClientGetResponse, error)
+}
+
+type UserAssignedIdentitiesAPI interface {
+	Get(ctx context.Context, resourceGroupName string, resourceName string, options *armmsi.UserAssignedIdentitiesClientGetOptions) (armmsi.UserAssignedIdentitiesClientGetResponse, error)
+}
+
+type PermissionsAPI interface {
+	NewListForResourcePager(resourceGroupName string, resourceProviderNamespace string, parentResourcePath string, resourceType string, resourceName string, options *armauthorization.PermissionsClientListForResourceOptions) *runtime.Pager[armauthorization.PermissionsClientListForResourceResponse]
+}
+
 // TODO: Move this to another package that more correctly reflects its usage across multiple providers
 type AZClient struct {
 	azureResourceGraphClient       AzureResourceGraphAPI
 	virtualMachinesClient          VirtualMachinesAPI
 	virtualMachinesExtensionClient VirtualMachineExtensionsAPI
 	networkInterfacesClient        NetworkInterfacesAPI
+	disksClient                    DisksAPI
 	subnetsClient                  SubnetsAPI
+	natGatewaysClient              NatGatewaysAPI
+	routeTablesClient              RouteTablesAPI
+	permissionsClient              PermissionsAPI
+	userAssignedIdentitiesClient   UserAssignedIdentitiesAPI
 
 	NodeImageVersionsClient imagefamilytypes.NodeImageVersionsAPI
 	ImageVersionsClient     imagefamilytypes.CommunityGalleryImageVersionsAPI
@@ -84,18 +118,116 @@ type AZClient struct {
 	LoadBalancersClient         loadbalancer.LoadBalancersAPI
 	NetworkSecurityGroupsClient networksecuritygroup.API
 	SubscriptionsClient         zone.SubscriptionsAPI
+	SpotPlacementScoresClient   spotplacementscore.API
+
+	// clients of other subscriptions node resources are created in, see ForSubscription
+	newSubscriptionClient func(subscriptionID string) (*AZClient, error)
+	subscriptionClientsMu sync.Mutex
+	subscriptionClients   map[string]*AZClient
+
+	// clients creating VMs from the images of galleries of other tenants, see VirtualMachinesClientForTenant
+	newAuxiliaryTenantClient func(tenantID string) (VirtualMachinesAPI, error)
+	auxiliaryTenantClientsMu sync.Mutex
+	auxiliaryTenantClients   map[string]VirtualMachinesAPI
 }
 
 func (c *AZClient) SubnetsClient() SubnetsAPI {
 	return c.subnetsClient
 }
 
+func (c *AZClient) NatGatewaysClient() NatGatewaysAPI {
+	return c.natGatewaysClient
+}
+
+func (c *AZClient) RouteTablesClient() RouteTablesAPI {
+	return c.routeTablesClient
+}
+
+func (c *AZClient) PermissionsClient() PermissionsAPI {
+	return c.permissionsClient
+}
+
+func (c *AZClient) UserAssignedIdentitiesClient() UserAssignedIdentitiesAPI {
+	return c.userAssignedIdentitiesClient
+}
+
+func (c *AZClient) AzureResourceGraphClient() AzureResourceGraphAPI {
+	return c.azureResourceGraphClient
+}
+
+// WithSubscriptionClients sets how the clients of subscriptions other than the cluster's are constructed
+func (c *AZClient) WithSubscriptionClients(newClient func(subscriptionID string) (*AZClient, error)) *AZClient {
+	c.newSubscriptionClient = newClient
+	return c
+}
+
+// WithAuxiliaryTenantClients sets how the VM clients authorized with an auxiliary token of other tenants are constructed
+func (c *AZClient) WithAuxiliaryTenantClients(newClient func(tenantID string) (VirtualMachinesAPI, error)) *AZClient {
+	c.newAuxiliaryTenantClient = newClient
+	return c
+}
+
+// VirtualMachinesClientForTenant returns the VM client authorized with an auxiliary token of the tenant, which VMs
+// created from the images of galleries in the tenant require, constructing it on first use. The empty tenant is the
+// cluster's tenant, whose VM client is the one of c.
+func (c *AZClient) VirtualMachinesClientForTenant(tenantID string) (VirtualMachinesAPI, error) {
+	if tenantID == "" {
+		return c.virtualMachinesClient, nil
+	}
+	key := strings.ToLower(tenantID)
+	c.auxiliaryTenantClientsMu.Lock()
+	defer c.auxiliaryTenantClientsMu.Unlock()
+	if client, ok := c.auxiliaryTenantClients[key]; ok {
+		return client, nil
+	}
+	if c.newAuxiliaryTenantClient == nil {
+		return nil, fmt.Errorf("creating VMs from images of tenant %s is not supported", tenantID)
+	}
+	client, err := c.newAuxiliaryTenantClient(tenantID)
+	if err != nil {
+		return nil, fmt.Errorf("creating the VM client for tenant %s, %w", tenantID, err)
+	}
+	if c.auxiliaryTenantClients == nil {
+		c.auxiliaryTenantClients = map[string]VirtualMachinesAPI{}
+	}
+	c.auxiliaryTenantClients[key] = client
+	return client, nil
+}
+
+// ForSubscription returns the clients for the given subscription, constructing them on first use.
+// The empty subscription is the cluster's subscription, whose clients are c itself.
+func (c *AZClient) ForSubscription(subscriptionID string) (*AZClient, error) {
+	if subscriptionID == "" {
+		return c, nil
+	}
+	key := strings.ToLower(subscriptionID)
+	c.subscriptionClientsMu.Lock()
+	defer c.subscriptionClientsMu.Unlock()
+	if client, ok := c.subscriptionClients[key]; ok {
+		return client, nil
+	}
+	if c.newSubscriptionClient == nil {
+		return nil, fmt.Errorf("creating node resources in subscription %s is not supported", subscriptionID)
+	}
+	client, err := c.newSubscriptionClient(subscriptionID)
+	if err != nil {
+		return nil, fmt.Errorf("creating clients for subscription %s, %w", subscriptionID, err)
+	}
+	if c.subscriptionClients == nil {
+		c.subscriptionClients = map[string]*AZClient{}
+	}
+	c.subscriptionClients[key] = client
+	return client, nil
+}
+
 func NewAZClientFromAPI(
 	virtualMachinesClient VirtualMachinesAPI,
 	azureResourceGraphClient AzureResourceGraphAPI,
 	virtualMachinesExtensionClient VirtualMachineExtensionsAPI,
 	interfacesClient NetworkInterfacesAPI,
 	subnetsClient SubnetsAPI,
+	natGatewaysClient NatGatewaysAPI,
+	routeTablesClient RouteTablesAPI,
 	loadBalancersClient loadbalancer.LoadBalancersAPI,
 	networkSecurityGroupsClient networksecuritygroup.API,
 	imageVersionsClient imagefamilytypes.CommunityGalleryImageVersionsAPI,
@@ -103,13 +235,20 @@ func NewAZClientFromAPI(
 	nodeBootstrappingClient imagefamilytypes.NodeBootstrappingAPI,
 	skuClient skewer.ResourceClient,
 	subscriptionsClient zone.SubscriptionsAPI,
+	permissionsClient PermissionsAPI,
+	userAssignedIdentitiesClient UserAssignedIdentitiesAPI,
+	spotPlacementScoresClient spotplacementscore.API,
+	disksClient DisksAPI,
 ) *AZClient {
 	return &AZClient{
 		virtualMachinesClient:          virtualMachinesClient,
 		azureResourceGraphClient:       azureResourceGraphClient,
 		virtualMachinesExtensionClient: virtualMachinesExtensionClient,
 		networkInterfacesClient:        interfacesClient,
+		disksClient:                    disksClient,
 		subnetsClient:                  subnetsClient,
+		natGatewaysClient:              natGatewaysClient,
+		routeTablesClient:              routeTablesClient,
 		ImageVersionsClient:            imageVersionsClient,
 		NodeImageVersionsClient:        nodeImageVersionsClient,
 		NodeBootstrappingClient:        nodeBootstrappingClient,
@@ -117,13 +256,21 @@ func NewAZClientFromAPI(
 		LoadBalancersClient:            loadBalancersClient,
 		NetworkSecurityGroupsClient:    networkSecurityGroupsClient,
 		SubscriptionsClient:            subscriptionsClient,
+		permissionsClient:              permissionsClient,
+		userAssignedIdentitiesClient:   userAssignedIdentitiesClient,
+		SpotPlacementScoresClient:      spotPlacementScoresClient,
 	}
 }
 
-// nolint: gocyclo
 func NewAZClient(ctx context.Context, cfg *auth.Config, env *auth.Environment, cred azcore.TokenCredential) (*AZClient, error) {
+	return NewAZClientWithOptions(ctx, cfg, env, cred, armopts.DefaultARMOpts(env.Cloud, options.FromContext(ctx).EnableAzureSDKLogging))
+}
+
+// NewAZClientWithOptions returns the clients of the ARM APIs built with the given client options, e.g. with the
+// transport of a test recording the ARM interactions. The clients of other subscriptions are built with them too.
+// nolint: gocyclo
+func NewAZClientWithOptions(ctx context.Context, cfg *auth.Config, env *auth.Environment, cred azcore.TokenCredential, opts *arm.ClientOptions) (*AZClient, error) {
 	o := options.FromContext(ctx)
-	opts := armopts.DefaultARMOpts(env.Cloud, o.EnableAzureSDKLogging)
 	extensionsClient, err := armcompute.NewVirtualMachineExtensionsClient(cfg.SubscriptionID, cred, opts)
 	if err != nil {
 		return nil, err
@@ -134,11 +281,26 @@ func NewAZClient(ctx context.Context, cfg *auth.Config, env *auth.Environment, c
 		return nil, err
 	}
 
+	disksClient, err := armcompute.NewDisksClient(cfg.SubscriptionID, cred, opts)
+	if err != nil {
+		return nil, err
+	}
+
 	subnetsClient, err := armnetwork.NewSubnetsClient(cfg.SubscriptionID, cred, opts)
 	if err != nil {
 		return nil, err
 	}
 
+	natGatewaysClient, err := armnetwork.NewNatGatewaysClient(cfg.SubscriptionID, cred, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	routeTablesClient, err := armnetwork.NewRouteTablesClient(cfg.SubscriptionID, cred, opts)
+	if err != nil {
+		return nil, err
+	}
+
 	// copy the options to avoid modifying the original
 	var vmClientOptions = *opts
 	var auxiliaryTokenClient auth.AuxiliaryTokenServer
@@ -146,7 +308,8 @@ func NewAZClient(ctx context.Context, cfg *auth.Config, env *auth.Environment, c
 		log.FromContext(ctx).Info("using SIG for image versions with auxiliary token policy for creating virtual machines")
 		auxiliaryTokenClient = armopts.DefaultHTTPClient()
 		auxPolicy := auth.NewAuxiliaryTokenPolicy(auxiliaryTokenClient, o.SIGAccessTokenServerURL, auth.TokenScope(env.Cloud))
-		vmClientOptions.ClientOptions.PerRetryPolicies = append(vmClientOptions.ClientOptions.PerRetryPolicies, auxPolicy)
+		// clipped, so that the policies of the shared options aren't appended to in place
+		vmClientOptions.ClientOptions.PerRetryPolicies = append(slices.Clip(vmClientOptions.ClientOptions.PerRetryPolicies), auxPolicy)
 	}
 	virtualMachinesClient, err := armcompute.NewVirtualMachinesClient(cfg.SubscriptionID, cred, &vmClientOptions)
 	if err != nil {
@@ -163,7 +326,7 @@ func NewAZClient(ctx context.Context, cfg *auth.Config, env *auth.Environment, c
 		return nil, err
 	}
 
-	nodeImageVersionsClient := imagefamily.NewNodeImageVersionsClient(cred, opts.Cloud)
+	nodeImageVersionsClient := imagefamily.NewNodeImageVersionsClient(cred, opts.Cloud, o.NodeImageVersionsAPIVersion)
 
 	loadBalancersClient, err := armnetwork.NewLoadBalancersClient(cfg.SubscriptionID, cred, opts)
 	if err != nil {
@@ -180,6 +343,18 @@ func NewAZClient(ctx context.Context, cfg *auth.Config, env *auth.Environment, c
 		return nil, err
 	}
 
+	permissionsClient, err := armauthorization.NewPermissionsClient(cfg.SubscriptionID, cred, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	userAssignedIdentitiesClient, err := armmsi.NewUserAssignedIdentitiesClient(cfg.SubscriptionID, cred, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	spotPlacementScoresClient := spotplacementscore.NewClient(cred, opts.Cloud)
+
 	// TODO: this one is not enabled for rate limiting / throttling ...
 	// TODO Move this over to track 2 when skewer is migrated
 	skuClient := skuclient.NewSkuClient(cfg.SubscriptionID, cred, env.Cloud)
@@ -200,12 +375,14 @@ func NewAZClient(ctx context.Context, cfg *auth.Config, env *auth.Environment, c
 		}
 	}
 
-	return NewAZClientFromAPI(
+	azClient := NewAZClientFromAPI(
 		virtualMachinesClient,
 		azureResourceGraphClient,
 		extensionsClient,
 		interfacesClient,
 		subnetsClient,
+		natGatewaysClient,
+		routeTablesClient,
 		loadBalancersClient,
 		networkSecurityGroupsClient,
 		communityImageVersionsClient,
@@ -213,5 +390,21 @@ func NewAZClient(ctx context.Context, cfg *auth.Config, env *auth.Environment, c
 		nodeBootstrappingClient,
 		skuClient,
 		subscriptionsClient,
-	), nil
+		permissionsClient,
+		userAssignedIdentitiesClient,
+		spotPlacementScoresClient,
+		disksClient,
+	)
+	return azClient.WithSubscriptionClients(func(subscriptionID string) (*AZClient, error) {
+		if strings.EqualFold(subscriptionID, cfg.SubscriptionID) {
+			return azClient, nil
+		}
+		subscriptionCfg := *cfg
+		subscriptionCfg.SubscriptionID = subscriptionID
+		return NewAZClientWithOptions(ctx, &subscriptionCfg, env, cred, opts)
+	}).WithAuxiliaryTenantClients(func(tenantID string) (VirtualMachinesAPI, error) {
+		auxiliaryTenantClientOptions := vmClientOptions
+		auxiliaryTenantClientOptions.AuxiliaryTenants = []string{tenantID}
+		return armcompute.NewVirtualMachinesClient(cfg.SubscriptionID, cred, &auxiliaryTenantClientOptions)
+	}), nil
 }
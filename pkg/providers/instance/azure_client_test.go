@@ -0,0 +1,77 @@
+/*
+Portions Copyright (c) Microsoft Corporation.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package instance
+
+import (
+	"testing"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/compute/armcompute/v7"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestForSubscription(t *testing.T) {
+	c := &AZClient{}
+	client, err := c.ForSubscription("")
+	assert.NoError(t, err)
+	assert.Same(t, c, client)
+
+	_, err = c.ForSubscription("abcdef12-4321-4321-4321-210987654321")
+	assert.Error(t, err, "subscription clients aren't supported without a constructor")
+
+	constructed := 0
+	c.WithSubscriptionClients(func(string) (*AZClient, error) {
+		constructed++
+		return &AZClient{}, nil
+	})
+	first, err := c.ForSubscription("abcdef12-4321-4321-4321-210987654321")
+	assert.NoError(t, err)
+	second, err := c.ForSubscription("abcdef12-4321-4321-4321-210987654321")
+	assert.NoError(t, err)
+	assert.Same(t, first, second)
+	// subscription IDs are case-insensitive
+	upper, err := c.ForSubscription("ABCDEF12-4321-4321-4321-210987654321")
+	assert.NoError(t, err)
+	assert.Same(t, first, upper)
+	assert.Equal(t, 1, constructed)
+}
+
+func TestVirtualMachinesClientForTenant(t *testing.T) {
+	c := &AZClient{virtualMachinesClient: &armcompute.VirtualMachinesClient{}}
+	client, err := c.VirtualMachinesClientForTenant("")
+	assert.NoError(t, err)
+	assert.Same(t, c.virtualMachinesClient, client)
+
+	_, err = c.VirtualMachinesClientForTenant("abcdef12-4321-4321-4321-210987654321")
+	assert.Error(t, err, "auxiliary tenant clients aren't supported without a constructor")
+
+	var tenantIDs []string
+	c.WithAuxiliaryTenantClients(func(tenantID string) (VirtualMachinesAPI, error) {
+		tenantIDs = append(tenantIDs, tenantID)
+		return &armcompute.VirtualMachinesClient{}, nil
+	})
+	first, err := c.VirtualMachinesClientForTenant("abcdef12-4321-4321-4321-210987654321")
+	assert.NoError(t, err)
+	assert.NotSame(t, c.virtualMachinesClient, first)
+	second, err := c.VirtualMachinesClientForTenant("abcdef12-4321-4321-4321-210987654321")
+	assert.NoError(t, err)
+	assert.Same(t, first, second)
+	// tenant IDs are case-insensitive
+	upper, err := c.VirtualMachinesClientForTenant("ABCDEF12-4321-4321-4321-210987654321")
+	assert.NoError(t, err)
+	assert.Same(t, first, upper)
+	assert.Equal(t, []string{"abcdef12-4321-4321-4321-210987654321"}, tenantIDs)
+}
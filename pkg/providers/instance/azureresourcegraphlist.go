@@ -33,7 +33,7 @@ const (
 	nicResourceType = "microsoft.network/networkinterfaces"
 )
 
-// getResourceListQueryBuilder returns a KQL query builder for listing resources with nodepool tags
+// getResourceListQueryBuilder returns a KQL query builder for listing resources with nodepool tags, of any cluster
 func getResourceListQueryBuilder(rg string, resourceType string) *kql.Builder {
 	return kql.New(`Resources`).
 		AddLiteral(` | where type == `).AddString(resourceType).
@@ -41,13 +41,31 @@ func getResourceListQueryBuilder(rg string, resourceType string) *kql.Builder {
 		AddLiteral(` | where tags has_cs `).AddString(launchtemplate.NodePoolTagKey)
 }
 
-// GetVMListQueryBuilder returns a KQL query builder for listing VMs with nodepool tags
-func GetVMListQueryBuilder(rg string) *kql.Builder {
+// getClusterResourceListQueryBuilder returns a KQL query builder for listing resources with nodepool tags, and the cluster tag of the given cluster
+func getClusterResourceListQueryBuilder(rg string, clusterName string, resourceType string) *kql.Builder {
+	return getResourceListQueryBuilder(rg, resourceType).
+		AddLiteral(` | where tags[`).AddString(launchtemplate.KarpenterManagedTagKey).AddLiteral(`] == `).AddString(clusterName)
+}
+
+// GetVMListQueryBuilder returns a KQL query builder for listing VMs of the cluster with nodepool tags
+func GetVMListQueryBuilder(rg string, clusterName string) *kql.Builder {
+	return getClusterResourceListQueryBuilder(rg, clusterName, vmResourceType)
+}
+
+// GetNICListQueryBuilder returns a KQL query builder for listing NICs of the cluster with nodepool tags
+func GetNICListQueryBuilder(rg string, clusterName string) *kql.Builder {
+	return getClusterResourceListQueryBuilder(rg, clusterName, nicResourceType)
+}
+
+// GetAllVMListQueryBuilder returns a KQL query builder for listing VMs with nodepool tags, including the ones created
+// before the cluster tag was applied
+func GetAllVMListQueryBuilder(rg string) *kql.Builder {
 	return getResourceListQueryBuilder(rg, vmResourceType)
 }
 
-// GetNICListQueryBuilder returns a KQL query builder for listing NICs with nodepool tags
-func GetNICListQueryBuilder(rg string) *kql.Builder {
+// GetAllNICListQueryBuilder returns a KQL query builder for listing NICs with nodepool tags, including the ones created
+// before the cluster tag was applied
+func GetAllNICListQueryBuilder(rg string) *kql.Builder {
 	return getResourceListQueryBuilder(rg, nicResourceType)
 }
 
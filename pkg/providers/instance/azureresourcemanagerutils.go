@@ -20,6 +20,7 @@ import (
 	"context"
 
 	sdkerrors "github.com/Azure/azure-sdk-for-go-extensions/pkg/errors"
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/runtime"
 	"github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/compute/armcompute/v7"
 	"github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/network/armnetwork"
 	"github.com/samber/lo"
@@ -76,12 +77,12 @@ func createVirtualMachineExtension(ctx context.Context, client VirtualMachineExt
 	return &res.VirtualMachineExtension, nil
 }
 
-func createNic(ctx context.Context, client NetworkInterfacesAPI, rg, nicName string, nic armnetwork.Interface) (*armnetwork.Interface, error) {
+func createNic(ctx context.Context, client NetworkInterfacesAPI, rg, nicName string, nic armnetwork.Interface, pollOptions *runtime.PollUntilDoneOptions) (*armnetwork.Interface, error) {
 	poller, err := client.BeginCreateOrUpdate(ctx, rg, nicName, nic, nil)
 	if err != nil {
 		return nil, err
 	}
-	res, err := poller.PollUntilDone(ctx, nil)
+	res, err := poller.PollUntilDone(ctx, pollOptions)
 
 	if err != nil {
 		return nil, err
@@ -89,12 +90,12 @@ func createNic(ctx context.Context, client NetworkInterfacesAPI, rg, nicName str
 	return &res.Interface, nil
 }
 
-func deleteNic(ctx context.Context, client NetworkInterfacesAPI, rg, nicName string) error {
+func deleteNic(ctx context.Context, client NetworkInterfacesAPI, rg, nicName string, pollOptions *runtime.PollUntilDoneOptions) error {
 	poller, err := client.BeginDelete(ctx, rg, nicName, nil)
 	if err != nil {
 		return err
 	}
-	_, err = poller.PollUntilDone(ctx, nil)
+	_, err = poller.PollUntilDone(ctx, pollOptions)
 	if err != nil {
 		if sdkerrors.IsNotFoundErr(err) {
 			return nil
@@ -104,7 +105,7 @@ func deleteNic(ctx context.Context, client NetworkInterfacesAPI, rg, nicName str
 	return nil
 }
 
-func deleteNicIfExists(ctx context.Context, client NetworkInterfacesAPI, rg, nicName string) error {
+func deleteNicIfExists(ctx context.Context, client NetworkInterfacesAPI, rg, nicName string, pollOptions *runtime.PollUntilDoneOptions) error {
 	_, err := client.Get(ctx, rg, nicName, nil)
 	if err != nil {
 		if sdkerrors.IsNotFoundErr(err) {
@@ -112,7 +113,7 @@ func deleteNicIfExists(ctx context.Context, client NetworkInterfacesAPI, rg, nic
 		}
 		return err
 	}
-	return deleteNic(ctx, client, rg, nicName)
+	return deleteNic(ctx, client, rg, nicName, pollOptions)
 }
 
 // deleteVirtualMachineIfExists checks if a virtual machine exists, and if it does, we delete it with a cascading delete
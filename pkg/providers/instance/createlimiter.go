@@ -0,0 +1,186 @@
+/*
+Portions Copyright (c) Microsoft Corporation.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package instance
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/Azure/karpenter-provider-azure/pkg/metrics"
+)
+
+// CreateLimiter caps the VM creates in flight, from the start of the create until its promise completes, globally
+// and per nodepool. Creates beyond the caps are queued, and dispatched round-robin across nodepools as others
+// complete, so that a nodepool scaling up by hundreds of nodes doesn't starve the others.
+//
+// Creates are queued for at most the queue timeout: Karpenter core launches nodeclaims from its reconcilers, which
+// must not block indefinitely, and retries failed launches with a backoff. A create timing out in the queue fails
+// with an error that isn't an insufficient capacity error, so that its nodeclaim is retried rather than deleted.
+// A nil CreateLimiter doesn't limit creates.
+type CreateLimiter struct {
+	maxInFlight            int
+	maxInFlightPerNodePool int
+	queueTimeout           time.Duration
+
+	mu                 sync.Mutex
+	inFlight           int
+	inFlightByNodePool map[string]int
+	queues             map[string][]*createWaiter
+	// order is the round-robin order of the nodepools with queued creates
+	order []string
+}
+
+type createWaiter struct {
+	ready   chan struct{}
+	granted bool
+}
+
+// NewCreateLimiter returns a limiter of the VM creates in flight. A maximum of 0 is unlimited.
+func NewCreateLimiter(maxInFlight, maxInFlightPerNodePool int, queueTimeout time.Duration) *CreateLimiter {
+	return &CreateLimiter{
+		maxInFlight:            maxInFlight,
+		maxInFlightPerNodePool: maxInFlightPerNodePool,
+		queueTimeout:           queueTimeout,
+		inFlightByNodePool:     map[string]int{},
+		queues:                 map[string][]*createWaiter{},
+	}
+}
+
+func (l *CreateLimiter) Enabled() bool {
+	return l != nil && (l.maxInFlight > 0 || l.maxInFlightPerNodePool > 0)
+}
+
+// Acquire waits for a VM create of the nodepool to be allowed in flight, and returns the function releasing it once
+// the create completes. The release function may be called more than once.
+func (l *CreateLimiter) Acquire(ctx context.Context, nodePool string) (func(), error) {
+	if !l.Enabled() {
+		return func() {}, nil
+	}
+	start := time.Now()
+	l.mu.Lock()
+	// creates only start right away if none of the nodepool is queued before them
+	if len(l.queues[nodePool]) == 0 && l.canStart(nodePool) {
+		l.start(nodePool)
+		l.mu.Unlock()
+		VMCreateQueueWaitDurationMetric.With(map[string]string{metrics.NodePoolLabel: nodePool}).Observe(0)
+		return l.releaseFunc(nodePool), nil
+	}
+	waiter := &createWaiter{ready: make(chan struct{})}
+	if len(l.queues[nodePool]) == 0 {
+		l.order = append(l.order, nodePool)
+	}
+	l.queues[nodePool] = append(l.queues[nodePool], waiter)
+	VMCreateQueueDepthMetric.With(map[string]string{metrics.NodePoolLabel: nodePool}).Inc()
+	l.mu.Unlock()
+
+	timer := time.NewTimer(l.queueTimeout)
+	defer timer.Stop()
+	var err error
+	select {
+	case <-waiter.ready:
+	case <-timer.C:
+		err = fmt.Errorf("timed out after %s waiting for VM creates in flight to complete, limited to %d in total and %d per nodepool", l.queueTimeout, l.maxInFlight, l.maxInFlightPerNodePool)
+	case <-ctx.Done():
+		err = fmt.Errorf("waiting for VM creates in flight to complete, %w", ctx.Err())
+	}
+	VMCreateQueueWaitDurationMetric.With(map[string]string{metrics.NodePoolLabel: nodePool}).Observe(time.Since(start).Seconds())
+	if err != nil {
+		l.mu.Lock()
+		defer l.mu.Unlock()
+		// the create may have been dispatched while timing out
+		if !waiter.granted {
+			l.dequeue(nodePool, waiter)
+			return nil, err
+		}
+	}
+	return l.releaseFunc(nodePool), nil
+}
+
+func (l *CreateLimiter) releaseFunc(nodePool string) func() {
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			l.mu.Lock()
+			defer l.mu.Unlock()
+			l.inFlight--
+			if l.inFlightByNodePool[nodePool]--; l.inFlightByNodePool[nodePool] == 0 {
+				delete(l.inFlightByNodePool, nodePool)
+			}
+			VMCreatesInFlightMetric.With(map[string]string{metrics.NodePoolLabel: nodePool}).Dec()
+			l.dispatch()
+		})
+	}
+}
+
+func (l *CreateLimiter) canStart(nodePool string) bool {
+	return (l.maxInFlight <= 0 || l.inFlight < l.maxInFlight) &&
+		(l.maxInFlightPerNodePool <= 0 || l.inFlightByNodePool[nodePool] < l.maxInFlightPerNodePool)
+}
+
+func (l *CreateLimiter) start(nodePool string) {
+	l.inFlight++
+	l.inFlightByNodePool[nodePool]++
+	VMCreatesInFlightMetric.With(map[string]string{metrics.NodePoolLabel: nodePool}).Inc()
+}
+
+// dispatch starts the queued creates allowed in flight, taking turns across the nodepools: the nodepool a create is
+// dispatched for moves to the back of the order.
+func (l *CreateLimiter) dispatch() {
+	for dispatched := true; dispatched; {
+		dispatched = false
+		for i, nodePool := range l.order {
+			if !l.canStart(nodePool) {
+				continue
+			}
+			waiter := l.queues[nodePool][0]
+			waiter.granted = true
+			close(waiter.ready)
+			l.start(nodePool)
+			l.dequeue(nodePool, waiter)
+			if len(l.queues[nodePool]) > 0 {
+				l.order = append(append(l.order[:i:i], l.order[i+1:]...), nodePool)
+			}
+			dispatched = true
+			break
+		}
+	}
+}
+
+// dequeue removes the waiter from the queue of the nodepool, and the nodepool from the order when its queue is empty
+func (l *CreateLimiter) dequeue(nodePool string, waiter *createWaiter) {
+	queue := l.queues[nodePool]
+	for i := range queue {
+		if queue[i] == waiter {
+			queue = append(queue[:i:i], queue[i+1:]...)
+			break
+		}
+	}
+	VMCreateQueueDepthMetric.With(map[string]string{metrics.NodePoolLabel: nodePool}).Dec()
+	if len(queue) > 0 {
+		l.queues[nodePool] = queue
+		return
+	}
+	delete(l.queues, nodePool)
+	for i := range l.order {
+		if l.order[i] == nodePool {
+			l.order = append(l.order[:i:i], l.order[i+1:]...)
+			break
+		}
+	}
+}
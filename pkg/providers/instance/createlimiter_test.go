@@ -0,0 +1,148 @@
+/*
+Portions Copyright (c) Microsoft Corporation.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package instance_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	corecloudprovider "sigs.k8s.io/karpenter/pkg/cloudprovider"
+
+	"github.com/Azure/karpenter-provider-azure/pkg/providers/instance"
+)
+
+// acquireAsync acquires a create of the nodepool in the background, once the creates queued before it are
+func acquireAsync(t *testing.T, limiter *instance.CreateLimiter, nodePool string) <-chan func() {
+	t.Helper()
+	queued := testutil.ToFloat64(instance.VMCreateQueueDepthMetric.WithLabelValues(nodePool))
+	acquired := make(chan func(), 1)
+	go func() {
+		release, err := limiter.Acquire(context.Background(), nodePool)
+		if err != nil {
+			t.Errorf("Unexpected error %v", err)
+			return
+		}
+		acquired <- release
+	}()
+	deadline := time.Now().Add(5 * time.Second)
+	for testutil.ToFloat64(instance.VMCreateQueueDepthMetric.WithLabelValues(nodePool)) == queued && len(acquired) == 0 {
+		if time.Now().After(deadline) {
+			t.Fatalf("create of %s neither queued nor acquired", nodePool)
+		}
+		time.Sleep(time.Millisecond)
+	}
+	return acquired
+}
+
+func expectAcquired(t *testing.T, acquired <-chan func()) func() {
+	t.Helper()
+	select {
+	case release := <-acquired:
+		return release
+	case <-time.After(5 * time.Second):
+		t.Fatalf("expected the create to be acquired")
+		return nil
+	}
+}
+
+func expectQueued(t *testing.T, acquired <-chan func()) {
+	t.Helper()
+	select {
+	case <-acquired:
+		t.Fatalf("expected the create to be queued")
+	case <-time.After(20 * time.Millisecond):
+	}
+}
+
+func TestCreateLimiterCaps(t *testing.T) {
+	limiter := instance.NewCreateLimiter(3, 2, time.Minute)
+
+	releaseA1 := expectAcquired(t, acquireAsync(t, limiter, "caps-a"))
+	expectAcquired(t, acquireAsync(t, limiter, "caps-a"))
+	// the nodepool reached its limit
+	a3 := acquireAsync(t, limiter, "caps-a")
+	expectQueued(t, a3)
+	expectAcquired(t, acquireAsync(t, limiter, "caps-b"))
+	// the global limit is reached
+	b2 := acquireAsync(t, limiter, "caps-b")
+	expectQueued(t, b2)
+
+	// releasing more than once releases a single create
+	releaseA1()
+	releaseA1()
+	expectAcquired(t, a3)
+	expectQueued(t, b2)
+}
+
+func TestCreateLimiterFairness(t *testing.T) {
+	limiter := instance.NewCreateLimiter(1, 0, time.Minute)
+
+	release := expectAcquired(t, acquireAsync(t, limiter, "fair-a"))
+	a := []<-chan func(){acquireAsync(t, limiter, "fair-a"), acquireAsync(t, limiter, "fair-a"), acquireAsync(t, limiter, "fair-a")}
+	b := []<-chan func(){acquireAsync(t, limiter, "fair-b")}
+	c := []<-chan func(){acquireAsync(t, limiter, "fair-c"), acquireAsync(t, limiter, "fair-c")}
+
+	// the nodepools take turns, in the order they queued creates
+	for _, next := range []<-chan func(){a[0], b[0], c[0], a[1], c[1], a[2]} {
+		release()
+		release = expectAcquired(t, next)
+	}
+	release()
+	if depth := testutil.ToFloat64(instance.VMCreateQueueDepthMetric.WithLabelValues("fair-a")); depth != 0 {
+		t.Errorf("expected no queued create, got %v", depth)
+	}
+}
+
+func TestCreateLimiterQueueTimeout(t *testing.T) {
+	limiter := instance.NewCreateLimiter(1, 0, 50*time.Millisecond)
+
+	release, err := limiter.Acquire(context.Background(), "timeout")
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	_, err = limiter.Acquire(context.Background(), "timeout")
+	if err == nil {
+		t.Fatalf("expected the queued create to time out")
+	}
+	// Karpenter core deletes the nodeclaims of insufficient capacity errors, rather than retrying them
+	if corecloudprovider.IsInsufficientCapacityError(err) {
+		t.Errorf("expected the timeout not to be an insufficient capacity error")
+	}
+	if depth := testutil.ToFloat64(instance.VMCreateQueueDepthMetric.WithLabelValues("timeout")); depth != 0 {
+		t.Errorf("expected the create timing out to be dequeued, got a queue depth of %v", depth)
+	}
+
+	// the timed out create doesn't hold a slot
+	release()
+	release, err = limiter.Acquire(context.Background(), "timeout")
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	release()
+}
+
+func TestCreateLimiterUnlimited(t *testing.T) {
+	for _, limiter := range []*instance.CreateLimiter{nil, instance.NewCreateLimiter(0, 0, time.Nanosecond)} {
+		for range 100 {
+			if _, err := limiter.Acquire(context.Background(), "unlimited"); err != nil {
+				t.Fatalf("Unexpected error %v", err)
+			}
+		}
+	}
+}
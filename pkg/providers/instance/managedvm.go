@@ -0,0 +1,64 @@
+/*
+Portions Copyright (c) Microsoft Corporation.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package instance
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/compute/armcompute/v7"
+	"github.com/samber/lo"
+
+	"github.com/Azure/karpenter-provider-azure/pkg/operator/options"
+	"github.com/Azure/karpenter-provider-azure/pkg/providers/launchtemplate"
+	"github.com/Azure/karpenter-provider-azure/pkg/utils"
+)
+
+// UnconfirmedManagedVMReason returns why the VM can't be confirmed as created by Karpenter for the cluster, or "" when
+// it's confirmed. A VM is confirmed by the cluster tag of the cluster, the nodepool tag, a name Karpenter generates for
+// the nodeclaims of that nodepool, and the garbage collection confirmation tag, if configured. The tags alone aren't
+// enough before destructive actions on VMs found by their tags, as other automation may copy them onto other VMs.
+func UnconfirmedManagedVMReason(ctx context.Context, vm *armcompute.VirtualMachine) string {
+	opts := options.FromContext(ctx)
+	if clusterName := lo.FromPtr(vm.Tags[launchtemplate.KarpenterManagedTagKey]); clusterName != opts.ClusterName {
+		return fmt.Sprintf("tag %s is %q rather than %q", launchtemplate.KarpenterManagedTagKey, clusterName, opts.ClusterName)
+	}
+	nodePoolName := lo.FromPtr(vm.Tags[launchtemplate.NodePoolTagKey])
+	if nodePoolName == "" {
+		return fmt.Sprintf("tag %s is missing", launchtemplate.NodePoolTagKey)
+	}
+	// the nodeclaims of a nodepool are named after it, and the names of their VMs derived from theirs
+	vmName := lo.FromPtr(vm.Name)
+	nodeClaimName := utils.NodeClaimNameFromResourceName(vmName)
+	if tag, ok := vm.Tags[launchtemplate.NodeClaimTagKey]; ok {
+		nodeClaimName = lo.FromPtr(tag)
+	}
+	if !strings.HasPrefix(nodeClaimName, nodePoolName+"-") || utils.ResourceName(nodeClaimName) != vmName {
+		return fmt.Sprintf("name %s isn't the name of a VM of a nodeclaim of nodepool %s", vmName, nodePoolName)
+	}
+	if opts.GarbageCollectionConfirmationTag != "" {
+		key, value, err := opts.GetGarbageCollectionConfirmationTag()
+		if err != nil {
+			return err.Error()
+		}
+		if tag, ok := lo.FindKeyBy(vm.Tags, func(k string, _ *string) bool { return strings.EqualFold(k, key) }); !ok || lo.FromPtr(vm.Tags[tag]) != value {
+			return fmt.Sprintf("confirmation tag %s=%s is missing", key, value)
+		}
+	}
+	return ""
+}
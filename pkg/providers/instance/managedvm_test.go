@@ -0,0 +1,81 @@
+/*
+Portions Copyright (c) Microsoft Corporation.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package instance
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/compute/armcompute/v7"
+	"github.com/samber/lo"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/Azure/karpenter-provider-azure/pkg/operator/options"
+	"github.com/Azure/karpenter-provider-azure/pkg/providers/launchtemplate"
+	"github.com/Azure/karpenter-provider-azure/pkg/utils"
+)
+
+func TestUnconfirmedManagedVMReason(t *testing.T) {
+	managedTags := func(overrides map[string]*string) map[string]*string {
+		return lo.OmitBy(lo.Assign(map[string]*string{
+			launchtemplate.KarpenterManagedTagKey: lo.ToPtr("test-cluster"),
+			launchtemplate.NodePoolTagKey:         lo.ToPtr("default"),
+			launchtemplate.NodeClassTagKey:        lo.ToPtr("default"),
+		}, overrides), func(_ string, value *string) bool { return value == nil })
+	}
+	longNodeClaimName := "default-" + strings.Repeat("a", 60)
+	for _, tc := range []struct {
+		name            string
+		vmName          string
+		tags            map[string]*string
+		confirmationTag string
+		expectedReason  string
+	}{
+		{name: "managed VM", vmName: "aks-default-a1b2c", tags: managedTags(nil)},
+		{name: "managed VM with a shortened name", vmName: utils.ResourceName(longNodeClaimName),
+			tags: managedTags(map[string]*string{launchtemplate.NodeClaimTagKey: lo.ToPtr(longNodeClaimName)})},
+		{name: "right tags, name not generated by Karpenter", vmName: "legacy-vm-01", tags: managedTags(nil),
+			expectedReason: "name legacy-vm-01 isn't the name of a VM of a nodeclaim of nodepool default"},
+		{name: "right tags, name of a VM of another nodepool", vmName: "aks-gpu-a1b2c", tags: managedTags(nil),
+			expectedReason: "name aks-gpu-a1b2c isn't the name of a VM of a nodeclaim of nodepool default"},
+		{name: "right tags, nodeclaim tag of another VM", vmName: "aks-default-a1b2c",
+			tags:           managedTags(map[string]*string{launchtemplate.NodeClaimTagKey: lo.ToPtr("default-d3e4f")}),
+			expectedReason: "name aks-default-a1b2c isn't the name of a VM of a nodeclaim of nodepool default"},
+		{name: "right name, cluster tag of another cluster", vmName: "aks-default-a1b2c",
+			tags:           managedTags(map[string]*string{launchtemplate.KarpenterManagedTagKey: lo.ToPtr("other-cluster")}),
+			expectedReason: `tag karpenter.azure.com_cluster is "other-cluster" rather than "test-cluster"`},
+		{name: "right name, no cluster tag", vmName: "aks-default-a1b2c",
+			tags:           managedTags(map[string]*string{launchtemplate.KarpenterManagedTagKey: nil}),
+			expectedReason: `tag karpenter.azure.com_cluster is "" rather than "test-cluster"`},
+		{name: "right name, no nodepool tag", vmName: "aks-default-a1b2c",
+			tags:           managedTags(map[string]*string{launchtemplate.NodePoolTagKey: nil}),
+			expectedReason: "tag karpenter.sh_nodepool is missing"},
+		{name: "confirmation tag", vmName: "aks-default-a1b2c", confirmationTag: "owner=karpenter",
+			tags: managedTags(map[string]*string{"Owner": lo.ToPtr("karpenter")})},
+		{name: "confirmation tag missing", vmName: "aks-default-a1b2c", confirmationTag: "owner=karpenter",
+			tags: managedTags(nil), expectedReason: "confirmation tag owner=karpenter is missing"},
+		{name: "confirmation tag of another value", vmName: "aks-default-a1b2c", confirmationTag: "owner=karpenter",
+			tags: managedTags(map[string]*string{"owner": lo.ToPtr("automation")}), expectedReason: "confirmation tag owner=karpenter is missing"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			ctx := options.ToContext(context.Background(), &options.Options{ClusterName: "test-cluster", GarbageCollectionConfirmationTag: tc.confirmationTag})
+			vm := &armcompute.VirtualMachine{Name: lo.ToPtr(tc.vmName), Tags: tc.tags}
+			assert.Equal(t, tc.expectedReason, UnconfirmedManagedVMReason(ctx, vm))
+		})
+	}
+}
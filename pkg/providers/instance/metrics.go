@@ -26,6 +26,8 @@ const (
 	instanceSubsystem = "instance"
 	phaseSyncFailure  = "sync"
 	phaseAsyncFailure = "async"
+	phaseQueued       = "queued"
+	phaseRunning      = "running"
 )
 
 // We don't need to add disk specification since they are statically defined and can be traced with provided labels.
@@ -55,11 +57,98 @@ var (
 		},
 		[]string{metrics.ImageLabel, metrics.SizeLabel, metrics.ZoneLabel, metrics.CapacityTypeLabel, metrics.NodePoolLabel, metrics.PhaseLabel, metrics.ErrorCodeLabel},
 	)
+
+	// VMDeleteVolumeDetachTimeoutMetric tracks VM deletions that timed out waiting for data disks to be detached.
+	//
+	// STABILITY: ALPHA - This metric may change or be removed without notice.
+	VMDeleteVolumeDetachTimeoutMetric = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: metrics.Namespace,
+			Subsystem: instanceSubsystem,
+			Name:      "vm_delete_volume_detach_timeout_total",
+			Help:      "Total number of VM deletions that timed out waiting for data disks to be detached.",
+		},
+		[]string{metrics.NodePoolLabel},
+	)
+
+	// VMCreateQueueDepthMetric tracks the VM creates queued for exceeding the limits of VM creates in flight.
+	//
+	// STABILITY: ALPHA - This metric may change or be removed without notice.
+	VMCreateQueueDepthMetric = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: metrics.Namespace,
+			Subsystem: instanceSubsystem,
+			Name:      "vm_create_queue_depth",
+			Help:      "Number of VM creates queued for exceeding the limits of VM creates in flight.",
+		},
+		[]string{metrics.NodePoolLabel},
+	)
+
+	// VMCreateQueueWaitDurationMetric tracks how long VM creates waited to be allowed in flight.
+	//
+	// STABILITY: ALPHA - This metric may change or be removed without notice.
+	VMCreateQueueWaitDurationMetric = prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Namespace: metrics.Namespace,
+			Subsystem: instanceSubsystem,
+			Name:      "vm_create_queue_wait_duration_seconds",
+			Help:      "Duration VM creates waited to be allowed in flight, including those timing out.",
+			Buckets:   []float64{0, 0.1, 0.5, 1, 5, 10, 30, 60, 120, 300},
+		},
+		[]string{metrics.NodePoolLabel},
+	)
+
+	// VMCreatesInFlightMetric tracks the VM creates in flight, counted against the limits of VM creates in flight.
+	//
+	// STABILITY: ALPHA - This metric may change or be removed without notice.
+	VMCreatesInFlightMetric = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: metrics.Namespace,
+			Subsystem: instanceSubsystem,
+			Name:      "vm_creates_in_flight",
+			Help:      "Number of VM creates in flight, from their start until their completion.",
+		},
+		[]string{metrics.NodePoolLabel},
+	)
+
+	// NICOperationDurationMetric tracks how long NIC operations waited for a worker of the network operation pool, in
+	// the queued phase, and then took to complete, in the running phase.
+	//
+	// STABILITY: ALPHA - This metric may change or be removed without notice.
+	NICOperationDurationMetric = prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Namespace: metrics.Namespace,
+			Subsystem: instanceSubsystem,
+			Name:      "nic_operation_duration_seconds",
+			Help:      "Duration NIC operations were queued for a worker, and then ran until they completed, by phase.",
+			Buckets:   []float64{0, 0.1, 0.5, 1, 2, 5, 10, 30, 60, 120},
+		},
+		[]string{metrics.OperationLabel, metrics.PhaseLabel},
+	)
+
+	// NICOperationQueueDepthMetric tracks the NIC operations waiting for a worker of the network operation pool.
+	//
+	// STABILITY: ALPHA - This metric may change or be removed without notice.
+	NICOperationQueueDepthMetric = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: metrics.Namespace,
+			Subsystem: instanceSubsystem,
+			Name:      "nic_operation_queue_depth",
+			Help:      "Number of NIC operations waiting for a worker of the network operation pool.",
+		},
+		[]string{metrics.OperationLabel},
+	)
 )
 
 func init() {
 	crmetrics.Registry.MustRegister(
 		VMCreateStartMetric,
 		VMCreateFailureMetric,
+		VMDeleteVolumeDetachTimeoutMetric,
+		VMCreateQueueDepthMetric,
+		VMCreateQueueWaitDurationMetric,
+		VMCreatesInFlightMetric,
+		NICOperationDurationMetric,
+		NICOperationQueueDepthMetric,
 	)
 }
@@ -0,0 +1,96 @@
+/*
+Portions Copyright (c) Microsoft Corporation.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package instance
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/runtime"
+
+	"github.com/Azure/karpenter-provider-azure/pkg/metrics"
+)
+
+const (
+	NICOperationCreate = "create"
+	NICOperationDelete = "delete"
+)
+
+// NetworkOperationPool runs the NIC creates and deletes, from their start until their LRO completes, on a bounded
+// number of workers. At high churn, NIC operations beyond the workers wait for one to be free, rather than each
+// polling ARM. Operations wait for as long as their context allows. A nil NetworkOperationPool runs operations right
+// away.
+type NetworkOperationPool struct {
+	workers chan struct{}
+	// pollOptions are shared by the LROs of all NIC operations, nil for the SDK defaults
+	pollOptions *runtime.PollUntilDoneOptions
+}
+
+// NewNetworkOperationPool returns a pool of the given number of workers for NIC operations, whose LROs are polled at
+// the given frequency when ARM doesn't ask to be polled later. A maximum of 0 is unlimited, and a poll frequency of 0
+// is the SDK default.
+func NewNetworkOperationPool(workers int, pollFrequency time.Duration) *NetworkOperationPool {
+	p := &NetworkOperationPool{}
+	if workers > 0 {
+		p.workers = make(chan struct{}, workers)
+	}
+	if pollFrequency > 0 {
+		p.pollOptions = &runtime.PollUntilDoneOptions{Frequency: pollFrequency}
+	}
+	return p
+}
+
+// PollOptions returns the options the LROs of NIC operations are polled with
+func (p *NetworkOperationPool) PollOptions() *runtime.PollUntilDoneOptions {
+	if p == nil {
+		return nil
+	}
+	return p.pollOptions
+}
+
+// Do runs the NIC operation once a worker is free, recording how long it was queued and then ran
+func (p *NetworkOperationPool) Do(ctx context.Context, operation string, run func() error) error {
+	start := time.Now()
+	if p != nil && p.workers != nil {
+		select {
+		case p.workers <- struct{}{}:
+		default:
+			NICOperationQueueDepthMetric.With(map[string]string{metrics.OperationLabel: operation}).Inc()
+			select {
+			case p.workers <- struct{}{}:
+			case <-ctx.Done():
+				NICOperationQueueDepthMetric.With(map[string]string{metrics.OperationLabel: operation}).Dec()
+				observeNICOperation(operation, phaseQueued, start)
+				return fmt.Errorf("waiting for a worker of the network operation pool, %w", ctx.Err())
+			}
+			NICOperationQueueDepthMetric.With(map[string]string{metrics.OperationLabel: operation}).Dec()
+		}
+		defer func() { <-p.workers }()
+	}
+	observeNICOperation(operation, phaseQueued, start)
+	start = time.Now()
+	defer observeNICOperation(operation, phaseRunning, start)
+	return run()
+}
+
+func observeNICOperation(operation, phase string, start time.Time) {
+	NICOperationDurationMetric.With(map[string]string{
+		metrics.OperationLabel: operation,
+		metrics.PhaseLabel:     phase,
+	}).Observe(time.Since(start).Seconds())
+}
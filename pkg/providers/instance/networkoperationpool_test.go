@@ -0,0 +1,103 @@
+/*
+Portions Copyright (c) Microsoft Corporation.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package instance_test
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+
+	"github.com/Azure/karpenter-provider-azure/pkg/providers/instance"
+)
+
+func TestNetworkOperationPoolBoundsConcurrency(t *testing.T) {
+	pool := instance.NewNetworkOperationPool(2, 0)
+	var mu sync.Mutex
+	var running, maxRunning int
+	var wg sync.WaitGroup
+	for range 10 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			err := pool.Do(context.Background(), instance.NICOperationCreate, func() error {
+				mu.Lock()
+				running++
+				maxRunning = max(maxRunning, running)
+				mu.Unlock()
+				time.Sleep(5 * time.Millisecond)
+				mu.Lock()
+				running--
+				mu.Unlock()
+				return nil
+			})
+			if err != nil {
+				t.Errorf("Unexpected error %v", err)
+			}
+		}()
+	}
+	wg.Wait()
+	if maxRunning != 2 {
+		t.Errorf("expected at most 2 operations running at once, got %d", maxRunning)
+	}
+	if got := testutil.ToFloat64(instance.NICOperationQueueDepthMetric.WithLabelValues(instance.NICOperationCreate)); got != 0 {
+		t.Errorf("expected no operation to be queued, got %v", got)
+	}
+}
+
+func TestNetworkOperationPoolQueueTimesOut(t *testing.T) {
+	pool := instance.NewNetworkOperationPool(1, 0)
+	started, release := make(chan struct{}), make(chan struct{})
+	go func() {
+		_ = pool.Do(context.Background(), instance.NICOperationDelete, func() error {
+			close(started)
+			<-release
+			return nil
+		})
+	}()
+	<-started
+	defer close(release)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	ran := false
+	err := pool.Do(ctx, instance.NICOperationDelete, func() error {
+		ran = true
+		return nil
+	})
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("expected the queued operation to time out, got %v", err)
+	}
+	if ran {
+		t.Errorf("expected the queued operation not to run")
+	}
+	if got := testutil.ToFloat64(instance.NICOperationQueueDepthMetric.WithLabelValues(instance.NICOperationDelete)); got != 0 {
+		t.Errorf("expected no operation to be queued, got %v", got)
+	}
+}
+
+func TestNetworkOperationPoolUnlimited(t *testing.T) {
+	for _, pool := range []*instance.NetworkOperationPool{nil, instance.NewNetworkOperationPool(0, 0)} {
+		want := errors.New("failed")
+		if err := pool.Do(context.Background(), instance.NICOperationCreate, func() error { return want }); !errors.Is(err, want) {
+			t.Errorf("expected the error of the operation, got %v", err)
+		}
+	}
+}
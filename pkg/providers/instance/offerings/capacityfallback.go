@@ -0,0 +1,144 @@
+/*
+Portions Copyright (c) Microsoft Corporation.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package offerings
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/patrickmn/go-cache"
+	v1 "k8s.io/api/core/v1"
+	karpv1 "sigs.k8s.io/karpenter/pkg/apis/v1"
+	"sigs.k8s.io/karpenter/pkg/scheduling"
+)
+
+const (
+	// CapacityFallbackAlways launches on-demand once no spot offering is available, the default
+	CapacityFallbackAlways = "Always"
+	// CapacityFallbackNever never launches on-demand while spot is allowed, failing the launch instead
+	CapacityFallbackNever = "Never"
+	// CapacityFallbackAfterNFailures launches on-demand once the given number of spot launches of the nodepool failed
+	// recently, counting the launches finding no spot offering available, in the format AfterNFailures=<n>
+	CapacityFallbackAfterNFailures = "AfterNFailures"
+)
+
+// SpotFailureMemory is how long the failed spot launches of a nodepool are remembered after the last one
+const SpotFailureMemory = 10 * time.Minute
+
+// CapacityFallback is the strategy of falling back from spot to on-demand of the nodeclaims of a nodepool allowing both
+type CapacityFallback struct {
+	Strategy string
+	// Failures is the number of recent spot failures falling back after with CapacityFallbackAfterNFailures
+	Failures int
+}
+
+// ParseCapacityFallback parses the capacity fallback strategy: Always, Never or AfterNFailures=<n>, with n at least 1
+func ParseCapacityFallback(value string) (CapacityFallback, error) {
+	switch value {
+	case CapacityFallbackAlways, CapacityFallbackNever:
+		return CapacityFallback{Strategy: value}, nil
+	}
+	if failures, ok := strings.CutPrefix(value, CapacityFallbackAfterNFailures+"="); ok {
+		if n, err := strconv.Atoi(failures); err == nil && n >= 1 {
+			return CapacityFallback{Strategy: CapacityFallbackAfterNFailures, Failures: n}, nil
+		}
+	}
+	return CapacityFallback{}, fmt.Errorf("capacity fallback %q is invalid, expected %s, %s or %s=<n> with n at least 1",
+		value, CapacityFallbackAlways, CapacityFallbackNever, CapacityFallbackAfterNFailures)
+}
+
+func (c CapacityFallback) String() string {
+	if c.Strategy == CapacityFallbackAfterNFailures {
+		return fmt.Sprintf("%s=%d", c.Strategy, c.Failures)
+	}
+	return c.Strategy
+}
+
+// CapacityType returns the capacity type the nodeclaim is restricted to by the strategy, given the recent spot failures
+// of its nodepool, or "" if it isn't: spot with CapacityFallbackNever, and with CapacityFallbackAfterNFailures until the
+// failures reach its number, on-demand after. Nodeclaims not allowing both spot and on-demand aren't restricted.
+func (c CapacityFallback) CapacityType(nodeClaim *karpv1.NodeClaim, spotFailures int) string {
+	capacityTypes := scheduling.NewNodeSelectorRequirementsWithMinValues(nodeClaim.Spec.Requirements...).Get(karpv1.CapacityTypeLabelKey)
+	if !capacityTypes.Has(karpv1.CapacityTypeSpot) || !capacityTypes.Has(karpv1.CapacityTypeOnDemand) {
+		return ""
+	}
+	switch c.Strategy {
+	case CapacityFallbackNever:
+		return karpv1.CapacityTypeSpot
+	case CapacityFallbackAfterNFailures:
+		if spotFailures >= c.Failures {
+			return karpv1.CapacityTypeOnDemand
+		}
+		return karpv1.CapacityTypeSpot
+	}
+	return ""
+}
+
+// WithCapacityType returns a copy of the nodeclaim requiring the capacity type
+func WithCapacityType(nodeClaim *karpv1.NodeClaim, capacityType string) *karpv1.NodeClaim {
+	restricted := nodeClaim.DeepCopy()
+	restricted.Spec.Requirements = append(restricted.Spec.Requirements, karpv1.NodeSelectorRequirementWithMinValues{
+		NodeSelectorRequirement: v1.NodeSelectorRequirement{
+			Key:      karpv1.CapacityTypeLabelKey,
+			Operator: v1.NodeSelectorOpIn,
+			Values:   []string{capacityType},
+		},
+	})
+	return restricted
+}
+
+// SpotFailures counts the recent failed spot launches of nodepools, forgotten SpotFailureMemory after the last one, or
+// once a spot launch of the nodepool succeeds
+type SpotFailures struct {
+	mu    sync.Mutex
+	cache *cache.Cache
+}
+
+func NewSpotFailures() *SpotFailures {
+	return &SpotFailures{cache: cache.New(SpotFailureMemory, time.Minute)}
+}
+
+// Record records a failed spot launch of the nodepool
+func (s *SpotFailures) Record(nodePool string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.cache.SetDefault(nodePool, s.count(nodePool)+1)
+}
+
+// Reset forgets the failed spot launches of the nodepool
+func (s *SpotFailures) Reset(nodePool string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.cache.Delete(nodePool)
+}
+
+// Count returns the number of recent failed spot launches of the nodepool
+func (s *SpotFailures) Count(nodePool string) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.count(nodePool)
+}
+
+func (s *SpotFailures) count(nodePool string) int {
+	if failures, ok := s.cache.Get(nodePool); ok {
+		return failures.(int)
+	}
+	return 0
+}
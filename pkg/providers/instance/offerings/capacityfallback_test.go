@@ -0,0 +1,153 @@
+/*
+Portions Copyright (c) Microsoft Corporation.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package offerings
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+	karpv1 "sigs.k8s.io/karpenter/pkg/apis/v1"
+	"sigs.k8s.io/karpenter/pkg/scheduling"
+)
+
+func TestParseCapacityFallback(t *testing.T) {
+	cases := []struct {
+		value       string
+		expected    CapacityFallback
+		expectedErr bool
+	}{
+		{value: "Always", expected: CapacityFallback{Strategy: CapacityFallbackAlways}},
+		{value: "Never", expected: CapacityFallback{Strategy: CapacityFallbackNever}},
+		{value: "AfterNFailures=2", expected: CapacityFallback{Strategy: CapacityFallbackAfterNFailures, Failures: 2}},
+		{value: "AfterNFailures=0", expectedErr: true},
+		{value: "AfterNFailures=two", expectedErr: true},
+		{value: "AfterNFailures", expectedErr: true},
+		{value: "always", expectedErr: true},
+		{value: "", expectedErr: true},
+	}
+	for _, c := range cases {
+		t.Run(c.value, func(t *testing.T) {
+			fallback, err := ParseCapacityFallback(c.value)
+			if c.expectedErr {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, c.expected, fallback)
+			assert.Equal(t, c.value, fallback.String())
+		})
+	}
+}
+
+func nodeClaimWithCapacityTypes(capacityTypes ...string) *karpv1.NodeClaim {
+	return &karpv1.NodeClaim{
+		Spec: karpv1.NodeClaimSpec{
+			Requirements: []karpv1.NodeSelectorRequirementWithMinValues{{
+				NodeSelectorRequirement: corev1.NodeSelectorRequirement{
+					Key:      karpv1.CapacityTypeLabelKey,
+					Operator: corev1.NodeSelectorOpIn,
+					Values:   capacityTypes,
+				},
+			}},
+		},
+	}
+}
+
+func TestCapacityFallbackCapacityType(t *testing.T) {
+	spotOrOnDemand := nodeClaimWithCapacityTypes(karpv1.CapacityTypeSpot, karpv1.CapacityTypeOnDemand)
+	cases := []struct {
+		name         string
+		fallback     CapacityFallback
+		nodeClaim    *karpv1.NodeClaim
+		spotFailures int
+		expected     string
+	}{
+		{
+			name:         "Always doesn't restrict the capacity type, whatever the spot failures",
+			fallback:     CapacityFallback{Strategy: CapacityFallbackAlways},
+			nodeClaim:    spotOrOnDemand,
+			spotFailures: 5,
+			expected:     "",
+		},
+		{
+			name:      "Never restricts to spot",
+			fallback:  CapacityFallback{Strategy: CapacityFallbackNever},
+			nodeClaim: spotOrOnDemand,
+			expected:  karpv1.CapacityTypeSpot,
+		},
+		{
+			name:      "Never doesn't restrict nodeclaims requiring on-demand",
+			fallback:  CapacityFallback{Strategy: CapacityFallbackNever},
+			nodeClaim: nodeClaimWithCapacityTypes(karpv1.CapacityTypeOnDemand),
+			expected:  "",
+		},
+		{
+			name:         "AfterNFailures restricts to spot before the failures",
+			fallback:     CapacityFallback{Strategy: CapacityFallbackAfterNFailures, Failures: 2},
+			nodeClaim:    spotOrOnDemand,
+			spotFailures: 1,
+			expected:     karpv1.CapacityTypeSpot,
+		},
+		{
+			name:         "AfterNFailures restricts to on-demand after the failures",
+			fallback:     CapacityFallback{Strategy: CapacityFallbackAfterNFailures, Failures: 2},
+			nodeClaim:    spotOrOnDemand,
+			spotFailures: 2,
+			expected:     karpv1.CapacityTypeOnDemand,
+		},
+		{
+			name:         "AfterNFailures doesn't restrict nodeclaims requiring spot",
+			fallback:     CapacityFallback{Strategy: CapacityFallbackAfterNFailures, Failures: 2},
+			nodeClaim:    nodeClaimWithCapacityTypes(karpv1.CapacityTypeSpot),
+			spotFailures: 2,
+			expected:     "",
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			assert.Equal(t, c.expected, c.fallback.CapacityType(c.nodeClaim, c.spotFailures))
+		})
+	}
+}
+
+func TestWithCapacityType(t *testing.T) {
+	nodeClaim := nodeClaimWithCapacityTypes(karpv1.CapacityTypeSpot, karpv1.CapacityTypeOnDemand)
+	restricted := WithCapacityType(nodeClaim, karpv1.CapacityTypeOnDemand)
+
+	capacityTypes := scheduling.NewNodeSelectorRequirementsWithMinValues(restricted.Spec.Requirements...).Get(karpv1.CapacityTypeLabelKey)
+	assert.True(t, capacityTypes.Has(karpv1.CapacityTypeOnDemand))
+	assert.False(t, capacityTypes.Has(karpv1.CapacityTypeSpot))
+	// the nodeclaim itself isn't restricted
+	assert.Len(t, nodeClaim.Spec.Requirements, 1)
+}
+
+func TestSpotFailures(t *testing.T) {
+	failures := NewSpotFailures()
+	assert.Equal(t, 0, failures.Count("batch"))
+
+	failures.Record("batch")
+	failures.Record("batch")
+	failures.Record("serving")
+	assert.Equal(t, 2, failures.Count("batch"))
+	assert.Equal(t, 1, failures.Count("serving"))
+
+	// a successful spot launch forgets the failures of its nodepool only
+	failures.Reset("batch")
+	assert.Equal(t, 0, failures.Count("batch"))
+	assert.Equal(t, 1, failures.Count("serving"))
+}
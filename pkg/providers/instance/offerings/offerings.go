@@ -33,11 +33,19 @@ import (
 
 // Suggestion: consider merging this package with instancetype package, as both of their responsibilities deal with instance types management
 
-// Pick the "best" SKU, priority and zone, from InstanceType options (and their offerings) in the request
+// SpotPlacementScores are the spot placement scores of instance types by zone, between 0 for the least and 1 for the most
+// likely spot placements
+type SpotPlacementScores interface {
+	Score(instanceType, zone string) (float64, bool)
+}
+
+// Pick the "best" SKU, priority and zone, from InstanceType options (and their offerings) in the request.
+// With spot placement scores, spot VMs are launched in the zones with the best score.
 func PickSkuSizePriorityAndZone(
 	ctx context.Context,
 	nodeClaim *karpv1.NodeClaim,
 	instanceTypes []*corecloudprovider.InstanceType,
+	scores SpotPlacementScores,
 ) (*corecloudprovider.InstanceType, string, string) {
 	if len(instanceTypes) == 0 {
 		return nil, "", ""
@@ -53,12 +61,57 @@ func PickSkuSizePriorityAndZone(
 		return getOfferingCapacityType(o) == priority && requestedZones.Has(getOfferingZone(o))
 	})
 	zonesWithPriority := lo.Map(priorityOfferings, func(o *corecloudprovider.Offering, _ int) string { return getOfferingZone(o) })
+	if priority == karpv1.CapacityTypeSpot && scores != nil {
+		zonesWithPriority = bestScoredZones(instanceType.Name, zonesWithPriority, scores)
+	}
 	if zone, ok := sets.New(zonesWithPriority...).PopAny(); ok {
 		return instanceType, priority, zone
 	}
 	return nil, "", ""
 }
 
+// ZoneDistribution is the number of nodes of a nodepool by zone
+type ZoneDistribution map[string]int
+
+// PickSkuSizePriorityAndSpreadZone picks the SKU, priority and zone like PickSkuSizePriorityAndZone, but round-robin across
+// zones: it picks the zone with the fewest nodes in the distribution that an instance type is available in, breaking ties
+// by zone name, and the first (cheapest) instance type available in that zone. It returns no instance type when none of
+// them is available in a zone, e.g. in regions without zones, for the caller to fall back to PickSkuSizePriorityAndZone.
+func PickSkuSizePriorityAndSpreadZone(
+	ctx context.Context,
+	nodeClaim *karpv1.NodeClaim,
+	instanceTypes []*corecloudprovider.InstanceType,
+	distribution ZoneDistribution,
+) (*corecloudprovider.InstanceType, string, string) {
+	requestedZones := scheduling.NewNodeSelectorRequirementsWithMinValues(nodeClaim.Spec.Requirements...).Get(v1.LabelTopologyZone)
+	priorities := make([]string, len(instanceTypes))
+	zonesWithPriority := make([]sets.Set[string], len(instanceTypes))
+	zones := sets.New[string]()
+	for i, instanceType := range instanceTypes {
+		priorities[i] = getPriorityForInstanceType(nodeClaim, instanceType)
+		zonesWithPriority[i] = sets.New[string]()
+		for _, o := range instanceType.Offerings.Available() {
+			if zone := getOfferingZone(o); zone != "" && getOfferingCapacityType(o) == priorities[i] && requestedZones.Has(zone) {
+				zonesWithPriority[i].Insert(zone)
+			}
+		}
+		zones = zones.Union(zonesWithPriority[i])
+	}
+	orderedZones := sets.List(zones)
+	sort.SliceStable(orderedZones, func(i, j int) bool {
+		return distribution[orderedZones[i]] < distribution[orderedZones[j]]
+	})
+	for _, zone := range orderedZones {
+		for i, instanceType := range instanceTypes {
+			if zonesWithPriority[i].Has(zone) {
+				log.FromContext(ctx).Info("selected instance type", logging.InstanceType, instanceType.Name, "zone", zone, "zoneDistribution", distribution)
+				return instanceType, priorities[i], zone
+			}
+		}
+	}
+	return nil, "", ""
+}
+
 // getPriorityForInstanceType selects spot if both constraints are flexible and there is an available offering.
 // The Azure Cloud Provider defaults to Regular, so spot must be explicitly included in capacity type requirements.
 //
@@ -77,17 +130,70 @@ func getPriorityForInstanceType(nodeClaim *karpv1.NodeClaim, instanceType *corec
 	return karpv1.CapacityTypeOnDemand
 }
 
+// bestScoredZones returns the zones with the best spot placement score of the instance type, or all the zones if none
+// of them is scored
+func bestScoredZones(instanceType string, zones []string, scores SpotPlacementScores) []string {
+	best := -1.0
+	bestZones := []string{}
+	for _, zone := range zones {
+		score, ok := scores.Score(instanceType, zone)
+		if !ok || score < best {
+			continue
+		}
+		if score > best {
+			best = score
+			bestZones = []string{}
+		}
+		bestZones = append(bestZones, zone)
+	}
+	if len(bestZones) == 0 {
+		return zones
+	}
+	return bestZones
+}
+
 func OrderInstanceTypesByPrice(instanceTypes []*corecloudprovider.InstanceType, requirements scheduling.Requirements) []*corecloudprovider.InstanceType {
+	return orderInstanceTypes(instanceTypes, requirements, func(_ string, offering *corecloudprovider.Offering) float64 {
+		return offering.Price
+	})
+}
+
+// OrderInstanceTypesByScoredPrice orders instance types by the scored price of their cheapest available offerings, see
+// ScoredPrice, so that cheap spot offerings unlikely to be allocated, or likely to be evicted, are ordered after
+// slightly more expensive ones with better placement scores
+func OrderInstanceTypesByScoredPrice(instanceTypes []*corecloudprovider.InstanceType, requirements scheduling.Requirements, scores SpotPlacementScores, weight float64) []*corecloudprovider.InstanceType {
+	return orderInstanceTypes(instanceTypes, requirements, func(instanceType string, offering *corecloudprovider.Offering) float64 {
+		return ScoredPrice(instanceType, offering, scores, weight)
+	})
+}
+
+// ScoredPrice returns the price of the offering weighted against its spot placement score: the price of a spot offering
+// is raised by up to weight times for the lowest score, and kept for the highest. On-demand and unscored offerings are
+// priced as is.
+func ScoredPrice(instanceType string, offering *corecloudprovider.Offering, scores SpotPlacementScores, weight float64) float64 {
+	if getOfferingCapacityType(offering) != karpv1.CapacityTypeSpot {
+		return offering.Price
+	}
+	score, ok := scores.Score(instanceType, getOfferingZone(offering))
+	if !ok {
+		return offering.Price
+	}
+	return offering.Price * (1 + weight*(1-score))
+}
+
+// orderInstanceTypes orders instance types by the price of their cheapest compatible available offering
+func orderInstanceTypes(instanceTypes []*corecloudprovider.InstanceType, requirements scheduling.Requirements, price func(string, *corecloudprovider.Offering) float64) []*corecloudprovider.InstanceType {
+	cheapest := func(instanceType *corecloudprovider.InstanceType) float64 {
+		cheapestPrice := math.MaxFloat64
+		for _, offering := range instanceType.Offerings.Available().Compatible(requirements) {
+			cheapestPrice = math.Min(cheapestPrice, price(instanceType.Name, offering))
+		}
+		return cheapestPrice
+	}
 	// Order instance types so that we get the cheapest instance types of the available offerings
 	sort.Slice(instanceTypes, func(i, j int) bool {
-		iPrice := math.MaxFloat64
-		jPrice := math.MaxFloat64
-		if len(instanceTypes[i].Offerings.Available().Compatible(requirements)) > 0 {
-			iPrice = instanceTypes[i].Offerings.Available().Compatible(requirements).Cheapest().Price
-		}
-		if len(instanceTypes[j].Offerings.Available().Compatible(requirements)) > 0 {
-			jPrice = instanceTypes[j].Offerings.Available().Compatible(requirements).Cheapest().Price
-		}
+		iPrice := cheapest(instanceTypes[i])
+		jPrice := cheapest(instanceTypes[j])
 		if iPrice == jPrice {
 			return instanceTypes[i].Name < instanceTypes[j].Name
 		}
@@ -208,7 +208,7 @@ func TestPickSkuSizePriorityAndZone(t *testing.T) {
 
 	for _, c := range cases {
 		t.Run(c.name, func(t *testing.T) {
-			instanceType, priority, zone := PickSkuSizePriorityAndZone(context.TODO(), c.nodeClaim, c.instanceTypes)
+			instanceType, priority, zone := PickSkuSizePriorityAndZone(context.TODO(), c.nodeClaim, c.instanceTypes, nil)
 
 			if c.expectedInstanceType == "" {
 				assert.Nil(t, instanceType)
@@ -438,6 +438,249 @@ func TestOrderInstanceTypesByPrice(t *testing.T) {
 	}
 }
 
+// fakeSpotPlacementScores are the scores of instance types by zone
+type fakeSpotPlacementScores map[string]map[string]float64
+
+func (f fakeSpotPlacementScores) Score(instanceType, zone string) (float64, bool) {
+	score, ok := f[instanceType][zone]
+	return score, ok
+}
+
+func spotOffering(price float64, zone string) *cloudprovider.Offering {
+	return &cloudprovider.Offering{
+		Price: price,
+		Requirements: scheduling.NewRequirements(
+			scheduling.NewRequirement(karpv1.CapacityTypeLabelKey, corev1.NodeSelectorOpIn, karpv1.CapacityTypeSpot),
+			scheduling.NewRequirement(corev1.LabelTopologyZone, corev1.NodeSelectorOpIn, zone),
+		),
+		Available: true,
+	}
+}
+
+func TestOrderInstanceTypesByScoredPrice(t *testing.T) {
+	spotRequirements := scheduling.NewRequirements(
+		scheduling.NewRequirement(karpv1.CapacityTypeLabelKey, corev1.NodeSelectorOpIn, karpv1.CapacityTypeSpot),
+	)
+	cases := []struct {
+		name          string
+		scores        fakeSpotPlacementScores
+		weight        float64
+		expectedOrder []string
+	}{
+		{
+			name:          "Order by price without scores",
+			scores:        fakeSpotPlacementScores{},
+			weight:        0.5,
+			expectedOrder: []string{"Cheap", "Expensive"},
+		},
+		{
+			name: "Order cheap offerings with low scores after expensive ones with high scores",
+			scores: fakeSpotPlacementScores{
+				"Cheap":     {"westus-1": 0, "westus-2": 0},
+				"Expensive": {"westus-1": 1},
+			},
+			weight:        0.5,
+			expectedOrder: []string{"Expensive", "Cheap"},
+		},
+		{
+			name: "Keep ordering by price when the price difference outweighs the scores",
+			scores: fakeSpotPlacementScores{
+				"Cheap":     {"westus-1": 0, "westus-2": 0},
+				"Expensive": {"westus-1": 1},
+			},
+			weight:        0.1,
+			expectedOrder: []string{"Cheap", "Expensive"},
+		},
+		{
+			name: "Order by the best scored offering of each instance type",
+			scores: fakeSpotPlacementScores{
+				"Cheap":     {"westus-1": 0, "westus-2": 1},
+				"Expensive": {"westus-1": 1},
+			},
+			weight:        0.5,
+			expectedOrder: []string{"Cheap", "Expensive"},
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			instanceTypes := []*cloudprovider.InstanceType{
+				{Name: "Expensive", Offerings: []*cloudprovider.Offering{spotOffering(0.12, "westus-1")}},
+				{Name: "Cheap", Offerings: []*cloudprovider.Offering{spotOffering(0.1, "westus-1"), spotOffering(0.1, "westus-2")}},
+			}
+			ordered := OrderInstanceTypesByScoredPrice(instanceTypes, spotRequirements, c.scores, c.weight)
+			actualOrder := make([]string, len(ordered))
+			for i, it := range ordered {
+				actualOrder[i] = it.Name
+			}
+			assert.Equal(t, c.expectedOrder, actualOrder)
+		})
+	}
+}
+
+func TestPickSkuSizePriorityAndZoneWithSpotPlacementScores(t *testing.T) {
+	nodeClaim := &karpv1.NodeClaim{
+		Spec: karpv1.NodeClaimSpec{
+			Requirements: []karpv1.NodeSelectorRequirementWithMinValues{
+				{NodeSelectorRequirement: corev1.NodeSelectorRequirement{Key: karpv1.CapacityTypeLabelKey, Operator: corev1.NodeSelectorOpIn, Values: []string{karpv1.CapacityTypeSpot}}},
+			},
+		},
+	}
+	instanceTypes := []*cloudprovider.InstanceType{
+		{
+			Name:      "Standard_D2s_v3",
+			Offerings: []*cloudprovider.Offering{spotOffering(0.1, "westus-1"), spotOffering(0.1, "westus-2"), spotOffering(0.1, "westus-3")},
+		},
+	}
+	cases := []struct {
+		name          string
+		scores        fakeSpotPlacementScores
+		expectedZones []string
+	}{
+		{
+			name: "Picks the best scored zone",
+			scores: fakeSpotPlacementScores{
+				"Standard_D2s_v3": {"westus-1": 0, "westus-2": 1, "westus-3": 0.5},
+			},
+			expectedZones: []string{"westus-2"},
+		},
+		{
+			name: "Picks among the zones with the best score",
+			scores: fakeSpotPlacementScores{
+				"Standard_D2s_v3": {"westus-1": 0.5, "westus-3": 0.5},
+			},
+			expectedZones: []string{"westus-1", "westus-3"},
+		},
+		{
+			name:          "Picks any zone without scores",
+			scores:        fakeSpotPlacementScores{},
+			expectedZones: []string{"westus-1", "westus-2", "westus-3"},
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			instanceType, priority, zone := PickSkuSizePriorityAndZone(context.TODO(), nodeClaim, instanceTypes, c.scores)
+			assert.Equal(t, "Standard_D2s_v3", instanceType.Name)
+			assert.Equal(t, karpv1.CapacityTypeSpot, priority)
+			assert.Contains(t, c.expectedZones, zone)
+		})
+	}
+}
+
+func onDemandOffering(price float64, zone string) *cloudprovider.Offering {
+	return &cloudprovider.Offering{
+		Price: price,
+		Requirements: scheduling.NewRequirements(
+			scheduling.NewRequirement(karpv1.CapacityTypeLabelKey, corev1.NodeSelectorOpIn, karpv1.CapacityTypeOnDemand),
+			scheduling.NewRequirement(corev1.LabelTopologyZone, corev1.NodeSelectorOpIn, zone),
+		),
+		Available: true,
+	}
+}
+
+func TestPickSkuSizePriorityAndSpreadZoneSequentialLaunches(t *testing.T) {
+	// the cheapest offerings are in westus-1, which a price ordering would launch every node in
+	instanceTypes := OrderInstanceTypesByPrice([]*cloudprovider.InstanceType{
+		{
+			Name:      "Standard_D2s_v3",
+			Offerings: []*cloudprovider.Offering{onDemandOffering(0.1, "westus-1"), onDemandOffering(0.2, "westus-2")},
+		},
+		{
+			Name:      "Standard_D4s_v3",
+			Offerings: []*cloudprovider.Offering{onDemandOffering(0.15, "westus-1"), onDemandOffering(0.3, "westus-2"), onDemandOffering(0.3, "westus-3")},
+		},
+	}, scheduling.NewRequirements())
+	distribution := ZoneDistribution{}
+	expected := []struct{ instanceType, zone string }{
+		{"Standard_D2s_v3", "westus-1"},
+		{"Standard_D2s_v3", "westus-2"},
+		{"Standard_D4s_v3", "westus-3"},
+		{"Standard_D2s_v3", "westus-1"},
+		{"Standard_D2s_v3", "westus-2"},
+		{"Standard_D4s_v3", "westus-3"},
+	}
+	for i, e := range expected {
+		instanceType, priority, zone := PickSkuSizePriorityAndSpreadZone(context.TODO(), &karpv1.NodeClaim{}, instanceTypes, distribution)
+		if !assert.NotNil(t, instanceType, "launch %d", i) {
+			return
+		}
+		assert.Equal(t, e.instanceType, instanceType.Name, "launch %d", i)
+		assert.Equal(t, karpv1.CapacityTypeOnDemand, priority, "launch %d", i)
+		assert.Equal(t, e.zone, zone, "launch %d", i)
+		// the launched node is in the distribution of the next launch
+		distribution[zone]++
+	}
+}
+
+func TestPickSkuSizePriorityAndSpreadZone(t *testing.T) {
+	instanceTypes := []*cloudprovider.InstanceType{
+		{
+			Name:      "Standard_D2s_v3",
+			Offerings: []*cloudprovider.Offering{onDemandOffering(0.1, "westus-1"), onDemandOffering(0.1, "westus-2"), onDemandOffering(0.1, "westus-3")},
+		},
+	}
+	cases := []struct {
+		name          string
+		instanceTypes []*cloudprovider.InstanceType
+		nodeClaim     *karpv1.NodeClaim
+		distribution  ZoneDistribution
+		expectedZone  string
+	}{
+		{
+			name:          "Picks the zone with the fewest nodes",
+			instanceTypes: instanceTypes,
+			nodeClaim:     &karpv1.NodeClaim{},
+			distribution:  ZoneDistribution{"westus-1": 2, "westus-2": 1, "westus-3": 2},
+			expectedZone:  "westus-2",
+		},
+		{
+			name:          "Picks a zone without nodes",
+			instanceTypes: instanceTypes,
+			nodeClaim:     &karpv1.NodeClaim{},
+			distribution:  ZoneDistribution{"westus-1": 1, "westus-2": 1},
+			expectedZone:  "westus-3",
+		},
+		{
+			name:          "Picks the zone with the fewest nodes among the requested zones",
+			instanceTypes: instanceTypes,
+			nodeClaim: &karpv1.NodeClaim{
+				Spec: karpv1.NodeClaimSpec{
+					Requirements: []karpv1.NodeSelectorRequirementWithMinValues{
+						{NodeSelectorRequirement: corev1.NodeSelectorRequirement{Key: corev1.LabelTopologyZone, Operator: corev1.NodeSelectorOpIn, Values: []string{"westus-1", "westus-2"}}},
+					},
+				},
+			},
+			distribution: ZoneDistribution{"westus-1": 2, "westus-2": 3},
+			expectedZone: "westus-1",
+		},
+		{
+			name: "Picks no zone without zonal offerings",
+			instanceTypes: []*cloudprovider.InstanceType{
+				{Name: "Standard_D2s_v3", Offerings: []*cloudprovider.Offering{onDemandOffering(0.1, "")}},
+			},
+			nodeClaim:    &karpv1.NodeClaim{},
+			distribution: ZoneDistribution{},
+			expectedZone: "",
+		},
+		{
+			name:          "Picks no zone without instance types",
+			instanceTypes: []*cloudprovider.InstanceType{},
+			nodeClaim:     &karpv1.NodeClaim{},
+			distribution:  ZoneDistribution{},
+			expectedZone:  "",
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			instanceType, _, zone := PickSkuSizePriorityAndSpreadZone(context.TODO(), c.nodeClaim, c.instanceTypes, c.distribution)
+			assert.Equal(t, c.expectedZone, zone)
+			assert.Equal(t, c.expectedZone == "", instanceType == nil)
+		})
+	}
+}
+
 func TestGetOfferingCapacityType(t *testing.T) {
 	cases := []struct {
 		name             string
@@ -0,0 +1,140 @@
+/*
+Portions Copyright (c) Microsoft Corporation.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package instance
+
+import (
+	"context"
+	"strings"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/arm"
+	arg "github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/resourcegraph/armresourcegraph"
+	"github.com/samber/lo"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	"github.com/Azure/karpenter-provider-azure/pkg/apis/v1beta1"
+)
+
+// resourceLocation is the subscription and resource group node resources are created in
+type resourceLocation struct {
+	subscriptionID string
+	resourceGroup  string
+}
+
+func (l resourceLocation) equal(other resourceLocation) bool {
+	return strings.EqualFold(l.subscriptionID, other.subscriptionID) && strings.EqualFold(l.resourceGroup, other.resourceGroup)
+}
+
+// subscriptionClient returns the clients of the subscription node resources are created in.
+// The empty subscription, and the cluster's own, map to the provider's clients.
+func (p *DefaultVMProvider) subscriptionClient(subscriptionID string) (*AZClient, error) {
+	if subscriptionID == "" || strings.EqualFold(subscriptionID, p.subscriptionID) {
+		return p.azClient, nil
+	}
+	return p.azClient.ForSubscription(subscriptionID)
+}
+
+// isForeignSubscription returns whether the subscription is another than the cluster's
+func (p *DefaultVMProvider) isForeignSubscription(subscriptionID string) bool {
+	return subscriptionID != "" && !strings.EqualFold(subscriptionID, p.subscriptionID)
+}
+
+// nodeClassLocation returns where the node resources of the nodeclass are created, defaulting to the cluster's
+// subscription and node resource group
+func (p *DefaultVMProvider) nodeClassLocation(nodeClass *v1beta1.AKSNodeClass) resourceLocation {
+	return resourceLocation{
+		subscriptionID: lo.Ternary(nodeClass.Spec.SubscriptionID != nil, lo.FromPtr(nodeClass.Spec.SubscriptionID), p.subscriptionID),
+		resourceGroup:  lo.Ternary(nodeClass.Spec.ResourceGroup != nil, lo.FromPtr(nodeClass.Spec.ResourceGroup), p.resourceGroup),
+	}
+}
+
+// locationFor returns where the named VM, and its NIC and disk, are, defaulting to the cluster's subscription and
+// node resource group
+func (p *DefaultVMProvider) locationFor(resourceName string) resourceLocation {
+	location, ok := p.resourceLocations.Load(strings.ToLower(resourceName))
+	if !ok {
+		return resourceLocation{subscriptionID: p.subscriptionID, resourceGroup: p.resourceGroup}
+	}
+	return location.(resourceLocation)
+}
+
+// clientFor returns the clients of the subscription the named VM, and its NIC, are in
+func (p *DefaultVMProvider) clientFor(resourceName string) *AZClient {
+	client, err := p.subscriptionClient(p.locationFor(resourceName).subscriptionID)
+	if err != nil {
+		// the clients were constructed when the location was recorded, so this is not expected
+		return p.azClient
+	}
+	return client
+}
+
+// resourceGroupFor returns the resource group the named VM, and its NIC, are in
+func (p *DefaultVMProvider) resourceGroupFor(resourceName string) string {
+	return p.locationFor(resourceName).resourceGroup
+}
+
+// recordLocation remembers the subscription and resource group of a VM or NIC, parsed from its resource ID
+func (p *DefaultVMProvider) recordLocation(resourceName string, resourceID *string) {
+	if resourceID == nil {
+		return
+	}
+	id, err := arm.ParseResourceID(*resourceID)
+	if err != nil {
+		return
+	}
+	p.resourceLocations.Store(strings.ToLower(resourceName), resourceLocation{subscriptionID: id.SubscriptionID, resourceGroup: id.ResourceGroupName})
+}
+
+// locations returns the cluster's subscription and node resource group, followed by every other location an
+// AKSNodeClass creates node resources in, so that listing and garbage collection cover nodes in all of them.
+func (p *DefaultVMProvider) locations(ctx context.Context) []resourceLocation {
+	locations := []resourceLocation{{subscriptionID: p.subscriptionID, resourceGroup: p.resourceGroup}}
+	if p.kubeClient == nil {
+		return locations
+	}
+	nodeClassList := &v1beta1.AKSNodeClassList{}
+	if err := p.kubeClient.List(ctx, nodeClassList); err != nil {
+		log.FromContext(ctx).Error(err, "failed to list nodeclasses, listing node resources in the cluster subscription only")
+		return locations
+	}
+	for i := range nodeClassList.Items {
+		location := p.nodeClassLocation(&nodeClassList.Items[i])
+		if lo.ContainsBy(locations, location.equal) {
+			continue
+		}
+		locations = append(locations, location)
+	}
+	return locations
+}
+
+// newQueryRequests returns the requests of the query in each resource group node resources are created in, each
+// request covering the subscriptions with node resources in the resource group
+func (p *DefaultVMProvider) newQueryRequests(ctx context.Context, query func(resourceGroup string) string) []*arg.QueryRequest {
+	var requests []*arg.QueryRequest
+	var resourceGroups []string
+	for _, location := range p.locations(ctx) {
+		i := lo.IndexOf(resourceGroups, strings.ToLower(location.resourceGroup))
+		if i < 0 {
+			resourceGroups = append(resourceGroups, strings.ToLower(location.resourceGroup))
+			requests = append(requests, NewQueryRequest(lo.ToPtr(location.subscriptionID), query(location.resourceGroup)))
+			continue
+		}
+		if !lo.ContainsBy(requests[i].Subscriptions, func(s *string) bool { return strings.EqualFold(*s, location.subscriptionID) }) {
+			requests[i].Subscriptions = append(requests[i].Subscriptions, lo.ToPtr(location.subscriptionID))
+		}
+	}
+	return requests
+}
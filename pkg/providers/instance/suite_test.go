@@ -20,8 +20,10 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"io"
 	"net/http"
 	"strings"
+	"sync"
 	"testing"
 	"time"
 
@@ -29,6 +31,12 @@ import (
 	. "github.com/onsi/ginkgo/v2"
 	. "github.com/onsi/gomega"
 	"github.com/samber/lo"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace/noop"
+	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/client-go/tools/record"
 	clock "k8s.io/utils/clock/testing"
@@ -43,7 +51,9 @@ import (
 	"sigs.k8s.io/karpenter/pkg/test/v1alpha1"
 	. "sigs.k8s.io/karpenter/pkg/utils/testing"
 
+	sdkerrors "github.com/Azure/azure-sdk-for-go-extensions/pkg/errors"
 	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/arm"
 	"github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/compute/armcompute/v7"
 	"github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/network/armnetwork"
 	"github.com/Azure/karpenter-provider-azure/pkg/apis"
@@ -54,9 +64,11 @@ import (
 	metrics "github.com/Azure/karpenter-provider-azure/pkg/metrics"
 	"github.com/Azure/karpenter-provider-azure/pkg/operator/options"
 	instancemetrics "github.com/Azure/karpenter-provider-azure/pkg/providers/instance"
+	"github.com/Azure/karpenter-provider-azure/pkg/providers/instance/offerings"
 	"github.com/Azure/karpenter-provider-azure/pkg/providers/launchtemplate"
 	"github.com/Azure/karpenter-provider-azure/pkg/test"
 	. "github.com/Azure/karpenter-provider-azure/pkg/test/expectations"
+	"github.com/Azure/karpenter-provider-azure/pkg/tracing"
 	"github.com/Azure/karpenter-provider-azure/pkg/utils"
 )
 
@@ -355,6 +367,202 @@ var _ = Describe("VMInstanceProvider", func() {
 		ZonalAndNonZonalRegions,
 	)
 
+	Context("capacity fallback", func() {
+		// zonalAllocationFailure fails spot launches in a single zone, leaving the spot offerings of the other zones
+		zonalAllocationFailure := &azcore.ResponseError{
+			ErrorCode: sdkerrors.OverconstrainedZonalAllocationRequest,
+			RawResponse: &http.Response{
+				Body: io.NopCloser(strings.NewReader(fmt.Sprintf(`{"error":{"code": "%s", "message": "Allocation failed."}}`, sdkerrors.OverconstrainedZonalAllocationRequest))),
+			},
+		}
+		// launch launches the nodeclaim with the available offerings of Standard_D2_v2
+		launch := func() (*instancemetrics.VirtualMachinePromise, error) {
+			instanceTypes, err := cloudProvider.GetInstanceTypes(ctx, nodePool)
+			Expect(err).ToNot(HaveOccurred())
+			instanceTypes = lo.Filter(instanceTypes, func(i *corecloudprovider.InstanceType, _ int) bool { return i.Name == "Standard_D2_v2" })
+			return azureEnv.VMInstanceProvider.BeginCreate(ctx, nodeClass, nodeClaim, instanceTypes)
+		}
+		markSpotUnavailable := func() {
+			for _, zone := range azureEnv.Zones() {
+				azureEnv.UnavailableOfferingsCache.MarkUnavailable(ctx, "SubscriptionQuotaReached", "Standard_D2_v2", zone, karpv1.CapacityTypeSpot)
+			}
+		}
+
+		BeforeEach(func() {
+			nodeClaim.Spec.Requirements = []karpv1.NodeSelectorRequirementWithMinValues{{
+				NodeSelectorRequirement: corev1.NodeSelectorRequirement{
+					Key:      karpv1.CapacityTypeLabelKey,
+					Operator: corev1.NodeSelectorOpIn,
+					Values:   []string{karpv1.CapacityTypeSpot, karpv1.CapacityTypeOnDemand},
+				},
+			}}
+		})
+
+		It("should fall back to on-demand once spot is unavailable without a capacity fallback annotation", func() {
+			ExpectApplied(ctx, env.Client, nodeClaim, nodePool, nodeClass)
+			markSpotUnavailable()
+
+			promise, err := launch()
+			Expect(err).ToNot(HaveOccurred())
+			Expect(instancemetrics.GetCapacityTypeFromVM(promise.VM)).To(Equal(karpv1.CapacityTypeOnDemand))
+			Expect(promise.CapacityFallback).To(Equal(offerings.CapacityFallbackAlways))
+		})
+		It("should launch spot without falling back while spot is available", func() {
+			ExpectApplied(ctx, env.Client, nodeClaim, nodePool, nodeClass)
+
+			promise, err := launch()
+			Expect(err).ToNot(HaveOccurred())
+			Expect(instancemetrics.GetCapacityTypeFromVM(promise.VM)).To(Equal(karpv1.CapacityTypeSpot))
+			Expect(promise.CapacityFallback).To(BeEmpty())
+		})
+		It("should never fall back to on-demand with the Never capacity fallback", func() {
+			nodePool.Annotations = map[string]string{v1beta1.AnnotationCapacityFallback: "Never"}
+			ExpectApplied(ctx, env.Client, nodeClaim, nodePool, nodeClass)
+			markSpotUnavailable()
+
+			promise, err := launch()
+			Expect(corecloudprovider.IsInsufficientCapacityError(err)).To(BeTrue())
+			Expect(err.Error()).To(ContainSubstring("capacity fallback of nodepool %s is Never", nodePool.Name))
+			Expect(promise).To(BeNil())
+			Expect(azureEnv.VirtualMachinesAPI.VirtualMachineCreateOrUpdateBehavior.CalledWithInput.Len()).To(Equal(0))
+		})
+		It("should fall back to on-demand after the spot failures of the AfterNFailures capacity fallback", func() {
+			nodePool.Annotations = map[string]string{v1beta1.AnnotationCapacityFallback: "AfterNFailures=2"}
+			ExpectApplied(ctx, env.Client, nodeClaim, nodePool, nodeClass)
+
+			// the first spot failure leaves spot in the other zones
+			azureEnv.VirtualMachinesAPI.VirtualMachineCreateOrUpdateBehavior.BeginError.Set(zonalAllocationFailure)
+			_, err := launch()
+			Expect(corecloudprovider.IsInsufficientCapacityError(err)).To(BeTrue())
+			Expect(azureEnv.VirtualMachinesAPI.VirtualMachineCreateOrUpdateBehavior.CalledWithInput.Pop().VM.Properties.Priority).To(Equal(lo.ToPtr(armcompute.VirtualMachinePriorityTypesSpot)))
+			// so is launched again, failing a second time
+			_, err = launch()
+			Expect(corecloudprovider.IsInsufficientCapacityError(err)).To(BeTrue())
+			Expect(azureEnv.VirtualMachinesAPI.VirtualMachineCreateOrUpdateBehavior.CalledWithInput.Pop().VM.Properties.Priority).To(Equal(lo.ToPtr(armcompute.VirtualMachinePriorityTypesSpot)))
+
+			// after which the nodepool falls back to on-demand, though spot is still available in a zone
+			azureEnv.VirtualMachinesAPI.VirtualMachineCreateOrUpdateBehavior.BeginError.Set(nil)
+			promise, err := launch()
+			Expect(err).ToNot(HaveOccurred())
+			Expect(instancemetrics.GetCapacityTypeFromVM(promise.VM)).To(Equal(karpv1.CapacityTypeOnDemand))
+			Expect(promise.CapacityFallback).To(Equal("AfterNFailures=2"))
+			Expect(promise.SpotFailures).To(Equal(2))
+		})
+		It("should count launches finding no spot offering toward the spot failures of the AfterNFailures capacity fallback", func() {
+			nodePool.Annotations = map[string]string{v1beta1.AnnotationCapacityFallback: "AfterNFailures=2"}
+			ExpectApplied(ctx, env.Client, nodeClaim, nodePool, nodeClass)
+			markSpotUnavailable()
+
+			for range 2 {
+				promise, err := launch()
+				Expect(corecloudprovider.IsInsufficientCapacityError(err)).To(BeTrue())
+				Expect(err.Error()).To(ContainSubstring("capacity fallback of nodepool %s is AfterNFailures=2", nodePool.Name))
+				Expect(promise).To(BeNil())
+			}
+			Expect(azureEnv.VirtualMachinesAPI.VirtualMachineCreateOrUpdateBehavior.CalledWithInput.Len()).To(Equal(0))
+
+			promise, err := launch()
+			Expect(err).ToNot(HaveOccurred())
+			Expect(instancemetrics.GetCapacityTypeFromVM(promise.VM)).To(Equal(karpv1.CapacityTypeOnDemand))
+			Expect(promise.CapacityFallback).To(Equal("AfterNFailures=2"))
+			Expect(promise.SpotFailures).To(Equal(2))
+		})
+		It("should keep launching spot before the spot failures of the AfterNFailures capacity fallback", func() {
+			nodePool.Annotations = map[string]string{v1beta1.AnnotationCapacityFallback: "AfterNFailures=2"}
+			ExpectApplied(ctx, env.Client, nodeClaim, nodePool, nodeClass)
+
+			azureEnv.VirtualMachinesAPI.VirtualMachineCreateOrUpdateBehavior.BeginError.Set(zonalAllocationFailure)
+			_, err := launch()
+			Expect(corecloudprovider.IsInsufficientCapacityError(err)).To(BeTrue())
+
+			azureEnv.VirtualMachinesAPI.VirtualMachineCreateOrUpdateBehavior.BeginError.Set(nil)
+			promise, err := launch()
+			Expect(err).ToNot(HaveOccurred())
+			Expect(instancemetrics.GetCapacityTypeFromVM(promise.VM)).To(Equal(karpv1.CapacityTypeSpot))
+			Expect(promise.CapacityFallback).To(BeEmpty())
+		})
+	})
+
+	It("should adopt the in flight create of the VM of a nodeclaim rather than creating a second VM", func() {
+		ExpectApplied(ctx, env.Client, nodeClaim, nodePool, nodeClass)
+		instanceTypes, err := cloudProvider.GetInstanceTypes(ctx, nodePool)
+		Expect(err).ToNot(HaveOccurred())
+
+		// the nodeclaim is launched again while its first create is in flight
+		promises := make([]*instancemetrics.VirtualMachinePromise, 2)
+		var wg sync.WaitGroup
+		for i := range promises {
+			wg.Add(1)
+			go func() {
+				defer GinkgoRecover()
+				defer wg.Done()
+				promise, err := azureEnv.VMInstanceProvider.BeginCreate(ctx, nodeClass, nodeClaim, instanceTypes)
+				Expect(err).ToNot(HaveOccurred())
+				promises[i] = promise
+			}()
+		}
+		wg.Wait()
+		for _, promise := range promises {
+			Expect(promise.Wait()).To(Succeed())
+		}
+
+		Expect(promises[0].GetInstanceName()).To(Equal(promises[1].GetInstanceName()))
+		Expect(azureEnv.VirtualMachinesAPI.VirtualMachineCreateOrUpdateBehavior.CalledWithInput.Len()).To(Equal(1))
+		vms := 0
+		azureEnv.VirtualMachinesAPI.Instances.Range(func(_, _ any) bool {
+			vms++
+			return true
+		})
+		Expect(vms).To(Equal(1))
+	})
+
+	It("should not create the NIC of a nodeclaim whose launch template can't be resolved", func() {
+		ExpectApplied(ctx, env.Client, nodeClaim, nodePool, nodeClass)
+		instanceTypes, err := cloudProvider.GetInstanceTypes(ctx, nodePool)
+		Expect(err).ToNot(HaveOccurred())
+		// without images the image of the nodeclaim can't be resolved
+		nodeClass.Status.Images = nil
+
+		_, err = azureEnv.VMInstanceProvider.BeginCreate(ctx, nodeClass, nodeClaim, instanceTypes)
+		Expect(err).To(HaveOccurred())
+		Expect(azureEnv.NetworkInterfacesAPI.NetworkInterfacesCreateOrUpdateBehavior.CalledWithInput.Len()).To(Equal(0))
+		Expect(azureEnv.VirtualMachinesAPI.VirtualMachineCreateOrUpdateBehavior.CalledWithInput.Len()).To(Equal(0))
+	})
+
+	It("should trace the stages of the launch of a nodeclaim as children of its span", func() {
+		recorder := tracetest.NewSpanRecorder()
+		otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+		DeferCleanup(func() { otel.SetTracerProvider(noop.NewTracerProvider()) })
+
+		ExpectApplied(ctx, env.Client, nodeClaim, nodePool, nodeClass)
+		_, err := cloudProvider.Create(ctx, nodeClaim)
+		Expect(err).ToNot(HaveOccurred())
+
+		// the VM is waited for, and its extensions created, asynchronously
+		Eventually(func() []string {
+			return lo.Map(recorder.Ended(), func(span sdktrace.ReadOnlySpan, _ int) string { return span.Name() })
+		}).Should(ContainElement(tracing.SpanCreateAKSIdentifyingExtension))
+		spans := lo.SliceToMap(recorder.Ended(), func(span sdktrace.ReadOnlySpan) (string, sdktrace.ReadOnlySpan) {
+			return span.Name(), span
+		})
+		Expect(spans).To(HaveKey(tracing.SpanCreate))
+		root := spans[tracing.SpanCreate]
+		Expect(root.Parent().IsValid()).To(BeFalse())
+		Expect(root.Attributes()).To(ContainElement(tracing.NodeClaimKey.String(nodeClaim.Name)))
+		for _, stage := range []string{
+			tracing.SpanResolveImage,
+			tracing.SpanCreateNetworkInterface,
+			tracing.SpanCreateVirtualMachine,
+			tracing.SpanWaitForVirtualMachine,
+			tracing.SpanCreateAKSIdentifyingExtension,
+		} {
+			Expect(spans).To(HaveKey(stage))
+			Expect(spans[stage].Parent().SpanID()).To(Equal(root.SpanContext().SpanID()), stage)
+			Expect(spans[stage].SpanContext().TraceID()).To(Equal(root.SpanContext().TraceID()), stage)
+			Expect(spans[stage].Status().Code).To(Equal(codes.Unset), stage)
+		}
+	})
+
 	When("getting the auxiliary token", func() {
 		var originalOptions *options.Options
 		var originalEnv *test.Environment
@@ -547,10 +755,45 @@ var _ = Describe("VMInstanceProvider", func() {
 		})).To(HaveLen(0))
 	})
 
+	It("should create the VM and NIC of a nodeclass of another subscription in its subscription and resource group", func() {
+		spokeSubscriptionID := "abcdef12-4321-4321-4321-210987654321"
+		nodeClass.Spec.SubscriptionID = lo.ToPtr(spokeSubscriptionID)
+		nodeClass.Spec.ResourceGroup = lo.ToPtr("spoke-resourceGroup")
+		ExpectApplied(ctx, env.Client, nodePool, nodeClass)
+
+		pod := coretest.UnschedulablePod(coretest.PodOptions{})
+		ExpectProvisioned(ctx, env.Client, cluster, cloudProvider, coreProvisioner, pod)
+		ExpectScheduled(ctx, env.Client, pod)
+
+		Expect(azureEnv.NetworkInterfacesAPI.NetworkInterfacesCreateOrUpdateBehavior.CalledWithInput.Len()).To(Equal(1))
+		nicInput := azureEnv.NetworkInterfacesAPI.NetworkInterfacesCreateOrUpdateBehavior.CalledWithInput.Pop()
+		Expect(nicInput.ResourceGroupName).To(Equal("spoke-resourceGroup"))
+		// the load balancers and network security group of the cluster can't be referenced from another subscription
+		Expect(nicInput.Interface.Properties.IPConfigurations[0].Properties.LoadBalancerBackendAddressPools).To(BeEmpty())
+		Expect(nicInput.Interface.Properties.NetworkSecurityGroup).To(BeNil())
+
+		Expect(azureEnv.VirtualMachinesAPI.VirtualMachineCreateOrUpdateBehavior.CalledWithInput.Len()).To(Equal(1))
+		vmInput := azureEnv.VirtualMachinesAPI.VirtualMachineCreateOrUpdateBehavior.CalledWithInput.Pop()
+		Expect(vmInput.ResourceGroupName).To(Equal("spoke-resourceGroup"))
+		nicID, err := arm.ParseResourceID(lo.FromPtr(vmInput.VM.Properties.NetworkProfile.NetworkInterfaces[0].ID))
+		Expect(err).ToNot(HaveOccurred())
+		Expect(nicID.ResourceGroupName).To(Equal("spoke-resourceGroup"))
+		Expect(nicID.Name).To(Equal(vmInput.VMName))
+
+		nodeClaims := ExpectNodeClaims(ctx, env.Client)
+		Expect(nodeClaims).To(HaveLen(1))
+		vmID, err := arm.ParseResourceID(strings.TrimPrefix(nodeClaims[0].Status.ProviderID, "azure://"))
+		Expect(err).ToNot(HaveOccurred())
+		Expect(vmID.SubscriptionID).To(Equal(spokeSubscriptionID))
+		Expect(vmID.ResourceGroupName).To(Equal("spoke-resourcegroup"))
+		Expect(vmID.Name).To(Equal(vmInput.VMName))
+	})
+
 	It("should not allow the user to override Karpenter-managed tags", func() {
 		nodeClass.Spec.Tags = map[string]string{
-			"karpenter.azure.com/cluster": "my-override-cluster",
-			"karpenter.sh/nodepool":       "my-override-nodepool",
+			"karpenter.azure.com/cluster":      "my-override-cluster",
+			"karpenter.sh/nodepool":            "my-override-nodepool",
+			"karpenter.azure.com/aksnodeclass": "my-override-nodeclass",
 		}
 		ExpectApplied(ctx, env.Client, nodePool, nodeClass)
 
@@ -565,6 +808,7 @@ var _ = Describe("VMInstanceProvider", func() {
 		tags := vm.Tags
 		Expect(lo.FromPtr(tags[launchtemplate.NodePoolTagKey])).To(Equal(nodePool.Name))
 		Expect(lo.FromPtr(tags[launchtemplate.KarpenterManagedTagKey])).To(Equal(testOptions.ClusterName))
+		Expect(lo.FromPtr(tags[launchtemplate.NodeClassTagKey])).To(Equal(nodeClass.Name))
 
 		Expect(azureEnv.NetworkInterfacesAPI.NetworkInterfacesCreateOrUpdateBehavior.CalledWithInput.Len()).To(Equal(1))
 		nic := azureEnv.NetworkInterfacesAPI.NetworkInterfacesCreateOrUpdateBehavior.CalledWithInput.Pop().Interface
@@ -572,6 +816,7 @@ var _ = Describe("VMInstanceProvider", func() {
 		nicTags := nic.Tags
 		Expect(lo.FromPtr(nicTags[launchtemplate.NodePoolTagKey])).To(Equal(nodePool.Name))
 		Expect(lo.FromPtr(nicTags[launchtemplate.KarpenterManagedTagKey])).To(Equal(testOptions.ClusterName))
+		Expect(lo.FromPtr(nicTags[launchtemplate.NodeClassTagKey])).To(Equal(nodeClass.Name))
 	})
 
 	It("should list nic from karpenter provisioning request", func() {
@@ -594,6 +839,58 @@ var _ = Describe("VMInstanceProvider", func() {
 		Expect(len(interfaces)).To(Equal(1))
 		Expect(interfaces[0].Name).To(Equal(managedNic.Name))
 	})
+	It("should only list nics and VMs of the cluster", func() {
+		managedNic := test.Interface(test.InterfaceOptions{NodepoolName: nodePool.Name})
+		otherClusterNic := test.Interface(test.InterfaceOptions{Tags: map[string]*string{
+			launchtemplate.KarpenterManagedTagKey: lo.ToPtr("other-cluster"),
+			launchtemplate.NodePoolTagKey:         lo.ToPtr(nodePool.Name),
+		}})
+		managedVM := test.VirtualMachine(test.VirtualMachineOptions{NodepoolName: nodePool.Name})
+		otherClusterVM := test.VirtualMachine(test.VirtualMachineOptions{Tags: otherClusterNic.Tags})
+
+		azureEnv.NetworkInterfacesAPI.NetworkInterfaces.Store(lo.FromPtr(managedNic.ID), *managedNic)
+		azureEnv.NetworkInterfacesAPI.NetworkInterfaces.Store(lo.FromPtr(otherClusterNic.ID), *otherClusterNic)
+		azureEnv.VirtualMachinesAPI.Instances.Store(lo.FromPtr(managedVM.ID), *managedVM)
+		azureEnv.VirtualMachinesAPI.Instances.Store(lo.FromPtr(otherClusterVM.ID), *otherClusterVM)
+
+		interfaces, err := azureEnv.VMInstanceProvider.ListNics(ctx)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(interfaces).To(HaveLen(1))
+		Expect(interfaces[0].Name).To(Equal(managedNic.Name))
+		vms, err := azureEnv.VMInstanceProvider.List(ctx)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(vms).To(HaveLen(1))
+		Expect(vms[0].Name).To(Equal(managedVM.Name))
+	})
+	It("should list the untagged nics and VMs of the cluster", func() {
+		// created before the cluster tag was applied
+		untaggedNic := test.Interface(test.InterfaceOptions{Tags: map[string]*string{
+			launchtemplate.NodePoolTagKey: lo.ToPtr(nodePool.Name),
+		}})
+		// created before the nodeclass tag was applied
+		untaggedVM := test.VirtualMachine(test.VirtualMachineOptions{NodepoolName: nodePool.Name})
+		taggedVM := test.VirtualMachine(test.VirtualMachineOptions{Tags: lo.Assign(test.ManagedTags(nodePool.Name), map[string]*string{
+			launchtemplate.NodeClassTagKey: lo.ToPtr(nodeClass.Name),
+		})})
+		otherClusterVM := test.VirtualMachine(test.VirtualMachineOptions{Tags: map[string]*string{
+			launchtemplate.KarpenterManagedTagKey: lo.ToPtr("other-cluster"),
+			launchtemplate.NodePoolTagKey:         lo.ToPtr(nodePool.Name),
+		}})
+
+		azureEnv.NetworkInterfacesAPI.NetworkInterfaces.Store(lo.FromPtr(untaggedNic.ID), *untaggedNic)
+		for _, vm := range []*armcompute.VirtualMachine{untaggedVM, taggedVM, otherClusterVM} {
+			azureEnv.VirtualMachinesAPI.Instances.Store(lo.FromPtr(vm.ID), *vm)
+		}
+
+		interfaces, err := azureEnv.VMInstanceProvider.ListUntaggedNics(ctx)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(interfaces).To(HaveLen(1))
+		Expect(interfaces[0].Name).To(Equal(untaggedNic.Name))
+		vms, err := azureEnv.VMInstanceProvider.ListUntagged(ctx)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(vms).To(HaveLen(1))
+		Expect(vms[0].Name).To(Equal(untaggedVM.Name))
+	})
 
 	It("should create VM with custom Linux admin username", func() {
 		customUsername := "customuser"
@@ -863,4 +1160,48 @@ var _ = Describe("VMInstanceProvider", func() {
 			Expect(vm.Properties.SecurityProfile).To(BeNil())
 		})
 	})
+
+	Context("PatchSettings", func() {
+		It("should create VM with the patch settings of the AKSNodeClass", func() {
+			nodeClass.Spec.PatchSettings = &v1beta1.PatchSettings{
+				Linux: &v1beta1.LinuxPatchSettings{
+					PatchMode:      "AutomaticByPlatform",
+					AssessmentMode: "AutomaticByPlatform",
+					AutomaticByPlatformSettings: &v1beta1.LinuxAutomaticByPlatformSettings{
+						BypassPlatformSafetyChecksOnUserSchedule: lo.ToPtr(false),
+						RebootSetting:                            "IfRequired",
+					},
+				},
+			}
+			ExpectApplied(ctx, env.Client, nodePool, nodeClass)
+
+			pod := coretest.UnschedulablePod(coretest.PodOptions{})
+			ExpectProvisioned(ctx, env.Client, cluster, cloudProvider, coreProvisioner, pod)
+			ExpectScheduled(ctx, env.Client, pod)
+
+			Expect(azureEnv.VirtualMachinesAPI.VirtualMachineCreateOrUpdateBehavior.CalledWithInput.Len()).To(Equal(1))
+			vm := azureEnv.VirtualMachinesAPI.VirtualMachineCreateOrUpdateBehavior.CalledWithInput.Pop().VM
+
+			patchSettings := vm.Properties.OSProfile.LinuxConfiguration.PatchSettings
+			Expect(patchSettings).ToNot(BeNil())
+			Expect(lo.FromPtr(patchSettings.PatchMode)).To(Equal(armcompute.LinuxVMGuestPatchModeAutomaticByPlatform))
+			Expect(lo.FromPtr(patchSettings.AssessmentMode)).To(Equal(armcompute.LinuxPatchAssessmentModeAutomaticByPlatform))
+			Expect(patchSettings.AutomaticByPlatformSettings).ToNot(BeNil())
+			Expect(patchSettings.AutomaticByPlatformSettings.BypassPlatformSafetyChecksOnUserSchedule).To(Equal(lo.ToPtr(false)))
+			Expect(lo.FromPtr(patchSettings.AutomaticByPlatformSettings.RebootSetting)).To(Equal(armcompute.LinuxVMGuestPatchAutomaticByPlatformRebootSettingIfRequired))
+		})
+
+		It("should create VM without patch settings when not specified in AKSNodeClass", func() {
+			ExpectApplied(ctx, env.Client, nodePool, nodeClass)
+
+			pod := coretest.UnschedulablePod(coretest.PodOptions{})
+			ExpectProvisioned(ctx, env.Client, cluster, cloudProvider, coreProvisioner, pod)
+			ExpectScheduled(ctx, env.Client, pod)
+
+			Expect(azureEnv.VirtualMachinesAPI.VirtualMachineCreateOrUpdateBehavior.CalledWithInput.Len()).To(Equal(1))
+			vm := azureEnv.VirtualMachinesAPI.VirtualMachineCreateOrUpdateBehavior.CalledWithInput.Pop().VM
+
+			Expect(vm.Properties.OSProfile.LinuxConfiguration.PatchSettings).To(BeNil())
+		})
+	})
 })
@@ -18,12 +18,15 @@ package instance
 
 import (
 	"context"
+	"crypto/rand"
+	"encoding/base64"
 	"errors"
 	"fmt"
 	"math"
 	"net/http"
-	"reflect"
 	"strconv"
+	"strings"
+	"sync"
 	"time"
 
 	sdkerrors "github.com/Azure/azure-sdk-for-go-extensions/pkg/errors"
@@ -32,6 +35,7 @@ import (
 	"github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/network/armnetwork"
 	"github.com/samber/lo"
 	v1 "k8s.io/api/core/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/log"
 	karpv1 "sigs.k8s.io/karpenter/pkg/apis/v1"
 	corecloudprovider "sigs.k8s.io/karpenter/pkg/cloudprovider"
@@ -43,12 +47,17 @@ import (
 	"github.com/Azure/karpenter-provider-azure/pkg/logging"
 	metrics "github.com/Azure/karpenter-provider-azure/pkg/metrics"
 	"github.com/Azure/karpenter-provider-azure/pkg/operator/options"
+	"github.com/Azure/karpenter-provider-azure/pkg/providers/imagefamily"
 	"github.com/Azure/karpenter-provider-azure/pkg/providers/instance/offerings"
 	"github.com/Azure/karpenter-provider-azure/pkg/providers/instancetype"
 	"github.com/Azure/karpenter-provider-azure/pkg/providers/launchtemplate"
+	"github.com/Azure/karpenter-provider-azure/pkg/providers/launchtemplate/parameters"
 	"github.com/Azure/karpenter-provider-azure/pkg/providers/loadbalancer"
 	"github.com/Azure/karpenter-provider-azure/pkg/providers/networksecuritygroup"
+	"github.com/Azure/karpenter-provider-azure/pkg/providers/spotplacementscore"
+	"github.com/Azure/karpenter-provider-azure/pkg/tracing"
 	"github.com/Azure/karpenter-provider-azure/pkg/utils"
+	"github.com/Azure/karpenter-provider-azure/pkg/utils/redact"
 )
 
 var (
@@ -63,7 +72,9 @@ var (
 )
 
 const (
-	aksIdentifyingExtensionName = "computeAksLinuxBilling"
+	aksIdentifyingExtensionName        = "computeAksLinuxBilling"
+	aksIdentifyingExtensionNameWindows = "computeAksWindowsBilling"
+	windowsAdminUsername               = "azureuser"
 	// TODO: Why bother with a different CSE name for Windows?
 	cseNameWindows = "windows-cse-agent-karpenter"
 	cseNameLinux   = "cse-agent-karpenter"
@@ -83,6 +94,60 @@ func ErrorCodeForMetrics(err error) string {
 	return "UnknownError"
 }
 
+// imageNotFoundErrorCodes are the error codes of VM creates failing because the image doesn't exist, e.g. because its
+// version was deleted from the gallery
+var imageNotFoundErrorCodes = []string{"ImageNotFound", "GalleryImageNotFound"}
+
+// ImageNotFoundError is returned by BeginCreate when the VM is launched with an image that doesn't exist. Image IDs are
+// resolved ahead of the create and cached, and the version of the image may have been deleted since. The versions of
+// custom images are checked before the create, which fails with it without creating the VM.
+type ImageNotFoundError struct {
+	ImageID string
+	Err     error
+}
+
+func (e *ImageNotFoundError) Error() string {
+	return fmt.Sprintf("image %s not found, %s", e.ImageID, e.Err)
+}
+
+func (e *ImageNotFoundError) Unwrap() error {
+	return e.Err
+}
+
+// IsImageNotFoundErr returns whether the error is of a VM create failing because its image doesn't exist
+func IsImageNotFoundErr(err error) bool {
+	azErr := sdkerrors.IsResponseError(err)
+	return azErr != nil && lo.Contains(imageNotFoundErrorCodes, azErr.ErrorCode)
+}
+
+// marketplaceTermsNotAcceptedErrorCodes are the error codes of VM creates failing because the terms of the purchase plan
+// of their marketplace image aren't accepted in the subscription
+var marketplaceTermsNotAcceptedErrorCodes = []string{"MarketplacePurchaseEligibilityFailed", "ResourcePurchaseValidationFailed"}
+
+// MarketplaceTermsNotAcceptedError is returned by BeginCreate when the VM is launched with a marketplace image whose
+// purchase plan terms aren't accepted in the subscription. Launches keep failing until they are.
+type MarketplaceTermsNotAcceptedError struct {
+	ImagePlan *armcompute.PurchasePlan
+	Err       error
+}
+
+func (e *MarketplaceTermsNotAcceptedError) Error() string {
+	return fmt.Sprintf("the terms of the plan of marketplace image %s:%s:%s must be accepted in the subscription, e.g. with "+
+		"az vm image terms accept --publisher %[1]s --offer %[2]s --plan %[3]s, %[4]s",
+		lo.FromPtr(e.ImagePlan.Publisher), lo.FromPtr(e.ImagePlan.Product), lo.FromPtr(e.ImagePlan.Name), e.Err)
+}
+
+func (e *MarketplaceTermsNotAcceptedError) Unwrap() error {
+	return e.Err
+}
+
+// IsMarketplaceTermsNotAcceptedErr returns whether the error is of a VM create failing because the terms of the purchase
+// plan of its marketplace image aren't accepted
+func IsMarketplaceTermsNotAcceptedErr(err error) bool {
+	azErr := sdkerrors.IsResponseError(err)
+	return azErr != nil && lo.Contains(marketplaceTermsNotAcceptedErrorCodes, azErr.ErrorCode)
+}
+
 // GetManagedExtensionNames gets the names of the VM extensions managed by Karpenter.
 // This is a set of 1 or 2 extensions (depending on provisionMode): aksIdentifyingExtension and (sometimes) cse.
 func GetManagedExtensionNames(provisionMode string) []string {
@@ -90,7 +155,7 @@ func GetManagedExtensionNames(provisionMode string) []string {
 		aksIdentifyingExtensionName,
 	}
 	if provisionMode == consts.ProvisionModeBootstrappingClient {
-		result = append(result, cseNameLinux) // TODO: Windows
+		result = append(result, cseNameLinux) // TODO(Windows): the extensions of Windows VMs aren't tagged by Update yet
 	}
 	return result
 }
@@ -100,6 +165,16 @@ type Resource = map[string]interface{}
 type VirtualMachinePromise struct {
 	VM       *armcompute.VirtualMachine
 	WaitFunc func() error
+	// LaunchTemplate is the template the VM was launched from. It is nil if the VM already existed.
+	LaunchTemplate *launchtemplate.Template
+	// CapacityFallback is the capacity fallback strategy of the NodePool when the VM is launched on-demand though its
+	// NodeClaim allows spot, with the recent failed spot launches of the NodePool as SpotFailures. It's empty otherwise.
+	CapacityFallback string
+	SpotFailures     int
+	// Zone and CapacityType are the zone and capacity type the VM is launched in, picked for SelectionReason
+	Zone            string
+	CapacityType    string
+	SelectionReason string
 
 	providerRef VMProvider
 }
@@ -121,12 +196,18 @@ func (p *VirtualMachinePromise) GetInstanceName() string {
 type VMProvider interface {
 	BeginCreate(context.Context, *v1beta1.AKSNodeClass, *karpv1.NodeClaim, []*corecloudprovider.InstanceType) (*VirtualMachinePromise, error)
 	Get(context.Context, string) (*armcompute.VirtualMachine, error)
+	GetWithInstanceView(context.Context, string) (*armcompute.VirtualMachine, error)
 	List(context.Context) ([]*armcompute.VirtualMachine, error)
 	Delete(context.Context, string) error
 	Update(context.Context, string, armcompute.VirtualMachineUpdate) error
 	GetNic(context.Context, string, string) (*armnetwork.Interface, error)
 	DeleteNic(context.Context, string) error
 	ListNics(context.Context) ([]*armnetwork.Interface, error)
+	ListUntagged(context.Context) ([]*armcompute.VirtualMachine, error)
+	ListUntaggedNics(context.Context) ([]*armnetwork.Interface, error)
+	UpdateNicTags(context.Context, string, map[string]*string) error
+	GetDisk(context.Context, string) (*armcompute.Disk, error)
+	UpdateDiskTags(context.Context, string, map[string]*string) error
 }
 
 // assert that DefaultProvider implements Provider interface
@@ -140,12 +221,31 @@ type DefaultVMProvider struct {
 	loadBalancerProvider         *loadbalancer.Provider
 	networkSecurityGroupProvider *networksecuritygroup.Provider
 	resourceGroup                string
+	clusterName                  string
 	subscriptionID               string
 	provisionMode                string
 	diskEncryptionSetID          string
 	errorHandling                *offerings.ResponseErrorHandler
-
-	vmListQuery, nicListQuery string
+	vmStateCache                 *VMStateCache
+	createLimiter                *CreateLimiter
+	networkOperations            *NetworkOperationPool
+	// spotPlacementScores are weighted against the prices of spot offerings with the Weighted spot placement score
+	// strategy. It may be nil, in which case offerings are ordered by price only.
+	spotPlacementScores *spotplacementscore.Provider
+	// kubeClient lists the nodeclasses, to find the subscriptions node resources are created in. It may be nil,
+	// in which case only the cluster's subscription is listed.
+	kubeClient client.Client
+	// resourceLocations maps the (lowercase) names of VMs and NICs to the resourceLocation they are in
+	resourceLocations sync.Map
+	// inflightCreates maps the UIDs of the nodeclaims whose VMs are being created to their *inflightCreate
+	inflightCreates sync.Map
+	// spotFailures are the recent failed spot launches by nodepool, which nodepools annotated with a capacity fallback
+	// strategy fall back to on-demand after
+	spotFailures *offerings.SpotFailures
+
+	// the list queries of the node resources in a resource group
+	vmListQuery, nicListQuery       func(resourceGroup string) string
+	allVMListQuery, allNICListQuery func(resourceGroup string) string
 }
 
 func NewDefaultVMProvider(
@@ -157,9 +257,15 @@ func NewDefaultVMProvider(
 	offeringsCache *cache.UnavailableOfferings,
 	location string,
 	resourceGroup string,
+	clusterName string,
 	subscriptionID string,
 	provisionMode string,
 	diskEncryptionSetID string,
+	vmStateCache *VMStateCache,
+	createLimiter *CreateLimiter,
+	networkOperations *NetworkOperationPool,
+	spotPlacementScores *spotplacementscore.Provider,
+	kubeClient client.Client,
 ) *DefaultVMProvider {
 	return &DefaultVMProvider{
 		azClient:                     azClient,
@@ -169,17 +275,34 @@ func NewDefaultVMProvider(
 		networkSecurityGroupProvider: networkSecurityGroupProvider,
 		location:                     location,
 		resourceGroup:                resourceGroup,
+		clusterName:                  clusterName,
 		subscriptionID:               subscriptionID,
 		provisionMode:                provisionMode,
 		diskEncryptionSetID:          diskEncryptionSetID,
+		vmStateCache:                 vmStateCache,
+		createLimiter:                createLimiter,
+		networkOperations:            networkOperations,
+		spotPlacementScores:          spotPlacementScores,
+		kubeClient:                   kubeClient,
 
-		vmListQuery:  GetVMListQueryBuilder(resourceGroup).String(),
-		nicListQuery: GetNICListQueryBuilder(resourceGroup).String(),
+		vmListQuery:     func(rg string) string { return GetVMListQueryBuilder(rg, clusterName).String() },
+		nicListQuery:    func(rg string) string { return GetNICListQueryBuilder(rg, clusterName).String() },
+		allVMListQuery:  func(rg string) string { return GetAllVMListQueryBuilder(rg).String() },
+		allNICListQuery: func(rg string) string { return GetAllNICListQueryBuilder(rg).String() },
 
 		errorHandling: offerings.NewResponseErrorHandler(offeringsCache),
+		spotFailures:  offerings.NewSpotFailures(),
 	}
 }
 
+// inflightCreate is a create of the VM of a nodeclaim, from its beginning until its promise completes
+type inflightCreate struct {
+	// begun is closed once the create is begun, or failed to
+	begun   chan struct{}
+	promise *VirtualMachinePromise
+	err     error
+}
+
 // BeginCreate creates an instance given the constraints.
 // instanceTypes should be sorted by priority for spot capacity type.
 // Note that the returned instance may not be finished provisioning yet.
@@ -188,15 +311,62 @@ func NewDefaultVMProvider(
 // Errors that occur on the "async side" of the VM create (after the request is accepted, or after polling the
 // VM create and while ) will be returned
 // from the VirtualMachinePromise.Wait() function.
+// Creates exceeding the limits of VM creates in flight wait for others to complete, and fail if they time out waiting.
+// A create of the nodeclaim still in flight, e.g. one whose LRO is slow when the nodeclaim is launched again, is adopted
+// rather than racing it with a second create of the VM.
 func (p *DefaultVMProvider) BeginCreate(
 	ctx context.Context,
 	nodeClass *v1beta1.AKSNodeClass,
 	nodeClaim *karpv1.NodeClaim,
 	instanceTypes []*corecloudprovider.InstanceType,
 ) (*VirtualMachinePromise, error) {
-	instanceTypes = offerings.OrderInstanceTypesByPrice(instanceTypes, scheduling.NewNodeSelectorRequirementsWithMinValues(nodeClaim.Spec.Requirements...))
+	// nodeclaims not created in the API server yet have no UID to track their creates by
+	if nodeClaim.UID == "" {
+		return p.beginCreate(ctx, nodeClass, nodeClaim, instanceTypes, func() {})
+	}
+	create := &inflightCreate{begun: make(chan struct{})}
+	if inflight, loaded := p.inflightCreates.LoadOrStore(nodeClaim.UID, create); loaded {
+		return p.adoptCreate(ctx, nodeClaim, inflight.(*inflightCreate))
+	}
+	create.promise, create.err = p.beginCreate(ctx, nodeClass, nodeClaim, instanceTypes, func() {
+		p.inflightCreates.CompareAndDelete(nodeClaim.UID, create)
+	})
+	close(create.begun)
+	return create.promise, create.err
+}
+
+// adoptCreate waits for the in flight create of the VM of the nodeclaim to begin, and returns its promise
+func (p *DefaultVMProvider) adoptCreate(ctx context.Context, nodeClaim *karpv1.NodeClaim, create *inflightCreate) (*VirtualMachinePromise, error) {
+	select {
+	case <-create.begun:
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+	if create.err != nil {
+		return nil, fmt.Errorf("in flight create of the VM of nodeclaim %s failed: %w", nodeClaim.Name, create.err)
+	}
+	log.FromContext(ctx).Info("adopting in flight create of instance", "NodeClaim", nodeClaim.Name, "vmName", create.promise.GetInstanceName())
+	return create.promise, nil
+}
+
+// beginCreate begins the create of the VM of the nodeclaim, calling done once it's no longer in flight
+func (p *DefaultVMProvider) beginCreate(
+	ctx context.Context,
+	nodeClass *v1beta1.AKSNodeClass,
+	nodeClaim *karpv1.NodeClaim,
+	instanceTypes []*corecloudprovider.InstanceType,
+	done func(),
+) (*VirtualMachinePromise, error) {
+	release, err := p.createLimiter.Acquire(ctx, nodeClaim.Labels[karpv1.NodePoolLabelKey])
+	if err != nil {
+		done()
+		return nil, err
+	}
+	instanceTypes = p.orderInstanceTypes(ctx, nodeClaim, instanceTypes)
 	vmPromise, err := p.beginLaunchInstance(ctx, nodeClass, nodeClaim, instanceTypes)
 	if err != nil {
+		release()
+		done()
 		// There may be orphan NICs (created before promise started)
 		// This err block is hit only for sync failures. Async (VM provisioning) failures will be returned by the vmPromise.Wait() function
 		if cleanupErr := p.cleanupAzureResources(ctx, GenerateResourceName(nodeClaim.Name), true); cleanupErr != nil {
@@ -204,6 +374,14 @@ func (p *DefaultVMProvider) BeginCreate(
 		}
 		return nil, err
 	}
+	// the create is in flight until the promise completes, which may be waited for more than once, also by the creates
+	// adopting it
+	wait := vmPromise.WaitFunc
+	vmPromise.WaitFunc = sync.OnceValue(func() error {
+		defer done()
+		defer release()
+		return wait()
+	})
 	vm := vmPromise.VM
 	zone, err := utils.GetZone(vm)
 	if err != nil {
@@ -224,14 +402,16 @@ func (p *DefaultVMProvider) BeginCreate(
 // Note that this means that this method can fail if the extensions have not been created yet. It is expected that the caller handles this and retries the update
 // to propagate the tags to the extensions once they're created.
 func (p *DefaultVMProvider) Update(ctx context.Context, vmName string, update armcompute.VirtualMachineUpdate) error {
+	azClient := p.clientFor(vmName)
+	resourceGroup := p.resourceGroupFor(vmName)
 	if update.Tags != nil {
 		// If there are tags for other resources, do those first. This is a hedge to avoid updating the VM first which may cause us to think subsequent updates aren't needed
 		// because the VM already has the updates
 
 		// Update NIC tags
-		_, err := p.azClient.networkInterfacesClient.UpdateTags(
+		_, err := azClient.networkInterfacesClient.UpdateTags(
 			ctx,
-			p.resourceGroup,
+			resourceGroup,
 			vmName, // NIC is named the same as the VM
 			armnetwork.TagsObject{
 				Tags: update.Tags,
@@ -246,9 +426,9 @@ func (p *DefaultVMProvider) Update(ctx context.Context, vmName string, update ar
 		pollers := make(map[string]*runtime.Poller[armcompute.VirtualMachineExtensionsClientUpdateResponse], len(extensionNames))
 		// Update tags on VM extensions
 		for _, extName := range extensionNames {
-			poller, err := p.azClient.virtualMachinesExtensionClient.BeginUpdate(
+			poller, err := azClient.virtualMachinesExtensionClient.BeginUpdate(
 				ctx,
-				p.resourceGroup,
+				resourceGroup,
 				vmName,
 				extName,
 				armcompute.VirtualMachineExtensionUpdate{
@@ -279,7 +459,8 @@ func (p *DefaultVMProvider) Update(ctx context.Context, vmName string, update ar
 		}
 	}
 
-	err := UpdateVirtualMachine(ctx, p.azClient.virtualMachinesClient, p.resourceGroup, vmName, update)
+	err := UpdateVirtualMachine(ctx, azClient.virtualMachinesClient, resourceGroup, vmName, update)
+	p.vmStateCache.Invalidate(vmName)
 	if err != nil {
 		return err
 	}
@@ -287,26 +468,123 @@ func (p *DefaultVMProvider) Update(ctx context.Context, vmName string, update ar
 	return nil
 }
 
+// Get returns the VM from the VM state cache, refreshing it if it is stale. VMs that aren't in the cache,
+// e.g. because they were just written, are read from ARM.
 func (p *DefaultVMProvider) Get(ctx context.Context, vmName string) (*armcompute.VirtualMachine, error) {
-	var vm armcompute.VirtualMachinesClientGetResponse
-	var err error
+	if cached, ok := p.vmStateCache.Get(vmName); ok {
+		return cached, nil
+	}
+	if err := p.vmStateCache.Refresh(ctx, p.listVMs); err != nil {
+		log.FromContext(ctx).V(1).Info("failed to refresh VM state cache, falling back to GET", "error", err)
+	} else if cached, ok := p.vmStateCache.Get(vmName); ok {
+		return cached, nil
+	}
 
-	if vm, err = p.azClient.virtualMachinesClient.Get(ctx, p.resourceGroup, vmName, nil); err != nil {
+	vm, err := p.getVM(ctx, vmName)
+	if err != nil {
 		if sdkerrors.IsNotFoundErr(err) {
 			return nil, corecloudprovider.NewNodeClaimNotFoundError(err)
 		}
 		return nil, fmt.Errorf("failed to get VM instance, %w", err)
 	}
 
-	return &vm.VirtualMachine, nil
+	p.vmStateCache.Store(vm)
+	return vm, nil
 }
 
+// GetWithInstanceView reads the VM from ARM along with its instance view, bypassing the VM state cache: the instance
+// view, e.g. the status of the VM agent, isn't part of the VMs listed to fill it
+func (p *DefaultVMProvider) GetWithInstanceView(ctx context.Context, vmName string) (*armcompute.VirtualMachine, error) {
+	resp, err := p.clientFor(vmName).virtualMachinesClient.Get(ctx, p.resourceGroupFor(vmName), vmName, &armcompute.VirtualMachinesClientGetOptions{
+		Expand: lo.ToPtr(armcompute.InstanceViewTypesInstanceView),
+	})
+	if err != nil {
+		if sdkerrors.IsNotFoundErr(err) {
+			return nil, corecloudprovider.NewNodeClaimNotFoundError(err)
+		}
+		return nil, fmt.Errorf("failed to get VM instance view, %w", err)
+	}
+	return &resp.VirtualMachine, nil
+}
+
+// getVM reads the VM from ARM. If the location of the VM isn't known, e.g. after a restart with the VM state
+// cache disabled, each location is tried in turn.
+func (p *DefaultVMProvider) getVM(ctx context.Context, vmName string) (*armcompute.VirtualMachine, error) {
+	var locations []resourceLocation
+	if location, ok := p.resourceLocations.Load(strings.ToLower(vmName)); ok {
+		if _, err := p.subscriptionClient(location.(resourceLocation).subscriptionID); err == nil {
+			locations = []resourceLocation{location.(resourceLocation)}
+		}
+	}
+	if len(locations) == 0 {
+		locations = p.locations(ctx)
+	}
+	var err error
+	for _, location := range locations {
+		azClient, clientErr := p.subscriptionClient(location.subscriptionID)
+		if clientErr != nil {
+			err = clientErr
+			continue
+		}
+		var resp armcompute.VirtualMachinesClientGetResponse
+		if resp, err = azClient.virtualMachinesClient.Get(ctx, location.resourceGroup, vmName, nil); err == nil {
+			p.recordLocation(vmName, resp.ID)
+			return &resp.VirtualMachine, nil
+		}
+		if !sdkerrors.IsNotFoundErr(err) {
+			return nil, err
+		}
+	}
+	return nil, err
+}
+
+// List returns the VMs of the cluster in the resource group that have the nodepool tag, from the VM state cache if it is fresh
 func (p *DefaultVMProvider) List(ctx context.Context) ([]*armcompute.VirtualMachine, error) {
-	req := NewQueryRequest(&(p.subscriptionID), p.vmListQuery)
-	client := p.azClient.azureResourceGraphClient
-	data, err := GetResourceData(ctx, client, *req)
+	if !p.vmStateCache.Enabled() {
+		return p.listVMs(ctx)
+	}
+	if err := p.vmStateCache.Refresh(ctx, p.listVMs); err != nil {
+		return nil, err
+	}
+	vms, written, ok := p.vmStateCache.List()
+	if !ok {
+		// The cache went stale between the refresh and the read
+		return p.listVMs(ctx)
+	}
+	// The VMs written since they were listed are read from ARM, as the list may not reflect the writes yet
+	for _, vmName := range written {
+		vm, err := p.Get(ctx, vmName)
+		if err != nil {
+			if corecloudprovider.IsNodeClaimNotFoundError(err) {
+				continue
+			}
+			return nil, err
+		}
+		vms = append(vms, vm)
+	}
+	return vms, nil
+}
+
+func (p *DefaultVMProvider) listVMs(ctx context.Context) ([]*armcompute.VirtualMachine, error) {
+	return p.queryVMs(ctx, p.vmListQuery)
+}
+
+// ListUntagged returns the VMs in the resource group that have the nodepool tag, but are missing the cluster tag, or
+// are of the cluster and missing the nodeclass tag. These were created before the tags were applied.
+func (p *DefaultVMProvider) ListUntagged(ctx context.Context) ([]*armcompute.VirtualMachine, error) {
+	vms, err := p.queryVMs(ctx, p.allVMListQuery)
 	if err != nil {
-		return nil, fmt.Errorf("querying azure resource graph, %w", err)
+		return nil, err
+	}
+	return lo.Filter(vms, func(vm *armcompute.VirtualMachine, _ int) bool {
+		return p.isUntagged(vm.Tags)
+	}), nil
+}
+
+func (p *DefaultVMProvider) queryVMs(ctx context.Context, query func(resourceGroup string) string) ([]*armcompute.VirtualMachine, error) {
+	data, err := p.queryResources(ctx, query)
+	if err != nil {
+		return nil, err
 	}
 	var vmList []*armcompute.VirtualMachine
 	for i := range data {
@@ -314,11 +592,26 @@ func (p *DefaultVMProvider) List(ctx context.Context) ([]*armcompute.VirtualMach
 		if err != nil {
 			return nil, fmt.Errorf("creating VM object from query response data, %w", err)
 		}
+		p.recordLocation(lo.FromPtr(vm.Name), vm.ID)
 		vmList = append(vmList, vm)
 	}
 	return vmList, nil
 }
 
+// queryResources returns the resources of the query in every resource group node resources are created in
+func (p *DefaultVMProvider) queryResources(ctx context.Context, query func(resourceGroup string) string) ([]Resource, error) {
+	client := p.azClient.azureResourceGraphClient
+	var data []Resource
+	for _, req := range p.newQueryRequests(ctx, query) {
+		resources, err := GetResourceData(ctx, client, *req)
+		if err != nil {
+			return nil, fmt.Errorf("querying azure resource graph, %w", err)
+		}
+		data = append(data, resources...)
+	}
+	return data, nil
+}
+
 func (p *DefaultVMProvider) Delete(ctx context.Context, resourceName string) error {
 	// Note that 'Get' also satisfies cloudprovider.Delete contract expectation (from v1.3.0)
 	// of returning cloudprovider.NewNodeClaimNotFoundError if the instance is already deleted
@@ -337,20 +630,48 @@ func (p *DefaultVMProvider) Delete(ctx context.Context, resourceName string) err
 }
 
 func (p *DefaultVMProvider) GetNic(ctx context.Context, rg, nicName string) (*armnetwork.Interface, error) {
-	nicResponse, err := p.azClient.networkInterfacesClient.Get(ctx, rg, nicName, nil)
+	nicResponse, err := p.clientFor(nicName).networkInterfacesClient.Get(ctx, rg, nicName, nil)
 	if err != nil {
 		return nil, err
 	}
 	return &nicResponse.Interface, nil
 }
 
-// ListNics returns all network interfaces in the resource group that have the nodepool tag
+// ListNics returns all network interfaces of the cluster in the resource group that have the nodepool tag
 func (p *DefaultVMProvider) ListNics(ctx context.Context) ([]*armnetwork.Interface, error) {
-	req := NewQueryRequest(&(p.subscriptionID), p.nicListQuery)
-	client := p.azClient.azureResourceGraphClient
-	data, err := GetResourceData(ctx, client, *req)
+	return p.queryNics(ctx, p.nicListQuery)
+}
+
+// ListUntaggedNics returns the network interfaces in the resource group that have the nodepool tag, but are missing
+// the cluster tag, or are of the cluster and missing the nodeclass tag
+func (p *DefaultVMProvider) ListUntaggedNics(ctx context.Context) ([]*armnetwork.Interface, error) {
+	nics, err := p.queryNics(ctx, p.allNICListQuery)
+	if err != nil {
+		return nil, err
+	}
+	return lo.Filter(nics, func(nic *armnetwork.Interface, _ int) bool {
+		return p.isUntagged(nic.Tags)
+	}), nil
+}
+
+// isUntagged returns whether the tags of a resource with the nodepool tag lack the tags identifying its cluster or
+// nodeclass. Resources tagged with another cluster are left alone.
+func (p *DefaultVMProvider) isUntagged(tags map[string]*string) bool {
+	clusterName, ok := tags[launchtemplate.KarpenterManagedTagKey]
+	if !ok {
+		return true
+	}
+	if lo.FromPtr(clusterName) != p.clusterName {
+		return false
+	}
+	_, ok = tags[launchtemplate.NodeClassTagKey]
+	return !ok
+}
+
+func (p *DefaultVMProvider) queryNics(ctx context.Context, query func(resourceGroup string) string) ([]*armnetwork.Interface, error) {
+	data, err := p.queryResources(ctx, query)
 	if err != nil {
-		return nil, fmt.Errorf("querying azure resource graph, %w", err)
+		return nil, err
 	}
 	var nicList []*armnetwork.Interface
 	for i := range data {
@@ -358,21 +679,61 @@ func (p *DefaultVMProvider) ListNics(ctx context.Context) ([]*armnetwork.Interfa
 		if err != nil {
 			return nil, fmt.Errorf("creating NIC object from query response data, %w", err)
 		}
+		p.recordLocation(lo.FromPtr(nic.Name), nic.ID)
 		nicList = append(nicList, nic)
 	}
 	return nicList, nil
 }
 
 func (p *DefaultVMProvider) DeleteNic(ctx context.Context, nicName string) error {
-	return deleteNicIfExists(ctx, p.azClient.networkInterfacesClient, p.resourceGroup, nicName)
+	return p.deleteNic(ctx, p.clientFor(nicName), nicName)
+}
+
+// deleteNic deletes the NIC, if it exists, on a worker of the network operation pool
+func (p *DefaultVMProvider) deleteNic(ctx context.Context, azClient *AZClient, nicName string) error {
+	return p.networkOperations.Do(ctx, NICOperationDelete, func() error {
+		return deleteNicIfExists(ctx, azClient.networkInterfacesClient, p.resourceGroupFor(nicName), nicName, p.networkOperations.PollOptions())
+	})
+}
+
+// UpdateNicTags replaces the tags of the network interface
+func (p *DefaultVMProvider) UpdateNicTags(ctx context.Context, nicName string, tags map[string]*string) error {
+	_, err := p.clientFor(nicName).networkInterfacesClient.UpdateTags(ctx, p.resourceGroupFor(nicName), nicName, armnetwork.TagsObject{Tags: tags}, nil)
+	if err != nil {
+		return fmt.Errorf("updating NIC tags for %q: %w", nicName, err)
+	}
+	return nil
+}
+
+// GetDisk returns the managed disk, e.g. the OS disk of a VM, which is named like the VM
+func (p *DefaultVMProvider) GetDisk(ctx context.Context, diskName string) (*armcompute.Disk, error) {
+	resp, err := p.clientFor(diskName).disksClient.Get(ctx, p.resourceGroupFor(diskName), diskName, nil)
+	if err != nil {
+		return nil, err
+	}
+	return &resp.Disk, nil
+}
+
+// UpdateDiskTags replaces the tags of the managed disk
+func (p *DefaultVMProvider) UpdateDiskTags(ctx context.Context, diskName string, tags map[string]*string) error {
+	poller, err := p.clientFor(diskName).disksClient.BeginUpdate(ctx, p.resourceGroupFor(diskName), diskName, armcompute.DiskUpdate{Tags: tags}, nil)
+	if err != nil {
+		return fmt.Errorf("updating disk tags for %q: %w", diskName, err)
+	}
+	if _, err := poller.PollUntilDone(ctx, nil); err != nil {
+		return fmt.Errorf("polling disk tags update for %q: %w", diskName, err)
+	}
+	return nil
 }
 
 // createAKSIdentifyingExtension attaches a VM extension to identify that this VM participates in an AKS cluster
-func (p *DefaultVMProvider) createAKSIdentifyingExtension(ctx context.Context, vmName string, tags map[string]*string) (err error) {
-	vmExt := p.getAKSIdentifyingExtension(tags)
+func (p *DefaultVMProvider) createAKSIdentifyingExtension(ctx context.Context, vmName string, isWindows bool, tags map[string]*string) (err error) {
+	ctx, span := tracing.Start(ctx, tracing.SpanCreateAKSIdentifyingExtension, tracing.ResourceNameKey.String(vmName))
+	defer func() { tracing.End(span, err) }()
+	vmExt := p.getAKSIdentifyingExtension(isWindows, tags)
 	vmExtName := *vmExt.Name
 	log.FromContext(ctx).V(1).Info("creating virtual machine AKS identifying extension", "vmName", vmName)
-	v, err := createVirtualMachineExtension(ctx, p.azClient.virtualMachinesExtensionClient, p.resourceGroup, vmName, vmExtName, *vmExt)
+	v, err := createVirtualMachineExtension(ctx, p.clientFor(vmName).virtualMachinesExtensionClient, p.resourceGroupFor(vmName), vmName, vmExtName, *vmExt)
 	if err != nil {
 		return fmt.Errorf("creating VM AKS identifying extension %q for VM %q: %w", vmExtName, vmName, err)
 	}
@@ -383,13 +744,17 @@ func (p *DefaultVMProvider) createAKSIdentifyingExtension(ctx context.Context, v
 	return nil
 }
 
-func (p *DefaultVMProvider) createCSExtension(ctx context.Context, vmName string, cse string, isWindows bool, tags map[string]*string) error {
+func (p *DefaultVMProvider) createCSExtension(ctx context.Context, vmName string, cse string, bootstrapToken redact.Secret, isWindows bool, tags map[string]*string) (err error) {
+	ctx, span := tracing.Start(ctx, tracing.SpanCreateCSE, tracing.ResourceNameKey.String(vmName))
+	defer func() { tracing.End(span, err) }()
 	vmExt := p.getCSExtension(cse, isWindows, tags)
 	vmExtName := *vmExt.Name
 	log.FromContext(ctx).V(1).Info("creating virtual machine CSE", "vmName", vmName)
-	v, err := createVirtualMachineExtension(ctx, p.azClient.virtualMachinesExtensionClient, p.resourceGroup, vmName, vmExtName, *vmExt)
+	v, err := createVirtualMachineExtension(ctx, p.clientFor(vmName).virtualMachinesExtensionClient, p.resourceGroupFor(vmName), vmName, vmExtName, *vmExt)
 	if err != nil {
-		return fmt.Errorf("creating VM CSE for VM %q: %w", vmName, err)
+		// the error may echo the extension settings, which hold the bootstrap token, in any of their encodings
+		secrets := append(redact.Encodings(cse), redact.Encodings(string(bootstrapToken))...)
+		return fmt.Errorf("creating VM CSE for VM %q: %w", vmName, redact.Error(err, secrets...))
 	}
 	log.FromContext(ctx).V(1).Info("created virtual machine CSE",
 		"vmName", vmName,
@@ -423,6 +788,7 @@ func (p *DefaultVMProvider) newNetworkInterfaceForVM(opts *createNICOptions) arm
 
 	nic := armnetwork.Interface{
 		Location: lo.ToPtr(p.location),
+		Tags:     opts.Tags,
 		Properties: &armnetwork.InterfacePropertiesFormat{
 			IPConfigurations: []*armnetwork.InterfaceIPConfiguration{
 				{
@@ -430,6 +796,7 @@ func (p *DefaultVMProvider) newNetworkInterfaceForVM(opts *createNICOptions) arm
 					Properties: &armnetwork.InterfaceIPConfigurationPropertiesFormat{
 						Primary:                   lo.ToPtr(true),
 						PrivateIPAllocationMethod: lo.ToPtr(armnetwork.IPAllocationMethodDynamic),
+						Subnet:                    &armnetwork.Subnet{ID: &opts.SubnetID},
 
 						LoadBalancerBackendAddressPools: ipv4BackendPools,
 					},
@@ -451,6 +818,7 @@ func (p *DefaultVMProvider) newNetworkInterfaceForVM(opts *createNICOptions) arm
 					Properties: &armnetwork.InterfaceIPConfigurationPropertiesFormat{
 						Primary:                   lo.ToPtr(false),
 						PrivateIPAllocationMethod: lo.ToPtr(armnetwork.IPAllocationMethodDynamic),
+						Subnet:                    &armnetwork.Subnet{ID: &opts.SubnetID},
 					},
 				},
 			)
@@ -461,25 +829,32 @@ func (p *DefaultVMProvider) newNetworkInterfaceForVM(opts *createNICOptions) arm
 
 // E.g., aks-default-2jf98
 func GenerateResourceName(nodeClaimName string) string {
-	return fmt.Sprintf("aks-%s", nodeClaimName)
+	return utils.ResourceName(nodeClaimName)
 }
 
 type createNICOptions struct {
 	NICName                string
 	BackendPools           *loadbalancer.BackendAddressPools
 	InstanceType           *corecloudprovider.InstanceType
-	LaunchTemplate         *launchtemplate.Template
+	SubnetID               string
+	Tags                   map[string]*string
 	NetworkPlugin          string
 	NetworkPluginMode      string
 	MaxPods                int32
 	NetworkSecurityGroupID string
 }
 
-func (p *DefaultVMProvider) createNetworkInterface(ctx context.Context, opts *createNICOptions) (string, error) {
+// createNetworkInterface creates the NIC on a worker of the network operation pool
+func (p *DefaultVMProvider) createNetworkInterface(ctx context.Context, opts *createNICOptions) (_ string, err error) {
+	ctx, span := tracing.Start(ctx, tracing.SpanCreateNetworkInterface, tracing.ResourceNameKey.String(opts.NICName))
+	defer func() { tracing.End(span, err) }()
 	nic := p.newNetworkInterfaceForVM(opts)
-	p.applyTemplateToNic(&nic, opts.LaunchTemplate)
 	log.FromContext(ctx).V(1).Info("creating network interface", "nicName", opts.NICName)
-	res, err := createNic(ctx, p.azClient.networkInterfacesClient, p.resourceGroup, opts.NICName, nic)
+	var res *armnetwork.Interface
+	err = p.networkOperations.Do(ctx, NICOperationCreate, func() (err error) {
+		res, err = createNic(ctx, p.clientFor(opts.NICName).networkInterfacesClient, p.resourceGroupFor(opts.NICName), opts.NICName, nic, p.networkOperations.PollOptions())
+		return err
+	})
 	if err != nil {
 		return "", err
 	}
@@ -508,10 +883,6 @@ type createVMOptions struct {
 
 // newVMObject creates a new armcompute.VirtualMachine from the provided options
 func newVMObject(opts *createVMOptions) *armcompute.VirtualMachine {
-	if opts.LaunchTemplate.IsWindows {
-		return &armcompute.VirtualMachine{} // TODO(Windows)
-	}
-
 	vm := &armcompute.VirtualMachine{
 		Name:     lo.ToPtr(opts.VMName), // TODO: I think it's safe to set this, even though it's read only
 		Location: lo.ToPtr(opts.Location),
@@ -528,7 +899,7 @@ func newVMObject(opts *createVMOptions) *armcompute.VirtualMachine {
 					CreateOption: lo.ToPtr(armcompute.DiskCreateOptionTypesFromImage),
 					DeleteOption: lo.ToPtr(armcompute.DiskDeleteOptionTypesDelete),
 				},
-				ImageReference: makeImageIDRef(&opts.NodeClass.Spec.CustomImageTerm, opts.LaunchTemplate.ImageID),
+				ImageReference: makeImageIDRef(opts.LaunchTemplate.ImageID),
 			},
 
 			NetworkProfile: &armcompute.NetworkProfile{
@@ -543,31 +914,19 @@ func newVMObject(opts *createVMOptions) *armcompute.VirtualMachine {
 				},
 			},
 
-			OSProfile: &armcompute.OSProfile{
-				AdminUsername: lo.ToPtr(opts.LinuxAdminUsername),
-				ComputerName:  &opts.VMName,
-				LinuxConfiguration: &armcompute.LinuxConfiguration{
-					DisablePasswordAuthentication: lo.ToPtr(true),
-					SSH: &armcompute.SSHConfiguration{
-						PublicKeys: []*armcompute.SSHPublicKey{
-							{
-								KeyData: lo.ToPtr(opts.SSHPublicKey),
-								Path:    lo.ToPtr("/home/" + opts.LinuxAdminUsername + "/.ssh/authorized_keys"),
-							},
-						},
-					},
-				},
-			},
-			Priority: lo.ToPtr(KarpCapacityTypeToVMPriority[opts.CapacityType]),
+			OSProfile: newOSProfile(opts),
+			Priority:  lo.ToPtr(KarpCapacityTypeToVMPriority[opts.CapacityType]),
 		},
 		Zones: utils.MakeVMZone(opts.Zone),
 		Tags:  opts.LaunchTemplate.Tags,
 	}
+	setVMPlan(vm, opts.LaunchTemplate.ImagePlan)
 	setVMPropertiesOSDiskType(vm.Properties, opts.LaunchTemplate)
 	setVMPropertiesOSDiskEncryption(vm.Properties, opts.DiskEncryptionSetID)
 	//setImageReference(vm.Properties, opts.LaunchTemplate.ImageID, opts.UseSIG)
 	setVMPropertiesBillingProfile(vm.Properties, opts.CapacityType)
 	setVMPropertiesSecurityProfile(vm.Properties, opts.NodeClass)
+	setVMPropertiesPatchSettings(vm.Properties, opts.NodeClass)
 
 	if opts.ProvisionMode == consts.ProvisionModeBootstrappingClient {
 		vm.Properties.OSProfile.CustomData = lo.ToPtr(opts.LaunchTemplate.CustomScriptsCustomData)
@@ -578,6 +937,47 @@ func newVMObject(opts *createVMOptions) *armcompute.VirtualMachine {
 	return vm
 }
 
+// newOSProfile returns the OS profile of the VM: SSH access for Linux, and for Windows, which requires an admin password,
+// a random one nobody knows, since the nodes are accessed through the Kubernetes API rather than logged in to
+func newOSProfile(opts *createVMOptions) *armcompute.OSProfile {
+	computerName := lo.ToPtr(utils.ComputerName(opts.VMName, opts.LaunchTemplate.IsWindows))
+	if opts.LaunchTemplate.IsWindows {
+		return &armcompute.OSProfile{
+			AdminUsername: lo.ToPtr(windowsAdminUsername),
+			AdminPassword: lo.ToPtr(windowsAdminPassword()),
+			ComputerName:  computerName,
+			WindowsConfiguration: &armcompute.WindowsConfiguration{
+				ProvisionVMAgent: lo.ToPtr(true),
+				// the node images are updated by reimaging them, as for Linux
+				EnableAutomaticUpdates: lo.ToPtr(false),
+			},
+		}
+	}
+	return &armcompute.OSProfile{
+		AdminUsername: lo.ToPtr(opts.LinuxAdminUsername),
+		ComputerName:  computerName,
+		LinuxConfiguration: &armcompute.LinuxConfiguration{
+			DisablePasswordAuthentication: lo.ToPtr(true),
+			SSH: &armcompute.SSHConfiguration{
+				PublicKeys: []*armcompute.SSHPublicKey{
+					{
+						KeyData: lo.ToPtr(opts.SSHPublicKey),
+						Path:    lo.ToPtr("/home/" + opts.LinuxAdminUsername + "/.ssh/authorized_keys"),
+					},
+				},
+			},
+		},
+	}
+}
+
+// windowsAdminPassword returns a random password satisfying the complexity requirements of Windows VMs: lower and upper
+// case letters, digits and special characters
+func windowsAdminPassword() string {
+	random := make([]byte, 24)
+	_, _ = rand.Read(random) // never fails
+	return "Kp1!" + base64.RawURLEncoding.EncodeToString(random)
+}
+
 func setVMPropertiesOSDiskType(vmProperties *armcompute.VirtualMachineProperties, launchTemplate *launchtemplate.Template) {
 	placement := launchTemplate.StorageProfilePlacement
 	if launchTemplate.StorageProfileIsEphemeral {
@@ -630,6 +1030,68 @@ func setVMPropertiesSecurityProfile(vmProperties *armcompute.VirtualMachinePrope
 		}
 		vmProperties.SecurityProfile.EncryptionAtHost = nodeClass.Spec.Security.EncryptionAtHost
 	}
+	if nodeClass.IsConfidentialVM() {
+		setVMPropertiesConfidentialVM(vmProperties)
+	}
+	if nodeClass.IsTrustedLaunch() {
+		setVMPropertiesTrustedLaunch(vmProperties, nodeClass.Spec.Security)
+	}
+}
+
+// setVMPropertiesTrustedLaunch makes the VM a trusted launch VM, with secure boot and a vTPM unless the nodeclass
+// disables them
+func setVMPropertiesTrustedLaunch(vmProperties *armcompute.VirtualMachineProperties, security *v1beta1.Security) {
+	if vmProperties.SecurityProfile == nil {
+		vmProperties.SecurityProfile = &armcompute.SecurityProfile{}
+	}
+	vmProperties.SecurityProfile.SecurityType = lo.ToPtr(armcompute.SecurityTypesTrustedLaunch)
+	vmProperties.SecurityProfile.UefiSettings = &armcompute.UefiSettings{
+		SecureBootEnabled: lo.ToPtr(lo.FromPtrOr(security.SecureBootEnabled, true)),
+		VTpmEnabled:       lo.ToPtr(lo.FromPtrOr(security.VTPMEnabled, true)),
+	}
+}
+
+// setVMPropertiesConfidentialVM makes the VM a confidential VM, with secure boot and a vTPM, as confidential VMs require,
+// and its VM guest state encrypted on its managed OS disk
+func setVMPropertiesConfidentialVM(vmProperties *armcompute.VirtualMachineProperties) {
+	if vmProperties.SecurityProfile == nil {
+		vmProperties.SecurityProfile = &armcompute.SecurityProfile{}
+	}
+	vmProperties.SecurityProfile.SecurityType = lo.ToPtr(armcompute.SecurityTypesConfidentialVM)
+	vmProperties.SecurityProfile.UefiSettings = &armcompute.UefiSettings{
+		SecureBootEnabled: lo.ToPtr(true),
+		VTpmEnabled:       lo.ToPtr(true),
+	}
+	if vmProperties.StorageProfile.OSDisk.ManagedDisk == nil {
+		vmProperties.StorageProfile.OSDisk.ManagedDisk = &armcompute.ManagedDiskParameters{}
+	}
+	vmProperties.StorageProfile.OSDisk.ManagedDisk.SecurityProfile = &armcompute.VMDiskSecurityProfile{
+		SecurityEncryptionType: lo.ToPtr(armcompute.SecurityEncryptionTypesVMGuestStateOnly),
+	}
+}
+
+// setVMPropertiesPatchSettings sets the guest patch settings of the nodeclass, leaving those unset to the Azure defaults
+func setVMPropertiesPatchSettings(vmProperties *armcompute.VirtualMachineProperties, nodeClass *v1beta1.AKSNodeClass) {
+	if nodeClass.Spec.PatchSettings == nil || nodeClass.Spec.PatchSettings.Linux == nil || vmProperties.OSProfile.LinuxConfiguration == nil {
+		return
+	}
+	settings := nodeClass.Spec.PatchSettings.Linux
+	patchSettings := &armcompute.LinuxPatchSettings{}
+	if settings.PatchMode != "" {
+		patchSettings.PatchMode = lo.ToPtr(armcompute.LinuxVMGuestPatchMode(settings.PatchMode))
+	}
+	if settings.AssessmentMode != "" {
+		patchSettings.AssessmentMode = lo.ToPtr(armcompute.LinuxPatchAssessmentMode(settings.AssessmentMode))
+	}
+	if automatic := settings.AutomaticByPlatformSettings; automatic != nil {
+		patchSettings.AutomaticByPlatformSettings = &armcompute.LinuxVMGuestPatchAutomaticByPlatformSettings{
+			BypassPlatformSafetyChecksOnUserSchedule: automatic.BypassPlatformSafetyChecksOnUserSchedule,
+		}
+		if automatic.RebootSetting != "" {
+			patchSettings.AutomaticByPlatformSettings.RebootSetting = lo.ToPtr(armcompute.LinuxVMGuestPatchAutomaticByPlatformRebootSetting(automatic.RebootSetting))
+		}
+	}
+	vmProperties.OSProfile.LinuxConfiguration.PatchSettings = patchSettings
 }
 
 type createResult struct {
@@ -638,7 +1100,13 @@ type createResult struct {
 }
 
 // createVirtualMachine creates a new VM using the provided options or skips the creation of a vm if it already exists, which means opts is not guaranteed except VMName
-func (p *DefaultVMProvider) createVirtualMachine(ctx context.Context, opts *createVMOptions) (*createResult, error) {
+func (p *DefaultVMProvider) createVirtualMachine(ctx context.Context, opts *createVMOptions) (_ *createResult, err error) {
+	ctx, span := tracing.Start(ctx, tracing.SpanCreateVirtualMachine,
+		tracing.ResourceNameKey.String(opts.VMName),
+		tracing.InstanceTypeKey.String(opts.InstanceType.Name),
+		tracing.ImageIDKey.String(opts.LaunchTemplate.ImageID),
+	)
+	defer func() { tracing.End(span, err) }()
 	// We assume that if a vm exists, we successfully created it with the right parameters from the nodeclaims during another run before a restart.
 	// there are some non-deterministic properties that may change.
 	// Zones: zones are non-detrminsitic as we do a random pick out of zones on the nodeclaim that satisfy the workload requirements.
@@ -650,7 +1118,9 @@ func (p *DefaultVMProvider) createVirtualMachine(ctx context.Context, opts *crea
 	//        os.CustomData.
 	// If any of these properties are modified, the existing vm will return a 409 status code "PropertyChangeNotAllowed".
 	// this results in create being blocked on the nodeclaim until liveness TTL is hit.
-	resp, err := p.azClient.virtualMachinesClient.Get(ctx, p.resourceGroup, opts.VMName, nil)
+	azClient := p.clientFor(opts.VMName)
+	resourceGroup := p.resourceGroupFor(opts.VMName)
+	resp, err := azClient.virtualMachinesClient.Get(ctx, resourceGroup, opts.VMName, nil)
 	// If status == ok, we want to return the existing vmm
 	if err == nil {
 		return &createResult{VM: &resp.VirtualMachine}, nil
@@ -669,7 +1139,13 @@ func (p *DefaultVMProvider) createVirtualMachine(ctx context.Context, opts *crea
 		metrics.NodePoolLabel:     opts.NodePoolName,
 	}).Inc()
 
-	poller, err := p.azClient.virtualMachinesClient.BeginCreateOrUpdate(ctx, p.resourceGroup, opts.VMName, *vm, nil)
+	// VMs created from the images of galleries of other tenants are authorized with an auxiliary token of the tenant
+	virtualMachinesClient, err := azClient.VirtualMachinesClientForTenant(opts.LaunchTemplate.ImageTenantID)
+	if err != nil {
+		return nil, err
+	}
+	p.vmStateCache.Invalidate(opts.VMName)
+	poller, err := virtualMachinesClient.BeginCreateOrUpdate(ctx, resourceGroup, opts.VMName, *vm, nil)
 	if err != nil {
 		VMCreateFailureMetric.With(map[string]string{
 			metrics.ImageLabel:        opts.LaunchTemplate.ImageID,
@@ -685,6 +1161,133 @@ func (p *DefaultVMProvider) createVirtualMachine(ctx context.Context, opts *crea
 	return &createResult{Poller: poller, VM: vm}, nil
 }
 
+// orderInstanceTypes orders the instance types by the price of their cheapest offerings, weighted against the spot
+// placement scores of the spot offerings when those are used. The instance types considered for spot launches are
+// tracked, to be scored.
+func (p *DefaultVMProvider) orderInstanceTypes(
+	ctx context.Context,
+	nodeClaim *karpv1.NodeClaim,
+	instanceTypes []*corecloudprovider.InstanceType,
+) []*corecloudprovider.InstanceType {
+	requirements := scheduling.NewNodeSelectorRequirementsWithMinValues(nodeClaim.Spec.Requirements...)
+	if p.scores(ctx) == nil || !requirements.Get(karpv1.CapacityTypeLabelKey).Has(karpv1.CapacityTypeSpot) {
+		return offerings.OrderInstanceTypesByPrice(instanceTypes, requirements)
+	}
+	p.spotPlacementScores.Track(lo.Map(instanceTypes, func(instanceType *corecloudprovider.InstanceType, _ int) string {
+		return instanceType.Name
+	})...)
+	return offerings.OrderInstanceTypesByScoredPrice(instanceTypes, requirements, p.spotPlacementScores, options.FromContext(ctx).SpotPlacementScoreWeight)
+}
+
+// scores returns the spot placement scores to order and pick the zones of spot launches with, if they are used
+func (p *DefaultVMProvider) scores(ctx context.Context) offerings.SpotPlacementScores {
+	if p.spotPlacementScores == nil || options.FromContext(ctx).SpotPlacementScoreStrategy != consts.SpotPlacementScoreStrategyWeighted {
+		// a nil *spotplacementscore.Provider would be a non-nil interface
+		return nil
+	}
+	return p.spotPlacementScores
+}
+
+// The reasons the instance type, priority and zone of a launch are picked for
+const (
+	SelectionReasonCheapestOffering   = "cheapest available offering"
+	SelectionReasonSpotPlacementScore = "cheapest available offering, in the zone with the best spot placement score"
+	SelectionReasonZoneSpread         = "spread across zones"
+	SelectionReasonCapacityFallback   = "capacity fallback of the nodepool"
+)
+
+// pickSkuSizePriorityAndZone picks the instance type, priority and zone to launch, and returns the reason they're picked.
+// The nodes of NodePools annotated to spread across zones are launched round-robin across zones, falling back to the
+// cheapest offering without zones. When the capacity fallback strategy of the NodePool restricts the NodeClaim to a
+// capacity type, see offerings.CapacityFallback, only the instance types with available offerings of that capacity type
+// are picked from.
+func (p *DefaultVMProvider) pickSkuSizePriorityAndZone(
+	ctx context.Context,
+	nodeClaim *karpv1.NodeClaim,
+	nodePool *karpv1.NodePool,
+	restrictedCapacityType string,
+	instanceTypes []*corecloudprovider.InstanceType,
+) (*corecloudprovider.InstanceType, string, string, string) {
+	if restrictedCapacityType != "" {
+		nodeClaim = offerings.WithCapacityType(nodeClaim, restrictedCapacityType)
+		requirements := scheduling.NewNodeSelectorRequirementsWithMinValues(nodeClaim.Spec.Requirements...)
+		instanceTypes = lo.Filter(instanceTypes, func(instanceType *corecloudprovider.InstanceType, _ int) bool {
+			return len(instanceType.Offerings.Available().Compatible(requirements)) > 0
+		})
+	}
+	if distribution := p.zoneDistribution(ctx, nodeClaim, nodePool); distribution != nil {
+		if instanceType, capacityType, zone := offerings.PickSkuSizePriorityAndSpreadZone(ctx, nodeClaim, instanceTypes, distribution); instanceType != nil {
+			return instanceType, capacityType, zone, SelectionReasonZoneSpread
+		}
+		log.FromContext(ctx).V(1).Info("no zonal offerings to spread the nodes of the nodepool across, launching the cheapest offering",
+			"NodePool", nodeClaim.Labels[karpv1.NodePoolLabelKey])
+	}
+	scores := p.scores(ctx)
+	instanceType, capacityType, zone := offerings.PickSkuSizePriorityAndZone(ctx, nodeClaim, instanceTypes, scores)
+	switch {
+	case restrictedCapacityType != "":
+		return instanceType, capacityType, zone, SelectionReasonCapacityFallback
+	case capacityType == karpv1.CapacityTypeSpot && scores != nil:
+		return instanceType, capacityType, zone, SelectionReasonSpotPlacementScore
+	default:
+		return instanceType, capacityType, zone, SelectionReasonCheapestOffering
+	}
+}
+
+// nodePool returns the NodePool of the NodeClaim, or nil if it has none or it can't be found, in which case the
+// annotations of the NodePool don't apply to the launch
+func (p *DefaultVMProvider) nodePool(ctx context.Context, nodeClaim *karpv1.NodeClaim) *karpv1.NodePool {
+	nodePoolName := nodeClaim.Labels[karpv1.NodePoolLabelKey]
+	if p.kubeClient == nil || nodePoolName == "" {
+		return nil
+	}
+	nodePool := &karpv1.NodePool{}
+	if err := p.kubeClient.Get(ctx, client.ObjectKey{Name: nodePoolName}, nodePool); err != nil {
+		log.FromContext(ctx).V(1).Info("failed to get nodepool, launching without its annotations", "NodePool", nodePoolName, "error", err)
+		return nil
+	}
+	return nodePool
+}
+
+// capacityFallback returns the capacity fallback strategy the NodePool is annotated with, Always by default
+func capacityFallback(ctx context.Context, nodePool *karpv1.NodePool) offerings.CapacityFallback {
+	value, ok := "", false
+	if nodePool != nil {
+		value, ok = nodePool.Annotations[v1beta1.AnnotationCapacityFallback]
+	}
+	if !ok {
+		return offerings.CapacityFallback{Strategy: offerings.CapacityFallbackAlways}
+	}
+	fallback, err := offerings.ParseCapacityFallback(value)
+	if err != nil {
+		log.FromContext(ctx).Error(err, "invalid capacity fallback annotation, falling back to on-demand once spot is unavailable", "NodePool", nodePool.Name)
+		return offerings.CapacityFallback{Strategy: offerings.CapacityFallbackAlways}
+	}
+	return fallback
+}
+
+// zoneDistribution returns the number of nodes of the NodePool of the NodeClaim by zone, counting its NodeClaims so that
+// launched nodes which haven't registered yet are included, or nil if the NodePool isn't annotated to spread its nodes
+// across zones
+func (p *DefaultVMProvider) zoneDistribution(ctx context.Context, nodeClaim *karpv1.NodeClaim, nodePool *karpv1.NodePool) offerings.ZoneDistribution {
+	if nodePool == nil || nodePool.Annotations[v1beta1.AnnotationZoneSpread] != "true" {
+		return nil
+	}
+	nodePoolName := nodeClaim.Labels[karpv1.NodePoolLabelKey]
+	nodeClaimList := &karpv1.NodeClaimList{}
+	if err := p.kubeClient.List(ctx, nodeClaimList, client.MatchingLabels{karpv1.NodePoolLabelKey: nodePoolName}); err != nil {
+		log.FromContext(ctx).Error(err, "failed to list nodeclaims, not spreading the nodes of the nodepool across zones", "NodePool", nodePoolName)
+		return nil
+	}
+	distribution := offerings.ZoneDistribution{}
+	for i := range nodeClaimList.Items {
+		if zone := nodeClaimList.Items[i].Labels[v1.LabelTopologyZone]; zone != "" && nodeClaimList.Items[i].DeletionTimestamp.IsZero() {
+			distribution[zone]++
+		}
+	}
+	return distribution
+}
+
 // beginLaunchInstance starts the launch of a VM instance.
 // The returned VirtualMachinePromise must be called to gather any errors
 // that are retrieved during async provisioning, as well as to complete the provisioning process.
@@ -695,31 +1298,53 @@ func (p *DefaultVMProvider) beginLaunchInstance(
 	nodeClaim *karpv1.NodeClaim,
 	instanceTypes []*corecloudprovider.InstanceType,
 ) (*VirtualMachinePromise, error) {
-	instanceType, capacityType, zone := offerings.PickSkuSizePriorityAndZone(ctx, nodeClaim, instanceTypes)
+	nodePool := p.nodePool(ctx, nodeClaim)
+	fallback := capacityFallback(ctx, nodePool)
+	nodePoolName := nodeClaim.Labels[karpv1.NodePoolLabelKey]
+	spotFailures := p.spotFailures.Count(nodePoolName)
+	restrictedCapacityType := fallback.CapacityType(nodeClaim, spotFailures)
+	if restrictedCapacityType != "" {
+		log.FromContext(ctx).V(1).Info("restricting capacity type by the capacity fallback strategy of the nodepool",
+			"NodePool", nodePoolName, "capacityFallback", fallback.String(), "spotFailures", spotFailures, "capacityType", restrictedCapacityType)
+	}
+	instanceType, capacityType, zone, selectionReason := p.pickSkuSizePriorityAndZone(ctx, nodeClaim, nodePool, restrictedCapacityType, instanceTypes)
 	if instanceType == nil {
+		if restrictedCapacityType == karpv1.CapacityTypeSpot {
+			// counts toward the failures the nodepool falls back to on-demand after
+			p.recordSpotFailure(nodePoolName, restrictedCapacityType)
+			return nil, corecloudprovider.NewInsufficientCapacityError(fmt.Errorf("no spot instance types available, and the capacity fallback of nodepool %s is %s", nodePoolName, fallback))
+		}
 		return nil, corecloudprovider.NewInsufficientCapacityError(fmt.Errorf("no instance types available"))
 	}
-	launchTemplate, err := p.getLaunchTemplate(ctx, nodeClass, nodeClaim, instanceType, capacityType)
-	if err != nil {
-		return nil, fmt.Errorf("getting launch template: %w", err)
-	}
-
+	fellBack := capacityType == karpv1.CapacityTypeOnDemand &&
+		scheduling.NewNodeSelectorRequirementsWithMinValues(nodeClaim.Spec.Requirements...).Get(karpv1.CapacityTypeLabelKey).Has(karpv1.CapacityTypeSpot)
 	// resourceName for the NIC, VM, and Disk
 	resourceName := GenerateResourceName(nodeClaim.Name)
-
-	backendPools, err := p.loadBalancerProvider.LoadBalancerBackendPools(ctx)
-	if err != nil {
-		return nil, fmt.Errorf("getting backend pools: %w", err)
+	location := p.nodeClassLocation(nodeClass)
+	if _, err := p.subscriptionClient(location.subscriptionID); err != nil {
+		return nil, err
+	}
+	p.resourceLocations.Store(strings.ToLower(resourceName), location)
+	// the load balancers and network security group of the cluster can't be referenced from another subscription
+	foreignSubscription := p.isForeignSubscription(location.subscriptionID)
+
+	backendPools := &loadbalancer.BackendAddressPools{}
+	if !foreignSubscription {
+		var err error
+		if backendPools, err = p.loadBalancerProvider.LoadBalancerBackendPools(ctx); err != nil {
+			return nil, fmt.Errorf("getting backend pools: %w", err)
+		}
 	}
 	networkPlugin := options.FromContext(ctx).NetworkPlugin
 	networkPluginMode := options.FromContext(ctx).NetworkPluginMode
 
-	isAKSManagedVNET, err := utils.IsAKSManagedVNET(options.FromContext(ctx).NodeResourceGroup, launchTemplate.SubnetID)
+	subnetID := launchtemplate.SubnetID(ctx, nodeClass)
+	isAKSManagedVNET, err := utils.IsAKSManagedVNET(options.FromContext(ctx).NodeResourceGroup, subnetID)
 	if err != nil {
 		return nil, fmt.Errorf("checking if vnet is managed: %w", err)
 	}
 	var nsgID string
-	if !isAKSManagedVNET {
+	if !isAKSManagedVNET && !foreignSubscription {
 		nsg, err := p.networkSecurityGroupProvider.ManagedNetworkSecurityGroup(ctx)
 		if err != nil {
 			return nil, fmt.Errorf("getting managed network security group: %w", err)
@@ -731,22 +1356,44 @@ func (p *DefaultVMProvider) beginLaunchInstance(
 	// TODO: doing so would bypass the capacity and other errors that are currently handled by
 	// TODO: core pkg/controllers/nodeclaim/lifecycle/controller.go - in particular, there are metrics/events
 	// TODO: emitted in capacity failure cases that we probably want.
-	nicReference, err := p.createNetworkInterface(
-		ctx,
-		&createNICOptions{
-			NICName:                resourceName,
-			NetworkPlugin:          networkPlugin,
-			NetworkPluginMode:      networkPluginMode,
-			MaxPods:                utils.GetMaxPods(nodeClass, networkPlugin, networkPluginMode),
-			LaunchTemplate:         launchTemplate,
-			BackendPools:           backendPools,
-			InstanceType:           instanceType,
-			NetworkSecurityGroupID: nsgID,
-		},
-	)
+	// The launch template is resolved before the NIC is created, so that launches failing to resolve it, e.g. for lack
+	// of an image, don't create a NIC. The NIC is then created while the customData of the template is rendered.
+	templateParameters, err := p.resolveLaunchTemplate(ctx, nodeClass, nodeClaim, instanceType, capacityType)
 	if err != nil {
-		return nil, err
+		return nil, launchTemplateError(err)
+	}
+	type nicResult struct {
+		reference string
+		err       error
+	}
+	nicCreated := make(chan nicResult, 1)
+	go func() {
+		reference, err := p.createNetworkInterface(
+			ctx,
+			&createNICOptions{
+				NICName:                resourceName,
+				NetworkPlugin:          networkPlugin,
+				NetworkPluginMode:      networkPluginMode,
+				MaxPods:                utils.GetMaxPods(nodeClass, networkPlugin, networkPluginMode),
+				SubnetID:               subnetID,
+				Tags:                   launchtemplate.Tags(options.FromContext(ctx), nodeClass, nodeClaim),
+				BackendPools:           backendPools,
+				InstanceType:           instanceType,
+				NetworkSecurityGroupID: nsgID,
+			},
+		)
+		nicCreated <- nicResult{reference: reference, err: err}
+	}()
+	launchTemplate, err := p.launchTemplateProvider.RenderTemplate(ctx, nodeClass, nodeClaim, templateParameters)
+	// the NIC is waited for even if the rendering failed, so that the cleanup of the failed launch deletes it
+	nic := <-nicCreated
+	if err != nil {
+		return nil, launchTemplateError(fmt.Errorf("rendering launch template, %w", err))
+	}
+	if nic.err != nil {
+		return nil, nic.err
 	}
+	nicReference := nic.reference
 
 	result, err := p.createVirtualMachine(ctx, &createVMOptions{
 		VMName:              resourceName,
@@ -756,7 +1403,7 @@ func (p *DefaultVMProvider) beginLaunchInstance(
 		Location:            p.location,
 		SSHPublicKey:        options.FromContext(ctx).SSHPublicKey,
 		LinuxAdminUsername:  options.FromContext(ctx).LinuxAdminUsername,
-		NodeIdentities:      options.FromContext(ctx).NodeIdentities,
+		NodeIdentities:      utils.GetNodeIdentities(nodeClass, options.FromContext(ctx).NodeIdentities),
 		NodeClass:           nodeClass,
 		LaunchTemplate:      launchTemplate,
 		InstanceType:        instanceType,
@@ -772,11 +1419,18 @@ func (p *DefaultVMProvider) beginLaunchInstance(
 		}
 		handledError := p.errorHandling.Handle(ctx, sku, instanceType, zone, capacityType, err)
 		if handledError != nil {
+			p.recordSpotFailure(nodePoolName, capacityType)
 			// At this point, the error is handled in provider layer (e.g., unavailable offerings cache), but not yet Karpenter core.
 			// Thus the error needs to be returned.
 			// Assuming that `HandleResponseError` already format/convert the error for such (e.g., `InsufficientCapacityError`).
 			return nil, handledError
 		}
+		if IsImageNotFoundErr(err) {
+			return nil, &ImageNotFoundError{ImageID: launchTemplate.ImageID, Err: err}
+		}
+		if launchTemplate.ImagePlan != nil && IsMarketplaceTermsNotAcceptedErr(err) {
+			return nil, &MarketplaceTermsNotAcceptedError{ImagePlan: launchTemplate.ImagePlan, Err: err}
+		}
 		return nil, err
 	}
 
@@ -784,11 +1438,17 @@ func (p *DefaultVMProvider) beginLaunchInstance(
 	// This is a bit of a hack that saves us doing a GET now.
 	// The reason to avoid a GET is that it can fail, and if it does the future above will be lost,
 	// which we don't want.
-	result.VM.ID = lo.ToPtr(fmt.Sprintf("/subscriptions/%s/resourceGroups/%s/providers/Microsoft.Compute/virtualMachines/%s", p.subscriptionID, p.resourceGroup, resourceName))
+	result.VM.ID = lo.ToPtr(fmt.Sprintf("/subscriptions/%s/resourceGroups/%s/providers/Microsoft.Compute/virtualMachines/%s", location.subscriptionID, location.resourceGroup, resourceName))
 	result.VM.Properties.TimeCreated = lo.ToPtr(time.Now())
 
+	var promiseLaunchTemplate *launchtemplate.Template
+	if result.Poller != nil {
+		promiseLaunchTemplate = launchTemplate
+	}
+
 	return &VirtualMachinePromise{
-		providerRef: p,
+		providerRef:    p,
+		LaunchTemplate: promiseLaunchTemplate,
 		WaitFunc: func() error {
 			if result.Poller == nil {
 				// Poller is nil means the VM existed already and we're done.
@@ -798,7 +1458,10 @@ func (p *DefaultVMProvider) beginLaunchInstance(
 				return nil
 			}
 
-			_, err = result.Poller.PollUntilDone(ctx, nil)
+			pollCtx, span := tracing.Start(ctx, tracing.SpanWaitForVirtualMachine, tracing.ResourceNameKey.String(resourceName))
+			_, err = result.Poller.PollUntilDone(pollCtx, nil)
+			tracing.End(span, err)
+			p.vmStateCache.Invalidate(resourceName)
 			if err != nil {
 				VMCreateFailureMetric.With(map[string]string{
 					metrics.ImageLabel:        launchTemplate.ImageID,
@@ -816,6 +1479,7 @@ func (p *DefaultVMProvider) beginLaunchInstance(
 				}
 				handledError := p.errorHandling.Handle(ctx, sku, instanceType, zone, capacityType, err)
 				if handledError != nil {
+					p.recordSpotFailure(nodePoolName, capacityType)
 					// At this point, the error is handled in provider layer (e.g., unavailable offerings cache), but not yet Karpenter core.
 					// Thus the error needs to be returned.
 					// Assuming that `HandleResponseError` already format/convert the error for such (e.g., `InsufficientCapacityError`).
@@ -823,56 +1487,81 @@ func (p *DefaultVMProvider) beginLaunchInstance(
 				}
 				return err
 			}
+			if capacityType == karpv1.CapacityTypeSpot {
+				p.spotFailures.Reset(nodePoolName)
+			}
 
 			if p.provisionMode == consts.ProvisionModeBootstrappingClient {
-				err = p.createCSExtension(ctx, resourceName, launchTemplate.CustomScriptsCSE, launchTemplate.IsWindows, launchTemplate.Tags)
+				err = p.createCSExtension(ctx, resourceName, launchTemplate.CustomScriptsCSE, launchTemplate.BootstrapToken, launchTemplate.IsWindows, launchTemplate.Tags)
 				if err != nil {
 					// An error here is handled by CloudProvider create and calls vmInstanceProvider.Delete (which cleans up the azure resources)
 					return err
 				}
+			} else if launchTemplate.IsWindows {
+				err = p.createCSExtension(ctx, resourceName, launchTemplate.ScriptlessCSE, launchTemplate.BootstrapToken, true, launchTemplate.Tags)
+				if err != nil {
+					return err
+				}
 			}
 
-			err = p.createAKSIdentifyingExtension(ctx, resourceName, launchTemplate.Tags)
+			err = p.createAKSIdentifyingExtension(ctx, resourceName, launchTemplate.IsWindows, launchTemplate.Tags)
 			if err != nil {
 				return err
 			}
 
 			return nil
 		},
-		VM: result.VM,
+		VM:               result.VM,
+		CapacityFallback: lo.Ternary(fellBack, fallback.String(), ""),
+		SpotFailures:     lo.Ternary(fellBack, spotFailures, 0),
+		Zone:             zone,
+		CapacityType:     capacityType,
+		SelectionReason:  selectionReason,
 	}, nil
 }
 
-func (p *DefaultVMProvider) applyTemplateToNic(nic *armnetwork.Interface, template *launchtemplate.Template) {
-	// set tags
-	nic.Tags = template.Tags
-	for _, ipConfig := range nic.Properties.IPConfigurations {
-		ipConfig.Properties.Subnet = &armnetwork.Subnet{ID: &template.SubnetID}
+// recordSpotFailure records the failed launch of the nodepool if it was a spot launch
+func (p *DefaultVMProvider) recordSpotFailure(nodePoolName, capacityType string) {
+	if capacityType == karpv1.CapacityTypeSpot && nodePoolName != "" {
+		p.spotFailures.Record(nodePoolName)
 	}
 }
 
-func (p *DefaultVMProvider) getLaunchTemplate(
+func (p *DefaultVMProvider) resolveLaunchTemplate(
 	ctx context.Context,
 	nodeClass *v1beta1.AKSNodeClass,
 	nodeClaim *karpv1.NodeClaim,
 	instanceType *corecloudprovider.InstanceType,
 	capacityType string,
-) (*launchtemplate.Template, error) {
+) (*parameters.Parameters, error) {
 	additionalLabels := lo.Assign(offerings.GetAllSingleValuedRequirementLabels(instanceType), map[string]string{karpv1.CapacityTypeLabelKey: capacityType})
 
-	launchTemplate, err := p.launchTemplateProvider.GetTemplate(ctx, nodeClass, nodeClaim, instanceType, additionalLabels)
+	templateParameters, err := p.launchTemplateProvider.ResolveParameters(ctx, nodeClass, nodeClaim, instanceType, additionalLabels)
 	if err != nil {
 		return nil, fmt.Errorf("getting launch templates, %w", err)
 	}
 
-	return launchTemplate, nil
+	return templateParameters, nil
+}
+
+// launchTemplateError returns the error of getting the launch template of a launch
+func launchTemplateError(err error) error {
+	// the version of the custom image was deleted since it was resolved, which is recovered from like the VM create
+	// failing with it
+	var imageVersionDeletedErr *imagefamily.ImageVersionDeletedError
+	if errors.As(err, &imageVersionDeletedErr) {
+		return &ImageNotFoundError{ImageID: imageVersionDeletedErr.ImageID, Err: err}
+	}
+	return fmt.Errorf("getting launch template: %w", err)
 }
 
 // mustDeleteNic parameter is used to determine whether NIC deletion failure is considered an error.
 // We may not want to return error of NIC cannot be deleted, as it is "by design" that NIC deletion may not be successful when VM deletion is not completed.
 // NIC garbage collector is expected to handle such cases.
 func (p *DefaultVMProvider) cleanupAzureResources(ctx context.Context, resourceName string, mustDeleteNic bool) error {
-	vmErr := deleteVirtualMachineIfExists(ctx, p.azClient.virtualMachinesClient, p.resourceGroup, resourceName)
+	azClient := p.clientFor(resourceName)
+	vmErr := deleteVirtualMachineIfExists(ctx, azClient.virtualMachinesClient, p.resourceGroupFor(resourceName), resourceName)
+	p.vmStateCache.Invalidate(resourceName)
 	if vmErr != nil {
 		log.FromContext(ctx).Error(vmErr, "virtualMachine.Delete failed", "vmName", resourceName)
 	}
@@ -880,7 +1569,10 @@ func (p *DefaultVMProvider) cleanupAzureResources(ctx context.Context, resourceN
 	// nic, disk and all associated resources will be removed. If the VM was not created successfully and a nic was found,
 	// then we attempt to delete the nic.
 
-	nicErr := deleteNicIfExists(ctx, p.azClient.networkInterfacesClient, p.resourceGroup, resourceName)
+	nicErr := p.deleteNic(ctx, azClient, resourceName)
+	if vmErr == nil && nicErr == nil {
+		p.resourceLocations.Delete(strings.ToLower(resourceName))
+	}
 
 	if mustDeleteNic {
 		// Don't log NIC error here since mustDeleteNic is true (critical cleanup scenario).
@@ -898,22 +1590,23 @@ func (p *DefaultVMProvider) cleanupAzureResources(ctx context.Context, resourceN
 	}
 }
 
-func (p *DefaultVMProvider) getAKSIdentifyingExtension(tags map[string]*string) *armcompute.VirtualMachineExtension {
+func (p *DefaultVMProvider) getAKSIdentifyingExtension(isWindows bool, tags map[string]*string) *armcompute.VirtualMachineExtension {
 	const (
-		vmExtensionType                  = "Microsoft.Compute/virtualMachines/extensions"
-		aksIdentifyingExtensionPublisher = "Microsoft.AKS"
-		aksIdentifyingExtensionTypeLinux = "Compute.AKS.Linux.Billing"
+		vmExtensionType                    = "Microsoft.Compute/virtualMachines/extensions"
+		aksIdentifyingExtensionPublisher   = "Microsoft.AKS"
+		aksIdentifyingExtensionTypeLinux   = "Compute.AKS.Linux.Billing"
+		aksIdentifyingExtensionTypeWindows = "Compute.AKS.Windows.Billing"
 	)
 
 	vmExtension := &armcompute.VirtualMachineExtension{
 		Location: lo.ToPtr(p.location),
-		Name:     lo.ToPtr(aksIdentifyingExtensionName),
+		Name:     lo.ToPtr(lo.Ternary(isWindows, aksIdentifyingExtensionNameWindows, aksIdentifyingExtensionName)),
 		Properties: &armcompute.VirtualMachineExtensionProperties{
 			Publisher:               lo.ToPtr(aksIdentifyingExtensionPublisher),
 			TypeHandlerVersion:      lo.ToPtr("1.0"),
 			AutoUpgradeMinorVersion: lo.ToPtr(true),
 			Settings:                &map[string]interface{}{},
-			Type:                    lo.ToPtr(aksIdentifyingExtensionTypeLinux),
+			Type:                    lo.ToPtr(lo.Ternary(isWindows, aksIdentifyingExtensionTypeWindows, aksIdentifyingExtensionTypeLinux)),
 		},
 		Type: lo.ToPtr(vmExtensionType),
 		Tags: tags,
@@ -995,14 +1688,36 @@ func ephemeralDiskSize(instanceType *corecloudprovider.InstanceType, userDiskSiz
 	}
 }
 
-func makeImageIDRef(imageTerm *v1beta1.CustomImageTerm, imageID string) *armcompute.ImageReference {
-	if reflect.DeepEqual(imageTerm, v1beta1.CustomImageTerm{}) {
+// setVMPlan sets the purchase plan of the marketplace image of the VM, which VMs launching with it must specify
+func setVMPlan(vm *armcompute.VirtualMachine, imagePlan *armcompute.PurchasePlan) {
+	if imagePlan == nil {
+		return
+	}
+	vm.Plan = &armcompute.Plan{
+		Name:      imagePlan.Name,
+		Product:   imagePlan.Product,
+		Publisher: imagePlan.Publisher,
+	}
+}
+
+// makeImageIDRef references the image by its community gallery image ID, for community gallery images, by its shared
+// gallery image ID, for images of directly shared galleries, by its publisher, offer, SKU and version, for marketplace
+// images, or else by its resource ID, for custom and shared image gallery images
+func makeImageIDRef(imageID string) *armcompute.ImageReference {
+	if ref, ok := imagefamily.MarketplaceImageReference(imageID); ok {
+		return ref
+	}
+	if strings.HasPrefix(strings.ToLower(imageID), "/communitygalleries/") {
 		return &armcompute.ImageReference{
 			CommunityGalleryImageID: &imageID,
 		}
-	} else {
+	}
+	if strings.HasPrefix(strings.ToLower(imageID), "/sharedgalleries/") {
 		return &armcompute.ImageReference{
-			ID: &imageID,
+			SharedGalleryImageID: &imageID,
 		}
 	}
+	return &armcompute.ImageReference{
+		ID: &imageID,
+	}
 }
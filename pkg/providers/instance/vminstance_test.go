@@ -0,0 +1,90 @@
+/*
+Portions Copyright (c) Microsoft Corporation.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package instance
+
+import (
+	"testing"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/compute/armcompute/v7"
+	"github.com/samber/lo"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/Azure/karpenter-provider-azure/pkg/apis/v1beta1"
+)
+
+func TestSetVMPropertiesSecurityProfile(t *testing.T) {
+	newVMProperties := func() *armcompute.VirtualMachineProperties {
+		return &armcompute.VirtualMachineProperties{
+			StorageProfile: &armcompute.StorageProfile{OSDisk: &armcompute.OSDisk{}},
+		}
+	}
+
+	t.Run("should not set a security profile by default", func(t *testing.T) {
+		vmProperties := newVMProperties()
+		setVMPropertiesSecurityProfile(vmProperties, &v1beta1.AKSNodeClass{})
+		assert.Nil(t, vmProperties.SecurityProfile)
+		assert.Nil(t, vmProperties.StorageProfile.OSDisk.ManagedDisk)
+	})
+
+	t.Run("should not make standard VMs confidential", func(t *testing.T) {
+		vmProperties := newVMProperties()
+		setVMPropertiesSecurityProfile(vmProperties, &v1beta1.AKSNodeClass{Spec: v1beta1.AKSNodeClassSpec{
+			Security: &v1beta1.Security{EncryptionAtHost: lo.ToPtr(true), SecurityType: lo.ToPtr(v1beta1.SecurityTypeStandard)},
+		}})
+		assert.True(t, lo.FromPtr(vmProperties.SecurityProfile.EncryptionAtHost))
+		assert.Nil(t, vmProperties.SecurityProfile.SecurityType)
+		assert.Nil(t, vmProperties.StorageProfile.OSDisk.ManagedDisk)
+	})
+
+	t.Run("should make confidential VMs with their VM guest state encrypted", func(t *testing.T) {
+		vmProperties := newVMProperties()
+		vmProperties.StorageProfile.OSDisk.ManagedDisk = &armcompute.ManagedDiskParameters{
+			DiskEncryptionSet: &armcompute.DiskEncryptionSetParameters{ID: lo.ToPtr("des")},
+		}
+		setVMPropertiesSecurityProfile(vmProperties, &v1beta1.AKSNodeClass{Spec: v1beta1.AKSNodeClassSpec{
+			Security: &v1beta1.Security{SecurityType: lo.ToPtr(v1beta1.SecurityTypeConfidentialVM)},
+		}})
+		assert.Equal(t, armcompute.SecurityTypesConfidentialVM, lo.FromPtr(vmProperties.SecurityProfile.SecurityType))
+		assert.True(t, lo.FromPtr(vmProperties.SecurityProfile.UefiSettings.SecureBootEnabled))
+		assert.True(t, lo.FromPtr(vmProperties.SecurityProfile.UefiSettings.VTpmEnabled))
+		assert.Equal(t, armcompute.SecurityEncryptionTypesVMGuestStateOnly,
+			lo.FromPtr(vmProperties.StorageProfile.OSDisk.ManagedDisk.SecurityProfile.SecurityEncryptionType))
+		// the disk encryption set of the OS disk is kept
+		assert.Equal(t, "des", lo.FromPtr(vmProperties.StorageProfile.OSDisk.ManagedDisk.DiskEncryptionSet.ID))
+	})
+
+	t.Run("should make trusted launch VMs with secure boot and a vTPM by default", func(t *testing.T) {
+		vmProperties := newVMProperties()
+		setVMPropertiesSecurityProfile(vmProperties, &v1beta1.AKSNodeClass{Spec: v1beta1.AKSNodeClassSpec{
+			Security: &v1beta1.Security{SecurityType: lo.ToPtr(v1beta1.SecurityTypeTrustedLaunch)},
+		}})
+		assert.Equal(t, armcompute.SecurityTypesTrustedLaunch, lo.FromPtr(vmProperties.SecurityProfile.SecurityType))
+		assert.True(t, lo.FromPtr(vmProperties.SecurityProfile.UefiSettings.SecureBootEnabled))
+		assert.True(t, lo.FromPtr(vmProperties.SecurityProfile.UefiSettings.VTpmEnabled))
+		// the VM guest state of trusted launch VMs isn't encrypted on their OS disk
+		assert.Nil(t, vmProperties.StorageProfile.OSDisk.ManagedDisk)
+	})
+
+	t.Run("should make trusted launch VMs without secure boot when disabled", func(t *testing.T) {
+		vmProperties := newVMProperties()
+		setVMPropertiesSecurityProfile(vmProperties, &v1beta1.AKSNodeClass{Spec: v1beta1.AKSNodeClassSpec{
+			Security: &v1beta1.Security{SecurityType: lo.ToPtr(v1beta1.SecurityTypeTrustedLaunch), SecureBootEnabled: lo.ToPtr(false)},
+		}})
+		assert.False(t, lo.FromPtr(vmProperties.SecurityProfile.UefiSettings.SecureBootEnabled))
+		assert.True(t, lo.FromPtr(vmProperties.SecurityProfile.UefiSettings.VTpmEnabled))
+	})
+}
@@ -0,0 +1,195 @@
+/*
+Portions Copyright (c) Microsoft Corporation.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package instance
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/compute/armcompute/v7"
+	"github.com/samber/lo"
+	"k8s.io/utils/clock"
+)
+
+// VMStateCacheTTL bounds how stale the cached state of a VM can be
+const VMStateCacheTTL = 30 * time.Second
+
+// VMStateCache holds the state of the VMs in the node resource group, so that the status and GC paths, which read
+// every VM on every reconcile, are served by one batched list per TTL rather than one GET per VM.
+//
+// Entries are considered fresh for TTL after they were read. Azure Resource Graph lags behind ARM, so a VM written
+// by Karpenter (created, updated or deleted) is invalidated synchronously, and its entry is not refreshed from the
+// list for TTL after the write; reads of it go to ARM until then. The last list is served without the VMs written
+// within TTL, as it may still include the deleted VMs and miss the created ones, which are read from ARM instead.
+// A VMStateCache with a zero TTL is disabled: every read goes to Azure.
+type VMStateCache struct {
+	ttl   time.Duration
+	clock clock.Clock
+
+	// refreshMu serializes refreshes, so that concurrent readers of a stale cache trigger a single list
+	refreshMu sync.Mutex
+
+	mu       sync.RWMutex
+	entries  map[string]vmStateEntry
+	written  map[string]vmWrite
+	listed   []*armcompute.VirtualMachine
+	listedAt time.Time
+}
+
+type vmStateEntry struct {
+	vm     *armcompute.VirtualMachine
+	readAt time.Time
+}
+
+// vmWrite is the last write of a VM by Karpenter
+type vmWrite struct {
+	vmName    string
+	writtenAt time.Time
+}
+
+func NewVMStateCache(ttl time.Duration, clk clock.Clock) *VMStateCache {
+	return &VMStateCache{
+		ttl:     ttl,
+		clock:   clk,
+		entries: map[string]vmStateEntry{},
+		written: map[string]vmWrite{},
+	}
+}
+
+func (c *VMStateCache) Enabled() bool {
+	return c != nil && c.ttl > 0
+}
+
+// Get returns the cached VM, if there is a fresh entry for it
+func (c *VMStateCache) Get(vmName string) (*armcompute.VirtualMachine, bool) {
+	if !c.Enabled() {
+		return nil, false
+	}
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	entry, ok := c.entries[vmStateKey(vmName)]
+	if !ok || c.clock.Since(entry.readAt) >= c.ttl {
+		return nil, false
+	}
+	return entry.vm, true
+}
+
+// List returns the VMs of the last list, if it is fresh, apart from the VMs written within TTL, whose names are returned
+// instead, for them to be read from ARM and merged into the list
+func (c *VMStateCache) List() (vms []*armcompute.VirtualMachine, written []string, ok bool) {
+	if !c.Enabled() {
+		return nil, nil, false
+	}
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	if !c.fresh() {
+		return nil, nil, false
+	}
+	now := c.clock.Now()
+	for _, write := range c.written {
+		if now.Sub(write.writtenAt) < c.ttl {
+			written = append(written, write.vmName)
+		}
+	}
+	vms = lo.Filter(c.listed, func(vm *armcompute.VirtualMachine, _ int) bool {
+		write, ok := c.written[vmStateKey(lo.FromPtr(vm.Name))]
+		return !ok || now.Sub(write.writtenAt) >= c.ttl
+	})
+	return vms, written, true
+}
+
+// Refresh replaces the cached VMs with the result of list, unless a concurrent caller has refreshed the cache already
+func (c *VMStateCache) Refresh(ctx context.Context, list func(context.Context) ([]*armcompute.VirtualMachine, error)) error {
+	if !c.Enabled() {
+		return nil
+	}
+	c.refreshMu.Lock()
+	defer c.refreshMu.Unlock()
+
+	c.mu.RLock()
+	fresh := c.fresh()
+	c.mu.RUnlock()
+	if fresh {
+		return nil
+	}
+
+	// VMs written while listing may be missing from the list, so it is considered taken when it started
+	listedAt := c.clock.Now()
+	vms, err := list(ctx)
+	if err != nil {
+		return err
+	}
+	c.storeList(vms, listedAt)
+	return nil
+}
+
+// Store caches a VM read from ARM
+func (c *VMStateCache) Store(vm *armcompute.VirtualMachine) {
+	if !c.Enabled() || vm == nil || vm.Name == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.entries[vmStateKey(*vm.Name)] = vmStateEntry{vm: vm, readAt: c.clock.Now()}
+}
+
+// Invalidate drops the cached state of a VM that is being written, so that it is next read from ARM
+func (c *VMStateCache) Invalidate(vmName string) {
+	if !c.Enabled() {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	key := vmStateKey(vmName)
+	delete(c.entries, key)
+	c.written[key] = vmWrite{vmName: vmName, writtenAt: c.clock.Now()}
+}
+
+func (c *VMStateCache) storeList(vms []*armcompute.VirtualMachine, now time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for key, write := range c.written {
+		if now.Sub(write.writtenAt) >= c.ttl {
+			delete(c.written, key)
+		}
+	}
+	entries := lo.PickBy(c.entries, func(key string, _ vmStateEntry) bool {
+		_, ok := c.written[key]
+		return ok
+	})
+	for _, vm := range vms {
+		key := vmStateKey(lo.FromPtr(vm.Name))
+		if _, ok := c.written[key]; ok {
+			continue
+		}
+		entries[key] = vmStateEntry{vm: vm, readAt: now}
+	}
+	c.entries = entries
+	c.listed = vms
+	c.listedAt = now
+}
+
+func (c *VMStateCache) fresh() bool {
+	return !c.listedAt.IsZero() && c.clock.Since(c.listedAt) < c.ttl
+}
+
+// VM names are case-insensitive in Azure
+func vmStateKey(vmName string) string {
+	return strings.ToLower(vmName)
+}
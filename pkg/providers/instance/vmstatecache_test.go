@@ -0,0 +1,157 @@
+/*
+Portions Copyright (c) Microsoft Corporation.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package instance_test
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/compute/armcompute/v7"
+	"github.com/samber/lo"
+	clock "k8s.io/utils/clock/testing"
+	corecloudprovider "sigs.k8s.io/karpenter/pkg/cloudprovider"
+
+	"github.com/Azure/karpenter-provider-azure/pkg/consts"
+	"github.com/Azure/karpenter-provider-azure/pkg/fake"
+	"github.com/Azure/karpenter-provider-azure/pkg/providers/instance"
+	"github.com/Azure/karpenter-provider-azure/pkg/providers/launchtemplate"
+)
+
+func TestVMStateCache(t *testing.T) {
+	ctx := context.Background()
+	const nodes = 20
+	cloud, err := fake.NewCloud("MC_fake-cluster", "fake-cluster")
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	cloud.VirtualMachinesAPI.VirtualMachineCreateOrUpdateBehavior.Latency = 0
+	cloud.VirtualMachinesAPI.VirtualMachineDeleteBehavior.Latency = 0
+	cloud.NetworkInterfacesAPI.NetworkInterfacesDeleteBehavior.Latency = 0
+	for i := range nodes {
+		if _, err := instance.CreateVirtualMachine(ctx, cloud.VirtualMachinesAPI, cloud.ResourceGroup, vmName(i), armcompute.VirtualMachine{
+			Tags: map[string]*string{launchtemplate.NodePoolTagKey: lo.ToPtr("default"), launchtemplate.KarpenterManagedTagKey: lo.ToPtr("fake-cluster")},
+		}); err != nil {
+			t.Fatalf("Unexpected error %v", err)
+		}
+	}
+
+	fakeClock := clock.NewFakeClock(time.Now())
+	vmProvider := instance.NewDefaultVMProvider(cloud.AZClient(), nil, nil, nil, nil, nil, fake.Region, cloud.ResourceGroup, "fake-cluster",
+		"00000000-0000-0000-0000-000000000000", consts.ProvisionModeAKSScriptless, "", instance.NewVMStateCache(instance.VMStateCacheTTL, fakeClock), nil, nil, nil, nil)
+	getAll := func() {
+		for i := range nodes {
+			if _, err := vmProvider.Get(ctx, vmName(i)); err != nil {
+				t.Fatalf("Unexpected error %v", err)
+			}
+		}
+		if _, err := vmProvider.List(ctx); err != nil {
+			t.Fatalf("Unexpected error %v", err)
+		}
+	}
+	expectCalls := func(lists, gets int) {
+		t.Helper()
+		if calls := cloud.AzureResourceGraphAPI.AzureResourceGraphResourcesBehavior.Calls(); calls != lists {
+			t.Errorf("Expected %d list calls, got %d", lists, calls)
+		}
+		if calls := cloud.VirtualMachinesAPI.VirtualMachineGetBehavior.Calls(); calls != gets {
+			t.Errorf("Expected %d GET calls, got %d", gets, calls)
+		}
+	}
+
+	// reads of all nodes within a refresh interval are served by a single list
+	getAll()
+	getAll()
+	expectCalls(1, 0)
+
+	// and once the cache is stale, by a single list again
+	fakeClock.Step(instance.VMStateCacheTTL)
+	getAll()
+	expectCalls(2, 0)
+
+	// deletes invalidate the VM synchronously, so it is read from ARM
+	if err := vmProvider.Delete(ctx, vmName(0)); err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	getsAfterDelete := cloud.VirtualMachinesAPI.VirtualMachineGetBehavior.Calls()
+	if _, err := vmProvider.Get(ctx, vmName(0)); !corecloudprovider.IsNodeClaimNotFoundError(err) {
+		t.Errorf("Expected NodeClaimNotFound error for deleted VM, got %v", err)
+	}
+	expectCalls(2, getsAfterDelete+1)
+
+	// and the list is still served from the cache, with the deleted VM read from ARM rather than listed
+	vms, err := vmProvider.List(ctx)
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	if len(vms) != nodes-1 {
+		t.Errorf("Expected %d VMs listed after the delete, got %d", nodes-1, len(vms))
+	}
+	expectCalls(2, getsAfterDelete+2)
+}
+
+func TestVMStateCacheListAfterWrite(t *testing.T) {
+	ctx := context.Background()
+	fakeClock := clock.NewFakeClock(time.Now())
+	cache := instance.NewVMStateCache(instance.VMStateCacheTTL, fakeClock)
+	vms := []*armcompute.VirtualMachine{{Name: lo.ToPtr(vmName(0))}, {Name: lo.ToPtr(vmName(1))}}
+	list := func(context.Context) ([]*armcompute.VirtualMachine, error) { return vms, nil }
+	expectList := func(expectedListed, expectedWritten []string) {
+		t.Helper()
+		if err := cache.Refresh(ctx, list); err != nil {
+			t.Fatalf("Unexpected error %v", err)
+		}
+		listed, written, ok := cache.List()
+		if !ok {
+			t.Fatalf("Expected the list to be served from the cache")
+		}
+		listedNames := lo.Map(listed, func(vm *armcompute.VirtualMachine, _ int) string { return lo.FromPtr(vm.Name) })
+		if !lo.ElementsMatch(listedNames, expectedListed) || !lo.ElementsMatch(written, expectedWritten) {
+			t.Errorf("Expected %v listed and %v written, got %v and %v", expectedListed, expectedWritten, listedNames, written)
+		}
+	}
+
+	expectList([]string{vmName(0), vmName(1)}, nil)
+
+	// a VM deleted within the TTL is left out of the list, to be read from ARM
+	fakeClock.Step(time.Second)
+	cache.Invalidate(vmName(1))
+	expectList([]string{vmName(0)}, []string{vmName(1)})
+
+	// even once listed again, as the list may lag behind the delete
+	fakeClock.Step(instance.VMStateCacheTTL - time.Second)
+	expectList([]string{vmName(0)}, []string{vmName(1)})
+
+	// until the TTL after the write
+	fakeClock.Step(instance.VMStateCacheTTL)
+	vms = vms[:1]
+	expectList([]string{vmName(0)}, nil)
+
+	// and so is a VM created within the TTL
+	fakeClock.Step(time.Second)
+	cache.Invalidate(vmName(2))
+	expectList([]string{vmName(0)}, []string{vmName(2)})
+
+	fakeClock.Step(instance.VMStateCacheTTL)
+	vms = append(vms, &armcompute.VirtualMachine{Name: lo.ToPtr(vmName(2))})
+	expectList([]string{vmName(0), vmName(2)}, nil)
+}
+
+func vmName(i int) string {
+	return fmt.Sprintf("aks-default-%05d", i)
+}
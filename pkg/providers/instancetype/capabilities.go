@@ -0,0 +1,56 @@
+/*
+Portions Copyright (c) Microsoft Corporation.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package instancetype
+
+import (
+	"github.com/Azure/skewer"
+)
+
+// Instance types are computed from the capabilities of SKUs, which new SKUs sometimes lack for a while after their
+// launch. SKUs missing a required capability are excluded, while optional capabilities fall back to defaults:
+//   - CpuArchitectureType: x64
+//   - HyperVGenerations: V1
+//   - GPUs, MaxResourceVolumeMB, CachedDiskBytes and the other disk capabilities: none
+//   - PremiumIO, AcceleratedNetworkingEnabled, EphemeralOSDiskSupported and EncryptionAtHostSupported: False
+//   - the network bandwidth: the one of the VM series, or none when it isn't known
+
+const (
+	// defaultArchitecture is the CPU architecture of SKUs without the CpuArchitectureType capability
+	defaultArchitecture = "x64"
+)
+
+// missingCapabilities returns the capabilities instance types can't be computed without that the SKU lacks, or has
+// no positive value for
+func missingCapabilities(sku *skewer.SKU) []string {
+	var missing []string
+	if vcpus, err := sku.VCPU(); err != nil || vcpus <= 0 {
+		missing = append(missing, skewer.VCPUs)
+	}
+	if memoryGiB, err := sku.Memory(); err != nil || memoryGiB <= 0 {
+		missing = append(missing, skewer.MemoryGB)
+	}
+	return missing
+}
+
+// skuArchitecture returns the CPU architecture of the SKU, defaulting to x64
+func skuArchitecture(sku *skewer.SKU) string {
+	architecture, err := sku.GetCPUArchitectureType()
+	if err != nil || architecture == "" {
+		return defaultArchitecture
+	}
+	return architecture
+}
@@ -0,0 +1,137 @@
+/*
+Portions Copyright (c) Microsoft Corporation.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package instancetype_test
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"testing"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/cloud"
+	//nolint SA1019 - deprecated package
+	"github.com/Azure/azure-sdk-for-go/services/compute/mgmt/2022-08-01/compute"
+	"github.com/Azure/skewer"
+	"github.com/patrickmn/go-cache"
+	"github.com/samber/lo"
+	corev1 "k8s.io/api/core/v1"
+	karpv1 "sigs.k8s.io/karpenter/pkg/apis/v1"
+
+	"github.com/Azure/karpenter-provider-azure/pkg/apis/v1beta1"
+	"github.com/Azure/karpenter-provider-azure/pkg/auth"
+	kcache "github.com/Azure/karpenter-provider-azure/pkg/cache"
+	"github.com/Azure/karpenter-provider-azure/pkg/fake"
+	"github.com/Azure/karpenter-provider-azure/pkg/operator/options"
+	"github.com/Azure/karpenter-provider-azure/pkg/providers/instancetype"
+	"github.com/Azure/karpenter-provider-azure/pkg/providers/pricing"
+)
+
+// skuClient lists the SKUs it holds
+type skuClient []compute.ResourceSku
+
+func (c skuClient) ListComplete(_ context.Context, _, _ string) (compute.ResourceSkusResultIterator, error) {
+	skus := []compute.ResourceSku(c)
+	return compute.NewResourceSkusResultIterator(compute.NewResourceSkusResultPage(
+		compute.ResourceSkusResult{Value: &skus},
+		func(context.Context, compute.ResourceSkusResult) (compute.ResourceSkusResult, error) {
+			return compute.ResourceSkusResult{}, nil
+		},
+	)), nil
+}
+
+// withCapabilities returns a copy of the SKUs keeping the capabilities for which keep returns true
+func withCapabilities(skus []compute.ResourceSku, keep func(sku string, capability string) bool) []compute.ResourceSku {
+	return lo.Map(skus, func(sku compute.ResourceSku, _ int) compute.ResourceSku {
+		sku.Capabilities = lo.ToPtr(lo.Filter(lo.FromPtr(sku.Capabilities), func(capability compute.ResourceSkuCapabilities, _ int) bool {
+			return keep(lo.FromPtr(sku.Name), lo.FromPtr(capability.Name))
+		}))
+		return sku
+	})
+}
+
+func TestIncompleteCapabilities(t *testing.T) {
+	ctx := options.ToContext(context.Background(), &options.Options{VMMemoryOverheadPercent: 0.075, NetworkPlugin: "azure"})
+	nodeClass := &v1beta1.AKSNodeClass{Spec: v1beta1.AKSNodeClassSpec{MaxPods: lo.ToPtr[int32](30), OSDiskSizeGB: lo.ToPtr[int32](128)}}
+	// a non-public cloud keeps the static prices, without updating them
+	pricingProvider := pricing.NewProvider(&auth.Environment{Cloud: cloud.AzureGovernment}, &fake.PricingAPI{}, fake.Region, pricing.DefaultUpdatePeriod)
+	skus := fake.ResourceSkus[fake.Region]
+
+	capabilities := map[string]bool{}
+	for _, sku := range skus {
+		for _, capability := range lo.FromPtr(sku.Capabilities) {
+			capabilities[lo.FromPtr(capability.Name)] = true
+		}
+	}
+	variants := map[string][]compute.ResourceSku{
+		"all capabilities": skus,
+		"no capabilities":  withCapabilities(skus, func(string, string) bool { return false }),
+		"nil capabilities": lo.Map(skus, func(sku compute.ResourceSku, _ int) compute.ResourceSku {
+			sku.Capabilities = nil
+			return sku
+		}),
+	}
+	for capability := range capabilities {
+		variants["without "+capability] = withCapabilities(skus, func(_ string, c string) bool { return c != capability })
+	}
+	random := rand.New(rand.NewSource(1))
+	for i := range 50 {
+		variants[fmt.Sprintf("random %d", i)] = withCapabilities(skus, func(string, string) bool { return random.Intn(2) == 0 })
+	}
+
+	for name, variant := range variants {
+		t.Run(name, func(t *testing.T) {
+			p := instancetype.NewDefaultProvider(fake.Region, cache.New(time.Hour, time.Hour), skuClient(variant), pricingProvider, kcache.NewUnavailableOfferings(), nil)
+			instanceTypes, err := p.List(ctx, nodeClass)
+			if err != nil {
+				t.Fatalf("listing instance types: %s", err)
+			}
+			for _, it := range instanceTypes {
+				for _, resourceName := range []corev1.ResourceName{corev1.ResourceCPU, corev1.ResourceMemory} {
+					if quantity := it.Capacity[resourceName]; quantity.Sign() <= 0 {
+						t.Errorf("expected instance type %s to have %s, got %s", it.Name, resourceName, quantity.String())
+					}
+				}
+			}
+			snapshot, err := p.Snapshot(ctx, &karpv1.NodePool{}, nodeClass)
+			if err != nil {
+				t.Fatalf("getting offerings snapshot: %s", err)
+			}
+			offered := lo.SliceToMap(snapshot.InstanceTypes, func(it instancetype.InstanceTypeSnapshot) (string, bool) { return it.Name, true })
+			excluded := lo.SliceToMap(snapshot.Excluded, func(e instancetype.ExcludedInstanceType) (string, bool) { return e.Name, true })
+			for _, sku := range variant {
+				s := skewer.SKU(sku)
+				vcpus, vcpusErr := s.VCPU()
+				memoryGiB, memoryErr := s.Memory()
+				if vcpusErr == nil && vcpus > 0 && memoryErr == nil && memoryGiB > 0 {
+					continue
+				}
+				if offered[s.GetName()] {
+					t.Errorf("expected %s to be excluded for missing capabilities", s.GetName())
+				}
+				if !excluded[s.GetName()] {
+					t.Errorf("expected the exclusion of %s to be recorded", s.GetName())
+				}
+			}
+		})
+	}
+	// the SKUs with all their capabilities are offered
+	p := instancetype.NewDefaultProvider(fake.Region, cache.New(time.Hour, time.Hour), skuClient(skus), pricingProvider, kcache.NewUnavailableOfferings(), nil)
+	if instanceTypes := lo.Must(p.List(ctx, nodeClass)); len(instanceTypes) == 0 {
+		t.Errorf("expected the SKUs with all their capabilities to be offered")
+	}
+}
@@ -0,0 +1,74 @@
+/*
+Portions Copyright (c) Microsoft Corporation.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package instancetype
+
+import (
+	"regexp"
+	"strings"
+
+	"github.com/Azure/skewer"
+
+	"github.com/Azure/karpenter-provider-azure/pkg/apis/v1beta1"
+)
+
+// seriesSizePattern matches VM sizes, e.g. DC2as_v5, into their family and the rest of their series, dropping the vCPUs
+var seriesSizePattern = regexp.MustCompile(`^([A-Za-z]+)\d+(.*)$`)
+
+// seriesConfidentialComputing is the confidential computing technology of the confidential VM series, as documented at
+// https://learn.microsoft.com/azure/confidential-computing/virtual-machine-options. It's consulted for SKUs not reporting
+// the ConfidentialComputingType capability. Keys are lowercase series, e.g. dcas_v5 for Standard_DC2as_v5.
+var seriesConfidentialComputing = map[string]string{
+	// AMD SEV-SNP
+	"dcas_v5":        v1beta1.ConfidentialComputingSNP,
+	"dcads_v5":       v1beta1.ConfidentialComputingSNP,
+	"dcas_cc_v5":     v1beta1.ConfidentialComputingSNP,
+	"dcads_cc_v5":    v1beta1.ConfidentialComputingSNP,
+	"ecas_v5":        v1beta1.ConfidentialComputingSNP,
+	"ecads_v5":       v1beta1.ConfidentialComputingSNP,
+	"ecas_cc_v5":     v1beta1.ConfidentialComputingSNP,
+	"ecads_cc_v5":    v1beta1.ConfidentialComputingSNP,
+	"dcas_v6":        v1beta1.ConfidentialComputingSNP,
+	"dcads_v6":       v1beta1.ConfidentialComputingSNP,
+	"ecas_v6":        v1beta1.ConfidentialComputingSNP,
+	"ecads_v6":       v1beta1.ConfidentialComputingSNP,
+	"nccads_h100_v5": v1beta1.ConfidentialComputingSNP,
+	// Intel TDX
+	"dces_v5":  v1beta1.ConfidentialComputingTDX,
+	"dceds_v5": v1beta1.ConfidentialComputingTDX,
+	"eces_v5":  v1beta1.ConfidentialComputingTDX,
+	"eceds_v5": v1beta1.ConfidentialComputingTDX,
+}
+
+// ConfidentialComputing returns the confidential computing technology of the SKU: SNP (AMD SEV-SNP) or TDX (Intel TDX)
+// for confidential VM sizes, from its ConfidentialComputingType capability or else its series, and None otherwise,
+// including for the application enclave (SGX) sizes of the DC family
+func ConfidentialComputing(sku *skewer.SKU) string {
+	if value, err := sku.GetCapabilityString(skewer.CapabilityConfidentialComputingType); err == nil {
+		switch {
+		case strings.EqualFold(value, v1beta1.ConfidentialComputingSNP):
+			return v1beta1.ConfidentialComputingSNP
+		case strings.EqualFold(value, v1beta1.ConfidentialComputingTDX):
+			return v1beta1.ConfidentialComputingTDX
+		}
+	}
+	if match := seriesSizePattern.FindStringSubmatch(sku.GetSize()); match != nil {
+		if technology, ok := seriesConfidentialComputing[strings.ToLower(match[1]+match[2])]; ok {
+			return technology
+		}
+	}
+	return v1beta1.ConfidentialComputingNone
+}
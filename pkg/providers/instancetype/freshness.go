@@ -0,0 +1,102 @@
+/*
+Portions Copyright (c) Microsoft Corporation.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package instancetype
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/samber/lo"
+	"k8s.io/apimachinery/pkg/util/sets"
+	karpv1 "sigs.k8s.io/karpenter/pkg/apis/v1"
+
+	"github.com/Azure/karpenter-provider-azure/pkg/apis/v1beta1"
+	"github.com/Azure/karpenter-provider-azure/pkg/operator/options"
+)
+
+// skuRefreshBackoff is how long stale SKUs are kept before their refresh is retried, when it fails
+const skuRefreshBackoff = time.Minute
+
+// StaleData is the pricing and SKU data of the instance types of an AKSNodeClass that is older than the
+// strict-data-freshness option. Their offerings are unavailable until the data is refreshed.
+type StaleData struct {
+	// OnDemandPrices and SpotPrices are the instance types whose on-demand and spot prices are stale
+	OnDemandPrices sets.Set[string]
+	SpotPrices     sets.Set[string]
+	// SKUs is whether the SKUs of the subscription of the AKSNodeClass are stale, which makes all offerings unavailable
+	SKUs bool
+	// SKUsFetched is when the SKUs of the subscription of the AKSNodeClass were fetched
+	SKUsFetched time.Time
+}
+
+// IsStale returns whether any of the data is stale
+func (s *StaleData) IsStale() bool {
+	return s.SKUs || s.OnDemandPrices.Len() > 0 || s.SpotPrices.Len() > 0
+}
+
+// offering returns whether the offering of the instance type of the capacity type is launched with stale data
+func (s *StaleData) offering(instanceType, capacityType string) bool {
+	if s.SKUs {
+		return true
+	}
+	if capacityType == karpv1.CapacityTypeSpot {
+		return s.SpotPrices.Has(instanceType)
+	}
+	return s.OnDemandPrices.Has(instanceType)
+}
+
+// key identifies the stale data in the instance types cache key. Data only gets staler until it's refreshed, which
+// changes the update times the instance types are keyed by too, so the number of stale prices tells which are stale.
+func (s *StaleData) key() string {
+	return fmt.Sprintf("%d-%d-%t", s.OnDemandPrices.Len(), s.SpotPrices.Len(), s.SKUs)
+}
+
+// StaleData returns the pricing and SKU data of the instance types of the AKSNodeClass that is older than the
+// strict-data-freshness option, none while it's disabled
+func (p *DefaultProvider) StaleData(ctx context.Context, nodeClass *v1beta1.AKSNodeClass) (*StaleData, error) {
+	skus, err := p.getInstanceTypes(ctx, lo.FromPtr(nodeClass.Spec.SubscriptionID))
+	if err != nil {
+		return nil, err
+	}
+	return p.staleData(ctx, skus), nil
+}
+
+func (p *DefaultProvider) staleData(ctx context.Context, skus *subscriptionSKUs) *StaleData {
+	stale := &StaleData{OnDemandPrices: sets.New[string](), SpotPrices: sets.New[string](), SKUsFetched: skus.fetched}
+	freshness := options.FromContext(ctx).StrictDataFreshness
+	if freshness <= 0 {
+		return stale
+	}
+	cutoff := time.Now().Add(-freshness)
+	onDemand, spot := p.pricingProvider.PricesUpdatedBefore(cutoff)
+	included := sets.KeySet(skus.included)
+	stale.OnDemandPrices = onDemand.Intersection(included)
+	stale.SpotPrices = spot.Intersection(included)
+	stale.SKUs = skus.fetched.Before(cutoff)
+	return stale
+}
+
+// skusRefreshDue returns whether the SKUs are older than the strict-data-freshness option, or the zones update period
+// used to discover the zones added to the region, and their refresh isn't backing off from a failure
+func skusRefreshDue(ctx context.Context, skus *subscriptionSKUs) bool {
+	age := time.Since(skus.fetched)
+	freshness := options.FromContext(ctx).StrictDataFreshness
+	zonesUpdatePeriod := options.FromContext(ctx).CacheConfig.ZonesUpdatePeriod
+	return ((freshness > 0 && age > freshness) || (zonesUpdatePeriod > 0 && age > zonesUpdatePeriod)) &&
+		time.Since(skus.refreshAttempted) > skuRefreshBackoff
+}
@@ -94,11 +94,12 @@ func (t TaxBrackets) Calculate(amount float64) float64 {
 	return tax
 }
 
+// NewInstanceType computes the instance type of the SKU, which must have the capabilities checked by missingCapabilities
 func NewInstanceType(ctx context.Context, sku *skewer.SKU, vmsize *skewer.VMSizeType, kc *v1beta1.KubeletConfiguration, region string,
 	offerings cloudprovider.Offerings, nodeClass *v1beta1.AKSNodeClass, architecture string) *cloudprovider.InstanceType {
 	return &cloudprovider.InstanceType{
 		Name:         sku.GetName(),
-		Requirements: computeRequirements(sku, vmsize, architecture, offerings, region),
+		Requirements: computeRequirements(sku, vmsize, architecture, operatingSystem(nodeClass), offerings, region),
 		Offerings:    offerings,
 		Capacity:     computeCapacity(ctx, sku, nodeClass),
 		Overhead: &cloudprovider.InstanceTypeOverhead{
@@ -109,13 +110,21 @@ func NewInstanceType(ctx context.Context, sku *skewer.SKU, vmsize *skewer.VMSize
 	}
 }
 
-func computeRequirements(sku *skewer.SKU, vmsize *skewer.VMSizeType, architecture string,
+// operatingSystem returns the operating system of the nodes of the nodeclass, which follows its image family
+func operatingSystem(nodeClass *v1beta1.AKSNodeClass) corev1.OSName {
+	if v1beta1.WindowsFamilies.Has(lo.FromPtr(nodeClass.Spec.ImageFamily)) {
+		return corev1.Windows
+	}
+	return corev1.Linux
+}
+
+func computeRequirements(sku *skewer.SKU, vmsize *skewer.VMSizeType, architecture string, operatingSystem corev1.OSName,
 	offerings cloudprovider.Offerings, region string) scheduling.Requirements {
 	requirements := scheduling.NewRequirements(
 		// Well Known Upstream
 		scheduling.NewRequirement(corev1.LabelInstanceTypeStable, corev1.NodeSelectorOpIn, sku.GetName()),
 		scheduling.NewRequirement(corev1.LabelArchStable, corev1.NodeSelectorOpIn, getArchitecture(architecture)),
-		scheduling.NewRequirement(corev1.LabelOSStable, corev1.NodeSelectorOpIn, string(corev1.Linux)),
+		scheduling.NewRequirement(corev1.LabelOSStable, corev1.NodeSelectorOpIn, string(operatingSystem)),
 		scheduling.NewRequirement(corev1.LabelTopologyZone, corev1.NodeSelectorOpIn, lo.Map(offerings.Available(), func(o *cloudprovider.Offering, _ int) string {
 			return o.Requirements.Get(corev1.LabelTopologyZone).Any()
 		})...),
@@ -145,9 +154,14 @@ func computeRequirements(sku *skewer.SKU, vmsize *skewer.VMSizeType, architectur
 
 		// SKU capabilities
 		scheduling.NewRequirement(v1beta1.LabelSKUStorageEphemeralOSMaxSize, corev1.NodeSelectorOpDoesNotExist),
+		scheduling.NewRequirement(v1beta1.LabelSKUStorageLocalProtocol, corev1.NodeSelectorOpDoesNotExist),
+		scheduling.NewRequirement(v1beta1.LabelSKUStorageLocalCount, corev1.NodeSelectorOpDoesNotExist),
+		scheduling.NewRequirement(v1beta1.LabelSKUStorageLocalSize, corev1.NodeSelectorOpDoesNotExist),
 		scheduling.NewRequirement(v1beta1.LabelSKUStoragePremiumCapable, corev1.NodeSelectorOpIn, fmt.Sprint(sku.IsPremiumIO())),
 		scheduling.NewRequirement(v1beta1.LabelSKUAcceleratedNetworking, corev1.NodeSelectorOpIn, fmt.Sprint(sku.IsAcceleratedNetworkingSupported())),
+		scheduling.NewRequirement(v1beta1.LabelSKUNetworkingBandwidth, corev1.NodeSelectorOpDoesNotExist),
 		scheduling.NewRequirement(v1beta1.LabelSKUHyperVGeneration, corev1.NodeSelectorOpDoesNotExist),
+		scheduling.NewRequirement(v1beta1.LabelSKUConfidentialComputing, corev1.NodeSelectorOpIn, ConfidentialComputing(sku)),
 		// all additive feature initialized elsewhere
 	)
 
@@ -158,7 +172,9 @@ func computeRequirements(sku *skewer.SKU, vmsize *skewer.VMSizeType, architectur
 	requirements[v1beta1.LabelSKUFamily].Insert(vmsize.Family)
 
 	setRequirementsEphemeralOSDiskSupported(requirements, sku)
+	setRequirementsLocalDisks(requirements, sku)
 	setRequirementsHyperVGeneration(requirements, sku)
+	setRequirementsNetworkBandwidth(requirements, sku)
 	setRequirementsGPU(requirements, sku, vmsize)
 	setRequirementsVersion(requirements, vmsize)
 
@@ -172,8 +188,18 @@ func setRequirementsEphemeralOSDiskSupported(requirements scheduling.Requirement
 	}
 }
 
+func setRequirementsLocalDisks(requirements scheduling.Requirements, sku *skewer.SKU) {
+	protocol, count, sizeGB := FindLocalDisks(sku)
+	if protocol != "" {
+		requirements[v1beta1.LabelSKUStorageLocalProtocol].Insert(protocol)
+	}
+	requirements[v1beta1.LabelSKUStorageLocalCount].Insert(fmt.Sprint(count))
+	requirements[v1beta1.LabelSKUStorageLocalSize].Insert(fmt.Sprint(sizeGB))
+}
+
 func setRequirementsHyperVGeneration(requirements scheduling.Requirements, sku *skewer.SKU) {
-	if sku.IsHyperVGen1Supported() {
+	// SKUs without Hyper-V generations support V1
+	if _, err := sku.GetCapabilityString(skewer.HyperVGenerations); err != nil || sku.IsHyperVGen1Supported() {
 		requirements[v1beta1.LabelSKUHyperVGeneration].Insert(v1beta1.HyperVGenerationV1)
 	}
 	if sku.IsHyperVGen2Supported() {
@@ -181,6 +207,12 @@ func setRequirementsHyperVGeneration(requirements scheduling.Requirements, sku *
 	}
 }
 
+func setRequirementsNetworkBandwidth(requirements scheduling.Requirements, sku *skewer.SKU) {
+	if mbps, ok := NetworkBandwidthMbps(sku); ok {
+		requirements[v1beta1.LabelSKUNetworkingBandwidth].Insert(fmt.Sprint(mbps))
+	}
+}
+
 func setRequirementsGPU(requirements scheduling.Requirements, sku *skewer.SKU, vmsize *skewer.VMSizeType) {
 	if utils.IsNvidiaEnabledSKU(sku.GetName()) {
 		requirements[v1beta1.LabelSKUGPUManufacturer].Insert(v1beta1.ManufacturerNvidia)
@@ -253,6 +285,8 @@ func CalculateMemoryWithoutOverhead(vmMemoryOverheadPercent float64, skuMemoryGi
 	return memory
 }
 
+// ephemeralStorage is the OS disk size in GB, rather than in the GiB of the disk: the root filesystem nodes grow to the
+// OS disk on bootstrap is smaller than the disk, by its partitions and filesystem metadata, but larger than that.
 func ephemeralStorage(nodeClass *v1beta1.AKSNodeClass) *resource.Quantity {
 	return resource.NewScaledQuantity(int64(lo.FromPtr(nodeClass.Spec.OSDiskSizeGB)), resource.Giga)
 }
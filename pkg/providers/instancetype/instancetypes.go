@@ -19,6 +19,7 @@ package instancetype
 import (
 	"context"
 	"fmt"
+	"maps"
 	"net/http"
 	"strings"
 	"sync"
@@ -62,6 +63,12 @@ type Provider interface {
 
 	// Return Azure Skewer Representation of the instance type
 	Get(context.Context, *v1beta1.AKSNodeClass, string) (*skewer.SKU, error)
+	// Snapshot returns the offerings of the instance types of the nodeclass the nodepool can launch, and why the other SKUs are excluded
+	Snapshot(context.Context, *karpv1.NodePool, *v1beta1.AKSNodeClass) (*OfferingsSnapshot, error)
+	// StaleData returns the pricing and SKU data of the instance types of the nodeclass older than the strict data freshness
+	StaleData(context.Context, *v1beta1.AKSNodeClass) (*StaleData, error)
+	// Zones returns the zones of the region the instance types are offered in, for the subscription of the nodeclass
+	Zones(context.Context, *v1beta1.AKSNodeClass) (sets.Set[string], error)
 	//UpdateInstanceTypes(ctx context.Context) error
 	//UpdateInstanceTypeOfferings(ctx context.Context) error
 }
@@ -70,12 +77,16 @@ type Provider interface {
 var _ Provider = (*DefaultProvider)(nil)
 
 type DefaultProvider struct {
-	region               string
-	skuClient            skewer.ResourceClient
-	pricingProvider      *pricing.Provider
-	unavailableOfferings *kcache.UnavailableOfferings
-
-	// Has one cache entry for all the instance types (key: InstanceTypesCacheKey)
+	region    string
+	skuClient skewer.ResourceClient
+	// skuClientForSubscription returns the SKU client of a subscription other than the cluster's, for nodeclasses
+	// that create their VMs in another subscription. It may be nil, in which case the cluster's SKUs are used.
+	skuClientForSubscription func(subscriptionID string) (skewer.ResourceClient, error)
+	pricingProvider          *pricing.Provider
+	unavailableOfferings     *kcache.UnavailableOfferings
+
+	// Has one cache entry for all the instance types of each subscription, along with the SKUs excluded from them
+	// (key: InstanceTypesCacheKey, suffixed with the subscription for subscriptions other than the cluster's)
 	// Values cached *before* considering insufficient capacity errors from the unavailableOfferings cache.
 	// Fully initialized Instance Types are also cached based on the set of all instance types,
 	// unavailableOfferings cache, AWSNodeClass, and kubelet configuration from the NodePool
@@ -93,88 +104,153 @@ func NewDefaultProvider(
 	skuClient skewer.ResourceClient,
 	pricingProvider *pricing.Provider,
 	offeringsCache *kcache.UnavailableOfferings,
+	skuClientForSubscription func(subscriptionID string) (skewer.ResourceClient, error),
 ) *DefaultProvider {
 	return &DefaultProvider{
 		// TODO: skewer api, subnetprovider, pricing provider, unavailable offerings, ...
-		region:               region,
-		skuClient:            skuClient,
-		pricingProvider:      pricingProvider,
-		unavailableOfferings: offeringsCache,
-		instanceTypesCache:   cache,
-		cm:                   pretty.NewChangeMonitor(),
-		instanceTypesSeqNum:  0,
+		region:                   region,
+		skuClient:                skuClient,
+		skuClientForSubscription: skuClientForSubscription,
+		pricingProvider:          pricingProvider,
+		unavailableOfferings:     offeringsCache,
+		instanceTypesCache:       cache,
+		cm:                       pretty.NewChangeMonitor(),
+		instanceTypesSeqNum:      0,
 	}
 }
 func (p *DefaultProvider) Get(ctx context.Context, nodeClass *v1beta1.AKSNodeClass, instanceType string) (*skewer.SKU, error) {
-	skus, err := p.getInstanceTypes(ctx)
+	skus, err := p.getInstanceTypes(ctx, lo.FromPtr(nodeClass.Spec.SubscriptionID))
 	if err != nil {
 		return nil, err
 	}
-	if sku, ok := skus[instanceType]; ok {
+	if sku, ok := skus.included[instanceType]; ok {
 		return sku, nil
 	}
 	return nil, fmt.Errorf("instance type %s not found", instanceType)
 }
 
+func (p *DefaultProvider) Zones(ctx context.Context, nodeClass *v1beta1.AKSNodeClass) (sets.Set[string], error) {
+	skus, err := p.getInstanceTypes(ctx, lo.FromPtr(nodeClass.Spec.SubscriptionID))
+	if err != nil {
+		return nil, err
+	}
+	return skus.zones.Clone(), nil
+}
+
 // Get all instance type options
 func (p *DefaultProvider) List(
 	ctx context.Context, nodeClass *v1beta1.AKSNodeClass) ([]*cloudprovider.InstanceType, error) {
+	instanceTypes, err := p.list(ctx, nodeClass)
+	if err != nil {
+		return nil, err
+	}
+	// Ensure what's returned from this function is a shallow-copy of the slice (not a deep-copy of the data itself)
+	// so that modifications to the ordering of the data don't affect the original
+	return append([]*cloudprovider.InstanceType{}, instanceTypes.included...), nil
+}
+
+// list returns the instance types of the nodeclass, along with the SKUs excluded from them
+func (p *DefaultProvider) list(ctx context.Context, nodeClass *v1beta1.AKSNodeClass) (*nodeClassInstanceTypes, error) {
 	kc := nodeClass.Spec.Kubelet
 
 	// Get SKUs from Azure
-	skus, err := p.getInstanceTypes(ctx)
+	subscriptionID := lo.FromPtr(nodeClass.Spec.SubscriptionID)
+	skus, err := p.getInstanceTypes(ctx, subscriptionID)
 	if err != nil {
 		return nil, err
 	}
+	// the spot offerings are priced in the logical zones of the subscription the nodes are launched in
+	p.pricingProvider.TrackSubscription(subscriptionID)
 
 	// Compute fully initialized instance types hash key
 	kcHash, _ := hashstructure.Hash(kc, hashstructure.FormatV2, &hashstructure.HashOptions{SlicesAsSets: true})
-	key := fmt.Sprintf("%d-%d-%016x-%s-%d-%d-%t",
+	imageRequirements := lo.Map(nodeClass.Status.Images, func(image v1beta1.NodeImage, _ int) []corev1.NodeSelectorRequirement { return image.Requirements })
+	imagesHash, _ := hashstructure.Hash(imageRequirements, hashstructure.FormatV2, &hashstructure.HashOptions{SlicesAsSets: true})
+	stale := p.staleData(ctx, skus)
+	// the SKUs are cached for long, so the retirement of their VM series is checked against the current time instead
+	now := time.Now()
+	retired := sets.New[string]()
+	for name, sku := range skus.included {
+		if isRetired(ctx, sku, now) {
+			retired.Insert(name)
+		}
+	}
+	retiredHash, _ := hashstructure.Hash(sets.List(retired), hashstructure.FormatV2, nil)
+	// offerings are priced when instance types are computed, so they are recomputed when prices are updated, or stale
+	key := fmt.Sprintf("%d-%d-%d-%d-%d-%016x-%016x-%s-%d-%d-%t-%t-%t-%s-%s-%016x",
 		p.instanceTypesSeqNum,
 		p.unavailableOfferings.SeqNum,
+		p.pricingProvider.OnDemandLastUpdated().UnixNano(),
+		p.pricingProvider.SpotLastUpdated().UnixNano(),
+		p.pricingProvider.ZonalSpotLastUpdated().UnixNano(),
 		kcHash,
+		imagesHash,
 		lo.FromPtr(nodeClass.Spec.ImageFamily),
 		lo.FromPtr(nodeClass.Spec.OSDiskSizeGB),
 		utils.GetMaxPods(nodeClass, options.FromContext(ctx).NetworkPlugin, options.FromContext(ctx).NetworkPluginMode),
 		nodeClass.GetEncryptionAtHost(),
+		nodeClass.IsConfidentialVM(),
+		nodeClass.IsTrustedLaunch(),
+		strings.ToLower(lo.FromPtr(nodeClass.Spec.SubscriptionID)),
+		stale.key(),
+		retiredHash,
 	)
 	if item, ok := p.instanceTypesCache.Get(key); ok {
-		// Ensure what's returned from this function is a shallow-copy of the slice (not a deep-copy of the data itself)
-		// so that modifications to the ordering of the data don't affect the original
-		return append([]*cloudprovider.InstanceType{}, item.([]*cloudprovider.InstanceType)...), nil
+		return item.(*nodeClassInstanceTypes), nil
 	}
 
 	// Get Viable offerings
 	/// Azure has zones availability directly from SKU info
-	var result []*cloudprovider.InstanceType
-	for _, sku := range skus {
-		vmsize, err := sku.GetVMSize()
-		if err != nil {
-			log.FromContext(ctx).Error(err, "parsing VM size", "vmSize", *sku.Size)
+	result := &nodeClassInstanceTypes{excluded: maps.Clone(skus.excluded)}
+	for _, sku := range skus.included {
+		if retired.Has(sku.GetName()) {
+			log.FromContext(ctx).V(1).Info("excluding SKU of retired VM series", "vmSize", sku.GetName(), "family", sku.GetFamilyName())
+			result.excluded.exclude(sku.GetName(), ExclusionReasonDenied, "VM series %s is retired", sku.GetFamilyName())
 			continue
 		}
-		architecture, err := sku.GetCPUArchitectureType()
+		vmsize, err := sku.GetVMSize()
 		if err != nil {
-			log.FromContext(ctx).Error(err, "parsing SKU architecture", "vmSize", *sku.Size)
+			log.FromContext(ctx).Error(err, "parsing VM size", "vmSize", sku.GetSize())
+			result.excluded.exclude(sku.GetName(), ExclusionReasonCapabilityMismatch, "parsing VM size, %s", err)
 			continue
 		}
+		architecture := skuArchitecture(sku)
 		instanceTypeZones := p.instanceTypeZones(sku)
 		// !!! Important !!!
 		// Any changes to the values passed into the NewInstanceType method will require making updates to the cache key
 		// so that Karpenter is able to cache the set of InstanceTypes based on values that alter the set of instance types
 		// !!! Important !!!
-		instanceType := NewInstanceType(ctx, sku, vmsize, kc, p.region, p.createOfferings(sku, instanceTypeZones), nodeClass, architecture)
+		instanceType := NewInstanceType(ctx, sku, vmsize, kc, p.region, p.createOfferings(sku, instanceTypeZones, subscriptionID, stale), nodeClass, architecture)
 		if len(instanceType.Offerings) == 0 {
+			result.excluded.exclude(sku.GetName(), ExclusionReasonUnavailableOffering, "no offerings")
 			continue
 		}
 
 		if !p.isInstanceTypeSupportedByImageFamily(sku.GetName(), lo.FromPtr(nodeClass.Spec.ImageFamily)) {
+			result.excluded.exclude(sku.GetName(), ExclusionReasonCapabilityMismatch, "GPU not supported by image family %s", lo.FromPtr(nodeClass.Spec.ImageFamily))
+			continue
+		}
+		if !p.isInstanceTypeSupportedByImages(instanceType, nodeClass) {
+			result.excluded.exclude(sku.GetName(), ExclusionReasonCapabilityMismatch, "no image of the nodeclass is compatible")
 			continue
 		}
 		if !p.isInstanceTypeSupportedByEncryptionAtHost(sku, nodeClass) {
+			result.excluded.exclude(sku.GetName(), ExclusionReasonCapabilityMismatch, "encryption at host not supported")
+			continue
+		}
+		if nodeClass.IsConfidentialVM() && ConfidentialComputing(sku) == v1beta1.ConfidentialComputingNone {
+			result.excluded.exclude(sku.GetName(), ExclusionReasonCapabilityMismatch, "not a confidential VM size")
+			continue
+		}
+		if !nodeClass.IsConfidentialVM() && p.isConfidential(sku) {
+			result.excluded.exclude(sku.GetName(), ExclusionReasonCapabilityMismatch, "confidential VMs require the ConfidentialVM security type")
+			continue
+		}
+		if nodeClass.IsTrustedLaunch() && !p.supportsTrustedLaunch(sku) {
+			result.excluded.exclude(sku.GetName(), ExclusionReasonCapabilityMismatch, "trusted launch not supported")
 			continue
 		}
-		result = append(result, instanceType)
+		result.included = append(result.included, instanceType)
 	}
 
 	p.instanceTypesCache.SetDefault(key, result)
@@ -211,13 +287,13 @@ func (p *DefaultProvider) instanceTypeZones(sku *skewer.SKU) sets.Set[string] {
 // offering, you can do the following thanks to this invariant:
 //
 //	offering.Requirements.Get(v1.TopologyLabelZone).Any()
-func (p *DefaultProvider) createOfferings(sku *skewer.SKU, zones sets.Set[string]) cloudprovider.Offerings {
+func (p *DefaultProvider) createOfferings(sku *skewer.SKU, zones sets.Set[string], subscriptionID string, stale *StaleData) cloudprovider.Offerings {
 	offerings := []*cloudprovider.Offering{}
 	for zone := range zones {
-		onDemandPrice, onDemandOk := p.pricingProvider.OnDemandPrice(*sku.Name)
-		spotPrice, spotOk := p.pricingProvider.SpotPrice(*sku.Name)
-		availableOnDemand := onDemandOk && !p.unavailableOfferings.IsUnavailable(sku, zone, karpv1.CapacityTypeOnDemand)
-		availableSpot := spotOk && !p.unavailableOfferings.IsUnavailable(sku, zone, karpv1.CapacityTypeSpot)
+		onDemandPrice, _ := p.pricingProvider.OnDemandPrice(sku.GetName())
+		spotPrice, _ := p.pricingProvider.SubscriptionZonalSpotPrice(subscriptionID, sku.GetName(), zone)
+		availableOnDemand := p.offeringUnavailableReason(sku, zone, karpv1.CapacityTypeOnDemand, subscriptionID, stale) == ""
+		availableSpot := p.offeringUnavailableReason(sku, zone, karpv1.CapacityTypeSpot, subscriptionID, stale) == ""
 
 		onDemandOffering := &cloudprovider.Offering{
 			Requirements: scheduling.NewRequirements(
@@ -255,6 +331,28 @@ func (p *DefaultProvider) createOfferings(sku *skewer.SKU, zones sets.Set[string
 	return offerings
 }
 
+// offeringUnavailableReason returns why the offering of the SKU is unavailable, or the empty string if it's available.
+// Offerings are unavailable without a price, with stale pricing or SKU data, or while marked unavailable after a launch
+// failure.
+func (p *DefaultProvider) offeringUnavailableReason(sku *skewer.SKU, zone, capacityType, subscriptionID string, stale *StaleData) string {
+	var priced bool
+	if capacityType == karpv1.CapacityTypeSpot {
+		_, priced = p.pricingProvider.SubscriptionZonalSpotPrice(subscriptionID, sku.GetName(), zone)
+	} else {
+		_, priced = p.pricingProvider.OnDemandPrice(sku.GetName())
+	}
+	if !priced {
+		return NoPriceReason
+	}
+	if stale.offering(sku.GetName(), capacityType) {
+		return StaleDataReason
+	}
+	if reason, unavailable := p.unavailableOfferings.UnavailableReason(sku, zone, capacityType); unavailable {
+		return lo.Ternary(reason != "", reason, UnavailableReason)
+	}
+	return ""
+}
+
 func (p *DefaultProvider) isInstanceTypeSupportedByImageFamily(skuName, imageFamily string) bool {
 	// Currently only GPU has conditional support by image family
 	if !(utils.IsNvidiaEnabledSKU(skuName) || utils.IsMarinerEnabledGPUSKU(skuName)) {
@@ -263,13 +361,27 @@ func (p *DefaultProvider) isInstanceTypeSupportedByImageFamily(skuName, imageFam
 	switch {
 	case v1beta1.UbuntuFamilies.Has(imageFamily):
 		return utils.IsNvidiaEnabledSKU(skuName)
-	case imageFamily == v1beta1.AzureLinuxImageFamily:
+	case v1beta1.AzureLinuxFamilies.Has(imageFamily):
 		return utils.IsMarinerEnabledGPUSKU(skuName)
 	default:
 		return false
 	}
 }
 
+// isInstanceTypeSupportedByImages checks that one of the images resolved for the node class can be launched on the instance type,
+// e.g. that there is an image for its architecture. Until the images are resolved, all instance types are considered supported.
+func (p *DefaultProvider) isInstanceTypeSupportedByImages(instanceType *cloudprovider.InstanceType, nodeClass *v1beta1.AKSNodeClass) bool {
+	if len(nodeClass.Status.Images) == 0 {
+		return true
+	}
+	return lo.SomeBy(nodeClass.Status.Images, func(image v1beta1.NodeImage) bool {
+		return instanceType.Requirements.Compatible(
+			scheduling.NewNodeSelectorRequirements(image.Requirements...),
+			v1beta1.AllowUndefinedWellKnownAndRestrictedLabels,
+		) == nil
+	})
+}
+
 func (p *DefaultProvider) isInstanceTypeSupportedByEncryptionAtHost(sku *skewer.SKU, nodeClass *v1beta1.AKSNodeClass) bool {
 	// If EncryptionAtHost is not enabled in the nodeclass, all instance types are supported
 	if !nodeClass.GetEncryptionAtHost() {
@@ -288,8 +400,10 @@ func (p *DefaultProvider) supportsEncryptionAtHost(sku *skewer.SKU) bool {
 	return strings.EqualFold(value, "True")
 }
 
-// getInstanceTypes retrieves all instance types from skewer using some opinionated filters
-func (p *DefaultProvider) getInstanceTypes(ctx context.Context) (map[string]*skewer.SKU, error) {
+// getInstanceTypes retrieves all instance types of the subscription from skewer using some opinionated filters.
+// The empty subscription is the cluster's. SKU availability and restrictions differ per subscription, while the
+// region, and so pricing, is the cluster's for all of them.
+func (p *DefaultProvider) getInstanceTypes(ctx context.Context, subscriptionID string) (*subscriptionSKUs, error) {
 	// DO NOT REMOVE THIS LOCK ----------------------------------------------------------------------------
 	// We lock here so that multiple callers to GetInstanceTypes do not result in cache misses and multiple
 	// calls to Resource API when we could have just made one call. This lock is here because multiple callers result
@@ -298,49 +412,114 @@ func (p *DefaultProvider) getInstanceTypes(ctx context.Context) (map[string]*ske
 	p.mu.Lock()
 	defer p.mu.Unlock()
 
-	if cached, ok := p.instanceTypesCache.Get(InstanceTypesCacheKey); ok {
-		return cached.(map[string]*skewer.SKU), nil
+	cacheKey := InstanceTypesCacheKey
+	if subscriptionID != "" {
+		cacheKey = fmt.Sprintf("%s-%s", InstanceTypesCacheKey, strings.ToLower(subscriptionID))
+	}
+	cached, ok := p.instanceTypesCache.Get(cacheKey)
+	if !ok {
+		return p.fetchSKUs(ctx, subscriptionID, cacheKey)
+	}
+	skus := cached.(*subscriptionSKUs)
+	if !skusRefreshDue(ctx, skus) {
+		return skus, nil
+	}
+	// with strict data freshness, stale SKUs are refreshed ahead of their expiry, and kept while they can't be, so that
+	// their offerings are unavailable rather than the instance types failing to list. They're also refreshed every
+	// zones update period, so that the zones added to the region are offered without waiting for their expiry.
+	skus.refreshAttempted = time.Now()
+	refreshed, err := p.fetchSKUs(ctx, subscriptionID, cacheKey)
+	if err != nil {
+		log.FromContext(ctx).Error(err, "refreshing stale SKUs", "fetched", skus.fetched.Format(time.RFC3339))
+		return skus, nil
+	}
+	if added := refreshed.zones.Difference(skus.zones); added.Len() > 0 {
+		log.FromContext(ctx).Info("discovered new zones", "zones", sets.List(added), "subscriptionID", subscriptionID)
 	}
-	instanceTypes := map[string]*skewer.SKU{}
+	return refreshed, nil
+}
 
-	cache, err := skewer.NewCache(ctx, skewer.WithLocation(p.region), skewer.WithResourceClient(p.skuClient))
+// fetchSKUs fetches the SKUs of the subscription, and caches them. The caller holds the lock.
+func (p *DefaultProvider) fetchSKUs(ctx context.Context, subscriptionID, cacheKey string) (*subscriptionSKUs, error) {
+	skuClient := p.skuClient
+	if subscriptionID != "" && p.skuClientForSubscription != nil {
+		var err error
+		if skuClient, err = p.skuClientForSubscription(subscriptionID); err != nil {
+			return nil, fmt.Errorf("getting SKU client for subscription %s, %w", subscriptionID, err)
+		}
+	}
+	instanceTypes := &subscriptionSKUs{included: map[string]*skewer.SKU{}, excluded: exclusions{}, fetched: time.Now(), zones: sets.New[string]()}
+
+	cache, err := skewer.NewCache(ctx, skewer.WithLocation(p.region), skewer.WithResourceClient(skuClient))
 	if err != nil {
 		return nil, fmt.Errorf("fetching SKUs using skewer, %w", err)
 	}
 
-	skus := cache.List(ctx, skewer.IncludesFilter(GetKarpenterWorkingSKUs()))
+	workingSKUs := GetKarpenterWorkingSKUs()
+	for _, sku := range cache.List(ctx, skewer.ResourceTypeFilter(skewer.VirtualMachines)) {
+		if !sku.MemberOf(workingSKUs) {
+			instanceTypes.excluded.exclude(sku.GetName(), ExclusionReasonDenied, "not a SKU known to work with AKS and Karpenter")
+		}
+	}
+	skus := cache.List(ctx, skewer.IncludesFilter(workingSKUs))
 	log.FromContext(ctx).V(1).Info("discovered SKUs", "skuCount", len(skus))
 	for i := range skus {
 		vmsize, err := skus[i].GetVMSize()
 		if err != nil {
-			log.FromContext(ctx).Error(err, "parsing VM size", "vmSize", *skus[i].Size)
+			log.FromContext(ctx).Error(err, "parsing VM size", "vmSize", skus[i].GetSize())
+			instanceTypes.excluded.exclude(skus[i].GetName(), ExclusionReasonCapabilityMismatch, "parsing VM size, %s", err)
+			continue
+		}
+		if missing := missingCapabilities(&skus[i]); len(missing) > 0 {
+			log.FromContext(ctx).Info("excluding SKU missing required capabilities", "vmSize", skus[i].GetName(), "capabilities", missing)
+			for _, capability := range missing {
+				SKUMissingCapabilityMetric.WithLabelValues(skus[i].GetName(), capability).Inc()
+			}
+			instanceTypes.excluded.exclude(skus[i].GetName(), ExclusionReasonCapabilityMismatch, "missing capabilities %s", strings.Join(missing, ", "))
 			continue
 		}
 		useSIG := options.FromContext(ctx).UseSIG
-		if !skus[i].HasLocationRestriction(p.region) && p.isSupported(&skus[i], vmsize, useSIG) {
-			instanceTypes[skus[i].GetName()] = &skus[i]
+		if skus[i].HasLocationRestriction(p.region) {
+			instanceTypes.excluded.exclude(skus[i].GetName(), ExclusionReasonDenied, "restricted in %s for the subscription", p.region)
+			continue
 		}
+		if exclusion := p.supportExclusion(&skus[i], vmsize, useSIG); exclusion != nil {
+			instanceTypes.excluded[skus[i].GetName()] = *exclusion
+			continue
+		}
+		instanceTypes.included[skus[i].GetName()] = &skus[i]
+		instanceTypes.zones.Insert(p.instanceTypeZones(&skus[i]).UnsortedList()...)
 	}
+	// non-zonal offerings have no zone
+	instanceTypes.zones.Delete("")
 
-	if p.cm.HasChanged("instance-types", instanceTypes) {
+	if p.cm.HasChanged("instance-types"+strings.TrimPrefix(cacheKey, InstanceTypesCacheKey), instanceTypes.included) {
 		// Only update instanceTypesSeqNun with the instance types have been changed
 		// This is to not create new keys with duplicate instance types option
 		atomic.AddUint64(&p.instanceTypesSeqNum, 1)
-		log.FromContext(ctx).V(1).Info("discovered instance types", "instanceTypeCount", len(instanceTypes))
+		log.FromContext(ctx).V(1).Info("discovered instance types", "instanceTypeCount", len(instanceTypes.included))
 	}
-	p.instanceTypesCache.SetDefault(InstanceTypesCacheKey, instanceTypes)
+	p.instanceTypesCache.SetDefault(cacheKey, instanceTypes)
 	return instanceTypes, nil
 }
 
-// isSupported indicates SKU is supported by AKS, based on SKU properties
-func (p *DefaultProvider) isSupported(sku *skewer.SKU, vmsize *skewer.VMSizeType, useSIG bool) bool {
-	return p.hasMinimumCPU(sku) &&
-		p.hasMinimumMemory(sku) &&
-		!p.isUnsupportedByAKS(sku) &&
-		!p.isUnsupportedGPU(sku) &&
-		!p.hasConstrainedCPUs(vmsize) &&
-		!p.isConfidential(sku) &&
-		isCompatibleImageAvailable(sku, useSIG)
+// supportExclusion returns why the SKU isn't supported by AKS, based on SKU properties, or nil if it is
+func (p *DefaultProvider) supportExclusion(sku *skewer.SKU, vmsize *skewer.VMSizeType, useSIG bool) *Exclusion {
+	switch {
+	case !p.hasMinimumCPU(sku):
+		return &Exclusion{Reason: ExclusionReasonCapabilityMismatch, Message: "fewer than 2 vCPUs"}
+	case !p.hasMinimumMemory(sku):
+		return &Exclusion{Reason: ExclusionReasonCapabilityMismatch, Message: "less than 3.5 GiB of memory"}
+	case p.isUnsupportedByAKS(sku):
+		return &Exclusion{Reason: ExclusionReasonDenied, Message: "not supported by AKS"}
+	case p.isUnsupportedGPU(sku):
+		return &Exclusion{Reason: ExclusionReasonCapabilityMismatch, Message: "GPU not supported"}
+	case p.hasConstrainedCPUs(vmsize):
+		return &Exclusion{Reason: ExclusionReasonCapabilityMismatch, Message: "constrained vCPUs"}
+	case !isCompatibleImageAvailable(sku, useSIG):
+		return &Exclusion{Reason: ExclusionReasonCapabilityMismatch, Message: "no compatible image"}
+	}
+	return nil
 }
 
 // at least 2 cpus
@@ -367,6 +546,10 @@ func (p *DefaultProvider) isUnsupportedGPU(sku *skewer.SKU) bool {
 	if err != nil || gpu <= 0 {
 		return false
 	}
+	// GPU drivers are only shipped for amd64 images
+	if getArchitecture(skuArchitecture(sku)) != karpv1.ArchitectureAmd64 {
+		return true
+	}
 	return !utils.IsMarinerEnabledGPUSKU(name) && !utils.IsNvidiaEnabledSKU(name)
 }
 
@@ -375,39 +558,100 @@ func (p *DefaultProvider) hasConstrainedCPUs(vmsize *skewer.VMSizeType) bool {
 	return vmsize.CpusConstrained != nil
 }
 
-// confidential VMs (DC, EC) are not yet supported by this Karpenter provider
+// confidential VMs (DC, EC, and CVM-only SKUs of other families, e.g. NCC) are only launched for the AKSNodeClasses with
+// the ConfidentialVM security type, with confidential VM images
 func (p *DefaultProvider) isConfidential(sku *skewer.SKU) bool {
 	size := sku.GetSize()
-	return strings.HasPrefix(size, "DC") || strings.HasPrefix(size, "EC")
+	if strings.HasPrefix(size, "DC") || strings.HasPrefix(size, "EC") {
+		return true
+	}
+	_, err := sku.GetCapabilityString(skewer.CapabilityConfidentialComputingType)
+	return err == nil
 }
 
-func FindMaxEphemeralSizeGBAndPlacement(sku *skewer.SKU) (sizeGB int64, placement *armcompute.DiffDiskPlacement) {
-	if sku == nil {
-		return 0, nil
-	}
+// supportsTrustedLaunch returns whether the SKU is a Gen2 VM size that doesn't disable trusted launch
+func (p *DefaultProvider) supportsTrustedLaunch(sku *skewer.SKU) bool {
+	supported, _ := sku.IsTrustedLaunchEnabled()
+	return supported
+}
 
-	if !sku.IsEphemeralOSDiskSupported() {
-		return 0, nil // ephemeral OS disk is not supported by this SKU
+// ephemeralOSDiskPlacement is a placement of the ephemeral OS disk, with the maximum OS disk size it holds
+type ephemeralOSDiskPlacement struct {
+	sizeGB    int64
+	placement armcompute.DiffDiskPlacement
+}
+
+// ephemeralOSDiskPlacements returns the ephemeral OS disk placements the SKU supports, from the best performing: the
+// NVMe disk, then the cache disk, then the resource (temp) disk
+func ephemeralOSDiskPlacements(sku *skewer.SKU) []ephemeralOSDiskPlacement {
+	if sku == nil || !sku.IsEphemeralOSDiskSupported() {
+		return nil // ephemeral OS disk is not supported by this SKU
 	}
 
+	var placements []ephemeralOSDiskPlacement
 	maxNVMeMiB, _ := NvmeSizePerDiskInMiB(sku)
-
-	// Check NVMe disk first (highest priority)
 	if maxNVMeMiB > 0 && supportsNVMeEphemeralOSDisk(sku) {
-		return maxNVMeMiB * int64(units.MiB) / int64(units.Gigabyte), lo.ToPtr(armcompute.DiffDiskPlacementNvmeDisk)
+		placements = append(placements, ephemeralOSDiskPlacement{maxNVMeMiB * int64(units.MiB) / int64(units.Gigabyte), armcompute.DiffDiskPlacementNvmeDisk})
 	}
 
 	maxCacheDiskBytes, _ := sku.MaxCachedDiskBytes()
 	if maxCacheDiskBytes > 0 {
-		return maxCacheDiskBytes / int64(units.Gigabyte), lo.ToPtr(armcompute.DiffDiskPlacementCacheDisk)
+		placements = append(placements, ephemeralOSDiskPlacement{maxCacheDiskBytes / int64(units.Gigabyte), armcompute.DiffDiskPlacementCacheDisk})
+	}
+
+	maxResourceDiskMiB, _ := sku.MaxResourceVolumeMB() // NOTE: MaxResourceVolumeMB is actually in MiBs
+	if maxResourceDiskMiB > 0 {
+		placements = append(placements, ephemeralOSDiskPlacement{maxResourceDiskMiB * int64(units.MiB) / int64(units.Gigabyte), armcompute.DiffDiskPlacementResourceDisk})
+	}
+	return placements
+}
+
+// FindMaxEphemeralSizeGBAndPlacement returns the largest OS disk size any ephemeral OS disk placement of the SKU holds,
+// with the best performing placement holding it. The NVMe disk of v6 SKUs can be smaller than their cache disk.
+func FindMaxEphemeralSizeGBAndPlacement(sku *skewer.SKU) (sizeGB int64, placement *armcompute.DiffDiskPlacement) {
+	for _, p := range ephemeralOSDiskPlacements(sku) {
+		if p.sizeGB > sizeGB {
+			sizeGB, placement = p.sizeGB, lo.ToPtr(p.placement)
+		}
+	}
+	return sizeGB, placement
+}
+
+// FindEphemeralPlacement returns the best performing ephemeral OS disk placement of the SKU that fits an OS disk of
+// the given size, or nil if none does. The NVMe disk of v6 SKUs can be smaller than their cache disk, in which case
+// larger OS disks still fit the cache disk.
+func FindEphemeralPlacement(sku *skewer.SKU, osDiskSizeGB int64) *armcompute.DiffDiskPlacement {
+	for _, placement := range ephemeralOSDiskPlacements(sku) {
+		if osDiskSizeGB <= placement.sizeGB {
+			return lo.ToPtr(placement.placement)
+		}
+	}
+	return nil
+}
+
+// FindLocalDisks returns the protocol, count and total capacity in GB of the SKU's local (temp) disks.
+// NVMe disks take precedence over the SCSI resource disk on SKUs that have both (e.g. Lsv3), since those are
+// the disks workloads target; SKUs without local disks return an empty protocol.
+func FindLocalDisks(sku *skewer.SKU) (protocol string, count int64, sizeGB int64) {
+	if sku == nil {
+		return "", 0, 0
+	}
+
+	totalNVMeMiB, _ := nvmeDiskSizeInMiB(sku)
+	if totalNVMeMiB > 0 {
+		count = 1
+		if perDiskNVMeMiB, _ := NvmeSizePerDiskInMiB(sku); perDiskNVMeMiB > 0 {
+			count = totalNVMeMiB / perDiskNVMeMiB
+		}
+		return v1beta1.StorageLocalProtocolNVMe, count, totalNVMeMiB * int64(units.MiB) / int64(units.Gigabyte)
 	}
 
 	maxResourceDiskMiB, _ := sku.MaxResourceVolumeMB() // NOTE: MaxResourceVolumeMB is actually in MiBs
 	if maxResourceDiskMiB > 0 {
-		return maxResourceDiskMiB * int64(units.MiB) / int64(units.Gigabyte), lo.ToPtr(armcompute.DiffDiskPlacementResourceDisk)
+		return v1beta1.StorageLocalProtocolSCSI, 1, maxResourceDiskMiB * int64(units.MiB) / int64(units.Gigabyte)
 	}
 
-	return 0, nil
+	return "", 0, 0
 }
 
 func isCompatibleImageAvailable(sku *skewer.SKU, useSIG bool) bool {
@@ -429,8 +673,7 @@ func supportsNVMeEphemeralOSDisk(sku *skewer.SKU) bool {
 }
 
 func UseEphemeralDisk(sku *skewer.SKU, nodeClass *v1beta1.AKSNodeClass) bool {
-	sizeGB, _ := FindMaxEphemeralSizeGBAndPlacement(sku)
-	return int64(*nodeClass.Spec.OSDiskSizeGB) <= sizeGB // use ephemeral disk if it is large enough
+	return FindEphemeralPlacement(sku, int64(*nodeClass.Spec.OSDiskSizeGB)) != nil // use ephemeral disk if one is large enough
 }
 
 func nvmeDiskSizeInMiB(s *skewer.SKU) (int64, error) {
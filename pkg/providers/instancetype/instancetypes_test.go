@@ -0,0 +1,336 @@
+/*
+Portions Copyright (c) Microsoft Corporation.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package instancetype
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	//nolint SA1019 - deprecated package
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/cloud"
+	"github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/compute/armcompute/v7"
+	"github.com/Azure/azure-sdk-for-go/services/compute/mgmt/2022-08-01/compute"
+	"github.com/Azure/skewer"
+	"github.com/samber/lo"
+	corev1 "k8s.io/api/core/v1"
+	karpv1 "sigs.k8s.io/karpenter/pkg/apis/v1"
+	"sigs.k8s.io/karpenter/pkg/scheduling"
+
+	"github.com/Azure/karpenter-provider-azure/pkg/apis/v1beta1"
+	"github.com/Azure/karpenter-provider-azure/pkg/auth"
+	"github.com/Azure/karpenter-provider-azure/pkg/operator/options"
+	"github.com/Azure/karpenter-provider-azure/pkg/providers/pricing"
+)
+
+func newTestSKU(name, size string, capabilities map[string]string) *skewer.SKU {
+	return &skewer.SKU{
+		Name: lo.ToPtr(name),
+		Size: lo.ToPtr(size),
+		Capabilities: lo.ToPtr(lo.MapToSlice(capabilities, func(k, v string) compute.ResourceSkuCapabilities {
+			return compute.ResourceSkuCapabilities{Name: lo.ToPtr(k), Value: lo.ToPtr(v)}
+		})),
+	}
+}
+
+func TestIsUnsupportedGPU(t *testing.T) {
+	p := &DefaultProvider{}
+	for _, tc := range []struct {
+		sku      *skewer.SKU
+		expected bool
+	}{
+		{newTestSKU("Standard_D2s_v3", "D2s_v3", map[string]string{"CpuArchitectureType": "x64"}), false},
+		{newTestSKU("Standard_NC6s_v3", "NC6s_v3", map[string]string{"CpuArchitectureType": "x64", "GPUs": "1"}), false},
+		// no GPU drivers for arm64 images
+		{newTestSKU("Standard_NC6s_v3", "NC6s_v3", map[string]string{"CpuArchitectureType": "Arm64", "GPUs": "1"}), true},
+		{newTestSKU("Standard_NV4as_v4", "NV4as_v4", map[string]string{"CpuArchitectureType": "x64", "GPUs": "1"}), true},
+	} {
+		if actual := p.isUnsupportedGPU(tc.sku); actual != tc.expected {
+			t.Errorf("isUnsupportedGPU(%s, %s) = %t, expected %t", *tc.sku.Name, lo.Must(tc.sku.GetCPUArchitectureType()), actual, tc.expected)
+		}
+	}
+}
+
+func TestIsConfidential(t *testing.T) {
+	p := &DefaultProvider{}
+	for _, tc := range []struct {
+		sku      *skewer.SKU
+		expected bool
+	}{
+		{newTestSKU("Standard_D2as_v5", "D2as_v5", nil), false},
+		{newTestSKU("Standard_DC2as_v5", "DC2as_v5", nil), true},
+		{newTestSKU("Standard_EC2as_v5", "EC2as_v5", nil), true},
+		// CVM-only SKUs outside of the DC and EC families
+		{newTestSKU("Standard_NCC40ads_H100_v5", "NCC40ads_H100_v5", map[string]string{"ConfidentialComputingType": "SNP"}), true},
+	} {
+		if actual := p.isConfidential(tc.sku); actual != tc.expected {
+			t.Errorf("isConfidential(%s) = %t, expected %t", *tc.sku.Name, actual, tc.expected)
+		}
+	}
+}
+
+func TestConfidentialComputing(t *testing.T) {
+	for _, tc := range []struct {
+		sku      *skewer.SKU
+		expected string
+	}{
+		// DCasv5 and ECasv5 series (AMD SEV-SNP)
+		{newTestSKU("Standard_DC2as_v5", "DC2as_v5", nil), v1beta1.ConfidentialComputingSNP},
+		{newTestSKU("Standard_DC4ads_v5", "DC4ads_v5", nil), v1beta1.ConfidentialComputingSNP},
+		{newTestSKU("Standard_EC8as_v5", "EC8as_v5", nil), v1beta1.ConfidentialComputingSNP},
+		{newTestSKU("Standard_DC16as_cc_v5", "DC16as_cc_v5", nil), v1beta1.ConfidentialComputingSNP},
+		// DCesv5 and ECesv5 series (Intel TDX)
+		{newTestSKU("Standard_DC2es_v5", "DC2es_v5", nil), v1beta1.ConfidentialComputingTDX},
+		{newTestSKU("Standard_EC2es_v5", "EC2es_v5", nil), v1beta1.ConfidentialComputingTDX},
+		{newTestSKU("Standard_EC16eds_v5", "EC16eds_v5", nil), v1beta1.ConfidentialComputingTDX},
+		// the capability is preferred over the series
+		{newTestSKU("Standard_NCC40ads_H100_v5", "NCC40ads_H100_v5", map[string]string{"ConfidentialComputingType": "SNP"}), v1beta1.ConfidentialComputingSNP},
+		{newTestSKU("Standard_DC2es_v6", "DC2es_v6", map[string]string{"ConfidentialComputingType": "TDX"}), v1beta1.ConfidentialComputingTDX},
+		// application enclave (SGX) sizes aren't confidential VMs
+		{newTestSKU("Standard_DC1s_v2", "DC1s_v2", nil), v1beta1.ConfidentialComputingNone},
+		{newTestSKU("Standard_DC2ds_v3", "DC2ds_v3", nil), v1beta1.ConfidentialComputingNone},
+		// ordinary SKUs
+		{newTestSKU("Standard_D2as_v5", "D2as_v5", nil), v1beta1.ConfidentialComputingNone},
+		{newTestSKU("Standard_E2s_v5", "E2s_v5", nil), v1beta1.ConfidentialComputingNone},
+		{newTestSKU("Standard_D2s_v3", "D2s_v3", map[string]string{"CpuArchitectureType": "x64"}), v1beta1.ConfidentialComputingNone},
+		{newTestSKU("Standard_NC24ads_A100_v4", "NC24ads_A100_v4", nil), v1beta1.ConfidentialComputingNone},
+	} {
+		if actual := ConfidentialComputing(tc.sku); actual != tc.expected {
+			t.Errorf("ConfidentialComputing(%s) = %s, expected %s", *tc.sku.Name, actual, tc.expected)
+		}
+	}
+}
+
+func TestNetworkBandwidthMbps(t *testing.T) {
+	for _, tc := range []struct {
+		sku           *skewer.SKU
+		expected      int64
+		expectedKnown bool
+	}{
+		{newTestSKU("Standard_D2s_v3", "D2s_v3", nil), 1000, true},
+		{newTestSKU("standard_d16s_v5", "D16s_v5", nil), 12500, true},
+		// the table takes precedence over the capability
+		{newTestSKU("Standard_F72s_v2", "F72s_v2", map[string]string{networkBandwidthCapability: "1"}), 30000, true},
+		// capability fallback for SKUs missing from the table
+		{newTestSKU("Standard_D2ls_v6", "D2ls_v6", map[string]string{networkBandwidthCapability: "12500"}), 12500, true},
+		{newTestSKU("Standard_D2ls_v6", "D2ls_v6", nil), 0, false},
+		{newTestSKU("Standard_D2ls_v6", "D2ls_v6", map[string]string{networkBandwidthCapability: "fast"}), 0, false},
+	} {
+		actual, known := NetworkBandwidthMbps(tc.sku)
+		if actual != tc.expected || known != tc.expectedKnown {
+			t.Errorf("NetworkBandwidthMbps(%s) = (%d, %t), expected (%d, %t)", *tc.sku.Name, actual, known, tc.expected, tc.expectedKnown)
+		}
+	}
+}
+
+func TestFindLocalDisks(t *testing.T) {
+	lsv3 := func(name, size, totalMiB string) *skewer.SKU {
+		return newTestSKU(name, size, map[string]string{
+			"MaxResourceVolumeMB":  "81920",
+			"NvmeDiskSizeInMiB":    totalMiB,
+			"NvmeSizePerDiskInMiB": "1831420",
+		})
+	}
+	for _, tc := range []struct {
+		sku              *skewer.SKU
+		expectedProtocol string
+		expectedCount    int64
+		expectedSizeGB   int64
+	}{
+		// NVMe data disks take precedence over the SCSI temp disk
+		{lsv3("Standard_L8s_v3", "L8s_v3", "1831420"), "nvme", 1, 1920},
+		{lsv3("Standard_L16s_v3", "L16s_v3", "3662840"), "nvme", 2, 3840},
+		{newTestSKU("Standard_D4ads_v6", "D4ads_v6", map[string]string{
+			"MaxResourceVolumeMB":  "0",
+			"DiskControllerTypes":  "NVMe",
+			"NvmeDiskSizeInMiB":    "225280",
+			"NvmeSizePerDiskInMiB": "225280",
+		}), "nvme", 1, 236},
+		{newTestSKU("Standard_D2s_v3", "D2s_v3", map[string]string{"MaxResourceVolumeMB": "16384"}), "scsi", 1, 17},
+		// no local disk
+		{newTestSKU("Standard_D4s_v5", "D4s_v5", map[string]string{"MaxResourceVolumeMB": "0"}), "", 0, 0},
+		{nil, "", 0, 0},
+	} {
+		protocol, count, sizeGB := FindLocalDisks(tc.sku)
+		if protocol != tc.expectedProtocol || count != tc.expectedCount || sizeGB != tc.expectedSizeGB {
+			t.Errorf("FindLocalDisks(%s) = (%q, %d, %d), expected (%q, %d, %d)", lo.FromPtr(lo.FromPtr(tc.sku).Name),
+				protocol, count, sizeGB, tc.expectedProtocol, tc.expectedCount, tc.expectedSizeGB)
+		}
+	}
+}
+
+func TestFindEphemeralPlacement(t *testing.T) {
+	// v6 SKUs place the ephemeral OS disk on their NVMe disk, v5 SKUs on their cache or temp disk
+	d4dsv6 := newTestSKU("Standard_D4ds_v6", "D4ds_v6", map[string]string{
+		"EphemeralOSDiskSupported":           "True",
+		"SupportedEphemeralOSDiskPlacements": "NvmeDisk",
+		"DiskControllerTypes":                "SCSI,NVMe",
+		"NvmeDiskSizeInMiB":                  "225280",
+		"NvmeSizePerDiskInMiB":               "225280",
+		"MaxResourceVolumeMB":                "0",
+	})
+	d4dsv5 := newTestSKU("Standard_D4ds_v5", "D4ds_v5", map[string]string{
+		"EphemeralOSDiskSupported":           "True",
+		"SupportedEphemeralOSDiskPlacements": "ResourceDisk,CacheDisk",
+		"CachedDiskBytes":                    "107374182400",
+		"MaxResourceVolumeMB":                "153600",
+	})
+	// a SKU whose NVMe disk is smaller than its cache disk
+	smallNVMe := newTestSKU("Standard_D4ds_v6", "D4ds_v6", map[string]string{
+		"EphemeralOSDiskSupported":           "True",
+		"SupportedEphemeralOSDiskPlacements": "NvmeDisk,CacheDisk",
+		"DiskControllerTypes":                "SCSI,NVMe",
+		"NvmeDiskSizeInMiB":                  "51200",
+		"NvmeSizePerDiskInMiB":               "51200",
+		"CachedDiskBytes":                    "107374182400",
+		"MaxResourceVolumeMB":                "0",
+	})
+	d4sv5 := newTestSKU("Standard_D4s_v5", "D4s_v5", map[string]string{
+		"EphemeralOSDiskSupported": "False",
+		"MaxResourceVolumeMB":      "0",
+	})
+	for _, tc := range []struct {
+		sku               *skewer.SKU
+		osDiskSizeGB      int64
+		expectedPlacement *armcompute.DiffDiskPlacement
+	}{
+		{d4dsv6, 128, lo.ToPtr(armcompute.DiffDiskPlacementNvmeDisk)},
+		{d4dsv6, 236, lo.ToPtr(armcompute.DiffDiskPlacementNvmeDisk)},
+		{d4dsv6, 237, nil},
+		// the cache disk performs better, the temp disk is larger
+		{d4dsv5, 100, lo.ToPtr(armcompute.DiffDiskPlacementCacheDisk)},
+		{d4dsv5, 128, lo.ToPtr(armcompute.DiffDiskPlacementResourceDisk)},
+		{d4dsv5, 200, nil},
+		// the NVMe disk performs better, the cache disk is larger
+		{smallNVMe, 50, lo.ToPtr(armcompute.DiffDiskPlacementNvmeDisk)},
+		{smallNVMe, 100, lo.ToPtr(armcompute.DiffDiskPlacementCacheDisk)},
+		{smallNVMe, 108, nil},
+		{d4sv5, 30, nil},
+		{nil, 30, nil},
+	} {
+		placement := FindEphemeralPlacement(tc.sku, tc.osDiskSizeGB)
+		if !reflect.DeepEqual(placement, tc.expectedPlacement) {
+			t.Errorf("FindEphemeralPlacement(%s, %d) = %v, expected %v", lo.FromPtr(lo.FromPtr(tc.sku).Name), tc.osDiskSizeGB, lo.FromPtr(placement), lo.FromPtr(tc.expectedPlacement))
+		}
+	}
+
+	// the maximum size is the one of the largest placement, even if another performs better
+	for _, tc := range []struct {
+		sku               *skewer.SKU
+		expectedSizeGB    int64
+		expectedPlacement *armcompute.DiffDiskPlacement
+	}{
+		{d4dsv6, 236, lo.ToPtr(armcompute.DiffDiskPlacementNvmeDisk)},
+		{d4dsv5, 161, lo.ToPtr(armcompute.DiffDiskPlacementResourceDisk)},
+		{smallNVMe, 107, lo.ToPtr(armcompute.DiffDiskPlacementCacheDisk)},
+		{d4sv5, 0, nil},
+	} {
+		sizeGB, placement := FindMaxEphemeralSizeGBAndPlacement(tc.sku)
+		if sizeGB != tc.expectedSizeGB || !reflect.DeepEqual(placement, tc.expectedPlacement) {
+			t.Errorf("FindMaxEphemeralSizeGBAndPlacement(%s) = (%d, %v), expected (%d, %v)", lo.FromPtr(tc.sku.Name),
+				sizeGB, lo.FromPtr(placement), tc.expectedSizeGB, lo.FromPtr(tc.expectedPlacement))
+		}
+	}
+}
+
+func TestSeriesRetirement(t *testing.T) {
+	now := time.Date(2026, time.April, 1, 0, 0, 0, 0, time.UTC)
+	ctx := options.ToContext(context.Background(), &options.Options{
+		VMSeriesRetirementWarningMonths: 6,
+		VMSeriesRetirementOverrides:     map[string]string{"standardDSv2Family": "2026-06-30", "StandardNVSv4Family": "2099-01-01"},
+	})
+	newFamilySKU := func(name, family string) *skewer.SKU {
+		sku := newTestSKU(name, strings.TrimPrefix(name, "Standard_"), nil)
+		sku.Family = lo.ToPtr(family)
+		return sku
+	}
+	for _, tc := range []struct {
+		sku              *skewer.SKU
+		expectedRetired  bool
+		expectedRetiring bool
+	}{
+		// generated retirement table
+		{newFamilySKU("Standard_NC6", "standardNCFamily"), true, true},
+		{newFamilySKU("Standard_NV12s_v3", "standardNVSv3Family"), false, true},
+		{newFamilySKU("Standard_L8s_v2", "standardLSv2Family"), false, false},
+		// overrides, matched case-insensitively
+		{newFamilySKU("Standard_DS2_v2", "standardDSv2Family"), false, true},
+		{newFamilySKU("Standard_NV8as_v4", "standardNVSv4Family"), false, false},
+		// not retiring
+		{newFamilySKU("Standard_D2s_v5", "standardDSv5Family"), false, false},
+	} {
+		if actual := isRetired(ctx, tc.sku, now); actual != tc.expectedRetired {
+			t.Errorf("isRetired(%s) = %t, expected %t", tc.sku.GetName(), actual, tc.expectedRetired)
+		}
+		if _, actual := IsSeriesRetiring(ctx, tc.sku, now); actual != tc.expectedRetiring {
+			t.Errorf("IsSeriesRetiring(%s) = %t, expected %t", tc.sku.GetName(), actual, tc.expectedRetiring)
+		}
+	}
+}
+
+func TestCapabilityDefaults(t *testing.T) {
+	if architecture := skuArchitecture(newTestSKU("Standard_D2s_v3", "D2s_v3", nil)); architecture != defaultArchitecture {
+		t.Errorf("expected SKUs without an architecture to default to %s, got %s", defaultArchitecture, architecture)
+	}
+	if architecture := skuArchitecture(newTestSKU("Standard_D2ps_v5", "D2ps_v5", map[string]string{skewer.CapabilityCPUArchitectureType: "Arm64"})); architecture != "Arm64" {
+		t.Errorf("expected the architecture of the SKU, got %s", architecture)
+	}
+
+	requirements := scheduling.NewRequirements(scheduling.NewRequirement(v1beta1.LabelSKUHyperVGeneration, corev1.NodeSelectorOpDoesNotExist))
+	setRequirementsHyperVGeneration(requirements, newTestSKU("Standard_D2s_v3", "D2s_v3", nil))
+	if values := requirements.Get(v1beta1.LabelSKUHyperVGeneration).Values(); len(values) != 1 || values[0] != v1beta1.HyperVGenerationV1 {
+		t.Errorf("expected SKUs without Hyper-V generations to default to %s, got %v", v1beta1.HyperVGenerationV1, values)
+	}
+}
+
+func TestStaleData(t *testing.T) {
+	pricingProvider := pricing.NewProvider(&auth.Environment{Cloud: cloud.AzurePublic}, nil, "eastus", pricing.DefaultUpdatePeriod)
+	p := &DefaultProvider{pricingProvider: pricingProvider}
+	skus := &subscriptionSKUs{included: map[string]*skewer.SKU{"Standard_D2s_v3": newTestSKU("Standard_D2s_v3", "D2s_v3", nil)}, fetched: time.Now()}
+
+	if stale := p.staleData(options.ToContext(context.Background(), &options.Options{}), skus); stale.IsStale() {
+		t.Errorf("expected no stale data without strict data freshness, got %+v", stale)
+	}
+
+	ctx := options.ToContext(context.Background(), &options.Options{StrictDataFreshness: time.Hour})
+	// the spot prices are still the static ones
+	if err := pricingProvider.UpdateOnDemandPricing(ctx, map[string]float64{"Standard_D2s_v3": 0.1}); err != nil {
+		t.Fatalf("updating on-demand pricing, %s", err)
+	}
+	stale := p.staleData(ctx, skus)
+	if stale.offering("Standard_D2s_v3", karpv1.CapacityTypeOnDemand) || !stale.offering("Standard_D2s_v3", karpv1.CapacityTypeSpot) {
+		t.Errorf("expected only the spot offering to be stale, got %+v", stale)
+	}
+	if skusRefreshDue(ctx, skus) {
+		t.Errorf("expected fresh SKUs not to be refreshed")
+	}
+
+	skus.fetched = time.Now().Add(-2 * time.Hour)
+	stale = p.staleData(ctx, skus)
+	if !stale.SKUs || !stale.offering("Standard_D2s_v3", karpv1.CapacityTypeOnDemand) {
+		t.Errorf("expected all offerings to be stale with stale SKUs, got %+v", stale)
+	}
+	if !skusRefreshDue(ctx, skus) {
+		t.Errorf("expected stale SKUs to be refreshed")
+	}
+	skus.refreshAttempted = time.Now()
+	if skusRefreshDue(ctx, skus) {
+		t.Errorf("expected the refresh of stale SKUs to back off after an attempt")
+	}
+}
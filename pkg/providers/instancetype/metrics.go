@@ -0,0 +1,63 @@
+/*
+Portions Copyright (c) Microsoft Corporation.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package instancetype
+
+import (
+	metrics "github.com/Azure/karpenter-provider-azure/pkg/metrics"
+	"github.com/prometheus/client_golang/prometheus"
+	crmetrics "sigs.k8s.io/controller-runtime/pkg/metrics"
+)
+
+const (
+	instanceTypeSubsystem = "instance_type"
+)
+
+var (
+	// NodePoolRetiringSeriesOnlyMetric is 1 for nodepools whose requirements can only be satisfied by instance types
+	// of VM series within the retirement warning period, and 0 otherwise.
+	//
+	// STABILITY: ALPHA - This metric may change or be removed without notice.
+	NodePoolRetiringSeriesOnlyMetric = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: metrics.Namespace,
+			Subsystem: instanceTypeSubsystem,
+			Name:      "nodepool_retiring_series_only",
+			Help:      "Whether the requirements of a nodepool can only be satisfied by instance types of VM series that are about to be retired.",
+		},
+		[]string{metrics.NodePoolLabel},
+	)
+	// SKUMissingCapabilityMetric counts the SKUs excluded for missing a capability instance types can't be computed
+	// without, each time the SKUs are discovered.
+	//
+	// STABILITY: ALPHA - This metric may change or be removed without notice.
+	SKUMissingCapabilityMetric = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: metrics.Namespace,
+			Subsystem: instanceTypeSubsystem,
+			Name:      "sku_missing_capability_total",
+			Help:      "Number of times a SKU was excluded for missing a required capability, counted each time the SKUs are discovered.",
+		},
+		[]string{metrics.SizeLabel, metrics.CapabilityLabel},
+	)
+)
+
+func init() {
+	crmetrics.Registry.MustRegister(
+		NodePoolRetiringSeriesOnlyMetric,
+		SKUMissingCapabilityMetric,
+	)
+}
@@ -0,0 +1,216 @@
+/*
+Portions Copyright (c) Microsoft Corporation.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package instancetype
+
+import (
+	"strings"
+
+	"github.com/Azure/skewer"
+)
+
+// networkBandwidthCapability is consulted for SKUs missing from skuNetworkBandwidthMbps,
+// so newer sizes can be labeled if the resource SKUs API reports their bandwidth.
+const networkBandwidthCapability = "MaxNetworkBandwidthMbps"
+
+// skuNetworkBandwidthMbps is the expected network bandwidth, in Mbps, as documented
+// for each VM size at https://learn.microsoft.com/azure/virtual-machines/sizes.
+// Keys are lowercase; use NetworkBandwidthMbps for lookups.
+var skuNetworkBandwidthMbps = func() map[string]int64 {
+	table := map[string]int64{
+		"Standard_A1_v2":           250,
+		"Standard_A2_v2":           500,
+		"Standard_A4_v2":           1000,
+		"Standard_A8_v2":           2000,
+		"Standard_A2m_v2":          500,
+		"Standard_A4m_v2":          1000,
+		"Standard_A8m_v2":          2000,
+		"Standard_D1_v2":           750,
+		"Standard_D2_v2":           1500,
+		"Standard_D3_v2":           3000,
+		"Standard_D4_v2":           6000,
+		"Standard_D5_v2":           12000,
+		"Standard_D11_v2":          1500,
+		"Standard_D12_v2":          3000,
+		"Standard_D13_v2":          6000,
+		"Standard_D14_v2":          12000,
+		"Standard_D15_v2":          25000,
+		"Standard_DS1_v2":          750,
+		"Standard_DS2_v2":          1500,
+		"Standard_DS3_v2":          3000,
+		"Standard_DS4_v2":          6000,
+		"Standard_DS5_v2":          12000,
+		"Standard_DS11_v2":         1500,
+		"Standard_DS12_v2":         3000,
+		"Standard_DS13_v2":         6000,
+		"Standard_DS14_v2":         12000,
+		"Standard_DS15_v2":         25000,
+		"Standard_F2s_v2":          875,
+		"Standard_F4s_v2":          1750,
+		"Standard_F8s_v2":          3500,
+		"Standard_F16s_v2":         7000,
+		"Standard_F32s_v2":         14000,
+		"Standard_F48s_v2":         21000,
+		"Standard_F64s_v2":         28000,
+		"Standard_F72s_v2":         30000,
+		"Standard_D2_v3":           1000,
+		"Standard_D4_v3":           2000,
+		"Standard_D8_v3":           4000,
+		"Standard_D16_v3":          8000,
+		"Standard_D32_v3":          16000,
+		"Standard_D48_v3":          24000,
+		"Standard_D64_v3":          30000,
+		"Standard_D2s_v3":          1000,
+		"Standard_D4s_v3":          2000,
+		"Standard_D8s_v3":          4000,
+		"Standard_D16s_v3":         8000,
+		"Standard_D32s_v3":         16000,
+		"Standard_D48s_v3":         24000,
+		"Standard_D64s_v3":         30000,
+		"Standard_E2_v3":           1000,
+		"Standard_E4_v3":           2000,
+		"Standard_E8_v3":           4000,
+		"Standard_E16_v3":          8000,
+		"Standard_E20_v3":          10000,
+		"Standard_E32_v3":          16000,
+		"Standard_E48_v3":          24000,
+		"Standard_E64_v3":          30000,
+		"Standard_E2s_v3":          1000,
+		"Standard_E4s_v3":          2000,
+		"Standard_E8s_v3":          4000,
+		"Standard_E16s_v3":         8000,
+		"Standard_E20s_v3":         10000,
+		"Standard_E32s_v3":         16000,
+		"Standard_E48s_v3":         24000,
+		"Standard_E64s_v3":         30000,
+		"Standard_D2_v4":           5000,
+		"Standard_D4_v4":           10000,
+		"Standard_D8_v4":           12500,
+		"Standard_D16_v4":          12500,
+		"Standard_D32_v4":          16000,
+		"Standard_D48_v4":          24000,
+		"Standard_D64_v4":          30000,
+		"Standard_D2d_v4":          5000,
+		"Standard_D4d_v4":          10000,
+		"Standard_D8d_v4":          12500,
+		"Standard_D16d_v4":         12500,
+		"Standard_D32d_v4":         16000,
+		"Standard_D48d_v4":         24000,
+		"Standard_D64d_v4":         30000,
+		"Standard_D2ds_v4":         5000,
+		"Standard_D4ds_v4":         10000,
+		"Standard_D8ds_v4":         12500,
+		"Standard_D16ds_v4":        12500,
+		"Standard_D32ds_v4":        16000,
+		"Standard_D48ds_v4":        24000,
+		"Standard_D64ds_v4":        30000,
+		"Standard_D2s_v4":          5000,
+		"Standard_D4s_v4":          10000,
+		"Standard_D8s_v4":          12500,
+		"Standard_D16s_v4":         12500,
+		"Standard_D32s_v4":         16000,
+		"Standard_D48s_v4":         24000,
+		"Standard_D64s_v4":         30000,
+		"Standard_D2_v5":           12500,
+		"Standard_D4_v5":           12500,
+		"Standard_D8_v5":           12500,
+		"Standard_D16_v5":          12500,
+		"Standard_D32_v5":          16000,
+		"Standard_D48_v5":          24000,
+		"Standard_D64_v5":          30000,
+		"Standard_D96_v5":          35000,
+		"Standard_D2d_v5":          12500,
+		"Standard_D4d_v5":          12500,
+		"Standard_D8d_v5":          12500,
+		"Standard_D16d_v5":         12500,
+		"Standard_D32d_v5":         16000,
+		"Standard_D48d_v5":         24000,
+		"Standard_D64d_v5":         30000,
+		"Standard_D96d_v5":         35000,
+		"Standard_D2ds_v5":         12500,
+		"Standard_D4ds_v5":         12500,
+		"Standard_D8ds_v5":         12500,
+		"Standard_D16ds_v5":        12500,
+		"Standard_D32ds_v5":        16000,
+		"Standard_D48ds_v5":        24000,
+		"Standard_D64ds_v5":        30000,
+		"Standard_D96ds_v5":        35000,
+		"Standard_D2s_v5":          12500,
+		"Standard_D4s_v5":          12500,
+		"Standard_D8s_v5":          12500,
+		"Standard_D16s_v5":         12500,
+		"Standard_D32s_v5":         16000,
+		"Standard_D48s_v5":         24000,
+		"Standard_D64s_v5":         30000,
+		"Standard_D96s_v5":         35000,
+		"Standard_E2_v5":           12500,
+		"Standard_E4_v5":           12500,
+		"Standard_E8_v5":           12500,
+		"Standard_E16_v5":          12500,
+		"Standard_E20_v5":          12500,
+		"Standard_E32_v5":          16000,
+		"Standard_E48_v5":          24000,
+		"Standard_E64_v5":          30000,
+		"Standard_E96_v5":          35000,
+		"Standard_E2d_v5":          12500,
+		"Standard_E4d_v5":          12500,
+		"Standard_E8d_v5":          12500,
+		"Standard_E16d_v5":         12500,
+		"Standard_E20d_v5":         12500,
+		"Standard_E32d_v5":         16000,
+		"Standard_E48d_v5":         24000,
+		"Standard_E64d_v5":         30000,
+		"Standard_E96d_v5":         35000,
+		"Standard_E2ds_v5":         12500,
+		"Standard_E4ds_v5":         12500,
+		"Standard_E8ds_v5":         12500,
+		"Standard_E16ds_v5":        12500,
+		"Standard_E20ds_v5":        12500,
+		"Standard_E32ds_v5":        16000,
+		"Standard_E48ds_v5":        24000,
+		"Standard_E64ds_v5":        30000,
+		"Standard_E96ds_v5":        35000,
+		"Standard_E2s_v5":          12500,
+		"Standard_E4s_v5":          12500,
+		"Standard_E8s_v5":          12500,
+		"Standard_E16s_v5":         12500,
+		"Standard_E20s_v5":         12500,
+		"Standard_E32s_v5":         16000,
+		"Standard_E48s_v5":         24000,
+		"Standard_E64s_v5":         30000,
+		"Standard_E96s_v5":         35000,
+		"Standard_NC24ads_A100_v4": 20000,
+		"Standard_NC48ads_A100_v4": 40000,
+		"Standard_NC96ads_A100_v4": 80000,
+	}
+	lowered := make(map[string]int64, len(table))
+	for name, mbps := range table {
+		lowered[strings.ToLower(name)] = mbps
+	}
+	return lowered
+}()
+
+// NetworkBandwidthMbps returns the expected network bandwidth of the SKU in Mbps,
+// and false when it is unknown.
+func NetworkBandwidthMbps(sku *skewer.SKU) (int64, bool) {
+	if mbps, ok := skuNetworkBandwidthMbps[strings.ToLower(sku.GetName())]; ok {
+		return mbps, true
+	}
+	if mbps, err := sku.GetCapabilityIntegerQuantity(networkBandwidthCapability); err == nil && mbps > 0 {
+		return mbps, true
+	}
+	return 0, false
+}
@@ -0,0 +1,60 @@
+/*
+Portions Copyright (c) Microsoft Corporation.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package instancetype
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/Azure/skewer"
+
+	"github.com/Azure/karpenter-provider-azure/pkg/operator/options"
+)
+
+// SeriesRetirementDate returns the retirement date of the VM series of the SKU, from the vm-series-retirement-overrides
+// option or else the retirement table generated from the Azure announcements (see hack/code/retirement_gen).
+// Series are identified by their SKU family, e.g. standardNCSv3Family.
+func SeriesRetirementDate(ctx context.Context, sku *skewer.SKU) (time.Time, bool) {
+	family := sku.GetFamilyName()
+	for overriddenFamily, date := range options.FromContext(ctx).VMSeriesRetirementOverrides {
+		if strings.EqualFold(overriddenFamily, family) {
+			retirement, err := time.Parse(time.DateOnly, date) // validated with the options
+			return retirement, err == nil
+		}
+	}
+	retirement, ok := initialSeriesRetirements[strings.ToLower(family)]
+	return retirement, ok
+}
+
+// isRetired returns whether the VM series of the SKU is retired, in which case creates start failing even though
+// the SKU may still be listed.
+func isRetired(ctx context.Context, sku *skewer.SKU, now time.Time) bool {
+	retirement, ok := SeriesRetirementDate(ctx, sku)
+	return ok && !now.Before(retirement)
+}
+
+// IsSeriesRetiring returns whether the VM series of the SKU retires within the vm-series-retirement-warning-months
+// option, along with its retirement date.
+func IsSeriesRetiring(ctx context.Context, sku *skewer.SKU, now time.Time) (time.Time, bool) {
+	months := options.FromContext(ctx).VMSeriesRetirementWarningMonths
+	retirement, ok := SeriesRetirementDate(ctx, sku)
+	if !ok || months == 0 {
+		return retirement, false
+	}
+	return retirement, now.AddDate(0, months, 0).After(retirement)
+}
@@ -0,0 +1,201 @@
+/*
+Portions Copyright (c) Microsoft Corporation.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package instancetype
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/Azure/skewer"
+	"github.com/samber/lo"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/util/sets"
+	karpv1 "sigs.k8s.io/karpenter/pkg/apis/v1"
+	"sigs.k8s.io/karpenter/pkg/cloudprovider"
+	"sigs.k8s.io/karpenter/pkg/scheduling"
+
+	"github.com/Azure/karpenter-provider-azure/pkg/apis/v1beta1"
+	"github.com/Azure/karpenter-provider-azure/pkg/providers/instance/offerings"
+)
+
+// ExclusionReason is the category of the reason an instance type isn't offered
+type ExclusionReason string
+
+const (
+	// ExclusionReasonDenied is for SKUs denied by the provider or its options, e.g. of retired VM series, or
+	// restricted for the subscription
+	ExclusionReasonDenied ExclusionReason = "Denied"
+	// ExclusionReasonCapabilityMismatch is for SKUs lacking a capability the provider or the nodeclass requires
+	ExclusionReasonCapabilityMismatch ExclusionReason = "CapabilityMismatch"
+	// ExclusionReasonNodePoolRequirements is for instance types incompatible with the requirements of the nodepool
+	ExclusionReasonNodePoolRequirements ExclusionReason = "NodePoolRequirements"
+	// ExclusionReasonUnavailableOffering is for instance types without an available offering
+	ExclusionReasonUnavailableOffering ExclusionReason = "UnavailableOffering"
+	// ExclusionReasonQuota is for instance types whose offerings are all unavailable for reaching the subscription quota
+	ExclusionReasonQuota ExclusionReason = "Quota"
+)
+
+const (
+	// NoPriceReason is the reason of offerings unavailable for lack of a price
+	NoPriceReason = "NoPrice"
+	// StaleDataReason is the reason of offerings unavailable as their pricing or SKU data is older than the
+	// strict-data-freshness option
+	StaleDataReason = "StaleData"
+	// UnavailableReason is the reason of offerings marked unavailable without one
+	UnavailableReason = "Unavailable"
+)
+
+// Exclusion is why an instance type isn't offered
+type Exclusion struct {
+	Reason  ExclusionReason `json:"reason"`
+	Message string          `json:"message"`
+}
+
+// exclusions maps the names of the excluded SKUs to why they are
+type exclusions map[string]Exclusion
+
+func (e exclusions) exclude(name string, reason ExclusionReason, format string, args ...any) {
+	e[name] = Exclusion{Reason: reason, Message: fmt.Sprintf(format, args...)}
+}
+
+// subscriptionSKUs are the SKUs of a subscription instance types are computed from, and the SKUs excluded from them
+type subscriptionSKUs struct {
+	included map[string]*skewer.SKU
+	excluded exclusions
+	// fetched is when the SKUs were fetched, and refreshAttempted when their last refresh was attempted, for the
+	// strict-data-freshness option
+	fetched          time.Time
+	refreshAttempted time.Time
+	// zones are the zones of the region the SKUs are offered in
+	zones sets.Set[string]
+}
+
+// nodeClassInstanceTypes are the instance types of a nodeclass, and the SKUs excluded from them
+type nodeClassInstanceTypes struct {
+	included []*cloudprovider.InstanceType
+	excluded exclusions
+}
+
+// OfferingsSnapshot is the snapshot of the offerings of a nodepool, for capacity planning
+type OfferingsSnapshot struct {
+	NodePool  string    `json:"nodePool"`
+	NodeClass string    `json:"nodeClass"`
+	Time      time.Time `json:"time"`
+	// InstanceTypes are the instance types the nodepool can launch, with at least one available offering
+	InstanceTypes []InstanceTypeSnapshot `json:"instanceTypes"`
+	// Excluded are the SKUs of the region the nodepool can't launch, and why
+	Excluded []ExcludedInstanceType `json:"excluded"`
+}
+
+type InstanceTypeSnapshot struct {
+	Name      string             `json:"name"`
+	Offerings []OfferingSnapshot `json:"offerings"`
+}
+
+type OfferingSnapshot struct {
+	Zone         string  `json:"zone"`
+	CapacityType string  `json:"capacityType"`
+	Price        float64 `json:"price"`
+	Available    bool    `json:"available"`
+	// UnavailableReason is why the offering is unavailable, e.g. NoPrice or SubscriptionQuotaReached
+	UnavailableReason string `json:"unavailableReason,omitempty"`
+}
+
+type ExcludedInstanceType struct {
+	Name string `json:"name"`
+	Exclusion
+}
+
+// Snapshot returns the offerings of the instance types of the nodeclass the nodepool can launch, and why the other
+// SKUs of the region are excluded: by the provider or its options, for lacking a capability, for the nodepool
+// requirements, or for their offerings being unavailable.
+func (p *DefaultProvider) Snapshot(ctx context.Context, nodePool *karpv1.NodePool, nodeClass *v1beta1.AKSNodeClass) (*OfferingsSnapshot, error) {
+	instanceTypes, err := p.list(ctx, nodeClass)
+	if err != nil {
+		return nil, err
+	}
+	skus, err := p.getInstanceTypes(ctx, lo.FromPtr(nodeClass.Spec.SubscriptionID))
+	if err != nil {
+		return nil, err
+	}
+
+	snapshot := &OfferingsSnapshot{
+		NodePool:      nodePool.Name,
+		NodeClass:     nodeClass.Name,
+		Time:          time.Now(),
+		InstanceTypes: []InstanceTypeSnapshot{},
+		Excluded:      []ExcludedInstanceType{},
+	}
+	stale := p.staleData(ctx, skus)
+	excluded := maps.Clone(instanceTypes.excluded)
+	requirements := scheduling.NewNodeSelectorRequirementsWithMinValues(nodePool.Spec.Template.Spec.Requirements...)
+	for _, it := range instanceTypes.included {
+		// the zones and capacity types of the instance type requirements are those of its available offerings, so the
+		// offerings are checked separately, for them to be reported unavailable rather than incompatible
+		if err := withoutOfferingRequirements(it.Requirements).Compatible(requirements, scheduling.AllowUndefinedWellKnownLabels); err != nil {
+			excluded.exclude(it.Name, ExclusionReasonNodePoolRequirements, "%s", err)
+			continue
+		}
+		compatible := it.Offerings.Compatible(requirements)
+		if len(compatible) == 0 {
+			excluded.exclude(it.Name, ExclusionReasonNodePoolRequirements, "no offering compatible with the nodepool requirements")
+			continue
+		}
+		offeringSnapshots := lo.Map(compatible, func(o *cloudprovider.Offering, _ int) OfferingSnapshot {
+			offering := OfferingSnapshot{Zone: o.Zone(), CapacityType: o.CapacityType(), Price: o.Price, Available: o.Available}
+			if sku, ok := skus.included[it.Name]; ok && !o.Available {
+				offering.UnavailableReason = p.offeringUnavailableReason(sku, o.Zone(), o.CapacityType(), lo.FromPtr(nodeClass.Spec.SubscriptionID), stale)
+			}
+			return offering
+		})
+		if exclusion := unavailableOfferingsExclusion(offeringSnapshots); exclusion != nil {
+			excluded[it.Name] = *exclusion
+			continue
+		}
+		snapshot.InstanceTypes = append(snapshot.InstanceTypes, InstanceTypeSnapshot{Name: it.Name, Offerings: offeringSnapshots})
+	}
+	for name, exclusion := range excluded {
+		snapshot.Excluded = append(snapshot.Excluded, ExcludedInstanceType{Name: name, Exclusion: exclusion})
+	}
+	sort.Slice(snapshot.InstanceTypes, func(i, j int) bool { return snapshot.InstanceTypes[i].Name < snapshot.InstanceTypes[j].Name })
+	sort.Slice(snapshot.Excluded, func(i, j int) bool { return snapshot.Excluded[i].Name < snapshot.Excluded[j].Name })
+	return snapshot, nil
+}
+
+// withoutOfferingRequirements returns the requirements of an instance type but those of its offerings
+func withoutOfferingRequirements(requirements scheduling.Requirements) scheduling.Requirements {
+	return scheduling.NewRequirements(lo.Reject(requirements.Values(), func(requirement *scheduling.Requirement, _ int) bool {
+		return requirement.Key == corev1.LabelTopologyZone || requirement.Key == karpv1.CapacityTypeLabelKey
+	})...)
+}
+
+// unavailableOfferingsExclusion returns why an instance type is excluded when none of its offerings is available, or
+// nil if one is. Instance types are excluded for quota when all their offerings are unavailable for it.
+func unavailableOfferingsExclusion(offeringSnapshots []OfferingSnapshot) *Exclusion {
+	if lo.SomeBy(offeringSnapshots, func(o OfferingSnapshot) bool { return o.Available }) {
+		return nil
+	}
+	reasons := sets.New(lo.Map(offeringSnapshots, func(o OfferingSnapshot, _ int) string { return o.UnavailableReason })...)
+	if reasons.Len() == 1 && reasons.Has(offerings.SubscriptionQuotaReachedReason) {
+		return &Exclusion{Reason: ExclusionReasonQuota, Message: "subscription quota reached for all offerings"}
+	}
+	return &Exclusion{Reason: ExclusionReasonUnavailableOffering, Message: fmt.Sprintf("no available offering: %s", strings.Join(sets.List(reasons), ", "))}
+}
@@ -19,6 +19,7 @@ package instancetype_test
 import (
 	"bytes"
 	"context"
+	"encoding/base64"
 	"fmt"
 	"io"
 	"net/http"
@@ -50,6 +51,7 @@ import (
 	"sigs.k8s.io/karpenter/pkg/controllers/provisioning"
 	"sigs.k8s.io/karpenter/pkg/controllers/state"
 	"sigs.k8s.io/karpenter/pkg/events"
+	"sigs.k8s.io/karpenter/pkg/scheduling"
 	coretest "sigs.k8s.io/karpenter/pkg/test"
 	. "sigs.k8s.io/karpenter/pkg/test/expectations"
 	"sigs.k8s.io/karpenter/pkg/test/v1alpha1"
@@ -624,9 +626,50 @@ var _ = Describe("InstanceType Provider", func() {
 		It("should not include confidential SKUs", func() {
 			Expect(instanceTypes).ShouldNot(ContainElement(WithTransform(getName, Equal("Standard_DC8s_v3"))))
 		})
+		It("should only include confidential VM sizes for the ConfidentialVM security type", func() {
+			nodeClass.Spec.ImageFamily = lo.ToPtr(v1beta1.Ubuntu2204ImageFamily)
+			nodeClass.Spec.Security = &v1beta1.Security{SecurityType: lo.ToPtr(v1beta1.SecurityTypeConfidentialVM)}
+			instanceTypes, err = azureEnv.InstanceTypesProvider.List(ctx, nodeClass)
+			Expect(err).ToNot(HaveOccurred())
+			for _, instanceType := range instanceTypes {
+				Expect(instanceType.Requirements.Get(v1beta1.LabelSKUConfidentialComputing).Any()).ToNot(Equal(v1beta1.ConfidentialComputingNone))
+			}
+			// application enclave (SGX) sizes aren't confidential VM sizes
+			Expect(instanceTypes).ShouldNot(ContainElement(WithTransform(getName, Equal("Standard_DC8s_v3"))))
+			Expect(instanceTypes).ShouldNot(ContainElement(WithTransform(getName, Equal("Standard_D2_v2"))))
+		})
+		It("should only include Gen2 VM sizes supporting trusted launch for the TrustedLaunch security type", func() {
+			nodeClass.Spec.Security = &v1beta1.Security{SecurityType: lo.ToPtr(v1beta1.SecurityTypeTrustedLaunch)}
+			instanceTypes, err = azureEnv.InstanceTypesProvider.List(ctx, nodeClass)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(instanceTypes).ToNot(BeEmpty())
+			for _, instanceType := range instanceTypes {
+				Expect(instanceType.Requirements.Get(v1beta1.LabelSKUHyperVGeneration).Has(v1beta1.HyperVGenerationV2)).To(BeTrue())
+			}
+			// Gen1 only
+			Expect(instanceTypes).ShouldNot(ContainElement(WithTransform(getName, Equal("Standard_D2_v2"))))
+			// trusted launch disabled
+			Expect(instanceTypes).ShouldNot(ContainElement(WithTransform(getName, Equal("Standard_D16plds_v5"))))
+		})
 		It("should not include SKUs without compatible image", func() {
 			Expect(instanceTypes).ShouldNot(ContainElement(WithTransform(getName, Equal("Standard_D2as_v6"))))
 		})
+		It("should not include SKUs of retired VM series", func() {
+			// Standard_NC6s_v3 (standardNCSv3Family) is retired per the generated retirement table
+			Expect(instanceTypes).ShouldNot(ContainElement(WithTransform(getName, Equal("Standard_NC6s_v3"))))
+
+			azureEnv.Reset()
+			ctx = options.ToContext(ctx, test.Options(test.OptionsFields{
+				VMSeriesRetirementOverrides: map[string]string{
+					"standardNCSv3Family": "2099-01-01",
+					"standardDv2Family":   time.Now().AddDate(0, 0, -1).Format(time.DateOnly),
+				},
+			}))
+			instanceTypes, err = azureEnv.InstanceTypesProvider.List(ctx, nodeClass)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(instanceTypes).Should(ContainElement(WithTransform(getName, Equal("Standard_NC6s_v3"))))
+			Expect(instanceTypes).ShouldNot(ContainElement(WithTransform(getName, Equal("Standard_D2_v2"))))
+		})
 	})
 	Context("Filtering GPU SKUs ProviderList(AzureLinux)", func() {
 		var instanceTypes corecloudprovider.InstanceTypes
@@ -712,17 +755,15 @@ var _ = Describe("InstanceType Provider", func() {
 		Context("FindMaxEphemeralSizeGBAndPlacement(sku *skewer.SKU) -> diskSizeGB, *placement", func() {
 			// B20ms:
 			// NvmeDiskSizeInMiB == 0
-			// CacheDiskBytes == 32212254720 -> 32.21225472 GB .. we should select this as the ephemeral disk size
-			// placement == CacheDisk
-			// MaxResourceVolumeMB == 163840 MiB -> 171.80 GB,
+			// CacheDiskBytes == 32212254720 -> 32.21225472 GB
+			// MaxResourceVolumeMB == 163840 MiB -> 171.80 GB, this is the largest so we select it, placement == ResourceDisk
 			// Standard_D128ds_v6:
 			// NvmeDiskSizeInMiB == 7208960 -> 7559.142441 GB // SupportedEphemeralOSDiskPlacments == NvmeDisk
 			// and this is greater than 0, so we select 7559, placement == NvmeDisk
 			// Standard_D16plds_v5:
 			// NvmeDiskSizeInMiB == 0
-			// CacheDiskBytes == 429496729600 -> 429.4967296, this is greater than zero, so we select this as the ephemeral disk size
-			// placement == CacheDisk and size == 429.4967296 GB
-			// MaxResourceVolumeMB == 614400 MiB
+			// CacheDiskBytes == 429496729600 -> 429.4967296 GB
+			// MaxResourceVolumeMB == 614400 MiB -> 644.24 GB, this is the largest so we select it, placement == ResourceDisk
 			// Standard_D2as_v6: -> EphemeralOSDiskSupported is false, it should return 0 and nil for placement
 			// Standard_D128ds_v6:
 			// NvmeDiskSizeInMiB == 7208960 -> 7559.142441 GB // SupportedEphemeralOSDiskPlacments == NvmeDisk
@@ -730,24 +771,25 @@ var _ = Describe("InstanceType Provider", func() {
 			// Standard_NC24ads_A100_v4:
 			// {Name: lo.ToPtr("SupportedEphemeralOSDiskPlacements"), Value: lo.ToPtr("ResourceDisk,CacheDisk")},
 			// NvmeDiskSizeInMiB == 915527 -> 959.99964 GB  but no SupportedEphemeralOSDiskPlacments == NvmeDisk so we move to cache disk
-			// CacheDiskBytes == 274877906944 -> 274.877906944 GB so we select cache disk + 274
-			// MaxResourceVolumeMB == 65536 MiB
+			// CacheDiskBytes == 274877906944 -> 274.877906944 GB
+			// MaxResourceVolumeMB == 65536 MiB -> 68.72 GB, so the cache disk is the largest, we select cache disk + 274
 			// Standard_D64s_v3:
 			// NvmeDiskSizeInMiB == 0
-			// CacheDiskBytes == 1717986918400 -> 1717.9869184 GB, this is greater than zero, so we select this as the ephemeral disk size
+			// CacheDiskBytes == 1717986918400 -> 1717.9869184 GB, this is the largest so we select it
 			// placement == CacheDisk and size == 1717 GB
+			// MaxResourceVolumeMB == 524288 MiB -> 549.76 GB
 			// Standard_A0
 			// NvmeDiskSizeInMiB == 0
 			// CacheDiskBytes == 0, this is zero
 			// MaxResourceVolumeMB == 20480 Mib -> 21.474836 GB. Note that this sku doesnt support ephemeral os disk
-			DescribeTable("should return the max ephemeral disk size in GB for a given instance type",
+			DescribeTable("should return the max ephemeral disk size in GB for a given instance type, with its placement",
 				func(sku *skewer.SKU, expectedSize int64, expectedPlacement *armcompute.DiffDiskPlacement) {
 					sizeGB, placement := instancetype.FindMaxEphemeralSizeGBAndPlacement(sku)
 					Expect(sizeGB).To(Equal(expectedSize))
 					Expect(placement).To(Equal(expectedPlacement))
-				}, Entry("Standard_B20ms", SkewerSKU("Standard_B20ms"), int64(32), lo.ToPtr(armcompute.DiffDiskPlacementCacheDisk)),
+				}, Entry("Standard_B20ms", SkewerSKU("Standard_B20ms"), int64(171), lo.ToPtr(armcompute.DiffDiskPlacementResourceDisk)),
 				Entry("Standard_D128ds_v6", SkewerSKU("Standard_D128ds_v6"), int64(7559), lo.ToPtr(armcompute.DiffDiskPlacementNvmeDisk)),
-				Entry("Standard_D16plds_v5", SkewerSKU("Standard_D16plds_v5"), int64(429), lo.ToPtr(armcompute.DiffDiskPlacementCacheDisk)),
+				Entry("Standard_D16plds_v5", SkewerSKU("Standard_D16plds_v5"), int64(644), lo.ToPtr(armcompute.DiffDiskPlacementResourceDisk)),
 				Entry("Standard_D2as_v6", SkewerSKU("Standard_D2as_v6"), int64(0), nil), // does not support ephemeral
 				Entry("Standard_NC24ads_A100_v4", SkewerSKU("Standard_NC24ads_A100_v4"), int64(274), lo.ToPtr(armcompute.DiffDiskPlacementCacheDisk)),
 				Entry("Standard_D64s_v3", SkewerSKU("Standard_D64s_v3"), int64(1717), lo.ToPtr(armcompute.DiffDiskPlacementCacheDisk)),
@@ -954,6 +996,9 @@ var _ = Describe("InstanceType Provider", func() {
 
 			Expect(vm.Properties.StorageProfile.OSDisk.DiffDiskSettings).NotTo(BeNil())
 			Expect(lo.FromPtr(vm.Properties.StorageProfile.OSDisk.DiffDiskSettings.Placement)).To(Equal(armcompute.DiffDiskPlacementNvmeDisk))
+			customData, err := base64.StdEncoding.DecodeString(lo.FromPtr(vm.Properties.OSProfile.CustomData))
+			Expect(err).ToNot(HaveOccurred())
+			Expect(string(customData)).To(ContainSubstring(v1beta1.AKSLabelEphemeralOSDiskPlacement + "=NvmeDisk"))
 		})
 	})
 
@@ -1148,6 +1193,60 @@ var _ = Describe("InstanceType Provider", func() {
 		})
 	})
 
+	Context("Zonal Spot Pricing", func() {
+		It("should price a spot consolidation candidate with the spot price of its zone", func() {
+			fakeZone3 := utils.MakeZone(fake.Region, "3")
+			azureEnv.PricingProvider.UpdateZonalSpotPricing(ctx, map[string]map[string]float64{
+				"Standard_D2_v2": {fakeZone1: 0.5, fakeZone3: 0.1},
+			})
+			ExpectApplied(ctx, env.Client, nodeClass)
+			instanceTypes, err := azureEnv.InstanceTypesProvider.List(ctx, nodeClass)
+			Expect(err).ToNot(HaveOccurred())
+			instanceType, ok := lo.Find(instanceTypes, func(it *corecloudprovider.InstanceType) bool { return it.Name == "Standard_D2_v2" })
+			Expect(ok).To(BeTrue())
+
+			// consolidation prices a candidate with the offering matching the zone and capacity type labels of its NodeClaim
+			candidateOfferings := instanceType.Offerings.Compatible(scheduling.NewLabelRequirements(map[string]string{
+				karpv1.CapacityTypeLabelKey: karpv1.CapacityTypeSpot,
+				v1.LabelTopologyZone:        fakeZone1,
+			}))
+			Expect(candidateOfferings).To(HaveLen(1))
+			Expect(candidateOfferings.Cheapest().Price).To(BeNumerically("==", 0.5))
+
+			// so the spot replacement in zone 3 is recognized as cheaper
+			replacement := instanceType.Offerings.Available().Compatible(scheduling.NewRequirements(
+				scheduling.NewRequirement(karpv1.CapacityTypeLabelKey, v1.NodeSelectorOpIn, karpv1.CapacityTypeSpot),
+			)).Cheapest()
+			Expect(replacement.Requirements.Get(v1.LabelTopologyZone).Any()).To(Equal(fakeZone3))
+			Expect(replacement.Price).To(BeNumerically("<", candidateOfferings.Cheapest().Price))
+		})
+		It("should price the spot offerings with the zonal spot prices fetched by the pricing update", func() {
+			azureEnv.AzureResourceGraphAPI.ZonalSpotPrices.Set(&map[string]map[string]float64{
+				"Standard_D2_v2": {"1": 0.05},
+			})
+			updateStart := time.Now()
+			pricingCtx, stopPricing := context.WithCancel(ctx)
+			defer stopPricing()
+			go func() {
+				defer GinkgoRecover()
+				Expect(azureEnv.PricingProvider.Start(pricingCtx)).To(Succeed())
+			}()
+			Eventually(azureEnv.PricingProvider.ZonalSpotLastUpdated).Should(BeTemporally(">", updateStart))
+
+			ExpectApplied(ctx, env.Client, nodeClass)
+			instanceTypes, err := azureEnv.InstanceTypesProvider.List(ctx, nodeClass)
+			Expect(err).ToNot(HaveOccurred())
+			instanceType, ok := lo.Find(instanceTypes, func(it *corecloudprovider.InstanceType) bool { return it.Name == "Standard_D2_v2" })
+			Expect(ok).To(BeTrue())
+			offerings := instanceType.Offerings.Compatible(scheduling.NewLabelRequirements(map[string]string{
+				karpv1.CapacityTypeLabelKey: karpv1.CapacityTypeSpot,
+				v1.LabelTopologyZone:        fakeZone1,
+			}))
+			Expect(offerings).To(HaveLen(1))
+			Expect(offerings.Cheapest().Price).To(BeNumerically("==", 0.05))
+		})
+	})
+
 	Context("Unavailable Offerings", func() {
 		It("should not allocate a vm in a zone marked as unavailable", func() {
 			azureEnv.UnavailableOfferingsCache.MarkUnavailable(ctx, "ZonalAllocationFailure", "Standard_D2_v2", fakeZone1, karpv1.CapacityTypeSpot)
@@ -1508,13 +1607,19 @@ var _ = Describe("InstanceType Provider", func() {
 				v1beta1.LabelSKUFamily:                    "N",
 				v1beta1.LabelSKUVersion:                   "4",
 				v1beta1.LabelSKUStorageEphemeralOSMaxSize: "429",
+				v1beta1.LabelSKUStorageLocalProtocol:      "nvme",
+				v1beta1.LabelSKUStorageLocalCount:         "1",
+				v1beta1.LabelSKUStorageLocalSize:          "959",
 				v1beta1.LabelSKUAcceleratedNetworking:     "true",
+				v1beta1.LabelSKUNetworkingBandwidth:       "20000",
 				v1beta1.LabelSKUStoragePremiumCapable:     "true",
 				v1beta1.LabelSKUGPUName:                   "A100",
 				v1beta1.LabelSKUGPUManufacturer:           "nvidia",
 				v1beta1.LabelSKUGPUCount:                  "1",
+				v1beta1.LabelSKUConfidentialComputing:     v1beta1.ConfidentialComputingNone,
 				v1beta1.LabelSKUCPU:                       "24",
 				v1beta1.LabelSKUMemory:                    "8192",
+				v1beta1.LabelImageFamily:                  v1beta1.Ubuntu2204ImageFamily,
 				// AKS domain.
 				v1beta1.AKSLabelCPU:    "24",
 				v1beta1.AKSLabelMemory: "8192",
@@ -1542,6 +1647,24 @@ var _ = Describe("InstanceType Provider", func() {
 				ExpectScheduled(ctx, env.Client, pod)
 			}
 		})
+		It("should select instance types by expected network bandwidth", func() {
+			nodePool.Spec.Template.Spec.Requirements = append(nodePool.Spec.Template.Spec.Requirements, karpv1.NodeSelectorRequirementWithMinValues{
+				NodeSelectorRequirement: v1.NodeSelectorRequirement{
+					Key:      v1beta1.LabelSKUNetworkingBandwidth,
+					Operator: v1.NodeSelectorOpGt,
+					Values:   []string{"15999"},
+				},
+			})
+			ExpectApplied(ctx, env.Client, nodePool, nodeClass)
+			pod := coretest.UnschedulablePod()
+			ExpectProvisioned(ctx, env.Client, cluster, cloudProvider, coreProvisioner, pod)
+			ExpectScheduled(ctx, env.Client, pod)
+
+			vm := azureEnv.VirtualMachinesAPI.VirtualMachineCreateOrUpdateBehavior.CalledWithInput.Pop().VM
+			mbps, known := instancetype.NetworkBandwidthMbps(&skewer.SKU{Name: (*string)(vm.Properties.HardwareProfile.VMSize)})
+			Expect(known).To(BeTrue())
+			Expect(mbps).To(BeNumerically(">=", 16000))
+		})
 		It("should propagate all values to requirements from skewer", func() {
 			var gpuNode *corecloudprovider.InstanceType
 			var normalNode *corecloudprovider.InstanceType
@@ -1567,6 +1690,15 @@ var _ = Describe("InstanceType Provider", func() {
 			Expect(normalNode.Requirements.Get(v1beta1.LabelSKUVersion).Values()).To(ConsistOf("2"))
 			Expect(gpuNode.Requirements.Get(v1beta1.LabelSKUVersion).Values()).To(ConsistOf("4"))
 
+			Expect(normalNode.Requirements.Get(v1beta1.LabelSKUNetworkingBandwidth).Values()).To(ConsistOf("1500"))
+			Expect(gpuNode.Requirements.Get(v1beta1.LabelSKUNetworkingBandwidth).Values()).To(ConsistOf("20000"))
+
+			// Local disks: Standard_D2_v2 has a SCSI temp disk, Standard_NC24ads_A100_v4 an NVMe disk
+			Expect(normalNode.Requirements.Get(v1beta1.LabelSKUStorageLocalProtocol).Values()).To(ConsistOf(v1beta1.StorageLocalProtocolSCSI))
+			Expect(gpuNode.Requirements.Get(v1beta1.LabelSKUStorageLocalProtocol).Values()).To(ConsistOf(v1beta1.StorageLocalProtocolNVMe))
+			Expect(gpuNode.Requirements.Get(v1beta1.LabelSKUStorageLocalCount).Values()).To(ConsistOf("1"))
+			Expect(gpuNode.Requirements.Get(v1beta1.LabelSKUStorageLocalSize).Values()).To(ConsistOf("959"))
+
 			// CPU (requirements and capacity)
 			Expect(normalNode.Requirements.Get(v1beta1.LabelSKUCPU).Values()).To(ConsistOf("2"))
 			Expect(normalNode.Capacity.Cpu().Value()).To(Equal(int64(2)))
@@ -1596,7 +1728,7 @@ var _ = Describe("InstanceType Provider", func() {
 				UseSIG: lo.ToPtr(true),
 			})
 			ctx = options.ToContext(ctx)
-			statusController := status.NewController(env.Client, azureEnv.KubernetesVersionProvider, azureEnv.ImageProvider, env.KubernetesInterface, azureEnv.SubnetsAPI)
+			statusController := status.NewController(env.Client, azureEnv.KubernetesVersionProvider, azureEnv.ImageProvider, env.KubernetesInterface, azureEnv.AZClient, azureEnv.InstanceTypesProvider, events.NewRecorder(&record.FakeRecorder{}), fakeClock)
 
 			ExpectApplied(ctx, env.Client, nodePool, nodeClass)
 			ExpectObjectReconciled(ctx, env.Client, statusController, nodeClass)
@@ -1645,7 +1777,7 @@ var _ = Describe("InstanceType Provider", func() {
 				UseSIG: lo.ToPtr(true),
 			})
 			ctx = options.ToContext(ctx)
-			statusController := status.NewController(env.Client, azureEnv.KubernetesVersionProvider, azureEnv.ImageProvider, env.KubernetesInterface, azureEnv.SubnetsAPI)
+			statusController := status.NewController(env.Client, azureEnv.KubernetesVersionProvider, azureEnv.ImageProvider, env.KubernetesInterface, azureEnv.AZClient, azureEnv.InstanceTypesProvider, events.NewRecorder(&record.FakeRecorder{}), fakeClock)
 
 			nodeClass.Spec.ImageFamily = lo.ToPtr(imageFamily)
 			coretest.ReplaceRequirements(nodePool, karpv1.NodeSelectorRequirementWithMinValues{
@@ -1679,7 +1811,7 @@ var _ = Describe("InstanceType Provider", func() {
 		)
 		DescribeTable("should select the right image for a given instance type",
 			func(instanceType string, imageFamily string, expectedImageDefinition string, expectedGalleryURL string) {
-				statusController := status.NewController(env.Client, azureEnv.KubernetesVersionProvider, azureEnv.ImageProvider, env.KubernetesInterface, azureEnv.SubnetsAPI)
+				statusController := status.NewController(env.Client, azureEnv.KubernetesVersionProvider, azureEnv.ImageProvider, env.KubernetesInterface, azureEnv.AZClient, azureEnv.InstanceTypesProvider, events.NewRecorder(&record.FakeRecorder{}), fakeClock)
 				if expectUseAzureLinux3 && expectedImageDefinition == azureLinuxGen2ArmImageDefinition {
 					Skip("AzureLinux3 ARM64 VHD is not available in CIG")
 				}
@@ -2035,6 +2167,10 @@ var _ = Describe("InstanceType Provider", func() {
 			Expect(vm.Zones).To(BeEmpty())
 		})
 		It("should support provisioning non-zonal instance types in zonal regions", func() {
+			// Standard_NC6s_v3 is the only non-zonal instance type of the test SKUs, but its series is retired
+			ctx = options.ToContext(ctx, test.Options(test.OptionsFields{
+				VMSeriesRetirementOverrides: map[string]string{"standardNCSv3Family": "2099-01-01"},
+			}))
 			coretest.ReplaceRequirements(nodePool, karpv1.NodeSelectorRequirementWithMinValues{
 				NodeSelectorRequirement: v1.NodeSelectorRequirement{
 					Key:      v1.LabelInstanceTypeStable,
@@ -2083,7 +2219,7 @@ var _ = Describe("InstanceType Provider", func() {
 
 		It("should return error when instance type resolution fails", func() {
 			// Create and set up the status controller
-			statusController := status.NewController(env.Client, azureEnv.KubernetesVersionProvider, azureEnv.ImageProvider, env.KubernetesInterface, azureEnv.SubnetsAPI)
+			statusController := status.NewController(env.Client, azureEnv.KubernetesVersionProvider, azureEnv.ImageProvider, env.KubernetesInterface, azureEnv.AZClient, azureEnv.InstanceTypesProvider, events.NewRecorder(&record.FakeRecorder{}), fakeClock)
 
 			// Set NodeClass to Ready
 			nodeClass.StatusConditions().SetTrue(karpv1.ConditionTypeLaunched)
@@ -0,0 +1,98 @@
+/*
+Portions Copyright (c) Microsoft Corporation.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package instancetype_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/cloud"
+	//nolint SA1019 - deprecated package
+	"github.com/Azure/azure-sdk-for-go/services/compute/mgmt/2022-08-01/compute"
+	"github.com/patrickmn/go-cache"
+	"github.com/samber/lo"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/util/sets"
+
+	"github.com/Azure/karpenter-provider-azure/pkg/apis/v1beta1"
+	"github.com/Azure/karpenter-provider-azure/pkg/auth"
+	kcache "github.com/Azure/karpenter-provider-azure/pkg/cache"
+	"github.com/Azure/karpenter-provider-azure/pkg/fake"
+	"github.com/Azure/karpenter-provider-azure/pkg/operator/options"
+	"github.com/Azure/karpenter-provider-azure/pkg/providers/instancetype"
+	"github.com/Azure/karpenter-provider-azure/pkg/providers/pricing"
+	"github.com/Azure/karpenter-provider-azure/pkg/utils"
+)
+
+// withoutZone returns a copy of the SKUs that aren't offered in the zone
+func withoutZone(skus []compute.ResourceSku, zone string) []compute.ResourceSku {
+	return lo.Map(skus, func(sku compute.ResourceSku, _ int) compute.ResourceSku {
+		sku.LocationInfo = lo.ToPtr(lo.Map(lo.FromPtr(sku.LocationInfo), func(info compute.ResourceSkuLocationInfo, _ int) compute.ResourceSkuLocationInfo {
+			info.Zones = lo.ToPtr(lo.Without(lo.FromPtr(info.Zones), zone))
+			return info
+		}))
+		return sku
+	})
+}
+
+// offeredZones returns the zones of the offerings of the instance types
+func offeredZones(t *testing.T, ctx context.Context, p *instancetype.DefaultProvider, nodeClass *v1beta1.AKSNodeClass) sets.Set[string] {
+	instanceTypes, err := p.List(ctx, nodeClass)
+	if err != nil {
+		t.Fatalf("listing instance types: %s", err)
+	}
+	zones := sets.New[string]()
+	for _, it := range instanceTypes {
+		for _, offering := range it.Offerings {
+			zones.Insert(offering.Requirements.Get(corev1.LabelTopologyZone).Any())
+		}
+	}
+	return zones.Delete("")
+}
+
+func TestZoneAddedToRegion(t *testing.T) {
+	nodeClass := &v1beta1.AKSNodeClass{Spec: v1beta1.AKSNodeClassSpec{MaxPods: lo.ToPtr[int32](30), OSDiskSizeGB: lo.ToPtr[int32](128)}}
+	pricingProvider := pricing.NewProvider(&auth.Environment{Cloud: cloud.AzureGovernment}, &fake.PricingAPI{}, fake.Region, pricing.DefaultUpdatePeriod)
+	newZone := utils.MakeZone(fake.Region, "3")
+
+	// the region has no zone 3 yet
+	skus := skuClient(withoutZone(fake.ResourceSkus[fake.Region], "3"))
+	p := instancetype.NewDefaultProvider(fake.Region, cache.New(time.Hour, time.Hour), &skus, pricingProvider, kcache.NewUnavailableOfferings(), nil)
+	ctx := options.ToContext(context.Background(), &options.Options{VMMemoryOverheadPercent: 0.075, NetworkPlugin: "azure"})
+	zones := lo.Must(p.Zones(ctx, nodeClass))
+	if zones.Has(newZone) || zones.Len() == 0 {
+		t.Fatalf("expected the zones of the region without %s, got %v", newZone, sets.List(zones))
+	}
+	if offeredZones(t, ctx, p, nodeClass).Has(newZone) {
+		t.Fatalf("expected %s not to be offered before it's added to the region", newZone)
+	}
+
+	// the zone is added to the region, and discovered once the SKUs are fetched again
+	skus = skuClient(fake.ResourceSkus[fake.Region])
+	if lo.Must(p.Zones(ctx, nodeClass)).Has(newZone) {
+		t.Errorf("expected the SKUs not to be fetched again with the zones update period disabled")
+	}
+	ctx = options.ToContext(context.Background(), &options.Options{VMMemoryOverheadPercent: 0.075, NetworkPlugin: "azure",
+		CacheConfig: options.CacheConfig{ZonesUpdatePeriod: time.Nanosecond}})
+	if zones := lo.Must(p.Zones(ctx, nodeClass)); !zones.Has(newZone) {
+		t.Errorf("expected %s to be discovered, got %v", newZone, sets.List(zones))
+	}
+	if !offeredZones(t, ctx, p, nodeClass).Has(newZone) {
+		t.Errorf("expected %s to be offered without a restart", newZone)
+	}
+}
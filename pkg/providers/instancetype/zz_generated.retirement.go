@@ -0,0 +1,43 @@
+//go:build !ignore_autogenerated
+
+/*
+Portions Copyright (c) Microsoft Corporation.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package instancetype
+
+import "time"
+
+// generated at 2026-10-12T08:00:00Z
+
+// initialSeriesRetirements are the retirement dates of VM series announced by Azure, keyed by lowercase SKU family
+var initialSeriesRetirements = map[string]time.Time{
+	"basicafamily":          time.Date(2024, time.August, 31, 0, 0, 0, 0, time.UTC),
+	"standarda0_a7family":   time.Date(2024, time.August, 31, 0, 0, 0, 0, time.UTC),
+	"standarda8_a11family":  time.Date(2021, time.March, 1, 0, 0, 0, 0, time.UTC),
+	"standardhbsfamily":     time.Date(2024, time.September, 30, 0, 0, 0, 0, time.UTC),
+	"standardhfamily":       time.Date(2024, time.September, 28, 0, 0, 0, 0, time.UTC),
+	"standardhpromofamily":  time.Date(2024, time.September, 28, 0, 0, 0, 0, time.UTC),
+	"standardlsv2family":    time.Date(2028, time.November, 15, 0, 0, 0, 0, time.UTC),
+	"standardncfamily":      time.Date(2023, time.September, 6, 0, 0, 0, 0, time.UTC),
+	"standardncpromofamily": time.Date(2023, time.September, 6, 0, 0, 0, 0, time.UTC),
+	"standardncsv2family":   time.Date(2023, time.September, 6, 0, 0, 0, 0, time.UTC),
+	"standardncsv3family":   time.Date(2025, time.September, 30, 0, 0, 0, 0, time.UTC),
+	"standardndsfamily":     time.Date(2023, time.September, 6, 0, 0, 0, 0, time.UTC),
+	"standardnvfamily":      time.Date(2023, time.September, 6, 0, 0, 0, 0, time.UTC),
+	"standardnvpromofamily": time.Date(2023, time.September, 6, 0, 0, 0, 0, time.UTC),
+	"standardnvsv3family":   time.Date(2026, time.September, 30, 0, 0, 0, 0, time.UTC),
+	"standardnvsv4family":   time.Date(2026, time.September, 30, 0, 0, 0, 0, time.UTC),
+}
@@ -19,6 +19,7 @@ package kubernetesversion
 import (
 	"context"
 	"strings"
+	"sync/atomic"
 
 	"github.com/patrickmn/go-cache"
 	"k8s.io/client-go/kubernetes"
@@ -32,12 +33,17 @@ const (
 
 type KubernetesVersionProvider interface {
 	KubeServerVersion(ctx context.Context) (string, error)
+	// Refresh discovers the version of the API server regardless of the cached one, and caches it. It returns whether the
+	// version changed since it was last discovered, e.g. as the control plane was upgraded.
+	Refresh(ctx context.Context) (bool, error)
 }
 
 type kubernetesVersionProvider struct {
 	kubernetesInterface    kubernetes.Interface
 	kubernetesVersionCache *cache.Cache
 	cm                     *pretty.ChangeMonitor
+	// discovered is the version last discovered, kept after the cached version expires
+	discovered atomic.Pointer[string]
 }
 
 func NewKubernetesVersionProvider(kubernetesInterface kubernetes.Interface, kubernetesVersionCache *cache.Cache) *kubernetesVersionProvider {
@@ -52,14 +58,27 @@ func (p *kubernetesVersionProvider) KubeServerVersion(ctx context.Context) (stri
 	if version, ok := p.kubernetesVersionCache.Get(kubernetesVersionCacheKey); ok {
 		return version.(string), nil
 	}
+	version, _, err := p.discover(ctx)
+	return version, err
+}
+
+func (p *kubernetesVersionProvider) Refresh(ctx context.Context) (bool, error) {
+	_, changed, err := p.discover(ctx)
+	return changed, err
+}
+
+// discover discovers the version of the API server and caches it, returning whether it changed since it was last
+// discovered
+func (p *kubernetesVersionProvider) discover(ctx context.Context) (string, bool, error) {
 	serverVersion, err := p.kubernetesInterface.Discovery().ServerVersion()
 	if err != nil {
-		return "", err
+		return "", false, err
 	}
 	version := strings.TrimPrefix(serverVersion.GitVersion, "v") // v1.24.9 -> 1.24.9
 	p.kubernetesVersionCache.SetDefault(kubernetesVersionCacheKey, version)
 	if p.cm.HasChanged("kubernetes-version", version) {
 		log.FromContext(ctx).V(1).Info("discovered kubernetes version", "kubernetesVersion", version)
 	}
-	return version, nil
+	previous := p.discovered.Swap(&version)
+	return version, previous != nil && *previous != version, nil
 }
@@ -0,0 +1,59 @@
+/*
+Portions Copyright (c) Microsoft Corporation.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package kubernetesversion
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/patrickmn/go-cache"
+	"github.com/stretchr/testify/assert"
+	"k8s.io/apimachinery/pkg/version"
+	fakediscovery "k8s.io/client-go/discovery/fake"
+	kubernetesfake "k8s.io/client-go/kubernetes/fake"
+)
+
+func TestRefresh(t *testing.T) {
+	ctx := context.Background()
+	kubernetesInterface := kubernetesfake.NewClientset()
+	discovery := kubernetesInterface.Discovery().(*fakediscovery.FakeDiscovery)
+	discovery.FakedServerVersion = &version.Info{GitVersion: "v1.31.2"}
+	p := NewKubernetesVersionProvider(kubernetesInterface, cache.New(time.Hour, time.Hour))
+
+	// the first version discovered isn't a change
+	changed, err := p.Refresh(ctx)
+	assert.NoError(t, err)
+	assert.False(t, changed)
+
+	// the control plane is upgraded while the version is cached
+	discovery.FakedServerVersion = &version.Info{GitVersion: "v1.32.0"}
+	kubernetesVersion, err := p.KubeServerVersion(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, "1.31.2", kubernetesVersion)
+
+	changed, err = p.Refresh(ctx)
+	assert.NoError(t, err)
+	assert.True(t, changed)
+	kubernetesVersion, err = p.KubeServerVersion(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, "1.32.0", kubernetesVersion)
+
+	changed, err = p.Refresh(ctx)
+	assert.NoError(t, err)
+	assert.False(t, changed)
+}
@@ -18,14 +18,19 @@ package launchtemplate
 
 import (
 	"context"
-	"sigs.k8s.io/controller-runtime/pkg/log"
+	"encoding/base64"
+	"fmt"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/compute/armcompute/v7"
+	"github.com/Azure/karpenter-provider-azure/pkg/providers/bootstraptoken"
 	"github.com/Azure/karpenter-provider-azure/pkg/providers/imagefamily"
+	"github.com/Azure/karpenter-provider-azure/pkg/providers/imagefamily/bootstrap"
 	"github.com/Azure/karpenter-provider-azure/pkg/providers/launchtemplate/parameters"
 	"github.com/Azure/karpenter-provider-azure/pkg/utils"
+	"github.com/Azure/karpenter-provider-azure/pkg/utils/redact"
 	"github.com/blang/semver/v4"
 	"github.com/samber/lo"
 	v1 "k8s.io/api/core/v1"
@@ -50,15 +55,20 @@ var (
 type Template struct {
 	ScriptlessCustomData      string
 	ImageID                   string
+	ImagePlan                 *armcompute.PurchasePlan
+	ImageTenantID             string
 	SubnetID                  string
 	Tags                      map[string]*string
 	CustomScriptsCustomData   string
 	CustomScriptsCSE          string
+	ScriptlessCSE             string
 	IsWindows                 bool
 	StorageProfileDiskType    string
 	StorageProfileIsEphemeral bool
 	StorageProfilePlacement   armcompute.DiffDiskPlacement
 	StorageProfileSizeGB      int32
+	// BootstrapToken is the kubelet TLS bootstrap token the template was rendered with, to redact from its renderings
+	BootstrapToken redact.Secret
 }
 
 type Provider struct {
@@ -74,12 +84,14 @@ type Provider struct {
 	location                string
 	vnetGUID                string
 	provisionMode           string
+	bootstrapTokenProvider  bootstraptoken.Provider
 }
 
 // TODO: add caching of launch templates
 
 func NewProvider(_ context.Context, imageFamily imagefamily.Resolver, imageProvider imagefamily.NodeImageProvider, caBundle *string, clusterEndpoint string,
 	tenantID, subscriptionID, clusterResourceGroup string, kubeletIdentityClientID, resourceGroup, location, vnetGUID, provisionMode string,
+	bootstrapTokenProvider bootstraptoken.Provider,
 ) *Provider {
 	return &Provider{
 		imageFamily:             imageFamily,
@@ -94,6 +106,7 @@ func NewProvider(_ context.Context, imageFamily imagefamily.Resolver, imageProvi
 		location:                location,
 		vnetGUID:                vnetGUID,
 		provisionMode:           provisionMode,
+		bootstrapTokenProvider:  bootstrapTokenProvider,
 	}
 }
 
@@ -104,6 +117,21 @@ func (p *Provider) GetTemplate(
 	instanceType *cloudprovider.InstanceType,
 	additionalLabels map[string]string,
 ) (*Template, error) {
+	templateParameters, err := p.ResolveParameters(ctx, nodeClass, nodeClaim, instanceType, additionalLabels)
+	if err != nil {
+		return nil, err
+	}
+	return p.RenderTemplate(ctx, nodeClass, nodeClaim, templateParameters)
+}
+
+// ResolveParameters resolves the parameters of the launch template, e.g. its image, ahead of rendering its customData
+func (p *Provider) ResolveParameters(
+	ctx context.Context,
+	nodeClass *v1beta1.AKSNodeClass,
+	nodeClaim *karpv1.NodeClaim,
+	instanceType *cloudprovider.InstanceType,
+	additionalLabels map[string]string,
+) (*parameters.Parameters, error) {
 	staticParameters, err := p.getStaticParameters(ctx, instanceType, nodeClass, lo.Assign(nodeClaim.Labels, additionalLabels))
 	if err != nil {
 		return nil, err
@@ -115,10 +143,17 @@ func (p *Provider) GetTemplate(
 		return nil, err
 	}
 	staticParameters.KubernetesVersion = kubernetesVersion
-	templateParameters, err := p.imageFamily.Resolve(ctx, nodeClass, nodeClaim, instanceType, staticParameters)
-	if err != nil {
-		return nil, err
-	}
+	return p.imageFamily.Resolve(ctx, nodeClass, nodeClaim, instanceType, staticParameters)
+}
+
+// RenderTemplate renders the launch template of the resolved parameters, along with its customData, which the node
+// bootstrapping API renders in the bootstrapping client provision mode
+func (p *Provider) RenderTemplate(
+	ctx context.Context,
+	nodeClass *v1beta1.AKSNodeClass,
+	nodeClaim *karpv1.NodeClaim,
+	templateParameters *parameters.Parameters,
+) (*Template, error) {
 	launchTemplate, err := p.createLaunchTemplate(ctx, templateParameters)
 	if err != nil {
 		return nil, err
@@ -129,6 +164,12 @@ func (p *Provider) GetTemplate(
 	return launchTemplate, nil
 }
 
+// SubnetID returns the subnet the nodes of the nodeclass are launched in: the subnet of the nodeclass, or else the
+// cluster's
+func SubnetID(ctx context.Context, nodeClass *v1beta1.AKSNodeClass) string {
+	return lo.Ternary(nodeClass.Spec.VNETSubnetID != nil, lo.FromPtr(nodeClass.Spec.VNETSubnetID), options.FromContext(ctx).SubnetID)
+}
+
 func (p *Provider) getStaticParameters(
 	ctx context.Context,
 	instanceType *cloudprovider.InstanceType,
@@ -140,7 +181,7 @@ func (p *Provider) getStaticParameters(
 		arch = karpv1.ArchitectureArm64
 	}
 
-	subnetID := lo.Ternary(nodeClass.Spec.VNETSubnetID != nil, lo.FromPtr(nodeClass.Spec.VNETSubnetID), options.FromContext(ctx).SubnetID)
+	subnetID := SubnetID(ctx, nodeClass)
 
 	if isAzureCNIOverlay(ctx) {
 		// TODO: make conditional on pod subnet
@@ -166,6 +207,17 @@ func (p *Provider) getStaticParameters(
 		labels[dataplaneLabel] = consts.NetworkDataplaneCilium
 	}
 
+	// The token is looked up at launch time so that rotations are picked up by new nodes
+	bootstrapToken, err := p.bootstrapTokenProvider.Token(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("getting kubelet bootstrap token, %w", err)
+	}
+
+	customCATrustCertificates, err := getCustomCATrustCertificates(nodeClass)
+	if err != nil {
+		return nil, err
+	}
+
 	return &parameters.StaticParameters{
 		ClusterName:                    options.FromContext(ctx).ClusterName,
 		ClusterEndpoint:                p.clusterEndpoint,
@@ -178,19 +230,49 @@ func (p *Provider) getStaticParameters(
 		GPUImageSHA:                    utils.GetAKSGPUImageSHA(instanceType.Name),
 		TenantID:                       p.tenantID,
 		SubscriptionID:                 p.subscriptionID,
-		KubeletIdentityClientID:        p.kubeletIdentityClientID,
+		KubeletIdentityClientID:        utils.GetKubeletIdentityClientID(nodeClass, p.kubeletIdentityClientID),
 		ResourceGroup:                  p.resourceGroup,
 		Location:                       p.location,
 		ClusterID:                      options.FromContext(ctx).ClusterID,
 		APIServerName:                  options.FromContext(ctx).GetAPIServerName(),
-		KubeletClientTLSBootstrapToken: options.FromContext(ctx).KubeletClientTLSBootstrapToken,
+		KubeletClientTLSBootstrapToken: redact.Secret(bootstrapToken),
 		NetworkPlugin:                  getAgentbakerNetworkPlugin(ctx),
 		NetworkPolicy:                  options.FromContext(ctx).NetworkPolicy,
 		SubnetID:                       subnetID,
 		ClusterResourceGroup:           p.clusterResourceGroup,
+		CustomCATrustCertificates:      customCATrustCertificates,
+		// the root filesystem must be at least the ephemeral storage the instance type advertises
+		RootFilesystemMinBytes: instanceType.Capacity.StorageEphemeral().Value(),
+		GPUDriverReadyTimeout:  gpuDriverReadyTimeout(ctx, instanceType),
 	}, nil
 }
 
+// gpuDriverReadyTimeout returns how long GPU nodes wait for their GPU driver to be ready, tainted. Only the bootstrap of
+// the aksscriptless provision mode reports the GPU driver ready, so GPU nodes aren't tainted in other provision modes.
+func gpuDriverReadyTimeout(ctx context.Context, instanceType *cloudprovider.InstanceType) time.Duration {
+	if !utils.IsNvidiaEnabledSKU(instanceType.Name) || options.FromContext(ctx).ProvisionMode != consts.ProvisionModeAKSScriptless {
+		return 0
+	}
+	return options.FromContext(ctx).GPUDriverReadyTimeout
+}
+
+// getCustomCATrustCertificates decodes the custom CA trust certificates of the nodeclass into PEM, which is how the node
+// writes them into /opt/certs
+func getCustomCATrustCertificates(nodeClass *v1beta1.AKSNodeClass) ([]string, error) {
+	if nodeClass.Spec.Security == nil {
+		return nil, nil
+	}
+	certificates := make([]string, 0, len(nodeClass.Spec.Security.CustomCATrustCertificates))
+	for i, encoded := range nodeClass.Spec.Security.CustomCATrustCertificates {
+		certificate, err := base64.StdEncoding.DecodeString(encoded)
+		if err != nil {
+			return nil, fmt.Errorf("decoding custom CA trust certificate %d, %w", i, err)
+		}
+		certificates = append(certificates, string(certificate))
+	}
+	return certificates, nil
+}
+
 func getAgentbakerNetworkPlugin(ctx context.Context) string {
 	if isAzureCNIOverlay(ctx) || isCiliumNodeSubnet(ctx) || isNetworkPluginNone(ctx) {
 		return consts.NetworkPluginNone
@@ -213,18 +295,21 @@ func isAzureCNIOverlay(ctx context.Context) bool {
 func (p *Provider) createLaunchTemplate(ctx context.Context, params *parameters.Parameters) (*Template, error) {
 	template := &Template{
 		ImageID:                   params.ImageID,
+		ImagePlan:                 params.ImagePlan,
+		ImageTenantID:             params.ImageTenantID,
 		SubnetID:                  params.SubnetID,
 		IsWindows:                 params.IsWindows,
 		StorageProfileDiskType:    params.StorageProfileDiskType,
 		StorageProfileIsEphemeral: params.StorageProfileIsEphemeral,
 		StorageProfilePlacement:   params.StorageProfilePlacement,
 		StorageProfileSizeGB:      params.StorageProfileSizeGB,
+		BootstrapToken:            params.KubeletClientTLSBootstrapToken,
 	}
 
 	if p.provisionMode == consts.ProvisionModeBootstrappingClient {
 		customData, cse, err := params.CustomScriptsNodeBootstrapping.GetCustomDataAndCSE(ctx)
 		if err != nil {
-			return nil, err
+			return nil, redact.Error(err, string(params.KubeletClientTLSBootstrapToken))
 		}
 		template.CustomScriptsCustomData = customData
 		template.CustomScriptsCSE = cse
@@ -232,9 +317,13 @@ func (p *Provider) createLaunchTemplate(ctx context.Context, params *parameters.
 		// render user data
 		userData, err := params.ScriptlessCustomData.Script()
 		if err != nil {
-			return nil, err
+			return nil, redact.Error(err, string(params.KubeletClientTLSBootstrapToken))
 		}
 		template.ScriptlessCustomData = userData
+		// Windows doesn't run custom data by itself, the CSE runs it
+		if params.IsWindows {
+			template.ScriptlessCSE = bootstrap.WindowsCSECommand
+		}
 	}
 
 	return template, nil
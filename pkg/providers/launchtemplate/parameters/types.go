@@ -17,9 +17,12 @@ limitations under the License.
 package parameters
 
 import (
+	"time"
+
 	"github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/compute/armcompute/v7"
 	"github.com/Azure/karpenter-provider-azure/pkg/providers/imagefamily/bootstrap"
 	"github.com/Azure/karpenter-provider-azure/pkg/providers/imagefamily/customscriptsbootstrap"
+	"github.com/Azure/karpenter-provider-azure/pkg/utils/redact"
 )
 
 // StaticParameters define the static launch template parameters
@@ -39,12 +42,15 @@ type StaticParameters struct {
 	ResourceGroup                  string
 	ClusterID                      string
 	APIServerName                  string
-	KubeletClientTLSBootstrapToken string
+	KubeletClientTLSBootstrapToken redact.Secret
 	NetworkPlugin                  string
 	NetworkPolicy                  string
 	KubernetesVersion              string
 	SubnetID                       string
 	ClusterResourceGroup           string
+	CustomCATrustCertificates      []string
+	RootFilesystemMinBytes         int64
+	GPUDriverReadyTimeout          time.Duration
 
 	Labels map[string]string
 }
@@ -55,6 +61,8 @@ type Parameters struct {
 	ScriptlessCustomData           bootstrap.Bootstrapper
 	CustomScriptsNodeBootstrapping customscriptsbootstrap.Bootstrapper
 	ImageID                        string
+	ImagePlan                      *armcompute.PurchasePlan
+	ImageTenantID                  string
 	StorageProfileDiskType         string
 	StorageProfileIsEphemeral      bool
 	StorageProfilePlacement        armcompute.DiffDiskPlacement
@@ -23,11 +23,24 @@ import (
 
 	"github.com/Azure/karpenter-provider-azure/pkg/apis/v1beta1"
 	"github.com/Azure/karpenter-provider-azure/pkg/operator/options"
+	"github.com/Azure/karpenter-provider-azure/pkg/utils"
 	"github.com/samber/lo"
 )
 
+// The tags identifying the resources (VM, Disk, NIC, etc) created by Karpenter. Azure doesn't allow '/' in tag names,
+// so these use '_' in place of the '/' of the matching labels:
+//   - karpenter.azure.com_cluster: the name of the cluster the resource belongs to
+//   - karpenter.sh_nodepool: the name of the nodepool of the nodeclaim the resource was created for
+//   - karpenter.azure.com_aksnodeclass: the name of the AKSNodeClass of the nodeclaim the resource was created for
+//
+// Listing and garbage collection only consider resources with the nodepool tag, and the cluster tag of this cluster.
+// Garbage collection also requires the garbage collection confirmation tag, if configured, which is applied as well.
 const (
 	KarpenterManagedTagKey = "karpenter.azure.com_cluster"
+	NodeClassTagKey        = "karpenter.azure.com_aksnodeclass"
+	// NodeClaimTagKey records the nodeclaim of resources whose names are shortened, since the nodeclaim name can't be
+	// derived from those
+	NodeClaimTagKey = "karpenter.azure.com_nodeclaim"
 )
 
 var (
@@ -43,6 +56,7 @@ func Tags(
 ) map[string]*string {
 	defaultTags := map[string]string{
 		KarpenterManagedTagKey: options.ClusterName,
+		NodeClassTagKey:        nodeClass.Name,
 	}
 	// Note: Be careful depending on nodeClaim.Labels here, as we assign some additional labels during the creation
 	// of the static parameters for the launch template. Those labels haven't actually been applied to the nodeClaim yet,
@@ -51,6 +65,12 @@ func Tags(
 	if val, ok := nodeClaim.Labels[karpv1.NodePoolLabelKey]; ok {
 		defaultTags[NodePoolTagKey] = val
 	}
+	if utils.IsShortenedResourceName(nodeClaim.Name) {
+		defaultTags[NodeClaimTagKey] = nodeClaim.Name
+	}
+	if key, value, err := options.GetGarbageCollectionConfirmationTag(); err == nil {
+		defaultTags[key] = value
+	}
 
 	// MapEntries first so that karpenter.azure.com_cluster and karpenter.azure.com/cluster collide
 	additionalTags := lo.MapEntries(options.AdditionalTags, mapTags)
@@ -36,6 +36,23 @@ const (
 
 type PricingAPI interface {
 	GetProductsPricePages(context.Context, []*Filter, func(output *ProductsPricePage)) error
+	// ResumeProductsPricePages continues a pagination from the NextPageLink of a PageError
+	ResumeProductsPricePages(ctx context.Context, nextPageLink string, pageHandler func(output *ProductsPricePage)) error
+}
+
+// PageError is returned when fetching a page fails part way through a pagination, after the handler has been
+// called for the preceding pages. NextPageLink is the link of the failed page, from which the pagination can resume.
+type PageError struct {
+	NextPageLink string
+	Err          error
+}
+
+func (e *PageError) Error() string {
+	return fmt.Sprintf("fetching page %s, %s", e.NextPageLink, e.Err)
+}
+
+func (e *PageError) Unwrap() error {
+	return e.Err
 }
 
 type pricingAPI struct {
@@ -65,29 +82,50 @@ func (papi *pricingAPI) GetProductsPricePages(_ context.Context, filters []*Filt
 		nextURL += fmt.Sprintf("&$filter=%s", filterParamsEscaped)
 	}
 
-	for nextURL != "" {
-		res, err := http.Get(nextURL)
-		if err != nil {
-			return err
-		}
-
-		if res.StatusCode != 200 {
-			return fmt.Errorf("got a non-200 status code: %d", res.StatusCode)
-		}
+	return papi.getPages(nextURL, pageHandler)
+}
 
-		resBody, err := io.ReadAll(res.Body)
-		if err != nil {
-			return err
-		}
+func (papi *pricingAPI) ResumeProductsPricePages(_ context.Context, nextPageLink string, pageHandler func(output *ProductsPricePage)) error {
+	if !auth.IsPublic(papi.cloud) {
+		return fmt.Errorf("pricing API is not supported in non-public clouds")
+	}
+	return papi.getPages(nextPageLink, pageHandler)
+}
 
-		page := ProductsPricePage{}
-		err = json.Unmarshal(resBody, &page)
+func (papi *pricingAPI) getPages(nextURL string, pageHandler func(output *ProductsPricePage)) error {
+	for first := true; nextURL != ""; first = false {
+		page, err := getPage(nextURL)
 		if err != nil {
-			return err
+			if first {
+				return err
+			}
+			return &PageError{NextPageLink: nextURL, Err: err}
 		}
-
-		pageHandler(&page)
+		pageHandler(page)
 		nextURL = page.NextPageLink
 	}
 	return nil
 }
+
+func getPage(pageURL string) (*ProductsPricePage, error) {
+	res, err := http.Get(pageURL) // #nosec G107 -- pricing API and its page links
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != 200 {
+		return nil, fmt.Errorf("got a non-200 status code: %d", res.StatusCode)
+	}
+
+	resBody, err := io.ReadAll(res.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	page := &ProductsPricePage{}
+	if err := json.Unmarshal(resBody, page); err != nil {
+		return nil, err
+	}
+	return page, nil
+}
@@ -0,0 +1,32 @@
+/*
+Portions Copyright (c) Microsoft Corporation.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package pricing
+
+import (
+	"strconv"
+
+	"github.com/Azure/karpenter-provider-azure/pkg/apis/v1beta1"
+)
+
+// CostEstimateAnnotations returns the cost estimate annotations of a VM of the SKU and capacity type with the hourly price
+func CostEstimateAnnotations(sku, capacityType string, price float64) map[string]string {
+	return map[string]string{
+		v1beta1.AnnotationEstimatedHourlyCost:             strconv.FormatFloat(price, 'f', -1, 64),
+		v1beta1.AnnotationEstimatedHourlyCostSKU:          sku,
+		v1beta1.AnnotationEstimatedHourlyCostCapacityType: capacityType,
+	}
+}
@@ -0,0 +1,49 @@
+/*
+Portions Copyright (c) Microsoft Corporation.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package pricing
+
+import (
+	metrics "github.com/Azure/karpenter-provider-azure/pkg/metrics"
+	"github.com/prometheus/client_golang/prometheus"
+	crmetrics "sigs.k8s.io/controller-runtime/pkg/metrics"
+)
+
+const (
+	pricingSubsystem = "pricing"
+)
+
+var (
+	// StalePricesMetric is the number of instance types whose price was not updated by the last pricing refresh,
+	// either because the refresh failed or because it failed part way through before fetching their page.
+	//
+	// STABILITY: ALPHA - This metric may change or be removed without notice.
+	StalePricesMetric = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: metrics.Namespace,
+			Subsystem: pricingSubsystem,
+			Name:      "stale_instance_types",
+			Help:      "Number of instance types whose price was not updated by the last pricing refresh.",
+		},
+		[]string{metrics.CapacityTypeLabel},
+	)
+)
+
+func init() {
+	crmetrics.Registry.MustRegister(
+		StalePricesMetric,
+	)
+}
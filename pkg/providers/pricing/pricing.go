@@ -20,21 +20,35 @@ import (
 	"context"
 	"errors"
 	"net/http"
+	"sort"
 	"strings"
 	"sync"
 	"time"
 
+	"github.com/prometheus/client_golang/prometheus"
 	"github.com/samber/lo"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/utils/clock"
 	"sigs.k8s.io/controller-runtime/pkg/log"
+	karpv1 "sigs.k8s.io/karpenter/pkg/apis/v1"
 	"sigs.k8s.io/karpenter/pkg/utils/pretty"
 
 	"github.com/Azure/azure-sdk-for-go/sdk/azcore/cloud"
 	"github.com/Azure/karpenter-provider-azure/pkg/auth"
+	"github.com/Azure/karpenter-provider-azure/pkg/metrics"
 	"github.com/Azure/karpenter-provider-azure/pkg/providers/pricing/client"
 )
 
-// pricingUpdatePeriod is how often we try to update our pricing information after the initial update on startup
-const pricingUpdatePeriod = 12 * time.Hour
+// DefaultUpdatePeriod is how often we try to update our pricing information after the initial update on becoming
+// the leader, unless configured otherwise with the cache-pricing-update-period option
+const DefaultUpdatePeriod = 12 * time.Hour
+
+// pricingRetryAttempts is how many times the remaining pages are retried when a pricing update fails part way
+// through, the first retry being immediate and the following ones backing off by pricingRetryBackoff
+const (
+	pricingRetryAttempts = 3
+	pricingRetryBackoff  = 5 * time.Second
+)
 
 const defaultRegion = "eastus"
 
@@ -45,16 +59,35 @@ const defaultRegion = "eastus"
 // fails, the previous pricing information is retained and used which may be the static initial pricing data if pricing
 // updates never succeed.
 type Provider struct {
-	pricing client.PricingAPI
-	region  string
-	cm      *pretty.ChangeMonitor
+	pricing      client.PricingAPI
+	cloud        cloud.Configuration
+	region       string
+	updatePeriod time.Duration
+	cm           *pretty.ChangeMonitor
+	clock        clock.Clock
 
 	mu                 sync.RWMutex
 	onDemandUpdateTime time.Time
 	onDemandPrices     map[string]float64
 	spotUpdateTime     time.Time
 	spotPrices         map[string]float64
-	done               chan struct{}
+	// onDemandPriceUpdateTimes and spotPriceUpdateTimes are when the price of each instance type was last fetched, as
+	// a refresh that fails part way through only updates the prices fetched before the failure
+	onDemandPriceUpdateTimes map[string]time.Time
+	spotPriceUpdateTimes     map[string]time.Time
+	// zonalSpotPrices are the spot prices of instance types by zone, where they differ from the regional spot price,
+	// keyed by the (lowercase) subscription whose logical zones they are priced in
+	zonalSpotUpdateTime time.Time
+	zonalSpotPrices     map[string]map[string]map[string]float64
+
+	// resourceGraph and subscriptionID are where the zonal spot prices are fetched from, when set with
+	// WithZonalSpotPricing
+	resourceGraph  ResourceGraphAPI
+	subscriptionID string
+	// subscriptionIDs are the other subscriptions than subscriptionID whose zonal spot prices are fetched, and
+	// subscriptionTrigger triggers a fetch when one is tracked, see TrackSubscription
+	subscriptionIDs     sets.Set[string]
+	subscriptionTrigger chan struct{}
 }
 
 type Err struct {
@@ -69,11 +102,10 @@ func NewAPI(cloud cloud.Configuration) client.PricingAPI {
 }
 
 func NewProvider(
-	ctx context.Context,
 	env *auth.Environment,
 	pricing client.PricingAPI,
 	region string,
-	startAsync <-chan struct{},
+	updatePeriod time.Duration,
 ) *Provider {
 	// see if we've got region specific pricing data
 	staticPricing, ok := initialOnDemandPrices[region]
@@ -82,54 +114,58 @@ func NewProvider(
 		staticPricing = initialOnDemandPrices[defaultRegion]
 	}
 
-	p := &Provider{
+	return &Provider{
+		cloud:              env.Cloud,
 		region:             region,
+		updatePeriod:       updatePeriod,
 		onDemandUpdateTime: initialPriceUpdate,
 		onDemandPrices:     staticPricing,
 		spotUpdateTime:     initialPriceUpdate,
 		// default our spot pricing to the same as the on-demand pricing until a price update
-		spotPrices: staticPricing,
-		pricing:    pricing,
-		cm:         pretty.NewChangeMonitor(),
-		done:       make(chan struct{}),
+		spotPrices:               staticPricing,
+		onDemandPriceUpdateTimes: map[string]time.Time{},
+		spotPriceUpdateTimes:     map[string]time.Time{},
+		subscriptionIDs:          sets.New[string](),
+		subscriptionTrigger:      make(chan struct{}, 1),
+		pricing:                  pricing,
+		cm:                       pretty.NewChangeMonitor(),
+		clock:                    clock.RealClock{},
 	}
-	ctx = log.IntoContext(ctx, log.FromContext(ctx).WithName("pricing").WithValues("region", region))
+}
 
+// WithClock makes the pricing updates, their retries and the update times of the prices follow the clock
+func (p *Provider) WithClock(clk clock.Clock) *Provider {
+	p.clock = clk
+	return p
+}
+
+// Start updates the pricing once, and then every update period until the context is canceled. It runs on the leader
+// only, so standby replicas keep the static pricing rather than competing with the leader for the pricing API, and a
+// replica losing its leadership stops updating as soon as its context is canceled.
+func (p *Provider) Start(ctx context.Context) error {
 	// Only poll in public cloud. Other clouds aren't supported currently
-	if auth.IsPublic(env.Cloud) {
-		go func() {
-			log.FromContext(ctx).V(0).Info("starting pricing update loop")
-			// perform an initial price update at startup
+	if !auth.IsPublic(p.cloud) {
+		return nil
+	}
+	ctx = log.IntoContext(ctx, log.FromContext(ctx).WithName("pricing").WithValues("region", p.region))
+	log.FromContext(ctx).V(0).Info("starting pricing update loop")
+	p.updatePricing(ctx)
+	for {
+		select {
+		case <-ctx.Done():
+			log.FromContext(ctx).V(0).Info("stopping pricing update loop")
+			return nil
+		case <-p.clock.After(p.updatePeriod):
 			p.updatePricing(ctx)
-
-			startup := time.Now()
-			// wait for leader election or to be signaled to exit
-			select {
-			case <-startAsync:
-			case <-ctx.Done():
-				close(p.done)
-				return
-			}
-			// if it took many hours to be elected leader, we want to re-fetch pricing before we start our periodic
-			// polling
-			if time.Since(startup) > pricingUpdatePeriod {
-				p.updatePricing(ctx)
-			}
-
-			for {
-				select {
-				case <-ctx.Done():
-					close(p.done)
-					return
-				case <-time.After(pricingUpdatePeriod):
-					p.updatePricing(ctx)
-				}
-			}
-		}()
-	} else {
-		close(p.done) // done immediately
+		case <-p.subscriptionTrigger:
+			p.updateZonalSpotPricing(ctx)
+		}
 	}
-	return p
+}
+
+// NeedLeaderElection is true so that the pricing is only updated by the leader
+func (p *Provider) NeedLeaderElection() bool {
+	return true
 }
 
 // InstanceTypes returns the list of all instance types for which either a price is known.
@@ -153,6 +189,57 @@ func (p *Provider) SpotLastUpdated() time.Time {
 	return p.spotUpdateTime
 }
 
+// OnDemandPriceLastUpdated returns the time that the on-demand price of the instance type was last updated, which is
+// the time of the static price list until the price is first fetched
+func (p *Provider) OnDemandPriceLastUpdated(instanceType string) time.Time {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	return lo.ValueOr(p.onDemandPriceUpdateTimes, instanceType, initialPriceUpdate)
+}
+
+// SpotPriceLastUpdated returns the time that the spot price of the instance type was last updated, which is the time
+// of the static price list until the price is first fetched
+func (p *Provider) SpotPriceLastUpdated(instanceType string) time.Time {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	return lo.ValueOr(p.spotPriceUpdateTimes, instanceType, initialPriceUpdate)
+}
+
+// StaleInstanceTypes returns the instance types whose on-demand and spot prices weren't updated by the last pricing
+// update, as it failed part way through
+func (p *Provider) StaleInstanceTypes() (onDemand []string, spot []string) {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	stale := func(prices map[string]float64, updateTimes map[string]time.Time, lastUpdate time.Time) []string {
+		instanceTypes := lo.Filter(lo.Keys(prices), func(instanceType string, _ int) bool {
+			return lo.ValueOr(updateTimes, instanceType, initialPriceUpdate).Before(lastUpdate)
+		})
+		sort.Strings(instanceTypes)
+		return instanceTypes
+	}
+	return stale(p.onDemandPrices, p.onDemandPriceUpdateTimes, p.onDemandUpdateTime), stale(p.spotPrices, p.spotPriceUpdateTimes, p.spotUpdateTime)
+}
+
+// PricesUpdatedBefore returns the instance types whose on-demand and spot prices were last updated before the time,
+// including those still priced by the static price list
+func (p *Provider) PricesUpdatedBefore(t time.Time) (onDemand sets.Set[string], spot sets.Set[string]) {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	updatedBefore := func(prices map[string]float64, updateTimes map[string]time.Time) sets.Set[string] {
+		return sets.New(lo.Filter(lo.Keys(prices), func(instanceType string, _ int) bool {
+			return lo.ValueOr(updateTimes, instanceType, initialPriceUpdate).Before(t)
+		})...)
+	}
+	return updatedBefore(p.onDemandPrices, p.onDemandPriceUpdateTimes), updatedBefore(p.spotPrices, p.spotPriceUpdateTimes)
+}
+
+// ZonalSpotLastUpdated returns the time the zonal spot prices were last updated
+func (p *Provider) ZonalSpotLastUpdated() time.Time {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	return p.zonalSpotUpdateTime
+}
+
 // OnDemandPrice returns the last known on-demand price for a given instance type, returning false if there is no
 // known on-demand pricing for the instance type.
 func (p *Provider) OnDemandPrice(instanceType string) (float64, bool) {
@@ -185,21 +272,114 @@ func (p *Provider) SpotPrice(instanceType string) (float64, bool) {
 	return price, true
 }
 
+// ZonalSpotPrice returns the last known spot price for a given instance type in a given zone of the cluster's
+// subscription, falling back to the regional spot price when there is no known price for the zone. The retail prices
+// API only publishes regional prices, so zonal prices are only known once fetched from Azure Resource Graph, see
+// WithZonalSpotPricing.
+func (p *Provider) ZonalSpotPrice(instanceType string, zone string) (float64, bool) {
+	return p.SubscriptionZonalSpotPrice("", instanceType, zone)
+}
+
+// SubscriptionZonalSpotPrice returns the last known spot price for a given instance type in a given zone of the
+// subscription, the empty subscription being the cluster's, falling back to the regional spot price when there is no
+// known price for the zone. The prices of another subscription are only known once it is tracked, see TrackSubscription.
+func (p *Provider) SubscriptionZonalSpotPrice(subscriptionID string, instanceType string, zone string) (float64, bool) {
+	p.mu.RLock()
+	price, ok := p.zonalSpotPrices[p.subscriptionKey(subscriptionID)][instanceType][zone]
+	p.mu.RUnlock()
+	if ok {
+		return price, true
+	}
+	return p.SpotPrice(instanceType)
+}
+
+// TrackSubscription records that nodes are launched in the subscription, so that its zonal spot prices are fetched
+// along with the cluster's, the logical zones differing between subscriptions
+func (p *Provider) TrackSubscription(subscriptionID string) {
+	key := p.subscriptionKey(subscriptionID)
+	if p.resourceGraph == nil || key == p.subscriptionKey("") {
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.subscriptionIDs.Has(key) {
+		return
+	}
+	p.subscriptionIDs.Insert(key)
+	select {
+	case p.subscriptionTrigger <- struct{}{}:
+	default:
+	}
+}
+
+// UpdateZonalSpotPricing replaces the zonal spot prices of the cluster's subscription, keyed by instance type and then
+// by zone
+func (p *Provider) UpdateZonalSpotPricing(ctx context.Context, zonalSpotPrices map[string]map[string]float64) {
+	p.updateSubscriptionZonalSpotPricing(ctx, "", zonalSpotPrices)
+}
+
+func (p *Provider) updateSubscriptionZonalSpotPricing(ctx context.Context, subscriptionID string, zonalSpotPrices map[string]map[string]float64) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	key := p.subscriptionKey(subscriptionID)
+	if p.zonalSpotPrices == nil {
+		p.zonalSpotPrices = map[string]map[string]map[string]float64{}
+	}
+	p.zonalSpotPrices[key] = lo.MapValues(zonalSpotPrices, func(prices map[string]float64, _ string) map[string]float64 { return lo.Assign(prices) })
+	p.zonalSpotUpdateTime = p.clock.Now()
+	if p.cm.HasChanged("zonal-spot-prices-"+key, p.zonalSpotPrices[key]) {
+		log.FromContext(ctx).Info("updated zonal spot pricing",
+			"subscriptionID", key,
+			"instanceTypeCount", len(p.zonalSpotPrices[key]),
+		)
+	}
+}
+
+// subscriptionKey returns the key of the zonal spot prices of the subscription, the empty subscription being the
+// cluster's
+func (p *Provider) subscriptionKey(subscriptionID string) string {
+	return strings.ToLower(lo.Ternary(subscriptionID == "", p.subscriptionID, subscriptionID))
+}
+
 func (p *Provider) updatePricing(ctx context.Context) {
 	if ctx.Err() != nil {
 		return
 	}
 
+	// the zonal spot prices come from another API, so they are updated even when the regional prices fail to
+	p.updateZonalSpotPricing(ctx)
+
+	refreshStart := p.clock.Now()
 	prices := map[client.Item]bool{}
-	err := p.fetchPricing(ctx, processPage(prices))
+	err := p.fetchPricing(ctx, "", processPage(prices))
+	// when the pagination fails part way through, use the prices of the pages fetched so far and only retry the
+	// remaining pages
+	for attempt := 1; err != nil && attempt <= pricingRetryAttempts; attempt++ {
+		pageErr := &client.PageError{}
+		if ctx.Err() != nil || !errors.As(err.error, &pageErr) {
+			break
+		}
+		p.mergePricing(ctx, prices, refreshStart)
+		log.FromContext(ctx).V(1).Info("retrying pricing update from the failed page", "attempt", attempt, "error", pageErr.Err)
+		if backoff := time.Duration(attempt-1) * pricingRetryBackoff; backoff > 0 {
+			select {
+			case <-ctx.Done():
+				return
+			case <-p.clock.After(backoff):
+			}
+		}
+		err = p.fetchPricing(ctx, pageErr.NextPageLink, processPage(prices))
+	}
 	if err != nil {
 		if ctx.Err() != nil {
 			return
 		}
-		log.FromContext(ctx).Error(err, "failed to fetch updated pricing, using existing pricing data",
+		log.FromContext(ctx).Error(err, "failed to fetch updated pricing, using existing pricing data for the instance types not fetched",
+			"fetchedPriceCount", len(prices),
 			"lastOnDemandUpdateTime", err.lastOnDemandUpdateTime.Format(time.RFC3339),
 			"lastSpotUpdateTime", err.lastSpotUpdateTime.Format(time.RFC3339),
 		)
+		p.mergePricing(ctx, prices, refreshStart)
 		return
 	}
 
@@ -227,6 +407,50 @@ func (p *Provider) updatePricing(ctx context.Context) {
 	}()
 
 	wg.Wait()
+	p.updateStalePriceMetrics(refreshStart)
+}
+
+// mergePricing merges the prices fetched by an incomplete refresh into the existing prices, keeping the existing
+// prices of the instance types that weren't fetched
+func (p *Provider) mergePricing(ctx context.Context, prices map[client.Item]bool, refreshStart time.Time) {
+	onDemandPrices, spotPrices := categorizePrices(prices)
+	p.mu.Lock()
+	now := p.clock.Now()
+	if len(onDemandPrices) > 0 {
+		p.onDemandPrices = lo.Assign(p.onDemandPrices, onDemandPrices)
+		for instanceType := range onDemandPrices {
+			p.onDemandPriceUpdateTimes[instanceType] = now
+		}
+		p.onDemandUpdateTime = now
+	}
+	if len(spotPrices) > 0 {
+		p.spotPrices = lo.Assign(p.spotPrices, spotPrices)
+		for instanceType := range spotPrices {
+			p.spotPriceUpdateTimes[instanceType] = now
+		}
+		p.spotUpdateTime = now
+	}
+	p.mu.Unlock()
+	if len(prices) > 0 {
+		log.FromContext(ctx).Info("merged partially updated pricing",
+			"onDemandInstanceTypeCount", len(onDemandPrices),
+			"spotInstanceTypeCount", len(spotPrices),
+		)
+	}
+	p.updateStalePriceMetrics(refreshStart)
+}
+
+// updateStalePriceMetrics records the number of instance types whose prices weren't updated by the refresh
+func (p *Provider) updateStalePriceMetrics(refreshStart time.Time) {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	stale := func(prices map[string]float64, updateTimes map[string]time.Time) float64 {
+		return float64(lo.CountBy(lo.Keys(prices), func(instanceType string) bool {
+			return updateTimes[instanceType].Before(refreshStart)
+		}))
+	}
+	StalePricesMetric.With(prometheus.Labels{metrics.CapacityTypeLabel: karpv1.CapacityTypeOnDemand}).Set(stale(p.onDemandPrices, p.onDemandPriceUpdateTimes))
+	StalePricesMetric.With(prometheus.Labels{metrics.CapacityTypeLabel: karpv1.CapacityTypeSpot}).Set(stale(p.spotPrices, p.spotPriceUpdateTimes))
 }
 
 func (p *Provider) UpdateOnDemandPricing(ctx context.Context, onDemandPrices map[string]float64) *Err {
@@ -237,7 +461,8 @@ func (p *Provider) UpdateOnDemandPricing(ctx context.Context, onDemandPrices map
 	}
 
 	p.onDemandPrices = lo.Assign(onDemandPrices)
-	p.onDemandUpdateTime = time.Now()
+	p.onDemandUpdateTime = p.clock.Now()
+	p.onDemandPriceUpdateTimes = lo.MapValues(onDemandPrices, func(float64, string) time.Time { return p.onDemandUpdateTime })
 	if p.cm.HasChanged("on-demand-prices", p.onDemandPrices) {
 		log.FromContext(ctx).Info("updated on-demand pricing",
 			"instanceTypeCount", len(p.onDemandPrices),
@@ -246,9 +471,16 @@ func (p *Provider) UpdateOnDemandPricing(ctx context.Context, onDemandPrices map
 	return nil
 }
 
-func (p *Provider) fetchPricing(ctx context.Context, pageHandler func(output *client.ProductsPricePage)) *Err {
+// fetchPricing fetches the prices of the region, resuming from nextPageLink when set
+func (p *Provider) fetchPricing(ctx context.Context, nextPageLink string, pageHandler func(output *client.ProductsPricePage)) *Err {
 	p.mu.Lock()
 	defer p.mu.Unlock()
+	if nextPageLink != "" {
+		if err := p.pricing.ResumeProductsPricePages(ctx, nextPageLink, pageHandler); err != nil {
+			return &Err{error: err, lastOnDemandUpdateTime: p.onDemandUpdateTime, lastSpotUpdateTime: p.spotUpdateTime}
+		}
+		return nil
+	}
 	filters := []*client.Filter{
 		{
 			Field:    "priceType",
@@ -305,7 +537,8 @@ func (p *Provider) UpdateSpotPricing(ctx context.Context, spotPrices map[string]
 	}
 
 	p.spotPrices = lo.Assign(spotPrices)
-	p.spotUpdateTime = time.Now()
+	p.spotUpdateTime = p.clock.Now()
+	p.spotPriceUpdateTimes = lo.MapValues(spotPrices, func(float64, string) time.Time { return p.spotUpdateTime })
 	if p.cm.HasChanged("spot-prices", p.spotPrices) {
 		log.FromContext(ctx).Info("updated spot pricing",
 			"instanceTypeCount", len(p.spotPrices),
@@ -346,16 +579,11 @@ func (p *Provider) Reset() {
 	defer p.mu.Unlock()
 	p.onDemandPrices = staticPricing
 	p.onDemandUpdateTime = initialPriceUpdate
-}
-
-// WaitUntilDone should be called after canceling the context passed to NewProvider to wait until all goroutines have exited
-func (p *Provider) WaitUntilDone() error {
-	select {
-	case <-p.done:
-		return nil
-	case <-time.After(5 * time.Second):
-		return errors.New("timeout waiting for pricing provider to shut down")
-	}
+	p.onDemandPriceUpdateTimes = map[string]time.Time{}
+	p.spotPriceUpdateTimes = map[string]time.Time{}
+	p.zonalSpotPrices = nil
+	p.zonalSpotUpdateTime = time.Time{}
+	p.subscriptionIDs = sets.New[string]()
 }
 
 func Regions() []string {
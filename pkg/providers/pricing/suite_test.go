@@ -24,11 +24,15 @@ import (
 
 	. "github.com/onsi/ginkgo/v2"
 	. "github.com/onsi/gomega"
+	"github.com/samber/lo"
+	clock "k8s.io/utils/clock/testing"
+	karpv1 "sigs.k8s.io/karpenter/pkg/apis/v1"
 	. "sigs.k8s.io/karpenter/pkg/utils/testing"
 
 	"github.com/Azure/azure-sdk-for-go/sdk/azcore/cloud"
 	"github.com/Azure/karpenter-provider-azure/pkg/auth"
 	"github.com/Azure/karpenter-provider-azure/pkg/fake"
+	"github.com/Azure/karpenter-provider-azure/pkg/metrics"
 	"github.com/Azure/karpenter-provider-azure/pkg/providers/instancetype"
 	"github.com/Azure/karpenter-provider-azure/pkg/providers/pricing"
 	"github.com/Azure/karpenter-provider-azure/pkg/providers/pricing/client"
@@ -40,7 +44,7 @@ var stop context.CancelFunc
 
 var fakePricingAPI *fake.PricingAPI
 var env *auth.Environment
-var providers []*pricing.Provider
+var started []chan struct{}
 
 func TestAzure(t *testing.T) {
 	mainCtx = TestContextWithLogger(t)
@@ -62,29 +66,41 @@ var _ = BeforeEach(func() {
 	// We still need the mainCtx because it attaches the test logger which we cannot do
 	// in BeforeEach.
 	ctx, stop = context.WithCancel(mainCtx)
-	providers = []*pricing.Provider{}
+	started = nil
 	fakePricingAPI.Reset()
 })
 
 var _ = AfterEach(func() {
 	stop()
-	// wait for providers to actually stop
-	for _, p := range providers {
-		Expect(p.WaitUntilDone()).To(Succeed())
+	// wait for the update loops to actually stop
+	for _, done := range started {
+		Eventually(done, 5*time.Second).Should(BeClosed())
 	}
 })
 
+// start runs the update loop of the provider, as on being elected the leader, until ctx is canceled
+func start(ctx context.Context, p *pricing.Provider) chan struct{} {
+	done := make(chan struct{})
+	started = append(started, done)
+	go func() {
+		defer GinkgoRecover()
+		defer close(done)
+		Expect(p.Start(ctx)).To(Succeed())
+	}()
+	return done
+}
+
 var _ = Describe("Pricing", func() {
 	It("should return static on-demand data if pricing API fails", func() {
 		fakePricingAPI.NextError.Set(fmt.Errorf("failed"))
-		p := pricing.NewProvider(ctx, env, fakePricingAPI, "", make(chan struct{}))
-		providers = append(providers, p)
+		p := pricing.NewProvider(env, fakePricingAPI, "", pricing.DefaultUpdatePeriod)
+		start(ctx, p)
 		price, ok := p.OnDemandPrice("Standard_D1")
 		Expect(ok).To(BeTrue())
 		Expect(price).To(BeNumerically(">", 0))
 	})
 	It("should update on-demand pricing with response from the pricing API", func() {
-		// modify our API before creating the pricing provider as it performs an initial update on creation.
+		// modify our API before starting the pricing provider as it performs an initial update on start.
 		fakePricingAPI.ProductsPricePage.Set(&client.ProductsPricePage{
 			Items: []client.Item{
 				fake.NewProductPrice("Standard_D1", 1.20),
@@ -92,8 +108,8 @@ var _ = Describe("Pricing", func() {
 			},
 		})
 		updateStart := time.Now()
-		p := pricing.NewProvider(ctx, env, fakePricingAPI, "", make(chan struct{}))
-		providers = append(providers, p)
+		p := pricing.NewProvider(env, fakePricingAPI, "", pricing.DefaultUpdatePeriod)
+		start(ctx, p)
 		Eventually(func() bool { return p.OnDemandLastUpdated().After(updateStart) }).Should(BeTrue())
 
 		price, ok := p.OnDemandPrice("Standard_D1")
@@ -106,7 +122,7 @@ var _ = Describe("Pricing", func() {
 	})
 
 	It("should update spot pricing with response from the pricing API", func() {
-		// modify our API before creating the pricing provider as it performs an initial update on creation.
+		// modify our API before starting the pricing provider as it performs an initial update on start.
 		fakePricingAPI.ProductsPricePage.Set(&client.ProductsPricePage{
 			Items: []client.Item{
 				fake.NewSpotProductPrice("Standard_D1", 1.10),
@@ -114,8 +130,8 @@ var _ = Describe("Pricing", func() {
 			},
 		})
 		updateStart := time.Now()
-		p := pricing.NewProvider(ctx, env, fakePricingAPI, "", make(chan struct{}))
-		providers = append(providers, p)
+		p := pricing.NewProvider(env, fakePricingAPI, "", pricing.DefaultUpdatePeriod)
+		start(ctx, p)
 		Eventually(func() bool { return p.SpotLastUpdated().After(updateStart) }).Should(BeTrue())
 
 		price, ok := p.SpotPrice("Standard_D1")
@@ -127,14 +143,159 @@ var _ = Describe("Pricing", func() {
 		Expect(price).To(BeNumerically("==", 1.13))
 	})
 
+	It("should use the prices fetched before a pricing update fails part way through", func() {
+		fakePricingAPI.ProductsPricePages.Append(
+			&client.ProductsPricePage{Items: []client.Item{
+				fake.NewProductPrice("Standard_D1", 1.20),
+				fake.NewSpotProductPrice("Standard_D1", 1.10),
+			}},
+			&client.ProductsPricePage{Items: []client.Item{
+				fake.NewProductPrice("Standard_D14", 1.23),
+			}},
+		)
+		// fail the second page on the first attempt and the immediate retry, leaving the update partial until the next retry
+		fakePricingAPI.NextPageError.Set(fmt.Errorf("failed"), fake.MaxCalls(2))
+		staticPrice, ok := pricing.NewProvider(&auth.Environment{Cloud: cloud.AzureGovernment}, fakePricingAPI, "", pricing.DefaultUpdatePeriod).OnDemandPrice("Standard_D14")
+		Expect(ok).To(BeTrue())
+
+		fakeClock := clock.NewFakeClock(time.Now())
+		p := pricing.NewProvider(env, fakePricingAPI, "", pricing.DefaultUpdatePeriod).WithClock(fakeClock)
+		start(ctx, p)
+		// the update backs off before the next retry
+		Eventually(fakeClock.HasWaiters).Should(BeTrue())
+
+		price, ok := p.OnDemandPrice("Standard_D1")
+		Expect(ok).To(BeTrue())
+		Expect(price).To(BeNumerically("==", 1.20))
+		Expect(p.OnDemandPriceLastUpdated("Standard_D1")).To(BeTemporally("==", fakeClock.Now()))
+		price, ok = p.SpotPrice("Standard_D1")
+		Expect(ok).To(BeTrue())
+		Expect(price).To(BeNumerically("==", 1.10))
+
+		// the instance types of the failed page keep their existing prices
+		price, ok = p.OnDemandPrice("Standard_D14")
+		Expect(ok).To(BeTrue())
+		Expect(price).To(BeNumerically("==", staticPrice))
+		Expect(p.OnDemandPriceLastUpdated("Standard_D14")).To(BeTemporally("<", fakeClock.Now()))
+
+		stale, err := metrics.FindMetricWithLabelValues("karpenter_pricing_stale_instance_types", map[string]string{metrics.CapacityTypeLabel: karpv1.CapacityTypeOnDemand})
+		Expect(err).ToNot(HaveOccurred())
+		Expect(stale.GetGauge().GetValue()).To(BeNumerically("==", len(p.InstanceTypes())-1))
+		staleOnDemand, _ := p.StaleInstanceTypes()
+		Expect(staleOnDemand).To(HaveLen(len(p.InstanceTypes()) - 1))
+		Expect(staleOnDemand).ToNot(ContainElement("Standard_D1"))
+
+		// the next retry fetches the remaining page
+		fakeClock.Step(5 * time.Second)
+		Eventually(func() float64 { return lo.Must(p.OnDemandPrice("Standard_D14")) }).Should(BeNumerically("==", 1.23))
+		staleOnDemand, _ = p.StaleInstanceTypes()
+		Expect(staleOnDemand).To(BeEmpty())
+	})
+
+	It("should return the prices updated before a time, including the static ones", func() {
+		p := pricing.NewProvider(env, fakePricingAPI, "", pricing.DefaultUpdatePeriod)
+		updateStart := time.Now()
+		Expect(p.UpdateOnDemandPricing(ctx, map[string]float64{"Standard_D1": 1.20})).To(BeNil())
+
+		onDemand, spot := p.PricesUpdatedBefore(updateStart)
+		Expect(onDemand.UnsortedList()).To(BeEmpty())
+		// spot prices are still the static ones
+		Expect(spot.UnsortedList()).ToNot(BeEmpty())
+
+		onDemand, _ = p.PricesUpdatedBefore(time.Now().Add(time.Minute))
+		Expect(onDemand.UnsortedList()).To(ConsistOf("Standard_D1"))
+	})
+
+	It("should return zonal spot prices, falling back to the regional spot price", func() {
+		fakePricingAPI.ProductsPricePage.Set(&client.ProductsPricePage{
+			Items: []client.Item{
+				fake.NewSpotProductPrice("Standard_D1", 1.10),
+			},
+		})
+		updateStart := time.Now()
+		p := pricing.NewProvider(env, fakePricingAPI, "", pricing.DefaultUpdatePeriod)
+		start(ctx, p)
+		Eventually(func() bool { return p.SpotLastUpdated().After(updateStart) }).Should(BeTrue())
+
+		p.UpdateZonalSpotPricing(ctx, map[string]map[string]float64{
+			"Standard_D1": {"southcentralus-3": 0.80},
+		})
+		Expect(p.ZonalSpotLastUpdated()).To(BeTemporally(">", updateStart))
+
+		price, ok := p.ZonalSpotPrice("Standard_D1", "southcentralus-3")
+		Expect(ok).To(BeTrue())
+		Expect(price).To(BeNumerically("==", 0.80))
+
+		price, ok = p.ZonalSpotPrice("Standard_D1", "southcentralus-1")
+		Expect(ok).To(BeTrue())
+		Expect(price).To(BeNumerically("==", 1.10))
+
+		p.Reset()
+		price, ok = p.ZonalSpotPrice("Standard_D1", "southcentralus-3")
+		Expect(ok).To(BeTrue())
+		Expect(price).To(BeNumerically("==", 1.10))
+	})
+
+	It("should update zonal spot pricing with the response from Azure Resource Graph", func() {
+		fakeResourceGraphAPI := fake.NewAzureResourceGraphAPI("", "", nil, nil)
+		fakeResourceGraphAPI.ZonalSpotPrices.Set(&map[string]map[string]float64{
+			"Standard_D1": {"3": 0.80},
+		})
+		updateStart := time.Now()
+		p := pricing.NewProvider(env, fakePricingAPI, fake.Region, pricing.DefaultUpdatePeriod).WithZonalSpotPricing(fakeResourceGraphAPI, "subscription-id")
+		start(ctx, p)
+		Eventually(func() bool { return p.ZonalSpotLastUpdated().After(updateStart) }).Should(BeTrue())
+
+		price, ok := p.ZonalSpotPrice("Standard_D1", fake.Region+"-3")
+		Expect(ok).To(BeTrue())
+		Expect(price).To(BeNumerically("==", 0.80))
+		Expect(fakeResourceGraphAPI.AzureResourceGraphResourcesBehavior.CalledWithInput.Pop().Query.Subscriptions).To(ConsistOf(HaveValue(Equal("subscription-id"))))
+	})
+
+	It("should fetch the zonal spot prices of a tracked subscription", func() {
+		fakeResourceGraphAPI := fake.NewAzureResourceGraphAPI("", "", nil, nil)
+		fakeResourceGraphAPI.ZonalSpotPrices.Set(&map[string]map[string]float64{
+			"Standard_D1": {"3": 0.80},
+		})
+		p := pricing.NewProvider(env, fakePricingAPI, fake.Region, pricing.DefaultUpdatePeriod).WithZonalSpotPricing(fakeResourceGraphAPI, "subscription-id")
+		start(ctx, p)
+		Eventually(fakeResourceGraphAPI.AzureResourceGraphResourcesBehavior.Calls).Should(Equal(1))
+		// until the subscription is tracked, its spot offerings are priced with the regional spot price
+		price, _ := p.SubscriptionZonalSpotPrice("spoke-subscription-id", "Standard_D1", fake.Region+"-3")
+		Expect(price).ToNot(BeNumerically("==", 0.80))
+
+		p.TrackSubscription("spoke-subscription-id")
+		Eventually(func() bool {
+			price, _ := p.SubscriptionZonalSpotPrice("spoke-subscription-id", "Standard_D1", fake.Region+"-3")
+			return price == 0.80
+		}).Should(BeTrue())
+		Expect(fakeResourceGraphAPI.AzureResourceGraphResourcesBehavior.CalledWithInput.Pop().Query.Subscriptions).To(ConsistOf(HaveValue(Equal("spoke-subscription-id"))))
+	})
+
+	It("should keep the zonal spot prices when Azure Resource Graph fails", func() {
+		fakeResourceGraphAPI := fake.NewAzureResourceGraphAPI("", "", nil, nil)
+		fakeResourceGraphAPI.AzureResourceGraphResourcesBehavior.Error.Set(fmt.Errorf("failed"))
+		p := pricing.NewProvider(env, fakePricingAPI, fake.Region, pricing.DefaultUpdatePeriod).WithZonalSpotPricing(fakeResourceGraphAPI, "subscription-id")
+		p.UpdateZonalSpotPricing(ctx, map[string]map[string]float64{"Standard_D1": {fake.Region + "-3": 0.80}})
+		lastUpdate := p.ZonalSpotLastUpdated()
+		start(ctx, p)
+		Eventually(fakeResourceGraphAPI.AzureResourceGraphResourcesBehavior.FailedCalls).Should(BeNumerically(">", 0))
+
+		Expect(p.ZonalSpotLastUpdated()).To(Equal(lastUpdate))
+		price, ok := p.ZonalSpotPrice("Standard_D1", fake.Region+"-3")
+		Expect(ok).To(BeTrue())
+		Expect(price).To(BeNumerically("==", 0.80))
+	})
+
 	It("each supported instance type should have pricing at least somewhere", func() {
 		// for now just print the names of the SKUs that don't have pricing
 		fmt.Println("\nSKUs that don't have pricing:")
 
 		regions := pricing.Regions()
 		skus := instancetype.GetKarpenterWorkingSKUs()
+		providers := []*pricing.Provider{}
 		for _, region := range regions {
-			providers = append(providers, pricing.NewProvider(ctx, env, fakePricingAPI, region, make(chan struct{})))
+			providers = append(providers, pricing.NewProvider(env, fakePricingAPI, region, pricing.DefaultUpdatePeriod))
 		}
 		for _, sku := range skus {
 			foundPricingForSKU := false
@@ -155,7 +316,7 @@ var _ = Describe("Pricing", func() {
 	})
 
 	It("should poll pricing data in public clouds", func() {
-		// modify our API before creating the pricing provider as it performs an initial update on creation.
+		// modify our API before starting the pricing provider as it performs an initial update on start.
 		fakePricingAPI.ProductsPricePage.Set(&client.ProductsPricePage{
 			Items: []client.Item{
 				fake.NewProductPrice("Standard_D1", 1.20),
@@ -164,10 +325,8 @@ var _ = Describe("Pricing", func() {
 				fake.NewSpotProductPrice("Standard_D14", 1.13),
 			},
 		})
-		start := make(chan struct{}, 1)
-		p := pricing.NewProvider(ctx, env, fakePricingAPI, "", start)
-		providers = append(providers, p)
-		start <- struct{}{}
+		p := pricing.NewProvider(env, fakePricingAPI, "", pricing.DefaultUpdatePeriod)
+		start(ctx, p)
 
 		// TODO: If this were exported or we were in the same package we could just assert on the package variable rather than
 		// duplicating it here
@@ -187,15 +346,56 @@ var _ = Describe("Pricing", func() {
 		Expect(price).To(BeNumerically("==", 1.10))
 	})
 
+	It("should not update pricing before being elected the leader", func() {
+		fakePricingAPI.ProductsPricePage.Set(&client.ProductsPricePage{
+			Items: []client.Item{
+				fake.NewProductPrice("Standard_D1", 1.20),
+			},
+		})
+		p := pricing.NewProvider(env, fakePricingAPI, "", pricing.DefaultUpdatePeriod)
+		Expect(p.NeedLeaderElection()).To(BeTrue())
+
+		// standby replicas keep the static pricing
+		lastUpdated := p.OnDemandLastUpdated()
+		Consistently(p.OnDemandLastUpdated, time.Second).Should(Equal(lastUpdated))
+
+		updateStart := time.Now()
+		start(ctx, p)
+		Eventually(func() bool { return p.OnDemandLastUpdated().After(updateStart) }).Should(BeTrue())
+		price, ok := p.OnDemandPrice("Standard_D1")
+		Expect(ok).To(BeTrue())
+		Expect(price).To(BeNumerically("==", 1.20))
+	})
+
+	It("should stop updating pricing when losing the leadership", func() {
+		fakePricingAPI.ProductsPricePage.Set(&client.ProductsPricePage{
+			Items: []client.Item{
+				fake.NewProductPrice("Standard_D1", 1.20),
+			},
+		})
+		p := pricing.NewProvider(env, fakePricingAPI, "", 100*time.Millisecond)
+		leaderCtx, loseLeadership := context.WithCancel(ctx)
+		done := start(leaderCtx, p)
+
+		// the pricing is updated periodically while leading
+		firstUpdate := time.Now()
+		Eventually(func() bool { return p.OnDemandLastUpdated().After(firstUpdate) }).Should(BeTrue())
+		secondUpdate := time.Now()
+		Eventually(func() bool { return p.OnDemandLastUpdated().After(secondUpdate) }).Should(BeTrue())
+
+		loseLeadership()
+		Eventually(done).Should(BeClosed())
+		lastUpdated := p.OnDemandLastUpdated()
+		Consistently(p.OnDemandLastUpdated, time.Second).Should(Equal(lastUpdated))
+	})
+
 	It("should not poll pricing data in non-public clouds", func() {
 		fakePricingAPI.NextError.Set(fmt.Errorf("failed"))
 		env := &auth.Environment{
 			Cloud: cloud.AzureGovernment,
 		}
-		start := make(chan struct{}, 1)
-		p := pricing.NewProvider(ctx, env, fakePricingAPI, "", start)
-		providers = append(providers, p)
-		start <- struct{}{}
+		p := pricing.NewProvider(env, fakePricingAPI, "", pricing.DefaultUpdatePeriod)
+		start(ctx, p)
 
 		// TODO: If this were exported or we were in the same package we could just assert on the package variable rather than
 		// duplicating it here
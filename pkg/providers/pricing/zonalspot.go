@@ -0,0 +1,135 @@
+/*
+Portions Copyright (c) Microsoft Corporation.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package pricing
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/to"
+	"github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/resourcegraph/armresourcegraph"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	"github.com/Azure/karpenter-provider-azure/pkg/utils"
+)
+
+// SpotResourcesTable is the Azure Resource Graph table of the spot price history, which unlike the retail prices API
+// publishes the spot prices by zone
+const SpotResourcesTable = "SpotResources"
+
+// ResourceGraphAPI is the Azure Resource Graph client the zonal spot prices are queried with
+type ResourceGraphAPI interface {
+	Resources(ctx context.Context, query armresourcegraph.QueryRequest, options *armresourcegraph.ClientResourcesOptions) (armresourcegraph.ClientResourcesResponse, error)
+}
+
+// ZonalSpotPriceQuery returns the Azure Resource Graph query of the latest Linux spot price of each instance type in
+// each zone of the region, with one row per instance type and zone
+func ZonalSpotPriceQuery(region string) string {
+	return fmt.Sprintf(`%s
+| where type =~ 'microsoft.compute/skuspotpricehistory/ostype/location/zone'
+| where location =~ '%s'
+| where tostring(properties.osType) =~ 'linux'
+| project skuName = tostring(sku.name), zone = tostring(zones[0]), priceUSD = todouble(properties.spotPrices[0].priceUSD)`,
+		SpotResourcesTable, region)
+}
+
+// WithZonalSpotPricing makes the pricing updates also fetch the zonal spot prices of the subscription from Azure
+// Resource Graph, the logical zones of the prices being those of the subscription
+func (p *Provider) WithZonalSpotPricing(resourceGraph ResourceGraphAPI, subscriptionID string) *Provider {
+	p.resourceGraph = resourceGraph
+	p.subscriptionID = subscriptionID
+	return p
+}
+
+// updateZonalSpotPricing fetches the zonal spot prices of the cluster's subscription and of the tracked ones, keeping
+// the existing prices of a subscription when its fetch fails
+func (p *Provider) updateZonalSpotPricing(ctx context.Context) {
+	if p.resourceGraph == nil {
+		return
+	}
+	p.mu.RLock()
+	subscriptionIDs := append([]string{p.subscriptionID}, sets.List(p.subscriptionIDs)...)
+	p.mu.RUnlock()
+	for _, subscriptionID := range subscriptionIDs {
+		zonalSpotPrices, err := p.fetchZonalSpotPricing(ctx, subscriptionID)
+		if err != nil {
+			if ctx.Err() != nil {
+				return
+			}
+			log.FromContext(ctx).Error(err, "failed to fetch zonal spot pricing, using existing pricing data",
+				"subscriptionID", subscriptionID,
+				"lastZonalSpotUpdateTime", p.ZonalSpotLastUpdated(),
+			)
+			continue
+		}
+		p.updateSubscriptionZonalSpotPricing(ctx, subscriptionID, zonalSpotPrices)
+	}
+}
+
+// fetchZonalSpotPricing returns the zonal spot prices of the region in the logical zones of the subscription, keyed by
+// instance type and then by zone
+func (p *Provider) fetchZonalSpotPricing(ctx context.Context, subscriptionID string) (map[string]map[string]float64, error) {
+	req := armresourcegraph.QueryRequest{
+		Query: to.Ptr(ZonalSpotPriceQuery(p.region)),
+		Options: &armresourcegraph.QueryRequestOptions{
+			ResultFormat: to.Ptr(armresourcegraph.ResultFormatObjectArray),
+		},
+		Subscriptions: []*string{to.Ptr(subscriptionID)},
+	}
+	zonalSpotPrices := map[string]map[string]float64{}
+	for {
+		resp, err := p.resourceGraph.Resources(ctx, req, nil)
+		if err != nil {
+			return nil, err
+		}
+		rows, ok := resp.Data.([]interface{})
+		if !ok {
+			return nil, fmt.Errorf("type casting query response as interface array failed")
+		}
+		for _, row := range rows {
+			instanceType, zone, price, ok := parseZonalSpotPrice(row)
+			if !ok {
+				continue
+			}
+			if zonalSpotPrices[instanceType] == nil {
+				zonalSpotPrices[instanceType] = map[string]float64{}
+			}
+			zonalSpotPrices[instanceType][utils.MakeZone(p.region, zone)] = price
+		}
+		if resp.SkipToken == nil {
+			return zonalSpotPrices, nil
+		}
+		req.Options.SkipToken = resp.SkipToken
+	}
+}
+
+// parseZonalSpotPrice returns the instance type, zone and price of a row of the zonal spot price query, returning
+// false for the rows of non-zonal prices and the rows without a price
+func parseZonalSpotPrice(row interface{}) (string, string, float64, bool) {
+	fields, ok := row.(map[string]interface{})
+	if !ok {
+		return "", "", 0, false
+	}
+	instanceType, _ := fields["skuName"].(string)
+	zone, _ := fields["zone"].(string)
+	price, ok := fields["priceUSD"].(float64)
+	if !ok || price <= 0 || instanceType == "" || zone == "" {
+		return "", "", 0, false
+	}
+	return instanceType, zone, price, true
+}
@@ -0,0 +1,131 @@
+/*
+Portions Copyright (c) Microsoft Corporation.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package spotplacementscore
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/cloud"
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/policy"
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/runtime"
+
+	"github.com/Azure/karpenter-provider-azure/pkg/auth"
+	"github.com/Azure/karpenter-provider-azure/pkg/consts"
+)
+
+// API generates the spot placement scores of VM sizes in the availability zones of a location
+type API interface {
+	Generate(ctx context.Context, subscription, location string, skus []string) ([]PlacementScore, error)
+}
+
+// PlacementScore is the likelihood of a spot VM of a size in an availability zone being allocated, and not evicted soon
+type PlacementScore struct {
+	SKU              string `json:"sku"`
+	Region           string `json:"region"`
+	AvailabilityZone string `json:"availabilityZone"`
+	// Score is one of High, Medium, Low, or DataNotFoundOrStale and RestrictedSkuNotAvailable when there is none
+	Score            string `json:"score"`
+	IsQuotaAvailable bool   `json:"isQuotaAvailable"`
+}
+
+type desiredSize struct {
+	SKU string `json:"sku"`
+}
+
+type generateRequest struct {
+	DesiredLocations  []string      `json:"desiredLocations"`
+	DesiredSizes      []desiredSize `json:"desiredSizes"`
+	DesiredCount      int           `json:"desiredCount"`
+	AvailabilityZones bool          `json:"availabilityZones"`
+}
+
+type generateResponse struct {
+	PlacementScores []PlacementScore `json:"placementScores"`
+}
+
+// Client generates spot placement scores with the Spot Placement Scores API of the compute resource provider
+type Client struct {
+	cred  azcore.TokenCredential
+	cloud cloud.Configuration
+}
+
+func NewClient(cred azcore.TokenCredential, cloud cloud.Configuration) *Client {
+	return &Client{
+		cred:  cred,
+		cloud: cloud,
+	}
+}
+
+// Generate returns the placement scores of a single spot VM of each of the SKUs, in each availability zone of the location
+func (c *Client) Generate(ctx context.Context, subscription, location string, skus []string) ([]PlacementScore, error) {
+	resourceURL := fmt.Sprintf(
+		"%s/subscriptions/%s/providers/Microsoft.Compute/locations/%s/placementScores/spot/generate?api-version=%s",
+		c.cloud.Services[cloud.ResourceManager].Endpoint, subscription, location, consts.SpotPlacementScoresAPIVersion,
+	)
+	body, err := json.Marshal(generateRequest{
+		DesiredLocations:  []string{location},
+		DesiredSizes:      desiredSizes(skus),
+		DesiredCount:      1,
+		AvailabilityZones: true,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	token, err := c.cred.GetToken(ctx, policy.TokenRequestOptions{
+		Scopes: []string{auth.TokenScope(c.cloud)},
+	})
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, resourceURL, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Authorization", "Bearer "+token.Token)
+	req.Header.Set("Content-Type", "application/json")
+
+	client := &http.Client{}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		// the error code, e.g. of the API not being available in the location, is parsed from the body
+		return nil, runtime.NewResponseError(resp)
+	}
+
+	var response generateResponse
+	if err := json.NewDecoder(resp.Body).Decode(&response); err != nil {
+		return nil, err
+	}
+	return response.PlacementScores, nil
+}
+
+func desiredSizes(skus []string) []desiredSize {
+	sizes := make([]desiredSize, 0, len(skus))
+	for _, sku := range skus {
+		sizes = append(sizes, desiredSize{SKU: sku})
+	}
+	return sizes
+}
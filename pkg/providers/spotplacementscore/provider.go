@@ -0,0 +1,227 @@
+/*
+Portions Copyright (c) Microsoft Corporation.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package spotplacementscore
+
+import (
+	"context"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	sdkerrors "github.com/Azure/azure-sdk-for-go-extensions/pkg/errors"
+	"github.com/samber/lo"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/karpenter/pkg/utils/pretty"
+
+	"github.com/Azure/karpenter-provider-azure/pkg/utils"
+)
+
+const (
+	// DefaultUpdatePeriod is how often the spot placement scores are updated, unless configured otherwise with the
+	// cache-spot-placement-scores-update-period option
+	DefaultUpdatePeriod = 30 * time.Minute
+
+	// batchSize is the most VM sizes the Spot Placement Scores API scores per request
+	batchSize = 5
+	// trackedTTL is how long instance types keep being scored after they were last considered for a spot launch
+	trackedTTL = 24 * time.Hour
+)
+
+// scoreValues are the values of the scores of the API, from 1 for the most to 0 for the least likely spot placements.
+// The other scores, DataNotFoundOrStale and RestrictedSkuNotAvailable, don't score the placement.
+var scoreValues = map[string]float64{
+	"High":   1,
+	"Medium": 0.5,
+	"Low":    0,
+}
+
+// Provider provides the spot placement scores of instance types by zone, which predict how likely spot VMs are to be
+// allocated, and not evicted soon. Scoring every SKU of the region would exhaust the request quota of the API, so only
+// the instance types considered for spot launches are tracked and scored: as soon as they're first considered, and then
+// every update period. Instance types without a score, e.g. while the API is unavailable in the region, are launched
+// by price only.
+type Provider struct {
+	api          API
+	location     string
+	subscription string
+	updatePeriod time.Duration
+	cm           *pretty.ChangeMonitor
+
+	mu sync.RWMutex
+	// tracked are the instance types considered for spot launches, and when they were last considered
+	tracked map[string]time.Time
+	// pending are the tracked instance types that weren't scored yet
+	pending sets.Set[string]
+	scores  map[string]map[string]float64
+	trigger chan struct{}
+}
+
+func NewProvider(api API, location, subscription string, updatePeriod time.Duration) *Provider {
+	return &Provider{
+		api:          api,
+		location:     location,
+		subscription: subscription,
+		updatePeriod: updatePeriod,
+		cm:           pretty.NewChangeMonitor(),
+		tracked:      map[string]time.Time{},
+		pending:      sets.New[string](),
+		scores:       map[string]map[string]float64{},
+		trigger:      make(chan struct{}, 1),
+	}
+}
+
+// Start scores the newly tracked instance types as they're tracked, and all the tracked ones every update period, until
+// the context is canceled
+func (p *Provider) Start(ctx context.Context) error {
+	ctx = log.IntoContext(ctx, log.FromContext(ctx).WithName("spotplacementscores").WithValues("region", p.location))
+	log.FromContext(ctx).V(0).Info("starting spot placement scores update loop")
+	ticker := time.NewTicker(p.updatePeriod)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			log.FromContext(ctx).V(0).Info("stopping spot placement scores update loop")
+			return nil
+		case <-p.trigger:
+			p.Update(ctx, p.takePending())
+		case <-ticker.C:
+			p.Update(ctx, p.trackedInstanceTypes())
+		}
+	}
+}
+
+// NeedLeaderElection is true so that the scores are only updated by the leader, which launches the VMs
+func (p *Provider) NeedLeaderElection() bool {
+	return true
+}
+
+// Track records that the instance types are considered for spot launches, so that they are scored
+func (p *Provider) Track(instanceTypes ...string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	now := time.Now()
+	added := false
+	for _, instanceType := range instanceTypes {
+		if _, ok := p.tracked[instanceType]; !ok {
+			p.pending.Insert(instanceType)
+			added = true
+		}
+		p.tracked[instanceType] = now
+	}
+	if added {
+		select {
+		case p.trigger <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// Score returns the spot placement score of the instance type in the zone, between 0 for the least and 1 for the most
+// likely placements, if it was scored
+func (p *Provider) Score(instanceType, zone string) (float64, bool) {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	score, ok := p.scores[instanceType][zone]
+	return score, ok
+}
+
+// Update scores the instance types, in batches. The scores of a batch failing to be scored are kept from the previous
+// update, unless the API is unavailable, e.g. not offered in the region, in which case all scores are dropped.
+func (p *Provider) Update(ctx context.Context, instanceTypes []string) {
+	for _, batch := range lo.Chunk(instanceTypes, batchSize) {
+		placementScores, err := p.api.Generate(ctx, p.subscription, p.location, batch)
+		if err != nil {
+			if isUnavailableErr(err) {
+				if p.cm.HasChanged("available", false) {
+					log.FromContext(ctx).Info("spot placement scores are unavailable, launching spot offerings by price only", "error", err)
+				}
+				p.mu.Lock()
+				p.scores = map[string]map[string]float64{}
+				p.mu.Unlock()
+				return
+			}
+			log.FromContext(ctx).Error(err, "updating spot placement scores", "instanceTypes", batch)
+			continue
+		}
+		if p.cm.HasChanged("available", true) {
+			log.FromContext(ctx).Info("spot placement scores are available")
+		}
+
+		scores := map[string]map[string]float64{}
+		for _, placementScore := range placementScores {
+			value, ok := scoreValues[placementScore.Score]
+			if !ok || placementScore.AvailabilityZone == "" {
+				continue
+			}
+			if scores[placementScore.SKU] == nil {
+				scores[placementScore.SKU] = map[string]float64{}
+			}
+			scores[placementScore.SKU][utils.MakeZone(p.location, placementScore.AvailabilityZone)] = value
+		}
+		p.mu.Lock()
+		for _, instanceType := range batch {
+			p.scores[instanceType] = scores[instanceType]
+		}
+		p.mu.Unlock()
+		log.FromContext(ctx).V(1).Info("updated spot placement scores", "instanceTypes", batch)
+	}
+}
+
+// takePending returns the tracked instance types that weren't scored yet, which are then no longer pending
+func (p *Provider) takePending() []string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	pending := sets.List(p.pending)
+	p.pending = sets.New[string]()
+	return pending
+}
+
+// trackedInstanceTypes returns the tracked instance types, forgetting those not considered within the tracked TTL
+func (p *Provider) trackedInstanceTypes() []string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for instanceType, lastTracked := range p.tracked {
+		if time.Since(lastTracked) > trackedTTL {
+			delete(p.tracked, instanceType)
+			delete(p.scores, instanceType)
+			p.pending.Delete(instanceType)
+		}
+	}
+	p.pending = sets.New[string]()
+	instanceTypes := lo.Keys(p.tracked)
+	sort.Strings(instanceTypes)
+	return instanceTypes
+}
+
+// Reset forgets the tracked instance types and their scores
+func (p *Provider) Reset() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.tracked = map[string]time.Time{}
+	p.pending = sets.New[string]()
+	p.scores = map[string]map[string]float64{}
+}
+
+// isUnavailableErr returns whether the error is of the API being unavailable, rather than failing transiently: a client
+// error other than throttling, e.g. of the API not being offered in the region or cloud, or not being permitted
+func isUnavailableErr(err error) bool {
+	azErr := sdkerrors.IsResponseError(err)
+	return azErr != nil && azErr.StatusCode >= http.StatusBadRequest && azErr.StatusCode < http.StatusInternalServerError &&
+		azErr.StatusCode != http.StatusTooManyRequests
+}
@@ -0,0 +1,111 @@
+/*
+Portions Copyright (c) Microsoft Corporation.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package spotplacementscore_test
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/Azure/karpenter-provider-azure/pkg/fake"
+	"github.com/Azure/karpenter-provider-azure/pkg/providers/spotplacementscore"
+)
+
+func newProvider() (*spotplacementscore.Provider, *fake.SpotPlacementScoresAPI) {
+	api := &fake.SpotPlacementScoresAPI{}
+	return spotplacementscore.NewProvider(api, fake.Region, "subscription", spotplacementscore.DefaultUpdatePeriod), api
+}
+
+func TestUpdate(t *testing.T) {
+	provider, api := newProvider()
+	api.Scores.Store("Standard_D2s_v3", map[string]string{"1": "High", "2": "Medium", "3": "Low"})
+	api.Scores.Store("Standard_D4s_v3", map[string]string{"1": "DataNotFoundOrStale", "2": "RestrictedSkuNotAvailable"})
+
+	provider.Update(context.Background(), []string{"Standard_D2s_v3", "Standard_D4s_v3"})
+
+	for zone, expected := range map[string]float64{"1": 1, "2": 0.5, "3": 0} {
+		score, ok := provider.Score("Standard_D2s_v3", fake.Region+"-"+zone)
+		assert.True(t, ok)
+		assert.Equal(t, expected, score)
+	}
+	_, ok := provider.Score("Standard_D4s_v3", fake.Region+"-1")
+	assert.False(t, ok, "scores without a placement score value aren't scored")
+}
+
+func TestUpdateBatches(t *testing.T) {
+	provider, api := newProvider()
+	instanceTypes := []string{"A", "B", "C", "D", "E", "F", "G"}
+
+	provider.Update(context.Background(), instanceTypes)
+
+	assert.Equal(t, 2, api.GenerateBehavior.Calls())
+	second := api.GenerateBehavior.CalledWithInput.Pop()
+	first := api.GenerateBehavior.CalledWithInput.Pop()
+	assert.Equal(t, []string{"A", "B", "C", "D", "E"}, first.SKUs)
+	assert.Equal(t, []string{"F", "G"}, second.SKUs)
+	assert.Equal(t, fake.Region, first.Location)
+	assert.Equal(t, "subscription", first.Subscription)
+}
+
+func TestUpdateKeepsScoresOnTransientErrors(t *testing.T) {
+	provider, api := newProvider()
+	api.Scores.Store("Standard_D2s_v3", map[string]string{"1": "High"})
+	provider.Update(context.Background(), []string{"Standard_D2s_v3"})
+
+	api.GenerateBehavior.Error.Set(&azcore.ResponseError{StatusCode: http.StatusTooManyRequests})
+	provider.Update(context.Background(), []string{"Standard_D2s_v3"})
+
+	score, ok := provider.Score("Standard_D2s_v3", fake.Region+"-1")
+	assert.True(t, ok)
+	assert.Equal(t, 1.0, score)
+}
+
+func TestUpdateDropsScoresWhenUnavailable(t *testing.T) {
+	provider, api := newProvider()
+	api.Scores.Store("Standard_D2s_v3", map[string]string{"1": "High"})
+	provider.Update(context.Background(), []string{"Standard_D2s_v3"})
+
+	api.GenerateBehavior.Error.Set(&azcore.ResponseError{StatusCode: http.StatusBadRequest, ErrorCode: "NotSupported"})
+	provider.Update(context.Background(), []string{"Standard_D4s_v3"})
+
+	_, ok := provider.Score("Standard_D2s_v3", fake.Region+"-1")
+	assert.False(t, ok)
+}
+
+func TestStartScoresTrackedInstanceTypes(t *testing.T) {
+	provider, api := newProvider()
+	api.Scores.Store("Standard_D2s_v3", map[string]string{"1": "High"})
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() { _ = provider.Start(ctx) }()
+
+	provider.Track("Standard_D2s_v3")
+
+	assert.Eventually(t, func() bool {
+		_, ok := provider.Score("Standard_D2s_v3", fake.Region+"-1")
+		return ok
+	}, 5*time.Second, 10*time.Millisecond)
+	// tracking instance types again doesn't score them again until the next update
+	provider.Track("Standard_D2s_v3")
+	assert.Never(t, func() bool {
+		return api.GenerateBehavior.Calls() > 1
+	}, 100*time.Millisecond, 10*time.Millisecond)
+}
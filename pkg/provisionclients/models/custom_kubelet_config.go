@@ -35,6 +35,12 @@ type CustomKubeletConfig struct {
 	// allowed unsafe sysctls
 	AllowedUnsafeSysctls []string `json:"allowedUnsafeSysctls"`
 
+	// anonymous auth
+	AnonymousAuth *bool `json:"anonymousAuth,omitempty"`
+
+	// authorization mode
+	AuthorizationMode *string `json:"authorizationMode,omitempty"`
+
 	// container log max files
 	ContainerLogMaxFiles *int32 `json:"containerLogMaxFiles,omitempty"`
 
@@ -68,6 +74,9 @@ type CustomKubeletConfig struct {
 	// pod max pids
 	PodMaxPids *int32 `json:"podMaxPids,omitempty"`
 
+	// read only port
+	ReadOnlyPort *int32 `json:"readOnlyPort,omitempty"`
+
 	// seccomp default
 	SeccompDefault *string `json:"seccompDefault,omitempty"`
 
@@ -0,0 +1,280 @@
+/*
+Portions Copyright (c) Microsoft Corporation.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package azure
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/arm"
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/cloud"
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/policy"
+	"github.com/Azure/azure-sdk-for-go/sdk/azidentity"
+
+	armopts "github.com/Azure/karpenter-provider-azure/pkg/utils/opts"
+)
+
+const (
+	// RecordEnvVar switches the recorders from replaying the cassettes to recording them again against Azure.
+	// Re-recording needs an Azure login (see azidentity.NewDefaultAzureCredential) and AZURE_SUBSCRIPTION_ID,
+	// along with whatever resources the tests expect to exist, e.g.:
+	//
+	//	RECORD_CASSETTES=true AZURE_SUBSCRIPTION_ID=<subscription> go test ./pkg/test/azure/...
+	RecordEnvVar = "RECORD_CASSETTES"
+
+	// SanitizedSubscriptionID replaces the subscription IDs in the cassettes, and is the subscription the tests use
+	// when replaying them
+	SanitizedSubscriptionID = "00000000-0000-0000-0000-000000000000"
+)
+
+var (
+	subscriptionRegex = regexp.MustCompile(`(?i)(/subscriptions/)[0-9a-f]{8}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{12}`)
+	// sensitiveHeaders are never written to the cassettes
+	sensitiveHeaders = []string{"Authorization", "X-Ms-Authorization-Auxiliary", "Cookie", "Set-Cookie"}
+)
+
+// Cassette is a recorded sequence of ARM interactions
+type Cassette struct {
+	Interactions []Interaction `json:"interactions"`
+}
+
+// Interaction is an ARM request and the response it got. Only the method and URL of requests are recorded, as
+// request bodies can carry secrets (e.g. the bootstrap data of VMs), and replays match on them alone.
+type Interaction struct {
+	Method   string           `json:"method"`
+	URL      string           `json:"url"`
+	Response RecordedResponse `json:"response"`
+}
+
+type RecordedResponse struct {
+	StatusCode int         `json:"statusCode"`
+	Header     http.Header `json:"header,omitempty"`
+	Body       string      `json:"body,omitempty"`
+}
+
+// Recorder is a transport for ARM clients that either records the interactions with Azure to a cassette under
+// testdata/cassettes, or replays them from it, so that tests exercising the Azure clients run hermetically and
+// deterministically. It replays unless RecordEnvVar is set.
+type Recorder struct {
+	t              testing.TB
+	path           string
+	recording      bool
+	subscriptionID string
+	credential     azcore.TokenCredential
+	transport      policy.Transporter
+
+	mu       sync.Mutex
+	cassette Cassette
+	replayed []bool
+}
+
+// NewRecorder returns a recorder for the named cassette, which the ARM clients of the test send their requests through
+// when built with its ClientOptions. In record mode, the cassette is saved when the test completes; in replay mode, the
+// test fails if any of the recorded interactions wasn't replayed.
+func NewRecorder(t testing.TB, name string) *Recorder {
+	t.Helper()
+	r := &Recorder{
+		t:              t,
+		path:           filepath.Join("testdata", "cassettes", name+".json"),
+		recording:      os.Getenv(RecordEnvVar) == "true",
+		subscriptionID: SanitizedSubscriptionID,
+		credential:     staticCredential{},
+	}
+	if r.recording {
+		r.subscriptionID = os.Getenv("AZURE_SUBSCRIPTION_ID")
+		if r.subscriptionID == "" {
+			t.Fatalf("recording %s needs AZURE_SUBSCRIPTION_ID", name)
+		}
+		cred, err := azidentity.NewDefaultAzureCredential(nil)
+		if err != nil {
+			t.Fatalf("recording %s needs an Azure credential, %s", name, err)
+		}
+		r.credential = cred
+		r.transport = armopts.DefaultHTTPClient()
+		t.Cleanup(r.save)
+	} else {
+		data, err := os.ReadFile(r.path)
+		if err != nil {
+			t.Fatalf("reading cassette (set %s=true to record it), %s", RecordEnvVar, err)
+		}
+		if err := json.Unmarshal(data, &r.cassette); err != nil {
+			t.Fatalf("decoding cassette %s, %s", r.path, err)
+		}
+		r.replayed = make([]bool, len(r.cassette.Interactions))
+		t.Cleanup(r.verifyReplayed)
+	}
+	return r
+}
+
+// ClientOptions returns the default options of the ARM clients, with the recorder as their transport
+func (r *Recorder) ClientOptions(cloudConfig cloud.Configuration) *arm.ClientOptions {
+	opts := armopts.DefaultARMOpts(cloudConfig, false)
+	opts.Transport = r
+	return opts
+}
+
+// SubscriptionID is the subscription the test should make its requests in: the one of the Azure login while recording,
+// SanitizedSubscriptionID while replaying
+func (r *Recorder) SubscriptionID() string {
+	return r.subscriptionID
+}
+
+// Credential is the credential the clients of the test should use; replays don't need a real one
+func (r *Recorder) Credential() azcore.TokenCredential {
+	return r.credential
+}
+
+// Do implements policy.Transporter
+func (r *Recorder) Do(req *http.Request) (*http.Response, error) {
+	if r.recording {
+		return r.record(req)
+	}
+	return r.replay(req)
+}
+
+func (r *Recorder) record(req *http.Request) (*http.Response, error) {
+	resp, err := r.transport.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	body, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	resp.Body = io.NopCloser(bytes.NewReader(body))
+
+	header := resp.Header.Clone()
+	for _, name := range sensitiveHeaders {
+		header.Del(name)
+	}
+	for name, values := range header {
+		for i := range values {
+			values[i] = r.sanitize(values[i])
+		}
+		header[name] = values
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.cassette.Interactions = append(r.cassette.Interactions, Interaction{
+		Method: req.Method,
+		URL:    r.sanitize(req.URL.String()),
+		Response: RecordedResponse{
+			StatusCode: resp.StatusCode,
+			Header:     header,
+			Body:       r.sanitize(string(body)),
+		},
+	})
+	return resp, nil
+}
+
+// replay returns the response of the first interaction with the same method and URL that wasn't replayed yet, so that
+// repeated requests, e.g. polling an LRO, get the recorded responses in order
+func (r *Recorder) replay(req *http.Request) (*http.Response, error) {
+	url := r.sanitize(req.URL.String())
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for i, interaction := range r.cassette.Interactions {
+		if r.replayed[i] || interaction.Method != req.Method || interaction.URL != url {
+			continue
+		}
+		r.replayed[i] = true
+		header := interaction.Response.Header.Clone()
+		if header == nil {
+			header = http.Header{}
+		}
+		// replays don't wait for what took time while recording: LROs are polled and requests retried right away
+		header.Del("Retry-After")
+		header.Set("Retry-After-Ms", "1")
+		return &http.Response{
+			Status:        fmt.Sprintf("%d %s", interaction.Response.StatusCode, http.StatusText(interaction.Response.StatusCode)),
+			StatusCode:    interaction.Response.StatusCode,
+			Header:        header,
+			Body:          io.NopCloser(strings.NewReader(interaction.Response.Body)),
+			ContentLength: int64(len(interaction.Response.Body)),
+			Request:       req,
+		}, nil
+	}
+	return nil, replayError{fmt.Errorf("no interaction left to replay for %s %s in cassette %s", req.Method, url, r.path)}
+}
+
+// replayError fails requests missing from the cassette right away, rather than after retries
+type replayError struct {
+	error
+}
+
+// NonRetriable implements errorinfo.NonRetriable
+func (replayError) NonRetriable() {}
+
+// sanitize replaces the subscription IDs, which are not secret but are specific to whoever recorded the cassette
+func (r *Recorder) sanitize(text string) string {
+	if r.subscriptionID != "" {
+		text = strings.ReplaceAll(text, r.subscriptionID, SanitizedSubscriptionID)
+	}
+	return subscriptionRegex.ReplaceAllString(text, "${1}"+SanitizedSubscriptionID)
+}
+
+func (r *Recorder) save() {
+	if r.t.Failed() {
+		r.t.Logf("not saving cassette %s of a failed test", r.path)
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	data, err := json.MarshalIndent(r.cassette, "", "  ")
+	if err != nil {
+		r.t.Errorf("encoding cassette %s, %s", r.path, err)
+		return
+	}
+	if err := os.MkdirAll(filepath.Dir(r.path), 0o750); err != nil {
+		r.t.Errorf("creating cassette directory, %s", err)
+		return
+	}
+	if err := os.WriteFile(r.path, append(data, '\n'), 0o600); err != nil {
+		r.t.Errorf("writing cassette %s, %s", r.path, err)
+	}
+}
+
+func (r *Recorder) verifyReplayed() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for i, replayed := range r.replayed {
+		if !replayed {
+			interaction := r.cassette.Interactions[i]
+			r.t.Errorf("interaction %s %s of cassette %s was not replayed", interaction.Method, interaction.URL, r.path)
+		}
+	}
+}
+
+// staticCredential stands in for the Azure login while replaying, as the cassettes don't check authorization
+type staticCredential struct{}
+
+func (staticCredential) GetToken(context.Context, policy.TokenRequestOptions) (azcore.AccessToken, error) {
+	return azcore.AccessToken{Token: "replay", ExpiresOn: time.Now().Add(time.Hour)}, nil
+}
@@ -0,0 +1,236 @@
+/*
+Portions Copyright (c) Microsoft Corporation.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package azure_test
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/compute/armcompute/v7"
+	"github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/network/armnetwork"
+	"github.com/patrickmn/go-cache"
+	"github.com/samber/lo"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	karpv1 "sigs.k8s.io/karpenter/pkg/apis/v1"
+	corecloudprovider "sigs.k8s.io/karpenter/pkg/cloudprovider"
+	coretest "sigs.k8s.io/karpenter/pkg/test"
+
+	"github.com/Azure/karpenter-provider-azure/pkg/apis/v1beta1"
+	"github.com/Azure/karpenter-provider-azure/pkg/auth"
+	azurecache "github.com/Azure/karpenter-provider-azure/pkg/cache"
+	"github.com/Azure/karpenter-provider-azure/pkg/fake"
+	"github.com/Azure/karpenter-provider-azure/pkg/operator/options"
+	"github.com/Azure/karpenter-provider-azure/pkg/providers/bootstraptoken"
+	"github.com/Azure/karpenter-provider-azure/pkg/providers/imagefamily"
+	"github.com/Azure/karpenter-provider-azure/pkg/providers/instance"
+	"github.com/Azure/karpenter-provider-azure/pkg/providers/instancetype"
+	"github.com/Azure/karpenter-provider-azure/pkg/providers/launchtemplate"
+	"github.com/Azure/karpenter-provider-azure/pkg/providers/loadbalancer"
+	"github.com/Azure/karpenter-provider-azure/pkg/providers/networksecuritygroup"
+	"github.com/Azure/karpenter-provider-azure/pkg/providers/pricing"
+	"github.com/Azure/karpenter-provider-azure/pkg/test"
+	"github.com/Azure/karpenter-provider-azure/pkg/test/azure"
+)
+
+// The location and resource group the cassettes of these tests make their requests in. Re-recording them (see
+// azure.RecordEnvVar) needs the resource group, and the SSH_PUBLIC_KEY of the VM.
+const (
+	location      = "westus2"
+	resourceGroup = "karpenter-recorder-test"
+	vmName        = "aks-recorder-test"
+)
+
+func newAZClient(t *testing.T, r *azure.Recorder) (context.Context, *instance.AZClient) {
+	t.Helper()
+	ctx := options.ToContext(context.Background(), test.Options())
+	env := lo.Must(auth.EnvironmentFromName("AzurePublicCloud"))
+	// the operator's client factory, sending its requests through the recorder
+	azClient, err := instance.NewAZClientWithOptions(ctx, &auth.Config{SubscriptionID: r.SubscriptionID(), ResourceGroup: resourceGroup, Location: location}, env, r.Credential(), r.ClientOptions(env.Cloud))
+	if err != nil {
+		t.Fatalf("creating clients, %s", err)
+	}
+	return ctx, azClient
+}
+
+func TestReplayImageResolution(t *testing.T) {
+	r := azure.NewRecorder(t, "image-resolution")
+	ctx, azClient := newAZClient(t, r)
+	provider := imagefamily.NewProvider(azClient.ImageVersionsClient, location, r.SubscriptionID(), azClient.NodeImageVersionsClient, cache.New(time.Hour, time.Hour))
+
+	nodeClass := test.AKSNodeClass()
+	nodeClass.Status.KubernetesVersion = "1.31.0"
+	nodeClass.StatusConditions().SetTrue(v1beta1.ConditionTypeKubernetesVersionReady)
+	nodeImages, err := provider.List(ctx, nodeClass)
+	if err != nil {
+		t.Fatalf("listing node images, %s", err)
+	}
+	if len(nodeImages) == 0 {
+		t.Fatalf("expected node images to be resolved")
+	}
+	for _, nodeImage := range nodeImages {
+		if !strings.HasPrefix(nodeImage.ID, "/CommunityGalleries/AKSUbuntu-38d80f77-467a-481f-a8d4-09b6d4220bd2/images/") || !strings.HasSuffix(nodeImage.ID, "/versions/202505.27.0") {
+			t.Errorf("expected the latest recorded Ubuntu image version, got %s", nodeImage.ID)
+		}
+	}
+	if arch := nodeImages[0].Requirements.Get("kubernetes.io/arch"); !arch.Has(karpv1.ArchitectureAmd64) {
+		t.Errorf("expected the preferred image to be amd64, got %s", arch)
+	}
+}
+
+func TestReplayVMCreate(t *testing.T) {
+	r := azure.NewRecorder(t, "vm-create")
+	ctx := options.ToContext(context.Background(), test.Options(test.OptionsFields{SSHPublicKey: lo.ToPtr(os.Getenv("SSH_PUBLIC_KEY"))}))
+	o := options.FromContext(ctx)
+	env := lo.Must(auth.EnvironmentFromName("AzurePublicCloud"))
+	// the VM and its NIC are created in Azure, while the SKUs, pricing, load balancers and extensions of the launch are
+	// served by the fake cloud
+	cloud, err := fake.NewCloud(resourceGroup, o.ClusterName)
+	if err != nil {
+		t.Fatalf("creating fake cloud, %s", err)
+	}
+	vmClient, err := armcompute.NewVirtualMachinesClient(r.SubscriptionID(), r.Credential(), r.ClientOptions(env.Cloud))
+	if err != nil {
+		t.Fatalf("creating VM client, %s", err)
+	}
+	nicClient, err := armnetwork.NewInterfacesClient(r.SubscriptionID(), r.Credential(), r.ClientOptions(env.Cloud))
+	if err != nil {
+		t.Fatalf("creating NIC client, %s", err)
+	}
+	azClient := instance.NewAZClientFromAPI(vmClient, cloud.AzureResourceGraphAPI, cloud.VirtualMachineExtensionsAPI, nicClient,
+		cloud.SubnetsAPI, cloud.NatGatewaysAPI, cloud.RouteTablesAPI, cloud.LoadBalancersAPI, cloud.NetworkSecurityGroupAPI,
+		cloud.CommunityImageVersionsAPI, cloud.NodeImageVersionsAPI, cloud.NodeBootstrappingAPI, cloud.SKUsAPI, cloud.SubscriptionsAPI,
+		cloud.PermissionsAPI, cloud.UserAssignedIdentitiesAPI, cloud.SpotPlacementScoresAPI, cloud.DisksAPI)
+
+	offeringsCache := azurecache.NewUnavailableOfferings()
+	pricingProvider := pricing.NewProvider(env, cloud.PricingAPI, fake.Region, pricing.DefaultUpdatePeriod)
+	instanceTypeProvider := instancetype.NewDefaultProvider(fake.Region, cache.New(time.Hour, time.Hour), cloud.SKUsAPI, pricingProvider, offeringsCache, nil)
+	imageProvider := imagefamily.NewProvider(cloud.CommunityImageVersionsAPI, location, r.SubscriptionID(), cloud.NodeImageVersionsAPI, cache.New(time.Hour, time.Hour))
+	launchTemplateProvider := launchtemplate.NewProvider(ctx,
+		imagefamily.NewDefaultResolver(nil, imageProvider, instanceTypeProvider, cloud.NodeBootstrappingAPI),
+		imageProvider, lo.ToPtr("ca-bundle"), o.ClusterEndpoint, "test-tenant", r.SubscriptionID(), resourceGroup,
+		"test-kubelet-identity-client-id", resourceGroup, location, o.VnetGUID, o.ProvisionMode, bootstraptoken.NewOptionsProvider())
+	vmProvider := instance.NewDefaultVMProvider(
+		azClient,
+		instanceTypeProvider,
+		launchTemplateProvider,
+		loadbalancer.NewProvider(cloud.LoadBalancersAPI, cache.New(time.Hour, time.Hour), resourceGroup),
+		networksecuritygroup.NewProvider(cloud.NetworkSecurityGroupAPI, resourceGroup),
+		offeringsCache,
+		location,
+		resourceGroup,
+		o.ClusterName,
+		r.SubscriptionID(),
+		o.ProvisionMode,
+		"",
+		nil,
+		nil,
+		instance.NewNetworkOperationPool(1, 0),
+		nil,
+		nil,
+	)
+
+	// the nodeclass as defaulted by the API server
+	nodeClass := test.AKSNodeClass(v1beta1.AKSNodeClass{Spec: v1beta1.AKSNodeClassSpec{MaxPods: lo.ToPtr[int32](30)}})
+	test.ApplyCIGImagesWithVersion(nodeClass, "202505.27.0")
+	nodeClass.StatusConditions().SetTrue(v1beta1.ConditionTypeImagesReady)
+	nodeClass.Status.KubernetesVersion = "1.31.0"
+	nodeClass.StatusConditions().SetTrue(v1beta1.ConditionTypeKubernetesVersionReady)
+	nodeClaim := coretest.NodeClaim(karpv1.NodeClaim{
+		ObjectMeta: metav1.ObjectMeta{Name: strings.TrimPrefix(vmName, "aks-")},
+		Spec: karpv1.NodeClaimSpec{Requirements: []karpv1.NodeSelectorRequirementWithMinValues{{
+			NodeSelectorRequirement: corev1.NodeSelectorRequirement{Key: karpv1.CapacityTypeLabelKey, Operator: corev1.NodeSelectorOpIn, Values: []string{karpv1.CapacityTypeOnDemand}},
+		}}},
+	})
+	instanceTypes, err := instanceTypeProvider.List(ctx, nodeClass)
+	if err != nil {
+		t.Fatalf("listing instance types, %s", err)
+	}
+	instanceTypes = lo.Filter(instanceTypes, func(instanceType *corecloudprovider.InstanceType, _ int) bool {
+		return instanceType.Name == string(armcompute.VirtualMachineSizeTypesStandardD2SV3)
+	})
+
+	promise, err := vmProvider.BeginCreate(ctx, nodeClass, nodeClaim, instanceTypes)
+	if err != nil {
+		t.Fatalf("creating VM, %s", err)
+	}
+	if err := promise.Wait(); err != nil {
+		t.Fatalf("waiting for VM, %s", err)
+	}
+	if promise.GetInstanceName() != vmName {
+		t.Errorf("expected the VM of the nodeclaim to be created, got %s", promise.GetInstanceName())
+	}
+
+	vm, err := vmProvider.Get(ctx, vmName)
+	if err != nil {
+		t.Fatalf("getting VM, %s", err)
+	}
+	if lo.FromPtr(vm.Properties.ProvisioningState) != "Succeeded" {
+		t.Errorf("expected the VM to be provisioned, got %s", lo.FromPtr(vm.Properties.ProvisioningState))
+	}
+	if !strings.Contains(lo.FromPtr(vm.ID), "/subscriptions/"+azure.SanitizedSubscriptionID+"/") {
+		t.Errorf("expected the subscription to be sanitized from the recorded VM, got %s", lo.FromPtr(vm.ID))
+	}
+	if lo.FromPtr(vm.Properties.HardwareProfile.VMSize) != armcompute.VirtualMachineSizeTypesStandardD2SV3 {
+		t.Errorf("expected the VM size to be recorded, got %s", lo.FromPtr(vm.Properties.HardwareProfile.VMSize))
+	}
+}
+
+func TestRecordSanitizes(t *testing.T) {
+	subscriptionID := "12345678-1234-1234-1234-123456789012"
+	t.Setenv(azure.RecordEnvVar, "true")
+	t.Setenv("AZURE_SUBSCRIPTION_ID", subscriptionID)
+	t.Chdir(t.TempDir())
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Azure-AsyncOperation", "https://management.azure.com/subscriptions/"+subscriptionID+"/operations/1")
+		w.Header().Set("Set-Cookie", "session=secret")
+		_, _ = w.Write([]byte(`{"id":"/subscriptions/` + subscriptionID + `/resourceGroups/rg"}`))
+	}))
+	defer server.Close()
+
+	t.Run("record", func(t *testing.T) {
+		r := azure.NewRecorder(t, "sanitized")
+		req := lo.Must(http.NewRequest(http.MethodGet, server.URL+"/subscriptions/"+subscriptionID+"/resourceGroups/rg", nil))
+		req.Header.Set("Authorization", "Bearer secret")
+		resp, err := r.Do(req)
+		if err != nil {
+			t.Fatalf("recording request, %s", err)
+		}
+		defer resp.Body.Close()
+		// the test gets the actual response
+		if body := string(lo.Must(io.ReadAll(resp.Body))); !strings.Contains(body, subscriptionID) {
+			t.Errorf("expected the actual response, got %s", body)
+		}
+	})
+
+	cassette := string(lo.Must(os.ReadFile(filepath.Join("testdata", "cassettes", "sanitized.json"))))
+	for _, leaked := range []string{subscriptionID, "secret", "Set-Cookie"} {
+		if strings.Contains(cassette, leaked) {
+			t.Errorf("expected %q not to be recorded, got %s", leaked, cassette)
+		}
+	}
+	if !strings.Contains(cassette, "/subscriptions/"+azure.SanitizedSubscriptionID+"/operations/1") {
+		t.Errorf("expected the subscription to be sanitized from the headers, got %s", cassette)
+	}
+}
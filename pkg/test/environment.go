@@ -33,6 +33,7 @@ import (
 	azurecache "github.com/Azure/karpenter-provider-azure/pkg/cache"
 	"github.com/Azure/karpenter-provider-azure/pkg/fake"
 	"github.com/Azure/karpenter-provider-azure/pkg/operator/options"
+	"github.com/Azure/karpenter-provider-azure/pkg/providers/bootstraptoken"
 	"github.com/Azure/karpenter-provider-azure/pkg/providers/imagefamily"
 	"github.com/Azure/karpenter-provider-azure/pkg/providers/instance"
 	"github.com/Azure/karpenter-provider-azure/pkg/providers/instancetype"
@@ -41,6 +42,7 @@ import (
 	"github.com/Azure/karpenter-provider-azure/pkg/providers/loadbalancer"
 	"github.com/Azure/karpenter-provider-azure/pkg/providers/networksecuritygroup"
 	"github.com/Azure/karpenter-provider-azure/pkg/providers/pricing"
+	"github.com/Azure/karpenter-provider-azure/pkg/providers/spotplacementscore"
 )
 
 func init() {
@@ -61,15 +63,24 @@ type Environment struct {
 	AzureResourceGraphAPI       *fake.AzureResourceGraphAPI
 	VirtualMachineExtensionsAPI *fake.VirtualMachineExtensionsAPI
 	NetworkInterfacesAPI        *fake.NetworkInterfacesAPI
+	DisksAPI                    *fake.DisksAPI
 	CommunityImageVersionsAPI   *fake.CommunityGalleryImageVersionsAPI
 	NodeImageVersionsAPI        *fake.NodeImageVersionsAPI
+	CustomGalleryAPI            *fake.CustomGalleryAPI
 	SKUsAPI                     *fake.ResourceSKUsAPI
 	PricingAPI                  *fake.PricingAPI
 	LoadBalancersAPI            *fake.LoadBalancersAPI
 	NetworkSecurityGroupAPI     *fake.NetworkSecurityGroupAPI
 	SubnetsAPI                  *fake.SubnetsAPI
+	NatGatewaysAPI              *fake.NatGatewaysAPI
+	RouteTablesAPI              *fake.RouteTablesAPI
+	PermissionsAPI              *fake.PermissionsAPI
+	UserAssignedIdentitiesAPI   *fake.UserAssignedIdentitiesAPI
+	AZClient                    *instance.AZClient
 	AuxiliaryTokenServer        *fake.AuxiliaryTokenServer
 	SubscriptionAPI             *fake.SubscriptionsAPI
+	SpotPlacementScoresAPI      *fake.SpotPlacementScoresAPI
+	NodeBootstrappingAPI        *fake.NodeBootstrappingAPI
 
 	// Cache
 	KubernetesVersionCache    *cache.Cache
@@ -82,6 +93,7 @@ type Environment struct {
 	InstanceTypesProvider        instancetype.Provider
 	VMInstanceProvider           instance.VMProvider
 	PricingProvider              *pricing.Provider
+	SpotPlacementScoreProvider   *spotplacementscore.Provider
 	KubernetesVersionProvider    kubernetesversion.KubernetesVersionProvider
 	ImageProvider                imagefamily.NodeImageProvider
 	ImageResolver                imagefamily.Resolver
@@ -117,6 +129,7 @@ func NewRegionalEnvironment(ctx context.Context, env *coretest.Environment, regi
 	virtualMachinesAPI := &fake.VirtualMachinesAPI{AuxiliaryTokenPolicy: auxTokenPolicy}
 
 	networkInterfacesAPI := &fake.NetworkInterfacesAPI{}
+	disksAPI := &fake.DisksAPI{}
 	virtualMachinesExtensionsAPI := &fake.VirtualMachineExtensionsAPI{}
 	pricingAPI := &fake.PricingAPI{}
 	skusAPI := &fake.ResourceSKUsAPI{Location: region}
@@ -124,27 +137,31 @@ func NewRegionalEnvironment(ctx context.Context, env *coretest.Environment, regi
 	loadBalancersAPI := &fake.LoadBalancersAPI{}
 	networkSecurityGroupAPI := &fake.NetworkSecurityGroupAPI{}
 	nodeImageVersionsAPI := &fake.NodeImageVersionsAPI{}
+	customGalleryAPI := &fake.CustomGalleryAPI{}
 	nodeBootstrappingAPI := &fake.NodeBootstrappingAPI{}
 	subscriptionAPI := &fake.SubscriptionsAPI{}
 
-	azureResourceGraphAPI := fake.NewAzureResourceGraphAPI(resourceGroup, virtualMachinesAPI, networkInterfacesAPI)
+	azureResourceGraphAPI := fake.NewAzureResourceGraphAPI(resourceGroup, testOptions.ClusterName, virtualMachinesAPI, networkInterfacesAPI)
 	// Cache
-	kubernetesVersionCache := cache.New(azurecache.KubernetesVersionTTL, azurecache.DefaultCleanupInterval)
-	nodeImagesCache := cache.New(imagefamily.ImageExpirationInterval, imagefamily.ImageCacheCleaningInterval)
-	instanceTypeCache := cache.New(instancetype.InstanceTypesCacheTTL, azurecache.DefaultCleanupInterval)
-	loadBalancerCache := cache.New(loadbalancer.LoadBalancersCacheTTL, azurecache.DefaultCleanupInterval)
-	unavailableOfferingsCache := azurecache.NewUnavailableOfferings()
+	caches := azurecache.NewProviderCaches(testOptions.CacheConfig)
+	kubernetesVersionCache := caches.KubernetesVersion
+	nodeImagesCache := caches.Images
+	instanceTypeCache := caches.InstanceTypes
+	loadBalancerCache := caches.LoadBalancers
+	unavailableOfferingsCache := caches.UnavailableOfferings
 
 	// Providers
-	pricingProvider := pricing.NewProvider(ctx, azureEnv, pricingAPI, region, make(chan struct{}))
+	pricingProvider := pricing.NewProvider(azureEnv, pricingAPI, region, pricing.DefaultUpdatePeriod).WithZonalSpotPricing(azureResourceGraphAPI, subscription)
 	kubernetesVersionProvider := kubernetesversion.NewKubernetesVersionProvider(env.KubernetesInterface, kubernetesVersionCache)
-	imageFamilyProvider := imagefamily.NewProvider(communityImageVersionsAPI, region, subscription, nodeImageVersionsAPI, nodeImagesCache)
+	imageFamilyProvider := imagefamily.NewProvider(communityImageVersionsAPI, region, subscription, nodeImageVersionsAPI, nodeImagesCache).
+		WithCustomGalleryClientFactory(customGalleryAPI.ClientFactory)
 	instanceTypesProvider := instancetype.NewDefaultProvider(
 		region,
 		instanceTypeCache,
 		skusAPI,
 		pricingProvider,
-		unavailableOfferingsCache)
+		unavailableOfferingsCache,
+		nil)
 	imageFamilyResolver := imagefamily.NewDefaultResolver(env.Client, imageFamilyProvider, instanceTypesProvider, nodeBootstrappingAPI)
 	launchTemplateProvider := launchtemplate.NewProvider(
 		ctx,
@@ -160,6 +177,7 @@ func NewRegionalEnvironment(ctx context.Context, env *coretest.Environment, regi
 		region,
 		testOptions.VnetGUID,
 		testOptions.ProvisionMode,
+		bootstraptoken.NewOptionsProvider(),
 	)
 	loadBalancerProvider := loadbalancer.NewProvider(
 		loadBalancersAPI,
@@ -171,12 +189,19 @@ func NewRegionalEnvironment(ctx context.Context, env *coretest.Environment, regi
 		testOptions.NodeResourceGroup,
 	)
 	subnetsAPI := &fake.SubnetsAPI{}
+	natGatewaysAPI := &fake.NatGatewaysAPI{}
+	routeTablesAPI := &fake.RouteTablesAPI{}
+	permissionsAPI := &fake.PermissionsAPI{}
+	userAssignedIdentitiesAPI := &fake.UserAssignedIdentitiesAPI{}
+	spotPlacementScoresAPI := &fake.SpotPlacementScoresAPI{}
 	azClient := instance.NewAZClientFromAPI(
 		virtualMachinesAPI,
 		azureResourceGraphAPI,
 		virtualMachinesExtensionsAPI,
 		networkInterfacesAPI,
 		subnetsAPI,
+		natGatewaysAPI,
+		routeTablesAPI,
 		loadBalancersAPI,
 		networkSecurityGroupAPI,
 		communityImageVersionsAPI,
@@ -184,7 +209,15 @@ func NewRegionalEnvironment(ctx context.Context, env *coretest.Environment, regi
 		nodeBootstrappingAPI,
 		skusAPI,
 		subscriptionAPI,
+		permissionsAPI,
+		userAssignedIdentitiesAPI,
+		spotPlacementScoresAPI,
+		disksAPI,
 	)
+	// the scores are updated by the tests, rather than in the background
+	spotPlacementScoreProvider := spotplacementscore.NewProvider(spotPlacementScoresAPI, region, subscription, spotplacementscore.DefaultUpdatePeriod)
+	// nodeclasses that create their nodes in another subscription share the fake APIs of the cluster's
+	azClient.WithSubscriptionClients(func(string) (*instance.AZClient, error) { return azClient, nil })
 	vmInstanceProvider := instance.NewDefaultVMProvider(
 		azClient,
 		instanceTypesProvider,
@@ -194,9 +227,15 @@ func NewRegionalEnvironment(ctx context.Context, env *coretest.Environment, regi
 		unavailableOfferingsCache,
 		region,
 		testOptions.NodeResourceGroup,
+		testOptions.ClusterName,
 		subscription,
 		testOptions.ProvisionMode,
 		testOptions.DiskEncryptionSetID,
+		nil, // VM state caching is disabled, as tests modify the fake VMs directly
+		nil, // VM creates are unlimited
+		instance.NewNetworkOperationPool(testOptions.MaxConcurrentNICOperations, testOptions.NICPollInterval),
+		spotPlacementScoreProvider,
+		env.Client,
 	)
 
 	return &Environment{
@@ -205,14 +244,23 @@ func NewRegionalEnvironment(ctx context.Context, env *coretest.Environment, regi
 		AzureResourceGraphAPI:       azureResourceGraphAPI,
 		VirtualMachineExtensionsAPI: virtualMachinesExtensionsAPI,
 		NetworkInterfacesAPI:        networkInterfacesAPI,
+		DisksAPI:                    disksAPI,
 		CommunityImageVersionsAPI:   communityImageVersionsAPI,
 		NodeImageVersionsAPI:        nodeImageVersionsAPI,
+		CustomGalleryAPI:            customGalleryAPI,
 		LoadBalancersAPI:            loadBalancersAPI,
 		NetworkSecurityGroupAPI:     networkSecurityGroupAPI,
 		SubnetsAPI:                  subnetsAPI,
+		NatGatewaysAPI:              natGatewaysAPI,
+		RouteTablesAPI:              routeTablesAPI,
+		PermissionsAPI:              permissionsAPI,
+		UserAssignedIdentitiesAPI:   userAssignedIdentitiesAPI,
+		AZClient:                    azClient,
 		SKUsAPI:                     skusAPI,
 		PricingAPI:                  pricingAPI,
 		SubscriptionAPI:             subscriptionAPI,
+		SpotPlacementScoresAPI:      spotPlacementScoresAPI,
+		NodeBootstrappingAPI:        nodeBootstrappingAPI,
 
 		KubernetesVersionCache:    kubernetesVersionCache,
 		NodeImagesCache:           nodeImagesCache,
@@ -223,6 +271,7 @@ func NewRegionalEnvironment(ctx context.Context, env *coretest.Environment, regi
 		InstanceTypesProvider:        instanceTypesProvider,
 		VMInstanceProvider:           vmInstanceProvider,
 		PricingProvider:              pricingProvider,
+		SpotPlacementScoreProvider:   spotPlacementScoreProvider,
 		KubernetesVersionProvider:    kubernetesVersionProvider,
 		ImageProvider:                imageFamilyProvider,
 		ImageResolver:                imageFamilyResolver,
@@ -243,14 +292,22 @@ func (env *Environment) Reset() {
 	env.AzureResourceGraphAPI.Reset()
 	env.VirtualMachineExtensionsAPI.Reset()
 	env.NetworkInterfacesAPI.Reset()
+	env.DisksAPI.Reset()
 	env.LoadBalancersAPI.Reset()
 	env.NetworkSecurityGroupAPI.Reset()
 	env.SubnetsAPI.Reset()
+	env.NatGatewaysAPI.Reset()
+	env.RouteTablesAPI.Reset()
+	env.PermissionsAPI.Reset()
+	env.UserAssignedIdentitiesAPI.Reset()
 	env.CommunityImageVersionsAPI.Reset()
 	env.NodeImageVersionsAPI.Reset()
+	env.CustomGalleryAPI.Reset()
 	env.SKUsAPI.Reset()
 	env.PricingAPI.Reset()
 	env.PricingProvider.Reset()
+	env.SpotPlacementScoresAPI.Reset()
+	env.SpotPlacementScoreProvider.Reset()
 
 	env.KubernetesVersionCache.Flush()
 	env.NodeImagesCache.Flush()
@@ -76,6 +76,8 @@ func ApplyDefaultStatus(nodeClass *v1beta1.AKSNodeClass, env *coretest.Environme
 	nodeClass.StatusConditions().SetTrue(v1beta1.ConditionTypeKubernetesVersionReady)
 	nodeClass.StatusConditions().SetTrue(opstatus.ConditionReady)
 	nodeClass.StatusConditions().SetTrue(v1beta1.ConditionTypeSubnetsReady)
+	nodeClass.StatusConditions().SetTrue(v1beta1.ConditionTypeSubscriptionReady)
+	nodeClass.StatusConditions().SetTrue(v1beta1.ConditionTypeKubeletIdentityReady)
 
 	conditions := []opstatus.Condition{}
 	for _, condition := range nodeClass.GetConditions() {
@@ -107,6 +109,7 @@ func ApplyCIGImagesWithVersion(nodeClass *v1beta1.AKSNodeClass, cigImageVersion
 					Values:   []string{"2"},
 				},
 			},
+			Channel: v1beta1.ImageChannelStable,
 		},
 		{
 			ID: fmt.Sprintf("/CommunityGalleries/AKSUbuntu-38d80f77-467a-481f-a8d4-09b6d4220bd2/images/2204containerd/versions/%s", cigImageVersion),
@@ -122,6 +125,7 @@ func ApplyCIGImagesWithVersion(nodeClass *v1beta1.AKSNodeClass, cigImageVersion
 					Values:   []string{"1"},
 				},
 			},
+			Channel: v1beta1.ImageChannelStable,
 		},
 		{
 			ID: fmt.Sprintf("/CommunityGalleries/AKSUbuntu-38d80f77-467a-481f-a8d4-09b6d4220bd2/images/2204gen2arm64containerd/versions/%s", cigImageVersion),
@@ -137,6 +141,7 @@ func ApplyCIGImagesWithVersion(nodeClass *v1beta1.AKSNodeClass, cigImageVersion
 					Values:   []string{"2"},
 				},
 			},
+			Channel: v1beta1.ImageChannelStable,
 		},
 	}
 }
@@ -146,14 +151,22 @@ func ApplySIGImages(nodeClass *v1beta1.AKSNodeClass) {
 }
 
 func ApplySIGImagesWithVersion(nodeClass *v1beta1.AKSNodeClass, sigImageVersion string) {
-	imageFamilyNodeImages := getExpectedTestSIGImages(*nodeClass.Spec.ImageFamily, nodeClass.Spec.FIPSMode, sigImageVersion, nodeClass.Status.KubernetesVersion)
+	imageFamilyNodeImages := getExpectedTestSIGImages(*nodeClass.Spec.ImageFamily, nodeClass.Spec.FIPSMode, nodeClass.IsConfidentialVM(), sigImageVersion, nodeClass.Status.KubernetesVersion)
 	nodeClass.Status.Images = translateToStatusNodeImages(imageFamilyNodeImages)
 }
 
-func getExpectedTestSIGImages(imageFamily string, fipsMode *v1beta1.FIPSMode, version string, kubernetesVersion string) []imagefamily.NodeImage {
+func getExpectedTestSIGImages(imageFamily string, fipsMode *v1beta1.FIPSMode, confidentialVM bool, version string, kubernetesVersion string) []imagefamily.NodeImage {
 	var images []imagefamilytypes.DefaultImageOutput
-	if imageFamily == v1beta1.Ubuntu2204ImageFamily {
+	if imageFamily == v1beta1.Ubuntu2204ImageFamily && confidentialVM {
+		images = imagefamily.Ubuntu2204{}.ConfidentialImages(true)
+	} else if imageFamily == v1beta1.Ubuntu2204ImageFamily {
 		images = imagefamily.Ubuntu2204{}.DefaultImages(true, fipsMode)
+	} else if imageFamily == v1beta1.Ubuntu2404ImageFamily {
+		images = imagefamily.Ubuntu2404{}.DefaultImages(true, fipsMode)
+	} else if imageFamily == v1beta1.Windows2022ImageFamily {
+		images = imagefamily.Windows2022{}.DefaultImages(true, fipsMode)
+	} else if imageFamily == v1beta1.AzureLinux3ImageFamily {
+		images = imagefamily.AzureLinux3{}.DefaultImages(true, fipsMode)
 	} else if imageFamily == v1beta1.AzureLinuxImageFamily {
 		if imagefamily.UseAzureLinux3(kubernetesVersion) {
 			images = imagefamily.AzureLinux3{}.DefaultImages(true, fipsMode)
@@ -166,6 +179,7 @@ func getExpectedTestSIGImages(imageFamily string, fipsMode *v1beta1.FIPSMode, ve
 		nodeImages = append(nodeImages, imagefamily.NodeImage{
 			ID:           fmt.Sprintf("/subscriptions/10945678-1234-1234-1234-123456789012/resourceGroups/%s/providers/Microsoft.Compute/galleries/%s/images/%s/versions/%s", image.GalleryResourceGroup, image.GalleryName, image.ImageDefinition, version),
 			Requirements: image.Requirements,
+			Channel:      v1beta1.ImageChannelStable,
 		})
 	}
 	return nodeImages
@@ -187,6 +201,7 @@ func translateToStatusNodeImages(imageFamilyNodeImages []imagefamily.NodeImage)
 		return v1beta1.NodeImage{
 			ID:           nodeImage.ID,
 			Requirements: reqs,
+			Channel:      nodeImage.Channel,
 		}
 	})
 }
@@ -18,41 +18,73 @@ package test
 
 import (
 	"fmt"
+	"time"
 
 	"github.com/imdario/mergo"
 	"github.com/samber/lo"
 
+	"github.com/Azure/karpenter-provider-azure/pkg/consts"
 	azoptions "github.com/Azure/karpenter-provider-azure/pkg/operator/options"
 )
 
 type OptionsFields struct {
-	ClusterName                    *string
-	ClusterEndpoint                *string
-	ClusterID                      *string
-	KubeletClientTLSBootstrapToken *string
-	LinuxAdminUsername             *string
-	SSHPublicKey                   *string
-	NetworkPlugin                  *string
-	NetworkPluginMode              *string
-	NetworkPolicy                  *string
-	NetworkDataplane               *string
-	VMMemoryOverheadPercent        *float64
-	NodeIdentities                 []string
-	SubnetID                       *string
-	NodeResourceGroup              *string
-	ProvisionMode                  *string
-	NodeBootstrappingServerURL     *string
-	VnetGUID                       *string
-	KubeletIdentityClientID        *string
-	AdditionalTags                 map[string]string
-	EnableAzureSDKLogging          *bool
-	DiskEncryptionSetID            *string
-	ClusterDNSServiceIP            *string
+	ClusterName                       *string
+	ClusterEndpoint                   *string
+	ClusterID                         *string
+	KubeletClientTLSBootstrapToken    *string
+	LinuxAdminUsername                *string
+	SSHPublicKey                      *string
+	NetworkPlugin                     *string
+	NetworkPluginMode                 *string
+	NetworkPolicy                     *string
+	NetworkDataplane                  *string
+	VMMemoryOverheadPercent           *float64
+	NodeIdentities                    []string
+	SubnetID                          *string
+	NodeResourceGroup                 *string
+	ProvisionMode                     *string
+	NodeBootstrappingServerURL        *string
+	VnetGUID                          *string
+	KubeletIdentityClientID           *string
+	AdditionalTags                    map[string]string
+	EnableAzureSDKLogging             *bool
+	DiskEncryptionSetID               *string
+	ClusterDNSServiceIP               *string
+	EnableBootstrapDebug              *bool
+	DemoteImageDiscoveryLogs          *bool
+	Cloud                             *string
+	VolumeDetachTimeout               *time.Duration
+	GPUDriverReadyTimeout             *time.Duration
+	InstanceHealthInterval            *time.Duration
+	TagDriftInterval                  *time.Duration
+	TagDriftMode                      *string
+	TagDriftMaxRepairs                *int
+	MaxConcurrentVMCreates            *int
+	MaxConcurrentVMCreatesPerNodePool *int
+	VMCreateQueueTimeout              *time.Duration
+	MaxConcurrentNICOperations        *int
+	NICPollInterval                   *time.Duration
+	ARMRateLimitLowThreshold          *int
+	ARMRateLimitBackpressure          *bool
+	SpotPlacementScoreStrategy        *string
+	SpotPlacementScoreWeight          *float64
+	VMSeriesRetirementOverrides       map[string]string
+	GalleryAliases                    map[string]string
+	VMSeriesRetirementWarningMonths   *int
+	StrictDataFreshness               *time.Duration
+	CacheConfig                       *azoptions.CacheConfig
+	DebugServerPort                   *int
+	LeaderElectionLeaseDuration       *time.Duration
+	LeaderElectionRenewDeadline       *time.Duration
+	LeaderElectionRetryPeriod         *time.Duration
+	NodeImageVersionsAPIVersion       *string
+	GarbageCollectionConfirmationTag  *string
 
 	// SIG Flags not required by the self hosted offering
 	UseSIG                  *bool
 	SIGAccessTokenServerURL *string
 	SIGSubscriptionID       *string
+	SIGFallbackToCIG        *bool
 }
 
 func Options(overrides ...OptionsFields) *azoptions.Options {
@@ -63,30 +95,60 @@ func Options(overrides ...OptionsFields) *azoptions.Options {
 		}
 	}
 	return &azoptions.Options{
-		ClusterName:                    lo.FromPtrOr(options.ClusterName, "test-cluster"),
-		ClusterEndpoint:                lo.FromPtrOr(options.ClusterEndpoint, "https://test-cluster"),
-		ClusterID:                      lo.FromPtrOr(options.ClusterID, "00000000"),
-		KubeletClientTLSBootstrapToken: lo.FromPtrOr(options.KubeletClientTLSBootstrapToken, "test-token"),
-		KubeletIdentityClientID:        lo.FromPtrOr(options.KubeletIdentityClientID, "12345678-1234-1234-1234-123456789012"),
-		SSHPublicKey:                   lo.FromPtrOr(options.SSHPublicKey, "test-ssh-public-key"),
-		LinuxAdminUsername:             lo.FromPtrOr(options.LinuxAdminUsername, "azureuser"),
-		NetworkPlugin:                  lo.FromPtrOr(options.NetworkPlugin, "azure"),
-		NetworkPluginMode:              lo.FromPtrOr(options.NetworkPluginMode, "overlay"),
-		NetworkPolicy:                  lo.FromPtrOr(options.NetworkPolicy, "cilium"),
-		VnetGUID:                       lo.FromPtrOr(options.VnetGUID, "a519e60a-cac0-40b2-b883-084477fe6f5c"),
-		NetworkDataplane:               lo.FromPtrOr(options.NetworkDataplane, "cilium"),
-		VMMemoryOverheadPercent:        lo.FromPtrOr(options.VMMemoryOverheadPercent, 0.075),
-		NodeIdentities:                 options.NodeIdentities,
-		SubnetID:                       lo.FromPtrOr(options.SubnetID, "/subscriptions/12345678-1234-1234-1234-123456789012/resourceGroups/test-resourceGroup/providers/Microsoft.Network/virtualNetworks/aks-vnet-12345678/subnets/aks-subnet"),
-		NodeResourceGroup:              lo.FromPtrOr(options.NodeResourceGroup, "test-resourceGroup"),
-		ProvisionMode:                  lo.FromPtrOr(options.ProvisionMode, "aksscriptless"),
-		NodeBootstrappingServerURL:     lo.FromPtrOr(options.NodeBootstrappingServerURL, ""),
-		EnableAzureSDKLogging:          lo.FromPtrOr(options.EnableAzureSDKLogging, true),
-		UseSIG:                         lo.FromPtrOr(options.UseSIG, false),
-		SIGSubscriptionID:              lo.FromPtrOr(options.SIGSubscriptionID, "12345678-1234-1234-1234-123456789012"),
-		SIGAccessTokenServerURL:        lo.FromPtrOr(options.SIGAccessTokenServerURL, "https://test-sig-access-token-server.com"),
-		AdditionalTags:                 options.AdditionalTags,
-		DiskEncryptionSetID:            lo.FromPtrOr(options.DiskEncryptionSetID, ""),
-		DNSServiceIP:                   lo.FromPtrOr(options.ClusterDNSServiceIP, ""),
+		ClusterName:                       lo.FromPtrOr(options.ClusterName, "test-cluster"),
+		ClusterEndpoint:                   lo.FromPtrOr(options.ClusterEndpoint, "https://test-cluster"),
+		ClusterID:                         lo.FromPtrOr(options.ClusterID, "00000000"),
+		KubeletClientTLSBootstrapToken:    lo.FromPtrOr(options.KubeletClientTLSBootstrapToken, "test-token"),
+		KubeletIdentityClientID:           lo.FromPtrOr(options.KubeletIdentityClientID, "12345678-1234-1234-1234-123456789012"),
+		SSHPublicKey:                      lo.FromPtrOr(options.SSHPublicKey, "test-ssh-public-key"),
+		LinuxAdminUsername:                lo.FromPtrOr(options.LinuxAdminUsername, "azureuser"),
+		NetworkPlugin:                     lo.FromPtrOr(options.NetworkPlugin, "azure"),
+		NetworkPluginMode:                 lo.FromPtrOr(options.NetworkPluginMode, "overlay"),
+		NetworkPolicy:                     lo.FromPtrOr(options.NetworkPolicy, "cilium"),
+		VnetGUID:                          lo.FromPtrOr(options.VnetGUID, "a519e60a-cac0-40b2-b883-084477fe6f5c"),
+		NetworkDataplane:                  lo.FromPtrOr(options.NetworkDataplane, "cilium"),
+		VMMemoryOverheadPercent:           lo.FromPtrOr(options.VMMemoryOverheadPercent, 0.075),
+		NodeIdentities:                    options.NodeIdentities,
+		SubnetID:                          lo.FromPtrOr(options.SubnetID, "/subscriptions/12345678-1234-1234-1234-123456789012/resourceGroups/test-resourceGroup/providers/Microsoft.Network/virtualNetworks/aks-vnet-12345678/subnets/aks-subnet"),
+		NodeResourceGroup:                 lo.FromPtrOr(options.NodeResourceGroup, "test-resourceGroup"),
+		ProvisionMode:                     lo.FromPtrOr(options.ProvisionMode, "aksscriptless"),
+		NodeBootstrappingServerURL:        lo.FromPtrOr(options.NodeBootstrappingServerURL, ""),
+		EnableAzureSDKLogging:             lo.FromPtrOr(options.EnableAzureSDKLogging, true),
+		UseSIG:                            lo.FromPtrOr(options.UseSIG, false),
+		SIGSubscriptionID:                 lo.FromPtrOr(options.SIGSubscriptionID, "12345678-1234-1234-1234-123456789012"),
+		SIGAccessTokenServerURL:           lo.FromPtrOr(options.SIGAccessTokenServerURL, "https://test-sig-access-token-server.com"),
+		SIGFallbackToCIG:                  lo.FromPtrOr(options.SIGFallbackToCIG, false),
+		AdditionalTags:                    options.AdditionalTags,
+		DiskEncryptionSetID:               lo.FromPtrOr(options.DiskEncryptionSetID, ""),
+		DNSServiceIP:                      lo.FromPtrOr(options.ClusterDNSServiceIP, ""),
+		EnableBootstrapDebug:              lo.FromPtrOr(options.EnableBootstrapDebug, false),
+		DemoteImageDiscoveryLogs:          lo.FromPtrOr(options.DemoteImageDiscoveryLogs, false),
+		Cloud:                             lo.FromPtrOr(options.Cloud, "azure"),
+		VolumeDetachTimeout:               lo.FromPtrOr(options.VolumeDetachTimeout, 2*time.Minute),
+		GPUDriverReadyTimeout:             lo.FromPtrOr(options.GPUDriverReadyTimeout, 0),
+		InstanceHealthInterval:            lo.FromPtrOr(options.InstanceHealthInterval, 0),
+		TagDriftInterval:                  lo.FromPtrOr(options.TagDriftInterval, 0),
+		TagDriftMode:                      lo.FromPtrOr(options.TagDriftMode, consts.TagDriftModeReport),
+		TagDriftMaxRepairs:                lo.FromPtrOr(options.TagDriftMaxRepairs, 20),
+		MaxConcurrentVMCreates:            lo.FromPtrOr(options.MaxConcurrentVMCreates, 0),
+		MaxConcurrentVMCreatesPerNodePool: lo.FromPtrOr(options.MaxConcurrentVMCreatesPerNodePool, 0),
+		VMCreateQueueTimeout:              lo.FromPtrOr(options.VMCreateQueueTimeout, time.Minute),
+		MaxConcurrentNICOperations:        lo.FromPtrOr(options.MaxConcurrentNICOperations, 50),
+		NICPollInterval:                   lo.FromPtr(options.NICPollInterval),
+		ARMRateLimitLowThreshold:          lo.FromPtrOr(options.ARMRateLimitLowThreshold, 50),
+		ARMRateLimitBackpressure:          lo.FromPtrOr(options.ARMRateLimitBackpressure, false),
+		SpotPlacementScoreStrategy:        lo.FromPtrOr(options.SpotPlacementScoreStrategy, consts.SpotPlacementScoreStrategyPrice),
+		SpotPlacementScoreWeight:          lo.FromPtrOr(options.SpotPlacementScoreWeight, 0.5),
+		GalleryAliases:                    lo.Ternary(options.GalleryAliases != nil, options.GalleryAliases, map[string]string{}),
+		VMSeriesRetirementOverrides:       lo.Ternary(options.VMSeriesRetirementOverrides != nil, options.VMSeriesRetirementOverrides, map[string]string{}),
+		VMSeriesRetirementWarningMonths:   lo.FromPtrOr(options.VMSeriesRetirementWarningMonths, 6),
+		StrictDataFreshness:               lo.FromPtrOr(options.StrictDataFreshness, 0),
+		CacheConfig:                       lo.FromPtrOr(options.CacheConfig, azoptions.DefaultCacheConfig()),
+		DebugServerPort:                   lo.FromPtrOr(options.DebugServerPort, 0),
+		LeaderElectionLeaseDuration:       lo.FromPtrOr(options.LeaderElectionLeaseDuration, 15*time.Second),
+		LeaderElectionRenewDeadline:       lo.FromPtrOr(options.LeaderElectionRenewDeadline, 10*time.Second),
+		LeaderElectionRetryPeriod:         lo.FromPtrOr(options.LeaderElectionRetryPeriod, 2*time.Second),
+		NodeImageVersionsAPIVersion:       lo.FromPtrOr(options.NodeImageVersionsAPIVersion, consts.NodeImageVersionsAPIVersion),
+		GarbageCollectionConfirmationTag:  lo.FromPtrOr(options.GarbageCollectionConfirmationTag, ""),
 	}
 }
@@ -19,6 +19,8 @@ package test
 import (
 	"github.com/samber/lo"
 	k8srand "k8s.io/apimachinery/pkg/util/rand"
+
+	"github.com/Azure/karpenter-provider-azure/pkg/providers/launchtemplate"
 )
 
 const (
@@ -34,9 +36,10 @@ func RandomName(prefix string) string {
 	return prefix + "-" + k8srand.String(10)
 }
 
+// ManagedTags returns the tags of resources created by Karpenter for the test cluster
 func ManagedTags(nodepoolName string) map[string]*string {
 	return map[string]*string{
-		"karpenter.sh_cluster":  lo.ToPtr("test-cluster"),
-		"karpenter.sh_nodepool": lo.ToPtr(nodepoolName),
+		launchtemplate.KarpenterManagedTagKey: lo.ToPtr("test-cluster"),
+		launchtemplate.NodePoolTagKey:         lo.ToPtr(nodepoolName),
 	}
 }
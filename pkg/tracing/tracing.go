@@ -0,0 +1,87 @@
+/*
+Portions Copyright (c) Microsoft Corporation.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package tracing
+
+import (
+	"context"
+	"fmt"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.37.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const tracerName = "github.com/Azure/karpenter-provider-azure"
+
+// The spans of the provisioning of a NodeClaim. The stages are children of the Create span of the NodeClaim, and the
+// ARM requests of a stage children of its span.
+const (
+	SpanCreate                        = "Create"
+	SpanResolveImage                  = "ResolveImage"
+	SpanCreateNetworkInterface        = "CreateNetworkInterface"
+	SpanCreateVirtualMachine          = "CreateVirtualMachine"
+	SpanWaitForVirtualMachine         = "WaitForVirtualMachine"
+	SpanCreateCSE                     = "CreateCSE"
+	SpanCreateAKSIdentifyingExtension = "CreateAKSIdentifyingExtension"
+)
+
+const (
+	NodeClaimKey    = attribute.Key("karpenter.nodeclaim")
+	NodePoolKey     = attribute.Key("karpenter.nodepool")
+	InstanceTypeKey = attribute.Key("karpenter.instance_type")
+	ImageIDKey      = attribute.Key("azure.image_id")
+	ResourceNameKey = attribute.Key("azure.resource_name")
+	// ARMRequestIDKey and ARMCorrelationRequestIDKey are the x-ms-request-id and x-ms-correlation-request-id of ARM
+	// requests, to look the requests up with Azure support
+	ARMRequestIDKey            = attribute.Key("azure.request_id")
+	ARMCorrelationRequestIDKey = attribute.Key("azure.correlation_request_id")
+)
+
+// Start starts a span as a child of the span of ctx, if any. Spans are no-ops, and cost next to nothing, unless
+// tracing is set up.
+func Start(ctx context.Context, name string, attributes ...attribute.KeyValue) (context.Context, trace.Span) {
+	return otel.Tracer(tracerName).Start(ctx, name, trace.WithAttributes(attributes...))
+}
+
+// End ends the span, marking it failed with err, if any, e.g. when its context was canceled
+func End(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
+
+// Setup exports the spans to the OTLP/HTTP endpoint, until the returned shutdown is called, flushing the spans not
+// exported yet
+func Setup(ctx context.Context, endpoint string) (shutdown func(context.Context) error, err error) {
+	exporter, err := otlptracehttp.New(ctx, otlptracehttp.WithEndpointURL(endpoint))
+	if err != nil {
+		return nil, fmt.Errorf("creating OTLP traces exporter for %q, %w", endpoint, err)
+	}
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(resource.NewSchemaless(semconv.ServiceName("karpenter"))),
+	)
+	otel.SetTracerProvider(provider)
+	return provider.Shutdown, nil
+}
@@ -0,0 +1,96 @@
+/*
+Portions Copyright (c) Microsoft Corporation.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package tracing
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace/noop"
+)
+
+// record records the spans started while it runs
+func record(t *testing.T, run func()) []sdktrace.ReadOnlySpan {
+	t.Helper()
+	recorder := tracetest.NewSpanRecorder()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+	// the global provider delegating to the one set can't be set back, tracing is disabled again instead
+	defer otel.SetTracerProvider(noop.NewTracerProvider())
+	run()
+	return recorder.Ended()
+}
+
+func TestStagesAreChildrenOfTheNodeClaimSpan(t *testing.T) {
+	stageErr := errors.New("creating VM failed")
+	spans := record(t, func() {
+		ctx, root := Start(context.Background(), SpanCreate, NodeClaimKey.String("default-abcde"))
+		_, nic := Start(ctx, SpanCreateNetworkInterface)
+		End(nic, nil)
+		_, vm := Start(ctx, SpanCreateVirtualMachine)
+		End(vm, stageErr)
+		End(root, stageErr)
+	})
+
+	if len(spans) != 3 {
+		t.Fatalf("expected 3 spans, got %d", len(spans))
+	}
+	nic, vm, root := spans[0], spans[1], spans[2]
+	if root.Name() != SpanCreate || root.Parent().IsValid() {
+		t.Errorf("expected the root span %s, got %s with parent %v", SpanCreate, root.Name(), root.Parent())
+	}
+	for _, stage := range []sdktrace.ReadOnlySpan{nic, vm} {
+		if stage.Parent().SpanID() != root.SpanContext().SpanID() {
+			t.Errorf("expected %s to be a child of %s", stage.Name(), SpanCreate)
+		}
+	}
+	if nic.Status().Code != codes.Unset {
+		t.Errorf("expected %s to succeed, got status %v", nic.Name(), nic.Status())
+	}
+	if vm.Status().Code != codes.Error || vm.Status().Description != stageErr.Error() {
+		t.Errorf("expected %s to fail with %q, got status %v", vm.Name(), stageErr, vm.Status())
+	}
+	if len(vm.Events()) != 1 || vm.Events()[0].Name != "exception" {
+		t.Errorf("expected the error of %s to be recorded, got events %v", vm.Name(), vm.Events())
+	}
+}
+
+func TestCanceledContextFailsTheSpan(t *testing.T) {
+	spans := record(t, func() {
+		ctx, cancel := context.WithCancel(context.Background())
+		ctx, span := Start(ctx, SpanWaitForVirtualMachine)
+		cancel()
+		<-ctx.Done()
+		End(span, ctx.Err())
+	})
+
+	if len(spans) != 1 || spans[0].Status().Code != codes.Error || spans[0].Status().Description != context.Canceled.Error() {
+		t.Errorf("expected the span to fail with %q, got %v", context.Canceled, spans)
+	}
+}
+
+func TestSpansAreNotRecordedWithoutSetup(t *testing.T) {
+	_, span := Start(context.Background(), SpanCreate)
+	defer End(span, nil)
+	if span.IsRecording() || span.SpanContext().IsValid() {
+		t.Errorf("expected a no-op span while tracing isn't set up")
+	}
+}
@@ -35,6 +35,10 @@ func DefaultARMOpts(cloudConfig cloud.Configuration, enableLogging bool) *arm.Cl
 	opts.Retry = DefaultRetryOpts()
 	opts.Transport = defaultHTTPClient
 	opts.Cloud = cloudConfig
+	// per retry, so that the quota remaining after throttled attempts is recorded too
+	opts.PerRetryPolicies = append(opts.PerRetryPolicies, RateLimits)
+	// per retry too, so that each attempt is a span of its own, with its own request ID
+	opts.PerRetryPolicies = append(opts.PerRetryPolicies, Tracing)
 
 	if enableLogging {
 		logger := slog.New(slog.NewJSONHandler(os.Stdout, nil))
@@ -0,0 +1,50 @@
+/*
+Portions Copyright (c) Microsoft Corporation.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package opts
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	crmetrics "sigs.k8s.io/controller-runtime/pkg/metrics"
+
+	"github.com/Azure/karpenter-provider-azure/pkg/metrics"
+)
+
+const (
+	armSubsystem = "arm"
+)
+
+var (
+	// ARMRateLimitRemainingMetric is the remaining ARM request quota of a rate limit bucket, e.g. subscription-writes or
+	// Microsoft.Compute/PutVM3Min, as of the last response reporting it.
+	//
+	// STABILITY: ALPHA - This metric may change or be removed without notice.
+	ARMRateLimitRemainingMetric = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: metrics.Namespace,
+			Subsystem: armSubsystem,
+			Name:      "ratelimit_remaining",
+			Help:      "Remaining ARM request quota of a rate limit bucket of a subscription, from the x-ms-ratelimit-remaining-* headers of the last response reporting it.",
+		},
+		[]string{metrics.SubscriptionLabel, metrics.BucketLabel},
+	)
+)
+
+func init() {
+	crmetrics.Registry.MustRegister(
+		ARMRateLimitRemainingMetric,
+	)
+}
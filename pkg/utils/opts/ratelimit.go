@@ -0,0 +1,188 @@
+/*
+Portions Copyright (c) Microsoft Corporation.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package opts
+
+import (
+	"context"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/policy"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	"github.com/Azure/karpenter-provider-azure/pkg/metrics"
+)
+
+const (
+	// rateLimitRemainingHeaderPrefix prefixes the ARM headers of the remaining request quota of a bucket, e.g.
+	// x-ms-ratelimit-remaining-subscription-writes
+	rateLimitRemainingHeaderPrefix = "x-ms-ratelimit-remaining-"
+	// resourceRateLimitHeader lists the remaining quota of the buckets of resource providers, e.g. for compute
+	// "Microsoft.Compute/PutVM3Min;239,Microsoft.Compute/PutVM30Min;1199"
+	resourceRateLimitHeader = rateLimitRemainingHeaderPrefix + "resource"
+
+	// rateLimitReadingTTL is how long the remaining quota of a bucket is considered, without a newer reading. Buckets are
+	// replenished within minutes, and a bucket nothing is sent to anymore mustn't keep the budget low.
+	rateLimitReadingTTL = 5 * time.Minute
+	// backpressureFactor is how much longer non-urgent background work waits while the budget is low
+	backpressureFactor = 4
+)
+
+var subscriptionPathPattern = regexp.MustCompile(`(?i)/subscriptions/([^/]+)`)
+
+// RateLimits tracks the remaining ARM request quota of the clients built from DefaultARMOpts
+var RateLimits = NewRateLimitTracker(0, false)
+
+var _ policy.Policy = &RateLimitTracker{}
+
+// RateLimitTracker tracks the remaining ARM request quota per subscription and bucket, from the
+// x-ms-ratelimit-remaining-* headers of ARM responses. A bucket is low when its remaining quota drops below the low
+// threshold. While any bucket is low, and backpressure is enabled, non-urgent background work such as garbage
+// collection and cache refreshes is slowed down, leaving the quota to provisioning, which always runs at full speed.
+type RateLimitTracker struct {
+	mu           sync.RWMutex
+	lowThreshold int
+	backpressure bool
+	readings     map[rateLimitBucket]rateLimitReading
+	now          func() time.Time
+}
+
+type rateLimitBucket struct {
+	subscription string
+	bucket       string
+}
+
+type rateLimitReading struct {
+	remaining  int
+	observedAt time.Time
+}
+
+// NewRateLimitTracker returns a tracker of the remaining ARM request quota. A low threshold of 0 never considers the
+// budget low.
+func NewRateLimitTracker(lowThreshold int, backpressure bool) *RateLimitTracker {
+	return &RateLimitTracker{
+		lowThreshold: lowThreshold,
+		backpressure: backpressure,
+		readings:     map[rateLimitBucket]rateLimitReading{},
+		now:          time.Now,
+	}
+}
+
+// Configure sets the low threshold of the remaining quota of buckets, and whether background work is slowed down
+// while the budget is low
+func (t *RateLimitTracker) Configure(lowThreshold int, backpressure bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.lowThreshold = lowThreshold
+	t.backpressure = backpressure
+}
+
+// Do records the remaining quota of the response to the request
+func (t *RateLimitTracker) Do(req *policy.Request) (*http.Response, error) {
+	resp, err := req.Next()
+	if resp != nil {
+		t.Observe(req.Raw().Context(), req.Raw().URL.Path, resp.Header)
+	}
+	return resp, err
+}
+
+// Observe records the remaining quota of the rate limit headers of a response to a request of the path
+func (t *RateLimitTracker) Observe(ctx context.Context, path string, header http.Header) {
+	subscription := ""
+	if match := subscriptionPathPattern.FindStringSubmatch(path); match != nil {
+		subscription = strings.ToLower(match[1])
+	}
+	remaining := map[string]int{}
+	for name, values := range header {
+		name = strings.ToLower(name)
+		if !strings.HasPrefix(name, rateLimitRemainingHeaderPrefix) || len(values) == 0 {
+			continue
+		}
+		if name == resourceRateLimitHeader {
+			for _, entry := range strings.Split(values[0], ",") {
+				bucket, count, ok := strings.Cut(strings.TrimSpace(entry), ";")
+				if n, err := strconv.Atoi(strings.TrimSpace(count)); ok && err == nil {
+					remaining[bucket] = n
+				}
+			}
+			continue
+		}
+		if n, err := strconv.Atoi(strings.TrimSpace(values[0])); err == nil {
+			remaining[strings.TrimPrefix(name, rateLimitRemainingHeaderPrefix)] = n
+		}
+	}
+	if len(remaining) == 0 {
+		return
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	now := t.now()
+	for bucket, n := range remaining {
+		key := rateLimitBucket{subscription: subscription, bucket: bucket}
+		previous, seen := t.readings[key]
+		wasLow := seen && t.isLow(previous, now)
+		t.readings[key] = rateLimitReading{remaining: n, observedAt: now}
+		ARMRateLimitRemainingMetric.With(map[string]string{metrics.SubscriptionLabel: subscription, metrics.BucketLabel: bucket}).Set(float64(n))
+		// warned once per bucket dropping below the threshold, rather than on every response
+		if !wasLow && t.isLow(t.readings[key], now) {
+			log.FromContext(ctx).Info("ARM request quota is running low, background work may be slowed down",
+				"subscription", subscription, "bucket", bucket, "remaining", n, "threshold", t.lowThreshold)
+		}
+	}
+}
+
+// Remaining returns the remaining quota of the bucket of the subscription, if it was observed
+func (t *RateLimitTracker) Remaining(subscription, bucket string) (int, bool) {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	reading, ok := t.readings[rateLimitBucket{subscription: strings.ToLower(subscription), bucket: bucket}]
+	return reading.remaining, ok
+}
+
+// Low returns whether the remaining quota of any bucket is below the low threshold
+func (t *RateLimitTracker) Low() bool {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	now := t.now()
+	for _, reading := range t.readings {
+		if t.isLow(reading, now) {
+			return true
+		}
+	}
+	return false
+}
+
+// BackgroundInterval returns how long non-urgent background work waits before running again: the interval, stretched
+// while the budget is low and backpressure is enabled
+func (t *RateLimitTracker) BackgroundInterval(interval time.Duration) time.Duration {
+	t.mu.RLock()
+	backpressure := t.backpressure
+	t.mu.RUnlock()
+	if !backpressure || !t.Low() {
+		return interval
+	}
+	return interval * backpressureFactor
+}
+
+func (t *RateLimitTracker) isLow(reading rateLimitReading, now time.Time) bool {
+	return t.lowThreshold > 0 && reading.remaining < t.lowThreshold && now.Sub(reading.observedAt) < rateLimitReadingTTL
+}
@@ -0,0 +1,156 @@
+/*
+Portions Copyright (c) Microsoft Corporation.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package opts
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/policy"
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/runtime"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/samber/lo"
+
+	"github.com/Azure/karpenter-provider-azure/pkg/metrics"
+)
+
+const testSubscription = "12345678-1234-1234-1234-123456789012"
+
+// headerTransport responds to every request with the next headers of its sequence
+type headerTransport struct {
+	responses []http.Header
+}
+
+func (t *headerTransport) Do(req *http.Request) (*http.Response, error) {
+	header := t.responses[0]
+	t.responses = t.responses[1:]
+	return &http.Response{StatusCode: http.StatusOK, Header: header, Body: http.NoBody, Request: req}, nil
+}
+
+// send sends a request through a pipeline with the tracker for each of the header sequence
+func send(t *testing.T, tracker *RateLimitTracker, responses ...http.Header) {
+	t.Helper()
+	pipeline := runtime.NewPipeline("test", "v0.0.0", runtime.PipelineOptions{PerRetry: []policy.Policy{tracker}}, &policy.ClientOptions{
+		Transport: &headerTransport{responses: responses},
+		Retry:     policy.RetryOptions{MaxRetries: -1},
+	})
+	for range responses {
+		req, err := runtime.NewRequest(context.Background(), http.MethodPut, "https://management.azure.com/subscriptions/"+testSubscription+"/resourceGroups/rg/providers/Microsoft.Compute/virtualMachines/vm")
+		if err != nil {
+			t.Fatalf("Unexpected error %v", err)
+		}
+		resp, err := pipeline.Do(req)
+		if err != nil {
+			t.Fatalf("Unexpected error %v", err)
+		}
+		resp.Body.Close()
+	}
+}
+
+func rateLimitHeader(pairs ...string) http.Header {
+	header := http.Header{}
+	for i := 0; i < len(pairs); i += 2 {
+		header.Set(pairs[i], pairs[i+1])
+	}
+	return header
+}
+
+func TestRateLimitTrackerParsesHeaders(t *testing.T) {
+	tracker := NewRateLimitTracker(50, true)
+	send(t, tracker, rateLimitHeader(
+		"x-ms-ratelimit-remaining-subscription-writes", "1199",
+		"x-ms-ratelimit-remaining-subscription-global-writes", "2999",
+		"x-ms-ratelimit-remaining-resource", "Microsoft.Compute/PutVM3Min;239,Microsoft.Compute/PutVM30Min;1199",
+		"x-ms-request-id", "ignored",
+	))
+
+	for bucket, expected := range map[string]int{
+		"subscription-writes":          1199,
+		"subscription-global-writes":   2999,
+		"Microsoft.Compute/PutVM3Min":  239,
+		"Microsoft.Compute/PutVM30Min": 1199,
+	} {
+		remaining, ok := tracker.Remaining(testSubscription, bucket)
+		if !ok || remaining != expected {
+			t.Errorf("expected %d remaining in bucket %s, got %d (observed: %t)", expected, bucket, remaining, ok)
+		}
+		if gauge := testutil.ToFloat64(ARMRateLimitRemainingMetric.With(map[string]string{metrics.SubscriptionLabel: testSubscription, metrics.BucketLabel: bucket})); gauge != float64(expected) {
+			t.Errorf("expected the gauge of bucket %s to be %d, got %v", bucket, expected, gauge)
+		}
+	}
+	if tracker.Low() {
+		t.Errorf("expected the budget not to be low")
+	}
+}
+
+func TestRateLimitTrackerBackpressure(t *testing.T) {
+	tracker := NewRateLimitTracker(50, true)
+	now := time.Now()
+	tracker.now = func() time.Time { return now }
+
+	// the PutVM3Min bucket drains as VMs are created, and then replenishes
+	sequence := []struct {
+		remaining string
+		low       bool
+	}{
+		{"239", false},
+		{"120", false},
+		{"50", false},
+		{"49", true},
+		{"3", true},
+		{"240", false},
+	}
+	for _, step := range sequence {
+		send(t, tracker, rateLimitHeader("x-ms-ratelimit-remaining-resource", "Microsoft.Compute/PutVM3Min;"+step.remaining))
+		if tracker.Low() != step.low {
+			t.Errorf("with %s remaining, expected the budget to be low: %t", step.remaining, step.low)
+		}
+		expected := lo.Ternary(step.low, 4*time.Minute, time.Minute)
+		if interval := tracker.BackgroundInterval(time.Minute); interval != expected {
+			t.Errorf("with %s remaining, expected background work to wait %s, got %s", step.remaining, expected, interval)
+		}
+	}
+
+	// a low reading no newer response reports stops slowing background work down
+	send(t, tracker, rateLimitHeader("x-ms-ratelimit-remaining-subscription-deletes", "10"))
+	if !tracker.Low() {
+		t.Errorf("expected the budget to be low")
+	}
+	now = now.Add(rateLimitReadingTTL)
+	if tracker.Low() {
+		t.Errorf("expected an expired reading not to keep the budget low")
+	}
+}
+
+func TestRateLimitTrackerWithoutBackpressure(t *testing.T) {
+	tracker := NewRateLimitTracker(50, false)
+	send(t, tracker, rateLimitHeader("x-ms-ratelimit-remaining-subscription-writes", "1"))
+	if !tracker.Low() {
+		t.Errorf("expected the budget to be low")
+	}
+	if interval := tracker.BackgroundInterval(time.Minute); interval != time.Minute {
+		t.Errorf("expected background work not to be slowed down without backpressure, got %s", interval)
+	}
+
+	// a threshold of 0 never considers the budget low
+	tracker.Configure(0, true)
+	if tracker.Low() {
+		t.Errorf("expected the budget not to be low without a threshold")
+	}
+}
@@ -0,0 +1,59 @@
+/*
+Portions Copyright (c) Microsoft Corporation.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package opts
+
+import (
+	"net/http"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/policy"
+	"go.opentelemetry.io/otel/codes"
+	semconv "go.opentelemetry.io/otel/semconv/v1.37.0"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/Azure/karpenter-provider-azure/pkg/tracing"
+)
+
+// Tracing traces the ARM requests of the clients built from DefaultARMOpts, as children of the span of the request
+// context, recording their ARM request IDs. Requests without a recording span, e.g. while tracing is disabled, aren't
+// traced.
+var Tracing policy.Policy = armTracingPolicy{}
+
+type armTracingPolicy struct{}
+
+func (armTracingPolicy) Do(req *policy.Request) (*http.Response, error) {
+	ctx := req.Raw().Context()
+	if !trace.SpanFromContext(ctx).IsRecording() {
+		return req.Next()
+	}
+	_, span := tracing.Start(ctx, "ARM "+req.Raw().Method,
+		semconv.HTTPRequestMethodKey.String(req.Raw().Method),
+		semconv.URLPath(req.Raw().URL.Path),
+	)
+	resp, err := req.Next()
+	if resp != nil {
+		span.SetAttributes(
+			semconv.HTTPResponseStatusCode(resp.StatusCode),
+			tracing.ARMRequestIDKey.String(resp.Header.Get("x-ms-request-id")),
+			tracing.ARMCorrelationRequestIDKey.String(resp.Header.Get("x-ms-correlation-request-id")),
+		)
+		if err == nil && resp.StatusCode >= http.StatusBadRequest {
+			span.SetStatus(codes.Error, http.StatusText(resp.StatusCode))
+		}
+	}
+	tracing.End(span, err)
+	return resp, err
+}
@@ -0,0 +1,125 @@
+/*
+Portions Copyright (c) Microsoft Corporation.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package opts
+
+import (
+	"context"
+	"net/http"
+	"slices"
+	"testing"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/policy"
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/runtime"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+	"go.opentelemetry.io/otel/trace/noop"
+
+	"github.com/Azure/karpenter-provider-azure/pkg/tracing"
+)
+
+// statusTransport responds to every request with the status and the ARM request IDs
+type statusTransport struct {
+	statusCode int
+}
+
+func (t *statusTransport) Do(req *http.Request) (*http.Response, error) {
+	header := http.Header{}
+	header.Set("x-ms-request-id", "request-id")
+	header.Set("x-ms-correlation-request-id", "correlation-request-id")
+	return &http.Response{StatusCode: t.statusCode, Header: header, Body: http.NoBody, Request: req}, nil
+}
+
+// sendTraced sends a request through a pipeline with the tracing policy, within a span of a stage unless traced is
+// false, and returns the spans of the ARM request and the stage recorded
+func sendTraced(t *testing.T, statusCode int, traced bool) (arm sdktrace.ReadOnlySpan, stage sdktrace.ReadOnlySpan) {
+	t.Helper()
+	recorder := tracetest.NewSpanRecorder()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+	defer otel.SetTracerProvider(noop.NewTracerProvider())
+
+	pipeline := runtime.NewPipeline("test", "v0.0.0", runtime.PipelineOptions{PerRetry: []policy.Policy{Tracing}}, &policy.ClientOptions{
+		Transport: &statusTransport{statusCode: statusCode},
+		Retry:     policy.RetryOptions{MaxRetries: -1},
+	})
+	ctx := context.Background()
+	var span trace.Span = noop.Span{}
+	if traced {
+		ctx, span = tracing.Start(ctx, tracing.SpanCreateVirtualMachine)
+	}
+	req, err := runtime.NewRequest(ctx, http.MethodPut, "https://management.azure.com/subscriptions/"+testSubscription+"/resourceGroups/rg/providers/Microsoft.Compute/virtualMachines/vm")
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	resp, err := pipeline.Do(req)
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	resp.Body.Close()
+	span.End()
+
+	spans := recorder.Ended()
+	if !traced {
+		if len(spans) != 0 {
+			t.Errorf("expected no spans for requests outside of a span, got %d", len(spans))
+		}
+		return nil, nil
+	}
+	if len(spans) != 2 {
+		t.Fatalf("expected the ARM request and stage spans, got %d spans", len(spans))
+	}
+	return spans[0], spans[1]
+}
+
+func TestTracingRecordsARMRequestIDs(t *testing.T) {
+	arm, stage := sendTraced(t, http.StatusOK, true)
+	if arm.Name() != "ARM PUT" {
+		t.Errorf("expected the span ARM PUT, got %s", arm.Name())
+	}
+	if arm.Parent().SpanID() != stage.SpanContext().SpanID() {
+		t.Errorf("expected the ARM request to be a child of %s", stage.Name())
+	}
+	for _, expected := range []attribute.KeyValue{
+		tracing.ARMRequestIDKey.String("request-id"),
+		tracing.ARMCorrelationRequestIDKey.String("correlation-request-id"),
+		attribute.Int("http.response.status_code", http.StatusOK),
+	} {
+		if !slices.Contains(arm.Attributes(), expected) {
+			t.Errorf("expected the attribute %v, got %v", expected, arm.Attributes())
+		}
+	}
+	if arm.Status().Code != codes.Unset {
+		t.Errorf("expected the ARM request to succeed, got status %v", arm.Status())
+	}
+}
+
+func TestTracingFailsSpansOfFailedARMRequests(t *testing.T) {
+	arm, _ := sendTraced(t, http.StatusConflict, true)
+	if arm.Status().Code != codes.Error {
+		t.Errorf("expected the ARM request to fail, got status %v", arm.Status())
+	}
+	if !slices.Contains(arm.Attributes(), tracing.ARMRequestIDKey.String("request-id")) {
+		t.Errorf("expected the request ID of the failed ARM request, got %v", arm.Attributes())
+	}
+}
+
+func TestTracingSkipsRequestsOutsideOfSpans(t *testing.T) {
+	sendTraced(t, http.StatusOK, false)
+}
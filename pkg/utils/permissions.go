@@ -0,0 +1,60 @@
+/*
+Portions Copyright (c) Microsoft Corporation.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package utils
+
+import (
+	"strings"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/authorization/armauthorization/v2"
+	"github.com/samber/lo"
+)
+
+// SubnetJoinAction is the action needed to create a network interface in a subnet
+const SubnetJoinAction = "Microsoft.Network/virtualNetworks/subnets/join/action"
+
+// IsActionPermitted returns whether any of the permissions, as listed for a resource, grants the action.
+// A permission grants an action that matches one of its actions and none of its not actions.
+func IsActionPermitted(permissions []*armauthorization.Permission, action string) bool {
+	return lo.ContainsBy(permissions, func(permission *armauthorization.Permission) bool {
+		if permission == nil {
+			return false
+		}
+		matches := func(pattern *string) bool { return matchesAction(lo.FromPtr(pattern), action) }
+		return lo.ContainsBy(permission.Actions, matches) && !lo.ContainsBy(permission.NotActions, matches)
+	})
+}
+
+// matchesAction matches an action against a pattern, in which * matches any sequence of characters, case-insensitively
+func matchesAction(pattern, action string) bool {
+	pattern, action = strings.ToLower(pattern), strings.ToLower(action)
+	parts := strings.Split(pattern, "*")
+	if len(parts) == 1 {
+		return pattern == action
+	}
+	if !strings.HasPrefix(action, parts[0]) {
+		return false
+	}
+	action = action[len(parts[0]):]
+	for _, part := range parts[1 : len(parts)-1] {
+		i := strings.Index(action, part)
+		if i < 0 {
+			return false
+		}
+		action = action[i+len(part):]
+	}
+	return strings.HasSuffix(action, parts[len(parts)-1])
+}
@@ -0,0 +1,55 @@
+/*
+Portions Copyright (c) Microsoft Corporation.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package utils_test
+
+import (
+	"testing"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/authorization/armauthorization/v2"
+	"github.com/samber/lo"
+
+	"github.com/Azure/karpenter-provider-azure/pkg/utils"
+)
+
+func TestIsActionPermitted(t *testing.T) {
+	permission := func(actions []string, notActions []string) *armauthorization.Permission {
+		return &armauthorization.Permission{Actions: lo.ToSlicePtr(actions), NotActions: lo.ToSlicePtr(notActions)}
+	}
+	cases := []struct {
+		name        string
+		permissions []*armauthorization.Permission
+		expected    bool
+	}{
+		{"no permissions", nil, false},
+		{"owner", []*armauthorization.Permission{permission([]string{"*"}, nil)}, true},
+		{"reader", []*armauthorization.Permission{permission([]string{"*/read"}, nil)}, false},
+		{"network contributor", []*armauthorization.Permission{permission([]string{"Microsoft.Network/*"}, nil)}, true},
+		{"exact action, different casing", []*armauthorization.Permission{permission([]string{"microsoft.network/virtualnetworks/subnets/join/action"}, nil)}, true},
+		{"excluded by not actions", []*armauthorization.Permission{permission([]string{"*"}, []string{"Microsoft.Network/virtualNetworks/*/action"})}, false},
+		{"granted by another role", []*armauthorization.Permission{
+			permission([]string{"*"}, []string{"Microsoft.Network/*"}),
+			permission([]string{"Microsoft.Network/virtualNetworks/subnets/*"}, nil),
+		}, true},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			if actual := utils.IsActionPermitted(c.permissions, utils.SubnetJoinAction); actual != c.expected {
+				t.Errorf("IsActionPermitted() = %t, expected %t", actual, c.expected)
+			}
+		})
+	}
+}
@@ -0,0 +1,110 @@
+/*
+Portions Copyright (c) Microsoft Corporation.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package redact masks bootstrap tokens and other secrets in text bound for logs, error messages and events.
+package redact
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"regexp"
+	"strings"
+)
+
+// Value is what secrets are replaced with
+const Value = "<redacted>"
+
+var (
+	// sensitiveVariables are the variables of the bootstrap script whose values must never leave the node
+	sensitiveVariables = []string{
+		"TLS_BOOTSTRAP_TOKEN",
+		"CUSTOM_SEARCH_REALM_PASSWORD",
+		"KUBELET_CLIENT_CONTENT",
+		"KUBELET_CLIENT_CERT_CONTENT",
+		"SERVICE_PRINCIPAL_CLIENT_SECRET",
+		"SERVICE_PRINCIPAL_FILE_CONTENT",
+	}
+	sensitiveVariableRegex = regexp.MustCompile(`\b(` + strings.Join(sensitiveVariables, "|") + `)=("[^"]*"|\S*)`)
+	// bootstrapTokenRegex matches the bootstrap token format <token-id>.<token-secret>
+	bootstrapTokenRegex = regexp.MustCompile(`\b[a-z0-9]{6}\.[a-z0-9]{16}\b`)
+)
+
+// String masks the values of the sensitive variables of the bootstrap script and anything formatted as a bootstrap
+// token. Any additional known secret values (e.g. the configured bootstrap token) are masked wherever they appear.
+func String(text string, secrets ...string) string {
+	for _, secret := range secrets {
+		if secret != "" {
+			text = strings.ReplaceAll(text, secret, Value)
+		}
+	}
+	text = sensitiveVariableRegex.ReplaceAllString(text, `${1}="`+Value+`"`)
+	return bootstrapTokenRegex.ReplaceAllString(text, Value)
+}
+
+// Encodings returns the secret along with the encodings it may be echoed in, e.g. by an API rejecting a request holding
+// it: JSON escaped, and base64 encoded. They're passed to String and Error as secrets.
+func Encodings(secret string) []string {
+	if secret == "" {
+		return nil
+	}
+	escaped, _ := json.Marshal(secret)
+	return []string{
+		secret,
+		string(escaped[1 : len(escaped)-1]),
+		base64.StdEncoding.EncodeToString([]byte(secret)),
+	}
+}
+
+// Secret is a string that is masked when formatted or marshalled, for fields holding secrets in structs that may be
+// logged or rendered into error messages. Convert it back to a string where the value is needed.
+type Secret string
+
+func (s Secret) String() string {
+	if s == "" {
+		return ""
+	}
+	return Value
+}
+
+func (s Secret) GoString() string {
+	return s.String()
+}
+
+func (s Secret) MarshalJSON() ([]byte, error) {
+	return json.Marshal(s.String())
+}
+
+type redactedError struct {
+	err     error
+	message string
+}
+
+func (e *redactedError) Error() string {
+	return e.message
+}
+
+func (e *redactedError) Unwrap() error {
+	return e.err
+}
+
+// Error returns err with its message masked as with String. The error can still be unwrapped, so callers matching on
+// it are unaffected, but must not surface the message of the unwrapped errors.
+func Error(err error, secrets ...string) error {
+	if err == nil {
+		return nil
+	}
+	return &redactedError{err: err, message: String(err.Error(), secrets...)}
+}
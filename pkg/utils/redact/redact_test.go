@@ -0,0 +1,99 @@
+/*
+Portions Copyright (c) Microsoft Corporation.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package redact_test
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"sigs.k8s.io/controller-runtime/pkg/log/zap"
+	karpv1 "sigs.k8s.io/karpenter/pkg/apis/v1"
+
+	"github.com/Azure/karpenter-provider-azure/pkg/cloudprovider/events"
+	"github.com/Azure/karpenter-provider-azure/pkg/providers/imagefamily/bootstrap"
+	"github.com/Azure/karpenter-provider-azure/pkg/providers/imagefamily/customscriptsbootstrap"
+	"github.com/Azure/karpenter-provider-azure/pkg/providers/launchtemplate/parameters"
+	"github.com/Azure/karpenter-provider-azure/pkg/utils/redact"
+)
+
+const testBootstrapToken = "abcdef.0123456789abcdef"
+
+func TestBootstrapTokenIsNeverLogged(t *testing.T) {
+	output := &bytes.Buffer{}
+	logger := zap.New(zap.WriteTo(output))
+
+	aks := bootstrap.AKS{
+		Options:                        bootstrap.Options{ClusterName: "test-cluster"},
+		KubeletClientTLSBootstrapToken: testBootstrapToken,
+	}
+	staticParameters := &parameters.StaticParameters{ClusterName: "test-cluster", KubeletClientTLSBootstrapToken: testBootstrapToken}
+	provisionClientBootstrap := customscriptsbootstrap.ProvisionClientBootstrap{ClusterName: "test-cluster", KubeletClientTLSBootstrapToken: testBootstrapToken}
+
+	// structured and formatted renderings of the bootstrap options
+	logger.Info("bootstrap options", "aks", aks, "staticParameters", staticParameters, "provisionClientBootstrap", provisionClientBootstrap)
+	logger.Info(fmt.Sprintf("%v %+v %#v", aks, staticParameters, provisionClientBootstrap))
+
+	// errors of the CSE and customData paths, which can echo the command line
+	cseErr := redact.Error(fmt.Errorf("extension failed: TLS_BOOTSTRAP_TOKEN=%q /opt/azure/containers/provision_start.sh", testBootstrapToken))
+	logger.Error(fmt.Errorf("creating VM CSE for VM %q: %w", "aks-default-a1b2c", cseErr), "failed launching nodeclaim")
+
+	// event messages built from errors
+	event := events.NodeClaimFailedToRegister(&karpv1.NodeClaim{}, fmt.Errorf("bootstrap token %s rejected", testBootstrapToken))
+	logger.Info(event.Message)
+
+	assert.NotContains(t, output.String(), testBootstrapToken)
+	assert.NotContains(t, output.String(), "0123456789abcdef")
+	assert.Contains(t, output.String(), redact.Value)
+	assert.Contains(t, output.String(), "test-cluster")
+}
+
+func TestError(t *testing.T) {
+	assert.NoError(t, redact.Error(nil))
+
+	cause := errors.New("command failed: echo hunter2")
+	err := redact.Error(cause, "hunter2")
+	assert.Equal(t, "command failed: echo "+redact.Value, err.Error())
+	// matching on the cause is unaffected
+	assert.ErrorIs(t, err, cause)
+}
+
+func TestEncodings(t *testing.T) {
+	assert.Empty(t, redact.Encodings(""))
+
+	secret := "TOKEN=\"" + testBootstrapToken + "\"\n"
+	escaped, err := json.Marshal(map[string]string{"commandToExecute": secret})
+	assert.NoError(t, err)
+	cause := fmt.Errorf("invalid settings %s, encoded %s", escaped, base64.StdEncoding.EncodeToString([]byte(secret)))
+	err = redact.Error(cause, redact.Encodings(secret)...)
+	assert.Equal(t, fmt.Sprintf(`invalid settings {"commandToExecute":"%s"}, encoded %s`, redact.Value, redact.Value), err.Error())
+}
+
+func TestSecret(t *testing.T) {
+	assert.Equal(t, redact.Value, redact.Secret(testBootstrapToken).String())
+	assert.Empty(t, redact.Secret("").String(), "unset secrets are told apart from set ones")
+
+	marshalled, err := json.Marshal(struct{ Token redact.Secret }{testBootstrapToken})
+	assert.NoError(t, err)
+	var unmarshalled struct{ Token string }
+	assert.NoError(t, json.Unmarshal(marshalled, &unmarshalled))
+	assert.Equal(t, redact.Value, unmarshalled.Token)
+}
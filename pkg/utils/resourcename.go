@@ -0,0 +1,71 @@
+/*
+Portions Copyright (c) Microsoft Corporation.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package utils
+
+import (
+	"fmt"
+	"hash/fnv"
+	"strings"
+)
+
+const (
+	resourceNamePrefix = "aks-"
+	// MaxResourceNameLength is the maximum length of a VM name, and of a Linux computer name
+	MaxResourceNameLength = 64
+	// MaxWindowsComputerNameLength is the maximum length of a Windows computer name (its NetBIOS name)
+	MaxWindowsComputerNameLength = 15
+	nameHashLength               = 8
+)
+
+// ResourceName returns the name of the VM, NIC and disk of a nodeclaim, e.g. aks-default-2jf98. Names that would exceed
+// the limit of VM names are shortened, ending with a hash of the full name, so that nodeclaims whose names share a long
+// prefix still get distinct names.
+func ResourceName(nodeClaimName string) string {
+	return shortenName(resourceNamePrefix+nodeClaimName, MaxResourceNameLength)
+}
+
+// IsShortenedResourceName returns whether the resource name of the nodeclaim is shortened, in which case the nodeclaim
+// name can't be derived from the resource name
+func IsShortenedResourceName(nodeClaimName string) bool {
+	return ResourceName(nodeClaimName) != resourceNamePrefix+nodeClaimName
+}
+
+// NodeClaimNameFromResourceName returns the name of the nodeclaim of a resource name that isn't shortened
+func NodeClaimNameFromResourceName(resourceName string) string {
+	return strings.TrimPrefix(resourceName, resourceNamePrefix)
+}
+
+// ComputerName returns the computer name of a VM, which becomes the name of its node. The VM name fits the limit of
+// Linux computer names, but Windows computer names are shortened like resource names.
+func ComputerName(resourceName string, isWindows bool) string {
+	if isWindows {
+		return shortenName(resourceName, MaxWindowsComputerNameLength)
+	}
+	return shortenName(resourceName, MaxResourceNameLength)
+}
+
+// shortenName returns the name if it fits maxLength, or a prefix of it followed by a hash of the full name otherwise
+func shortenName(name string, maxLength int) string {
+	if len(name) <= maxLength {
+		return name
+	}
+	hash := fnv.New32a()
+	_, _ = hash.Write([]byte(name))
+	// hyphens and periods are trimmed from the end of the prefix, so that it doesn't run into the hyphen before the hash
+	prefix := strings.TrimRight(name[:maxLength-nameHashLength-1], "-.")
+	return fmt.Sprintf("%s-%0*x", prefix, nameHashLength, hash.Sum32())
+}
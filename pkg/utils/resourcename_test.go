@@ -0,0 +1,89 @@
+/*
+Portions Copyright (c) Microsoft Corporation.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package utils_test
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/Azure/karpenter-provider-azure/pkg/utils"
+)
+
+func TestResourceName(t *testing.T) {
+	// names within the limit are kept, and map back to their nodeclaim
+	assert.Equal(t, "aks-default-2jf98", utils.ResourceName("default-2jf98"))
+	assert.False(t, utils.IsShortenedResourceName("default-2jf98"))
+	assert.Equal(t, "default-2jf98", utils.NodeClaimNameFromResourceName(utils.ResourceName("default-2jf98")))
+
+	exactlyAtLimit := strings.Repeat("a", utils.MaxResourceNameLength-len("aks-"))
+	assert.Equal(t, "aks-"+exactlyAtLimit, utils.ResourceName(exactlyAtLimit))
+	assert.False(t, utils.IsShortenedResourceName(exactlyAtLimit))
+
+	longName := strings.Repeat("a", 100) + "-2jf98"
+	resourceName := utils.ResourceName(longName)
+	assert.Len(t, resourceName, utils.MaxResourceNameLength)
+	assert.True(t, strings.HasPrefix(resourceName, "aks-aaaa"))
+	assert.True(t, utils.IsShortenedResourceName(longName))
+	// the generation is deterministic
+	assert.Equal(t, resourceName, utils.ResourceName(longName))
+}
+
+func TestResourceNameCollisions(t *testing.T) {
+	for _, prefix := range []string{
+		strings.Repeat("a", 63),
+		strings.Repeat("nodepool-", 10),
+		// ends right at the truncation point with hyphens and periods
+		strings.Repeat("b", 50) + "-.-.-.-.-.-.-.",
+		strings.Repeat("c", 253-6),
+	} {
+		names := map[string]string{}
+		for i := range 1000 {
+			nodeClaimName := fmt.Sprintf("%s-%05d", prefix, i)
+			resourceName := utils.ResourceName(nodeClaimName)
+			assert.LessOrEqual(t, len(resourceName), utils.MaxResourceNameLength)
+			assert.False(t, strings.HasSuffix(resourceName, "-") || strings.HasSuffix(resourceName, "."), resourceName)
+			assert.NotContains(t, resourceName, "--")
+			if other, ok := names[resourceName]; ok {
+				t.Errorf("nodeclaims %s and %s have the same resource name %s", other, nodeClaimName, resourceName)
+			}
+			names[resourceName] = nodeClaimName
+		}
+	}
+}
+
+func TestComputerName(t *testing.T) {
+	assert.Equal(t, "aks-default-2jf98", utils.ComputerName("aks-default-2jf98", false))
+	resourceName := utils.ResourceName(strings.Repeat("a", 100))
+	assert.Equal(t, resourceName, utils.ComputerName(resourceName, false))
+
+	// Windows computer names are limited to 15 characters
+	assert.Equal(t, "aks-win-2jf98", utils.ComputerName("aks-win-2jf98", true))
+	names := map[string]string{}
+	for i := range 1000 {
+		resourceName := utils.ResourceName(fmt.Sprintf("windows-%05d", i))
+		computerName := utils.ComputerName(resourceName, true)
+		assert.LessOrEqual(t, len(computerName), utils.MaxWindowsComputerNameLength)
+		assert.True(t, strings.HasPrefix(computerName, "aks-"), computerName)
+		if other, ok := names[computerName]; ok {
+			t.Errorf("resources %s and %s have the same Windows computer name %s", other, resourceName, computerName)
+		}
+		names[computerName] = resourceName
+	}
+}
@@ -21,6 +21,7 @@ import (
 	"fmt"
 	"os"
 	"regexp"
+	"slices"
 	"strconv"
 	"strings"
 
@@ -165,6 +166,24 @@ var managedVNETPattern = regexp.MustCompile(`(?i)^aks-vnet-\d{8}$`)
 
 const managedSubnetName = "aks-subnet"
 
+// GetKubeletIdentityClientID resolves the client ID of the kubelet identity for a given nodeclass.
+// If not specified, defaults to the cluster's kubelet identity.
+func GetKubeletIdentityClientID(nodeClass *v1beta1.AKSNodeClass, clusterKubeletIdentityClientID string) string {
+	if nodeClass == nil || nodeClass.Spec.KubeletIdentityClientID == nil {
+		return clusterKubeletIdentityClientID
+	}
+	return *nodeClass.Spec.KubeletIdentityClientID
+}
+
+// GetNodeIdentities resolves the user-assigned identities assigned to the VMs of a given nodeclass:
+// the node identities of the cluster, and the kubelet identity of the nodeclass, if specified.
+func GetNodeIdentities(nodeClass *v1beta1.AKSNodeClass, nodeIdentities []string) []string {
+	if nodeClass == nil || nodeClass.Spec.KubeletIdentityResourceID == nil {
+		return nodeIdentities
+	}
+	return lo.UniqBy(append(slices.Clone(nodeIdentities), *nodeClass.Spec.KubeletIdentityResourceID), strings.ToLower)
+}
+
 // IsAKSManagedVNET determines if the vnet managed or not.
 // Note: You can "trick" this function if you really try by (for example) createding a VNET that looks like
 // an AKS managed VNET, with the same resource group as the MC RG, in a different subscription, or by creating
@@ -17,12 +17,15 @@ limitations under the License.
 package utils_test
 
 import (
+	"strings"
 	"testing"
 
+	"github.com/Azure/karpenter-provider-azure/pkg/test"
 	"github.com/Azure/karpenter-provider-azure/pkg/utils"
 	"github.com/Azure/skewer"
 	"github.com/mitchellh/hashstructure/v2"
 	. "github.com/onsi/gomega"
+	"github.com/samber/lo"
 )
 
 func TestIsAKSManagedVNET(t *testing.T) {
@@ -170,3 +173,23 @@ func TestExtractVersionFromVMSize(t *testing.T) {
 		})
 	}
 }
+
+func TestGetNodeIdentities(t *testing.T) {
+	g := NewWithT(t)
+	clusterIdentity := "/subscriptions/00000000-0000-0000-0000-000000000000/resourceGroups/MC_rg/providers/Microsoft.ManagedIdentity/userAssignedIdentities/kubelet"
+	nodeClassIdentity := "/subscriptions/00000000-0000-0000-0000-000000000000/resourceGroups/rg/providers/Microsoft.ManagedIdentity/userAssignedIdentities/pool-kubelet"
+
+	nodeClass := test.AKSNodeClass()
+	g.Expect(utils.GetNodeIdentities(nodeClass, []string{clusterIdentity})).To(Equal([]string{clusterIdentity}))
+	g.Expect(utils.GetKubeletIdentityClientID(nodeClass, "cluster-client-id")).To(Equal("cluster-client-id"))
+
+	nodeClass.Spec.KubeletIdentityResourceID = lo.ToPtr(nodeClassIdentity)
+	nodeClass.Spec.KubeletIdentityClientID = lo.ToPtr("pool-client-id")
+	nodeIdentities := []string{clusterIdentity}
+	g.Expect(utils.GetNodeIdentities(nodeClass, nodeIdentities)).To(Equal([]string{clusterIdentity, nodeClassIdentity}))
+	g.Expect(nodeIdentities).To(Equal([]string{clusterIdentity}), "the cluster node identities must not be modified")
+	g.Expect(utils.GetKubeletIdentityClientID(nodeClass, "cluster-client-id")).To(Equal("pool-client-id"))
+
+	// resource IDs are case-insensitive
+	g.Expect(utils.GetNodeIdentities(nodeClass, []string{strings.ToUpper(nodeClassIdentity)})).To(Equal([]string{strings.ToUpper(nodeClassIdentity)}))
+}
@@ -98,8 +98,9 @@ var _ = Describe("Inplace Update", func() {
 			expectedTags := lo.Assign(
 				nodeClass.Spec.Tags,
 				map[string]string{
-					"karpenter.azure.com_cluster": env.ClusterName,
-					"karpenter.sh_nodepool":       nodePool.Name,
+					"karpenter.azure.com_cluster":      env.ClusterName,
+					"karpenter.sh_nodepool":            nodePool.Name,
+					"karpenter.azure.com_aksnodeclass": nodeClass.Name,
 				})
 
 			env.ExpectUpdated(nodeClass)
@@ -192,8 +193,9 @@ var _ = Describe("Inplace Update", func() {
 			expectedTags := lo.Assign(
 				nodeClass.Spec.Tags,
 				map[string]string{
-					"karpenter.azure.com_cluster": env.ClusterName,
-					"karpenter.sh_nodepool":       nodePool.Name,
+					"karpenter.azure.com_cluster":      env.ClusterName,
+					"karpenter.sh_nodepool":            nodePool.Name,
+					"karpenter.azure.com_aksnodeclass": nodeClass.Name,
 				})
 
 			env.ExpectUpdated(nodeClass)
@@ -21,6 +21,7 @@ import (
 	"github.com/samber/lo"
 
 	"github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/network/armnetwork"
+	"github.com/Azure/karpenter-provider-azure/pkg/providers/launchtemplate"
 	azkarptest "github.com/Azure/karpenter-provider-azure/pkg/test"
 )
 
@@ -29,7 +30,9 @@ var _ = Describe("gc", func() {
 		env.ExpectCreatedInterface(armnetwork.Interface{
 			Name:     lo.ToPtr("orphan-nic"),
 			Location: lo.ToPtr(env.Region),
-			Tags:     azkarptest.ManagedTags("default"),
+			Tags: lo.Assign(azkarptest.ManagedTags("default"), map[string]*string{
+				launchtemplate.KarpenterManagedTagKey: lo.ToPtr(env.ClusterName),
+			}),
 			Properties: &armnetwork.InterfacePropertiesFormat{
 				IPConfigurations: []*armnetwork.InterfaceIPConfiguration{
 					{
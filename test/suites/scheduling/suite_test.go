@@ -129,8 +129,13 @@ var _ = Describe("Scheduling", Ordered, ContinueOnFailure, func() {
 				v1beta1.AKSLabelCPU:                       "2",
 				v1beta1.AKSLabelMemory:                    "8192",
 				v1beta1.LabelSKUAcceleratedNetworking:     "true",
+				v1beta1.LabelSKUNetworkingBandwidth:       "1000",
 				v1beta1.LabelSKUStoragePremiumCapable:     "true",
 				v1beta1.LabelSKUStorageEphemeralOSMaxSize: "53",
+				v1beta1.LabelSKUStorageLocalProtocol:      "scsi",
+				v1beta1.LabelSKUStorageLocalCount:         "1",
+				v1beta1.LabelSKUStorageLocalSize:          "17",
+				v1beta1.LabelSKUConfidentialComputing:     v1beta1.ConfidentialComputingNone,
 			}
 			selectors.Insert(lo.Keys(nodeSelector)...) // Add node selector keys to selectors used in testing to ensure we test all labels
 			requirements := lo.MapToSlice(nodeSelector, func(key string, value string) corev1.NodeSelectorRequirement {
@@ -145,6 +150,18 @@ var _ = Describe("Scheduling", Ordered, ContinueOnFailure, func() {
 			env.EventuallyExpectHealthyPodCount(labels.SelectorFromSet(deployment.Spec.Selector.MatchLabels), int(*deployment.Spec.Replicas))
 			env.ExpectCreatedNodeCount("==", 1)
 		})
+		It("should support the image family label, overriding the image family of the nodeclass", func() {
+			nodeSelector := map[string]string{
+				v1beta1.LabelImageFamily: v1beta1.AzureLinuxImageFamily,
+			}
+			selectors.Insert(lo.Keys(nodeSelector)...) // Add node selector keys to selectors used in testing to ensure we test all labels
+			nodeClass.Spec.ImageFamily = lo.ToPtr(v1beta1.Ubuntu2204ImageFamily)
+			pod := test.Pod(test.PodOptions{NodeSelector: nodeSelector})
+			env.ExpectCreated(nodeClass, nodePool, pod)
+			env.EventuallyExpectHealthy(pod)
+			env.ExpectCreatedNodeCount("==", 1)
+			Expect(env.GetNode(pod.Spec.NodeName).Status.NodeInfo.OSImage).To(ContainSubstring("Azure Linux"))
+		})
 		It("should support well-known deprecated labels -- beta.kubernetes.io/instance-type", func() {
 			// NOTE: this isn't tested alongside the rest of the deprecated labels, because the restriction for
 			// instance type + zone is flaky when receiving zonal allocation errors from azure